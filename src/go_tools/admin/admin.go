@@ -0,0 +1,252 @@
+// Package admin is the tool servers' admin API, under /admin/ on each, for
+// what an operator would otherwise restart a process to do: list and
+// kick the relay's clients, reload a level pack, see the analysis jobs
+// running, or turn logging up while chasing a problem. Requests need a
+// token with the admin scope, its reads admin:read; a server without a
+// tokens file lets only loopback clients in, so a dev machine's admin API
+// isn't open to the network it serves playtests on.
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/logging"
+)
+
+// Prefix is where a server mounts its API
+const Prefix = "/admin/"
+
+// maxBody bounds a request's body
+const maxBody = 1 << 20
+
+// Registrar is a server with operations of its own to add
+type Registrar interface {
+	RegisterAdmin(a *API)
+}
+
+// Op is one operation of an API
+type Op struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Doc    string `json:"doc"`
+}
+
+// Info is what GET /admin/ answers
+type Info struct {
+	Server        string  `json:"server"`
+	Host          string  `json:"host"`
+	PID           int     `json:"pid"`
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+	LogLevel      string  `json:"logLevel"`
+	Ops           []Op    `json:"ops"`
+}
+
+// API is a server's admin endpoints. Every server has
+//
+//	GET /admin/             the server, its uptime and log level, and the operations it has
+//	GET /admin/log-level    the log level
+//	PUT /admin/log-level    set it, to debug, info, warn or error, as the body or ?level=
+//
+// and adds its own with Handle.
+type API struct {
+	server   string
+	started  time.Time
+	loopback bool // no keyring checks tokens, so only loopback clients are let in
+	mux      *http.ServeMux
+	ops      []Op
+}
+
+// New is the API of a server; keys is the keyring checking its tokens, nil
+// for none
+func New(server string, keys *auth.Keyring) *API {
+	a := &API{server: server, started: time.Now(), loopback: keys == nil, mux: http.NewServeMux()}
+	a.Handle("GET "+Prefix+"{$}", "the server, its uptime and log level, and these operations", a.info)
+	a.Handle("GET "+Prefix+"log-level", "the log level", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]string{"level": logging.Level()})
+	})
+	a.Handle("PUT "+Prefix+"log-level", "set the log level: debug, info, warn or error", a.setLevel)
+	return a
+}
+
+// Handle adds an operation: pattern is an http.ServeMux pattern with a
+// method, such as "DELETE /admin/rooms/{code}", and doc what it does
+func (a *API) Handle(pattern, doc string, h http.HandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	a.mux.HandleFunc(pattern, h)
+	a.ops = append(a.ops, Op{Method: method, Path: strings.TrimSuffix(path, "{$}"), Doc: doc})
+}
+
+// Mount serves the API under Prefix and next for everything else
+func Mount(a *API, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsAdmin(r) {
+			a.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsAdmin reports whether a request is to the admin API
+func IsAdmin(r *http.Request) bool {
+	return r.URL.Path == strings.TrimSuffix(Prefix, "/") || strings.HasPrefix(r.URL.Path, Prefix)
+}
+
+// Surface is the surface function of a server that is all one surface
+// but its admin API
+func Surface(name string) func(*http.Request) string {
+	return func(r *http.Request) string {
+		if IsAdmin(r) {
+			return auth.SurfaceAdmin
+		}
+		return name
+	}
+}
+
+// ServeHTTP routes the request to its operation
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.loopback && !fromLoopback(r) {
+		Error(w, http.StatusForbidden, "the admin API takes only loopback clients without a tokens file")
+		return
+	}
+	if r.URL.Path == strings.TrimSuffix(Prefix, "/") {
+		r.URL.Path = Prefix
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+	if _, pattern := a.mux.Handler(r); pattern == "" {
+		Error(w, http.StatusNotFound, "no admin operation %s %s; GET %s lists them", r.Method, r.URL.Path, Prefix)
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *API) info(w http.ResponseWriter, r *http.Request) {
+	host, _ := os.Hostname()
+	ops := append([]Op(nil), a.ops...)
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Path < ops[j].Path })
+	WriteJSON(w, http.StatusOK, Info{Server: a.server, Host: host, PID: os.Getpid(),
+		UptimeSeconds: time.Since(a.started).Seconds(), LogLevel: logging.Level(), Ops: ops})
+}
+
+func (a *API) setLevel(w http.ResponseWriter, r *http.Request) {
+	level := r.URL.Query().Get("level")
+	if level == "" {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			Error(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		var body struct {
+			Level string `json:"level"`
+		}
+		if json.Unmarshal(data, &body) == nil {
+			level = body.Level
+		} else {
+			level = strings.TrimSpace(string(data))
+		}
+	}
+	was := logging.Level()
+	if err := logging.SetLevel(level); err != nil {
+		Error(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	logging.Logger().Info("admin: log level changed", "from", was, "to", logging.Level(), "by", r.RemoteAddr)
+	WriteJSON(w, http.StatusOK, map[string]string{"level": logging.Level()})
+}
+
+func fromLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// WriteJSON answers with v as JSON
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Error answers with a JSON error
+func Error(w http.ResponseWriter, status int, format string, args ...any) {
+	WriteJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+// Client calls a server's admin API, presenting the token of
+// auth.TokenEnv
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// NewClient calls the admin API of the server at rawURL, such as
+// http://host:8097
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("server URL %s isn't http or https", rawURL)
+	}
+	u.RawQuery, u.Fragment = "", ""
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), strings.TrimSuffix(Prefix, "/"))
+	return &Client{base: u.String(), token: os.Getenv(auth.TokenEnv), http: certs.HTTPClient(time.Minute)}, nil
+}
+
+// Do calls the operation at path, under Prefix, with body as JSON if not
+// nil, decoding the answer into v if not nil
+func (c *Client) Do(ctx context.Context, method, path string, body, v any) error {
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+Prefix+strings.TrimPrefix(path, "/"), rd)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	auth.SetHeader(req.Header, c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var reply struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&reply)
+		if reply.Error == "" {
+			reply.Error = resp.Status
+		}
+		return fmt.Errorf("%s %s: %s", method, path, reply.Error)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
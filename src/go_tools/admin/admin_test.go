@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/logging"
+)
+
+func TestAPI(t *testing.T) {
+	defer logging.SetLevel(logging.Level())
+	a := New("relay", nil)
+	a.Handle("GET /admin/rooms", "rooms", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, []string{"GAME"})
+	})
+	srv := httptest.NewServer(Mount(a, http.NotFoundHandler()))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var in Info
+	if err := c.Do(ctx, http.MethodGet, "", nil, &in); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, op := range in.Ops {
+		paths = append(paths, op.Method+" "+op.Path)
+	}
+	if in.Server != "relay" || strings.Join(paths, ",") != "GET /admin/,GET /admin/log-level,PUT /admin/log-level,GET /admin/rooms" {
+		t.Errorf("info = %+v", in)
+	}
+	var rooms []string
+	if err := c.Do(ctx, http.MethodGet, "rooms", nil, &rooms); err != nil || len(rooms) != 1 {
+		t.Errorf("rooms = %v, %v", rooms, err)
+	}
+
+	var level struct{ Level string }
+	if err := c.Do(ctx, http.MethodPut, "log-level", map[string]string{"level": "DEBUG"}, &level); err != nil || level.Level != "debug" {
+		t.Fatalf("set level = %+v, %v", level, err)
+	}
+	if !logging.Logger().Enabled(ctx, slog.LevelDebug) {
+		t.Error("debug not logged after the level was set to it")
+	}
+	if err := c.Do(ctx, http.MethodPut, "log-level", map[string]string{"level": "loud"}, nil); err == nil || !strings.Contains(err.Error(), "unknown log level") {
+		t.Errorf("set an unknown level: %v", err)
+	}
+	if err := c.Do(ctx, http.MethodPost, "rooms/GAME/restart", nil, nil); err == nil || !strings.Contains(err.Error(), "no admin operation") {
+		t.Errorf("unknown operation: %v", err)
+	}
+}
+
+func TestAPIWithoutTokensTakesLoopbackOnly(t *testing.T) {
+	a := New("packs", nil)
+	for addr, want := range map[string]int{"127.0.0.1:5000": http.StatusOK, "[::1]:5000": http.StatusOK, "192.0.2.7:5000": http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodGet, "/admin/", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		if w.Code != want {
+			var reply map[string]string
+			json.NewDecoder(w.Body).Decode(&reply)
+			t.Errorf("from %s: %d %v, want %d", addr, w.Code, reply, want)
+		}
+	}
+}
+
+func TestSurface(t *testing.T) {
+	surface := Surface("relay")
+	for path, want := range map[string]string{"/admin": "admin", "/admin/rooms": "admin", "/rooms": "relay", "/administrator": "relay"} {
+		if got := surface(httptest.NewRequest(http.MethodGet, path, nil)); got != want {
+			t.Errorf("surface of %s = %s, want %s", path, got, want)
+		}
+	}
+}
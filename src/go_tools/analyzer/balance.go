@@ -0,0 +1,120 @@
+package analyzer
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// WinRate is how often players in some group won
+type WinRate struct {
+	Key   string  `json:"key"`
+	Games int     `json:"games"`
+	Wins  int     `json:"wins"`
+	Rate  float64 `json:"rate"`
+}
+
+// BalanceReport summarizes game balance over a set of replays
+type BalanceReport struct {
+	Generated      time.Time         `json:"generated"`
+	Sessions       int               `json:"sessions"`
+	Spells         []WinRate         `json:"spells"`        // players who cast the spell at least once
+	SpecialBlocks  []WinRate         `json:"specialBlocks"` // players who triggered the special block
+	Levels         []WinRate         `json:"levels"`        // solo clears and first-player wins per level
+	FirstPlayer    WinRate           `json:"firstPlayer"`   // first-listed player in matches of two or more
+	AverageMatchMs float64           `json:"averageMatchMs"`
+	SpellUsage     []SpellUsage      `json:"spellUsage"`
+	Funnels        []Funnel          `json:"funnels,omitempty"`   // filled in when a client event log is available
+	Retention      []RetentionCohort `json:"retention,omitempty"` // likewise
+	Passes         []*Table          `json:"passes,omitempty"`    // tables emitted by registered analysis passes
+}
+
+// winCounter accumulates games and wins per key
+type winCounter map[string]*WinRate
+
+func (c winCounter) add(key string, won bool) {
+	w, ok := c[key]
+	if !ok {
+		w = &WinRate{Key: key}
+		c[key] = w
+	}
+	w.Games++
+	if won {
+		w.Wins++
+	}
+}
+
+// sorted returns the counts with their rates filled in, ordered by key
+func (c winCounter) sorted() []WinRate {
+	out := make([]WinRate, 0, len(c))
+	for _, w := range c {
+		out = append(out, w.withRate())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+func (w WinRate) withRate() WinRate {
+	if w.Games > 0 {
+		w.Rate = float64(w.Wins) / float64(w.Games)
+	}
+	return w
+}
+
+// AnalyzeGameBalance computes win rates per spell, special block and level,
+// the first player's advantage, the average session length and how each
+// spell is used
+func AnalyzeGameBalance(replays []*replay.Replay) BalanceReport {
+	report := BalanceReport{Generated: time.Now(), Sessions: len(replays)}
+	spells, specials, levels := winCounter{}, winCounter{}, winCounter{}
+	first := WinRate{Key: "first player"}
+	var totalMs int64
+
+	for _, r := range replays {
+		totalMs += r.Result.DurationMs
+		cast := make(map[string]map[string]bool)
+		for _, sc := range r.Spells {
+			if cast[sc.Player] == nil {
+				cast[sc.Player] = make(map[string]bool)
+			}
+			cast[sc.Player][sc.Spell] = true
+		}
+		triggered := make(map[string]map[string]bool)
+		for _, ev := range r.EventsOf(replay.EventSpecial) {
+			if triggered[ev.Player] == nil {
+				triggered[ev.Player] = make(map[string]bool)
+			}
+			triggered[ev.Player][ev.Detail] = true
+		}
+
+		for _, p := range r.Players {
+			won := r.Won(p.ID)
+			for spell := range cast[p.ID] {
+				spells.add(spell, won)
+			}
+			for kind := range triggered[p.ID] {
+				specials.add(kind, won)
+			}
+		}
+		if len(r.Players) > 0 {
+			levels.add(r.Level, r.Won(r.Players[0].ID))
+		}
+		if len(r.Players) > 1 && r.Result.Winner != "" {
+			first.Games++
+			if r.Result.Winner == r.Players[0].ID {
+				first.Wins++
+			}
+		}
+	}
+
+	report.Spells = spells.sorted()
+	report.SpecialBlocks = specials.sorted()
+	report.Levels = levels.sorted()
+	report.FirstPlayer = first.withRate()
+	report.SpellUsage = AnalyzeSpellUsage(replays)
+	if len(replays) > 0 {
+		report.AverageMatchMs = float64(totalMs) / float64(len(replays))
+	}
+	return report
+}
@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+)
+
+var balanceTemplate = template.Must(template.New("balance").Funcs(template.FuncMap{
+	"chart":   winRateChart,
+	"percent": func(v float64) string { return fmt.Sprintf("%.1f%%", v*100) },
+	"seconds": func(ms float64) string { return i18n.T("report.seconds", ms/1000) },
+	"timing":  timingChart,
+	"delta":   func(v float64) string { return i18n.T("report.delta", v*100) },
+	"section": func(title string, rates []WinRate) balanceSection { return balanceSection{title, rates} },
+	"cell":    formatValue,
+	"t":       i18n.T,
+	"locale":  i18n.Locale,
+}).Parse(`<!DOCTYPE html>
+<html lang="{{locale}}">
+<head>
+<meta charset="utf-8">
+<title>{{t "report.title"}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { padding: 4px 12px; border-bottom: 1px solid #ddd; text-align: left; }
+td.num { text-align: right; }
+section { margin-bottom: 2em; }
+</style>
+</head>
+<body>
+<h1>{{t "report.heading"}}</h1>
+<p>{{t "report.generated" (.Generated.Format "2006-01-02 15:04") .Sessions}}
+{{t "report.average_length" (seconds .AverageMatchMs)}}</p>
+<p>{{t "report.first_player" (percent .FirstPlayer.Rate) .FirstPlayer.Games}}</p>
+{{template "section" (section (t "report.by_spell") .Spells)}}
+{{template "section" (section (t "report.by_special") .SpecialBlocks)}}
+{{template "section" (section (t "report.by_level") .Levels)}}
+<section>
+<h2>{{t "report.spell_usage"}}</h2>
+<table>
+<tr><th>{{t "report.spell"}}</th><th>{{t "report.casts"}}</th><th>{{t "report.pick_rate"}}</th><th>{{t "report.mean_cast"}}</th><th>{{t "report.timing"}}</th><th>{{t "report.caster_win_rate"}}</th><th>{{t "report.delta_column"}}</th><th>{{t "report.top_target"}}</th></tr>
+{{range .SpellUsage}}<tr><td>{{.Spell}}</td><td class="num">{{.Casts}}</td><td class="num">{{percent .PickRate}}</td><td class="num">{{t "report.seconds" .MeanCastSec}}</td><td>{{timing .Timing}}</td><td class="num">{{percent .CasterWins}}</td><td class="num">{{delta .WinRateDelta}}</td><td>{{.TopTarget}}</td></tr>
+{{end}}</table>
+</section>
+{{if .Funnels}}<section>
+<h2>{{t "report.funnels"}}</h2>
+{{range .Funnels}}<h3>{{t "report.version" .Version}}</h3>
+<table>
+<tr><th>{{t "report.step"}}</th><th>{{t "report.players"}}</th><th>{{t "report.conversion"}}</th><th>{{t "report.drop_off"}}</th><th>{{t "report.overall"}}</th></tr>
+{{range .Steps}}<tr><td>{{.Step}}</td><td class="num">{{.Players}}</td><td class="num">{{percent .Conversion}}</td><td class="num">{{percent .DropOff}}</td><td class="num">{{percent .Overall}}</td></tr>
+{{end}}</table>
+{{end}}</section>
+{{end}}{{if .Retention}}<section>
+<h2>{{t "report.retention"}}</h2>
+<table>
+<tr><th>{{t "report.cohort"}}</th><th>{{t "report.by"}}</th><th>{{t "report.group"}}</th><th>{{t "report.installs"}}</th>{{range (index .Retention 0).Days}}<th>{{t "report.day" .Day}}</th>{{end}}</tr>
+{{range .Retention}}<tr><td>{{.Cohort}}</td><td>{{.By}}</td><td>{{.Group}}</td><td class="num">{{.Installs}}</td>{{range .Days}}<td class="num">{{if .Eligible}}{{percent .Rate}}{{else}}-{{end}}</td>{{end}}</tr>
+{{end}}</table>
+</section>
+{{end}}{{range .Passes}}<section>
+<h2>{{.Name}}</h2>
+<table><tr>{{range .Columns}}<th>{{.Name}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{cell .}}</td>{{end}}</tr>
+{{end}}</table>
+</section>
+{{end}}</body>
+</html>
+{{define "section"}}<section>
+<h2>{{.Title}}</h2>
+{{if .Rates}}{{chart .Rates}}
+<table>
+<tr><th>{{t "report.key"}}</th><th>{{t "report.games"}}</th><th>{{t "report.wins"}}</th><th>{{t "report.win_rate"}}</th></tr>
+{{range .Rates}}<tr><td>{{.Key}}</td><td class="num">{{.Games}}</td><td class="num">{{.Wins}}</td><td class="num">{{percent .Rate}}</td></tr>
+{{end}}</table>
+{{else}}<p>{{t "report.no_data"}}</p>
+{{end}}</section>{{end}}
+`))
+
+type balanceSection struct {
+	Title string
+	Rates []WinRate
+}
+
+// winRateChart draws win rates as an inline SVG bar chart with a 50% line
+func winRateChart(rates []WinRate) template.HTML {
+	const (
+		labelWidth = 160
+		barWidth   = 400
+		rowHeight  = 22
+	)
+	height := len(rates)*rowHeight + 10
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-size="12">`, labelWidth+barWidth+60, height)
+	for i, r := range rates {
+		y := i*rowHeight + 5
+		fmt.Fprintf(&sb, `<text x="0" y="%d">%s</text>`, y+14, html.EscapeString(r.Key))
+		fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="#4a7ebb"/>`, labelWidth, y, r.Rate*barWidth, rowHeight-6)
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d">%.0f%%</text>`, float64(labelWidth)+r.Rate*barWidth+4, y+14, r.Rate*100)
+	}
+	fmt.Fprintf(&sb, `<line x1="%d" y1="0" x2="%d" y2="%d" stroke="#c00" stroke-dasharray="4"/>`, labelWidth+barWidth/2, labelWidth+barWidth/2, height)
+	sb.WriteString(`</svg>`)
+	return template.HTML(sb.String())
+}
+
+// timingChart draws a cast timing histogram as a small inline SVG
+func timingChart(buckets []int) template.HTML {
+	const barWidth, height = 6, 20
+	max := 0
+	for _, b := range buckets {
+		if b > max {
+			max = b
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`, len(buckets)*barWidth, height)
+	for i, b := range buckets {
+		if max == 0 {
+			break
+		}
+		h := float64(b*height) / float64(max)
+		fmt.Fprintf(&sb, `<rect x="%d" y="%.1f" width="%d" height="%.1f" fill="#4a7ebb"/>`, i*barWidth, height-h, barWidth-1, h)
+	}
+	sb.WriteString(`</svg>`)
+	return template.HTML(sb.String())
+}
+
+// WriteHTML renders the report as a self-contained HTML page
+func (r BalanceReport) WriteHTML(w io.Writer) error {
+	return balanceTemplate.Execute(w, r)
+}
+
+// SaveHTML writes the HTML report to path
+func (r BalanceReport) SaveHTML(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteHTML(f); err != nil {
+		f.Close()
+		return fmt.Errorf("render %s: %w", path, err)
+	}
+	return f.Close()
+}
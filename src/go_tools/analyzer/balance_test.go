@@ -0,0 +1,112 @@
+package analyzer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// balanceReplays are two matches on caves, the first player winning one,
+// and a solo clear of a level whose name needs escaping
+func balanceReplays() []*replay.Replay {
+	duo := []replay.Player{{ID: "a"}, {ID: "b"}}
+	return []*replay.Replay{
+		{
+			Level: "caves", Players: duo,
+			Spells: []replay.SpellCast{
+				{TimeMs: 6000, Player: "a", Spell: level.SpellClearLine},
+				{TimeMs: 30000, Player: "a", Spell: level.SpellSpeedUp, Target: "b"},
+			},
+			Events: []replay.Event{{Type: replay.EventSpecial, Player: "b", Detail: level.SpecialBomb}},
+			Result: replay.Result{Winner: "a", DurationMs: 60000},
+		},
+		{
+			Level: "caves", Players: duo,
+			Spells: []replay.SpellCast{
+				{TimeMs: 29999, Player: "a", Spell: level.SpellClearLine, Target: "a"},
+				{TimeMs: 3000, Player: "b", Spell: level.SpellSlowDown, Target: "b"},
+				{TimeMs: 4000, Player: "b", Spell: "METEOR"},
+			},
+			Result: replay.Result{Winner: "b", DurationMs: 30000},
+		},
+		{
+			Level: "<pit>", Players: []replay.Player{{ID: "c"}},
+			Spells: []replay.SpellCast{{TimeMs: 45000, Player: "c", Spell: level.SpellClearLine, Target: "c"}},
+			Result: replay.Result{Outcome: replay.OutcomeCleared, DurationMs: 90000},
+		},
+	}
+}
+
+func TestAnalyzeGameBalanceWinRates(t *testing.T) {
+	report := AnalyzeGameBalance(balanceReplays())
+	rate := func(key string, games, wins int) WinRate {
+		return WinRate{Key: key, Games: games, Wins: wins}.withRate()
+	}
+	want := map[string][]WinRate{
+		"spells":   {rate(level.SpellClearLine, 3, 2), rate("METEOR", 1, 1), rate(level.SpellSlowDown, 1, 1), rate(level.SpellSpeedUp, 1, 1)},
+		"specials": {rate(level.SpecialBomb, 1, 0)},
+		"levels":   {rate("<pit>", 1, 1), rate("caves", 2, 1)},
+	}
+	got := map[string][]WinRate{"spells": report.Spells, "specials": report.SpecialBlocks, "levels": report.Levels}
+	for k, w := range want {
+		if !reflect.DeepEqual(got[k], w) {
+			t.Errorf("%s = %+v, want %+v", k, got[k], w)
+		}
+	}
+	if report.FirstPlayer != rate("first player", 2, 1) {
+		t.Errorf("first player %+v", report.FirstPlayer)
+	}
+	if report.Sessions != 3 || report.AverageMatchMs != 60000 {
+		t.Errorf("%d sessions averaging %vms", report.Sessions, report.AverageMatchMs)
+	}
+	if len(report.SpellUsage) != len(level.Spells) {
+		t.Errorf("spell usage covers %d spells", len(report.SpellUsage))
+	}
+}
+
+func TestBalanceHTMLIsSelfContained(t *testing.T) {
+	if err := i18n.SetLocale(i18n.DefaultLocale); err != nil {
+		t.Fatal(err)
+	}
+	report := AnalyzeGameBalance(balanceReplays())
+	report.Generated = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	report.SpecialBlocks = nil
+
+	var out bytes.Buffer
+	if err := report.WriteHTML(&out); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	for _, want := range []string{
+		`<html lang="en">`,
+		"<h1>" + i18n.T("report.heading") + "</h1>",
+		i18n.T("report.generated", "2024-03-01 12:30", 3),
+		i18n.T("report.first_player", "50.0%", 2),
+		"<td>caves</td><td class=\"num\">2</td><td class=\"num\">1</td><td class=\"num\">50.0%</td>",
+		`<text x="0" y="19">&lt;pit&gt;</text>`,
+		"<td>&lt;pit&gt;</td>",
+		"<p>" + i18n.T("report.no_data") + "</p>", // the emptied special blocks
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the report lacks %s", want)
+		}
+	}
+	if strings.Contains(page, "<pit>") {
+		t.Error("a level name went into the report unescaped")
+	}
+	for _, external := range []string{"<script", "<link", " src=", " href="} {
+		if strings.Contains(page, external) {
+			t.Errorf("the report loads something from outside it: %s", external)
+		}
+	}
+	// Two charts with a 50% line each, for spells and levels
+	if n := strings.Count(page, `stroke-dasharray="4"`); n != 2 {
+		t.Errorf("%d win rate charts, want 2", n)
+	}
+}
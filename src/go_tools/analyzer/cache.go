@@ -0,0 +1,123 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// cacheVersion is part of every cache key; bump it when a cached
+// computation changes so stale results are recomputed
+const cacheVersion = 1
+
+// Cache stores per-replay and per-level intermediate results on disk,
+// keyed by the content hash of the files they came from, so rerunning
+// analysis on a growing dataset only does the expensive work for new files
+type Cache struct {
+	dir   string
+	force bool
+
+	mu           sync.Mutex
+	hits, misses int
+	err          error // first failed write
+}
+
+// OpenCache opens the cache in dir, creating it if needed. With force,
+// every result is recomputed and rewritten, ignoring what is cached.
+func OpenCache(dir string, force bool) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("open cache: %w", err)
+	}
+	return &Cache{dir: dir, force: force}, nil
+}
+
+// Stats returns how many lookups were served from the cache and how many
+// had to be computed
+func (c *Cache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Err returns the first error writing to the cache; failed writes don't
+// stop analysis, they only make the next run slower
+func (c *Cache) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// cached returns the result stored under kind and the key parts, or
+// computes it with fn and stores it. A nil cache, or a key part that is
+// empty because its input wasn't loaded from a file, always computes.
+func cached[T any](c *Cache, kind string, fn func() T, parts ...string) T {
+	if c == nil {
+		return fn()
+	}
+	for _, p := range parts {
+		if p == "" {
+			return fn()
+		}
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%s", cacheVersion, kind)
+	for _, p := range parts {
+		fmt.Fprintf(h, "\x00%s", p)
+	}
+	path := filepath.Join(c.dir, kind, hex.EncodeToString(h.Sum(nil))+".json")
+
+	if !c.force {
+		var v T
+		if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &v) == nil {
+			c.mu.Lock()
+			c.hits++
+			c.mu.Unlock()
+			return v
+		}
+	}
+	v := fn()
+	err := c.write(path, v)
+	c.mu.Lock()
+	c.misses++
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	return v
+}
+
+// write stores v as JSON through a temporary file, so concurrent or
+// interrupted runs never leave a truncated entry behind
+func (c *Cache) write(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// contentHash identifies a file's contents
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestCacheReusesResultsForUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	replays := filepath.Join(dir, "replays")
+	r := &replay.Replay{SessionID: "s1", Level: "pit", Players: []replay.Player{{ID: "p"}},
+		Events: []replay.Event{{Frame: 1, Player: "p", Type: replay.EventLock, Piece: "O", X: 0, Y: 18}}}
+	if err := os.MkdirAll(replays, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(filepath.Join(replays, "s1.json")); err != nil {
+		t.Fatal(err)
+	}
+	fallback := level.GridSize{Width: 10, Height: 20}
+
+	load := func(force bool) (*Dataset, *Cache) {
+		cache, err := OpenCache(filepath.Join(dir, "cache"), force)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := NewDataset()
+		data.Cache = cache
+		if err := data.LoadReplays(replays); err != nil {
+			t.Fatal(err)
+		}
+		return data, cache
+	}
+
+	data, cache := load(false)
+	first := data.ReplayComplexity(data.Replays[0], fallback)
+	if hits, misses := cache.Stats(); hits != 0 || misses != 1 || len(first) != 1 {
+		t.Fatalf("first run: %d hits, %d misses, %d frames", hits, misses, len(first))
+	}
+
+	data, cache = load(false)
+	again := data.ReplayComplexity(data.Replays[0], fallback)
+	if hits, misses := cache.Stats(); hits != 1 || misses != 0 {
+		t.Errorf("second run: %d hits, %d misses", hits, misses)
+	}
+	if !reflect.DeepEqual(first, again) {
+		t.Errorf("cached %+v, computed %+v", again, first)
+	}
+	data.ReplayComplexity(data.Replays[0], level.GridSize{Width: 8, Height: 16})
+	if _, misses := cache.Stats(); misses != 1 {
+		t.Error("another board size reused the cached frames")
+	}
+
+	data, cache = load(true)
+	data.ReplayComplexity(data.Replays[0], fallback)
+	if hits, misses := cache.Stats(); hits != 0 || misses != 1 {
+		t.Errorf("forced run: %d hits, %d misses", hits, misses)
+	}
+	if err := cache.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCacheSkipsDataNotFromFiles(t *testing.T) {
+	cache, err := OpenCache(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := NewDataset()
+	data.Cache = cache
+	data.Replays = []*replay.Replay{{SessionID: "mem", Players: []replay.Player{{ID: "p"}}}}
+	data.AnalyzeTechniques(level.GridSize{Width: 10, Height: 20})
+	if hits, misses := cache.Stats(); hits+misses != 0 {
+		t.Errorf("in-memory replay went through the cache: %d hits, %d misses", hits, misses)
+	}
+}
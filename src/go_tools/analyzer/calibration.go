@@ -0,0 +1,221 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// calibrationPrior is how many sessions' worth of evidence keeps the
+// suggested weights near the current ones, so a handful of levels can't
+// swing the model
+const calibrationPrior = 20
+
+// CalibrationOptions tune the calibration pass
+type CalibrationOptions struct {
+	Bins        int // calibration curve buckets over the predicted score
+	MinSessions int // levels with fewer solo sessions are left out
+}
+
+// DefaultCalibrationOptions returns the settings of the calibration pass
+func DefaultCalibrationOptions() CalibrationOptions {
+	return CalibrationOptions{Bins: 5, MinSessions: 5}
+}
+
+// CalibratedLevel compares one level's predicted difficulty to how often
+// players failed it
+type CalibratedLevel struct {
+	Level     string  `json:"level"`
+	Sessions  int     `json:"sessions"`
+	Predicted float64 `json:"predicted"` // the difficulty score
+	Observed  float64 `json:"observed"`  // share of solo sessions not cleared
+	Adjusted  float64 `json:"adjusted"`  // score under the suggested weights
+}
+
+// CalibrationBin is one point of the calibration curve
+type CalibrationBin struct {
+	Low       float64 `json:"low"`
+	High      float64 `json:"high"`
+	Levels    int     `json:"levels"`
+	Sessions  int     `json:"sessions"`
+	Predicted float64 `json:"predicted"` // session-weighted means
+	Observed  float64 `json:"observed"`
+}
+
+// WeightSuggestion is a suggested change to one score component's weight
+type WeightSuggestion struct {
+	Component string  `json:"component"`
+	Current   float64 `json:"current"`
+	Suggested float64 `json:"suggested"`
+}
+
+// CalibrationReport measures how well the difficulty score predicts real
+// failure rates; errors are session-weighted mean squared errors
+type CalibrationReport struct {
+	Sessions      int                `json:"sessions"`
+	Levels        []CalibratedLevel  `json:"levels"` // by predicted score
+	Curve         []CalibrationBin   `json:"curve"`
+	Bias          float64            `json:"bias"` // mean observed minus predicted
+	Error         float64            `json:"error"`
+	AdjustedError float64            `json:"adjustedError"`
+	Weights       []WeightSuggestion `json:"weights"`
+}
+
+// calibrationSample is a level's difficulty report with its outcomes
+type calibrationSample struct {
+	report   DifficultyReport
+	sessions int
+	failed   int
+}
+
+// Calibrate compares each level's difficulty score to the share of solo
+// sessions that failed to clear it, buckets the levels into a calibration
+// curve and fits component weights that would have predicted the observed
+// rates better
+func (d *Dataset) Calibrate(opts CalibrationOptions) (CalibrationReport, error) {
+	sessions, failed := make(map[string]int), make(map[string]int)
+	for _, r := range d.Replays {
+		if len(r.Players) != 1 || r.Result.Outcome == "" {
+			continue
+		}
+		sessions[r.Level]++
+		if r.Result.Outcome != replay.OutcomeCleared {
+			failed[r.Level]++
+		}
+	}
+	var samples []calibrationSample
+	for _, lvl := range d.LevelList() {
+		if sessions[lvl.Name] > 0 {
+			samples = append(samples, calibrationSample{d.analyzeLevel(lvl), sessions[lvl.Name], failed[lvl.Name]})
+		}
+	}
+	return calibrate(samples, opts)
+}
+
+func calibrate(samples []calibrationSample, opts CalibrationOptions) (CalibrationReport, error) {
+	var report CalibrationReport
+	if opts.Bins <= 0 {
+		return report, fmt.Errorf("calibration needs at least one bin, got %d", opts.Bins)
+	}
+	kept := samples[:0:0]
+	for _, s := range samples {
+		if s.sessions >= opts.MinSessions && s.sessions > 0 {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == 0 {
+		return report, nil
+	}
+
+	weights, err := fitWeights(kept)
+	if err != nil {
+		return report, err
+	}
+	for i, c := range difficultyComponents {
+		report.Weights = append(report.Weights, WeightSuggestion{Component: c, Current: difficultyWeights[i], Suggested: weights[i]})
+	}
+	for _, s := range kept {
+		l := CalibratedLevel{Level: s.report.Level, Sessions: s.sessions, Predicted: s.report.Score,
+			Observed: float64(s.failed) / float64(s.sessions), Adjusted: s.report.weighted(weights)}
+		w := float64(s.sessions)
+		report.Sessions += s.sessions
+		report.Bias += w * (l.Observed - l.Predicted)
+		report.Error += w * (l.Observed - l.Predicted) * (l.Observed - l.Predicted)
+		report.AdjustedError += w * (l.Observed - l.Adjusted) * (l.Observed - l.Adjusted)
+		report.Levels = append(report.Levels, l)
+	}
+	total := float64(report.Sessions)
+	report.Bias /= total
+	report.Error /= total
+	report.AdjustedError /= total
+	sort.SliceStable(report.Levels, func(i, j int) bool { return report.Levels[i].Predicted < report.Levels[j].Predicted })
+
+	bins := make([]CalibrationBin, opts.Bins)
+	for i := range bins {
+		bins[i].Low, bins[i].High = float64(i)/float64(opts.Bins), float64(i+1)/float64(opts.Bins)
+	}
+	for _, l := range report.Levels {
+		b := &bins[min(int(l.Predicted*float64(opts.Bins)), opts.Bins-1)]
+		b.Levels++
+		b.Sessions += l.Sessions
+		b.Predicted += float64(l.Sessions) * l.Predicted
+		b.Observed += float64(l.Sessions) * l.Observed
+	}
+	for _, b := range bins {
+		if b.Levels == 0 {
+			continue
+		}
+		b.Predicted /= float64(b.Sessions)
+		b.Observed /= float64(b.Sessions)
+		report.Curve = append(report.Curve, b)
+	}
+	return report, nil
+}
+
+// fitWeights fits the component weights by session-weighted least squares
+// of the observed failure rates, shrunk towards the current weights by
+// calibrationPrior and kept non-negative
+func fitWeights(samples []calibrationSample) ([]float64, error) {
+	k := len(difficultyWeights)
+	lhs := make([][]float64, k)
+	rhs := make([]float64, k)
+	for a := range lhs {
+		lhs[a] = make([]float64, k)
+		lhs[a][a] = calibrationPrior
+		rhs[a] = calibrationPrior * difficultyWeights[a]
+	}
+	for _, s := range samples {
+		x, w := s.report.components(), float64(s.sessions)
+		y := float64(s.failed) / w
+		for a := range x {
+			rhs[a] += w * x[a] * y
+			for b := range x {
+				lhs[a][b] += w * x[a] * x[b]
+			}
+		}
+	}
+	inv, err := invert(lhs)
+	if err != nil {
+		return nil, err
+	}
+	weights := make([]float64, k)
+	for a := range weights {
+		for b := range rhs {
+			weights[a] += inv[a][b] * rhs[b]
+		}
+		weights[a] = math.Max(weights[a], 0)
+	}
+	return weights, nil
+}
+
+// calibrationPass reports Calibrate with the default options
+type calibrationPass struct{}
+
+func init() {
+	RegisterPass(calibrationPass{})
+}
+
+func (calibrationPass) Name() string       { return "calibration" }
+func (calibrationPass) Requires() []string { return []string{InputLevels, InputReplays} }
+
+func (calibrationPass) Run(in PassInputs) ([]*Table, error) {
+	report, err := in.Data.Calibrate(DefaultCalibrationOptions())
+	if err != nil {
+		return nil, err
+	}
+	levels := NewTable("by_level", "level", "sessions:int", "predicted:float", "observed:float", "adjusted:float")
+	for _, l := range report.Levels {
+		levels.Add(l.Level, l.Sessions, l.Predicted, l.Observed, l.Adjusted)
+	}
+	curve := NewTable("curve", "low:float", "high:float", "levels:int", "sessions:int", "predicted:float", "observed:float")
+	for _, b := range report.Curve {
+		curve.Add(b.Low, b.High, b.Levels, b.Sessions, b.Predicted, b.Observed)
+	}
+	weights := NewTable("weights", "component", "current:float", "suggested:float", "bias:float", "error:float", "adjusted_error:float")
+	for _, w := range report.Weights {
+		weights.Add(w.Component, w.Current, w.Suggested, report.Bias, report.Error, report.AdjustedError)
+	}
+	return []*Table{levels, curve, weights}, nil
+}
@@ -0,0 +1,49 @@
+package analyzer
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCalibrateSuggestsWeights(t *testing.T) {
+	// players fail exactly as often as the bot fails to clear, so the model
+	// underweights clears and shouldn't weight terrain at all
+	var samples []calibrationSample
+	for i := 0; i < 10; i++ {
+		rate := float64(i) / 10
+		samples = append(samples, calibrationSample{
+			report:   DifficultyReport{Level: fmt.Sprint("l", i), TerrainComplexity: 0.5, PickupAccessibility: 1, ClearRate: 1 - rate},
+			sessions: 100, failed: i * 10,
+		})
+	}
+	for i := range samples {
+		samples[i].report.Score = samples[i].report.weighted(difficultyWeights)
+	}
+	samples = append(samples, calibrationSample{report: DifficultyReport{Level: "rare"}, sessions: 2, failed: 2})
+
+	report, err := calibrate(samples, DefaultCalibrationOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Levels) != 10 || report.Sessions != 1000 {
+		t.Fatalf("kept %d levels and %d sessions, want the 10 with enough sessions", len(report.Levels), report.Sessions)
+	}
+	if report.AdjustedError >= report.Error {
+		t.Errorf("adjusted error %g not below current %g", report.AdjustedError, report.Error)
+	}
+	w := report.Weights
+	if w[3].Component != "clears" || w[3].Suggested <= w[3].Current || w[0].Suggested >= w[0].Current {
+		t.Errorf("weights %+v: want clears raised and terrain lowered", w)
+	}
+	if len(report.Curve) == 0 || report.Curve[0].Low != 0 {
+		t.Fatalf("curve %+v", report.Curve)
+	}
+	for _, b := range report.Curve {
+		if b.Predicted < b.Low || b.Predicted > b.High {
+			t.Errorf("bin %+v predicts outside its bounds", b)
+		}
+	}
+	if _, err := calibrate(samples, CalibrationOptions{}); err == nil {
+		t.Error("no error without bins")
+	}
+}
@@ -0,0 +1,211 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Evidence kinds
+const (
+	EvidenceInputRate    = "input_rate"
+	EvidencePlacement    = "placement"
+	EvidenceSpellTiming  = "spell_timing"
+	EvidenceSpellCadence = "spell_cadence"
+)
+
+// Weights each piece of evidence adds to a suspicion score
+var evidenceWeights = map[string]float64{
+	EvidenceInputRate:    0.4,
+	EvidencePlacement:    0.5,
+	EvidenceSpellTiming:  0.3,
+	EvidenceSpellCadence: 0.3,
+}
+
+// CheatOptions are the thresholds beyond which play is considered superhuman
+type CheatOptions struct {
+	MaxInputsPerSecond float64        // inputs in any one-second window
+	MinReactionMs      int64          // fastest believable pickup-to-cast time
+	MaxExcerpts        int            // evidence kept per player
+	Board              level.GridSize // board size of levels the dataset doesn't hold
+}
+
+// DefaultCheatOptions returns thresholds well above what strong players reach
+func DefaultCheatOptions() CheatOptions {
+	return CheatOptions{MaxInputsPerSecond: 35, MinReactionMs: 100, MaxExcerpts: 5, Board: level.GridSize{Width: 10, Height: 20}}
+}
+
+// Evidence is one suspicious moment of a replay
+type Evidence struct {
+	Kind   string `json:"kind"`
+	Frame  int    `json:"frame"`
+	TimeMs int64  `json:"timeMs"`
+	Detail string `json:"detail"`
+}
+
+// Suspicion is the screening result for one player of one replay
+type Suspicion struct {
+	Session  string     `json:"session"`
+	Player   string     `json:"player"`
+	Score    float64    `json:"score"` // 0 (clean) to 1
+	Findings int        `json:"findings"`
+	Evidence []Evidence `json:"evidence"` // the first MaxExcerpts findings
+}
+
+// ScreenReplays screens every replay in the dataset and returns the
+// players with any evidence against them, most suspicious first
+func (d *Dataset) ScreenReplays(opts CheatOptions) []Suspicion {
+	var out []Suspicion
+	fallback := opts.Board
+	for _, r := range d.Replays {
+		opts.Board = d.GridSize(r.Level, fallback)
+		out = append(out, ScreenReplay(r, opts)...)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out
+}
+
+// ScreenReplay checks each player for superhuman input rates, placements
+// that can't happen on a board of opts.Board and implausibly fast or
+// regular spell casts
+func ScreenReplay(r *replay.Replay, opts CheatOptions) []Suspicion {
+	var out []Suspicion
+	for _, p := range r.Players {
+		var evidence []Evidence
+		evidence = append(evidence, inputRateEvidence(r, p.ID, opts)...)
+		evidence = append(evidence, placementEvidence(r, p.ID, opts)...)
+		evidence = append(evidence, spellEvidence(r, p.ID, opts)...)
+		if len(evidence) == 0 {
+			continue
+		}
+
+		// independent signals combine like probabilities
+		clean := 1.0
+		for _, e := range evidence {
+			clean *= 1 - evidenceWeights[e.Kind]
+		}
+		s := Suspicion{Session: r.SessionID, Player: p.ID, Score: 1 - clean, Findings: len(evidence), Evidence: evidence}
+		if len(s.Evidence) > opts.MaxExcerpts {
+			s.Evidence = s.Evidence[:opts.MaxExcerpts]
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// inputRateEvidence reports each burst of more inputs in one second than
+// opts allows, once per burst
+func inputRateEvidence(r *replay.Replay, player string, opts CheatOptions) []Evidence {
+	var times []int64
+	var frames []int
+	for _, in := range r.Inputs {
+		if in.Player == player {
+			times = append(times, in.TimeMs)
+			frames = append(frames, in.Frame)
+		}
+	}
+	var out []Evidence
+	limit := int(opts.MaxInputsPerSecond)
+	inBurst := false
+	for start, end := 0, 0; end < len(times); end++ {
+		for times[end]-times[start] >= 1000 {
+			start++
+		}
+		over := end-start+1 > limit
+		if over && !inBurst {
+			out = append(out, Evidence{Kind: EvidenceInputRate, Frame: frames[end], TimeMs: times[end],
+				Detail: fmt.Sprintf("%d inputs within one second", end-start+1)})
+		}
+		inBurst = over
+	}
+	return out
+}
+
+// placementEvidence reports locked pieces outside the board and pieces
+// that were never dealt in that order
+func placementEvidence(r *replay.Replay, player string, opts CheatOptions) []Evidence {
+	var out []Evidence
+	next := 0
+	for _, ev := range r.Events {
+		if ev.Type != replay.EventLock || ev.Player != player {
+			continue
+		}
+		if next < len(r.Pieces) {
+			if want := r.Pieces[next]; ev.Piece != want {
+				out = append(out, Evidence{Kind: EvidencePlacement, Frame: ev.Frame, TimeMs: ev.TimeMs,
+					Detail: fmt.Sprintf("locked %s as piece %d, sequence dealt %s", ev.Piece, next+1, want)})
+			}
+		}
+		next++
+		cells, ok := pieces.Cells(ev.Piece, ev.Rotation)
+		if !ok {
+			out = append(out, Evidence{Kind: EvidencePlacement, Frame: ev.Frame, TimeMs: ev.TimeMs,
+				Detail: fmt.Sprintf("locked unknown piece %q", ev.Piece)})
+			continue
+		}
+		for _, c := range cells {
+			x, y := ev.X+c.X, ev.Y+c.Y
+			if x < 0 || x >= opts.Board.Width || y < 0 || y >= opts.Board.Height {
+				out = append(out, Evidence{Kind: EvidencePlacement, Frame: ev.Frame, TimeMs: ev.TimeMs,
+					Detail: fmt.Sprintf("%s locked with a cell at (%d,%d), outside the board", ev.Piece, x, y)})
+				break
+			}
+		}
+	}
+	return out
+}
+
+// spellEvidence reports casts faster after their pickup than a human can
+// react, and cast intervals too regular to be manual
+func spellEvidence(r *replay.Replay, player string, opts CheatOptions) []Evidence {
+	var out []Evidence
+	var pickups []replay.Event
+	for _, ev := range r.EventsOf(replay.EventPickup) {
+		if ev.Player == player {
+			pickups = append(pickups, ev)
+		}
+	}
+	var casts []replay.SpellCast
+	for _, sc := range r.Spells {
+		if sc.Player != player {
+			continue
+		}
+		casts = append(casts, sc)
+		for i := len(pickups) - 1; i >= 0; i-- {
+			pk := pickups[i]
+			if pk.Detail != sc.Spell || pk.TimeMs > sc.TimeMs {
+				continue
+			}
+			if reaction := sc.TimeMs - pk.TimeMs; reaction < opts.MinReactionMs {
+				out = append(out, Evidence{Kind: EvidenceSpellTiming, Frame: sc.Frame, TimeMs: sc.TimeMs,
+					Detail: fmt.Sprintf("%s cast %dms after pickup", sc.Spell, reaction)})
+			}
+			break
+		}
+	}
+
+	// five or more casts spaced almost exactly alike point to a script
+	if len(casts) >= 5 {
+		intervals := make([]float64, len(casts)-1)
+		mean := 0.0
+		for i := 1; i < len(casts); i++ {
+			intervals[i-1] = float64(casts[i].TimeMs - casts[i-1].TimeMs)
+			mean += intervals[i-1]
+		}
+		mean /= float64(len(intervals))
+		variance := 0.0
+		for _, v := range intervals {
+			variance += (v - mean) * (v - mean)
+		}
+		if cv := math.Sqrt(variance/float64(len(intervals))) / mean; mean > 0 && cv < 0.05 {
+			last := casts[len(casts)-1]
+			out = append(out, Evidence{Kind: EvidenceSpellCadence, Frame: last.Frame, TimeMs: last.TimeMs,
+				Detail: fmt.Sprintf("%d casts every %.0fms (variation %.1f%%)", len(casts), mean, cv*100)})
+		}
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestScreenReplayFlagsImpossiblePlay(t *testing.T) {
+	r := &replay.Replay{
+		SessionID: "s",
+		Players:   []replay.Player{{ID: "bot"}, {ID: "human"}},
+		Pieces:    []string{"T", "O"},
+		Events: []replay.Event{
+			{Type: replay.EventLock, Player: "bot", Piece: "I", X: 0, Y: 18},   // dealt T
+			{Type: replay.EventLock, Player: "human", Piece: "T", X: 3, Y: 18}, // fine
+			{Type: replay.EventPickup, Player: "bot", Detail: "SLOW_DOWN", TimeMs: 500},
+		},
+		Spells: []replay.SpellCast{{Player: "bot", Spell: "SLOW_DOWN", TimeMs: 520}},
+	}
+	for i := 0; i < 50; i++ {
+		r.Inputs = append(r.Inputs, replay.Input{Player: "bot", Action: replay.ActionLeft, TimeMs: int64(i * 10)})
+	}
+
+	got := ScreenReplay(r, DefaultCheatOptions())
+	if len(got) != 1 || got[0].Player != "bot" {
+		t.Fatalf("suspicions = %+v, want only bot", got)
+	}
+	kinds := map[string]bool{}
+	for _, e := range got[0].Evidence {
+		kinds[e.Kind] = true
+	}
+	for _, k := range []string{EvidenceInputRate, EvidencePlacement, EvidenceSpellTiming} {
+		if !kinds[k] {
+			t.Errorf("missing %s evidence in %+v", k, got[0].Evidence)
+		}
+	}
+	if got[0].Score < 0.7 {
+		t.Errorf("score %.2f too low for three signals", got[0].Score)
+	}
+}
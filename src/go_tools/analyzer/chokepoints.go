@@ -0,0 +1,175 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// ChokePointMetadata is the level metadata key AnnotateChokePoints writes
+const ChokePointMetadata = "choke_points"
+
+// ChokeOptions configures choke point detection
+type ChokeOptions struct {
+	RegionSize     int     // side of the square board regions, in cells
+	MomentSec      int     // length of the session time buckets
+	ControlLoss    int     // holes one lock must add to count as losing control
+	MinRate        float64 // incidents per session a region or moment needs to be a choke point
+	MaxChokePoints int     // reported per level, worst first
+}
+
+// DefaultChokeOptions uses 4x4 regions and 15 second moments
+func DefaultChokeOptions() ChokeOptions {
+	return ChokeOptions{RegionSize: 4, MomentSec: 15, ControlLoss: 2, MinRate: 0.1, MaxChokePoints: 5}
+}
+
+// ChokePoint is a board region or a session moment where players top out
+// or lose control unusually often
+type ChokePoint struct {
+	level.Zone            // the region; the whole board for moments
+	FromSec       int     `json:"fromSec,omitempty"` // the moment, for time choke points
+	ToSec         int     `json:"toSec,omitempty"`
+	TopOuts       int     `json:"topOuts"`
+	ControlLosses int     `json:"controlLosses"`
+	Rate          float64 `json:"rate"` // incidents per session
+}
+
+// LevelChokePoints is the choke points found on one level
+type LevelChokePoints struct {
+	Level    string       `json:"level"`
+	Sessions int          `json:"sessions"`
+	Regions  []ChokePoint `json:"regions"`
+	Moments  []ChokePoint `json:"moments"`
+}
+
+// ChokePoints aggregates top-outs and control losses (locks adding at
+// least opts.ControlLoss holes to the player's board) by board region and
+// by session moment, and reports the worst of each per level
+func (d *Dataset) ChokePoints(fallback level.GridSize, opts ChokeOptions) []LevelChokePoints {
+	if opts.RegionSize <= 0 {
+		opts.RegionSize = DefaultChokeOptions().RegionSize
+	}
+	if opts.MomentSec <= 0 {
+		opts.MomentSec = DefaultChokeOptions().MomentSec
+	}
+	type key struct{ a, b int }
+	type tally struct {
+		sessions int
+		regions  map[key]*ChokePoint
+		moments  map[int]*ChokePoint
+	}
+	size := opts.RegionSize
+	tallies := make(map[string]*tally)
+	var names []string
+	for _, r := range d.Replays {
+		t := tallies[r.Level]
+		if t == nil {
+			t = &tally{regions: make(map[key]*ChokePoint), moments: make(map[int]*ChokePoint)}
+			tallies[r.Level] = t
+			names = append(names, r.Level)
+		}
+		t.sessions++
+		grid := d.GridSize(r.Level, fallback)
+		record := func(x, y int, timeMs int64, topOut bool) {
+			// top-outs above the board count in the top row of regions
+			k := key{max(x, 0) / size, max(y, 0) / size}
+			reg := t.regions[k]
+			if reg == nil {
+				reg = &ChokePoint{Zone: level.Zone{X: k.a * size, Y: k.b * size, Width: size, Height: size}}
+				t.regions[k] = reg
+			}
+			m := int(timeMs / 1000 / int64(opts.MomentSec))
+			mom := t.moments[m]
+			if mom == nil {
+				mom = &ChokePoint{Zone: level.Zone{Width: grid.Width, Height: grid.Height},
+					FromSec: m * opts.MomentSec, ToSec: (m + 1) * opts.MomentSec}
+				t.moments[m] = mom
+			}
+			for _, cp := range []*ChokePoint{reg, mom} {
+				if topOut {
+					cp.TopOuts++
+				} else {
+					cp.ControlLosses++
+				}
+			}
+		}
+		for _, ev := range r.EventsOf(replay.EventTopOut) {
+			record(ev.X, ev.Y, ev.TimeMs, true)
+		}
+		holes := make(map[string]int)
+		for _, p := range r.Players {
+			_, holes[p.ID], _ = d.startBoard(r, fallback).surface()
+		}
+		d.replayBoards(r, fallback, func(player string, ev replay.Event, b board) {
+			_, now, _ := b.surface()
+			if opts.ControlLoss > 0 && now-holes[player] >= opts.ControlLoss {
+				record(ev.X, ev.Y, ev.TimeMs, false)
+			}
+			holes[player] = now
+		})
+	}
+
+	sort.Strings(names)
+	out := make([]LevelChokePoints, 0, len(names))
+	for _, name := range names {
+		t := tallies[name]
+		lc := LevelChokePoints{Level: name, Sessions: t.sessions}
+		for _, cp := range t.regions {
+			lc.Regions = append(lc.Regions, *cp)
+		}
+		for _, cp := range t.moments {
+			lc.Moments = append(lc.Moments, *cp)
+		}
+		lc.Regions = worstChokePoints(lc.Regions, t.sessions, opts)
+		lc.Moments = worstChokePoints(lc.Moments, t.sessions, opts)
+		out = append(out, lc)
+	}
+	return out
+}
+
+// worstChokePoints rates the candidates and keeps the worst above MinRate
+func worstChokePoints(points []ChokePoint, sessions int, opts ChokeOptions) []ChokePoint {
+	kept := points[:0]
+	for _, cp := range points {
+		cp.Rate = float64(cp.TopOuts+cp.ControlLosses) / float64(sessions)
+		if cp.Rate >= opts.MinRate {
+			kept = append(kept, cp)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].Rate != kept[j].Rate {
+			return kept[i].Rate > kept[j].Rate
+		}
+		if kept[i].FromSec != kept[j].FromSec {
+			return kept[i].FromSec < kept[j].FromSec
+		}
+		if kept[i].Y != kept[j].Y {
+			return kept[i].Y < kept[j].Y
+		}
+		return kept[i].X < kept[j].X
+	})
+	if opts.MaxChokePoints > 0 && len(kept) > opts.MaxChokePoints {
+		kept = kept[:opts.MaxChokePoints]
+	}
+	return kept
+}
+
+// AnnotateChokePoints stores the choke points in the level's metadata as
+// JSON under ChokePointMetadata, so the editor can overlay them
+func AnnotateChokePoints(lvl *level.Level, cp LevelChokePoints) error {
+	data, err := json.Marshal(struct {
+		Sessions int          `json:"sessions"`
+		Regions  []ChokePoint `json:"regions"`
+		Moments  []ChokePoint `json:"moments"`
+	}{cp.Sessions, cp.Regions, cp.Moments})
+	if err != nil {
+		return err
+	}
+	if lvl.Metadata == nil {
+		lvl.Metadata = make(map[string]string)
+	}
+	lvl.Metadata[ChokePointMetadata] = string(data)
+	return nil
+}
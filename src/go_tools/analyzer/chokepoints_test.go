@@ -0,0 +1,41 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestChokePointsFindTopOutRegion(t *testing.T) {
+	data := NewDataset()
+	lvl := level.New("spire", 8, 8)
+	data.Levels[lvl.Name] = lvl
+	for i := 0; i < 4; i++ {
+		data.Replays = append(data.Replays, &replay.Replay{Level: "spire", Players: []replay.Player{{ID: "p"}},
+			Events: []replay.Event{{Type: replay.EventTopOut, Player: "p", X: 5, Y: 1, TimeMs: 40000}}})
+	}
+	data.Replays = append(data.Replays, &replay.Replay{Level: "spire", Players: []replay.Player{{ID: "p"}},
+		Events: []replay.Event{{Type: replay.EventTopOut, Player: "p", X: 1, Y: 6, TimeMs: 5000}}})
+
+	got := data.ChokePoints(level.GridSize{Width: 8, Height: 8}, DefaultChokeOptions())
+	if len(got) != 1 || len(got[0].Regions) != 2 {
+		t.Fatalf("choke points = %+v", got)
+	}
+	worst := got[0].Regions[0]
+	if worst.X != 4 || worst.Y != 0 || worst.TopOuts != 4 || worst.Rate != 0.8 {
+		t.Errorf("worst region = %+v, want (4,0) with 4 top-outs", worst)
+	}
+	if m := got[0].Moments[0]; m.FromSec != 30 || m.ToSec != 45 {
+		t.Errorf("worst moment = %ds-%ds, want 30s-45s", m.FromSec, m.ToSec)
+	}
+
+	if err := AnnotateChokePoints(lvl, got[0]); err != nil {
+		t.Fatal(err)
+	}
+	var stored LevelChokePoints
+	if err := json.Unmarshal([]byte(lvl.Metadata[ChokePointMetadata]), &stored); err != nil || len(stored.Regions) != 2 {
+		t.Errorf("metadata = %s (%v)", lvl.Metadata[ChokePointMetadata], err)
+	}
+}
@@ -0,0 +1,207 @@
+package analyzer
+
+import (
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+// Clear-rate simulation settings; the seed is fixed so a level always
+// scores the same
+const (
+	simulatedPieces = 40
+	simulationSeed  = 1
+)
+
+// ClearSimulation is the outcome of playing a level with a greedy bot
+type ClearSimulation struct {
+	Pieces    int  `json:"pieces"` // pieces placed before the end or a top-out
+	Lines     int  `json:"lines"`
+	ToppedOut bool `json:"toppedOut"`
+}
+
+// Rate returns lines cleared per piece relative to perfect play, where
+// every cell placed ends up in a cleared line
+func (s ClearSimulation) Rate(width int) float64 {
+	if s.Pieces == 0 {
+		return 0
+	}
+	rate := float64(s.Lines*width) / float64(s.Pieces*4)
+	if rate > 1 {
+		rate = 1
+	}
+	return rate
+}
+
+// board is a mutable occupancy grid indexed [y][x]
+type board [][]bool
+
+func (b board) fits(cells []level.Point, dx, dy int) bool {
+	for _, c := range cells {
+		x, y := c.X+dx, c.Y+dy
+		if x < 0 || y < 0 || y >= len(b) || x >= len(b[0]) || b[y][x] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b board) clone() board {
+	c := make(board, len(b))
+	for y := range b {
+		c[y] = append([]bool(nil), b[y]...)
+	}
+	return c
+}
+
+// place locks the cells and clears full rows, returning the rows cleared
+func (b board) place(cells []level.Point, dx, dy int) int {
+	for _, c := range cells {
+		b[c.Y+dy][c.X+dx] = true
+	}
+	cleared := 0
+	for y := len(b) - 1; y >= 0; {
+		full := true
+		for _, filled := range b[y] {
+			if !filled {
+				full = false
+				break
+			}
+		}
+		if !full {
+			y--
+			continue
+		}
+		copy(b[1:y+1], b[:y])
+		b[0] = make([]bool, len(b[y]))
+		cleared++
+	}
+	return cleared
+}
+
+// surface returns each column's height, the holes beneath the surface and
+// the bumpiness between neighbouring columns
+func (b board) surface() (heights []int, holes, bumpiness int) {
+	height := len(b)
+	width := len(b[0])
+	heights = make([]int, width)
+	for x := 0; x < width; x++ {
+		covered := false
+		for y := 0; y < height; y++ {
+			switch {
+			case b[y][x] && !covered:
+				covered = true
+				heights[x] = height - y
+			case !b[y][x] && covered:
+				holes++
+			}
+		}
+		if x > 0 {
+			d := heights[x] - heights[x-1]
+			if d < 0 {
+				d = -d
+			}
+			bumpiness += d
+		}
+	}
+	return heights, holes, bumpiness
+}
+
+// evaluate scores a board after a placement with the usual greedy weights
+func (b board) evaluate(lines int) float64 {
+	heights, holes, bumpiness := b.surface()
+	aggregate := 0
+	for _, h := range heights {
+		aggregate += h
+	}
+	return -0.51*float64(aggregate) + 0.76*float64(lines) - 0.36*float64(holes) - 0.18*float64(bumpiness)
+}
+
+// SimulateClears plays the level's piece sequence with a greedy hard-drop
+// bot and reports how many lines it clears
+func SimulateClears(lvl *level.Level) ClearSimulation {
+	var sim ClearSimulation
+	if lvl.GridSize.Width <= 0 || lvl.GridSize.Height <= 0 {
+		return sim
+	}
+	queue, err := pieces.ForLevel(lvl.Pieces, pieces.Bag7, rng.NewXoshiro(simulationSeed))
+	if err != nil {
+		queue, _ = pieces.New(pieces.Bag7, rng.NewXoshiro(simulationSeed))
+	}
+	b := board(lvl.Occupancy())
+	for i := 0; i < simulatedPieces; i++ {
+		p, ok := b.dropBest(queue.Next())
+		if !ok {
+			sim.ToppedOut = true
+			break
+		}
+		sim.Pieces++
+		sim.Lines += p.Lines
+	}
+	return sim
+}
+
+// Bot is the greedy hard-drop bot of SimulateClears, playing a board a
+// piece at a time, for headless clients
+type Bot struct {
+	start, b board
+}
+
+// NewBot starts a bot on an empty board
+func NewBot(width, height int) *Bot {
+	start := make(board, height)
+	for y := range start {
+		start[y] = make([]bool, width)
+	}
+	return &Bot{start: start, b: start.clone()}
+}
+
+// NewLevelBot starts a bot on the level's board
+func NewLevelBot(lvl *level.Level) *Bot {
+	start := board(lvl.Occupancy())
+	return &Bot{start: start, b: start.clone()}
+}
+
+// Drop places the piece where the bot scores it best, reporting false
+// when it doesn't fit anywhere: the bot topped out
+func (bot *Bot) Drop(piece string) (Placement, bool) {
+	if len(bot.b) == 0 || len(bot.b[0]) == 0 {
+		return Placement{}, false
+	}
+	return bot.b.dropBest(piece)
+}
+
+// Reset clears the board back to the bot's start
+func (bot *Bot) Reset() {
+	bot.b = bot.start.clone()
+}
+
+// dropBest hard-drops the piece at the best-scoring rotation and column
+func (b board) dropBest(piece string) (Placement, bool) {
+	width := len(b[0])
+	bestScore := 0.0
+	var bestCells []level.Point
+	bestRot, bestX, bestY := 0, 0, 0
+	for rot := 0; rot < 4; rot++ {
+		cells, _ := pieces.Cells(piece, rot)
+		for dx := -3; dx < width; dx++ {
+			if !b.fits(cells, dx, 0) {
+				continue
+			}
+			dy := 0
+			for b.fits(cells, dx, dy+1) {
+				dy++
+			}
+			trial := b.clone()
+			cleared := trial.place(cells, dx, dy)
+			if score := trial.evaluate(cleared); bestCells == nil || score > bestScore {
+				bestScore, bestCells, bestRot, bestX, bestY = score, cells, rot, dx, dy
+			}
+		}
+	}
+	if bestCells == nil {
+		return Placement{}, false
+	}
+	lines := b.place(bestCells, bestX, bestY)
+	return Placement{Piece: piece, Rotation: bestRot, X: bestX, Y: bestY, Lines: lines}, true
+}
@@ -0,0 +1,112 @@
+package analyzer
+
+import (
+	"math"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Level metrics compared between packs, in report order
+const (
+	MetricBlocks              = "blocks"
+	MetricSpecialBlocks       = "special_blocks"
+	MetricPickups             = "pickups"
+	MetricDensity             = "density"
+	MetricTerrainComplexity   = "terrain_complexity"
+	MetricHoles               = "holes"
+	MetricPickupAccessibility = "pickup_accessibility"
+	MetricClearRate           = "clear_rate"
+	MetricDifficulty          = "difficulty"
+)
+
+// LevelMetricNames lists the metrics LevelMetrics computes
+var LevelMetricNames = []string{
+	MetricBlocks, MetricSpecialBlocks, MetricPickups, MetricDensity, MetricTerrainComplexity,
+	MetricHoles, MetricPickupAccessibility, MetricClearRate, MetricDifficulty,
+}
+
+// LevelMetrics measures a level's structure and difficulty
+func LevelMetrics(lvl *level.Level) map[string]float64 {
+	report := AnalyzeLevel(lvl)
+	special := 0
+	for _, b := range lvl.Blocks {
+		if b.Special != "" {
+			special++
+		}
+	}
+	density := 0.0
+	if cells := lvl.GridSize.Width * lvl.GridSize.Height; cells > 0 {
+		density = float64(len(lvl.Blocks)) / float64(cells)
+	}
+	return map[string]float64{
+		MetricBlocks:              float64(len(lvl.Blocks)),
+		MetricSpecialBlocks:       float64(special),
+		MetricPickups:             float64(len(lvl.Pickups)),
+		MetricDensity:             density,
+		MetricTerrainComplexity:   report.TerrainComplexity,
+		MetricHoles:               float64(report.Holes),
+		MetricPickupAccessibility: report.PickupAccessibility,
+		MetricClearRate:           report.ClearRate,
+		MetricDifficulty:          report.Score,
+	}
+}
+
+// MetricDelta compares one metric between pack A and pack B
+type MetricDelta struct {
+	Metric       string  `json:"metric"`
+	MeanA        float64 `json:"meanA"`
+	MeanB        float64 `json:"meanB"`
+	Delta        float64 `json:"delta"`        // MeanB - MeanA
+	RelativeDiff float64 `json:"relativeDiff"` // Delta / MeanA, 0 when MeanA is 0
+	PValue       float64 `json:"pValue"`       // Welch's t-test
+	Significance string  `json:"significance"` // "", "*", "**" or "***"
+}
+
+// PackComparison is the metric-by-metric difference between two level packs
+type PackComparison struct {
+	LevelsA int           `json:"levelsA"`
+	LevelsB int           `json:"levelsB"`
+	Metrics []MetricDelta `json:"metrics"`
+}
+
+// ComparePacks compares every level metric between two packs, marking
+// differences whose Welch's t-test p-value is below 0.05, 0.01 and 0.001
+func ComparePacks(a, b []*level.Level) PackComparison {
+	cmp := PackComparison{LevelsA: len(a), LevelsB: len(b)}
+	ma, mb := packMetrics(a), packMetrics(b)
+	for _, name := range LevelMetricNames {
+		meanA, varA := stats.MeanVariance(ma[name])
+		meanB, varB := stats.MeanVariance(mb[name])
+		d := MetricDelta{Metric: name, MeanA: meanA, MeanB: meanB, Delta: meanB - meanA}
+		if meanA != 0 {
+			d.RelativeDiff = d.Delta / math.Abs(meanA)
+		}
+		d.PValue = stats.WelchP(meanA, varA, len(a), meanB, varB, len(b))
+		d.Significance = significance(d.PValue)
+		cmp.Metrics = append(cmp.Metrics, d)
+	}
+	return cmp
+}
+
+func packMetrics(levels []*level.Level) map[string][]float64 {
+	out := make(map[string][]float64)
+	for _, lvl := range levels {
+		for name, v := range LevelMetrics(lvl) {
+			out[name] = append(out[name], v)
+		}
+	}
+	return out
+}
+
+func significance(p float64) string {
+	switch {
+	case p < 0.001:
+		return "***"
+	case p < 0.01:
+		return "**"
+	case p < 0.05:
+		return "*"
+	}
+	return ""
+}
@@ -0,0 +1,202 @@
+package analyzer
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// BoardComplexity describes how hard a board state is to play on
+type BoardComplexity struct {
+	MaxHeight         float64 `json:"maxHeight"` // tallest column over board height
+	Roughness         float64 `json:"roughness"` // bumpiness over its maximum, 4 per column boundary
+	Holes             int     `json:"holes"`
+	DependencyDepth   int     `json:"dependencyDepth"` // most filled cells stacked above a single hole
+	RowTransitions    int     `json:"rowTransitions"`  // filled/empty changes along rows, walls count as filled
+	ColumnTransitions int     `json:"columnTransitions"`
+	Entropy           float64 `json:"entropy"` // Shannon entropy of 2x2 cell patterns, over its 4-bit maximum
+}
+
+// Terrain combines the metrics into one 0..1 terrain score, weighted
+// towards stack height as the most direct danger
+func (c BoardComplexity) Terrain(height int) float64 {
+	depth := 0.0
+	if height > 0 {
+		depth = clamp(float64(c.DependencyDepth) / float64(height))
+	}
+	return clamp(0.4*c.MaxHeight + 0.3*c.Roughness + 0.15*c.Entropy + 0.15*depth)
+}
+
+// complexity measures the board
+func (b board) complexity() BoardComplexity {
+	var c BoardComplexity
+	height := len(b)
+	if height == 0 || len(b[0]) == 0 {
+		return c
+	}
+	width := len(b[0])
+	heights, holes, bumpiness := b.surface()
+	c.Holes = holes
+	for _, h := range heights {
+		c.MaxHeight = math.Max(c.MaxHeight, float64(h)/float64(height))
+	}
+	if width > 1 {
+		c.Roughness = clamp(float64(bumpiness) / float64(4*(width-1)))
+	}
+
+	filled := func(x, y int) bool {
+		return x < 0 || x >= width || y >= height || (y >= 0 && b[y][x])
+	}
+	for x := 0; x < width; x++ {
+		above := 0
+		for y := 0; y < height; y++ {
+			if b[y][x] {
+				above++
+			} else if above > c.DependencyDepth {
+				c.DependencyDepth = above
+			}
+			if filled(x, y) != filled(x, y+1) {
+				c.ColumnTransitions++
+			}
+		}
+	}
+	for y := 0; y < height; y++ {
+		for x := -1; x < width; x++ {
+			if filled(x, y) != filled(x+1, y) {
+				c.RowTransitions++
+			}
+		}
+	}
+
+	var patterns [16]int
+	windows := 0
+	for y := 0; y+1 < height; y++ {
+		for x := 0; x+1 < width; x++ {
+			p := 0
+			for i, cell := range [4]bool{b[y][x], b[y][x+1], b[y+1][x], b[y+1][x+1]} {
+				if cell {
+					p |= 1 << i
+				}
+			}
+			patterns[p]++
+			windows++
+		}
+	}
+	for _, n := range patterns {
+		if n > 0 {
+			p := float64(n) / float64(windows)
+			c.Entropy -= p * math.Log2(p)
+		}
+	}
+	c.Entropy /= 4
+	return c
+}
+
+// LevelComplexity measures a level's starting board
+func LevelComplexity(lvl *level.Level) BoardComplexity {
+	if lvl.GridSize.Width <= 0 || lvl.GridSize.Height <= 0 {
+		return BoardComplexity{}
+	}
+	return board(lvl.Occupancy()).complexity()
+}
+
+// ComplexityFrame is one player's board complexity right after a lock
+type ComplexityFrame struct {
+	Frame           int    `json:"frame"`
+	TimeMs          int64  `json:"timeMs"`
+	Player          string `json:"player"`
+	BoardComplexity `json:"complexity"`
+}
+
+// ReplayComplexity measures every player's board after each of their locks
+func (d *Dataset) ReplayComplexity(r *replay.Replay, fallback level.GridSize) []ComplexityFrame {
+	return cached(d.Cache, "complexity", func() []ComplexityFrame {
+		var frames []ComplexityFrame
+		d.replayBoards(r, fallback, func(player string, ev replay.Event, b board) {
+			frames = append(frames, ComplexityFrame{Frame: ev.Frame, TimeMs: ev.TimeMs, Player: player, BoardComplexity: b.complexity()})
+		})
+		return frames
+	}, d.replayKey(r, fallback)...)
+}
+
+// ComplexityProfile summarizes how complex a level's boards get in play
+type ComplexityProfile struct {
+	Level       string          `json:"level"`
+	Start       BoardComplexity `json:"start"`
+	Frames      int             `json:"frames"` // boards measured, one per lock
+	MeanTerrain float64         `json:"meanTerrain"`
+	PeakTerrain float64         `json:"peakTerrain"`
+	MeanEntropy float64         `json:"meanEntropy"`
+	MeanHoles   float64         `json:"meanHoles"`
+	MaxDepth    int             `json:"maxDepth"` // deepest hole dependency seen
+}
+
+// ComplexityProfiles measures every board of every replay, per level in
+// name order
+func (d *Dataset) ComplexityProfiles(fallback level.GridSize) []ComplexityProfile {
+	profiles := make(map[string]*ComplexityProfile)
+	var names []string
+	for _, r := range d.Replays {
+		p := profiles[r.Level]
+		if p == nil {
+			p = &ComplexityProfile{Level: r.Level, Start: d.startBoard(r, fallback).complexity()}
+			profiles[r.Level] = p
+			names = append(names, r.Level)
+		}
+		height := d.GridSize(r.Level, fallback).Height
+		for _, f := range d.ReplayComplexity(r, fallback) {
+			terrain := f.Terrain(height)
+			p.Frames++
+			p.MeanTerrain += terrain
+			p.PeakTerrain = math.Max(p.PeakTerrain, terrain)
+			p.MeanEntropy += f.Entropy
+			p.MeanHoles += float64(f.Holes)
+			if f.DependencyDepth > p.MaxDepth {
+				p.MaxDepth = f.DependencyDepth
+			}
+		}
+	}
+	sort.Strings(names)
+	out := make([]ComplexityProfile, 0, len(names))
+	for _, name := range names {
+		p := profiles[name]
+		if p.Frames > 0 {
+			n := float64(p.Frames)
+			p.MeanTerrain /= n
+			p.MeanEntropy /= n
+			p.MeanHoles /= n
+		}
+		out = append(out, *p)
+	}
+	return out
+}
+
+// startBoard is the board a replay starts on: the level's blocks when the
+// level is loaded, otherwise an empty board of the fallback size
+func (d *Dataset) startBoard(r *replay.Replay, fallback level.GridSize) board {
+	if lvl := d.Levels[r.Level]; lvl != nil {
+		return board(lvl.Occupancy())
+	}
+	size := d.GridSize(r.Level, fallback)
+	b := make(board, size.Height)
+	for y := range b {
+		b[y] = make([]bool, size.Width)
+	}
+	return b
+}
+
+// replayBoards locks each player's pieces onto their own board, calling fn
+// after every lock; locks that don't fit the reconstructed board are skipped
+func (d *Dataset) replayBoards(r *replay.Replay, fallback level.GridSize, fn func(player string, ev replay.Event, b board)) {
+	s := NewReplaySimulator(d, fallback)
+	if s.Load(r) != nil {
+		return
+	}
+	for _, ev := range r.Events {
+		if b, ok := s.lock(ev); ok {
+			fn(ev.Player, ev, b)
+		}
+	}
+}
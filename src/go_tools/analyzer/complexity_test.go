@@ -0,0 +1,29 @@
+package analyzer
+
+import "testing"
+
+func TestBoardComplexity(t *testing.T) {
+	c := boardFrom(
+		"....",
+		"##..",
+		"#.#.",
+		"#.##",
+	).complexity()
+	if c.Holes != 2 || c.DependencyDepth != 1 {
+		t.Errorf("holes %d depth %d, want 2 and 1", c.Holes, c.DependencyDepth)
+	}
+	if c.MaxHeight != 0.75 {
+		t.Errorf("max height = %v, want 0.75", c.MaxHeight)
+	}
+	if c.Entropy <= 0 || c.Entropy > 1 {
+		t.Errorf("entropy = %v, want within (0, 1]", c.Entropy)
+	}
+
+	empty := boardFrom("....", "....").complexity()
+	if empty.Entropy != 0 || empty.Holes != 0 || empty.RowTransitions != 4 {
+		t.Errorf("empty board = %+v, want no entropy or holes and a transition at each wall", empty)
+	}
+	if empty.Terrain(2) != 0 {
+		t.Errorf("empty terrain = %v", empty.Terrain(2))
+	}
+}
@@ -0,0 +1,354 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Dataset is the input every analysis pass consumes
+type Dataset struct {
+	Replays []*replay.Replay
+	Levels  map[string]*level.Level // keyed by level name
+	Cache   *Cache                  // per-replay and per-level results, nil to always compute
+
+	// Anonymizer is applied to replays as they're added, before any
+	// analysis sees them; nil keeps them as recorded
+	Anonymizer *replay.Anonymizer
+
+	// Keys, when set, refuse replays their recorders didn't sign, or that
+	// were modified since, checked before anonymizing; nil takes any
+	Keys *replay.Keys
+
+	// Filter drops the replays and levels it doesn't match as directories
+	// are loaded, before anything else reads them; nil loads everything
+	Filter *ReplayFilter
+
+	// Scoring is the points the scoring economy attributes a session's score
+	// by; nil for the game's own
+	Scoring *ScoringRules
+
+	// ReadFile reads each file as directories are loaded, with kind
+	// "replay" or "level", such as to time the reads; nil uses os.ReadFile
+	ReadFile func(kind, path string) ([]byte, error)
+
+	replayHashes map[*replay.Replay]string // content hashes of the loaded files
+	levelHashes  map[string]string         // keyed by level name
+}
+
+// NewDataset returns an empty dataset
+func NewDataset() *Dataset {
+	return &Dataset{Levels: make(map[string]*level.Level)}
+}
+
+// LoadReplays parses every .json replay in dir into the dataset, failing
+// on the first file that doesn't parse
+func (d *Dataset) LoadReplays(dir string) error {
+	return firstError(d.LoadReplaysWith(dir, Pool{}))
+}
+
+// ReplaySource lists and reads replay files, such as a directory or a
+// replay store
+type ReplaySource interface {
+	// Replays names the source's replays, in the order they load
+	Replays() ([]string, error)
+	// ReadReplay reads one, by a name Replays gave
+	ReadReplay(name string) ([]byte, error)
+}
+
+// replayDir is a directory's .json and binary replay files as a source, read through the
+// dataset's ReadFile
+type replayDir struct {
+	d   *Dataset
+	dir string
+}
+
+func (r replayDir) Replays() ([]string, error) { return filesWith(r.dir, ".json", replay.FormatExt) }
+
+func (r replayDir) ReadReplay(path string) ([]byte, error) { return r.d.readFile("replay", path) }
+
+// LoadReplaysWith parses every .json replay in dir across the pool, in
+// file order, keeping those the filter matches. Files that fail are
+// skipped and returned; the error is for failing to list dir.
+func (d *Dataset) LoadReplaysWith(dir string, pool Pool) ([]FileError, error) {
+	return d.LoadReplaysFrom(replayDir{d: d, dir: dir}, pool)
+}
+
+// LoadReplaysFrom is LoadReplaysWith for any source of replays
+func (d *Dataset) LoadReplaysFrom(src ReplaySource, pool Pool) ([]FileError, error) {
+	files, err := src.Replays()
+	if err != nil {
+		return nil, err
+	}
+	replays := make([]*replay.Replay, len(files))
+	hashes := make([]string, len(files))
+	errs := pool.run("replays", len(files), func(i int) error {
+		data, err := src.ReadReplay(files[i])
+		if err != nil {
+			return err
+		}
+		if replays[i], err = d.parseReplay(data); err != nil {
+			return err
+		}
+		hashes[i] = d.replayHash(data)
+		return nil
+	})
+	if d.replayHashes == nil {
+		d.replayHashes = make(map[*replay.Replay]string)
+	}
+	var failed []FileError
+	for i, f := range files {
+		if err := errs[i]; err != nil {
+			failed = append(failed, FileError{File: f, Err: err})
+			continue
+		}
+		if !d.Filter.MatchReplay(replays[i]) {
+			continue
+		}
+		d.Replays = append(d.Replays, replays[i])
+		d.replayHashes[replays[i]] = hashes[i]
+	}
+	return failed, nil
+}
+
+func (d *Dataset) readFile(kind, path string) ([]byte, error) {
+	if d.ReadFile == nil {
+		return os.ReadFile(path)
+	}
+	return d.ReadFile(kind, path)
+}
+
+// AddReplay parses and validates a replay file's contents and adds the
+// replay to the dataset
+func (d *Dataset) AddReplay(data []byte) (*replay.Replay, error) {
+	rp, err := d.parseReplay(data)
+	if err != nil {
+		return nil, err
+	}
+	if d.replayHashes == nil {
+		d.replayHashes = make(map[*replay.Replay]string)
+	}
+	d.Replays = append(d.Replays, rp)
+	d.replayHashes[rp] = d.replayHash(data)
+	return rp, nil
+}
+
+// parseReplay parses a replay file's contents, checks its signature and
+// anonymizes the replay
+func (d *Dataset) parseReplay(data []byte) (*replay.Replay, error) {
+	rp, err := replay.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if d.Keys != nil {
+		if err := d.Keys.Verify(rp); err != nil {
+			return nil, err
+		}
+	}
+	if d.Anonymizer != nil {
+		d.Anonymizer.Apply(rp)
+	}
+	return rp, nil
+}
+
+// replayHash identifies a replay file's contents as the dataset sees them,
+// so results cached under other anonymizer settings aren't reused
+func (d *Dataset) replayHash(data []byte) string {
+	if d.Anonymizer == nil {
+		return contentHash(data)
+	}
+	settings, _ := json.Marshal(d.Anonymizer)
+	return contentHash(append(settings, data...))
+}
+
+// LoadLevels reads every level in dir, JSON or binary, into the dataset,
+// failing on the first file that doesn't parse
+func (d *Dataset) LoadLevels(dir string) error {
+	return firstError(d.LoadLevelsWith(dir, Pool{}))
+}
+
+// LoadLevelsWith reads every level file under dir, as level.Files finds
+// them, across the pool, keeping those the filter matches. Each is parsed
+// as level.Parse does, so older formats are migrated and newer ones
+// refused. Files that fail, or repeat an earlier file's level name, are
+// skipped and returned; the error is for failing to list dir.
+func (d *Dataset) LoadLevelsWith(dir string, pool Pool) ([]FileError, error) {
+	files, err := level.Files(dir, "manifest.json")
+	if errors.Is(err, level.ErrNoFiles) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	levels := make([]*level.Level, len(files))
+	hashes := make([]string, len(files))
+	errs := pool.run("levels", len(files), func(i int) error {
+		data, err := d.readFile("level", files[i])
+		if err != nil {
+			return err
+		}
+		if levels[i], err = level.Parse(data); err != nil {
+			return fmt.Errorf("parse level: %w", err)
+		}
+		hashes[i] = contentHash(data)
+		return nil
+	})
+	if d.levelHashes == nil {
+		d.levelHashes = make(map[string]string)
+	}
+	var failed []FileError
+	for i, f := range files {
+		if err := errs[i]; err != nil {
+			failed = append(failed, FileError{File: f, Err: err})
+			continue
+		}
+		lvl := levels[i]
+		if !d.Filter.MatchLevel(lvl.Name) {
+			continue
+		}
+		if _, dup := d.Levels[lvl.Name]; dup {
+			failed = append(failed, FileError{File: f, Err: fmt.Errorf("duplicate level name %q", lvl.Name)})
+			continue
+		}
+		d.Levels[lvl.Name] = lvl
+		d.levelHashes[lvl.Name] = hashes[i]
+	}
+	return failed, nil
+}
+
+// Warm computes the cached per-replay and per-level results across the
+// pool, so the analyses after it read them from the cache instead of
+// reconstructing boards one replay at a time. Without a cache it does
+// nothing.
+func (d *Dataset) Warm(fallback level.GridSize, pool Pool) {
+	if d.Cache == nil {
+		return
+	}
+	levels := d.LevelList()
+	pool.run("level analysis", len(levels), func(i int) error {
+		d.analyzeLevel(levels[i])
+		return nil
+	})
+	pool.run("replay analysis", len(d.Replays), func(i int) error {
+		d.ReplayComplexity(d.Replays[i], fallback)
+		d.replayTechniques(d.Replays[i], fallback)
+		d.replayFinesse(d.Replays[i], fallback)
+		return nil
+	})
+}
+
+func firstError(failed []FileError, err error) error {
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return failed[0]
+	}
+	return nil
+}
+
+// GridSize returns the board size of a level in the dataset, or fallback
+// for levels it doesn't hold
+func (d *Dataset) GridSize(levelName string, fallback level.GridSize) level.GridSize {
+	if lvl, ok := d.Levels[levelName]; ok {
+		return lvl.GridSize
+	}
+	return fallback
+}
+
+// LevelNames returns the dataset's level names in sorted order
+func (d *Dataset) LevelNames() []string {
+	names := make([]string, 0, len(d.Levels))
+	for name := range d.Levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LevelList returns the dataset's levels in name order
+func (d *Dataset) LevelList() []*level.Level {
+	levels := make([]*level.Level, 0, len(d.Levels))
+	for _, name := range d.LevelNames() {
+		levels = append(levels, d.Levels[name])
+	}
+	return levels
+}
+
+// Cohort returns a dataset holding the replays matching spec, written as
+// key=value with key one of level, mode, version, experiment, arm or band
+// (every player in the skill band). Levels are shared with d.
+func (d *Dataset) Cohort(spec string) (*Dataset, error) {
+	key, value, ok := strings.Cut(spec, "=")
+	if !ok {
+		return nil, fmt.Errorf("cohort %q: want key=value", spec)
+	}
+	var match func(r *replay.Replay) bool
+	switch key {
+	case "level":
+		match = func(r *replay.Replay) bool { return r.Level == value }
+	case "mode":
+		match = func(r *replay.Replay) bool { return r.Mode == value }
+	case "version":
+		match = func(r *replay.Replay) bool { return r.GameVersion == value }
+	case "experiment":
+		match = func(r *replay.Replay) bool { exp, _ := d.experimentArm(r); return exp == value }
+	case "arm":
+		match = func(r *replay.Replay) bool { _, arm := d.experimentArm(r); return arm == value }
+	case "band":
+		match = func(r *replay.Replay) bool {
+			for _, p := range r.Players {
+				if SkillBand(p.Rating) != value {
+					return false
+				}
+			}
+			return len(r.Players) > 0
+		}
+	default:
+		return nil, fmt.Errorf("cohort %q: unknown key %q", spec, key)
+	}
+	cohort := &Dataset{Levels: d.Levels, Cache: d.Cache, replayHashes: d.replayHashes, levelHashes: d.levelHashes}
+	for _, r := range d.Replays {
+		if match(r) {
+			cohort.Replays = append(cohort.Replays, r)
+		}
+	}
+	return cohort, nil
+}
+
+// replayKey is the cache key of a replay's board-dependent results: the
+// replay file, the level file it was played on and the fallback board size.
+// Parts are empty, disabling the cache, for replays and levels that weren't
+// loaded from files.
+func (d *Dataset) replayKey(r *replay.Replay, fallback level.GridSize) []string {
+	lvl := "none"
+	if _, ok := d.Levels[r.Level]; ok {
+		lvl = d.levelHashes[r.Level]
+	}
+	return []string{d.replayHashes[r], lvl, fmt.Sprintf("%dx%d", fallback.Width, fallback.Height)}
+}
+
+// filesWith are the directory's files with one of the extensions, sorted
+func filesWith(dir string, exts ...string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && slices.Contains(exts, filepath.Ext(e.Name())) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
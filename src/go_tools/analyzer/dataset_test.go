@@ -0,0 +1,64 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+func TestLoadLevelsReadsEveryLevelFormat(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	current := level.New("current", 4, 4)
+	current.Blocks = []level.Block{{Type: "I", X: 0, Y: 3}}
+	if err := current.Save(filepath.Join(dir, "current.json")); err != nil {
+		t.Fatal(err)
+	}
+	binary := level.New("binary", 6, 8)
+	if err := os.Mkdir(filepath.Join(dir, "batch"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := binary.Save(filepath.Join(dir, "batch", "binary"+level.BinaryExt)); err != nil {
+		t.Fatal(err)
+	}
+	// From before there was a format, with its lists left out
+	write("old.json", `{"name": "old", "grid_size": {"width": 4, "height": 4}}`)
+	write("manifest.json", `{"levels": []}`)
+	write("future.json", `{"format": 7, "name": "future", "grid_size": {"width": 4, "height": 4}}`)
+
+	d := NewDataset()
+	failed, err := d.LoadLevelsWith(dir, Pool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || filepath.Base(failed[0].File) != "future.json" || !strings.Contains(failed[0].Err.Error(), "7") {
+		t.Errorf("failed %v, want only the format 7 level", failed)
+	}
+	for _, name := range []string{"current", "binary", "old"} {
+		if d.Levels[name] == nil {
+			t.Errorf("level %s not loaded, have %d levels", name, len(d.Levels))
+		}
+	}
+	if len(d.Levels) != 3 {
+		t.Errorf("%d levels loaded, want 3", len(d.Levels))
+	}
+	if old := d.Levels["old"]; old != nil && (old.Format != level.CurrentFormat || old.Blocks == nil || old.SpecialRules == nil) {
+		t.Errorf("the old level wasn't migrated: %+v", old)
+	}
+	if b := d.Levels["binary"]; b != nil && b.GridSize != binary.GridSize {
+		t.Errorf("binary level size %v", b.GridSize)
+	}
+
+	empty := NewDataset()
+	if failed, err := empty.LoadLevelsWith(t.TempDir(), Pool{}); err != nil || len(failed) != 0 || len(empty.Levels) != 0 {
+		t.Errorf("an empty directory: %v, %v", failed, err)
+	}
+}
@@ -0,0 +1,143 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Weights of the composite difficulty score
+const (
+	weightTerrain = 0.3
+	weightHoles   = 0.2
+	weightPickups = 0.1
+	weightClears  = 0.4
+)
+
+// difficultyComponents names the components of the composite score, in
+// the order of difficultyWeights
+var difficultyComponents = []string{"terrain", "holes", "pickups", "clears"}
+
+// difficultyWeights are the weights of the composite difficulty score
+var difficultyWeights = []float64{weightTerrain, weightHoles, weightPickups, weightClears}
+
+// DifficultyReport breaks a level's difficulty down into its components;
+// every component and the composite Score range from 0 (easy) to 1 (hard)
+type DifficultyReport struct {
+	Level               string          `json:"level"`
+	TerrainComplexity   float64         `json:"terrainComplexity"` // BoardComplexity.Terrain of the starting board
+	Complexity          BoardComplexity `json:"complexity"`
+	Holes               int             `json:"holes"`
+	HoleRatio           float64         `json:"holeRatio"`           // holes per block
+	PickupAccessibility float64         `json:"pickupAccessibility"` // share of pickups reachable from a spawn point
+	Simulation          ClearSimulation `json:"simulation"`
+	ClearRate           float64         `json:"clearRate"`
+	Score               float64         `json:"score"`
+}
+
+// AnalyzeLevel scores a level's difficulty from its terrain, holes, how
+// reachable its pickups are and how well a greedy bot clears it
+func AnalyzeLevel(lvl *level.Level) DifficultyReport {
+	report := DifficultyReport{Level: lvl.Name, PickupAccessibility: 1}
+	width, height := lvl.GridSize.Width, lvl.GridSize.Height
+	if width <= 0 || height <= 0 {
+		return report
+	}
+
+	report.Complexity = LevelComplexity(lvl)
+	report.TerrainComplexity = report.Complexity.Terrain(height)
+	report.Holes = report.Complexity.Holes
+	if len(lvl.Blocks) > 0 {
+		report.HoleRatio = clamp(float64(report.Holes) / float64(len(lvl.Blocks)))
+	}
+	report.PickupAccessibility = pickupAccessibility(lvl)
+	report.Simulation = SimulateClears(lvl)
+	report.ClearRate = report.Simulation.Rate(width)
+
+	report.Score = report.weighted(difficultyWeights)
+	return report
+}
+
+// components returns the report's score components, each from 0 (easy)
+// to 1 (hard), in the order of difficultyComponents
+func (r DifficultyReport) components() []float64 {
+	return []float64{r.TerrainComplexity, r.HoleRatio, 1 - r.PickupAccessibility, 1 - r.ClearRate}
+}
+
+// weighted returns the composite score under other component weights
+func (r DifficultyReport) weighted(weights []float64) float64 {
+	score := 0.0
+	for i, c := range r.components() {
+		score += weights[i] * c
+	}
+	return clamp(score)
+}
+
+// Estimate returns the composite difficulty score, usable as the
+// generator's difficulty estimator
+func Estimate(lvl *level.Level) float64 {
+	return AnalyzeLevel(lvl).Score
+}
+
+// pickupAccessibility returns the share of pickups an open path connects
+// to a spawn point; levels without pickups are fully accessible
+func pickupAccessibility(lvl *level.Level) float64 {
+	if len(lvl.Pickups) == 0 {
+		return 1
+	}
+	spawns := make([]level.Zone, 0, len(lvl.SpawnPoints))
+	for _, sp := range lvl.SpawnPoints {
+		spawns = append(spawns, level.Zone{X: sp.X, Y: sp.Y, Width: 1, Height: 1})
+	}
+	if len(spawns) == 0 {
+		spawns = append(spawns, level.Zone{X: 0, Y: 0, Width: lvl.GridSize.Width, Height: 1})
+	}
+	reachable := 0
+	for _, p := range lvl.Pickups {
+		goal := level.Zone{X: p.X, Y: p.Y, Width: 1, Height: 1}
+		for _, s := range spawns {
+			if lvl.Reachable(s, goal) {
+				reachable++
+				break
+			}
+		}
+	}
+	return float64(reachable) / float64(len(lvl.Pickups))
+}
+
+// OrderByDifficulty analyzes a level pack and returns the reports from
+// easiest to hardest
+func OrderByDifficulty(levels []*level.Level) []DifficultyReport {
+	reports := make([]DifficultyReport, len(levels))
+	for i, lvl := range levels {
+		reports[i] = AnalyzeLevel(lvl)
+	}
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].Score < reports[j].Score })
+	return reports
+}
+
+// AnalyzeLevels analyzes the dataset's levels, reusing cached reports for
+// level files analyzed before, and returns them from easiest to hardest
+func (d *Dataset) AnalyzeLevels() []DifficultyReport {
+	levels := d.LevelList()
+	reports := make([]DifficultyReport, len(levels))
+	for i, lvl := range levels {
+		reports[i] = d.analyzeLevel(lvl)
+	}
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].Score < reports[j].Score })
+	return reports
+}
+
+func (d *Dataset) analyzeLevel(lvl *level.Level) DifficultyReport {
+	return cached(d.Cache, "difficulty", func() DifficultyReport { return AnalyzeLevel(lvl) }, d.levelHashes[lvl.Name])
+}
+
+func clamp(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
@@ -0,0 +1,48 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+func TestBoardPlaceClearsFullRows(t *testing.T) {
+	b := make(board, 4)
+	for y := range b {
+		b[y] = make([]bool, 4)
+	}
+	for x := 0; x < 3; x++ {
+		b[3][x] = true
+	}
+	b[1][0] = true
+	b[2][0] = true
+	// completing row 2 clears it and drops row 1 into its place
+	if got := b.place([]level.Point{{X: 1, Y: 2}, {X: 2, Y: 2}, {X: 3, Y: 2}}, 0, 0); got != 1 {
+		t.Fatalf("cleared %d rows, want 1", got)
+	}
+	if !b[3][0] || b[3][3] || !b[2][0] || b[2][1] || b[1][0] {
+		t.Fatalf("rows not shifted down: %v", b)
+	}
+}
+
+func TestAnalyzeLevelRanksHolesHarder(t *testing.T) {
+	flat := level.New("flat", 10, 20)
+	holey := level.New("holey", 10, 20)
+	for x := 0; x < 10; x++ {
+		flat.Blocks = append(flat.Blocks, level.Block{Type: "I", X: x, Y: 19})
+		if x%2 == 0 {
+			holey.Blocks = append(holey.Blocks, level.Block{Type: "I", X: x, Y: 19})
+		}
+		holey.Blocks = append(holey.Blocks, level.Block{Type: "I", X: x, Y: 18})
+	}
+	easy, hard := AnalyzeLevel(flat), AnalyzeLevel(holey)
+	if hard.Holes != 5 {
+		t.Fatalf("holes = %d, want 5", hard.Holes)
+	}
+	if hard.Score <= easy.Score {
+		t.Fatalf("holey level scored %.3f, flat level %.3f", hard.Score, easy.Score)
+	}
+	if order := OrderByDifficulty([]*level.Level{holey, flat}); order[0].Level != "flat" {
+		t.Fatalf("order = %s first, want flat", order[0].Level)
+	}
+}
@@ -0,0 +1,269 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Per-session experiment metrics
+const (
+	ExperimentCompletion = "completion_rate" // sessions cleared or won
+	ExperimentTopOut     = "top_out_rate"
+	ExperimentDuration   = "duration_sec"
+	ExperimentScore      = "score" // mean score across the session's players
+)
+
+// ExperimentMetricNames lists the metrics compared between arms, in report order
+var ExperimentMetricNames = []string{ExperimentCompletion, ExperimentTopOut, ExperimentDuration, ExperimentScore}
+
+// experimentDirection is +1 for metrics where higher is better, -1 where
+// lower is better and 0 for metrics with no preferred direction
+var experimentDirection = map[string]float64{
+	ExperimentCompletion: 1,
+	ExperimentTopOut:     -1,
+	ExperimentDuration:   0,
+	ExperimentScore:      1,
+}
+
+// experimentProportions are the metrics whose per-session values are 0 or 1
+var experimentProportions = map[string]bool{ExperimentCompletion: true, ExperimentTopOut: true}
+
+// Bootstrap settings of the intervals of non-proportion metrics
+const (
+	experimentResamples = 1000
+	experimentSeed      = 11
+)
+
+// ExperimentOptions configures an experiment analysis
+type ExperimentOptions struct {
+	Control    string  // arm the others are compared to; "" picks "control", or the first arm by name
+	Primary    string  // metric that decides the winner
+	Confidence float64 // of the intervals, and 1 - alpha of the winner test
+}
+
+// DefaultExperimentOptions decides on completion rate at 95% confidence
+func DefaultExperimentOptions() ExperimentOptions {
+	return ExperimentOptions{Primary: ExperimentCompletion, Confidence: 0.95}
+}
+
+// ArmMetric is one metric of one arm, compared with the control arm
+type ArmMetric struct {
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	Low    float64 `json:"low"` // confidence interval
+	High   float64 `json:"high"`
+	Lift   float64 `json:"lift"`   // relative to control, 0 for the control arm
+	PValue float64 `json:"pValue"` // against control, 1 for the control arm
+	// Adjusted is PValue Holm-corrected across the treatment arms, so
+	// adding arms doesn't add false winners
+	Adjusted float64 `json:"adjustedPValue"`
+}
+
+// ArmResult is every metric of one arm
+type ArmResult struct {
+	Arm      string      `json:"arm"`
+	Sessions int         `json:"sessions"`
+	Metrics  []ArmMetric `json:"metrics"`
+}
+
+// Metric returns the arm's named metric
+func (a ArmResult) Metric(name string) ArmMetric {
+	for _, m := range a.Metrics {
+		if m.Metric == name {
+			return m
+		}
+	}
+	return ArmMetric{Metric: name}
+}
+
+// ExperimentReport compares the arms of one experiment
+type ExperimentReport struct {
+	Experiment string      `json:"experiment"`
+	Control    string      `json:"control"`
+	Primary    string      `json:"primary"`
+	Confidence float64     `json:"confidence"`
+	Arms       []ArmResult `json:"arms"`
+	Winner     string      `json:"winner,omitempty"` // "" when inconclusive
+	Decision   string      `json:"decision"`
+}
+
+// experimentArm tags a session: the replay's own tags win, otherwise the
+// "experiment" and "arm" metadata of the level it was played on, which is
+// how generator experiments mark their packs
+func (d *Dataset) experimentArm(r *replay.Replay) (experiment, arm string) {
+	if r.Experiment != "" {
+		return r.Experiment, r.Arm
+	}
+	if lvl := d.Levels[r.Level]; lvl != nil && lvl.Metadata != nil {
+		return lvl.Metadata["experiment"], lvl.Metadata["arm"]
+	}
+	return "", ""
+}
+
+// Experiments lists the experiments the dataset's sessions are tagged with
+func (d *Dataset) Experiments() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, r := range d.Replays {
+		if exp, arm := d.experimentArm(r); exp != "" && arm != "" && !seen[exp] {
+			seen[exp] = true
+			names = append(names, exp)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AnalyzeExperiment computes every metric per arm of the named experiment
+// with confidence intervals, and picks as winner the arm that beats control
+// on the primary metric with the most lift, significant after a Bonferroni
+// correction for the number of treatment arms
+func (d *Dataset) AnalyzeExperiment(name string, opts ExperimentOptions) (ExperimentReport, error) {
+	if opts.Primary == "" {
+		opts.Primary = ExperimentCompletion
+	}
+	if _, ok := experimentDirection[opts.Primary]; !ok {
+		return ExperimentReport{}, fmt.Errorf("unknown experiment metric %q", opts.Primary)
+	}
+	if experimentDirection[opts.Primary] == 0 {
+		return ExperimentReport{}, fmt.Errorf("metric %s has no better direction to decide a winner on", opts.Primary)
+	}
+	if opts.Confidence <= 0 || opts.Confidence >= 1 {
+		opts.Confidence = 0.95
+	}
+
+	values := make(map[string]map[string][]float64) // arm, metric
+	for _, r := range d.Replays {
+		exp, arm := d.experimentArm(r)
+		if exp != name || arm == "" {
+			continue
+		}
+		if values[arm] == nil {
+			values[arm] = make(map[string][]float64)
+		}
+		for metric, v := range sessionMetrics(r) {
+			values[arm][metric] = append(values[arm][metric], v)
+		}
+	}
+	if len(values) < 2 {
+		return ExperimentReport{}, fmt.Errorf("experiment %s: needs at least two arms, found %d", name, len(values))
+	}
+	arms := make([]string, 0, len(values))
+	for arm := range values {
+		arms = append(arms, arm)
+	}
+	sort.Strings(arms)
+	control := opts.Control
+	if control == "" {
+		control = arms[0]
+		if values["control"] != nil {
+			control = "control"
+		}
+	}
+	if values[control] == nil {
+		return ExperimentReport{}, fmt.Errorf("experiment %s: no sessions in control arm %q", name, control)
+	}
+	sort.SliceStable(arms, func(i, j int) bool { return arms[i] == control && arms[j] != control })
+
+	report := ExperimentReport{Experiment: name, Control: control, Primary: opts.Primary, Confidence: opts.Confidence}
+	alpha := 1 - opts.Confidence
+	for _, arm := range arms {
+		res := ArmResult{Arm: arm, Sessions: len(values[arm][opts.Primary])}
+		for _, metric := range ExperimentMetricNames {
+			res.Metrics = append(res.Metrics, compareArm(values[arm][metric], values[control][metric], metric, alpha, arm == control))
+		}
+		report.Arms = append(report.Arms, res)
+	}
+	for j := range ExperimentMetricNames {
+		ps := make([]float64, 0, len(report.Arms)-1)
+		for _, arm := range report.Arms[1:] {
+			ps = append(ps, arm.Metrics[j].PValue)
+		}
+		for i, adjusted := range stats.Holm(ps) {
+			report.Arms[i+1].Metrics[j].Adjusted = adjusted
+		}
+		report.Arms[0].Metrics[j].Adjusted = 1
+	}
+
+	direction := experimentDirection[opts.Primary]
+	bestLift, worse := 0.0, 0
+	for _, arm := range report.Arms[1:] {
+		m := arm.Metric(opts.Primary)
+		if m.Adjusted >= alpha {
+			continue
+		}
+		diff := (m.Value - report.Arms[0].Metric(opts.Primary).Value) * direction
+		if diff < 0 {
+			worse++
+		} else if diff > bestLift {
+			bestLift, report.Winner = diff, arm.Arm
+		}
+	}
+	switch {
+	case report.Winner != "":
+		report.Decision = fmt.Sprintf("%s beats %s on %s", report.Winner, control, opts.Primary)
+	case worse == len(report.Arms)-1:
+		report.Winner = control
+		report.Decision = fmt.Sprintf("%s beats every treatment on %s", control, opts.Primary)
+	default:
+		report.Decision = fmt.Sprintf("inconclusive: no arm differs significantly from %s on %s", control, opts.Primary)
+	}
+	return report, nil
+}
+
+// sessionMetrics measures one session
+func sessionMetrics(r *replay.Replay) map[string]float64 {
+	completed, toppedOut := 0.0, 0.0
+	if r.Result.Outcome == replay.OutcomeCleared || r.Result.Outcome == replay.OutcomeWin {
+		completed = 1
+	}
+	if r.Result.Outcome == replay.OutcomeTopOut || len(r.EventsOf(replay.EventTopOut)) > 0 {
+		toppedOut = 1
+	}
+	score := 0.0
+	if len(r.Result.Scores) > 0 {
+		for _, s := range r.Result.Scores {
+			score += float64(s)
+		}
+		score /= float64(len(r.Result.Scores))
+	}
+	return map[string]float64{
+		ExperimentCompletion: completed,
+		ExperimentTopOut:     toppedOut,
+		ExperimentDuration:   float64(r.Result.DurationMs) / 1000,
+		ExperimentScore:      score,
+	}
+}
+
+// compareArm estimates a metric for one arm, with a Wilson interval for
+// proportions and a bootstrap interval of the mean otherwise, and tests it
+// against the control arm with a two-proportion z-test or, as durations
+// and scores are skewed, a Mann-Whitney U test
+func compareArm(xs, control []float64, metric string, alpha float64, isControl bool) ArmMetric {
+	mean := stats.Mean(xs)
+	m := ArmMetric{Metric: metric, Value: mean, PValue: 1}
+	n := float64(len(xs))
+	if experimentProportions[metric] {
+		m.Low, m.High = stats.WilsonInterval(mean, n, stats.NormalQuantile(alpha))
+	} else {
+		m.Low, m.High = stats.BootstrapCI(xs, stats.Mean, 1-alpha, experimentResamples, rng.NewXoshiro(experimentSeed))
+	}
+	if isControl {
+		return m
+	}
+	controlMean := stats.Mean(control)
+	if controlMean != 0 {
+		m.Lift = (mean - controlMean) / math.Abs(controlMean)
+	}
+	if experimentProportions[metric] {
+		m.PValue = stats.TwoProportionP(mean, n, controlMean, float64(len(control)))
+	} else {
+		_, m.PValue = stats.MannWhitneyU(xs, control)
+	}
+	return m
+}
@@ -0,0 +1,69 @@
+package analyzer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// armSessions returns n solo sessions of which cleared end in a clear
+func armSessions(exp, arm string, n, cleared int) []*replay.Replay {
+	var out []*replay.Replay
+	for i := 0; i < n; i++ {
+		r := &replay.Replay{SessionID: fmt.Sprintf("%s-%d", arm, i), Experiment: exp, Arm: arm,
+			Result: replay.Result{Outcome: replay.OutcomeTopOut, DurationMs: int64(60000 + i*100)}}
+		if i < cleared {
+			r.Result.Outcome = replay.OutcomeCleared
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func TestAnalyzeExperimentPicksSignificantWinner(t *testing.T) {
+	data := NewDataset()
+	data.Replays = append(armSessions("gen", "control", 200, 80), armSessions("gen", "b", 200, 130)...)
+	data.Replays = append(data.Replays, armSessions("gen", "c", 200, 84)...)
+
+	report, err := data.AnalyzeExperiment("gen", DefaultExperimentOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Control != "control" || report.Arms[0].Arm != "control" {
+		t.Errorf("control = %s, first arm %s", report.Control, report.Arms[0].Arm)
+	}
+	if report.Winner != "b" {
+		t.Errorf("winner = %q (%s), want b", report.Winner, report.Decision)
+	}
+	for _, a := range report.Arms {
+		m := a.Metric(ExperimentCompletion)
+		if m.Low > m.Value || m.High < m.Value {
+			t.Errorf("arm %s: %.3f outside [%.3f, %.3f]", a.Arm, m.Value, m.Low, m.High)
+		}
+	}
+}
+
+func TestAnalyzeExperimentInconclusive(t *testing.T) {
+	data := NewDataset()
+	data.Replays = append(armSessions("gen", "a", 30, 12), armSessions("gen", "b", 30, 14)...)
+	report, err := data.AnalyzeExperiment("gen", DefaultExperimentOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Control != "a" || report.Winner != "" {
+		t.Errorf("control %s winner %q, want a and none", report.Control, report.Winner)
+	}
+}
+
+func TestExperimentArmFromLevelMetadata(t *testing.T) {
+	data := NewDataset()
+	lvl := level.New("pack-b-1", 10, 20)
+	lvl.Metadata = map[string]string{"experiment": "gen", "arm": "b"}
+	data.Levels[lvl.Name] = lvl
+	data.Replays = []*replay.Replay{{Level: "pack-b-1"}, {Level: "untagged"}}
+	if got := data.Experiments(); len(got) != 1 || got[0] != "gen" {
+		t.Errorf("experiments = %v, want [gen]", got)
+	}
+}
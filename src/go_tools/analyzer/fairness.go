@@ -0,0 +1,158 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Fairness analysis settings; the null distributions of droughts and
+// streaks are estimated by simulating the randomizer with a fixed seed,
+// often enough that the smallest possible p-value survives correction
+const (
+	fairnessTrials = 500
+	fairnessSeed   = 7
+	fairnessAlpha  = 0.01
+)
+
+// FairnessReport compares observed piece sequences to what the randomizer
+// should produce
+type FairnessReport struct {
+	Randomizer     string         `json:"randomizer"`
+	Sequences      int            `json:"sequences"`
+	Pieces         int            `json:"pieces"`
+	Counts         map[string]int `json:"counts"`
+	ChiSquare      float64        `json:"chiSquare"`
+	DistributionP  float64        `json:"distributionP"` // against a uniform piece distribution
+	MaxDrought     map[string]int `json:"maxDrought"`    // longest run without each piece
+	LongestDrought int            `json:"longestDrought"`
+	DroughtP       float64        `json:"droughtP"` // chance the randomizer produces a drought this long
+	LongestStreak  int            `json:"longestStreak"`
+	StreakP        float64        `json:"streakP"` // chance the randomizer repeats a piece this often
+	Flags          []string       `json:"flags"`   // deviations significant after Holm correction across the three tests
+}
+
+// sequenceShape holds the drought and streak extremes of a set of sequences
+type sequenceShape struct {
+	maxDrought map[string]int
+	drought    int
+	streak     int
+}
+
+func measureSequences(sequences [][]string) sequenceShape {
+	shape := sequenceShape{maxDrought: make(map[string]int)}
+	for _, seq := range sequences {
+		last := make(map[string]int, len(level.BlockTypes))
+		for _, t := range level.BlockTypes {
+			last[t] = -1
+		}
+		run := 0
+		for i, p := range seq {
+			if gap := i - last[p] - 1; gap > shape.maxDrought[p] {
+				shape.maxDrought[p] = gap
+			}
+			last[p] = i
+			if i > 0 && seq[i-1] == p {
+				run++
+			} else {
+				run = 1
+			}
+			if run > shape.streak {
+				shape.streak = run
+			}
+		}
+		// a piece that hasn't come since its last appearance is still in a drought
+		for _, t := range level.BlockTypes {
+			if gap := len(seq) - last[t] - 1; gap > shape.maxDrought[t] {
+				shape.maxDrought[t] = gap
+			}
+		}
+	}
+	for _, d := range shape.maxDrought {
+		if d > shape.drought {
+			shape.drought = d
+		}
+	}
+	return shape
+}
+
+// PieceSequences collects the non-empty piece sequences of the replays
+func PieceSequences(replays []*replay.Replay) [][]string {
+	var out [][]string
+	for _, r := range replays {
+		if len(r.Pieces) > 0 {
+			out = append(out, r.Pieces)
+		}
+	}
+	return out
+}
+
+// AnalyzeFairness tests piece sequences for distribution bias, droughts and
+// repeat streaks the named randomizer is unlikely to produce
+func AnalyzeFairness(sequences [][]string, randomizer string) (FairnessReport, error) {
+	report := FairnessReport{Randomizer: randomizer, Sequences: len(sequences), Counts: make(map[string]int)}
+	src := rng.NewXoshiro(fairnessSeed)
+	if _, err := pieces.New(randomizer, src); err != nil {
+		return report, err
+	}
+
+	for _, seq := range sequences {
+		for _, p := range seq {
+			if !level.IsBlockType(p) {
+				return report, fmt.Errorf("unknown piece %q in sequence", p)
+			}
+			report.Counts[p]++
+			report.Pieces++
+		}
+	}
+	if report.Pieces == 0 {
+		return report, nil
+	}
+
+	observedCounts := make([]float64, len(level.BlockTypes))
+	expectedCounts := make([]float64, len(level.BlockTypes))
+	for i, t := range level.BlockTypes {
+		observedCounts[i] = float64(report.Counts[t])
+		expectedCounts[i] = float64(report.Pieces) / float64(len(level.BlockTypes))
+	}
+	report.ChiSquare, report.DistributionP = stats.ChiSquare(observedCounts, expectedCounts)
+
+	observed := measureSequences(sequences)
+	report.MaxDrought = observed.maxDrought
+	report.LongestDrought = observed.drought
+	report.LongestStreak = observed.streak
+
+	droughts, streaks := 0, 0
+	for trial := 0; trial < fairnessTrials; trial++ {
+		simulated := make([][]string, len(sequences))
+		for i, seq := range sequences {
+			r, _ := pieces.New(randomizer, src)
+			simulated[i] = pieces.Take(r, len(seq))
+		}
+		shape := measureSequences(simulated)
+		if shape.drought >= observed.drought {
+			droughts++
+		}
+		if shape.streak >= observed.streak {
+			streaks++
+		}
+	}
+	report.DroughtP = float64(droughts+1) / float64(fairnessTrials+1)
+	report.StreakP = float64(streaks+1) / float64(fairnessTrials+1)
+
+	adjusted := stats.Holm([]float64{report.DistributionP, report.DroughtP, report.StreakP})
+	if adjusted[0] < fairnessAlpha {
+		report.Flags = append(report.Flags, fmt.Sprintf("piece distribution is biased (chi-square %.1f, adjusted p=%.4f)", report.ChiSquare, adjusted[0]))
+	}
+	if adjusted[1] < fairnessAlpha {
+		report.Flags = append(report.Flags, fmt.Sprintf("%d-piece drought is unlikely under %s (adjusted p=%.4f)", report.LongestDrought, randomizer, adjusted[1]))
+	}
+	if adjusted[2] < fairnessAlpha {
+		report.Flags = append(report.Flags, fmt.Sprintf("%d repeats in a row is unlikely under %s (adjusted p=%.4f)", report.LongestStreak, randomizer, adjusted[2]))
+	}
+	return report, nil
+}
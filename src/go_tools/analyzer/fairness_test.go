@@ -0,0 +1,34 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+func TestAnalyzeFairness(t *testing.T) {
+	r, _ := pieces.New(pieces.Bag7, rng.NewXoshiro(3))
+	fair, err := AnalyzeFairness([][]string{pieces.Take(r, 700)}, pieces.Bag7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fair.Flags) != 0 {
+		t.Fatalf("bag7 output flagged: %v", fair.Flags)
+	}
+
+	// the same sequence with every I replaced can't come from a 7-bag
+	rigged := pieces.Take(r, 700)
+	for i, p := range rigged {
+		if p == "I" {
+			rigged[i] = "S"
+		}
+	}
+	unfair, err := AnalyzeFairness([][]string{rigged}, pieces.Bag7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unfair.Flags) < 2 || unfair.MaxDrought["I"] != 700 {
+		t.Fatalf("rigged sequence not flagged: %+v", unfair)
+	}
+}
@@ -0,0 +1,73 @@
+package analyzer
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// ReplayFilter narrows the sessions and levels a dataset loads; zero
+// fields match everything
+type ReplayFilter struct {
+	Since   time.Time // sessions started at or after; those without a start time are dropped
+	Until   time.Time // sessions started before
+	Levels  []string  // level name patterns, as in path.Match; any may match
+	Players []string  // player IDs or names; sessions with any of them match
+}
+
+// Validate checks the level patterns
+func (f *ReplayFilter) Validate() error {
+	for _, p := range f.Levels {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("level pattern %q: %w", p, err)
+		}
+	}
+	if !f.Since.IsZero() && !f.Until.IsZero() && !f.Since.Before(f.Until) {
+		return fmt.Errorf("filter window %s to %s is empty", f.Since.Format(time.DateOnly), f.Until.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// MatchLevel reports whether the named level passes the filter; a nil
+// filter matches every level
+func (f *ReplayFilter) MatchLevel(name string) bool {
+	if f == nil || len(f.Levels) == 0 {
+		return true
+	}
+	for _, p := range f.Levels {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchReplay reports whether the session passes the filter; a nil
+// filter matches every session
+func (f *ReplayFilter) MatchReplay(r *replay.Replay) bool {
+	if f == nil {
+		return true
+	}
+	if !f.Since.IsZero() && (r.StartedAt.IsZero() || r.StartedAt.Before(f.Since)) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.StartedAt.Before(f.Until) {
+		return false
+	}
+	if !f.MatchLevel(r.Level) {
+		return false
+	}
+	if len(f.Players) == 0 {
+		return true
+	}
+	for _, p := range r.Players {
+		for _, want := range f.Players {
+			if p.ID == want || (p.Name != "" && p.Name == want) {
+				return true
+			}
+		}
+	}
+	return false
+}
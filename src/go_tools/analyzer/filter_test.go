@@ -0,0 +1,54 @@
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilterAppliesWhileLoading(t *testing.T) {
+	dir := t.TempDir()
+	for i, lvl := range []string{"pack2/pit", "pack3/pit", "pack3/caves", "pack3/pit"} {
+		started := time.Date(2024, 5, 30+i, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		data := fmt.Sprintf(`{"sessionId":"s%d","level":%q,"startedAt":%q,"players":[{"id":"p%d","name":"ann"}],
+			"events":[],"result":{"durationMs":1000,"outcome":"cleared"}}`, i, lvl, started, i%2)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("s%d.json", i)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter := &ReplayFilter{
+		Since:   time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Levels:  []string{"pack3/*"},
+		Players: []string{"p0", "p1"},
+	}
+	if err := filter.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDataset()
+	d.Filter = filter
+	if err := d.LoadReplays(dir); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range d.Replays {
+		got = append(got, r.SessionID)
+	}
+	// s0 is pack2 and s1 started on May 31
+	if fmt.Sprint(got) != "[s2 s3]" {
+		t.Errorf("kept %v, want [s2 s3]", got)
+	}
+
+	filter.Players = []string{"ann"}
+	filter.Until = time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)
+	if !filter.MatchLevel("pack3/caves") || filter.MatchLevel("pack2/pit") {
+		t.Error("level pattern mismatch")
+	}
+	if !filter.MatchReplay(d.Replays[0]) || filter.MatchReplay(d.Replays[1]) {
+		t.Error("Until should keep June 1 and drop June 2")
+	}
+	if err := (&ReplayFilter{Levels: []string{"pack["}}).Validate(); err == nil {
+		t.Error("malformed pattern accepted")
+	}
+}
@@ -0,0 +1,264 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// FinesseStats is how efficiently a player moved their pieces into place:
+// the shifts and rotations they used against the fewest reaching the same
+// placements from where the pieces spawned, soft drops and gravity being
+// free, and the pieces they misdropped. A misdrop is a lock leaving new
+// holes where the same piece, turned the same way, could have gone a
+// column to either side without any.
+type FinesseStats struct {
+	Player   string `json:"player"`
+	Name     string `json:"name,omitempty"`
+	Sessions int    `json:"sessions"`
+	Pieces   int    `json:"pieces"`  // locks compared
+	Inputs   int    `json:"inputs"`  // shifts and rotations the player moved them with
+	Optimal  int    `json:"optimal"` // the fewest that reach the same placements
+	Wasted   int    `json:"wasted"`  // inputs past the fewest, summed over the pieces
+	Faults   int    `json:"faults"`  // pieces moved with more than the fewest
+	Misdrops int    `json:"misdrops"`
+	Skipped  int    `json:"skipped"` // locks that could not be replayed onto the board or reached from their spawn
+}
+
+// WastedPerPiece is the inputs wasted on an average piece
+func (s FinesseStats) WastedPerPiece() float64 { return ratio(s.Wasted, s.Pieces) }
+
+// FaultRate is the share of the pieces moved with more inputs than needed
+func (s FinesseStats) FaultRate() float64 { return ratio(s.Faults, s.Pieces) }
+
+// MisdropRate is the share of the pieces misdropped
+func (s FinesseStats) MisdropRate() float64 { return ratio(s.Misdrops, s.Pieces) }
+
+func ratio(n, of int) float64 {
+	if of == 0 {
+		return 0
+	}
+	return float64(n) / float64(of)
+}
+
+func (s *FinesseStats) merge(o FinesseStats) {
+	s.Sessions += o.Sessions
+	s.Pieces += o.Pieces
+	s.Inputs += o.Inputs
+	s.Optimal += o.Optimal
+	s.Wasted += o.Wasted
+	s.Faults += o.Faults
+	s.Misdrops += o.Misdrops
+	s.Skipped += o.Skipped
+}
+
+// AnalyzeFinesse compares every player's inputs to the fewest that place
+// their pieces where they locked, ordered by player ID. Boards start from
+// the level's blocks when the level is loaded and empty otherwise, and
+// pieces turn by the replay's rotation system.
+func (d *Dataset) AnalyzeFinesse(fallback level.GridSize) []FinesseStats {
+	players := make(map[string]*FinesseStats)
+	for _, r := range d.Replays {
+		byPlayer := d.replayFinesse(r, fallback)
+		for _, p := range r.Players {
+			s := players[p.ID]
+			if s == nil {
+				s = &FinesseStats{Player: p.ID}
+				players[p.ID] = s
+			}
+			if p.Name != "" {
+				s.Name = p.Name
+			}
+			s.merge(byPlayer[p.ID])
+		}
+	}
+	out := make([]FinesseStats, 0, len(players))
+	for _, s := range players {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Player < out[j].Player })
+	return out
+}
+
+// replayFinesse measures every player's finesse in a replay, keyed by
+// player
+func (d *Dataset) replayFinesse(r *replay.Replay, fallback level.GridSize) map[string]FinesseStats {
+	return cached(d.Cache, "finesse", func() map[string]FinesseStats {
+		out := make(map[string]FinesseStats, len(r.Players))
+		for _, p := range r.Players {
+			out[p.ID] = replayFinesse(r, p.ID, d.startBoard(r, fallback))
+		}
+		return out
+	}, d.replayKey(r, fallback)...)
+}
+
+// replayFinesse measures one player's finesse in a replay, locking each
+// piece onto b. A lock's inputs are the player's up to its frame, ending
+// at the hard drop that locked it, and from the last hold among them the
+// piece it brought into play is the one measured.
+func replayFinesse(r *replay.Replay, player string, b board) FinesseStats {
+	stats := FinesseStats{Player: player, Sessions: 1}
+	if len(b) == 0 || len(b[0]) == 0 {
+		return stats
+	}
+	name := pieces.RotationSRS
+	if r.Rules != nil && r.Rules.Rotation != "" {
+		name = r.Rules.Rotation
+	}
+	turns, err := pieces.NewRotation(name)
+	if err != nil {
+		return stats
+	}
+	var inputs []replay.Input
+	for _, in := range r.Inputs {
+		if in.Player == player {
+			inputs = append(inputs, in)
+		}
+	}
+	sort.SliceStable(inputs, func(i, j int) bool { return inputs[i].Frame < inputs[j].Frame })
+
+	next := 0
+	var spawn *replay.Event
+	for i, ev := range r.Events {
+		if ev.Player != player {
+			continue
+		}
+		if ev.Type == replay.EventSpawn {
+			spawn = &r.Events[i]
+			continue
+		}
+		if ev.Type != replay.EventLock {
+			continue
+		}
+		used := 0
+		for ; next < len(inputs) && inputs[next].Frame <= ev.Frame; next++ {
+			switch inputs[next].Action {
+			case replay.ActionLeft, replay.ActionRight, replay.ActionRotateCW, replay.ActionRotateCCW:
+				used++
+			case replay.ActionHold:
+				used = 0
+			}
+			if inputs[next].Action == replay.ActionHardDrop {
+				next++
+				break
+			}
+		}
+		from := spawn
+		spawn = nil
+		cells, ok := pieces.Cells(ev.Piece, ev.Rotation)
+		if !ok || !b.fits(cells, ev.X, ev.Y) {
+			stats.Skipped++
+			continue
+		}
+		var costs map[finesseAt]int
+		if from != nil && from.Piece == ev.Piece {
+			costs = b.finesse(turns, ev.Piece, finesseAt{x: from.X, y: from.Y})
+		}
+		fewest, reached := costs[finesseAt{x: ev.X, y: ev.Y, rot: ev.Rotation % 4}]
+		if !reached {
+			stats.Skipped++
+			b.place(cells, ev.X, ev.Y)
+			continue
+		}
+		stats.Pieces++
+		stats.Inputs += used
+		stats.Optimal += fewest
+		if used > fewest {
+			stats.Wasted += used - fewest
+			stats.Faults++
+		}
+		if b.misdrop(ev, costs) {
+			stats.Misdrops++
+		}
+		b.place(cells, ev.X, ev.Y)
+	}
+	return stats
+}
+
+// finesseAt is where and how a piece is turned
+type finesseAt struct{ x, y, rot int }
+
+// finesse is the fewest shifts and rotations that take the piece from
+// start to each place it can lock, soft drops being free, keyed by where
+// it locks
+func (b board) finesse(turns pieces.RotationSystem, piece string, start finesseAt) map[finesseAt]int {
+	fits := func(at finesseAt) bool {
+		cells, _ := pieces.Cells(piece, at.rot)
+		return b.fits(cells, at.x, at.y)
+	}
+	if !fits(start) {
+		return nil
+	}
+	// a search over positions costing 0 or 1, the free soft drops at
+	// the front of the queue
+	cost := map[finesseAt]int{start: 0}
+	queue := []finesseAt{start}
+	for len(queue) > 0 {
+		at := queue[0]
+		queue = queue[1:]
+		c := cost[at]
+		visit := func(to finesseAt, step int) {
+			if old, seen := cost[to]; seen && old <= c+step {
+				return
+			}
+			cost[to] = c + step
+			if step == 0 {
+				queue = append([]finesseAt{to}, queue...)
+			} else {
+				queue = append(queue, to)
+			}
+		}
+		if down := (finesseAt{x: at.x, y: at.y + 1, rot: at.rot}); fits(down) {
+			visit(down, 0)
+		}
+		for _, dx := range []int{-1, 1} {
+			if side := (finesseAt{x: at.x + dx, y: at.y, rot: at.rot}); fits(side) {
+				visit(side, 1)
+			}
+		}
+		for _, turn := range []int{1, 3} {
+			to := (at.rot + turn) % 4
+			for _, k := range turns.Kicks(piece, at.rot, to) {
+				if kicked := (finesseAt{x: at.x + k.X, y: at.y + k.Y, rot: to}); fits(kicked) {
+					visit(kicked, 1)
+					break
+				}
+			}
+		}
+	}
+	locks := make(map[finesseAt]int)
+	for at, c := range cost {
+		if fits(finesseAt{x: at.x, y: at.y + 1, rot: at.rot}) {
+			continue // not resting on anything
+		}
+		if old, seen := locks[at]; !seen || c < old {
+			locks[at] = c
+		}
+	}
+	return locks
+}
+
+// misdrop reports whether the lock leaves new holes where a place the
+// piece could lock at a column to either side, turned the same way,
+// leaves none
+func (b board) misdrop(ev replay.Event, reachable map[finesseAt]int) bool {
+	_, before, _ := b.surface()
+	holes := func(x, y int) int {
+		cells, _ := pieces.Cells(ev.Piece, ev.Rotation)
+		after := b.clone()
+		after.place(cells, x, y)
+		_, h, _ := after.surface()
+		return h
+	}
+	if holes(ev.X, ev.Y) <= before {
+		return false
+	}
+	for at := range reachable {
+		if at.rot == ev.Rotation%4 && (at.x == ev.X-1 || at.x == ev.X+1) && holes(at.x, at.y) <= before {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestReplayFinesse(t *testing.T) {
+	b := boardFrom(
+		"..........",
+		"..........",
+		"..........",
+		"..........",
+		"..........",
+		".....#....",
+	)
+	r := &replay.Replay{
+		Inputs: []replay.Input{
+			// four lefts would do, the right and a left more are wasted
+			{Frame: 2, Player: "p", Action: replay.ActionRight},
+			{Frame: 3, Player: "p", Action: replay.ActionLeft},
+			{Frame: 4, Player: "p", Action: replay.ActionLeft},
+			{Frame: 5, Player: "p", Action: replay.ActionLeft},
+			{Frame: 6, Player: "p", Action: replay.ActionLeft},
+			{Frame: 7, Player: "p", Action: replay.ActionLeft},
+			{Frame: 7, Player: "q", Action: replay.ActionRight},
+			{Frame: 8, Player: "p", Action: replay.ActionHardDrop},
+			{Frame: 20, Player: "p", Action: replay.ActionHardDrop},
+		},
+		Events: []replay.Event{
+			{Frame: 1, Type: replay.EventSpawn, Player: "p", Piece: "O", X: 4},
+			{Frame: 8, Type: replay.EventLock, Player: "p", Piece: "O", X: 0, Y: 4},
+			// dropped straight onto the block, a hole beside it where a
+			// column left would have left none
+			{Frame: 10, Type: replay.EventSpawn, Player: "p", Piece: "O", X: 4},
+			{Frame: 20, Type: replay.EventLock, Player: "p", Piece: "O", X: 4, Y: 3},
+			{Frame: 21, Type: replay.EventSpawn, Player: "p", Piece: "T", X: 4},
+			{Frame: 30, Type: replay.EventLock, Player: "p", Piece: "I", X: 4, Y: 0},
+			{Frame: 30, Type: replay.EventLock, Player: "q", Piece: "O", X: 8, Y: 4},
+		},
+	}
+	s := replayFinesse(r, "p", b)
+	want := FinesseStats{Player: "p", Sessions: 1, Pieces: 2, Inputs: 6, Optimal: 4, Wasted: 2, Faults: 1, Misdrops: 1, Skipped: 1}
+	if s != want {
+		t.Errorf("stats = %+v, want %+v", s, want)
+	}
+	if s.WastedPerPiece() != 1 || s.MisdropRate() != 0.5 {
+		t.Errorf("%.2f wasted a piece, %.2f misdropped", s.WastedPerPiece(), s.MisdropRate())
+	}
+}
+
+func TestFinesseRotations(t *testing.T) {
+	b := boardFrom(
+		"..........",
+		"..........",
+		"..........",
+		"..........",
+	)
+	turns, err := pieces.NewRotation(pieces.RotationSRS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	costs := b.finesse(turns, "T", finesseAt{x: 4})
+	// turned either way against the left wall, a turn and the shifts
+	// there; turned clockwise on the floor it kicks the last column left
+	for at, want := range map[finesseAt]int{{x: -1, y: 1, rot: 1}: 5, {x: 0, y: 1, rot: 3}: 5, {x: 4, y: 2}: 0, {x: 4, y: 1, rot: 2}: 2} {
+		if c, ok := costs[at]; !ok || c != want {
+			t.Errorf("locking at %+v takes %d inputs (reached %t), want %d", at, c, ok, want)
+		}
+	}
+	if _, ok := costs[finesseAt{x: 4, y: 1}]; ok {
+		t.Error("a piece in the air counted as a place to lock")
+	}
+}
@@ -0,0 +1,142 @@
+package analyzer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Client events that make up the default funnel
+const (
+	ClientLaunch           = "launch"
+	ClientTutorialComplete = "tutorial_complete"
+	ClientMultiplayerMatch = "multiplayer_match"
+	ClientWin              = "win"
+	ClientInputLatency     = "input_latency" // a sample of input-to-lock latency, in LatencyMs
+)
+
+// DefaultFunnel is the onboarding funnel from first launch to first win
+var DefaultFunnel = []string{ClientLaunch, ClientTutorialComplete, ClientMultiplayerMatch, ClientWin}
+
+// FunnelAllVersions is the version key of the funnel over every player
+const FunnelAllVersions = "all"
+
+// ClientEvent is one line of the client's event log
+type ClientEvent struct {
+	ID         string    `json:"id,omitempty"` // the client's, unique to the event, so an event sent twice is kept once
+	Time       time.Time `json:"time"`
+	Player     string    `json:"player"`
+	Event      string    `json:"event"`
+	Version    string    `json:"version"`
+	Build      string    `json:"build,omitempty"` // client build, when finer than the version
+	Platform   string    `json:"platform,omitempty"`
+	Experiment string    `json:"experiment,omitempty"` // A/B experiment the player was assigned to
+	Arm        string    `json:"arm,omitempty"`
+	LatencyMs  float64   `json:"latencyMs,omitempty"`
+}
+
+// LoadClientEvents reads a client event log with one JSON event per line
+func LoadClientEvents(path string) ([]ClientEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []ClientEvent
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var ev ClientEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		events = append(events, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// FunnelStep is how many players reached one step of a funnel
+type FunnelStep struct {
+	Step       string  `json:"step"`
+	Players    int     `json:"players"`
+	Conversion float64 `json:"conversion"` // share of the previous step's players
+	DropOff    float64 `json:"dropOff"`    // 1 - Conversion
+	Overall    float64 `json:"overall"`    // share of the first step's players
+}
+
+// Funnel is a funnel for the players of one game version
+type Funnel struct {
+	Version string       `json:"version"`
+	Steps   []FunnelStep `json:"steps"`
+}
+
+// ComputeFunnels counts the players completing each step in order, for
+// everyone and per game version; a player belongs to the version they
+// first appear with
+func ComputeFunnels(events []ClientEvent, steps []string) []Funnel {
+	sorted := append([]ClientEvent(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	reached := make(map[string]int)     // steps completed per player
+	versions := make(map[string]string) // version per player
+	for _, ev := range sorted {
+		if _, ok := versions[ev.Player]; !ok {
+			versions[ev.Player] = ev.Version
+		}
+		if n := reached[ev.Player]; n < len(steps) && ev.Event == steps[n] {
+			reached[ev.Player] = n + 1
+		}
+	}
+
+	counts := map[string][]int{FunnelAllVersions: make([]int, len(steps))}
+	for player, n := range reached {
+		v := versions[player]
+		if counts[v] == nil {
+			counts[v] = make([]int, len(steps))
+		}
+		for i := 0; i < n; i++ {
+			counts[FunnelAllVersions][i]++
+			counts[v][i]++
+		}
+	}
+
+	keys := make([]string, 0, len(counts))
+	for v := range counts {
+		if v != FunnelAllVersions {
+			keys = append(keys, v)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{FunnelAllVersions}, keys...)
+
+	funnels := make([]Funnel, 0, len(keys))
+	for _, v := range keys {
+		f := Funnel{Version: v}
+		for i, step := range steps {
+			s := FunnelStep{Step: step, Players: counts[v][i]}
+			if first := counts[v][0]; first > 0 {
+				s.Overall = float64(s.Players) / float64(first)
+			}
+			s.Conversion = 1
+			if i > 0 {
+				s.Conversion = 0
+				if prev := counts[v][i-1]; prev > 0 {
+					s.Conversion = float64(s.Players) / float64(prev)
+				}
+			}
+			s.DropOff = 1 - s.Conversion
+			f.Steps = append(f.Steps, s)
+		}
+		funnels = append(funnels, f)
+	}
+	return funnels
+}
@@ -0,0 +1,103 @@
+package analyzer
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComputeFunnelsCountsStepsInOrder(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(min int, player, event, version string) ClientEvent {
+		return ClientEvent{Time: start.Add(time.Duration(min) * time.Minute), Player: player, Event: event, Version: version}
+	}
+	// Out of time order, as logs merged from several clients arrive
+	events := []ClientEvent{
+		at(4, "p1", ClientWin, "1.0"),
+		at(1, "p1", ClientLaunch, "1.0"),
+		at(2, "p1", ClientTutorialComplete, "1.0"),
+		at(3, "p1", ClientMultiplayerMatch, "1.0"),
+		at(1, "p2", ClientLaunch, "1.0"),
+		at(2, "p2", ClientMultiplayerMatch, "1.0"), // before the tutorial, so not a step
+		at(3, "p2", ClientTutorialComplete, "1.0"),
+		at(1, "p3", ClientLaunch, "1.1"),
+		at(2, "p3", ClientTutorialComplete, "1.2"), // still a 1.1 player
+		at(1, "p4", ClientTutorialComplete, "2.0"), // never launched
+		at(2, "p4", ClientWin, "2.0"),
+	}
+	funnels := ComputeFunnels(events, DefaultFunnel)
+
+	want := map[string][]int{
+		FunnelAllVersions: {3, 3, 1, 1},
+		"1.0":             {2, 2, 1, 1},
+		"1.1":             {1, 1, 0, 0},
+	}
+	if len(funnels) != len(want) || funnels[0].Version != FunnelAllVersions || funnels[1].Version != "1.0" || funnels[2].Version != "1.1" {
+		t.Fatalf("funnels %+v", funnels)
+	}
+	for _, f := range funnels {
+		for i, s := range f.Steps {
+			if s.Step != DefaultFunnel[i] || s.Players != want[f.Version][i] {
+				t.Errorf("%s step %d: %+v, want %d players at %s", f.Version, i, s, want[f.Version][i], DefaultFunnel[i])
+			}
+		}
+	}
+
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	match := funnels[0].Steps[2]
+	if !near(match.Conversion, 1.0/3) || !near(match.DropOff, 2.0/3) || !near(match.Overall, 1.0/3) {
+		t.Errorf("all versions' match step %+v", match)
+	}
+	if win := funnels[0].Steps[3]; win.Conversion != 1 || !near(win.Overall, 1.0/3) {
+		t.Errorf("all versions' win step %+v", win)
+	}
+	if first := funnels[0].Steps[0]; first.Conversion != 1 || first.DropOff != 0 || first.Overall != 1 {
+		t.Errorf("the first step %+v", first)
+	}
+	// No one reached a match on 1.1, so its win step converts nothing
+	if win := funnels[2].Steps[3]; win.Conversion != 0 || win.DropOff != 1 {
+		t.Errorf("1.1 win step %+v", win)
+	}
+
+	table := FunnelTable(funnels)
+	if len(table.Rows) != 3*len(DefaultFunnel) {
+		t.Fatalf("%d table rows", len(table.Rows))
+	}
+	var csv bytes.Buffer
+	if err := table.WriteCSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(csv.String(), "version,step,players,conversion,drop_off,overall\nall,launch,3,") {
+		t.Errorf("funnel CSV:\n%s", csv.String())
+	}
+}
+
+func TestLoadClientEventsReportsTheBadLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+	log := `{"time":"2024-05-01T00:00:00Z","player":"p1","event":"launch","version":"1.0"}
+
+{"time":"2024-05-01T00:01:00Z","player":"p1","event":"win","version":"1.0"}
+`
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+	events, err := LoadClientEvents(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1].Event != ClientWin || events[1].Time.Minute() != 1 {
+		t.Errorf("events %+v", events)
+	}
+
+	if err := os.WriteFile(path, []byte(log+"{\"player\":\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadClientEvents(path); err == nil || !strings.Contains(err.Error(), "events.jsonl:4:") {
+		t.Errorf("a bad line gave %v", err)
+	}
+}
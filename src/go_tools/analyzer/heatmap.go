@@ -0,0 +1,195 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Heatmap kinds
+const (
+	HeatmapPlacements = "placements" // every cell covered by a locked piece
+	HeatmapLocks      = "locks"      // the position each piece locked at
+	HeatmapTopOuts    = "top_outs"   // where players topped out
+	HeatmapHoles      = "holes"      // covered empty cells, counted after every lock
+
+	HeatmapPickups       = "pickups"        // the level's spell pickups, once per session
+	HeatmapCollections   = "collections"    // where players collected pickups
+	HeatmapMissedPickups = "missed_pickups" // pickups left uncollected, once per session
+)
+
+// HeatmapKinds lists every heatmap the analyzer can accumulate
+var HeatmapKinds = []string{HeatmapPlacements, HeatmapLocks, HeatmapTopOuts, HeatmapHoles,
+	HeatmapPickups, HeatmapCollections, HeatmapMissedPickups}
+
+// Heatmap accumulates event counts per board cell
+type Heatmap struct {
+	Kind     string      `json:"kind"`
+	Level    string      `json:"level"`
+	Width    int         `json:"width"`
+	Height   int         `json:"height"`
+	Counts   [][]float64 `json:"counts"` // indexed [y][x]
+	Samples  int         `json:"samples"`
+	Sessions int         `json:"sessions"`
+	Diff     bool        `json:"diff,omitempty"` // counts are per-session differences and may be negative
+}
+
+// NewHeatmap returns an empty heatmap for a board of the given size
+func NewHeatmap(kind, levelName string, width, height int) *Heatmap {
+	counts := make([][]float64, height)
+	for y := range counts {
+		counts[y] = make([]float64, width)
+	}
+	return &Heatmap{Kind: kind, Level: levelName, Width: width, Height: height, Counts: counts}
+}
+
+// Add records weight at (x, y); cells outside the board are ignored
+func (h *Heatmap) Add(x, y int, weight float64) {
+	if x < 0 || x >= h.Width || y < 0 || y >= h.Height {
+		return
+	}
+	h.Counts[y][x] += weight
+	h.Samples++
+}
+
+// Max returns the largest cell count
+func (h *Heatmap) Max() float64 {
+	max := 0.0
+	for _, row := range h.Counts {
+		for _, c := range row {
+			if c > max {
+				max = c
+			}
+		}
+	}
+	return max
+}
+
+// Merge adds another heatmap of the same size and kind into h
+func (h *Heatmap) Merge(o *Heatmap) error {
+	if o.Kind != h.Kind || o.Width != h.Width || o.Height != h.Height {
+		return fmt.Errorf("cannot merge %s %dx%d heatmap into %s %dx%d",
+			o.Kind, o.Width, o.Height, h.Kind, h.Width, h.Height)
+	}
+	for y, row := range o.Counts {
+		for x, c := range row {
+			h.Counts[y][x] += c
+		}
+	}
+	h.Samples += o.Samples
+	h.Sessions += o.Sessions
+	return nil
+}
+
+// DiffHeatmaps subtracts cohort b's heatmap from cohort a's, cell by cell,
+// after dividing each by its session count so cohorts of different sizes
+// compare; positive cells are where a does more
+func DiffHeatmaps(a, b *Heatmap) (*Heatmap, error) {
+	if a.Kind != b.Kind || a.Width != b.Width || a.Height != b.Height {
+		return nil, fmt.Errorf("cannot diff %s %dx%d heatmap against %s %dx%d",
+			a.Kind, a.Width, a.Height, b.Kind, b.Width, b.Height)
+	}
+	perSession := func(h *Heatmap) float64 {
+		if h.Sessions == 0 {
+			return 0
+		}
+		return 1 / float64(h.Sessions)
+	}
+	wa, wb := perSession(a), perSession(b)
+	diff := NewHeatmap(a.Kind, a.Level, a.Width, a.Height)
+	diff.Diff = true
+	for y := range diff.Counts {
+		for x := range diff.Counts[y] {
+			diff.Counts[y][x] = a.Counts[y][x]*wa - b.Counts[y][x]*wb
+		}
+	}
+	diff.Samples = a.Samples + b.Samples
+	diff.Sessions = a.Sessions + b.Sessions
+	return diff, nil
+}
+
+// AddReplay accumulates the replay's events matching the heatmap's kind;
+// holes need the reconstructed board, and placed and missed pickups the
+// level, so Dataset.Heatmaps accumulates those
+func (h *Heatmap) AddReplay(r *replay.Replay) {
+	h.Sessions++
+	for _, ev := range r.Events {
+		switch {
+		case h.Kind == HeatmapLocks && ev.Type == replay.EventLock:
+			h.Add(ev.X, ev.Y, 1)
+		case h.Kind == HeatmapPlacements && ev.Type == replay.EventLock:
+			cells, ok := pieces.Cells(ev.Piece, ev.Rotation)
+			if !ok {
+				h.Add(ev.X, ev.Y, 1)
+				continue
+			}
+			for _, c := range cells {
+				h.Add(ev.X+c.X, ev.Y+c.Y, 1)
+			}
+		case h.Kind == HeatmapTopOuts && ev.Type == replay.EventTopOut:
+			h.Add(ev.X, ev.Y, 1)
+		case h.Kind == HeatmapCollections && ev.Type == replay.EventPickup:
+			h.Add(ev.X, ev.Y, 1)
+		}
+	}
+}
+
+// Heatmaps accumulates one heatmap of the given kind per level played in
+// the dataset; boards of levels the dataset doesn't know use fallback
+func (d *Dataset) Heatmaps(kind string, fallback level.GridSize) map[string]*Heatmap {
+	maps := make(map[string]*Heatmap)
+	for _, r := range d.Replays {
+		h, ok := maps[r.Level]
+		if !ok {
+			size := d.GridSize(r.Level, fallback)
+			h = NewHeatmap(kind, r.Level, size.Width, size.Height)
+			maps[r.Level] = h
+		}
+		switch kind {
+		case HeatmapHoles:
+			h.Sessions++
+			d.replayBoards(r, fallback, func(_ string, _ replay.Event, b board) { h.addHoles(b) })
+			continue
+		case HeatmapPickups, HeatmapMissedPickups:
+			h.Sessions++
+			lvl, ok := d.Levels[r.Level]
+			if !ok {
+				continue
+			}
+			collected := collectedPickups(r)
+			for _, p := range lvl.Pickups {
+				if kind == HeatmapPickups || !collected[level.Point{X: p.X, Y: p.Y}] {
+					h.Add(p.X, p.Y, 1)
+				}
+			}
+			continue
+		}
+		h.AddReplay(r)
+	}
+	return maps
+}
+
+// collectedPickups returns the cells any player collected a pickup from
+func collectedPickups(r *replay.Replay) map[level.Point]bool {
+	cells := make(map[level.Point]bool)
+	for _, ev := range r.EventsOf(replay.EventPickup) {
+		cells[level.Point{X: ev.X, Y: ev.Y}] = true
+	}
+	return cells
+}
+
+// addHoles counts every empty cell with a filled cell above it
+func (h *Heatmap) addHoles(b board) {
+	for x := 0; x < h.Width && len(b) > 0 && x < len(b[0]); x++ {
+		covered := false
+		for y := 0; y < h.Height && y < len(b); y++ {
+			if b[y][x] {
+				covered = true
+			} else if covered {
+				h.Add(x, y, 1)
+			}
+		}
+	}
+}
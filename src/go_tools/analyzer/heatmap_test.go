@@ -0,0 +1,162 @@
+package analyzer
+
+import (
+	"fmt"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestDiffHeatmapsPerSession(t *testing.T) {
+	lock := func(x int) *replay.Replay {
+		return &replay.Replay{Events: []replay.Event{{Type: replay.EventLock, X: x, Y: 0}}}
+	}
+	a := NewHeatmap(HeatmapLocks, "l", 2, 1)
+	a.AddReplay(lock(0))
+	a.AddReplay(lock(0))
+	b := NewHeatmap(HeatmapLocks, "l", 2, 1)
+	for _, x := range []int{0, 1, 1, 1} {
+		b.AddReplay(lock(x))
+	}
+
+	d, err := DiffHeatmaps(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(d.Counts[0][0]-0.75) > 1e-9 || math.Abs(d.Counts[0][1]+0.75) > 1e-9 {
+		t.Errorf("diff = %v, want [0.75 -0.75]", d.Counts[0])
+	}
+	cm, err := RenderOptions{}.colorMap(d.Diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	colors := d.cellColors(cm)
+	if colors[0][0] != cm(1) || colors[0][1] != cm(0) {
+		t.Errorf("diff colors %v, want the two ends of the diverging map", colors[0])
+	}
+	if _, err := DiffHeatmaps(a, NewHeatmap(HeatmapLocks, "l", 3, 1)); err == nil {
+		t.Error("diffed heatmaps of different sizes")
+	}
+}
+
+func TestPickupHeatmapsAndCollectionRates(t *testing.T) {
+	data := NewDataset()
+	lvl := level.New("caves", 4, 4)
+	lvl.Pickups = []level.Pickup{{Spell: level.SpellClearLine, X: 0, Y: 1}, {Spell: level.SpellSlowDown, X: 3, Y: 3}}
+	data.Levels[lvl.Name] = lvl
+	for i := 0; i < 10; i++ {
+		r := &replay.Replay{Level: "caves", Players: []replay.Player{{ID: "p"}},
+			Events: []replay.Event{{Type: replay.EventPickup, Player: "p", X: 0, Y: 1, Detail: level.SpellClearLine}}}
+		data.Replays = append(data.Replays, r)
+	}
+	fallback := level.GridSize{Width: 4, Height: 4}
+	placed := data.Heatmaps(HeatmapPickups, fallback)["caves"]
+	collected := data.Heatmaps(HeatmapCollections, fallback)["caves"]
+	missed := data.Heatmaps(HeatmapMissedPickups, fallback)["caves"]
+	if placed.Counts[1][0] != 10 || placed.Counts[3][3] != 10 || collected.Counts[1][0] != 10 || collected.Counts[3][3] != 0 {
+		t.Errorf("placed %v, collected %v", placed.Counts, collected.Counts)
+	}
+	if missed.Counts[1][0] != 0 || missed.Counts[3][3] != 10 {
+		t.Errorf("missed %v, want only the bottom-right pickup", missed.Counts)
+	}
+
+	rates := data.PickupCollections()
+	if len(rates) != 2 || rates[0].Spell != level.SpellSlowDown || !rates[0].Unreachable || rates[1].Rate != 1 || rates[1].Unreachable {
+		t.Errorf("collection rates = %+v", rates)
+	}
+}
+
+func TestPlacementHeatmapCoversPieceCells(t *testing.T) {
+	h := NewHeatmap(HeatmapPlacements, "l", 6, 5)
+	h.AddReplay(&replay.Replay{Events: []replay.Event{
+		{Type: replay.EventLock, Piece: "T", Rotation: 1, X: 2, Y: 1},
+		{Type: replay.EventLock, Piece: "?", X: 0, Y: 4}, // unknown pieces count their lock cell
+		{Type: replay.EventLock, Piece: "O", X: 5, Y: 0}, // half off the board
+	}})
+	want := map[level.Point]float64{{X: 3, Y: 1}: 1, {X: 3, Y: 2}: 1, {X: 4, Y: 2}: 1, {X: 3, Y: 3}: 1, {X: 0, Y: 4}: 1, {X: 5, Y: 0}: 1, {X: 5, Y: 1}: 1}
+	for y, row := range h.Counts {
+		for x, c := range row {
+			if c != want[level.Point{X: x, Y: y}] {
+				t.Errorf("cell (%d,%d) counted %v", x, y, c)
+			}
+		}
+	}
+	if h.Samples != len(want) || h.Sessions != 1 {
+		t.Errorf("%d samples over %d sessions, want %d over 1", h.Samples, h.Sessions, len(want))
+	}
+}
+
+func TestExportHeatmapRendersEachCell(t *testing.T) {
+	h := NewHeatmap(HeatmapLocks, "l", 3, 2)
+	h.Add(0, 0, 4)
+	h.Add(2, 1, 2)
+	heat := ColorMaps["heat"]
+	dir := t.TempDir()
+	opts := RenderOptions{CellSize: 4}
+
+	path := filepath.Join(dir, "locks.png")
+	if err := ExportHeatmap(h, path, opts); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 12 || b.Dy() != 8 {
+		t.Fatalf("image is %dx%d, want 12x8", b.Dx(), b.Dy())
+	}
+	for _, c := range []struct {
+		px, py int
+		t      float64
+	}{{1, 1, 1}, {3, 3, 1}, {9, 5, 0.5}, {5, 1, 0}} {
+		r, g, b, _ := img.At(c.px, c.py).RGBA()
+		want := heat(c.t)
+		if uint8(r>>8) != want.R || uint8(g>>8) != want.G || uint8(b>>8) != want.B {
+			t.Errorf("pixel (%d,%d) is %v, want %v", c.px, c.py, img.At(c.px, c.py), want)
+		}
+	}
+
+	path = filepath.Join(dir, "locks.SVG")
+	if err := ExportHeatmap(h, path, opts); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(data)
+	half := heat(0.5)
+	for _, want := range []string{
+		`width="12" height="8"`,
+		`<rect x="0" y="0" width="4" height="4" fill="#ffffff"><title>(0,0) 4</title></rect>`,
+		fmt.Sprintf(`<rect x="8" y="4" width="4" height="4" fill="#%02x%02x%02x"><title>(2,1) 2</title></rect>`, half.R, half.G, half.B),
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG lacks %s:\n%s", want, svg)
+		}
+	}
+	if n := strings.Count(svg, "<rect"); n != 6 {
+		t.Errorf("%d rects for 6 cells", n)
+	}
+
+	if err := ExportHeatmap(h, filepath.Join(dir, "locks.gif"), opts); err == nil {
+		t.Error("exported a heatmap as a GIF")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "locks.gif")); !os.IsNotExist(err) {
+		t.Error("an unsupported format left a file behind")
+	}
+	if err := ExportHeatmap(h, filepath.Join(dir, "x.png"), RenderOptions{ColorMap: "rainbow"}); err == nil {
+		t.Error("rendered with an unknown colour map")
+	}
+}
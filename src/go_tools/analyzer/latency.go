@@ -0,0 +1,168 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Latency breakdowns
+const (
+	LatencyPlatform = "platform"
+	LatencyBuild    = "build"
+)
+
+// LatencyOptions decide when a build counts as less responsive than the
+// one before it
+type LatencyOptions struct {
+	MinSamples int     // builds with fewer samples aren't compared
+	Slowdown   float64 // relative rise in p95 that is flagged, e.g. 0.1 for 10%
+	Alpha      float64 // significance level of the test on mean latency
+}
+
+// DefaultLatencyOptions flags a 10% rise in p95 latency over 100 samples
+func DefaultLatencyOptions() LatencyOptions {
+	return LatencyOptions{MinSamples: 100, Slowdown: 0.1, Alpha: 0.01}
+}
+
+// LatencyDistribution summarizes the input-to-lock latency samples of one
+// platform or build, in milliseconds
+type LatencyDistribution struct {
+	By      string  `json:"by"`
+	Group   string  `json:"group"`
+	Samples int     `json:"samples"`
+	Mean    float64 `json:"mean"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	Max     float64 `json:"max"`
+}
+
+// LatencyRegression is a build whose latency rose significantly over the
+// previous build on the same platform
+type LatencyRegression struct {
+	Platform string  `json:"platform"`
+	Build    string  `json:"build"`
+	Previous string  `json:"previous"`
+	P95      float64 `json:"p95"`
+	PrevP95  float64 `json:"prevP95"`
+	Slowdown float64 `json:"slowdown"` // relative rise in p95
+	PValue   float64 `json:"pValue"`
+}
+
+// LatencyReport is the input latency of a client event log
+type LatencyReport struct {
+	Distributions []LatencyDistribution `json:"distributions"` // by platform, then by build
+	Regressions   []LatencyRegression   `json:"regressions"`
+}
+
+// AnalyzeLatency summarizes the client's input latency samples per
+// platform and per build, and compares each build on each platform with the
+// build before it, flagging those whose p95 rose by opts.Slowdown with a
+// significant rise in mean latency
+func AnalyzeLatency(events []ClientEvent, opts LatencyOptions) LatencyReport {
+	byPlatform := make(map[string][]float64)
+	byBuild := make(map[string][]float64)
+	byBoth := make(map[string]map[string][]float64)
+	for _, ev := range events {
+		if ev.Event != ClientInputLatency || ev.LatencyMs < 0 {
+			continue
+		}
+		platform, build := ev.Platform, ev.Build
+		if platform == "" {
+			platform = "unknown"
+		}
+		if build == "" {
+			build = ev.Version
+		}
+		byPlatform[platform] = append(byPlatform[platform], ev.LatencyMs)
+		byBuild[build] = append(byBuild[build], ev.LatencyMs)
+		if byBoth[platform] == nil {
+			byBoth[platform] = make(map[string][]float64)
+		}
+		byBoth[platform][build] = append(byBoth[platform][build], ev.LatencyMs)
+	}
+
+	var report LatencyReport
+	for _, p := range sortedKeys(byPlatform) {
+		report.Distributions = append(report.Distributions, latencyDistribution(LatencyPlatform, p, byPlatform[p]))
+	}
+	builds := sortedKeys(byBuild)
+	sort.SliceStable(builds, func(i, j int) bool { return CompareVersions(builds[i], builds[j]) < 0 })
+	for _, b := range builds {
+		report.Distributions = append(report.Distributions, latencyDistribution(LatencyBuild, b, byBuild[b]))
+	}
+
+	for _, p := range sortedKeys(byBoth) {
+		var prev string
+		for _, b := range builds {
+			samples := byBoth[p][b]
+			if len(samples) < max(opts.MinSamples, 2) {
+				continue
+			}
+			if prev != "" {
+				if r, ok := latencyRegression(byBoth[p][prev], samples, opts); ok {
+					r.Platform, r.Build, r.Previous = p, b, prev
+					report.Regressions = append(report.Regressions, r)
+				}
+			}
+			prev = b
+		}
+	}
+	return report
+}
+
+func latencyDistribution(by, group string, samples []float64) LatencyDistribution {
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	mean, _ := stats.MeanVariance(sorted)
+	return LatencyDistribution{By: by, Group: group, Samples: len(sorted), Mean: mean,
+		P50: stats.Quantile(sorted, 0.5), P95: stats.Quantile(sorted, 0.95), P99: stats.Quantile(sorted, 0.99), Max: sorted[len(sorted)-1]}
+}
+
+func latencyRegression(before, after []float64, opts LatencyOptions) (LatencyRegression, bool) {
+	b, a := append([]float64(nil), before...), append([]float64(nil), after...)
+	sort.Float64s(b)
+	sort.Float64s(a)
+	r := LatencyRegression{P95: stats.Quantile(a, 0.95), PrevP95: stats.Quantile(b, 0.95)}
+	if r.PrevP95 <= 0 {
+		return r, false
+	}
+	r.Slowdown = r.P95/r.PrevP95 - 1
+	meanA, varA := stats.MeanVariance(a)
+	meanB, varB := stats.MeanVariance(b)
+	r.PValue = stats.WelchP(meanA, varA, len(a), meanB, varB, len(b))
+	return r, r.Slowdown >= opts.Slowdown && meanA > meanB && r.PValue < opts.Alpha
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// latencyPass reports AnalyzeLatency with the default options
+type latencyPass struct{}
+
+func init() {
+	RegisterPass(latencyPass{})
+}
+
+func (latencyPass) Name() string       { return "input_latency" }
+func (latencyPass) Requires() []string { return []string{InputClientEvents} }
+
+func (latencyPass) Run(in PassInputs) ([]*Table, error) {
+	report := AnalyzeLatency(in.Events, DefaultLatencyOptions())
+	dist := NewTable("distribution", "by", "group", "samples:int", "mean_ms:float", "p50_ms:float", "p95_ms:float", "p99_ms:float", "max_ms:float")
+	for _, d := range report.Distributions {
+		dist.Add(d.By, d.Group, d.Samples, d.Mean, d.P50, d.P95, d.P99, d.Max)
+	}
+	regressions := NewTable("regressions", "platform", "build", "previous", "p95_ms:float", "previous_p95_ms:float", "slowdown:float", "p_value:float")
+	for _, r := range report.Regressions {
+		regressions.Add(r.Platform, r.Build, r.Previous, r.P95, r.PrevP95, r.Slowdown, r.PValue)
+	}
+	return []*Table{dist, regressions}, nil
+}
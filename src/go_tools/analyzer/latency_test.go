@@ -0,0 +1,38 @@
+package analyzer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAnalyzeLatencyFlagsSlowerBuild(t *testing.T) {
+	var events []ClientEvent
+	add := func(platform, build string, base float64) {
+		for i := 0; i < 200; i++ {
+			events = append(events, ClientEvent{Event: ClientInputLatency, Platform: platform, Build: build,
+				LatencyMs: base + float64(i%20)})
+		}
+	}
+	add("ios", "1.9", 40)
+	add("ios", "1.10", 60) // slower, and ordered after 1.9 despite sorting first as text
+	add("android", "1.9", 50)
+	add("android", "1.10", 50)
+
+	report := AnalyzeLatency(events, DefaultLatencyOptions())
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	if len(report.Regressions) != 1 {
+		t.Fatalf("regressions = %+v, want only ios 1.10", report.Regressions)
+	}
+	if r := report.Regressions[0]; r.Platform != "ios" || r.Build != "1.10" || r.Previous != "1.9" || !near(r.P95, 78.05) || !near(r.PrevP95, 58.05) {
+		t.Errorf("regression = %+v", r)
+	}
+	var ios LatencyDistribution
+	for _, d := range report.Distributions {
+		if d.By == LatencyPlatform && d.Group == "ios" {
+			ios = d
+		}
+	}
+	if ios.Samples != 400 || ios.P50 != 59.5 || ios.P99 != 79 || ios.Max != 79 {
+		t.Errorf("ios distribution = %+v", ios)
+	}
+}
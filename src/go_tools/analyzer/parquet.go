@@ -0,0 +1,225 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// The Parquet writer below covers what analysis tables need: one row
+// group, one uncompressed PLAIN data page per column, all columns
+// required. Metadata is Thrift compact protocol, per parquet.thrift.
+
+// Parquet physical types, repetitions and other enum values
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetUTF8     = 0 // converted type
+	parquetPlain    = 0 // encoding
+	parquetRLE      = 3 // encoding
+	parquetDataPage = 0 // page type
+)
+
+var parquetMagic = []byte("PAR1")
+
+// Thrift compact protocol type codes
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes Thrift compact protocol structs
+type thriftWriter struct {
+	buf    bytes.Buffer
+	lastID []int16 // last field id of each open struct
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	last := &w.lastID[len(w.lastID)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		w.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) begin()                { w.lastID = append(w.lastID, 0) }
+func (w *thriftWriter) end()                  { w.buf.WriteByte(0); w.lastID = w.lastID[:len(w.lastID)-1] }
+func (w *thriftWriter) i32(id int16, v int32) { w.field(id, thriftI32); w.zigzag(int64(v)) }
+func (w *thriftWriter) i64(id int16, v int64) { w.field(id, thriftI64); w.zigzag(v) }
+
+func (w *thriftWriter) str(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+func (w *thriftWriter) list(id int16, elem byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		w.buf.WriteByte(0xf0 | elem)
+		w.varint(uint64(n))
+	}
+}
+
+// parquetType maps a column kind to its physical type
+func parquetType(kind string) int32 {
+	switch kind {
+	case KindInt:
+		return parquetInt64
+	case KindFloat:
+		return parquetDouble
+	case KindBool:
+		return parquetBoolean
+	}
+	return parquetByteArray
+}
+
+// plainValues PLAIN-encodes column j of the table
+func (t *Table) plainValues(j int) []byte {
+	var buf bytes.Buffer
+	var b [8]byte
+	var bits byte
+	for i, row := range t.Rows {
+		switch v := row[j].(type) {
+		case string:
+			binary.LittleEndian.PutUint32(b[:4], uint32(len(v)))
+			buf.Write(b[:4])
+			buf.WriteString(v)
+		case int:
+			binary.LittleEndian.PutUint64(b[:], uint64(int64(v)))
+			buf.Write(b[:])
+		case float64:
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+			buf.Write(b[:])
+		case bool:
+			if v {
+				bits |= 1 << (i % 8)
+			}
+			if i%8 == 7 || i == len(t.Rows)-1 {
+				buf.WriteByte(bits)
+				bits = 0
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// WriteParquet writes the table as a Parquet file
+func (t *Table) WriteParquet(w io.Writer) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	var file bytes.Buffer
+	file.Write(parquetMagic)
+
+	type chunk struct {
+		offset int64
+		size   int64
+	}
+	chunks := make([]chunk, len(t.Columns))
+	for j := range t.Columns {
+		values := t.plainValues(j)
+		var header thriftWriter
+		header.begin()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(values)))
+		header.i32(3, int32(len(values)))
+		header.structField(5)
+		header.i32(1, int32(len(t.Rows)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.end()
+		header.end()
+
+		chunks[j] = chunk{offset: int64(file.Len()), size: int64(header.buf.Len() + len(values))}
+		file.Write(header.buf.Bytes())
+		file.Write(values)
+	}
+
+	var meta thriftWriter
+	meta.begin()
+	meta.i32(1, 1)
+	meta.list(2, thriftStruct, len(t.Columns)+1)
+	meta.begin()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(t.Columns)))
+	meta.end()
+	for _, c := range t.Columns {
+		meta.begin()
+		meta.i32(1, parquetType(c.Kind))
+		meta.i32(3, parquetRequired)
+		meta.str(4, c.Name)
+		if c.Kind == KindString {
+			meta.i32(6, parquetUTF8)
+		}
+		meta.end()
+	}
+	meta.i64(3, int64(len(t.Rows)))
+
+	var total int64
+	for _, c := range chunks {
+		total += c.size
+	}
+	meta.list(4, thriftStruct, 1)
+	meta.begin()
+	meta.list(1, thriftStruct, len(t.Columns))
+	for j, c := range t.Columns {
+		meta.begin()
+		meta.i64(2, chunks[j].offset)
+		meta.structField(3)
+		meta.i32(1, parquetType(c.Kind))
+		meta.list(2, thriftI32, 1)
+		meta.zigzag(parquetPlain)
+		meta.list(3, thriftBinary, 1)
+		meta.varint(uint64(len(c.Name)))
+		meta.buf.WriteString(c.Name)
+		meta.i32(4, 0) // uncompressed
+		meta.i64(5, int64(len(t.Rows)))
+		meta.i64(6, chunks[j].size)
+		meta.i64(7, chunks[j].size)
+		meta.i64(9, chunks[j].offset)
+		meta.end()
+		meta.end()
+	}
+	meta.i64(2, total)
+	meta.i64(3, int64(len(t.Rows)))
+	meta.end()
+	meta.str(6, "SuperTetris analyzer")
+	meta.end()
+
+	file.Write(meta.buf.Bytes())
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(meta.buf.Len()))
+	file.Write(length[:])
+	file.Write(parquetMagic)
+	_, err := w.Write(file.Bytes())
+	return err
+}
@@ -0,0 +1,286 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+)
+
+// Inputs an analysis pass can require
+const (
+	InputLevels       = "levels"
+	InputReplays      = "replays"
+	InputClientEvents = "client_events"
+)
+
+// PassInputs is everything loaded for an analysis run
+type PassInputs struct {
+	Data   *Dataset
+	Events []ClientEvent
+
+	// Context parents the passes' trace spans; nil starts a new trace
+	Context context.Context
+}
+
+// Has reports whether the named input was loaded
+func (in PassInputs) Has(input string) bool {
+	switch input {
+	case InputLevels:
+		return in.Data != nil && len(in.Data.Levels) > 0
+	case InputReplays:
+		return in.Data != nil && len(in.Data.Replays) > 0
+	case InputClientEvents:
+		return len(in.Events) > 0
+	}
+	return false
+}
+
+// AnalysisPass is a custom analysis; the tables it emits are exported,
+// stored and shown in the balance report alongside the built-in ones
+type AnalysisPass interface {
+	// Name identifies the pass in config and prefixes its table names
+	Name() string
+	// Requires lists the inputs the pass needs; it is skipped when one is
+	// missing
+	Requires() []string
+	// Run analyzes the inputs and returns the pass's metrics as tables
+	Run(in PassInputs) ([]*Table, error)
+}
+
+var (
+	passesMu sync.Mutex
+	passes   = make(map[string]AnalysisPass)
+)
+
+// RegisterPass makes a pass available to RunPasses, usually from the init
+// function of the package defining it; it panics on duplicate names
+func RegisterPass(p AnalysisPass) {
+	passesMu.Lock()
+	defer passesMu.Unlock()
+	if _, dup := passes[p.Name()]; dup {
+		panic("analyzer: pass " + p.Name() + " registered twice")
+	}
+	passes[p.Name()] = p
+}
+
+// Passes returns the registered passes ordered by name
+func Passes() []AnalysisPass {
+	passesMu.Lock()
+	defer passesMu.Unlock()
+	out := make([]AnalysisPass, 0, len(passes))
+	for _, p := range passes {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out
+}
+
+// RunPasses runs the named passes, or every registered pass when names is
+// empty, and returns their tables. Passes whose inputs are missing are
+// skipped and reported in skipped.
+func RunPasses(in PassInputs, names []string) (tables []*Table, skipped []string, err error) {
+	selected := Passes()
+	if len(names) > 0 {
+		byName := make(map[string]AnalysisPass, len(selected))
+		for _, p := range selected {
+			byName[p.Name()] = p
+		}
+		selected = selected[:0]
+		for _, name := range names {
+			p, ok := byName[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown analysis pass %q", name)
+			}
+			selected = append(selected, p)
+		}
+	}
+	ctx := in.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracing.Start(ctx, "analysis.passes", tracing.Int("passes", len(selected)))
+	defer func() {
+		span.SetAttrs(tracing.Int("tables", len(tables)), tracing.Int("skipped", len(skipped)))
+		span.SetError(err)
+		span.End()
+	}()
+	for _, p := range selected {
+		if !hasAll(in, p.Requires()) {
+			skipped = append(skipped, p.Name())
+			continue
+		}
+		out, err := runPass(ctx, p, in)
+		if err != nil {
+			return nil, nil, fmt.Errorf("pass %s: %w", p.Name(), err)
+		}
+		for _, t := range out {
+			t.Name = p.Name() + "_" + t.Name
+			if err := t.validate(); err != nil {
+				return nil, nil, fmt.Errorf("pass %s: %w", p.Name(), err)
+			}
+		}
+		tables = append(tables, out...)
+	}
+	return tables, skipped, nil
+}
+
+// runPass runs one pass under its own span
+func runPass(ctx context.Context, p AnalysisPass, in PassInputs) ([]*Table, error) {
+	ctx, span := tracing.Start(ctx, "analysis.pass", tracing.String("pass", p.Name()))
+	defer span.End()
+	in.Context = ctx
+	out, err := p.Run(in)
+	span.SetAttrs(tracing.Int("tables", len(out)))
+	span.SetError(err)
+	return out, err
+}
+
+func hasAll(in PassInputs, inputs []string) bool {
+	for _, input := range inputs {
+		if !in.Has(input) {
+			return false
+		}
+	}
+	return true
+}
+
+// CommandPass runs an external program as a pass, so passes can be
+// written in any language. The program reads a JSON object holding the
+// required inputs ("levels", "replays", "client_events") on stdin and
+// writes a JSON array of tables to stdout:
+//
+//	[{"name": "kpis", "columns": [{"name": "level", "kind": "string"},
+//	  {"name": "retention", "kind": "float"}], "rows": [["caves", 0.42]]}]
+type CommandPass struct {
+	PassName string
+	Command  []string
+	Inputs   []string
+}
+
+func (p *CommandPass) Name() string       { return p.PassName }
+func (p *CommandPass) Requires() []string { return p.Inputs }
+
+func (p *CommandPass) Run(in PassInputs) ([]*Table, error) {
+	if len(p.Command) == 0 {
+		return nil, fmt.Errorf("no command")
+	}
+	payload, err := in.Payload(p.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(p.Command[0], p.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	if in.Context != nil {
+		if tp := tracing.Traceparent(in.Context); tp != "" {
+			// the W3C environment carrier, for programs that trace too
+			cmd.Env = append(os.Environ(), "TRACEPARENT="+tp)
+		}
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", p.Command[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	tables, err := DecodeTables(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s output: %w", p.Command[0], err)
+	}
+	return tables, nil
+}
+
+// Payload is what an external pass is sent: the named inputs, keyed by
+// their names
+func (in PassInputs) Payload(inputs []string) (map[string]any, error) {
+	payload := make(map[string]any)
+	for _, input := range inputs {
+		switch input {
+		case InputLevels:
+			payload[input] = in.Data.LevelList()
+		case InputReplays:
+			payload[input] = in.Data.Replays
+		case InputClientEvents:
+			payload[input] = in.Events
+		default:
+			return nil, fmt.Errorf("unknown input %q", input)
+		}
+	}
+	return payload, nil
+}
+
+// DecodeTables reads the JSON array of tables an external pass answers with
+func DecodeTables(data []byte) ([]*Table, error) {
+	var tables []*Table
+	if err := json.Unmarshal(data, &tables); err != nil {
+		return nil, err
+	}
+	for _, t := range tables {
+		t.coerceNumbers()
+	}
+	return tables, nil
+}
+
+// coerceNumbers converts the float64s JSON decodes numbers to into ints
+// for int columns
+func (t *Table) coerceNumbers() {
+	for _, row := range t.Rows {
+		for j, v := range row {
+			if f, ok := v.(float64); ok && j < len(t.Columns) && t.Columns[j].Kind == KindInt && f == float64(int(f)) {
+				row[j] = int(f)
+			}
+		}
+	}
+}
+
+// sessionsPass summarizes sessions per level; it is the built-in example
+// of a registered pass
+type sessionsPass struct{}
+
+func init() {
+	RegisterPass(sessionsPass{})
+}
+
+func (sessionsPass) Name() string       { return "sessions" }
+func (sessionsPass) Requires() []string { return []string{InputReplays} }
+
+func (sessionsPass) Run(in PassInputs) ([]*Table, error) {
+	type summary struct {
+		sessions, topOuts int
+		durationMs        int64
+	}
+	byLevel := make(map[string]*summary)
+	var levels []string
+	for _, r := range in.Data.Replays {
+		s := byLevel[r.Level]
+		if s == nil {
+			s = &summary{}
+			byLevel[r.Level] = s
+			levels = append(levels, r.Level)
+		}
+		s.sessions++
+		s.durationMs += r.Result.DurationMs
+		if len(r.EventsOf(replay.EventTopOut)) > 0 {
+			s.topOuts++
+		}
+	}
+	sort.Strings(levels)
+	t := NewTable("by_level", "level", "sessions:int", "mean_duration_sec:float", "top_out_rate:float")
+	for _, lvl := range levels {
+		s := byLevel[lvl]
+		n := float64(s.sessions)
+		t.Add(lvl, s.sessions, float64(s.durationMs)/n/1000, float64(s.topOuts)/n)
+	}
+	return []*Table{t}, nil
+}
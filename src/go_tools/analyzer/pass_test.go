@@ -0,0 +1,81 @@
+package analyzer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+)
+
+func TestRunPassesPrefixesAndSkips(t *testing.T) {
+	data := NewDataset()
+	data.Replays = []*replay.Replay{
+		{SessionID: "a", Level: "caves", Result: replay.Result{DurationMs: 4000}},
+		{SessionID: "b", Level: "caves", Result: replay.Result{DurationMs: 2000},
+			Events: []replay.Event{{Type: replay.EventTopOut}}},
+	}
+	tables, _, err := RunPasses(PassInputs{Data: data}, []string{"sessions"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || tables[0].Name != "sessions_by_level" {
+		t.Fatalf("tables = %+v", tables)
+	}
+	row := tables[0].Rows[0]
+	if row[1] != 2 || row[2] != 3.0 || row[3] != 0.5 {
+		t.Errorf("row = %v, want [caves 2 3 0.5]", row)
+	}
+
+	_, skipped, err := RunPasses(PassInputs{Data: NewDataset()}, []string{"sessions"})
+	if err != nil || len(skipped) != 1 {
+		t.Errorf("skipped = %v, %v; want sessions skipped without replays", skipped, err)
+	}
+	if _, _, err := RunPasses(PassInputs{}, []string{"missing"}); err == nil {
+		t.Error("unknown pass accepted")
+	}
+}
+
+// spanRecorder keeps the spans exported to it
+type spanRecorder struct{ spans []tracing.SpanData }
+
+func (r *spanRecorder) ExportSpans(_ context.Context, spans []tracing.SpanData) error {
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestRunPassesTraces(t *testing.T) {
+	rec := &spanRecorder{}
+	shutdown := tracing.SetExporter(rec)
+	ctx, root := tracing.Start(context.Background(), "analyze")
+	data := NewDataset()
+	data.Replays = []*replay.Replay{{SessionID: "a", Level: "caves", Result: replay.Result{DurationMs: 1000}}}
+	if _, _, err := RunPasses(PassInputs{Data: data, Context: ctx}, []string{"sessions"}); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+	shutdown(context.Background())
+
+	parents := map[string]tracing.SpanID{}
+	ids := map[string]tracing.SpanID{}
+	for _, s := range rec.spans {
+		parents[s.Name], ids[s.Name] = s.Parent, s.SpanID
+	}
+	if parents["analysis.passes"] != root.Context().SpanID || parents["analysis.pass"] != ids["analysis.passes"] {
+		t.Errorf("spans = %+v, want analyze > analysis.passes > analysis.pass", rec.spans)
+	}
+}
+
+func TestCommandPassDecodesTables(t *testing.T) {
+	p := &CommandPass{PassName: "ext", Inputs: []string{InputReplays}, Command: []string{"sh", "-c",
+		`cat >/dev/null; echo '[{"name":"kpi","columns":[{"name":"k","kind":"string"},{"name":"n","kind":"int"}],"rows":[["x",3]]}]'`}}
+	data := NewDataset()
+	data.Replays = []*replay.Replay{{SessionID: "a"}}
+	tables, err := p.Run(PassInputs{Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tables[0].validate(); err != nil || tables[0].Rows[0][1] != 3 {
+		t.Errorf("tables = %+v, %v", tables[0], err)
+	}
+}
@@ -0,0 +1,148 @@
+package analyzer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// PatternOptions control block-pattern mining
+type PatternOptions struct {
+	Size           int // window side in cells
+	MinCells       int // windows with fewer filled cells are ignored as trivial, as are flat ones
+	MinOccurrences int // patterns seen fewer times aren't reported
+	MaxExamples    int // example locations kept per pattern
+}
+
+// DefaultPatternOptions returns the options the analyzer uses by default
+func DefaultPatternOptions() PatternOptions {
+	return PatternOptions{Size: 3, MinCells: 3, MinOccurrences: 4, MaxExamples: 3}
+}
+
+// PatternLocation is the top-left cell of one occurrence of a pattern
+type PatternLocation struct {
+	Level string `json:"level"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+}
+
+// BlockPattern is a block configuration found across a level set
+type BlockPattern struct {
+	Pattern     string            `json:"pattern"` // rows of '#' and '.', top first, separated by '/'
+	Occurrences int               `json:"occurrences"`
+	Levels      int               `json:"levels"` // distinct levels it appears in
+	Examples    []PatternLocation `json:"examples"`
+}
+
+// MineBlockPatterns slides a Size x Size window over every level and
+// returns the block configurations occurring at least MinOccurrences
+// times, most frequent first. Flat windows, each row of them empty or
+// full, such as open space and floor, say nothing and aren't counted, and
+// neither is an occurrence overlapping one of the same pattern already
+// counted in the level, so a run of a repeating configuration counts once
+// per copy rather than once per shift.
+func MineBlockPatterns(levels []*level.Level, opts PatternOptions) []BlockPattern {
+	if opts.Size <= 0 {
+		return nil
+	}
+	found := make(map[string]*BlockPattern)
+	for _, lvl := range levels {
+		grid := lvl.Occupancy()
+		counted := make(map[string][]PatternLocation) // in this level
+		for y := 0; y+opts.Size <= lvl.GridSize.Height; y++ {
+			for x := 0; x+opts.Size <= lvl.GridSize.Width; x++ {
+				key, filled := window(grid, x, y, opts.Size)
+				if filled < opts.MinCells || flat(grid, x, y, opts.Size) {
+					continue
+				}
+				at := PatternLocation{Level: lvl.Name, X: x, Y: y}
+				if overlaps(counted[key], at, opts.Size) {
+					continue
+				}
+				p, ok := found[key]
+				if !ok {
+					p = &BlockPattern{Pattern: key}
+					found[key] = p
+				}
+				p.Occurrences++
+				if len(counted[key]) == 0 {
+					p.Levels++
+				}
+				counted[key] = append(counted[key], at)
+				if len(p.Examples) < opts.MaxExamples {
+					p.Examples = append(p.Examples, at)
+				}
+			}
+		}
+	}
+
+	var patterns []BlockPattern
+	for _, p := range found {
+		if p.Occurrences >= opts.MinOccurrences {
+			patterns = append(patterns, *p)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].Occurrences != patterns[j].Occurrences {
+			return patterns[i].Occurrences > patterns[j].Occurrences
+		}
+		return patterns[i].Pattern < patterns[j].Pattern
+	})
+	return patterns
+}
+
+// flat reports whether every row of the size x size cells at (x, y) is
+// either empty or full
+func flat(grid [][]bool, x, y, size int) bool {
+	for dy := 0; dy < size; dy++ {
+		filled := 0
+		for dx := 0; dx < size; dx++ {
+			if grid[y+dy][x+dx] {
+				filled++
+			}
+		}
+		if filled != 0 && filled != size {
+			return false
+		}
+	}
+	return true
+}
+
+// overlaps reports whether a window at at shares a cell with any of the
+// windows at locs
+func overlaps(locs []PatternLocation, at PatternLocation, size int) bool {
+	for _, l := range locs {
+		if abs(l.X-at.X) < size && abs(l.Y-at.Y) < size {
+			return true
+		}
+	}
+	return false
+}
+
+// window encodes the size x size cells at (x, y) and counts the filled ones
+func window(grid [][]bool, x, y, size int) (string, int) {
+	var sb strings.Builder
+	filled := 0
+	for dy := 0; dy < size; dy++ {
+		if dy > 0 {
+			sb.WriteByte('/')
+		}
+		for dx := 0; dx < size; dx++ {
+			if grid[y+dy][x+dx] {
+				sb.WriteByte('#')
+				filled++
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+	}
+	return sb.String(), filled
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
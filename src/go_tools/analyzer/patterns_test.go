@@ -0,0 +1,80 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// patternLevel is a 16x12 level with two rows of floor and the motif's
+// filled cells, rows top first, planted at each of at
+func patternLevel(name string, motif []string, at ...level.Point) *level.Level {
+	lvl := level.New(name, 16, 12)
+	for y := 10; y < 12; y++ {
+		for x := 0; x < 16; x++ {
+			lvl.Blocks = append(lvl.Blocks, level.Block{Type: "O", X: x, Y: y})
+		}
+	}
+	for _, p := range at {
+		for dy, row := range motif {
+			for dx, c := range row {
+				if c == '#' {
+					lvl.Blocks = append(lvl.Blocks, level.Block{Type: "T", X: p.X + dx, Y: p.Y + dy})
+				}
+			}
+		}
+	}
+	return lvl
+}
+
+func find(patterns []BlockPattern, key string) *BlockPattern {
+	for i := range patterns {
+		if patterns[i].Pattern == key {
+			return &patterns[i]
+		}
+	}
+	return nil
+}
+
+func TestMineBlockPatternsFindsAPlantedMotif(t *testing.T) {
+	motif := []string{"#..", "#..", "##."}
+	levels := []*level.Level{
+		patternLevel("a", motif, level.Point{X: 1, Y: 1}, level.Point{X: 6, Y: 1}, level.Point{X: 11, Y: 1}),
+		patternLevel("b", motif, level.Point{X: 1, Y: 5}, level.Point{X: 8, Y: 5}),
+	}
+	patterns := MineBlockPatterns(levels, DefaultPatternOptions())
+	p := find(patterns, strings.Join(motif, "/"))
+	if p == nil {
+		t.Fatalf("the motif wasn't found in %+v", patterns)
+	}
+	if p.Occurrences != 5 || p.Levels != 2 || len(p.Examples) != 3 || p.Examples[0] != (PatternLocation{Level: "a", X: 1, Y: 1}) {
+		t.Errorf("motif = %+v", p)
+	}
+	for _, p := range patterns {
+		rows := strings.Split(p.Pattern, "/")
+		flat := true
+		for _, r := range rows {
+			flat = flat && (r == "..." || r == "###")
+		}
+		if flat {
+			t.Errorf("flat window %s counted %d times", p.Pattern, p.Occurrences)
+		}
+	}
+}
+
+func TestMineBlockPatternsCountsOverlapsOnce(t *testing.T) {
+	// columns of blocks a cell apart: the window #.#/#.#/#.# fits at x 0,
+	// 2 and 4, and .#./.#./.#. at 1, 3 and 5, but the middle one of each
+	// shares a column with both others
+	stripes := []string{"#.#.#.#", "#.#.#.#", "#.#.#.#"}
+	opts := DefaultPatternOptions()
+	opts.MinOccurrences = 1
+	patterns := MineBlockPatterns([]*level.Level{patternLevel("stripes", stripes, level.Point{X: 0, Y: 2})}, opts)
+	if p := find(patterns, "#.#/#.#/#.#"); p == nil || p.Occurrences != 2 {
+		t.Errorf("#.#/#.#/#.# = %+v", p)
+	}
+	if p := find(patterns, ".#./.#./.#."); p == nil || p.Occurrences != 2 {
+		t.Errorf(".#./.#./.#. = %+v", p)
+	}
+}
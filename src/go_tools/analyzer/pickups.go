@@ -0,0 +1,89 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Pickups collected in fewer than unreachableRate of at least
+// unreachableSessions sessions count as unreachable in practice
+const (
+	unreachableRate     = 0.05
+	unreachableSessions = 10
+)
+
+// PickupCollection is how often players collected one of a level's
+// spell pickups
+type PickupCollection struct {
+	Level       string  `json:"level"`
+	Spell       string  `json:"spell"`
+	X           int     `json:"x"`
+	Y           int     `json:"y"`
+	Sessions    int     `json:"sessions"`
+	Collected   int     `json:"collected"` // sessions in which a player collected it
+	Rate        float64 `json:"rate"`
+	Reachable   bool    `json:"reachable"`   // an open path leads to it from a spawn point
+	Unreachable bool    `json:"unreachable"` // players almost never collect it
+}
+
+// PickupCollections measures the collection rate of every pickup on the
+// levels played in the dataset, rarest first
+func (d *Dataset) PickupCollections() []PickupCollection {
+	type key struct {
+		level string
+		cell  level.Point
+	}
+	sessions := make(map[string]int)
+	collected := make(map[key]int)
+	for _, r := range d.Replays {
+		sessions[r.Level]++
+		for cell := range collectedPickups(r) {
+			collected[key{r.Level, cell}]++
+		}
+	}
+	var out []PickupCollection
+	for _, lvl := range d.LevelList() {
+		n := sessions[lvl.Name]
+		if n == 0 {
+			continue
+		}
+		for _, p := range lvl.Pickups {
+			c := PickupCollection{Level: lvl.Name, Spell: p.Spell, X: p.X, Y: p.Y, Sessions: n,
+				Collected: collected[key{lvl.Name, level.Point{X: p.X, Y: p.Y}}]}
+			c.Rate = float64(c.Collected) / float64(n)
+			c.Reachable = pickupReachable(lvl, p)
+			c.Unreachable = n >= unreachableSessions && c.Rate < unreachableRate
+			out = append(out, c)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Rate < out[j].Rate })
+	return out
+}
+
+// pickupReachable reports whether an open path connects the pickup to a
+// spawn point, as pickupAccessibility counts it
+func pickupReachable(lvl *level.Level, p level.Pickup) bool {
+	single := *lvl
+	single.Pickups = []level.Pickup{p}
+	return pickupAccessibility(&single) == 1
+}
+
+// pickupPass reports PickupCollections
+type pickupPass struct{}
+
+func init() {
+	RegisterPass(pickupPass{})
+}
+
+func (pickupPass) Name() string       { return "pickup_collection" }
+func (pickupPass) Requires() []string { return []string{InputLevels, InputReplays} }
+
+func (pickupPass) Run(in PassInputs) ([]*Table, error) {
+	t := NewTable("by_pickup", "level", "spell", "x:int", "y:int", "sessions:int", "collected:int", "rate:float",
+		"reachable:bool", "unreachable:bool")
+	for _, c := range in.Data.PickupCollections() {
+		t.Add(c.Level, c.Spell, c.X, c.Y, c.Sessions, c.Collected, c.Rate, c.Reachable, c.Unreachable)
+	}
+	return []*Table{t}, nil
+}
@@ -0,0 +1,343 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Behavioural features players are clustered on, in vector order
+const (
+	FeatureStackHeight     = "stack_height"     // mean tallest column after a lock, over board height
+	FeaturePiecesPerMinute = "pieces_per_min"   // speed
+	FeatureInputsPerSecond = "inputs_per_sec"   // how busy the hands are
+	FeatureSpellRate       = "spells_per_min"   // spell use
+	FeatureAggression      = "spell_aggression" // share of casts aimed at opponents
+)
+
+// PlaystyleFeatures lists the features in vector order
+var PlaystyleFeatures = []string{FeatureStackHeight, FeaturePiecesPerMinute, FeatureInputsPerSecond, FeatureSpellRate, FeatureAggression}
+
+// playstyleWords name a cluster by its most distinctive features: the
+// first word when the centroid is above the population mean, the second
+// when below
+var playstyleWords = map[string][2]string{
+	FeatureStackHeight:     {"high stacker", "low stacker"},
+	FeaturePiecesPerMinute: {"fast", "deliberate"},
+	FeatureInputsPerSecond: {"busy hands", "efficient"},
+	FeatureSpellRate:       {"spell heavy", "spell light"},
+	FeatureAggression:      {"aggressive", "defensive"},
+}
+
+// Clustering settings; the seed is fixed so reruns label players alike
+const (
+	playstyleSeed       = 11
+	playstyleIterations = 100
+	playstyleRestarts   = 5
+	playstyleDistinct   = 0.5 // |z| a centroid feature needs to name the cluster
+)
+
+// PlayerFeatures is one player's behaviour, averaged over their sessions
+type PlayerFeatures struct {
+	Player   string    `json:"player"`
+	Sessions int       `json:"sessions"`
+	Values   []float64 `json:"values"` // in PlaystyleFeatures order
+}
+
+// Playstyle is one cluster of players
+type Playstyle struct {
+	Label    string    `json:"label"`
+	Players  []string  `json:"players"`
+	Share    float64   `json:"share"`
+	Centroid []float64 `json:"centroid"` // feature means of the cluster, in PlaystyleFeatures order
+}
+
+// PlaystylePeriod is the population share of each playstyle in one ISO week
+type PlaystylePeriod struct {
+	Period  string    `json:"period"` // e.g. 2024-W07
+	Players int       `json:"players"`
+	Shares  []float64 `json:"shares"` // indexed like PlaystyleReport.Styles
+}
+
+// PlaystyleReport clusters players by behaviour and tracks the clusters'
+// share of the population over time
+type PlaystyleReport struct {
+	Styles  []Playstyle       `json:"styles"`
+	Periods []PlaystylePeriod `json:"periods"`
+}
+
+// Playstyles clusters every player into k playstyles with k-means over
+// standardized features, then assigns each week's players to the nearest
+// playstyle by their behaviour that week
+func (d *Dataset) Playstyles(k int, fallback level.GridSize) (PlaystyleReport, error) {
+	var report PlaystyleReport
+	players := d.playerFeatures(d.Replays, fallback)
+	if k <= 0 {
+		return report, fmt.Errorf("need at least one playstyle, got %d", k)
+	}
+	if len(players) < k {
+		return report, fmt.Errorf("need at least %d players to find %d playstyles, have %d", k, k, len(players))
+	}
+	mean, std := featureMoments(players)
+	points := make([][]float64, len(players))
+	for i, p := range players {
+		points[i] = standardize(p.Values, mean, std)
+	}
+	centroids, assignment := kMeans(points, k, rng.NewXoshiro(playstyleSeed))
+
+	for c, centroid := range centroids {
+		style := Playstyle{Label: playstyleLabel(centroid), Centroid: make([]float64, len(centroid))}
+		for j, z := range centroid {
+			style.Centroid[j] = mean[j] + z*std[j]
+		}
+		for i, a := range assignment {
+			if a == c {
+				style.Players = append(style.Players, players[i].Player)
+			}
+		}
+		style.Share = float64(len(style.Players)) / float64(len(players))
+		report.Styles = append(report.Styles, style)
+	}
+
+	weeks := make(map[string][]*replay.Replay)
+	for _, r := range d.Replays {
+		if r.StartedAt.IsZero() {
+			continue
+		}
+		year, week := r.StartedAt.ISOWeek()
+		key := fmt.Sprintf("%d-W%02d", year, week)
+		weeks[key] = append(weeks[key], r)
+	}
+	periods := make([]string, 0, len(weeks))
+	for p := range weeks {
+		periods = append(periods, p)
+	}
+	sort.Strings(periods)
+	for _, p := range periods {
+		inWeek := d.playerFeatures(weeks[p], fallback)
+		period := PlaystylePeriod{Period: p, Players: len(inWeek), Shares: make([]float64, k)}
+		for _, pf := range inWeek {
+			period.Shares[nearest(centroids, standardize(pf.Values, mean, std))] += 1 / float64(len(inWeek))
+		}
+		report.Periods = append(report.Periods, period)
+	}
+	return report, nil
+}
+
+// playerFeatures measures every player across the replays, in player order
+func (d *Dataset) playerFeatures(replays []*replay.Replay, fallback level.GridSize) []PlayerFeatures {
+	type totals struct {
+		sessions                   int
+		heightSum                  float64
+		frames, inputs             int
+		spells, offensive, minutes float64
+	}
+	byPlayer := make(map[string]*totals)
+	get := func(id string) *totals {
+		t := byPlayer[id]
+		if t == nil {
+			t = &totals{}
+			byPlayer[id] = t
+		}
+		return t
+	}
+	for _, r := range replays {
+		minutes := float64(r.Result.DurationMs) / 60000
+		for _, p := range r.Players {
+			t := get(p.ID)
+			t.sessions++
+			t.minutes += minutes
+		}
+		for _, f := range d.ReplayComplexity(r, fallback) {
+			t := get(f.Player)
+			t.heightSum += f.MaxHeight
+			t.frames++
+		}
+		for _, in := range r.Inputs {
+			get(in.Player).inputs++
+		}
+		for _, sc := range r.Spells {
+			t := get(sc.Player)
+			t.spells++
+			if role := targetRole(r, sc); role == TargetOpponent || role == TargetLeader {
+				t.offensive++
+			}
+		}
+	}
+	ids := make([]string, 0, len(byPlayer))
+	for id, t := range byPlayer {
+		if t.sessions > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	out := make([]PlayerFeatures, 0, len(ids))
+	for _, id := range ids {
+		t := byPlayer[id]
+		values := make([]float64, len(PlaystyleFeatures))
+		if t.frames > 0 { // one frame per lock, so frames are pieces
+			values[0] = t.heightSum / float64(t.frames)
+		}
+		if t.minutes > 0 {
+			values[1] = float64(t.frames) / t.minutes
+			values[2] = float64(t.inputs) / (t.minutes * 60)
+			values[3] = t.spells / t.minutes
+		}
+		if t.spells > 0 {
+			values[4] = t.offensive / t.spells
+		}
+		out = append(out, PlayerFeatures{Player: id, Sessions: t.sessions, Values: values})
+	}
+	return out
+}
+
+// featureMoments returns each feature's mean and standard deviation; a
+// constant feature gets deviation 1 so it standardizes to 0
+func featureMoments(players []PlayerFeatures) (mean, std []float64) {
+	n := len(PlaystyleFeatures)
+	mean, std = make([]float64, n), make([]float64, n)
+	for j := 0; j < n; j++ {
+		xs := make([]float64, len(players))
+		for i, p := range players {
+			xs[i] = p.Values[j]
+		}
+		var variance float64
+		mean[j], variance = stats.MeanVariance(xs)
+		std[j] = math.Sqrt(variance)
+		if std[j] == 0 {
+			std[j] = 1
+		}
+	}
+	return mean, std
+}
+
+func standardize(values, mean, std []float64) []float64 {
+	z := make([]float64, len(values))
+	for j, v := range values {
+		z[j] = (v - mean[j]) / std[j]
+	}
+	return z
+}
+
+// kMeans clusters the points, keeping the best of several k-means++
+// seeded runs by within-cluster sum of squares
+func kMeans(points [][]float64, k int, src rng.RandomSource) (centroids [][]float64, assignment []int) {
+	best := math.Inf(1)
+	for run := 0; run < playstyleRestarts; run++ {
+		c := seedCentroids(points, k, src)
+		a := make([]int, len(points))
+		for iter := 0; iter < playstyleIterations; iter++ {
+			changed := iter == 0
+			for i, p := range points {
+				if n := nearest(c, p); n != a[i] {
+					a[i], changed = n, true
+				}
+			}
+			if !changed {
+				break
+			}
+			for ci := range c {
+				sum := make([]float64, len(points[0]))
+				count := 0
+				for i, p := range points {
+					if a[i] != ci {
+						continue
+					}
+					count++
+					for j, v := range p {
+						sum[j] += v
+					}
+				}
+				if count == 0 {
+					continue // keep an emptied centroid where it was
+				}
+				for j := range sum {
+					sum[j] /= float64(count)
+				}
+				c[ci] = sum
+			}
+		}
+		inertia := 0.0
+		for i, p := range points {
+			inertia += sqDist(p, c[a[i]])
+		}
+		if inertia < best {
+			best, centroids, assignment = inertia, c, a
+		}
+	}
+	return centroids, assignment
+}
+
+// seedCentroids picks k starting centroids with k-means++
+func seedCentroids(points [][]float64, k int, src rng.RandomSource) [][]float64 {
+	centroids := [][]float64{points[src.Intn(len(points))]}
+	for len(centroids) < k {
+		weights := make([]float64, len(points))
+		total := 0.0
+		for i, p := range points {
+			weights[i] = sqDist(p, centroids[nearest(centroids, p)])
+			total += weights[i]
+		}
+		pick := len(points) - 1
+		target := src.Float64() * total
+		for i, w := range weights {
+			if target < w {
+				pick = i
+				break
+			}
+			target -= w
+		}
+		centroids = append(centroids, points[pick])
+	}
+	return centroids
+}
+
+func nearest(centroids [][]float64, p []float64) int {
+	best, bestDist := 0, math.Inf(1)
+	for i, c := range centroids {
+		if d := sqDist(p, c); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+func sqDist(a, b []float64) float64 {
+	d := 0.0
+	for i := range a {
+		d += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return d
+}
+
+// playstyleLabel names a standardized centroid after its one or two most
+// distinctive features
+func playstyleLabel(z []float64) string {
+	order := make([]int, len(z))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return math.Abs(z[order[a]]) > math.Abs(z[order[b]]) })
+	var words []string
+	for _, j := range order[:2] {
+		if math.Abs(z[j]) < playstyleDistinct {
+			break
+		}
+		w := playstyleWords[PlaystyleFeatures[j]]
+		if z[j] > 0 {
+			words = append(words, w[0])
+		} else {
+			words = append(words, w[1])
+		}
+	}
+	if len(words) == 0 {
+		return "balanced"
+	}
+	return strings.Join(words, ", ")
+}
@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// duel is a one minute match in which a casts n spells at b
+func duel(a, b string, n int, at time.Time) *replay.Replay {
+	r := &replay.Replay{StartedAt: at, Players: []replay.Player{{ID: a}, {ID: b}},
+		Result: replay.Result{DurationMs: 60000}}
+	for i := 0; i < n; i++ {
+		r.Spells = append(r.Spells, replay.SpellCast{Frame: i, Player: a, Spell: "freeze", Target: b})
+	}
+	return r
+}
+
+func TestPlaystylesSeparateCasters(t *testing.T) {
+	week1 := time.Date(2024, 2, 12, 12, 0, 0, 0, time.UTC)
+	week2 := week1.AddDate(0, 0, 7)
+	data := NewDataset()
+	for _, id := range []string{"1", "2", "3"} {
+		data.Replays = append(data.Replays, duel("caster"+id, "quiet"+id, 10+len(id), week1))
+	}
+	data.Replays = append(data.Replays, duel("caster1", "caster2", 12, week2), duel("caster2", "caster1", 12, week2))
+
+	report, err := data.Playstyles(2, level.GridSize{Width: 10, Height: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Styles) != 2 {
+		t.Fatalf("%d styles, want 2", len(report.Styles))
+	}
+	casters := -1
+	for i, s := range report.Styles {
+		if len(s.Players) != 3 || s.Share != 0.5 {
+			t.Errorf("style %d: players %v share %.2f", i, s.Players, s.Share)
+		}
+		if strings.HasPrefix(s.Players[0], "caster") {
+			casters = i
+			for _, p := range s.Players {
+				if !strings.HasPrefix(p, "caster") {
+					t.Errorf("caster style holds %s", p)
+				}
+			}
+			if !strings.Contains(s.Label, "spell heavy") && !strings.Contains(s.Label, "aggressive") {
+				t.Errorf("caster style labelled %q", s.Label)
+			}
+		}
+	}
+	if casters < 0 {
+		t.Fatal("no caster style")
+	}
+	if len(report.Periods) != 2 || report.Periods[0].Period != "2024-W07" || report.Periods[1].Period != "2024-W08" {
+		t.Fatalf("periods %+v", report.Periods)
+	}
+	if p := report.Periods[1]; p.Players != 2 || p.Shares[casters] != 1 {
+		t.Errorf("second week: %d players, caster share %.2f", p.Players, p.Shares[casters])
+	}
+}
+
+func TestPlaystylesNeedEnoughPlayers(t *testing.T) {
+	data := NewDataset()
+	data.Replays = []*replay.Replay{duel("a", "b", 1, time.Time{})}
+	if _, err := data.Playstyles(3, level.GridSize{Width: 10, Height: 20}); err == nil {
+		t.Error("clustered 2 players into 3 styles")
+	}
+}
+
+func TestPlaystyleLabel(t *testing.T) {
+	for _, tc := range []struct {
+		z    []float64
+		want string
+	}{
+		{[]float64{0.1, -0.2, 0.3, 0, 0.4}, "balanced"},
+		{[]float64{0, 1.5, 0, 0, -0.7}, "fast, defensive"},
+		{[]float64{-2, 0, 0.2, 0, 0}, "low stacker"},
+	} {
+		if got := playstyleLabel(tc.z); got != tc.want {
+			t.Errorf("label %v = %q, want %q", tc.z, got, tc.want)
+		}
+	}
+}
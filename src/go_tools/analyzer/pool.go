@@ -0,0 +1,85 @@
+package analyzer
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+)
+
+// Progress reports how far a parallel stage has got; one is sent after
+// every item
+type Progress struct {
+	Stage   string        `json:"stage"` // e.g. "replays"
+	Done    int           `json:"done"`
+	Total   int           `json:"total"`
+	Errors  int           `json:"errors"`
+	Elapsed time.Duration `json:"elapsed"`
+	ETA     time.Duration `json:"eta"` // time left at the pace so far
+}
+
+// FileError is a file that failed to load or analyze; the rest of the
+// dataset is processed without it
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// Pool spreads per-file work across workers
+type Pool struct {
+	Workers  int             // zero uses one per CPU
+	Progress chan<- Progress // optional; must be drained while the pool runs, it is never closed
+}
+
+// run calls fn for 0..n-1 across the workers and returns the error for
+// each index that failed
+func (p Pool) run(stage string, n int, fn func(i int) error) map[int]error {
+	workers := p.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, n)
+	type result struct {
+		i   int
+		err error
+	}
+	jobs := make(chan int)
+	results := make(chan result)
+	for w := 0; w < workers; w++ {
+		crash.Go(func() {
+			for i := range jobs {
+				results <- result{i, fn(i)}
+			}
+		})
+	}
+	crash.Go(func() {
+		for i := 0; i < n; i++ {
+			jobs <- i
+		}
+		close(jobs)
+	})
+
+	errs := make(map[int]error)
+	start := time.Now()
+	for done := 1; done <= n; done++ {
+		r := <-results
+		if r.err != nil {
+			errs[r.i] = r.err
+		}
+		if p.Progress != nil {
+			elapsed := time.Since(start)
+			p.Progress <- Progress{Stage: stage, Done: done, Total: n, Errors: len(errs), Elapsed: elapsed,
+				ETA: elapsed / time.Duration(done) * time.Duration(n-done)}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,57 @@
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestLoadReplaysWithSkipsCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		r := &replay.Replay{SessionID: fmt.Sprintf("s%02d", i), Players: []replay.Player{{ID: "p"}}}
+		if err := r.Save(filepath.Join(dir, r.SessionID+".json")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "s07.json"), []byte(`{"sessionId":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	progress := make(chan Progress)
+	var updates []Progress
+	done := make(chan struct{})
+	go func() {
+		for p := range progress {
+			updates = append(updates, p)
+		}
+		close(done)
+	}()
+	data := NewDataset()
+	failed, err := data.LoadReplaysWith(dir, Pool{Workers: 4, Progress: progress})
+	close(progress)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failed) != 1 || filepath.Base(failed[0].File) != "s07.json" {
+		t.Fatalf("failed = %v, want s07.json", failed)
+	}
+	if len(data.Replays) != 19 || data.Replays[6].SessionID != "s06" || data.Replays[7].SessionID != "s08" {
+		t.Errorf("loaded %d replays out of file order", len(data.Replays))
+	}
+	if len(updates) != 20 {
+		t.Fatalf("%d progress updates, want 20", len(updates))
+	}
+	last := updates[len(updates)-1]
+	if last.Stage != "replays" || last.Done != 20 || last.Total != 20 || last.Errors != 1 || last.ETA != 0 {
+		t.Errorf("last update %+v", last)
+	}
+	if err := data.LoadReplays(dir); err == nil {
+		t.Error("LoadReplays accepted the corrupt file")
+	}
+}
@@ -0,0 +1,165 @@
+package analyzer
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Balance metrics tracked per game version
+const (
+	MetricSpellWinRate       = "spell_win_rate"
+	MetricSpecialWinRate     = "special_win_rate"
+	MetricLevelWinRate       = "level_win_rate"
+	MetricFirstPlayerWinRate = "first_player_win_rate"
+)
+
+// BalanceMetric is a win rate of one game version, kept as counts so
+// versions can be tested against each other
+type BalanceMetric struct {
+	Version   string `json:"version"`
+	Metric    string `json:"metric"`
+	Subject   string `json:"subject"` // the spell, special block or level; empty for first player
+	Successes int    `json:"successes"`
+	Trials    int    `json:"trials"`
+}
+
+// Rate is the share of trials that succeeded
+func (m BalanceMetric) Rate() float64 {
+	if m.Trials == 0 {
+		return 0
+	}
+	return float64(m.Successes) / float64(m.Trials)
+}
+
+// VersionBalance computes the balance report's win rates separately for
+// every game version; sessions without a version are left out
+func VersionBalance(replays []*replay.Replay) []BalanceMetric {
+	byVersion := make(map[string][]*replay.Replay)
+	for _, r := range replays {
+		if r.GameVersion != "" {
+			byVersion[r.GameVersion] = append(byVersion[r.GameVersion], r)
+		}
+	}
+	versions := make([]string, 0, len(byVersion))
+	for v := range byVersion {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return CompareVersions(versions[i], versions[j]) < 0 })
+
+	var metrics []BalanceMetric
+	for _, v := range versions {
+		report := AnalyzeGameBalance(byVersion[v])
+		add := func(metric string, rates ...WinRate) {
+			for _, w := range rates {
+				if w.Games > 0 {
+					metrics = append(metrics, BalanceMetric{Version: v, Metric: metric, Subject: w.Key, Successes: w.Wins, Trials: w.Games})
+				}
+			}
+		}
+		add(MetricSpellWinRate, report.Spells...)
+		add(MetricSpecialWinRate, report.SpecialBlocks...)
+		add(MetricLevelWinRate, report.Levels...)
+		first := report.FirstPlayer
+		first.Key = ""
+		add(MetricFirstPlayerWinRate, first)
+	}
+	return metrics
+}
+
+// RegressionOptions decide which changes between versions are flagged
+type RegressionOptions struct {
+	MinDelta  float64 // smallest change in rate worth flagging
+	Alpha     float64 // significance level of the two-proportion test
+	MinTrials int     // metrics with fewer trials in either version are skipped
+}
+
+// DefaultRegressionOptions flags changes of 5 points significant at 1%
+func DefaultRegressionOptions() RegressionOptions {
+	return RegressionOptions{MinDelta: 0.05, Alpha: 0.01, MinTrials: 30}
+}
+
+// Regression is a balance metric that changed significantly between two
+// versions
+type Regression struct {
+	Metric          string  `json:"metric"`
+	Subject         string  `json:"subject"`
+	Baseline        string  `json:"baseline"`
+	Candidate       string  `json:"candidate"`
+	BaselineRate    float64 `json:"baselineRate"`
+	CandidateRate   float64 `json:"candidateRate"`
+	BaselineTrials  int     `json:"baselineTrials"`
+	CandidateTrials int     `json:"candidateTrials"`
+	Delta           float64 `json:"delta"` // candidate minus baseline
+	PValue          float64 `json:"pValue"`
+	Adjusted        float64 `json:"adjustedPValue"` // Benjamini-Hochberg q-value over every metric compared
+}
+
+// DetectRegressions compares every metric the two versions share and
+// returns those whose rate moved by at least MinDelta, in either
+// direction, with a two-proportion p-value below Alpha once adjusted for
+// the number of metrics compared; the largest changes come first
+func DetectRegressions(baseline, candidate []BalanceMetric, opts RegressionOptions) []Regression {
+	type key struct{ metric, subject string }
+	base := make(map[key]BalanceMetric, len(baseline))
+	for _, m := range baseline {
+		base[key{m.Metric, m.Subject}] = m
+	}
+	var compared []Regression
+	for _, c := range candidate {
+		b, ok := base[key{c.Metric, c.Subject}]
+		if !ok || b.Trials < max(opts.MinTrials, 1) || c.Trials < max(opts.MinTrials, 1) {
+			continue
+		}
+		r := Regression{Metric: c.Metric, Subject: c.Subject, Baseline: b.Version, Candidate: c.Version,
+			BaselineRate: b.Rate(), CandidateRate: c.Rate(), BaselineTrials: b.Trials, CandidateTrials: c.Trials}
+		r.Delta = r.CandidateRate - r.BaselineRate
+		r.PValue = stats.TwoProportionP(r.CandidateRate, float64(c.Trials), r.BaselineRate, float64(b.Trials))
+		compared = append(compared, r)
+	}
+	ps := make([]float64, len(compared))
+	for i, r := range compared {
+		ps[i] = r.PValue
+	}
+	var out []Regression
+	for i, q := range stats.BenjaminiHochberg(ps) {
+		r := compared[i]
+		r.Adjusted = q
+		if math.Abs(r.Delta) >= opts.MinDelta && r.Adjusted < opts.Alpha {
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return math.Abs(out[i].Delta) > math.Abs(out[j].Delta) })
+	return out
+}
+
+// CompareVersions orders version strings like 1.2 and 1.10 by their
+// dot-separated parts, numerically where both parts are numbers
+func CompareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case (errA != nil || errB != nil) && pa[i] != pb[i]:
+			return strings.Compare(pa[i], pb[i])
+		}
+	}
+	switch {
+	case len(pa) < len(pb):
+		return -1
+	case len(pa) > len(pb):
+		return 1
+	}
+	return 0
+}
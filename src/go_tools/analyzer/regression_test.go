@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.2", "1.10", -1},
+		{"v2.0", "1.9.9", 1},
+		{"1.2", "1.2.0", -1},
+		{"1.2-beta", "1.2-rc", -1},
+		{"3.1", "3.1", 0},
+	} {
+		if got := CompareVersions(c.a, c.b); got != c.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestDetectRegressionsFlagsWinRateJump(t *testing.T) {
+	// FREEZE casters win 50% on 1.0 and 58% on 1.1; SLOW_DOWN barely moves
+	var replays []*replay.Replay
+	add := func(version, spell string, games, wins int) {
+		for i := 0; i < games; i++ {
+			r := &replay.Replay{SessionID: fmt.Sprint(version, spell, i), GameVersion: version, Level: "caves",
+				Players: []replay.Player{{ID: "a"}, {ID: "b"}}, Spells: []replay.SpellCast{{Player: "a", Spell: spell}}}
+			r.Result.Winner = "b"
+			if i < wins {
+				r.Result.Winner = "a"
+			}
+			replays = append(replays, r)
+		}
+	}
+	add("1.0", "FREEZE", 1000, 500)
+	add("1.1", "FREEZE", 1000, 580)
+	add("1.0", "SLOW_DOWN", 1000, 500)
+	add("1.1", "SLOW_DOWN", 1000, 510)
+
+	metrics := VersionBalance(replays)
+	byVersion := make(map[string][]BalanceMetric)
+	for _, m := range metrics {
+		byVersion[m.Version] = append(byVersion[m.Version], m)
+	}
+	found := DetectRegressions(byVersion["1.0"], byVersion["1.1"], DefaultRegressionOptions())
+	if len(found) == 0 || found[0].Metric != MetricSpellWinRate || found[0].Subject != "FREEZE" {
+		t.Fatalf("regressions = %+v, want FREEZE's win rate first", found)
+	}
+	for _, r := range found {
+		if r.Subject == "SLOW_DOWN" {
+			t.Errorf("flagged an insignificant change: %+v", r)
+		}
+	}
+	if d := found[0].Delta; d < 0.079 || d > 0.081 {
+		t.Errorf("delta = %g, want 0.08", d)
+	}
+	if again := DetectRegressions(byVersion["1.0"], byVersion["1.0"], DefaultRegressionOptions()); len(again) != 0 {
+		t.Errorf("a version regressed against itself: %+v", again)
+	}
+}
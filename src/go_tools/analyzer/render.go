@@ -0,0 +1,171 @@
+package analyzer
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ColorMap maps a normalised value in [0, 1] to a colour
+type ColorMap func(t float64) color.RGBA
+
+// ColorMaps are the colour maps heatmaps can be rendered with
+var ColorMaps = map[string]ColorMap{
+	"heat":    gradient(color.RGBA{0, 0, 0, 255}, color.RGBA{200, 0, 0, 255}, color.RGBA{255, 200, 0, 255}, color.RGBA{255, 255, 255, 255}),
+	"gray":    gradient(color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}),
+	"viridis": gradient(color.RGBA{68, 1, 84, 255}, color.RGBA{59, 82, 139, 255}, color.RGBA{33, 145, 140, 255}, color.RGBA{94, 201, 98, 255}, color.RGBA{253, 231, 37, 255}),
+	"blues":   gradient(color.RGBA{247, 251, 255, 255}, color.RGBA{107, 174, 214, 255}, color.RGBA{8, 48, 107, 255}),
+	// diverging runs blue through white to red, with white at 0.5
+	"diverging": gradient(color.RGBA{33, 102, 172, 255}, color.RGBA{146, 197, 222, 255}, color.RGBA{247, 247, 247, 255}, color.RGBA{244, 165, 130, 255}, color.RGBA{178, 24, 43, 255}),
+}
+
+// gradient interpolates linearly between evenly spaced colour stops
+func gradient(stops ...color.RGBA) ColorMap {
+	return func(t float64) color.RGBA {
+		t = math.Max(0, math.Min(1, t))
+		pos := t * float64(len(stops)-1)
+		i := int(pos)
+		if i >= len(stops)-1 {
+			return stops[len(stops)-1]
+		}
+		f := pos - float64(i)
+		a, b := stops[i], stops[i+1]
+		mix := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*f + 0.5) }
+		return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+	}
+}
+
+// RenderOptions control how a heatmap is drawn
+type RenderOptions struct {
+	ColorMap string // name in ColorMaps; heat when empty, diverging for difference heatmaps
+	CellSize int    // pixels per board cell
+}
+
+func (o RenderOptions) colorMap(diff bool) (ColorMap, error) {
+	name := o.ColorMap
+	switch {
+	case name == "" && diff:
+		name = "diverging"
+	case name == "":
+		name = "heat"
+	}
+	cm, ok := ColorMaps[name]
+	if !ok {
+		names := make([]string, 0, len(ColorMaps))
+		for n := range ColorMaps {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown color map %q (want one of %s)", name, strings.Join(names, ", "))
+	}
+	return cm, nil
+}
+
+func (o RenderOptions) cellSize() int {
+	if o.CellSize <= 0 {
+		return 16
+	}
+	return o.CellSize
+}
+
+// cellColors returns the colour of every cell, normalised to the busiest
+// cell; difference heatmaps are scaled symmetrically so 0 maps to 0.5
+func (h *Heatmap) cellColors(cm ColorMap) [][]color.RGBA {
+	max := h.Max()
+	if h.Diff {
+		max = 0
+		for _, row := range h.Counts {
+			for _, c := range row {
+				max = math.Max(max, math.Abs(c))
+			}
+		}
+	}
+	colors := make([][]color.RGBA, h.Height)
+	for y, row := range h.Counts {
+		colors[y] = make([]color.RGBA, h.Width)
+		for x, c := range row {
+			t := 0.0
+			switch {
+			case h.Diff && max > 0:
+				t = 0.5 + c/(2*max)
+			case h.Diff:
+				t = 0.5
+			case max > 0:
+				t = c / max
+			}
+			colors[y][x] = cm(t)
+		}
+	}
+	return colors
+}
+
+// RenderPNG draws the heatmap as a PNG image
+func (h *Heatmap) RenderPNG(w io.Writer, opts RenderOptions) error {
+	cm, err := opts.colorMap(h.Diff)
+	if err != nil {
+		return err
+	}
+	size := opts.cellSize()
+	img := image.NewRGBA(image.Rect(0, 0, h.Width*size, h.Height*size))
+	for y, row := range h.cellColors(cm) {
+		for x, c := range row {
+			for py := y * size; py < (y+1)*size; py++ {
+				for px := x * size; px < (x+1)*size; px++ {
+					img.SetRGBA(px, py, c)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// RenderSVG draws the heatmap as an SVG document, one rect per cell with
+// its count as a tooltip
+func (h *Heatmap) RenderSVG(w io.Writer, opts RenderOptions) error {
+	cm, err := opts.colorMap(h.Diff)
+	if err != nil {
+		return err
+	}
+	size := opts.cellSize()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		h.Width*size, h.Height*size, h.Width*size, h.Height*size)
+	for y, row := range h.cellColors(cm) {
+		for x, c := range row {
+			fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="#%02x%02x%02x"><title>(%d,%d) %g</title></rect>`+"\n",
+				x*size, y*size, size, size, c.R, c.G, c.B, x, y, h.Counts[y][x])
+		}
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// ExportHeatmap writes the heatmap to path, choosing PNG or SVG by extension
+func ExportHeatmap(h *Heatmap, path string, opts RenderOptions) error {
+	var render func(io.Writer, RenderOptions) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		render = h.RenderPNG
+	case ".svg":
+		render = h.RenderSVG
+	default:
+		return fmt.Errorf("%s: unsupported heatmap format", path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := render(f, opts); err != nil {
+		f.Close()
+		return fmt.Errorf("render %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,143 @@
+package analyzer
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+)
+
+// ReportContext is the data a custom report template is executed with:
+//
+//	.Generated  when the report was rendered
+//	.Balance    the BalanceReport behind the built-in balance.html, with
+//	            .Sessions, .Spells, .SpecialBlocks, .Levels, .FirstPlayer,
+//	            .AverageMatchMs, .SpellUsage, .Funnels, .Retention and .Passes
+//	.Tables     every table of the run, each with .Name, .Columns and .Rows
+//	.Table "n"  the run's table named n, or nil; $.Table inside a range
+//
+// Besides the standard template functions, templates can call
+//
+//	percent, seconds, delta  format a rate, a duration in ms or a rate change
+//	cell                     formats a table value
+//	chart, timing            the built-in report's SVG win rate and cast timing charts
+//	markdown                 a table written as a Markdown table
+//	t, locale                a message of the tools' catalogs and the locale they read in
+type ReportContext struct {
+	Generated time.Time
+	Balance   BalanceReport
+	Tables    []*Table
+}
+
+// Table returns the context's table of the given name, or nil
+func (c ReportContext) Table(name string) *Table {
+	for _, t := range c.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// ReportTemplate is a user-supplied report layout. Files ending in .html or
+// .htm, before an optional .tmpl suffix, are HTML templates with contextual
+// escaping; anything else, Markdown included, is rendered as plain text
+type ReportTemplate struct {
+	Name    string // output file name: the template's base name without .tmpl
+	execute func(io.Writer, any) error
+}
+
+// LoadReportTemplate parses the template file at path
+func LoadReportTemplate(path string) (*ReportTemplate, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+	t := &ReportTemplate{Name: name}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".html", ".htm":
+		tmpl, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(reportFuncs())).Parse(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		t.execute = tmpl.Execute
+	default:
+		tmpl, err := template.New(name).Funcs(reportFuncs()).Parse(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		t.execute = tmpl.Execute
+	}
+	return t, nil
+}
+
+// reportFuncs are the functions custom templates can call
+func reportFuncs() template.FuncMap {
+	return template.FuncMap{
+		"percent":  func(v float64) string { return fmt.Sprintf("%.1f%%", v*100) },
+		"seconds":  func(ms float64) string { return i18n.T("report.seconds", ms/1000) },
+		"delta":    func(v float64) string { return i18n.T("report.delta", v*100) },
+		"cell":     formatValue,
+		"chart":    winRateChart,
+		"timing":   timingChart,
+		"markdown": markdownTable,
+		"t":        i18n.T,
+		"locale":   i18n.Locale,
+	}
+}
+
+// Execute renders the template with ctx
+func (t *ReportTemplate) Execute(w io.Writer, ctx ReportContext) error {
+	return t.execute(w, ctx)
+}
+
+// Save renders the template into dir under its Name and returns the path
+func (t *ReportTemplate) Save(dir string, ctx ReportContext) (string, error) {
+	path := filepath.Join(dir, t.Name)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(f, ctx); err != nil {
+		f.Close()
+		return "", fmt.Errorf("render %s: %w", path, err)
+	}
+	return path, f.Close()
+}
+
+// markdownTable writes a table as a Markdown table, numbers right-aligned
+func markdownTable(t *Table) string {
+	if t == nil {
+		return ""
+	}
+	escape := strings.NewReplacer("|", `\|`, "\n", " ")
+	var sb strings.Builder
+	sb.WriteString("|")
+	for _, c := range t.Columns {
+		sb.WriteString(" " + escape.Replace(c.Name) + " |")
+	}
+	sb.WriteString("\n|")
+	for _, c := range t.Columns {
+		if c.Kind == KindInt || c.Kind == KindFloat {
+			sb.WriteString(" ---: |")
+		} else {
+			sb.WriteString(" --- |")
+		}
+	}
+	sb.WriteString("\n")
+	for _, row := range t.Rows {
+		sb.WriteString("|")
+		for _, v := range row {
+			sb.WriteString(" " + escape.Replace(formatValue(v)) + " |")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
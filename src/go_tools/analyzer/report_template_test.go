@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReportTemplates(t *testing.T) {
+	dir := t.TempDir()
+	sessions := NewTable("sessions_by_level", "level", "sessions:int")
+	sessions.Add("pit|deep", 3)
+	ctx := ReportContext{
+		Balance: BalanceReport{Sessions: 3, FirstPlayer: WinRate{Rate: 0.25}},
+		Tables:  []*Table{sessions},
+	}
+	write := func(name, src string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tmpl, err := LoadReportTemplate(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := tmpl.Save(t.TempDir(), ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Base(out) != strings.TrimSuffix(name, ".tmpl") {
+			t.Errorf("%s rendered to %s", name, out)
+		}
+		data, _ := os.ReadFile(out)
+		return string(data)
+	}
+
+	md := write("studio.md.tmpl", "# {{.Balance.Sessions}} sessions, first player {{percent .Balance.FirstPlayer.Rate}}\n{{markdown (.Table \"sessions_by_level\")}}")
+	want := "# 3 sessions, first player 25.0%\n| level | sessions |\n| --- | ---: |\n| pit\\|deep | 3 |\n"
+	if md != want {
+		t.Errorf("markdown report:\n%s\nwant:\n%s", md, want)
+	}
+	page := write("studio.html", `{{range .Tables}}<p>{{range .Rows}}{{index . 0}}{{end}}</p>{{end}}`)
+	if page != "<p>pit|deep</p>" {
+		t.Errorf("html report %q", page)
+	}
+
+	bad := filepath.Join(dir, "bad.md")
+	os.WriteFile(bad, []byte("{{.Nope"), 0644)
+	if _, err := LoadReportTemplate(bad); err == nil || !strings.Contains(err.Error(), "bad.md") {
+		t.Errorf("unparsable template: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RetentionDays are the days after install retention is measured on
+var RetentionDays = []int{1, 7, 30}
+
+// Retention breakdowns
+const (
+	RetentionAll      = "all"
+	RetentionPlatform = "platform"
+	RetentionArm      = "arm" // experiment/arm, for players assigned to one
+)
+
+// RetentionDay is how many of a cohort's players came back on one day
+// after installing
+type RetentionDay struct {
+	Day      int     `json:"day"`
+	Eligible int     `json:"eligible"` // players installed at least Day days before the log ends
+	Retained int     `json:"retained"` // eligible players with an event on that day
+	Rate     float64 `json:"rate"`
+}
+
+// RetentionCohort is the retention of the players installing in one ISO
+// week, overall or within one platform or experiment arm
+type RetentionCohort struct {
+	Cohort   string         `json:"cohort"` // install week, e.g. 2024-W07
+	By       string         `json:"by"`
+	Group    string         `json:"group"`
+	Installs int            `json:"installs"`
+	Days     []RetentionDay `json:"days"` // one per RetentionDays
+}
+
+// retentionPlayer is what retention needs to know about one player
+type retentionPlayer struct {
+	installed     time.Time
+	platform, arm string
+	active        map[int]bool // days after install with an event
+}
+
+// ComputeRetention measures D1, D7 and D30 retention from a client event
+// log. A player installs with their first event and is retained on day N
+// when they have an event N calendar days (UTC) later; days after the
+// log's last event aren't counted against anyone.
+func ComputeRetention(events []ClientEvent) []RetentionCohort {
+	sorted := append([]ClientEvent(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+	if len(sorted) == 0 {
+		return nil
+	}
+	end := utcDay(sorted[len(sorted)-1].Time)
+
+	players := make(map[string]*retentionPlayer)
+	for _, ev := range sorted {
+		p, ok := players[ev.Player]
+		if !ok {
+			p = &retentionPlayer{installed: utcDay(ev.Time), platform: ev.Platform, active: make(map[int]bool)}
+			players[ev.Player] = p
+		}
+		if p.platform == "" {
+			p.platform = ev.Platform
+		}
+		if p.arm == "" && ev.Experiment != "" {
+			p.arm = ev.Experiment + "/" + ev.Arm
+		}
+		p.active[daysBetween(p.installed, utcDay(ev.Time))] = true
+	}
+
+	type key struct{ cohort, by, group string }
+	cohorts := make(map[key]*RetentionCohort)
+	add := func(k key, p *retentionPlayer) {
+		c, ok := cohorts[k]
+		if !ok {
+			c = &RetentionCohort{Cohort: k.cohort, By: k.by, Group: k.group}
+			for _, day := range RetentionDays {
+				c.Days = append(c.Days, RetentionDay{Day: day})
+			}
+			cohorts[k] = c
+		}
+		c.Installs++
+		for i := range c.Days {
+			d := &c.Days[i]
+			if daysBetween(p.installed, end) < d.Day {
+				continue
+			}
+			d.Eligible++
+			if p.active[d.Day] {
+				d.Retained++
+			}
+		}
+	}
+	for _, p := range players {
+		year, week := p.installed.ISOWeek()
+		cohort := fmt.Sprintf("%d-W%02d", year, week)
+		platform := p.platform
+		if platform == "" {
+			platform = "unknown"
+		}
+		add(key{cohort, RetentionAll, RetentionAll}, p)
+		add(key{cohort, RetentionPlatform, platform}, p)
+		if p.arm != "" {
+			add(key{cohort, RetentionArm, p.arm}, p)
+		}
+	}
+
+	order := map[string]int{RetentionAll: 0, RetentionPlatform: 1, RetentionArm: 2}
+	out := make([]RetentionCohort, 0, len(cohorts))
+	for _, c := range cohorts {
+		for i := range c.Days {
+			if d := &c.Days[i]; d.Eligible > 0 {
+				d.Rate = float64(d.Retained) / float64(d.Eligible)
+			}
+		}
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Cohort != b.Cohort {
+			return a.Cohort < b.Cohort
+		}
+		if a.By != b.By {
+			return order[a.By] < order[b.By]
+		}
+		return a.Group < b.Group
+	})
+	return out
+}
+
+func utcDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from) / (24 * time.Hour))
+}
@@ -0,0 +1,47 @@
+package analyzer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeRetention(t *testing.T) {
+	install := time.Date(2024, 2, 12, 22, 0, 0, 0, time.UTC) // a Monday
+	day := func(n int) time.Time { return install.Add(time.Duration(n) * 24 * time.Hour) }
+	events := []ClientEvent{
+		{Time: install, Player: "a", Event: ClientLaunch, Platform: "ios", Experiment: "onboarding", Arm: "b"},
+		{Time: day(1), Player: "a", Event: ClientLaunch},
+		{Time: day(7), Player: "a", Event: ClientLaunch},
+		{Time: install, Player: "b", Event: ClientLaunch, Platform: "android"},
+		{Time: install.Add(3 * time.Hour), Player: "b", Event: ClientLaunch}, // the next calendar day
+		{Time: day(8), Player: "c", Event: ClientLaunch, Platform: "ios"},
+		{Time: day(10), Player: "c", Event: ClientLaunch},
+	}
+	cohorts := ComputeRetention(events)
+	find := func(cohort, by, group string) RetentionCohort {
+		for _, c := range cohorts {
+			if c.Cohort == cohort && c.By == by && c.Group == group {
+				return c
+			}
+		}
+		t.Fatalf("no %s cohort for %s=%s in %+v", cohort, by, group, cohorts)
+		return RetentionCohort{}
+	}
+
+	all := find("2024-W07", RetentionAll, RetentionAll)
+	if all.Installs != 2 || all.Days[0].Retained != 2 || all.Days[1].Retained != 1 || all.Days[1].Rate != 0.5 {
+		t.Errorf("week 7 = %+v, want both back on D1 and one on D7", all)
+	}
+	if all.Days[2].Eligible != 0 {
+		t.Errorf("D30 counted %d players before the log reaches day 30", all.Days[2].Eligible)
+	}
+	if ios := find("2024-W07", RetentionPlatform, "ios"); ios.Installs != 1 || ios.Days[1].Rate != 1 {
+		t.Errorf("ios = %+v", ios)
+	}
+	if arm := find("2024-W07", RetentionArm, "onboarding/b"); arm.Installs != 1 {
+		t.Errorf("arm = %+v", arm)
+	}
+	if late := find("2024-W08", RetentionAll, RetentionAll); late.Days[0].Eligible != 1 || late.Days[0].Retained != 0 {
+		t.Errorf("week 8 = %+v, want c eligible for D1 but not retained", late)
+	}
+}
@@ -0,0 +1,219 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Point sources of the scoring economy
+const (
+	ScoreSingle     = "single"
+	ScoreDouble     = "double"
+	ScoreTriple     = "triple"
+	ScoreTetris     = "tetris"
+	ScoreTSpin      = "t_spin"           // T-spins' points, mini or full, with lines or without
+	ScoreBackToBack = "back_to_back"     // what back-to-back difficult clears add
+	ScoreCombo      = "combo"            // the per-step bonus of clears continuing a combo
+	ScoreSpell      = "spell_multiplier" // clear points beyond the rules, from multiplier spells
+	ScoreCast       = "spell_cast"       // the rules' points for casting spells
+	ScorePickup     = "pickup"
+	ScoreSpecial    = "special"
+	ScoreOther      = "other" // final score no event explains, mostly soft and hard drops
+)
+
+// ScoreSources lists the sources in report order
+var ScoreSources = []string{ScoreSingle, ScoreDouble, ScoreTriple, ScoreTetris, ScoreTSpin, ScoreBackToBack, ScoreCombo,
+	ScoreSpell, ScoreCast, ScorePickup, ScoreSpecial, ScoreOther}
+
+var clearSources = [...]string{1: ScoreSingle, 2: ScoreDouble, 3: ScoreTriple, 4: ScoreTetris}
+
+// ScoringRules are the game's points, the simulator's scoring table, used
+// to split a clear's score into its line, T-spin, back-to-back, combo and
+// spell parts
+type ScoringRules = sim.Scoring
+
+// DefaultScoringRules returns the points the game scores by
+func DefaultScoringRules() ScoringRules {
+	return sim.DefaultScoring()
+}
+
+// ScoringEconomy is where the points of one skill band's player sessions
+// came from
+type ScoringEconomy struct {
+	Band     string             `json:"band"`
+	Sessions int                `json:"sessions"` // player sessions, one per player per replay
+	Points   float64            `json:"points"`
+	Sources  map[string]float64 `json:"sources"` // points by source
+}
+
+// Share is the fraction of the band's points that came from source
+func (e ScoringEconomy) Share(source string) float64 {
+	if e.Points == 0 {
+		return 0
+	}
+	return e.Sources[source] / e.Points
+}
+
+// PerSession is the source's mean points per player session
+func (e ScoringEconomy) PerSession(source string) float64 {
+	if e.Sessions == 0 {
+		return 0
+	}
+	return e.Sources[source] / float64(e.Sessions)
+}
+
+// ScoringEconomy attributes every player's points to their sources and
+// sums them per skill band, in SkillBands order. Clear points are split
+// into the line points the rules give, the combo bonus, and whatever a
+// multiplier spell added on top; points in the final score that no event
+// carries count as other.
+func (d *Dataset) ScoringEconomy(rules ScoringRules) []ScoringEconomy {
+	bands := make(map[string]*ScoringEconomy)
+	for _, r := range d.Replays {
+		for _, p := range r.Players {
+			band := SkillBand(p.Rating)
+			e := bands[band]
+			if e == nil {
+				e = &ScoringEconomy{Band: band, Sources: make(map[string]float64)}
+				bands[band] = e
+			}
+			e.Sessions++
+			for source, points := range scoreSources(r, p.ID, rules) {
+				e.Sources[source] += points
+				e.Points += points
+			}
+		}
+	}
+	var out []ScoringEconomy
+	for _, band := range SkillBands {
+		if e := bands[band]; e != nil {
+			out = append(out, *e)
+		}
+	}
+	return out
+}
+
+// scoreSources attributes one player's points in a replay. The combo
+// follows the game: each clearing lock adds to it and a lock that clears
+// nothing resets it, so without lock events there's no combo to credit.
+// A clear's kind and back-to-back come from its detail, and each spell
+// cast is credited the rules' points for it.
+func scoreSources(r *replay.Replay, player string, rules ScoringRules) map[string]float64 {
+	out := make(map[string]float64)
+	events := make([]replay.Event, 0, len(r.Events))
+	for _, ev := range r.Events {
+		if ev.Player == player {
+			events = append(events, ev)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Frame < events[j].Frame })
+
+	combo, locksSinceClear, locked := 0, 0, false
+	attributed := 0
+	for _, ev := range events {
+		switch ev.Type {
+		case replay.EventLock:
+			if locksSinceClear > 0 {
+				combo = 0
+			}
+			locksSinceClear++
+			locked = true
+			out[ScoreTSpin] += float64(ev.Score) // a T-spin clearing nothing
+		case replay.EventClear:
+			lines := max(ev.Lines, 1)
+			kind, b2b := sim.ClearKind(ev.Detail)
+			bonus := 0
+			if locked {
+				bonus = combo * rules.Combo
+			}
+			combo++
+			locksSinceClear = 0
+			if ev.Score > 0 {
+				source := clearSources[min(lines, 4)]
+				if kind != "" {
+					source = ScoreTSpin
+				}
+				base := rules.Clear(lines, kind, false)
+				splitClear(out, float64(ev.Score),
+					clearPart{source, float64(base)},
+					clearPart{ScoreBackToBack, float64(rules.Clear(lines, kind, b2b) - base)},
+					clearPart{ScoreCombo, float64(bonus)})
+			}
+		case replay.EventPickup:
+			out[ScorePickup] += float64(ev.Score)
+		case replay.EventSpecial:
+			out[ScoreSpecial] += float64(ev.Score)
+		default:
+			out[ScoreOther] += float64(ev.Score)
+		}
+		attributed += ev.Score
+	}
+	for _, sc := range r.Spells {
+		if sc.Player == player {
+			out[ScoreCast] += float64(rules.Spells[sc.Spell])
+			attributed += rules.Spells[sc.Spell]
+		}
+	}
+	if final, ok := r.Result.Scores[player]; ok && final > attributed {
+		out[ScoreOther] += float64(final - attributed)
+	}
+	for source, points := range out {
+		if points == 0 {
+			delete(out, source)
+		}
+	}
+	return out
+}
+
+// clearPart is some of the points the rules give a clear
+type clearPart struct {
+	source string
+	points float64
+}
+
+// splitClear credits a clear's score to the parts the rules give it, the
+// first its line points, scaled down together when the score falls short
+// of them, and the rest to spells
+func splitClear(out map[string]float64, score float64, parts ...clearPart) {
+	expected := 0.0
+	for _, p := range parts {
+		expected += p.points
+	}
+	if expected <= 0 {
+		out[parts[0].source] += score
+		return
+	}
+	scale := min(1, score/expected)
+	for _, p := range parts {
+		out[p.source] += p.points * scale
+	}
+	out[ScoreSpell] += score - expected*scale
+}
+
+// scoringPass reports ScoringEconomy under the dataset's rules
+type scoringPass struct{}
+
+func init() {
+	RegisterPass(scoringPass{})
+}
+
+func (scoringPass) Name() string       { return "scoring_economy" }
+func (scoringPass) Requires() []string { return []string{InputReplays} }
+
+func (scoringPass) Run(in PassInputs) ([]*Table, error) {
+	t := NewTable("by_band", "band", "source", "sessions:int", "points:float", "share:float", "per_session:float")
+	rules := DefaultScoringRules()
+	if in.Data.Scoring != nil {
+		rules = *in.Data.Scoring
+	}
+	for _, e := range in.Data.ScoringEconomy(rules) {
+		for _, source := range ScoreSources {
+			if _, ok := e.Sources[source]; ok {
+				t.Add(e.Band, source, e.Sessions, e.Sources[source], e.Share(source), e.PerSession(source))
+			}
+		}
+	}
+	return []*Table{t}, nil
+}
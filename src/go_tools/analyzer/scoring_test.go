@@ -0,0 +1,72 @@
+package analyzer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+func TestScoringEconomySplitsClears(t *testing.T) {
+	lock := func(frame int) replay.Event { return replay.Event{Frame: frame, Player: "a", Type: replay.EventLock} }
+	clear := func(frame, lines, score int) replay.Event {
+		return replay.Event{Frame: frame, Player: "a", Type: replay.EventClear, Lines: lines, Score: score}
+	}
+	data := NewDataset()
+	data.Replays = []*replay.Replay{{
+		Players: []replay.Player{{ID: "a", Rating: 1000}},
+		Events: []replay.Event{
+			lock(1), clear(1, 1, 100),
+			lock(2), clear(2, 2, 350), // one clear into the combo
+			lock(3),
+			lock(4), clear(4, 4, 1600), // combo reset, doubled by a spell
+			{Frame: 5, Player: "a", Type: replay.EventPickup, Score: 50},
+		},
+		Result: replay.Result{Scores: map[string]int{"a": 2200}},
+	}}
+
+	economy := data.ScoringEconomy(DefaultScoringRules())
+	if len(economy) != 1 || economy[0].Band != BandNovice || economy[0].Sessions != 1 {
+		t.Fatalf("economy = %+v", economy)
+	}
+	e := economy[0]
+	want := map[string]float64{ScoreSingle: 100, ScoreDouble: 300, ScoreCombo: 50, ScoreTetris: 800,
+		ScoreSpell: 800, ScorePickup: 50, ScoreOther: 100}
+	for source, points := range want {
+		if math.Abs(e.Sources[source]-points) > 1e-9 {
+			t.Errorf("%s: %g points, want %g", source, e.Sources[source], points)
+		}
+	}
+	if e.Points != 2200 || math.Abs(e.Share(ScoreTetris)-800.0/2200) > 1e-9 {
+		t.Errorf("points %g, tetris share %g", e.Points, e.Share(ScoreTetris))
+	}
+}
+
+func TestScoringEconomyCreditsTSpinsAndBackToBacks(t *testing.T) {
+	ev := func(frame int, typ string, lines, score int, detail string) replay.Event {
+		return replay.Event{Frame: frame, Player: "a", Type: typ, Lines: lines, Score: score, Detail: detail}
+	}
+	data := NewDataset()
+	data.Replays = []*replay.Replay{{
+		Players: []replay.Player{{ID: "a", Rating: 1000}},
+		Events: []replay.Event{
+			ev(1, replay.EventLock, 0, 100, sim.ClearTSpinMini),
+			ev(2, replay.EventLock, 4, 0, ""), ev(2, replay.EventClear, 4, 800, ""),
+			ev(3, replay.EventLock, 2, 0, ""), ev(3, replay.EventClear, 2, 1850, sim.ClearTSpin+" "+sim.ClearBackToBack),
+		},
+		Spells: []replay.SpellCast{{Frame: 4, Player: "a", Spell: level.SpellSlowDown}},
+		Result: replay.Result{Scores: map[string]int{"a": 2775}},
+	}}
+	e := data.ScoringEconomy(DefaultScoringRules())[0]
+	want := map[string]float64{ScoreTSpin: 100 + 1200, ScoreBackToBack: 600, ScoreCombo: 50, ScoreTetris: 800, ScoreCast: 25}
+	for source, points := range want {
+		if math.Abs(e.Sources[source]-points) > 1e-9 {
+			t.Errorf("%s: %g points, want %g", source, e.Sources[source], points)
+		}
+	}
+	if e.Points != 2775 || e.Sources[ScoreOther] != 0 || e.Sources[ScoreSpell] != 0 {
+		t.Errorf("sources %v", e.Sources)
+	}
+}
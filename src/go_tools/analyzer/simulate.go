@@ -0,0 +1,79 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// ReplaySimulator steps a replay headlessly, an event at a time: each
+// lock is placed on its player's board, full rows cleared, and the board
+// measured, the work the analyzer does per lock. The same replay always
+// does the same work, so it is a fixed workload to profile.
+type ReplaySimulator struct {
+	d        *Dataset
+	fallback level.GridSize
+	r        *replay.Replay
+	boards   map[string]board
+	last     BoardComplexity
+
+	Locks   int // placed since Load
+	Skipped int // locks that didn't fit the reconstructed board
+}
+
+// NewReplaySimulator steps replays on the dataset's levels, or empty
+// boards of the fallback size for levels it doesn't hold
+func NewReplaySimulator(d *Dataset, fallback level.GridSize) *ReplaySimulator {
+	if d == nil {
+		d = NewDataset()
+	}
+	return &ReplaySimulator{d: d, fallback: fallback}
+}
+
+// Load sets every player of r on the replay's starting board
+func (s *ReplaySimulator) Load(r *replay.Replay) error {
+	if len(r.Players) == 0 {
+		return fmt.Errorf("replay has no players")
+	}
+	s.r, s.Locks, s.Skipped = r, 0, 0
+	s.boards = make(map[string]board, len(r.Players))
+	for _, p := range r.Players {
+		s.boards[p.ID] = s.d.startBoard(r, s.fallback)
+	}
+	return nil
+}
+
+// Step applies one event of the loaded replay
+func (s *ReplaySimulator) Step(ev replay.Event) error {
+	if s.r == nil {
+		return fmt.Errorf("no replay loaded")
+	}
+	if b, ok := s.lock(ev); ok {
+		s.last = b.complexity()
+	}
+	return nil
+}
+
+// Board is the complexity of the board last locked onto
+func (s *ReplaySimulator) Board() BoardComplexity {
+	return s.last
+}
+
+// lock places a lock event's piece, returning the board it went on; other
+// events and locks that don't fit aren't placed
+func (s *ReplaySimulator) lock(ev replay.Event) (board, bool) {
+	b, ok := s.boards[ev.Player]
+	if ev.Type != replay.EventLock || !ok || len(b) == 0 {
+		return nil, false
+	}
+	cells, ok := pieces.Cells(ev.Piece, ev.Rotation)
+	if !ok || !b.fits(cells, ev.X, ev.Y) {
+		s.Skipped++
+		return nil, false
+	}
+	b.place(cells, ev.X, ev.Y)
+	s.Locks++
+	return b, true
+}
@@ -0,0 +1,37 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestReplaySimulatorClearsRows(t *testing.T) {
+	r := &replay.Replay{Players: []replay.Player{{ID: "p"}}, Events: []replay.Event{
+		{Type: replay.EventLock, Player: "p", Piece: "I", X: 0, Y: 2}, // fills the bottom row, which clears
+		{Type: replay.EventLock, Player: "p", Piece: "I", X: 0, Y: 2}, // so the same place fits again
+		{Type: replay.EventLock, Player: "p", Piece: "O", X: 3, Y: 2}, // off the board
+		{Type: replay.EventTopOut, Player: "p"},
+	}}
+	sim := NewReplaySimulator(nil, level.GridSize{Width: 4, Height: 4})
+	if err := sim.Step(r.Events[0]); err == nil {
+		t.Error("stepped without a replay")
+	}
+	for pass := 0; pass < 2; pass++ {
+		if err := sim.Load(r); err != nil {
+			t.Fatal(err)
+		}
+		for _, ev := range r.Events {
+			if err := sim.Step(ev); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if sim.Locks != 2 || sim.Skipped != 1 || sim.Board().Holes != 0 {
+			t.Errorf("pass %d: %d locks, %d skipped, board %+v", pass, sim.Locks, sim.Skipped, sim.Board())
+		}
+	}
+	if err := sim.Load(&replay.Replay{}); err == nil {
+		t.Error("loaded a replay without players")
+	}
+}
@@ -0,0 +1,459 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+// Objective kinds the solver understands
+const (
+	ObjectiveClearLines     = "clear_lines"
+	ObjectiveFillGoal       = "fill_goal"
+	ObjectiveCastSpell      = "cast_spell" // collect a pickup by moving a piece over it
+	ObjectiveTriggerSpecial = "trigger_special"
+)
+
+// Solver verdicts
+const (
+	Solvable   = "solvable"
+	Impossible = "impossible"
+	Unknown    = "unknown" // the search budget ran out first
+)
+
+// SolveOptions bounds the solver's search
+type SolveOptions struct {
+	MaxPieces int // longest witness searched for
+	MaxNodes  int // board states explored before giving up
+}
+
+// DefaultSolveOptions searches up to 40 pieces and 200k states
+func DefaultSolveOptions() SolveOptions {
+	return SolveOptions{MaxPieces: 40, MaxNodes: 200000}
+}
+
+// Placement is one piece locked by a witness solution, in the coordinates
+// replay lock events use
+type Placement struct {
+	Piece    string `json:"piece"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Rotation int    `json:"rotation"`
+	Lines    int    `json:"lines,omitempty"`
+}
+
+// Solvability is the solver's verdict on one level
+type Solvability struct {
+	Level   string      `json:"level"`
+	Status  string      `json:"status"`
+	Reason  string      `json:"reason,omitempty"` // why the level is impossible, or the search stopped
+	Witness []Placement `json:"witness,omitempty"`
+	Nodes   int         `json:"nodes"` // board states explored
+}
+
+// solverState is a board during the search, with the objective progress
+// made so far
+type solverState struct {
+	b        board
+	special  [][]bool // special blocks, moving with the rows they sit in
+	pickups  map[level.Point]bool
+	lines    int
+	spells   int
+	triggers int
+}
+
+// Solve decides whether a single player can complete every objective of
+// the level, independent of how it was generated. Pieces move left, right,
+// down and rotate without wall kicks; the level's fixed pieces are dealt
+// first, then its seeded sequence, or, unseeded, whichever piece the
+// search wants next. Special blocks count as triggered when their row
+// clears, but their effects on the board aren't simulated. A level is
+// impossible when an objective can't be met by construction, or when every
+// line of play tops out before the piece limit.
+func Solve(lvl *level.Level, opts SolveOptions) Solvability {
+	result := Solvability{Level: lvl.Name}
+	if reason := impossibleObjectives(lvl); reason != "" {
+		result.Status, result.Reason = Impossible, reason
+		return result
+	}
+	if len(lvl.Objectives) == 0 {
+		result.Status, result.Reason = Solvable, "the level has no objectives"
+		return result
+	}
+	if opts.MaxPieces <= 0 {
+		opts.MaxPieces = DefaultSolveOptions().MaxPieces
+	}
+	if opts.MaxNodes <= 0 {
+		opts.MaxNodes = DefaultSolveOptions().MaxNodes
+	}
+
+	start := solverState{b: board(lvl.Occupancy()), pickups: make(map[level.Point]bool)}
+	start.special = make([][]bool, len(start.b))
+	for y := range start.special {
+		start.special[y] = make([]bool, lvl.GridSize.Width)
+	}
+	for _, bl := range lvl.Blocks {
+		if bl.Special != "" && lvl.InBounds(bl.X, bl.Y) {
+			start.special[bl.Y][bl.X] = true
+		}
+	}
+	for _, p := range lvl.Pickups {
+		start.pickups[level.Point{X: p.X, Y: p.Y}] = true
+	}
+
+	s := &solver{lvl: lvl, opts: opts, seen: make(map[string]int), deal: dealtPieces(lvl, opts.MaxPieces)}
+	s.spawns = lvl.SpawnPoints
+	if len(s.spawns) == 0 {
+		s.spawns = []level.Point{{X: lvl.GridSize.Width / 2, Y: 0}}
+	}
+	if s.done(start) {
+		result.Status = Solvable
+		return result
+	}
+	witness, found := s.search(start, 0)
+	result.Nodes = s.nodes
+	switch {
+	case found:
+		result.Status, result.Witness = Solvable, witness
+	case s.nodes >= opts.MaxNodes:
+		result.Status, result.Reason = Unknown, fmt.Sprintf("gave up after %d board states", s.nodes)
+	case s.cutoff:
+		result.Status, result.Reason = Unknown, fmt.Sprintf("no solution within %d pieces", opts.MaxPieces)
+	default:
+		result.Status, result.Reason = Impossible, "every line of play tops out before completing the objectives"
+	}
+	return result
+}
+
+// impossibleObjectives returns why the level's objectives can't be met by
+// construction, or "" when they might be
+func impossibleObjectives(lvl *level.Level) string {
+	width, height := lvl.GridSize.Width, lvl.GridSize.Height
+	if width <= 0 || height <= 0 {
+		return fmt.Sprintf("invalid grid size %dx%d", width, height)
+	}
+	specials := 0
+	for _, b := range lvl.Blocks {
+		if b.Special != "" {
+			specials++
+		}
+	}
+	var reasons []string
+	for _, o := range lvl.Objectives {
+		switch o.Kind {
+		case ObjectiveClearLines:
+		case ObjectiveFillGoal:
+			switch {
+			case lvl.GoalArea == nil:
+				reasons = append(reasons, "fill_goal without a goal area")
+			case o.Target > lvl.GoalArea.Width*lvl.GoalArea.Height:
+				reasons = append(reasons, fmt.Sprintf("fill_goal needs %d cells but the goal area has %d", o.Target, lvl.GoalArea.Width*lvl.GoalArea.Height))
+			}
+		case ObjectiveCastSpell:
+			if o.Target > len(lvl.Pickups) {
+				reasons = append(reasons, fmt.Sprintf("cast_spell needs %d spells but the level has %d pickups", o.Target, len(lvl.Pickups)))
+			}
+		case ObjectiveTriggerSpecial:
+			if o.Target > specials {
+				reasons = append(reasons, fmt.Sprintf("trigger_special needs %d special blocks but the level has %d", o.Target, specials))
+			}
+		default:
+			reasons = append(reasons, fmt.Sprintf("unknown objective %q", o.Kind))
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// dealtPieces returns the pieces the level deals for certain, up to n: its
+// fixed queue, followed by its sequence when seeded. Past the end the
+// solver may pick any piece.
+func dealtPieces(lvl *level.Level, n int) []string {
+	if lvl.Pieces == nil {
+		return nil
+	}
+	if lvl.Pieces.Seed == 0 {
+		return lvl.Pieces.Fixed
+	}
+	queue, err := pieces.ForLevel(lvl.Pieces, pieces.Bag7, rng.NewXoshiro(0))
+	if err != nil {
+		return lvl.Pieces.Fixed
+	}
+	return pieces.Take(queue, n)
+}
+
+type solver struct {
+	lvl    *level.Level
+	opts   SolveOptions
+	deal   []string
+	spawns []level.Point
+	seen   map[string]int // depth each state was explored at
+	nodes  int
+	cutoff bool // some line of play hit the piece limit
+}
+
+// move is a candidate placement and the state it leads to
+type move struct {
+	Placement
+	next  solverState
+	score float64
+}
+
+// search explores placements depth first, most promising first
+func (s *solver) search(st solverState, depth int) ([]Placement, bool) {
+	if s.nodes >= s.opts.MaxNodes {
+		return nil, false
+	}
+	if depth >= s.opts.MaxPieces {
+		s.cutoff = true
+		return nil, false
+	}
+	// a state already explored with as many pieces left can't succeed now
+	key := s.key(st, depth)
+	if at, ok := s.seen[key]; ok && at <= depth {
+		return nil, false
+	}
+	s.seen[key] = depth
+	s.nodes++
+
+	choices := level.BlockTypes
+	if depth < len(s.deal) {
+		choices = []string{s.deal[depth]}
+	}
+	var moves []move
+	for _, piece := range choices {
+		moves = append(moves, s.moves(st, piece)...)
+	}
+	sort.SliceStable(moves, func(i, j int) bool { return moves[i].score > moves[j].score })
+	for _, m := range moves {
+		if s.done(m.next) {
+			return []Placement{m.Placement}, true
+		}
+		if rest, ok := s.search(m.next, depth+1); ok {
+			return append([]Placement{m.Placement}, rest...), true
+		}
+	}
+	return nil, false
+}
+
+// key identifies a state for deduplication; the depth only matters while
+// the dealt pieces still constrain what comes next
+func (s *solver) key(st solverState, depth int) string {
+	var sb strings.Builder
+	for y := range st.b {
+		for x := range st.b[y] {
+			switch {
+			case st.special[y][x]:
+				sb.WriteByte('*')
+			case st.b[y][x]:
+				sb.WriteByte('#')
+			default:
+				sb.WriteByte('.')
+			}
+		}
+	}
+	if depth < len(s.deal) {
+		fmt.Fprintf(&sb, "@%d", depth)
+	}
+	fmt.Fprintf(&sb, "|%d|%d|%d", s.progress(st.lines, ObjectiveClearLines), s.progress(st.spells, ObjectiveCastSpell),
+		s.progress(st.triggers, ObjectiveTriggerSpecial))
+	left := make([]string, 0, len(st.pickups))
+	for p := range st.pickups {
+		left = append(left, fmt.Sprintf("%d,%d", p.X, p.Y))
+	}
+	sort.Strings(left)
+	sb.WriteString("|" + strings.Join(left, " "))
+	return sb.String()
+}
+
+// progress caps a counter at the largest target set for it, since going
+// beyond that doesn't bring the level closer to completion
+func (s *solver) progress(n int, kind string) int {
+	target := 0
+	for _, o := range s.lvl.Objectives {
+		if o.Kind == kind && o.Target > target {
+			target = o.Target
+		}
+	}
+	return min(n, target)
+}
+
+// done reports whether every objective is met in the state
+func (s *solver) done(st solverState) bool {
+	for _, o := range s.lvl.Objectives {
+		var have int
+		switch o.Kind {
+		case ObjectiveClearLines:
+			have = st.lines
+		case ObjectiveCastSpell:
+			have = st.spells
+		case ObjectiveTriggerSpecial:
+			have = st.triggers
+		case ObjectiveFillGoal:
+			have = st.goalFilled(*s.lvl.GoalArea)
+		}
+		if have < o.Target {
+			return false
+		}
+	}
+	return true
+}
+
+func (st solverState) goalFilled(goal level.Zone) int {
+	filled := 0
+	for y := goal.Y; y < goal.Y+goal.Height; y++ {
+		for x := goal.X; x < goal.X+goal.Width; x++ {
+			if y >= 0 && y < len(st.b) && x >= 0 && x < len(st.b[y]) && st.b[y][x] {
+				filled++
+			}
+		}
+	}
+	return filled
+}
+
+type piecePos struct{ x, y, rot int }
+
+// reachable returns every position the piece can move to from a spawn
+// point, in breadth-first order
+func (s *solver) reachable(b board, piece string) []piecePos {
+	return reachable(b, piece, s.spawns)
+}
+
+// reachable returns every position the piece can move to from the spawn
+// points, moving left, right, down and rotating, without wall kicks
+func reachable(b board, piece string, spawns []level.Point) []piecePos {
+	var queue []piecePos
+	seen := make(map[piecePos]bool)
+	fits := func(p piecePos) bool {
+		cells, _ := pieces.Cells(piece, p.rot)
+		return b.fits(cells, p.x, p.y)
+	}
+	for _, sp := range spawns {
+		p := piecePos{x: sp.X - 1, y: sp.Y}
+		if !seen[p] && fits(p) {
+			seen[p] = true
+			queue = append(queue, p)
+		}
+	}
+	for i := 0; i < len(queue); i++ {
+		p := queue[i]
+		for _, n := range []piecePos{{p.x - 1, p.y, p.rot}, {p.x + 1, p.y, p.rot}, {p.x, p.y + 1, p.rot},
+			{p.x, p.y, (p.rot + 1) % 4}, {p.x, p.y, (p.rot + 3) % 4}} {
+			if !seen[n] && fits(n) {
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	return queue
+}
+
+// collect picks up every pickup on the cells a piece can move over before
+// locking
+func (st *solverState) collect(path map[level.Point]bool) {
+	for p := range st.pickups {
+		if path[p] {
+			delete(st.pickups, p)
+			st.spells++
+		}
+	}
+}
+
+// moves lists every distinct way to lock the piece and the states they
+// lead to
+func (s *solver) moves(st solverState, piece string) []move {
+	positions := s.reachable(st.b, piece)
+	path := make(map[level.Point]bool)
+	for _, p := range positions {
+		cells, _ := pieces.Cells(piece, p.rot)
+		for _, c := range cells {
+			path[level.Point{X: c.X + p.x, Y: c.Y + p.y}] = true
+		}
+	}
+	var out []move
+	locked := make(map[string]bool)
+	for _, p := range positions {
+		cells, _ := pieces.Cells(piece, p.rot)
+		if st.b.fits(cells, p.x, p.y+1) {
+			continue // not resting on anything
+		}
+		abs := make([]string, len(cells))
+		for i, c := range cells {
+			abs[i] = fmt.Sprintf("%d,%d", c.X+p.x, c.Y+p.y)
+		}
+		sort.Strings(abs)
+		if k := strings.Join(abs, " "); locked[k] {
+			continue // another rotation covering the same cells
+		} else {
+			locked[k] = true
+		}
+
+		next := st.clone()
+		next.collect(path)
+		lines, triggered := next.place(cells, p.x, p.y)
+		next.lines += lines
+		next.triggers += triggered
+		m := move{Placement: Placement{Piece: piece, X: p.x, Y: p.y, Rotation: p.rot, Lines: lines}, next: next}
+		m.score = next.b.evaluate(lines) + 10*float64(next.lines-st.lines+next.spells-st.spells+next.triggers-st.triggers)
+		if s.lvl.GoalArea != nil {
+			m.score += 2 * float64(next.goalFilled(*s.lvl.GoalArea))
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func (st solverState) clone() solverState {
+	c := st
+	c.b = st.b.clone()
+	c.special = make([][]bool, len(st.special))
+	for y := range st.special {
+		c.special[y] = append([]bool(nil), st.special[y]...)
+	}
+	c.pickups = make(map[level.Point]bool, len(st.pickups))
+	for p := range st.pickups {
+		c.pickups[p] = true
+	}
+	return c
+}
+
+// place locks the cells and clears full rows, returning the rows cleared
+// and the special blocks they held
+func (st *solverState) place(cells []level.Point, dx, dy int) (lines, triggered int) {
+	for _, c := range cells {
+		st.b[c.Y+dy][c.X+dx] = true
+	}
+	for y := len(st.b) - 1; y >= 0; {
+		full := true
+		for _, filled := range st.b[y] {
+			full = full && filled
+		}
+		if !full {
+			y--
+			continue
+		}
+		for _, special := range st.special[y] {
+			if special {
+				triggered++
+			}
+		}
+		copy(st.b[1:y+1], st.b[:y])
+		copy(st.special[1:y+1], st.special[:y])
+		st.b[0] = make([]bool, len(st.b[y]))
+		st.special[0] = make([]bool, len(st.special[y]))
+		lines++
+	}
+	return lines, triggered
+}
+
+// SolveLevels runs the solver on every level, in name order
+func (d *Dataset) SolveLevels(opts SolveOptions) []Solvability {
+	var out []Solvability
+	for _, lvl := range d.LevelList() {
+		out = append(out, Solve(lvl, opts))
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// gapLevel has its bottom row filled except for the last column
+func gapLevel(objectives ...level.Objective) *level.Level {
+	lvl := level.New("gap", 6, 8)
+	for x := 0; x < 5; x++ {
+		lvl.Blocks = append(lvl.Blocks, level.Block{Type: "O", X: x, Y: 7})
+	}
+	lvl.SpawnPoints = []level.Point{{X: 3, Y: 0}}
+	lvl.Objectives = objectives
+	return lvl
+}
+
+func TestSolveFindsWitness(t *testing.T) {
+	lvl := gapLevel(level.Objective{Kind: ObjectiveClearLines, Target: 1})
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"I"}}
+	res := Solve(lvl, DefaultSolveOptions())
+	if res.Status != Solvable || len(res.Witness) != 1 {
+		t.Fatalf("%s (%s), witness %+v", res.Status, res.Reason, res.Witness)
+	}
+	if w := res.Witness[0]; w.Piece != "I" || w.Lines != 1 || w.Rotation%2 != 1 {
+		t.Errorf("witness %+v, want a vertical I clearing a line", w)
+	}
+}
+
+func TestSolveSpecialAndPickup(t *testing.T) {
+	lvl := gapLevel(level.Objective{Kind: ObjectiveTriggerSpecial, Target: 1}, level.Objective{Kind: ObjectiveCastSpell, Target: 1})
+	lvl.Blocks[2].Special = level.SpecialBomb
+	lvl.Pickups = []level.Pickup{{Spell: level.SpellClearLine, X: 0, Y: 3}}
+	res := Solve(lvl, DefaultSolveOptions())
+	if res.Status != Solvable {
+		t.Fatalf("%s (%s)", res.Status, res.Reason)
+	}
+}
+
+func TestSolveProvesImpossible(t *testing.T) {
+	res := Solve(gapLevel(level.Objective{Kind: ObjectiveCastSpell, Target: 1}), DefaultSolveOptions())
+	if res.Status != Impossible || !strings.Contains(res.Reason, "pickups") {
+		t.Errorf("no pickups: %s (%s)", res.Status, res.Reason)
+	}
+
+	// the spawn row is walled in, so no piece can ever enter the board
+	lvl := gapLevel(level.Objective{Kind: ObjectiveClearLines, Target: 1})
+	for x := 0; x < 6; x++ {
+		lvl.Blocks = append(lvl.Blocks, level.Block{Type: "O", X: x, Y: 1})
+	}
+	res = Solve(lvl, DefaultSolveOptions())
+	if res.Status != Impossible || !strings.Contains(res.Reason, "tops out") {
+		t.Errorf("walled in: %s (%s)", res.Status, res.Reason)
+	}
+}
+
+func TestSolveGivesUpWithinBudget(t *testing.T) {
+	lvl := level.New("wide", 10, 20)
+	lvl.Objectives = []level.Objective{{Kind: ObjectiveClearLines, Target: 40}}
+	res := Solve(lvl, SolveOptions{MaxPieces: 5, MaxNodes: 1000})
+	if res.Status != Unknown {
+		t.Errorf("%s (%s), want unknown", res.Status, res.Reason)
+	}
+}
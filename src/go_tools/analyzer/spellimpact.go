@@ -0,0 +1,281 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Logistic regression settings
+const (
+	impactIterations = 50
+	impactRidge      = 1e-3 // keeps the fit finite when a spell always wins or loses
+	impactRatingUnit = 400  // rating advantage is measured in Elo's 400 point unit
+	impactBaseRating = 1500 // stands in for unrated players and, in solo sessions, the opponent
+)
+
+// SpellImpact is one spell's estimated effect on winning
+type SpellImpact struct {
+	Spell     string  `json:"spell"`
+	Sessions  int     `json:"sessions"` // player sessions casting it at least once
+	PickRate  float64 `json:"pickRate"`
+	Coef      float64 `json:"coef"` // log-odds change from casting it, rating held fixed
+	CoefLow   float64 `json:"coefLow"`
+	CoefHigh  float64 `json:"coefHigh"`
+	OddsRatio float64 `json:"oddsRatio"`
+	Impact    float64 `json:"impact"` // average change in win probability from casting it
+	Low       float64 `json:"low"`
+	High      float64 `json:"high"`
+	PValue    float64 `json:"pValue"`
+}
+
+// SpellImpactReport ranks spells by their estimated effect on winning
+type SpellImpactReport struct {
+	Sessions   int           `json:"sessions"`
+	Confidence float64       `json:"confidence"`
+	RatingCoef float64       `json:"ratingCoef"` // log-odds per 400 points of rating advantage
+	Spells     []SpellImpact `json:"spells"`     // most impactful first
+}
+
+// SpellImpact fits a logistic regression of each player session's win on
+// which spells the player cast, controlling for their rating advantage over
+// their opponents, and converts each spell's coefficient into an average
+// change in win probability with a confidence interval. Unlike the caster
+// win-rate delta, strong players favouring a spell doesn't make it look
+// strong.
+func (d *Dataset) SpellImpact(confidence float64) (SpellImpactReport, error) {
+	report := SpellImpactReport{Confidence: confidence}
+	if confidence <= 0 || confidence >= 1 {
+		return report, fmt.Errorf("confidence must be between 0 and 1, got %g", confidence)
+	}
+	column := make(map[string]int)
+	var spells []string
+	for _, s := range level.Spells {
+		column[s] = len(spells) + 2
+		spells = append(spells, s)
+	}
+	var xs [][]float64
+	var ys []float64
+	for _, r := range d.Replays {
+		for _, p := range r.Players {
+			x := make([]float64, 2, 2+len(spells))
+			x[0], x[1] = 1, ratingAdvantage(r, p.ID)/impactRatingUnit
+			x = append(x, make([]float64, len(spells))...)
+			for _, sc := range r.Spells {
+				if sc.Player != p.ID {
+					continue
+				}
+				j, ok := column[sc.Spell]
+				if !ok {
+					column[sc.Spell] = len(spells) + 2
+					spells = append(spells, sc.Spell)
+					for i := range xs {
+						xs[i] = append(xs[i], 0)
+					}
+					x = append(x, 0)
+					j = len(x) - 1
+				}
+				x[j] = 1
+			}
+			y := 0.0
+			if r.Won(p.ID) {
+				y = 1
+			}
+			xs, ys = append(xs, x), append(ys, y)
+		}
+	}
+	report.Sessions = len(xs)
+	if len(xs) == 0 {
+		return report, nil
+	}
+
+	beta, cov, err := logisticRegression(xs, ys)
+	if err != nil {
+		return report, err
+	}
+	report.RatingCoef = beta[1]
+	z := stats.NormalQuantile(1 - confidence)
+	for i, s := range spells {
+		j := i + 2
+		imp := SpellImpact{Spell: s}
+		for _, x := range xs {
+			if x[j] == 1 {
+				imp.Sessions++
+			}
+		}
+		if imp.Sessions == 0 {
+			continue
+		}
+		se := math.Sqrt(cov[j][j])
+		imp.PickRate = float64(imp.Sessions) / float64(len(xs))
+		imp.Coef, imp.CoefLow, imp.CoefHigh = beta[j], beta[j]-z*se, beta[j]+z*se
+		imp.OddsRatio = math.Exp(beta[j])
+		imp.PValue = stats.NormalTwoSided(beta[j] / se)
+		// the marginal effect is monotone in the coefficient, so the
+		// coefficient's bounds carry over
+		imp.Impact = marginalEffect(xs, beta, j, beta[j])
+		imp.Low = marginalEffect(xs, beta, j, imp.CoefLow)
+		imp.High = marginalEffect(xs, beta, j, imp.CoefHigh)
+		report.Spells = append(report.Spells, imp)
+	}
+	sort.SliceStable(report.Spells, func(a, b int) bool { return report.Spells[a].Impact > report.Spells[b].Impact })
+	return report, nil
+}
+
+// ratingAdvantage is the player's rating minus the mean of their opponents'
+func ratingAdvantage(r *replay.Replay, player string) float64 {
+	rating := func(v float64) float64 {
+		if v <= 0 {
+			return impactBaseRating
+		}
+		return v
+	}
+	own, opponents, n := float64(impactBaseRating), 0.0, 0
+	for _, p := range r.Players {
+		if p.ID == player {
+			own = rating(p.Rating)
+		} else {
+			opponents += rating(p.Rating)
+			n++
+		}
+	}
+	if n == 0 {
+		return own - impactBaseRating
+	}
+	return own - opponents/float64(n)
+}
+
+// marginalEffect averages, over every session, how much the win
+// probability rises when feature j switches from 0 to 1, with coefficient
+// coef in place of beta[j]
+func marginalEffect(xs [][]float64, beta []float64, j int, coef float64) float64 {
+	total := 0.0
+	for _, x := range xs {
+		eta := 0.0
+		for k, v := range x {
+			if k != j {
+				eta += beta[k] * v
+			}
+		}
+		total += logistic(eta+coef) - logistic(eta)
+	}
+	return total / float64(len(xs))
+}
+
+func logistic(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+// logisticRegression fits y ~ logistic(x·beta) by Newton-Raphson with a
+// small ridge penalty, returning the coefficients and their covariance
+func logisticRegression(xs [][]float64, ys []float64) (beta []float64, cov [][]float64, err error) {
+	k := len(xs[0])
+	beta = make([]float64, k)
+	for iter := 0; iter < impactIterations; iter++ {
+		grad := make([]float64, k)
+		hess := make([][]float64, k)
+		for a := range hess {
+			hess[a] = make([]float64, k)
+			hess[a][a] = impactRidge
+			grad[a] = -impactRidge * beta[a]
+		}
+		for i, x := range xs {
+			eta := 0.0
+			for a, v := range x {
+				eta += beta[a] * v
+			}
+			p := logistic(eta)
+			w := p * (1 - p)
+			for a, va := range x {
+				grad[a] += (ys[i] - p) * va
+				for b, vb := range x {
+					hess[a][b] += w * va * vb
+				}
+			}
+		}
+		if cov, err = invert(hess); err != nil {
+			return nil, nil, err
+		}
+		step := 0.0
+		for a := range beta {
+			delta := 0.0
+			for b := range grad {
+				delta += cov[a][b] * grad[b]
+			}
+			beta[a] += delta
+			step = math.Max(step, math.Abs(delta))
+		}
+		if step < 1e-8 {
+			break
+		}
+	}
+	return beta, cov, nil
+}
+
+// invert inverts a square matrix by Gauss-Jordan elimination
+func invert(m [][]float64) ([][]float64, error) {
+	n := len(m)
+	a := make([][]float64, n)
+	for i := range m {
+		a[i] = make([]float64, 2*n)
+		copy(a[i], m[i])
+		a[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("singular matrix")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		scale := a[col][col]
+		for j := range a[col] {
+			a[col][j] /= scale
+		}
+		for row := 0; row < n; row++ {
+			if row == col || a[row][col] == 0 {
+				continue
+			}
+			f := a[row][col]
+			for j := range a[row] {
+				a[row][j] -= f * a[col][j]
+			}
+		}
+	}
+	inv := make([][]float64, n)
+	for i := range a {
+		inv[i] = a[i][n:]
+	}
+	return inv, nil
+}
+
+// spellImpactPass reports SpellImpact at 95% confidence
+type spellImpactPass struct{}
+
+func init() {
+	RegisterPass(spellImpactPass{})
+}
+
+func (spellImpactPass) Name() string       { return "spell_impact" }
+func (spellImpactPass) Requires() []string { return []string{InputReplays} }
+
+func (spellImpactPass) Run(in PassInputs) ([]*Table, error) {
+	report, err := in.Data.SpellImpact(0.95)
+	if err != nil {
+		return nil, err
+	}
+	t := NewTable("by_spell", "spell", "sessions:int", "pick_rate:float", "coef:float", "coef_low:float", "coef_high:float",
+		"odds_ratio:float", "win_impact:float", "impact_low:float", "impact_high:float", "p_value:float")
+	for _, s := range report.Spells {
+		t.Add(s.Spell, s.Sessions, s.PickRate, s.Coef, s.CoefLow, s.CoefHigh, s.OddsRatio, s.Impact, s.Low, s.High, s.PValue)
+	}
+	return []*Table{t}, nil
+}
@@ -0,0 +1,73 @@
+package analyzer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Strong players always win more and mostly cast SLOW_DOWN, which does
+// nothing; weak players casting CLEAR_LINE win far more often.
+func TestSpellImpactControlsForRating(t *testing.T) {
+	data := NewDataset()
+	for i := 0; i < 400; i++ {
+		r := &replay.Replay{Players: []replay.Player{{ID: "strong", Rating: 1800}, {ID: "weak", Rating: 1200}}}
+		if i%3 != 0 {
+			r.Spells = append(r.Spells, replay.SpellCast{Player: "strong", Spell: level.SpellSlowDown, Target: "weak"})
+		}
+		r.Result.Winner = "strong"
+		if i%2 == 0 {
+			r.Spells = append(r.Spells, replay.SpellCast{Player: "weak", Spell: level.SpellClearLine, Target: "weak"})
+			if i%4 == 0 {
+				r.Result.Winner = "weak"
+			}
+		} else if i%10 == 1 {
+			r.Result.Winner = "weak"
+		}
+		data.Replays = append(data.Replays, r)
+	}
+
+	report, err := data.SpellImpact(0.95)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sessions != 800 || len(report.Spells) != 2 {
+		t.Fatalf("sessions %d, spells %+v", report.Sessions, report.Spells)
+	}
+	if report.RatingCoef <= 0 {
+		t.Errorf("rating coefficient %.3f, want positive", report.RatingCoef)
+	}
+	clear, slow := report.Spells[0], report.Spells[1]
+	if clear.Spell != level.SpellClearLine {
+		t.Fatalf("ranked %s first", clear.Spell)
+	}
+	if clear.Low <= 0 || clear.Impact < 0.15 || clear.PValue > 0.01 {
+		t.Errorf("clear line impact %.3f [%.3f, %.3f] p=%.4f, want clearly positive", clear.Impact, clear.Low, clear.High, clear.PValue)
+	}
+	if slow.Low >= 0 || slow.High <= 0 {
+		t.Errorf("slow down impact %.3f [%.3f, %.3f], want an interval around 0", slow.Impact, slow.Low, slow.High)
+	}
+	if math.Abs(slow.PickRate-0.33) > 0.01 {
+		t.Errorf("slow down pick rate %.3f", slow.PickRate)
+	}
+}
+
+func TestInvert(t *testing.T) {
+	inv, err := invert([][]float64{{4, 7}, {2, 6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float64{{0.6, -0.7}, {-0.2, 0.4}}
+	for i := range want {
+		for j := range want[i] {
+			if math.Abs(inv[i][j]-want[i][j]) > 1e-9 {
+				t.Errorf("inv[%d][%d] = %g, want %g", i, j, inv[i][j], want[i][j])
+			}
+		}
+	}
+	if _, err := invert([][]float64{{1, 2}, {2, 4}}); err == nil {
+		t.Error("inverted a singular matrix")
+	}
+}
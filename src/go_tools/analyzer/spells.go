@@ -0,0 +1,144 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// timingBuckets splits a session into equal parts for the cast timing histogram
+const timingBuckets = 10
+
+// Spell target roles
+const (
+	TargetSelf     = "self"
+	TargetOpponent = "opponent"
+	TargetLeader   = "leader" // the opponent finishing with the highest score
+	TargetNone     = "none"
+)
+
+// SpellUsage describes how one spell is used and how it affects results
+type SpellUsage struct {
+	Spell        string         `json:"spell"`
+	Casts        int            `json:"casts"`
+	PickRate     float64        `json:"pickRate"`     // share of player-sessions casting it at least once
+	MeanCastSec  float64        `json:"meanCastSec"`  // seconds after session start
+	Timing       []int          `json:"timing"`       // casts per tenth of the session
+	CasterWins   float64        `json:"casterWins"`   // win rate of player-sessions that cast it
+	WinRateDelta float64        `json:"winRateDelta"` // caster win rate minus everyone else's
+	Targets      map[string]int `json:"targets"`      // casts per target role
+	TopTarget    string         `json:"topTarget"`
+}
+
+// AnalyzeSpellUsage computes pick rate, cast timing, win-rate impact and
+// target choice for every spell, in level.Spells order
+func AnalyzeSpellUsage(replays []*replay.Replay) []SpellUsage {
+	usage := make(map[string]*SpellUsage, len(level.Spells))
+	casters := make(map[string]winCounter, len(level.Spells))
+	for _, s := range level.Spells {
+		usage[s] = &SpellUsage{Spell: s, Timing: make([]int, timingBuckets), Targets: make(map[string]int)}
+		casters[s] = winCounter{}
+	}
+	timeSum := make(map[string]float64)
+	playerSessions := 0
+
+	for _, r := range replays {
+		cast := make(map[string]map[string]bool)
+		for _, sc := range r.Spells {
+			u, ok := usage[sc.Spell]
+			if !ok {
+				continue
+			}
+			u.Casts++
+			timeSum[sc.Spell] += float64(sc.TimeMs) / 1000
+			if r.Result.DurationMs > 0 {
+				b := int(sc.TimeMs * timingBuckets / r.Result.DurationMs)
+				if b >= timingBuckets {
+					b = timingBuckets - 1
+				}
+				if b >= 0 {
+					u.Timing[b]++
+				}
+			}
+			u.Targets[targetRole(r, sc)]++
+			if cast[sc.Player] == nil {
+				cast[sc.Player] = make(map[string]bool)
+			}
+			cast[sc.Player][sc.Spell] = true
+		}
+
+		for _, p := range r.Players {
+			playerSessions++
+			won := r.Won(p.ID)
+			for _, s := range level.Spells {
+				key := "other"
+				if cast[p.ID][s] {
+					key = "caster"
+				}
+				casters[s].add(key, won)
+			}
+		}
+	}
+
+	out := make([]SpellUsage, 0, len(level.Spells))
+	for _, s := range level.Spells {
+		u := usage[s]
+		c, o := casters[s]["caster"], casters[s]["other"]
+		if c != nil {
+			u.PickRate = float64(c.Games) / float64(playerSessions)
+			u.CasterWins = c.withRate().Rate
+			u.WinRateDelta = u.CasterWins
+			if o != nil {
+				u.WinRateDelta -= o.withRate().Rate
+			}
+		}
+		if u.Casts > 0 {
+			u.MeanCastSec = timeSum[s] / float64(u.Casts)
+		}
+		u.TopTarget = topKey(u.Targets)
+		out = append(out, *u)
+	}
+	return out
+}
+
+// targetRole classifies whom a spell was aimed at
+func targetRole(r *replay.Replay, sc replay.SpellCast) string {
+	switch {
+	case sc.Target == "":
+		return TargetNone
+	case sc.Target == sc.Player:
+		return TargetSelf
+	case len(r.Players) > 2 && leader(r, sc.Player) == sc.Target:
+		return TargetLeader
+	default:
+		return TargetOpponent
+	}
+}
+
+// leader returns the opponent of player with the highest final score
+func leader(r *replay.Replay, player string) string {
+	best, bestScore := "", -1
+	for _, p := range r.Players {
+		if s, ok := r.Result.Scores[p.ID]; ok && p.ID != player && s > bestScore {
+			best, bestScore = p.ID, s
+		}
+	}
+	return best
+}
+
+// topKey returns the key with the largest count, breaking ties by name
+func topKey(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	top := ""
+	for _, k := range keys {
+		if top == "" || counts[k] > counts[top] {
+			top = k
+		}
+	}
+	return top
+}
@@ -0,0 +1,84 @@
+package analyzer
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestAnalyzeSpellUsage(t *testing.T) {
+	usage := AnalyzeSpellUsage(balanceReplays())
+	if len(usage) != len(level.Spells) {
+		t.Fatalf("%d spells, want every one of %d", len(usage), len(level.Spells))
+	}
+	bySpell := map[string]SpellUsage{}
+	for i, u := range usage {
+		if u.Spell != level.Spells[i] {
+			t.Errorf("spell %d is %s, want %s", i, u.Spell, level.Spells[i])
+		}
+		bySpell[u.Spell] = u
+	}
+
+	// Five player-sessions; a cast clear line twice and c once, winning two
+	// of three, while b won one of two without it
+	clear := bySpell[level.SpellClearLine]
+	if clear.Casts != 3 || math.Abs(clear.PickRate-0.6) > 1e-9 {
+		t.Errorf("clear line: %d casts, pick rate %v", clear.Casts, clear.PickRate)
+	}
+	if math.Abs(clear.CasterWins-2.0/3) > 1e-9 || math.Abs(clear.WinRateDelta-(2.0/3-0.5)) > 1e-9 {
+		t.Errorf("clear line: caster wins %v, delta %v", clear.CasterWins, clear.WinRateDelta)
+	}
+	if math.Abs(clear.MeanCastSec-(6+29.999+45)/3) > 1e-9 {
+		t.Errorf("clear line: mean cast at %vs", clear.MeanCastSec)
+	}
+	// Casts a tenth, just under the whole and half way into their sessions
+	if want := []int{0, 1, 0, 0, 0, 1, 0, 0, 0, 1}; !reflect.DeepEqual(clear.Timing, want) {
+		t.Errorf("clear line timing %v, want %v", clear.Timing, want)
+	}
+	if clear.Targets[TargetSelf] != 2 || clear.Targets[TargetNone] != 1 || clear.TopTarget != TargetSelf {
+		t.Errorf("clear line targets %v, top %q", clear.Targets, clear.TopTarget)
+	}
+
+	speed := bySpell[level.SpellSpeedUp]
+	if speed.TopTarget != TargetOpponent || speed.CasterWins != 1 || speed.WinRateDelta != 0.5 {
+		t.Errorf("speed up: %+v", speed)
+	}
+	freeze := bySpell[level.SpellFreeze]
+	if freeze.Casts != 0 || freeze.PickRate != 0 || freeze.TopTarget != "" || len(freeze.Timing) != timingBuckets {
+		t.Errorf("an uncast spell: %+v", freeze)
+	}
+}
+
+func TestSpellTargetsTheLeader(t *testing.T) {
+	r := &replay.Replay{
+		Players: []replay.Player{{ID: "a"}, {ID: "b"}, {ID: "c"}},
+		Spells: []replay.SpellCast{
+			{Player: "a", Spell: level.SpellAddBlocks, Target: "c"},
+			{Player: "a", Spell: level.SpellAddBlocks, Target: "b"},
+			{Player: "c", Spell: level.SpellAddBlocks, Target: "a"}, // a trails c, but leads the others
+		},
+		Result: replay.Result{Winner: "c", DurationMs: 1000, Scores: map[string]int{"a": 50, "b": 10, "c": 900}},
+	}
+	addBlocks := func() SpellUsage {
+		for _, u := range AnalyzeSpellUsage([]*replay.Replay{r}) {
+			if u.Spell == level.SpellAddBlocks {
+				return u
+			}
+		}
+		t.Fatal("no usage for add blocks")
+		return SpellUsage{}
+	}
+	if u := addBlocks(); u.Targets[TargetLeader] != 2 || u.Targets[TargetOpponent] != 1 || u.TopTarget != TargetLeader {
+		t.Errorf("targets %v, top %q", u.Targets, u.TopTarget)
+	}
+
+	// In a match of two the only opponent is never counted as the leader
+	r.Players = r.Players[:2]
+	r.Spells = r.Spells[1:2]
+	if u := addBlocks(); u.Targets[TargetOpponent] != 1 {
+		t.Errorf("two-player targets %v", u.Targets)
+	}
+}
@@ -0,0 +1,203 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// followPoll is how often a followed file is checked for new data
+const followPoll = 250 * time.Millisecond
+
+// OpenStream opens a live session log: "tcp://host:port" and
+// "unix:///path" are dialled, anything else is a file followed like
+// tail -f from its current end
+func OpenStream(ctx context.Context, source string) (io.ReadCloser, error) {
+	for _, network := range []string{"tcp", "unix"} {
+		if addr, ok := strings.CutPrefix(source, network+"://"); ok {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			crash.Go(func() {
+				<-ctx.Done()
+				conn.Close()
+			})
+			return conn, nil
+		}
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &follower{ctx: ctx, f: f}, nil
+}
+
+// follower reads a growing file, waiting at the end for more data
+type follower struct {
+	ctx context.Context
+	f   *os.File
+}
+
+func (fl *follower) Read(p []byte) (int, error) {
+	for {
+		n, err := fl.f.Read(p)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		select {
+		case <-fl.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(followPoll):
+		}
+	}
+}
+
+func (fl *follower) Close() error {
+	return fl.f.Close()
+}
+
+// Snapshot is the state of the rolling metrics at one moment
+type Snapshot struct {
+	Time         time.Time      `json:"time"`
+	Window       time.Duration  `json:"window"`
+	Sessions     int            `json:"sessions"` // sessions with activity in the window
+	Started      int            `json:"started"`
+	Ended        int            `json:"ended"`
+	InputsPerSec float64        `json:"inputsPerSec"`
+	PiecesPerMin float64        `json:"piecesPerMin"`
+	LinesPerMin  float64        `json:"linesPerMin"`
+	TopOuts      int            `json:"topOuts"`
+	Spells       map[string]int `json:"spells"`
+}
+
+// bucket holds one second of activity
+type bucket struct {
+	second   int64
+	sessions map[string]bool
+	started  int
+	ended    int
+	inputs   int
+	pieces   int
+	lines    int
+	topOuts  int
+	spells   map[string]int
+}
+
+// RollingMetrics aggregates live records over a sliding window, one
+// bucket per second of arrival time; it is safe for concurrent use
+type RollingMetrics struct {
+	mu      sync.Mutex
+	window  time.Duration
+	buckets []*bucket
+}
+
+// NewRollingMetrics returns metrics covering the last window of activity
+func NewRollingMetrics(window time.Duration) *RollingMetrics {
+	seconds := int(window / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return &RollingMetrics{window: time.Duration(seconds) * time.Second, buckets: make([]*bucket, seconds)}
+}
+
+// bucketAt returns the bucket for now, recycling the slot of an expired second
+func (m *RollingMetrics) bucketAt(now time.Time) *bucket {
+	sec := now.Unix()
+	slot := int(sec % int64(len(m.buckets)))
+	b := m.buckets[slot]
+	if b == nil || b.second != sec {
+		b = &bucket{second: sec, sessions: make(map[string]bool), spells: make(map[string]int)}
+		m.buckets[slot] = b
+	}
+	return b
+}
+
+// Add records one live record as arriving at now
+func (m *RollingMetrics) Add(rec replay.Record, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.bucketAt(now)
+	b.sessions[rec.Session] = true
+	switch rec.Kind {
+	case replay.RecordStart:
+		b.started++
+	case replay.RecordEnd:
+		b.ended++
+	case replay.RecordInput:
+		b.inputs++
+	case replay.RecordSpell:
+		b.spells[rec.Spell.Spell]++
+	case replay.RecordEvent:
+		switch rec.Event.Type {
+		case replay.EventLock:
+			b.pieces++
+		case replay.EventClear:
+			b.lines += rec.Event.Lines
+		case replay.EventTopOut:
+			b.topOuts++
+		}
+	}
+}
+
+// Snapshot sums the buckets still inside the window at now
+func (m *RollingMetrics) Snapshot(now time.Time) Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Snapshot{Time: now, Window: m.window, Spells: make(map[string]int)}
+	oldest := now.Unix() - int64(len(m.buckets)) + 1
+	sessions := make(map[string]bool)
+	var inputs, pieces, lines int
+	for _, b := range m.buckets {
+		if b == nil || b.second < oldest || b.second > now.Unix() {
+			continue
+		}
+		for id := range b.sessions {
+			sessions[id] = true
+		}
+		s.Started += b.started
+		s.Ended += b.ended
+		s.TopOuts += b.topOuts
+		inputs += b.inputs
+		pieces += b.pieces
+		lines += b.lines
+		for spell, n := range b.spells {
+			s.Spells[spell] += n
+		}
+	}
+	s.Sessions = len(sessions)
+	secs := m.window.Seconds()
+	s.InputsPerSec = float64(inputs) / secs
+	s.PiecesPerMin = float64(pieces) * 60 / secs
+	s.LinesPerMin = float64(lines) * 60 / secs
+	return s
+}
+
+// TopSpells returns the snapshot's spells, most cast first
+func (s Snapshot) TopSpells() []string {
+	spells := make([]string, 0, len(s.Spells))
+	for spell := range s.Spells {
+		spells = append(spells, spell)
+	}
+	sort.Slice(spells, func(i, j int) bool {
+		if s.Spells[spells[i]] != s.Spells[spells[j]] {
+			return s.Spells[spells[i]] > s.Spells[spells[j]]
+		}
+		return spells[i] < spells[j]
+	})
+	return spells
+}
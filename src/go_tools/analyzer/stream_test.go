@@ -0,0 +1,48 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestRollingMetricsCoverTheWindow(t *testing.T) {
+	m := NewRollingMetrics(10 * time.Second)
+	start := time.Unix(1_700_000_000, 0)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	m.Add(replay.Record{Session: "s1", Kind: replay.RecordStart}, at(0))
+	m.Add(replay.Record{Session: "s2", Kind: replay.RecordStart}, at(1))
+	for i := 0; i < 20; i++ {
+		m.Add(replay.Record{Session: "s1", Kind: replay.RecordInput, Input: &replay.Input{Action: replay.ActionLeft}}, at(2))
+	}
+	m.Add(replay.Record{Session: "s1", Kind: replay.RecordEvent, Event: &replay.Event{Type: replay.EventLock}}, at(3))
+	m.Add(replay.Record{Session: "s1", Kind: replay.RecordEvent, Event: &replay.Event{Type: replay.EventClear, Lines: 4}}, at(3))
+	m.Add(replay.Record{Session: "s2", Kind: replay.RecordSpell, Spell: &replay.SpellCast{Spell: "freeze"}}, at(4))
+	m.Add(replay.Record{Session: "s2", Kind: replay.RecordSpell, Spell: &replay.SpellCast{Spell: "freeze"}}, at(5))
+	m.Add(replay.Record{Session: "s2", Kind: replay.RecordSpell, Spell: &replay.SpellCast{Spell: "bomb"}}, at(5))
+	m.Add(replay.Record{Session: "s2", Kind: replay.RecordEvent, Event: &replay.Event{Type: replay.EventTopOut}}, at(6))
+	m.Add(replay.Record{Session: "s2", Kind: replay.RecordEnd, Result: &replay.Result{}}, at(6))
+
+	s := m.Snapshot(at(6))
+	if s.Window != 10*time.Second || s.Sessions != 2 || s.Started != 2 || s.Ended != 1 || s.TopOuts != 1 {
+		t.Errorf("snapshot = %+v", s)
+	}
+	if s.InputsPerSec != 2 || s.PiecesPerMin != 6 || s.LinesPerMin != 24 {
+		t.Errorf("rates = %.1f inputs/s, %.1f pieces/min, %.1f lines/min", s.InputsPerSec, s.PiecesPerMin, s.LinesPerMin)
+	}
+	if got := s.TopSpells(); !reflect.DeepEqual(got, []string{"freeze", "bomb"}) {
+		t.Errorf("top spells = %v", got)
+	}
+
+	// the first seconds age out, and their slots are reused for new ones
+	m.Add(replay.Record{Session: "s3", Kind: replay.RecordStart}, at(13))
+	s = m.Snapshot(at(13))
+	if s.Started != 1 || s.Ended != 1 || s.Sessions != 2 || s.InputsPerSec != 0 || s.PiecesPerMin != 0 || s.Spells["freeze"] != 2 {
+		t.Errorf("snapshot after the start aged out = %+v", s)
+	}
+	if s := m.Snapshot(at(30)); s.Sessions != 0 || s.Started != 0 || len(s.Spells) != 0 {
+		t.Errorf("snapshot long after = %+v", s)
+	}
+}
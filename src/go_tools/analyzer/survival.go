@@ -0,0 +1,220 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Survival measures: how long a player lasts, in seconds or pieces locked
+const (
+	SurvivalSeconds = "seconds"
+	SurvivalPieces  = "pieces"
+)
+
+// Survival cohorts sessions can be grouped by
+const (
+	CohortLevel      = "level"
+	CohortDifficulty = "difficulty" // the level's declared difficulty
+	CohortBand       = "band"       // the player's skill band
+	CohortVersion    = "version"    // the game version
+)
+
+// SurvivalSubject is one player session: how long it lasted and whether it
+// ended in a loss; sessions ending otherwise are censored
+type SurvivalSubject struct {
+	Time float64
+	Lost bool
+}
+
+// SurvivalPoint is the curve after the losses at one time
+type SurvivalPoint struct {
+	Time     float64 `json:"time"`
+	AtRisk   int     `json:"atRisk"`
+	Losses   int     `json:"losses"`
+	Survival float64 `json:"survival"`
+	Low      float64 `json:"low"` // 95% Greenwood interval
+	High     float64 `json:"high"`
+}
+
+// SurvivalCurve is a Kaplan-Meier estimate for one cohort
+type SurvivalCurve struct {
+	Group    string          `json:"group"`
+	Subjects int             `json:"subjects"`
+	Losses   int             `json:"losses"`
+	Median   float64         `json:"median"` // first time survival drops to 0.5, -1 when it never does
+	Points   []SurvivalPoint `json:"points"`
+}
+
+// SurvivalReport compares the survival of the cohorts of one grouping
+type SurvivalReport struct {
+	By        string          `json:"by"`
+	Measure   string          `json:"measure"`
+	Curves    []SurvivalCurve `json:"curves"`
+	ChiSquare float64         `json:"chiSquare"` // log-rank statistic across the cohorts
+	PValue    float64         `json:"pValue"`
+}
+
+// KaplanMeier estimates the survival curve of the subjects
+func KaplanMeier(group string, subjects []SurvivalSubject) SurvivalCurve {
+	curve := SurvivalCurve{Group: group, Subjects: len(subjects), Median: -1}
+	sorted := append([]SurvivalSubject(nil), subjects...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time < sorted[j].Time })
+
+	survival, greenwood := 1.0, 0.0
+	atRisk := len(sorted)
+	for i := 0; i < len(sorted); {
+		t := sorted[i].Time
+		losses, leaving := 0, 0
+		for ; i < len(sorted) && sorted[i].Time == t; i++ {
+			leaving++
+			if sorted[i].Lost {
+				losses++
+			}
+		}
+		if losses > 0 {
+			survival *= 1 - float64(losses)/float64(atRisk)
+			if atRisk > losses {
+				greenwood += float64(losses) / float64(atRisk*(atRisk-losses))
+			}
+			half := 1.96 * survival * math.Sqrt(greenwood)
+			curve.Points = append(curve.Points, SurvivalPoint{Time: t, AtRisk: atRisk, Losses: losses,
+				Survival: survival, Low: clamp(survival - half), High: clamp(survival + half)})
+			curve.Losses += losses
+			if curve.Median < 0 && survival <= 0.5 {
+				curve.Median = t
+			}
+		}
+		atRisk -= leaving
+	}
+	return curve
+}
+
+// LogRank tests whether the cohorts share one survival curve, returning
+// the log-rank statistic sum((O-E)^2/E) and its chi-square p-value with
+// one degree of freedom fewer than the cohorts
+func LogRank(groups map[string][]SurvivalSubject) (chiSquare, p float64) {
+	type entry struct {
+		time  float64
+		group string
+		lost  bool
+	}
+	var all []entry
+	atRisk := make(map[string]int)
+	for g, subjects := range groups {
+		for _, s := range subjects {
+			all = append(all, entry{s.Time, g, s.Lost})
+		}
+		atRisk[g] = len(subjects)
+	}
+	if len(groups) < 2 {
+		return 0, 1
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].time < all[j].time })
+	observed := make(map[string]float64)
+	expected := make(map[string]float64)
+	total := len(all)
+	for i := 0; i < len(all); {
+		t := all[i].time
+		losses := 0
+		leaving := make(map[string]int)
+		for ; i < len(all) && all[i].time == t; i++ {
+			leaving[all[i].group]++
+			if all[i].lost {
+				losses++
+				observed[all[i].group]++
+			}
+		}
+		for g, n := range atRisk {
+			expected[g] += float64(losses) * float64(n) / float64(total)
+		}
+		for g, n := range leaving {
+			atRisk[g] -= n
+			total -= n
+		}
+	}
+	for g := range groups {
+		if e := expected[g]; e > 0 {
+			chiSquare += (observed[g] - e) * (observed[g] - e) / e
+		}
+	}
+	return chiSquare, stats.ChiSquareP(chiSquare, len(groups)-1)
+}
+
+// Survival estimates a survival curve per cohort of player sessions and
+// compares them with the log-rank test. A session is a loss when the
+// player topped out; any other ending censors it.
+func (d *Dataset) Survival(by, measure string) (SurvivalReport, error) {
+	report := SurvivalReport{By: by, Measure: measure}
+	if measure != SurvivalSeconds && measure != SurvivalPieces {
+		return report, fmt.Errorf("unknown survival measure %q", measure)
+	}
+	groups := make(map[string][]SurvivalSubject)
+	for _, r := range d.Replays {
+		for _, p := range r.Players {
+			var group string
+			switch by {
+			case CohortLevel:
+				group = r.Level
+			case CohortDifficulty:
+				if lvl := d.Levels[r.Level]; lvl != nil {
+					group = lvl.Difficulty
+				}
+			case CohortBand:
+				group = SkillBand(p.Rating)
+			case CohortVersion:
+				group = r.GameVersion
+			default:
+				return report, fmt.Errorf("unknown survival cohort %q", by)
+			}
+			if group == "" {
+				group = "unknown"
+			}
+			groups[group] = append(groups[group], sessionSurvival(r, p.ID, measure))
+		}
+	}
+	names := make([]string, 0, len(groups))
+	for g := range groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+	for _, g := range names {
+		report.Curves = append(report.Curves, KaplanMeier(g, groups[g]))
+	}
+	report.ChiSquare, report.PValue = LogRank(groups)
+	return report, nil
+}
+
+// sessionSurvival measures how long one player lasted in a session
+func sessionSurvival(r *replay.Replay, player, measure string) SurvivalSubject {
+	var s SurvivalSubject
+	for _, ev := range r.Events {
+		if ev.Player != player {
+			continue
+		}
+		switch ev.Type {
+		case replay.EventLock:
+			if !s.Lost && measure == SurvivalPieces {
+				s.Time++
+			}
+		case replay.EventTopOut:
+			if !s.Lost && measure == SurvivalSeconds {
+				s.Time = float64(ev.TimeMs) / 1000
+			}
+			s.Lost = true
+		}
+	}
+	if len(r.Players) == 1 && r.Result.Outcome == replay.OutcomeTopOut && !s.Lost {
+		s.Lost = true
+		if measure == SurvivalSeconds {
+			s.Time = float64(r.Result.DurationMs) / 1000
+		}
+	}
+	if !s.Lost && measure == SurvivalSeconds {
+		s.Time = float64(r.Result.DurationMs) / 1000
+	}
+	return s
+}
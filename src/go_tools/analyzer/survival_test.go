@@ -0,0 +1,37 @@
+package analyzer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestKaplanMeier(t *testing.T) {
+	// losses at 1, 3 and 4; censored at 2 and 5
+	c := KaplanMeier("g", []SurvivalSubject{{1, true}, {2, false}, {3, true}, {4, true}, {5, false}})
+	want := []float64{0.8, 0.8 * 2 / 3, 0.8 * 2 / 3 * 0.5}
+	if len(c.Points) != len(want) {
+		t.Fatalf("points = %+v", c.Points)
+	}
+	for i, w := range want {
+		if math.Abs(c.Points[i].Survival-w) > 1e-9 {
+			t.Errorf("S(%v) = %v, want %v", c.Points[i].Time, c.Points[i].Survival, w)
+		}
+	}
+	if c.Median != 4 || c.Losses != 3 {
+		t.Errorf("median %v losses %d, want 4 and 3", c.Median, c.Losses)
+	}
+}
+
+func TestLogRankSeparatesCohorts(t *testing.T) {
+	var early, late []SurvivalSubject
+	for i := 0; i < 30; i++ {
+		early = append(early, SurvivalSubject{Time: float64(10 + i), Lost: true})
+		late = append(late, SurvivalSubject{Time: float64(40 + i), Lost: i%3 != 0})
+	}
+	if _, p := LogRank(map[string][]SurvivalSubject{"a": early, "b": late}); p > 0.001 {
+		t.Errorf("p = %v for clearly different cohorts", p)
+	}
+	if _, p := LogRank(map[string][]SurvivalSubject{"a": early, "b": early}); p < 0.5 {
+		t.Errorf("p = %v for identical cohorts", p)
+	}
+}
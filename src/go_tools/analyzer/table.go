@@ -0,0 +1,152 @@
+package analyzer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Column kinds
+const (
+	KindString = "string"
+	KindInt    = "int"
+	KindFloat  = "float"
+	KindBool   = "bool"
+)
+
+// Export formats
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// Column is a named, typed column of a Table
+type Column struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// Table is a flat analysis result ready for export; each row holds one
+// value per column, of type string, int, float64 or bool to match the
+// column's kind
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []Column `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// NewTable returns an empty table with the given columns, written as
+// "name:kind" pairs
+func NewTable(name string, columns ...string) *Table {
+	t := &Table{Name: name}
+	for _, c := range columns {
+		col := Column{Name: c, Kind: KindString}
+		for i := len(c) - 1; i >= 0; i-- {
+			if c[i] == ':' {
+				col = Column{Name: c[:i], Kind: c[i+1:]}
+				break
+			}
+		}
+		t.Columns = append(t.Columns, col)
+	}
+	return t
+}
+
+// Add appends a row
+func (t *Table) Add(values ...any) {
+	t.Rows = append(t.Rows, values)
+}
+
+// validate checks every row against the columns
+func (t *Table) validate() error {
+	for i, row := range t.Rows {
+		if len(row) != len(t.Columns) {
+			return fmt.Errorf("table %s: row %d has %d values, want %d", t.Name, i, len(row), len(t.Columns))
+		}
+		for j, v := range row {
+			var ok bool
+			switch t.Columns[j].Kind {
+			case KindString:
+				_, ok = v.(string)
+			case KindInt:
+				_, ok = v.(int)
+			case KindFloat:
+				_, ok = v.(float64)
+			case KindBool:
+				_, ok = v.(bool)
+			}
+			if !ok {
+				return fmt.Errorf("table %s: row %d column %s: %T is not %s", t.Name, i, t.Columns[j].Name, v, t.Columns[j].Kind)
+			}
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the table with a header row
+func (t *Table) WriteCSV(w io.Writer) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	header := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		header[i] = c.Name
+	}
+	cw.Write(header)
+	record := make([]string, len(t.Columns))
+	for _, row := range t.Rows {
+		for i, v := range row {
+			record[i] = formatValue(v)
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatValue renders a cell as text
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// Export writes the table to dir as <name>.<format> for each format
+func (t *Table) Export(dir string, formats []string) error {
+	for _, format := range formats {
+		var write func(io.Writer) error
+		switch format {
+		case FormatCSV:
+			write = t.WriteCSV
+		case FormatParquet:
+			write = t.WriteParquet
+		default:
+			return fmt.Errorf("unknown export format %q", format)
+		}
+		path := filepath.Join(dir, t.Name+"."+format)
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := write(f); err != nil {
+			f.Close()
+			return fmt.Errorf("export %s: %w", path, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
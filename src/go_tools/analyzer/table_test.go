@@ -0,0 +1,204 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"testing"
+)
+
+func sampleTable() *Table {
+	t := NewTable("sample", "name", "n:int", "x:float", "ok:bool")
+	t.Add("a", 1, 0.5, true)
+	t.Add("b,c", 2, 1.25, false)
+	return t
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleTable().WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "name,n,x,ok\na,1,0.5,true\n\"b,c\",2,1.25,false\n"
+	if buf.String() != want {
+		t.Errorf("csv = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteParquetFraming(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sampleTable().WriteParquet(&buf); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if !bytes.HasPrefix(b, parquetMagic) || !bytes.HasSuffix(b, parquetMagic) {
+		t.Fatal("missing PAR1 magic")
+	}
+	footer := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	if footer <= 0 || footer > len(b)-12 {
+		t.Fatalf("footer length %d out of range for %d byte file", footer, len(b))
+	}
+
+	// the footer's FileMetaData: version, schema and row count
+	r := &thriftReader{data: b[len(b)-8-footer : len(b)-8]}
+	meta := r.read()
+	if r.err != nil || r.pos != footer {
+		t.Fatalf("footer decodes to %d of %d bytes: %v", r.pos, footer, r.err)
+	}
+	if meta[1] != int64(1) || meta[3] != int64(2) {
+		t.Errorf("version %v, rows %v", meta[1], meta[3])
+	}
+	schema := meta[2].([]any)
+	if root := schema[0].(map[int16]any); string(root[4].([]byte)) != "schema" || root[5] != int64(4) {
+		t.Errorf("schema root = %v", root)
+	}
+	want := []struct {
+		name string
+		typ  int64
+	}{{"name", parquetByteArray}, {"n", parquetInt64}, {"x", parquetDouble}, {"ok", parquetBoolean}}
+	if len(schema) != len(want)+1 {
+		t.Fatalf("schema has %d elements", len(schema))
+	}
+	for i, w := range want {
+		el := schema[i+1].(map[int16]any)
+		if string(el[4].([]byte)) != w.name || el[1] != w.typ || el[3] != int64(parquetRequired) {
+			t.Errorf("schema element %d = %v, want %s of type %d", i+1, el, w.name, w.typ)
+		}
+	}
+
+	// a column's page read back from the chunk's offset
+	group := meta[4].([]any)[0].(map[int16]any)
+	if group[3] != int64(2) {
+		t.Errorf("row group rows = %v", group[3])
+	}
+	for j, decode := range map[int]func([]byte) []any{
+		0: func(v []byte) []any {
+			var out []any
+			for len(v) >= 4 {
+				n := binary.LittleEndian.Uint32(v)
+				out, v = append(out, string(v[4:4+n])), v[4+n:]
+			}
+			return out
+		},
+		1: func(v []byte) []any {
+			return []any{int(binary.LittleEndian.Uint64(v)), int(binary.LittleEndian.Uint64(v[8:]))}
+		},
+		2: func(v []byte) []any {
+			return []any{math.Float64frombits(binary.LittleEndian.Uint64(v)), math.Float64frombits(binary.LittleEndian.Uint64(v[8:]))}
+		},
+		3: func(v []byte) []any { return []any{v[0]&1 != 0, v[0]&2 != 0} },
+	} {
+		chunk := group[1].([]any)[j].(map[int16]any)[3].(map[int16]any)
+		offset := int(chunk[9].(int64))
+		page := &thriftReader{data: b[offset:]}
+		header := page.read()
+		if page.err != nil || header[1] != int64(parquetDataPage) {
+			t.Fatalf("column %d page header %v: %v", j, header, page.err)
+		}
+		if int64(page.pos)+header[3].(int64) != chunk[6].(int64) {
+			t.Errorf("column %d: a %d byte header and %v of values in a %v byte chunk", j, page.pos, header[3], chunk[6])
+		}
+		if rows := header[5].(map[int16]any)[1]; rows != int64(2) {
+			t.Errorf("column %d page has %v values", j, rows)
+		}
+		values := b[offset+page.pos : offset+page.pos+int(header[3].(int64))]
+		got := decode(values)
+		for i, row := range sampleTable().Rows {
+			if got[i] != row[j] {
+				t.Errorf("column %d row %d = %v, want %v", j, i, got[i], row[j])
+			}
+		}
+	}
+}
+
+// thriftReader decodes Thrift compact protocol structs, enough to read
+// back what WriteParquet writes: a struct is a map by field id, an
+// integer an int64, a binary a []byte and a list a []any
+type thriftReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *thriftReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	r.pos++
+	return r.data[r.pos-1]
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.data[min(r.pos, len(r.data)):])
+	if n <= 0 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		if r.pos+n > len(r.data) {
+			r.err = io.ErrUnexpectedEOF
+			return nil
+		}
+		r.pos += n
+		return r.data[r.pos-n : r.pos]
+	case thriftList:
+		head := r.byte()
+		n := int(head >> 4)
+		if n == 15 {
+			n = int(r.varint())
+		}
+		list := make([]any, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			list = append(list, r.value(head&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return r.read()
+	}
+	r.err = fmt.Errorf("thrift type %d at %d", typ, r.pos)
+	return nil
+}
+
+// read decodes a struct
+func (r *thriftReader) read() map[int16]any {
+	out := map[int16]any{}
+	var id int16
+	for r.err == nil {
+		head := r.byte()
+		if head == 0 {
+			break
+		}
+		if d := int16(head >> 4); d != 0 {
+			id += d
+		} else {
+			id = int16(r.zigzag())
+		}
+		out[id] = r.value(head & 0x0f)
+	}
+	return out
+}
+
+func TestTableRejectsMistypedValues(t *testing.T) {
+	tbl := NewTable("bad", "n:int")
+	tbl.Add(1.5)
+	if err := tbl.WriteCSV(&bytes.Buffer{}); err == nil {
+		t.Error("float accepted in int column")
+	}
+}
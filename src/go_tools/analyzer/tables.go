@@ -0,0 +1,316 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rating"
+)
+
+// DifficultyTable lists difficulty reports, one row per level
+func DifficultyTable(reports []DifficultyReport) *Table {
+	t := NewTable("difficulty", "level", "terrain_complexity:float", "roughness:float", "entropy:float",
+		"dependency_depth:int", "holes:int", "hole_ratio:float", "pickup_accessibility:float", "simulated_pieces:int",
+		"simulated_lines:int", "topped_out:bool", "clear_rate:float", "score:float")
+	for _, r := range reports {
+		c := r.Complexity
+		t.Add(r.Level, r.TerrainComplexity, c.Roughness, c.Entropy, c.DependencyDepth, r.Holes, r.HoleRatio,
+			r.PickupAccessibility, r.Simulation.Pieces, r.Simulation.Lines, r.Simulation.ToppedOut, r.ClearRate, r.Score)
+	}
+	return t
+}
+
+// SolvabilityTable lists solver results, one row per level
+func SolvabilityTable(results []Solvability) *Table {
+	t := NewTable("solvability", "level", "status", "reason", "witness_pieces:int", "nodes:int")
+	for _, r := range results {
+		t.Add(r.Level, r.Status, r.Reason, len(r.Witness), r.Nodes)
+	}
+	return t
+}
+
+// RegressionTable lists balance regressions, largest change first
+func RegressionTable(regressions []Regression) *Table {
+	t := NewTable("regressions", "metric", "subject", "baseline", "candidate", "baseline_rate:float",
+		"candidate_rate:float", "baseline_trials:int", "candidate_trials:int", "delta:float", "p_value:float", "adjusted_p_value:float")
+	for _, r := range regressions {
+		t.Add(r.Metric, r.Subject, r.Baseline, r.Candidate, r.BaselineRate, r.CandidateRate,
+			r.BaselineTrials, r.CandidateTrials, r.Delta, r.PValue, r.Adjusted)
+	}
+	return t
+}
+
+// PatternTable lists mined block patterns with their first example
+func PatternTable(patterns []BlockPattern) *Table {
+	t := NewTable("patterns", "pattern", "occurrences:int", "levels:int", "example_level", "example_x:int", "example_y:int")
+	for _, p := range patterns {
+		var ex PatternLocation
+		if len(p.Examples) > 0 {
+			ex = p.Examples[0]
+		}
+		t.Add(p.Pattern, p.Occurrences, p.Levels, ex.Level, ex.X, ex.Y)
+	}
+	return t
+}
+
+// HeatmapTable lists every non-zero cell of the heatmaps
+func HeatmapTable(maps []*Heatmap) *Table {
+	t := NewTable("heatmaps", "level", "kind", "x:int", "y:int", "count:float")
+	for _, h := range maps {
+		for y, row := range h.Counts {
+			for x, c := range row {
+				if c != 0 {
+					t.Add(h.Level, h.Kind, x, y, c)
+				}
+			}
+		}
+	}
+	return t
+}
+
+// WinRateTable lists the balance report's win rates, one row per group
+func WinRateTable(report BalanceReport) *Table {
+	t := NewTable("win_rates", "group", "key", "games:int", "wins:int", "rate:float")
+	for _, g := range []struct {
+		name  string
+		rates []WinRate
+	}{{"spell", report.Spells}, {"special_block", report.SpecialBlocks}, {"level", report.Levels}} {
+		for _, r := range g.rates {
+			t.Add(g.name, r.Key, r.Games, r.Wins, r.Rate)
+		}
+	}
+	f := report.FirstPlayer
+	t.Add("first_player", f.Key, f.Games, f.Wins, f.Rate)
+	return t
+}
+
+// SpellUsageTable lists per-spell usage
+func SpellUsageTable(usage []SpellUsage) *Table {
+	t := NewTable("spell_usage", "spell", "casts:int", "pick_rate:float", "mean_cast_sec:float",
+		"caster_win_rate:float", "win_rate_delta:float", "top_target")
+	for _, u := range usage {
+		t.Add(u.Spell, u.Casts, u.PickRate, u.MeanCastSec, u.CasterWins, u.WinRateDelta, u.TopTarget)
+	}
+	return t
+}
+
+// FunnelTable lists funnel steps, one row per version and step
+func FunnelTable(funnels []Funnel) *Table {
+	t := NewTable("funnels", "version", "step", "players:int", "conversion:float", "drop_off:float", "overall:float")
+	for _, f := range funnels {
+		for _, s := range f.Steps {
+			t.Add(f.Version, s.Step, s.Players, s.Conversion, s.DropOff, s.Overall)
+		}
+	}
+	return t
+}
+
+// RetentionTable lists retention cohorts, with eligible, retained and rate
+// columns for each of RetentionDays
+func RetentionTable(cohorts []RetentionCohort) *Table {
+	columns := []string{"cohort", "by", "group", "installs:int"}
+	for _, day := range RetentionDays {
+		columns = append(columns, fmt.Sprintf("d%d_eligible:int", day), fmt.Sprintf("d%d_retained:int", day), fmt.Sprintf("d%d_rate:float", day))
+	}
+	t := NewTable("retention", columns...)
+	for _, c := range cohorts {
+		row := []any{c.Cohort, c.By, c.Group, c.Installs}
+		for _, d := range c.Days {
+			row = append(row, d.Eligible, d.Retained, d.Rate)
+		}
+		t.Add(row...)
+	}
+	return t
+}
+
+// FairnessTable lists per-piece counts and droughts of a fairness report
+func FairnessTable(report FairnessReport) *Table {
+	t := NewTable("fairness", "randomizer", "piece", "count:int", "max_drought:int")
+	pieces := make([]string, 0, len(report.Counts))
+	for p := range report.MaxDrought {
+		pieces = append(pieces, p)
+	}
+	sort.Strings(pieces)
+	for _, p := range pieces {
+		t.Add(report.Randomizer, p, report.Counts[p], report.MaxDrought[p])
+	}
+	return t
+}
+
+// SuspicionTable lists screened players with their evidence kinds
+func SuspicionTable(suspicions []Suspicion) *Table {
+	t := NewTable("suspicions", "session", "player", "score:float", "findings:int", "evidence")
+	for _, s := range suspicions {
+		details := make([]string, len(s.Evidence))
+		for i, e := range s.Evidence {
+			details[i] = e.Kind + ": " + e.Detail
+		}
+		t.Add(s.Session, s.Player, s.Score, s.Findings, strings.Join(details, "; "))
+	}
+	return t
+}
+
+// ComparisonTable lists per-metric pack deltas
+func ComparisonTable(cmp PackComparison) *Table {
+	t := NewTable("pack_comparison", "metric", "mean_a:float", "mean_b:float", "delta:float",
+		"relative_diff:float", "p_value:float", "significance")
+	for _, m := range cmp.Metrics {
+		t.Add(m.Metric, m.MeanA, m.MeanB, m.Delta, m.RelativeDiff, m.PValue, m.Significance)
+	}
+	return t
+}
+
+// RatingTable lists the ledger's leaderboard
+func RatingTable(ledger *rating.Ledger) *Table {
+	t := NewTable("ratings", "player", "rating:float", "deviation:float", "volatility:float", "games:int")
+	for _, s := range ledger.Leaderboard() {
+		t.Add(s.Player, s.Rating.Value, s.Rating.Deviation, s.Rating.Volatility, s.Rating.Games)
+	}
+	return t
+}
+
+// MatchmakingTable lists a matchmaking report's gap buckets
+func MatchmakingTable(r rating.MatchmakingReport) *Table {
+	t := NewTable("matchmaking", "gap_low:float", "gap_high:float", "matches:int", "mean_queue_ms:float",
+		"expected:float", "favorite_win:float", "blowout_rate:float")
+	for _, b := range r.Buckets {
+		t.Add(b.Low, b.High, b.Matches, b.MeanQueueMs, b.Expected, b.FavoriteWin, b.BlowoutRate)
+	}
+	return t
+}
+
+// ExperimentTable lists every arm metric of the experiment reports
+func ExperimentTable(reports []ExperimentReport) *Table {
+	t := NewTable("experiments", "experiment", "arm", "metric", "sessions:int", "value:float", "ci_low:float",
+		"ci_high:float", "lift:float", "p_value:float", "adjusted_p_value:float", "winner:bool")
+	for _, r := range reports {
+		for _, a := range r.Arms {
+			for _, m := range a.Metrics {
+				t.Add(r.Experiment, a.Arm, m.Metric, a.Sessions, m.Value, m.Low, m.High, m.Lift, m.PValue, m.Adjusted, a.Arm == r.Winner)
+			}
+		}
+	}
+	return t
+}
+
+// TechniqueTable lists technique counts and rates per skill band
+func TechniqueTable(stats []TechniqueStats) *Table {
+	t := NewTable("techniques", "band", "sessions:int", "pieces:int", "singles:int", "doubles:int", "triples:int",
+		"tetrises:int", "t_spins:int", "t_spin_minis:int", "t_spin_clears:int", "combos:int", "max_combo:int",
+		"back_to_backs:int", "perfect_clears:int", "t_spins_per_100:float", "tetrises_per_100:float")
+	for _, s := range stats {
+		t.Add(s.Band, s.Sessions, s.Pieces, s.Clears[1], s.Clears[2], s.Clears[3], s.Tetrises, s.TSpins,
+			s.TSpinMinis, s.TSpinClears, s.Combos, s.MaxCombo, s.BackToBacks, s.PerfectClears,
+			s.Per100(s.TSpins+s.TSpinMinis), s.Per100(s.Tetrises))
+	}
+	return t
+}
+
+// FinesseTable lists every player's inputs against optimal finesse and
+// their misdrops
+func FinesseTable(stats []FinesseStats) *Table {
+	t := NewTable("finesse", "player", "name", "sessions:int", "pieces:int", "inputs:int", "optimal:int",
+		"wasted:int", "faults:int", "misdrops:int", "skipped:int", "wasted_per_piece:float", "fault_rate:float",
+		"misdrop_rate:float")
+	for _, s := range stats {
+		t.Add(s.Player, s.Name, s.Sessions, s.Pieces, s.Inputs, s.Optimal, s.Wasted, s.Faults, s.Misdrops,
+			s.Skipped, s.WastedPerPiece(), s.FaultRate(), s.MisdropRate())
+	}
+	return t
+}
+
+// ComplexityTable lists per-level board complexity in play
+func ComplexityTable(profiles []ComplexityProfile) *Table {
+	t := NewTable("board_complexity", "level", "start_entropy:float", "start_dependency_depth:int", "frames:int",
+		"mean_terrain:float", "peak_terrain:float", "mean_entropy:float", "mean_holes:float", "max_depth:int")
+	for _, p := range profiles {
+		t.Add(p.Level, p.Start.Entropy, p.Start.DependencyDepth, p.Frames, p.MeanTerrain, p.PeakTerrain,
+			p.MeanEntropy, p.MeanHoles, p.MaxDepth)
+	}
+	return t
+}
+
+// ChokePointTable lists every level's choke regions and moments
+func ChokePointTable(levels []LevelChokePoints) *Table {
+	t := NewTable("choke_points", "level", "kind", "x:int", "y:int", "width:int", "height:int", "from_sec:int",
+		"to_sec:int", "top_outs:int", "control_losses:int", "rate:float")
+	for _, lc := range levels {
+		for _, g := range []struct {
+			kind   string
+			points []ChokePoint
+		}{{"region", lc.Regions}, {"moment", lc.Moments}} {
+			for _, cp := range g.points {
+				t.Add(lc.Level, g.kind, cp.X, cp.Y, cp.Width, cp.Height, cp.FromSec, cp.ToSec, cp.TopOuts,
+					cp.ControlLosses, cp.Rate)
+			}
+		}
+	}
+	return t
+}
+
+// SurvivalTable lists the points of every survival curve
+func SurvivalTable(reports []SurvivalReport) *Table {
+	t := NewTable("survival", "by", "measure", "group", "time:float", "at_risk:int", "losses:int",
+		"survival:float", "ci_low:float", "ci_high:float")
+	for _, r := range reports {
+		for _, c := range r.Curves {
+			for _, p := range c.Points {
+				t.Add(r.By, r.Measure, c.Group, p.Time, p.AtRisk, p.Losses, p.Survival, p.Low, p.High)
+			}
+		}
+	}
+	return t
+}
+
+// PlaystyleTables is the playstyle clusters with their mean features, and
+// their share of the players in each period
+func PlaystyleTables(r PlaystyleReport) (styles, shares *Table) {
+	cols := []string{"style:int", "label", "players:int", "share:float"}
+	for _, f := range PlaystyleFeatures {
+		cols = append(cols, f+":float")
+	}
+	styles = NewTable("playstyles", cols...)
+	for i, s := range r.Styles {
+		row := []any{i, s.Label, len(s.Players), s.Share}
+		for _, v := range s.Centroid {
+			row = append(row, v)
+		}
+		styles.Add(row...)
+	}
+	shares = NewTable("playstyle_shares", "period", "players:int", "style:int", "label", "share:float")
+	for _, p := range r.Periods {
+		for i, share := range p.Shares {
+			shares.Add(p.Period, p.Players, i, r.Styles[i].Label, share)
+		}
+	}
+	return styles, shares
+}
+
+// DatasetTables are the tables the servers serve: the difficulty of
+// levels, the dataset's AnalyzeLevels, then with replays their balance,
+// spells, techniques, finesse, complexity and survival, then every pass's
+func DatasetTables(ctx context.Context, d *Dataset, levels []DifficultyReport, fallback level.GridSize) ([]*Table, error) {
+	tables := []*Table{DifficultyTable(levels)}
+	if len(d.Replays) > 0 {
+		balance := AnalyzeGameBalance(d.Replays)
+		survival, err := d.Survival(CohortLevel, SurvivalSeconds)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables,
+			WinRateTable(balance),
+			SpellUsageTable(balance.SpellUsage),
+			TechniqueTable(d.AnalyzeTechniques(fallback)),
+			FinesseTable(d.AnalyzeFinesse(fallback)),
+			ComplexityTable(d.ComplexityProfiles(fallback)),
+			SurvivalTable([]SurvivalReport{survival}))
+	}
+	passes, _, err := RunPasses(PassInputs{Data: d, Context: ctx}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(tables, passes...), nil
+}
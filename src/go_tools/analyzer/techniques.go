@@ -0,0 +1,232 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Skill bands by player rating; players without a rating are unrated
+const (
+	BandUnrated      = "unrated"
+	BandNovice       = "novice"       // below 1200
+	BandIntermediate = "intermediate" // 1200 to 1500
+	BandAdvanced     = "advanced"     // 1500 to 1800
+	BandExpert       = "expert"       // 1800 and up
+)
+
+// SkillBands lists the bands in report order
+var SkillBands = []string{BandNovice, BandIntermediate, BandAdvanced, BandExpert, BandUnrated}
+
+// SkillBand returns the band for a rating
+func SkillBand(rating float64) string {
+	switch {
+	case rating <= 0:
+		return BandUnrated
+	case rating < 1200:
+		return BandNovice
+	case rating < 1500:
+		return BandIntermediate
+	case rating < 1800:
+		return BandAdvanced
+	}
+	return BandExpert
+}
+
+// TechniqueStats counts advanced techniques over a set of player sessions
+type TechniqueStats struct {
+	Band          string      `json:"band"`
+	Sessions      int         `json:"sessions"` // player sessions, one per player per replay
+	Pieces        int         `json:"pieces"`
+	Clears        map[int]int `json:"clears"` // locks clearing 1, 2, 3 or 4 lines
+	TSpins        int         `json:"tSpins"`
+	TSpinMinis    int         `json:"tSpinMinis"`
+	TSpinClears   int         `json:"tSpinClears"` // T-spins, mini or full, that cleared lines
+	Tetrises      int         `json:"tetrises"`
+	Combos        int         `json:"combos"` // clearing locks right after another clearing lock
+	MaxCombo      int         `json:"maxCombo"`
+	BackToBacks   int         `json:"backToBacks"` // difficult clears following a difficult clear
+	PerfectClears int         `json:"perfectClears"`
+	Skipped       int         `json:"skipped"` // locks that could not be replayed onto the board
+}
+
+// Per100 returns n per 100 pieces locked
+func (s TechniqueStats) Per100(n int) float64 {
+	if s.Pieces == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(s.Pieces)
+}
+
+func (s *TechniqueStats) merge(o TechniqueStats) {
+	s.Sessions += o.Sessions
+	s.Pieces += o.Pieces
+	for lines, n := range o.Clears {
+		s.Clears[lines] += n
+	}
+	s.TSpins += o.TSpins
+	s.TSpinMinis += o.TSpinMinis
+	s.TSpinClears += o.TSpinClears
+	s.Tetrises += o.Tetrises
+	s.Combos += o.Combos
+	if o.MaxCombo > s.MaxCombo {
+		s.MaxCombo = o.MaxCombo
+	}
+	s.BackToBacks += o.BackToBacks
+	s.PerfectClears += o.PerfectClears
+	s.Skipped += o.Skipped
+}
+
+// AnalyzeTechniques replays every lock onto a reconstructed board and
+// reports technique frequencies per skill band, in SkillBands order.
+// Boards start from the level's blocks when the level is loaded and empty
+// otherwise.
+func (d *Dataset) AnalyzeTechniques(fallback level.GridSize) []TechniqueStats {
+	bands := make(map[string]*TechniqueStats)
+	for _, r := range d.Replays {
+		byPlayer := d.replayTechniques(r, fallback)
+		for _, p := range r.Players {
+			stats := byPlayer[p.ID]
+			band := SkillBand(p.Rating)
+			if bands[band] == nil {
+				bands[band] = &TechniqueStats{Band: band, Clears: make(map[int]int)}
+			}
+			bands[band].merge(stats)
+		}
+	}
+	var out []TechniqueStats
+	for _, band := range SkillBands {
+		if s := bands[band]; s != nil {
+			out = append(out, *s)
+		}
+	}
+	return out
+}
+
+// replayTechniques detects every player's techniques in a replay, keyed by
+// player
+func (d *Dataset) replayTechniques(r *replay.Replay, fallback level.GridSize) map[string]TechniqueStats {
+	return cached(d.Cache, "techniques", func() map[string]TechniqueStats {
+		out := make(map[string]TechniqueStats, len(r.Players))
+		for _, p := range r.Players {
+			out[p.ID] = replayTechniques(r, p.ID, d.startBoard(r, fallback))
+		}
+		return out
+	}, d.replayKey(r, fallback)...)
+}
+
+// replayTechniques detects one player's techniques in a replay, locking
+// each piece onto b. A lock is a T-spin when the T's last move was a
+// rotation and three of the corners around its center are filled, and a
+// mini when only one of those is in front of the T.
+func replayTechniques(r *replay.Replay, player string, b board) TechniqueStats {
+	stats := TechniqueStats{Sessions: 1, Clears: make(map[int]int)}
+	if len(b) == 0 || len(b[0]) == 0 {
+		return stats
+	}
+	var inputs []replay.Input
+	for _, in := range r.Inputs {
+		if in.Player == player {
+			inputs = append(inputs, in)
+		}
+	}
+	sort.SliceStable(inputs, func(i, j int) bool { return inputs[i].Frame < inputs[j].Frame })
+
+	next, combo := 0, -1
+	lastDifficult := false
+	for _, ev := range r.Events {
+		if ev.Type != replay.EventLock || ev.Player != player {
+			continue
+		}
+		lastMove := ""
+		for ; next < len(inputs) && inputs[next].Frame <= ev.Frame; next++ {
+			switch inputs[next].Action {
+			case replay.ActionLeft, replay.ActionRight, replay.ActionSoftDrop, replay.ActionRotateCW, replay.ActionRotateCCW:
+				lastMove = inputs[next].Action
+			}
+		}
+		cells, ok := pieces.Cells(ev.Piece, ev.Rotation)
+		if !ok || !b.fits(cells, ev.X, ev.Y) {
+			stats.Skipped++
+			continue
+		}
+		stats.Pieces++
+
+		spin, mini := false, false
+		if ev.Piece == "T" && (lastMove == replay.ActionRotateCW || lastMove == replay.ActionRotateCCW) {
+			spin, mini = b.tSpin(ev.X, ev.Y, ev.Rotation)
+		}
+		lines := b.place(cells, ev.X, ev.Y)
+		switch {
+		case spin && mini:
+			stats.TSpinMinis++
+		case spin:
+			stats.TSpins++
+		}
+		if lines == 0 {
+			combo = -1
+			continue
+		}
+		stats.Clears[lines]++
+		if spin {
+			stats.TSpinClears++
+		}
+		if lines == 4 {
+			stats.Tetrises++
+		}
+		if combo++; combo > 0 {
+			stats.Combos++
+			if combo > stats.MaxCombo {
+				stats.MaxCombo = combo
+			}
+		}
+		difficult := lines == 4 || spin
+		if difficult && lastDifficult {
+			stats.BackToBacks++
+		}
+		lastDifficult = difficult
+		if b.empty() {
+			stats.PerfectClears++
+		}
+	}
+	return stats
+}
+
+// tSpin checks the corners around the center of a T locked with its
+// bounding box at (x, y); cells off the board count as filled
+func (b board) tSpin(x, y, rotation int) (spin, mini bool) {
+	filled := func(cx, cy int) bool {
+		return cx < 0 || cy < 0 || cy >= len(b) || cx >= len(b[0]) || b[cy][cx]
+	}
+	// corners in clockwise order from top-left; the T points up in rotation
+	// 0, so its front corners are the first two, shifting by one per turn
+	corners := [4][2]int{{x, y}, {x + 2, y}, {x + 2, y + 2}, {x, y + 2}}
+	rot := ((rotation % 4) + 4) % 4
+	count, front := 0, 0
+	for i, c := range corners {
+		if !filled(c[0], c[1]) {
+			continue
+		}
+		count++
+		if i == rot || i == (rot+1)%4 {
+			front++
+		}
+	}
+	if count < 3 {
+		return false, false
+	}
+	return true, front < 2
+}
+
+func (b board) empty() bool {
+	for _, row := range b {
+		for _, filled := range row {
+			if filled {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// boardFrom builds a board from rows of '#' (filled) and '.' (empty)
+func boardFrom(rows ...string) board {
+	b := make(board, len(rows))
+	for y, row := range rows {
+		b[y] = make([]bool, len(row))
+		for x, c := range row {
+			b[y][x] = c == '#'
+		}
+	}
+	return b
+}
+
+func TestReplayTechniquesTSpinDouble(t *testing.T) {
+	b := boardFrom(
+		"..........",
+		"..........",
+		"...#......",
+		"###...####",
+		"####.#####",
+	)
+	r := &replay.Replay{
+		Inputs: []replay.Input{
+			{Frame: 10, Player: "p", Action: replay.ActionLeft},
+			{Frame: 20, Player: "p", Action: replay.ActionRotateCW},
+			{Frame: 21, Player: "p", Action: replay.ActionHardDrop},
+		},
+		Events: []replay.Event{{Frame: 21, Type: replay.EventLock, Player: "p", Piece: "T", X: 3, Y: 2, Rotation: 2}},
+	}
+	s := replayTechniques(r, "p", b)
+	if s.TSpins != 1 || s.TSpinMinis != 0 || s.TSpinClears != 1 || s.Clears[2] != 1 {
+		t.Errorf("stats = %+v, want one full T-spin double", s)
+	}
+
+	// the same lock after a sideways move is a plain double
+	r.Inputs[1].Action = replay.ActionRight
+	b = boardFrom("..........", "..........", "...#......", "###...####", "####.#####")
+	if s := replayTechniques(r, "p", b); s.TSpins != 0 || s.Clears[2] != 1 {
+		t.Errorf("stats = %+v, want a double without spin", s)
+	}
+}
+
+func TestReplayTechniquesTetrisPerfectClearAndCombo(t *testing.T) {
+	b := boardFrom(
+		".#",
+		".#",
+		".#",
+		".#",
+	)
+	r := &replay.Replay{Events: []replay.Event{
+		{Frame: 1, Type: replay.EventLock, Player: "p", Piece: "I", X: -2, Y: 0, Rotation: 1},
+		{Frame: 2, Type: replay.EventLock, Player: "p", Piece: "O", X: 0, Y: 2},
+	}}
+	s := replayTechniques(r, "p", b)
+	if s.Tetrises != 1 || s.PerfectClears != 2 || s.Clears[2] != 1 || s.Combos != 1 || s.MaxCombo != 1 {
+		t.Errorf("stats = %+v, want a tetris and a combo double, both perfect clears", s)
+	}
+}
@@ -0,0 +1,229 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Reasons a move is rejected
+const (
+	RejectPlayer      = "player"      // not a player of the game
+	RejectOrder       = "order"       // at an earlier frame than the player's last move
+	RejectOver        = "over"        // after the player topped out
+	RejectUnknown     = "unknown"     // a piece or rotation that doesn't exist
+	RejectWrongPiece  = "wrong_piece" // not the next piece dealt
+	RejectCollision   = "collision"   // overlapping the board's blocks or leaving it
+	RejectFloating    = "floating"    // locked with room below to fall
+	RejectUnreachable = "unreachable" // no way there from a spawn point
+	RejectLines       = "lines"       // claiming clears the board doesn't make
+)
+
+// ValidateOptions tune a Game's checks
+type ValidateOptions struct {
+	// AllowUnreachable accepts locks no sequence of moves gets to from a
+	// spawn point; the check knows no wall kicks, so a game with them
+	// sets this to keep kicked pieces from being rejected
+	AllowUnreachable bool
+}
+
+// Rejection is why a submitted move is impossible
+type Rejection struct {
+	Reason string `json:"reason"`
+	Player string `json:"player"`
+	Frame  int    `json:"frame"`
+	TimeMs int64  `json:"timeMs"`
+	Type   string `json:"type"` // of the event rejected
+	Detail string `json:"detail"`
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("%s at frame %d: %s: %s", r.Player, r.Frame, r.Reason, r.Detail)
+}
+
+// Game is the server's copy of a session's boards: each move a client
+// submits is re-simulated against it, applied when possible and rejected,
+// leaving the boards as they were, when not
+type Game struct {
+	opts    ValidateOptions
+	spawns  []level.Point
+	deal    []string // pieces dealt each player, in order; past its end any piece goes
+	players map[string]*gamePlayer
+}
+
+// gamePlayer is one player's side of a game
+type gamePlayer struct {
+	b      board
+	locks  int
+	frame  int
+	lines  int // cleared by the last lock, for the clear event that reports them
+	topOut bool
+}
+
+// NewGame starts a game of the level for the players, each on their own
+// copy of its board, dealt the level's pieces
+func NewGame(lvl *level.Level, players []string, opts ValidateOptions) (*Game, error) {
+	return newGame(board(lvl.Occupancy()), lvl.SpawnPoints, dealtPieces(lvl, 1<<16), players, opts)
+}
+
+// NewReplayGame starts a game of the replay's session: on its level when
+// the dataset holds it, otherwise an empty board of the fallback size,
+// dealt the replay's pieces
+func (d *Dataset) NewReplayGame(r *replay.Replay, fallback level.GridSize, opts ValidateOptions) (*Game, error) {
+	var spawns []level.Point
+	if lvl := d.Levels[r.Level]; lvl != nil {
+		spawns = lvl.SpawnPoints
+	}
+	players := make([]string, len(r.Players))
+	for i, p := range r.Players {
+		players[i] = p.ID
+	}
+	return newGame(d.startBoard(r, fallback), spawns, r.Pieces, players, opts)
+}
+
+func newGame(start board, spawns []level.Point, deal, players []string, opts ValidateOptions) (*Game, error) {
+	if len(players) == 0 {
+		return nil, fmt.Errorf("game has no players")
+	}
+	if len(start) == 0 || len(start[0]) == 0 {
+		return nil, fmt.Errorf("game has an empty board")
+	}
+	if len(spawns) == 0 {
+		spawns = []level.Point{{X: len(start[0]) / 2, Y: 0}}
+	}
+	g := &Game{opts: opts, spawns: spawns, deal: deal, players: make(map[string]*gamePlayer, len(players))}
+	for _, p := range players {
+		if _, dup := g.players[p]; dup {
+			return nil, fmt.Errorf("player %q twice", p)
+		}
+		g.players[p] = &gamePlayer{b: start.clone(), frame: -1}
+	}
+	return g, nil
+}
+
+// Submit validates a move, applying it when it's possible and returning a
+// *Rejection when it isn't. Lock events are placed, the piece checked
+// against the deal, the board and the moves that reach it; a clear event
+// has to report the lines its lock cleared. Other events only order the
+// player's moves in time.
+func (g *Game) Submit(ev replay.Event) error {
+	p, ok := g.players[ev.Player]
+	reject := func(reason, format string, args ...any) error {
+		return &Rejection{Reason: reason, Player: ev.Player, Frame: ev.Frame, TimeMs: ev.TimeMs, Type: ev.Type,
+			Detail: fmt.Sprintf(format, args...)}
+	}
+	switch {
+	case !ok:
+		return reject(RejectPlayer, "not a player of the game")
+	case ev.Frame < p.frame:
+		return reject(RejectOrder, "frame %d is before the player's last move, at %d", ev.Frame, p.frame)
+	case p.topOut:
+		return reject(RejectOver, "the player topped out")
+	}
+	switch ev.Type {
+	case replay.EventLock:
+		lines, err := g.lock(p, ev, reject)
+		if err != nil {
+			return err
+		}
+		p.lines = lines
+	case replay.EventClear:
+		if ev.Lines != p.lines {
+			return reject(RejectLines, "%d lines cleared, the last lock cleared %d", ev.Lines, p.lines)
+		}
+		p.lines = 0
+	case replay.EventTopOut:
+		p.topOut = true
+	}
+	p.frame = ev.Frame
+	return nil
+}
+
+// lock checks and places a lock event's piece, returning the lines it
+// cleared
+func (g *Game) lock(p *gamePlayer, ev replay.Event, reject func(string, string, ...any) error) (int, error) {
+	cells, ok := pieces.Cells(ev.Piece, ev.Rotation)
+	if !ok {
+		return 0, reject(RejectUnknown, "no piece %q in rotation %d", ev.Piece, ev.Rotation)
+	}
+	if p.locks < len(g.deal) && ev.Piece != g.deal[p.locks] {
+		return 0, reject(RejectWrongPiece, "locked %s as piece %d, dealt %s", ev.Piece, p.locks+1, g.deal[p.locks])
+	}
+	if !p.b.fits(cells, ev.X, ev.Y) {
+		return 0, reject(RejectCollision, "%s at (%d,%d) overlaps the board or leaves it", ev.Piece, ev.X, ev.Y)
+	}
+	if p.b.fits(cells, ev.X, ev.Y+1) {
+		return 0, reject(RejectFloating, "%s at (%d,%d) has room to fall", ev.Piece, ev.X, ev.Y)
+	}
+	if !g.opts.AllowUnreachable && !reaches(p.b, ev, g.spawns) {
+		return 0, reject(RejectUnreachable, "%s can't get to (%d,%d) in rotation %d from a spawn point", ev.Piece, ev.X, ev.Y, ev.Rotation)
+	}
+	lines := p.b.place(cells, ev.X, ev.Y)
+	p.locks++
+	return lines, nil
+}
+
+// reaches reports whether the lock's position is one its piece can move to
+func reaches(b board, ev replay.Event, spawns []level.Point) bool {
+	want := piecePos{x: ev.X, y: ev.Y, rot: ((ev.Rotation % 4) + 4) % 4}
+	for _, pos := range reachable(b, ev.Piece, spawns) {
+		if pos == want {
+			return true
+		}
+	}
+	return false
+}
+
+// Rows draws a player's board, a string a row with # for a block
+func (g *Game) Rows(player string) ([]string, bool) {
+	p, ok := g.players[player]
+	if !ok {
+		return nil, false
+	}
+	rows := make([]string, len(p.b))
+	for y, row := range p.b {
+		var sb strings.Builder
+		for _, filled := range row {
+			if filled {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		rows[y] = sb.String()
+	}
+	return rows, true
+}
+
+// Verdict is the validation of every move of a replay
+type Verdict struct {
+	SessionID  string      `json:"sessionId"`
+	Valid      bool        `json:"valid"`
+	Moves      int         `json:"moves"` // events checked
+	Accepted   int         `json:"accepted"`
+	Rejections []Rejection `json:"rejections"`
+}
+
+// ValidateReplay re-simulates a replay's events in order, as a server
+// would have as they were submitted. A rejected move leaves the board as
+// it was, so later moves are judged on the board the server would hold.
+func (d *Dataset) ValidateReplay(r *replay.Replay, fallback level.GridSize, opts ValidateOptions) (Verdict, error) {
+	v := Verdict{SessionID: r.SessionID, Rejections: []Rejection{}}
+	g, err := d.NewReplayGame(r, fallback, opts)
+	if err != nil {
+		return v, err
+	}
+	for _, ev := range r.Events {
+		v.Moves++
+		if err := g.Submit(ev); err != nil {
+			v.Rejections = append(v.Rejections, *err.(*Rejection))
+			continue
+		}
+		v.Accepted++
+	}
+	v.Valid = len(v.Rejections) == 0
+	return v, nil
+}
@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func lock(frame int, piece string, x, y int) replay.Event {
+	return replay.Event{Frame: frame, Player: "p", Type: replay.EventLock, Piece: piece, X: x, Y: y}
+}
+
+func reason(err error) string {
+	var rej *Rejection
+	if errors.As(err, &rej) {
+		return rej.Reason
+	}
+	return ""
+}
+
+func TestGameRejectsImpossibleMoves(t *testing.T) {
+	r := &replay.Replay{Players: []replay.Player{{ID: "p"}}, Pieces: []string{"I", "I", "O", "I"}}
+	g, err := NewDataset().NewReplayGame(r, level.GridSize{Width: 6, Height: 6}, ValidateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, step := range []struct {
+		ev   replay.Event
+		want string // rejection reason, "" to be accepted
+	}{
+		{lock(1, "I", 0, 4), ""},
+		{lock(2, "I", 0, 4), RejectCollision},
+		{lock(2, "I", 0, 3), ""},
+		{lock(3, "T", 0, 0), RejectWrongPiece},
+		{lock(3, "O", 4, 0), RejectFloating},
+		{lock(3, "O", 5, 4), RejectCollision}, // half off the board
+		{lock(3, "Q", 4, 4), RejectUnknown},
+		{lock(3, "O", 4, 4), ""}, // fills both rows
+		{replay.Event{Frame: 3, Player: "p", Type: replay.EventClear, Lines: 1}, RejectLines},
+		{replay.Event{Frame: 3, Player: "p", Type: replay.EventClear, Lines: 2}, ""},
+		{lock(2, "I", 0, 4), RejectOrder},
+		{replay.Event{Frame: 4, Player: "q", Type: replay.EventLock}, RejectPlayer},
+		{replay.Event{Frame: 5, Player: "p", Type: replay.EventTopOut}, ""},
+		{lock(6, "I", 0, 4), RejectOver},
+	} {
+		if got := reason(g.Submit(step.ev)); got != step.want {
+			t.Errorf("step %d %+v: %q, want %q", i, step.ev, got, step.want)
+		}
+	}
+	// the clears left the board empty
+	if rows, _ := g.Rows("p"); strings.Join(rows, "") != strings.Repeat(".", 36) {
+		t.Errorf("board = %v", rows)
+	}
+}
+
+func TestGameRejectsUnreachableLocks(t *testing.T) {
+	lvl := level.New("roofed", 6, 6)
+	for x := 0; x < 6; x++ {
+		lvl.Blocks = append(lvl.Blocks, level.Block{Type: "stone", X: x, Y: 3})
+	}
+	for _, allow := range []bool{false, true} {
+		g, err := NewGame(lvl, []string{"p"}, ValidateOptions{AllowUnreachable: allow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// under the roof, where nothing gets
+		err = g.Submit(lock(1, "I", 0, 4))
+		if got := reason(err); allow && got != "" || !allow && got != RejectUnreachable {
+			t.Errorf("allow %v: %v", allow, err)
+		}
+	}
+	if _, err := NewGame(lvl, nil, ValidateOptions{}); err == nil {
+		t.Error("game without players")
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	r := &replay.Replay{SessionID: "s", Players: []replay.Player{{ID: "p"}}, Events: []replay.Event{
+		lock(1, "I", 0, 4),
+		lock(2, "O", 0, 0), // floating
+		lock(3, "O", 4, 4),
+	}}
+	v, err := NewDataset().ValidateReplay(r, level.GridSize{Width: 6, Height: 6}, ValidateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Valid || v.Moves != 3 || v.Accepted != 2 || len(v.Rejections) != 1 || v.Rejections[0].Reason != RejectFloating || v.Rejections[0].Frame != 2 {
+		t.Errorf("verdict = %+v", v)
+	}
+}
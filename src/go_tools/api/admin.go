@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/admin"
+)
+
+// RegisterAdmin adds the server's operations to its admin API:
+//
+//	GET /admin/jobs   analysis jobs in progress, oldest first
+func (s *Server) RegisterAdmin(a *admin.API) {
+	a.Handle("GET /admin/jobs", "analysis jobs in progress, oldest first", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, s.stats.Jobs())
+	})
+}
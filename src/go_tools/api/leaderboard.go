@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/leaderboard"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// maxScoreBytes bounds a submitted score, past the replay backing it
+const maxScoreBytes = 4 << 10
+
+// scoreSubmission is the body of a score submission
+type scoreSubmission struct {
+	Player string          `json:"player"`
+	Score  int64           `json:"score"`
+	Replay json.RawMessage `json:"replay,omitempty"` // of the session the score was made in
+}
+
+// scoreResult is the standing a submission left the player at
+type scoreResult struct {
+	leaderboard.Standing
+	Improved bool `json:"improved"` // false when it didn't beat their best
+}
+
+// leaderboard routes /api/leaderboards/{board}/...
+func (s *Server) leaderboard(w http.ResponseWriter, r *http.Request, parts []string) {
+	lb := s.opts.Leaderboard
+	if lb == nil {
+		httpError(w, http.StatusNotImplemented, "no leaderboard configured")
+		return
+	}
+	board, q := parts[0], r.URL.Query()
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		var sub scoreSubmission
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxScoreBytes+maxReplayBytes))
+		if err != nil {
+			httpError(w, http.StatusRequestEntityTooLarge, "read score: %v", err)
+			return
+		}
+		if err := json.Unmarshal(body, &sub); err != nil || sub.Player == "" {
+			httpError(w, http.StatusBadRequest, "a score is {\"player\":ID,\"score\":N,\"replay\":REPLAY}")
+			return
+		}
+		if err := s.backScore(&sub); err != nil {
+			httpError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		st, improved, err := lb.Submit(board, sub.Player, sub.Score)
+		if err != nil {
+			httpError(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, scoreResult{Standing: st, Improved: improved})
+	case r.Method != http.MethodGet:
+		if len(parts) == 1 {
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		} else {
+			methodNotAllowed(w, http.MethodGet)
+		}
+	case len(parts) == 1:
+		page, err := lb.Top(board, q.Get("season"), queryInt(q.Get("offset"), 0), queryInt(q.Get("limit"), leaderboard.DefaultPageSize))
+		leaderboardReply(w, page, err)
+	case len(parts) == 2 && parts[1] == "seasons":
+		seasons, err := lb.Seasons(board)
+		leaderboardReply(w, seasons, err)
+	case len(parts) == 3 && parts[1] == "players":
+		if q.Has("around") {
+			page, err := lb.Around(board, q.Get("season"), parts[2], queryInt(q.Get("around"), 0))
+			leaderboardReply(w, page, err)
+			return
+		}
+		st, err := lb.Player(board, q.Get("season"), parts[2])
+		leaderboardReply(w, st, err)
+	default:
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+	}
+}
+
+// backScore takes a submission's score from its replay, which has to be
+// signed when the dataset has keys; without keys a score needs no replay
+func (s *Server) backScore(sub *scoreSubmission) error {
+	keys := s.data.Keys
+	if len(sub.Replay) == 0 {
+		if keys != nil {
+			return fmt.Errorf("a score needs the signed replay it was made in")
+		}
+		return nil
+	}
+	rp, err := replay.Parse(bytes.NewReader(sub.Replay))
+	if err != nil {
+		return err
+	}
+	if keys != nil {
+		if err := keys.Verify(rp); err != nil {
+			return err
+		}
+	}
+	if _, ok := rp.Player(sub.Player); !ok {
+		return fmt.Errorf("%s didn't play in replay %s", sub.Player, rp.SessionID)
+	}
+	score, ok := rp.Result.Scores[sub.Player]
+	switch {
+	case !ok:
+		return fmt.Errorf("replay %s has no score for %s", rp.SessionID, sub.Player)
+	case sub.Score != 0 && sub.Score != int64(score):
+		return fmt.Errorf("score %d isn't the %d of replay %s", sub.Score, score, rp.SessionID)
+	}
+	sub.Score = int64(score)
+	return nil
+}
+
+func leaderboardReply(w http.ResponseWriter, v any, err error) {
+	switch {
+	case errors.Is(err, leaderboard.ErrNotRanked):
+		httpError(w, http.StatusNotFound, "%v", err)
+	case err != nil:
+		httpError(w, http.StatusInternalServerError, "%v", err)
+	default:
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+// queryInt parses a query parameter, def when it's absent or not a number
+func queryInt(v string, def int) int {
+	if n, err := strconv.Atoi(v); err == nil {
+		return n
+	}
+	return def
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// metricsPrefix namespaces every exported metric
+const metricsPrefix = "supertetris_analyzer_"
+
+// ErrorRateWindow is how far back the replay error rate looks
+const ErrorRateWindow = 15 * time.Minute
+
+// Metrics aggregates what the server has done for the Prometheus /metrics
+// endpoint
+type Metrics struct {
+	mu         sync.Mutex
+	active     map[int64]Job // jobs in progress, by ID
+	lastJob    int64
+	jobs       map[string]int     // completed, by kind
+	jobSeconds map[string]float64 // by kind
+	accepted   int
+	rejected   int
+	recent     []replayResult // within ErrorRateWindow, oldest first
+	levels     int
+	difficulty float64 // mean score of the processed levels
+}
+
+type replayResult struct {
+	at     time.Time
+	failed bool
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{active: make(map[int64]Job), jobs: make(map[string]int), jobSeconds: make(map[string]float64)}
+}
+
+// Job is an analysis job in progress
+type Job struct {
+	ID      int64     `json:"id"`
+	Kind    string    `json:"kind"`
+	Subject string    `json:"subject,omitempty"` // what it analyzes, such as a heatmap's level
+	Started time.Time `json:"started"`
+	Seconds float64   `json:"seconds"` // running so far
+}
+
+// startJob counts an analysis job as active until the returned func is called
+func (m *Metrics) startJob(kind, subject string) func() {
+	start := time.Now()
+	m.mu.Lock()
+	m.lastJob++
+	id := m.lastJob
+	m.active[id] = Job{ID: id, Kind: kind, Subject: subject, Started: start}
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.active, id)
+		m.jobs[kind]++
+		m.jobSeconds[kind] += time.Since(start).Seconds()
+	}
+}
+
+// Jobs lists the jobs in progress, oldest first
+func (m *Metrics) Jobs() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Job, 0, len(m.active))
+	for _, j := range m.active {
+		j.Seconds = time.Since(j.Started).Seconds()
+		out = append(out, j)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// ObserveReplays records replays accepted and rejected, whether submitted
+// or loaded from disk at startup
+func (m *Metrics) ObserveReplays(accepted, rejected int, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accepted += accepted
+	m.rejected += rejected
+	for i := 0; i < accepted+rejected; i++ {
+		m.recent = append(m.recent, replayResult{at: at, failed: i >= accepted})
+	}
+	m.prune(at)
+}
+
+// observeLevels records the difficulty scores of the processed levels
+func (m *Metrics) observeLevels(scores []float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.levels = len(scores)
+	m.difficulty = 0
+	for _, s := range scores {
+		m.difficulty += s / float64(len(scores))
+	}
+}
+
+func (m *Metrics) prune(now time.Time) {
+	keep := 0
+	for keep < len(m.recent) && now.Sub(m.recent[keep].at) > ErrorRateWindow {
+		keep++
+	}
+	m.recent = m.recent[keep:]
+}
+
+// errorRate is the share of recent replays that failed to parse
+func (m *Metrics) errorRate(now time.Time) float64 {
+	m.prune(now)
+	if len(m.recent) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, r := range m.recent {
+		if r.failed {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(m.recent))
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cw := &countingWriter{w: w}
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(cw, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, kind)
+	}
+	metric("jobs_active", "gauge", "Analysis jobs in progress.")
+	fmt.Fprintf(cw, "%sjobs_active %d\n", metricsPrefix, len(m.active))
+
+	kinds := make([]string, 0, len(m.jobs))
+	for k := range m.jobs {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	metric("jobs_total", "counter", "Analysis jobs completed.")
+	for _, k := range kinds {
+		fmt.Fprintf(cw, "%sjobs_total{kind=%q} %d\n", metricsPrefix, k, m.jobs[k])
+	}
+	metric("job_seconds_total", "counter", "Time spent in completed analysis jobs.")
+	for _, k := range kinds {
+		fmt.Fprintf(cw, "%sjob_seconds_total{kind=%q} %g\n", metricsPrefix, k, m.jobSeconds[k])
+	}
+
+	metric("replays_total", "counter", "Replays processed, by whether they parsed.")
+	fmt.Fprintf(cw, "%sreplays_total{result=\"accepted\"} %d\n", metricsPrefix, m.accepted)
+	fmt.Fprintf(cw, "%sreplays_total{result=\"rejected\"} %d\n", metricsPrefix, m.rejected)
+	metric("replay_error_rate", "gauge", fmt.Sprintf("Share of replays rejected over the last %s.", ErrorRateWindow))
+	fmt.Fprintf(cw, "%sreplay_error_rate %g\n", metricsPrefix, m.errorRate(time.Now()))
+
+	metric("levels_processed", "gauge", "Levels analyzed.")
+	fmt.Fprintf(cw, "%slevels_processed %d\n", metricsPrefix, m.levels)
+	metric("level_difficulty_average", "gauge", "Mean difficulty score of the analyzed levels, 0 easy to 1 hard.")
+	fmt.Fprintf(cw, "%slevel_difficulty_average %g\n", metricsPrefix, m.difficulty)
+	return cw.n, cw.err
+}
+
+// countingWriter tracks what WriteTo wrote and its first error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/leaderboard"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// DescribeAPI adds the analysis endpoints to a server's OpenAPI document
+func (s *Server) DescribeAPI(spec *openapi.Spec) {
+	filters := []openapi.Param{
+		{Name: "source", Doc: "the table the metric comes from"},
+		{Name: "subject", Doc: "what it measures, such as a level or player"},
+		{Name: "name", Doc: "the metric's"},
+	}
+	board := map[string]string{"board": "the leaderboard's name"}
+	season := openapi.Param{Name: "season", Doc: "empty for the current one"}
+
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/api/replays", Summary: "sessions in the dataset", Reply: []session{}})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/api/replays", Summary: "submit a replay",
+		Body: replay.Replay{}, Status: http.StatusCreated, Reply: session{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/api/tables", Summary: "analysis tables, without their rows", Reply: []tableInfo{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/api/tables/{name}", Summary: "one table",
+		Params: map[string]string{"name": "the table's"}, Reply: analyzer.Table{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/api/metrics", Summary: "current metrics, filtered",
+		Query: filters, Reply: []metric{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/api/metrics/history",
+		Summary: "a metric across recorded runs; source and name are required", Query: filters, Reply: []point{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/api/heatmaps/{level}/{file}", Summary: "a heatmap image",
+		Params: map[string]string{"level": "the level's name", "file": "the kind and format, such as " + analyzer.HeatmapKinds[0] + ".png or .svg"},
+		Reply:  openapi.Raw("image/png")})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/api/leaderboards/{board}", Summary: "a ranked page", Params: board,
+		Query: []openapi.Param{season, {Name: "offset", Type: "integer"}, {Name: "limit", Type: "integer"}},
+		Reply: leaderboard.Page{}})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/api/leaderboards/{board}",
+		Summary: "submit a player's score, with the replay it was made in", Params: board,
+		Body: scoreSubmission{}, Reply: scoreResult{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/api/leaderboards/{board}/seasons", Summary: "seasons with scores",
+		Params: board, Reply: []string{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/api/leaderboards/{board}/players/{player}",
+		Summary: "a player's standing, or with around the page of it and its neighbours",
+		Params:  map[string]string{"board": board["board"], "player": "the player's ID"},
+		Query:   []openapi.Param{season, {Name: "around", Doc: "how many neighbours either side", Type: "integer"}},
+		Reply:   leaderboard.Standing{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/metrics", Summary: "Prometheus metrics", Reply: openapi.Raw("text/plain")})
+}
@@ -0,0 +1,413 @@
+// Package api serves the analyzer over HTTP, so dashboards can submit
+// replays and read metrics and heatmaps without running the CLI
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/leaderboard"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/store"
+)
+
+// maxReplayBytes bounds a submitted replay
+const maxReplayBytes = 32 << 20
+
+// Options configures a Server
+type Options struct {
+	Fallback  level.GridSize         // board size for replays of levels not loaded
+	Render    analyzer.RenderOptions // heatmap images
+	ReplayDir string                 // submitted replays are saved here, empty keeps them in memory only
+	Store     *store.Store           // optional; serves metric history
+
+	// Leaderboard, optional, is served under /api/leaderboards
+	Leaderboard *leaderboard.Leaderboard
+
+	// Collectors add their Prometheus metrics to /metrics after the server's own
+	Collectors []io.WriterTo
+}
+
+// Server exposes a dataset's analysis over REST:
+//
+//	GET  /api/replays                              sessions in the dataset
+//	POST /api/replays                              submit a replay
+//	GET  /api/tables                               analysis tables
+//	GET  /api/tables/{name}                        one table
+//	GET  /api/metrics?source=&subject=&name=       current metrics, filtered
+//	GET  /api/metrics/history?source=&subject=&name= a metric across recorded runs
+//	GET  /api/heatmaps/{level}/{kind}.png|svg      a heatmap image
+//	GET  /api/leaderboards/{board}?season=&offset=&limit= a ranked page
+//	POST /api/leaderboards/{board}                 submit a player's score, with its replay
+//	GET  /api/leaderboards/{board}/seasons         seasons with scores
+//	GET  /api/leaderboards/{board}/players/{player}?season=&around= a standing and its neighbours
+//	GET  /metrics                                  Prometheus metrics
+//
+// RegisterAdmin adds the jobs in progress to a server's admin API.
+type Server struct {
+	opts  Options
+	stats *Metrics
+
+	mu     sync.RWMutex
+	data   *analyzer.Dataset
+	tables []*analyzer.Table // computed on demand, dropped when a replay arrives
+}
+
+// NewServer serves the dataset; it takes ownership of it
+func NewServer(data *analyzer.Dataset, opts Options) *Server {
+	return &Server{data: data, opts: opts, stats: newMetrics()}
+}
+
+// Metrics returns the server's Prometheus metrics
+func (s *Server) Metrics() *Metrics {
+	return s.stats
+}
+
+// ServeHTTP routes the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "metrics" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		s.stats.WriteTo(w)
+		for _, c := range s.opts.Collectors {
+			c.WriteTo(w)
+		}
+		return
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) < 2 || parts[0] != "api" {
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+		return
+	}
+	switch {
+	case parts[1] == "replays" && len(parts) == 2:
+		switch r.Method {
+		case http.MethodGet:
+			s.listReplays(w)
+		case http.MethodPost:
+			s.submitReplay(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	case parts[1] == "leaderboards" && len(parts) > 2:
+		s.leaderboard(w, r, parts[2:])
+		return
+	case r.Method != http.MethodGet:
+		methodNotAllowed(w, http.MethodGet)
+	case parts[1] == "tables" && len(parts) == 2:
+		s.listTables(w, r)
+	case parts[1] == "tables" && len(parts) == 3:
+		s.getTable(w, r, parts[2])
+	case parts[1] == "metrics" && len(parts) == 2:
+		s.metrics(w, r)
+	case parts[1] == "metrics" && len(parts) == 3 && parts[2] == "history":
+		s.history(w, r)
+	case parts[1] == "heatmaps" && len(parts) == 4:
+		s.heatmap(w, parts[2], parts[3])
+	default:
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+	}
+}
+
+// session summarizes one replay
+type session struct {
+	SessionID  string   `json:"sessionId"`
+	Level      string   `json:"level"`
+	Players    []string `json:"players"`
+	DurationMs int64    `json:"durationMs"`
+	Outcome    string   `json:"outcome,omitempty"`
+	Winner     string   `json:"winner,omitempty"`
+}
+
+func summarize(r *replay.Replay) session {
+	s := session{SessionID: r.SessionID, Level: r.Level, DurationMs: r.Result.DurationMs,
+		Outcome: r.Result.Outcome, Winner: r.Result.Winner}
+	for _, p := range r.Players {
+		s.Players = append(s.Players, p.ID)
+	}
+	return s
+}
+
+func (s *Server) listReplays(w http.ResponseWriter) {
+	s.mu.RLock()
+	out := make([]session, 0, len(s.data.Replays))
+	for _, r := range s.data.Replays {
+		out = append(out, summarize(r))
+	}
+	s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) submitReplay(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxReplayBytes))
+	if err != nil {
+		httpError(w, http.StatusRequestEntityTooLarge, "read replay: %v", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	probe, err := replay.Parse(bytes.NewReader(body))
+	if err != nil {
+		s.stats.ObserveReplays(0, 1, time.Now())
+		slog.Warn("api: replay rejected", "error", err, "by", r.RemoteAddr)
+		httpError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	// checked before anything is saved; AddReplay checks again
+	if s.data.Keys != nil {
+		if err := s.data.Keys.Verify(probe); err != nil {
+			s.stats.ObserveReplays(0, 1, time.Now())
+			slog.Warn("api: replay rejected", "session", probe.SessionID, "error", err, "by", r.RemoteAddr)
+			httpError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+	for _, existing := range s.data.Replays {
+		if existing.SessionID == probe.SessionID {
+			httpError(w, http.StatusConflict, "session %s already submitted", probe.SessionID)
+			return
+		}
+	}
+	if s.opts.ReplayDir != "" {
+		// the dataset anonymizes its copy, so identifiers must not reach disk
+		stored := body
+		if s.data.Anonymizer != nil {
+			s.data.Anonymizer.Apply(probe)
+			if stored, err = json.MarshalIndent(probe, "", "  "); err != nil {
+				httpError(w, http.StatusInternalServerError, "save replay: %v", err)
+				return
+			}
+		}
+		if err := saveReplay(s.opts.ReplayDir, probe.SessionID, stored); err != nil {
+			httpError(w, http.StatusInternalServerError, "save replay: %v", err)
+			return
+		}
+	}
+	rp, err := s.data.AddReplay(body)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	s.tables = nil
+	s.stats.ObserveReplays(1, 0, time.Now())
+	slog.Info("api: replay submitted", "session", probe.SessionID, "level", probe.Level, "by", r.RemoteAddr)
+	writeJSON(w, http.StatusCreated, summarize(rp))
+}
+
+// saveReplay writes a submitted replay where the CLI will find it
+func saveReplay(dir, sessionID string, data []byte) error {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, sessionID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, strings.TrimLeft(name, ".")+".json")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// analysis returns the dataset's analysis tables, computing them when the
+// dataset changed since the last request
+func (s *Server) analysis(ctx context.Context) ([]*analyzer.Table, error) {
+	s.mu.RLock()
+	tables := s.tables
+	s.mu.RUnlock()
+	if tables != nil {
+		return tables, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tables != nil {
+		return s.tables, nil
+	}
+	defer s.stats.startJob("tables", fmt.Sprintf("%d replays", len(s.data.Replays)))()
+	levels := s.data.AnalyzeLevels()
+	scores := make([]float64, len(levels))
+	for i, l := range levels {
+		scores[i] = l.Score
+	}
+	s.stats.observeLevels(scores)
+	tables, err := analyzer.DatasetTables(ctx, s.data, levels, s.opts.Fallback)
+	if err != nil {
+		return nil, err
+	}
+	s.tables = tables
+	return s.tables, nil
+}
+
+// tableInfo describes a table without its rows
+type tableInfo struct {
+	Name    string            `json:"name"`
+	Columns []analyzer.Column `json:"columns"`
+	Rows    int               `json:"rows"`
+}
+
+func (s *Server) listTables(w http.ResponseWriter, r *http.Request) {
+	tables, err := s.analysis(r.Context())
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	out := make([]tableInfo, 0, len(tables))
+	for _, t := range tables {
+		out = append(out, tableInfo{Name: t.Name, Columns: t.Columns, Rows: len(t.Rows)})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getTable(w http.ResponseWriter, r *http.Request, name string) {
+	tables, err := s.analysis(r.Context())
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	for _, t := range tables {
+		if t.Name == name {
+			writeJSON(w, http.StatusOK, t)
+			return
+		}
+	}
+	httpError(w, http.StatusNotFound, "no table %q", name)
+}
+
+// metric is one numeric analysis result
+type metric struct {
+	Source  string  `json:"source"`
+	Subject string  `json:"subject"`
+	Name    string  `json:"name"`
+	Value   float64 `json:"value"`
+}
+
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	tables, err := s.analysis(r.Context())
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	q := r.URL.Query()
+	match := func(filter, v string) bool { return filter == "" || filter == v }
+	out := []metric{}
+	for _, t := range tables {
+		if !match(q.Get("source"), t.Name) {
+			continue
+		}
+		for _, m := range store.TableMetrics(t) {
+			if match(q.Get("subject"), m.Subject) && match(q.Get("name"), m.Name) {
+				out = append(out, metric{m.Source, m.Subject, m.Name, m.Value})
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// point is a metric's value in one recorded run
+type point struct {
+	Run   int64   `json:"run"`
+	Label string  `json:"label"`
+	At    string  `json:"at"`
+	Value float64 `json:"value"`
+}
+
+func (s *Server) history(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Store == nil {
+		httpError(w, http.StatusNotImplemented, "no results database configured")
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("source") == "" || q.Get("name") == "" {
+		httpError(w, http.StatusBadRequest, "history needs source and name")
+		return
+	}
+	points, err := s.opts.Store.MetricHistory(q.Get("source"), q.Get("subject"), q.Get("name"))
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	out := make([]point, 0, len(points))
+	for _, p := range points {
+		out = append(out, point{p.Run.ID, p.Run.Label, p.Run.StartedAt.Format("2006-01-02T15:04:05Z07:00"), p.Value})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) heatmap(w http.ResponseWriter, levelName, file string) {
+	kind, format, ok := strings.Cut(file, ".")
+	if !ok || (format != "png" && format != "svg") {
+		httpError(w, http.StatusNotFound, "heatmaps are .png or .svg")
+		return
+	}
+	known := false
+	for _, k := range analyzer.HeatmapKinds {
+		known = known || k == kind
+	}
+	if !known {
+		httpError(w, http.StatusNotFound, "unknown heatmap kind %q, want one of %s", kind, strings.Join(analyzer.HeatmapKinds, ", "))
+		return
+	}
+	defer s.stats.startJob("heatmap", levelName+" "+kind)()
+	s.mu.RLock()
+	h := s.data.Heatmaps(kind, s.opts.Fallback)[levelName]
+	s.mu.RUnlock()
+	if h == nil {
+		httpError(w, http.StatusNotFound, "no sessions on level %q", levelName)
+		return
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		w.Header().Set("Content-Type", "image/png")
+		err = h.RenderPNG(&buf, s.opts.Render)
+	} else {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = h.RenderSVG(&buf, s.opts.Render)
+	}
+	if err != nil {
+		w.Header().Del("Content-Type")
+		httpError(w, http.StatusInternalServerError, "render heatmap: %v", err)
+		return
+	}
+	buf.WriteTo(w)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
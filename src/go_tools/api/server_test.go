@@ -0,0 +1,272 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/leaderboard"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+const submitted = `{"sessionId":"s1","level":"pit","players":[{"id":"p"}],
+	"events":[{"frame":1,"player":"p","type":"lock","piece":"O","x":0,"y":18}],
+	"result":{"durationMs":30000,"outcome":"cleared"}}`
+
+func TestServerSubmitQueryAndHeatmap(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(NewServer(analyzer.NewDataset(), Options{
+		Fallback: level.GridSize{Width: 10, Height: 20}, ReplayDir: dir}))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/api/replays", "application/json", strings.NewReader(submitted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("submit: %s", resp.Status)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "s1.json")); err != nil {
+		t.Errorf("submitted replay not saved: %v", err)
+	}
+	resp, _ = http.Post(srv.URL+"/api/replays", "application/json", strings.NewReader(submitted))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("resubmit: %s, want 409", resp.Status)
+	}
+	resp, _ = http.Post(srv.URL+"/api/replays", "application/json", strings.NewReader(`{"sessionId":"bad"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid replay: %s, want 400", resp.Status)
+	}
+
+	var metrics []metric
+	getJSON(t, srv.URL+"/api/metrics?source=board_complexity&subject=pit&name=frames", &metrics)
+	if len(metrics) != 1 || metrics[0].Value != 1 {
+		t.Errorf("metrics = %+v, want one frame on pit", metrics)
+	}
+	var tables []tableInfo
+	getJSON(t, srv.URL+"/api/tables", &tables)
+	found := false
+	for _, ti := range tables {
+		found = found || ti.Name == "sessions_by_level"
+	}
+	if !found {
+		t.Errorf("tables %+v lack the sessions pass", tables)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/heatmaps/pit/locks.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("heatmap: %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	for _, path := range []string{"/api/heatmaps/pit/nope.png", "/api/heatmaps/caves/locks.png", "/api/tables/nope", "/elsewhere"} {
+		resp, _ := http.Get(srv.URL + path)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: %s, want 404", path, resp.Status)
+		}
+	}
+	resp, _ = http.Get(srv.URL + "/api/metrics/history?source=x&name=y")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("history without a store: %s, want 501", resp.Status)
+	}
+}
+
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerPrometheusMetrics(t *testing.T) {
+	s := NewServer(analyzer.NewDataset(), Options{
+		Fallback:   level.GridSize{Width: 10, Height: 20},
+		Collectors: []io.WriterTo{strings.NewReader("supertetris_profiler_goroutines 7\n")},
+	})
+	s.Metrics().ObserveReplays(3, 1, time.Now())
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	resp, _ := http.Post(srv.URL+"/api/replays", "application/json", strings.NewReader(`{`))
+	resp.Body.Close()
+	resp, _ = http.Get(srv.URL + "/api/tables")
+	resp.Body.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		"supertetris_analyzer_jobs_active 0\n",
+		`supertetris_analyzer_jobs_total{kind="tables"} 1` + "\n",
+		`supertetris_analyzer_replays_total{result="rejected"} 2` + "\n",
+		"supertetris_analyzer_replay_error_rate 0.4\n",
+		"# TYPE supertetris_analyzer_level_difficulty_average gauge\n",
+		"supertetris_profiler_goroutines 7\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestErrorRateWindow(t *testing.T) {
+	m := newMetrics()
+	start := time.Now()
+	m.ObserveReplays(0, 4, start)
+	m.ObserveReplays(1, 0, start.Add(ErrorRateWindow+time.Minute))
+	if r := m.errorRate(start.Add(ErrorRateWindow + time.Minute)); r != 0 {
+		t.Errorf("error rate %g after old failures left the window", r)
+	}
+}
+
+func TestServerLeaderboard(t *testing.T) {
+	lb, err := leaderboard.New(leaderboard.NewMemory(), leaderboard.PeriodAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewServer(analyzer.NewDataset(), Options{Leaderboard: lb}))
+	defer srv.Close()
+
+	for _, body := range []string{`{"player":"a","score":10}`, `{"player":"b","score":30}`, `{"player":"c","score":20}`, `{"player":"a","score":5}`} {
+		resp, err := http.Post(srv.URL+"/api/leaderboards/marathon", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got scoreResult
+		json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || (body == `{"player":"a","score":5}`) == got.Improved {
+			t.Errorf("submit %s: %s %+v", body, resp.Status, got)
+		}
+	}
+	var page leaderboard.Page
+	getJSON(t, srv.URL+"/api/leaderboards/marathon?limit=2", &page)
+	if page.Players != 3 || len(page.Standings) != 2 || page.Standings[0].Player != "b" || page.Standings[1].Rank != 2 {
+		t.Errorf("top = %+v", page)
+	}
+	getJSON(t, srv.URL+"/api/leaderboards/marathon/players/a?around=1", &page)
+	if len(page.Standings) != 2 || page.Standings[1].Player != "a" || page.Standings[1].Rank != 3 {
+		t.Errorf("around a = %+v", page)
+	}
+	var seasons []string
+	getJSON(t, srv.URL+"/api/leaderboards/marathon/seasons", &seasons)
+	if len(seasons) != 1 || seasons[0] != "all" {
+		t.Errorf("seasons = %v", seasons)
+	}
+	for path, want := range map[string]int{"/api/leaderboards/marathon/players/nobody": http.StatusNotFound, "/api/leaderboards/marathon/nope": http.StatusNotFound} {
+		resp, _ := http.Get(srv.URL + path)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET %s: %s, want %d", path, resp.Status, want)
+		}
+	}
+	resp, _ := http.Post(srv.URL+"/api/leaderboards/marathon", "application/json", strings.NewReader(`{"score":1}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("score without a player: %s", resp.Status)
+	}
+}
+
+func TestServerLeaderboardNeedsSignedReplays(t *testing.T) {
+	lb, _ := leaderboard.New(leaderboard.NewMemory(), leaderboard.PeriodAll)
+	key, _ := replay.NewKey()
+	data := analyzer.NewDataset()
+	data.Keys = (&replay.Keys{Keys: []replay.Key{key}}).Public()
+	srv := httptest.NewServer(NewServer(data, Options{Leaderboard: lb}))
+	defer srv.Close()
+
+	rp, _ := replay.Parse(strings.NewReader(strings.Replace(submitted, `"outcome"`, `"scores":{"p":70},"outcome"`, 1)))
+	unsigned, _ := json.Marshal(rp)
+	rp.Sign(key)
+	signed, _ := json.Marshal(rp)
+	rp.Result.Scores["p"] = 700
+	tampered, _ := json.Marshal(rp)
+	for _, c := range []struct {
+		body string
+		want int
+	}{
+		{`{"player":"p","score":70}`, http.StatusBadRequest},
+		{`{"player":"p","replay":` + string(unsigned) + `}`, http.StatusBadRequest},
+		{`{"player":"p","replay":` + string(tampered) + `}`, http.StatusBadRequest},
+		{`{"player":"p","score":80,"replay":` + string(signed) + `}`, http.StatusBadRequest},
+		{`{"player":"q","replay":` + string(signed) + `}`, http.StatusBadRequest},
+		{`{"player":"p","replay":` + string(signed) + `}`, http.StatusOK},
+	} {
+		resp, err := http.Post(srv.URL+"/api/leaderboards/marathon", "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got scoreResult
+		json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if resp.StatusCode != c.want || c.want == http.StatusOK && got.Score != 70 {
+			t.Errorf("submit %.60s: %s %+v", c.body, resp.Status, got)
+		}
+	}
+
+	// uploads are checked too
+	resp, _ := http.Post(srv.URL+"/api/replays", "application/json", strings.NewReader(string(tampered)))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || len(data.Replays) != 0 {
+		t.Errorf("tampered upload: %s", resp.Status)
+	}
+	resp, _ = http.Post(srv.URL+"/api/replays", "application/json", strings.NewReader(string(signed)))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("signed upload: %s", resp.Status)
+	}
+}
+
+func TestServerDescribesItsRoutes(t *testing.T) {
+	lb, err := leaderboard.New(leaderboard.NewMemory(), leaderboard.PeriodAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(analyzer.NewDataset(), Options{Leaderboard: lb})
+	spec := openapi.New("analysis", "")
+	s.DescribeAPI(spec)
+	h := openapi.Mount(spec, s)
+	fill := strings.NewReplacer("{name}", "x", "{level}", "pit", "{file}", "moves.png", "{board}", "marathon", "{player}", "a")
+	for path, item := range spec.Document().Paths {
+		for method := range item {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(strings.ToUpper(method), openapi.Prefix+fill.Replace(path), strings.NewReader("{}")))
+			if w.Code == http.StatusMethodNotAllowed || strings.Contains(w.Body.String(), "no such endpoint") {
+				t.Errorf("%s %s described but not routed: %d %s", method, path, w.Code, w.Body)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tables", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Deprecation") == "" || !strings.Contains(w.Header().Get("Link"), "/v1/api/tables") {
+		t.Errorf("unversioned path answered %d with %v", w.Code, w.Header())
+	}
+}
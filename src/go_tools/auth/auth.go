@@ -0,0 +1,280 @@
+// Package auth checks the API tokens the tool servers accept. A token
+// grants scopes: a surface such as packs or replays, just its reads as
+// packs:read, or * for every surface. Tokens live hashed in a tokens file,
+// which lists revoked ones too and is reread when it changes, so revoking
+// a token needs no restart.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenPrefix starts every token, so one is recognisable in a leak scan
+const TokenPrefix = "st_"
+
+// TokenEnv holds the token the tools' clients present, such as analyze
+// reading a replay store's server
+const TokenEnv = "SUPERTETRIS_TOKEN"
+
+// Surfaces the tool servers check tokens against
+const (
+	SurfaceAdmin        = "admin"        // every server's /admin/ API
+	SurfaceAnalysis     = "analysis"     // analyze -serve's REST API
+	SurfaceLeaderboards = "leaderboards" // its /api/leaderboards
+	SurfaceJobs         = "jobs"         // the batch job queue
+	SurfacePacks        = "packs"
+	SurfaceProfiler     = "profiler" // metrics, profiles and dashboards
+	SurfaceRelay        = "relay"
+	SurfaceReplays      = "replays"
+	SurfaceSync         = "sync"      // the editor and game live sync
+	SurfaceTelemetry    = "telemetry" // clients' telemetry events
+	SurfaceTools        = "tools"     // the gRPC services
+	SurfaceValidation   = "validation"
+)
+
+// Surfaces lists them, for validating scopes
+var Surfaces = []string{SurfaceAdmin, SurfaceAnalysis, SurfaceJobs, SurfaceLeaderboards, SurfacePacks, SurfaceProfiler, SurfaceRelay,
+	SurfaceReplays, SurfaceSync, SurfaceTelemetry, SurfaceTools, SurfaceValidation}
+
+// Errors Authorize returns
+var (
+	ErrUnauthenticated = errors.New("missing or unknown API token")
+	ErrRevoked         = errors.New("API token revoked")
+	ErrExpired         = errors.New("API token expired")
+	ErrForbidden       = errors.New("API token lacks the scope")
+)
+
+// rereadEvery is how often a keyring checks its file for changes
+const rereadEvery = time.Second
+
+// Token is an entry of a tokens file
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"` // who or what holds it
+	Hash    string    `json:"hash"` // hex SHA-256 of the token
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires,omitempty"` // zero never expires
+}
+
+// Allows reports whether the token's scopes cover the surface, or only
+// its reads when write is false
+func (t Token) Allows(surface string, write bool) bool {
+	for _, s := range t.Scopes {
+		if s == "*" || s == surface || !write && s == surface+":read" {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidScope reports whether s is a surface, a surface's reads or *
+func ValidScope(s string) bool {
+	return s == "*" || slices.Contains(Surfaces, strings.TrimSuffix(s, ":read"))
+}
+
+// File is a tokens file
+type File struct {
+	Tokens  []Token  `json:"tokens"`
+	Revoked []string `json:"revoked,omitempty"` // IDs of tokens refused
+}
+
+// ReadFile reads a tokens file; a missing one is empty
+func ReadFile(path string) (File, error) {
+	var f File
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("parse tokens file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Save writes the file readable only by its owner, replacing it whole so
+// a keyring never rereads half of it
+func (f File) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// NewToken makes a token named name granting scopes, valid for ttl or,
+// zero, forever. It returns the entry to keep and the token to hand out,
+// which isn't kept anywhere.
+func NewToken(name string, scopes []string, ttl time.Duration) (Token, string, error) {
+	for _, s := range scopes {
+		if !ValidScope(s) {
+			return Token{}, "", fmt.Errorf("unknown scope %q, want one of %s, SURFACE:read or *", s, strings.Join(Surfaces, ", "))
+		}
+	}
+	if len(scopes) == 0 {
+		return Token{}, "", fmt.Errorf("token %s has no scopes", name)
+	}
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return Token{}, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Token{}, "", err
+	}
+	t := Token{ID: hex.EncodeToString(id), Name: name, Scopes: scopes, Created: time.Now().UTC()}
+	if ttl > 0 {
+		t.Expires = t.Created.Add(ttl)
+	}
+	token := TokenPrefix + t.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	t.Hash = hashToken(token)
+	return t, token, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenID is the ID a token carries, empty when it isn't one
+func TokenID(token string) string {
+	rest, ok := strings.CutPrefix(token, TokenPrefix)
+	if !ok {
+		return ""
+	}
+	id, _, _ := strings.Cut(rest, "_")
+	return id
+}
+
+// Keyring checks tokens against a tokens file
+type Keyring struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	file    File
+	byID    map[string]Token
+	revoked map[string]bool
+	stat    os.FileInfo
+	checked time.Time
+}
+
+// Open reads the tokens file at path, which must exist
+func Open(path string) (*Keyring, error) {
+	k := &Keyring{path: path, now: time.Now}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.load(info); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Load opens the keyring of a config's tokens file, or returns nil, which
+// checks nothing, when path is empty
+func Load(path string) (*Keyring, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return Open(path)
+}
+
+// load reads the file; on failure the tokens last read stay in force
+func (k *Keyring) load(info os.FileInfo) error {
+	f, err := ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	k.file, k.stat = f, info
+	k.byID = make(map[string]Token, len(f.Tokens))
+	for _, t := range f.Tokens {
+		k.byID[t.ID] = t
+	}
+	k.revoked = make(map[string]bool, len(f.Revoked))
+	for _, id := range f.Revoked {
+		k.revoked[id] = true
+	}
+	return nil
+}
+
+// refresh rereads the file when it changed, at most every rereadEvery
+func (k *Keyring) refresh() {
+	now := k.now()
+	if now.Sub(k.checked) < rereadEvery {
+		return
+	}
+	k.checked = now
+	info, err := os.Stat(k.path)
+	if err != nil || info.ModTime().Equal(k.stat.ModTime()) && info.Size() == k.stat.Size() {
+		return
+	}
+	k.load(info)
+}
+
+// Tokens lists the file's tokens
+func (k *Keyring) Tokens() []Token {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refresh()
+	return slices.Clone(k.file.Tokens)
+}
+
+// Authenticate returns the entry of a token that is known, unrevoked and
+// unexpired
+func (k *Keyring) Authenticate(token string) (Token, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.refresh()
+	t, known := k.byID[TokenID(token)]
+	want, _ := hex.DecodeString(t.Hash)
+	got, _ := hex.DecodeString(hashToken(token))
+	// compared even for an unknown ID, so timing tells nothing of the IDs
+	if subtle.ConstantTimeCompare(got, want) != 1 || !known {
+		return Token{}, ErrUnauthenticated
+	}
+	if k.revoked[t.ID] {
+		return t, ErrRevoked
+	}
+	if !t.Expires.IsZero() && !k.now().Before(t.Expires) {
+		return t, ErrExpired
+	}
+	return t, nil
+}
+
+// Authorize authenticates a token and checks it covers the surface, or
+// its reads when write is false
+func (k *Keyring) Authorize(token, surface string, write bool) (Token, error) {
+	t, err := k.Authenticate(token)
+	if err != nil {
+		return t, err
+	}
+	if !t.Allows(surface, write) {
+		access := "read"
+		if write {
+			access = "write"
+		}
+		return t, fmt.Errorf("%w: %s can't %s %s", ErrForbidden, t.Name, access, surface)
+	}
+	return t, nil
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyringScopesRevocationAndExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	packs, packsToken, err := NewToken("ci", []string{"packs:read", "replays"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	short, shortToken, _ := NewToken("playtest", []string{"*"}, time.Hour)
+	if err := (File{Tokens: []Token{packs, short}}).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewToken("x", []string{"packs:write"}, 0); err == nil {
+		t.Error("unknown scope accepted")
+	}
+
+	k, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	k.now = func() time.Time { return now }
+	for _, c := range []struct {
+		token, surface string
+		write          bool
+		want           error
+	}{
+		{packsToken, SurfacePacks, false, nil},
+		{packsToken, SurfacePacks, true, ErrForbidden},
+		{packsToken, SurfaceReplays, true, nil},
+		{packsToken, SurfaceRelay, false, ErrForbidden},
+		{shortToken, SurfaceRelay, true, nil},
+		{packsToken[:len(packsToken)-1] + "x", SurfacePacks, false, ErrUnauthenticated},
+		{"", SurfacePacks, false, ErrUnauthenticated},
+	} {
+		if _, err := k.Authorize(c.token, c.surface, c.write); !errors.Is(err, c.want) {
+			t.Errorf("%s on %s (write %v): %v, want %v", c.token[:min(len(c.token), 12)], c.surface, c.write, err, c.want)
+		}
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := k.Authenticate(shortToken); !errors.Is(err, ErrExpired) {
+		t.Errorf("expired token: %v", err)
+	}
+	// revoking rewrites the file, which a running keyring picks up
+	if err := (File{Tokens: []Token{packs, short}, Revoked: []string{packs.ID}}).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	now = now.Add(rereadEvery)
+	if _, err := k.Authenticate(packsToken); !errors.Is(err, ErrRevoked) {
+		t.Errorf("revoked token: %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	reader, readToken, _ := NewToken("viewer", []string{"relay:read"}, 0)
+	(File{Tokens: []Token{reader}}).Save(path)
+	k, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := k.Middleware(Surface(SurfaceRelay), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+	if rec := serve(httptest.NewRequest(http.MethodGet, "/rooms", nil)); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("no token: %d", rec.Code)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/rooms", nil)
+	r.Header.Set("Authorization", "Bearer "+readToken)
+	if rec := serve(r); rec.Code != http.StatusOK {
+		t.Errorf("read with a bearer token: %d", rec.Code)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/rooms/ABCD", nil)
+	r.Header.Set("Authorization", "Bearer "+readToken)
+	r.Header.Set("Upgrade", "websocket")
+	if rec := serve(r); rec.Code != http.StatusForbidden {
+		t.Errorf("joining a room with a read token: %d", rec.Code)
+	}
+	// a link with the token leaves a cookie the page's requests then carry
+	rec := serve(httptest.NewRequest(http.MethodGet, "/rooms?access_token="+readToken, nil))
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Value != readToken || !cookies[0].HttpOnly {
+		t.Fatalf("access_token: %d %v", rec.Code, cookies)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/rooms", nil)
+	r.AddCookie(cookies[0])
+	if rec := serve(r); rec.Code != http.StatusOK {
+		t.Errorf("read with the cookie: %d", rec.Code)
+	}
+
+	var none *Keyring
+	if none.Middleware(Surface(SurfaceRelay), http.NotFoundHandler()) == nil {
+		t.Error("a nil keyring's middleware is nil")
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// CookieName is the cookie a browser keeps its token in, set when a page
+// is opened with ?access_token= so the page's own requests carry it
+const CookieName = "supertetris_token"
+
+// Credential is the token a request presents: a bearer token, else the
+// cookie, else an access_token parameter, for browsers' WebSockets and
+// dashboard links, which can't set headers
+func Credential(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if c, err := r.Cookie(CookieName); err == nil {
+		return c.Value
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// IsWrite reports whether a request changes anything: any method but GET,
+// HEAD and OPTIONS, and a WebSocket, over which a client sends too
+func IsWrite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+	}
+	return true
+}
+
+// Surface is the surface function of a server that is all one surface
+func Surface(name string) func(*http.Request) string {
+	return func(*http.Request) string { return name }
+}
+
+// Middleware passes on the requests whose token covers surface(r), the
+// whole surface by IsWrite or only its reads, and answers the others 401
+// or 403 with a JSON error. A request surface returns "" for is left to
+// next, such as one with its own authentication. A nil keyring checks
+// nothing.
+func (k *Keyring) Middleware(surface func(*http.Request) string, next http.Handler) http.Handler {
+	if k == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := surface(r)
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := Credential(r)
+		_, err := k.Authorize(token, name, IsWrite(r))
+		if err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, ErrForbidden) {
+				status = http.StatusForbidden
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="supertetris"`)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if r.URL.Query().Get("access_token") == token {
+			http.SetCookie(w, &http.Cookie{Name: CookieName, Value: token, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetHeader presents token, if any, on an outgoing request
+func SetHeader(h http.Header, token string) {
+	if token != "" {
+		h.Set("Authorization", "Bearer "+token)
+	}
+}
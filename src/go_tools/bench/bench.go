@@ -0,0 +1,186 @@
+// Package bench is the tools' standard performance workload: a batch of
+// levels generated from a fixed seed, bot games played on them as the
+// reference simulation, and the analysis of those games' replays. Each
+// runs the same work on every machine and build, so its timings and
+// allocations can be held against a baseline's to catch a change that
+// makes the tools slower.
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/bot"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// WorkloadVersion is the version of the workload; a change to what it
+// runs bumps it, as results of another aren't comparable
+const WorkloadVersion = 1
+
+// Workloads, in the order they run
+const (
+	WorkloadGenerate = "generate"
+	WorkloadSimulate = "simulate"
+	WorkloadAnalyze  = "analyze"
+)
+
+// Names lists the workloads in order
+var Names = []string{WorkloadGenerate, WorkloadSimulate, WorkloadAnalyze}
+
+// Seed is what the workload's levels are generated and its games dealt
+// from
+const Seed = 20240601
+
+// Sizes are how much work each workload does
+type Sizes struct {
+	Levels int // generated, and played
+	Games  int // played on each level
+	Frames int // a game plays at most
+}
+
+// StandardSizes are the workload's
+var StandardSizes = Sizes{Levels: 8, Games: 1, Frames: 20 * 60}
+
+// Fixture is what the workloads work on: the levels the generation batch
+// makes and the replays of the games played on them, built once before
+// any is timed
+type Fixture struct {
+	Sizes   Sizes
+	Levels  []*level.Level
+	Replays [][]byte // JSON, as the analyzer reads them from files
+}
+
+// NewFixture generates the workload's levels and plays its games
+func NewFixture(sizes Sizes) (*Fixture, error) {
+	f := &Fixture{Sizes: sizes}
+	var err error
+	if f.Levels, err = generate(sizes); err != nil {
+		return nil, err
+	}
+	err = play(f, func(g bot.BatchGame) error {
+		data, err := json.Marshal(g.Replay)
+		f.Replays = append(f.Replays, data)
+		return err
+	})
+	return f, err
+}
+
+// generatorConfig is the game's own config, seeded, without the time
+// budget that makes a loaded machine generate other levels
+func generatorConfig() utils.Config {
+	config := utils.DefaultConfig()
+	config.GeneratorSeed = Seed
+	config.LevelTimeBudget = 0
+	return config
+}
+
+// generate runs the generation batch, writing nothing
+func generate(sizes Sizes) ([]*level.Level, error) {
+	g, err := generator.NewGenerator(generatorConfig())
+	if err != nil {
+		return nil, err
+	}
+	var levels []*level.Level
+	_, err = g.RunBatch(generator.BatchOptions{Prefix: "bench", Count: sizes.Levels, DryRun: true,
+		Emit: func(lvl *level.Level, _ generator.BatchEntry) error {
+			levels = append(levels, lvl)
+			return nil
+		}})
+	return levels, err
+}
+
+// play plays the reference games on the fixture's levels, one at a time
+func play(f *Fixture, fn func(bot.BatchGame) error) error {
+	return bot.PlayBatch(f.Levels, bot.BatchOptions{Games: f.Sizes.Games, Seed: Seed, Frames: f.Sizes.Frames,
+		Workers: 1, Start: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}, fn)
+}
+
+// analyze loads the fixture's replays and levels into a dataset and runs
+// the analyzer's replay analyses and built-in passes on it
+func analyze(f *Fixture) error {
+	data := analyzer.NewDataset()
+	for _, l := range f.Levels {
+		data.Levels[l.Name] = l
+	}
+	for _, raw := range f.Replays {
+		if _, err := data.AddReplay(raw); err != nil {
+			return err
+		}
+	}
+	grid := level.GridSize{Width: utils.DefaultConfig().LevelWidth, Height: utils.DefaultConfig().LevelHeight}
+	data.AnalyzeTechniques(grid)
+	data.AnalyzeFinesse(grid)
+	data.ChokePoints(grid, analyzer.DefaultChokeOptions())
+	_, _, err := analyzer.RunPasses(analyzer.PassInputs{Data: data}, builtinPasses)
+	return err
+}
+
+// builtinPasses are the analyzer's own passes, as plugins and the
+// config's pass commands register more
+var builtinPasses = func() []string {
+	var names []string
+	for _, p := range analyzer.Passes() {
+		names = append(names, p.Name())
+	}
+	return names
+}()
+
+// Run runs the named workload once on the fixture
+func (f *Fixture) Run(name string) error {
+	switch name {
+	case WorkloadGenerate:
+		_, err := generate(f.Sizes)
+		return err
+	case WorkloadSimulate:
+		return play(f, func(bot.BatchGame) error { return nil })
+	case WorkloadAnalyze:
+		return analyze(f)
+	}
+	return fmt.Errorf("unknown workload %q, want one of %v", name, Names)
+}
+
+// Result is a workload's measurement over its runs
+type Result struct {
+	Workload    string `json:"workload"`
+	Runs        int    `json:"runs"`
+	NsPerOp     int64  `json:"nsPerOp"`     // of the fastest run, the least disturbed by whatever else the machine does
+	MeanNs      int64  `json:"meanNs"`      // of every run
+	AllocsPerOp uint64 `json:"allocsPerOp"` // mean
+	BytesPerOp  uint64 `json:"bytesPerOp"`  // mean
+}
+
+// Measure runs the named workload runs times, collecting garbage before
+// each so one run's garbage isn't another's cost
+func (f *Fixture) Measure(name string, runs int) (Result, error) {
+	res := Result{Workload: name, Runs: max(runs, 1)}
+	var total time.Duration
+	var allocs, bytes uint64
+	for i := 0; i < res.Runs; i++ {
+		runtime.GC()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		err := f.Run(name)
+		took := time.Since(start)
+		runtime.ReadMemStats(&after)
+		if err != nil {
+			return res, fmt.Errorf("%s: %w", name, err)
+		}
+		total += took
+		if i == 0 || took.Nanoseconds() < res.NsPerOp {
+			res.NsPerOp = took.Nanoseconds()
+		}
+		allocs += after.Mallocs - before.Mallocs
+		bytes += after.TotalAlloc - before.TotalAlloc
+	}
+	n := uint64(res.Runs)
+	res.MeanNs = total.Nanoseconds() / int64(res.Runs)
+	res.AllocsPerOp, res.BytesPerOp = allocs/n, bytes/n
+	return res, nil
+}
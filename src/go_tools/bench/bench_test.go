@@ -0,0 +1,80 @@
+package bench
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var small = Sizes{Levels: 2, Games: 1, Frames: 600}
+
+func TestFixtureIsTheSameEveryRun(t *testing.T) {
+	a, err := NewFixture(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewFixture(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Levels) != small.Levels || len(a.Replays) != small.Levels*small.Games {
+		t.Fatalf("%d levels and %d replays", len(a.Levels), len(a.Replays))
+	}
+	for i := range a.Levels {
+		ha, _ := a.Levels[i].Hash()
+		hb, _ := b.Levels[i].Hash()
+		if ha != hb {
+			t.Errorf("level %d generated differently", i)
+		}
+	}
+	for i := range a.Replays {
+		if !bytes.Equal(a.Replays[i], b.Replays[i]) {
+			t.Errorf("game %d played differently", i)
+		}
+	}
+	for _, name := range Names {
+		res, err := a.Measure(name, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Runs != 2 || res.NsPerOp <= 0 || res.NsPerOp > res.MeanNs || res.AllocsPerOp == 0 {
+			t.Errorf("%s: %+v", name, res)
+		}
+	}
+	if err := a.Run("nope"); err == nil {
+		t.Error("no error running an unknown workload")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	base := NewReport([]Result{{Workload: WorkloadGenerate, NsPerOp: 1000, AllocsPerOp: 100, BytesPerOp: 4096}}, now)
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := base.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	base, err := LoadReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cur := NewReport([]Result{{Workload: WorkloadGenerate, NsPerOp: 1100, AllocsPerOp: 110, BytesPerOp: 2048}}, now)
+	deltas, err := Compare(base, cur, DefaultThresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := Regressions(deltas)
+	if len(deltas) != 3 || len(reg) != 1 || reg[0].Metric != MetricAllocs {
+		t.Errorf("deltas %+v, regressions %+v; want allocs alone", deltas, reg)
+	}
+
+	cur.Results = append(cur.Results, Result{Workload: WorkloadAnalyze})
+	if _, err := Compare(base, cur, DefaultThresholds); err == nil {
+		t.Error("no error comparing a workload the baseline lacks")
+	}
+	base.Version++
+	if _, err := Compare(base, cur, DefaultThresholds); err == nil {
+		t.Error("no error comparing another workload version")
+	}
+}
@@ -0,0 +1,144 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// Report is a run of the workloads, as a baseline is stored
+type Report struct {
+	Version   int       `json:"version"` // WorkloadVersion
+	Recorded  time.Time `json:"recorded"`
+	GoVersion string    `json:"goVersion"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	CPUs      int       `json:"cpus"`
+	Results   []Result  `json:"results"`
+}
+
+// NewReport is a report of results run on this machine at now
+func NewReport(results []Result, now time.Time) Report {
+	return Report{Version: WorkloadVersion, Recorded: now.UTC(), GoVersion: runtime.Version(),
+		OS: runtime.GOOS, Arch: runtime.GOARCH, CPUs: runtime.NumCPU(), Results: results}
+}
+
+// Machine is where the report's results were measured
+func (r Report) Machine() string {
+	return fmt.Sprintf("%s/%s, %d CPUs, %s", r.OS, r.Arch, r.CPUs, r.GoVersion)
+}
+
+// Result is the report's result of the workload, if it has one
+func (r Report) Result(workload string) (Result, bool) {
+	for _, res := range r.Results {
+		if res.Workload == workload {
+			return res, true
+		}
+	}
+	return Result{}, false
+}
+
+// LoadReport reads a report, such as a baseline
+func LoadReport(path string) (Report, error) {
+	var r Report
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Save writes the report to path, making its directory
+func (r Report) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Thresholds are the rises over a baseline that are regressions, as
+// fractions: 0.1 for 10%
+type Thresholds struct {
+	Time   float64 // of the fastest run
+	Allocs float64 // of allocations and of bytes allocated
+}
+
+// DefaultThresholds allow timings the noise of a quiet machine and
+// allocations, which the workload makes the same every run, next to none
+var DefaultThresholds = Thresholds{Time: 0.15, Allocs: 0.02}
+
+// Metrics compared
+const (
+	MetricTime   = "time"
+	MetricAllocs = "allocs"
+	MetricBytes  = "bytes"
+)
+
+// Delta is a metric of a workload against the baseline's
+type Delta struct {
+	Workload   string
+	Metric     string
+	Baseline   float64
+	Current    float64
+	Regression bool // rose by more than its threshold
+}
+
+// Change is the delta's rise as a fraction of the baseline, below zero
+// for a fall
+func (d Delta) Change() float64 {
+	if d.Baseline == 0 {
+		return 0
+	}
+	return d.Current/d.Baseline - 1
+}
+
+// Compare holds each of current's results against the baseline's of the
+// same workload. A baseline of another WorkloadVersion is an error, as is
+// one missing a workload current ran.
+func Compare(baseline, current Report, th Thresholds) ([]Delta, error) {
+	if baseline.Version != current.Version {
+		return nil, fmt.Errorf("baseline is of workload version %d, this build's is %d; record a new one", baseline.Version, current.Version)
+	}
+	var deltas []Delta
+	for _, cur := range current.Results {
+		base, ok := baseline.Result(cur.Workload)
+		if !ok {
+			return nil, fmt.Errorf("baseline has no %s workload; record a new one", cur.Workload)
+		}
+		for _, d := range []struct {
+			metric    string
+			base, cur float64
+			threshold float64
+		}{
+			{MetricTime, float64(base.NsPerOp), float64(cur.NsPerOp), th.Time},
+			{MetricAllocs, float64(base.AllocsPerOp), float64(cur.AllocsPerOp), th.Allocs},
+			{MetricBytes, float64(base.BytesPerOp), float64(cur.BytesPerOp), th.Allocs},
+		} {
+			delta := Delta{Workload: cur.Workload, Metric: d.metric, Baseline: d.base, Current: d.cur}
+			delta.Regression = delta.Change() > d.threshold
+			deltas = append(deltas, delta)
+		}
+	}
+	return deltas, nil
+}
+
+// Regressions are the deltas that are
+func Regressions(deltas []Delta) []Delta {
+	var out []Delta
+	for _, d := range deltas {
+		if d.Regression {
+			out = append(out, d)
+		}
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Defaults for BatchOptions left zero
+const (
+	DefaultBatchGames = 10
+	DefaultBatchDelay = sim.FrameRate / 2 // two pieces a second at most, about a practised player's pace
+)
+
+// BatchOptions set up a batch of bot games
+type BatchOptions struct {
+	Games     int         // of each level
+	Strengths []int       // beam bots play at, a game each in turn; default DefaultStrengths
+	Seed      int64       // deals a batch's first game, each game after it the next seed
+	Frames    int         // a game plays at most, DefaultFrames when zero
+	Delay     int         // frames a bot thinks on each new piece; below zero, none
+	Workers   int         // games played at once, default GOMAXPROCS
+	Spells    SpellPolicy // how the bots play pickups; the zero policy is DefaultSpellPolicy
+	Start     time.Time   // the first game starts at; each after it as the one before ends
+	Sim       sim.Options
+}
+
+// BatchGame is a game a batch played
+type BatchGame struct {
+	Level    string
+	Game     int // of the level, from 0
+	Strength int
+	Replay   *replay.Replay
+}
+
+// PlayBatch plays a batch of solo bot games, Games of each level, across
+// the workers, and hands fn each game's replay in order, the level's games
+// before the next level's; it stops at the first error a game or fn
+// returns. A bot of strength n plays as player "bot" n, so a dataset of
+// replays has a player for each strength. The replays are recorded as the
+// analyzer reads them, with their sessions starting one after another
+// from Start.
+func PlayBatch(levels []*level.Level, opts BatchOptions, fn func(BatchGame) error) error {
+	if opts.Games <= 0 {
+		opts.Games = DefaultBatchGames
+	}
+	if len(opts.Strengths) == 0 {
+		opts.Strengths = DefaultStrengths
+	}
+	if opts.Delay == 0 {
+		opts.Delay = DefaultBatchDelay
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	n := len(levels) * opts.Games
+	type result struct {
+		game BatchGame
+		err  error
+	}
+	done := make([]chan result, n)
+	for i := range done {
+		done[i] = make(chan result, 1)
+	}
+	jobs := make(chan int)
+	window := make(chan struct{}, 2*opts.Workers) // games played but not handed on yet
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(stop) // before waiting, for the workers to run out of games
+	crash.Go(func() {
+		defer close(jobs)
+		for i := 0; i < n; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-stop:
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-stop:
+				return
+			}
+		}
+	})
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		crash.Go(func() {
+			defer wg.Done()
+			for i := range jobs {
+				game, err := playBatchGame(levels[i/opts.Games], i%opts.Games, int64(i), opts)
+				done[i] <- result{game, err}
+			}
+		})
+	}
+
+	at := opts.Start
+	for i := 0; i < n; i++ {
+		res := <-done[i]
+		if res.err != nil {
+			return res.err
+		}
+		res.game.Replay.StartedAt = at
+		at = at.Add(time.Duration(res.game.Replay.Result.DurationMs) * time.Millisecond)
+		if err := fn(res.game); err != nil {
+			return err
+		}
+		<-window
+	}
+	return nil
+}
+
+// playBatchGame plays the level's game, the batch's i'th
+func playBatchGame(lvl *level.Level, game int, i int64, opts BatchOptions) (BatchGame, error) {
+	strength := opts.Strengths[game%len(opts.Strengths)]
+	player := fmt.Sprintf("bot%d", strength)
+	simOpts := opts.Sim
+	simOpts.Seed, simOpts.Players = opts.Seed+i, []string{player}
+	g, err := sim.New(lvl, simOpts)
+	if err != nil {
+		return BatchGame{}, fmt.Errorf("level %s game %d: %w", lvl.Name, game, err)
+	}
+	frames := opts.Frames
+	if frames <= 0 {
+		frames = DefaultFrames
+	}
+	Play(g, []Bot{{Player: player, Policy: ForStrength(strength), Delay: max(opts.Delay, 0), Hold: true, Spells: opts.Spells}}, frames)
+	r := g.Replay(fmt.Sprintf("%s-%s-%d", lvl.Name, player, game))
+	r.Players[0].Name = fmt.Sprintf("beam bot, strength %d", strength)
+	return BatchGame{Level: lvl.Name, Game: game, Strength: strength, Replay: r}, nil
+}
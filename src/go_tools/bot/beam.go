@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Strengths of ForStrength, weakest first
+const (
+	MinStrength = 1
+	MaxStrength = 5
+)
+
+// Beam searches the known queue, the piece in play and the preview,
+// keeping the Width best boards after each piece down to Depth pieces,
+// and places the piece in play where the best board it leads to begins
+type Beam struct {
+	Width   int
+	Depth   int
+	Weights Weights
+}
+
+// ForStrength is the beam search of a strength from MinStrength, which
+// looks no further than the piece in play as Greedy does, to MaxStrength
+func ForStrength(strength int) Beam {
+	strength = min(max(strength, MinStrength), MaxStrength)
+	widths := [...]int{1, 3, 6, 10, 16}
+	return Beam{Width: widths[strength-1], Depth: strength, Weights: DefaultWeights}
+}
+
+// node is a board the search reached, the placement it began with and
+// the pieces known to come after it
+type node struct {
+	first sim.Placement
+	board sim.Board
+	next  []string
+	lines int
+	score float64
+}
+
+// Choose implements Policy
+func (p Beam) Choose(g *sim.Game, player string, placements []sim.Placement) (sim.Placement, bool) {
+	if len(placements) == 0 {
+		return sim.Placement{}, false
+	}
+	width, depth := max(p.Width, 1), max(p.Depth, 1)
+	start := g.Board(player)
+	st, _ := g.State(player)
+	var beam []node
+	for _, pl := range placements {
+		b := start.Clone()
+		lines := b.Lock(pl.Piece)
+		beam = append(beam, node{first: pl, board: b, next: coming(st, pl), lines: lines, score: p.Weights.Score(Measure(b, lines))})
+	}
+	beam = p.keep(beam, width)
+	for ply := 1; ply < depth; ply++ {
+		var next []node
+		for _, n := range beam {
+			if len(n.next) == 0 {
+				continue
+			}
+			for _, pc := range drops(n.board, n.next[0]) {
+				b := n.board.Clone()
+				lines := n.lines + b.Lock(pc)
+				next = append(next, node{first: n.first, board: b, next: n.next[1:], lines: lines, score: p.Weights.Score(Measure(b, lines))})
+			}
+		}
+		if len(next) == 0 {
+			break // every board tops out on its next piece or has none coming; the deepest that didn't wins
+		}
+		beam = p.keep(next, width)
+	}
+	return beam[0].first, true
+}
+
+// keep is the width best nodes, best first, earlier ones winning ties
+func (p Beam) keep(nodes []node, width int) []node {
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].score > nodes[j].score })
+	return nodes[:min(width, len(nodes))]
+}
@@ -0,0 +1,176 @@
+// Package bot plays levels in the headless simulator. A bot hands each of
+// its player's pieces to a policy, which picks where the piece goes among
+// the placements the simulator finds reachable, and feeds the game the
+// inputs that take it there. The policies here judge a board by a weighted
+// sum of its features: height, holes, bumpiness, lines cleared and rows a
+// cell short of clearing.
+package bot
+
+import (
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// DefaultFrames is the frames PlayLevel plays when given none: five
+// minutes of play
+const DefaultFrames = 5 * 60 * sim.FrameRate
+
+// Features are what the evaluation sees of a board after a placement
+type Features struct {
+	Height    int `json:"height"` // of every column, summed
+	MaxHeight int `json:"maxHeight"`
+	Holes     int `json:"holes"`     // empty cells with a block above them
+	Bumpiness int `json:"bumpiness"` // height steps between neighbouring columns
+	Lines     int `json:"lines"`     // cleared by the placement
+	Potential int `json:"potential"` // rows one cell short of full
+}
+
+// Measure reads the features of a board a placement cleared lines on
+func Measure(b sim.Board, lines int) Features {
+	f := Features{Lines: lines}
+	width := b.Width()
+	heights := make([]int, width)
+	for x := 0; x < width; x++ {
+		covered := false
+		for y := range b {
+			switch {
+			case !b[y][x].Empty() && !covered:
+				covered, heights[x] = true, len(b)-y
+			case b[y][x].Empty() && covered:
+				f.Holes++
+			}
+		}
+		f.Height += heights[x]
+		f.MaxHeight = max(f.MaxHeight, heights[x])
+		if x > 0 {
+			f.Bumpiness += abs(heights[x] - heights[x-1])
+		}
+	}
+	for _, row := range b {
+		empty := 0
+		for _, c := range row {
+			if c.Empty() {
+				empty++
+			}
+		}
+		if empty == 1 {
+			f.Potential++
+		}
+	}
+	return f
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Weights weigh the features into a board's score, higher being better
+type Weights struct {
+	Height    float64 `json:"height"`
+	MaxHeight float64 `json:"maxHeight"`
+	Holes     float64 `json:"holes"`
+	Bumpiness float64 `json:"bumpiness"`
+	Lines     float64 `json:"lines"`
+	Potential float64 `json:"potential"`
+}
+
+// DefaultWeights are the usual greedy weights, the analyzer's bot's, with
+// a little credit for rows waiting on one cell
+var DefaultWeights = Weights{Height: -0.51, Holes: -0.36, Bumpiness: -0.18, Lines: 0.76, Potential: 0.1}
+
+// Score weighs the features
+func (w Weights) Score(f Features) float64 {
+	return w.Height*float64(f.Height) + w.MaxHeight*float64(f.MaxHeight) + w.Holes*float64(f.Holes) +
+		w.Bumpiness*float64(f.Bumpiness) + w.Lines*float64(f.Lines) + w.Potential*float64(f.Potential)
+}
+
+// Policy picks where a player's piece goes
+type Policy interface {
+	// Choose picks one of the placements of the player's piece, or of the
+	// piece holding brings, led by the hold; false to leave the piece be
+	Choose(g *sim.Game, player string, placements []sim.Placement) (sim.Placement, bool)
+}
+
+// coming are the pieces known to come after the placement's: the
+// player's preview, less its first when the placement holds it into play
+func coming(st sim.State, pl sim.Placement) []string {
+	if len(pl.Inputs) > 0 && pl.Inputs[0] == replay.ActionHold && st.Hold == "" && len(st.Next) > 0 {
+		return st.Next[1:]
+	}
+	return st.Next
+}
+
+// Bot plays a player of a game by a policy
+type Bot struct {
+	Player string
+	Policy Policy
+	Delay  int         // frames it waits with each new piece before moving it
+	Hold   bool        // weigh holding each piece, choosing among where the piece holding brings goes too
+	Spells SpellPolicy // how it goes after pickups and when it casts the spells it holds
+}
+
+// Play plays the game's bots until the game is over or frames have been
+// played. With each new piece a bot casts the spells its spell policy
+// finds worth it, then places the piece, or one its spell policy has
+// grab a pickup instead. A bot whose policy leaves a piece be lets
+// gravity have it.
+func Play(g *sim.Game, bots []Bot, frames int) {
+	waited := make(map[string]int, len(bots))
+	moved := make(map[string]int, len(bots)) // the piece, by pieces locked, last moved
+	for i := range bots {
+		moved[bots[i].Player] = -1
+	}
+	for i := 0; i < frames && !g.Over(); i++ {
+		g.Tick()
+		for _, b := range bots {
+			st, ok := g.State(b.Player)
+			if !ok || st.Piece == nil || moved[b.Player] == st.Pieces {
+				continue
+			}
+			if waited[b.Player] < b.Delay {
+				waited[b.Player]++
+				continue
+			}
+			waited[b.Player] = 0
+			if b.Spells.cast(g, b.Player) {
+				continue // the piece in play swaps on the next frame; that one is placed
+			}
+			moved[b.Player] = st.Pieces
+			placements := g.Placements(b.Player)
+			if b.Hold {
+				placements = append(placements, g.HoldPlacements(b.Player)...)
+			}
+			pl, ok := b.Policy.Choose(g, b.Player, placements)
+			if !ok {
+				continue
+			}
+			pl = b.Spells.grab(g, b.Player, b.Policy, placements, pl)
+			for _, input := range pl.Inputs {
+				g.Input(b.Player, input)
+			}
+		}
+	}
+}
+
+// PlayLevel plays a game of the level with a bot of the policy for each of
+// the options' players, playing pickups by DefaultSpellPolicy, for frames
+// or DefaultFrames when zero
+func PlayLevel(lvl *level.Level, policy Policy, opts sim.Options, frames int) (*sim.Game, error) {
+	g, err := sim.New(lvl, opts)
+	if err != nil {
+		return nil, err
+	}
+	if frames <= 0 {
+		frames = DefaultFrames
+	}
+	var bots []Bot
+	for _, id := range g.Players() {
+		bots = append(bots, Bot{Player: id, Policy: policy, Hold: true, Spells: DefaultSpellPolicy()})
+	}
+	Play(g, bots, frames)
+	return g, nil
+}
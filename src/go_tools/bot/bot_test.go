@@ -0,0 +1,462 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+func TestMeasure(t *testing.T) {
+	b := sim.NewBoard(4, 4)
+	for _, c := range []level.Point{{X: 0, Y: 1}, {X: 0, Y: 3}, {X: 1, Y: 3}, {X: 2, Y: 3}} {
+		b[c.Y][c.X] = sim.Cell{Type: "O"}
+	}
+	want := Features{Height: 5, MaxHeight: 3, Holes: 1, Bumpiness: 3, Lines: 2, Potential: 1}
+	if f := Measure(b, 2); f != want {
+		t.Errorf("features %+v, want %+v", f, want)
+	}
+}
+
+func TestPoliciesPlayLevels(t *testing.T) {
+	lvl := level.New("open", 10, 20)
+	lvl.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+	lvl.Objectives = []level.Objective{{Kind: sim.ObjectiveClearLines, Target: 10}}
+	lines := make(map[string]int)
+	for _, name := range Policies {
+		policy, err := NewPolicy(name, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := PlayLevel(lvl, policy, sim.Options{Seed: 5}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, _ := g.State("p1")
+		lines[name] = st.Lines
+		if name != PolicyRandom && (!g.Complete("p1") || st.ToppedOut) {
+			t.Errorf("%s: %+v", name, st)
+		}
+	}
+	if lines[PolicyRandom] >= lines[PolicyGreedy] {
+		t.Errorf("lines cleared %v: random kept up with greedy", lines)
+	}
+	if _, err := NewPolicy("minimax", 0); err == nil {
+		t.Error("an unknown policy was accepted")
+	}
+}
+
+func TestBotsHoldWhereAllowed(t *testing.T) {
+	lvl := level.New("open", 10, 20)
+	lvl.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+	holds := func(opts sim.Options) int {
+		g, err := sim.New(lvl, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		Play(g, []Bot{{Player: "p1", Policy: ForStrength(2), Delay: 10, Hold: true}}, 20*sim.FrameRate)
+		n := 0
+		for _, in := range g.Replay("s").Inputs {
+			if in.Action == replay.ActionHold {
+				n++
+			}
+		}
+		if st, _ := g.State("p1"); st.ToppedOut || st.Pieces < 20 {
+			t.Errorf("options %+v: %+v", opts, st)
+		}
+		return n
+	}
+	if n := holds(sim.Options{Seed: 2}); n == 0 {
+		t.Error("the bot never held")
+	}
+	// nothing held and nothing in sight, holding can't be weighed
+	if n := holds(sim.Options{Seed: 2, Preview: -1}); n != 0 {
+		t.Errorf("the bot held %d times blind", n)
+	}
+	lvl.SpecialRules[sim.HoldRule] = 0
+	if n := holds(sim.Options{Seed: 2}); n != 0 {
+		t.Errorf("the bot held %d times on a level without hold", n)
+	}
+}
+
+func TestBotsWaitAndShareAGame(t *testing.T) {
+	lvl := level.New("duel", 8, 16)
+	lvl.SpawnPoints = []level.Point{{X: 4, Y: 0}}
+	g, err := sim.New(lvl, sim.Options{Players: []string{"fast", "slow"}, Seed: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	greedy, _ := NewPolicy(PolicyGreedy, 0)
+	Play(g, []Bot{{Player: "fast", Policy: greedy}, {Player: "slow", Policy: greedy, Delay: 20}}, 120)
+	first := map[string]int{}
+	for _, ev := range g.Replay("duel").EventsOf(replay.EventLock) {
+		if _, ok := first[ev.Player]; !ok {
+			first[ev.Player] = ev.Frame
+		}
+	}
+	if first["fast"] != 1 || first["slow"] != 21 {
+		t.Errorf("first locks %v, want fast on frame 1 and slow on 21", first)
+	}
+}
+
+func TestBeamEstimatesDifficulty(t *testing.T) {
+	open := level.New("open", 10, 20)
+	// a stack to within three rows of the top, its well capped
+	stacked := level.New("stacked", 10, 20)
+	stacked.Blocks = append(stacked.Blocks, level.Block{Type: "O", X: 9, Y: 2})
+	for y := 3; y < 20; y++ {
+		for x := 0; x < 9; x++ {
+			stacked.Blocks = append(stacked.Blocks, level.Block{Type: "O", X: x, Y: y})
+		}
+	}
+	easy, err := EstimateDifficulty(open, EstimateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hard, _ := EstimateDifficulty(stacked, EstimateOptions{})
+	if len(easy.Strengths) != len(DefaultStrengths) || easy.Score >= hard.Score || hard.Score < 0.9 {
+		t.Errorf("open level %+v, stacked %+v", easy, hard)
+	}
+	if again, _ := EstimateDifficulty(open, EstimateOptions{}); again.Score != easy.Score {
+		t.Errorf("the estimate moved from %v to %v", easy.Score, again.Score)
+	}
+	for _, s := range easy.Strengths {
+		if s.Pieces != DefaultEstimatePieces || s.ToppedOut {
+			t.Errorf("strength %d on the open level %+v", s.Strength, s)
+		}
+	}
+	if b := ForStrength(MaxStrength + 2); b.Depth != MaxStrength {
+		t.Errorf("strength past the strongest %+v", b)
+	}
+}
+
+func TestPlaySpellsCastsPickups(t *testing.T) {
+	lvl := level.New("pickups", 10, 20)
+	lvl.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"O"}}
+	for x, spell := range []string{level.SpellFreeze, level.SpellGravityFlip} {
+		lvl.Pickups = append(lvl.Pickups, level.Pickup{Spell: spell, X: 4 + x, Y: 1})
+	}
+	r, err := PlaySpells(lvl, sim.Options{Seed: 1}, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missed := r.Uncollected(lvl); len(missed) > 0 || r.Collected[level.SpellFreeze] != 2 {
+		t.Errorf("pickups missed %v: %+v", missed, r)
+	}
+	if r.Cast[level.SpellFreeze] != 2 || r.Cast[level.SpellGravityFlip] != 2 {
+		t.Errorf("spells cast %v", r.Cast)
+	}
+}
+
+func TestSpellPolicies(t *testing.T) {
+	// a pickup atop each of two pillars, out of a greedy bot's way
+	lvl := level.New("pillars", 10, 20)
+	lvl.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+	lvl.Objectives = []level.Objective{{Kind: sim.ObjectiveCastSpell, Target: 2}}
+	for y := 14; y < 20; y++ {
+		lvl.Blocks = append(lvl.Blocks, level.Block{Type: "O", X: 0, Y: y}, level.Block{Type: "O", X: 9, Y: y})
+	}
+	lvl.Pickups = []level.Pickup{{Spell: level.SpellClearLine, X: 0, Y: 13}, {Spell: level.SpellClearLine, X: 9, Y: 13}}
+	pieces := func(spells SpellPolicy) []int {
+		est, err := EstimateDifficulty(lvl, EstimateOptions{Spells: spells})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []int
+		for _, s := range est.Strengths {
+			if !s.Complete {
+				t.Errorf("%+v: strength %d didn't collect the pickups: %+v", spells, s.Strength, s)
+			}
+			out = append(out, s.Pieces)
+		}
+		return out
+	}
+	always, safely, never := pieces(SpellPolicy{Grab: GrabAlways}), pieces(SpellPolicy{}), pieces(SpellPolicy{Grab: GrabNever})
+	for i := range never {
+		if always[i] > safely[i] || safely[i] >= never[i] {
+			t.Errorf("strength %d collected the pickups in %d pieces grabbing always, %d safely, %d never",
+				DefaultStrengths[i], always[i], safely[i], never[i])
+		}
+	}
+
+	// a clear line picked up as the first piece spawns over it, cast once
+	// the stack is high
+	casts := func(stack int, spells SpellPolicy) int {
+		lvl := level.New("stack", 10, 20)
+		lvl.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+		lvl.Pieces = &level.PieceSequence{Fixed: []string{"O"}}
+		lvl.Pickups = []level.Pickup{{Spell: level.SpellClearLine, X: 4, Y: 1}}
+		for y := 20 - stack; y < 20; y++ {
+			for x := 0; x < 9; x++ {
+				lvl.Blocks = append(lvl.Blocks, level.Block{Type: "O", X: x, Y: y})
+			}
+		}
+		g, _ := sim.New(lvl, sim.Options{})
+		g.Tick()
+		spells.cast(g, "p1")
+		g.Tick()
+		return len(g.Replay("s").Spells)
+	}
+	if n := casts(12, SpellPolicy{}); n != 1 {
+		t.Errorf("cast %d clear lines on a high stack", n)
+	}
+	if n := casts(4, SpellPolicy{}); n != 0 {
+		t.Errorf("cast %d clear lines on a low stack", n)
+	}
+	if n := casts(4, SpellPolicy{Cast: CastAtOnce}); n != 1 {
+		t.Errorf("cast %d clear lines at once", n)
+	}
+	if n := casts(12, SpellPolicy{Cast: CastNever}); n != 0 {
+		t.Errorf("cast %d clear lines never casting", n)
+	}
+
+	path := filepath.Join(t.TempDir(), "spells.json")
+	os.WriteFile(path, []byte(`{"grab": "always"}`), 0644)
+	if s, err := LoadSpellPolicy(path); err != nil || s.Grab != GrabAlways || s.Cast != CastUseful {
+		t.Errorf("loaded %+v, %v", s, err)
+	}
+	for _, bad := range []SpellPolicy{{Grab: "sometimes"}, {Cast: "later"}, {Height: 1.5}} {
+		if bad.Validate() == nil {
+			t.Errorf("spell policy %+v validated", bad)
+		}
+	}
+}
+
+func TestPlayMatchExchangesGarbage(t *testing.T) {
+	lvl := level.New("versus", 10, 20)
+	lvl.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+	greedy, _ := NewPolicy(PolicyGreedy, 0)
+	random, _ := NewPolicy(PolicyRandom, 3)
+	attack := sim.DefaultAttack()
+	attack.Lines[1] = 1
+	r, err := PlayMatch(lvl, []Policy{greedy, random}, sim.Options{Seed: 4, Versus: &attack}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1, p2 := r.Players["p1"], r.Players["p2"]
+	if r.Winner != "p1" || r.Outcome != replay.OutcomeWin || !p2.ToppedOut {
+		t.Errorf("match %+v", r)
+	}
+	if p1.Sent == 0 || p2.Received+p2.Countered > p1.Sent || p1.Received+p1.Countered > p2.Sent {
+		t.Errorf("garbage sent and taken %+v", r.Players)
+	}
+	if _, err := PlayMatch(lvl, []Policy{greedy}, sim.Options{}, 0); err == nil {
+		t.Error("a match of one was played")
+	}
+}
+
+func TestPlayTournament(t *testing.T) {
+	lvl := level.New("versus", 10, 20)
+	lvl.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+	// a greedy bot, one sending a row more for every clear, and a random one
+	patch := sim.DefaultAttack()
+	for i := range patch.Lines {
+		patch.Lines[i]++
+	}
+	entrants := []Entrant{
+		{Name: "greedy", Policy: PolicyGreedy, Delay: -1},
+		{Name: "patched", Policy: PolicyGreedy, Delay: -1, Attack: &patch},
+		{Name: "random", Policy: PolicyRandom, Delay: -1},
+	}
+	report, err := PlayTournament([]*level.Level{lvl}, entrants, TournamentOptions{Games: 2, Seed: 3, Frames: 40 * sim.FrameRate, Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Games != 6 || len(report.Matchups) != 3 || len(report.Standings) != 3 {
+		t.Fatalf("report %+v", report)
+	}
+	for _, s := range report.Standings {
+		if s.Played != 4 || s.Wins+s.Losses+s.Draws != 4 || s.Points != float64(s.Wins)+float64(s.Draws)/2 {
+			t.Errorf("standing %+v", s)
+		}
+	}
+	if last := report.Standings[2]; last.Entrant != "random" || last.Wins != 0 {
+		t.Errorf("standings %+v", report.Standings)
+	}
+	if m := report.Matchups[0]; m.A != "greedy" || m.B != "patched" || m.Games != 2 {
+		t.Errorf("first pairing %+v", m)
+	}
+	order := map[string]int{"greedy": 0, "patched": 1, "random": 2}
+	for _, g := range report.Interesting {
+		if len(g.Reasons) == 0 || g.Replay == nil || g.Replay.Players[0].ID != g.Players[0] {
+			t.Errorf("kept game %+v", g)
+		}
+		if swapped := order[g.Players[0]] > order[g.Players[1]]; swapped != (g.Game%2 == 1) {
+			t.Errorf("game %d played with %v first", g.Game, g.Players)
+		}
+	}
+	if len(report.Interesting) < 3 {
+		t.Errorf("kept %d games, want each pairing's longest at least", len(report.Interesting))
+	}
+
+	if _, err := PlayTournament([]*level.Level{lvl}, entrants[:1], TournamentOptions{}); err == nil {
+		t.Error("a tournament of one was played")
+	}
+	if err := ValidateEntrants([]Entrant{{Name: "a"}, {Name: "a"}}); err == nil {
+		t.Error("two entrants of one name validated")
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "patch.json"), []byte(`{"lines": [0, 1, 2, 3, 5]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "entrants.json"), []byte(`[{"name": "a", "strength": 1}, {"name": "b", "attackFile": "patch.json"}]`), 0644)
+	loaded, err := LoadEntrants(filepath.Join(dir, "entrants.json"))
+	if err != nil || len(loaded) != 2 || loaded[1].Attack == nil || loaded[1].Attack.Lines[1] != 1 || loaded[1].Attack.Delay != sim.GarbageDelay {
+		t.Errorf("loaded %+v, %v", loaded, err)
+	}
+}
+
+func TestPlayBatch(t *testing.T) {
+	open := level.New("open", 10, 20)
+	open.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+	narrow := level.New("narrow", 6, 14)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := BatchOptions{Games: 3, Strengths: []int{1, 2}, Seed: 7, Frames: 20 * sim.FrameRate, Workers: 3, Start: start}
+	var games []BatchGame
+	err := PlayBatch([]*level.Level{open, narrow}, opts, func(g BatchGame) error {
+		games = append(games, g)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 6 {
+		t.Fatalf("played %d games, want 3 of each of 2 levels", len(games))
+	}
+	at := start
+	for i, g := range games {
+		r := g.Replay
+		wantLevel, wantPlayer := []string{"open", "narrow"}[i/3], []string{"bot1", "bot2"}[i%3%2]
+		if g.Level != wantLevel || g.Game != i%3 || r.Players[0].ID != wantPlayer || r.Seed != 7+int64(i) {
+			t.Errorf("game %d: %s game %d by %s seeded %d", i, g.Level, g.Game, r.Players[0].ID, r.Seed)
+		}
+		if !r.StartedAt.Equal(at) {
+			t.Errorf("game %d started at %v, want %v", i, r.StartedAt, at)
+		}
+		at = at.Add(time.Duration(r.Result.DurationMs) * time.Millisecond)
+		if err := r.Validate(); err != nil {
+			t.Errorf("game %d: %v", i, err)
+		}
+		if len(r.EventsOf(replay.EventLock)) == 0 {
+			t.Errorf("game %d locked no pieces", i)
+		}
+	}
+
+	opts.Workers = 1
+	i := 0
+	PlayBatch([]*level.Level{open, narrow}, opts, func(g BatchGame) error {
+		if !reflect.DeepEqual(g.Replay, games[i].Replay) {
+			t.Errorf("game %d played differently on one worker", i)
+		}
+		i++
+		return nil
+	})
+	stop := errors.New("stop")
+	i = 0
+	if err := PlayBatch([]*level.Level{open, narrow}, opts, func(BatchGame) error { i++; return stop }); err != stop || i != 1 {
+		t.Errorf("stopping on the first game returned %v after %d games", err, i)
+	}
+}
+
+func TestCalibrateLadder(t *testing.T) {
+	open := level.New("open", 10, 20)
+	rare := level.New("rare", 10, 20)
+	opts := LadderOptions{Strengths: []int{3, 1}}
+	est, err := EstimateDifficulty(open, EstimateOptions{Strengths: opts.Strengths})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range est.Strengths {
+		if s.ClearRate <= 0 || s.ClearRate >= 1 {
+			t.Fatalf("strength %d clears %v of the open level, want some", s.Strength, s.ClearRate)
+		}
+	}
+	// the three lowest rated of ten players top out, the rest clear it
+	var replays []*replay.Replay
+	for i := 0; i < 10; i++ {
+		r := &replay.Replay{Level: "open", Players: []replay.Player{{ID: fmt.Sprintf("p%d", i), Rating: 1000 + 100*float64(i)}}}
+		r.Result.Outcome = replay.OutcomeCleared
+		if i < 3 {
+			r.Result.Outcome = replay.OutcomeTopOut
+		}
+		replays = append(replays, r)
+	}
+	for i := 0; i < 2; i++ {
+		replays = append(replays, &replay.Replay{Level: "rare", Players: []replay.Player{{ID: "p0", Rating: 1000}}})
+	}
+	replays = append(replays, &replay.Replay{Level: "open", Players: []replay.Player{{ID: "new"}}})
+
+	ladder, err := CalibrateLadder([]*level.Level{open, rare}, replays, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ladder.Players != 10 || ladder.Levels != 1 || ladder.Sessions != 10 || len(ladder.Rungs) != 2 {
+		t.Fatalf("ladder %+v", ladder)
+	}
+	for i, r := range ladder.Rungs {
+		if r.Strength != []int{1, 3}[i] || r.Percentile != 30 || r.Rating != 1250 || r.Beats != 0.3 {
+			t.Errorf("rung %d = %+v, want the 30th percentile", i, r)
+		}
+	}
+	if s, ok := ladder.Strength(30); !ok || s != 1 {
+		t.Errorf("strength of the 30th percentile = %d, %t", s, ok)
+	}
+	if _, ok := ladder.Strength(31); ok {
+		t.Error("a strength plays like the 31st percentile")
+	}
+	beaten := Estimate{Strengths: []StrengthResult{{Strength: 3, Complete: true}, {Strength: 1}}}
+	if pct, ok := beaten.BeatableAt(ladder); !ok || pct != 30 {
+		t.Errorf("beatable at %v, %t", pct, ok)
+	}
+	if _, ok := est.BeatableAt(ladder); ok {
+		t.Error("the open level, which has no objectives, is beatable")
+	}
+
+	path := filepath.Join(t.TempDir(), "ladder.json")
+	if err := ladder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if back, err := LoadLadder(path); err != nil || !reflect.DeepEqual(back, ladder) {
+		t.Errorf("loaded %+v, %v", back, err)
+	}
+	if _, err := CalibrateLadder([]*level.Level{rare}, replays, opts); err == nil {
+		t.Error("calibrated against too few sessions")
+	}
+}
+
+func TestEstimateClearTime(t *testing.T) {
+	few := level.New("few", 10, 20)
+	few.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+	few.Objectives = []level.Objective{{Kind: sim.ObjectiveClearLines, Target: 2}}
+	many := level.New("many", 10, 20)
+	many.SpawnPoints = few.SpawnPoints
+	many.Objectives = []level.Objective{{Kind: sim.ObjectiveClearLines, Target: 8}}
+	opts := RolloutOptions{Rollouts: 4, Strength: 1, Frames: 120 * sim.FrameRate, Seed: 3}
+	fast, err := EstimateClearTime(few, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow, _ := EstimateClearTime(many, opts)
+	if fast.Cleared != 4 || len(fast.Seconds) != 4 || fast.P10 > fast.P50 || fast.P50 > fast.P90 || fast.Mean <= 0 {
+		t.Fatalf("two lines %+v", fast)
+	}
+	if fast.Score <= 0 || fast.Score >= slow.Score || slow.Mean <= fast.Mean && slow.Cleared == slow.Rollouts {
+		t.Errorf("two lines %+v, eight %+v", fast, slow)
+	}
+	opts.Workers = 1
+	if again, _ := EstimateClearTime(few, opts); !reflect.DeepEqual(again, fast) {
+		t.Errorf("one worker estimated %+v, not %+v", again, fast)
+	}
+	if none, _ := EstimateClearTime(level.New("endless", 10, 20), opts); none.Cleared != 0 || none.Score != 1 {
+		t.Errorf("a level without objectives %+v", none)
+	}
+	if score := ClearTimeEstimator(opts)(few); score != fast.Score {
+		t.Errorf("the estimator scored %v, not %v", score, fast.Score)
+	}
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Defaults for EstimateOptions left zero
+const (
+	DefaultEstimatePieces = 40
+	DefaultEstimateSeed   = 1
+)
+
+// DefaultStrengths are the strengths a difficulty estimate plays at
+var DefaultStrengths = []int{1, 2, 3}
+
+// EstimateOptions set up a difficulty estimate
+type EstimateOptions struct {
+	Strengths []int       // default DefaultStrengths
+	Pieces    int         // each strength plays, at most
+	Seed      int64       // deals the pieces; every strength is dealt the same
+	Spells    SpellPolicy // how the bots play pickups; the zero policy is DefaultSpellPolicy
+	Sim       sim.Options
+}
+
+// StrengthResult is how a beam bot of a strength did on a level
+type StrengthResult struct {
+	Strength  int     `json:"strength"`
+	Pieces    int     `json:"pieces"` // locked before the end, a top-out or the limit
+	Lines     int     `json:"lines"`
+	ToppedOut bool    `json:"toppedOut"`
+	Complete  bool    `json:"complete"` // the level's objectives were met
+	ClearRate float64 `json:"clearRate"`
+}
+
+// Estimate is a level's simulated difficulty
+type Estimate struct {
+	Strengths []StrengthResult `json:"strengths"`
+	Score     float64          `json:"score"` // 0 trivial to 1 hardest
+}
+
+// EstimateDifficulty plays the level with a beam bot at each strength and
+// scores it by how little they clear: the mean over the strengths of one
+// less the clear rate, lines cleared a piece relative to every placed cell
+// ending up in a cleared line. Meeting the level's objectives counts as
+// a full clear rate, and topping out as none.
+func EstimateDifficulty(lvl *level.Level, opts EstimateOptions) (Estimate, error) {
+	if len(opts.Strengths) == 0 {
+		opts.Strengths = DefaultStrengths
+	}
+	if opts.Pieces <= 0 {
+		opts.Pieces = DefaultEstimatePieces
+	}
+	if opts.Seed == 0 {
+		opts.Seed = DefaultEstimateSeed
+	}
+	simOpts := opts.Sim
+	simOpts.Seed, simOpts.Players = opts.Seed, nil
+
+	var est Estimate
+	total := 0.0
+	for _, strength := range opts.Strengths {
+		g, err := sim.New(lvl, simOpts)
+		if err != nil {
+			return est, err
+		}
+		res := play(g, Bot{Policy: ForStrength(strength), Hold: true, Spells: opts.Spells}, opts.Pieces)
+		res.Strength = strength
+		total += 1 - res.ClearRate
+		est.Strengths = append(est.Strengths, res)
+	}
+	est.Score = total / float64(len(opts.Strengths))
+	return est, nil
+}
+
+// Estimator is EstimateDifficulty's score with the options, the shape
+// of the generator's difficulty estimators; a level that can't be played
+// scores hardest
+func Estimator(opts EstimateOptions) func(*level.Level) float64 {
+	return func(lvl *level.Level) float64 {
+		est, err := EstimateDifficulty(lvl, opts)
+		if err != nil {
+			return 1
+		}
+		return est.Score
+	}
+}
+
+// play plays the game's one player with the bot until they locked pieces,
+// topped out or completed the level
+func play(g *sim.Game, bot Bot, pieces int) StrengthResult {
+	id := g.Players()[0]
+	bot.Player = id
+	b := []Bot{bot}
+	// a piece a frame once it spawns; the frames bound a policy leaving
+	// pieces to gravity
+	for frames := 0; frames < pieces*sim.FrameRate*len(g.Board(id)); frames++ {
+		if st, _ := g.State(id); st.Pieces >= pieces || g.Over() {
+			break
+		}
+		Play(g, b, 1)
+	}
+	st, _ := g.State(id)
+	res := StrengthResult{Pieces: st.Pieces, Lines: st.Lines, ToppedOut: st.ToppedOut, Complete: g.Complete(id)}
+	switch {
+	case res.Complete:
+		res.ClearRate = 1
+	case res.ToppedOut || st.Pieces == 0:
+	default:
+		res.ClearRate = min(float64(st.Lines*g.Board(id).Width())/float64(st.Pieces*4), 1)
+	}
+	return res
+}
@@ -0,0 +1,291 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Defaults for LadderOptions left zero
+const (
+	DefaultLadderBins        = 10
+	DefaultLadderMinSessions = 3
+)
+
+// LadderOptions set up a ladder calibration
+type LadderOptions struct {
+	Strengths   []int // calibrated, default MinStrength to MaxStrength
+	Bins        int   // of the players' skill percentiles
+	MinSessions int   // levels with fewer rated solo sessions are left out
+	Estimate    EstimateOptions
+}
+
+// Rung is where a strength stands among the rated players
+type Rung struct {
+	Strength   int     `json:"strength"`
+	Percentile float64 `json:"percentile"` // of players by rating, 0 to 100, the bot plays like
+	Rating     float64 `json:"rating"`     // at the percentile
+	Sessions   int     `json:"sessions"`   // compared against
+	Beats      float64 `json:"beats"`      // share of those sessions the bot did better than
+}
+
+// Ladder maps beam bot strengths onto the skill percentiles of rated
+// players, weakest first
+type Ladder struct {
+	Players  int    `json:"players"`
+	Sessions int    `json:"sessions"`
+	Levels   int    `json:"levels"`
+	Rungs    []Rung `json:"rungs"`
+}
+
+// CalibrateLadder places each strength among the players of the rated
+// solo replays of the levels. A player's skill percentile is the share
+// of the replays' players rated below them, by their latest session's
+// rating. Each strength plays each level as EstimateDifficulty does, and
+// its clear rate is set against every session of the level's: the bot
+// beats a session it out-cleared, and a player who topped out clears
+// nothing and one who cleared the level everything. The strength plays
+// like the percentile at which players, binned by percentile, beat it
+// as often as it beats them, interpolated between the bins; the share
+// is kept falling with percentile, and the rungs climbing with strength.
+func CalibrateLadder(levels []*level.Level, replays []*replay.Replay, opts LadderOptions) (Ladder, error) {
+	if len(opts.Strengths) == 0 {
+		for s := MinStrength; s <= MaxStrength; s++ {
+			opts.Strengths = append(opts.Strengths, s)
+		}
+	}
+	opts.Strengths = append([]int(nil), opts.Strengths...)
+	sort.Ints(opts.Strengths)
+	if opts.Bins <= 0 {
+		opts.Bins = DefaultLadderBins
+	}
+	if opts.MinSessions <= 0 {
+		opts.MinSessions = DefaultLadderMinSessions
+	}
+	byName := make(map[string]*level.Level, len(levels))
+	for _, lvl := range levels {
+		byName[lvl.Name] = lvl
+	}
+
+	type session struct {
+		level  string
+		player string
+		rate   float64
+	}
+	var sessions []session
+	latest := make(map[string]*replay.Replay)
+	perLevel := make(map[string]int)
+	for _, r := range replays {
+		lvl := byName[r.Level]
+		if lvl == nil || len(r.Players) != 1 || r.Players[0].Rating <= 0 {
+			continue
+		}
+		p := r.Players[0].ID
+		sessions = append(sessions, session{level: r.Level, player: p, rate: sessionClearRate(lvl, r)})
+		perLevel[r.Level]++
+		if l := latest[p]; l == nil || r.StartedAt.After(l.StartedAt) {
+			latest[p] = r
+		}
+	}
+	ratings := make([]float64, 0, len(latest))
+	for _, r := range latest {
+		ratings = append(ratings, r.Players[0].Rating)
+	}
+	sort.Float64s(ratings)
+	percentile := make(map[string]float64, len(latest))
+	for p, r := range latest {
+		percentile[p] = percentileOf(ratings, r.Players[0].Rating)
+	}
+
+	names := make([]string, 0, len(perLevel))
+	for name, n := range perLevel {
+		if n >= opts.MinSessions {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	est := opts.Estimate
+	est.Strengths = opts.Strengths
+	bots := make(map[string]map[int]float64, len(names))
+	for _, name := range names {
+		e, err := EstimateDifficulty(byName[name], est)
+		if err != nil {
+			return Ladder{}, fmt.Errorf("level %s: %w", name, err)
+		}
+		bots[name] = make(map[int]float64, len(e.Strengths))
+		for _, res := range e.Strengths {
+			bots[name][res.Strength] = res.ClearRate
+		}
+	}
+
+	ladder := Ladder{Players: len(latest), Levels: len(names)}
+	for _, s := range sessions {
+		if bots[s.level] != nil {
+			ladder.Sessions++
+		}
+	}
+	for _, strength := range opts.Strengths {
+		rung := Rung{Strength: strength}
+		shares := make([]float64, opts.Bins) // the bot's wins over each bin's sessions
+		counts := make([]int, opts.Bins)
+		centers := make([]float64, opts.Bins)
+		for _, s := range sessions {
+			rates := bots[s.level]
+			if rates == nil {
+				continue
+			}
+			bot, pct := rates[strength], percentile[s.player]
+			win := 0.5
+			switch {
+			case bot > s.rate:
+				win = 1
+			case bot < s.rate:
+				win = 0
+			}
+			bin := min(int(pct/100*float64(opts.Bins)), opts.Bins-1)
+			shares[bin] += win
+			counts[bin]++
+			centers[bin] += pct
+			rung.Sessions++
+			rung.Beats += win
+		}
+		if rung.Sessions == 0 {
+			return Ladder{}, fmt.Errorf("no rated solo sessions of levels with %d or more to calibrate against", opts.MinSessions)
+		}
+		rung.Beats /= float64(rung.Sessions)
+		// the ends of the range: nobody loses to the bot at 0, everybody at 100
+		xs, ys := []float64{0}, []float64{1}
+		for b := range shares {
+			if counts[b] > 0 {
+				xs = append(xs, centers[b]/float64(counts[b]))
+				ys = append(ys, min(shares[b]/float64(counts[b]), ys[len(ys)-1]))
+			}
+		}
+		xs, ys = append(xs, 100), append(ys, 0)
+		for i := 1; i < len(xs); i++ {
+			if ys[i] < 0.5 {
+				rung.Percentile = xs[i-1] + (ys[i-1]-0.5)/(ys[i-1]-ys[i])*(xs[i]-xs[i-1])
+				break
+			}
+		}
+		if n := len(ladder.Rungs); n > 0 {
+			rung.Percentile = max(rung.Percentile, ladder.Rungs[n-1].Percentile)
+		}
+		rung.Rating = ratingAt(ratings, rung.Percentile)
+		ladder.Rungs = append(ladder.Rungs, rung)
+	}
+	return ladder, nil
+}
+
+// sessionClearRate is a session's clear rate as play measures a bot's
+func sessionClearRate(lvl *level.Level, r *replay.Replay) float64 {
+	switch r.Result.Outcome {
+	case replay.OutcomeCleared:
+		return 1
+	case replay.OutcomeTopOut:
+		return 0
+	}
+	pieces, lines := len(r.EventsOf(replay.EventLock)), 0
+	for _, ev := range r.EventsOf(replay.EventClear) {
+		lines += ev.Lines
+	}
+	if pieces == 0 {
+		return 0
+	}
+	return min(float64(lines*lvl.GridSize.Width)/float64(pieces*4), 1)
+}
+
+// percentileOf is the share of sorted ratings below v, counting those
+// equal to it half, as a percentage
+func percentileOf(sorted []float64, v float64) float64 {
+	below := sort.SearchFloat64s(sorted, v)
+	equal := 0
+	for below+equal < len(sorted) && sorted[below+equal] == v {
+		equal++
+	}
+	return (float64(below) + float64(equal)/2) / float64(len(sorted)) * 100
+}
+
+// ratingAt is the rating at a percentile of sorted ratings, interpolated
+// between the ratings percentileOf places
+func ratingAt(sorted []float64, pct float64) float64 {
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	at := pct/100*float64(n) - 0.5
+	switch {
+	case at <= 0:
+		return sorted[0]
+	case at >= float64(n-1):
+		return sorted[n-1]
+	}
+	i := int(at)
+	return sorted[i] + (at-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// Percentile is the skill percentile the strength plays like, false when
+// it wasn't calibrated
+func (l Ladder) Percentile(strength int) (float64, bool) {
+	for _, r := range l.Rungs {
+		if r.Strength == strength {
+			return r.Percentile, true
+		}
+	}
+	return 0, false
+}
+
+// Strength is the weakest calibrated strength playing like a player of
+// the percentile or better, false when none does
+func (l Ladder) Strength(percentile float64) (int, bool) {
+	for _, r := range l.Rungs {
+		if r.Percentile >= percentile {
+			return r.Strength, true
+		}
+	}
+	return 0, false
+}
+
+// BeatableAt is the skill percentile of the weakest strength of the
+// estimate that completed the level, by the ladder: a player of that
+// percentile beats it as the bot did. False when no strength the ladder
+// calibrated completed it.
+func (e Estimate) BeatableAt(l Ladder) (float64, bool) {
+	strengths := append([]StrengthResult(nil), e.Strengths...)
+	sort.SliceStable(strengths, func(i, j int) bool { return strengths[i].Strength < strengths[j].Strength })
+	for _, res := range strengths {
+		if !res.Complete {
+			continue
+		}
+		if pct, ok := l.Percentile(res.Strength); ok {
+			return pct, true
+		}
+	}
+	return 0, false
+}
+
+// Save writes the ladder as JSON
+func (l Ladder) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadLadder reads a ladder Save wrote
+func LoadLadder(path string) (Ladder, error) {
+	var l Ladder
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(data, &l); err != nil {
+		return l, fmt.Errorf("parse ladder %s: %w", path, err)
+	}
+	return l, nil
+}
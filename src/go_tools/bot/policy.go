@@ -0,0 +1,122 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Policies by name
+const (
+	PolicyGreedy    = "greedy"
+	PolicyLookahead = "lookahead"
+	PolicyBeam      = "beam" // at the middle strength
+	PolicyRandom    = "random"
+)
+
+// Policies lists every policy in a stable order
+var Policies = []string{PolicyGreedy, PolicyLookahead, PolicyBeam, PolicyRandom}
+
+// NewPolicy returns the named policy with the default weights, a random
+// one drawing from seed
+func NewPolicy(name string, seed int64) (Policy, error) {
+	switch name {
+	case "", PolicyGreedy:
+		return Greedy{Weights: DefaultWeights}, nil
+	case PolicyLookahead:
+		return Lookahead{Weights: DefaultWeights}, nil
+	case PolicyBeam:
+		return ForStrength((MinStrength + MaxStrength) / 2), nil
+	case PolicyRandom:
+		return &Random{Src: rng.NewXoshiro(uint64(seed))}, nil
+	default:
+		return nil, fmt.Errorf("unknown bot policy %q", name)
+	}
+}
+
+// Greedy places each piece where the board scores best right after
+type Greedy struct {
+	Weights Weights
+}
+
+// Choose implements Policy
+func (p Greedy) Choose(g *sim.Game, player string, placements []sim.Placement) (sim.Placement, bool) {
+	board := g.Board(player)
+	return best(placements, func(pl sim.Placement) float64 {
+		b := board.Clone()
+		return p.Weights.Score(Measure(b, b.Lock(pl.Piece)))
+	})
+}
+
+// Lookahead places each piece where the board scores best once the next
+// piece is also placed at its best, dropped straight down
+type Lookahead struct {
+	Weights Weights
+}
+
+// Choose implements Policy
+func (p Lookahead) Choose(g *sim.Game, player string, placements []sim.Placement) (sim.Placement, bool) {
+	board := g.Board(player)
+	st, _ := g.State(player)
+	return best(placements, func(pl sim.Placement) float64 {
+		b := board.Clone()
+		lines := b.Lock(pl.Piece)
+		score := p.Weights.Score(Measure(b, lines))
+		next := coming(st, pl)
+		if len(next) == 0 {
+			return score
+		}
+		after, found := 0.0, false
+		for _, pc := range drops(b, next[0]) {
+			then := b.Clone()
+			more := then.Lock(pc)
+			if s := p.Weights.Score(Measure(then, lines+more)); !found || s > after {
+				after, found = s, true
+			}
+		}
+		if !found {
+			return score - 1000 // the next piece tops out
+		}
+		return after
+	})
+}
+
+// Random places each piece anywhere it can go
+type Random struct {
+	Src rng.RandomSource
+}
+
+// Choose implements Policy
+func (p *Random) Choose(_ *sim.Game, _ string, placements []sim.Placement) (sim.Placement, bool) {
+	if len(placements) == 0 {
+		return sim.Placement{}, false
+	}
+	return placements[p.Src.Intn(len(placements))], true
+}
+
+// best is the placement scoring highest, the first of equals
+func best(placements []sim.Placement, score func(sim.Placement) float64) (sim.Placement, bool) {
+	var top sim.Placement
+	topScore, found := 0.0, false
+	for _, pl := range placements {
+		if s := score(pl); !found || s > topScore {
+			top, topScore, found = pl, s, true
+		}
+	}
+	return top, found
+}
+
+// drops are the places the piece can be dropped straight down to from the
+// top of the board, in every rotation
+func drops(b sim.Board, piece string) []sim.Piece {
+	var out []sim.Piece
+	for rot := 0; rot < 4; rot++ {
+		for x := -3; x < b.Width(); x++ {
+			if pc := (sim.Piece{Type: piece, X: x, Rotation: rot}); b.Fits(pc) {
+				out = append(out, b.Drop(pc))
+			}
+		}
+	}
+	return out
+}
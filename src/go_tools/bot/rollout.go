@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Defaults for RolloutOptions left zero
+const (
+	DefaultRollouts        = 8
+	DefaultRolloutStrength = 2
+	DefaultRolloutFrames   = 3 * 60 * sim.FrameRate
+)
+
+// RolloutOptions set up a clear-time estimate
+type RolloutOptions struct {
+	Rollouts int         // games played of the level
+	Strength int         // of the beam bot playing them
+	Frames   int         // a rollout plays at most; one that hasn't cleared by then didn't
+	Delay    int         // frames the bot thinks on each new piece, default DefaultBatchDelay; below zero, none
+	Seed     int64       // deals the first rollout, each after it the next seed
+	Workers  int         // rollouts played at once, default GOMAXPROCS
+	Spells   SpellPolicy // how the bot plays pickups; the zero policy is DefaultSpellPolicy
+	Sim      sim.Options
+}
+
+// ClearTime is how long a level's rollouts took to clear it
+type ClearTime struct {
+	Level    string    `json:"level"`
+	Rollouts int       `json:"rollouts"`
+	Cleared  int       `json:"cleared"`
+	Seconds  []float64 `json:"seconds"` // of the rollouts that cleared, fastest first
+	Mean     float64   `json:"mean"`    // of Seconds
+	Variance float64   `json:"variance"`
+	P10      float64   `json:"p10"`
+	P50      float64   `json:"p50"`
+	P90      float64   `json:"p90"`
+	Score    float64   `json:"score"` // 0 trivial to 1 hardest
+}
+
+// ClearRate is the share of the rollouts that cleared the level
+func (c ClearTime) ClearRate() float64 {
+	if c.Rollouts == 0 {
+		return 0
+	}
+	return float64(c.Cleared) / float64(c.Rollouts)
+}
+
+// StdDev is the standard deviation of the clear times
+func (c ClearTime) StdDev() float64 { return math.Sqrt(c.Variance) }
+
+// EstimateClearTime plays Rollouts games of the level with a beam bot at a
+// player's pace, each dealt its own seed, and reports the distribution of
+// the times the ones completing its objectives took. Scored as a
+// difficulty, a rollout's time is its share of Frames, one not clearing
+// counting as all of them, and the score their mean; a level without
+// objectives never clears.
+func EstimateClearTime(lvl *level.Level, opts RolloutOptions) (ClearTime, error) {
+	if opts.Rollouts <= 0 {
+		opts.Rollouts = DefaultRollouts
+	}
+	if opts.Strength <= 0 {
+		opts.Strength = DefaultRolloutStrength
+	}
+	if opts.Frames <= 0 {
+		opts.Frames = DefaultRolloutFrames
+	}
+	if opts.Delay == 0 {
+		opts.Delay = DefaultBatchDelay
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	frames := make([]int, opts.Rollouts) // to clear, or -1
+	errs := make([]error, opts.Rollouts)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(opts.Workers, opts.Rollouts); w++ {
+		wg.Add(1)
+		crash.Go(func() {
+			defer wg.Done()
+			for i := range jobs {
+				frames[i], errs[i] = rollout(lvl, opts, int64(i))
+			}
+		})
+	}
+	for i := 0; i < opts.Rollouts; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	ct := ClearTime{Level: lvl.Name, Rollouts: opts.Rollouts}
+	total := 0.0
+	for i, f := range frames {
+		if errs[i] != nil {
+			return ct, fmt.Errorf("level %s rollout %d: %w", lvl.Name, i, errs[i])
+		}
+		if f < 0 {
+			total++
+			continue
+		}
+		ct.Cleared++
+		ct.Seconds = append(ct.Seconds, float64(f)/sim.FrameRate)
+		total += float64(f) / float64(opts.Frames)
+	}
+	ct.Score = total / float64(opts.Rollouts)
+	if ct.Cleared > 0 {
+		sort.Float64s(ct.Seconds)
+		ct.Mean = stats.Mean(ct.Seconds)
+		for _, s := range ct.Seconds {
+			ct.Variance += (s - ct.Mean) * (s - ct.Mean)
+		}
+		if ct.Cleared > 1 {
+			ct.Variance /= float64(ct.Cleared - 1)
+		}
+		ct.P10, ct.P50, ct.P90 = stats.Quantile(ct.Seconds, 0.1), stats.Quantile(ct.Seconds, 0.5), stats.Quantile(ct.Seconds, 0.9)
+	}
+	return ct, nil
+}
+
+// ClearTimeEstimator is EstimateClearTime's score with the options, the
+// shape of the generator's difficulty estimators; a level that can't be
+// played scores hardest
+func ClearTimeEstimator(opts RolloutOptions) func(*level.Level) float64 {
+	return func(lvl *level.Level) float64 {
+		ct, err := EstimateClearTime(lvl, opts)
+		if err != nil {
+			return 1
+		}
+		return ct.Score
+	}
+}
+
+// rollout plays the level's i'th rollout, answering the frames it took to
+// clear it, -1 when it didn't
+func rollout(lvl *level.Level, opts RolloutOptions, i int64) (int, error) {
+	simOpts := opts.Sim
+	simOpts.Seed, simOpts.Players = opts.Seed+i, nil
+	g, err := sim.New(lvl, simOpts)
+	if err != nil {
+		return 0, err
+	}
+	id := g.Players()[0]
+	Play(g, []Bot{{Player: id, Policy: ForStrength(opts.Strength), Delay: max(opts.Delay, 0), Hold: true, Spells: opts.Spells}}, opts.Frames)
+	if !g.Complete(id) {
+		return -1, nil
+	}
+	return g.Frame(), nil
+}
@@ -0,0 +1,231 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Grab modes of a SpellPolicy: whether a bot goes out of its way for a
+// pickup its policy's placement would pass by
+const (
+	GrabAlways = "always" // the policy's best of the placements picking a spell up, when any do
+	GrabSafely = "safely" // the same of those leaving no more holes than its own pick and the stack below Height
+	GrabNever  = "never"  // its own pick, picking up what that passes over
+)
+
+// Cast modes of a SpellPolicy: when a bot casts the spells it holds
+const (
+	CastAtOnce = "at_once" // every spell with the first piece after it was picked up
+	CastUseful = "useful"  // a spell at an opponent at once, its own when its effect helps the board
+	CastNever  = "never"
+)
+
+// DefaultSpellHeight is the share of the board's height a SpellPolicy
+// left without one puts its Height at
+const DefaultSpellHeight = 0.5
+
+// SpellPolicy is how a bot plays a level's pickups. Under CastUseful the
+// spells clearing rows, removing column tops or slowing its own gravity
+// help once its stack rises past Height, and swapping its piece once every
+// placement of the piece in play leaves a hole; a spell speeding up,
+// freezing or burying its own board never does. An empty mode is the
+// default policy's.
+type SpellPolicy struct {
+	Grab   string  `json:"grab"`
+	Cast   string  `json:"cast"`
+	Height float64 `json:"height"` // share of the board's height, DefaultSpellHeight when zero
+}
+
+// DefaultSpellPolicy grabs pickups when it's safe and casts a spell when
+// it helps
+func DefaultSpellPolicy() SpellPolicy {
+	return SpellPolicy{Grab: GrabSafely, Cast: CastUseful, Height: DefaultSpellHeight}
+}
+
+// LoadSpellPolicy reads a JSON spell policy; entries missing from the
+// file keep DefaultSpellPolicy's
+func LoadSpellPolicy(path string) (SpellPolicy, error) {
+	s := DefaultSpellPolicy()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("parse spell policy %s: %w", path, err)
+	}
+	if err := s.Validate(); err != nil {
+		return s, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Validate checks the modes are known and Height a share of the board
+func (s SpellPolicy) Validate() error {
+	switch s.Grab {
+	case "", GrabAlways, GrabSafely, GrabNever:
+	default:
+		return fmt.Errorf("unknown grab mode %q", s.Grab)
+	}
+	switch s.Cast {
+	case "", CastAtOnce, CastUseful, CastNever:
+	default:
+		return fmt.Errorf("unknown cast mode %q", s.Cast)
+	}
+	if s.Height < 0 || s.Height > 1 {
+		return fmt.Errorf("spell policy height %v must be a share of the board, 0 to 1", s.Height)
+	}
+	return nil
+}
+
+// height is the rows the stack on the board rises to before the policy
+// turns down grabs and casts the spells saving it
+func (s SpellPolicy) height(b sim.Board) int {
+	share := s.Height
+	if share <= 0 {
+		share = DefaultSpellHeight
+	}
+	return int(share * float64(len(b)))
+}
+
+// cast casts the player's spells the policy finds worth it now, reporting
+// whether one swaps their piece in play
+func (s SpellPolicy) cast(g *sim.Game, id string) bool {
+	if s.Cast == CastNever {
+		return false
+	}
+	st, _ := g.State(id)
+	book := g.Spellbook()
+	swapped := false
+	for _, spell := range st.Spells {
+		if s.Cast == CastAtOnce || s.useful(g, id, book[spell]) {
+			// refused without a target; kept for later
+			if g.Cast(id, spell, "") == nil && book[spell].Effect == sim.EffectSwapPiece {
+				swapped = true
+			}
+		}
+	}
+	return swapped
+}
+
+// useful reports whether casting the spell now helps the player, as
+// CastUseful has it
+func (s SpellPolicy) useful(g *sim.Game, id string, def sim.Spell) bool {
+	if def.Target == sim.TargetOpponent {
+		return true
+	}
+	b := g.Board(id)
+	f := Measure(b, 0)
+	high := f.MaxHeight > s.height(b)
+	switch def.Effect {
+	case sim.EffectClearLines, sim.EffectRemoveTops:
+		return high
+	case sim.EffectGravity:
+		return high && def.Scale >= 0 && def.Scale < 1
+	case sim.EffectSwapPiece:
+		st, _ := g.State(id)
+		if len(st.Next) == 0 {
+			return false
+		}
+		for _, pl := range g.Placements(id) {
+			if after := b.Clone(); Measure(after, after.Lock(pl.Piece)).Holes <= f.Holes {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// grab is the placement the bot takes in place of the policy's pick: one
+// picking a spell up instead, when the policy goes after them and the
+// player has room for another spell
+func (s SpellPolicy) grab(g *sim.Game, id string, policy Policy, placements []sim.Placement, pick sim.Placement) sim.Placement {
+	st, _ := g.State(id)
+	if s.Grab == GrabNever || len(pick.Pickups) > 0 || len(st.Spells) >= sim.MaxSpells {
+		return pick
+	}
+	b := g.Board(id)
+	locked := func(pl sim.Placement) Features {
+		after := b.Clone()
+		return Measure(after, after.Lock(pl.Piece))
+	}
+	own := locked(pick)
+	var grabs []sim.Placement
+	for _, pl := range placements {
+		if len(pl.Pickups) == 0 {
+			continue
+		}
+		if f := locked(pl); s.Grab != GrabAlways && (f.Holes > own.Holes || f.MaxHeight > s.height(b)) {
+			continue
+		}
+		grabs = append(grabs, pl)
+	}
+	if len(grabs) == 0 {
+		return pick
+	}
+	if pl, ok := policy.Choose(g, id, grabs); ok {
+		return pl
+	}
+	return pick
+}
+
+// SpellReport is what greedy bots playing a level made of its pickups
+type SpellReport struct {
+	Pickups   int            `json:"pickups"`   // the level has, for each player
+	Collected map[string]int `json:"collected"` // by spell, across the players
+	Cast      map[string]int `json:"cast"`      // by spell, landing or not
+	Events    map[string]int `json:"events"`    // of the game, by type, such as the garbage spells sent
+}
+
+// Uncollected are the level's spells no bot picked up
+func (r SpellReport) Uncollected(lvl *level.Level) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, pk := range lvl.Pickups {
+		if r.Collected[pk.Spell] == 0 && !seen[pk.Spell] {
+			seen[pk.Spell] = true
+			out = append(out, pk.Spell)
+		}
+	}
+	return out
+}
+
+// PlaySpells plays the level end to end with greedy bots for the options'
+// players, two when it names none so spells aimed at an opponent have
+// one, grabbing every pickup they can and casting every spell they pick
+// up by the options' spellbook, for frames or DefaultFrames when zero
+func PlaySpells(lvl *level.Level, opts sim.Options, frames int) (SpellReport, error) {
+	if len(opts.Players) == 0 {
+		opts.Players = []string{"p1", "p2"}
+	}
+	g, err := sim.New(lvl, opts)
+	if err != nil {
+		return SpellReport{}, err
+	}
+	if frames <= 0 {
+		frames = DefaultFrames
+	}
+	greedy, _ := NewPolicy(PolicyGreedy, 0)
+	var bots []Bot
+	for _, id := range g.Players() {
+		bots = append(bots, Bot{Player: id, Policy: greedy, Hold: true, Spells: SpellPolicy{Grab: GrabAlways, Cast: CastAtOnce}})
+	}
+	Play(g, bots, frames)
+	r := g.Replay(lvl.Name)
+	report := SpellReport{Pickups: len(lvl.Pickups), Collected: make(map[string]int), Cast: make(map[string]int), Events: make(map[string]int)}
+	for _, ev := range r.Events {
+		report.Events[ev.Type]++
+		if ev.Type == replay.EventPickup {
+			report.Collected[ev.Detail]++
+		}
+	}
+	for _, sc := range r.Spells {
+		report.Cast[sc.Spell]++
+	}
+	return report, nil
+}
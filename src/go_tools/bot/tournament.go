@@ -0,0 +1,383 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Defaults for TournamentOptions left zero
+const DefaultTournamentGames = 4
+
+// Why a tournament game is kept
+const (
+	InterestingUpset   = "upset"   // won by the side losing the pairing at least two games to one
+	InterestingDraw    = "draw"    // nobody won
+	InterestingLongest = "longest" // of its pairing
+)
+
+// Entrant is a bot configuration a tournament pits against the others,
+// or a candidate balance patch: a bot whose clears send garbage by an
+// attack table of its own
+type Entrant struct {
+	Name       string      `json:"name"`               // its player ID in the games
+	Policy     string      `json:"policy,omitempty"`   // a Policies entry; default the beam bot at Strength
+	Strength   int         `json:"strength,omitempty"` // the beam bot's, default the middle one
+	Weights    *Weights    `json:"weights,omitempty"`  // the policy's board weights, default DefaultWeights
+	Delay      int         `json:"delay,omitempty"`    // frames it thinks on each new piece, default DefaultBatchDelay; below zero, none
+	Spells     SpellPolicy `json:"spells"`             // how it plays pickups; the zero policy is DefaultSpellPolicy
+	AttackFile string      `json:"attackFile,omitempty"`
+	Attack     *sim.Attack `json:"-"` // AttackFile's table, nil for the match's
+}
+
+// DefaultEntrants are beam bots of every strength
+func DefaultEntrants() []Entrant {
+	var out []Entrant
+	for s := MinStrength; s <= MaxStrength; s++ {
+		out = append(out, Entrant{Name: fmt.Sprintf("beam%d", s), Policy: PolicyBeam, Strength: s})
+	}
+	return out
+}
+
+// LoadEntrants reads a JSON list of entrants, their attack files found
+// relative to it
+func LoadEntrants(path string) ([]Entrant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entrants []Entrant
+	if err := json.Unmarshal(data, &entrants); err != nil {
+		return nil, fmt.Errorf("parse entrants %s: %w", path, err)
+	}
+	for i, e := range entrants {
+		if e.AttackFile == "" {
+			continue
+		}
+		file := e.AttackFile
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		attack, err := sim.LoadAttack(file)
+		if err != nil {
+			return nil, fmt.Errorf("entrant %s: %w", e.Name, err)
+		}
+		entrants[i].Attack = &attack
+	}
+	if err := ValidateEntrants(entrants); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entrants, nil
+}
+
+// ValidateEntrants checks there are two entrants or more, each named
+// apart, by a known policy and spell policy
+func ValidateEntrants(entrants []Entrant) error {
+	if len(entrants) < 2 {
+		return fmt.Errorf("a tournament needs two entrants or more, got %d", len(entrants))
+	}
+	seen := make(map[string]bool, len(entrants))
+	for _, e := range entrants {
+		if e.Name == "" || seen[e.Name] {
+			return fmt.Errorf("entrant name %q is empty or taken", e.Name)
+		}
+		seen[e.Name] = true
+		if _, err := e.policy(0); err != nil {
+			return fmt.Errorf("entrant %s: %w", e.Name, err)
+		}
+		if err := e.Spells.Validate(); err != nil {
+			return fmt.Errorf("entrant %s: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// policy is the entrant's policy, a random one drawing from seed
+func (e Entrant) policy(seed int64) (Policy, error) {
+	weights := DefaultWeights
+	if e.Weights != nil {
+		weights = *e.Weights
+	}
+	switch e.Policy {
+	case "", PolicyBeam:
+		strength := e.Strength
+		if strength <= 0 {
+			strength = (MinStrength + MaxStrength) / 2
+		}
+		beam := ForStrength(strength)
+		beam.Weights = weights
+		return beam, nil
+	case PolicyGreedy:
+		return Greedy{Weights: weights}, nil
+	case PolicyLookahead:
+		return Lookahead{Weights: weights}, nil
+	}
+	return NewPolicy(e.Policy, seed)
+}
+
+// TournamentOptions set up a tournament
+type TournamentOptions struct {
+	Games   int   // of each pairing on each level, the sides swapped every other game
+	Frames  int   // a game plays at most, DefaultFrames when zero
+	Seed    int64 // deals a pairing's first two games, each two after them the next seed
+	Workers int   // games played at once, default GOMAXPROCS
+	Sim     sim.Options
+}
+
+// Standing is how an entrant did in a tournament
+type Standing struct {
+	Entrant  string  `json:"entrant"`
+	Played   int     `json:"played"`
+	Wins     int     `json:"wins"`
+	Losses   int     `json:"losses"`
+	Draws    int     `json:"draws"`
+	Points   float64 `json:"points"` // a win's 1 and a draw's a half
+	Lines    int     `json:"lines"`
+	Sent     int     `json:"sent"` // garbage rows
+	Received int     `json:"received"`
+}
+
+// WinRate is the share of the points the entrant's games held it took
+func (s Standing) WinRate() float64 {
+	if s.Played == 0 {
+		return 0
+	}
+	return s.Points / float64(s.Played)
+}
+
+// Matchup is how two entrants' games against each other went
+type Matchup struct {
+	A     string `json:"a"`
+	B     string `json:"b"`
+	Games int    `json:"games"`
+	WinsA int    `json:"winsA"`
+	WinsB int    `json:"winsB"`
+	Draws int    `json:"draws"`
+}
+
+// WinRate is A's share of the pairing's points, a draw a half
+func (m Matchup) WinRate() float64 {
+	if m.Games == 0 {
+		return 0
+	}
+	return (float64(m.WinsA) + float64(m.Draws)/2) / float64(m.Games)
+}
+
+// TournamentGame is a game a tournament kept, with its replay
+type TournamentGame struct {
+	Level   string         `json:"level"`
+	Game    int            `json:"game"`    // of the pairing on the level, from 0
+	Players []string       `json:"players"` // the entrants, p1's side first
+	Winner  string         `json:"winner,omitempty"`
+	Frames  int            `json:"frames"`
+	Reasons []string       `json:"reasons"` // why it was kept, Interesting constants
+	Report  MatchReport    `json:"report"`
+	Replay  *replay.Replay `json:"-"`
+}
+
+// TournamentReport is how a tournament went: the standings, best first,
+// every pairing in entrant order and the games worth watching again
+type TournamentReport struct {
+	Games       int              `json:"games"`
+	Standings   []Standing       `json:"standings"`
+	Matchups    []Matchup        `json:"matchups"`
+	Interesting []TournamentGame `json:"interesting"`
+}
+
+// PlayTournament plays a round robin of versus matches between the
+// entrants, Games of each pairing on each level across the workers, and
+// reports the standings, every pairing's record and, with their replays,
+// the games worth watching again: a pairing's upsets, draws and longest
+// game. The two games of a pairing dealt the same seed swap the sides,
+// so neither entrant gains by going first. A game nobody won by Frames
+// is a draw. The players' clears send each other garbage by the options'
+// attack table, DefaultAttack without one, an entrant's own if it has one.
+func PlayTournament(levels []*level.Level, entrants []Entrant, opts TournamentOptions) (TournamentReport, error) {
+	if err := ValidateEntrants(entrants); err != nil {
+		return TournamentReport{}, err
+	}
+	if len(levels) == 0 {
+		return TournamentReport{}, fmt.Errorf("a tournament needs a level to play")
+	}
+	if opts.Games <= 0 {
+		opts.Games = DefaultTournamentGames
+	}
+	if opts.Frames <= 0 {
+		opts.Frames = DefaultFrames
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.Sim.Versus == nil {
+		attack := sim.DefaultAttack()
+		opts.Sim.Versus = &attack
+	}
+	report := TournamentReport{Standings: make([]Standing, len(entrants))}
+	at := make(map[string]*Standing, len(entrants))
+	for i, e := range entrants {
+		report.Standings[i].Entrant = e.Name
+		at[e.Name] = &report.Standings[i]
+	}
+	for a := range entrants {
+		for b := a + 1; b < len(entrants); b++ {
+			games, err := playPairing(levels, entrants[a], entrants[b], opts)
+			if err != nil {
+				return report, err
+			}
+			m := Matchup{A: entrants[a].Name, B: entrants[b].Name, Games: len(games)}
+			for _, g := range games {
+				switch g.Winner {
+				case m.A:
+					m.WinsA++
+				case m.B:
+					m.WinsB++
+				default:
+					m.Draws++
+				}
+				for _, id := range g.Players {
+					s, mp := at[id], g.Report.Players[id]
+					s.Played++
+					s.Lines += mp.Lines
+					s.Sent += mp.Sent
+					s.Received += mp.Received
+					switch g.Winner {
+					case id:
+						s.Wins++
+						s.Points++
+					case "":
+						s.Draws++
+						s.Points += 0.5
+					default:
+						s.Losses++
+					}
+				}
+			}
+			report.Games += len(games)
+			report.Matchups = append(report.Matchups, m)
+			report.Interesting = append(report.Interesting, interesting(games, m)...)
+		}
+	}
+	sort.SliceStable(report.Standings, func(i, j int) bool {
+		a, b := report.Standings[i], report.Standings[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		return a.Wins > b.Wins
+	})
+	return report, nil
+}
+
+// playPairing plays the two entrants' games on every level across the
+// workers, in order, a level's before the next's
+func playPairing(levels []*level.Level, a, b Entrant, opts TournamentOptions) ([]TournamentGame, error) {
+	n := len(levels) * opts.Games
+	games := make([]TournamentGame, n)
+	errs := make([]error, n)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(opts.Workers, n); w++ {
+		wg.Add(1)
+		crash.Go(func() {
+			defer wg.Done()
+			for i := range jobs {
+				games[i], errs[i] = playTournamentGame(levels[i/opts.Games], a, b, i%opts.Games, opts)
+			}
+		})
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return games, nil
+}
+
+// playTournamentGame plays the pairing's game on the level, b taking the
+// first side every other game on the seed of the game before
+func playTournamentGame(lvl *level.Level, a, b Entrant, game int, opts TournamentOptions) (TournamentGame, error) {
+	sides := []Entrant{a, b}
+	if game%2 == 1 {
+		sides[0], sides[1] = b, a
+	}
+	seed := opts.Seed + int64(game/2)
+	simOpts := opts.Sim
+	simOpts.Seed, simOpts.Players, simOpts.Attacks = seed, nil, nil
+	bots := make([]Bot, len(sides))
+	for i, e := range sides {
+		simOpts.Players = append(simOpts.Players, e.Name)
+		if e.Attack != nil {
+			if simOpts.Attacks == nil {
+				simOpts.Attacks = make(map[string]*sim.Attack)
+			}
+			simOpts.Attacks[e.Name] = e.Attack
+		}
+		policy, err := e.policy(seed)
+		if err != nil {
+			return TournamentGame{}, err
+		}
+		delay := e.Delay
+		if delay == 0 {
+			delay = DefaultBatchDelay
+		}
+		bots[i] = Bot{Player: e.Name, Policy: policy, Delay: max(delay, 0), Hold: true, Spells: e.Spells}
+	}
+	g, err := sim.New(lvl, simOpts)
+	if err != nil {
+		return TournamentGame{}, fmt.Errorf("level %s, %s against %s: %w", lvl.Name, a.Name, b.Name, err)
+	}
+	Play(g, bots, opts.Frames)
+	r := g.Replay(fmt.Sprintf("%s-%s-%s-%d", lvl.Name, a.Name, b.Name, game))
+	report := matchReport(g, r)
+	return TournamentGame{
+		Level: lvl.Name, Game: game, Players: simOpts.Players, Winner: report.Winner, Frames: report.Frames,
+		Report: report, Replay: r,
+	}, nil
+}
+
+// interesting are the pairing's games worth keeping, with why
+func interesting(games []TournamentGame, m Matchup) []TournamentGame {
+	loser := ""
+	switch {
+	case m.WinsA > 0 && m.WinsB >= 2*m.WinsA:
+		loser = m.A
+	case m.WinsB > 0 && m.WinsA >= 2*m.WinsB:
+		loser = m.B
+	}
+	longest := 0
+	for i, g := range games {
+		if g.Frames > games[longest].Frames {
+			longest = i
+		}
+	}
+	var out []TournamentGame
+	for i, g := range games {
+		g.Reasons = nil
+		if loser != "" && g.Winner == loser {
+			g.Reasons = append(g.Reasons, InterestingUpset)
+		}
+		if g.Winner == "" {
+			g.Reasons = append(g.Reasons, InterestingDraw)
+		}
+		if i == longest {
+			g.Reasons = append(g.Reasons, InterestingLongest)
+		}
+		if len(g.Reasons) > 0 {
+			out = append(out, g)
+		}
+	}
+	return out
+}
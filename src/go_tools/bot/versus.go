@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// MatchPlayer is a player's side of a bot match
+type MatchPlayer struct {
+	Score     int  `json:"score"`
+	Lines     int  `json:"lines"`
+	Sent      int  `json:"sent"`      // garbage rows their clears sent
+	Countered int  `json:"countered"` // garbage rows queued against them their clears cancelled
+	Received  int  `json:"received"`  // garbage rows that landed on their board
+	ToppedOut bool `json:"toppedOut,omitempty"`
+}
+
+// MatchReport is how a bot match went
+type MatchReport struct {
+	Frames  int                    `json:"frames"`
+	Outcome string                 `json:"outcome,omitempty"`
+	Winner  string                 `json:"winner,omitempty"`
+	Players map[string]MatchPlayer `json:"players"`
+}
+
+// PlayMatch plays a versus match of the level between bots of the
+// policies, a player each, p1 onwards unless the options name them, for
+// frames or DefaultFrames when zero. The players' clears send each other
+// garbage by the options' attack table, DefaultAttack without one.
+func PlayMatch(lvl *level.Level, policies []Policy, opts sim.Options, frames int) (MatchReport, error) {
+	if len(opts.Players) == 0 {
+		for i := range policies {
+			opts.Players = append(opts.Players, fmt.Sprintf("p%d", i+1))
+		}
+	}
+	if len(policies) < 2 || len(opts.Players) != len(policies) {
+		return MatchReport{}, fmt.Errorf("a match needs a policy for each of two players or more, got %d for %d", len(policies), len(opts.Players))
+	}
+	if opts.Versus == nil {
+		attack := sim.DefaultAttack()
+		opts.Versus = &attack
+	}
+	g, err := sim.New(lvl, opts)
+	if err != nil {
+		return MatchReport{}, err
+	}
+	if frames <= 0 {
+		frames = DefaultFrames
+	}
+	bots := make([]Bot, len(policies))
+	for i, policy := range policies {
+		bots[i] = Bot{Player: opts.Players[i], Policy: policy, Hold: true, Spells: DefaultSpellPolicy()}
+	}
+	Play(g, bots, frames)
+	return matchReport(g, g.Replay(lvl.Name)), nil
+}
+
+// matchReport is how the game's match went, its replay so far r
+func matchReport(g *sim.Game, r *replay.Replay) MatchReport {
+	res := g.Result()
+	report := MatchReport{Frames: g.Frame(), Outcome: res.Outcome, Winner: res.Winner, Players: make(map[string]MatchPlayer, len(r.Players))}
+	for _, p := range r.Players {
+		st, _ := g.State(p.ID)
+		report.Players[p.ID] = MatchPlayer{Score: st.Score, Lines: st.Lines, ToppedOut: st.ToppedOut}
+	}
+	for _, ev := range r.Events {
+		mp := report.Players[ev.Player]
+		switch ev.Type {
+		case replay.EventAttack:
+			mp.Sent += ev.Lines
+		case replay.EventCounter:
+			mp.Countered += ev.Lines
+		case replay.EventGarbage:
+			mp.Received += ev.Lines
+		default:
+			continue
+		}
+		report.Players[ev.Player] = mp
+	}
+	return report
+}
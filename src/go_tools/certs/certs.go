@@ -0,0 +1,383 @@
+// Package certs serves the tool servers over TLS and lets their clients
+// trust them. A server uses the config's certificate, or a development one
+// issued by a local CA that is generated once under the config's dev
+// directory and reissued as the machine's names change, and may require
+// clients to present certificates of their own, signed by a CA it trusts.
+// Clients trust the system's roots plus the CA the environment names, and
+// present the certificate it names, so pointing SUPERTETRIS_TLS_CA at a dev
+// CA's ca.pem is all a playtest machine needs.
+package certs
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+// Environment the tools' clients take their TLS settings from
+const (
+	CAEnv   = "SUPERTETRIS_TLS_CA"   // PEM file of CAs trusted besides the system's
+	CertEnv = "SUPERTETRIS_TLS_CERT" // PEM certificate presented to servers requiring one
+	KeyEnv  = "SUPERTETRIS_TLS_KEY"  // its PEM key
+)
+
+// Files of a dev directory
+const (
+	CAFile        = "ca.pem"
+	caKeyFile     = "ca-key.pem"
+	ServerFile    = "server.pem"
+	serverKeyFile = "server-key.pem"
+)
+
+// Dev certificate lifetimes, and how long before expiry a server's is
+// reissued
+const (
+	caValidity     = 10 * 365 * 24 * time.Hour
+	leafValidity   = 397 * 24 * time.Hour // the longest clients accept
+	reissueWithin  = 30 * 24 * time.Hour
+	backdateIssued = time.Hour // for clocks a little behind
+)
+
+// Server is the TLS config of a server as the config's TLS settings give
+// it, or nil when TLS is off: the config's certificate, or the dev one of
+// its dev directory, and with a client CA file, client certificates
+// signed by one of its CAs are required
+func Server(config utils.Config) (*tls.Config, error) {
+	if !config.TLSEnabled {
+		return nil, nil
+	}
+	var cert tls.Certificate
+	var err error
+	switch {
+	case config.TLSCertFile != "" && config.TLSKeyFile != "":
+		cert, err = tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+	case config.TLSCertFile != "" || config.TLSKeyFile != "":
+		return nil, fmt.Errorf("tls: tlsCertFile and tlsKeyFile go together")
+	default:
+		cert, err = DevServer(config.TLSDevDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	if config.TLSClientCAFile != "" {
+		pool, err := loadPool(config.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// ListenAndServe serves srv over TLS with cfg, or in the clear when cfg
+// is nil
+func ListenAndServe(srv *http.Server, cfg *tls.Config) error {
+	if cfg == nil {
+		return srv.ListenAndServe()
+	}
+	srv.TLSConfig = cfg
+	return srv.ListenAndServeTLS("", "")
+}
+
+// Scheme is http, or https over TLS
+func Scheme(cfg *tls.Config) string {
+	if cfg == nil {
+		return "http"
+	}
+	return "https"
+}
+
+var client = sync.OnceValues(func() (*tls.Config, error) {
+	return ClientFrom(os.Getenv(CAEnv), os.Getenv(CertEnv), os.Getenv(KeyEnv))
+})
+
+// Client is the TLS config of the tools' clients, from the environment's
+// CA, certificate and key, or nil, for Go's defaults, when it sets none
+func Client() (*tls.Config, error) {
+	return client()
+}
+
+// ClientFrom is a client TLS config trusting the system's roots plus the
+// CAs of caFile, and presenting the certificate of certFile and keyFile;
+// nil when all are empty
+func ClientFrom(caFile, certFile, keyFile string) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("tls: no certificates in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("tls: %s and %s go together", CertEnv, KeyEnv)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// HTTPClient is an HTTP client with the Client TLS config; if the
+// environment's files don't load, its HTTPS requests fail saying why
+func HTTPClient(timeout time.Duration) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	cfg, err := Client()
+	if err != nil {
+		t.DialTLSContext = func(context.Context, string, string) (net.Conn, error) { return nil, err }
+	} else {
+		t.TLSClientConfig = cfg
+	}
+	return &http.Client{Timeout: timeout, Transport: t}
+}
+
+// Dial opens a WebSocket like websocket.Dial, with the Client TLS config
+func Dial(ctx context.Context, rawURL string, header http.Header) (*websocket.Conn, error) {
+	cfg, err := Client()
+	if err != nil {
+		return nil, err
+	}
+	return websocket.DialTLS(ctx, rawURL, header, cfg)
+}
+
+// CA is a dev directory's certificate authority
+type CA struct {
+	Cert *x509.Certificate
+	Path string // of its certificate, for clients to trust
+	key  crypto.Signer
+}
+
+// DevCA loads the CA of a dev directory, generating it the first time
+func DevCA(dir string) (*CA, error) {
+	certPath, keyPath := filepath.Join(dir, CAFile), filepath.Join(dir, caKeyFile)
+	cert, key, err := loadPair(certPath, keyPath)
+	if err == nil {
+		return &CA{Cert: cert, Path: certPath, key: key}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial(),
+		Subject:               pkix.Name{Organization: []string{"SuperTetris dev"}, CommonName: "SuperTetris dev CA " + host},
+		NotBefore:             now.Add(-backdateIssued),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, k.Public(), k)
+	if err != nil {
+		return nil, err
+	}
+	if err := writePair(certPath, keyPath, der, k); err != nil {
+		return nil, err
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Cert: cert, Path: certPath, key: k}, nil
+}
+
+// Issue signs a new certificate and key, as PEM: a server's for hosts,
+// names and addresses alike, or a client's for name
+func (ca *CA) Issue(name string, hosts []string, client bool) (certPEM, keyPEM []byte, err error) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial(),
+		Subject:      pkix.Name{Organization: []string{"SuperTetris dev"}, CommonName: name},
+		NotBefore:    now.Add(-backdateIssued),
+		NotAfter:     now.Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if client {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, k.Public(), ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// IssueClient writes a client certificate for name, signed by the CA, to
+// dir as name.pem and name-key.pem, returning their paths
+func (ca *CA) IssueClient(dir, name string) (certPath, keyPath string, err error) {
+	certPEM, keyPEM, err := ca.Issue(name, nil, true)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	certPath, keyPath = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return "", "", err
+	}
+	return certPath, keyPath, os.WriteFile(certPath, certPEM, 0644)
+}
+
+// DevServer is the server certificate of a dev directory, issued by its
+// CA when missing, near expiry, or not naming all of Hosts now
+func DevServer(dir string) (tls.Certificate, error) {
+	if dir == "" {
+		return tls.Certificate{}, fmt.Errorf("no dev certificate directory")
+	}
+	ca, err := DevCA(dir)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPath, keyPath := filepath.Join(dir, ServerFile), filepath.Join(dir, serverKeyFile)
+	hosts := Hosts()
+	if cert, _, err := loadPair(certPath, keyPath); err == nil && current(cert, ca, hosts) {
+		return tls.LoadX509KeyPair(certPath, keyPath)
+	}
+	certPEM, keyPEM, err := ca.Issue("SuperTetris dev server", hosts, false)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// current reports whether a server certificate is the CA's, valid a while
+// yet, and names every host
+func current(cert *x509.Certificate, ca *CA, hosts []string) bool {
+	if cert.CheckSignatureFrom(ca.Cert) != nil || time.Until(cert.NotAfter) < reissueWithin {
+		return false
+	}
+	for _, h := range hosts {
+		if cert.VerifyHostname(h) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Hosts are the names and addresses a dev server certificate is for:
+// localhost, the machine's name and its interfaces' addresses
+func Hosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil && name != "" && name != "localhost" {
+		hosts = append(hosts, name)
+	}
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && !n.IP.IsLinkLocalUnicast() && !slices.Contains(hosts, n.IP.String()) {
+			hosts = append(hosts, n.IP.String())
+		}
+	}
+	return hosts
+}
+
+func loadPair(certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		if _, statErr := os.Stat(certPath); errors.Is(statErr, os.ErrNotExist) {
+			return nil, nil, statErr
+		}
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: key can't sign", keyPath)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	return cert, key, err
+}
+
+func writePair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, nil
+}
+
+func serial() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	return n
+}
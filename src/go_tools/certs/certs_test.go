@@ -0,0 +1,138 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+func TestDevServerIsKept(t *testing.T) {
+	dir := t.TempDir()
+	first, err := DevServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := DevServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Certificate[0], second.Certificate[0]) {
+		t.Error("server certificate reissued though still current")
+	}
+	ca, err := DevCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Leaf.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Errorf("server certificate isn't the dev CA's: %v", err)
+	}
+	for _, h := range []string{"localhost", "127.0.0.1"} {
+		if err := first.Leaf.VerifyHostname(h); err != nil {
+			t.Errorf("server certificate: %v", err)
+		}
+	}
+}
+
+func TestServerOff(t *testing.T) {
+	cfg, err := Server(utils.DefaultConfig())
+	if cfg != nil || err != nil {
+		t.Fatalf("Server of the default config = %v, %v; want TLS off", cfg, err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	config := utils.DefaultConfig()
+	config.TLSEnabled = true
+	config.TLSDevDir = dir
+	ca, err := DevCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.TLSClientCAFile = ca.Path
+	cfg, err := Server(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws" {
+			conn, err := websocket.Upgrade(w, r)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			if _, data, err := conn.ReadMessage(); err == nil {
+				conn.WriteText(string(data))
+			}
+			return
+		}
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	certPath, keyPath, err := ca.IssueClient(filepath.Join(dir, "clients"), "playtester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCert, err := ClientFrom(ca.Path, certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{TLSClientConfig: withCert}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	resp.Body.Close()
+	if body.String() != "playtester" {
+		t.Errorf("server saw client %q, want playtester", body.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := websocket.DialTLS(ctx, strings.Replace(srv.URL, "https", "wss", 1)+"/ws", nil, withCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteText("hello")
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "hello" {
+		t.Errorf("echo over wss = %q, %v", data, err)
+	}
+	conn.Close()
+
+	trustOnly, err := ClientFrom(ca.Path, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, transport := range map[string]*http.Transport{
+		"without a client certificate": {TLSClientConfig: trustOnly},
+		"not trusting the dev CA":      {},
+	} {
+		c := &http.Client{Timeout: 5 * time.Second, Transport: transport}
+		if resp, err := c.Get(srv.URL); err == nil {
+			resp.Body.Close()
+			t.Errorf("request %s succeeded", name)
+		}
+	}
+}
+
+func TestClientFromMismatched(t *testing.T) {
+	if _, err := ClientFrom("", "cert.pem", ""); err == nil {
+		t.Error("a certificate without a key was accepted")
+	}
+	if cfg, err := ClientFrom("", "", ""); cfg != nil || err != nil {
+		t.Errorf("ClientFrom of nothing = %v, %v; want the defaults", cfg, err)
+	}
+}
@@ -0,0 +1,226 @@
+// Package admin is stt admin, which calls the admin API of a tool server
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/admin"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/api"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/discovery"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/packs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/relay"
+)
+
+// commands are what admin does, with the arguments each takes after the
+// server
+var commands = map[string]struct {
+	min, max int
+	run      func(ctx context.Context, c *admin.Client, args []string) (any, error)
+}{
+	"info":      {0, 0, info},
+	"log-level": {0, 1, logLevel},
+	"rooms":     {0, 0, rooms},
+	"kick":      {2, 2, kick},
+	"close":     {1, 1, closeRoom},
+	"reload":    {0, 1, reload},
+	"jobs":      {0, 0, jobs},
+}
+
+// Main runs stt admin with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("admin"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its discoveryAddr is queried when the server is given as a kind")
+	asJSON := fs.Bool("json", false, "print the server's answer as JSON")
+	discoveryAddr := fs.String("discovery", "", "group queried when the server is given as a kind (default the config's discoveryAddr)")
+	timeout := fs.Duration("timeout", 30*time.Second, "for the call")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: %[1]s [flags] server COMMAND [args]
+       %[1]s server info
+       %[1]s server log-level [debug|info|warn|error]
+       %[1]s relay-server rooms
+       %[1]s relay-server kick ROOM PEER
+       %[1]s relay-server close ROOM
+       %[1]s packs-server reload [PACK]
+       %[1]s analysis-server jobs
+
+Calls the admin API of a tool server, for what would otherwise mean
+restarting it. server is its URL, such as http://host:8097, or a kind,
+such as relay, to find the one on the local network. info says what the
+server is and which operations it has; log-level shows or sets how much
+it logs, until it restarts. rooms lists the relay's rooms, their peers
+and where they connected from; kick disconnects a peer, host or not, and
+close a room. reload rereads a pack's versions from disk, or every
+pack's, and jobs lists the analysis jobs running.
+
+The token of %[2]s is presented, which needs the admin scope, or
+admin:read to look only. A server without a tokens file takes admin
+calls from its own machine alone.
+
+`, cli.Name("admin"), auth.TokenEnv)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[fs.Arg(1)]
+	rest := fs.Args()[2:]
+	if !ok || len(rest) < cmd.min || len(rest) > cmd.max {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	if *discoveryAddr == "" {
+		*discoveryAddr = config.DiscoveryAddr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	server := fs.Arg(0)
+	if !strings.Contains(server, "://") {
+		f, err := discovery.Find(ctx, *discoveryAddr, server, "")
+		if err != nil {
+			cli.Fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "found %s %q on %s at %s\n", f.Kind, f.Name, f.Host, f.URL)
+		server = f.URL
+	}
+	c, err := admin.NewClient(server)
+	if err != nil {
+		cli.Fail(err)
+	}
+	out, err := cmd.run(ctx, c, rest)
+	if err != nil {
+		cli.Fail(err)
+	}
+	if out == nil {
+		return
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(out)
+		return
+	}
+	printAnswer(out)
+}
+
+func info(ctx context.Context, c *admin.Client, _ []string) (any, error) {
+	var in admin.Info
+	err := c.Do(ctx, http.MethodGet, "", nil, &in)
+	return in, err
+}
+
+// levelReply is what the log-level operations answer
+type levelReply struct {
+	Level string `json:"level"`
+}
+
+func logLevel(ctx context.Context, c *admin.Client, args []string) (any, error) {
+	var reply levelReply
+	var err error
+	if len(args) == 0 {
+		err = c.Do(ctx, http.MethodGet, "log-level", nil, &reply)
+	} else {
+		err = c.Do(ctx, http.MethodPut, "log-level", map[string]string{"level": args[0]}, &reply)
+	}
+	return reply, err
+}
+
+func rooms(ctx context.Context, c *admin.Client, _ []string) (any, error) {
+	var rs []relay.Room
+	err := c.Do(ctx, http.MethodGet, "rooms", nil, &rs)
+	return rs, err
+}
+
+func kick(ctx context.Context, c *admin.Client, args []string) (any, error) {
+	err := c.Do(ctx, http.MethodDelete, "rooms/"+url.PathEscape(args[0])+"/peers/"+url.PathEscape(args[1]), nil, nil)
+	if err == nil {
+		fmt.Printf("kicked %s from room %s\n", args[1], args[0])
+	}
+	return nil, err
+}
+
+func closeRoom(ctx context.Context, c *admin.Client, args []string) (any, error) {
+	err := c.Do(ctx, http.MethodDelete, "rooms/"+url.PathEscape(args[0]), nil, nil)
+	if err == nil {
+		fmt.Printf("closed room %s\n", args[0])
+	}
+	return nil, err
+}
+
+func reload(ctx context.Context, c *admin.Client, args []string) (any, error) {
+	path := "packs/reload"
+	if len(args) == 1 {
+		path = "packs/" + url.PathEscape(args[0]) + "/reload"
+	}
+	var vs []packs.Version
+	err := c.Do(ctx, http.MethodPost, path, nil, &vs)
+	return vs, err
+}
+
+func jobs(ctx context.Context, c *admin.Client, _ []string) (any, error) {
+	var js []api.Job
+	err := c.Do(ctx, http.MethodGet, "jobs", nil, &js)
+	return js, err
+}
+
+// printAnswer writes a command's answer for people
+func printAnswer(out any) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	switch v := out.(type) {
+	case admin.Info:
+		fmt.Fprintf(w, "server\t%s\nhost\t%s (pid %d)\nuptime\t%s\nlog level\t%s\n\n", v.Server, v.Host, v.PID,
+			(time.Duration(v.UptimeSeconds) * time.Second).String(), v.LogLevel)
+		for _, op := range v.Ops {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", op.Method, op.Path, op.Doc)
+		}
+	case levelReply:
+		fmt.Fprintln(w, "log level", v.Level)
+	case []relay.Room:
+		fmt.Fprintln(w, "ROOM\tSTATE\tPEER\tADDR\tJOINED\tREADY\tSENT\tRECEIVED")
+		for _, r := range v {
+			if len(r.Peers) == 0 {
+				fmt.Fprintf(w, "%s\t%s\t-\t\t\t\t\t\n", r.Code, r.State)
+			}
+			for _, p := range r.Peers {
+				name := p.Name
+				if p.Name == r.Host {
+					name += " (host)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s ago\t%v\t%d\t%d\n", r.Code, r.State, name, p.Addr,
+					time.Since(p.Joined).Round(time.Second), p.Ready, p.Sent, p.Received)
+			}
+		}
+	case []packs.Version:
+		fmt.Fprintln(w, "PACK\tVERSION\tFILES\tBYTES\tSHA256")
+		for _, pv := range v {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", pv.Pack, pv.Version, len(pv.Files), pv.Bytes, pv.SHA256)
+		}
+	case []api.Job:
+		if len(v) == 0 {
+			fmt.Fprintln(w, "no jobs running")
+			return
+		}
+		fmt.Fprintln(w, "ID\tKIND\tSUBJECT\tRUNNING")
+		for _, j := range v {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%.1fs\n", j.ID, j.Kind, j.Subject, j.Seconds)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package analyze
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/bot"
+)
+
+// printClearTimes plays rollouts of each level and prints them ordered
+// by their clear-time score, easiest first, as the pack would play
+func printClearTimes(data *analyzer.Dataset, opts bot.RolloutOptions) (*analyzer.Table, error) {
+	var times []bot.ClearTime
+	for _, lvl := range data.LevelList() {
+		ct, err := bot.EstimateClearTime(lvl, opts)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, ct)
+	}
+	sort.SliceStable(times, func(i, j int) bool { return times[i].Score < times[j].Score })
+	t := analyzer.NewTable("clear_time", "level", "rollouts:int", "cleared:int", "mean_seconds:float",
+		"stddev_seconds:float", "p10_seconds:float", "p50_seconds:float", "p90_seconds:float", "score:float")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tCLEARED\tMEAN\tSTDDEV\tP10\tP50\tP90\tSCORE")
+	for _, ct := range times {
+		fmt.Fprintf(w, "%s\t%d/%d\t%.1fs\t%.1fs\t%.1fs\t%.1fs\t%.1fs\t%.3f\n", ct.Level, ct.Cleared, ct.Rollouts,
+			ct.Mean, ct.StdDev(), ct.P10, ct.P50, ct.P90, ct.Score)
+		t.Add(ct.Level, ct.Rollouts, ct.Cleared, ct.Mean, ct.StdDev(), ct.P10, ct.P50, ct.P90, ct.Score)
+	}
+	return t, w.Flush()
+}
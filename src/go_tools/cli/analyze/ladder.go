@@ -0,0 +1,83 @@
+package analyze
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/bot"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// playOptions are the rules the replays were played by: the dataset's
+// scoring and the config's spellbook and rules of play
+func playOptions(data *analyzer.Dataset, config utils.Config) (sim.Options, error) {
+	opts := sim.Options{Scoring: data.Scoring}
+	if config.SpellsFile != "" {
+		var err error
+		if opts.Spells, err = sim.LoadSpellbook(config.SpellsFile); err != nil {
+			return opts, err
+		}
+	}
+	if config.PlayRulesFile != "" {
+		rules, err := sim.LoadRules(config.PlayRulesFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.Rules = &rules
+	}
+	return opts, nil
+}
+
+// spellPolicy is the config's bot spell policy, the zero policy without one
+func spellPolicy(config utils.Config) (bot.SpellPolicy, error) {
+	if config.BotSpellsFile == "" {
+		return bot.SpellPolicy{}, nil
+	}
+	return bot.LoadSpellPolicy(config.BotSpellsFile)
+}
+
+// calibrateLadder places the beam bot strengths among the dataset's rated
+// players, writes the ladder to path, and prints it with the percentile
+// each level with objectives is beatable at
+func calibrateLadder(data *analyzer.Dataset, opts sim.Options, spells bot.SpellPolicy, path string) error {
+	levels := data.LevelList()
+	est := bot.EstimateOptions{Spells: spells, Sim: opts}
+	ladder, err := bot.CalibrateLadder(levels, data.Replays, bot.LadderOptions{Estimate: est})
+	if err != nil {
+		return err
+	}
+	if err := ladder.Save(path); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STRENGTH\tPERCENTILE\tRATING\tSESSIONS\tBEATS")
+	for _, r := range ladder.Rungs {
+		fmt.Fprintf(w, "%d\t%.0f\t%.0f\t%d\t%.2f\n", r.Strength, r.Percentile, r.Rating, r.Sessions, r.Beats)
+	}
+	w.Flush()
+	fmt.Printf("\n%d players' %d sessions of %d levels; ladder written to %s\n\n", ladder.Players, ladder.Sessions, ladder.Levels, path)
+
+	for _, r := range ladder.Rungs {
+		est.Strengths = append(est.Strengths, r.Strength)
+	}
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tBEATABLE AT")
+	for _, lvl := range levels {
+		if len(lvl.Objectives) == 0 {
+			continue
+		}
+		e, err := bot.EstimateDifficulty(lvl, est)
+		if err != nil {
+			return fmt.Errorf("level %s: %w", lvl.Name, err)
+		}
+		at := "no strength beats it"
+		if pct, ok := e.BeatableAt(ladder); ok {
+			at = fmt.Sprintf("percentile %.0f", pct)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", lvl.Name, at)
+	}
+	return w.Flush()
+}
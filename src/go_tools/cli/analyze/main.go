@@ -0,0 +1,1440 @@
+// Package analyze is stt analyze, which reports on the sessions played
+// and the levels they were played on
+package analyze
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/bot"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/notify"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/plugins"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rating"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replaystore"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/store"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Main runs stt analyze with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("analyze"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	replayDir := fs.String("replays", "", "directory of replay files, a replay store, or a replay store server's URL, optionally of a search like http://host:8098/replays?level=pack3/* (default from config)")
+	levelDir := fs.String("levels", "", "directory of level files the replays were played on")
+	outDir := fs.String("out", "", "report output directory (default from config)")
+	eventLog := fs.String("events", "", "client event log for funnel and retention analysis, or sqlite:PATH for the events stt serve telemetry and stt telemetry stored there (default from config)")
+	matchLog := fs.String("matches", "", "match log (one JSON match per line) rated alongside the replays")
+	tailSource := fs.String("tail", "", "follow a live session log file, or tcp:// or unix:// socket, and print rolling metrics")
+	window := fs.Duration("window", time.Minute, "rolling metrics window for -tail")
+	interval := fs.Duration("interval", 5*time.Second, "how often -tail prints metrics")
+	tailFormat := fs.String("tail-format", "proto", "format of the -tail log: proto for length-prefixed game messages, or json for the legacy JSON lines")
+	record := fs.String("record", "", "with -tail, write each session the log sees through as a replay to this directory, signed with the config's replay key")
+	compare := fs.Bool("compare", false, "compare the two level packs given as arguments: level directories, or generator config files to generate packs from")
+	packSize := fs.Int("pack-size", 20, "levels generated per config for -compare")
+	difficulty := fs.Bool("difficulty", false, "print the levels in -levels ordered from easiest to hardest")
+	rollouts := fs.Int("rollouts", 0, "with -difficulty, play this many bot rollouts of each level and order them by their expected clear time instead")
+	solve := fs.Bool("solve", false, "check that the objectives of every level in -levels can be achieved at all")
+	diff := fs.String("diff", "", "write heatmaps of cohort A minus cohort B, given as A:B with cohorts like band=novice or version=1.2")
+	annotate := fs.String("annotate", "", "write the -levels levels, annotated with their choke points, to this directory")
+	serveAddr := fs.String("serve", "", "serve the analysis over HTTP on this address, e.g. :8090, instead of writing reports")
+	tune := fs.Bool("tune", false, "suggest generator config changes from the sessions played on the -levels levels, written as a patch for generate -patch")
+	regressions := fs.Bool("regressions", false, "compare balance metrics of two game versions in the results database and exit with status 2 on significant changes")
+	baseline := fs.String("baseline", "", "game version -regressions compares against (default the one before -candidate)")
+	candidate := fs.String("candidate", "", "game version -regressions checks (default the newest recorded)")
+	anonymizeDir := fs.String("anonymize", "", "write the replays, anonymized per config, to this directory for sharing")
+	force := fs.Bool("force", false, "recompute every replay and level instead of reusing cached results")
+	profile := fs.Bool("profile", false, "write CPU and heap profiles and sampled stacks of the run to the config's profileDir, and serve /debug/pprof with -serve")
+	since := fs.String("since", "", "only analyze sessions started on or after this date, e.g. 2024-06-01")
+	until := fs.String("until", "", "only analyze sessions started on or before this date")
+	levelFilter := fs.String("level", "", "only analyze these levels and their sessions: comma-separated name patterns like pack3/*")
+	playerFilter := fs.String("player", "", "only analyze sessions with one of these comma-separated player IDs or names")
+	verify := fs.Bool("verify", false, "play the -replays replays again on their -levels levels, check them against the state checksums they recorded, and exit with status 2 if any diverged")
+	ladderPath := fs.String("ladder", "", "calibrate the beam bot strengths against the rated solo sessions in -replays on their -levels levels, write the ladder to this file, and print the skill percentile each level is beatable at")
+	passes := fs.String("passes", "", "run only these comma-separated report sections and analysis passes, e.g. heatmap,balance (default all)")
+	watchFlags := cli.AddWatchFlags(fs, "the config, the replays, levels and logs analyzed or the report templates")
+	modes := map[string]*bool{"replays": nil, "compare": compare, "difficulty": difficulty, "solve": solve, "tune": tune, "regressions": regressions, "verify": verify}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [replays|compare|difficulty|solve|tune|regressions|verify] [flags] [args]\n\n", cli.Name("analyze"))
+		fmt.Fprintln(fs.Output(), "A subcommand is the same as its flag; replays, the default, analyzes the sessions in -replays.")
+		fs.PrintDefaults()
+	}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		mode, ok := modes[args[0]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown subcommand %q\n", args[0])
+			fs.Usage()
+			os.Exit(2)
+		}
+		fs.Parse(args[1:])
+		if mode != nil {
+			*mode = true
+		}
+	} else {
+		fs.Parse(args)
+	}
+
+	config := cli.Config(*configPath)
+	if *replayDir == "" {
+		*replayDir = config.ReplayDir
+	}
+	if *outDir == "" {
+		*outDir = config.ReportDir
+	}
+	if *eventLog == "" {
+		*eventLog = config.ClientEventLog
+	}
+	if *watchFlags.Watch {
+		if *serveAddr != "" || *tailSource != "" {
+			fail(errors.New("-serve and -tail keep running; they don't -watch"))
+		}
+		inputs := []string{cli.ConfigPath(*configPath), *levelDir, strings.TrimPrefix(*eventLog, eventStorePrefix), *matchLog, config.ScoringFile, config.SpellsFile,
+			config.PlayRulesFile, config.ReplayKeysFile, config.PluginsDir}
+		if !strings.Contains(*replayDir, "://") {
+			inputs = append(inputs, *replayDir)
+		}
+		inputs = append(inputs, config.ReportTemplates...)
+		inputs = append(inputs, fs.Args()...)
+		cli.Watch("analyze", args, watchFlags, inputs, []string{*outDir, config.AnalysisCache, config.ResultsDB})
+		return
+	}
+	notifier, err := notify.New(config.Webhooks, config.WebhookArtifactURL)
+	if err != nil {
+		fail(err)
+	}
+	if !*compare && !*regressions && *tailSource == "" && !*difficulty && !*solve && *anonymizeDir == "" && !*tune && !*verify && *ladderPath == "" && *serveAddr == "" {
+		analysis = notifier.Start(notify.JobAnalyze)
+	}
+	var timeline *profiler.Timeline
+	var disk *profiler.IORecorder
+	if *profile {
+		if config.ProfileIO {
+			disk = profiler.NewIORecorder()
+		}
+		stop, t := startProfile(config, disk)
+		defer stop()
+		timeline = t
+	}
+	defer startTracing(config, "supertetris-analyze", timeline)()
+	ctx, span := tracing.Start(context.Background(), "analyze")
+	defer span.End()
+
+	if *compare {
+		if fs.NArg() != 2 {
+			fail(fmt.Errorf("-compare needs two level directories"))
+		}
+		cmp, err := comparePacks(fs.Arg(0), fs.Arg(1), *packSize)
+		if err != nil {
+			fail(err)
+		}
+		tables := []*analyzer.Table{analyzer.ComparisonTable(cmp)}
+		exportTables(config, *outDir, tables...)
+		recordResults(config, "compare", nil, tables...)
+		return
+	}
+	if *regressions {
+		found, err := checkRegressions(config, *outDir, *baseline, *candidate)
+		if err != nil {
+			fail(err)
+		}
+		if found {
+			os.Exit(2)
+		}
+		return
+	}
+	var keys *replay.Keys
+	if config.ReplayKeysFile != "" {
+		var err error
+		if keys, err = replay.ReadKeys(config.ReplayKeysFile); err != nil {
+			fail(err)
+		}
+	}
+	if *tailSource != "" {
+		if err := tail(*tailSource, *tailFormat, *window, *interval, *record, keys); err != nil {
+			fail(err)
+		}
+		return
+	} else if *record != "" {
+		fail(fmt.Errorf("-record needs a -tail log to record"))
+	}
+
+	data := analyzer.NewDataset()
+	data.Keys = keys
+	if config.ScoringFile != "" {
+		scoring, err := sim.LoadScoring(config.ScoringFile)
+		if err != nil {
+			fail(err)
+		}
+		data.Scoring = &scoring
+	}
+	if disk != nil {
+		data.ReadFile = func(kind, path string) ([]byte, error) {
+			op := profiler.IOReplayLoad
+			if kind == "level" {
+				op = profiler.IOLevelLoad
+			}
+			return disk.ReadFile(op, path)
+		}
+	}
+	filter, err := parseFilter(*since, *until, *levelFilter, *playerFilter)
+	if err != nil {
+		fail(err)
+	}
+	data.Filter = filter
+	for _, c := range config.PassCommands {
+		analyzer.RegisterPass(&analyzer.CommandPass{PassName: c.Name, Command: c.Command, Inputs: c.Requires})
+	}
+	pluginHost, err := plugins.Open(config.PluginsDir)
+	if err != nil {
+		fail(err)
+	}
+	defer pluginHost.Close()
+	registerPluginPasses(pluginHost)
+	sel, err := parseSelection(*passes, config.AnalysisPasses)
+	if err != nil {
+		fail(err)
+	}
+	if len(config.Anonymize) > 0 {
+		anon, err := replay.NewAnonymizer(config.Anonymize, config.AnonymizeSalt)
+		if err != nil {
+			fail(err)
+		}
+		data.Anonymizer = anon
+	} else if *anonymizeDir != "" {
+		fail(fmt.Errorf("-anonymize needs the anonymize fields set in the config"))
+	}
+	if config.AnalysisCache != "" {
+		cache, err := analyzer.OpenCache(config.AnalysisCache, *force)
+		if err != nil {
+			fail(err)
+		}
+		data.Cache = cache
+		defer reportCache(cache)
+	}
+	pool, stopProgress := progressPool(config.AnalysisWorkers)
+	defer stopProgress()
+	fallback := level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight}
+	if *levelDir != "" {
+		endLoad := profiler.Region("level load")
+		failed, err := data.LoadLevelsWith(*levelDir, pool)
+		endLoad()
+		if err != nil {
+			fail(err)
+		}
+		warnFailed(failed)
+	}
+	if *difficulty && *rollouts > 0 {
+		opts, err := playOptions(data, config)
+		if err != nil {
+			fail(err)
+		}
+		spells, err := spellPolicy(config)
+		if err != nil {
+			fail(err)
+		}
+		table, err := printClearTimes(data, bot.RolloutOptions{Rollouts: *rollouts, Spells: spells, Sim: opts})
+		if err != nil {
+			fail(err)
+		}
+		exportTables(config, *outDir, table)
+		recordResults(config, "clear_time", data, table)
+		return
+	}
+	if *difficulty {
+		data.Warm(fallback, pool)
+		tables := []*analyzer.Table{printDifficulty(data)}
+		exportTables(config, *outDir, tables...)
+		recordResults(config, "difficulty", data, tables...)
+		return
+	}
+	if *solve {
+		tables := []*analyzer.Table{printSolvability(data, config)}
+		exportTables(config, *outDir, tables...)
+		recordResults(config, "solve", data, tables...)
+		return
+	}
+
+	endLoad := profiler.Region("replay load")
+	failed, err := loadReplays(data, *replayDir, pool)
+	endLoad()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fail(err)
+		}
+		cli.Warnf("no replay directory %s", *replayDir)
+	}
+	warnFailed(failed)
+	if *verify {
+		opts, err := playOptions(data, config)
+		if err != nil {
+			fail(err)
+		}
+		if verifyReplays(data, opts) > 0 {
+			os.Exit(2)
+		}
+		return
+	}
+	if *ladderPath != "" {
+		opts, err := playOptions(data, config)
+		if err != nil {
+			fail(err)
+		}
+		spells, err := spellPolicy(config)
+		if err != nil {
+			fail(err)
+		}
+		if err := calibrateLadder(data, opts, spells, *ladderPath); err != nil {
+			fail(err)
+		}
+		return
+	}
+	if *anonymizeDir != "" {
+		if err := writeReplays(*anonymizeDir, data.Replays, disk); err != nil {
+			fail(err)
+		}
+		fmt.Printf("%d anonymized replays written to %s\n", len(data.Replays), *anonymizeDir)
+		return
+	}
+	data.Warm(fallback, pool)
+	if *tune {
+		if err := writeTuning(data, config, *outDir); err != nil {
+			fail(err)
+		}
+		return
+	}
+	if *serveAddr != "" {
+		span.End() // requests are traced on their own
+		saveDir := *replayDir
+		if replaystore.IsURL(saveDir) || replaystore.IsStore(saveDir) {
+			saveDir = "" // submitted replays aren't loose files there
+		}
+		if err := serve(*serveAddr, data, config, saveDir, len(failed), *profile); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	var tables []*analyzer.Table
+	if sel.run(sectionPatterns) && config.AnalyzeBlockPatterns && len(data.Levels) > 0 {
+		tables = append(tables, printPatterns(data, config))
+	}
+	if sel.run(sectionSummary) {
+		printReplays(data.Replays)
+	}
+	if sel.run(sectionFairness) {
+		fairness, err := printFairness(data, config)
+		if err != nil {
+			fail(err)
+		}
+		tables = append(tables, fairness...)
+	}
+	if sel.run(sectionCheat) {
+		tables = append(tables, printSuspicions(data, config))
+	}
+	if sel.run(sectionTechniques) {
+		if techniques := printTechniques(data, config); techniques != nil {
+			tables = append(tables, techniques)
+		}
+	}
+	if sel.run(sectionFinesse) {
+		if finesse := printFinesse(data, config); finesse != nil {
+			tables = append(tables, finesse)
+		}
+	}
+	if len(data.Replays) > 0 {
+		if sel.run(sectionComplexity) {
+			tables = append(tables, analyzer.ComplexityTable(data.ComplexityProfiles(fallback)))
+		}
+		if sel.run(sectionChokePoints) {
+			chokes, err := printChokePoints(data, fallback, *annotate, disk)
+			if err != nil {
+				fail(err)
+			}
+			tables = append(tables, chokes)
+		}
+		if sel.run(sectionSurvival) {
+			survival, err := printSurvival(data)
+			if err != nil {
+				fail(err)
+			}
+			tables = append(tables, survival)
+		}
+		if sel.run(sectionPlaystyles) {
+			tables = append(tables, printPlaystyles(data, fallback, config.PlaystyleClusters)...)
+		}
+	}
+	if sel.run(sectionExperiments) {
+		experiments, err := printExperiments(data, config)
+		if err != nil {
+			fail(err)
+		}
+		tables = append(tables, experiments...)
+	}
+
+	if sel.run(sectionRatings) && config.AnalyzePlayerStats {
+		ratings, err := writeRatings(data, config, *matchLog, *outDir)
+		if err != nil {
+			fail(err)
+		}
+		tables = append(tables, ratings...)
+	}
+
+	var events []analyzer.ClientEvent
+	var funnels []analyzer.Funnel
+	var retention []analyzer.RetentionCohort
+	if *eventLog != "" {
+		if events, err = loadEvents(*eventLog); err != nil {
+			fail(err)
+		}
+		if sel.run(sectionFunnels) {
+			funnels = analyzer.ComputeFunnels(events, analyzer.DefaultFunnel)
+			tables = append(tables, analyzer.FunnelTable(funnels))
+		}
+		if sel.run(sectionRetention) {
+			retention = analyzer.ComputeRetention(events)
+			tables = append(tables, analyzer.RetentionTable(retention))
+		}
+	}
+	var passTables []*analyzer.Table
+	if sel.runsPasses() {
+		if passTables, err = runPasses(analyzer.PassInputs{Data: data, Events: events, Context: ctx}, sel.passes); err != nil {
+			fail(err)
+		}
+	}
+	tables = append(tables, passTables...)
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fail(err)
+	}
+	var balance analyzer.BalanceReport
+	if (sel.run(sectionBalance) && config.AnalyzeGameBalance) || len(config.ReportTemplates) > 0 {
+		balance = analyzer.AnalyzeGameBalance(data.Replays)
+		balance.Funnels = funnels
+		balance.Retention = retention
+		balance.Passes = passTables
+	}
+	if sel.run(sectionBalance) && config.AnalyzeGameBalance {
+		path := filepath.Join(*outDir, "balance.html")
+		if err := balance.SaveHTML(path); err != nil {
+			fail(err)
+		}
+		fmt.Println("balance report written to", path)
+		analysis.Artifact("balance report", path)
+		tables = append(tables, analyzer.WinRateTable(balance), analyzer.SpellUsageTable(balance.SpellUsage))
+	}
+	if sel.run(sectionHeatmap) && config.GenerateHeatmaps {
+		heatmaps, err := writeHeatmaps(data, config, filepath.Join(*outDir, "heatmaps"))
+		if err != nil {
+			fail(err)
+		}
+		tables = append(tables, heatmaps)
+	}
+	if *diff != "" {
+		diffs, err := writeHeatmapDiffs(data, config, *diff, filepath.Join(*outDir, "heatmaps", "diff"))
+		if err != nil {
+			fail(err)
+		}
+		tables = append(tables, diffs)
+	}
+	if err := writeCustomReports(config.ReportTemplates, *outDir, analyzer.ReportContext{
+		Generated: time.Now(), Balance: balance, Tables: tables}); err != nil {
+		fail(err)
+	}
+	exportTables(config, *outDir, tables...)
+	recordResults(config, "analyze", data, tables...)
+	analysis.Field("sessions", "%d", len(data.Replays))
+	analysis.Field("levels", "%d", len(data.Levels))
+	analysis.Field("tables", "%d", len(tables))
+	analysis.Artifact("reports", *outDir)
+	if err := analysis.Succeed(fmt.Sprintf("analyzed %d sessions into %s", len(data.Replays), *outDir)); err != nil {
+		cli.Warn(err)
+	}
+}
+
+// writeCustomReports renders each user-supplied report template into dir
+func writeCustomReports(paths []string, dir string, ctx analyzer.ReportContext) error {
+	for _, p := range paths {
+		tmpl, err := analyzer.LoadReportTemplate(p)
+		if err != nil {
+			return err
+		}
+		path, err := tmpl.Save(dir, ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println("report written to", path)
+	}
+	return nil
+}
+
+// printTechniques reports advanced technique frequencies per skill band
+func printTechniques(data *analyzer.Dataset, config utils.Config) *analyzer.Table {
+	stats := data.AnalyzeTechniques(level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight})
+	if len(stats) == 0 {
+		return nil
+	}
+	fmt.Println("\ntechniques per skill band (per 100 pieces):")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BAND\tSESSIONS\tPIECES\tTETRIS\tT-SPIN\tMINI\tCOMBO\tMAX COMBO\tB2B\tPERFECT")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t%d\t%.2f\t%d\n", s.Band, s.Sessions, s.Pieces,
+			s.Per100(s.Tetrises), s.Per100(s.TSpins), s.Per100(s.TSpinMinis), s.Per100(s.Combos), s.MaxCombo,
+			s.Per100(s.BackToBacks), s.PerfectClears)
+	}
+	w.Flush()
+	return analyzer.TechniqueTable(stats)
+}
+
+// printFinesse reports each player's wasted inputs and misdrops
+func printFinesse(data *analyzer.Dataset, config utils.Config) *analyzer.Table {
+	stats := data.AnalyzeFinesse(level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight})
+	if len(stats) == 0 {
+		return nil
+	}
+	fmt.Println("\nfinesse per player (inputs against the fewest placing the same pieces):")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PLAYER\tSESSIONS\tPIECES\tINPUTS\tOPTIMAL\tWASTED/PIECE\tFAULTS\tMISDROPS\tSKIPPED")
+	for _, s := range stats {
+		player := s.Player
+		if s.Name != "" {
+			player += " (" + s.Name + ")"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.2f\t%.1f%%\t%.1f%%\t%d\n", player, s.Sessions, s.Pieces, s.Inputs,
+			s.Optimal, s.WastedPerPiece(), 100*s.FaultRate(), 100*s.MisdropRate(), s.Skipped)
+	}
+	w.Flush()
+	return analyzer.FinesseTable(stats)
+}
+
+// printChokePoints lists where each level's players top out or lose
+// control, and writes annotated copies of the levels when dir is set
+func printChokePoints(data *analyzer.Dataset, fallback level.GridSize, dir string, disk *profiler.IORecorder) (*analyzer.Table, error) {
+	levels := data.ChokePoints(fallback, analyzer.DefaultChokeOptions())
+	fmt.Println("\nchoke points (incidents per session):")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tSESSIONS\tWHERE\tTOP OUTS\tCONTROL LOSSES\tRATE")
+	for _, lc := range levels {
+		for _, cp := range lc.Regions {
+			fmt.Fprintf(w, "%s\t%d\tcells (%d,%d)-(%d,%d)\t%d\t%d\t%.2f\n", lc.Level, lc.Sessions,
+				cp.X, cp.Y, cp.X+cp.Width-1, cp.Y+cp.Height-1, cp.TopOuts, cp.ControlLosses, cp.Rate)
+		}
+		for _, cp := range lc.Moments {
+			fmt.Fprintf(w, "%s\t%d\t%ds-%ds\t%d\t%d\t%.2f\n", lc.Level, lc.Sessions,
+				cp.FromSec, cp.ToSec, cp.TopOuts, cp.ControlLosses, cp.Rate)
+		}
+	}
+	w.Flush()
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		annotated := 0
+		for _, lc := range levels {
+			lvl := data.Levels[lc.Level]
+			if lvl == nil {
+				continue
+			}
+			if err := analyzer.AnnotateChokePoints(lvl, lc); err != nil {
+				return nil, err
+			}
+			path := filepath.Join(dir, generator.LevelFileName(lvl.Name))
+			if err := disk.Time(profiler.IOLevelSave, path, func() error { return lvl.Save(path) }); err != nil {
+				return nil, err
+			}
+			annotated++
+		}
+		fmt.Printf("%d annotated levels written to %s\n", annotated, dir)
+	}
+	return analyzer.ChokePointTable(levels), nil
+}
+
+// printSurvival prints median survival per level and per difficulty and
+// whether the cohorts differ
+func printSurvival(data *analyzer.Dataset) (*analyzer.Table, error) {
+	var reports []analyzer.SurvivalReport
+	for _, by := range []string{analyzer.CohortLevel, analyzer.CohortDifficulty} {
+		seconds, err := data.Survival(by, analyzer.SurvivalSeconds)
+		if err != nil {
+			return nil, err
+		}
+		pieces, err := data.Survival(by, analyzer.SurvivalPieces)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, seconds, pieces)
+
+		fmt.Printf("\nsurvival by %s (log-rank p=%.4f over seconds, p=%.4f over pieces):\n", by, seconds.PValue, pieces.PValue)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "GROUP\tSESSIONS\tLOSSES\tMEDIAN SEC\tMEDIAN PIECES")
+		for i, c := range seconds.Curves {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", c.Group, c.Subjects, c.Losses, median(c.Median), median(pieces.Curves[i].Median))
+		}
+		w.Flush()
+	}
+	return analyzer.SurvivalTable(reports), nil
+}
+
+// printPlaystyles clusters the players by behaviour and prints each
+// playstyle's share, overall and per week
+func printPlaystyles(data *analyzer.Dataset, fallback level.GridSize, k int) []*analyzer.Table {
+	report, err := data.Playstyles(k, fallback)
+	if err != nil {
+		cli.Warnf("skipping playstyles: %v", err)
+		return nil
+	}
+	fmt.Println("\nplaystyles:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STYLE\tLABEL\tPLAYERS\tSHARE")
+	for i, s := range report.Styles {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%.1f%%\n", i, s.Label, len(s.Players), s.Share*100)
+	}
+	w.Flush()
+	if len(report.Periods) > 0 {
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		header := "PERIOD\tPLAYERS"
+		for i := range report.Styles {
+			header += fmt.Sprintf("\tSTYLE %d", i)
+		}
+		fmt.Fprintln(w, header)
+		for _, p := range report.Periods {
+			line := fmt.Sprintf("%s\t%d", p.Period, p.Players)
+			for _, share := range p.Shares {
+				line += fmt.Sprintf("\t%.1f%%", share*100)
+			}
+			fmt.Fprintln(w, line)
+		}
+		w.Flush()
+	}
+	styles, shares := analyzer.PlaystyleTables(report)
+	return []*analyzer.Table{styles, shares}
+}
+
+// progressPool returns a worker pool reporting its progress on stderr, at
+// most once a second per stage, and a function that stops the reporting
+func progressPool(workers int) (analyzer.Pool, func()) {
+	progress := make(chan analyzer.Progress)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var last time.Time
+		for p := range progress {
+			if p.Done < p.Total && time.Since(last) < time.Second {
+				continue
+			}
+			last = time.Now()
+			line := fmt.Sprintf("%s: %d/%d", p.Stage, p.Done, p.Total)
+			if p.Errors > 0 {
+				line += fmt.Sprintf(", %d failed", p.Errors)
+			}
+			if p.Done < p.Total {
+				line += fmt.Sprintf(", %s left", p.ETA.Round(time.Second))
+			} else {
+				line += fmt.Sprintf(" in %s", p.Elapsed.Round(time.Millisecond))
+			}
+			fmt.Fprintln(os.Stderr, line)
+		}
+	}()
+	return analyzer.Pool{Workers: workers, Progress: progress}, func() {
+		close(progress)
+		<-done
+	}
+}
+
+// loadReplays loads the -replays source: a directory of replay files, a
+// replay store, or the URL of a store's server or of a search on it
+func loadReplays(data *analyzer.Dataset, source string, pool analyzer.Pool) ([]analyzer.FileError, error) {
+	switch {
+	case replaystore.IsURL(source):
+		c, err := replaystore.NewClient(source)
+		if err != nil {
+			return nil, err
+		}
+		return data.LoadReplaysFrom(c, pool)
+	case replaystore.IsStore(source):
+		s, err := replaystore.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer s.Close()
+		return data.LoadReplaysFrom(s, pool)
+	}
+	return data.LoadReplaysWith(source, pool)
+}
+
+// eventStorePrefix marks an -events source as a results store's
+const eventStorePrefix = "sqlite:"
+
+// loadEvents loads the -events source: a client event log, or the events
+// ingested into a results store
+func loadEvents(source string) ([]analyzer.ClientEvent, error) {
+	path, ok := strings.CutPrefix(source, eventStorePrefix)
+	if !ok {
+		return analyzer.LoadClientEvents(source)
+	}
+	db, err := store.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return db.ClientEvents()
+}
+
+// warnFailed lists the files that were skipped
+func warnFailed(failed []analyzer.FileError) {
+	const shown = 10
+	for i, f := range failed {
+		if i == shown {
+			cli.Warnf("%d more files skipped", len(failed)-shown)
+			break
+		}
+		cli.Warnf("skipping %v", f)
+	}
+}
+
+// reportCache prints how much work the cache saved
+func reportCache(cache *analyzer.Cache) {
+	hits, misses := cache.Stats()
+	if hits+misses > 0 {
+		fmt.Fprintf(os.Stderr, "cache: %d results reused, %d computed\n", hits, misses)
+	}
+	if err := cache.Err(); err != nil {
+		cli.Warnf("writing analysis cache: %v", err)
+	}
+}
+
+func median(v float64) string {
+	if v < 0 {
+		return "not reached"
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+// printExperiments compares the arms of every experiment the sessions are
+// tagged with
+func printExperiments(data *analyzer.Dataset, config utils.Config) ([]*analyzer.Table, error) {
+	names := data.Experiments()
+	if len(names) == 0 {
+		return nil, nil
+	}
+	opts := analyzer.DefaultExperimentOptions()
+	if config.ExperimentMetric != "" {
+		opts.Primary = config.ExperimentMetric
+	}
+	if config.ExperimentConfidence > 0 {
+		opts.Confidence = config.ExperimentConfidence
+	}
+	var reports []analyzer.ExperimentReport
+	for _, name := range names {
+		report, err := data.AnalyzeExperiment(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+
+		fmt.Printf("\nexperiment %s (%.0f%% intervals, control %s):\n", name, report.Confidence*100, report.Control)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ARM\tSESSIONS\tMETRIC\tVALUE\tINTERVAL\tLIFT\tP\tADJUSTED P")
+		for _, a := range report.Arms {
+			for _, m := range a.Metrics {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%.3f\t[%.3f, %.3f]\t%+.1f%%\t%.4f\t%.4f\n",
+					a.Arm, a.Sessions, m.Metric, m.Value, m.Low, m.High, m.Lift*100, m.PValue, m.Adjusted)
+			}
+		}
+		w.Flush()
+		fmt.Println(report.Decision)
+	}
+	return []*analyzer.Table{analyzer.ExperimentTable(reports)}, nil
+}
+
+// registerPluginPasses registers the passes of the plugins, but for those
+// named as a pass already is
+func registerPluginPasses(h *plugins.Host) {
+	for _, f := range h.Failures {
+		cli.Warnf("plugin %s: %v", f.Path, f.Err)
+	}
+	registered := make(map[string]bool)
+	for _, p := range analyzer.Passes() {
+		registered[p.Name()] = true
+	}
+	for _, p := range h.Passes() {
+		if registered[p.Name()] {
+			cli.Warnf("plugin pass %s: a pass has that name already", p.Name())
+			continue
+		}
+		analyzer.RegisterPass(p)
+	}
+}
+
+// runPasses runs the named analysis passes, or every registered one
+func runPasses(in analyzer.PassInputs, names []string) ([]*analyzer.Table, error) {
+	tables, skipped, err := analyzer.RunPasses(in, names)
+	if len(skipped) > 0 {
+		cli.Warnf("skipped analysis passes missing inputs: %s", strings.Join(skipped, ", "))
+	}
+	return tables, err
+}
+
+// Built-in report sections -passes can select alongside the registered
+// analysis passes
+const (
+	sectionSummary     = "summary"
+	sectionPatterns    = "patterns"
+	sectionFairness    = "fairness"
+	sectionCheat       = "cheat"
+	sectionTechniques  = "techniques"
+	sectionFinesse     = "finesse"
+	sectionComplexity  = "complexity"
+	sectionChokePoints = "chokepoints"
+	sectionSurvival    = "survival"
+	sectionPlaystyles  = "playstyles"
+	sectionExperiments = "experiments"
+	sectionRatings     = "ratings"
+	sectionFunnels     = "funnels"
+	sectionRetention   = "retention"
+	sectionBalance     = "balance"
+	sectionHeatmap     = "heatmap"
+)
+
+var sections = []string{sectionSummary, sectionPatterns, sectionFairness, sectionCheat, sectionTechniques,
+	sectionFinesse, sectionComplexity, sectionChokePoints, sectionSurvival, sectionPlaystyles, sectionExperiments,
+	sectionRatings, sectionFunnels, sectionRetention, sectionBalance, sectionHeatmap}
+
+// selection is the report sections and analysis passes a run produces
+type selection struct {
+	all      bool
+	sections map[string]bool
+	passes   []string // registered passes to run; empty with all runs every one
+}
+
+func (s selection) run(section string) bool { return s.all || s.sections[section] }
+func (s selection) runsPasses() bool        { return s.all || len(s.passes) > 0 }
+
+// parseSelection reads -passes, a comma-separated list of section and
+// registered pass names; empty selects everything, with the configured
+// passes
+func parseSelection(spec string, configured []string) (selection, error) {
+	if spec == "" {
+		return selection{all: true, passes: configured}, nil
+	}
+	registered := make(map[string]bool)
+	for _, p := range analyzer.Passes() {
+		registered[p.Name()] = true
+	}
+	sel := selection{sections: make(map[string]bool)}
+	for _, name := range splitList(spec) {
+		switch {
+		case registered[name]:
+			sel.passes = append(sel.passes, name)
+		case slices.Contains(sections, name):
+			sel.sections[name] = true
+		default:
+			var passes []string
+			for p := range registered {
+				passes = append(passes, p)
+			}
+			sort.Strings(passes)
+			return sel, fmt.Errorf("unknown section or pass %q; sections are %s and passes %s",
+				name, strings.Join(sections, ", "), strings.Join(passes, ", "))
+		}
+	}
+	return sel, nil
+}
+
+// parseFilter builds the dataset filter from the -since, -until, -level
+// and -player flags; it returns nil when none is set
+func parseFilter(since, until, levels, players string) (*analyzer.ReplayFilter, error) {
+	if since == "" && until == "" && levels == "" && players == "" {
+		return nil, nil
+	}
+	var f analyzer.ReplayFilter
+	if since != "" {
+		t, err := time.Parse(time.DateOnly, since)
+		if err != nil {
+			return nil, fmt.Errorf("-since: %w", err)
+		}
+		f.Since = t
+	}
+	if until != "" {
+		t, err := time.Parse(time.DateOnly, until)
+		if err != nil {
+			return nil, fmt.Errorf("-until: %w", err)
+		}
+		f.Until = t.AddDate(0, 0, 1)
+	}
+	f.Levels = splitList(levels)
+	f.Players = splitList(players)
+	return &f, f.Validate()
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// exportTables writes the analysis tables in every configured export format
+func exportTables(config utils.Config, dir string, tables ...*analyzer.Table) {
+	if len(config.ExportFormats) == 0 {
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fail(err)
+	}
+	for _, t := range tables {
+		if err := t.Export(dir, config.ExportFormats); err != nil {
+			fail(err)
+		}
+	}
+	fmt.Printf("%d tables exported to %s as %s\n", len(tables), dir, strings.Join(config.ExportFormats, ", "))
+}
+
+// recordResults appends a run with the dataset and tables to the results
+// database, when one is configured
+func recordResults(config utils.Config, label string, data *analyzer.Dataset, tables ...*analyzer.Table) {
+	if config.ResultsDB == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(config.ResultsDB), 0755); err != nil {
+		fail(err)
+	}
+	db, err := store.Open(config.ResultsDB)
+	if err != nil {
+		fail(err)
+	}
+	defer db.Close()
+	run, err := db.BeginRun(label, time.Now())
+	if err != nil {
+		fail(err)
+	}
+	if data != nil {
+		if err := db.RecordSessions(run, data.Replays); err != nil {
+			fail(err)
+		}
+		if err := db.RecordLevels(run, data.LevelList()); err != nil {
+			fail(err)
+		}
+		if err := db.RecordBalance(run, analyzer.VersionBalance(data.Replays)); err != nil {
+			fail(err)
+		}
+	}
+	for _, t := range tables {
+		if err := db.RecordTable(run, t); err != nil {
+			fail(err)
+		}
+	}
+	fmt.Printf("results recorded as run %d in %s\n", run.ID, config.ResultsDB)
+}
+
+// writeTuning prints generator tuning suggestions and writes them to the
+// report directory as a config patch
+func writeTuning(data *analyzer.Dataset, config utils.Config, outDir string) error {
+	report := generator.SuggestTuning(config, data, generator.DefaultTuningOptions())
+	fmt.Printf("%d sessions on %d generated levels: clear rate %.0f%%, target %.0f%%\n",
+		report.Sessions, report.Levels, 100*report.ClearRate, 100*report.TargetClearRate)
+	if len(report.Suggestions) == 0 {
+		fmt.Println("no generator changes suggested")
+		return nil
+	}
+	for _, s := range report.Suggestions {
+		fmt.Println(s)
+	}
+	patch, err := report.Patch()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(outDir, "generator_tuning.json")
+	if err := os.WriteFile(path, patch, 0644); err != nil {
+		return err
+	}
+	fmt.Println("config patch written to", path)
+	return nil
+}
+
+// writeReplays saves each replay to dir, named after its session, timing
+// the writes with a disk recorder
+func writeReplays(dir string, replays []*replay.Replay, disk *profiler.IORecorder) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, r := range replays {
+		name := strings.Map(func(c rune) rune {
+			if c == '/' || c == os.PathSeparator {
+				return '_'
+			}
+			return c
+		}, r.SessionID)
+		path := filepath.Join(dir, name+".json")
+		if err := disk.Time(profiler.IOReplayWrite, path, func() error { return r.Save(path) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRegressions prints the balance metrics that changed significantly
+// between two recorded game versions and reports whether there were any
+func checkRegressions(config utils.Config, outDir, baseline, candidate string) (bool, error) {
+	if config.ResultsDB == "" {
+		return false, fmt.Errorf("-regressions needs a results database")
+	}
+	db, err := store.Open(config.ResultsDB)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+	if baseline == "" || candidate == "" {
+		versions, err := db.BalanceVersions()
+		if err != nil {
+			return false, err
+		}
+		if candidate == "" && len(versions) > 0 {
+			candidate = versions[len(versions)-1]
+		}
+		if baseline == "" {
+			for _, v := range versions {
+				if analyzer.CompareVersions(v, candidate) < 0 {
+					baseline = v
+				}
+			}
+		}
+		if baseline == "" || candidate == "" {
+			return false, fmt.Errorf("need balance metrics of two game versions, %s has %d", config.ResultsDB, len(versions))
+		}
+	}
+	base, err := db.VersionBalance(baseline)
+	if err != nil {
+		return false, err
+	}
+	cand, err := db.VersionBalance(candidate)
+	if err != nil {
+		return false, err
+	}
+	if len(base) == 0 || len(cand) == 0 {
+		return false, fmt.Errorf("no balance metrics recorded for %s and %s", baseline, candidate)
+	}
+	opts := analyzer.RegressionOptions{MinDelta: config.RegressionMinDelta, Alpha: config.RegressionAlpha, MinTrials: config.RegressionMinTrials}
+	found := analyzer.DetectRegressions(base, cand, opts)
+
+	fmt.Printf("%s against %s: %d significant balance changes\n", candidate, baseline, len(found))
+	if len(found) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "METRIC\tSUBJECT\tBASELINE\tCANDIDATE\tDELTA\tGAMES\tP\tADJUSTED P")
+		for _, r := range found {
+			fmt.Fprintf(w, "%s\t%s\t%.1f%%\t%.1f%%\t%+.1f%%\t%d/%d\t%.4f\t%.4f\n", r.Metric, r.Subject, 100*r.BaselineRate,
+				100*r.CandidateRate, 100*r.Delta, r.BaselineTrials, r.CandidateTrials, r.PValue, r.Adjusted)
+		}
+		w.Flush()
+	}
+	exportTables(config, outDir, analyzer.RegressionTable(found))
+	return len(found) > 0, nil
+}
+
+// startProfile starts profiling the run per config and returns the
+// function that stops it and reports the profiles written, and the
+// timeline a chrome trace collects. Disk, when set, has the operations it
+// timed written with the profiles.
+func startProfile(config utils.Config, disk *profiler.IORecorder) (stop func(), timeline *profiler.Timeline) {
+	opts := profileOptions(config)
+	opts.IO = disk
+	session, err := profiler.Start(opts)
+	if err != nil {
+		fail(err)
+	}
+	return func() {
+		paths, err := session.Stop()
+		if err != nil {
+			cli.Warnf("%v", err)
+		}
+		for _, p := range paths {
+			fmt.Println("profile written to", p)
+		}
+		if leaks := session.Leaks(); leaks != nil {
+			for _, w := range leaks.Warnings() {
+				cli.Warnf("%s", w)
+			}
+		}
+		if leaks := session.GoroutineLeaks(); leaks != nil {
+			for _, w := range leaks.Warnings() {
+				cli.Warnf("%s", w)
+			}
+		}
+	}, session.Timeline()
+}
+
+// startTracing exports the run's spans to the config's collector, if any,
+// and to the profile's timeline, and returns the function that flushes them
+func startTracing(config utils.Config, service string, timeline *profiler.Timeline) func() {
+	var also []tracing.Exporter
+	if timeline != nil {
+		also = append(also, timeline)
+	}
+	shutdown := tracing.Setup(config.TracingEndpoint, service, also...)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			cli.Warnf("tracing: %v", err)
+		}
+	}
+}
+
+func profileOptions(config utils.Config) profiler.Options {
+	return profiler.Options{
+		CPU:               config.ProfileCPU,
+		Memory:            config.ProfileMemory,
+		Dir:               config.ProfileDir,
+		SampleInterval:    time.Duration(config.ProfilerSamplingRate) * time.Millisecond,
+		SampleFormat:      config.ProfilerOutputFormat,
+		SampleBudget:      config.ProfilerCPUBudget,
+		HeapInterval:      time.Duration(config.ProfileHeapInterval) * time.Second,
+		GoroutineInterval: time.Duration(config.ProfileGoroutineInterval) * time.Second,
+		AllocInterval:     time.Duration(config.ProfileAllocInterval) * time.Second,
+		Contention:        config.ProfileContention,
+	}
+}
+
+// analysis is the replays analysis being run, told to the config's
+// webhooks as it ends; nil for the other modes
+var analysis *notify.Job
+
+// fail is cli.Fail, telling the config's webhooks the analysis failed
+func fail(err error) {
+	if analysis != nil {
+		if ferr := analysis.Fail("analysis failed", err); ferr != nil {
+			cli.Warn(ferr)
+		}
+	}
+	cli.Fail(err)
+}
+
+func printReplays(replays []*replay.Replay) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tLEVEL\tPLAYERS\tPIECES\tINPUTS\tEVENTS\tSPELLS\tSECONDS\tOUTCOME")
+	for _, r := range replays {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%.1f\t%s\n",
+			r.SessionID, r.Level, len(r.Players), len(r.Pieces), len(r.Inputs),
+			len(r.Events), len(r.Spells), float64(r.Result.DurationMs)/1000, r.Result.Outcome)
+	}
+	w.Flush()
+	fmt.Printf("\n%d replays\n", len(replays))
+}
+
+// comparePacks prints per-metric deltas from pack a to pack b
+func comparePacks(a, b string, size int) (analyzer.PackComparison, error) {
+	packA, err := loadPack(a, size)
+	if err != nil {
+		return analyzer.PackComparison{}, err
+	}
+	packB, err := loadPack(b, size)
+	if err != nil {
+		return analyzer.PackComparison{}, err
+	}
+	cmp := analyzer.ComparePacks(packA, packB)
+
+	fmt.Printf("A: %s (%d levels)\nB: %s (%d levels)\n\n", a, cmp.LevelsA, b, cmp.LevelsB)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METRIC\tA\tB\tDELTA\tCHANGE\tP\t")
+	for _, m := range cmp.Metrics {
+		fmt.Fprintf(w, "%s\t%.3f\t%.3f\t%+.3f\t%+.1f%%\t%.4f\t%s\n",
+			m.Metric, m.MeanA, m.MeanB, m.Delta, m.RelativeDiff*100, m.PValue, m.Significance)
+	}
+	w.Flush()
+	fmt.Println("\n* p<0.05  ** p<0.01  *** p<0.001 (Welch's t-test)")
+	return cmp, nil
+}
+
+// loadPack reads a level directory, or generates size levels from a
+// generator config file
+func loadPack(path string, size int) ([]*level.Level, error) {
+	if filepath.Ext(path) != ".json" {
+		data := analyzer.NewDataset()
+		if err := data.LoadLevels(path); err != nil {
+			return nil, err
+		}
+		return data.LevelList(), nil
+	}
+	config, err := utils.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	gen, err := generator.NewGenerator(config)
+	if err != nil {
+		return nil, err
+	}
+	levels := make([]*level.Level, 0, size)
+	for i := 1; i <= size; i++ {
+		lvl, err := gen.Generate(fmt.Sprintf("level_%d", i))
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, lvl)
+	}
+	return levels, nil
+}
+
+// printDifficulty prints the difficulty breakdown of every level, easiest first
+func printDifficulty(data *analyzer.Dataset) *analyzer.Table {
+	reports := data.AnalyzeLevels()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tTERRAIN\tHOLES\tPICKUPS\tCLEAR RATE\tTOPPED OUT\tSCORE")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%.2f\t%d\t%.2f\t%.2f\t%t\t%.3f\n", r.Level, r.TerrainComplexity,
+			r.Holes, r.PickupAccessibility, r.ClearRate, r.Simulation.ToppedOut, r.Score)
+	}
+	w.Flush()
+	return analyzer.DifficultyTable(reports)
+}
+
+// printSolvability prints whether each level can be completed, with the
+// witness placements of solvable ones
+func printSolvability(data *analyzer.Dataset, config utils.Config) *analyzer.Table {
+	opts := analyzer.DefaultSolveOptions()
+	if config.SolveMaxPieces > 0 {
+		opts.MaxPieces = config.SolveMaxPieces
+	}
+	if config.SolveMaxNodes > 0 {
+		opts.MaxNodes = config.SolveMaxNodes
+	}
+	results := data.SolveLevels(opts)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tSTATUS\tNODES\tDETAIL")
+	for _, r := range results {
+		detail := r.Reason
+		if len(r.Witness) > 0 {
+			steps := make([]string, len(r.Witness))
+			for i, p := range r.Witness {
+				steps[i] = fmt.Sprintf("%s@%d,%d/%d", p.Piece, p.X, p.Y, p.Rotation)
+			}
+			detail = strings.Join(steps, " ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", r.Level, r.Status, r.Nodes, detail)
+	}
+	w.Flush()
+	return analyzer.SolvabilityTable(results)
+}
+
+// printPatterns lists block patterns that recur across the loaded levels
+func printPatterns(data *analyzer.Dataset, config utils.Config) *analyzer.Table {
+	levels := data.LevelList()
+	opts := analyzer.DefaultPatternOptions()
+	opts.Size = config.PatternSize
+	opts.MinOccurrences = config.PatternMinOccurrences
+	patterns := analyzer.MineBlockPatterns(levels, opts)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATTERN\tOCCURRENCES\tLEVELS\tEXAMPLES")
+	for _, p := range patterns {
+		examples := make([]string, len(p.Examples))
+		for i, e := range p.Examples {
+			examples[i] = fmt.Sprintf("%s@%d,%d", e.Level, e.X, e.Y)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", p.Pattern, p.Occurrences, p.Levels, strings.Join(examples, " "))
+	}
+	w.Flush()
+	fmt.Printf("\n%d overused %dx%d patterns\n\n", len(patterns), opts.Size, opts.Size)
+	return analyzer.PatternTable(patterns)
+}
+
+// printFairness checks the recorded piece sequences against the configured randomizer
+func printFairness(data *analyzer.Dataset, config utils.Config) ([]*analyzer.Table, error) {
+	sequences := analyzer.PieceSequences(data.Replays)
+	if len(sequences) == 0 {
+		return nil, nil
+	}
+	report, err := analyzer.AnalyzeFairness(sequences, config.PieceRandomizer)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("\nrandomizer %s: %d pieces, distribution p=%.3f, longest drought %d (p=%.3f), longest streak %d (p=%.3f)\n",
+		report.Randomizer, report.Pieces, report.DistributionP, report.LongestDrought, report.DroughtP,
+		report.LongestStreak, report.StreakP)
+	for _, f := range report.Flags {
+		fmt.Println("  flagged:", f)
+	}
+	return []*analyzer.Table{analyzer.FairnessTable(report)}, nil
+}
+
+// printSuspicions lists players whose replays need a manual cheat review
+func printSuspicions(data *analyzer.Dataset, config utils.Config) *analyzer.Table {
+	opts := analyzer.DefaultCheatOptions()
+	opts.MaxInputsPerSecond = config.CheatMaxInputsPerSecond
+	opts.MinReactionMs = config.CheatMinReactionMs
+	opts.Board = level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight}
+	suspicions := data.ScreenReplays(opts)
+	if len(suspicions) > 0 {
+		fmt.Println("\nsuspicious play:")
+	}
+	for _, s := range suspicions {
+		fmt.Printf("  %s %s: score %.2f, %d findings\n", s.Session, s.Player, s.Score, s.Findings)
+		for _, e := range s.Evidence {
+			fmt.Printf("    frame %d (%.1fs) %s: %s\n", e.Frame, float64(e.TimeMs)/1000, e.Kind, e.Detail)
+		}
+	}
+	return analyzer.SuspicionTable(suspicions)
+}
+
+// writeRatings rates every match in the replays and match log, prints the
+// leaderboard and saves the ledger
+func writeRatings(data *analyzer.Dataset, config utils.Config, matchLog, outDir string) ([]*analyzer.Table, error) {
+	var matches []rating.Match
+	for _, r := range data.Replays {
+		if m, ok := rating.FromReplay(r); ok {
+			matches = append(matches, m)
+		}
+	}
+	if matchLog != "" {
+		logged, err := rating.LoadMatchLog(matchLog)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, logged...)
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	ledger, err := rating.NewLedger(config.RatingSystem, config.EloK)
+	if err != nil {
+		return nil, err
+	}
+	if err := ledger.ApplyAll(matches); err != nil {
+		return nil, err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nPLAYER\tRATING\tDEVIATION\tGAMES")
+	for _, s := range ledger.Leaderboard() {
+		fmt.Fprintf(w, "%s\t%.0f\t%.0f\t%d\n", s.Player, s.Rating.Value, s.Rating.Deviation, s.Rating.Games)
+	}
+	w.Flush()
+
+	mm, err := rating.AnalyzeMatchmaking(config.RatingSystem, config.EloK, matches)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeMatchmaking(mm, filepath.Join(outDir, "matchmaking.json")); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(config.RatingsFile), 0755); err != nil {
+		return nil, err
+	}
+	return []*analyzer.Table{analyzer.RatingTable(ledger), analyzer.MatchmakingTable(mm)}, ledger.Save(config.RatingsFile)
+}
+
+// writeMatchmaking prints the matchmaking fairness summary and saves the
+// full report as JSON for the matchmaking simulator
+func writeMatchmaking(r rating.MatchmakingReport, path string) error {
+	fmt.Printf("\nmatchmaking: %d matches, rating gap p50 %.0f p90 %.0f max %.0f, upsets %.1f%%, blowouts %.1f%%, queue/gap correlation %+.2f\n",
+		r.Matches, r.GapP50, r.GapP90, r.GapMax, 100*r.UpsetRate, 100*r.BlowoutRate, r.QueueGap)
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	fmt.Println("matchmaking report written to", path)
+	return nil
+}
+
+// writeHeatmaps exports every heatmap kind for every level played
+func writeHeatmaps(data *analyzer.Dataset, config utils.Config, dir string) (*analyzer.Table, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	opts := analyzer.RenderOptions{ColorMap: config.HeatmapColorMap, CellSize: config.HeatmapCellSize}
+	fallback := level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight}
+	var all []*analyzer.Heatmap
+	for _, kind := range analyzer.HeatmapKinds {
+		for name, h := range data.Heatmaps(kind, fallback) {
+			path := filepath.Join(dir, fmt.Sprintf("%s_%s.%s", name, kind, config.HeatmapFormat))
+			if err := analyzer.ExportHeatmap(h, path, opts); err != nil {
+				return nil, err
+			}
+			all = append(all, h)
+		}
+	}
+	fmt.Printf("%d heatmaps written to %s\n", len(all), dir)
+	for _, c := range data.PickupCollections() {
+		if c.Unreachable {
+			cli.Warnf("%s: %s pickup at (%d,%d) collected in %d of %d sessions",
+				c.Level, c.Spell, c.X, c.Y, c.Collected, c.Sessions)
+		}
+	}
+	return analyzer.HeatmapTable(all), nil
+}
+
+// writeHeatmapDiffs exports, for every heatmap kind and level both cohorts
+// played, cohort A's heatmap minus cohort B's
+func writeHeatmapDiffs(data *analyzer.Dataset, config utils.Config, spec, dir string) (*analyzer.Table, error) {
+	specA, specB, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("-diff %q: want two cohorts as A:B", spec)
+	}
+	a, err := data.Cohort(specA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := data.Cohort(specB)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	opts := analyzer.RenderOptions{ColorMap: config.HeatmapDiffColorMap, CellSize: config.HeatmapCellSize}
+	fallback := level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight}
+	label := strings.NewReplacer("=", "-", "/", "-").Replace(specA + "_vs_" + specB)
+	var all []*analyzer.Heatmap
+	for _, kind := range analyzer.HeatmapKinds {
+		mapsB := b.Heatmaps(kind, fallback)
+		for name, ha := range a.Heatmaps(kind, fallback) {
+			hb, ok := mapsB[name]
+			if !ok {
+				continue
+			}
+			h, err := analyzer.DiffHeatmaps(ha, hb)
+			if err != nil {
+				return nil, err
+			}
+			path := filepath.Join(dir, fmt.Sprintf("%s_%s_%s.%s", name, kind, label, config.HeatmapFormat))
+			if err := analyzer.ExportHeatmap(h, path, opts); err != nil {
+				return nil, err
+			}
+			all = append(all, h)
+		}
+	}
+	fmt.Printf("%d difference heatmaps (%s, %d vs %d sessions) written to %s\n",
+		len(all), spec, len(a.Replays), len(b.Replays), dir)
+	t := analyzer.HeatmapTable(all)
+	t.Name = "heatmap_diffs"
+	return t, nil
+}
@@ -0,0 +1,188 @@
+package analyze
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/admin"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/api"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/discovery"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/leaderboard"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/ratelimit"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/store"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// serve exposes the dataset's analysis over HTTP on addr until interrupted,
+// with Prometheus metrics on /metrics and, when profiling, the runtime's
+// heap and goroutine metrics there too, its profiles on /debug/pprof and a
+// live dashboard of them on /debug/dashboard/. With an agent token, profile
+// attach can sample the server's stacks remotely. The config's performance
+// budgets are checked every second, alerts logged to stderr as JSON lines.
+// Each request is traced when a collector is configured, and the config's
+// continuous profiling runs while serving. Submitted replays are saved to
+// replayDir so later CLI runs include them; failed is how many replay files
+// didn't load, counted towards the replay error rate. The config's
+// leaderboard is served under /api/leaderboards for integration tests.
+// With the config's tokens file, requests need a token for serveSurface.
+// Its admin API, under /admin/, lists the analysis jobs running. The API
+// is versioned under /v1/, where /v1/openapi.json describes it. It is
+// served over TLS when the config says so, and the API, and the agent, are
+// advertised to LAN discovery.
+func serve(addr string, data *analyzer.Dataset, config utils.Config, replayDir string, failed int, profile bool) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := api.Options{
+		Fallback:  level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight},
+		Render:    analyzer.RenderOptions{ColorMap: config.HeatmapColorMap, CellSize: config.HeatmapCellSize},
+		ReplayDir: replayDir,
+	}
+	if config.ResultsDB != "" {
+		if err := os.MkdirAll(filepath.Dir(config.ResultsDB), 0755); err != nil {
+			return err
+		}
+		db, err := store.Open(config.ResultsDB)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		opts.Store = db
+	}
+	if config.LeaderboardStorage != "" {
+		storage, err := leaderboard.Open(config.LeaderboardStorage)
+		if err != nil {
+			return err
+		}
+		lb, err := leaderboard.New(storage, config.LeaderboardSeason)
+		if err != nil {
+			storage.Close()
+			return err
+		}
+		defer lb.Close()
+		opts.Leaderboard = lb
+	}
+
+	var live *profiler.LiveMetrics
+	budgets := profiler.Budgets{TickMs: config.BudgetTickMs, HeapMiB: config.BudgetHeapMiB, BandwidthKiBps: config.BudgetBandwidthKiBps}
+	if profile || budgets.Any() {
+		live = profiler.NewLiveMetrics()
+		opts.Collectors = append(opts.Collectors, live)
+	}
+	if budgets.Any() {
+		watch := profiler.StartBudgetWatch(live, budgets, time.Second, profiler.AlertLog(os.Stderr))
+		defer watch.Stop()
+	}
+	if config.ProfileContinuous {
+		copts := profiler.DefaultContinuousOptions(filepath.Join(config.ProfileDir, "continuous"))
+		copts.Retention = time.Duration(config.ProfileRetentionDays) * 24 * time.Hour
+		continuous, err := profiler.StartContinuous(copts)
+		if err != nil {
+			return err
+		}
+		defer continuous.Stop()
+	}
+	server := api.NewServer(data, opts)
+	server.Metrics().ObserveReplays(len(data.Replays), failed, time.Now())
+	var handler http.Handler = server
+	token := config.ProfileAgentToken
+	if token == "" {
+		token = os.Getenv(profiler.AgentTokenEnv)
+	}
+	if profile || token != "" {
+		mux := http.NewServeMux()
+		if profile {
+			mux.Handle("/debug/pprof/", profiler.Handler(profileOptions(config)))
+			dash := profiler.NewDashboard(live.Snapshot, time.Second)
+			defer dash.Close()
+			mux.Handle("/debug/dashboard/", dash)
+		}
+		if token != "" {
+			agent, err := profiler.NewAgent(token, config.ProfilerCPUBudget)
+			if err != nil {
+				return err
+			}
+			mux.Handle(profiler.AgentPath, agent)
+		}
+		mux.Handle("/", server)
+		handler = mux
+	}
+	keys, err := auth.Load(config.AuthTokensFile)
+	if err != nil {
+		return err
+	}
+	adminAPI := admin.New(auth.SurfaceAnalysis, keys)
+	server.RegisterAdmin(adminAPI)
+	handler = admin.Mount(adminAPI, handler)
+	handler = keys.Middleware(serveSurface, handler)
+	spec := openapi.New("SuperTetris analysis", "replays, analysis tables, metrics, heatmaps and leaderboards")
+	server.DescribeAPI(spec)
+	handler = openapi.Mount(spec, handler)
+	handler = ratelimit.FromConfig(config, keys).Middleware(handler)
+	tlsConfig, err := certs.Server(config)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: addr, Handler: crash.Handler(tracing.Middleware(handler)), ReadHeaderTimeout: 10 * time.Second}
+	done := make(chan error, 1)
+	go func() {
+		done <- certs.ListenAndServe(srv, tlsConfig)
+	}()
+	fmt.Printf("serving analysis of %d replays and %d levels on %s://%s\n", len(data.Replays), len(data.Levels), certs.Scheme(tlsConfig), addr)
+	if adv, err := discovery.FromConfig(config); err != nil {
+		cli.Warn("not advertised on the network:", err)
+	} else {
+		defer adv.Close()
+		scheme := certs.Scheme(tlsConfig)
+		adv.AddListen(addr, discovery.Service{Kind: discovery.KindAnalysis, Name: "analysis", Scheme: scheme})
+		if token != "" {
+			adv.AddListen(addr, discovery.Service{Kind: discovery.KindAgent, Name: "analysis", Scheme: strings.Replace(scheme, "http", "ws", 1), Path: profiler.AgentPath})
+		}
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdown); err != nil {
+		return err
+	}
+	if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveSurface is the token scope a request to the server needs; the
+// profiling agent checks its own token
+func serveSurface(r *http.Request) string {
+	switch p := r.URL.Path; {
+	case p == profiler.AgentPath:
+		return ""
+	case admin.IsAdmin(r):
+		return auth.SurfaceAdmin
+	case strings.HasPrefix(p, "/api/leaderboards"):
+		return auth.SurfaceLeaderboards
+	case p == "/metrics" || strings.HasPrefix(p, "/debug/"):
+		return auth.SurfaceProfiler
+	}
+	return auth.SurfaceAnalysis
+}
@@ -0,0 +1,126 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// tail follows a live session log and prints rolling metrics every
+// interval until interrupted or the stream ends; with a record directory
+// its sessions are saved there as replays, signed by the keys' signer
+func tail(source, format string, window, interval time.Duration, record string, keys *replay.Keys) error {
+	if format != "proto" && format != "json" {
+		return fmt.Errorf("unknown -tail-format %q, want proto or json", format)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	stream, err := analyzer.OpenStream(ctx, source)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	var recorder *replay.Recorder
+	if record != "" {
+		if recorder, err = newRecorder(record, keys); err != nil {
+			return err
+		}
+	}
+	metrics := analyzer.NewRollingMetrics(window)
+	done := make(chan error, 1)
+	go func() {
+		done <- feed(stream, format, metrics, record, recorder)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			printSnapshot(metrics.Snapshot(time.Now()))
+		case err := <-done:
+			printSnapshot(metrics.Snapshot(time.Now()))
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// feed reads the log's records into the metrics, and the recorder if
+// there is one, until the stream ends. A line or message that doesn't
+// decode is warned of and skipped, so one bad record doesn't end a tail.
+func feed(stream io.Reader, format string, metrics *analyzer.RollingMetrics, record string, recorder *replay.Recorder) error {
+	decode, unit := gamepb.SkipRecords, "message"
+	if format == "json" {
+		// the legacy log, JSON lines of replay records
+		decode, unit = replay.SkipRecords, "line"
+	}
+	return decode(stream, func(rec replay.Record) error {
+		now := time.Now()
+		metrics.Add(rec, now)
+		if recorder == nil {
+			return nil
+		}
+		rp, err := recorder.Add(rec, now)
+		if err != nil {
+			cli.Warnf("session %s not recorded: %v", rec.Session, err)
+			return nil
+		}
+		if rp != nil {
+			return rp.Save(filepath.Join(record, replayFile(rp.SessionID)))
+		}
+		return nil
+	}, func(n int, err error) {
+		cli.Warnf("%s %d of the log skipped: %v", unit, n, err)
+	})
+}
+
+// newRecorder records into dir, signing when the keys have a signer
+func newRecorder(dir string, keys *replay.Keys) (*replay.Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return replay.NewRecorder(nil)
+	}
+	key, ok := keys.Signer()
+	if !ok {
+		return nil, fmt.Errorf("no replay key in the config's replayKeysFile can sign; add one with serve replaykey -new")
+	}
+	return replay.NewRecorder(&key)
+}
+
+// replayFile names a session's replay file, keeping only the characters
+// of its ID safe in a file name
+func replayFile(sessionID string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, sessionID) + ".json"
+}
+
+func printSnapshot(s analyzer.Snapshot) {
+	spells := make([]string, 0, len(s.Spells))
+	for _, spell := range s.TopSpells() {
+		spells = append(spells, fmt.Sprintf("%s=%d", spell, s.Spells[spell]))
+	}
+	fmt.Printf("%s last %s: %d sessions (+%d -%d), %.1f inputs/s, %.1f pieces/min, %.1f lines/min, %d top-outs, spells %s\n",
+		s.Time.Format("15:04:05"), s.Window, s.Sessions, s.Started, s.Ended, s.InputsPerSec,
+		s.PiecesPerMin, s.LinesPerMin, s.TopOuts, strings.Join(spells, " "))
+}
@@ -0,0 +1,76 @@
+package analyze
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func session(id string) []replay.Record {
+	rp := &replay.Replay{SessionID: id, Level: "pit", Players: []replay.Player{{ID: "p1"}},
+		Inputs: []replay.Input{{Frame: 1, Player: "p1", Action: replay.ActionHardDrop}},
+		Events: []replay.Event{{Frame: 1, Player: "p1", Type: replay.EventLock, Piece: "T"}},
+		Result: replay.Result{DurationMs: 100, Scores: map[string]int{"p1": 10}}}
+	return rp.Records()
+}
+
+func TestFeedSkipsBadRecordsAndReadsOn(t *testing.T) {
+	for _, format := range []string{"proto", "json"} {
+		t.Run(format, func(t *testing.T) {
+			var log bytes.Buffer
+			encode := gamepb.EncodeRecords
+			if format == "json" {
+				encode = replay.EncodeRecords
+			}
+			if err := encode(&log, session("s1")); err != nil {
+				t.Fatal(err)
+			}
+			// a record mangled on its way, in either format
+			if format == "json" {
+				log.WriteString("{\"session\":\"s1\",\"kind\"\n")
+			} else {
+				log.Write([]byte{2, 0xff, 0xff})
+			}
+			if err := encode(&log, session("s2")); err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			recorder, err := newRecorder(dir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metrics := analyzer.NewRollingMetrics(time.Minute)
+			if err := feed(&log, format, metrics, dir, recorder); err != nil {
+				t.Fatalf("feed: %v", err)
+			}
+			if s := metrics.Snapshot(time.Now()); s.Sessions != 2 || s.Started != 2 || s.Ended != 2 {
+				t.Errorf("snapshot = %+v", s)
+			}
+			for _, id := range []string{"s1", "s2"} {
+				rp, err := replay.Load(filepath.Join(dir, replayFile(id)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if rp.SessionID != id || len(rp.Inputs) != 1 || len(rp.Events) != 1 {
+					t.Errorf("recorded %+v", rp)
+				}
+			}
+		})
+	}
+}
+
+func TestTailRefusesUnknownFormats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.log")
+	os.WriteFile(path, nil, 0644)
+	if err := tail(path, "xml", time.Minute, time.Second, "", nil); err == nil || !strings.Contains(err.Error(), "-tail-format") {
+		t.Errorf("tail -tail-format xml: %v", err)
+	}
+}
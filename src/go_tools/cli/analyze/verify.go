@@ -0,0 +1,42 @@
+package analyze
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// verifyReplays plays each replay again on its level with the options, and
+// checks it against its state checksums, answering how many diverged
+func verifyReplays(data *analyzer.Dataset, opts sim.Options) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tLEVEL\tCHECKED\tSTATUS")
+	diverged, unchecked := 0, 0
+	for _, r := range data.Replays {
+		status := "ok"
+		v := sim.Verification{}
+		lvl, ok := data.Levels[r.Level]
+		switch {
+		case !ok:
+			status, unchecked = "no level", unchecked+1
+		case len(r.Checksums) == 0:
+			status, unchecked = "no checksums", unchecked+1
+		default:
+			var err error
+			if v, err = sim.Verify(lvl, r, opts); err != nil {
+				status = "error: " + err.Error()
+				diverged++
+			} else if v.Diverged {
+				status = fmt.Sprintf("diverged at frame %d: %08x, replayed %08x", v.Frame, v.Want, v.Got)
+				diverged++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", r.SessionID, r.Level, v.Checked, status)
+	}
+	w.Flush()
+	fmt.Printf("\n%d replays verified, %d diverged, %d unchecked\n", len(data.Replays)-diverged-unchecked, diverged, unchecked)
+	return diverged
+}
@@ -0,0 +1,138 @@
+// Package batchsim is stt batchsim, which plays bot games of a directory
+// of levels into a synthetic replay dataset for the analyzer
+package batchsim
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/bot"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// SessionLog is the live session log a batch writes next to its replays,
+// a stream of game messages
+const SessionLog = "sessions.pb"
+
+// Main runs stt batchsim with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("batchsim"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its scoringFile, spellsFile, playRulesFile and pieceRandomizer set up the games, its botSpellsFile how the bots play pickups")
+	levelDir := fs.String("levels", "", "directory of level files to play")
+	out := fs.String("out", "synthetic", "directory to write the replays and the session log to")
+	games := fs.Int("games", bot.DefaultBatchGames, "games played of each level")
+	strengths := fs.String("strengths", "1,2,3", "comma-separated beam bot strengths, a game each in turn")
+	seed := fs.Int64("seed", 1, "deals the first game; each game after it the next seed")
+	frames := fs.Int("frames", bot.DefaultFrames, "a game plays at most")
+	delay := fs.Int("delay", bot.DefaultBatchDelay, "frames a bot thinks on each new piece; below zero, none")
+	workers := fs.Int("workers", 0, "games played at once (default GOMAXPROCS)")
+	start := fs.String("start", "", "RFC 3339 time the first session starts at (default now)")
+	format := fs.String("format", "json", "replay file format: json, or bin for the binary format")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt batchsim -levels DIR [flags]
+
+Plays bot games of every level in -levels across workers, a beam bot of
+each strength in turn, and writes each game's replay to -out, so the
+analyzer can be run on a synthetic dataset before playtest data exists:
+
+	stt analyze -levels DIR -replays OUT
+
+The batch is also written as a live session log of game messages,
+OUT/%s, a game at a time as they finish; stt analyze -tail OUT/%s
+follows it while the batch plays. The same flags always play the same games.
+
+`, SessionLog, SessionLog)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *levelDir == "" || *games <= 0 || *format != "json" && *format != "bin" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	opts := bot.BatchOptions{Games: *games, Seed: *seed, Frames: *frames, Delay: *delay, Workers: *workers, Start: time.Now().UTC()}
+	for _, s := range strings.Split(*strengths, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 1 {
+			cli.Fail(fmt.Errorf("strength %q is not a positive number", s))
+		}
+		opts.Strengths = append(opts.Strengths, n)
+	}
+	if *start != "" {
+		t, err := time.Parse(time.RFC3339, *start)
+		if err != nil {
+			cli.Fail(fmt.Errorf("start: %w", err))
+		}
+		opts.Start = t
+	}
+	var err error
+	if opts.Sim, err = sim.OptionsFromConfig(config); err != nil {
+		cli.Fail(err)
+	}
+	if config.BotSpellsFile != "" {
+		if opts.Spells, err = bot.LoadSpellPolicy(config.BotSpellsFile); err != nil {
+			cli.Fail(err)
+		}
+	}
+
+	data := analyzer.NewDataset()
+	failed, err := data.LoadLevelsWith(*levelDir, analyzer.Pool{})
+	if err != nil {
+		cli.Fail(err)
+	}
+	for _, f := range failed {
+		cli.Warnf("%s: %v", f.File, f.Err)
+	}
+	levels := data.LevelList()
+	if len(levels) == 0 {
+		cli.Fail(fmt.Errorf("no levels in %s", *levelDir))
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		cli.Fail(err)
+	}
+	logFile, err := os.Create(filepath.Join(*out, SessionLog))
+	if err != nil {
+		cli.Fail(err)
+	}
+	log := bufio.NewWriter(logFile)
+	ext := ".json"
+	if *format == "bin" {
+		ext = replay.FormatExt
+	}
+	played, pieces := 0, 0
+	began := time.Now()
+	err = bot.PlayBatch(levels, opts, func(game bot.BatchGame) error {
+		r := game.Replay
+		if err := r.Save(filepath.Join(*out, strings.ReplaceAll(r.SessionID, "/", "_")+ext)); err != nil {
+			return err
+		}
+		if err := gamepb.EncodeRecords(log, r.Records()); err != nil {
+			return err
+		}
+		if err := log.Flush(); err != nil {
+			return err
+		}
+		played++
+		pieces += len(r.EventsOf(replay.EventLock))
+		return nil
+	})
+	if cerr := logFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cli.Fail(err)
+	}
+	fmt.Printf("%d games of %d levels, %d pieces, played in %s; replays and %s written to %s\n",
+		played, len(levels), pieces, time.Since(began).Round(time.Millisecond), SessionLog, *out)
+}
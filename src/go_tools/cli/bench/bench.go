@@ -0,0 +1,161 @@
+// Package bench is stt bench, which runs the tools' standard performance
+// workload and fails when it has grown slower than its baseline
+package bench
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/bench"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+)
+
+// Main runs stt bench with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("bench"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	baseline := fs.String("baseline", "", "baseline to compare against, or with -save to record (default the config's benchBaseline)")
+	save := fs.Bool("save", false, "record this run as the baseline rather than comparing against it")
+	runs := fs.Int("runs", 5, "times each workload runs; its fastest run is compared")
+	only := fs.String("only", "", "comma-separated workloads to run (default all: "+strings.Join(bench.Names, ", ")+")")
+	timeThreshold := fs.Float64("time-threshold", -1, "rise in time over the baseline to fail on, as a fraction (default the config's benchTimeThreshold)")
+	allocThreshold := fs.Float64("alloc-threshold", -1, "rise in allocations or bytes allocated to fail on (default the config's benchAllocThreshold)")
+	out := fs.String("out", "", "also write this run's results to this file, as a baseline is written")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), `usage: stt bench [flags]
+
+Runs the tools' standard performance workload, the same on every machine
+and build, and compares each part's fastest time, allocations and bytes
+allocated with a baseline's, failing when one rose past its threshold:
+
+  generate  a batch of levels from a fixed seed, written nowhere
+  simulate  bot games on those levels, the reference simulation
+  analyze   the analysis of those games' replays and the analyzer's passes
+
+Record a baseline with -save on the machine the comparisons run on, and
+again whenever a change is meant to cost more; a baseline of another
+machine, or of another version of the workload, doesn't compare.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *runs < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	if *baseline == "" {
+		*baseline = config.BenchBaseline
+	}
+	th := bench.Thresholds{Time: config.BenchTimeThreshold, Allocs: config.BenchAllocThreshold}
+	if *timeThreshold >= 0 {
+		th.Time = *timeThreshold
+	}
+	if *allocThreshold >= 0 {
+		th.Allocs = *allocThreshold
+	}
+	names := bench.Names
+	if *only != "" {
+		names = strings.Split(*only, ",")
+		for _, name := range names {
+			if !slices.Contains(bench.Names, name) {
+				cli.Fail(fmt.Errorf("unknown workload %q, want one of %s", name, strings.Join(bench.Names, ", ")))
+			}
+		}
+	}
+
+	var base bench.Report
+	if !*save {
+		var err error
+		if base, err = bench.LoadReport(*baseline); err != nil {
+			if os.IsNotExist(err) {
+				cli.Fail(fmt.Errorf("no baseline at %s; record one with stt bench -save", *baseline))
+			}
+			cli.Fail(err)
+		}
+	}
+	fixture, err := bench.NewFixture(bench.StandardSizes)
+	if err != nil {
+		cli.Fail(err)
+	}
+	var results []bench.Result
+	for _, name := range names {
+		res, err := fixture.Measure(name, *runs)
+		if err != nil {
+			cli.Fail(err)
+		}
+		fmt.Printf("%-8s  %s, %d allocs, %s a run\n", name, duration(res.NsPerOp), res.AllocsPerOp, bytes(float64(res.BytesPerOp)))
+		results = append(results, res)
+	}
+	report := bench.NewReport(results, time.Now())
+	if *out != "" {
+		if err := report.Save(*out); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *save {
+		if err := report.Save(*baseline); err != nil {
+			cli.Fail(err)
+		}
+		fmt.Printf("baseline of %s recorded to %s\n", report.Machine(), *baseline)
+		return
+	}
+
+	deltas, err := bench.Compare(base, report, th)
+	if err != nil {
+		cli.Fail(fmt.Errorf("%s: %w", *baseline, err))
+	}
+	if base.Machine() != report.Machine() {
+		cli.Warnf("baseline was recorded on %s, not this %s; its timings may not compare", base.Machine(), report.Machine())
+	}
+	fmt.Printf("\nagainst %s, recorded %s:\n", *baseline, base.Recorded.Format(time.DateTime))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKLOAD\tMETRIC\tBASELINE\tNOW\tCHANGE\t")
+	for _, d := range deltas {
+		mark := ""
+		if d.Regression {
+			mark = "REGRESSION"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%+.1f%%\t%s\n", d.Workload, d.Metric, format(d.Metric, d.Baseline), format(d.Metric, d.Current), 100*d.Change(), mark)
+	}
+	w.Flush()
+	if reg := bench.Regressions(deltas); len(reg) > 0 {
+		cli.Fail(fmt.Errorf("%d regressions past the thresholds of %.0f%% time and %.0f%% allocation", len(reg), 100*th.Time, 100*th.Allocs))
+	}
+	fmt.Println("no regressions")
+}
+
+// format is a metric's value as it reads
+func format(metric string, v float64) string {
+	switch metric {
+	case bench.MetricTime:
+		return duration(int64(v))
+	case bench.MetricBytes:
+		return bytes(v)
+	}
+	return fmt.Sprintf("%.0f", v)
+}
+
+func duration(ns int64) string {
+	return time.Duration(ns).Round(10 * time.Microsecond).String()
+}
+
+// bytes is n bytes in the largest unit it reads as at least 1 in
+func bytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	v, i := n/unit, 0
+	for v >= unit && i < 3 {
+		v /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, "KMGT"[i])
+}
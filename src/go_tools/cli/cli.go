@@ -0,0 +1,102 @@
+// Package cli is what the subcommands of stt share: the config they load,
+// how they log, and how they report usage, warnings and errors. Each
+// subcommand is a package under cli with a Main taking its arguments.
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/logging"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Program is the binary the subcommands run under
+const Program = "stt"
+
+// ConfigEnv names the config file subcommands load when not given
+// -config; stt -config sets it for the subcommand it runs
+const ConfigEnv = "STT_CONFIG"
+
+// Command is a subcommand of stt
+type Command struct {
+	Name    string
+	Summary string // a line for stt's usage
+	Main    func(args []string)
+}
+
+// Name is how usage messages call a subcommand, such as stt serve sync
+func Name(sub ...string) string {
+	return strings.Join(append([]string{Program}, sub...), " ")
+}
+
+// ConfigPath is path, or $STT_CONFIG when path is empty
+func ConfigPath(path string) string {
+	if path == "" {
+		return os.Getenv(ConfigEnv)
+	}
+	return path
+}
+
+// LoadConfig loads the config file at path, or at $STT_CONFIG when path
+// is empty; with neither it is the defaults
+func LoadConfig(path string) (utils.Config, error) {
+	if path = ConfigPath(path); path == "" {
+		return utils.DefaultConfig(), nil
+	}
+	return utils.LoadConfig(path)
+}
+
+// Config loads the config as LoadConfig does, failing the command if it
+// can't, and logs and speaks from then on as it says
+func Config(path string) utils.Config {
+	config, err := LoadConfig(path)
+	if err != nil {
+		Fail(err)
+	}
+	if err := StartLogging(config); err != nil {
+		Fail(err)
+	}
+	if err := i18n.SetLocale(config.Locale); err != nil {
+		Fail(err)
+	}
+	return config
+}
+
+// StartLogging logs at the config's logLevel and module levels, in its
+// logFormat, to stderr and its logFile in the working directory, and has
+// crash bundles written to its crashDir there and sent to its
+// crashReportUrl
+func StartLogging(config utils.Config) error {
+	file := config.LogFile
+	if file != "" && !filepath.IsAbs(file) {
+		file = filepath.Join(config.WorkingDirectory, file)
+	}
+	crashes := config.CrashDir
+	if crashes != "" && !filepath.IsAbs(crashes) {
+		crashes = filepath.Join(config.WorkingDirectory, crashes)
+	}
+	crash.Configure(crash.Options{Dir: crashes, UploadURL: config.CrashReportURL, Config: config})
+	return logging.Start(logging.Options{Level: config.LogLevel, Format: config.LogFormat, Modules: config.LogModules,
+		File: file, MaxSizeMiB: config.LogMaxSizeMiB, MaxFiles: config.LogMaxFiles})
+}
+
+// Fail reports the error that stopped the command and exits with status 1
+func Fail(err error) {
+	fmt.Fprintln(os.Stderr, i18n.T("cli.error"), err)
+	os.Exit(1)
+}
+
+// Warn logs a problem the command carried on past
+func Warn(args ...any) {
+	logging.Logger().Warn(strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
+
+// Warnf is Warn with a format
+func Warnf(format string, args ...any) {
+	Warn(fmt.Sprintf(format, args...))
+}
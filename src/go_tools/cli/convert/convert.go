@@ -0,0 +1,144 @@
+// Package convert is stt convert, which turns level files, and packs and
+// batches of them, from JSON into the binary level format and back
+package convert
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Formats to convert to
+const (
+	toBinary = "binary"
+	toJSON   = "json"
+)
+
+// Main runs stt convert with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("convert"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	to := fs.String("to", toBinary, "format to convert to: binary or json")
+	keep := fs.Bool("keep", false, "keep the original files, leaving batch manifests listing them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt convert [flags] PATH...
+
+Converts level files between JSON and the compressed binary level
+format, %s files, which is a fraction of the size and quicker to load,
+for packs too large for JSON. A directory, such as a pack version or a
+generator batch, has each level file under it converted, and its batch
+manifest rewritten to list the converted files and their checksums;
+level signatures carry over, but a signed batch needs signing again. Each file is written
+next to the original, which is removed unless -keep; levels of older
+JSON formats are migrated on the way. The tools read either format.
+
+`, level.BinaryExt)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || (*to != toBinary && *to != toJSON) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cli.Config(*configPath)
+	ext := ".json"
+	if *to == toBinary {
+		ext = level.BinaryExt
+	}
+
+	var converted, failed int
+	var before, after int64
+	for _, p := range fs.Args() {
+		files, err := level.Files(p, generator.ManifestFile)
+		if err != nil {
+			cli.Fail(err)
+		}
+		renamed := make(map[string]map[string]string)
+		for _, path := range files {
+			if filepath.Ext(path) == ext {
+				continue
+			}
+			out := strings.TrimSuffix(path, filepath.Ext(path)) + ext
+			in, n, err := convertFile(path, out)
+			if err != nil {
+				cli.Warnf("%s: %v", path, err)
+				failed++
+				continue
+			}
+			converted++
+			before, after = before+in, after+n
+			dir := filepath.Dir(path)
+			if renamed[dir] == nil {
+				renamed[dir] = make(map[string]string)
+			}
+			renamed[dir][filepath.Base(path)] = filepath.Base(out)
+			if !*keep {
+				if err := os.Remove(path); err != nil {
+					cli.Warn(err)
+				}
+			}
+		}
+		if !*keep {
+			refreshManifests(renamed)
+		}
+	}
+	fmt.Printf("%d levels converted to %s, %s to %s\n", converted, *to, size(before), size(after))
+	if failed > 0 {
+		cli.Fail(fmt.Errorf("%d levels failed to convert", failed))
+	}
+}
+
+// convertFile writes the level at path to out, in the format of out's
+// extension, returning both files' sizes
+func convertFile(path, out string) (int64, int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	lvl, err := level.Load(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := lvl.Save(out); err != nil {
+		return 0, 0, err
+	}
+	written, err := os.Stat(out)
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.Size(), written.Size(), nil
+}
+
+// refreshManifests has the batch manifests of the directories converted,
+// renamed by directory, list the converted files and their checksums
+func refreshManifests(renamed map[string]map[string]string) {
+	for dir, files := range renamed {
+		dropped, err := generator.RefreshManifest(dir, files)
+		if err != nil {
+			cli.Warn(err)
+		}
+		if dropped {
+			cli.Warnf("%s: the batch's signature no longer covers its files; sign it again with stt pack -sign", dir)
+		}
+	}
+}
+
+// size is n bytes in the largest unit it reads as at least 1 in
+func size(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, i := float64(n)/unit, 0
+	for v >= unit && i < 3 {
+		v /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, "KMGT"[i])
+}
@@ -0,0 +1,188 @@
+// Package dash is stt dash, a terminal dashboard of the jobs, analyses,
+// profiler budgets and relay rooms running on a test server
+package dash
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/discovery"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tui"
+)
+
+// Main runs stt dash with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("dash"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its jobQueueUrl is the default -jobs, its budgetTickMs and budgetHeapMiB the budgets")
+	jobsURL := fs.String("jobs", "", "job queue whose generation, analysis and simulation batches to show")
+	analysisURL := fs.String("analysis", "", "stt analyze -serve server whose analysis jobs to show")
+	relayURL := fs.String("relay", "", "relay whose rooms to show")
+	metrics := fs.String("metrics", "", "comma-separated /metrics URLs of processes to hold to the budgets, such as a batch's stt generate -metrics")
+	lan := fs.Bool("lan", true, "find the job queue, analysis server and relay left unset on the local network")
+	interval := fs.Duration("interval", 2*time.Second, "how often the sources are polled")
+	jobs := fs.Int("limit", tui.DefaultJobs, "newest jobs listed")
+	once := fs.Bool("once", false, "print the dashboard once, every panel, and exit, for scripts and terminals without keys")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt dash [flags]
+
+Shows what the test server is running, polled every -interval: the job
+queue's batches and workers, the analysis jobs in progress on stt
+analyze -serve, the tick times and heap of processes serving profiler metrics
+against the config's budgets, and the relay's rooms and peers. Left and
+right or tab switch panels, as do 1 to 4; up and down, page up and down,
+home and end pick a row, and enter opens its details: a job's payload,
+result or error, a room's peers. r polls again, q quits.
+
+Admin and job queue calls present the token of $%s, and discovery
+finds the servers the flags and config leave unset.
+
+`, auth.TokenEnv)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *interval <= 0 || *jobs <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	src := tui.Sources{Jobs: *jobsURL, Analysis: *analysisURL, Relay: *relayURL, Limit: *jobs,
+		Budgets: profiler.Budgets{TickMs: config.BudgetTickMs, HeapMiB: config.BudgetHeapMiB}}
+	if src.Jobs == "" {
+		src.Jobs = config.JobQueueURL
+	}
+	for _, u := range strings.Split(*metrics, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			src.Metrics = append(src.Metrics, u)
+		}
+	}
+	if *lan {
+		discover(ctx, config.DiscoveryAddr, &src)
+	}
+	poller, err := tui.NewPoller(src)
+	if err != nil {
+		cli.Fail(err)
+	}
+	m := &tui.Model{Sources: src}
+
+	if *once {
+		m.SetStatus(poller.Poll(ctx))
+		width, _ := size()
+		for i := range tui.Panels {
+			m.Panel = i
+			m.Render(os.Stdout, width, 0)
+			fmt.Println()
+		}
+		return
+	}
+	term, err := openTerminal()
+	if err != nil {
+		cli.Fail(fmt.Errorf("stdin is not a terminal (%v); pass -once", err))
+	}
+	defer term.Close()
+	run(ctx, poller, m, *interval)
+}
+
+// run polls and redraws until q or an interrupt
+func run(ctx context.Context, poller *tui.Poller, m *tui.Model, interval time.Duration) {
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+	polled := make(chan tui.Status, 1)
+	polling := false
+	poll := func() {
+		if polling {
+			return
+		}
+		polling = true
+		go func() {
+			pctx, cancel := context.WithTimeout(ctx, max(interval, 5*time.Second))
+			defer cancel()
+			polled <- poller.Poll(pctx)
+		}()
+	}
+	poll()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	width, height := size()
+	for {
+		os.Stdout.WriteString("\x1b[H\x1b[2J")
+		m.Render(os.Stdout, width, height)
+		select {
+		case <-ctx.Done():
+			return
+		case st := <-polled:
+			polling = false
+			m.SetStatus(st)
+			width, height = size()
+		case <-tick.C:
+			poll()
+		case data, ok := <-keys:
+			if !ok {
+				return
+			}
+			for _, k := range tui.ParseKeys(data) {
+				switch m.Key(k) {
+				case tui.ActionQuit:
+					return
+				case tui.ActionRefresh:
+					poll()
+				}
+			}
+		}
+	}
+}
+
+// discover fills the sources left unset with the servers that answer on
+// the local network
+func discover(ctx context.Context, addr string, src *tui.Sources) {
+	want := map[string]*string{discovery.KindJobs: &src.Jobs, discovery.KindAnalysis: &src.Analysis, discovery.KindRelay: &src.Relay}
+	var kinds []string
+	for kind, u := range want {
+		if *u == "" {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) == 0 {
+		return
+	}
+	found, err := discovery.Browse(ctx, discovery.BrowseOptions{Addr: addr, Kinds: kinds})
+	if err != nil {
+		cli.Warn(err)
+		return
+	}
+	for _, f := range found {
+		if u := want[f.Kind]; u != nil && *u == "" {
+			// the admin API and the queue answer on the server's root,
+			// over HTTP whatever the service's own scheme
+			base, err := url.Parse(f.URL)
+			if err != nil {
+				continue
+			}
+			base.Scheme = strings.Replace(base.Scheme, "ws", "http", 1)
+			base.Path = ""
+			*u = base.String()
+			fmt.Fprintf(os.Stderr, "found %s %q on %s at %s\n", f.Kind, f.Name, f.Host, f.URL)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package dash
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// terminal is the controlling terminal, read a key at a time without
+// echo while the dashboard runs
+type terminal struct {
+	saved string // stty settings to restore
+}
+
+// stty runs stty on the terminal, for what it prints
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// openTerminal turns off line buffering and echo, and switches to the
+// alternate screen, so the dashboard draws over nothing and leaves the
+// shell as it was
+func openTerminal() (*terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return nil, err
+	}
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	return &terminal{saved: saved}, nil
+}
+
+// Close puts the terminal back
+func (t *terminal) Close() {
+	os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+	stty(t.saved)
+}
+
+// size is the terminal's width and height, or $COLUMNS and $LINES, or
+// 80 by 24
+func size() (width, height int) {
+	width, height = 80, 24
+	if out, err := stty("size"); err == nil {
+		if f := strings.Fields(out); len(f) == 2 {
+			h, herr := strconv.Atoi(f[0])
+			w, werr := strconv.Atoi(f[1])
+			if herr == nil && werr == nil && w > 0 && h > 0 {
+				return w, h
+			}
+		}
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		width = w
+	}
+	if h, err := strconv.Atoi(os.Getenv("LINES")); err == nil && h > 0 {
+		height = h
+	}
+	return width, height
+}
@@ -0,0 +1,155 @@
+// Package desync is stt desync, which plays a replay on two simulations
+// frame-locked and reports where they part
+package desync
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/desync"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Main runs stt desync with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("desync"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its scoringFile, spellsFile, playRulesFile and pieceRandomizer set up a local simulation")
+	levelPath := fs.String("level", "", "the replay's level file")
+	replayPath := fs.String("replay", "", "replay file to play")
+	a := fs.String("a", "local", "first simulation: local, grpc://HOST:PORT or grpcs://HOST:PORT")
+	b := fs.String("b", "", "second simulation, as -a")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt desync -level FILE -replay FILE [-a SIM] -b SIM
+
+Plays a replay on two simulations frame-locked and reports the first
+frame their states part on, with the values that differ, for hunting
+determinism bugs. A simulation is this build's, local, or the Simulator
+service of another build's stt serve grpc, or of the engine, at
+grpc://HOST:PORT, grpcs:// for TLS; the token of %s, if set, is
+presented to it. A server plays the replay by its own config's rules.
+
+Exits 2 when the simulations diverge, or one ends before the other.
+
+`, auth.TokenEnv)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *levelPath == "" || *replayPath == "" || *b == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	lvl, err := level.Load(*levelPath)
+	if err != nil {
+		cli.Fail(err)
+	}
+	r, err := replay.Load(*replayPath)
+	if err != nil {
+		cli.Fail(err)
+	}
+	if r.Level != lvl.Name {
+		cli.Fail(fmt.Errorf("replay of level %q played on %q", r.Level, lvl.Name))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if token := os.Getenv(auth.TokenEnv); token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	srcA, err := source(ctx, *a, config, lvl, r)
+	if err != nil {
+		cli.Fail(fmt.Errorf("a: %w", err))
+	}
+	srcB, err := source(ctx, *b, config, lvl, r)
+	if err != nil {
+		cli.Fail(fmt.Errorf("b: %w", err))
+	}
+	rep, err := desync.Compare(srcA, srcB)
+	if err != nil {
+		cli.Fail(err)
+	}
+	switch {
+	case rep.Diverged:
+		fmt.Printf("diverged on frame %d after %d frames alike: checksum %08x in a, %08x in b\n",
+			rep.Frames+1, rep.Frames, rep.ChecksumA, rep.ChecksumB)
+		for _, d := range rep.Diffs {
+			fmt.Printf("  %s: %s != %s\n", d.Path, orMissing(d.A), orMissing(d.B))
+		}
+		if rep.More > 0 {
+			fmt.Printf("  and %d more\n", rep.More)
+		}
+		if len(rep.Diffs) == 0 {
+			fmt.Println("  the states weren't sent to compare")
+		}
+		os.Exit(2)
+	case rep.Ended != "":
+		fmt.Printf("%d frames alike, then %s ended first\n", rep.Frames, rep.Ended)
+		os.Exit(2)
+	}
+	fmt.Printf("%d frames alike\n", rep.Frames)
+}
+
+// source is the simulation addr names, playing the replay
+func source(ctx context.Context, addr string, config utils.Config, lvl *level.Level, r *replay.Replay) (desync.Source, error) {
+	if addr == "local" {
+		opts, err := sim.OptionsFromConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		return desync.Local(lvl, r, opts)
+	}
+	var creds credentials.TransportCredentials
+	switch {
+	case strings.HasPrefix(addr, "grpc://"):
+		creds = insecure.NewCredentials()
+	case strings.HasPrefix(addr, "grpcs://"):
+		cfg, err := certs.Client()
+		if err != nil {
+			return nil, err
+		}
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		creds = credentials.NewTLS(cfg)
+	default:
+		return nil, fmt.Errorf("simulation %q is neither local nor a grpc:// or grpcs:// address", addr)
+	}
+	_, host, _ := strings.Cut(addr, "://")
+	conn, err := grpc.NewClient(host, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	rawLevel, err := json.Marshal(lvl)
+	if err != nil {
+		return nil, err
+	}
+	rawReplay, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return desync.Remote(ctx, conn, rawLevel, rawReplay)
+}
+
+// orMissing is a diff's value, or that it is missing
+func orMissing(v string) string {
+	if v == "" {
+		return "(missing)"
+	}
+	return v
+}
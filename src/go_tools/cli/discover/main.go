@@ -0,0 +1,77 @@
+// Package discover is stt discover, which lists the game's and the
+// tools' servers running on the local network
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/discovery"
+)
+
+// Main runs stt discover with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("discover"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its discoveryAddr is queried")
+	addr := fs.String("addr", "", "group or address queried (default: the config's discoveryAddr)")
+	kinds := fs.String("kind", "", "comma-separated kinds to list: agent, analysis, jobs, relay, sync, packs, replays or validation (default: all)")
+	timeout := fs.Duration("timeout", discovery.DefaultTimeout, "how long to wait for answers")
+	asJSON := fs.Bool("json", false, "print the services as JSON, for the editor and scripts")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt discover [flags]
+
+Lists the game's and the tools' servers running on the local network:
+stt serve's relay, sync hub and other servers, stt analyze -serve and
+its profiling agent, each with the URL to reach it at. They answer a UDP
+multicast query, sent to the subnet's broadcast address too, so nothing
+needs to be typed in; a server listening on loopback only isn't listed.
+Exits 1 if nothing answered.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *timeout <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	if *addr == "" {
+		*addr = config.DiscoveryAddr
+	}
+	opts := discovery.BrowseOptions{Addr: *addr, Timeout: *timeout}
+	if *kinds != "" {
+		opts.Kinds = strings.Split(*kinds, ",")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	found, err := discovery.Browse(ctx, opts)
+	if err != nil {
+		cli.Fail(err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(found)
+	} else if len(found) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tNAME\tHOST\tURL")
+		for _, f := range found {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Kind, f.Name, f.Host, f.URL)
+		}
+		w.Flush()
+	} else {
+		fmt.Fprintln(os.Stderr, "nothing answered")
+	}
+	if len(found) == 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,191 @@
+// Package edit is stt edit, which edits a level file in any text editor
+// and keeps the games of a live sync session playing each save
+package edit
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/discovery"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/livesync"
+)
+
+// DefaultInterval is how often the level file is checked for saves
+const DefaultInterval = 500 * time.Millisecond
+
+// Main runs stt edit with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("edit"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its discoveryAddr is where -lan looks")
+	editor := fs.String("editor", os.Getenv("EDITOR"), "command to edit the level with, given the file as its last argument; empty watches the file until interrupted")
+	syncURL := fs.String("sync", "", "live sync hub to push each save to, such as http://localhost:8102")
+	lan := fs.Bool("lan", false, "find the live sync hub on the local network instead of -sync")
+	session := fs.String("session", "", "live sync session to push to (default the level's name)")
+	name := fs.String("name", "", "name to join the session as (default the address the hub sees)")
+	interval := fs.Duration("interval", DefaultInterval, "how often the file is checked for saves")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt edit [flags] LEVEL
+
+Opens a level file in -editor and checks the level each time it's
+saved, reporting what doesn't validate. With -sync, or -lan to find the
+hub stt serve sync runs, each save that validates is loaded into the live
+sync session, so the games joined to it play the edit at once. It ends
+when the editor exits, or without one when interrupted.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *lan && *syncURL != "" || *interval <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	path := fs.Arg(0)
+	lvl, seen, err := load(path)
+	if err != nil {
+		cli.Fail(err)
+	}
+	// the level as it last loaded, for a crash report to carry
+	opened := lvl
+	defer crash.Open(filepath.Base(path), func() ([]byte, error) { return opened.Marshal() })()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *lan {
+		f, err := discovery.Find(ctx, config.DiscoveryAddr, discovery.KindSync, "")
+		if err != nil {
+			cli.Fail(err)
+		}
+		fmt.Fprintln(os.Stderr, i18n.T("edit.found_hub", f.Name, f.Host, f.URL))
+		*syncURL = f.URL
+	}
+	var peer *livesync.Client
+	if *syncURL != "" {
+		if *session == "" {
+			*session = sessionName(lvl, path)
+		}
+		if peer, err = livesync.Dial(ctx, *syncURL, *session, livesync.RoleEditor, *name); err != nil {
+			cli.Fail(err)
+		}
+		defer peer.Close()
+		go report(ctx, peer)
+	}
+	push := func(lvl *level.Level) {
+		opened = lvl
+		if err := lvl.Validate(); err != nil {
+			cli.Warnf("%s: %v", path, err)
+			return
+		}
+		fmt.Println(i18n.T("edit.valid", time.Now().Format(time.TimeOnly), path))
+		if peer != nil {
+			if err := peer.Load(lvl); err != nil {
+				cli.Fail(err)
+			}
+		}
+	}
+	push(lvl)
+
+	done := make(chan error, 1)
+	if *editor != "" {
+		argv := append(strings.Fields(*editor), path)
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Start(); err != nil {
+			cli.Fail(err)
+		}
+		go func() { done <- cmd.Wait() }()
+	}
+	tick := time.NewTicker(*interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-done:
+			// the editor may save as it quits
+			if lvl, at, lerr := load(path); lerr == nil && at != seen {
+				push(lvl)
+			}
+			if err != nil {
+				cli.Fail(i18n.Errorf("edit.editor", err))
+			}
+			return
+		case <-tick.C:
+		}
+		info, err := os.Stat(path)
+		if err != nil || stamp(info) == seen {
+			continue
+		}
+		lvl, at, err := load(path)
+		seen = at
+		if err != nil {
+			// mid-save, or not a level yet; the next save tries again
+			cli.Warn(err)
+			continue
+		}
+		push(lvl)
+	}
+}
+
+// mark tells saves apart by when they were written and their size
+type mark struct {
+	mod  time.Time
+	size int64
+}
+
+func stamp(info os.FileInfo) mark {
+	return mark{mod: info.ModTime(), size: info.Size()}
+}
+
+// load reads the level file and the mark of the save it read
+func load(path string) (*level.Level, mark, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, mark{}, err
+	}
+	lvl, err := level.Load(path)
+	return lvl, stamp(info), err
+}
+
+// sessionName is the level's name, or the file's when it has none
+func sessionName(lvl *level.Level, path string) string {
+	if lvl.Name != "" {
+		return lvl.Name
+	}
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// report prints what the hub says of the loads and who is playing them,
+// until the connection closes
+func report(ctx context.Context, peer *livesync.Client) {
+	games := -1
+	for {
+		m, err := peer.Recv(ctx)
+		if err != nil {
+			return
+		}
+		switch m.Type {
+		case livesync.TypeAck:
+			fmt.Println(i18n.T("edit.revision_loaded", m.Rev, m.Session))
+		case livesync.TypeWelcome, livesync.TypePeers:
+			if len(m.Games) != games {
+				games = len(m.Games)
+				fmt.Println(i18n.T("edit.games_playing", peer.Session, games))
+			}
+		case livesync.TypeError:
+			cli.Warn(i18n.T("edit.session_error", peer.Session, m.Error))
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Package engine is stt engine, which converts levels, block definitions,
+// spell tables and rule sets between the tools' formats and the game
+// engine's
+package engine
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/engine"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Kinds of thing to convert
+const (
+	kindLevel  = "level"
+	kindSpells = "spells"
+	kindRules  = "rules"
+	kindBlocks = "blocks"
+)
+
+// Files rules import writes into its -out directory
+const (
+	rulesFile   = "rules.json"
+	scoringFile = "scoring.json"
+)
+
+// Main runs stt engine with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("engine"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	kind := fs.String("kind", kindLevel, "what to convert: level, spells, rules or blocks")
+	out := fs.String("out", "", "file or, for levels and rules import, directory to write; default stdout, or the current directory")
+	base := fs.String("base", "", "engine spell list whose cooldowns, mana costs, descriptions and icons spells export keeps")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), `usage: stt engine export|import [flags] [PATH...]
+
+Converts between the tools' formats and the game engine's, the ones
+game_logic.py's to_dict writes and from_dict reads:
+
+  level   export: level files, or directories of them, to engine boards
+          in -out, one of each name; import: engine boards to levels
+  spells  export: the config's spellsFile, or the game's spells, to an
+          engine spell list; import: an engine spell list to a
+          spellsFile
+  rules   export: the config's playRulesFile and scoringFile to engine
+          GameConstants; import: GameConstants to rules.json and
+          scoring.json in -out
+  blocks  export: the pieces' shapes and the special blocks' physics;
+          import: checks the engine's agree with the tools', listing
+          each difference and failing on any
+
+What one side has no place for, such as a level's spawn points or the
+engine's physics spells, is left behind on export and refused on import.
+
+`)
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := args[0]
+	fs.Parse(args[1:])
+	config := cli.Config(*configPath)
+
+	var err error
+	switch {
+	case *kind == kindLevel && dir == "export":
+		err = exportLevels(fs.Args(), *out)
+	case *kind == kindLevel:
+		err = importLevels(fs.Args(), *out)
+	case *kind == kindSpells && dir == "export":
+		err = exportSpells(config, *base, *out)
+	case *kind == kindSpells:
+		err = importSpells(oneArg(fs), *out)
+	case *kind == kindRules && dir == "export":
+		err = exportRules(config, *out)
+	case *kind == kindRules:
+		err = importRules(oneArg(fs), *out)
+	case *kind == kindBlocks && dir == "export":
+		err = writeJSON(*out, engine.ExportBlocks())
+	case *kind == kindBlocks:
+		err = checkBlocks(oneArg(fs))
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		cli.Fail(err)
+	}
+}
+
+// oneArg is the one path the import of a file takes
+func oneArg(fs *flag.FlagSet) string {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return fs.Arg(0)
+}
+
+// exportLevels writes each level under the paths to dir as an engine
+// board of its file's name
+func exportLevels(paths []string, dir string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no levels to export")
+	}
+	var exported, failed int
+	for _, p := range paths {
+		files, err := level.Files(p, generator.ManifestFile)
+		if err != nil {
+			return err
+		}
+		for _, path := range files {
+			l, err := level.Load(path)
+			var b *engine.Board
+			if err == nil {
+				b, err = engine.ExportLevel(l)
+			}
+			if err == nil {
+				err = writeFile(filepath.Join(dir, baseName(path)+".json"), b)
+			}
+			if err != nil {
+				cli.Warnf("%s: %v", path, err)
+				failed++
+				continue
+			}
+			exported++
+		}
+	}
+	fmt.Printf("%d levels exported to %s\n", exported, outDir(dir))
+	if failed > 0 {
+		return fmt.Errorf("%d levels failed to export", failed)
+	}
+	return nil
+}
+
+// importLevels saves each engine board file as a level of its name in dir
+func importLevels(paths []string, dir string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no boards to import")
+	}
+	if err := os.MkdirAll(outDir(dir), 0o755); err != nil {
+		return err
+	}
+	var imported, failed int
+	for _, path := range paths {
+		var b engine.Board
+		err := readJSON(path, &b)
+		var l *level.Level
+		if err == nil {
+			l, err = engine.ImportLevel(baseName(path), &b)
+		}
+		if err == nil {
+			err = l.Save(filepath.Join(dir, baseName(path)+".json"))
+		}
+		if err != nil {
+			cli.Warnf("%s: %v", path, err)
+			failed++
+			continue
+		}
+		imported++
+	}
+	fmt.Printf("%d boards imported to %s\n", imported, outDir(dir))
+	if failed > 0 {
+		return fmt.Errorf("%d boards failed to import", failed)
+	}
+	return nil
+}
+
+// exportSpells writes the config's spells as an engine spell list over
+// the one at base, if any
+func exportSpells(config utils.Config, base, out string) error {
+	book := sim.DefaultSpellbook()
+	if config.SpellsFile != "" {
+		var err error
+		if book, err = sim.LoadSpellbook(config.SpellsFile); err != nil {
+			return err
+		}
+	}
+	var kept []engine.Spell
+	if base != "" {
+		if err := readJSON(base, &kept); err != nil {
+			return err
+		}
+	}
+	return writeJSON(out, engine.ExportSpells(book, kept))
+}
+
+// importSpells writes the engine spell list at path as a spells file
+func importSpells(path, out string) error {
+	var spells []engine.Spell
+	if err := readJSON(path, &spells); err != nil {
+		return err
+	}
+	book, err := engine.ImportSpells(spells)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return writeJSON(out, engine.SpellsFile(book))
+}
+
+// exportRules writes the config's rules of play and scoring as engine
+// constants
+func exportRules(config utils.Config, out string) error {
+	r, s := sim.DefaultRules(), sim.DefaultScoring()
+	var err error
+	if config.PlayRulesFile != "" {
+		if r, err = sim.LoadRules(config.PlayRulesFile); err != nil {
+			return err
+		}
+	}
+	if config.ScoringFile != "" {
+		if s, err = sim.LoadScoring(config.ScoringFile); err != nil {
+			return err
+		}
+	}
+	c, err := engine.ExportRules(r, s)
+	if err != nil {
+		return err
+	}
+	return writeJSON(out, c)
+}
+
+// importRules writes the engine constants at path as rules and scoring
+// files in dir
+func importRules(path, dir string) error {
+	c := engine.DefaultConstants()
+	if err := readJSON(path, &c); err != nil {
+		return err
+	}
+	r, s, err := engine.ImportRules(c)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := writeFile(filepath.Join(dir, rulesFile), r); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, scoringFile), s); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s and %s to %s; set playRulesFile and scoringFile to them\n", rulesFile, scoringFile, outDir(dir))
+	return nil
+}
+
+// checkBlocks lists how the engine's block definitions at path differ
+// from the tools'
+func checkBlocks(path string) error {
+	var b engine.Blocks
+	if err := readJSON(path, &b); err != nil {
+		return err
+	}
+	diffs := engine.CompareBlocks(b)
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%s: %d differences from the tools' blocks", path, len(diffs))
+	}
+	fmt.Println("the engine's blocks match the tools'")
+	return nil
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSON writes v as indented JSON to path, or stdout for none
+func writeJSON(path string, v any) error {
+	if path == "" {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	return writeFile(path, v)
+}
+
+// writeFile writes v as indented JSON to path, making its directory
+func writeFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// baseName is a file's name without its directory or extension
+func baseName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+func outDir(dir string) string {
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
@@ -0,0 +1,282 @@
+// Package generate is stt generate, which generates batches of levels
+package generate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/notify"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/plugins"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/ratelimit"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Main runs stt generate with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("generate"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	prefix := fs.String("name", "level", "level name prefix")
+	count := fs.Int("count", 1, "number of levels to generate")
+	outDir := fs.String("out", "data/levels", "output directory for level files")
+	dryRun := fs.Bool("dry-run", false, "print per-level statistics without writing level files")
+	binary := fs.Bool("binary", false, "write the levels in the compressed binary level format, for large packs; stt convert turns them back into JSON")
+	asJSON := fs.Bool("json", false, "print statistics as JSON")
+	summary := fs.Bool("summary", false, "print combined telemetry of the batch directories given as arguments")
+	experiment := fs.String("experiment", "", "tag the levels as one arm of this A/B experiment")
+	arm := fs.String("arm", "", "experiment arm the levels belong to, with -experiment")
+	patch := fs.String("patch", "", "partial config applied over -config, such as the tuning suggestions written by analyze -tune")
+	profile := fs.Bool("profile", false, "write CPU and heap profiles and sampled stacks of the batch to the config's profileDir")
+	metricsAddr := fs.String("metrics", "", "serve the profiler's Prometheus metrics and a live dashboard on this address while the batch runs, for soak tests")
+	watchFlags := cli.AddWatchFlags(fs, "the config, -patch or the rules, scoring, spells and play rules files")
+	fs.Parse(args)
+
+	if *summary {
+		telemetry, err := generator.MergeManifests(fs.Args())
+		if err != nil {
+			cli.Fail(err)
+		}
+		telemetry.Report(os.Stdout)
+		return
+	}
+
+	config := cli.Config(*configPath)
+	if *patch != "" {
+		var err error
+		if config, err = utils.ApplyConfigPatch(config, *patch); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *watchFlags.Watch {
+		inputs := []string{cli.ConfigPath(*configPath), *patch, config.RulesFile, config.ScoringFile, config.SpellsFile, config.PlayRulesFile}
+		if config.GeneratorPlugin != "" {
+			inputs = append(inputs, config.PluginsDir)
+		}
+		cli.Watch("generate", args, watchFlags, inputs, []string{*outDir})
+		return
+	}
+
+	notifier, err := notify.New(config.Webhooks, config.WebhookArtifactURL)
+	if err != nil {
+		cli.Fail(err)
+	}
+
+	var timeline *profiler.Timeline
+	var disk *profiler.IORecorder
+	if *profile {
+		if config.ProfileIO {
+			disk = profiler.NewIORecorder()
+		}
+		session, err := profiler.Start(profiler.Options{
+			CPU:               config.ProfileCPU,
+			Memory:            config.ProfileMemory,
+			Dir:               config.ProfileDir,
+			SampleInterval:    time.Duration(config.ProfilerSamplingRate) * time.Millisecond,
+			SampleFormat:      config.ProfilerOutputFormat,
+			SampleBudget:      config.ProfilerCPUBudget,
+			HeapInterval:      time.Duration(config.ProfileHeapInterval) * time.Second,
+			GoroutineInterval: time.Duration(config.ProfileGoroutineInterval) * time.Second,
+			AllocInterval:     time.Duration(config.ProfileAllocInterval) * time.Second,
+			Contention:        config.ProfileContention,
+			IO:                disk,
+		})
+		if err != nil {
+			cli.Fail(err)
+		}
+		timeline = session.Timeline()
+		defer func() {
+			paths, err := session.Stop()
+			if err != nil {
+				cli.Warn(err)
+			}
+			for _, p := range paths {
+				fmt.Println("profile written to", p)
+			}
+			if leaks := session.Leaks(); leaks != nil {
+				for _, w := range leaks.Warnings() {
+					cli.Warn(w)
+				}
+			}
+			if leaks := session.GoroutineLeaks(); leaks != nil {
+				for _, w := range leaks.Warnings() {
+					cli.Warn(w)
+				}
+			}
+		}()
+	}
+
+	if config.ProfileContinuous {
+		opts := profiler.DefaultContinuousOptions(filepath.Join(config.ProfileDir, "continuous"))
+		opts.Retention = time.Duration(config.ProfileRetentionDays) * 24 * time.Hour
+		continuous, err := profiler.StartContinuous(opts)
+		if err != nil {
+			cli.Fail(err)
+		}
+		defer continuous.Stop()
+	}
+
+	budgets := profileBudgets(config)
+	var live *profiler.LiveMetrics
+	if *metricsAddr != "" || budgets.Any() {
+		live = profiler.NewLiveMetrics()
+	}
+	if *metricsAddr != "" {
+		ln, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			cli.Fail(err)
+		}
+		keys, err := auth.Load(config.AuthTokensFile)
+		if err != nil {
+			cli.Fail(err)
+		}
+		dash := profiler.NewDashboard(live.Snapshot, time.Second)
+		defer dash.Close()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", live)
+		mux.Handle("/debug/dashboard/", dash)
+		srv := &http.Server{Handler: crash.Handler(ratelimit.FromConfig(config, keys).Middleware(keys.Middleware(auth.Surface(auth.SurfaceProfiler), mux))), ReadHeaderTimeout: 10 * time.Second}
+		go srv.Serve(ln)
+		defer srv.Close()
+		fmt.Fprintf(os.Stderr, "serving metrics on %s/metrics and a live dashboard on %s/debug/dashboard/\n", ln.Addr(), ln.Addr())
+	}
+	var budgetWatch *profiler.BudgetWatch
+	if budgets.Any() {
+		budgetWatch = profiler.StartBudgetWatch(live, budgets, time.Second, profiler.AlertLog(os.Stderr))
+	}
+
+	if (*experiment == "") != (*arm == "") {
+		cli.Fail(errors.New("-experiment and -arm go together"))
+	}
+	var metadata map[string]string
+	if *experiment != "" {
+		metadata = map[string]string{"experiment": *experiment, "arm": *arm}
+	}
+
+	gen, stopPlugins, err := plugins.NewGenerator(config)
+	if err != nil {
+		cli.Fail(err)
+	}
+	stopTracing := startTracing(config, timeline)
+	job := notifier.Start(notify.JobGenerate)
+	ctx, span := tracing.Start(context.Background(), "generate")
+	entries, err := gen.RunBatch(generator.BatchOptions{
+		Context:   ctx,
+		Prefix:    *prefix,
+		Count:     *count,
+		OutputDir: *outDir,
+		DryRun:    *dryRun,
+		Binary:    *binary,
+		Metadata:  metadata,
+		Publish:   publisher(disk),
+	})
+	span.SetError(err)
+	span.End()
+	stopPlugins()
+	stopTracing() // before any exit below
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(entries)
+	} else {
+		printEntries(entries)
+		fmt.Println()
+		gen.Telemetry().Report(os.Stdout)
+	}
+	if err == nil && budgetWatch != nil {
+		budgetWatch.Stop()
+		if exceeded := budgetWatch.Exceeded(); len(exceeded) > 0 {
+			err = fmt.Errorf("performance budgets exceeded: %s", strings.Join(exceeded, ", "))
+		}
+	}
+	reportBatch(job, entries, *outDir, *dryRun, err)
+	if err != nil {
+		cli.Fail(err)
+	}
+}
+
+// reportBatch tells the config's webhooks how the batch ended
+func reportBatch(job *notify.Job, entries []generator.BatchEntry, outDir string, dryRun bool, err error) {
+	fallbacks, difficulty := 0, 0.0
+	for _, e := range entries {
+		if e.Fallback {
+			fallbacks++
+		}
+		difficulty += e.Difficulty
+	}
+	job.Field("levels", "%d", len(entries))
+	job.Field("fallbacks", "%d", fallbacks)
+	if len(entries) > 0 {
+		job.Field("mean difficulty", "%.2f", difficulty/float64(len(entries)))
+	}
+	if !dryRun && len(entries) > 0 {
+		job.Artifact("manifest", filepath.Join(outDir, generator.ManifestFile))
+	}
+	if err != nil {
+		err = job.Fail(fmt.Sprintf("batch failed after %d levels", len(entries)), err)
+	} else if dryRun {
+		err = job.Succeed(fmt.Sprintf("dry run of %d levels", len(entries)))
+	} else {
+		err = job.Succeed(fmt.Sprintf("generated %d levels into %s", len(entries), outDir))
+	}
+	if err != nil {
+		cli.Warn(err)
+	}
+}
+
+// profileBudgets are the config's performance budgets
+func profileBudgets(config utils.Config) profiler.Budgets {
+	return profiler.Budgets{TickMs: config.BudgetTickMs, HeapMiB: config.BudgetHeapMiB, BandwidthKiBps: config.BudgetBandwidthKiBps}
+}
+
+// startTracing exports the batch's spans to the config's collector, if any,
+// and to the profile's timeline, and returns the function that flushes them
+func startTracing(config utils.Config, timeline *profiler.Timeline) func() {
+	var also []tracing.Exporter
+	if timeline != nil {
+		also = append(also, timeline)
+	}
+	shutdown := tracing.Setup(config.TracingEndpoint, "supertetris-generate", also...)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			cli.Warn("tracing:", err)
+		}
+	}
+}
+
+// publisher times the batch's level writes when profiling disk I/O
+func publisher(disk *profiler.IORecorder) func(string, func() error) error {
+	if disk == nil {
+		return nil
+	}
+	return func(path string, write func() error) error {
+		return disk.Time(profiler.IOLevelSave, path, write)
+	}
+}
+
+func printEntries(entries []generator.BatchEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tMODE\tBLOCKS\tSPECIAL\tPICKUPS\tDENSITY\tHEIGHT\tHOLES\tDIFFICULTY\tMS\tFALLBACK")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%.3f\t%d\t%d\t%.2f\t%d\t%v\n",
+			e.Name, e.Mode, e.Blocks, e.SpecialBlocks, e.Pickups, e.Density, e.MaxHeight, e.Holes, e.Difficulty,
+			e.DurationMs, e.Fallback)
+	}
+	w.Flush()
+}
@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/jobqueue"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/plugins"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replaystore"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Kinds of job the workers run
+const (
+	KindGenerate = "generate"
+	KindAnalyze  = "analyze"
+	KindSimulate = "simulate"
+)
+
+// Kinds lists them
+var Kinds = []string{KindGenerate, KindAnalyze, KindSimulate}
+
+// maxBatch bounds the levels one generate job builds, so its result stays
+// a reasonable row of the queue's database
+const maxBatch = 1000
+
+// GenerateJob is a generate job's payload: a batch built as generate
+// -dry-run would
+type GenerateJob struct {
+	Prefix      string            `json:"prefix"`
+	Count       int               `json:"count"`
+	Seed        int64             `json:"seed,omitempty"`        // 0 for the worker's config's
+	ConfigPatch json.RawMessage   `json:"configPatch,omitempty"` // applied over the worker's config, as stt generate -patch
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// GenerateResult is a generate job's result
+type GenerateResult struct {
+	Levels  []*level.Level         `json:"levels"`
+	Entries []generator.BatchEntry `json:"entries"`
+}
+
+// AnalyzeJob is an analyze job's payload: the tables analyze computes of
+// a dataset the worker loads. Directories are the worker's; a replay
+// store's URL reaches the same replays from every machine.
+type AnalyzeJob struct {
+	Levels  string `json:"levels,omitempty"`  // directory of level files
+	Replays string `json:"replays,omitempty"` // directory, replay store, or replay store URL, as stt analyze -replays
+}
+
+// SimulateJob is a simulate job's payload: the difficulty model's clear
+// simulation of a level, and with Solve the solver's verdict
+type SimulateJob struct {
+	Level     *level.Level `json:"level"`
+	Solve     bool         `json:"solve,omitempty"`
+	MaxPieces int          `json:"maxPieces,omitempty"` // 0 for the solver's default
+	MaxNodes  int          `json:"maxNodes,omitempty"`
+}
+
+// SimulateResult is a simulate job's result
+type SimulateResult struct {
+	Level    string                   `json:"level"`
+	Clears   analyzer.ClearSimulation `json:"clears"`
+	Rate     float64                  `json:"rate"` // of lines cleared, relative to perfect play
+	Solution *analyzer.Solvability    `json:"solution,omitempty"`
+}
+
+// handlers run the kinds of job, with the worker's config
+func handlers(config utils.Config) map[string]jobqueue.Handler {
+	return map[string]jobqueue.Handler{
+		KindGenerate: func(ctx context.Context, payload json.RawMessage) (any, error) {
+			var job GenerateJob
+			if err := json.Unmarshal(payload, &job); err != nil {
+				return nil, err
+			}
+			return generate(ctx, config, job)
+		},
+		KindAnalyze: func(ctx context.Context, payload json.RawMessage) (any, error) {
+			var job AnalyzeJob
+			if err := json.Unmarshal(payload, &job); err != nil {
+				return nil, err
+			}
+			return analyze(ctx, config, job)
+		},
+		KindSimulate: func(ctx context.Context, payload json.RawMessage) (any, error) {
+			var job SimulateJob
+			if err := json.Unmarshal(payload, &job); err != nil {
+				return nil, err
+			}
+			return simulate(job)
+		},
+	}
+}
+
+func generate(ctx context.Context, config utils.Config, job GenerateJob) (GenerateResult, error) {
+	var res GenerateResult
+	if job.Count <= 0 || job.Count > maxBatch {
+		return res, fmt.Errorf("count %d isn't between 1 and %d", job.Count, maxBatch)
+	}
+	if len(job.ConfigPatch) > 0 {
+		var err error
+		if config, err = utils.PatchConfig(config, job.ConfigPatch); err != nil {
+			return res, err
+		}
+	}
+	if job.Seed != 0 {
+		config.GeneratorSeed = job.Seed
+	}
+	if job.Prefix == "" {
+		job.Prefix = "level"
+	}
+	gen, stop, err := plugins.NewGenerator(config)
+	if err != nil {
+		return res, err
+	}
+	defer stop()
+	res.Entries, err = gen.RunBatch(generator.BatchOptions{
+		Context:  ctx,
+		Prefix:   job.Prefix,
+		Count:    job.Count,
+		DryRun:   true,
+		Metadata: job.Metadata,
+		Emit: func(lvl *level.Level, _ generator.BatchEntry) error {
+			res.Levels = append(res.Levels, lvl)
+			return ctx.Err()
+		},
+	})
+	return res, err
+}
+
+func analyze(ctx context.Context, config utils.Config, job AnalyzeJob) ([]*analyzer.Table, error) {
+	if job.Levels == "" && job.Replays == "" {
+		return nil, errors.New("nothing to analyze: give levels, replays or both")
+	}
+	d := analyzer.NewDataset()
+	pool := analyzer.Pool{Workers: config.AnalysisWorkers}
+	if job.Levels != "" {
+		if _, err := d.LoadLevelsWith(job.Levels, pool); err != nil {
+			return nil, err
+		}
+	}
+	if job.Replays != "" {
+		var err error
+		switch {
+		case replaystore.IsURL(job.Replays):
+			var c *replaystore.Client
+			if c, err = replaystore.NewClient(job.Replays); err == nil {
+				_, err = d.LoadReplaysFrom(c, pool)
+			}
+		case replaystore.IsStore(job.Replays):
+			var s *replaystore.Store
+			if s, err = replaystore.Open(job.Replays); err == nil {
+				_, err = d.LoadReplaysFrom(s, pool)
+				s.Close()
+			}
+		default:
+			_, err = d.LoadReplaysWith(job.Replays, pool)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return analyzer.DatasetTables(ctx, d, d.AnalyzeLevels(), level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight})
+}
+
+func simulate(job SimulateJob) (SimulateResult, error) {
+	if job.Level == nil {
+		return SimulateResult{}, errors.New("no level to simulate")
+	}
+	if err := job.Level.Validate(); err != nil {
+		return SimulateResult{}, fmt.Errorf("level %s: %w", job.Level.Name, err)
+	}
+	clears := analyzer.SimulateClears(job.Level)
+	res := SimulateResult{Level: job.Level.Name, Clears: clears, Rate: clears.Rate(job.Level.GridSize.Width)}
+	if job.Solve {
+		opts := analyzer.DefaultSolveOptions()
+		if job.MaxPieces > 0 {
+			opts.MaxPieces = job.MaxPieces
+		}
+		if job.MaxNodes > 0 {
+			opts.MaxNodes = job.MaxNodes
+		}
+		sol := analyzer.Solve(job.Level, opts)
+		res.Solution = &sol
+	}
+	return res, nil
+}
@@ -0,0 +1,379 @@
+// Package jobs is stt jobs, which submits batch work to the job queue,
+// follows it and runs workers taking it
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/discovery"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/jobqueue"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// commands are what jobs does, each parsing its own flags
+var commands = map[string]func(ctx context.Context, c *jobqueue.Client, config utils.Config, args []string) error{
+	"submit":  submit,
+	"status":  status,
+	"result":  result,
+	"list":    list,
+	"workers": workers,
+	"work":    work,
+}
+
+var asJSON bool
+
+// Main runs stt jobs with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("jobs"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; a worker generates and analyzes with its settings")
+	server := fs.String("server", "", "job queue, such as http://host:8103 (default the config's jobQueueUrl, or the one on the LAN)")
+	fs.BoolVar(&asJSON, "json", false, "print jobs and workers as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: %[1]s [flags] submit generate|analyze|simulate [flags] [level.json ...]
+       %[1]s [flags] status [-wait] ID
+       %[1]s [flags] result ID
+       %[1]s [flags] result -out DIR ID ...
+       %[1]s [flags] list [-status S] [-kind K] [-limit N]
+       %[1]s [flags] workers
+       %[1]s [flags] work [-kinds K,...] [-parallel N]
+
+Spreads batch work across machines through stt serve jobs's queue.
+submit queues jobs: generate splits a batch of levels into jobs of
+-per-job levels, analyze computes stt analyze's tables of a dataset, and
+simulate queues a job per level file, running the difficulty model's
+clear simulation and with -solve the solver. Each prints its job IDs.
+
+work runs a worker on this machine taking the jobs of its kinds until
+interrupted; start one on each machine to lend. A job whose worker fails
+or dies is queued again for another until its attempts run out.
+
+status shows where a job stands, waiting with -wait until it's done or
+failed, and result prints its result, or with -out writes generate
+jobs' levels as files, a split batch's with one manifest. list and
+workers show the queue.
+
+`, cli.Name("jobs"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *server == "" {
+		*server = config.JobQueueURL
+	}
+	if *server == "" {
+		f, err := discovery.Find(ctx, config.DiscoveryAddr, discovery.KindJobs, "")
+		if err != nil {
+			cli.Fail(fmt.Errorf("%w; pass -server or set the config's jobQueueUrl", err))
+		}
+		fmt.Fprintf(os.Stderr, "found job queue %q on %s at %s\n", f.Name, f.Host, f.URL)
+		*server = f.URL
+	}
+	c, err := jobqueue.NewClient(*server)
+	if err != nil {
+		cli.Fail(err)
+	}
+	if err := cmd(ctx, c, config, fs.Args()[1:]); err != nil {
+		cli.Fail(err)
+	}
+}
+
+func submit(ctx context.Context, c *jobqueue.Client, config utils.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: stt jobs submit generate|analyze|simulate [flags] [level.json ...]")
+		os.Exit(2)
+	}
+	kind := args[0]
+	fs := flag.NewFlagSet(cli.Name("jobs", "submit", kind), flag.ExitOnError)
+	attempts := fs.Int("attempts", 0, "a job gets before it's failed (default the queue's)")
+	var payloads []any
+	switch kind {
+	case KindGenerate:
+		count := fs.Int("count", 10, "levels to generate")
+		perJob := fs.Int("per-job", 100, "levels a job builds, up to 1000")
+		prefix := fs.String("prefix", "level", "level name prefix; each job's levels are PREFIX-N_level_M")
+		seed := fs.Int64("seed", 0, "seed of the first job, the next job's one more (default each worker's config's)")
+		patch := fs.String("patch", "", "partial config the workers apply over theirs, as stt generate -patch")
+		meta := fs.String("meta", "", "comma-separated key=value metadata added to every level")
+		fs.Parse(args[1:])
+		if *count <= 0 || *perJob <= 0 || *perJob > maxBatch {
+			return fmt.Errorf("-count must be positive and -per-job between 1 and %d", maxBatch)
+		}
+		var raw json.RawMessage
+		if *patch != "" {
+			data, err := os.ReadFile(*patch)
+			if err != nil {
+				return err
+			}
+			if _, err := utils.PatchConfig(config, data); err != nil {
+				return fmt.Errorf("%s: %w", *patch, err)
+			}
+			raw = data
+		}
+		metadata, err := parseMeta(*meta)
+		if err != nil {
+			return err
+		}
+		for i := 0; i*(*perJob) < *count; i++ {
+			job := GenerateJob{Prefix: *prefix, Count: min(*perJob, *count-i*(*perJob)), ConfigPatch: raw, Metadata: metadata}
+			if *count > *perJob {
+				job.Prefix = fmt.Sprintf("%s-%d", *prefix, i+1)
+			}
+			if *seed != 0 {
+				job.Seed = *seed + int64(i)
+			}
+			payloads = append(payloads, job)
+		}
+	case KindAnalyze:
+		levels := fs.String("levels", "", "directory of level files, on the worker")
+		replays := fs.String("replays", "", "replays as stt analyze -replays takes them; a replay store URL reaches every worker")
+		fs.Parse(args[1:])
+		if *levels == "" && *replays == "" {
+			return fmt.Errorf("nothing to analyze: pass -levels, -replays or both")
+		}
+		payloads = append(payloads, AnalyzeJob{Levels: *levels, Replays: *replays})
+	case KindSimulate:
+		solve := fs.Bool("solve", false, "run the solver too")
+		maxPieces := fs.Int("max-pieces", 0, "longest solution the solver searches for (default its own)")
+		maxNodes := fs.Int("max-nodes", 0, "board states the solver explores before giving up (default its own)")
+		fs.Parse(args[1:])
+		if fs.NArg() == 0 {
+			return fmt.Errorf("no level files to simulate")
+		}
+		for _, path := range fs.Args() {
+			lvl, err := level.Load(path)
+			if err != nil {
+				return err
+			}
+			payloads = append(payloads, SimulateJob{Level: lvl, Solve: *solve, MaxPieces: *maxPieces, MaxNodes: *maxNodes})
+		}
+	default:
+		return fmt.Errorf("unknown kind of job %q, want one of %s", kind, strings.Join(Kinds, ", "))
+	}
+
+	for _, p := range payloads {
+		j, err := c.Submit(ctx, kind, p, *attempts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(j.ID)
+	}
+	fmt.Fprintf(os.Stderr, "submitted %d %s jobs\n", len(payloads), kind)
+	return nil
+}
+
+func status(ctx context.Context, c *jobqueue.Client, _ utils.Config, args []string) error {
+	fs := flag.NewFlagSet(cli.Name("jobs", "status"), flag.ExitOnError)
+	wait := fs.Bool("wait", false, "wait until the job is done or failed; exits 1 if it failed")
+	fs.Parse(args)
+	id, err := jobArg(fs)
+	if err != nil {
+		return err
+	}
+	var j jobqueue.Job
+	if *wait {
+		j, err = c.Wait(ctx, id, time.Second)
+	} else {
+		j, err = c.Job(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	printJobs([]jobqueue.Job{j})
+	if *wait && j.Status == jobqueue.StatusFailed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func result(ctx context.Context, c *jobqueue.Client, _ utils.Config, args []string) error {
+	fs := flag.NewFlagSet(cli.Name("jobs", "result"), flag.ExitOnError)
+	out := fs.String("out", "", "directory to write generate jobs' levels and their manifest to")
+	fs.Parse(args)
+	if fs.NArg() == 0 || *out == "" && fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var jobs []jobqueue.Job
+	for _, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("job ID %q isn't a number", arg)
+		}
+		j, err := c.Job(ctx, id)
+		if err != nil {
+			return err
+		}
+		switch {
+		case j.Status == jobqueue.StatusFailed:
+			return fmt.Errorf("job %d failed after %d attempts: %s", j.ID, j.Attempts, j.Error)
+		case j.Status != jobqueue.StatusDone:
+			return fmt.Errorf("job %d is %s", j.ID, j.Status)
+		case *out != "" && j.Kind != KindGenerate:
+			return fmt.Errorf("job %d is a %s job; only generate jobs' results are written as files", j.ID, j.Kind)
+		}
+		jobs = append(jobs, j)
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(append(jobs[0].Result, '\n'))
+		return err
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	manifest := generator.Manifest{Generated: time.Now().UTC()}
+	for _, j := range jobs {
+		var res GenerateResult
+		if err := json.Unmarshal(j.Result, &res); err != nil {
+			return fmt.Errorf("job %d: %w", j.ID, err)
+		}
+		for i, lvl := range res.Levels {
+			name := lvl.Name + ".json"
+			if err := lvl.Save(filepath.Join(*out, name)); err != nil {
+				return err
+			}
+			if i < len(res.Entries) {
+				res.Entries[i].File = name
+			}
+		}
+		manifest.Levels = append(manifest.Levels, res.Entries...)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(*out, generator.ManifestFile), data, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d levels to %s\n", len(manifest.Levels), *out)
+	return nil
+}
+
+func list(ctx context.Context, c *jobqueue.Client, _ utils.Config, args []string) error {
+	fs := flag.NewFlagSet(cli.Name("jobs", "list"), flag.ExitOnError)
+	var f jobqueue.Filter
+	fs.StringVar(&f.Status, "status", "", "queued, running, done or failed (default all)")
+	fs.StringVar(&f.Kind, "kind", "", "kind of job (default all)")
+	fs.IntVar(&f.Limit, "limit", jobqueue.DefaultLimit, "jobs listed, newest first")
+	fs.Parse(args)
+	jobs, err := c.Jobs(ctx, f)
+	if err != nil {
+		return err
+	}
+	printJobs(jobs)
+	return nil
+}
+
+func workers(ctx context.Context, c *jobqueue.Client, _ utils.Config, _ []string) error {
+	ws, err := c.Workers(ctx)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(ws)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "WORKER\tHOST\tKINDS\tSEEN\tRUNNING")
+	for _, wk := range ws {
+		running := make([]string, len(wk.Running))
+		for i, id := range wk.Running {
+			running[i] = strconv.FormatInt(id, 10)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s ago\t%s\n", wk.ID, wk.Host, strings.Join(wk.Kinds, ","),
+			time.Since(wk.Seen).Round(time.Second), strings.Join(running, ","))
+	}
+	return nil
+}
+
+func work(ctx context.Context, c *jobqueue.Client, config utils.Config, args []string) error {
+	fs := flag.NewFlagSet(cli.Name("jobs", "work"), flag.ExitOnError)
+	kinds := fs.String("kinds", strings.Join(Kinds, ","), "comma-separated kinds of job to take")
+	name := fs.String("name", "", "worker name (default the host's)")
+	parallel := fs.Int("parallel", 1, "jobs to run at once")
+	fs.Parse(args)
+	all := handlers(config)
+	taken := map[string]jobqueue.Handler{}
+	for _, k := range strings.Split(*kinds, ",") {
+		h, ok := all[k]
+		if !ok {
+			return fmt.Errorf("unknown kind of job %q, want one of %s", k, strings.Join(Kinds, ", "))
+		}
+		taken[k] = h
+	}
+	fmt.Fprintf(os.Stderr, "working on %s jobs, %d at a time, until interrupted\n", *kinds, *parallel)
+	return c.Work(ctx, jobqueue.WorkerOptions{Name: *name, Handlers: taken, Parallel: *parallel})
+}
+
+func jobArg(fs *flag.FlagSet) (int64, error) {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("job ID %q isn't a number", fs.Arg(0))
+	}
+	return id, nil
+}
+
+// parseMeta reads key=value,key=value
+func parseMeta(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	meta := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("metadata %q isn't key=value", kv)
+		}
+		meta[k] = v
+	}
+	return meta, nil
+}
+
+func printJobs(jobs []jobqueue.Job) {
+	if asJSON {
+		printJSON(jobs)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "ID\tKIND\tSTATUS\tATTEMPTS\tWORKER\tCREATED\tERROR")
+	for _, j := range jobs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d/%d\t%s\t%s\t%s\n", j.ID, j.Kind, j.Status, j.Attempts, j.MaxAttempts, j.Worker,
+			j.Created.Local().Format(time.DateTime), j.Error)
+	}
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
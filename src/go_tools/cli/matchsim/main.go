@@ -0,0 +1,154 @@
+// Package matchsim is stt matchsim, which simulates a player population
+// queueing under the matchmaking policies
+package matchsim
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/netprobe"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rating"
+)
+
+// Main runs stt matchsim with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("matchsim"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file, for its logging")
+	simPath := fs.String("sim", "", "simulation config: population, duration and policies as JSON (default a built-in population and three policies)")
+	seed := fs.Int64("seed", 0, "seed of the population and its arrivals, overriding the config's; 0 keeps it")
+	players := fs.Int("players", 0, "population size, overriding the config's")
+	duration := fs.Duration("duration", 0, "simulated time, overriding the config's")
+	out := fs.String("out", "", "write the full reports as JSON to this file")
+	asJSON := fs.Bool("json", false, "print the reports as JSON")
+	printConfig := fs.Bool("print-config", false, "print the simulation config that would run, to start a -sim file from")
+	latency := fs.String("latency", "", "comma-separated probe reports, one from each region, whose median round trips between regions the policies' maxRttMs and the reports' RTT columns use")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt matchsim [flags]
+
+Simulates a synthetic player population queueing for matches under each
+matchmaking policy of the -sim config, and reports queue times against how
+fair the matches were, by the players' hidden skill and by the ratings the
+matchmaker saw, so its parameters can be tuned offline. Every policy sees
+the same population.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	cli.Config(*configPath)
+
+	config := rating.DefaultSimulationConfig()
+	if *simPath != "" {
+		var err error
+		if config, err = rating.LoadSimulationConfig(*simPath); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *seed != 0 {
+		config.Seed = *seed
+	}
+	if *players > 0 {
+		config.Population.Players = *players
+	}
+	if *duration > 0 {
+		config.DurationSec = int(duration.Seconds())
+	}
+	if *latency != "" {
+		for _, path := range strings.Split(*latency, ",") {
+			if err := applyLatency(&config, path); err != nil {
+				cli.Fail(err)
+			}
+		}
+	}
+	if *printConfig {
+		data, _ := json.MarshalIndent(config, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	reports, err := rating.Simulate(config)
+	if err != nil {
+		cli.Fail(err)
+	}
+	if *out != "" {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			cli.Fail(err)
+		}
+		if err := os.WriteFile(*out, data, 0644); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *asJSON {
+		data, _ := json.MarshalIndent(reports, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	printReports(reports)
+	if *out != "" {
+		fmt.Println("\nreports written to", *out)
+	}
+}
+
+// applyLatency sets the round trips a probe report measured from its
+// region
+func applyLatency(config *rating.SimulationConfig, path string) error {
+	rep, err := netprobe.ReadReport(path)
+	if err != nil {
+		return err
+	}
+	if rep.From == "" {
+		return fmt.Errorf("latency report %s doesn't say where it was probed from; run stt probe with -from", path)
+	}
+	for _, r := range rep.Regions {
+		if r.Received == 0 {
+			cli.Warnf("%s: no round trips from %s to %s", path, rep.From, r.Region)
+			continue
+		}
+		if err := config.Population.SetRTT(rep.From, r.Region, r.P50Ms); err != nil {
+			return fmt.Errorf("latency report %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// printReports compares the policies, then each one's regions
+func printReports(reports []rating.SimulationReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POLICY\tMATCHES\tQUEUE P50\tP90\tP99\tABANDONED\tCROSS-REGION\tSKILL GAP P50\tP90\tFAVOURITE ODDS\tFAIR\tRATING GAP P50\tUPSETS\tRTT P50\tP90")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%d\t%.1f%%\t%.0f\t%.0f\t%.2f\t%.1f%%\t%.0f\t%.1f%%\t%s\t%s\n",
+			r.Policy.Name, r.Matches, seconds(r.QueueP50Ms), seconds(r.QueueP90Ms), seconds(r.QueueP99Ms), r.Abandoned,
+			100*r.CrossRegion, r.SkillGapP50, r.SkillGapP90, r.FavoriteOdds, 100*r.FairShare,
+			r.Matchmaking.GapP50, 100*r.Matchmaking.UpsetRate, millis(r.RTTP50Ms), millis(r.RTTP90Ms))
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POLICY\tREGION\tMATCHED\tABANDONED\tQUEUE P50\tP90\tPLAYED OUTSIDE")
+	for _, r := range reports {
+		for _, q := range r.Regions {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%.1f%%\n", r.Policy.Name, q.Region, q.Matched, q.Abandoned,
+				seconds(q.QueueP50Ms), seconds(q.QueueP90Ms), 100*q.CrossShare)
+		}
+	}
+	w.Flush()
+}
+
+func seconds(ms int64) string {
+	return fmt.Sprintf("%ds", ms/1000)
+}
+
+// millis is a round trip, or - when none was measured
+func millis(ms float64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0fms", ms)
+}
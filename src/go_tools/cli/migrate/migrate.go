@@ -0,0 +1,131 @@
+// Package migrate is stt migrate, which upgrades level files, and packs
+// and batches of them, to the current level format
+package migrate
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Main runs stt migrate with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("migrate"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	dryRun := fs.Bool("dry-run", false, "print what each level's migration changes without writing it")
+	check := fs.Bool("check", false, "write nothing and exit with status 1 if any level is of an older format")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt migrate [flags] PATH...
+
+Upgrades level files to format %d, the one this build writes. A
+directory, such as a pack version or a generator batch, has each level
+file under it but batch manifests migrated; binary levels are left as
+they are. The tools still load levels
+of older formats, migrating them as they're read; migrated files are
+what a later build, or the Python tools, read without it. -dry-run
+prints each value the upgrade would add, remove or change.
+
+Formats:
+`, level.CurrentFormat)
+		for _, m := range level.Migrations {
+			fmt.Fprintf(fs.Output(), "  %d to %d: %s\n", m.From, m.From+1, m.Summary)
+		}
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cli.Config(*configPath)
+
+	var files []string
+	for _, p := range fs.Args() {
+		found, err := level.Files(p, generator.ManifestFile)
+		if err != nil {
+			cli.Fail(err)
+		}
+		files = append(files, found...)
+	}
+	var migrated, current, failed int
+	rewritten := make(map[string]bool)
+	for _, path := range files {
+		changes, from, err := migrateFile(path, *dryRun || *check)
+		switch {
+		case err != nil:
+			cli.Warnf("%s: %v", path, err)
+			failed++
+		case from == level.CurrentFormat:
+			current++
+		default:
+			migrated++
+			rewritten[filepath.Dir(path)] = true
+			fmt.Printf("%s: format %d to %d, %d changes\n", path, from, level.CurrentFormat, len(changes))
+			if *dryRun {
+				for _, c := range changes {
+					fmt.Printf("  %s\n", c)
+				}
+			}
+		}
+	}
+	if !*dryRun && !*check {
+		for dir := range rewritten {
+			dropped, err := generator.RefreshManifest(dir, nil)
+			if err != nil {
+				cli.Warn(err)
+			}
+			if dropped {
+				cli.Warnf("%s: the batch's signature no longer covers its files; sign it again with stt pack -sign", dir)
+			}
+		}
+	}
+	verb := "migrated"
+	if *dryRun || *check {
+		verb = "to migrate"
+	}
+	fmt.Printf("%d levels %s, %d up to date, %d failed\n", migrated, verb, current, failed)
+	if failed > 0 {
+		cli.Fail(fmt.Errorf("%d of %d levels failed to migrate", failed, len(files)))
+	}
+	if *check && migrated > 0 {
+		os.Exit(1)
+	}
+}
+
+// migrateFile upgrades the level at path, writing it back unless dryRun,
+// and returns what changed and the format it was
+func migrateFile(path string, dryRun bool) ([]level.Change, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if level.IsBinary(data) {
+		// a binary level decodes in the current format, or not at all
+		return nil, level.CurrentFormat, nil
+	}
+	from, err := level.FormatOf(data)
+	if err != nil || from == level.CurrentFormat {
+		return nil, from, err
+	}
+	lvl, err := level.Parse(data)
+	if err != nil {
+		return nil, from, err
+	}
+	// written as Save writes, so the diff shows any fields this build
+	// doesn't know and drops
+	out, err := lvl.Marshal()
+	if err != nil {
+		return nil, from, err
+	}
+	changes, err := level.Diff(data, out)
+	if err != nil || dryRun {
+		return changes, from, err
+	}
+	return changes, from, os.WriteFile(path, out, 0644)
+}
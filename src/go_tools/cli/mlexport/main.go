@@ -0,0 +1,151 @@
+// Package mlexport is stt mlexport, which exports replays or bot games as
+// training samples for learned difficulty models and bot policies
+package mlexport
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/bot"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/training"
+)
+
+// Main runs stt mlexport with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("mlexport"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its scoringFile, spellsFile, playRulesFile and pieceRandomizer set up the games, its botSpellsFile how simulated bots play pickups")
+	levelDir := fs.String("levels", "", "directory of level files the replays were played on, or to simulate")
+	replayDir := fs.String("replays", "", "directory of replay files to export")
+	simulate := fs.Int("simulate", 0, "bot games of each level to play and export, as stt batchsim plays them")
+	strengths := fs.String("strengths", "1,2,3", "with -simulate, comma-separated beam bot strengths, a game each in turn")
+	seed := fs.Int64("seed", 1, "with -simulate, deals the first game; each game after it the next seed")
+	frames := fs.Int("frames", bot.DefaultFrames, "with -simulate, a game plays at most")
+	encodingPath := fs.String("encoding", "", "JSON feature encoding: board size and encoding, preview, hold, counters and reward weights (default training.DefaultEncoding)")
+	format := fs.String("format", training.FormatNPZ, "export format: "+strings.Join(training.Formats, " or "))
+	out := fs.String("out", "", "file to write the samples to (default samples.FORMAT)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt mlexport -levels DIR (-replays DIR | -simulate N) [flags]
+
+Exports replays, or bot games it plays, as state-action-reward samples
+for training learned difficulty models and bot policies: a sample a
+piece locked, the player's state as the piece came into play encoded by
+-encoding, the placement it locked at and the lock's reward. The samples
+are written as an NPZ archive of arrays, or TFRecords of tf.train.Example,
+with OUT.meta.json laying out the features and listing the episodes.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *levelDir == "" || (*replayDir == "") == (*simulate <= 0) || !slices.Contains(training.Formats, *format) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	enc := training.DefaultEncoding()
+	if *encodingPath != "" {
+		var err error
+		if enc, err = training.LoadEncoding(*encodingPath); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *out == "" {
+		*out = "samples." + *format
+	}
+	opts, err := sim.OptionsFromConfig(config)
+	if err != nil {
+		cli.Fail(err)
+	}
+
+	data := analyzer.NewDataset()
+	failed, err := data.LoadLevelsWith(*levelDir, analyzer.Pool{})
+	if err != nil {
+		cli.Fail(err)
+	}
+	for _, f := range failed {
+		cli.Warnf("%s: %v", f.File, f.Err)
+	}
+	var replays []*replay.Replay
+	if *replayDir != "" {
+		failed, err := data.LoadReplaysWith(*replayDir, analyzer.Pool{})
+		if err != nil {
+			cli.Fail(err)
+		}
+		for _, f := range failed {
+			cli.Warnf("%s: %v", f.File, f.Err)
+		}
+		replays = data.Replays
+	} else {
+		batch := bot.BatchOptions{Games: *simulate, Seed: *seed, Frames: *frames, Sim: opts}
+		if config.BotSpellsFile != "" {
+			if batch.Spells, err = bot.LoadSpellPolicy(config.BotSpellsFile); err != nil {
+				cli.Fail(err)
+			}
+		}
+		for _, s := range strings.Split(*strengths, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n < 1 {
+				cli.Fail(fmt.Errorf("strength %q is not a positive number", s))
+			}
+			batch.Strengths = append(batch.Strengths, n)
+		}
+		err := bot.PlayBatch(data.LevelList(), batch, func(g bot.BatchGame) error {
+			replays = append(replays, g.Replay)
+			return nil
+		})
+		if err != nil {
+			cli.Fail(err)
+		}
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		cli.Fail(err)
+	}
+	buf := bufio.NewWriter(f)
+	w, err := training.NewWriter(*format, buf, enc.Size())
+	if err != nil {
+		cli.Fail(err)
+	}
+	meta := training.NewMeta(enc)
+	samples, skipped := 0, 0
+	for _, r := range replays {
+		lvl := data.Levels[r.Level]
+		if lvl == nil {
+			skipped++
+			continue
+		}
+		err := training.Extract(lvl, r, opts, meta, func(s training.Sample) error {
+			samples++
+			return w.Write(s)
+		})
+		if err != nil {
+			cli.Warnf("session %s: %v", r.SessionID, err)
+			skipped++
+		}
+	}
+	err = w.Close()
+	if err == nil {
+		err = buf.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cli.Fail(err)
+	}
+	if err := meta.Save(*out + ".meta.json"); err != nil {
+		cli.Fail(err)
+	}
+	fmt.Printf("%d samples of %d episodes, %d features each, written to %s; %d replays skipped\n",
+		samples, len(meta.Episodes), meta.Size, *out, skipped)
+}
@@ -0,0 +1,307 @@
+// Package pack is stt pack, which releases a generator batch as a new
+// version of a level pack on a packs server, keeping a local registry of
+// releases so a bad one can be rolled back
+package pack
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/packs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Main runs stt pack with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("pack"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	packName := fs.String("pack", "", "pack the batch is a version of (default the batch directory's name)")
+	bump := fs.String("bump", packs.BumpMinor, "version part to bump: major, minor or patch")
+	version := fs.String("version", "", "publish as this version instead of bumping the last")
+	endpoint := fs.String("endpoint", "", "packs server to publish to (default the config's packPublishUrl)")
+	registryPath := fs.String("registry", "", "release registry file (default the config's packRegistry)")
+	dryRun := fs.Bool("dry-run", false, "validate the batch and print the release without uploading it")
+	rollback := fs.String("rollback", "", "withdraw this pack's current release, so the one before it is latest again")
+	list := fs.Bool("list", false, "list the releases in the registry, of the packs given as arguments or all")
+	sign := fs.Bool("sign", false, "sign the batch's levels and manifest with the newest key of the config's packKeysFile before publishing; with -dry-run, only check there's a key to")
+	verify := fs.Bool("verify", false, "check the batches given as arguments are whole and, with packKeysFile set, signed")
+	fetch := fs.String("fetch", "", "download this pack's -version, default latest, from -endpoint into -out and verify it")
+	out := fs.String("out", "", "directory -fetch writes the pack to (default the pack's name)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt pack [flags] BATCH
+       stt pack -rollback PACK
+       stt pack -list [PACK...]
+       stt pack -verify BATCH...
+       stt pack -fetch PACK [-version V] [-out DIR]
+
+Validates a generator batch, bumps the pack's version past the highest
+the registry or the server has, uploads the batch to the packs server
+and records the release. -rollback withdraws a pack's current release
+from the server it went to and marks it rolled back; the server keeps
+its files aside.
+
+The batch manifest has each level file's checksum, which -verify and
+-fetch check, so a corrupted download shows. -sign signs each level and
+the manifest with the newest key of the config's packKeysFile, managed
+with stt serve replaykey -file, rewriting them in place, which -dry-run
+doesn't; with packKeysFile set, -verify, -fetch and the packs server
+refuse a pack no key of it signed, or one changed since it was signed.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	config := cli.Config(*configPath)
+	if *endpoint == "" {
+		*endpoint = config.PackPublishURL
+	}
+	if *registryPath == "" {
+		*registryPath = config.PackRegistry
+	}
+	reg, err := packs.ReadRegistry(*registryPath)
+	if err != nil {
+		cli.Fail(err)
+	}
+
+	var keys *replay.Keys
+	if config.PackKeysFile != "" {
+		if keys, err = replay.ReadKeys(config.PackKeysFile); err != nil {
+			cli.Fail(err)
+		}
+	}
+
+	switch {
+	case *list:
+		listReleases(reg, fs.Args())
+	case *rollback != "":
+		if fs.NArg() != 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if err := rollBack(reg, *registryPath, *rollback); err != nil {
+			cli.Fail(err)
+		}
+	case *verify:
+		if fs.NArg() == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		verifyBatches(fs.Args(), keys)
+	case *fetch != "":
+		if fs.NArg() != 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if *version == "" {
+			*version = packs.Latest
+		}
+		if err := fetchPack(*fetch, *version, *endpoint, *out, keys); err != nil {
+			cli.Fail(err)
+		}
+	default:
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if *sign {
+			if err := signBatch(fs.Arg(0), keys, *dryRun); err != nil {
+				cli.Fail(err)
+			}
+		}
+		if err := publish(reg, *registryPath, fs.Arg(0), *packName, *version, *bump, *endpoint, *dryRun); err != nil {
+			cli.Fail(err)
+		}
+	}
+}
+
+// publish validates and uploads a batch, recording the release
+func publish(reg *packs.Registry, registryPath, dir, pack, version, bump, endpoint string, dryRun bool) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if pack == "" {
+		pack = filepath.Base(abs)
+	}
+	if err := packs.ValidateBatch(abs); err != nil {
+		return err
+	}
+	if endpoint == "" && !dryRun {
+		return fmt.Errorf("nowhere to publish: set the config's packPublishUrl or pass -endpoint")
+	}
+	var client *packs.Client
+	if endpoint != "" {
+		if client, err = packs.NewClient(endpoint); err != nil {
+			return err
+		}
+	}
+	if version == "" {
+		latest := reg.Highest(pack)
+		if client != nil {
+			p, err := client.Pack(pack)
+			switch {
+			case errors.Is(err, packs.ErrNotFound):
+			case err != nil:
+				return err
+			case latest == "" || packs.VersionLess(latest, p.Latest):
+				latest = p.Latest
+			}
+		}
+		if version, err = packs.BumpVersion(latest, bump); err != nil {
+			return err
+		}
+	}
+	v, err := packs.ReadBatch(pack, version, abs)
+	if err != nil {
+		return err
+	}
+	levels := 0
+	for _, f := range v.Files {
+		if f.Level != "" {
+			levels++
+		}
+	}
+	if dryRun {
+		fmt.Printf("would publish pack %s version %s: %d levels, %d files, %d bytes, sha256 %s\n", pack, version, levels, len(v.Files), v.Bytes, v.SHA256)
+		return nil
+	}
+	published, err := client.Publish(pack, version, v.Archive())
+	if err != nil {
+		return err
+	}
+	if published.SHA256 != v.SHA256 {
+		cli.Warnf("the server's archive %s isn't the one uploaded, %s", published.SHA256, v.SHA256)
+	}
+	reg.Releases = append(reg.Releases, packs.Release{Pack: pack, Version: version, SHA256: v.SHA256, Levels: levels,
+		Source: abs, Endpoint: endpoint, Published: time.Now().UTC()})
+	if err := reg.Save(registryPath); err != nil {
+		return fmt.Errorf("published pack %s version %s, but recording it failed: %w", pack, version, err)
+	}
+	fmt.Printf("published pack %s version %s, %d levels, to %s\n", pack, version, levels, endpoint)
+	return nil
+}
+
+// signBatch signs the batch in dir with the newest key that can sign; a
+// dry run finds the key but leaves the batch's files as they are
+func signBatch(dir string, keys *replay.Keys, dryRun bool) error {
+	if keys == nil {
+		return fmt.Errorf("no keys to sign with: set the config's packKeysFile")
+	}
+	key, ok := keys.Signer()
+	if !ok {
+		return fmt.Errorf("no key of the packKeysFile can sign; add one with stt serve replaykey -file FILE -new")
+	}
+	if dryRun {
+		fmt.Printf("would sign %s with key %s\n", dir, key.ID)
+		return nil
+	}
+	if err := packs.SignBatch(dir, key); err != nil {
+		return err
+	}
+	fmt.Printf("signed %s with key %s\n", dir, key.ID)
+	return nil
+}
+
+// verifyBatches checks each batch as VerifyBatch does, with the keys when
+// there are any
+func verifyBatches(dirs []string, keys *replay.Keys) {
+	var verifier level.Verifier
+	if keys != nil {
+		verifier = keys.Public()
+	}
+	failed := 0
+	for _, dir := range dirs {
+		if err := packs.VerifyBatch(dir, verifier); err != nil {
+			cli.Warnf("%s: %v", dir, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: ok\n", dir)
+	}
+	if failed > 0 {
+		cli.Fail(fmt.Errorf("%d of %d batches failed verification", failed, len(dirs)))
+	}
+}
+
+// fetchPack downloads and verifies a version of a pack into out
+func fetchPack(pack, version, endpoint, out string, keys *replay.Keys) error {
+	if endpoint == "" {
+		return fmt.Errorf("nowhere to fetch from: set the config's packPublishUrl or pass -endpoint")
+	}
+	client, err := packs.NewClient(endpoint)
+	if err != nil {
+		return err
+	}
+	var verifier level.Verifier
+	if keys != nil {
+		verifier = keys.Public()
+	}
+	if out == "" {
+		out = pack
+	}
+	v, err := client.Fetch(pack, version, out, verifier)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("fetched pack %s version %s, %d files, into %s\n", pack, v.Version, len(v.Files), out)
+	return nil
+}
+
+// rollBack withdraws a pack's current release from the server it went to
+func rollBack(reg *packs.Registry, registryPath, pack string) error {
+	rel, ok := reg.Current(pack)
+	if !ok {
+		return fmt.Errorf("pack %s has no release to roll back", pack)
+	}
+	client, err := packs.NewClient(rel.Endpoint)
+	if err != nil {
+		return err
+	}
+	if err := client.Withdraw(rel.Pack, rel.Version); errors.Is(err, packs.ErrNotFound) {
+		cli.Warnf("%s has no pack %s version %s any more", rel.Endpoint, rel.Pack, rel.Version)
+	} else if err != nil {
+		return err
+	}
+	if _, err := reg.RollBack(pack, time.Now()); err != nil {
+		return err
+	}
+	if err := reg.Save(registryPath); err != nil {
+		return err
+	}
+	latest := "none"
+	if p, err := client.Pack(pack); err == nil && p.Latest != "" {
+		latest = p.Latest
+	}
+	fmt.Printf("rolled back pack %s version %s; %s serves %s as latest\n", pack, rel.Version, rel.Endpoint, latest)
+	return nil
+}
+
+func listReleases(reg *packs.Registry, names []string) {
+	only := make(map[string]bool, len(names))
+	for _, n := range names {
+		only[n] = true
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PACK\tVERSION\tLEVELS\tPUBLISHED\tSTATE\tENDPOINT")
+	for _, rel := range reg.Releases {
+		if len(only) > 0 && !only[rel.Pack] {
+			continue
+		}
+		state := "superseded"
+		if cur, _ := reg.Current(rel.Pack); cur.Version == rel.Version && rel.RolledBack.IsZero() {
+			state = "current"
+		} else if !rel.RolledBack.IsZero() {
+			state = "rolled back " + rel.RolledBack.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", rel.Pack, rel.Version, rel.Levels, rel.Published.Format(time.DateTime), state, rel.Endpoint)
+	}
+	w.Flush()
+}
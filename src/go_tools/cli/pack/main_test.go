@@ -0,0 +1,56 @@
+package pack
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestSignBatchLeavesADryRunAlone(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a1.json":       `{"name":"a1","grid_size":{"width":10,"height":20}}`,
+		"manifest.json": `{"generated":"2024-06-01T12:00:00Z","levels":[{"name":"a1","mode":"standard","file":"a1.json"}]}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unchanged := func() bool {
+		for name, data := range files {
+			got, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, []byte(data)) {
+				return false
+			}
+		}
+		return true
+	}
+	key, err := replay.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &replay.Keys{Keys: []replay.Key{key}}
+
+	if err := signBatch(dir, keys.Public(), true); err == nil {
+		t.Error("a dry run found a key to sign with among public keys")
+	}
+	if err := signBatch(dir, keys, true); err != nil {
+		t.Fatal(err)
+	}
+	if !unchanged() {
+		t.Fatal("a dry run rewrote the batch")
+	}
+	if err := signBatch(dir, keys, false); err != nil {
+		t.Fatal(err)
+	}
+	if unchanged() {
+		t.Error("signing left the batch as it was")
+	}
+}
@@ -0,0 +1,121 @@
+// Package plugin is stt plugin, which lists the plugins of the plugins
+// directory and runs their editor tools on level files
+package plugin
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/plugins"
+)
+
+// Main runs stt plugin with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("plugin"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its pluginsDir is the default -dir")
+	dir := fs.String("dir", "", "plugins directory")
+	run := fs.String("run", "", "editor tool to run on the level file given")
+	out := fs.String("out", "", "file the edited level is written to (default the level file)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt plugin [flags]
+       stt plugin -run TOOL [flags] LEVEL [ARG...]
+
+Lists the plugins of the plugins directory, each executable in it, and
+the generators, analysis passes and editor tools they provide. The
+config's generatorPlugin names a generator to build levels with, and
+their passes are run by stt analyze like the built-in ones. -run runs
+an editor tool on a level file, with the arguments after it, and writes
+the level back once it validates, so stt edit syncs it.
+
+Plugins are started with $%s set and answer JSON-RPC on their stdin
+and stdout; see the plugins package.
+
+`, plugins.Env)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*run == "") != (fs.NArg() == 0) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	if *dir == "" {
+		*dir = config.PluginsDir
+	}
+	h, err := plugins.Open(*dir)
+	if err != nil {
+		cli.Fail(err)
+	}
+	defer h.Close()
+	for _, f := range h.Failures {
+		cli.Warnf("plugin %s: %v", f.Path, f.Err)
+	}
+
+	if *run == "" {
+		list(h, *dir)
+		return
+	}
+	if *out == "" {
+		*out = fs.Arg(0)
+	}
+	if err := edit(h, *run, fs.Arg(0), *out, fs.Args()[1:]); err != nil {
+		h.Close()
+		cli.Fail(err)
+	}
+}
+
+// list prints the plugins and their tools
+func list(h *plugins.Host, dir string) {
+	if len(h.Plugins) == 0 {
+		fmt.Printf("no plugins in %s\n", dir)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PLUGIN\tVERSION\tKIND\tTOOL\tSUMMARY")
+	for _, c := range h.Plugins {
+		name := fmt.Sprintf("%s (%s)", c.Manifest.Name, filepath.Base(c.Path))
+		if len(c.Manifest.Tools) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t\n", name, c.Manifest.Version)
+		}
+		for _, t := range c.Manifest.Tools {
+			summary := t.Summary
+			if len(t.Requires) > 0 {
+				summary = fmt.Sprintf("%s (needs %v)", summary, t.Requires)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, c.Manifest.Version, t.Kind, t.Name, summary)
+		}
+	}
+	w.Flush()
+}
+
+// edit runs an editor tool on the level at path, writing it to out
+func edit(h *plugins.Host, tool, path, out string, args []string) error {
+	c, _, ok := h.Find(plugins.KindEditor, tool)
+	if !ok {
+		return fmt.Errorf("no plugin editor tool %q", tool)
+	}
+	lvl, err := level.Load(path)
+	if err != nil {
+		return err
+	}
+	defer crash.Open(filepath.Base(path), lvl.Marshal)()
+	edited, err := c.Edit(context.Background(), plugins.EditArgs{Tool: tool, Level: lvl, Args: args})
+	if err != nil {
+		return fmt.Errorf("%s: %w", tool, err)
+	}
+	if err := edited.Validate(); err != nil {
+		return fmt.Errorf("%s left the level invalid: %w", tool, err)
+	}
+	if err := edited.Save(out); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s ran, wrote %s\n", path, tool, out)
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package probe is stt probe, which measures the round trip to the game
+// server regions
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/netprobe"
+)
+
+// Main runs stt probe with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("probe"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its probeRegions are probed")
+	from := fs.String("from", "", "region this machine plays from, as the matchmaking simulator names it; needed for stt matchsim -latency")
+	count := fs.Int("count", netprobe.DefaultCount, "pings a region")
+	interval := fs.Duration("interval", netprobe.DefaultInterval, "between a region's pings")
+	timeout := fs.Duration("timeout", netprobe.DefaultTimeout, "for a connection, and for a ping's answer before it counts as lost")
+	out := fs.String("out", "", "write the report as JSON to this file, for stt matchsim -latency")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt probe [flags] [NAME=URL...]
+
+Measures the round trip and jitter from this machine to each game server
+region of the config's probeRegions, and the regions given as arguments,
+over the WebSocket transport the game plays over rather than ICMP: the
+handshake, then pings its connection carries like game messages. A
+relay's ws://HOST:8097/ping answers them, as does any WebSocket server.
+
+Probing from each region with -from and -out gives the reports stt
+matchsim -latency reads to simulate matches with the latency between
+regions. The token of %s, if set, is presented to the regions.
+
+`, auth.TokenEnv)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *count <= 0 || *interval <= 0 || *timeout <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	var targets []netprobe.Target
+	for _, r := range config.ProbeRegions {
+		targets = append(targets, netprobe.Target{Name: r.Name, URL: r.URL})
+	}
+	for _, arg := range fs.Args() {
+		name, u, ok := strings.Cut(arg, "=")
+		if !ok || name == "" || u == "" {
+			cli.Fail(fmt.Errorf("region %q is not NAME=URL", arg))
+		}
+		targets = append(targets, netprobe.Target{Name: name, URL: u})
+	}
+	if len(targets) == 0 {
+		cli.Fail(fmt.Errorf("no regions to probe: set the config's probeRegions or pass NAME=URL"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	rep := netprobe.Run(ctx, *from, targets, netprobe.Options{Count: *count, Interval: *interval, Timeout: *timeout,
+		Token: os.Getenv(auth.TokenEnv)})
+	if *out != "" {
+		if err := rep.Save(*out); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+	} else {
+		printReport(rep)
+		if *out != "" {
+			fmt.Println("\nreport written to", *out)
+		}
+	}
+	for _, r := range rep.Regions {
+		if r.Received > 0 {
+			return
+		}
+	}
+	os.Exit(1)
+}
+
+func printReport(rep netprobe.Report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REGION\tCONNECT\tMIN\tP50\tP90\tP99\tJITTER\tLOSS\tERROR")
+	for _, r := range rep.Regions {
+		if r.Received == 0 {
+			loss := "-"
+			if r.Sent > 0 {
+				loss = "100%"
+			}
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\t-\t%s\t%s\n", r.Region, loss, r.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.0f%%\t%s\n", r.Region, r.ConnectMs, r.MinMs,
+			r.P50Ms, r.P90Ms, r.P99Ms, r.JitterMs, 100*r.Loss, r.Error)
+	}
+	w.Flush()
+}
@@ -0,0 +1,111 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// allocs reports allocation per tick by call site:
+// profile allocs [flags] session|allocticks.jsonl
+func allocs(args []string) {
+	defaults := profiler.DefaultAllocTickOptions()
+	fs := flag.NewFlagSet("allocs", flag.ExitOnError)
+	loop := fs.String("loop", "", "comma-separated function name parts of the simulation loop, such as Simulator.Step")
+	steady := fs.Float64("steady", defaults.SteadyShare, "share of intervals a site must allocate in to be steady")
+	top := fs.Int("top", defaults.Top, "sites listed")
+	baseline := fs.String("baseline", "", "a baseline session or allocation log to compare per-tick allocation against")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile allocs [flags] session|allocticks.jsonl
+
+Reports what each call site allocated per tick once a run warmed up, from
+the allocticks log a session with profileAllocInterval writes, and marks
+the sites allocating in nearly every interval: the steady allocation that
+keeps the collector busy.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *top < 0 || *steady <= 0 || *steady > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	opts := profiler.AllocTickOptions{SteadyShare: *steady}
+	for _, part := range strings.Split(*loop, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			opts.Loop = append(opts.Loop, part)
+		}
+	}
+
+	samples, err := profiler.LoadAllocSamples(fs.Arg(0))
+	if err != nil {
+		cli.Fail(err)
+	}
+	report := profiler.AnalyzeAllocTicks(samples, opts)
+	var d *profiler.AllocTickDiff
+	if *baseline != "" {
+		samples, err := profiler.LoadAllocSamples(*baseline)
+		if err != nil {
+			cli.Fail(err)
+		}
+		diff := profiler.DiffAllocTicks(profiler.AnalyzeAllocTicks(samples, opts), report)
+		if *top > 0 && len(diff.Sites) > *top {
+			diff.Sites = diff.Sites[:*top]
+		}
+		d = &diff
+	}
+	if *top > 0 && len(report.Sites) > *top {
+		report.Sites = report.Sites[:*top]
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			profiler.AllocTickReport
+			Baseline *profiler.AllocTickDiff `json:"baseline,omitempty"`
+		}{report, d}); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+
+	if report.Note != "" {
+		cli.Warn(report.Note)
+	}
+	fmt.Printf("%d ticks over %s: %.0f bytes and %.1f objects a tick, %.2f MiB/s; %.0f bytes a tick steady\n",
+		report.Ticks, ms(report.DurationMs), report.BytesPerTick, report.ObjectsPerTick, report.BytesPerSec/(1<<20), report.SteadyBytes)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "BYTES/TICK\tOBJECTS/TICK\tMIB/S\tSHARE\tACTIVE\tKIND\tSITE\n")
+	for _, s := range report.Sites {
+		mark := ""
+		switch {
+		case s.Steady && s.InLoop:
+			mark = "steady, loop"
+		case s.Steady:
+			mark = "steady"
+		case s.InLoop:
+			mark = "loop"
+		}
+		fmt.Fprintf(tw, "%.0f\t%.1f\t%.2f\t%.1f%%\t%.0f%%\t%s\t%s\n", s.BytesPerTick, s.ObjectsPerTick, s.BytesPerSec/(1<<20),
+			100*s.Share, 100*s.Active, mark, s.Site)
+	}
+	tw.Flush()
+	if d == nil {
+		return
+	}
+	fmt.Printf("\nagainst %s: %.0f to %.0f bytes a tick (%s)\n", *baseline, d.Before, d.After, change(d.Change()))
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "BEFORE\tAFTER\tDELTA\tCHANGE\tSITE\n")
+	for _, s := range d.Sites {
+		fmt.Fprintf(tw, "%.0f\t%.0f\t%+.0f\t%s\t%s\n", s.Before, s.After, s.After-s.Before, change(s.Change()), s.Site)
+	}
+	tw.Flush()
+}
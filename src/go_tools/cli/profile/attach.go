@@ -0,0 +1,87 @@
+package profile
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/discovery"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// attach samples a server's stacks through its profiling agent:
+// profile attach [flags] [agent-url]
+func attach(args []string) {
+	fs := flag.NewFlagSet("attach", flag.ExitOnError)
+	token := fs.String("token", "", "the agent's token (default $"+profiler.AgentTokenEnv+")")
+	duration := fs.Duration("duration", 30*time.Second, "how long to sample, at most 10m")
+	interval := fs.Duration("interval", 10*time.Millisecond, "stack sampling interval")
+	format := fs.String("format", profiler.FormatSVG, "output format: folded, speedscope, svg, chrome-trace, json or binary")
+	out := fs.String("out", "", "output file (default: remote-<time> with the format's extension, - for stdout)")
+	discoveryAddr := fs.String("discovery", discovery.DefaultAddr, "group queried for the agent when no agent-url is given")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile attach [flags] [agent-url]
+
+Samples a running server's stacks through its profiling agent, such as
+ws://host:8090%s on analyze -serve with a profileAgentToken, and
+writes them like a local sample dump. Interrupting keeps what arrived.
+Without an agent-url, the one agent on the local network is found.
+
+`, profiler.AgentPath)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !profiler.ValidFormat(*format) {
+		fmt.Fprintf(os.Stderr, "error: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+	if *token == "" {
+		*token = os.Getenv(profiler.AgentTokenEnv)
+	}
+	if *token == "" {
+		fmt.Fprintf(os.Stderr, "error: no token; pass -token or set %s\n", profiler.AgentTokenEnv)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	agentURL := fs.Arg(0)
+	if agentURL == "" {
+		agentURL = discover(ctx, *discoveryAddr, discovery.KindAgent)
+	}
+	start := time.Now()
+	samples, err := profiler.Attach(ctx, agentURL, profiler.AttachOptions{
+		Token: *token, Duration: *duration, Interval: *interval,
+		OnChunk: func(c profiler.AgentChunk) {
+			fmt.Fprintf(os.Stderr, "\r%s of %s sampled, heap %d MiB, %d goroutines ",
+				time.Since(start).Round(time.Second), *duration, c.Stats.HeapInuse>>20, c.Stats.Goroutines)
+		},
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		if samples == nil {
+			cli.Fail(err)
+		}
+		cli.Warn(err)
+	}
+
+	at := start.Format("20060102-150405")
+	path := *out
+	if path == "" {
+		path = "remote-" + at + profiler.Extension(*format)
+	}
+	if err := writeOutput(path, func(w io.Writer) error {
+		return profiler.WriteSamples(w, samples, *format, agentURL+" "+at)
+	}); err != nil {
+		cli.Fail(err)
+	}
+}
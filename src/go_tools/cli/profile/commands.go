@@ -0,0 +1,62 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// commands reports an editor command log: profile commands [flags] commands.jsonl
+func commands(args []string) {
+	fs := flag.NewFlagSet("commands", flag.ExitOnError)
+	stall := fs.Duration("stall", profiler.DefaultCommandStall, "commands longer than this count as stalls")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: stt profile commands [flags] commands.jsonl\n\nReads one {\"at\":MS,\"command\":C,\"level\":L,\"blocks\":N,\"ms\":MS,\"allocBytes\":B,\"allocs\":N} object\nper line, - for stdin, as the command engine's profiling middleware logs them.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *stall <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r, closer := openInput(fs.Arg(0))
+	events, err := profiler.ReadCommandEvents(r)
+	closer()
+	if err != nil {
+		cli.Fail(fmt.Errorf("%s: %w", fs.Arg(0), err))
+	}
+	report := profiler.AnalyzeCommands(events, *stall)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+
+	fmt.Printf("%d editor commands\n", report.Events)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "COMMAND\tCOUNT\tERRORS\tP50\tP95\tMAX\tALLOC/RUN\tALLOCS/RUN\tPER 1K BLOCKS\tSTALLS\n")
+	for _, c := range report.Commands {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%.1f KiB\t%.0f\t%s\t%d\n", c.Command, c.Count, c.Errors,
+			ms(c.LatencyMs.P50), ms(c.LatencyMs.P95), ms(c.LatencyMs.Max), c.AllocBytes/(1<<10), c.Allocs, ms(c.MsPerKBlocks), c.Stalls)
+	}
+	tw.Flush()
+	if len(report.Slowest) > 0 {
+		fmt.Printf("\nstalls over %s:\n", ms(report.StallMs))
+		tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "AT\tCOMMAND\tTIME\tBLOCKS\tALLOCATED\tLEVEL\n")
+		for _, ev := range report.Slowest {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%.1f MiB\t%s\n", ms(ev.At), ev.Command, ms(ev.Ms), ev.Blocks, float64(ev.AllocBytes)/(1<<20), ev.Level)
+		}
+		tw.Flush()
+	}
+}
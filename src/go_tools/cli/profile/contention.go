@@ -0,0 +1,82 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// contention reports the most contended locks of mutex and block
+// profiles: profile contention [flags] mutex.pb.gz [block.pb.gz]
+func contention(args []string) {
+	fs := flag.NewFlagSet("contention", flag.ExitOnError)
+	top := fs.Int("top", 15, "sites listed per profile")
+	focus := fs.String("focus", "", "comma-separated function name parts, such as websocket,api; only stacks through one count")
+	stacks := fs.Bool("stacks", false, "print each site's heaviest stack")
+	asJSON := fs.Bool("json", false, "print the reports as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: stt profile contention [flags] mutex.pb.gz [block.pb.gz]\n\nRanks where goroutines waited in the mutex and block profiles a session\nwith profileContention writes, or go tool pprof fetches.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || *top < 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var parts []string
+	for _, f := range strings.Split(*focus, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			parts = append(parts, f)
+		}
+	}
+
+	var reports []profiler.ContentionReport
+	for _, path := range fs.Args() {
+		p, err := profiler.LoadProfile(path)
+		if err != nil {
+			cli.Fail(err)
+		}
+		if p.ValueIndex("delay") < 0 {
+			cli.Fail(fmt.Errorf("%s: not a mutex or block profile", path))
+		}
+		name, _, _ := strings.Cut(filepath.Base(path), "-")
+		reports = append(reports, profiler.AnalyzeContention(p, name, parts, *top))
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+
+	for i, r := range reports {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s: %d contentions, %s waited\n", r.Profile, r.Contentions, ms(r.DelayMs))
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "WAITED\tSHARE\tCOUNT\tON\tSITE\n")
+		for _, s := range r.Sites {
+			fmt.Fprintf(tw, "%s\t%.1f%%\t%d\t%s\t%s\n", ms(s.DelayMs), 100*s.Share, s.Contentions, s.Kind, s.Site)
+		}
+		tw.Flush()
+		if !*stacks {
+			continue
+		}
+		for _, s := range r.Sites {
+			fmt.Printf("\n%s:\n", s.Site)
+			for j := len(s.Stack) - 1; j >= 0; j-- {
+				fmt.Printf("  %s\n", s.Stack[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// costs reports what block kinds and spells cost the physics of a step
+// log: profile costs [flags] steps.jsonl
+func costs(args []string) {
+	fs := flag.NewFlagSet("costs", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	minShare := fs.Float64("min-share", 0.05, "leave phases under this share of physics time out of the summary")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: stt profile costs [flags] steps.jsonl\n\nReads a physics step log whose steps carry \"costs\":{\"collision\":{\"block:ice\":MS,...}}, - for stdin.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r, closer := openInput(fs.Arg(0))
+	defer closer()
+	steps, err := profiler.ReadPhysicsSteps(r)
+	if err != nil {
+		cli.Fail(fmt.Errorf("%s: %w", fs.Arg(0), err))
+	}
+	report := profiler.AnalyzeCosts(steps)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+	if len(report.Entities) == 0 {
+		cli.Warn("no step in the log attributes costs to block kinds or spells")
+	}
+	for _, line := range report.Headlines(*minShare) {
+		fmt.Println(line)
+	}
+	fmt.Println()
+
+	phases := report.PhaseOrder()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "ENTITY\tSTEPS\tTOTAL\tSHARE")
+	for _, phase := range phases {
+		fmt.Fprintf(tw, "\t%s", phase)
+	}
+	fmt.Fprintln(tw)
+	for _, e := range report.Entities {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.1f%%", e.Entity, e.Steps, ms(e.TotalMs), 100*e.Share)
+		for _, phase := range phases {
+			fmt.Fprintf(tw, "\t%.1f%%", 100*e.Shares[phase])
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprint(tw, "untagged\t\t\t")
+	for _, phase := range phases {
+		share := 0.0
+		if report.PhaseMs[phase] > 0 {
+			share = report.UntaggedMs[phase] / report.PhaseMs[phase]
+		}
+		fmt.Fprintf(tw, "\t%.1f%%", 100*share)
+	}
+	fmt.Fprintln(tw)
+	tw.Flush()
+}
@@ -0,0 +1,99 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// diff compares two profiling sessions as a perf gate:
+// profile diff [flags] before after
+func diff(args []string) {
+	defaults := profiler.DefaultDiffOptions()
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	threshold := fs.Float64("threshold", defaults.Threshold, "relative growth that counts as a regression, 0.1 for 10%")
+	minShare := fs.Float64("min-share", defaults.MinShare, "leave out functions and allocation sites under this share of both sessions")
+	budget := fs.Duration("budget", profiler.DefaultFrameBudget, "frame budget the sessions' frame times are judged against")
+	all := fs.Bool("all", false, "list every compared measurement, not just those past the threshold")
+	asJSON := fs.Bool("json", false, "print the diff as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile diff [flags] before after
+
+Compares CPU hot spots, allocation sites and frame time percentiles of two
+session bundles or -profile directories, and exits 1 when anything
+regressed past the threshold.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 || *threshold < 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	before, err := profiler.LoadSessionProfiles(fs.Arg(0), *budget)
+	if err != nil {
+		cli.Fail(err)
+	}
+	after, err := profiler.LoadSessionProfiles(fs.Arg(1), *budget)
+	if err != nil {
+		cli.Fail(err)
+	}
+	d := profiler.DiffProfiles(before, after, profiler.DiffOptions{Threshold: *threshold, MinShare: *minShare})
+	for _, metric := range d.Skipped {
+		cli.Warnf("only one session has %s profiles; not compared", metric)
+	}
+	regressions := d.Regressions()
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d); err != nil {
+			cli.Fail(err)
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "METRIC\tNAME\tBEFORE\tAFTER\tCHANGE\t\n")
+		for _, c := range d.Changes {
+			if !*all && math.Abs(c.Delta()) <= *threshold {
+				continue
+			}
+			mark := ""
+			if c.Regression {
+				mark = "REGRESSION"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Metric, c.Name, amount(c.Before, c.Unit), amount(c.After, c.Unit), change(c.Delta()), mark)
+		}
+		tw.Flush()
+		fmt.Printf("\n%d regressions past %.0f%%\n", len(regressions), 100**threshold)
+	}
+	if len(regressions) > 0 {
+		os.Exit(1)
+	}
+}
+
+func amount(v float64, unit string) string {
+	switch unit {
+	case "%":
+		return fmt.Sprintf("%.1f%%", v)
+	case "bytes":
+		return fmt.Sprintf("%.1f MiB", v/(1<<20))
+	case "ms":
+		return ms(v)
+	}
+	return fmt.Sprint(v)
+}
+
+func change(delta float64) string {
+	if math.IsInf(delta, 1) {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", 100*delta)
+}
@@ -0,0 +1,117 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// frames reports a frame timing log: profile frames [flags] frames.jsonl.
+// With -gc it exits 1 when collection pauses alone miss the budget.
+func frames(args []string) {
+	fs := flag.NewFlagSet("frames", flag.ExitOnError)
+	budget := fs.Duration("budget", profiler.DefaultFrameBudget, "frame budget; longer frames miss it")
+	timeline := fs.String("timeline", "", "also write a per-frame CSV timeline here (- for stdout)")
+	gcLog := fs.String("gc", "", "GC pause log of the same run, such as a session's gc-*.jsonl, to match pauses with stutters")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: stt profile frames [flags] frames.jsonl\n\nReads one {\"frame\":N,\"at\":MS,\"ms\":MS} object per line, - for stdin.\nWith -gc, exits 1 when a collection pause is longer than the budget.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *budget <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r, closer := openInput(fs.Arg(0))
+	defer closer()
+	times, err := profiler.ReadFrameTimes(r)
+	if err != nil {
+		cli.Fail(fmt.Errorf("%s: %w", fs.Arg(0), err))
+	}
+	report := profiler.AnalyzeFrames(times, *budget)
+	var pauses []profiler.GCPause
+	var gc *profiler.GCReport
+	if *gcLog != "" {
+		r, closer := openInput(*gcLog)
+		pauses, err = profiler.ReadGCPauses(r)
+		closer()
+		if err != nil {
+			cli.Fail(fmt.Errorf("%s: %w", *gcLog, err))
+		}
+		g := profiler.AnalyzeGC(times, pauses, *budget)
+		gc = &g
+	}
+	if *timeline != "" {
+		if err := writeOutput(*timeline, func(w io.Writer) error {
+			if gc != nil {
+				return profiler.WriteGCTimeline(w, times, report, pauses)
+			}
+			return profiler.WriteTimeline(w, times, report)
+		}); err != nil {
+			cli.Fail(err)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		out := struct {
+			profiler.FrameReport
+			GC *profiler.GCReport `json:"gc,omitempty"`
+		}{report, gc}
+		if err := enc.Encode(out); err != nil {
+			cli.Fail(err)
+		}
+		if gc != nil && gc.Flagged() {
+			os.Exit(1)
+		}
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "FRAMES\tBUDGET\tMEAN\tP50\tP95\tP99\tWORST\tOVER BUDGET\tSTUTTERS\n")
+	fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s (frame %d)\t%d\t%d (%.2f%%)\n",
+		report.Frames, ms(report.BudgetMs), ms(report.MeanMs), ms(report.P50Ms), ms(report.P95Ms), ms(report.P99Ms),
+		ms(report.WorstMs), report.WorstFrame, report.OverBudget, report.Stutters, 100*report.StutterRate())
+	tw.Flush()
+	if gc == nil {
+		return
+	}
+	fmt.Println()
+	printGC(*gc)
+	if gc.Flagged() {
+		fmt.Printf("\n%d of %d GC pauses are longer than the %s frame budget\n", gc.OverBudget, gc.Pauses, ms(gc.BudgetMs))
+		os.Exit(1)
+	}
+}
+
+func printGC(gc profiler.GCReport) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "GC PAUSES	PER SECOND	TOTAL	MEAN	P95	MAX	OVER BUDGET	STUTTERS FROM GC\n")
+	fmt.Fprintf(tw, "%d	%.2f	%s	%s	%s	%s	%d	%d of %d (%.0f%%)\n",
+		gc.Pauses, gc.PerSecond, ms(gc.TotalMs), ms(gc.MeanMs), ms(gc.P95Ms), ms(gc.MaxMs),
+		gc.OverBudget, len(gc.Spikes), gc.Stutters, 100*gc.SpikeShare())
+	tw.Flush()
+	if len(gc.Spikes) == 0 {
+		return
+	}
+	fmt.Println()
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "FRAME	TIME	PAUSED\n")
+	for _, s := range gc.Spikes {
+		fmt.Fprintf(tw, "%d	%s	%s\n", s.Frame, ms(s.Ms), ms(s.GCMs))
+	}
+	tw.Flush()
+}
+
+func ms(v float64) string {
+	return time.Duration(v * float64(time.Millisecond)).Round(10 * time.Microsecond).String()
+}
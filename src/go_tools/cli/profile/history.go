@@ -0,0 +1,109 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// history looks back at continuous profiles: profile history [flags] dir
+func history(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	since := fs.Duration("since", 24*time.Hour, "look back this far from now, unless -from is given")
+	fromFlag := fs.String("from", "", "period start, as 2006-01-02 or 2006-01-02T15:04 local time")
+	toFlag := fs.String("to", "", "period end (default: a day after -from, or now)")
+	top := fs.Int("top", 15, "hottest functions to list")
+	out := fs.String("out", "", "also write the period's merged stacks here, for flamegraphs (- for stdout)")
+	format := fs.String("format", profiler.FormatSVG, "-out format: folded, speedscope, svg or json")
+	asJSON := fs.Bool("json", false, "print the history as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: stt profile history [flags] dir\n\nReads the captures and hourly rollups continuous profiling keeps in dir,\nsuch as data/profiles/continuous.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || !profiler.ValidFormat(*format) {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	to, from := time.Now(), time.Now().Add(-*since)
+	if *fromFlag != "" {
+		var err error
+		if from, err = parseWhen(*fromFlag); err != nil {
+			cli.Fail(err)
+		}
+		to = from.Add(24 * time.Hour)
+	}
+	if *toFlag != "" {
+		var err error
+		if to, err = parseWhen(*toFlag); err != nil {
+			cli.Fail(err)
+		}
+	}
+	h, err := profiler.LoadHistory(fs.Arg(0), from, to)
+	if err != nil {
+		cli.Fail(err)
+	}
+	if h.Captures == 0 {
+		cli.Warnf("no continuous profiles in %s between %s and %s",
+			fs.Arg(0), from.Format(time.DateTime), to.Format(time.DateTime))
+	}
+	if *out != "" {
+		if err := writeOutput(*out, func(w io.Writer) error {
+			return profiler.WriteSamples(w, h.Samples, *format, "continuous "+from.Format(time.DateTime)+" to "+to.Format(time.DateTime))
+		}); err != nil {
+			cli.Fail(err)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(h); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+	if h.Captures == 0 {
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "AT\tCAPTURES\tSAMPLED\tPEAK HEAP\tOBJECTS\tGOROUTINES\n")
+	for _, p := range h.Points {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.1f MiB\t%d\t%d\n", p.At.Local().Format(time.DateTime), p.Captures,
+			p.Window.Round(time.Second), float64(p.Stats.HeapInuse)/(1<<20), p.Stats.HeapObjects, p.Stats.Goroutines)
+	}
+	tw.Flush()
+
+	total := h.Samples.Weight()
+	if total == 0 {
+		return
+	}
+	fmt.Println()
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "FUNCTION\tSELF\tTOTAL\n")
+	for i, f := range h.Samples.Functions() {
+		if i == *top {
+			break
+		}
+		fmt.Fprintf(tw, "%s\t%.1f%%\t%.1f%%\n", f.Function, 100*float64(f.Self)/float64(total), 100*float64(f.Total)/float64(total))
+	}
+	tw.Flush()
+}
+
+// parseWhen reads a date or a date and time, in local time
+func parseWhen(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't read %q as a date or date and time", s)
+}
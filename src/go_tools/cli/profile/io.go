@@ -0,0 +1,88 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// diskIO reports a disk operation log: profile io [flags] io.jsonl
+func diskIO(args []string) {
+	fs := flag.NewFlagSet("io", flag.ExitOnError)
+	hitch := fs.Duration("hitch", profiler.DefaultFrameBudget, "operations longer than this count as hitches")
+	framesLog := fs.String("frames", "", "frame timings on the same clock, to find the stutters disk operations explain")
+	budget := fs.Duration("budget", profiler.DefaultFrameBudget, "frame budget for -frames")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: stt profile io [flags] io.jsonl\n\nReads one {\"at\":MS,\"op\":OP,\"path\":P,\"bytes\":N,\"ms\":MS} object per line, - for stdin,\nsuch as a profiled run's io-<time>.jsonl or the editor's autosave log.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *hitch <= 0 || *budget <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r, closer := openInput(fs.Arg(0))
+	events, err := profiler.ReadIOEvents(r)
+	closer()
+	if err != nil {
+		cli.Fail(fmt.Errorf("%s: %w", fs.Arg(0), err))
+	}
+	var frames []profiler.FrameTime
+	if *framesLog != "" {
+		r, closer := openInput(*framesLog)
+		frames, err = profiler.ReadFrameTimes(r)
+		closer()
+		if err != nil {
+			cli.Fail(fmt.Errorf("%s: %w", *framesLog, err))
+		}
+	}
+	report := profiler.AnalyzeIO(events, *hitch, frames, *budget)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+
+	fmt.Printf("%d disk operations over %s, %d bytes\n", report.Events, ms(report.DurationMs), report.Bytes)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "OP\tCOUNT\tERRORS\tBYTES\tP50\tP95\tMAX\tMIB/S\tHITCHES\tEVERY\n")
+	for _, op := range report.Ops {
+		every := "-"
+		if op.IntervalMs > 0 {
+			every = ms(op.IntervalMs)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%.1f\t%d\t%s\n", op.Op, op.Count, op.Errors, op.Bytes,
+			ms(op.LatencyMs.P50), ms(op.LatencyMs.P95), ms(op.LatencyMs.Max), op.MiBps, op.Hitches, every)
+	}
+	tw.Flush()
+	if len(report.Slowest) > 0 {
+		fmt.Printf("\nslowest operations over %s:\n", ms(report.HitchMs))
+		tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "AT\tOP\tTIME\tBYTES\tPATH\n")
+		for _, ev := range report.Slowest {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", ms(ev.At), ev.Op, ms(ev.Ms), ev.Bytes, ev.Path)
+		}
+		tw.Flush()
+	}
+	if *framesLog != "" {
+		fmt.Printf("\n%d stutters overlapped by disk operations\n", len(report.Stutters))
+		if len(report.Stutters) > 0 {
+			tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(tw, "FRAME\tTIME\tOP\tOVERLAP\tPATH\n")
+			for _, s := range report.Stutters {
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", s.Frame, ms(s.Ms), s.Op, ms(s.OverlapMs), s.Path)
+			}
+			tw.Flush()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// latency reports the latency histograms of one or more sessions, merged:
+// profile latency [flags] session|latency.json...
+func latency(args []string) {
+	fs := flag.NewFlagSet("latency", flag.ExitOnError)
+	out := fs.String("out", "", "also write the merged histograms here, to merge again later (- for stdout)")
+	asJSON := fs.Bool("json", false, "print the percentiles as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile latency [flags] session|latency.json...
+
+Reads the tick time, round trip and input latency histograms sessions
+recorded and merges them, so the percentiles are of every session's
+samples together rather than an average of each session's.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	merged := make(profiler.Latencies)
+	for _, path := range fs.Args() {
+		l, err := profiler.LoadLatencies(path)
+		if err != nil {
+			cli.Fail(err)
+		}
+		merged.Merge(l)
+	}
+	if *out != "" {
+		if err := writeOutput(*out, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(merged)
+		}); err != nil {
+			cli.Fail(err)
+		}
+	}
+	summaries := merged.Summaries()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summaries); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+
+	fmt.Printf("latency of %d sessions\n", fs.NArg())
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "LATENCY\tCOUNT\tMEAN\tP50\tP90\tP99\tP99.9\tMAX\n")
+	for _, s := range summaries {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Kind, s.Count, ms(s.MeanMs), ms(s.P50Ms), ms(s.P90Ms), ms(s.P99Ms), ms(s.P999Ms), ms(s.MaxMs))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,125 @@
+package profile
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/discovery"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/loadtest"
+)
+
+// load plays headless bots against a relay: profile load [flags] [relay-url]
+func load(args []string) {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	bots := fs.Int("bots", loadtest.DefaultBots, "bot clients to connect")
+	roomSize := fs.Int("room-size", loadtest.DefaultRoomSize, "bots a room")
+	duration := fs.Duration("duration", loadtest.DefaultDuration, "of the matches")
+	ramp := fs.Duration("ramp", 0, "spread the rooms joining over this long (0 joins them at once)")
+	pieceInterval := fs.Duration("piece-interval", loadtest.DefaultPieceInterval, "between a bot's pieces; a player places one every half second or so")
+	healthInterval := fs.Duration("health-interval", loadtest.DefaultHealthInterval, "between reads of the relay's health")
+	levelPath := fs.String("level", "", "level file the bots play (default: an empty 10x20 board)")
+	seed := fs.Uint64("seed", 1, "seed of the bots' pieces")
+	out := fs.String("out", "", "also write the latency histograms here, for profile latency (- for stdout)")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	discoveryAddr := fs.String("discovery", discovery.DefaultAddr, "group queried for the relay when no relay-url is given")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile load [flags] [relay-url]
+
+Load tests a relay, such as http://host:8097, with -bots headless
+clients: they join rooms of -room-size, get ready, and once the host
+starts each match play the analyzer's greedy bot for -duration, sending
+their inputs and locks as game messages. Reports the bots that couldn't
+connect or were cut off, connect and delivery latency, and the relay's
+tick lag and slow peers dropped from its /health, for capacity planning.
+Exits 1 if any bot failed to play its match through. The token of %s,
+if set, is presented to the relay. Without a relay-url, the one relay on
+the local network is found.
+
+`, auth.TokenEnv)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 || *bots < 2 || *roomSize < 2 || *duration <= 0 || *pieceInterval <= 0 || *healthInterval <= 0 || *ramp < 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	opts := loadtest.Options{Bots: *bots, RoomSize: *roomSize, Duration: *duration, Ramp: *ramp,
+		PieceInterval: *pieceInterval, HealthInterval: *healthInterval, Seed: *seed}
+	if *levelPath != "" {
+		lvl, err := level.Load(*levelPath)
+		if err != nil {
+			cli.Fail(err)
+		}
+		opts.Level = lvl
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	relayURL := fs.Arg(0)
+	if relayURL == "" {
+		relayURL = discover(ctx, *discoveryAddr, discovery.KindRelay)
+	}
+	rep, err := loadtest.Run(ctx, relayURL, opts)
+	if err != nil {
+		cli.Fail(err)
+	}
+	if *out != "" {
+		if err := writeOutput(*out, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(rep.Histograms)
+		}); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			cli.Fail(err)
+		}
+	} else {
+		printLoad(rep)
+	}
+	if rep.Failed() {
+		os.Exit(1)
+	}
+}
+
+func printLoad(rep loadtest.Report) {
+	fmt.Printf("%d of %d bots played in %d rooms over %s: %d pieces, %d top-outs\n",
+		rep.Playing, rep.Bots, rep.Rooms, ms(rep.DurationMs), rep.Pieces, rep.TopOuts)
+	fmt.Printf("%d game messages sent, %d copies delivered, %d lost\n", rep.Sent, rep.Delivered, rep.Lost)
+	s := rep.Server
+	if s.Samples > 0 {
+		fmt.Printf("relay: peak %d peers in %d rooms, %d dropped as too slow, tick lag p99 %s max %s\n",
+			s.PeersPeak, s.RoomsPeak, s.Dropped, ms(s.TickLagP99Ms), ms(s.TickLagMaxMs))
+	} else {
+		fmt.Println("relay: no health read")
+	}
+	if len(rep.Latencies) > 0 {
+		fmt.Println()
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "LATENCY\tCOUNT\tMEAN\tP50\tP90\tP99\tP99.9\tMAX\n")
+		for _, l := range rep.Latencies {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", l.Kind, l.Count, ms(l.MeanMs), ms(l.P50Ms), ms(l.P90Ms), ms(l.P99Ms), ms(l.P999Ms), ms(l.MaxMs))
+		}
+		tw.Flush()
+	}
+	if len(rep.Errors) > 0 {
+		fmt.Println()
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "ERROR\tCOUNT\tFIRST\n")
+		for _, e := range rep.Errors {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", e.Kind, e.Count, e.Example)
+		}
+		tw.Flush()
+	}
+}
@@ -0,0 +1,166 @@
+// Package profile is stt profile, which converts profiler samples and
+// reports on timing logs and profiling sessions
+package profile
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/discovery"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// subcommands report timing logs and continuous profiles rather than
+// convert samples
+var subcommands = map[string]func(args []string){
+	"frames":     frames,
+	"physics":    physics,
+	"costs":      costs,
+	"network":    network,
+	"io":         diskIO,
+	"contention": contention,
+	"allocs":     allocs,
+	"commands":   commands,
+	"latency":    latency,
+	"replay":     replayRun,
+	"load":       load,
+	"history":    history,
+	"diff":       diff,
+	"report":     report,
+	"merge":      merge,
+	"serve":      serve,
+	"attach":     attach,
+	"watch":      watch,
+}
+
+// Main runs stt profile with the arguments after the subcommand
+func Main(args []string) {
+	if len(args) > 0 {
+		if sub, ok := subcommands[args[0]]; ok {
+			sub(args[1:])
+			return
+		}
+	}
+	fs := flag.NewFlagSet(cli.Name("profile"), flag.ExitOnError)
+	format := fs.String("format", profiler.FormatSVG, "output format: folded, speedscope, svg, chrome-trace, json or binary")
+	out := fs.String("out", "", "output file (default: the input with the format's extension, - for stdout)")
+	title := fs.String("title", "", "profile name shown by speedscope and the flamegraph (default: the input file name)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile [flags] samples.json|samples.bin
+       stt profile frames [flags] frames.jsonl
+       stt profile physics [flags] steps.jsonl
+       stt profile costs [flags] steps.jsonl
+       stt profile network [flags] messages.jsonl
+       stt profile io [flags] io.jsonl
+       stt profile contention [flags] mutex.pb.gz [block.pb.gz]
+       stt profile allocs [flags] session|allocticks.jsonl
+       stt profile commands [flags] commands.jsonl
+       stt profile latency [flags] session|latency.json...
+       stt profile replay [flags] replay.json
+       stt profile load [flags] [relay-url]
+       stt profile history [flags] dir
+       stt profile diff [flags] before after
+       stt profile report [flags] dir
+       stt profile merge [flags] client.trace.json server.trace.json handshakes.jsonl
+       stt profile serve [flags] metrics-url
+       stt profile attach [flags] [agent-url]
+       stt profile watch [flags] pid|addr
+
+Converts a profiler sample dump, JSON or binary, for flamegraph tooling,
+or between the two with -format json or binary. frames reports
+frame time percentiles and stutters of a timing log, physics where
+physics steps spend their time per level and block count, costs which
+block kinds and spells that time goes to, and network traffic,
+serialization time and round trips per message type. io reports the
+latency and throughput of level loads, autosaves and replay writes, and
+the stutters they line up with, and contention the most contended locks
+of a session's mutex and block profiles. allocs reports allocation per
+tick by call site, marking the simulation loop's steady allocation, and
+its change from a baseline session; commands which editor commands stall
+and how their time grows with the level. latency merges sessions' tick
+time, round trip and input latency histograms into one set of
+percentiles. replay profiles a recorded replay through the headless
+simulator, the same work on every build, so its sessions are the ones to
+diff. load plays headless bots against a relay and reports their
+connection errors and latency and the relay's tick health. history
+looks back at what continuous profiling captured over a period, and diff
+flags performance regressions between two profiling sessions, and report
+renders one as an HTML page for a perf ticket. merge lines up the chrome
+traces of a match's client and server on one clock. serve hosts
+a live dashboard of a process's profiler metrics for playtests,
+attach samples a remote server's stacks through its profiling agent, and
+watch shows a process's hot spots and tick times live in the terminal.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !profiler.ValidFormat(*format) {
+		fmt.Fprintf(os.Stderr, "error: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	in := fs.Arg(0)
+	samples, err := profiler.LoadSamples(in)
+	if err != nil {
+		cli.Fail(err)
+	}
+	name := *title
+	if name == "" {
+		name = filepath.Base(in)
+	}
+	path := *out
+	if path == "" {
+		path = strings.TrimSuffix(in, filepath.Ext(in)) + profiler.Extension(*format)
+		if path == in {
+			fmt.Fprintln(os.Stderr, "error: output would overwrite the input; pass -out")
+			os.Exit(2)
+		}
+	}
+	if err := writeOutput(path, func(w io.Writer) error {
+		return profiler.WriteSamples(w, samples, *format, name)
+	}); err != nil {
+		cli.Fail(err)
+	}
+}
+
+// discover finds the one service of kind on the local network, for a URL
+// argument left out
+func discover(ctx context.Context, addr, kind string) string {
+	f, err := discovery.Find(ctx, addr, kind, "")
+	if err != nil {
+		cli.Fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "found %s %q on %s at %s\n", kind, f.Name, f.Host, f.URL)
+	return f.URL
+}
+
+// writeOutput writes to path, or stdout for -, and reports the file written
+func writeOutput(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "wrote", path)
+	return nil
+}
@@ -0,0 +1,71 @@
+package profile
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// merge lines up the traces of a match's processes:
+// profile merge [flags] client.trace.json server.trace.json handshakes.jsonl ...
+func merge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("out", "merged.trace.json", "merged trace to write, - for stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile merge [flags] client.trace.json server.trace.json handshakes.jsonl [server.trace.json handshakes.jsonl ...]
+
+Merges chrome traces of the client and servers of one match onto the
+client's clock. Each server's clock offset is estimated from the
+client's handshakes with it, one {"clientSend":MS,"serverReceive":MS,
+"serverSend":MS,"clientReceive":MS} object per line in Unix milliseconds.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 3 || fs.NArg()%2 == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	inputs := []profiler.MergeInput{{Name: traceName(fs.Arg(0)), Trace: readTrace(fs.Arg(0))}}
+	for i := 1; i < fs.NArg(); i += 2 {
+		r, closer := openInput(fs.Arg(i + 1))
+		handshakes, err := profiler.ReadHandshakes(r)
+		closer()
+		if err != nil {
+			cli.Fail(fmt.Errorf("%s: %w", fs.Arg(i+1), err))
+		}
+		offset, err := profiler.EstimateClockOffset(handshakes)
+		if err != nil {
+			cli.Fail(fmt.Errorf("%s: %w", fs.Arg(i+1), err))
+		}
+		fmt.Fprintf(os.Stderr, "%s: clock %+.3fms from %s, within %.3fms (fastest of %d handshakes: %.3fms)\n",
+			fs.Arg(i), offset.OffsetMs, fs.Arg(0), offset.UncertaintyMs, offset.Handshakes, offset.RTTMs)
+		inputs = append(inputs, profiler.MergeInput{Name: traceName(fs.Arg(i)), Trace: readTrace(fs.Arg(i)), Offset: offset})
+	}
+	if err := writeOutput(*out, func(w io.Writer) error { return profiler.MergeTraces(w, inputs) }); err != nil {
+		cli.Fail(err)
+	}
+}
+
+func readTrace(path string) *profiler.ChromeTrace {
+	r, closer := openInput(path)
+	defer closer()
+	t, err := profiler.ReadChromeTrace(r)
+	if err != nil {
+		cli.Fail(fmt.Errorf("%s: %w", path, err))
+	}
+	return t
+}
+
+// traceName names a process after its trace file
+func traceName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), profiler.Extension(profiler.FormatChromeTrace))
+}
@@ -0,0 +1,80 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// network reports a message log: profile network [flags] messages.jsonl
+func network(args []string) {
+	fs := flag.NewFlagSet("network", flag.ExitOnError)
+	series := fs.String("series", "", "also write a per-type CSV time series here (- for stdout)")
+	bucket := fs.Duration("bucket", time.Second, "time series bucket width")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: stt profile network [flags] messages.jsonl\n\nReads one {\"at\":MS,\"type\":T,\"dir\":\"in|out\",\"bytes\":N,\"serializeMs\":MS,\"rttMs\":MS} object per line, - for stdin.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *bucket <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r, closer := openInput(fs.Arg(0))
+	defer closer()
+	events, err := profiler.ReadNetworkEvents(r)
+	if err != nil {
+		cli.Fail(fmt.Errorf("%s: %w", fs.Arg(0), err))
+	}
+	if *series != "" {
+		if err := writeOutput(*series, func(w io.Writer) error {
+			return profiler.WriteNetworkSeries(w, profiler.NetworkSeries(events, *bucket))
+		}); err != nil {
+			cli.Fail(err)
+		}
+	}
+	report := profiler.AnalyzeNetwork(events)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+
+	seconds := report.DurationMs / 1000
+	fmt.Printf("%d messages over %s, %d bytes in, %d bytes out", report.Messages, ms(report.DurationMs), report.BytesIn, report.BytesOut)
+	if seconds > 0 {
+		fmt.Printf(" (%.0f B/s)", float64(report.BytesIn+report.BytesOut)/seconds)
+	}
+	if report.RTTMs.Count > 0 {
+		fmt.Printf(", rtt p50 %s p99 %s", ms(report.RTTMs.P50), ms(report.RTTMs.P99))
+	}
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "TYPE\tIN\tOUT\tBYTES IN\tBYTES OUT\tMEAN SIZE\tMAX SIZE\tSERIALIZE P95\tRTT P50\tRTT P95\tRTT P99\n")
+	for _, t := range report.Types {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.0f\t%.0f\t%s\t%s\t%s\t%s\n", t.Type, t.In, t.Out, t.BytesIn, t.BytesOut,
+			t.Size.Mean, t.Size.Max, optionalMs(t.SerializeMs.Count, t.SerializeMs.P95),
+			optionalMs(t.RTTMs.Count, t.RTTMs.P50), optionalMs(t.RTTMs.Count, t.RTTMs.P95), optionalMs(t.RTTMs.Count, t.RTTMs.P99))
+	}
+	tw.Flush()
+}
+
+// optionalMs formats a statistic of count measurements, - without any
+func optionalMs(count int, v float64) string {
+	if count == 0 {
+		return "-"
+	}
+	return ms(v)
+}
@@ -0,0 +1,72 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// physics reports a physics step log: profile physics [flags] steps.jsonl
+func physics(args []string) {
+	fs := flag.NewFlagSet("physics", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: stt profile physics [flags] steps.jsonl\n\nReads one {\"level\":L,\"step\":N,\"blocks\":N,\"phases\":{\"collision\":MS,...}} object per line, - for stdin.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r, closer := openInput(fs.Arg(0))
+	defer closer()
+	steps, err := profiler.ReadPhysicsSteps(r)
+	if err != nil {
+		cli.Fail(fmt.Errorf("%s: %w", fs.Arg(0), err))
+	}
+	report := profiler.AnalyzePhysics(steps)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+	printBreakdowns("LEVEL", report.ByLevel)
+	fmt.Println()
+	printBreakdowns("BLOCKS", report.ByBlocks)
+}
+
+func printBreakdowns(group string, rows []profiler.PhysicsBreakdown) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tSTEPS\tPHASE\tMEAN\tP95\tMAX\tSHARE\n", group)
+	for _, b := range rows {
+		fmt.Fprintf(tw, "%s\t%d\tstep\t%s\t%s\t%s\t\n", b.Group, b.Steps, ms(b.Total.MeanMs), ms(b.Total.P95Ms), ms(b.Total.MaxMs))
+		for _, phase := range b.PhaseOrder() {
+			t := b.Phases[phase]
+			fmt.Fprintf(tw, "\t\t%s\t%s\t%s\t%s\t%.1f%%\n", phase, ms(t.MeanMs), ms(t.P95Ms), ms(t.MaxMs), 100*t.Share)
+		}
+	}
+	tw.Flush()
+}
+
+// openInput opens path, or stdin for -
+func openInput(path string) (io.Reader, func()) {
+	if path == "-" {
+		return os.Stdin, func() {}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		cli.Fail(err)
+	}
+	return f, func() { f.Close() }
+}
@@ -0,0 +1,130 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/notify"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// replayRun profiles a recorded replay through the headless simulator:
+// profile replay [flags] replay.json
+func replayRun(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its profile settings choose what the session captures")
+	levels := fs.String("levels", "", "directory of levels the replay may be played on (default: an empty board of the config's level size)")
+	passes := fs.Int("passes", 5, "profiled passes over the replay")
+	warmup := fs.Int("warmup", 1, "passes before profiling starts")
+	build := fs.String("build", "", "build being profiled, recorded as the session's build label")
+	labels := fs.String("label", "", "comma-separated key=value session labels")
+	name := fs.String("name", "replay", "session name")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile replay [flags] replay.json
+
+Steps a recorded replay through the headless simulator under a profiling
+session, one tick per event, and writes the session bundle under the
+config's profileDir. The replay fixes the workload, so sessions of two
+builds on it compare with profile diff.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *passes <= 0 || *warmup < 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	extra := make(map[string]string)
+	for _, kv := range strings.Split(*labels, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			cli.Fail(fmt.Errorf("label %q is not key=value", kv))
+		}
+		extra[k] = v
+	}
+
+	notifier, err := notify.New(config.Webhooks, config.WebhookArtifactURL)
+	if err != nil {
+		cli.Fail(err)
+	}
+	job := notifier.Start(notify.JobProfile)
+	failRun := func(runErr error) {
+		if err := job.Fail(fmt.Sprintf("profiling %s failed", fs.Arg(0)), runErr); err != nil {
+			cli.Warn(err)
+		}
+		cli.Fail(runErr)
+	}
+
+	r, err := replay.Load(fs.Arg(0))
+	if err != nil {
+		failRun(err)
+	}
+	data := analyzer.NewDataset()
+	if *levels != "" {
+		if err := data.LoadLevels(*levels); err != nil {
+			failRun(err)
+		}
+	}
+	sim := analyzer.NewReplaySimulator(data, level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight})
+	profiler.ConfigureSessions(profiler.Options{
+		CPU:               config.ProfileCPU,
+		Memory:            config.ProfileMemory,
+		Dir:               config.ProfileDir,
+		SampleInterval:    time.Duration(config.ProfilerSamplingRate) * time.Millisecond,
+		SampleFormat:      config.ProfilerOutputFormat,
+		SampleBudget:      config.ProfilerCPUBudget,
+		HeapInterval:      time.Duration(config.ProfileHeapInterval) * time.Second,
+		GoroutineInterval: time.Duration(config.ProfileGoroutineInterval) * time.Second,
+		AllocInterval:     time.Duration(config.ProfileAllocInterval) * time.Second,
+		Contention:        config.ProfileContention,
+		Latency:           profiler.NewLatencyRecorder(),
+	})
+	res, err := profiler.RunReplay(r, sim, profiler.HarnessOptions{Name: *name, Build: *build, Labels: extra, Passes: *passes, Warmup: *warmup})
+	if err != nil {
+		failRun(err)
+	}
+	if sim.Skipped > 0 {
+		cli.Warnf("%d locks of the replay didn't fit its board; is -levels missing its level?", sim.Skipped)
+	}
+	var total time.Duration
+	for _, d := range res.Passes {
+		total += d
+	}
+	job.Field("workload", "%s", res.Workload)
+	job.Field("passes", "%d", len(res.Passes))
+	job.Field("ticks", "%d", res.Ticks)
+	if len(res.Passes) > 0 {
+		job.Field("mean pass", "%s", (total / time.Duration(len(res.Passes))).Round(time.Microsecond))
+	}
+	job.Artifact("session", res.Artifact.Dir)
+	if err := job.Succeed(fmt.Sprintf("profiled %s over %d passes", fs.Arg(0), len(res.Passes))); err != nil {
+		cli.Warn(err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+	fmt.Printf("workload %s: %d events a pass, %d ticks profiled\n", res.Workload, res.Events, res.Ticks)
+	for i, d := range res.Passes {
+		fmt.Printf("  pass %d: %s\n", i+1, d.Round(time.Microsecond))
+	}
+	fmt.Println(res.Artifact.Dir)
+}
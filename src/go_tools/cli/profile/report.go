@@ -0,0 +1,65 @@
+package profile
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// report renders a profiling session as an HTML page for a perf ticket:
+// profile report [flags] dir
+func report(args []string) {
+	defaults := profiler.DefaultReportOptions()
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	out := fs.String("out", "", "HTML file to write (default: report.html in the session directory, - for stdout)")
+	budget := fs.Duration("budget", defaults.FrameBudget, "frame budget frames, GC pauses and disk operations are judged against")
+	top := fs.Int("top", defaults.Top, "hot spots and allocation sites listed")
+	asJSON := fs.Bool("json", false, "print the report as JSON instead")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile report [flags] dir
+
+Renders a session bundle or -profile directory as one self-contained HTML
+page: a summary, the budgets it missed, frame time charts, and the top CPU
+hot spots and allocation sites.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *budget <= 0 || *top <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r, err := profiler.BuildSessionReport(fs.Arg(0), profiler.ReportOptions{FrameBudget: *budget, Top: *top})
+	if err != nil {
+		cli.Fail(err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+	path := *out
+	if path == "" {
+		path = filepath.Join(fs.Arg(0), "report.html")
+	}
+	if path == "-" {
+		if err := r.WriteHTML(os.Stdout); err != nil {
+			cli.Fail(err)
+		}
+		return
+	}
+	if err := r.SaveHTML(path); err != nil {
+		cli.Fail(err)
+	}
+	fmt.Printf("report written to %s, %d budget violations\n", path, len(r.Violations))
+}
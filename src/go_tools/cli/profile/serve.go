@@ -0,0 +1,79 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/ratelimit"
+)
+
+// serve hosts the live dashboard for another process's profiler metrics:
+// profile serve [flags] metrics-url
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; with its authTokensFile, viewers need a token with the profiler scope")
+	addr := fs.String("addr", ":8095", "address to serve the dashboard on")
+	interval := fs.Duration("interval", time.Second, "how often the metrics are scraped and the charts updated")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile serve [flags] metrics-url
+
+Charts tick times, memory, GC and message rates live from a process's
+profiler metrics, such as generate -metrics or analyze -serve -profile
+expose at /metrics. A metrics URL behind a token is scraped with the
+token in %s. The dashboard is served over TLS with the config's
+tlsEnabled.
+
+`, auth.TokenEnv)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *interval <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	keys, err := auth.Load(config.AuthTokensFile)
+	if err != nil {
+		cli.Fail(err)
+	}
+
+	source := profiler.ScrapeSource(fs.Arg(0))
+	if _, err := source(); err != nil {
+		cli.Warn(err)
+	}
+	dash := profiler.NewDashboard(source, *interval)
+	defer dash.Close()
+	srv := &http.Server{Addr: *addr, Handler: crash.Handler(ratelimit.FromConfig(config, keys).Middleware(keys.Middleware(auth.Surface(auth.SurfaceProfiler), dash))), ReadHeaderTimeout: 10 * time.Second}
+
+	tlsConfig, err := certs.Server(config)
+	if err != nil {
+		cli.Fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	done := make(chan error, 1)
+	go func() { done <- certs.ListenAndServe(srv, tlsConfig) }()
+	fmt.Printf("serving the dashboard for %s on %s://%s\n", fs.Arg(0), certs.Scheme(tlsConfig), *addr)
+	select {
+	case err := <-done:
+		if !errors.Is(err, http.ErrServerClosed) {
+			cli.Fail(err)
+		}
+	case <-ctx.Done():
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}
+}
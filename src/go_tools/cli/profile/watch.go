@@ -0,0 +1,205 @@
+package profile
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+)
+
+// watch shows a running process's hot spots and tick times live in the
+// terminal and keeps them as a session: profile watch [flags] pid|addr
+func watch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	token := fs.String("token", "", "the agent's token (default $"+profiler.AgentTokenEnv+"); without one only tick times are shown")
+	agentURL := fs.String("agent", "", "the agent's URL (default: ws://addr"+profiler.AgentPath+")")
+	metricsURL := fs.String("metrics", "", "the metrics URL (default: http://addr/metrics)")
+	interval := fs.Duration("interval", time.Second, "how often the view is redrawn and the metrics scraped")
+	sampling := fs.Duration("sampling", 10*time.Millisecond, "stack sampling interval")
+	top := fs.Int("top", 15, "hot spots shown")
+	dir := fs.String("dir", "data/profiles", "directory the session is written under on exit")
+	name := fs.String("name", "watch", "session name")
+	format := fs.String("format", profiler.FormatJSON, "format of the session's samples: folded, speedscope, svg, chrome-trace, json or binary")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt profile watch [flags] pid|addr
+
+Shows a running process's hottest functions over the last seconds and
+its tick times, memory and goroutines, redrawn in the terminal like top,
+for a quick look without the dashboard. The stacks come from its
+profiling agent at ws://addr%s, the tick times from its metrics at
+http://addr/metrics. A pid is looked up among the local process's
+listening ports, on Linux. Interrupting writes what was seen as a session
+under -dir.
+
+`, profiler.AgentPath)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *interval <= 0 || *top <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !profiler.ValidFormat(*format) {
+		fmt.Fprintf(os.Stderr, "error: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+	if *token == "" {
+		*token = os.Getenv(profiler.AgentTokenEnv)
+	}
+	target := fs.Arg(0)
+	addr := target
+	if pid, err := strconv.Atoi(target); err == nil {
+		if addr, err = pidAddr(pid); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *agentURL == "" {
+		*agentURL = "ws://" + addr + profiler.AgentPath
+	}
+	if *metricsURL == "" {
+		*metricsURL = "http://" + addr + "/metrics"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	w := profiler.NewWatcher()
+	var mu sync.Mutex
+	var agentErr, scrapeErr error
+	if *token != "" {
+		go func() {
+			// an agent ends a capture after ten minutes; start another
+			for ctx.Err() == nil {
+				_, err := profiler.Attach(ctx, *agentURL, profiler.AttachOptions{
+					Token: *token, Duration: 10 * time.Minute, Interval: *sampling, OnChunk: w.Chunk})
+				mu.Lock()
+				agentErr = err
+				mu.Unlock()
+				if err != nil {
+					select {
+					case <-ctx.Done():
+					case <-time.After(*interval):
+					}
+				}
+			}
+		}()
+	} else {
+		agentErr = fmt.Errorf("no token; pass -token or set %s to see hot spots", profiler.AgentTokenEnv)
+	}
+
+	scrape := profiler.ScrapeSource(*metricsURL)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		s, err := scrape()
+		if err == nil {
+			w.Scrape(s)
+		}
+		mu.Lock()
+		scrapeErr = err
+		status := []error{agentErr, scrapeErr}
+		mu.Unlock()
+		drawWatch(target, w.View(*top), status)
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	a, err := w.Save(*dir, *name, *format, map[string]string{"target": target})
+	if err != nil {
+		cli.Fail(err)
+	}
+	fmt.Println(a.Dir)
+}
+
+// drawWatch redraws the terminal with the view
+func drawWatch(target string, v profiler.WatchView, status []error) {
+	fmt.Print("\x1b[H\x1b[2J")
+	fmt.Printf("watching %s for %s, interrupt to save the session\n", target, v.Elapsed.Round(time.Second))
+	for _, err := range status {
+		if err != nil {
+			fmt.Println("warning:", err)
+		}
+	}
+	if t := v.Tick; t != nil {
+		fmt.Printf("ticks %.0f/s  mean %s  p95 %s  heap %.1f MiB  gc %.1f/s  goroutines %d\n",
+			t.TickRate, ms(t.TickMeanMs), ms(t.TickP95Ms), t.HeapInuseMiB, t.GCRate, t.Goroutines)
+	} else if v.Chunks > 0 {
+		fmt.Printf("heap %d MiB  goroutines %d\n", v.Stats.HeapInuse>>20, v.Stats.Goroutines)
+	}
+	fmt.Println()
+	if len(v.Hotspots) == 0 {
+		fmt.Println("no stacks sampled yet")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "SELF\tTOTAL\tFUNCTION\t(%d samples)\n", v.Samples)
+	for _, h := range v.Hotspots {
+		fmt.Fprintf(tw, "%.1f%%\t%.1f%%\t%s\t\n", h.Self*100, h.Total*100, h.Function)
+	}
+	tw.Flush()
+}
+
+// pidAddr finds the local address a process listens on, from /proc: the
+// port answering /metrics if there is one, else its first
+func pidAddr(pid int) (string, error) {
+	inodes := make(map[string]bool)
+	fds, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return "", fmt.Errorf("pid %d: %w; pass its address instead", pid, err)
+	}
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "fd", fd.Name()))
+		if inode, ok := strings.CutPrefix(link, "socket:["); err == nil && ok {
+			inodes[strings.TrimSuffix(inode, "]")] = true
+		}
+	}
+	var ports []string
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(table)
+		if err != nil {
+			continue
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			// sl local_address rem_address st ... inode; 0A is LISTEN
+			fields := strings.Fields(sc.Text())
+			if len(fields) < 10 || fields[3] != "0A" || !inodes[fields[9]] {
+				continue
+			}
+			_, hexPort, _ := strings.Cut(fields[1], ":")
+			if port, err := strconv.ParseUint(hexPort, 16, 16); err == nil {
+				ports = append(ports, strconv.FormatUint(port, 10))
+			}
+		}
+		f.Close()
+	}
+	if len(ports) == 0 {
+		return "", fmt.Errorf("pid %d listens on no TCP port; pass its address instead", pid)
+	}
+	client := certs.HTTPClient(time.Second)
+	for _, port := range ports {
+		addr := net.JoinHostPort("localhost", port)
+		if resp, err := client.Get("http://" + addr + "/metrics"); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return addr, nil
+			}
+		}
+	}
+	return net.JoinHostPort("localhost", ports[0]), nil
+}
@@ -0,0 +1,198 @@
+// Package schedule is stt schedule, which runs the config's periodic
+// tasks, such as nightly generation, analysis of the replay store and
+// pruning of old profiles and autosaves, at the times their specs say
+package schedule
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/schedule"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Tasks a schedule runs
+const (
+	TaskGenerate      = "generate"
+	TaskAnalyze       = "analyze"
+	TaskPruneProfiles = "prune-profiles"
+	TaskSweep         = "sweep"
+)
+
+// Main runs stt schedule with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("schedule"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its schedules are run")
+	list := fs.Bool("list", false, "list the schedules and when each runs next, without running them")
+	run := fs.String("run", "", "run the schedule of this name once, now, and exit")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt schedule [flags]
+
+Runs the config's schedules until interrupted, each when its cron spec
+says, in local time: five fields, minute hour day-of-month month
+day-of-week, as cron takes them, or @hourly, @daily, @weekly, @monthly
+or @every DURATION. A schedule's task is one of
+
+  %-14s  stt generate with the schedule's args
+  %-14s  stt analyze with them, as of -replays a replay store
+  %-14s  continuous profiles rolled up and those past the config's
+                  profileRetentionDays removed, with the other profiles
+                  under profileDir that old
+  %-14s  the files its args' globs match older than its maxAge,
+                  such as stale autosaves
+
+{date} and {time} in generate's and analyze's args are the run's, so
+nightly batches and reports each get a directory, as in
+{"name":"nightly","cron":"0 3 * * *","task":"generate","args":["-count","50","-out","nightly/{date}"]}.
+A run still going when its schedule is next due skips that run.
+
+`, TaskGenerate, TaskAnalyze, TaskPruneProfiles, TaskSweep)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	jobs, err := Jobs(config, cli.ConfigPath(*configPath))
+	if err != nil {
+		cli.Fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	switch {
+	case *list:
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTASK\tCRON\tNEXT")
+		for i, j := range jobs {
+			next := "never"
+			if at := j.Spec.Next(now); !at.IsZero() {
+				next = at.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", j.Name, config.Schedules[i].Task, j.Spec, next)
+		}
+		w.Flush()
+	case *run != "":
+		for _, j := range jobs {
+			if j.Name == *run {
+				if err := j.Run(ctx, time.Now()); err != nil {
+					cli.Fail(err)
+				}
+				return
+			}
+		}
+		cli.Fail(fmt.Errorf("no schedule named %q", *run))
+	default:
+		if len(jobs) == 0 {
+			cli.Fail(fmt.Errorf("the config has no schedules to run"))
+		}
+		schedule.Run(ctx, jobs)
+	}
+}
+
+// Jobs are the config's schedules as jobs, the commands they run loading
+// the config at configPath
+func Jobs(config utils.Config, configPath string) ([]schedule.Job, error) {
+	jobs := make([]schedule.Job, 0, len(config.Schedules))
+	seen := make(map[string]bool)
+	for i, s := range config.Schedules {
+		if s.Name == "" {
+			return nil, fmt.Errorf("schedule %d has no name", i+1)
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("two schedules named %q", s.Name)
+		}
+		seen[s.Name] = true
+		spec, err := schedule.Parse(s.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", s.Name, err)
+		}
+		run, err := task(config, configPath, s)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", s.Name, err)
+		}
+		jobs = append(jobs, schedule.Job{Name: s.Name, Spec: spec, Run: run})
+	}
+	return jobs, nil
+}
+
+// task is what runs a schedule's task
+func task(config utils.Config, configPath string, s utils.Schedule) (func(ctx context.Context, at time.Time) error, error) {
+	switch s.Task {
+	case TaskGenerate, TaskAnalyze:
+		return func(ctx context.Context, at time.Time) error {
+			return command(ctx, configPath, s.Task, expand(s.Args, at))
+		}, nil
+	case TaskPruneProfiles:
+		if config.ProfileRetentionDays <= 0 {
+			return nil, fmt.Errorf("%s needs the config's profileRetentionDays", s.Task)
+		}
+		retention := time.Duration(config.ProfileRetentionDays) * 24 * time.Hour
+		return func(_ context.Context, at time.Time) error {
+			continuous := profiler.DefaultContinuousOptions(filepath.Join(config.ProfileDir, "continuous"))
+			if err := profiler.Compact(continuous.Dir, at, continuous.RollupAfter, retention); err != nil {
+				return err
+			}
+			n, err := schedule.Sweep([]string{filepath.Join(config.ProfileDir, "*")}, retention, at)
+			slog.Info("schedule: profiles pruned", "job", s.Name, "removed", n, "retentionDays", config.ProfileRetentionDays)
+			return err
+		}, nil
+	case TaskSweep:
+		maxAge, err := time.ParseDuration(s.MaxAge)
+		if err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("%s needs a maxAge, such as 168h", s.Task)
+		}
+		if len(s.Args) == 0 {
+			return nil, fmt.Errorf("%s needs globs of the files to sweep as its args", s.Task)
+		}
+		return func(_ context.Context, at time.Time) error {
+			n, err := schedule.Sweep(s.Args, maxAge, at)
+			slog.Info("schedule: files swept", "job", s.Name, "removed", n, "maxAge", maxAge)
+			return err
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown task %q, want %s, %s, %s or %s", s.Task, TaskGenerate, TaskAnalyze, TaskPruneProfiles, TaskSweep)
+	}
+}
+
+// command runs an stt subcommand, with the config at configPath
+func command(ctx context.Context, configPath, name string, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, exe, append([]string{name}, args...)...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = os.Environ()
+	if configPath != "" {
+		cmd.Env = append(cmd.Env, cli.ConfigEnv+"="+configPath)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", cli.Name(name), strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// expand puts the run's date and time into args
+func expand(args []string, at time.Time) []string {
+	r := strings.NewReplacer("{date}", at.Format(time.DateOnly), "{time}", at.Format("150405"))
+	out := make([]string, len(args))
+	for i, a := range args {
+		out[i] = r.Replace(a)
+	}
+	return out
+}
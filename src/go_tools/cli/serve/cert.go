@@ -0,0 +1,66 @@
+package serve
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+)
+
+// serveCert issues dev certificates: serve cert [flags] [client-name...]
+func serveCert(args []string) {
+	fs := flag.NewFlagSet("cert", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	dir := fs.String("dir", "", "dev certificate directory (default the config's tlsDevDir)")
+	out := fs.String("out", "", "directory client certificates are written to (default the dev directory)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve cert [flags] [client-name...]
+
+Issues the development certificates the servers use with the config's
+tlsEnabled and no tlsCertFile: a local CA, generated the first time, and
+a server certificate it signs for this machine's names and addresses,
+which the servers also issue themselves as they start. Clients trust the
+CA's ca.pem through %s.
+
+Each client-name gets a client certificate, NAME.pem and NAME-key.pem,
+for servers whose tlsClientCaFile is the CA's ca.pem to accept. Clients
+present it through %s and %s.
+
+`, certs.CAEnv, certs.CertEnv, certs.KeyEnv)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	config := cli.Config(*configPath)
+	if *dir == "" {
+		*dir = config.TLSDevDir
+	}
+	if *out == "" {
+		*out = *dir
+	}
+	for _, name := range fs.Args() {
+		if name == "" || strings.ContainsAny(name, `/\`) || name == "ca" || name == "server" {
+			cli.Fail(fmt.Errorf("client name %q isn't usable as a file name", name))
+		}
+	}
+
+	if _, err := certs.DevServer(*dir); err != nil {
+		cli.Fail(err)
+	}
+	ca, err := certs.DevCA(*dir)
+	if err != nil {
+		cli.Fail(err)
+	}
+	fmt.Printf("dev CA %s, expires %s\n", ca.Path, ca.Cert.NotAfter.Format("2006-01-02"))
+	fmt.Printf("server certificate %s for %s\n", filepath.Join(*dir, certs.ServerFile), strings.Join(certs.Hosts(), ", "))
+	for _, name := range fs.Args() {
+		certPath, keyPath, err := ca.IssueClient(*out, name)
+		if err != nil {
+			cli.Fail(err)
+		}
+		fmt.Printf("client certificate for %s: %s=%s %s=%s\n", name, certs.CertEnv, certPath, certs.KeyEnv, keyPath)
+	}
+	fmt.Printf("clients trust the servers with %s=%s\n", certs.CAEnv, ca.Path)
+}
@@ -0,0 +1,81 @@
+package serve
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/grpcapi"
+)
+
+// serveGRPC serves the tools over gRPC: serve grpc [flags]
+func serveGRPC(args []string) {
+	fs := flag.NewFlagSet("grpc", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file, the settings calls start from")
+	addr := fs.String("addr", ":8099", "address to serve on")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve grpc [flags]
+
+Serves the generator, analyzer and headless simulator as the gRPC
+services of toolspb/tools.proto, for the engine and build pipelines to
+call rather than run the tools and parse their output. Levels and replays
+travel as their JSON files; a Generate call may patch the config as
+generate -patch does. The server answers reflection, so grpcurl can list
+and call it, and the standard health check. With the config's tokens
+file, calls but health checks need a bearer token with the tools scope in
+their authorization metadata. With the config's tlsEnabled, the server
+takes TLS connections only, as the HTTP modes do.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+
+	keys, err := auth.Load(config.AuthTokensFile)
+	if err != nil {
+		cli.Fail(err)
+	}
+	var opts []grpc.ServerOption
+	tlsConfig := serverTLS(config)
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	defer startTracing(config)()
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		cli.Fail(err)
+	}
+	srv := grpcapi.NewServer(config, keys, opts...)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+	fmt.Printf("serving the generator, analyzer and simulator over gRPC on %s%s\n", ln.Addr(), overTLS(tlsConfig))
+	select {
+	case err := <-done:
+		cli.Fail(err)
+	case <-ctx.Done():
+		// calls in flight get as long as an HTTP mode's do to finish
+		stopped := make(chan struct{})
+		go func() { srv.GracefulStop(); close(stopped) }()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			srv.Stop()
+		}
+	}
+}
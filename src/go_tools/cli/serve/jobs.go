@@ -0,0 +1,66 @@
+package serve
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/jobqueue"
+)
+
+// serveJobs serves the batch job queue: serve jobs [flags]
+func serveJobs(args []string) {
+	fs := flag.NewFlagSet("jobs", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	db := fs.String("db", "", "SQLite database of the queue, created if missing (default the config's jobQueueDb)")
+	addr := fs.String("addr", ":8103", "address to serve on")
+	lease := fs.Duration("lease", jobqueue.DefaultLease, "a worker has to renew its jobs' leases within, or they're taken back")
+	attempts := fs.Int("attempts", jobqueue.DefaultMaxAttempts, "a job gets before it's failed, unless submitted with its own")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve jobs [flags]
+
+Queues batch work, level generation, analysis and simulation, for the
+workers of any number of machines. The jobs tool submits jobs and runs
+workers: a worker registers the kinds of job it takes with POST /workers,
+leases the next with POST /workers/ID/lease and reports its result with
+POST /jobs/N/done. GET /jobs and /jobs/N show where jobs stand, and
+GET /workers who is working on what.
+
+A job whose attempt fails, or whose worker stops renewing its lease
+because it died or lost the network, is queued again for another worker
+until its attempts run out. Jobs survive a restart in the database.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	if *db == "" {
+		*db = config.JobQueueDB
+	}
+	if err := os.MkdirAll(filepath.Dir(*db), 0o755); err != nil {
+		cli.Fail(err)
+	}
+	queue, err := jobqueue.Open(*db, jobqueue.Options{Lease: *lease, MaxAttempts: *attempts})
+	if err != nil {
+		cli.Fail(err)
+	}
+	defer queue.Close()
+	counts, err := queue.Counts()
+	if err != nil {
+		cli.Fail(err)
+	}
+	srv := jobqueue.NewServer(queue)
+	defer srv.Close()
+
+	abs, _ := filepath.Abs(*db)
+	listen(config, *addr, auth.SurfaceJobs, srv, fmt.Sprintf("job queue %s with %d jobs queued and %d running",
+		abs, counts[jobqueue.StatusQueued], counts[jobqueue.StatusRunning]))
+}
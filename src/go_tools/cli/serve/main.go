@@ -0,0 +1,182 @@
+// Package serve is stt serve, which runs the tools' development servers
+package serve
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/admin"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/discovery"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/ratelimit"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// modes are the servers serve runs, for test clients and the launcher on
+// a dev machine
+var modes = map[string]func(args []string){
+	"cert":      serveCert,
+	"grpc":      serveGRPC,
+	"jobs":      serveJobs,
+	"netsim":    serveNetsim,
+	"packs":     servePacks,
+	"relay":     serveRelay,
+	"replaykey": serveReplayKey,
+	"replays":   serveReplays,
+	"sync":      serveSync,
+	"telemetry": serveTelemetry,
+	"token":     serveToken,
+	"validate":  serveValidate,
+	"wire":      serveWire,
+}
+
+// Main runs stt serve with the arguments after the subcommand
+func Main(args []string) {
+	if len(args) > 0 {
+		if mode, ok := modes[args[0]]; ok {
+			mode(args[1:])
+			return
+		}
+	}
+	fmt.Fprint(os.Stderr, `usage: stt serve MODE [flags]
+
+Runs one of the tools' development servers, for test clients and the
+launcher on a dev machine:
+
+  cert       issues the dev certificates servers and clients use for TLS
+  grpc       the generator, analyzer and simulator as gRPC services
+  jobs       a queue of batch jobs for the workers of several machines
+  netsim     a proxy that puts bad network conditions before a server
+  packs      level packs, their versions, checksums and downloads
+  relay      rooms that forward game messages between local clients
+  replaykey  the keys replays are signed with; signs and checks replays
+  replays    a replay store: uploads, deduplicated, searched and downloaded
+  sync       the level editor and running games, kept in step both ways
+  telemetry  clients' telemetry events, validated, deduplicated and stored
+  token      creates, lists and revokes the API tokens the servers accept
+  validate   re-simulates submitted moves and rejects impossible ones
+  wire       plays back a capture of the relay's traffic, to a client or relay
+
+The servers answer the LAN queries of stt discover, profile attach and
+profile load unless the config's discoveryAdvertise is off, or they
+listen on loopback only. With the config's tlsEnabled they serve TLS
+only, with a dev certificate unless given one, and with its
+tlsClientCaFile require client certificates; serve cert issues both.
+Each server but netsim and wire has an admin API under /admin/, which
+the admin tool calls. The REST APIs are versioned under /v1/, with an
+OpenAPI document at /v1/openapi.json; their unversioned paths still
+answer, with a Deprecation header. Run stt serve MODE -h for a mode's flags.
+`)
+	os.Exit(2)
+}
+
+// listen serves handler on addr, traced, until interrupted; with the
+// config's tokens file, requests need a token covering surface, and with
+// its rate limits, clients making too many are refused. It is served over
+// TLS when the config says so, and advertised to LAN discovery as its
+// surface. A server with a surface has the admin API, with handler's
+// operations if it has any, and logs at the config's logLevel until the
+// API changes it. A handler describing its endpoints is served under /v1/
+// too, with its OpenAPI document, and its unversioned paths deprecated.
+func listen(config utils.Config, addr, surface string, handler http.Handler, what string) {
+	keys, err := auth.Load(config.AuthTokensFile)
+	if err != nil {
+		cli.Fail(err)
+	}
+	describer, versioned := handler.(openapi.Describer)
+	if surface != "" {
+		api := admin.New(surface, keys)
+		if r, ok := handler.(admin.Registrar); ok {
+			r.RegisterAdmin(api)
+		}
+		handler = admin.Mount(api, handler)
+	}
+	tlsConfig := serverTLS(config)
+	defer startTracing(config)()
+	if surface != "" {
+		defer advertise(config, addr, discovery.Service{Kind: surface, Name: what, Scheme: certs.Scheme(tlsConfig)})()
+	}
+	handler = keys.Middleware(admin.Surface(surface), handler)
+	if versioned {
+		spec := openapi.New("SuperTetris "+surface, what)
+		describer.DescribeAPI(spec)
+		handler = openapi.Mount(spec, handler)
+	}
+	handler = ratelimit.FromConfig(config, keys).Middleware(handler)
+	srv := &http.Server{Addr: addr, Handler: crash.Handler(tracing.Middleware(handler)), ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	done := make(chan error, 1)
+	go func() { done <- certs.ListenAndServe(srv, tlsConfig) }()
+	fmt.Printf("serving %s on %s%s\n", what, addr, overTLS(tlsConfig))
+	select {
+	case err := <-done:
+		if !errors.Is(err, http.ErrServerClosed) {
+			cli.Fail(err)
+		}
+	case <-ctx.Done():
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}
+}
+
+// serverTLS is the config's TLS for a server, or nil when off; a dev
+// certificate's CA is named for clients to trust
+func serverTLS(config utils.Config) *tls.Config {
+	cfg, err := certs.Server(config)
+	if err != nil {
+		cli.Fail(err)
+	}
+	if cfg != nil && config.TLSCertFile == "" {
+		fmt.Printf("using a dev certificate; clients trust it with %s=%s\n", certs.CAEnv, filepath.Join(config.TLSDevDir, certs.CAFile))
+	}
+	return cfg
+}
+
+func overTLS(cfg *tls.Config) string {
+	switch {
+	case cfg == nil:
+		return ""
+	case cfg.ClientAuth == tls.RequireAndVerifyClientCert:
+		return " over TLS, requiring client certificates"
+	}
+	return " over TLS"
+}
+
+// advertise answers discovery queries for the service until the returned
+// function is called; failing to only warns, as the server works without
+func advertise(config utils.Config, addr string, s discovery.Service) func() {
+	adv, err := discovery.FromConfig(config)
+	if err != nil {
+		cli.Warn("not advertised on the network:", err)
+		return func() {}
+	}
+	adv.AddListen(addr, s)
+	return func() { adv.Close() }
+}
+
+// startTracing exports the server's spans to the config's collector, if
+// any, and returns the function that flushes them
+func startTracing(config utils.Config) func() {
+	shutdown := tracing.Setup(config.TracingEndpoint, "supertetris-serve")
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			cli.Warn("tracing:", err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package serve
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/netsim"
+)
+
+// serveNetsim proxies a server through simulated network conditions:
+// serve netsim [flags]
+func serveNetsim(args []string) {
+	fs := flag.NewFlagSet("netsim", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	addr := fs.String("addr", ":8100", "address to serve on")
+	upstream := fs.String("upstream", "http://localhost:8097", "server the clients reach through the proxy")
+	scriptText := fs.String("script", "clear", "network conditions over time")
+	seed := fs.Int64("seed", 0, "seed of the losses, jitter and reordering, to repeat a run (0 picks one)")
+	perConn := fs.Bool("per-conn", false, "run the script from each connection's opening rather than the proxy's start")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve netsim [flags]
+
+Sits between game clients and a server, such as serve relay, and puts a
+bad network between them: WebSocket messages are delayed, jittered, lost
+and reordered each way by a script of conditions over time, and plain
+HTTP requests delayed. Point clients at this address instead of the
+server's. A script is phases separated by commas or "then":
+
+  150ms for 30s, then 2s outage, then latency 80ms jitter 40ms loss 2%%
+  latency 200ms reorder 5%% for 10s; clear for 5s; repeat
+
+GET /netsim shows the conditions now and what was done to the traffic;
+PUT /netsim with a script replaces it, from its start.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	script, err := netsim.ParseScript(*scriptText)
+	if err != nil {
+		cli.Fail(err)
+	}
+	proxy, err := netsim.NewProxy(*upstream, script, netsim.Options{Seed: *seed, PerConnection: *perConn})
+	if err != nil {
+		cli.Fail(err)
+	}
+	// the upstream checks the tokens forwarded to it
+	listen(config, *addr, "", proxy, fmt.Sprintf("%s through %q", *upstream, script))
+}
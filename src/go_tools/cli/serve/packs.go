@@ -0,0 +1,60 @@
+package serve
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/packs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// servePacks serves the level packs of a directory: serve packs [flags]
+func servePacks(args []string) {
+	fs := flag.NewFlagSet("packs", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	dir := fs.String("dir", "", "directory of packs, as pack/version/ generator batches (default the config's packDir)")
+	addr := fs.String("addr", ":8096", "address to serve on")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve packs [flags]
+
+Serves the level packs under -dir over HTTP: GET /packs lists them,
+/packs/NAME/VERSION describes a version's files with their checksums,
+and /packs/NAME/VERSION/download is a zip of it, latest for the newest
+version. Generate a pack into it with generate -out DIR/NAME/VERSION,
+or release a batch to it with publish, which PUTs the batch's zip to
+/packs/NAME/VERSION; publish -rollback DELETEs it again. With the
+config's packKeysFile set, an upload not signed by one of its keys, as
+pack -sign signs, or changed since, is refused.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	if *dir == "" {
+		*dir = config.PackDir
+	}
+	lib := packs.NewLibrary(*dir)
+	if config.PackKeysFile != "" {
+		keys, err := replay.ReadKeys(config.PackKeysFile)
+		if err != nil {
+			cli.Fail(err)
+		}
+		lib.Keys = keys.Public()
+	}
+	found, err := lib.Packs()
+	if err != nil {
+		cli.Fail(err)
+	}
+
+	abs, _ := filepath.Abs(*dir)
+	listen(config, *addr, auth.SurfacePacks, packs.NewServer(lib), fmt.Sprintf("%d level packs from %s", len(found), abs))
+}
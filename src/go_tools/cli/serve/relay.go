@@ -0,0 +1,80 @@
+package serve
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/lobby"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/relay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/wirecap"
+)
+
+// serveRelay relays game messages between local clients: serve relay [flags]
+func serveRelay(args []string) {
+	fs := flag.NewFlagSet("relay", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	addr := fs.String("addr", ":8097", "address to serve on")
+	maxPeers := fs.Int("max-peers", relay.DefaultMaxPeers, "peers a room takes")
+	queue := fs.Int("queue", relay.DefaultQueueSize, "messages a peer may fall behind before it's dropped")
+	minPeers := fs.Int("min-peers", lobby.DefaultMinMembers, "peers a room needs for the host to start a match")
+	idle := fs.Duration("idle", 0, "drop a peer that sends nothing this long (0 never does)")
+	readyTimeout := fs.Duration("ready-timeout", 0, "drop a peer not ready this long before a match (0 never does)")
+	maxSpectators := fs.Int("max-spectators", relay.DefaultMaxSpectators, "spectators a room takes")
+	spectatorDelay := fs.Duration("spectator-delay", relay.DefaultSpectatorDelay, "how far behind the room spectators see it")
+	spectatorInterval := fs.Duration("spectator-interval", relay.DefaultSpectatorInterval, "how often spectators are sent a batch of the game")
+	captureDir := fs.String("capture", "", "directory to record every room's traffic in, a file a room, for serve wire")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve relay [flags]
+
+Forwards game messages between locally running clients, so networked
+features can be tested without the production backend. A client joins a
+room with a WebSocket to /rooms/CODE?name=NAME and every message it sends
+goes to the room's other clients; add &events=1 to hear the room's events
+as game messages, or &events=json as the legacy JSON text. POST /rooms
+opens a room under a fresh code, GET /rooms lists them, and GET /health
+reports the relay's load and how late its ticks run.
+
+The first client in a room hosts it. Game messages with a control body
+are lobby controls the relay acts on rather than forwards: ready, unready,
+ping, and for the host start, end, and host or kick with a peer. Legacy
+text controls like {"lobby":"ready"} are still read.
+
+A WebSocket to /rooms/CODE?spectate=1 watches an open room read-only, for
+casting: the room's events and its game messages, less inputs and
+players' addresses, -spectator-delay late and batched each
+-spectator-interval.
+
+With -capture, each room's joins, leaves, messages and events are
+recorded as they happen, to a file named for the room and when it
+opened, which serve wire plays back to a client or another relay.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+
+	var capture *wirecap.Recorder
+	if *captureDir != "" {
+		var err error
+		if capture, err = wirecap.NewRecorder(*captureDir); err != nil {
+			cli.Fail(err)
+		}
+		defer capture.Close()
+		fmt.Printf("capturing rooms' traffic in %s\n", *captureDir)
+	}
+
+	srv := relay.NewServer(relay.Options{MaxPeers: *maxPeers, MinPeers: *minPeers, QueueSize: *queue,
+		IdleTimeout: *idle, ReadyTimeout: *readyTimeout,
+		MaxSpectators: *maxSpectators, SpectatorDelay: *spectatorDelay, SpectatorInterval: *spectatorInterval,
+		Capture: capture})
+	defer srv.Close()
+	listen(config, *addr, auth.SurfaceRelay, srv, fmt.Sprintf("a relay of up to %d peers a room", *maxPeers))
+}
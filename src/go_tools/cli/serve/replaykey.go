@@ -0,0 +1,143 @@
+package serve
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// serveReplayKey manages the replay signing keys: serve replaykey [flags] [replays]
+func serveReplayKey(args []string) {
+	fs := flag.NewFlagSet("replaykey", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	file := fs.String("file", "", "replay keys file (default the config's replayKeysFile)")
+	create := fs.Bool("new", false, "add a key, which signs from then on")
+	retire := fs.String("retire", "", "stop signing with the key with this ID; what it signed still verifies")
+	public := fs.String("public", "", "write the keys without their private halves to this file, for servers that only verify")
+	sign := fs.Bool("sign", false, "sign the replay files given as arguments, in place")
+	verify := fs.Bool("verify", false, "check the signatures of the replay files given as arguments")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve replaykey [flags] [replays]
+
+Creates and retires the Ed25519 keys replays are signed with once the
+config's replayKeysFile is set. Recorders, such as analyze -tail -record,
+sign each replay as its session ends with the newest key; the replay
+store, the analyzer and leaderboard submissions then refuse replays that
+aren't signed by one of the file's keys, or were changed after.
+
+-sign signs replays recorded elsewhere, -verify checks them. With no
+flags, the keys are listed.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	files := *sign || *verify
+	if files != (fs.NArg() > 0) || *sign && *verify || *create && *retire != "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	if *file == "" {
+		*file = config.ReplayKeysFile
+	}
+	if *file == "" {
+		cli.Fail(fmt.Errorf("no replay keys file: set the config's replayKeysFile or pass -file"))
+	}
+	keys, err := replay.ReadKeys(*file)
+	if errors.Is(err, os.ErrNotExist) && *create {
+		keys, err = &replay.Keys{}, nil
+	}
+	if err != nil {
+		cli.Fail(err)
+	}
+
+	switch {
+	case *create:
+		key, err := replay.NewKey()
+		if err != nil {
+			cli.Fail(err)
+		}
+		keys.Keys = append(keys.Keys, key)
+		if err := keys.Save(*file); err != nil {
+			cli.Fail(err)
+		}
+		fmt.Printf("created replay key %s\n", key.ID)
+	case *retire != "":
+		i := slices.IndexFunc(keys.Keys, func(k replay.Key) bool { return k.ID == *retire })
+		if i < 0 {
+			cli.Fail(fmt.Errorf("no replay key %s in %s", *retire, *file))
+		}
+		keys.Keys[i].Retired = true
+		if err := keys.Save(*file); err != nil {
+			cli.Fail(err)
+		}
+		fmt.Printf("retired replay key %s\n", *retire)
+	case *sign:
+		key, ok := keys.Signer()
+		if !ok {
+			cli.Fail(fmt.Errorf("no key in %s can sign; add one with -new", *file))
+		}
+		for _, path := range fs.Args() {
+			rp, err := replay.Load(path)
+			if err == nil {
+				if err = rp.Sign(key); err == nil {
+					err = rp.Save(path)
+				}
+			}
+			if err != nil {
+				cli.Fail(err)
+			}
+		}
+		fmt.Printf("signed %d replays with key %s\n", fs.NArg(), key.ID)
+	case *verify:
+		bad := 0
+		for _, path := range fs.Args() {
+			rp, err := replay.Load(path)
+			if err == nil {
+				err = keys.Verify(rp)
+			}
+			if err != nil {
+				fmt.Printf("%s: %v\n", path, err)
+				bad++
+				continue
+			}
+			fmt.Printf("%s: signed by %s\n", path, rp.Signature.KeyID)
+		}
+		if bad > 0 {
+			os.Exit(1)
+		}
+	}
+	if *public != "" {
+		if err := keys.Public().Save(*public); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *create || *retire != "" || files || *public != "" {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tSTATE")
+	signer, _ := keys.Signer()
+	for _, k := range keys.Keys {
+		state := "verifies"
+		switch {
+		case k.ID == signer.ID:
+			state = "signs"
+		case k.Retired:
+			state = "retired"
+		case k.Private == nil:
+			state = "public only"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", k.ID, k.Created.Format(time.DateOnly), state)
+	}
+	w.Flush()
+}
@@ -0,0 +1,93 @@
+package serve
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replaystore"
+)
+
+// serveReplays serves a replay store: serve replays [flags]
+func serveReplays(args []string) {
+	fs := flag.NewFlagSet("replays", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	dir := fs.String("dir", "", "replay store directory, created if missing (default the config's replayStoreDir)")
+	addr := fs.String("addr", ":8098", "address to serve on")
+	importDir := fs.String("import", "", "add the replay files of this directory to the store before serving")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve replays [flags]
+
+Serves a replay store over HTTP: POST /replays uploads a replay, the same
+file twice is kept once, GET /replays?player=&level=&version=&outcome=
+searches them and /replays/ID/download fetches one. The analyzer reads a
+store's server as its replays: analyze -replays http://HOST:PORT/replays,
+with a search's parameters to analyze just those. With the config's
+replayKeysFile set, uploads have to be signed by one of its keys.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	if *dir == "" {
+		*dir = config.ReplayStoreDir
+	}
+	store, err := replaystore.Open(*dir)
+	if err != nil {
+		cli.Fail(err)
+	}
+	defer store.Close()
+	if config.ReplayKeysFile != "" {
+		if store.Keys, err = replay.ReadKeys(config.ReplayKeysFile); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *importDir != "" {
+		added, dups, err := importReplays(store, *importDir)
+		if err != nil {
+			cli.Fail(err)
+		}
+		fmt.Printf("imported %d replays from %s, %d already stored\n", added, *importDir, dups)
+	}
+
+	abs, _ := filepath.Abs(*dir)
+	listen(config, *addr, auth.SurfaceReplays, replaystore.NewServer(store), fmt.Sprintf("%d replays from %s", store.Search(replaystore.Query{}).Total, abs))
+}
+
+// importReplays puts the .json replays of dir in the store, warning of
+// those that aren't replays
+func importReplays(store *replaystore.Store, dir string) (added, dups int, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return added, dups, err
+		}
+		_, created, err := store.Put(data)
+		switch {
+		case err != nil:
+			cli.Warnf("%s: %v", e.Name(), err)
+		case created:
+			added++
+		default:
+			dups++
+		}
+	}
+	return added, dups, nil
+}
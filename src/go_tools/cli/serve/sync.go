@@ -0,0 +1,42 @@
+package serve
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/livesync"
+)
+
+// serveSync keeps the editor and running games in step: serve sync [flags]
+func serveSync(args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	addr := fs.String("addr", ":8102", "address to serve on")
+	queue := fs.Int("queue", livesync.DefaultQueueSize, "messages a peer may fall behind before it's dropped")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve sync [flags]
+
+Syncs the level editor and running games both ways. The editor and games
+join a session with a WebSocket to /sessions/NAME?role=editor|game&name=N.
+The editor sends the level it edits as a load, then patches as it
+changes, and the hub numbers the revisions and passes them to the games,
+so a game joining late or sending resync is caught up. The editor sends
+capture to ask a game for its board as it stands, which the game answers
+with a snapshot, to start a puzzle from. GET /sessions lists the
+sessions, GET /sessions/NAME shows one with its level.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	hub := livesync.NewHub(livesync.Options{QueueSize: *queue})
+	listen(config, *addr, auth.SurfaceSync, hub, "editor and game live sync")
+}
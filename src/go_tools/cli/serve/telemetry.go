@@ -0,0 +1,69 @@
+package serve
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/store"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/telemetry"
+)
+
+// serveTelemetry ingests clients' telemetry: serve telemetry [flags]
+func serveTelemetry(args []string) {
+	fs := flag.NewFlagSet("telemetry", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	db := fs.String("db", "", "results database the events are stored in (default the config's telemetryDb, or else its resultsDb)")
+	addr := fs.String("addr", ":8104", "address to serve on")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve telemetry [flags]
+
+Takes the client's telemetry events over HTTP: POST /telemetry sends
+some, one JSON event a line as the client's event log has them, and GET
+/telemetry has the totals so far. Each event is checked against the
+event schema, and rejected by line if it isn't one; one sent twice, by
+its id or, without one, its content, is kept once, so a client may
+resend whatever it isn't sure arrived. Events are buffered into batches
+of the config's telemetryBatchSize, stored at least every
+telemetryFlushSecs and on shutdown; analyze reads them with
+-events sqlite:PATH. stt telemetry imports event logs the same way.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	path, opts := telemetry.FromConfig(config)
+	if *db != "" {
+		path = *db
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		cli.Fail(err)
+	}
+	results, err := store.Open(path)
+	if err != nil {
+		cli.Fail(err)
+	}
+	defer results.Close()
+	in := telemetry.New(results, opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- in.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			cli.Warn("telemetry: events left unstored:", err)
+		}
+	}()
+
+	abs, _ := filepath.Abs(path)
+	listen(config, *addr, auth.SurfaceTelemetry, telemetry.NewServer(in), "client telemetry into "+abs)
+}
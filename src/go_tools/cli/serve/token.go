@@ -0,0 +1,97 @@
+package serve
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+)
+
+// serveToken manages the servers' tokens file: serve token [flags]
+func serveToken(args []string) {
+	fs := flag.NewFlagSet("token", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	file := fs.String("file", "", "tokens file (default the config's authTokensFile)")
+	name := fs.String("name", "", "create a token held by this name")
+	scopes := fs.String("scopes", "", "comma-separated scopes of the token created: "+strings.Join(auth.Surfaces, ", ")+", any as SURFACE:read, or *")
+	ttl := fs.Duration("ttl", 0, "how long the token created is valid, 0 for ever")
+	revoke := fs.String("revoke", "", "revoke the token with this ID")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve token [flags]
+
+Creates, lists and revokes the API tokens the servers accept once the
+config's authTokensFile is set. -name and -scopes create a token, printed
+once: only its hash is kept. -revoke refuses a token from then on,
+running servers included. With neither, the tokens are listed.
+
+Clients send a token as an Authorization: Bearer header; browsers may add
+?access_token= to a page's URL instead. The tools' own clients read it
+from %s.
+
+`, auth.TokenEnv)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 || *name != "" && *revoke != "" || (*name == "") != (*scopes == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	if *file == "" {
+		*file = config.AuthTokensFile
+	}
+	if *file == "" {
+		cli.Fail(fmt.Errorf("no tokens file: set the config's authTokensFile or pass -file"))
+	}
+	f, err := auth.ReadFile(*file)
+	if err != nil {
+		cli.Fail(err)
+	}
+
+	switch {
+	case *name != "":
+		t, token, err := auth.NewToken(*name, strings.Split(*scopes, ","), *ttl)
+		if err != nil {
+			cli.Fail(err)
+		}
+		f.Tokens = append(f.Tokens, t)
+		if err := f.Save(*file); err != nil {
+			cli.Fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "created token %s for %s; it isn't shown again\n", t.ID, t.Name)
+		fmt.Println(token)
+	case *revoke != "":
+		if !slices.ContainsFunc(f.Tokens, func(t auth.Token) bool { return t.ID == *revoke }) {
+			cli.Fail(fmt.Errorf("no token %s in %s", *revoke, *file))
+		}
+		if !slices.Contains(f.Revoked, *revoke) {
+			f.Revoked = append(f.Revoked, *revoke)
+		}
+		if err := f.Save(*file); err != nil {
+			cli.Fail(err)
+		}
+		fmt.Printf("revoked token %s\n", *revoke)
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED\tSTATE")
+		for _, t := range f.Tokens {
+			state := "valid"
+			switch {
+			case slices.Contains(f.Revoked, t.ID):
+				state = "revoked"
+			case !t.Expires.IsZero() && !time.Now().Before(t.Expires):
+				state = "expired"
+			case !t.Expires.IsZero():
+				state = "until " + t.Expires.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(t.Scopes, ","), t.Created.Format(time.DateOnly), state)
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,52 @@
+package serve
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/validation"
+)
+
+// serveValidate re-simulates submitted moves: serve validate [flags]
+func serveValidate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	addr := fs.String("addr", ":8101", "address to serve on")
+	levels := fs.String("levels", "", "directory of the levels games are played on; others are empty boards of the config's size")
+	kicks := fs.Bool("kicks", false, "accept locks only a wall kick reaches, for games that have them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve validate [flags]
+
+Re-simulates the moves clients submit against an authoritative copy of
+each game and rejects impossible ones: pieces out of the dealt order,
+overlapping the board, floating, or where no moves take them, and clears
+the board didn't make. POST /games opens a game, POST /games/ID/moves
+submits its lock and clear events, which answer 422 with the reason when
+impossible. POST /validate checks every move of a replay at once.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	data := analyzer.NewDataset()
+	if *levels != "" {
+		if err := data.LoadLevels(*levels); err != nil {
+			cli.Fail(err)
+		}
+	}
+	srv := validation.NewServer(data, validation.Options{
+		Fallback: level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight},
+		Validate: analyzer.ValidateOptions{AllowUnreachable: *kicks},
+	})
+	listen(config, *addr, auth.SurfaceValidation, srv, fmt.Sprintf("move validation on %d levels", len(data.Levels)))
+}
@@ -0,0 +1,73 @@
+package serve
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/wirecap"
+)
+
+// serveWire plays back a capture of the relay's traffic, to a client or a
+// relay: serve wire [flags] capture.jsonl
+func serveWire(args []string) {
+	fs := flag.NewFlagSet("wire", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	addr := fs.String("addr", ":8097", "address to serve the capture to clients on")
+	to := fs.String("to", "", "relay, such as http://localhost:8097, to play the capture's peers to instead")
+	room := fs.String("room", "", "room the peers join with -to (default the capture's)")
+	as := fs.String("as", "", "peer whose view clients are played, whatever name they join with (default their ?name=)")
+	speed := fs.Float64("speed", 1, "of the playback, 2 for twice as fast")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt serve wire [flags] capture.jsonl
+       serve wire -to http://host:8097 [flags] capture.jsonl
+
+Plays back a room's traffic that serve relay -capture recorded, so a
+networking bug seen once can be run again with the same messages in
+the same order and at the same pace.
+
+By default it stands in for the relay: a client joining /rooms/CODE as
+one of the captured peers is sent what that peer was, the others'
+messages and, with ?events=1 or ?events=json, the room's events, from
+its join to its leave. With -to it stands in for the clients instead: each captured
+peer joins the relay's room as it did and sends what it sent, controls
+included, leaving the relay's part to the relay. Put serve netsim in
+between to replay under the network conditions of the bug report.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	c, err := wirecap.Load(fs.Arg(0))
+	if err != nil {
+		cli.Fail(err)
+	}
+	what := fmt.Sprintf("capture of room %s, %d records over %s, with peers %s", c.Room, len(c.Records),
+		c.Duration().Round(time.Millisecond), strings.Join(c.Peers(), ", "))
+
+	if *to == "" {
+		// a stand-in relay for one client under test: no tokens, admin API
+		// or discovery
+		listen(config, *addr, "", wirecap.NewPlayer(c, *as, *speed), "the "+what)
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Printf("playing the %s to %s\n", what, *to)
+	st, err := wirecap.Play(ctx, c, *to, wirecap.PlayOptions{Room: *room, Speed: *speed})
+	fmt.Printf("%d joins, %d messages sent, %d for peers the relay had dropped, %d received\n",
+		st.Joined, st.Sent, st.Failed, st.Received)
+	if err != nil {
+		cli.Fail(err)
+	}
+}
@@ -0,0 +1,108 @@
+// Package telemetry is stt telemetry, which imports client event logs
+// into the results database the analyzer reads telemetry from
+package telemetry
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/store"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/telemetry"
+)
+
+// maxWarned is the rejected events of a log warned of one by one
+const maxWarned = 10
+
+// Main runs stt telemetry with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("telemetry"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file")
+	db := fs.String("db", "", "results database to store the events in (default the config's telemetryDb, or else its resultsDb)")
+	export := fs.String("export", "", "write every event stored to this directory as a client_events table, in the config's exportFormats")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), `usage: stt telemetry [flags] [LOG...]
+
+Imports client event logs, one JSON event a line and gzipped if they end
+in .gz, into the results database serve telemetry stores clients' events
+in, checking each event against the event schema as the server does.
+Events that aren't valid are rejected by line; one already stored is
+kept once, so a log can be imported again, or after being sent. The
+analyzer reads the stored events with -events sqlite:PATH; -export
+writes them out for other tools, as CSV or Parquet.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 && *export == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	path, opts := telemetry.FromConfig(config)
+	if *db != "" {
+		path = *db
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		cli.Fail(err)
+	}
+	results, err := store.Open(path)
+	if err != nil {
+		cli.Fail(err)
+	}
+	defer results.Close()
+
+	in := telemetry.New(results, opts)
+	failed := 0
+	for _, log := range fs.Args() {
+		res, err := telemetry.Import(in, log)
+		for i, r := range res.Rejected {
+			if i == maxWarned {
+				cli.Warnf("%s: %d more events rejected", log, len(res.Rejected)-maxWarned)
+				break
+			}
+			cli.Warnf("%s:%d: %s", log, r.Line, r.Error)
+		}
+		if err != nil {
+			cli.Warnf("%s: %v", log, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: %d events accepted, %d rejected\n", log, res.Accepted, len(res.Rejected))
+	}
+	if fs.NArg() > 0 {
+		s := in.Stats()
+		fmt.Printf("%d new events stored in %s, %d already there\n", s.Stored, path, s.Duplicates)
+	}
+	if *export != "" {
+		if err := exportEvents(results, *export, config.ExportFormats); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if failed > 0 {
+		cli.Fail(fmt.Errorf("%d event logs failed to import", failed))
+	}
+}
+
+// exportEvents writes the events stored to dir as a table in formats
+func exportEvents(results *store.Store, dir string, formats []string) error {
+	events, err := results.ClientEvents()
+	if err != nil {
+		return err
+	}
+	if len(formats) == 0 {
+		formats = []string{analyzer.FormatCSV}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := telemetry.Table(events).Export(dir, formats); err != nil {
+		return err
+	}
+	fmt.Printf("%d events exported to %s\n", len(events), dir)
+	return nil
+}
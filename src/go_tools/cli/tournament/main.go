@@ -0,0 +1,153 @@
+// Package tournament is stt tournament, which plays a round robin of
+// versus matches between bot configurations and balance patches
+package tournament
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/bot"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Main runs stt tournament with the arguments after the subcommand
+func Main(args []string) {
+	fs := flag.NewFlagSet(cli.Name("tournament"), flag.ExitOnError)
+	configPath := fs.String("config", "", "path to a JSON config file; its scoringFile, spellsFile, playRulesFile and pieceRandomizer set up the games, its attackFile the garbage the entrants send")
+	levelDir := fs.String("levels", "", "directory of level files to play the matches on")
+	entrantsPath := fs.String("entrants", "", "JSON list of entrants: bot configurations, each with a name, policy, strength, weights, delay and spell policy, and an attackFile for a candidate balance patch (default beam bots of every strength)")
+	games := fs.Int("games", bot.DefaultTournamentGames, "games of each pairing on each level, the sides swapped every other game")
+	seed := fs.Int64("seed", 1, "deals a pairing's first two games; each two after them the next seed")
+	frames := fs.Int("frames", bot.DefaultFrames, "a game plays at most; one nobody has won by then is a draw")
+	workers := fs.Int("workers", 0, "games played at once (default GOMAXPROCS)")
+	out := fs.String("out", "", "directory to write the report and the replays of the upsets, draws and longest games to")
+	format := fs.String("format", "json", "replay file format: json, or bin for the binary format")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: stt tournament -levels DIR [flags]
+
+Plays a round robin of versus matches between bot configurations, or
+balance patches sending garbage by attack tables of their own, on every
+level in -levels, and prints the standings and every pairing's win rate.
+With -out the report is written to OUT/tournament.json and the games
+worth watching again, each pairing's upsets, draws and longest game, to
+OUT as replays. The same flags always play the same games.
+
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *levelDir == "" || *games <= 0 || *format != "json" && *format != "bin" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	config := cli.Config(*configPath)
+	entrants := bot.DefaultEntrants()
+	if *entrantsPath != "" {
+		var err error
+		if entrants, err = bot.LoadEntrants(*entrantsPath); err != nil {
+			cli.Fail(err)
+		}
+	}
+	opts := bot.TournamentOptions{Games: *games, Seed: *seed, Frames: *frames, Workers: *workers}
+	var err error
+	if opts.Sim, err = sim.OptionsFromConfig(config); err != nil {
+		cli.Fail(err)
+	}
+
+	data := analyzer.NewDataset()
+	failed, err := data.LoadLevelsWith(*levelDir, analyzer.Pool{})
+	if err != nil {
+		cli.Fail(err)
+	}
+	for _, f := range failed {
+		cli.Warnf("%s: %v", f.File, f.Err)
+	}
+	levels := data.LevelList()
+	if len(levels) == 0 {
+		cli.Fail(fmt.Errorf("no levels in %s", *levelDir))
+	}
+
+	report, err := bot.PlayTournament(levels, entrants, opts)
+	if err != nil {
+		cli.Fail(err)
+	}
+	if *out != "" {
+		if err := save(report, *out, *format); err != nil {
+			cli.Fail(err)
+		}
+	}
+	if *asJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	printReport(report)
+	if *out != "" {
+		fmt.Printf("\nreport and %d replays written to %s\n", len(report.Interesting), *out)
+	}
+}
+
+// save writes the report and the replays of its interesting games
+func save(report bot.TournamentReport, dir, format string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ext := ".json"
+	if format == "bin" {
+		ext = replay.FormatExt
+	}
+	for _, g := range report.Interesting {
+		if err := g.Replay.Save(filepath.Join(dir, strings.ReplaceAll(g.Replay.SessionID, "/", "_")+ext)); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "tournament.json"), data, 0644)
+}
+
+// printReport lists the standings, every pairing and the games kept
+func printReport(report bot.TournamentReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tENTRANT\tPLAYED\tWINS\tLOSSES\tDRAWS\tPOINTS\tWIN RATE\tLINES\tSENT\tRECEIVED")
+	for i, s := range report.Standings {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%d\t%.1f\t%.1f%%\t%d\t%d\t%d\n", i+1, s.Entrant, s.Played, s.Wins, s.Losses,
+			s.Draws, s.Points, 100*s.WinRate(), s.Lines, s.Sent, s.Received)
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "A\tB\tGAMES\tA WINS\tB WINS\tDRAWS\tA WIN RATE")
+	for _, m := range report.Matchups {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%.1f%%\n", m.A, m.B, m.Games, m.WinsA, m.WinsB, m.Draws, 100*m.WinRate())
+	}
+	w.Flush()
+
+	if len(report.Interesting) == 0 {
+		return
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tPLAYERS\tWINNER\tSECONDS\tWHY")
+	for _, g := range report.Interesting {
+		winner := g.Winner
+		if winner == "" {
+			winner = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1f\t%s\n", g.Replay.SessionID, strings.Join(g.Players, " v "), winner,
+			float64(g.Frames)/sim.FrameRate, strings.Join(g.Reasons, ", "))
+	}
+	w.Flush()
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/watch"
+)
+
+// WatchFlags are the flags of a subcommand's -watch mode, which its Main
+// passes to Watch
+type WatchFlags struct {
+	Watch    *bool
+	Dirs     *string
+	Debounce *time.Duration
+}
+
+// AddWatchFlags adds -watch, -watch-dir and -debounce to a subcommand's
+// flags, what naming the inputs it runs again on
+func AddWatchFlags(fs *flag.FlagSet, what string) WatchFlags {
+	return WatchFlags{
+		Watch:    fs.Bool("watch", false, "run again each time "+what+" change, until interrupted"),
+		Dirs:     fs.String("watch-dir", "", "comma-separated files and directories -watch watches too, such as templates"),
+		Debounce: fs.Duration("debounce", watch.DefaultDebounce, "with -watch, how long the files must be left alone before running again"),
+	}
+}
+
+// Watch runs stt sub with args, less the watch flags, and again each time
+// the files under paths, or under -watch-dir, change. Files under exclude,
+// the pipeline's outputs, are left out. It returns once interrupted.
+func Watch(sub string, args []string, f WatchFlags, paths, exclude []string) {
+	for _, d := range strings.Split(*f.Dirs, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			paths = append(paths, d)
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		Fail(err)
+	}
+	args = append([]string{sub}, withoutWatchFlags(args)...)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	w := watch.New(paths, exclude)
+	fmt.Fprintf(os.Stderr, "watching %s, %d files so far; interrupt to stop\n", strings.Join(w.Paths(), ", "), w.Files())
+	runs := 0
+	run := func(why string) {
+		runs++
+		fmt.Fprintf(os.Stderr, "-- run %d: %s\n", runs, why)
+		start := time.Now()
+		cmd := exec.CommandContext(ctx, exe, args...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "-- run %d: %s failed after %s: %v\n", runs, Name(sub), time.Since(start).Round(time.Millisecond), err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "-- run %d: %s done in %s\n", runs, Name(sub), time.Since(start).Round(time.Millisecond))
+	}
+	run("first run")
+	w.Run(ctx, watch.Options{Debounce: *f.Debounce}, func(changes []watch.Change) {
+		run(watch.Summary(changes))
+	})
+}
+
+// withoutWatchFlags is args without -watch, -watch-dir and -debounce and
+// their values, in any of the flag package's spellings
+func withoutWatchFlags(args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			return append(out, args[i:]...)
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if !strings.HasPrefix(a, "-") {
+			out = append(out, a)
+			continue
+		}
+		switch name {
+		case "watch":
+		case "watch-dir", "debounce":
+			if !hasValue {
+				i++
+			}
+		default:
+			out = append(out, a)
+		}
+	}
+	return out
+}
@@ -0,0 +1,121 @@
+// Command stt runs the level tools as subcommands sharing one config,
+// log level and way of reporting usage, warnings and errors
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/admin"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/analyze"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/batchsim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/bench"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/convert"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/dash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/desync"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/discover"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/edit"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/engine"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/generate"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/jobs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/matchsim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/migrate"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/mlexport"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/pack"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/plugin"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/probe"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/profile"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/schedule"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/serve"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/telemetry"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli/tournament"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+)
+
+// commands are stt's subcommands, in the order usage lists them
+var commands = []cli.Command{
+	{Name: "edit", Summary: "edit a level file, checking and live syncing each save", Main: edit.Main},
+	{Name: "generate", Summary: "generate a batch of levels", Main: generate.Main},
+	{Name: "analyze", Summary: "report on sessions played and the levels they were played on", Main: analyze.Main},
+	{Name: "telemetry", Summary: "import client event logs into the results database the analyzer reads", Main: telemetry.Main},
+	{Name: "batchsim", Summary: "play bot games of a directory of levels into a synthetic replay dataset", Main: batchsim.Main},
+	{Name: "tournament", Summary: "play a round robin of versus matches between bot configurations or balance patches", Main: tournament.Main},
+	{Name: "matchsim", Summary: "simulate the matchmaking policies on a synthetic player population", Main: matchsim.Main},
+	{Name: "mlexport", Summary: "export replays or bot games as training samples for learned models", Main: mlexport.Main},
+	{Name: "desync", Summary: "play a replay on two simulations and report the first frame they part on", Main: desync.Main},
+	{Name: "profile", Summary: "convert profiler samples and report on timing logs and profiles", Main: profile.Main},
+	{Name: "bench", Summary: "time the standard generation, simulation and analysis workload against a baseline", Main: bench.Main},
+	{Name: "serve", Summary: "run one of the development servers", Main: serve.Main},
+	{Name: "schedule", Summary: "run the config's periodic tasks: generation, analysis and pruning", Main: schedule.Main},
+	{Name: "jobs", Summary: "submit batch work to the job queue, follow it, or work on it", Main: jobs.Main},
+	{Name: "dash", Summary: "watch running jobs, analyses, profiler budgets and relay rooms in the terminal", Main: dash.Main},
+	{Name: "admin", Summary: "call a tool server's admin API: log level, relay rooms, pack reloads and jobs", Main: admin.Main},
+	{Name: "discover", Summary: "list the game's and the tools' servers on the local network", Main: discover.Main},
+	{Name: "probe", Summary: "measure the round trip and jitter to the game server regions", Main: probe.Main},
+	{Name: "migrate", Summary: "upgrade level files, packs and batches to the current level format", Main: migrate.Main},
+	{Name: "convert", Summary: "convert level files, packs and batches between JSON and the binary level format", Main: convert.Main},
+	{Name: "engine", Summary: "convert levels, blocks, spells and rules to and from the game engine's formats", Main: engine.Main},
+	{Name: "pack", Summary: "release a batch as a level pack version, list or roll back releases", Main: pack.Main},
+	{Name: "plugin", Summary: "list the plugins' generators, passes and editor tools, run an editor tool", Main: plugin.Main},
+}
+
+func main() {
+	defer crash.Recover()
+	if code := run(os.Args[1:], commands, os.Stderr); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// run parses stt's flags and runs the command args name, returning the
+// status to exit with when it returns: 2 for no command or an unknown one
+func run(args []string, commands []cli.Command, stderr io.Writer) int {
+	fs := flag.NewFlagSet(cli.Program, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "path to a JSON config file the subcommand loads when not given its own -config (default $"+cli.ConfigEnv+")")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, `usage: %s [-config FILE] COMMAND [flags] [args]
+
+Runs one of the level tools. Every command loads the config of its
+own -config, or else of stt's, or else of $%s, and logs at its
+logLevel; warnings and errors go to stderr, and a command exits with
+status 1 when it fails and 2 when it's run wrongly. One that crashes
+writes a crash bundle to the config's crashDir, uploading it to its
+crashReportUrl, exiting with status 2 too. Run stt COMMAND -h for a
+command's flags.
+
+`, cli.Program, cli.ConfigEnv)
+		for _, c := range commands {
+			fmt.Fprintf(out, "  %-10s  %s\n", c.Name, c.Summary)
+		}
+		fmt.Fprintln(out)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *configPath != "" {
+		os.Setenv(cli.ConfigEnv, *configPath)
+	}
+	name := fs.Arg(0)
+	for _, c := range commands {
+		if c.Name == name {
+			c.Main(fs.Args()[1:])
+			return 0
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n", name)
+	fs.Usage()
+	return 2
+}
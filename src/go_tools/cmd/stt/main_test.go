@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/cli"
+)
+
+func TestRunDispatches(t *testing.T) {
+	t.Setenv(cli.ConfigEnv, "")
+	var ran []string
+	var got []string
+	cmds := []cli.Command{
+		{Name: "one", Main: func(args []string) { ran, got = append(ran, "one"), args }},
+		{Name: "two", Main: func(args []string) { ran, got = append(ran, "two"), args }},
+	}
+	var stderr bytes.Buffer
+	if code := run([]string{"-config", "tools.json", "two", "-n", "3", "x"}, cmds, &stderr); code != 0 {
+		t.Fatalf("exited %d: %s", code, stderr.String())
+	}
+	if !slices.Equal(ran, []string{"two"}) || !slices.Equal(got, []string{"-n", "3", "x"}) {
+		t.Errorf("ran %v with %v", ran, got)
+	}
+	if path := os.Getenv(cli.ConfigEnv); path != "tools.json" {
+		t.Errorf("$%s is %q, want stt's -config", cli.ConfigEnv, path)
+	}
+}
+
+func TestRunRefusesUnknownCommands(t *testing.T) {
+	cmds := []cli.Command{{Name: "one", Summary: "the only command", Main: func([]string) { t.Error("ran one") }}}
+	var stderr bytes.Buffer
+	if code := run([]string{"nope"}, cmds, &stderr); code != 2 {
+		t.Errorf("an unknown command exited %d, want 2", code)
+	}
+	if out := stderr.String(); !strings.Contains(out, `unknown command "nope"`) || !strings.Contains(out, "the only command") {
+		t.Errorf("stderr:\n%s", out)
+	}
+	stderr.Reset()
+	if code := run(nil, cmds, &stderr); code != 2 || !strings.Contains(stderr.String(), "usage: stt") {
+		t.Errorf("no command exited %d: %s", code, stderr.String())
+	}
+	if code := run([]string{"-h"}, cmds, &stderr); code != 0 {
+		t.Errorf("-h exited %d", code)
+	}
+}
+
+func TestCommandsAreNamedOnce(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, c := range commands {
+		if c.Name == "" || c.Summary == "" || c.Main == nil {
+			t.Errorf("command %+v is missing its name, summary or Main", c.Name)
+		}
+		if seen[c.Name] {
+			t.Errorf("two commands are named %s", c.Name)
+		}
+		seen[c.Name] = true
+	}
+}
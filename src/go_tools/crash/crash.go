@@ -0,0 +1,245 @@
+// Package crash turns a panic in one of the tools into a crash bundle, a
+// directory of what it takes to work out what happened: the stack, the
+// log's last lines, the config with its secrets taken out and the
+// documents the tool had open, saved as they were. Each tool's main
+// defers Recover, the goroutines servers and workers start run through Go,
+// and HTTP handlers are wrapped in Handler, so a panic anywhere in a tool
+// leaves a bundle.
+package crash
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/logging"
+)
+
+// DefaultDir is where bundles are written when Configure hasn't said
+const DefaultDir = "crashes"
+
+// Files of a bundle
+const (
+	InfoFile       = "crash.json"
+	StackFile      = "stack.txt"      // the panicking goroutine's
+	GoroutinesFile = "goroutines.txt" // every goroutine's
+	LogFile        = "log.txt"
+	ConfigFile     = "config.json"
+	DocumentsDir   = "documents"
+)
+
+// Options configure crash reporting, from the config's crash settings
+type Options struct {
+	Dir       string // bundles are written under; empty for DefaultDir
+	UploadURL string // endpoint each bundle is POSTed to as a zip; empty keeps them local
+	Config    any    // the tool's config, written sanitized
+}
+
+// Info is a bundle's crash.json
+type Info struct {
+	Program   string    `json:"program"`
+	Args      []string  `json:"args"`
+	Panic     string    `json:"panic"`
+	Time      time.Time `json:"time"`
+	GoVersion string    `json:"goVersion"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	Build     string    `json:"build,omitempty"` // the main module's version
+	Documents []string  `json:"documents,omitempty"`
+}
+
+var (
+	mu     sync.Mutex
+	opts   Options
+	docs   = make(map[int]document)
+	nextID int
+)
+
+// exit ends the process once a panic is reported; tests replace it
+var exit = os.Exit
+
+// document is an open document and how to save it as it is
+type document struct {
+	name string
+	save func() ([]byte, error)
+}
+
+// Configure sets how crashes are reported from then on
+func Configure(o Options) {
+	mu.Lock()
+	defer mu.Unlock()
+	opts = o
+}
+
+// Open has bundles save a document the tool has open, by save, under
+// name, until the returned func closes it again
+func Open(name string, save func() ([]byte, error)) (close func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	id := nextID
+	nextID++
+	docs[id] = document{name: name, save: save}
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(docs, id)
+	}
+}
+
+// Recover, deferred, reports a panic of the goroutine it's deferred in: it
+// writes a bundle, uploads it when there's somewhere to, says where it is
+// and exits with status 2 as an unrecovered panic would
+func Recover() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	report(v, debug.Stack())
+	exit(2)
+}
+
+// Go runs fn on a goroutine of its own that defers Recover, for the
+// goroutines a server or worker starts, whose panics main's Recover
+// never sees
+func Go(fn func()) {
+	go func() {
+		defer Recover()
+		fn()
+	}()
+}
+
+// Handler reports a panic of h serving a request as Recover does, then
+// panics again for the server to deal with as usual, so one bad request
+// leaves a bundle without taking the server down. A handler aborting its
+// response with http.ErrAbortHandler isn't reported.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v != http.ErrAbortHandler {
+				report(v, debug.Stack())
+			}
+			panic(v)
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// report writes the bundle of a panic of v with stack, uploads it when
+// there's somewhere to, and says where it is
+func report(v any, stack []byte) {
+	fmt.Fprintf(os.Stderr, "panic: %v\n\n%s\n", v, stack)
+	dir, err := Write(v, stack)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "writing the crash report failed:", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "crash report written to", dir)
+	mu.Lock()
+	url := opts.UploadURL
+	mu.Unlock()
+	if url != "" {
+		if err := Upload(url, dir); err != nil {
+			fmt.Fprintln(os.Stderr, "uploading the crash report failed:", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "crash report uploaded to", url)
+		}
+	}
+}
+
+// Write writes the bundle of a panic of v with stack under the configured
+// directory, returning the bundle's directory. A part that can't be
+// written, such as a document failing to save, is noted in its place.
+func Write(v any, stack []byte) (string, error) {
+	mu.Lock()
+	o := opts
+	open := make([]document, 0, len(docs))
+	for _, d := range docs {
+		open = append(open, d)
+	}
+	mu.Unlock()
+	sort.Slice(open, func(i, j int) bool { return open[i].name < open[j].name })
+
+	now := time.Now().UTC()
+	program := filepath.Base(os.Args[0])
+	root := o.Dir
+	if root == "" {
+		root = DefaultDir
+	}
+	dir := filepath.Join(root, fmt.Sprintf("%s-%s-%d", program, now.Format("20060102-150405"), os.Getpid()))
+	if err := os.MkdirAll(filepath.Join(dir, DocumentsDir), 0o755); err != nil {
+		return "", err
+	}
+
+	info := Info{Program: program, Args: os.Args[1:], Panic: fmt.Sprint(v), Time: now,
+		GoVersion: runtime.Version(), OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Build = bi.Main.Version
+	}
+	files := map[string][]byte{
+		StackFile:      stack,
+		GoroutinesFile: allStacks(),
+		LogFile:        []byte(strings.Join(logging.Tail(), "\n") + "\n"),
+	}
+	if o.Config != nil {
+		cfg, err := Sanitize(o.Config)
+		if err != nil {
+			cfg = []byte(fmt.Sprintf("config not written: %v\n", err))
+		}
+		files[ConfigFile] = cfg
+	}
+	for _, d := range open {
+		name := filepath.Join(DocumentsDir, filepath.Base(d.name))
+		data, err := save(d)
+		if err != nil {
+			name, data = name+".error.txt", []byte(err.Error()+"\n")
+		}
+		files[name] = data
+		info.Documents = append(info.Documents, name)
+	}
+	raw, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	files[InfoFile] = append(raw, '\n')
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			return dir, err
+		}
+	}
+	return dir, nil
+}
+
+// save saves a document, a panic of its own as it does an error, since
+// what panicked may have left it broken
+func save(d document) (data []byte, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("saving %s panicked: %v", d.name, v)
+		}
+	}()
+	return d.save()
+}
+
+// allStacks is the stack of every goroutine
+func allStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
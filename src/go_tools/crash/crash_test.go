@@ -0,0 +1,225 @@
+package crash
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+func TestSanitize(t *testing.T) {
+	config := map[string]any{
+		"profileAgentToken":  "s3cret",
+		"authTokensFile":     "tokens.json",
+		"logLevel":           "debug",
+		"leaderboardStorage": "redis://user:pw@cache:6379/2",
+		"tracingEndpoint":    "http://localhost:4318",
+		"webhooks":           []map[string]any{{"url": "https://hooks.slack.com/services/T0/B0/xyz", "format": "slack"}},
+		"empty":              map[string]string{"dbPassword": ""},
+	}
+	raw, err := Sanitize(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(raw)
+	for _, secret := range []string{"s3cret", "pw@", "xyz", "user"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%q left in\n%s", secret, out)
+		}
+	}
+	for _, kept := range []string{`"tokens.json"`, `"debug"`, `"redis://cache:6379/[redacted]"`, `"http://localhost:4318"`, `"https://hooks.slack.com/[redacted]"`, `"dbPassword": ""`} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("%s not kept in\n%s", kept, out)
+		}
+	}
+}
+
+func TestSanitizeRedactsTheConfigsSecrets(t *testing.T) {
+	config := utils.DefaultConfig()
+	config.AnonymizeSalt = "pepper-8f2c"
+	config.ProfileAgentToken = "agent-77"
+	config.TLSKeyFile = "certs/server.key"
+	config.PackKeysFile = "keys/packs.json"
+	raw, err := Sanitize(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(raw)
+	for _, secret := range []string{"pepper-8f2c", "agent-77"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%q left in the config", secret)
+		}
+	}
+	for _, kept := range []string{`"anonymizeSalt": "[redacted]"`, `"certs/server.key"`, `"keys/packs.json"`} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("%s not in\n%s", kept, out)
+		}
+	}
+
+	// Without a tag, names still tell: key on its own, not in keysDir
+	raw, err = Sanitize(map[string]string{"signingKey": "k1", "api_key": "k2", "keysDir": "keys", "monkeyName": "bubbles", "hashSalt": "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = string(raw)
+	for _, secret := range []string{"k1", "k2", `"s"`} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%s left in\n%s", secret, out)
+		}
+	}
+	for _, kept := range []string{`"keys"`, `"bubbles"`} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("%s not kept in\n%s", kept, out)
+		}
+	}
+}
+
+func TestWriteAndUpload(t *testing.T) {
+	dir := t.TempDir()
+	Configure(Options{Dir: dir, Config: map[string]string{"apiToken": "s3cret"}})
+	defer Configure(Options{})
+	defer Open("level.json", func() ([]byte, error) { return []byte(`{"name":"open"}`), nil })()
+	closed := Open("closed.json", func() ([]byte, error) { return nil, nil })
+	closed()
+	defer Open("broken.json", func() ([]byte, error) { return nil, errors.New("half written") })()
+
+	bundle, err := Write("index out of range", []byte("goroutine 1 [running]:\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(bundle) != dir {
+		t.Errorf("bundle written to %s", bundle)
+	}
+	var info Info
+	raw, _ := os.ReadFile(filepath.Join(bundle, InfoFile))
+	if err := json.Unmarshal(raw, &info); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(DocumentsDir, "broken.json.error.txt"), filepath.Join(DocumentsDir, "level.json")}
+	if info.Panic != "index out of range" || strings.Join(info.Documents, ",") != strings.Join(want, ",") {
+		t.Errorf("info = %+v", info)
+	}
+	for name, want := range map[string]string{
+		StackFile:      "goroutine 1",
+		GoroutinesFile: "TestWriteAndUpload",
+		ConfigFile:     Redacted,
+		filepath.Join(DocumentsDir, "level.json"): `"open"`,
+	} {
+		data, err := os.ReadFile(filepath.Join(bundle, name))
+		if err != nil || !strings.Contains(string(data), want) {
+			t.Errorf("%s = %q %v, want it to have %q", name, data, err, want)
+		}
+	}
+
+	var got *zip.Reader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Crash-Bundle") != filepath.Base(bundle) {
+			http.Error(w, "unnamed bundle", http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		var err error
+		if got, err = zip.NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	if err := Upload(srv.URL, bundle); err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, f := range got.File {
+		names[f.Name] = true
+	}
+	if !names[InfoFile] || !names[LogFile] || !names[DocumentsDir+"/level.json"] {
+		t.Errorf("uploaded %v", names)
+	}
+	if err := Upload(srv.URL, t.TempDir()); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("refused upload: %v", err)
+	}
+}
+
+// bundles lists the bundles written under dir
+func bundles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestGoReportsAGoroutinesPanic(t *testing.T) {
+	dir := t.TempDir()
+	Configure(Options{Dir: dir})
+	defer Configure(Options{})
+	exited := make(chan int, 1)
+	exit = func(code int) { exited <- code }
+	defer func() { exit = os.Exit }()
+
+	Go(func() { panic("worker broke") })
+	if code := <-exited; code != 2 {
+		t.Errorf("exited %d, want 2", code)
+	}
+	found := bundles(t, dir)
+	if len(found) != 1 {
+		t.Fatalf("bundles %v", found)
+	}
+	stack, _ := os.ReadFile(filepath.Join(dir, found[0], StackFile))
+	if !strings.Contains(string(stack), "TestGoReportsAGoroutinesPanic") {
+		t.Errorf("the stack isn't the panicking goroutine's:\n%s", stack)
+	}
+}
+
+func TestHandlerReportsAndKeepsServing(t *testing.T) {
+	dir := t.TempDir()
+	Configure(Options{Dir: dir})
+	defer Configure(Options{})
+	srv := httptest.NewUnstartedServer(Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/panic":
+			panic("handler broke")
+		case "/abort":
+			panic(http.ErrAbortHandler)
+		}
+		io.WriteString(w, "ok")
+	})))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.Start()
+	defer srv.Close()
+
+	for _, path := range []string{"/panic", "/abort"} {
+		if resp, err := http.Get(srv.URL + path); err == nil {
+			resp.Body.Close()
+			t.Errorf("%s answered %s", path, resp.Status)
+		}
+	}
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatalf("the server stopped serving: %v", err)
+	}
+	resp.Body.Close()
+	found := bundles(t, dir)
+	if len(found) != 1 {
+		t.Fatalf("bundles %v, want one for the panic and none for the abort", found)
+	}
+	var info Info
+	raw, _ := os.ReadFile(filepath.Join(dir, found[0], InfoFile))
+	if err := json.Unmarshal(raw, &info); err != nil || info.Panic != "handler broke" {
+		t.Errorf("info %+v, %v", info, err)
+	}
+}
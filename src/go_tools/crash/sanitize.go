@@ -0,0 +1,140 @@
+package crash
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Redacted stands in for what Sanitize takes out
+const Redacted = "[redacted]"
+
+// secretKeys are what the names of settings holding a secret have in them
+var secretKeys = []string{"token", "secret", "password", "passwd", "apikey", "salt"}
+
+// secretWords are words that, whole, name a setting holding a secret,
+// though other names have them in them, as keysDir has key
+var secretWords = []string{"key"}
+
+// Sanitize is v as indented JSON with its secrets taken out: the strings
+// of fields tagged secret:"true", of keys naming a token, secret, salt,
+// key or password, other than files and directories of them, and of URLs,
+// which may carry credentials or, as webhooks' do, be secrets themselves,
+// all but the scheme and host
+func Sanitize(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var tree any
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return nil, err
+	}
+	secrets := make(map[string]bool)
+	secretFields(reflect.TypeOf(v), secrets, make(map[reflect.Type]bool))
+	return json.MarshalIndent(sanitize("", tree, secrets), "", "  ")
+}
+
+// secretFields adds the JSON names of t's fields tagged secret:"true", and
+// of the structs it holds, to secrets
+func secretFields(t reflect.Type, secrets map[string]bool, seen map[reflect.Type]bool) {
+	if t == nil || seen[t] {
+		return
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		secretFields(t.Elem(), secrets, seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" {
+				name = f.Name
+			}
+			if f.Tag.Get("secret") == "true" {
+				secrets[name] = true
+			}
+			secretFields(f.Type, secrets, seen)
+		}
+	}
+}
+
+func sanitize(key string, v any, secrets map[string]bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = sanitize(k, e, secrets)
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = sanitize(key, e, secrets)
+		}
+		return v
+	case string:
+		if v == "" {
+			return v
+		}
+		if secrets[key] || secretKey(key) {
+			return Redacted
+		}
+		if u, err := url.Parse(v); err == nil && u.Scheme != "" && u.Host != "" {
+			clean := u.Scheme + "://" + u.Host
+			if u.User != nil || u.Path != "" && u.Path != "/" || u.RawQuery != "" || u.Fragment != "" {
+				clean += "/" + Redacted
+			}
+			return clean
+		}
+		return v
+	}
+	return v
+}
+
+// secretKey is whether a setting of the name holds a secret
+func secretKey(key string) bool {
+	k := strings.ToLower(key)
+	if strings.HasSuffix(k, "file") || strings.HasSuffix(k, "dir") {
+		return false
+	}
+	for _, s := range secretKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	for _, w := range words(key) {
+		for _, s := range secretWords {
+			if w == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// words splits a camelCase, snake_case or kebab-case name into its
+// lower-case words
+func words(name string) []string {
+	var out []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			out = append(out, strings.ToLower(string(cur)))
+			cur = cur[:0]
+		}
+	}
+	for _, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+			continue
+		case unicode.IsUpper(r):
+			flush()
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return out
+}
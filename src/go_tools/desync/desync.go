@@ -0,0 +1,234 @@
+// Package desync hunts determinism bugs: it plays a replay on two
+// simulations frame-locked, this build's sim and another's over the tools'
+// gRPC Simulator, or the engine answering the same service, and reports
+// the first frame their states part on with what differs between them.
+package desync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"google.golang.org/grpc"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/toolspb"
+)
+
+// MaxDiffs is the most differences a Report lists
+const MaxDiffs = 20
+
+// Frame is a simulation's state after a frame of the replay
+type Frame struct {
+	Frame    int    // frames played
+	Checksum uint32 // as replays record them
+	State    []byte // JSON shaped like a sim.Snapshot without its history; may be empty
+}
+
+// Source is a simulation playing a replay. Next plays its next frame,
+// ending with io.EOF once the replay has played through.
+type Source interface {
+	Next() (Frame, error)
+}
+
+// local plays the replay on this build's sim
+type local struct {
+	r *sim.Replayer
+}
+
+// Local is the replay played on this build's sim, as PlayReplay plays it
+func Local(lvl *level.Level, r *replay.Replay, opts sim.Options) (Source, error) {
+	rp, err := sim.NewReplayer(lvl, r, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &local{r: rp}, nil
+}
+
+func (l *local) Next() (Frame, error) {
+	if l.r.Done() {
+		return Frame{}, io.EOF
+	}
+	if _, err := l.r.Step(); err != nil {
+		return Frame{}, err
+	}
+	g := l.r.Game()
+	state, err := json.Marshal(g.FrameSnapshot())
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{Frame: g.Frame(), Checksum: g.Checksum(), State: state}, nil
+}
+
+// remote reads the frames a Simulator's StepReplay streams
+type remote struct {
+	stream toolspb.Simulator_StepReplayClient
+}
+
+// Remote is the replay played by the Simulator service conn serves, on
+// the level; cancelling ctx ends its stream
+func Remote(ctx context.Context, conn grpc.ClientConnInterface, lvl, r []byte) (Source, error) {
+	stream, err := toolspb.NewSimulatorClient(conn).StepReplay(ctx, &toolspb.StepReplayRequest{Replay: r, Level: lvl, WithState: true})
+	if err != nil {
+		return nil, err
+	}
+	return &remote{stream: stream}, nil
+}
+
+func (r *remote) Next() (Frame, error) {
+	f, err := r.stream.Recv()
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{Frame: int(f.Frame), Checksum: f.Checksum, State: f.State}, nil
+}
+
+// Diff is a value the two states differ in
+type Diff struct {
+	Path string // in the state's JSON, as players[0].board[19][3].type
+	A, B string // the value in each, as JSON; empty where it is missing
+}
+
+// Report is how two simulations of a replay compare
+type Report struct {
+	Frames    int  // played alike
+	Diverged  bool // on the frame after Frames
+	ChecksumA uint32
+	ChecksumB uint32
+	Diffs     []Diff // of the first diverged frame's states, at most MaxDiffs
+	More      int    // differences past Diffs
+	Ended     string // "a" or "b" when that one ended first, without diverging before
+}
+
+// Compare plays a and b a frame at a time until they part or both end. A
+// frame diverges when either its number or its checksum differ, or, the
+// checksums leaving some state out, the states do.
+func Compare(a, b Source) (Report, error) {
+	var rep Report
+	for {
+		fa, errA := a.Next()
+		fb, errB := b.Next()
+		endA, endB := errors.Is(errA, io.EOF), errors.Is(errB, io.EOF)
+		switch {
+		case errA != nil && !endA:
+			return rep, fmt.Errorf("a: frame %d: %w", rep.Frames+1, errA)
+		case errB != nil && !endB:
+			return rep, fmt.Errorf("b: frame %d: %w", rep.Frames+1, errB)
+		case endA && endB:
+			return rep, nil
+		case endA:
+			rep.Ended = "a"
+			return rep, nil
+		case endB:
+			rep.Ended = "b"
+			return rep, nil
+		}
+		diffs, more, err := diffStates(fa.State, fb.State)
+		if err != nil {
+			return rep, fmt.Errorf("frame %d: %w", rep.Frames+1, err)
+		}
+		if fa.Frame != fb.Frame {
+			diffs = append([]Diff{{Path: "frame", A: strconv.Itoa(fa.Frame), B: strconv.Itoa(fb.Frame)}}, diffs...)
+		}
+		if fa.Checksum != fb.Checksum || len(diffs) > 0 {
+			rep.Diverged, rep.ChecksumA, rep.ChecksumB = true, fa.Checksum, fb.Checksum
+			rep.Diffs, rep.More = diffs, more
+			if len(rep.Diffs) > MaxDiffs {
+				rep.More += len(rep.Diffs) - MaxDiffs
+				rep.Diffs = rep.Diffs[:MaxDiffs]
+			}
+			return rep, nil
+		}
+		rep.Frames++
+	}
+}
+
+// diffStates are the values two states' JSON differ in, the first
+// MaxDiffs of them and how many more; none when either is empty
+func diffStates(a, b []byte) ([]Diff, int, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return nil, 0, nil
+	}
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		return nil, 0, fmt.Errorf("a: state: %w", err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return nil, 0, fmt.Errorf("b: state: %w", err)
+	}
+	d := &differ{}
+	d.diff("", va, vb)
+	return d.diffs, d.more, nil
+}
+
+// differ collects the differences of two JSON values
+type differ struct {
+	diffs []Diff
+	more  int
+}
+
+func (d *differ) diff(path string, a, b any) {
+	ma, okA := a.(map[string]any)
+	mb, okB := b.(map[string]any)
+	if okA && okB {
+		keys := make(map[string]bool)
+		for k := range ma {
+			keys[k] = true
+		}
+		for k := range mb {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			d.diff(p, ma[k], mb[k])
+		}
+		return
+	}
+	sa, okA := a.([]any)
+	sb, okB := b.([]any)
+	if okA && okB {
+		for i := 0; i < max(len(sa), len(sb)); i++ {
+			var ea, eb any
+			if i < len(sa) {
+				ea = sa[i]
+			}
+			if i < len(sb) {
+				eb = sb[i]
+			}
+			d.diff(path+"["+strconv.Itoa(i)+"]", ea, eb)
+		}
+		return
+	}
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+	if len(d.diffs) == MaxDiffs {
+		d.more++
+		return
+	}
+	d.diffs = append(d.diffs, Diff{Path: path, A: jsonOf(a), B: jsonOf(b)})
+}
+
+// jsonOf is v as JSON, empty for a missing value
+func jsonOf(v any) string {
+	if v == nil {
+		return ""
+	}
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
@@ -0,0 +1,81 @@
+package desync
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// played is a replay of a piece placed every few frames on an open level
+func played(t *testing.T) (*level.Level, *replay.Replay) {
+	t.Helper()
+	lvl := level.New("open", 8, 12)
+	lvl.SpawnPoints = []level.Point{{X: 4, Y: 0}}
+	g, err := sim.New(lvl, sim.Options{Seed: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for col := 0; !g.Over() && g.Frame() < 300; col++ {
+		g.Tick()
+		if st, _ := g.State("p1"); st.Piece != nil && g.Frame()%10 == 0 {
+			g.Place("p1", col%6, col%4)
+		}
+	}
+	return lvl, g.Replay("s")
+}
+
+// shifted is a source whose frame's state has its score bumped on one
+// frame, as a build scoring a clear differently would
+type shifted struct {
+	Source
+	at int
+}
+
+func (s shifted) Next() (Frame, error) {
+	f, err := s.Source.Next()
+	if err == nil && f.Frame == s.at {
+		f.State = bytes.Replace(f.State, []byte(`"score":`), []byte(`"score":1`), 1)
+	}
+	return f, err
+}
+
+func TestCompare(t *testing.T) {
+	lvl, r := played(t)
+	source := func() Source {
+		src, err := Local(lvl, r, sim.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return src
+	}
+
+	rep, err := Compare(source(), source())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Diverged || rep.Ended != "" || rep.Frames < 100 {
+		t.Errorf("the same build: %+v", rep)
+	}
+
+	rep, err = Compare(source(), shifted{source(), 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Diverged || rep.Frames != 39 || len(rep.Diffs) != 1 || rep.Diffs[0].Path != "players[0].score" {
+		t.Errorf("a bumped score: %+v", rep)
+	}
+
+	short := *r
+	short.Inputs = r.Inputs[:len(r.Inputs)/2]
+	short.Result.DurationMs = 0
+	b, err := Local(lvl, &short, sim.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep, err = Compare(source(), b); err != nil || rep.Diverged || rep.Ended != "b" {
+		t.Errorf("a replay cut short: %+v, %v", rep, err)
+	}
+}
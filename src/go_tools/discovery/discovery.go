@@ -0,0 +1,380 @@
+// Package discovery finds the game's and the tools' servers on the local
+// network, so a tool is pointed at "the relay" or "the profiling agent"
+// rather than a host and port typed in each time. A process advertises
+// its services by answering queries on a UDP multicast group, which it
+// joins alongside any others on the machine; a browser sends a query to
+// the group and to the subnet's broadcast address, for networks that drop
+// multicast, and collects the replies for a moment. Replies are unicast
+// JSON naming each service's port, and the browser takes the host from
+// where the reply came from, so an advertiser needn't know its own
+// address.
+package discovery
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// DefaultAddr is the group and port queries go to
+const DefaultAddr = "239.255.83.84:8199"
+
+// protocol is in every datagram, so strays are told apart
+const protocol = "supertetris-discovery/1"
+
+// Defaults for BrowseOptions left zero
+const (
+	DefaultTimeout = time.Second
+	resendEvery    = 300 * time.Millisecond
+	maxDatagram    = 32 << 10
+)
+
+// Service kinds the tools advertise and look for
+const (
+	KindAgent    = "agent"    // a profiling agent, for profile attach and watch
+	KindAnalysis = "analysis" // analyze -serve's REST API
+	KindJobs     = "jobs"     // the batch job queue, for workers and submitters
+	KindRelay    = "relay"    // a relay to play through, for bots
+	KindSync     = "sync"     // the editor and game live sync hub
+)
+
+// Service is one server a process advertises
+type Service struct {
+	Kind   string            `json:"kind"`
+	Name   string            `json:"name"`           // for people choosing between several
+	Scheme string            `json:"scheme"`         // of its URL: http or ws
+	Port   int               `json:"port"`           // on the advertiser's host
+	Path   string            `json:"path,omitempty"` // of its URL
+	Meta   map[string]string `json:"meta,omitempty"`
+}
+
+// Found is a service a browse found
+type Found struct {
+	Service
+	Instance string    `json:"instance"` // of the advertising process, the same for each of its services
+	Host     string    `json:"host"`     // the machine's name, as it gave it
+	Addr     string    `json:"addr"`     // host:port, the host where its reply came from
+	URL      string    `json:"url"`
+	Started  time.Time `json:"started"`
+}
+
+type query struct {
+	Protocol string   `json:"protocol"`
+	ID       string   `json:"id"`
+	Kinds    []string `json:"kinds,omitempty"` // wanted; none for every kind
+}
+
+type reply struct {
+	Protocol string    `json:"protocol"`
+	ID       string    `json:"id"` // of the query answered
+	Instance string    `json:"instance"`
+	Host     string    `json:"host"`
+	Started  time.Time `json:"started"`
+	Services []Service `json:"services"`
+}
+
+// Advertiser answers queries for a process's services
+type Advertiser struct {
+	conn     net.PacketConn
+	instance string
+	host     string
+	started  time.Time
+	done     chan struct{}
+
+	mu       sync.Mutex
+	services []Service
+}
+
+// FromConfig advertises as the config's discovery settings say, or
+// returns nil, which advertises nothing, when they turn it off
+func FromConfig(config utils.Config) (*Advertiser, error) {
+	if !config.DiscoveryAdvertise {
+		return nil, nil
+	}
+	return Advertise(config.DiscoveryAddr)
+}
+
+// Advertise answers queries arriving at addr, DefaultAddr when empty: a
+// multicast group it joins, or a unicast address it listens on
+func Advertise(addr string) (*Advertiser, error) {
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	udp, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.PacketConn
+	if udp.IP.IsMulticast() {
+		conn, err = net.ListenMulticastUDP("udp4", nil, udp)
+	} else {
+		conn, err = net.ListenUDP("udp4", udp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	host, _ := os.Hostname()
+	a := &Advertiser{conn: conn, instance: newID(), host: host, started: time.Now().UTC(), done: make(chan struct{})}
+	crash.Go(a.serve)
+	return a, nil
+}
+
+// Addr is where the advertiser listens
+func (a *Advertiser) Addr() net.Addr {
+	return a.conn.LocalAddr()
+}
+
+// Add advertises a service until the returned func is called
+func (a *Advertiser) Add(s Service) (remove func()) {
+	if a == nil {
+		return func() {}
+	}
+	a.mu.Lock()
+	a.services = append(a.services, s)
+	a.mu.Unlock()
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		for i, other := range a.services {
+			if other.Kind == s.Kind && other.Name == s.Name && other.Port == s.Port && other.Path == s.Path {
+				a.services = slices.Delete(a.services, i, i+1)
+				break
+			}
+		}
+	}
+}
+
+// AddListen advertises a service serving on a listen address like
+// :8097; one on a loopback address can't be reached from the network and
+// isn't advertised
+func (a *Advertiser) AddListen(addr string, s Service) (remove func()) {
+	port, public := ListenPort(addr)
+	if !public {
+		return func() {}
+	}
+	s.Port = port
+	return a.Add(s)
+}
+
+// Close stops answering; a nil advertiser closes as nothing
+func (a *Advertiser) Close() error {
+	if a == nil {
+		return nil
+	}
+	err := a.conn.Close()
+	<-a.done
+	return err
+}
+
+func (a *Advertiser) serve() {
+	defer close(a.done)
+	buf := make([]byte, maxDatagram)
+	for {
+		n, from, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		var q query
+		if json.Unmarshal(buf[:n], &q) != nil || q.Protocol != protocol {
+			continue
+		}
+		rep := reply{Protocol: protocol, ID: q.ID, Instance: a.instance, Host: a.host, Started: a.started}
+		a.mu.Lock()
+		for _, s := range a.services {
+			if len(q.Kinds) == 0 || slices.Contains(q.Kinds, s.Kind) {
+				rep.Services = append(rep.Services, s)
+			}
+		}
+		a.mu.Unlock()
+		if len(rep.Services) == 0 {
+			continue
+		}
+		if data, err := json.Marshal(rep); err == nil {
+			a.conn.WriteTo(data, from)
+		}
+	}
+}
+
+// BrowseOptions tune a browse
+type BrowseOptions struct {
+	Addr    string        // queried, DefaultAddr when empty; the broadcast address on its port too, for a group
+	Kinds   []string      // wanted; none for every kind
+	Timeout time.Duration // waiting for replies
+}
+
+// Browse queries for services and returns those that answered within
+// the timeout, or until ctx is done, by kind, name and address
+func Browse(ctx context.Context, opts BrowseOptions) ([]Found, error) {
+	if opts.Addr == "" {
+		opts.Addr = DefaultAddr
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	target, err := net.ResolveUDPAddr("udp4", opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	targets := []*net.UDPAddr{target}
+	if target.IP.IsMulticast() {
+		targets = append(targets, &net.UDPAddr{IP: net.IPv4bcast, Port: target.Port})
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	defer conn.Close()
+	q := query{Protocol: protocol, ID: newID(), Kinds: opts.Kinds}
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	seen := map[string]Found{}
+	buf := make([]byte, maxDatagram)
+	var sent error
+	for next := time.Now(); ctx.Err() == nil; {
+		if !time.Now().Before(next) && next.Before(deadline) {
+			// datagrams get lost; the same query again is answered again.
+			// Only the first target's failure counts: a network without
+			// broadcast still has the group.
+			_, sent = conn.WriteToUDP(data, targets[0])
+			for _, t := range targets[1:] {
+				conn.WriteToUDP(data, t)
+			}
+			next = next.Add(resendEvery)
+		}
+		wait := next
+		if deadline.Before(wait) {
+			wait = deadline
+		}
+		conn.SetReadDeadline(wait)
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil || !time.Now().Before(deadline) {
+				break
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return nil, fmt.Errorf("discovery: %w", err)
+		}
+		var r reply
+		if json.Unmarshal(buf[:n], &r) != nil || r.Protocol != protocol || r.ID != q.ID {
+			continue
+		}
+		for _, s := range r.Services {
+			f := found(r, s, from.IP)
+			seen[f.Instance+" "+f.URL] = f
+		}
+	}
+	if sent != nil && len(seen) == 0 {
+		return nil, fmt.Errorf("discovery: %w", sent)
+	}
+	out := make([]Found, 0, len(seen))
+	for _, f := range seen {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Addr < b.Addr
+	})
+	return out, nil
+}
+
+func found(r reply, s Service, ip net.IP) Found {
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(s.Port))
+	scheme := s.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return Found{Service: s, Instance: r.Instance, Host: r.Host, Addr: addr, URL: scheme + "://" + addr + s.Path, Started: r.Started}
+}
+
+// ErrNotFound is a Find nothing answered
+var ErrNotFound = errors.New("discovery: nothing found")
+
+// Find browses for the one service of kind, or the one named name when
+// several answer, failing when none or more than one does
+func Find(ctx context.Context, addr, kind, name string) (Found, error) {
+	all, err := Browse(ctx, BrowseOptions{Addr: addr, Kinds: []string{kind}})
+	if err != nil {
+		return Found{}, err
+	}
+	var matches []Found
+	for _, f := range all {
+		if name == "" || f.Name == name || f.Host == name {
+			matches = append(matches, f)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		if name != "" {
+			return Found{}, fmt.Errorf("%w: no %s %s on the network", ErrNotFound, kind, name)
+		}
+		return Found{}, fmt.Errorf("%w: no %s on the network", ErrNotFound, kind)
+	case 1:
+		return matches[0], nil
+	}
+	var names []string
+	for _, f := range matches {
+		names = append(names, fmt.Sprintf("%s (%s at %s)", f.Name, f.Host, f.URL))
+	}
+	return Found{}, fmt.Errorf("discovery: %d %s services answered, pick one: %s", len(matches), kind, strings.Join(names, ", "))
+}
+
+// ListenPort is the port of a listen address like :8097, and whether it
+// is reachable from other machines, which a loopback address isn't
+func ListenPort(addr string) (int, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	if host == "localhost" {
+		return n, false
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return n, false
+	}
+	return n, true
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBrowseFindsAdvertisedServices(t *testing.T) {
+	// unicast on loopback, as the sandbox may have no multicast route
+	a, err := Advertise("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.Add(Service{Kind: KindRelay, Name: "dev relay", Port: 8097})
+	removeAgent := a.Add(Service{Kind: KindAgent, Name: "analysis", Scheme: "ws", Port: 8090, Path: "/debug/profile/agent"})
+	addr := a.Addr().String()
+
+	ctx := context.Background()
+	all, err := Browse(ctx, BrowseOptions{Addr: addr, Timeout: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].Kind != KindAgent || all[1].Kind != KindRelay {
+		t.Fatalf("found %+v", all)
+	}
+	if all[0].URL != "ws://127.0.0.1:8090/debug/profile/agent" || all[1].URL != "http://127.0.0.1:8097" || all[0].Instance != all[1].Instance {
+		t.Errorf("found %+v", all)
+	}
+
+	relay, err := Find(ctx, addr, KindRelay, "")
+	if err != nil || relay.Name != "dev relay" {
+		t.Errorf("find relay: %+v %v", relay, err)
+	}
+	removeAgent()
+	if _, err := Find(ctx, addr, KindAgent, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("a removed service was found: %v", err)
+	}
+
+	// a second relay makes a bare find ambiguous
+	a.Add(Service{Kind: KindRelay, Name: "other relay", Port: 9097})
+	if _, err := Find(ctx, addr, KindRelay, ""); err == nil || !strings.Contains(err.Error(), "pick one") {
+		t.Errorf("ambiguous find: %v", err)
+	}
+	if f, err := Find(ctx, addr, KindRelay, "other relay"); err != nil || f.Port != 9097 {
+		t.Errorf("find by name: %+v %v", f, err)
+	}
+}
+
+func TestListenPort(t *testing.T) {
+	for addr, want := range map[string]bool{":8097": true, "0.0.0.0:8097": true, "127.0.0.1:8097": false, "localhost:8097": false} {
+		if port, public := ListenPort(addr); port != 8097 || public != want {
+			t.Errorf("%s: %d %v", addr, port, public)
+		}
+	}
+	if port, _ := ListenPort("nonsense"); port != 0 {
+		t.Errorf("nonsense: %d", port)
+	}
+}
@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+)
+
+// Shape is a block shape as the engine's BlockShape holds it: the cells
+// of its box by row from the top, in spawn orientation
+type Shape struct {
+	BlockType string   `json:"block_type"`
+	Cells     [][]bool `json:"cells"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+}
+
+// Blocks are block definitions: the shapes of the pieces and the physics
+// of the blocks of each special kind
+type Blocks struct {
+	Shapes    []Shape             `json:"shapes"`
+	Materials map[string]Material `json:"materials"`
+}
+
+// ExportBlocks is the tools' block definitions for the engine: the
+// pieces' shapes as the client spawns them and the Materials
+func ExportBlocks() Blocks {
+	b := Blocks{Materials: Materials}
+	for _, t := range level.BlockTypes {
+		cells, _ := pieces.Cells(t, 0)
+		size := 0
+		for _, c := range cells {
+			size = max(size, c.X+1, c.Y+1)
+		}
+		s := Shape{BlockType: t, Cells: make([][]bool, size), Width: size, Height: size}
+		for y := range s.Cells {
+			s.Cells[y] = make([]bool, size)
+		}
+		for _, c := range cells {
+			s.Cells[c.Y][c.X] = true
+		}
+		b.Shapes = append(b.Shapes, s)
+	}
+	return b
+}
+
+// CompareBlocks is how the engine's block definitions differ from the
+// tools', which are code rather than data: none when the engine builds
+// the boards and pieces the tools check and simulate
+func CompareBlocks(engine Blocks) []string {
+	ours := ExportBlocks()
+	var diffs []string
+	byType := make(map[string]Shape, len(engine.Shapes))
+	for _, s := range engine.Shapes {
+		byType[s.BlockType] = s
+	}
+	for _, s := range ours.Shapes {
+		theirs, ok := byType[s.BlockType]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("shape %s: missing", s.BlockType))
+		case !sameCells(s, theirs):
+			diffs = append(diffs, fmt.Sprintf("shape %s: %v, the tools' %v", s.BlockType, theirs.Cells, s.Cells))
+		}
+		delete(byType, s.BlockType)
+	}
+	for _, t := range sortedKeys(byType) {
+		if t != BlockSpecial {
+			diffs = append(diffs, fmt.Sprintf("shape %s: the tools have no such piece", t))
+		}
+	}
+	for _, kind := range sortedKeys(ours.Materials) {
+		theirs, ok := engine.Materials[kind]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("material %q: missing", kind))
+		case theirs != ours.Materials[kind]:
+			diffs = append(diffs, fmt.Sprintf("material %q: %+v, the tools' %+v", kind, theirs, ours.Materials[kind]))
+		}
+	}
+	for _, kind := range sortedKeys(engine.Materials) {
+		if _, ok := ours.Materials[kind]; !ok {
+			diffs = append(diffs, fmt.Sprintf("material %q: the tools have no such special kind", kind))
+		}
+	}
+	return diffs
+}
+
+// sameCells is whether two shapes cover the same cells of their boxes
+func sameCells(a, b Shape) bool {
+	return a.Width == b.Width && a.Height == b.Height && slices.EqualFunc(a.Cells, b.Cells, slices.Equal[[]bool])
+}
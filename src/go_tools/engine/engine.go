@@ -0,0 +1,140 @@
+// Package engine bridges the tools' formats and the game engine's, the
+// dicts python_logic's game_logic.py writes with to_dict and reads with
+// from_dict: levels become its boards and boards levels, the spell tables
+// the simulation resolves casts by its spell lists, play rules and
+// scoring its GameConstants, and the pieces and special blocks its block
+// shapes and physics. Each conversion round-trips what both sides hold,
+// and refuses what one can't say rather than guessing.
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// BlockSpecial is the engine's block type for blocks of no tetromino
+const BlockSpecial = "SPECIAL"
+
+// Vec is a position or velocity as the engine writes them
+type Vec struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Block is a block as the engine's Block.to_dict writes it
+type Block struct {
+	ID              int     `json:"id"`
+	BlockType       string  `json:"block_type"` // I to Z, or BlockSpecial
+	Position        Vec     `json:"position"`
+	Rotation        int     `json:"rotation"` // degrees clockwise
+	Angle           float64 `json:"angle"`    // radians
+	Velocity        Vec     `json:"velocity"`
+	AngularVelocity float64 `json:"angular_velocity"`
+	Density         float64 `json:"density"`
+	Friction        float64 `json:"friction"`
+	Restitution     float64 `json:"restitution"`
+	IsActive        bool    `json:"is_active"`
+	IsStatic        bool    `json:"is_static"`
+	IsPlaced        bool    `json:"is_placed"`
+	PlayerID        *string `json:"player_id"`
+	// the level's special kind, which from_dict passes over and to_dict
+	// leaves out, so boards the engine saves keep only its Material
+	Special string `json:"special,omitempty"`
+}
+
+// Board is a board as the engine's GameBoard.to_dict writes it: its cells
+// by row from the top, each the ID of the block covering it or null, and
+// its blocks by ID
+type Board struct {
+	Width  int              `json:"width"`
+	Height int              `json:"height"`
+	Cells  [][]*int         `json:"cells"`
+	Blocks map[string]Block `json:"blocks"`
+}
+
+// Material is a block's physics in the engine
+type Material struct {
+	Density     float64 `json:"density"`
+	Friction    float64 `json:"friction"`
+	Restitution float64 `json:"restitution"`
+}
+
+// Materials are the engine physics of the special kinds of block, a
+// plain block's under "", as the engine's GameConstants has it
+var Materials = map[string]Material{
+	"":                 {Density: 1.0, Friction: 0.3, Restitution: 0.2},
+	level.SpecialBomb:  {Density: 1.0, Friction: 0.3, Restitution: 0.2},
+	level.SpecialIce:   {Density: 1.0, Friction: 0.05, Restitution: 0.2},
+	level.SpecialHeavy: {Density: 3.0, Friction: 0.3, Restitution: 0.1},
+}
+
+// ExportLevel is the level's terrain as an engine board, each block a
+// placed static block of its cell. What boards don't hold, such as spawn
+// points, objectives and pickups, stays behind.
+func ExportLevel(l *level.Level) (*Board, error) {
+	w, h := l.GridSize.Width, l.GridSize.Height
+	b := &Board{Width: w, Height: h, Cells: make([][]*int, h), Blocks: make(map[string]Block, len(l.Blocks))}
+	for y := range b.Cells {
+		b.Cells[y] = make([]*int, w)
+	}
+	for i, blk := range l.Blocks {
+		if blk.X < 0 || blk.X >= w || blk.Y < 0 || blk.Y >= h {
+			return nil, fmt.Errorf("level %q: block %d at (%d, %d) is off its %dx%d grid", l.Name, i, blk.X, blk.Y, w, h)
+		}
+		if b.Cells[blk.Y][blk.X] != nil {
+			return nil, fmt.Errorf("level %q: two blocks at (%d, %d)", l.Name, blk.X, blk.Y)
+		}
+		m, ok := Materials[blk.Special]
+		if !ok {
+			return nil, fmt.Errorf("level %q: block %d is of special kind %q, which the engine has no physics for", l.Name, i, blk.Special)
+		}
+		id := i + 1
+		b.Cells[blk.Y][blk.X] = &id
+		b.Blocks[strconv.Itoa(id)] = Block{ID: id, BlockType: blk.Type, Position: Vec{X: float64(blk.X), Y: float64(blk.Y)},
+			Density: m.Density, Friction: m.Friction, Restitution: m.Restitution,
+			IsActive: true, IsStatic: true, IsPlaced: true, Special: blk.Special}
+	}
+	return b, nil
+}
+
+// ImportLevel is an engine board as a level of the name: a block for each
+// cell covered, of the type of the block covering it, row by row from the
+// top
+func ImportLevel(name string, b *Board) (*level.Level, error) {
+	if b.Width <= 0 || b.Height <= 0 || len(b.Cells) != b.Height {
+		return nil, fmt.Errorf("board %s: %d rows of cells for a %dx%d board", name, len(b.Cells), b.Width, b.Height)
+	}
+	l := level.New(name, b.Width, b.Height)
+	for y, row := range b.Cells {
+		if len(row) != b.Width {
+			return nil, fmt.Errorf("board %s: row %d has %d cells, want %d", name, y, len(row), b.Width)
+		}
+		for x, id := range row {
+			if id == nil {
+				continue
+			}
+			blk, ok := b.Blocks[strconv.Itoa(*id)]
+			if !ok {
+				return nil, fmt.Errorf("board %s: cell (%d, %d) is of block %d, which it doesn't have", name, x, y, *id)
+			}
+			if blk.BlockType == BlockSpecial {
+				return nil, fmt.Errorf("board %s: block %d is %s, which levels have no type for", name, *id, BlockSpecial)
+			}
+			l.Blocks = append(l.Blocks, level.Block{Type: blk.BlockType, X: x, Y: y, Special: blk.Special})
+		}
+	}
+	return l, nil
+}
+
+// sortedKeys are a map's keys in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
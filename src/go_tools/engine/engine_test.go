@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+func TestLevelRoundTrip(t *testing.T) {
+	l := level.New("terrain", 6, 8)
+	l.Blocks = []level.Block{{Type: "I", X: 0, Y: 7}, {Type: "T", X: 5, Y: 7, Special: level.SpecialBomb},
+		{Type: "O", X: 2, Y: 6, Special: level.SpecialIce}, {Type: "S", X: 3, Y: 0, Special: level.SpecialHeavy}}
+	b, err := ExportLevel(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read Board
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ImportLevel("terrain", &read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]level.Block(nil), l.Blocks...)
+	sort.Slice(want, func(i, j int) bool {
+		return want[i].Y < want[j].Y || want[i].Y == want[j].Y && want[i].X < want[j].X
+	})
+	if !reflect.DeepEqual(got.Blocks, want) || got.GridSize != l.GridSize {
+		t.Errorf("imported %+v, want %+v", got.Blocks, want)
+	}
+	if b.Blocks["3"].Friction != Materials[level.SpecialIce].Friction {
+		t.Errorf("ice block exported as %+v", b.Blocks["3"])
+	}
+
+	l.Blocks = append(l.Blocks, level.Block{Type: "I", X: 0, Y: 7})
+	if _, err := ExportLevel(l); err == nil {
+		t.Error("no error exporting two blocks in a cell")
+	}
+}
+
+func TestImportEngineBoard(t *testing.T) {
+	// a T the engine placed covers four cells with one block
+	one := 1
+	b := &Board{Width: 3, Height: 2, Cells: [][]*int{{&one, &one, &one}, {nil, &one, nil}},
+		Blocks: map[string]Block{"1": {ID: 1, BlockType: "T", IsPlaced: true}}}
+	l, err := ImportLevel("t", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Blocks) != 4 || l.Blocks[3] != (level.Block{Type: "T", X: 1, Y: 1}) {
+		t.Errorf("imported %+v", l.Blocks)
+	}
+	b.Blocks["1"] = Block{ID: 1, BlockType: BlockSpecial}
+	if _, err := ImportLevel("t", b); err == nil {
+		t.Error("no error importing a special block")
+	}
+}
+
+func TestSpellsRoundTrip(t *testing.T) {
+	book := sim.DefaultSpellbook()
+	var name string
+	for name = range book {
+		break
+	}
+	base := []Spell{{ID: "custom", Name: name, Cooldown: 12, ManaCost: 30, Description: "kept", IconPath: "icons/x.png"}}
+	spells := ExportSpells(book, base)
+	if len(spells) != len(book) {
+		t.Fatalf("exported %d spells of %d", len(spells), len(book))
+	}
+	for _, s := range spells {
+		if s.Name == name && (s.ID != "custom" || s.Cooldown != 12 || s.ManaCost != 30 || s.Description != "kept") {
+			t.Errorf("engine fields of %s lost: %+v", name, s)
+		}
+	}
+	got, err := ImportSpells(spells)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, book) {
+		t.Errorf("imported %+v, want %+v", got, book)
+	}
+
+	wind := []Spell{{Name: "gust", SpellType: SpellDark, Effect: "wind", TargetType: sim.TargetOpponent, Strength: 2}}
+	if _, err := ImportSpells(wind); err == nil {
+		t.Error("no error importing a physics effect")
+	}
+}
+
+func TestRulesRoundTrip(t *testing.T) {
+	c := DefaultConstants()
+	r, s, err := ImportRules(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.Gravity); n != 400 || r.Gravity[n-1].Lines != 3990 || r.Gravity[n-1].Gravity != c.MaxFallSpeed {
+		t.Errorf("gravity curve %+v", r.Gravity)
+	}
+	if s.Clear(4, "", false) != c.PointsTetris || s.HardDrop != c.PointsHardDrop {
+		t.Errorf("scoring %+v", s)
+	}
+	got, err := ExportRules(r, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(got.InitialFallSpeed*got.SpeedIncreaseFactor, c.InitialFallSpeed*c.SpeedIncreaseFactor) {
+		t.Errorf("fall speed %g×%g, want %g×%g", got.InitialFallSpeed, got.SpeedIncreaseFactor, c.InitialFallSpeed, c.SpeedIncreaseFactor)
+	}
+	got.InitialFallSpeed, got.SpeedIncreaseFactor = c.InitialFallSpeed, c.SpeedIncreaseFactor
+	if got != c {
+		t.Errorf("exported %+v, want %+v", got, c)
+	}
+
+	// a cap short of a whole level's speed
+	c.MaxFallSpeed = 1.23
+	r, s, _ = ImportRules(c)
+	if got, err := ExportRules(r, s); err != nil || !near(got.MaxFallSpeed, 1.23) {
+		t.Errorf("capped curve exported as %+v, %v", got, err)
+	}
+
+	r.Gravity[1].Lines = 15
+	if _, err := ExportRules(r, s); err == nil || !strings.Contains(err.Error(), "step 1") {
+		t.Errorf("curve off the engine's levels: %v", err)
+	}
+}
+
+func TestCompareBlocks(t *testing.T) {
+	b := ExportBlocks()
+	if diffs := CompareBlocks(b); len(diffs) != 0 {
+		t.Errorf("the tools' own blocks differ: %v", diffs)
+	}
+	data, _ := json.Marshal(b)
+	var theirs Blocks
+	json.Unmarshal(data, &theirs)
+	theirs.Shapes[0].Cells[0][0] = !theirs.Shapes[0].Cells[0][0]
+	m := theirs.Materials[level.SpecialIce]
+	m.Friction = 0.5
+	theirs.Materials[level.SpecialIce] = m
+	if diffs := CompareBlocks(theirs); len(diffs) != 2 {
+		t.Errorf("diffs %v, want a shape's and a material's", diffs)
+	}
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// LinesPerLevel are the lines a player clears for each of the engine's
+// levels, which its fall speed climbs by
+const LinesPerLevel = 10
+
+// maxLevels bounds the gravity curve ImportRules builds
+const maxLevels = 1000
+
+// Constants are the engine's GameConstants a rule set sets: how fast a
+// piece falls, INITIAL_FALL_SPEED times SPEED_INCREASE_FACTOR times the
+// player's level, up to MAX_FALL_SPEED, and what scores
+type Constants struct {
+	InitialFallSpeed      float64 `json:"INITIAL_FALL_SPEED"`
+	SpeedIncreaseFactor   float64 `json:"SPEED_INCREASE_FACTOR"`
+	MaxFallSpeed          float64 `json:"MAX_FALL_SPEED"`
+	PointsSingleLine      int     `json:"POINTS_SINGLE_LINE"`
+	PointsDoubleLine      int     `json:"POINTS_DOUBLE_LINE"`
+	PointsTripleLine      int     `json:"POINTS_TRIPLE_LINE"`
+	PointsTetris          int     `json:"POINTS_TETRIS"`
+	PointsSoftDrop        int     `json:"POINTS_SOFT_DROP"`
+	PointsHardDrop        int     `json:"POINTS_HARD_DROP"`
+	PointsComboMultiplier int     `json:"POINTS_COMBO_MULTIPLIER"`
+}
+
+// DefaultConstants are the engine's own
+func DefaultConstants() Constants {
+	return Constants{InitialFallSpeed: 1.0, SpeedIncreaseFactor: 0.05, MaxFallSpeed: 20.0,
+		PointsSingleLine: 100, PointsDoubleLine: 300, PointsTripleLine: 500, PointsTetris: 800,
+		PointsSoftDrop: 1, PointsHardDrop: 2, PointsComboMultiplier: 50}
+}
+
+// ExportRules is the rules' gravity curve and the scoring as the engine's
+// constants. The engine's fall speed climbs by the same speed each level,
+// so the curve must too: a step every LinesPerLevel lines from none, each
+// one level's speed faster than the last, but for a last one it tops out
+// at. Scoring the engine has no constant for, such as T-spins and
+// pickups, stays behind.
+func ExportRules(r sim.Rules, s sim.Scoring) (Constants, error) {
+	c := DefaultConstants()
+	if len(r.Gravity) == 0 {
+		return c, fmt.Errorf("the engine's pieces fall faster each level; give the rules a gravity curve climbing every %d lines as it does", LinesPerLevel)
+	}
+	step := r.Gravity[0].Gravity
+	for i, g := range r.Gravity {
+		speed := step * float64(i+1)
+		last := i == len(r.Gravity)-1
+		switch {
+		case g.Lines != i*LinesPerLevel:
+			return c, fmt.Errorf("gravity step %d is at %d lines, where the engine's levels climb at %d", i, g.Lines, i*LinesPerLevel)
+		case last && i > 0 && g.Gravity > step*float64(i) && g.Gravity <= speed*(1+1e-9):
+		case !near(g.Gravity, speed):
+			return c, fmt.Errorf("gravity step %d is %g rows a second, where the engine's level %d falls at %g", i, g.Gravity, i+1, speed)
+		}
+	}
+	c.InitialFallSpeed = step / c.SpeedIncreaseFactor
+	c.MaxFallSpeed = r.Gravity[len(r.Gravity)-1].Gravity
+	c.PointsSingleLine, c.PointsDoubleLine = s.Clear(1, "", false), s.Clear(2, "", false)
+	c.PointsTripleLine, c.PointsTetris = s.Clear(3, "", false), s.Clear(4, "", false)
+	c.PointsSoftDrop, c.PointsHardDrop, c.PointsComboMultiplier = s.SoftDrop, s.HardDrop, s.Combo
+	return c, nil
+}
+
+// ImportRules is the engine's constants as rules, the game's own but for
+// a gravity curve stepping up a level's speed every LinesPerLevel lines to
+// MaxFallSpeed, and as scoring, the game's but for the engine's points
+func ImportRules(c Constants) (sim.Rules, sim.Scoring, error) {
+	r, s := sim.DefaultRules(), sim.DefaultScoring()
+	step := c.InitialFallSpeed * c.SpeedIncreaseFactor
+	if step <= 0 || c.MaxFallSpeed <= 0 {
+		return r, s, fmt.Errorf("the engine's fall speed needs a positive INITIAL_FALL_SPEED, SPEED_INCREASE_FACTOR and MAX_FALL_SPEED")
+	}
+	if c.MaxFallSpeed/step > maxLevels {
+		return r, s, fmt.Errorf("a fall speed of %g a level takes past %d levels to reach %g", step, maxLevels, c.MaxFallSpeed)
+	}
+	for n := 1; ; n++ {
+		speed := step * float64(n)
+		if speed >= c.MaxFallSpeed || near(speed, c.MaxFallSpeed) {
+			r.Gravity = append(r.Gravity, sim.GravityStep{Lines: (n - 1) * LinesPerLevel, Gravity: c.MaxFallSpeed})
+			break
+		}
+		r.Gravity = append(r.Gravity, sim.GravityStep{Lines: (n - 1) * LinesPerLevel, Gravity: speed})
+	}
+	s.Lines = []int{0, c.PointsSingleLine, c.PointsDoubleLine, c.PointsTripleLine, c.PointsTetris}
+	s.SoftDrop, s.HardDrop, s.Combo = c.PointsSoftDrop, c.PointsHardDrop, c.PointsComboMultiplier
+	if err := r.Validate(); err != nil {
+		return r, s, err
+	}
+	return r, s, s.Validate()
+}
+
+// near is whether two speeds are the same but for rounding
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b))
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Spell types of the engine's, by who a spell lands on
+const (
+	SpellLight = "LIGHT" // on its caster
+	SpellDark  = "DARK"  // on an opponent
+)
+
+// Spell is a spell as the engine's Spell.to_dict writes it
+type Spell struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	SpellType   string  `json:"spell_type"`
+	Effect      string  `json:"effect"`
+	Duration    float64 `json:"duration"` // seconds; 0 for the simulation's default of a timed effect
+	Strength    float64 `json:"strength"` // a gravity effect's scale, or the rows of those acting on rows
+	TargetType  string  `json:"target_type"`
+	Cooldown    float64 `json:"cooldown"` // seconds
+	ManaCost    int     `json:"mana_cost"`
+	Description string  `json:"description"`
+	IconPath    string  `json:"icon_path"`
+}
+
+// rowEffects are the effects whose strength is their rows
+var rowEffects = map[string]bool{sim.EffectClearLines: true, sim.EffectFreeze: true, sim.EffectGarbage: true}
+
+// ExportSpells is the spellbook as an engine spell list, by name. The
+// engine's own fields, its ID, cooldown, mana cost, description and
+// icon, are kept from the spell of the same name in base, an engine list
+// the book was imported from, so exporting edits over it loses none.
+func ExportSpells(book sim.Spellbook, base []Spell) []Spell {
+	kept := make(map[string]Spell, len(base))
+	for _, s := range base {
+		kept[s.Name] = s
+	}
+	out := make([]Spell, 0, len(book))
+	for _, name := range sortedKeys(book) {
+		s := book[name]
+		e := kept[name]
+		if e.ID == "" {
+			e.ID = strings.ToLower(name)
+		}
+		e.Name, e.Effect, e.TargetType = name, s.Effect, s.Target
+		e.SpellType = SpellLight
+		if s.Target == sim.TargetOpponent {
+			e.SpellType = SpellDark
+		}
+		e.Duration = float64(s.Frames) / sim.FrameRate
+		e.Strength = s.Scale
+		if rowEffects[s.Effect] {
+			e.Strength = float64(s.Rows)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// ImportSpells is an engine spell list as a spellbook. The engine's
+// physics effects, such as wind or grow, are an error, having nothing
+// the simulation resolves them by.
+func ImportSpells(spells []Spell) (sim.Spellbook, error) {
+	book := make(sim.Spellbook, len(spells))
+	for _, e := range spells {
+		if _, dup := book[e.Name]; dup {
+			return nil, fmt.Errorf("spell %q defined twice", e.Name)
+		}
+		if e.Duration < 0 {
+			return nil, fmt.Errorf("spell %s: negative duration", e.Name)
+		}
+		s := sim.Spell{Name: e.Name, Target: e.TargetType, Effect: e.Effect, Frames: int(math.Round(e.Duration * sim.FrameRate))}
+		switch {
+		case rowEffects[e.Effect]:
+			if e.Strength != math.Trunc(e.Strength) {
+				return nil, fmt.Errorf("spell %s: %s acts on whole rows, not %g", e.Name, e.Effect, e.Strength)
+			}
+			s.Rows = int(e.Strength)
+		case e.Effect == sim.EffectGravity:
+			s.Scale = e.Strength
+		}
+		book[e.Name] = s
+	}
+	if err := book.Validate(); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// SpellsFile is a spellbook as the simulation's spells.json has it, by
+// name
+func SpellsFile(book sim.Spellbook) any {
+	spells := make([]sim.Spell, 0, len(book))
+	for _, s := range book {
+		spells = append(spells, s)
+	}
+	sort.Slice(spells, func(i, j int) bool { return spells[i].Name < spells[j].Name })
+	return struct {
+		Spells []sim.Spell `json:"spells"`
+	}{spells}
+}
@@ -0,0 +1,222 @@
+package gamepb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// ErrNoRecord is returned converting a message a live session log has no
+// record kind for, such as chat
+var ErrNoRecord = errors.New("no replay record for the message")
+
+// The enums are named after the replay format's strings: rotate_cw is
+// ACTION_ROTATE_CW, top_out EVENT_TYPE_TOP_OUT
+
+func enumName(prefix, s string) string {
+	return prefix + strings.ToUpper(s)
+}
+
+func replayName(prefix, name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, prefix))
+}
+
+// ParseAction reads a replay action
+func ParseAction(s string) (Action, error) {
+	if v, ok := Action_value[enumName("ACTION_", s)]; ok && v != 0 {
+		return Action(v), nil
+	}
+	return 0, fmt.Errorf("unknown action %q", s)
+}
+
+// Replay is the action as the replay format writes it
+func (a Action) Replay() string { return replayName("ACTION_", a.String()) }
+
+// ParseEventType reads a replay event type
+func ParseEventType(s string) (EventType, error) {
+	if v, ok := EventType_value[enumName("EVENT_TYPE_", s)]; ok && v != 0 {
+		return EventType(v), nil
+	}
+	return 0, fmt.Errorf("unknown event type %q", s)
+}
+
+// Replay is the event type as the replay format writes it
+func (t EventType) Replay() string { return replayName("EVENT_TYPE_", t.String()) }
+
+// ParseOutcome reads a replay outcome; "" is OUTCOME_UNSPECIFIED
+func ParseOutcome(s string) (Outcome, error) {
+	if s == "" {
+		return Outcome_OUTCOME_UNSPECIFIED, nil
+	}
+	if v, ok := Outcome_value[enumName("OUTCOME_", s)]; ok && v != 0 {
+		return Outcome(v), nil
+	}
+	return 0, fmt.Errorf("unknown outcome %q", s)
+}
+
+// Replay is the outcome as the replay format writes it, "" when
+// unspecified
+func (o Outcome) Replay() string {
+	if o == Outcome_OUTCOME_UNSPECIFIED {
+		return ""
+	}
+	return replayName("OUTCOME_", o.String())
+}
+
+// FromRecord converts a live session log record
+func FromRecord(rec replay.Record) (*Message, error) {
+	if err := rec.Validate(); err != nil {
+		return nil, err
+	}
+	m := &Message{Session: rec.Session}
+	switch rec.Kind {
+	case replay.RecordStart:
+		start := &SessionStart{Level: rec.Level}
+		for _, p := range rec.Players {
+			start.Players = append(start.Players, FromPlayer(p))
+		}
+		m.Body = &Message_Start{Start: start}
+	case replay.RecordInput:
+		in, err := FromInput(*rec.Input)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = &Message_Input{Input: in}
+	case replay.RecordEvent:
+		ev, err := FromEvent(*rec.Event)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = &Message_Event{Event: ev}
+	case replay.RecordSpell:
+		m.Body = &Message_Spell{Spell: FromSpell(*rec.Spell)}
+	case replay.RecordEnd:
+		res, err := FromResult(*rec.Result)
+		if err != nil {
+			return nil, err
+		}
+		m.Body = &Message_End{End: res}
+	}
+	return m, nil
+}
+
+// Record converts the message to a live session log record; chat and the
+// relay's controls and room events have none, and are ErrNoRecord
+func (m *Message) Record() (replay.Record, error) {
+	rec := replay.Record{Session: m.GetSession()}
+	switch body := m.GetBody().(type) {
+	case *Message_Start:
+		rec.Kind, rec.Level = replay.RecordStart, body.Start.GetLevel()
+		for _, p := range body.Start.GetPlayers() {
+			rec.Players = append(rec.Players, p.Replay())
+		}
+	case *Message_Input:
+		in := body.Input.Replay()
+		rec.Kind, rec.Input = replay.RecordInput, &in
+	case *Message_Event:
+		ev := body.Event.Replay()
+		rec.Kind, rec.Event = replay.RecordEvent, &ev
+	case *Message_Spell:
+		spell := body.Spell.Replay()
+		rec.Kind, rec.Spell = replay.RecordSpell, &spell
+	case *Message_End:
+		res := body.End.Replay()
+		rec.Kind, rec.Result = replay.RecordEnd, &res
+	case *Message_Chat, *Message_Control, *Message_Room:
+		return rec, ErrNoRecord
+	default:
+		return rec, fmt.Errorf("message of session %q has no body", m.GetSession())
+	}
+	return rec, rec.Validate()
+}
+
+// FromPlayer converts a replay player
+func FromPlayer(p replay.Player) *Player {
+	return &Player{Id: p.ID, Name: p.Name, Rating: p.Rating, Address: p.Address}
+}
+
+// Replay converts the player to the replay format
+func (p *Player) Replay() replay.Player {
+	return replay.Player{ID: p.GetId(), Name: p.GetName(), Rating: p.GetRating(), Address: p.GetAddress()}
+}
+
+// FromInput converts a replay input
+func FromInput(in replay.Input) (*Input, error) {
+	action, err := ParseAction(in.Action)
+	if err != nil {
+		return nil, err
+	}
+	return &Input{Frame: int32(in.Frame), TimeMs: in.TimeMs, Player: in.Player, Action: action}, nil
+}
+
+// Replay converts the input to the replay format
+func (in *Input) Replay() replay.Input {
+	return replay.Input{Frame: int(in.GetFrame()), TimeMs: in.GetTimeMs(), Player: in.GetPlayer(), Action: in.GetAction().Replay()}
+}
+
+// FromEvent converts a replay event
+func FromEvent(e replay.Event) (*Event, error) {
+	typ, err := ParseEventType(e.Type)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{Frame: int32(e.Frame), TimeMs: e.TimeMs, Player: e.Player, Type: typ, Piece: e.Piece,
+		X: int32(e.X), Y: int32(e.Y), Rotation: int32(e.Rotation), Lines: int32(e.Lines), Score: int32(e.Score), Detail: e.Detail}, nil
+}
+
+// Replay converts the event to the replay format
+func (e *Event) Replay() replay.Event {
+	return replay.Event{Frame: int(e.GetFrame()), TimeMs: e.GetTimeMs(), Player: e.GetPlayer(), Type: e.GetType().Replay(),
+		Piece: e.GetPiece(), X: int(e.GetX()), Y: int(e.GetY()), Rotation: int(e.GetRotation()), Lines: int(e.GetLines()),
+		Score: int(e.GetScore()), Detail: e.GetDetail()}
+}
+
+// FromSpell converts a replay spell cast
+func FromSpell(s replay.SpellCast) *SpellCast {
+	return &SpellCast{Frame: int32(s.Frame), TimeMs: s.TimeMs, Player: s.Player, Spell: s.Spell, Target: s.Target}
+}
+
+// Replay converts the spell cast to the replay format
+func (s *SpellCast) Replay() replay.SpellCast {
+	return replay.SpellCast{Frame: int(s.GetFrame()), TimeMs: s.GetTimeMs(), Player: s.GetPlayer(), Spell: s.GetSpell(), Target: s.GetTarget()}
+}
+
+// FromChat converts a replay chat line
+func FromChat(c replay.ChatMessage) *Chat {
+	return &Chat{Frame: int32(c.Frame), TimeMs: c.TimeMs, Player: c.Player, Text: c.Text}
+}
+
+// Replay converts the chat line to the replay format
+func (c *Chat) Replay() replay.ChatMessage {
+	return replay.ChatMessage{Frame: int(c.GetFrame()), TimeMs: c.GetTimeMs(), Player: c.GetPlayer(), Text: c.GetText()}
+}
+
+// FromResult converts a replay result
+func FromResult(r replay.Result) (*Result, error) {
+	outcome, err := ParseOutcome(r.Outcome)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Winner: r.Winner, DurationMs: r.DurationMs, Outcome: outcome}
+	if len(r.Scores) > 0 {
+		res.Scores = make(map[string]int32, len(r.Scores))
+		for p, s := range r.Scores {
+			res.Scores[p] = int32(s)
+		}
+	}
+	return res, nil
+}
+
+// Replay converts the result to the replay format
+func (r *Result) Replay() replay.Result {
+	res := replay.Result{Winner: r.GetWinner(), DurationMs: r.GetDurationMs(), Outcome: r.GetOutcome().Replay()}
+	if len(r.GetScores()) > 0 {
+		res.Scores = make(map[string]int, len(r.GetScores()))
+		for p, s := range r.GetScores() {
+			res.Scores[p] = int(s)
+		}
+	}
+	return res
+}
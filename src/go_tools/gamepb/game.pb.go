@@ -0,0 +1,1296 @@
+// The multiplayer game messages: what clients, servers and bots send each
+// other over a relay, the lobby controls peers send the relay and the room
+// events it answers with, and what a session log carries for the analyzer
+// to follow, one length-prefixed Message after another. The fields mirror
+// the replay format's, so a replay plays back as messages.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.28.3
+// source: game.proto
+
+package gamepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Action is a player input
+type Action int32
+
+const (
+	Action_ACTION_UNSPECIFIED Action = 0
+	Action_ACTION_LEFT        Action = 1
+	Action_ACTION_RIGHT       Action = 2
+	Action_ACTION_ROTATE_CW   Action = 3
+	Action_ACTION_ROTATE_CCW  Action = 4
+	Action_ACTION_SOFT_DROP   Action = 5
+	Action_ACTION_HARD_DROP   Action = 6
+	Action_ACTION_HOLD        Action = 7
+	Action_ACTION_CAST        Action = 8
+)
+
+// Enum value maps for Action.
+var (
+	Action_name = map[int32]string{
+		0: "ACTION_UNSPECIFIED",
+		1: "ACTION_LEFT",
+		2: "ACTION_RIGHT",
+		3: "ACTION_ROTATE_CW",
+		4: "ACTION_ROTATE_CCW",
+		5: "ACTION_SOFT_DROP",
+		6: "ACTION_HARD_DROP",
+		7: "ACTION_HOLD",
+		8: "ACTION_CAST",
+	}
+	Action_value = map[string]int32{
+		"ACTION_UNSPECIFIED": 0,
+		"ACTION_LEFT":        1,
+		"ACTION_RIGHT":       2,
+		"ACTION_ROTATE_CW":   3,
+		"ACTION_ROTATE_CCW":  4,
+		"ACTION_SOFT_DROP":   5,
+		"ACTION_HARD_DROP":   6,
+		"ACTION_HOLD":        7,
+		"ACTION_CAST":        8,
+	}
+)
+
+func (x Action) Enum() *Action {
+	p := new(Action)
+	*p = x
+	return p
+}
+
+func (x Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_game_proto_enumTypes[0].Descriptor()
+}
+
+func (Action) Type() protoreflect.EnumType {
+	return &file_game_proto_enumTypes[0]
+}
+
+func (x Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Action.Descriptor instead.
+func (Action) EnumDescriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{0}
+}
+
+// EventType is what the game reports happened
+type EventType int32
+
+const (
+	EventType_EVENT_TYPE_UNSPECIFIED EventType = 0
+	EventType_EVENT_TYPE_SPAWN       EventType = 1
+	EventType_EVENT_TYPE_LOCK        EventType = 2
+	EventType_EVENT_TYPE_CLEAR       EventType = 3
+	EventType_EVENT_TYPE_PICKUP      EventType = 4
+	EventType_EVENT_TYPE_SPECIAL     EventType = 5
+	EventType_EVENT_TYPE_GARBAGE     EventType = 6
+	EventType_EVENT_TYPE_TOP_OUT     EventType = 7
+)
+
+// Enum value maps for EventType.
+var (
+	EventType_name = map[int32]string{
+		0: "EVENT_TYPE_UNSPECIFIED",
+		1: "EVENT_TYPE_SPAWN",
+		2: "EVENT_TYPE_LOCK",
+		3: "EVENT_TYPE_CLEAR",
+		4: "EVENT_TYPE_PICKUP",
+		5: "EVENT_TYPE_SPECIAL",
+		6: "EVENT_TYPE_GARBAGE",
+		7: "EVENT_TYPE_TOP_OUT",
+	}
+	EventType_value = map[string]int32{
+		"EVENT_TYPE_UNSPECIFIED": 0,
+		"EVENT_TYPE_SPAWN":       1,
+		"EVENT_TYPE_LOCK":        2,
+		"EVENT_TYPE_CLEAR":       3,
+		"EVENT_TYPE_PICKUP":      4,
+		"EVENT_TYPE_SPECIAL":     5,
+		"EVENT_TYPE_GARBAGE":     6,
+		"EVENT_TYPE_TOP_OUT":     7,
+	}
+)
+
+func (x EventType) Enum() *EventType {
+	p := new(EventType)
+	*p = x
+	return p
+}
+
+func (x EventType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EventType) Descriptor() protoreflect.EnumDescriptor {
+	return file_game_proto_enumTypes[1].Descriptor()
+}
+
+func (EventType) Type() protoreflect.EnumType {
+	return &file_game_proto_enumTypes[1]
+}
+
+func (x EventType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EventType.Descriptor instead.
+func (EventType) EnumDescriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{1}
+}
+
+// Outcome is how a session ended
+type Outcome int32
+
+const (
+	Outcome_OUTCOME_UNSPECIFIED Outcome = 0
+	Outcome_OUTCOME_CLEARED     Outcome = 1 // solo player completed the level
+	Outcome_OUTCOME_TOP_OUT     Outcome = 2
+	Outcome_OUTCOME_QUIT        Outcome = 3
+	Outcome_OUTCOME_WIN         Outcome = 4 // versus match with a winner
+)
+
+// Enum value maps for Outcome.
+var (
+	Outcome_name = map[int32]string{
+		0: "OUTCOME_UNSPECIFIED",
+		1: "OUTCOME_CLEARED",
+		2: "OUTCOME_TOP_OUT",
+		3: "OUTCOME_QUIT",
+		4: "OUTCOME_WIN",
+	}
+	Outcome_value = map[string]int32{
+		"OUTCOME_UNSPECIFIED": 0,
+		"OUTCOME_CLEARED":     1,
+		"OUTCOME_TOP_OUT":     2,
+		"OUTCOME_QUIT":        3,
+		"OUTCOME_WIN":         4,
+	}
+)
+
+func (x Outcome) Enum() *Outcome {
+	p := new(Outcome)
+	*p = x
+	return p
+}
+
+func (x Outcome) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Outcome) Descriptor() protoreflect.EnumDescriptor {
+	return file_game_proto_enumTypes[2].Descriptor()
+}
+
+func (Outcome) Type() protoreflect.EnumType {
+	return &file_game_proto_enumTypes[2]
+}
+
+func (x Outcome) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Outcome.Descriptor instead.
+func (Outcome) EnumDescriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{2}
+}
+
+// Message is one game message, of a session
+type Message struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Session string                 `protobuf:"bytes,1,opt,name=session,proto3" json:"session,omitempty"`
+	Seq     uint64                 `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"` // per sender, from 1, so a receiver notices gaps and reordering
+	// Types that are valid to be assigned to Body:
+	//
+	//	*Message_Start
+	//	*Message_Input
+	//	*Message_Event
+	//	*Message_Spell
+	//	*Message_Chat
+	//	*Message_End
+	//	*Message_Control
+	//	*Message_Room
+	Body          isMessage_Body `protobuf_oneof:"body"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_game_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_game_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Message) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+func (x *Message) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Message) GetBody() isMessage_Body {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+func (x *Message) GetStart() *SessionStart {
+	if x != nil {
+		if x, ok := x.Body.(*Message_Start); ok {
+			return x.Start
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetInput() *Input {
+	if x != nil {
+		if x, ok := x.Body.(*Message_Input); ok {
+			return x.Input
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetEvent() *Event {
+	if x != nil {
+		if x, ok := x.Body.(*Message_Event); ok {
+			return x.Event
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetSpell() *SpellCast {
+	if x != nil {
+		if x, ok := x.Body.(*Message_Spell); ok {
+			return x.Spell
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetChat() *Chat {
+	if x != nil {
+		if x, ok := x.Body.(*Message_Chat); ok {
+			return x.Chat
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetEnd() *Result {
+	if x != nil {
+		if x, ok := x.Body.(*Message_End); ok {
+			return x.End
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetControl() *Control {
+	if x != nil {
+		if x, ok := x.Body.(*Message_Control); ok {
+			return x.Control
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetRoom() *RoomEvent {
+	if x != nil {
+		if x, ok := x.Body.(*Message_Room); ok {
+			return x.Room
+		}
+	}
+	return nil
+}
+
+type isMessage_Body interface {
+	isMessage_Body()
+}
+
+type Message_Start struct {
+	Start *SessionStart `protobuf:"bytes,10,opt,name=start,proto3,oneof"`
+}
+
+type Message_Input struct {
+	Input *Input `protobuf:"bytes,11,opt,name=input,proto3,oneof"`
+}
+
+type Message_Event struct {
+	Event *Event `protobuf:"bytes,12,opt,name=event,proto3,oneof"`
+}
+
+type Message_Spell struct {
+	Spell *SpellCast `protobuf:"bytes,13,opt,name=spell,proto3,oneof"`
+}
+
+type Message_Chat struct {
+	Chat *Chat `protobuf:"bytes,14,opt,name=chat,proto3,oneof"`
+}
+
+type Message_End struct {
+	End *Result `protobuf:"bytes,15,opt,name=end,proto3,oneof"`
+}
+
+type Message_Control struct {
+	Control *Control `protobuf:"bytes,16,opt,name=control,proto3,oneof"` // to the relay, which acts on it instead of relaying
+}
+
+type Message_Room struct {
+	Room *RoomEvent `protobuf:"bytes,17,opt,name=room,proto3,oneof"` // from the relay alone
+}
+
+func (*Message_Start) isMessage_Body() {}
+
+func (*Message_Input) isMessage_Body() {}
+
+func (*Message_Event) isMessage_Body() {}
+
+func (*Message_Spell) isMessage_Body() {}
+
+func (*Message_Chat) isMessage_Body() {}
+
+func (*Message_End) isMessage_Body() {}
+
+func (*Message_Control) isMessage_Body() {}
+
+func (*Message_Room) isMessage_Body() {}
+
+// Control is a lobby control a peer sends the relay
+type Control struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Lobby         string                 `protobuf:"bytes,1,opt,name=lobby,proto3" json:"lobby,omitempty"` // ready, unready, start, end, host, kick or ping
+	Peer          string                 `protobuf:"bytes,2,opt,name=peer,proto3" json:"peer,omitempty"`   // the peer host hands over to or kick removes
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Control) Reset() {
+	*x = Control{}
+	mi := &file_game_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Control) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Control) ProtoMessage() {}
+
+func (x *Control) ProtoReflect() protoreflect.Message {
+	mi := &file_game_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Control.ProtoReflect.Descriptor instead.
+func (*Control) Descriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Control) GetLobby() string {
+	if x != nil {
+		return x.Lobby
+	}
+	return ""
+}
+
+func (x *Control) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+// RoomEvent tells a relay's peers what changed in their room: a lobby
+// event type, or error, answering a control that failed
+type RoomEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         string                 `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	Room          string                 `protobuf:"bytes,2,opt,name=room,proto3" json:"room,omitempty"`
+	Peer          string                 `protobuf:"bytes,3,opt,name=peer,proto3" json:"peer,omitempty"`
+	Peers         []string               `protobuf:"bytes,4,rep,name=peers,proto3" json:"peers,omitempty"` // in the room after it, in the order they joined
+	Host          string                 `protobuf:"bytes,5,opt,name=host,proto3" json:"host,omitempty"`
+	Ready         []string               `protobuf:"bytes,6,rep,name=ready,proto3" json:"ready,omitempty"` // peers ready
+	State         string                 `protobuf:"bytes,7,opt,name=state,proto3" json:"state,omitempty"`
+	Reason        string                 `protobuf:"bytes,8,opt,name=reason,proto3" json:"reason,omitempty"` // why a peer left
+	Error         string                 `protobuf:"bytes,9,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RoomEvent) Reset() {
+	*x = RoomEvent{}
+	mi := &file_game_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoomEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoomEvent) ProtoMessage() {}
+
+func (x *RoomEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_game_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoomEvent.ProtoReflect.Descriptor instead.
+func (*RoomEvent) Descriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RoomEvent) GetEvent() string {
+	if x != nil {
+		return x.Event
+	}
+	return ""
+}
+
+func (x *RoomEvent) GetRoom() string {
+	if x != nil {
+		return x.Room
+	}
+	return ""
+}
+
+func (x *RoomEvent) GetPeer() string {
+	if x != nil {
+		return x.Peer
+	}
+	return ""
+}
+
+func (x *RoomEvent) GetPeers() []string {
+	if x != nil {
+		return x.Peers
+	}
+	return nil
+}
+
+func (x *RoomEvent) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *RoomEvent) GetReady() []string {
+	if x != nil {
+		return x.Ready
+	}
+	return nil
+}
+
+func (x *RoomEvent) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *RoomEvent) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *RoomEvent) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Player is a participant of a session
+type Player struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Rating        float64                `protobuf:"fixed64,3,opt,name=rating,proto3" json:"rating,omitempty"`
+	Address       string                 `protobuf:"bytes,4,opt,name=address,proto3" json:"address,omitempty"` // client IP the server saw
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Player) Reset() {
+	*x = Player{}
+	mi := &file_game_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Player) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Player) ProtoMessage() {}
+
+func (x *Player) ProtoReflect() protoreflect.Message {
+	mi := &file_game_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Player.ProtoReflect.Descriptor instead.
+func (*Player) Descriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Player) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Player) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Player) GetRating() float64 {
+	if x != nil {
+		return x.Rating
+	}
+	return 0
+}
+
+func (x *Player) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+// SessionStart opens a session
+type SessionStart struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Level         string                 `protobuf:"bytes,1,opt,name=level,proto3" json:"level,omitempty"`
+	Players       []*Player              `protobuf:"bytes,2,rep,name=players,proto3" json:"players,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionStart) Reset() {
+	*x = SessionStart{}
+	mi := &file_game_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionStart) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionStart) ProtoMessage() {}
+
+func (x *SessionStart) ProtoReflect() protoreflect.Message {
+	mi := &file_game_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionStart.ProtoReflect.Descriptor instead.
+func (*SessionStart) Descriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SessionStart) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
+func (x *SessionStart) GetPlayers() []*Player {
+	if x != nil {
+		return x.Players
+	}
+	return nil
+}
+
+// Input is a single player input
+type Input struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Frame         int32                  `protobuf:"varint,1,opt,name=frame,proto3" json:"frame,omitempty"`
+	TimeMs        int64                  `protobuf:"varint,2,opt,name=time_ms,json=timeMs,proto3" json:"time_ms,omitempty"`
+	Player        string                 `protobuf:"bytes,3,opt,name=player,proto3" json:"player,omitempty"`
+	Action        Action                 `protobuf:"varint,4,opt,name=action,proto3,enum=supertetris.game.v1.Action" json:"action,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Input) Reset() {
+	*x = Input{}
+	mi := &file_game_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Input) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Input) ProtoMessage() {}
+
+func (x *Input) ProtoReflect() protoreflect.Message {
+	mi := &file_game_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Input.ProtoReflect.Descriptor instead.
+func (*Input) Descriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Input) GetFrame() int32 {
+	if x != nil {
+		return x.Frame
+	}
+	return 0
+}
+
+func (x *Input) GetTimeMs() int64 {
+	if x != nil {
+		return x.TimeMs
+	}
+	return 0
+}
+
+func (x *Input) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+func (x *Input) GetAction() Action {
+	if x != nil {
+		return x.Action
+	}
+	return Action_ACTION_UNSPECIFIED
+}
+
+// Event is something the game reported
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Frame         int32                  `protobuf:"varint,1,opt,name=frame,proto3" json:"frame,omitempty"`
+	TimeMs        int64                  `protobuf:"varint,2,opt,name=time_ms,json=timeMs,proto3" json:"time_ms,omitempty"`
+	Player        string                 `protobuf:"bytes,3,opt,name=player,proto3" json:"player,omitempty"`
+	Type          EventType              `protobuf:"varint,4,opt,name=type,proto3,enum=supertetris.game.v1.EventType" json:"type,omitempty"`
+	Piece         string                 `protobuf:"bytes,5,opt,name=piece,proto3" json:"piece,omitempty"`
+	X             int32                  `protobuf:"varint,6,opt,name=x,proto3" json:"x,omitempty"`
+	Y             int32                  `protobuf:"varint,7,opt,name=y,proto3" json:"y,omitempty"`
+	Rotation      int32                  `protobuf:"varint,8,opt,name=rotation,proto3" json:"rotation,omitempty"`
+	Lines         int32                  `protobuf:"varint,9,opt,name=lines,proto3" json:"lines,omitempty"`
+	Score         int32                  `protobuf:"varint,10,opt,name=score,proto3" json:"score,omitempty"` // points awarded by this event
+	Detail        string                 `protobuf:"bytes,11,opt,name=detail,proto3" json:"detail,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_game_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_game_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Event) GetFrame() int32 {
+	if x != nil {
+		return x.Frame
+	}
+	return 0
+}
+
+func (x *Event) GetTimeMs() int64 {
+	if x != nil {
+		return x.TimeMs
+	}
+	return 0
+}
+
+func (x *Event) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+func (x *Event) GetType() EventType {
+	if x != nil {
+		return x.Type
+	}
+	return EventType_EVENT_TYPE_UNSPECIFIED
+}
+
+func (x *Event) GetPiece() string {
+	if x != nil {
+		return x.Piece
+	}
+	return ""
+}
+
+func (x *Event) GetX() int32 {
+	if x != nil {
+		return x.X
+	}
+	return 0
+}
+
+func (x *Event) GetY() int32 {
+	if x != nil {
+		return x.Y
+	}
+	return 0
+}
+
+func (x *Event) GetRotation() int32 {
+	if x != nil {
+		return x.Rotation
+	}
+	return 0
+}
+
+func (x *Event) GetLines() int32 {
+	if x != nil {
+		return x.Lines
+	}
+	return 0
+}
+
+func (x *Event) GetScore() int32 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *Event) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+// SpellCast is a spell being used
+type SpellCast struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Frame         int32                  `protobuf:"varint,1,opt,name=frame,proto3" json:"frame,omitempty"`
+	TimeMs        int64                  `protobuf:"varint,2,opt,name=time_ms,json=timeMs,proto3" json:"time_ms,omitempty"`
+	Player        string                 `protobuf:"bytes,3,opt,name=player,proto3" json:"player,omitempty"`
+	Spell         string                 `protobuf:"bytes,4,opt,name=spell,proto3" json:"spell,omitempty"`
+	Target        string                 `protobuf:"bytes,5,opt,name=target,proto3" json:"target,omitempty"` // player the spell was aimed at
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SpellCast) Reset() {
+	*x = SpellCast{}
+	mi := &file_game_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SpellCast) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SpellCast) ProtoMessage() {}
+
+func (x *SpellCast) ProtoReflect() protoreflect.Message {
+	mi := &file_game_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SpellCast.ProtoReflect.Descriptor instead.
+func (*SpellCast) Descriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SpellCast) GetFrame() int32 {
+	if x != nil {
+		return x.Frame
+	}
+	return 0
+}
+
+func (x *SpellCast) GetTimeMs() int64 {
+	if x != nil {
+		return x.TimeMs
+	}
+	return 0
+}
+
+func (x *SpellCast) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+func (x *SpellCast) GetSpell() string {
+	if x != nil {
+		return x.Spell
+	}
+	return ""
+}
+
+func (x *SpellCast) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+// Chat is a line of in-game chat
+type Chat struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Frame         int32                  `protobuf:"varint,1,opt,name=frame,proto3" json:"frame,omitempty"`
+	TimeMs        int64                  `protobuf:"varint,2,opt,name=time_ms,json=timeMs,proto3" json:"time_ms,omitempty"`
+	Player        string                 `protobuf:"bytes,3,opt,name=player,proto3" json:"player,omitempty"`
+	Text          string                 `protobuf:"bytes,4,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Chat) Reset() {
+	*x = Chat{}
+	mi := &file_game_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Chat) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Chat) ProtoMessage() {}
+
+func (x *Chat) ProtoReflect() protoreflect.Message {
+	mi := &file_game_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Chat.ProtoReflect.Descriptor instead.
+func (*Chat) Descriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Chat) GetFrame() int32 {
+	if x != nil {
+		return x.Frame
+	}
+	return 0
+}
+
+func (x *Chat) GetTimeMs() int64 {
+	if x != nil {
+		return x.TimeMs
+	}
+	return 0
+}
+
+func (x *Chat) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+func (x *Chat) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+// Result ends a session
+type Result struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Winner        string                 `protobuf:"bytes,1,opt,name=winner,proto3" json:"winner,omitempty"`
+	DurationMs    int64                  `protobuf:"varint,2,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	Scores        map[string]int32       `protobuf:"bytes,3,rep,name=scores,proto3" json:"scores,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Outcome       Outcome                `protobuf:"varint,4,opt,name=outcome,proto3,enum=supertetris.game.v1.Outcome" json:"outcome,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Result) Reset() {
+	*x = Result{}
+	mi := &file_game_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Result) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Result) ProtoMessage() {}
+
+func (x *Result) ProtoReflect() protoreflect.Message {
+	mi := &file_game_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Result.ProtoReflect.Descriptor instead.
+func (*Result) Descriptor() ([]byte, []int) {
+	return file_game_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Result) GetWinner() string {
+	if x != nil {
+		return x.Winner
+	}
+	return ""
+}
+
+func (x *Result) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *Result) GetScores() map[string]int32 {
+	if x != nil {
+		return x.Scores
+	}
+	return nil
+}
+
+func (x *Result) GetOutcome() Outcome {
+	if x != nil {
+		return x.Outcome
+	}
+	return Outcome_OUTCOME_UNSPECIFIED
+}
+
+var File_game_proto protoreflect.FileDescriptor
+
+const file_game_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"game.proto\x12\x13supertetris.game.v1\"\xea\x03\n" +
+	"\aMessage\x12\x18\n" +
+	"\asession\x18\x01 \x01(\tR\asession\x12\x10\n" +
+	"\x03seq\x18\x02 \x01(\x04R\x03seq\x129\n" +
+	"\x05start\x18\n" +
+	" \x01(\v2!.supertetris.game.v1.SessionStartH\x00R\x05start\x122\n" +
+	"\x05input\x18\v \x01(\v2\x1a.supertetris.game.v1.InputH\x00R\x05input\x122\n" +
+	"\x05event\x18\f \x01(\v2\x1a.supertetris.game.v1.EventH\x00R\x05event\x126\n" +
+	"\x05spell\x18\r \x01(\v2\x1e.supertetris.game.v1.SpellCastH\x00R\x05spell\x12/\n" +
+	"\x04chat\x18\x0e \x01(\v2\x19.supertetris.game.v1.ChatH\x00R\x04chat\x12/\n" +
+	"\x03end\x18\x0f \x01(\v2\x1b.supertetris.game.v1.ResultH\x00R\x03end\x128\n" +
+	"\acontrol\x18\x10 \x01(\v2\x1c.supertetris.game.v1.ControlH\x00R\acontrol\x124\n" +
+	"\x04room\x18\x11 \x01(\v2\x1e.supertetris.game.v1.RoomEventH\x00R\x04roomB\x06\n" +
+	"\x04body\"3\n" +
+	"\aControl\x12\x14\n" +
+	"\x05lobby\x18\x01 \x01(\tR\x05lobby\x12\x12\n" +
+	"\x04peer\x18\x02 \x01(\tR\x04peer\"\xcd\x01\n" +
+	"\tRoomEvent\x12\x14\n" +
+	"\x05event\x18\x01 \x01(\tR\x05event\x12\x12\n" +
+	"\x04room\x18\x02 \x01(\tR\x04room\x12\x12\n" +
+	"\x04peer\x18\x03 \x01(\tR\x04peer\x12\x14\n" +
+	"\x05peers\x18\x04 \x03(\tR\x05peers\x12\x12\n" +
+	"\x04host\x18\x05 \x01(\tR\x04host\x12\x14\n" +
+	"\x05ready\x18\x06 \x03(\tR\x05ready\x12\x14\n" +
+	"\x05state\x18\a \x01(\tR\x05state\x12\x16\n" +
+	"\x06reason\x18\b \x01(\tR\x06reason\x12\x14\n" +
+	"\x05error\x18\t \x01(\tR\x05error\"^\n" +
+	"\x06Player\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x16\n" +
+	"\x06rating\x18\x03 \x01(\x01R\x06rating\x12\x18\n" +
+	"\aaddress\x18\x04 \x01(\tR\aaddress\"[\n" +
+	"\fSessionStart\x12\x14\n" +
+	"\x05level\x18\x01 \x01(\tR\x05level\x125\n" +
+	"\aplayers\x18\x02 \x03(\v2\x1b.supertetris.game.v1.PlayerR\aplayers\"\x83\x01\n" +
+	"\x05Input\x12\x14\n" +
+	"\x05frame\x18\x01 \x01(\x05R\x05frame\x12\x17\n" +
+	"\atime_ms\x18\x02 \x01(\x03R\x06timeMs\x12\x16\n" +
+	"\x06player\x18\x03 \x01(\tR\x06player\x123\n" +
+	"\x06action\x18\x04 \x01(\x0e2\x1b.supertetris.game.v1.ActionR\x06action\"\x94\x02\n" +
+	"\x05Event\x12\x14\n" +
+	"\x05frame\x18\x01 \x01(\x05R\x05frame\x12\x17\n" +
+	"\atime_ms\x18\x02 \x01(\x03R\x06timeMs\x12\x16\n" +
+	"\x06player\x18\x03 \x01(\tR\x06player\x122\n" +
+	"\x04type\x18\x04 \x01(\x0e2\x1e.supertetris.game.v1.EventTypeR\x04type\x12\x14\n" +
+	"\x05piece\x18\x05 \x01(\tR\x05piece\x12\f\n" +
+	"\x01x\x18\x06 \x01(\x05R\x01x\x12\f\n" +
+	"\x01y\x18\a \x01(\x05R\x01y\x12\x1a\n" +
+	"\brotation\x18\b \x01(\x05R\brotation\x12\x14\n" +
+	"\x05lines\x18\t \x01(\x05R\x05lines\x12\x14\n" +
+	"\x05score\x18\n" +
+	" \x01(\x05R\x05score\x12\x16\n" +
+	"\x06detail\x18\v \x01(\tR\x06detail\"\x80\x01\n" +
+	"\tSpellCast\x12\x14\n" +
+	"\x05frame\x18\x01 \x01(\x05R\x05frame\x12\x17\n" +
+	"\atime_ms\x18\x02 \x01(\x03R\x06timeMs\x12\x16\n" +
+	"\x06player\x18\x03 \x01(\tR\x06player\x12\x14\n" +
+	"\x05spell\x18\x04 \x01(\tR\x05spell\x12\x16\n" +
+	"\x06target\x18\x05 \x01(\tR\x06target\"a\n" +
+	"\x04Chat\x12\x14\n" +
+	"\x05frame\x18\x01 \x01(\x05R\x05frame\x12\x17\n" +
+	"\atime_ms\x18\x02 \x01(\x03R\x06timeMs\x12\x16\n" +
+	"\x06player\x18\x03 \x01(\tR\x06player\x12\x12\n" +
+	"\x04text\x18\x04 \x01(\tR\x04text\"\xf5\x01\n" +
+	"\x06Result\x12\x16\n" +
+	"\x06winner\x18\x01 \x01(\tR\x06winner\x12\x1f\n" +
+	"\vduration_ms\x18\x02 \x01(\x03R\n" +
+	"durationMs\x12?\n" +
+	"\x06scores\x18\x03 \x03(\v2'.supertetris.game.v1.Result.ScoresEntryR\x06scores\x126\n" +
+	"\aoutcome\x18\x04 \x01(\x0e2\x1c.supertetris.game.v1.OutcomeR\aoutcome\x1a9\n" +
+	"\vScoresEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01*\xbe\x01\n" +
+	"\x06Action\x12\x16\n" +
+	"\x12ACTION_UNSPECIFIED\x10\x00\x12\x0f\n" +
+	"\vACTION_LEFT\x10\x01\x12\x10\n" +
+	"\fACTION_RIGHT\x10\x02\x12\x14\n" +
+	"\x10ACTION_ROTATE_CW\x10\x03\x12\x15\n" +
+	"\x11ACTION_ROTATE_CCW\x10\x04\x12\x14\n" +
+	"\x10ACTION_SOFT_DROP\x10\x05\x12\x14\n" +
+	"\x10ACTION_HARD_DROP\x10\x06\x12\x0f\n" +
+	"\vACTION_HOLD\x10\a\x12\x0f\n" +
+	"\vACTION_CAST\x10\b*\xc7\x01\n" +
+	"\tEventType\x12\x1a\n" +
+	"\x16EVENT_TYPE_UNSPECIFIED\x10\x00\x12\x14\n" +
+	"\x10EVENT_TYPE_SPAWN\x10\x01\x12\x13\n" +
+	"\x0fEVENT_TYPE_LOCK\x10\x02\x12\x14\n" +
+	"\x10EVENT_TYPE_CLEAR\x10\x03\x12\x15\n" +
+	"\x11EVENT_TYPE_PICKUP\x10\x04\x12\x16\n" +
+	"\x12EVENT_TYPE_SPECIAL\x10\x05\x12\x16\n" +
+	"\x12EVENT_TYPE_GARBAGE\x10\x06\x12\x16\n" +
+	"\x12EVENT_TYPE_TOP_OUT\x10\a*o\n" +
+	"\aOutcome\x12\x17\n" +
+	"\x13OUTCOME_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fOUTCOME_CLEARED\x10\x01\x12\x13\n" +
+	"\x0fOUTCOME_TOP_OUT\x10\x02\x12\x10\n" +
+	"\fOUTCOME_QUIT\x10\x03\x12\x0f\n" +
+	"\vOUTCOME_WIN\x10\x04B<Z:github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepbb\x06proto3"
+
+var (
+	file_game_proto_rawDescOnce sync.Once
+	file_game_proto_rawDescData []byte
+)
+
+func file_game_proto_rawDescGZIP() []byte {
+	file_game_proto_rawDescOnce.Do(func() {
+		file_game_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_game_proto_rawDesc), len(file_game_proto_rawDesc)))
+	})
+	return file_game_proto_rawDescData
+}
+
+var file_game_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_game_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_game_proto_goTypes = []any{
+	(Action)(0),          // 0: supertetris.game.v1.Action
+	(EventType)(0),       // 1: supertetris.game.v1.EventType
+	(Outcome)(0),         // 2: supertetris.game.v1.Outcome
+	(*Message)(nil),      // 3: supertetris.game.v1.Message
+	(*Control)(nil),      // 4: supertetris.game.v1.Control
+	(*RoomEvent)(nil),    // 5: supertetris.game.v1.RoomEvent
+	(*Player)(nil),       // 6: supertetris.game.v1.Player
+	(*SessionStart)(nil), // 7: supertetris.game.v1.SessionStart
+	(*Input)(nil),        // 8: supertetris.game.v1.Input
+	(*Event)(nil),        // 9: supertetris.game.v1.Event
+	(*SpellCast)(nil),    // 10: supertetris.game.v1.SpellCast
+	(*Chat)(nil),         // 11: supertetris.game.v1.Chat
+	(*Result)(nil),       // 12: supertetris.game.v1.Result
+	nil,                  // 13: supertetris.game.v1.Result.ScoresEntry
+}
+var file_game_proto_depIdxs = []int32{
+	7,  // 0: supertetris.game.v1.Message.start:type_name -> supertetris.game.v1.SessionStart
+	8,  // 1: supertetris.game.v1.Message.input:type_name -> supertetris.game.v1.Input
+	9,  // 2: supertetris.game.v1.Message.event:type_name -> supertetris.game.v1.Event
+	10, // 3: supertetris.game.v1.Message.spell:type_name -> supertetris.game.v1.SpellCast
+	11, // 4: supertetris.game.v1.Message.chat:type_name -> supertetris.game.v1.Chat
+	12, // 5: supertetris.game.v1.Message.end:type_name -> supertetris.game.v1.Result
+	4,  // 6: supertetris.game.v1.Message.control:type_name -> supertetris.game.v1.Control
+	5,  // 7: supertetris.game.v1.Message.room:type_name -> supertetris.game.v1.RoomEvent
+	6,  // 8: supertetris.game.v1.SessionStart.players:type_name -> supertetris.game.v1.Player
+	0,  // 9: supertetris.game.v1.Input.action:type_name -> supertetris.game.v1.Action
+	1,  // 10: supertetris.game.v1.Event.type:type_name -> supertetris.game.v1.EventType
+	13, // 11: supertetris.game.v1.Result.scores:type_name -> supertetris.game.v1.Result.ScoresEntry
+	2,  // 12: supertetris.game.v1.Result.outcome:type_name -> supertetris.game.v1.Outcome
+	13, // [13:13] is the sub-list for method output_type
+	13, // [13:13] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_game_proto_init() }
+func file_game_proto_init() {
+	if File_game_proto != nil {
+		return
+	}
+	file_game_proto_msgTypes[0].OneofWrappers = []any{
+		(*Message_Start)(nil),
+		(*Message_Input)(nil),
+		(*Message_Event)(nil),
+		(*Message_Spell)(nil),
+		(*Message_Chat)(nil),
+		(*Message_End)(nil),
+		(*Message_Control)(nil),
+		(*Message_Room)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_game_proto_rawDesc), len(file_game_proto_rawDesc)),
+			NumEnums:      3,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_game_proto_goTypes,
+		DependencyIndexes: file_game_proto_depIdxs,
+		EnumInfos:         file_game_proto_enumTypes,
+		MessageInfos:      file_game_proto_msgTypes,
+	}.Build()
+	File_game_proto = out.File
+	file_game_proto_goTypes = nil
+	file_game_proto_depIdxs = nil
+}
@@ -0,0 +1,192 @@
+package gamepb
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func sample() *replay.Replay {
+	return &replay.Replay{
+		SessionID: "s1",
+		Level:     "pack1/03",
+		StartedAt: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		Players:   []replay.Player{{ID: "p1", Name: "Ann", Rating: 1510}, {ID: "p2"}},
+		Inputs: []replay.Input{
+			{Frame: 10, TimeMs: 166, Player: "p1", Action: replay.ActionRotateCW},
+			{Frame: 40, TimeMs: 666, Player: "p2", Action: replay.ActionHardDrop},
+		},
+		Events: []replay.Event{{Frame: 41, TimeMs: 683, Player: "p2", Type: replay.EventTopOut, Piece: "T", X: -1, Lines: 2}},
+		Spells: []replay.SpellCast{{Frame: 20, TimeMs: 333, Player: "p1", Spell: "freeze", Target: "p2"}},
+		Chat:   []replay.ChatMessage{{Frame: 30, TimeMs: 500, Player: "p2", Text: "gg"}},
+		Result: replay.Result{Winner: "p1", DurationMs: 700, Scores: map[string]int{"p1": 300, "p2": 0}, Outcome: replay.OutcomeWin},
+	}
+}
+
+func TestEnumsFollowTheReplayFormat(t *testing.T) {
+	for _, s := range []string{replay.ActionLeft, replay.ActionRotateCCW, replay.ActionSoftDrop, replay.ActionCast} {
+		if a, err := ParseAction(s); err != nil || a.Replay() != s {
+			t.Errorf("action %s = %v %v", s, a, err)
+		}
+	}
+	if e, err := ParseEventType(replay.EventTopOut); err != nil || e != EventType_EVENT_TYPE_TOP_OUT {
+		t.Errorf("top_out = %v %v", e, err)
+	}
+	if o, err := ParseOutcome(""); err != nil || o.Replay() != "" {
+		t.Errorf("no outcome = %v %v", o, err)
+	}
+	for _, bad := range []string{"", "unspecified", "teleport"} {
+		if _, err := ParseAction(bad); err == nil {
+			t.Errorf("action %q parsed", bad)
+		}
+	}
+}
+
+func TestReplayPlaysBackAsMessages(t *testing.T) {
+	rp := sample()
+	msgs, err := FromReplay(rp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for i, m := range msgs {
+		if m.GetSeq() != uint64(i+1) || m.GetSession() != "s1" {
+			t.Errorf("message %d = %v", i, m)
+		}
+		kinds = append(kinds, string(m.ProtoReflect().WhichOneof(m.ProtoReflect().Descriptor().Oneofs().ByName("body")).Name()))
+	}
+	if want := []string{"start", "input", "spell", "chat", "input", "event", "end"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("kinds = %v, want %v", kinds, want)
+	}
+
+	var stream bytes.Buffer
+	for _, m := range msgs {
+		if err := Write(&stream, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var recs []replay.Record
+	if err := DecodeRecords(&stream, func(rec replay.Record) error {
+		recs = append(recs, rec)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// chat has no record kind
+	if len(recs) != 6 || recs[0].Kind != replay.RecordStart || recs[5].Kind != replay.RecordEnd {
+		t.Fatalf("records = %+v", recs)
+	}
+	if !reflect.DeepEqual(recs[0].Players, rp.Players) || *recs[1].Input != rp.Inputs[0] || *recs[2].Spell != rp.Spells[0] ||
+		*recs[4].Event != rp.Events[0] || !reflect.DeepEqual(*recs[5].Result, rp.Result) {
+		t.Errorf("records differ from the replay: %+v", recs)
+	}
+
+	// and back from the records
+	for _, rec := range recs {
+		m, err := FromRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := m.Record()
+		if err != nil || !reflect.DeepEqual(again, rec) {
+			t.Errorf("%+v comes back as %+v, %v", rec, again, err)
+		}
+	}
+	if _, err := msgs[3].Record(); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("chat record: %v", err)
+	}
+	if _, err := FromRecord(replay.Record{Session: "s1", Kind: replay.RecordInput, Input: &replay.Input{Action: "teleport"}}); err == nil {
+		t.Error("unknown action converted")
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	msgs, _ := FromReplay(sample())
+	data, err := Marshal(msgs[5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Unmarshal(data)
+	if err != nil || !proto.Equal(m, msgs[5]) {
+		t.Errorf("round trip = %v %v", m, err)
+	}
+	if _, err := Unmarshal([]byte{0xff, 0xff}); err == nil {
+		t.Error("garbage unmarshaled")
+	}
+}
+
+func TestEncodeRecordsRoundTrip(t *testing.T) {
+	recs := sample().Records()
+	var stream bytes.Buffer
+	if err := EncodeRecords(&stream, recs); err != nil {
+		t.Fatal(err)
+	}
+	var seqs []uint64
+	Decode(bytes.NewReader(stream.Bytes()), func(m *Message) error {
+		seqs = append(seqs, m.GetSeq())
+		return nil
+	})
+	if len(seqs) != len(recs) || seqs[0] != 1 || seqs[len(seqs)-1] != uint64(len(recs)) {
+		t.Errorf("seqs = %v", seqs)
+	}
+	var got []replay.Record
+	if err := DecodeRecords(&stream, func(rec replay.Record) error {
+		got = append(got, rec)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, recs) {
+		t.Errorf("decoded\n%+v\nwant\n%+v", got, recs)
+	}
+
+	// the relay's controls and room events aren't session records
+	for _, m := range []*Message{
+		{Body: &Message_Control{Control: &Control{Lobby: "ready"}}},
+		{Body: &Message_Room{Room: &RoomEvent{Event: "join", Room: "GAME"}}},
+	} {
+		if _, err := m.Record(); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("%v record: %v", m, err)
+		}
+	}
+}
+
+func TestSkipRecordsReadsOnPastBadMessages(t *testing.T) {
+	recs := sample().Records()
+	var stream bytes.Buffer
+	// a record with no action, a message that doesn't unmarshal and one too large
+	Write(&stream, &Message{Session: "s1", Body: &Message_Input{Input: &Input{Player: "p1"}}})
+	stream.Write([]byte{2, 0xff, 0xff})
+	big := make([]byte, MaxMessageBytes+1)
+	stream.Write(protowire.AppendVarint(nil, uint64(len(big))))
+	stream.Write(big)
+	if err := EncodeRecords(&stream, recs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	data := stream.Bytes()
+
+	if err := DecodeRecords(bytes.NewReader(data), func(replay.Record) error { return nil }); err == nil {
+		t.Error("strict decoding read past a bad message")
+	}
+	var got []replay.Record
+	var skipped []int
+	err := SkipRecords(bytes.NewReader(data), func(rec replay.Record) error {
+		got = append(got, rec)
+		return nil
+	}, func(n int, err error) {
+		skipped = append(skipped, n)
+	})
+	if err != nil || !reflect.DeepEqual(got, recs[:2]) || !reflect.DeepEqual(skipped, []int{1, 2, 3}) {
+		t.Errorf("read %d records, skipped messages %v: %v", len(got), skipped, err)
+	}
+	if err := SkipRecords(bytes.NewReader(data[:len(data)-1]), func(replay.Record) error { return nil }, func(int, error) {}); err == nil {
+		t.Error("a stream cut off mid-message ended cleanly")
+	}
+}
@@ -0,0 +1,6 @@
+// Package gamepb holds the multiplayer game messages, generated from
+// game.proto, and their conversions to and from the replay format's
+// records; the game generates its side from the same file
+package gamepb
+
+//go:generate protoc -I. --go_out=paths=source_relative:. game.proto
@@ -0,0 +1,190 @@
+package gamepb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// MaxMessageBytes caps a message in a stream, as replay.DecodeRecords
+// caps a line
+const MaxMessageBytes = 1 << 20
+
+// Write writes a message to a stream, prefixed by its length as a varint
+func Write(w io.Writer, m *Message) error {
+	_, err := protodelim.MarshalTo(w, m)
+	return err
+}
+
+// Decode reads a stream of length-prefixed messages, calling fn for each
+// until the reader ends or fn returns an error
+func Decode(r io.Reader, fn func(*Message) error) error {
+	return decode(r, fn, nil)
+}
+
+// decode reads messages as Decode does; with skip, a message that doesn't
+// unmarshal, or is over MaxMessageBytes, is handed to it with its number,
+// counting from 1, and passed over. A stream cut off mid-message still
+// ends with an error.
+func decode(r io.Reader, fn func(*Message) error, skip func(n int, err error)) error {
+	br := bufio.NewReader(r)
+	opts := protodelim.UnmarshalOptions{MaxSize: MaxMessageBytes}
+	for n := 1; ; n++ {
+		m := &Message{}
+		err := opts.UnmarshalFrom(br, m)
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err == nil:
+			if err := fn(m); err != nil {
+				return err
+			}
+			continue
+		case skip == nil, errors.Is(err, io.ErrUnexpectedEOF):
+			return err
+		}
+		var large *protodelim.SizeTooLargeError
+		if errors.As(err, &large) {
+			if _, err := br.Discard(int(large.Size)); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+		}
+		skip(n, err)
+	}
+}
+
+// DecodeRecords reads a stream of messages as replay.DecodeRecords reads
+// JSON lines, skipping the messages with no record kind. The first
+// message that doesn't decode, or isn't a valid record, ends it with an
+// error.
+func DecodeRecords(r io.Reader, fn func(replay.Record) error) error {
+	return decodeRecords(r, fn, nil)
+}
+
+// SkipRecords reads records as DecodeRecords does, but hands a message
+// that doesn't decode or validate to skip, with its number, and reads on,
+// as replay.SkipRecords does lines
+func SkipRecords(r io.Reader, fn func(replay.Record) error, skip func(n int, err error)) error {
+	return decodeRecords(r, fn, skip)
+}
+
+func decodeRecords(r io.Reader, fn func(replay.Record) error, skip func(n int, err error)) error {
+	n := 0
+	return decode(r, func(m *Message) error {
+		n++
+		rec, err := m.Record()
+		if errors.Is(err, ErrNoRecord) {
+			return nil
+		}
+		if err != nil {
+			if skip == nil {
+				return fmt.Errorf("message %d: %w", n, err)
+			}
+			skip(n, err)
+			return nil
+		}
+		return fn(rec)
+	}, func(_ int, err error) {
+		n++
+		skip(n, err)
+	})
+}
+
+// EncodeRecords writes the records as a stream of messages, as
+// DecodeRecords reads them, numbering each session's from 1
+func EncodeRecords(w io.Writer, recs []replay.Record) error {
+	seqs := map[string]uint64{}
+	for _, rec := range recs {
+		m, err := FromRecord(rec)
+		if err != nil {
+			return err
+		}
+		seqs[rec.Session]++
+		m.Seq = seqs[rec.Session]
+		if err := Write(w, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal encodes a message for a binary WebSocket message or a datagram
+func Marshal(m *Message) ([]byte, error) {
+	return proto.Marshal(m)
+}
+
+// Unmarshal decodes what Marshal encoded
+func Unmarshal(data []byte) (*Message, error) {
+	m := &Message{}
+	if err := proto.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FromReplay plays a replay back as the messages of its session: the
+// start, its inputs, events, spells and chat in time order, and the end,
+// numbered from 1
+func FromReplay(rp *replay.Replay) ([]*Message, error) {
+	type timed struct {
+		frame int
+		ms    int64
+		m     *Message
+	}
+	var body []timed
+	add := func(frame int, ms int64, m *Message) {
+		m.Session = rp.SessionID
+		body = append(body, timed{frame, ms, m})
+	}
+	for _, in := range rp.Inputs {
+		msg, err := FromInput(in)
+		if err != nil {
+			return nil, err
+		}
+		add(in.Frame, in.TimeMs, &Message{Body: &Message_Input{Input: msg}})
+	}
+	for _, e := range rp.Events {
+		msg, err := FromEvent(e)
+		if err != nil {
+			return nil, err
+		}
+		add(e.Frame, e.TimeMs, &Message{Body: &Message_Event{Event: msg}})
+	}
+	for _, s := range rp.Spells {
+		add(s.Frame, s.TimeMs, &Message{Body: &Message_Spell{Spell: FromSpell(s)}})
+	}
+	for _, c := range rp.Chat {
+		add(c.Frame, c.TimeMs, &Message{Body: &Message_Chat{Chat: FromChat(c)}})
+	}
+	sort.SliceStable(body, func(i, j int) bool {
+		if body[i].ms != body[j].ms {
+			return body[i].ms < body[j].ms
+		}
+		return body[i].frame < body[j].frame
+	})
+
+	start := &SessionStart{Level: rp.Level}
+	for _, p := range rp.Players {
+		start.Players = append(start.Players, FromPlayer(p))
+	}
+	end, err := FromResult(rp.Result)
+	if err != nil {
+		return nil, err
+	}
+	out := []*Message{{Session: rp.SessionID, Body: &Message_Start{Start: start}}}
+	for _, t := range body {
+		out = append(out, t.m)
+	}
+	out = append(out, &Message{Session: rp.SessionID, Body: &Message_End{End: end}})
+	for i, m := range out {
+		m.Seq = uint64(i + 1)
+	}
+	return out, nil
+}
@@ -0,0 +1,251 @@
+package generator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+)
+
+// ManifestFile is the name of the manifest written next to a batch's levels
+const ManifestFile = "manifest.json"
+
+// BatchOptions controls a batch generation run
+type BatchOptions struct {
+	Prefix    string // level names are Prefix_level_N
+	Count     int
+	OutputDir string
+	DryRun    bool              // run the full pipeline but write no level files
+	Binary    bool              // write the levels in the binary level format rather than JSON
+	Metadata  map[string]string // added to every level, e.g. experiment and arm tags
+	Context   context.Context   // parents the batch's trace spans; nil starts a new trace
+
+	// Publish, when set, runs each level file's write, such as to time it
+	Publish func(path string, write func() error) error
+
+	// Emit, when set, is passed each level and its entry once produced,
+	// such as to stream them; an error stops the batch
+	Emit func(lvl *level.Level, entry BatchEntry) error
+}
+
+// BatchEntry records one level of a batch
+type BatchEntry struct {
+	LevelStats
+	File           string `json:"file,omitempty"`
+	SHA256         string `json:"sha256,omitempty"` // hex, of the file as written
+	DurationMs     int64  `json:"durationMs"`
+	Fallback       bool   `json:"fallback,omitempty"`
+	FallbackReason string `json:"fallbackReason,omitempty"`
+}
+
+// Manifest lists the levels a batch produced
+type Manifest struct {
+	Generated time.Time    `json:"generated"`
+	Levels    []BatchEntry `json:"levels"`
+	Telemetry *Telemetry   `json:"telemetry,omitempty"`
+
+	// Signature, once the batch is signed as a pack, covers the manifest
+	// and so, by their hashes, the level files; see packs.SignBatch
+	Signature *level.Signature `json:"signature,omitempty"`
+}
+
+// RunBatch generates, validates and saves Count levels along with a
+// manifest, returning an entry for every level produced. In tutorial mode
+// the scripted tutorial sequence is produced and Count is ignored.
+func (g *Generator) RunBatch(opts BatchOptions) ([]BatchEntry, error) {
+	if g.config.GeneratorMode == level.ModeTutorial {
+		levels, err := g.GenerateTutorial(opts.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		opts.Count = len(levels)
+		return g.runBatch(opts, func(i int) (*level.Level, GenerationInfo, error) {
+			return levels[i-1], GenerationInfo{}, nil
+		})
+	}
+	return g.runBatch(opts, func(i int) (*level.Level, GenerationInfo, error) {
+		return g.GenerateWithInfo(fmt.Sprintf("%s_level_%d", opts.Prefix, i))
+	})
+}
+
+// runBatch saves levels 1..Count produced by next and writes the manifest
+func (g *Generator) runBatch(opts BatchOptions, next func(i int) (*level.Level, GenerationInfo, error)) ([]BatchEntry, error) {
+	if opts.Count <= 0 {
+		return nil, fmt.Errorf("batch count must be positive, got %d", opts.Count)
+	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := tracing.Start(ctx, "generator.batch", tracing.String("prefix", opts.Prefix), tracing.Int("count", opts.Count), tracing.Bool("dry_run", opts.DryRun))
+	defer span.End()
+	parent := g.span
+	g.span = span
+	defer func() { g.span = parent }()
+	// Gather this batch's telemetry separately, then fold it into the total
+	total := g.telemetry
+	g.telemetry = NewTelemetry()
+	batch := g.telemetry
+	defer func() {
+		total.Merge(batch)
+		g.telemetry = total
+	}()
+
+	if !opts.DryRun {
+		if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]BatchEntry, 0, opts.Count)
+	for i := 1; i <= opts.Count; i++ {
+		lvl, info, err := next(i)
+		if err != nil {
+			span.SetError(err)
+			return entries, err
+		}
+		if len(opts.Metadata) > 0 && lvl.Metadata == nil {
+			lvl.Metadata = make(map[string]string, len(opts.Metadata))
+		}
+		for k, v := range opts.Metadata {
+			lvl.Metadata[k] = v
+		}
+		entry := BatchEntry{
+			LevelStats:     ComputeStats(lvl),
+			DurationMs:     info.Duration.Milliseconds(),
+			Fallback:       info.Fallback,
+			FallbackReason: info.FallbackReason,
+		}
+		entry.Difficulty = g.estimator(lvl)
+		if !opts.DryRun {
+			entry.File = LevelFileName(lvl.Name)
+			if opts.Binary {
+				entry.File = strings.TrimSuffix(entry.File, ".json") + level.BinaryExt
+			}
+			path := filepath.Join(opts.OutputDir, entry.File)
+			write := func() error { return lvl.Save(path) }
+			if opts.Publish != nil {
+				write = func() error { return opts.Publish(path, func() error { return lvl.Save(path) }) }
+			}
+			if err := g.publish(entry.File, write); err != nil {
+				span.SetError(err)
+				return entries, err
+			}
+			sum, err := FileHash(path)
+			if err != nil {
+				span.SetError(err)
+				return entries, err
+			}
+			entry.SHA256 = sum
+		}
+		if opts.Emit != nil {
+			if err := opts.Emit(lvl, entry); err != nil {
+				span.SetError(err)
+				return entries, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	if opts.DryRun {
+		return entries, nil
+	}
+	err := g.publish(ManifestFile, func() error {
+		return WriteManifest(opts.OutputDir, Manifest{
+			Generated: time.Now().UTC(),
+			Levels:    entries,
+			Telemetry: batch,
+		})
+	})
+	span.SetError(err)
+	return entries, err
+}
+
+// publish writes one of a batch's files under a trace span
+func (g *Generator) publish(file string, write func() error) error {
+	span, end := g.startSpan("generator.publish", tracing.String("file", file))
+	defer end()
+	err := write()
+	span.SetError(err)
+	return err
+}
+
+// FileHash is the hex SHA-256 of the file at path, as BatchEntry records it
+func FileHash(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ReadManifest reads the manifest of the batch in dir
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest in %s: %w", dir, err)
+	}
+	return &m, nil
+}
+
+// RefreshManifest records the checksums of the batch in dir's level files
+// anew once they're rewritten, renaming the files of renamed, old name to
+// new. A batch without a manifest is left alone. A signature the manifest
+// had no longer covers a file it checksums differently, so it is dropped,
+// and dropped says so.
+func RefreshManifest(dir string, renamed map[string]string) (dropped bool, err error) {
+	m, err := ReadManifest(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	for i, e := range m.Levels {
+		if to, ok := renamed[e.File]; ok {
+			m.Levels[i].File, changed = to, true
+		}
+		sum, err := FileHash(filepath.Join(dir, m.Levels[i].File))
+		if err != nil {
+			return false, err
+		}
+		if sum != e.SHA256 {
+			m.Levels[i].SHA256, changed = sum, true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	dropped = m.Signature != nil
+	m.Signature = nil
+	return dropped, WriteManifest(dir, *m)
+}
+
+// WriteManifest writes the manifest of the batch in dir
+func WriteManifest(dir string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestFile), data, 0644)
+}
+
+// LevelFileName returns the file name the Python tools use for a level
+func LevelFileName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, " ", "_")) + ".json"
+}
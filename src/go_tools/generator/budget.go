@@ -0,0 +1,59 @@
+package generator
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// errOverBudget aborts a search loop once the level's time budget is spent
+var errOverBudget = errors.New("level time budget exceeded")
+
+func (g *Generator) overBudget() bool {
+	return !g.deadline.IsZero() && time.Now().After(g.deadline)
+}
+
+// generateFallback builds a level without candidate selection or rule
+// retries. Co-op levels get a carved channel above the goal instead of
+// terrain rejection sampling, so this always finishes in a single pass.
+// Designer rules are repaired where possible but not guaranteed.
+func (g *Generator) generateFallback(name string) (*level.Level, error) {
+	g.deadline = time.Time{}
+
+	var lvl *level.Level
+	var err error
+	if g.config.GeneratorMode == level.ModeCoop {
+		lvl, err = g.generateCoopFallback(name)
+	} else {
+		lvl, err = g.generateMode(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := g.assignPieces(lvl); err != nil {
+		return nil, err
+	}
+	for _, r := range g.rules {
+		r.Repair(lvl)
+	}
+	if lvl.Mode == level.ModeMirror || lvl.Mode == level.ModeIdentical {
+		mirrorArea(lvl, level.Zone{X: 0, Y: 0, Width: lvl.GridSize.Width / 2, Height: lvl.GridSize.Height})
+	}
+	if err := CheckLevel(lvl, g.config.PickupRules); err != nil {
+		return nil, err
+	}
+	return lvl, nil
+}
+
+// generateCoopFallback places terrain once and clears the goal columns up
+// to the top row, which terrain never reaches, so both spawn zones connect
+func (g *Generator) generateCoopFallback(name string) (*level.Level, error) {
+	if err := g.checkCoopWidth(); err != nil {
+		return nil, err
+	}
+	lvl := g.coopTerrain(name)
+	goal := *lvl.GoalArea
+	clearZone(lvl, level.Zone{X: goal.X, Y: 0, Width: goal.Width, Height: goal.Y + goal.Height})
+	return g.finishCoop(lvl)
+}
@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// stallingRule is never satisfied and slow to repair, like a rule the
+// rejection sampler cannot meet
+type stallingRule struct{}
+
+func (stallingRule) Check(*level.Level) error { return errors.New("never satisfied") }
+func (stallingRule) Repair(*level.Level)      { time.Sleep(3 * time.Millisecond) }
+func (stallingRule) String() string           { return "stall" }
+
+func TestBudgetFallsBackToSimpleAlgorithm(t *testing.T) {
+	for _, mode := range []string{level.ModeStandard, level.ModeCoop, level.ModeMirror} {
+		cfg := utils.DefaultConfig()
+		cfg.GeneratorSeed = 3
+		cfg.GeneratorMode = mode
+		cfg.LevelTimeBudget = 1
+		gen, err := NewGenerator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen.SetRules([]Constraint{stallingRule{}})
+
+		lvl, info, err := gen.GenerateWithInfo("budget")
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if !info.Fallback || info.FallbackReason == "" {
+			t.Fatalf("%s: expected a marked fallback, got %+v", mode, info)
+		}
+		if err := CheckLevel(lvl, cfg.PickupRules); err != nil {
+			t.Fatalf("%s: fallback level invalid: %v", mode, err)
+		}
+	}
+}
+
+func TestBudgetMarksAPartialSelection(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.GeneratorSeed = 3
+	cfg.CandidatesPerLevel = 50
+	cfg.LevelTimeBudget = 20
+	gen, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.SetDifficultyEstimator(func(*level.Level) float64 {
+		time.Sleep(30 * time.Millisecond)
+		return 0
+	})
+
+	lvl, info, err := gen.GenerateWithInfo("budget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Candidates == 0 || info.Candidates >= cfg.CandidatesPerLevel {
+		t.Fatalf("expected a partial selection, got %d candidates", info.Candidates)
+	}
+	if !info.Fallback || !strings.Contains(info.FallbackReason, "exhausted") {
+		t.Fatalf("expected the partial selection marked, got %+v", info)
+	}
+	if err := CheckLevel(lvl, cfg.PickupRules); err != nil {
+		t.Fatalf("partial selection invalid: %v", err)
+	}
+	if gen.Telemetry().Fallbacks != 1 {
+		t.Fatalf("telemetry counted %d fallbacks, want 1", gen.Telemetry().Fallbacks)
+	}
+}
@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// coopAttempts bounds how many terrains are tried before giving up on a co-op level
+const coopAttempts = 20
+
+// minCoopWidth is the narrowest board that fits two spawn zones and a goal between them
+const minCoopWidth = 8
+
+// generateCoop builds a level with two spawn zones and a shared goal area
+// that both spawn zones can reach through open cells
+func (g *Generator) generateCoop(name string) (*level.Level, error) {
+	if err := g.checkCoopWidth(); err != nil {
+		return nil, err
+	}
+	for attempt := 0; attempt < coopAttempts; attempt++ {
+		if g.overBudget() {
+			return nil, errOverBudget
+		}
+		lvl := g.coopTerrain(name)
+		if !coopReachable(lvl) {
+			g.telemetry.reject(RejectCoopUnreachable)
+			continue
+		}
+		return g.finishCoop(lvl)
+	}
+	return nil, i18n.Errorf("generator.coop_unreachable", name, coopAttempts)
+}
+
+func (g *Generator) checkCoopWidth() error {
+	if g.config.LevelWidth < minCoopWidth {
+		return i18n.Errorf("generator.coop_width", minCoopWidth, g.config.LevelWidth)
+	}
+	return nil
+}
+
+// coopTerrain lays out spawn zones and the goal area and places terrain
+// with the goal area cleared
+func (g *Generator) coopTerrain(name string) *level.Level {
+	width, height := g.config.LevelWidth, g.config.LevelHeight
+	zoneWidth := width / 3
+	goal := level.Zone{X: zoneWidth, Y: height - 2, Width: width - 2*zoneWidth, Height: 2}
+
+	lvl := level.New(name, width, height)
+	lvl.Mode = level.ModeCoop
+	lvl.Difficulty = difficultyName(g.config.DifficultyLevel)
+	lvl.SpawnZones = []level.Zone{
+		{X: 0, Y: 0, Width: zoneWidth, Height: 2},
+		{X: width - zoneWidth, Y: 0, Width: zoneWidth, Height: 2},
+	}
+	for _, z := range lvl.SpawnZones {
+		lvl.SpawnPoints = append(lvl.SpawnPoints, level.Point{X: z.X + z.Width/2, Y: z.Y})
+	}
+	lvl.GoalArea = &goal
+	g.timed(StageTerrain, func() { g.placeTerrain(lvl) })
+	clearZone(lvl, goal)
+	return lvl
+}
+
+func coopReachable(lvl *level.Level) bool {
+	for _, z := range lvl.SpawnZones {
+		if !lvl.Reachable(z, *lvl.GoalArea) {
+			return false
+		}
+	}
+	return true
+}
+
+// finishCoop adds the shared objectives and pickups
+func (g *Generator) finishCoop(lvl *level.Level) (*level.Level, error) {
+	goal := lvl.GoalArea
+	lvl.Objectives = []level.Objective{
+		{Kind: "clear_lines", Target: 8 + 4*g.config.DifficultyLevel, Shared: true},
+		{Kind: "fill_goal", Target: goal.Width * goal.Height, Shared: true},
+	}
+	if err := g.addPickups(lvl); err != nil {
+		return nil, err
+	}
+	return lvl, nil
+}
+
+// clearZone removes every block inside the zone
+func clearZone(lvl *level.Level, z level.Zone) {
+	kept := lvl.Blocks[:0]
+	for _, b := range lvl.Blocks {
+		if !z.Contains(b.X, b.Y) {
+			kept = append(kept, b)
+		}
+	}
+	lvl.Blocks = kept
+}
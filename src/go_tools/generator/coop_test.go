@@ -0,0 +1,59 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// walledCoop is a co-op level whose left spawn zone is walled off from the
+// goal by a column of blocks from the floor to the top, when walled
+func walledCoop(walled bool) *level.Level {
+	lvl := level.New("walled", 12, 20)
+	lvl.Mode = level.ModeCoop
+	lvl.SpawnZones = []level.Zone{{X: 0, Y: 0, Width: 4, Height: 2}, {X: 8, Y: 0, Width: 4, Height: 2}}
+	lvl.SpawnPoints = []level.Point{{X: 2, Y: 0}, {X: 10, Y: 0}}
+	lvl.GoalArea = &level.Zone{X: 4, Y: 18, Width: 4, Height: 2}
+	if walled {
+		for y := 0; y < 20; y++ {
+			lvl.Blocks = append(lvl.Blocks, level.Block{Type: "I", X: 4, Y: y})
+		}
+		lvl.GoalArea.X = 5
+	}
+	return lvl
+}
+
+func TestCoopRefusesAnUnreachableGoal(t *testing.T) {
+	rules := utils.DefaultPickupRules()
+	if err := CheckLevel(walledCoop(false), rules); err != nil {
+		t.Fatalf("open level: %v", err)
+	}
+	lvl := walledCoop(true)
+	if coopReachable(lvl) {
+		t.Fatal("the walled-off spawn zone reaches the goal")
+	}
+	if !lvl.Reachable(lvl.SpawnZones[1], *lvl.GoalArea) {
+		t.Fatal("the open spawn zone doesn't reach the goal")
+	}
+	if err := CheckLevel(lvl, rules); err == nil {
+		t.Error("a level with a spawn zone walled off from the goal passed")
+	}
+}
+
+func TestGeneratedCoopGoalsAreReachable(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		cfg := utils.DefaultConfig()
+		cfg.GeneratorMode = level.ModeCoop
+		cfg.GeneratorSeed = seed
+		lvl, err := generate(t, cfg)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		for i, z := range lvl.SpawnZones {
+			if !lvl.Reachable(z, *lvl.GoalArea) {
+				t.Errorf("seed %d: spawn zone %d can't reach the goal", seed, i)
+			}
+		}
+	}
+}
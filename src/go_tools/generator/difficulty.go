@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/bot"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// DifficultyEstimator scores a candidate level from 0 (trivial) to 1 (hardest)
+type DifficultyEstimator func(lvl *level.Level) float64
+
+// defaultTargets maps DifficultyLevel to a target when TargetDifficulty is unset
+var defaultTargets = map[int]float64{
+	1: 0.15,
+	2: 0.3,
+	3: 0.5,
+}
+
+// Difficulty estimators a config can name
+const (
+	EstimatorModel   = "model"   // the analyzer's difficulty model
+	EstimatorBot     = "bot"     // beam bots' clear rates, see bot.EstimateDifficulty
+	EstimatorRollout = "rollout" // a beam bot's clear times over rollouts, see bot.EstimateClearTime
+)
+
+// estimatorFor is the difficulty estimator a config names
+func estimatorFor(config utils.Config) (DifficultyEstimator, error) {
+	switch config.DifficultyEstimator {
+	case "", EstimatorModel:
+		return analyzer.Estimate, nil
+	case EstimatorBot, EstimatorRollout:
+		opts := sim.Options{Randomizer: config.PieceRandomizer}
+		if config.SpellsFile != "" {
+			var err error
+			if opts.Spells, err = sim.LoadSpellbook(config.SpellsFile); err != nil {
+				return nil, err
+			}
+		}
+		if config.PlayRulesFile != "" {
+			rules, err := sim.LoadRules(config.PlayRulesFile)
+			if err != nil {
+				return nil, err
+			}
+			opts.Rules = &rules
+		}
+		var spells bot.SpellPolicy
+		if config.BotSpellsFile != "" {
+			var err error
+			if spells, err = bot.LoadSpellPolicy(config.BotSpellsFile); err != nil {
+				return nil, err
+			}
+		}
+		if config.DifficultyEstimator == EstimatorRollout {
+			return bot.ClearTimeEstimator(bot.RolloutOptions{Rollouts: config.EstimatorRollouts, Spells: spells, Sim: opts}), nil
+		}
+		return bot.Estimator(bot.EstimateOptions{Spells: spells, Sim: opts}), nil
+	default:
+		return nil, fmt.Errorf("unknown difficulty estimator %q", config.DifficultyEstimator)
+	}
+}
+
+// SetDifficultyEstimator replaces the estimator consulted during candidate
+// selection; nil restores the analyzer's difficulty model
+func (g *Generator) SetDifficultyEstimator(estimator DifficultyEstimator) {
+	if estimator == nil {
+		estimator = analyzer.Estimate
+	}
+	g.estimator = estimator
+}
+
+// EstimateDifficulty scores a level with the generator's current estimator
+func (g *Generator) EstimateDifficulty(lvl *level.Level) float64 {
+	return g.estimator(lvl)
+}
+
+func (g *Generator) targetDifficulty() float64 {
+	return targetFor(g.config)
+}
+
+// targetFor is the difficulty a config asks its levels to have
+func targetFor(config utils.Config) float64 {
+	if config.TargetDifficulty > 0 {
+		return config.TargetDifficulty
+	}
+	if t, ok := defaultTargets[config.DifficultyLevel]; ok {
+		return t
+	}
+	return defaultTargets[2]
+}
@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/bot"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+func TestConfigNamesDifficultyEstimator(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.GeneratorSeed = 5
+	cfg.CandidatesPerLevel = 2
+	cfg.DifficultyEstimator = EstimatorBot
+	gen, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lvl, err := gen.Generate("estimated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	est, err := bot.EstimateDifficulty(lvl, bot.EstimateOptions{})
+	if err != nil || gen.EstimateDifficulty(lvl) != est.Score {
+		t.Errorf("the generator estimated %v, the bots %+v, %v", gen.EstimateDifficulty(lvl), est, err)
+	}
+
+	cfg.DifficultyEstimator = "oracle"
+	if _, err := NewGenerator(cfg); err == nil {
+		t.Error("an unknown difficulty estimator was accepted")
+	}
+}
+
+func TestSelectionConsultsTheSetEstimator(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.GeneratorSeed = 5
+	cfg.CandidatesPerLevel = 5
+	cfg.TargetDifficulty = 0.3
+	gen, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Score the candidates 0, 0.1, 0.2... in the order they're offered,
+	// so the fourth is the one nearest the target
+	var seen []*level.Level
+	scores := map[*level.Level]float64{}
+	gen.SetDifficultyEstimator(func(lvl *level.Level) float64 {
+		if _, ok := scores[lvl]; !ok {
+			scores[lvl] = float64(len(seen)) / 10
+			seen = append(seen, lvl)
+		}
+		return scores[lvl]
+	})
+
+	lvl, info, err := gen.GenerateWithInfo("hooked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != cfg.CandidatesPerLevel || info.Candidates != cfg.CandidatesPerLevel {
+		t.Fatalf("the estimator saw %d of %d candidates", len(seen), info.Candidates)
+	}
+	if lvl != seen[3] {
+		t.Errorf("selected the candidate scored %v, not the one nearest %v", scores[lvl], cfg.TargetDifficulty)
+	}
+	if gen.EstimateDifficulty(lvl) != 0.3 {
+		t.Errorf("EstimateDifficulty bypassed the set estimator")
+	}
+
+	gen.SetDifficultyEstimator(nil)
+	if gen.EstimateDifficulty(lvl) != analyzer.Estimate(lvl) {
+		t.Error("a nil estimator didn't restore the difficulty model")
+	}
+}
@@ -0,0 +1,337 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// DifficultyNames maps DifficultyLevel values to the names stored in levels
+var DifficultyNames = map[int]string{
+	1: "easy",
+	2: "medium",
+	3: "hard",
+}
+
+// Generator produces levels from the generator settings of a Config
+type Generator struct {
+	config    utils.Config
+	rng       rng.RandomSource
+	estimator DifficultyEstimator
+	rules     []Constraint
+	deadline  time.Time // zero when the current level has no time budget
+	telemetry *Telemetry
+	algorithm Algorithm     // nil for the built-in modes
+	span      *tracing.Span // the open trace span stages are children of
+}
+
+// NewGenerator creates a generator using the random algorithm named by
+// GeneratorRNG; a zero GeneratorSeed seeds from the current time. Rules
+// are loaded from RulesFile when it is set.
+func NewGenerator(config utils.Config) (*Generator, error) {
+	src, err := rng.New(config.GeneratorRNG, config.GeneratorSeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pieces.New(config.PieceRandomizer, src); err != nil {
+		return nil, err
+	}
+	g := NewGeneratorWithSource(config, src)
+	if g.estimator, err = estimatorFor(config); err != nil {
+		return nil, err
+	}
+	if config.RulesFile != "" {
+		if g.rules, err = LoadRules(config.RulesFile); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// NewGeneratorWithSource creates a generator drawing from the given source,
+// ignoring GeneratorRNG and GeneratorSeed
+func NewGeneratorWithSource(config utils.Config, src rng.RandomSource) *Generator {
+	return &Generator{config: config, rng: src, estimator: analyzer.Estimate, telemetry: NewTelemetry()}
+}
+
+// GenerationInfo describes how a level was produced
+type GenerationInfo struct {
+	Candidates     int           // candidates completed before selection
+	Duration       time.Duration // wall-clock time spent on the level
+	Fallback       bool          // the time budget ran out before every candidate was complete
+	FallbackReason string
+}
+
+// Generate builds CandidatesPerLevel candidate levels and returns the one
+// whose estimated difficulty is closest to the target
+func (g *Generator) Generate(name string) (*level.Level, error) {
+	lvl, _, err := g.GenerateWithInfo(name)
+	return lvl, err
+}
+
+// GenerateWithInfo is Generate, also reporting how the level was produced.
+// When LevelTimeBudget is exceeded the best candidate so far is used, or,
+// if there is none yet, a level from the simple fallback algorithm; either
+// way the level is marked as a fallback.
+func (g *Generator) GenerateWithInfo(name string) (*level.Level, GenerationInfo, error) {
+	span, end := g.startSpan("generator.level", tracing.String("level", name))
+	defer end()
+	lvl, info, err := g.generateWithInfo(name)
+	span.SetAttrs(tracing.Int("candidates", info.Candidates), tracing.Bool("fallback", info.Fallback))
+	span.SetError(err)
+	return lvl, info, err
+}
+
+func (g *Generator) generateWithInfo(name string) (*level.Level, GenerationInfo, error) {
+	var info GenerationInfo
+	cfg := g.config
+	if cfg.LevelWidth <= 0 || cfg.LevelHeight <= 0 {
+		return nil, info, fmt.Errorf("invalid level size %dx%d", cfg.LevelWidth, cfg.LevelHeight)
+	}
+	if cfg.MinBlocks < 0 || cfg.MaxBlocks < cfg.MinBlocks {
+		return nil, info, fmt.Errorf("invalid block range %d..%d", cfg.MinBlocks, cfg.MaxBlocks)
+	}
+
+	start := time.Now()
+	g.deadline = time.Time{}
+	if cfg.LevelTimeBudget > 0 {
+		g.deadline = start.Add(time.Duration(cfg.LevelTimeBudget) * time.Millisecond)
+	}
+	defer func() { g.deadline = time.Time{} }()
+
+	candidates := cfg.CandidatesPerLevel
+	if candidates < 1 {
+		candidates = 1
+	}
+	target := g.targetDifficulty()
+
+	var best *level.Level
+	bestGap := math.Inf(1)
+	exhausted := false
+	for i := 0; i < candidates; i++ {
+		lvl, err := g.generateCandidate(name)
+		if errors.Is(err, errOverBudget) {
+			g.telemetry.reject(RejectTimeBudget)
+			exhausted = true
+			break
+		}
+		if err != nil {
+			return nil, info, err
+		}
+		info.Candidates++
+		g.telemetry.Candidates++
+		if candidates == 1 {
+			best = lvl
+			break
+		}
+		var difficulty float64
+		g.timed(StageEstimate, func() { difficulty = g.estimator(lvl) })
+		if gap := math.Abs(difficulty - target); gap < bestGap {
+			best, bestGap = lvl, gap
+		}
+		if i < candidates-1 && g.overBudget() {
+			exhausted = true
+			break
+		}
+	}
+
+	if best == nil {
+		lvl, err := g.generateFallback(name)
+		if err != nil {
+			return nil, info, err
+		}
+		best = lvl
+		info.Fallback = true
+		info.FallbackReason = fmt.Sprintf("time budget of %dms exceeded before a candidate was complete", cfg.LevelTimeBudget)
+	} else if exhausted {
+		info.Fallback = true
+		info.FallbackReason = fmt.Sprintf("time budget of %dms exhausted after %d of %d candidates", cfg.LevelTimeBudget, info.Candidates, candidates)
+	}
+	info.Duration = time.Since(start)
+	g.telemetry.addLevel(g.estimator(best), info.Fallback)
+	return best, info, nil
+}
+
+// Algorithm builds a candidate level in place of the built-in modes, such
+// as a plugin's generator; seed is drawn from the generator's source, so
+// seeded batches stay reproducible
+type Algorithm func(name string, seed int64) (*level.Level, error)
+
+// SetAlgorithm has candidates built by a, or by the built-in modes again
+// when a is nil; the rules, pieces and validation apply either way
+func (g *Generator) SetAlgorithm(a Algorithm) {
+	g.algorithm = a
+}
+
+// SetRules replaces the designer rules every generated level must satisfy
+func (g *Generator) SetRules(rules []Constraint) {
+	g.rules = rules
+}
+
+// ruleAttempts bounds how many levels are tried per candidate to satisfy the rules
+const ruleAttempts = 10
+
+// generateCandidate builds one level that passes validation and the
+// designer rules, repairing rule violations where possible
+func (g *Generator) generateCandidate(name string) (*level.Level, error) {
+	var lastErr error
+	for attempt := 0; attempt < ruleAttempts; attempt++ {
+		if g.overBudget() {
+			return nil, errOverBudget
+		}
+		lvl, err := g.generateMode(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := g.assignPieces(lvl); err != nil {
+			return nil, err
+		}
+		if len(g.rules) == 0 {
+			return lvl, nil
+		}
+		var violated Constraint
+		g.timed(StageRules, func() {
+			for _, r := range g.rules {
+				r.Repair(lvl)
+			}
+			if lvl.Mode == level.ModeMirror || lvl.Mode == level.ModeIdentical {
+				mirrorArea(lvl, level.Zone{X: 0, Y: 0, Width: lvl.GridSize.Width / 2, Height: lvl.GridSize.Height})
+			}
+			violated, lastErr = firstViolation(lvl, g.rules)
+		})
+		if violated != nil {
+			g.telemetry.reject("rule: " + violated.String())
+			continue
+		}
+		g.timed(StageValidate, func() { err = CheckLevel(lvl, g.config.PickupRules) })
+		if err != nil {
+			return nil, err
+		}
+		return lvl, nil
+	}
+	return nil, fmt.Errorf("level %q: %w (after %d attempts)", name, lastErr, ruleAttempts)
+}
+
+// generateMode builds and validates one level for the configured mode
+func (g *Generator) generateMode(name string) (*level.Level, error) {
+	cfg := g.config
+	var lvl *level.Level
+	var err error
+	switch {
+	case g.algorithm != nil:
+		seed := int64(g.rng.Intn(math.MaxInt32)) + 1
+		g.timed(StageTerrain, func() { lvl, err = g.algorithm(name, seed) })
+		if err == nil && lvl == nil {
+			err = fmt.Errorf("level %q: the algorithm built nothing", name)
+		}
+	case cfg.GeneratorMode == "", cfg.GeneratorMode == level.ModeStandard:
+		lvl, err = g.generateStandard(name)
+	case cfg.GeneratorMode == level.ModeCoop:
+		lvl, err = g.generateCoop(name)
+	case cfg.GeneratorMode == level.ModeMirror, cfg.GeneratorMode == level.ModeIdentical:
+		lvl, err = g.generateVersus(name, cfg.GeneratorMode)
+	case cfg.GeneratorMode == level.ModeTutorial:
+		err = fmt.Errorf("tutorial levels are generated as a sequence, use GenerateTutorial")
+	default:
+		err = fmt.Errorf("unknown generator mode %q", cfg.GeneratorMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	g.timed(StageValidate, func() { err = lvl.Validate() })
+	if err != nil {
+		return nil, err
+	}
+	return lvl, nil
+}
+
+// addPickups places spell pickups when enabled and checks the result against the caps
+func (g *Generator) addPickups(lvl *level.Level) error {
+	if !g.config.GenerateSpellPickups {
+		return nil
+	}
+	g.timed(StagePickups, func() { g.placePickups(lvl) })
+	return CheckPickupCaps(lvl, g.config.PickupRules)
+}
+
+// generateStandard builds a single-player level with one spawn point
+func (g *Generator) generateStandard(name string) (*level.Level, error) {
+	lvl := level.New(name, g.config.LevelWidth, g.config.LevelHeight)
+	lvl.Mode = level.ModeStandard
+	lvl.Difficulty = difficultyName(g.config.DifficultyLevel)
+	g.timed(StageTerrain, func() { g.placeTerrain(lvl) })
+	lvl.SpawnPoints = append(lvl.SpawnPoints, level.Point{X: g.config.LevelWidth / 2, Y: 0})
+	if err := g.addPickups(lvl); err != nil {
+		return nil, err
+	}
+	return lvl, nil
+}
+
+// placeTerrain stacks blocks up from the floor, optionally mirrored left to right
+func (g *Generator) placeTerrain(lvl *level.Level) {
+	cfg := g.config
+	width, height := lvl.GridSize.Width, lvl.GridSize.Height
+	maxColumn := height / 2
+
+	count := cfg.MinBlocks
+	if cfg.MaxBlocks > cfg.MinBlocks {
+		count += g.rng.Intn(cfg.MaxBlocks - cfg.MinBlocks + 1)
+	}
+	if limit := width * maxColumn; count > limit {
+		count = limit
+	}
+
+	symmetricX := g.rng.Float64() < cfg.SymmetryXProbability
+	symmetricY := g.rng.Float64() < cfg.SymmetryYProbability
+	columns := make([]int, width)
+	for placed, attempts := 0, 0; placed < count && attempts < count*10; attempts++ {
+		x := g.rng.Intn(width)
+		if columns[x] >= maxColumn {
+			continue
+		}
+		g.stackBlock(lvl, columns, x)
+		placed++
+		if symmetricX {
+			if mx := width - 1 - x; mx != x && columns[mx] < maxColumn {
+				g.stackMirror(lvl, columns, mx)
+				placed++
+			}
+		}
+	}
+	if symmetricY {
+		symmetrizeColumns(lvl)
+	}
+	if symmetricX || symmetricY {
+		g.addAccents(lvl, columns, cfg.SymmetryAccents)
+	}
+}
+
+// stackBlock places one block on top of column x
+func (g *Generator) stackBlock(lvl *level.Level, columns []int, x int) {
+	block := level.Block{
+		Type: level.BlockTypes[g.rng.Intn(len(level.BlockTypes))],
+		X:    x,
+		Y:    lvl.GridSize.Height - 1 - columns[x],
+	}
+	if g.rng.Float64() < g.config.SpecialBlockChance {
+		block.Special = level.SpecialKinds[g.rng.Intn(len(level.SpecialKinds))]
+	}
+	lvl.Blocks = append(lvl.Blocks, block)
+	columns[x]++
+}
+
+func difficultyName(d int) string {
+	if name, ok := DifficultyNames[d]; ok {
+		return name
+	}
+	return DifficultyNames[2]
+}
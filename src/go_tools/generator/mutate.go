@@ -0,0 +1,264 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Mutation is a named, randomized edit applied in place to a copy of a level
+type Mutation struct {
+	Name  string
+	Apply func(lvl *level.Level, src rng.RandomSource) error
+}
+
+// Mutate applies the mutation to a copy of the level and returns the copy
+// only if it still passes CheckLevel; otherwise the error says why. On
+// versus levels the mutation is applied to the left half and copied over.
+func Mutate(lvl *level.Level, m Mutation, src rng.RandomSource, rules utils.PickupRules) (*level.Level, error) {
+	out := cloneLevel(lvl)
+	if err := m.Apply(out, src); err != nil {
+		return nil, fmt.Errorf("%s: %w", m.Name, err)
+	}
+	if out.Mode == level.ModeMirror || out.Mode == level.ModeIdentical {
+		half := out.GridSize.Width / 2
+		mirrorArea(out, level.Zone{X: 0, Y: 0, Width: half, Height: out.GridSize.Height})
+	}
+	if err := CheckLevel(out, rules); err != nil {
+		return nil, fmt.Errorf("%s: result invalid: %w", m.Name, err)
+	}
+	return out, nil
+}
+
+// Mutate applies a mutation using the generator's random source and pickup rules
+func (g *Generator) Mutate(lvl *level.Level, m Mutation) (*level.Level, error) {
+	return Mutate(lvl, m, g.rng, g.config.PickupRules)
+}
+
+// Mutations returns the standard operator set used by the tuner
+func Mutations() []Mutation {
+	return []Mutation{
+		ShiftRows(1),
+		ShiftRows(-1),
+		SwapBlockTypes(),
+		AddPocket(2),
+		RemovePocket(),
+		JitterPickups(2),
+	}
+}
+
+// editWidth is the part of the board a mutation may touch: the left half
+// of versus levels, the whole board otherwise
+func editWidth(lvl *level.Level) int {
+	if lvl.Mode == level.ModeMirror || lvl.Mode == level.ModeIdentical {
+		return lvl.GridSize.Width / 2
+	}
+	return lvl.GridSize.Width
+}
+
+// ShiftRows moves the whole terrain dy rows down (positive) or up
+// (negative). Moving down drops the floor rows; moving up duplicates the
+// floor row so the terrain stays supported.
+func ShiftRows(dy int) Mutation {
+	return Mutation{
+		Name: fmt.Sprintf("shift-rows(%d)", dy),
+		Apply: func(lvl *level.Level, _ rng.RandomSource) error {
+			if dy == 0 {
+				return nil
+			}
+			height := lvl.GridSize.Height
+			var floor []level.Block
+			shifted := lvl.Blocks[:0]
+			for _, b := range lvl.Blocks {
+				if b.Y == height-1 {
+					floor = append(floor, b)
+				}
+				b.Y += dy
+				if b.Y < 0 {
+					return fmt.Errorf("terrain would leave the top of the board")
+				}
+				if b.Y < height {
+					shifted = append(shifted, b)
+				}
+			}
+			lvl.Blocks = shifted
+			for i := 0; i > dy; i-- {
+				for _, b := range floor {
+					b.Y = height - 1 + i
+					lvl.Blocks = append(lvl.Blocks, b)
+				}
+			}
+			for _, p := range lvl.Pickups {
+				if p.Y+dy < 2 || p.Y+dy >= height {
+					return fmt.Errorf("pickup at (%d,%d) would leave the open area", p.X, p.Y)
+				}
+			}
+			for i := range lvl.Pickups {
+				lvl.Pickups[i].Y += dy
+			}
+			return nil
+		},
+	}
+}
+
+// SwapBlockTypes exchanges two randomly chosen distinct block types
+func SwapBlockTypes() Mutation {
+	return Mutation{
+		Name: "swap-block-types",
+		Apply: func(lvl *level.Level, src rng.RandomSource) error {
+			perm := rng.Perm(src, len(level.BlockTypes))
+			a, b := level.BlockTypes[perm[0]], level.BlockTypes[perm[1]]
+			for i := range lvl.Blocks {
+				switch lvl.Blocks[i].Type {
+				case a:
+					lvl.Blocks[i].Type = b
+				case b:
+					lvl.Blocks[i].Type = a
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// AddPocket removes up to depth blocks from the top of a random non-empty column
+func AddPocket(depth int) Mutation {
+	return Mutation{
+		Name: fmt.Sprintf("add-pocket(%d)", depth),
+		Apply: func(lvl *level.Level, src rng.RandomSource) error {
+			heights := columnHeights(lvl)
+			var columns []int
+			for x := 0; x < editWidth(lvl); x++ {
+				if heights[x] > 0 {
+					columns = append(columns, x)
+				}
+			}
+			if len(columns) == 0 {
+				return fmt.Errorf("no terrain to carve a pocket into")
+			}
+			x := columns[src.Intn(len(columns))]
+			top := lvl.GridSize.Height - heights[x]
+			kept := lvl.Blocks[:0]
+			for _, b := range lvl.Blocks {
+				if b.X == x && b.Y >= top && b.Y < top+depth {
+					continue
+				}
+				kept = append(kept, b)
+			}
+			lvl.Blocks = kept
+			return nil
+		},
+	}
+}
+
+// RemovePocket fills a random well (a column lower than both neighbours)
+// up to the lower neighbour's height
+func RemovePocket() Mutation {
+	return Mutation{
+		Name: "remove-pocket",
+		Apply: func(lvl *level.Level, src rng.RandomSource) error {
+			heights := columnHeights(lvl)
+			width := editWidth(lvl)
+			var wells []int
+			for x := 0; x < width; x++ {
+				if neighbourFloor(heights, x, width) > heights[x] {
+					wells = append(wells, x)
+				}
+			}
+			if len(wells) == 0 {
+				return fmt.Errorf("level has no pockets to fill")
+			}
+			x := wells[src.Intn(len(wells))]
+			occupied := make(map[level.Point]bool, len(lvl.Pickups))
+			for _, p := range lvl.Pickups {
+				occupied[level.Point{X: p.X, Y: p.Y}] = true
+			}
+			for h := heights[x]; h < neighbourFloor(heights, x, width); h++ {
+				y := lvl.GridSize.Height - 1 - h
+				if occupied[level.Point{X: x, Y: y}] {
+					return fmt.Errorf("pickup at (%d,%d) sits in the pocket", x, y)
+				}
+				lvl.Blocks = append(lvl.Blocks, level.Block{
+					Type: level.BlockTypes[src.Intn(len(level.BlockTypes))],
+					X:    x,
+					Y:    y,
+				})
+			}
+			return nil
+		},
+	}
+}
+
+// JitterPickups moves every pickup to a random open cell within radius,
+// leaving it in place when no such cell exists
+func JitterPickups(radius int) Mutation {
+	return Mutation{
+		Name: fmt.Sprintf("jitter-pickups(%d)", radius),
+		Apply: func(lvl *level.Level, src rng.RandomSource) error {
+			if len(lvl.Pickups) == 0 {
+				return fmt.Errorf("level has no pickups")
+			}
+			width := editWidth(lvl)
+			open := make(map[level.Point]bool)
+			for _, c := range openCells(lvl) {
+				open[c] = true
+			}
+			for _, p := range lvl.Pickups {
+				delete(open, level.Point{X: p.X, Y: p.Y})
+			}
+			for i, p := range lvl.Pickups {
+				if p.X >= width {
+					continue
+				}
+				var choices []level.Point
+				for dy := -radius; dy <= radius; dy++ {
+					for dx := -radius; dx <= radius; dx++ {
+						c := level.Point{X: p.X + dx, Y: p.Y + dy}
+						if c.X < width && open[c] {
+							choices = append(choices, c)
+						}
+					}
+				}
+				if len(choices) == 0 {
+					continue
+				}
+				c := choices[src.Intn(len(choices))]
+				delete(open, c)
+				open[level.Point{X: p.X, Y: p.Y}] = true
+				lvl.Pickups[i].X, lvl.Pickups[i].Y = c.X, c.Y
+			}
+			return nil
+		},
+	}
+}
+
+// columnHeights returns the height of the topmost block in each column
+func columnHeights(lvl *level.Level) []int {
+	heights := make([]int, lvl.GridSize.Width)
+	for _, b := range lvl.Blocks {
+		if h := lvl.GridSize.Height - b.Y; h > heights[b.X] {
+			heights[b.X] = h
+		}
+	}
+	return heights
+}
+
+// neighbourFloor returns the lower of the neighbouring column heights,
+// treating the board edge as a wall
+func neighbourFloor(heights []int, x, width int) int {
+	floor := -1
+	for _, nx := range []int{x - 1, x + 1} {
+		if nx < 0 || nx >= width {
+			continue
+		}
+		if floor < 0 || heights[nx] < floor {
+			floor = heights[nx]
+		}
+	}
+	if floor < 0 {
+		return 0
+	}
+	return floor
+}
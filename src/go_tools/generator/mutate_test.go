@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// checkReachable fails the test unless every pickup can be reached from
+// the spawn rows, and on co-op levels every spawn zone reaches the goal
+func checkReachable(t *testing.T, lvl *level.Level, what string) {
+	t.Helper()
+	top := level.Zone{Width: lvl.GridSize.Width, Height: 2}
+	for _, p := range lvl.Pickups {
+		if !lvl.Reachable(top, level.Zone{X: p.X, Y: p.Y, Width: 1, Height: 1}) {
+			t.Fatalf("%s: pickup at (%d,%d) can't be reached", what, p.X, p.Y)
+		}
+	}
+	if lvl.Mode == level.ModeCoop && !coopReachable(lvl) {
+		t.Fatalf("%s: a spawn zone can't reach the goal", what)
+	}
+}
+
+func TestMutationsKeepLevelsValid(t *testing.T) {
+	const rounds = 12
+	applied := map[string]int{}
+	for _, mode := range []string{level.ModeStandard, level.ModeCoop, level.ModeMirror, level.ModeIdentical} {
+		for seed := int64(1); seed <= 4; seed++ {
+			cfg := utils.DefaultConfig()
+			cfg.GeneratorMode = mode
+			cfg.GeneratorSeed = seed
+			lvl, err := generate(t, cfg)
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", mode, seed, err)
+			}
+			for _, m := range Mutations() {
+				mutate := func() *level.Level {
+					src := rng.NewXoshiro(uint64(seed))
+					cur := lvl
+					for i := 0; i < rounds; i++ {
+						next, err := Mutate(cur, m, src, cfg.PickupRules)
+						if err != nil {
+							continue // refused, as when there's no pocket to fill
+						}
+						what := m.Name + " on " + mode
+						if err := next.Validate(); err != nil {
+							t.Fatalf("%s seed %d round %d: %v", what, seed, i, err)
+						}
+						if err := CheckLevel(next, cfg.PickupRules); err != nil {
+							t.Fatalf("%s seed %d round %d: %v", what, seed, i, err)
+						}
+						checkReachable(t, next, what)
+						applied[m.Name]++
+						cur = next
+					}
+					return cur
+				}
+				if a, b := mutate(), mutate(); !reflect.DeepEqual(a, b) {
+					t.Errorf("%s on %s seed %d: the same source mutated differently", m.Name, mode, seed)
+				}
+			}
+			if err := CheckLevel(lvl, cfg.PickupRules); err != nil {
+				t.Fatalf("%s seed %d: mutating changed the original: %v", mode, seed, err)
+			}
+		}
+	}
+	for _, m := range Mutations() {
+		if applied[m.Name] == 0 {
+			t.Errorf("%s never applied", m.Name)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// region identifies a RegionSize x RegionSize square of the board
+type region struct {
+	X, Y int
+}
+
+// pickupCounter tracks pickups per category for the whole level and per region
+type pickupCounter struct {
+	rules    utils.PickupRules
+	level    map[string]int
+	byRegion map[region]map[string]int
+}
+
+func newPickupCounter(rules utils.PickupRules) *pickupCounter {
+	return &pickupCounter{
+		rules:    rules,
+		level:    make(map[string]int),
+		byRegion: make(map[region]map[string]int),
+	}
+}
+
+func (c *pickupCounter) regionOf(x, y int) region {
+	size := c.rules.RegionSize
+	if size <= 0 {
+		return region{}
+	}
+	return region{x / size, y / size}
+}
+
+// allows reports whether one more pickup of the category fits at (x, y);
+// categories without a configured cap are unlimited
+func (c *pickupCounter) allows(category string, x, y int) bool {
+	if max, ok := c.rules.MaxPerLevel[category]; ok && c.level[category] >= max {
+		return false
+	}
+	if max, ok := c.rules.MaxPerRegion[category]; ok && c.byRegion[c.regionOf(x, y)][category] >= max {
+		return false
+	}
+	return true
+}
+
+func (c *pickupCounter) add(category string, x, y int) {
+	c.level[category]++
+	r := c.regionOf(x, y)
+	if c.byRegion[r] == nil {
+		c.byRegion[r] = make(map[string]int)
+	}
+	c.byRegion[r][category]++
+}
+
+// placePickups scatters spell pickups in the open space above the terrain,
+// skipping any spell whose category has reached its level or region cap
+func (g *Generator) placePickups(lvl *level.Level) {
+	rules := g.config.PickupRules
+	candidates := openCells(lvl)
+	if len(candidates) == 0 || rules.PickupsPerLevel <= 0 {
+		return
+	}
+
+	counter := newPickupCounter(rules)
+	for attempts := 0; len(lvl.Pickups) < rules.PickupsPerLevel && attempts < rules.PickupsPerLevel*10; attempts++ {
+		i := g.rng.Intn(len(candidates))
+		cell := candidates[i]
+		for _, j := range rng.Perm(g.rng, len(level.Spells)) {
+			spell := level.Spells[j]
+			category := level.SpellCategories[spell]
+			if !counter.allows(category, cell.X, cell.Y) {
+				continue
+			}
+			counter.add(category, cell.X, cell.Y)
+			lvl.Pickups = append(lvl.Pickups, level.Pickup{Spell: spell, X: cell.X, Y: cell.Y})
+			candidates[i] = candidates[len(candidates)-1]
+			candidates = candidates[:len(candidates)-1]
+			break
+		}
+		if len(candidates) == 0 {
+			break
+		}
+	}
+}
+
+// openCells returns empty cells above the terrain surface, excluding the
+// spawn rows and any goal area
+func openCells(lvl *level.Level) []level.Point {
+	grid := lvl.Occupancy()
+	var cells []level.Point
+	for x := 0; x < lvl.GridSize.Width; x++ {
+		for y := 2; y < lvl.GridSize.Height; y++ {
+			if grid[y][x] {
+				break
+			}
+			if lvl.GoalArea != nil && lvl.GoalArea.Contains(x, y) {
+				continue
+			}
+			cells = append(cells, level.Point{X: x, Y: y})
+		}
+	}
+	return cells
+}
+
+// sidePickups returns the pickups that share a player's side with column x;
+// in versus modes each half is capped on its own
+func sidePickups(lvl *level.Level, x int) []level.Pickup {
+	if lvl.Mode != level.ModeMirror && lvl.Mode != level.ModeIdentical {
+		return lvl.Pickups
+	}
+	half := lvl.GridSize.Width / 2
+	var side []level.Pickup
+	for _, p := range lvl.Pickups {
+		if (p.X < half) == (x < half) {
+			side = append(side, p)
+		}
+	}
+	return side
+}
+
+// CheckPickupCaps returns an error if the level's pickups exceed any
+// per-level or per-region category cap; versus levels are checked on the
+// left half, whose pickups the right half must match
+func CheckPickupCaps(lvl *level.Level, rules utils.PickupRules) error {
+	counter := newPickupCounter(rules)
+	for _, p := range sidePickups(lvl, 0) {
+		category := level.SpellCategories[p.Spell]
+		if !counter.allows(category, p.X, p.Y) {
+			r := counter.regionOf(p.X, p.Y)
+			return i18n.Errorf("generator.pickup_cap",
+				lvl.Name, p.Spell, p.X, p.Y, category, r.X, r.Y)
+		}
+		counter.add(category, p.X, p.Y)
+	}
+	return nil
+}
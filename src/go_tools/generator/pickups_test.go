@@ -0,0 +1,96 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+func TestGeneratedPickupsKeepToTheirCaps(t *testing.T) {
+	rules := utils.PickupRules{
+		PickupsPerLevel: 12,
+		MaxPerLevel:     map[string]int{level.CategoryOffense: 2, level.CategoryDefense: 3, level.CategoryUtility: 1},
+		MaxPerRegion:    map[string]int{level.CategoryOffense: 1, level.CategoryDefense: 1, level.CategoryUtility: 1},
+		RegionSize:      4,
+	}
+	full := 0
+	for _, mode := range []string{level.ModeStandard, level.ModeCoop, level.ModeMirror} {
+		for seed := int64(1); seed <= 15; seed++ {
+			cfg := utils.DefaultConfig()
+			cfg.GeneratorMode = mode
+			cfg.GeneratorSeed = seed
+			cfg.PickupRules = rules
+			lvl, err := generate(t, cfg)
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", mode, seed, err)
+			}
+			perLevel := map[string]int{}
+			perRegion := map[region]map[string]int{}
+			side := sidePickups(lvl, 0)
+			for _, p := range side {
+				category := level.SpellCategories[p.Spell]
+				perLevel[category]++
+				r := region{p.X / rules.RegionSize, p.Y / rules.RegionSize}
+				if perRegion[r] == nil {
+					perRegion[r] = map[string]int{}
+				}
+				if perRegion[r][category]++; perRegion[r][category] > rules.MaxPerRegion[category] {
+					t.Errorf("%s seed %d: %d %s pickups in region %v", mode, seed, perRegion[r][category], category, r)
+				}
+			}
+			for category, n := range perLevel {
+				if n > rules.MaxPerLevel[category] {
+					t.Errorf("%s seed %d: %d %s pickups, over the cap of %d", mode, seed, n, category, rules.MaxPerLevel[category])
+				}
+			}
+			if len(side) > rules.PickupsPerLevel {
+				t.Errorf("%s seed %d: %d pickups, over the total of %d", mode, seed, len(side), rules.PickupsPerLevel)
+			}
+			if len(side) == 6 {
+				full++ // every category at its cap
+			}
+			if err := CheckPickupCaps(lvl, rules); err != nil {
+				t.Errorf("%s seed %d: %v", mode, seed, err)
+			}
+		}
+	}
+	if full == 0 {
+		t.Error("no level filled its category caps, so they were never tested")
+	}
+}
+
+func TestGeneratedPickupsKeepToTheTotal(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		cfg := utils.DefaultConfig()
+		cfg.GeneratorSeed = seed
+		cfg.PickupRules.PickupsPerLevel = 2
+		lvl, err := generate(t, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lvl.Pickups) != 2 {
+			t.Errorf("seed %d: %d pickups, want the total of 2", seed, len(lvl.Pickups))
+		}
+	}
+}
+
+func TestCheckPickupCapsRefusesTooMany(t *testing.T) {
+	rules := utils.DefaultPickupRules()
+	lvl := level.New("caps", 10, 20)
+	// two offense pickups in one region, over its cap of one
+	lvl.Pickups = []level.Pickup{{Spell: level.SpellSpeedUp, X: 0, Y: 5}, {Spell: level.SpellAddBlocks, X: 1, Y: 6}}
+	if err := CheckPickupCaps(lvl, rules); err == nil {
+		t.Error("two offense pickups in one region passed")
+	}
+	// four across regions, over the level's cap of three
+	lvl.Pickups = []level.Pickup{{Spell: level.SpellSpeedUp, X: 0, Y: 2}, {Spell: level.SpellAddBlocks, X: 5, Y: 2},
+		{Spell: level.SpellSpeedUp, X: 0, Y: 10}, {Spell: level.SpellAddBlocks, X: 5, Y: 10}}
+	if err := CheckPickupCaps(lvl, rules); err == nil {
+		t.Error("four offense pickups passed")
+	}
+	lvl.Pickups = lvl.Pickups[:3]
+	if err := CheckPickupCaps(lvl, rules); err != nil {
+		t.Errorf("three offense pickups across regions: %v", err)
+	}
+}
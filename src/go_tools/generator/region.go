@@ -0,0 +1,255 @@
+package generator
+
+import (
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// regionAttempts bounds how many rerolls RegenerateRegion tries before giving up
+const regionAttempts = 20
+
+// RegenerateRegion rerolls the terrain and pickups inside a rectangle of an
+// existing level, leaving everything outside untouched. The result is
+// checked at the seams: every block must rest on the floor or another
+// block, co-op goals must stay reachable and versus halves stay matched
+// (the counterpart region is rerolled along with the selected one).
+func (g *Generator) RegenerateRegion(lvl *level.Level, area level.Zone) (*level.Level, error) {
+	area = clipZone(area, lvl.GridSize)
+	if area.Width <= 0 || area.Height <= 0 {
+		return nil, i18n.Errorf("generator.region_outside", lvl.Name)
+	}
+	if err := lvl.Validate(); err != nil {
+		return nil, err
+	}
+	if lvl.Mode == level.ModeMirror || lvl.Mode == level.ModeIdentical {
+		if half := lvl.GridSize.Width / 2; area.X < half && area.X+area.Width > half {
+			return nil, i18n.Errorf("generator.region_versus_half", lvl.Name)
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < regionAttempts; attempt++ {
+		out := cloneLevel(lvl)
+		g.rerollArea(out, area)
+		if out.Mode == level.ModeMirror || out.Mode == level.ModeIdentical {
+			mirrorArea(out, area)
+		}
+		if err := CheckLevel(out, g.config.PickupRules); err != nil {
+			lastErr = err
+			continue
+		}
+		return out, nil
+	}
+	return nil, i18n.Errorf("generator.region_reroll", lvl.Name, regionAttempts, lastErr)
+}
+
+// rerollArea clears the area and stacks new blocks from its lower edge in
+// every column that has support there, then refills the area's pickups
+func (g *Generator) rerollArea(lvl *level.Level, area level.Zone) {
+	var removedPickups int
+	lvl.Blocks, _ = dropBlocks(lvl.Blocks, area)
+	lvl.Pickups, removedPickups = dropPickups(lvl.Pickups, area)
+
+	grid := lvl.Occupancy()
+	bottom := area.Y + area.Height - 1
+	top := area.Y
+	// Columns carrying blocks above the area must stay filled to the top
+	// of the area, otherwise the blocks above would float.
+	for x := area.X; x < area.X+area.Width; x++ {
+		supported := bottom == lvl.GridSize.Height-1 || grid[bottom+1][x]
+		if !supported {
+			continue
+		}
+		carrying := top > 0 && grid[top-1][x]
+		height := area.Height
+		if !carrying {
+			height = g.rng.Intn(area.Height + 1)
+		}
+		for i := 0; i < height; i++ {
+			g.stackAt(lvl, x, bottom-i)
+		}
+	}
+
+	if removedPickups == 0 {
+		return
+	}
+	counter := newPickupCounter(g.config.PickupRules)
+	for _, p := range sidePickups(lvl, area.X) {
+		counter.add(level.SpellCategories[p.Spell], p.X, p.Y)
+	}
+	var cells []level.Point
+	for _, c := range openCells(lvl) {
+		if area.Contains(c.X, c.Y) {
+			cells = append(cells, c)
+		}
+	}
+	for placed := 0; placed < removedPickups && len(cells) > 0; {
+		i := g.rng.Intn(len(cells))
+		cell := cells[i]
+		cells[i] = cells[len(cells)-1]
+		cells = cells[:len(cells)-1]
+		for _, j := range rng.Perm(g.rng, len(level.Spells)) {
+			spell := level.Spells[j]
+			if category := level.SpellCategories[spell]; counter.allows(category, cell.X, cell.Y) {
+				counter.add(category, cell.X, cell.Y)
+				lvl.Pickups = append(lvl.Pickups, level.Pickup{Spell: spell, X: cell.X, Y: cell.Y})
+				placed++
+				break
+			}
+		}
+	}
+}
+
+// stackAt places a random block at (x, y)
+func (g *Generator) stackAt(lvl *level.Level, x, y int) {
+	block := level.Block{
+		Type: level.BlockTypes[g.rng.Intn(len(level.BlockTypes))],
+		X:    x,
+		Y:    y,
+	}
+	if g.rng.Float64() < g.config.SpecialBlockChance {
+		block.Special = level.SpecialKinds[g.rng.Intn(len(level.SpecialKinds))]
+	}
+	lvl.Blocks = append(lvl.Blocks, block)
+}
+
+// CheckLevel runs every structural check an edited level must pass:
+// bounds and overlaps, pickup caps, block support, co-op reachability and
+// versus half matching
+func CheckLevel(lvl *level.Level, rules utils.PickupRules) error {
+	if err := lvl.Validate(); err != nil {
+		return err
+	}
+	if err := CheckPickupCaps(lvl, rules); err != nil {
+		return err
+	}
+	if err := CheckSupport(lvl); err != nil {
+		return err
+	}
+	switch lvl.Mode {
+	case level.ModeCoop:
+		if lvl.GoalArea != nil && !coopReachable(lvl) {
+			return i18n.Errorf("generator.goal_unreachable", lvl.Name)
+		}
+	case level.ModeMirror, level.ModeIdentical:
+		return CheckVersusHalves(lvl)
+	}
+	return nil
+}
+
+// CheckSupport returns an error for the first block that neither rests on
+// the floor nor sits on another block
+func CheckSupport(lvl *level.Level) error {
+	grid := lvl.Occupancy()
+	for _, b := range lvl.Blocks {
+		if b.Y == lvl.GridSize.Height-1 || grid[b.Y+1][b.X] {
+			continue
+		}
+		if lvl.Mode == level.ModeCoop && lvl.GoalArea != nil && lvl.GoalArea.Contains(b.X, b.Y+1) {
+			continue // overhangs above the co-op goal are carved deliberately
+		}
+		return i18n.Errorf("generator.block_floating", lvl.Name, b.X, b.Y)
+	}
+	return nil
+}
+
+// mirrorArea copies the contents of the area onto the counterpart area of
+// the other versus half
+func mirrorArea(lvl *level.Level, area level.Zone) {
+	half := lvl.GridSize.Width / 2
+	var mirrored level.Zone
+	mirrored.Y, mirrored.Height, mirrored.Width = area.Y, area.Height, area.Width
+	x0 := counterpartX(lvl.Mode, area.X, half)
+	x1 := counterpartX(lvl.Mode, area.X+area.Width-1, half)
+	if x0 > x1 {
+		x0, x1 = x1, x0
+	}
+	mirrored.X = x0
+	mirrored.Width = x1 - x0 + 1
+
+	lvl.Blocks, _ = dropBlocks(lvl.Blocks, mirrored)
+	lvl.Pickups, _ = dropPickups(lvl.Pickups, mirrored)
+	for _, b := range append([]level.Block(nil), lvl.Blocks...) {
+		if area.Contains(b.X, b.Y) {
+			b.X = counterpartX(lvl.Mode, b.X, half)
+			lvl.Blocks = append(lvl.Blocks, b)
+		}
+	}
+	for _, p := range append([]level.Pickup(nil), lvl.Pickups...) {
+		if area.Contains(p.X, p.Y) {
+			p.X = counterpartX(lvl.Mode, p.X, half)
+			lvl.Pickups = append(lvl.Pickups, p)
+		}
+	}
+}
+
+func dropBlocks(blocks []level.Block, area level.Zone) ([]level.Block, int) {
+	kept := make([]level.Block, 0, len(blocks))
+	for _, b := range blocks {
+		if !area.Contains(b.X, b.Y) {
+			kept = append(kept, b)
+		}
+	}
+	return kept, len(blocks) - len(kept)
+}
+
+func dropPickups(pickups []level.Pickup, area level.Zone) ([]level.Pickup, int) {
+	kept := make([]level.Pickup, 0, len(pickups))
+	for _, p := range pickups {
+		if !area.Contains(p.X, p.Y) {
+			kept = append(kept, p)
+		}
+	}
+	return kept, len(pickups) - len(kept)
+}
+
+func clipZone(z level.Zone, size level.GridSize) level.Zone {
+	x1, y1 := z.X+z.Width, z.Y+z.Height
+	if z.X < 0 {
+		z.X = 0
+	}
+	if z.Y < 0 {
+		z.Y = 0
+	}
+	if x1 > size.Width {
+		x1 = size.Width
+	}
+	if y1 > size.Height {
+		y1 = size.Height
+	}
+	z.Width, z.Height = x1-z.X, y1-z.Y
+	return z
+}
+
+// cloneLevel returns a deep copy of the level
+func cloneLevel(lvl *level.Level) *level.Level {
+	out := *lvl
+	out.Blocks = append([]level.Block(nil), lvl.Blocks...)
+	out.Pickups = append([]level.Pickup(nil), lvl.Pickups...)
+	out.SpawnPoints = append([]level.Point(nil), lvl.SpawnPoints...)
+	out.SpawnZones = append([]level.Zone(nil), lvl.SpawnZones...)
+	out.Objectives = append([]level.Objective(nil), lvl.Objectives...)
+	if lvl.GoalArea != nil {
+		goal := *lvl.GoalArea
+		out.GoalArea = &goal
+	}
+	if lvl.Pieces != nil {
+		seq := *lvl.Pieces
+		seq.Fixed = append([]string(nil), lvl.Pieces.Fixed...)
+		out.Pieces = &seq
+	}
+	out.Hints = append([]level.Hint(nil), lvl.Hints...)
+	if lvl.Metadata != nil {
+		out.Metadata = make(map[string]string, len(lvl.Metadata))
+		for k, v := range lvl.Metadata {
+			out.Metadata[k] = v
+		}
+	}
+	out.SpecialRules = make(map[string]float64, len(lvl.SpecialRules))
+	for k, v := range lvl.SpecialRules {
+		out.SpecialRules[k] = v
+	}
+	return &out
+}
@@ -0,0 +1,111 @@
+package generator
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// outside is what of the level lies outside the zones, in a fixed order
+func outside(lvl *level.Level, zones ...level.Zone) ([]level.Block, []level.Pickup) {
+	in := func(x, y int) bool {
+		for _, z := range zones {
+			if z.Contains(x, y) {
+				return true
+			}
+		}
+		return false
+	}
+	var blocks []level.Block
+	for _, b := range lvl.Blocks {
+		if !in(b.X, b.Y) {
+			blocks = append(blocks, b)
+		}
+	}
+	var pickups []level.Pickup
+	for _, p := range lvl.Pickups {
+		if !in(p.X, p.Y) {
+			pickups = append(pickups, p)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Y < blocks[j].Y || blocks[i].Y == blocks[j].Y && blocks[i].X < blocks[j].X
+	})
+	sort.Slice(pickups, func(i, j int) bool {
+		return pickups[i].Y < pickups[j].Y || pickups[i].Y == pickups[j].Y && pickups[i].X < pickups[j].X
+	})
+	return blocks, pickups
+}
+
+func TestRegenerateRegionLeavesTheRestAlone(t *testing.T) {
+	for _, mode := range []string{level.ModeStandard, level.ModeCoop, level.ModeMirror} {
+		for seed := int64(1); seed <= 5; seed++ {
+			cfg := utils.DefaultConfig()
+			cfg.GeneratorMode = mode
+			cfg.GeneratorSeed = seed
+			gen, err := NewGenerator(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lvl, err := gen.Generate("region")
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", mode, seed, err)
+			}
+			h := lvl.GridSize.Height
+			for _, area := range []level.Zone{
+				{X: 1, Y: h - 6, Width: 3, Height: 4}, // mid-terrain, with seams on all sides
+				{X: 0, Y: h - 3, Width: 4, Height: 3}, // on the floor and the left wall
+				{X: 2, Y: 4, Width: 3, Height: 3},     // open space above the terrain
+			} {
+				out, err := gen.RegenerateRegion(lvl, area)
+				if err != nil {
+					t.Fatalf("%s seed %d %+v: %v", mode, seed, area, err)
+				}
+				zones := []level.Zone{area}
+				if mode == level.ModeMirror {
+					half := lvl.GridSize.Width / 2
+					zones = append(zones, level.Zone{X: 2*half - area.X - area.Width, Y: area.Y, Width: area.Width, Height: area.Height})
+				}
+				wantBlocks, wantPickups := outside(lvl, zones...)
+				gotBlocks, gotPickups := outside(out, zones...)
+				if !reflect.DeepEqual(gotBlocks, wantBlocks) || !reflect.DeepEqual(gotPickups, wantPickups) {
+					t.Fatalf("%s seed %d %+v: cells outside the region changed", mode, seed, area)
+				}
+				if err := CheckLevel(out, cfg.PickupRules); err != nil {
+					t.Fatalf("%s seed %d %+v: %v", mode, seed, area, err)
+				}
+				// the seam above the region: every block resting on it is still held up
+				grid := out.Occupancy()
+				for _, b := range out.Blocks {
+					if b.Y == area.Y-1 && area.Contains(b.X, b.Y+1) && !grid[b.Y+1][b.X] {
+						t.Fatalf("%s seed %d %+v: block %+v floats over the region", mode, seed, area, b)
+					}
+				}
+				checkReachable(t, out, mode+" region")
+			}
+		}
+	}
+}
+
+func TestRegenerateRegionRefusesBadAreas(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.GeneratorMode = level.ModeMirror
+	gen, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lvl, err := gen.Generate("region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	half := lvl.GridSize.Width / 2
+	if _, err := gen.RegenerateRegion(lvl, level.Zone{X: half - 1, Y: 0, Width: 2, Height: 2}); err == nil {
+		t.Error("regenerated a region across the versus halves")
+	}
+	if _, err := gen.RegenerateRegion(lvl, level.Zone{X: lvl.GridSize.Width, Y: 0, Width: 2, Height: 2}); err == nil {
+		t.Error("regenerated a region off the board")
+	}
+}
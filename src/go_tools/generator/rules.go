@@ -0,0 +1,355 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Constraint is a designer rule a generated level must satisfy
+type Constraint interface {
+	// Check returns an error describing the first violation
+	Check(lvl *level.Level) error
+	// Repair removes what it can of any violation; rules that can only be
+	// met by generating more content leave the level unchanged
+	Repair(lvl *level.Level)
+	// String returns the rule as written in the rules file
+	String() string
+}
+
+// LoadRules parses a rules file
+func LoadRules(path string) ([]Constraint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules, err := ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseRules reads one rule per line; blank lines and lines starting with #
+// are ignored. Rows are numbered from the floor, starting at 1.
+//
+//	at most 2 bomb blocks per 10 rows
+//	at most 3 offense pickups
+//	at least 1 heavy blocks
+//	ice only above row 15
+//	special blocks only below row 8
+//
+// Block subjects are a special kind (bomb, ice, heavy), a piece type (I, T,
+// ...), "special" or "all". Pickup subjects are a spell (clear_line), a
+// category (offense) or "all".
+func ParseRules(r io.Reader) ([]Constraint, error) {
+	var rules []Constraint
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, i18n.Errorf("rules.line", n, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+func parseRule(line string) (Constraint, error) {
+	words := strings.Fields(strings.ToLower(line))
+	switch {
+	case len(words) >= 4 && words[0] == "at" && (words[1] == "most" || words[1] == "least"):
+		n, err := strconv.Atoi(words[2])
+		if err != nil || n < 0 {
+			return nil, i18n.Errorf("rules.expected_count", "at "+words[1], words[2])
+		}
+		subject, rest, err := parseSubject(words[3:])
+		if err != nil {
+			return nil, err
+		}
+		rule := &countRule{text: line, subject: subject, limit: n, atLeast: words[1] == "least"}
+		if len(rest) == 0 {
+			return rule, nil
+		}
+		if len(rest) == 3 && rest[0] == "per" && (rest[2] == "rows" || rest[2] == "row") && !rule.atLeast {
+			if rule.per, err = strconv.Atoi(rest[1]); err != nil || rule.per <= 0 {
+				return nil, i18n.Errorf("rules.expected_rows", "per", rest[1])
+			}
+			return rule, nil
+		}
+		return nil, i18n.Errorf("rules.unexpected", strings.Join(rest, " "))
+
+	default:
+		subject, rest, err := parseSubject(words)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) != 4 || rest[0] != "only" || rest[2] != "row" || (rest[1] != "above" && rest[1] != "below") {
+			return nil, i18n.Errorf("rules.unrecognized", line)
+		}
+		row, err := strconv.Atoi(rest[3])
+		if err != nil {
+			return nil, i18n.Errorf("rules.expected_row", rest[3])
+		}
+		return &rowRule{text: line, subject: subject, row: row, above: rest[1] == "above"}, nil
+	}
+}
+
+// subject selects the blocks or pickups a rule talks about
+type subject struct {
+	name    string
+	pickups bool
+}
+
+// parseSubject reads "<name> [blocks|pickups]" and returns the remaining words
+func parseSubject(words []string) (subject, []string, error) {
+	if len(words) == 0 {
+		return subject{}, nil, i18n.Errorf("rules.missing_subject")
+	}
+	s := subject{name: words[0]}
+	rest := words[1:]
+	if len(rest) > 0 {
+		switch rest[0] {
+		case "block", "blocks":
+			rest = rest[1:]
+		case "pickup", "pickups":
+			s.pickups = true
+			rest = rest[1:]
+		}
+	}
+	if !s.pickups && !knownBlockSubject(s.name) {
+		if knownPickupSubject(s.name) {
+			s.pickups = true
+		} else {
+			return s, nil, i18n.Errorf("rules.unknown_subject", s.name)
+		}
+	}
+	if s.pickups && !knownPickupSubject(s.name) {
+		return s, nil, i18n.Errorf("rules.unknown_pickup_subject", s.name)
+	}
+	return s, rest, nil
+}
+
+func knownBlockSubject(name string) bool {
+	if name == "all" || name == "special" {
+		return true
+	}
+	for _, k := range level.SpecialKinds {
+		if name == k {
+			return true
+		}
+	}
+	for _, t := range level.BlockTypes {
+		if name == strings.ToLower(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func knownPickupSubject(name string) bool {
+	if name == "all" {
+		return true
+	}
+	for spell, category := range level.SpellCategories {
+		if name == strings.ToLower(spell) || name == category {
+			return true
+		}
+	}
+	return false
+}
+
+func (s subject) matchesBlock(b level.Block) bool {
+	switch s.name {
+	case "all":
+		return true
+	case "special":
+		return b.Special != ""
+	}
+	return b.Special == s.name || strings.ToLower(b.Type) == s.name
+}
+
+func (s subject) matchesPickup(p level.Pickup) bool {
+	return s.name == "all" || strings.ToLower(p.Spell) == s.name || level.SpellCategories[p.Spell] == s.name
+}
+
+// item is a matched block or pickup with its row counted from the floor
+type item struct {
+	index int
+	row   int
+}
+
+func (s subject) items(lvl *level.Level) []item {
+	var items []item
+	height := lvl.GridSize.Height
+	if s.pickups {
+		for i, p := range lvl.Pickups {
+			if s.matchesPickup(p) {
+				items = append(items, item{i, height - p.Y})
+			}
+		}
+		return items
+	}
+	for i, b := range lvl.Blocks {
+		if s.matchesBlock(b) {
+			items = append(items, item{i, height - b.Y})
+		}
+	}
+	return items
+}
+
+// remove drops the matched items; special-kind block rules demote the block
+// to a plain block instead of deleting terrain
+func (s subject) remove(lvl *level.Level, drop map[int]bool) {
+	if len(drop) == 0 {
+		return
+	}
+	if s.pickups {
+		kept := lvl.Pickups[:0]
+		for i, p := range lvl.Pickups {
+			if !drop[i] {
+				kept = append(kept, p)
+			}
+		}
+		lvl.Pickups = kept
+		return
+	}
+	for i := range drop {
+		lvl.Blocks[i].Special = ""
+	}
+}
+
+// countRule limits how many matching items a level (or each band of rows) holds
+type countRule struct {
+	text    string
+	subject subject
+	limit   int
+	atLeast bool
+	per     int // band height in rows; 0 means the whole level
+}
+
+func (r *countRule) String() string { return r.text }
+
+func (r *countRule) band(row int) int {
+	if r.per == 0 {
+		return 0
+	}
+	return (row - 1) / r.per
+}
+
+func (r *countRule) Check(lvl *level.Level) error {
+	counts := make(map[int]int)
+	for _, it := range r.subject.items(lvl) {
+		counts[r.band(it.row)]++
+	}
+	if r.atLeast {
+		if counts[0] < r.limit {
+			return i18n.Errorf("rules.found", r.text, counts[0])
+		}
+		return nil
+	}
+	for band, n := range counts {
+		if n > r.limit {
+			if r.per == 0 {
+				return i18n.Errorf("rules.found", r.text, n)
+			}
+			return i18n.Errorf("rules.found_in_rows", r.text, n, band*r.per+1, (band+1)*r.per)
+		}
+	}
+	return nil
+}
+
+func (r *countRule) Repair(lvl *level.Level) {
+	if r.atLeast || r.subject.isTerrain() {
+		return
+	}
+	seen := make(map[int]int)
+	drop := make(map[int]bool)
+	for _, it := range r.subject.items(lvl) {
+		band := r.band(it.row)
+		if seen[band]++; seen[band] > r.limit {
+			drop[it.index] = true
+		}
+	}
+	r.subject.remove(lvl, drop)
+}
+
+// isTerrain reports whether removing matches would delete terrain blocks
+// rather than demote special blocks
+func (s subject) isTerrain() bool {
+	return !s.pickups && s.name != "special" && !isSpecialKind(s.name)
+}
+
+func isSpecialKind(name string) bool {
+	for _, k := range level.SpecialKinds {
+		if name == k {
+			return true
+		}
+	}
+	return false
+}
+
+// rowRule confines matching items to rows above or below a given row
+type rowRule struct {
+	text    string
+	subject subject
+	row     int
+	above   bool
+}
+
+func (r *rowRule) String() string { return r.text }
+
+func (r *rowRule) allowed(row int) bool {
+	if r.above {
+		return row > r.row
+	}
+	return row < r.row
+}
+
+func (r *rowRule) Check(lvl *level.Level) error {
+	for _, it := range r.subject.items(lvl) {
+		if !r.allowed(it.row) {
+			return i18n.Errorf("rules.match_on_row", r.text, it.row)
+		}
+	}
+	return nil
+}
+
+func (r *rowRule) Repair(lvl *level.Level) {
+	if r.subject.isTerrain() {
+		return
+	}
+	drop := make(map[int]bool)
+	for _, it := range r.subject.items(lvl) {
+		if !r.allowed(it.row) {
+			drop[it.index] = true
+		}
+	}
+	r.subject.remove(lvl, drop)
+}
+
+// CheckRules returns the first rule the level violates
+func CheckRules(lvl *level.Level, rules []Constraint) error {
+	_, err := firstViolation(lvl, rules)
+	return err
+}
+
+func firstViolation(lvl *level.Level, rules []Constraint) (Constraint, error) {
+	for _, r := range rules {
+		if err := r.Check(lvl); err != nil {
+			return r, err
+		}
+	}
+	return nil, nil
+}
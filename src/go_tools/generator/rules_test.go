@@ -0,0 +1,67 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+func TestParseRulesRejectsMalformedLines(t *testing.T) {
+	bad := []string{
+		"at most x bomb blocks",
+		"at most 2 lava blocks",
+		"ice only sideways row 3",
+		"at least 2 bomb blocks per 10 rows",
+	}
+	for _, line := range bad {
+		if _, err := ParseRules(strings.NewReader(line)); err == nil {
+			t.Errorf("%q: expected a parse error", line)
+		}
+	}
+}
+
+func TestRulesCheckAndRepair(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# bombs are rationed, ice stays high
+at most 1 bomb blocks per 2 rows
+ice only above row 2
+at most 1 offense pickups
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lvl := level.New("rules", 4, 6)
+	lvl.Blocks = []level.Block{
+		{Type: "I", X: 0, Y: 5, Special: level.SpecialBomb},
+		{Type: "I", X: 1, Y: 5, Special: level.SpecialBomb},
+		{Type: "O", X: 2, Y: 5, Special: level.SpecialIce},
+		{Type: "O", X: 2, Y: 4},
+		{Type: "T", X: 2, Y: 3, Special: level.SpecialIce},
+	}
+	lvl.Pickups = []level.Pickup{
+		{Spell: level.SpellAddBlocks, X: 0, Y: 2},
+		{Spell: level.SpellSpeedUp, X: 1, Y: 2},
+		{Spell: level.SpellClearLine, X: 3, Y: 2},
+	}
+
+	if err := CheckRules(lvl, rules); err == nil {
+		t.Fatal("expected violations before repair")
+	}
+	for _, r := range rules {
+		r.Repair(lvl)
+	}
+	if err := CheckRules(lvl, rules); err != nil {
+		t.Fatalf("after repair: %v", err)
+	}
+	if len(lvl.Blocks) != 5 {
+		t.Errorf("repair must not delete terrain, have %d blocks", len(lvl.Blocks))
+	}
+	if lvl.Blocks[4].Special != level.SpecialIce {
+		t.Errorf("ice on row 3 should survive, got %q", lvl.Blocks[4].Special)
+	}
+	if len(lvl.Pickups) != 2 {
+		t.Errorf("expected one offense pickup removed, have %d pickups", len(lvl.Pickups))
+	}
+}
@@ -0,0 +1,26 @@
+package generator
+
+import (
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+// assignPieces embeds the piece sequence in the level: the configured
+// randomizer with a per-level seed, plus a fixed opening queue when
+// FixedPieceCount is set
+func (g *Generator) assignPieces(lvl *level.Level) error {
+	seq := &level.PieceSequence{
+		Randomizer: g.config.PieceRandomizer,
+		Seed:       int64(g.rng.Intn(1<<31-1)) + 1,
+	}
+	if g.config.FixedPieceCount > 0 {
+		r, err := pieces.New(seq.Randomizer, rng.NewXoshiro(uint64(seq.Seed)))
+		if err != nil {
+			return err
+		}
+		seq.Fixed = pieces.Take(r, g.config.FixedPieceCount)
+	}
+	lvl.Pieces = seq
+	return nil
+}
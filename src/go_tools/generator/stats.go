@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// LevelStats summarizes a generated level for dry runs and batch reports
+type LevelStats struct {
+	Name          string  `json:"name"`
+	Mode          string  `json:"mode"`
+	Blocks        int     `json:"blocks"`
+	SpecialBlocks int     `json:"specialBlocks"`
+	Pickups       int     `json:"pickups"`
+	Density       float64 `json:"density"`   // share of cells covered by blocks
+	MaxHeight     int     `json:"maxHeight"` // tallest column in cells
+	Holes         int     `json:"holes"`     // empty cells with a block above them
+	Difficulty    float64 `json:"difficulty"`
+}
+
+// ComputeStats measures a level and scores its difficulty with the
+// analyzer's difficulty model
+func ComputeStats(lvl *level.Level) LevelStats {
+	stats := measure(lvl)
+	stats.Difficulty = analyzer.Estimate(lvl)
+	return stats
+}
+
+// measure fills in every statistic except the difficulty
+func measure(lvl *level.Level) LevelStats {
+	stats := LevelStats{
+		Name:    lvl.Name,
+		Mode:    lvl.Mode,
+		Blocks:  len(lvl.Blocks),
+		Pickups: len(lvl.Pickups),
+	}
+	for _, b := range lvl.Blocks {
+		if b.Special != "" {
+			stats.SpecialBlocks++
+		}
+	}
+
+	width, height := lvl.GridSize.Width, lvl.GridSize.Height
+	if cells := width * height; cells > 0 {
+		stats.Density = float64(stats.Blocks) / float64(cells)
+	}
+
+	grid := lvl.Occupancy()
+	for x := 0; x < width; x++ {
+		covered := false
+		for y := 0; y < height; y++ {
+			switch {
+			case grid[y][x] && !covered:
+				covered = true
+				if h := height - y; h > stats.MaxHeight {
+					stats.MaxHeight = h
+				}
+			case !grid[y][x] && covered:
+				stats.Holes++
+			}
+		}
+	}
+
+	return stats
+}
+
+// EstimateHeuristic is a cheap DifficultyEstimator that only looks at
+// terrain statistics, for callers that can't afford the clear simulation
+func EstimateHeuristic(lvl *level.Level) float64 {
+	return HeuristicDifficulty(lvl, measure(lvl))
+}
+
+// HeuristicDifficulty returns a quick 0..1 difficulty estimate from terrain
+// height, holes and special blocks
+func HeuristicDifficulty(lvl *level.Level, stats LevelStats) float64 {
+	height := float64(lvl.GridSize.Height)
+	if height == 0 || stats.Blocks == 0 {
+		return 0
+	}
+	score := 0.5*float64(stats.MaxHeight)/height +
+		0.3*float64(stats.Holes)/float64(stats.Blocks) +
+		0.2*float64(stats.SpecialBlocks)/float64(stats.Blocks)
+	if score > 1 {
+		score = 1
+	}
+	return score
+}
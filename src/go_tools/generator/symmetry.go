@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// stackMirror places a copy of the block just stacked on the mirrored column
+func (g *Generator) stackMirror(lvl *level.Level, columns []int, x int) {
+	block := lvl.Blocks[len(lvl.Blocks)-1]
+	block.X = x
+	block.Y = lvl.GridSize.Height - 1 - columns[x]
+	lvl.Blocks = append(lvl.Blocks, block)
+	columns[x]++
+}
+
+// symmetrizeColumns makes every column's stack read the same from the top
+// as from the floor, mirroring types and special kinds about its middle
+func symmetrizeColumns(lvl *level.Level) {
+	byColumn := make(map[int][]int)
+	for i, b := range lvl.Blocks {
+		byColumn[b.X] = append(byColumn[b.X], i)
+	}
+	for _, idx := range byColumn {
+		sort.Slice(idx, func(a, b int) bool { return lvl.Blocks[idx[a]].Y > lvl.Blocks[idx[b]].Y })
+		for i, j := 0, len(idx)-1; i < j; i, j = i+1, j-1 {
+			lvl.Blocks[idx[j]].Type = lvl.Blocks[idx[i]].Type
+			lvl.Blocks[idx[j]].Special = lvl.Blocks[idx[i]].Special
+		}
+	}
+}
+
+// addAccents breaks otherwise symmetric terrain in k places, either by
+// retyping a block or by adding one block on top of a single column
+func (g *Generator) addAccents(lvl *level.Level, columns []int, k int) {
+	maxColumn := lvl.GridSize.Height / 2
+	for i := 0; i < k && len(lvl.Blocks) > 0; i++ {
+		if g.rng.Intn(2) == 0 {
+			b := &lvl.Blocks[g.rng.Intn(len(lvl.Blocks))]
+			for {
+				t := level.BlockTypes[g.rng.Intn(len(level.BlockTypes))]
+				if t != b.Type {
+					b.Type = t
+					break
+				}
+			}
+			continue
+		}
+		if x := g.rng.Intn(len(columns)); columns[x] < maxColumn {
+			g.stackBlock(lvl, columns, x)
+		}
+	}
+}
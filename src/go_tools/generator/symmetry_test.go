@@ -0,0 +1,129 @@
+package generator
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// terrain places a level's terrain alone, before pickups and rules
+func terrain(t *testing.T, cfg utils.Config) *level.Level {
+	t.Helper()
+	gen, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lvl := level.New("symmetry", cfg.LevelWidth, cfg.LevelHeight)
+	gen.placeTerrain(lvl)
+	return lvl
+}
+
+// asymmetryX counts the cells whose left-right mirror differs in occupancy
+// or block type
+func asymmetryX(lvl *level.Level) int {
+	cells := map[level.Point]level.Block{}
+	for _, b := range lvl.Blocks {
+		cells[level.Point{X: b.X, Y: b.Y}] = b
+	}
+	n := 0
+	width := lvl.GridSize.Width
+	for y := 0; y < lvl.GridSize.Height; y++ {
+		for x := 0; x < width/2; x++ {
+			a, okA := cells[level.Point{X: x, Y: y}]
+			b, okB := cells[level.Point{X: width - 1 - x, Y: y}]
+			if okA != okB || a.Type != b.Type || a.Special != b.Special {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// asymmetryY counts the block pairs that differ between a column's stack
+// read from its top and from the floor
+func asymmetryY(lvl *level.Level) int {
+	byColumn := map[int][]level.Block{}
+	for _, b := range lvl.Blocks {
+		byColumn[b.X] = append(byColumn[b.X], b)
+	}
+	n := 0
+	for _, stack := range byColumn {
+		sort.Slice(stack, func(i, j int) bool { return stack[i].Y > stack[j].Y })
+		for i, j := 0, len(stack)-1; i < j; i, j = i+1, j-1 {
+			if stack[i].Type != stack[j].Type || stack[i].Special != stack[j].Special {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func symmetryConfig(seed int64, x, y float64, accents int) utils.Config {
+	cfg := utils.DefaultConfig()
+	cfg.GeneratorSeed = seed
+	cfg.SymmetryXProbability = x
+	cfg.SymmetryYProbability = y
+	cfg.SymmetryAccents = accents
+	cfg.SpecialBlockChance = 0.3
+	return cfg
+}
+
+func TestSymmetryAxesApplyIndependently(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		lvl := terrain(t, symmetryConfig(seed, 1, 0, 0))
+		if n := asymmetryX(lvl); n != 0 {
+			t.Errorf("seed %d: %d cells break left-right symmetry", seed, n)
+		}
+
+		lvl = terrain(t, symmetryConfig(seed, 0, 1, 0))
+		if n := asymmetryY(lvl); n != 0 {
+			t.Errorf("seed %d: %d block pairs break top-bottom symmetry", seed, n)
+		}
+
+		lvl = terrain(t, symmetryConfig(seed, 1, 1, 0))
+		if x, y := asymmetryX(lvl), asymmetryY(lvl); x != 0 || y != 0 {
+			t.Errorf("seed %d: both axes asked for, %d and %d breaks", seed, x, y)
+		}
+	}
+}
+
+func TestSymmetryProbabilitiesAreRespected(t *testing.T) {
+	const runs = 300
+	mirrored, stacked := 0, 0
+	for seed := int64(1); seed <= runs; seed++ {
+		lvl := terrain(t, symmetryConfig(seed, 0.3, 0.7, 0))
+		if asymmetryX(lvl) == 0 {
+			mirrored++
+		}
+		if asymmetryY(lvl) == 0 {
+			stacked++
+		}
+	}
+	// Random terrain is almost never symmetric by chance, so the shares
+	// track the configured probabilities
+	if share := float64(mirrored) / runs; share < 0.2 || share > 0.4 {
+		t.Errorf("%.2f of levels mirrored left to right, want about 0.3", share)
+	}
+	if share := float64(stacked) / runs; share < 0.6 || share > 0.8 {
+		t.Errorf("%.2f of levels symmetric top to bottom, want about 0.7", share)
+	}
+}
+
+func TestSymmetryAccentsBreakItSparingly(t *testing.T) {
+	const accents = 3
+	broken := 0
+	for seed := int64(1); seed <= 20; seed++ {
+		n := asymmetryX(terrain(t, symmetryConfig(seed, 1, 0, accents)))
+		if n > accents {
+			t.Errorf("seed %d: %d breaks from %d accents", seed, n, accents)
+		}
+		if n > 0 {
+			broken++
+		}
+	}
+	if broken == 0 {
+		t.Error("no accent ever broke the symmetry")
+	}
+}
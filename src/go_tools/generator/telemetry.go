@@ -0,0 +1,243 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+)
+
+// Generation stages timed by the telemetry
+const (
+	StageTerrain  = "terrain"
+	StagePickups  = "pickups"
+	StageRules    = "rules"
+	StageValidate = "validate"
+	StageEstimate = "estimate"
+)
+
+// Rejection reasons recorded by the telemetry; rule violations are
+// recorded as "rule: " followed by the rule text
+const (
+	RejectCoopUnreachable = "coop_unreachable"
+	RejectTimeBudget      = "time_budget"
+)
+
+// difficultyBuckets is the number of equal-width histogram buckets over 0..1
+const difficultyBuckets = 10
+
+// Telemetry aggregates generator statistics across levels and batches
+type Telemetry struct {
+	Levels     int                `json:"levels"`
+	Candidates int                `json:"candidates"`
+	Fallbacks  int                `json:"fallbacks"`
+	Rejections map[string]int     `json:"rejections"`
+	StageMs    map[string]float64 `json:"stageMs"` // total milliseconds per stage
+	Difficulty DifficultySummary  `json:"difficulty"`
+}
+
+// DifficultySummary is a histogram of selected levels' difficulty scores
+type DifficultySummary struct {
+	Buckets [difficultyBuckets]int `json:"buckets"`
+	Sum     float64                `json:"sum"`
+	SumSq   float64                `json:"sumSq"`
+	Min     float64                `json:"min"`
+	Max     float64                `json:"max"`
+}
+
+// NewTelemetry returns empty telemetry
+func NewTelemetry() *Telemetry {
+	return &Telemetry{
+		Rejections: make(map[string]int),
+		StageMs:    make(map[string]float64),
+	}
+}
+
+func (t *Telemetry) reject(reason string) {
+	t.Rejections[reason]++
+}
+
+func (t *Telemetry) stage(name string, d time.Duration) {
+	t.StageMs[name] += float64(d) / float64(time.Millisecond)
+}
+
+// addLevel records a selected level's difficulty
+func (t *Telemetry) addLevel(difficulty float64, fallback bool) {
+	d := &t.Difficulty
+	if t.Levels == 0 || difficulty < d.Min {
+		d.Min = difficulty
+	}
+	if t.Levels == 0 || difficulty > d.Max {
+		d.Max = difficulty
+	}
+	t.Levels++
+	if fallback {
+		t.Fallbacks++
+	}
+	d.Sum += difficulty
+	d.SumSq += difficulty * difficulty
+	b := int(difficulty * difficultyBuckets)
+	if b < 0 {
+		b = 0
+	}
+	if b >= difficultyBuckets {
+		b = difficultyBuckets - 1
+	}
+	d.Buckets[b]++
+}
+
+// Merge folds another telemetry record into t
+func (t *Telemetry) Merge(o *Telemetry) {
+	if o == nil || o.Levels == 0 && o.Candidates == 0 {
+		return
+	}
+	if t.Levels == 0 || o.Levels > 0 && o.Difficulty.Min < t.Difficulty.Min {
+		t.Difficulty.Min = o.Difficulty.Min
+	}
+	if o.Difficulty.Max > t.Difficulty.Max {
+		t.Difficulty.Max = o.Difficulty.Max
+	}
+	t.Levels += o.Levels
+	t.Candidates += o.Candidates
+	t.Fallbacks += o.Fallbacks
+	for k, v := range o.Rejections {
+		t.Rejections[k] += v
+	}
+	for k, v := range o.StageMs {
+		t.StageMs[k] += v
+	}
+	t.Difficulty.Sum += o.Difficulty.Sum
+	t.Difficulty.SumSq += o.Difficulty.SumSq
+	for i, n := range o.Difficulty.Buckets {
+		t.Difficulty.Buckets[i] += n
+	}
+}
+
+// Mean returns the mean difficulty of recorded levels
+func (d DifficultySummary) Mean(levels int) float64 {
+	if levels == 0 {
+		return 0
+	}
+	return d.Sum / float64(levels)
+}
+
+// StdDev returns the standard deviation of recorded difficulties
+func (d DifficultySummary) StdDev(levels int) float64 {
+	if levels == 0 {
+		return 0
+	}
+	mean := d.Mean(levels)
+	return math.Sqrt(math.Max(0, d.SumSq/float64(levels)-mean*mean))
+}
+
+// Report writes a human-readable summary
+func (t *Telemetry) Report(w io.Writer) {
+	fmt.Fprintf(w, "Levels: %d  candidates: %d  fallbacks: %d\n", t.Levels, t.Candidates, t.Fallbacks)
+	d := t.Difficulty
+	fmt.Fprintf(w, "Difficulty: mean %.3f  stddev %.3f  min %.3f  max %.3f\n",
+		d.Mean(t.Levels), d.StdDev(t.Levels), d.Min, d.Max)
+	peak := 0
+	for _, n := range d.Buckets {
+		if n > peak {
+			peak = n
+		}
+	}
+	for i, n := range d.Buckets {
+		bar := 0
+		if peak > 0 {
+			bar = n * 40 / peak
+		}
+		fmt.Fprintf(w, "  %.1f-%.1f %5d %s\n", float64(i)/difficultyBuckets, float64(i+1)/difficultyBuckets, n, bars(bar))
+	}
+
+	fmt.Fprintln(w, "Rejections:")
+	for _, k := range sortedKeys(t.Rejections) {
+		fmt.Fprintf(w, "  %6d  %s\n", t.Rejections[k], k)
+	}
+	fmt.Fprintln(w, "Stage timings:")
+	stages := make([]string, 0, len(t.StageMs))
+	for k := range t.StageMs {
+		stages = append(stages, k)
+	}
+	sort.Strings(stages)
+	for _, k := range stages {
+		per := 0.0
+		if t.Candidates > 0 {
+			per = t.StageMs[k] / float64(t.Candidates)
+		}
+		fmt.Fprintf(w, "  %-10s total %10.1fms  per candidate %8.3fms\n", k, t.StageMs[k], per)
+	}
+}
+
+func bars(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = '#'
+	}
+	return string(b)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// Telemetry returns the statistics gathered since the generator was created
+func (g *Generator) Telemetry() *Telemetry {
+	return g.telemetry
+}
+
+// timed runs fn and adds its duration to the named stage, tracing it
+// under the level being generated
+func (g *Generator) timed(stage string, fn func()) {
+	if g.span != nil {
+		_, end := g.startSpan("generator." + stage)
+		defer end()
+	}
+	start := time.Now()
+	fn()
+	g.telemetry.stage(stage, time.Since(start))
+}
+
+// startSpan opens a span under the open one, or a new trace without one,
+// making it the parent of spans started until end is called
+func (g *Generator) startSpan(name string, attrs ...tracing.Attr) (span *tracing.Span, end func()) {
+	parent := g.span
+	if parent != nil {
+		span = parent.Child(name, attrs...)
+	} else {
+		_, span = tracing.Start(context.Background(), name, attrs...)
+	}
+	g.span = span
+	return span, func() {
+		span.End()
+		g.span = parent
+	}
+}
+
+// MergeManifests reads the manifests in the given batch directories and
+// returns their combined telemetry
+func MergeManifests(dirs []string) (*Telemetry, error) {
+	total := NewTelemetry()
+	for _, dir := range dirs {
+		m, err := ReadManifest(dir)
+		if err != nil {
+			return nil, err
+		}
+		total.Merge(m.Telemetry)
+	}
+	return total, nil
+}
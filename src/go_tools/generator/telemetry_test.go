@@ -0,0 +1,100 @@
+package generator
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+func TestTelemetryMergeMatchesOneRecord(t *testing.T) {
+	// Sixteenths add up exactly in any order
+	levels := []float64{0.0625, 0.4375, 1, 0.9375, -0.125, 0.5}
+	whole, a, b := NewTelemetry(), NewTelemetry(), NewTelemetry()
+	for i, d := range levels {
+		part := a
+		if i >= 2 {
+			part = b
+		}
+		for _, tm := range []*Telemetry{whole, part} {
+			tm.addLevel(d, i%3 == 0)
+			tm.reject(RejectCoopUnreachable)
+		}
+	}
+	b.reject(RejectTimeBudget)
+	whole.reject(RejectTimeBudget)
+
+	merged := NewTelemetry()
+	merged.Merge(a)
+	merged.Merge(NewTelemetry())
+	merged.Merge(b)
+	if !reflect.DeepEqual(merged, whole) {
+		t.Fatalf("merged %+v, recorded at once %+v", merged, whole)
+	}
+
+	d := whole.Difficulty
+	if d.Min != -0.125 || d.Max != 1 || whole.Fallbacks != 2 {
+		t.Errorf("min %v, max %v, %d fallbacks", d.Min, d.Max, whole.Fallbacks)
+	}
+	want := [difficultyBuckets]int{0: 2, 4: 1, 5: 1, 9: 2} // out-of-range scores land in the end buckets
+	if d.Buckets != want {
+		t.Errorf("buckets %v, want %v", d.Buckets, want)
+	}
+	if mean := d.Mean(whole.Levels); math.Abs(mean-2.8125/6) > 1e-9 {
+		t.Errorf("mean %v", mean)
+	}
+}
+
+func TestBatchTelemetryMergesAcrossManifests(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.GeneratorSeed = 4
+	cfg.CandidatesPerLevel = 3
+	gen, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	dirs := []string{filepath.Join(root, "a"), filepath.Join(root, "b")}
+	for i, dir := range dirs {
+		if _, err := gen.RunBatch(BatchOptions{Prefix: "tel", Count: 2 + i, OutputDir: dir}); err != nil {
+			t.Fatal(err)
+		}
+		m, err := ReadManifest(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Telemetry == nil || m.Telemetry.Levels != 2+i || m.Telemetry.Candidates != (2+i)*cfg.CandidatesPerLevel {
+			t.Fatalf("batch %d telemetry %+v", i, m.Telemetry)
+		}
+	}
+
+	merged, err := MergeManifests(dirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := gen.Telemetry()
+	if merged.Levels != 5 || merged.Levels != total.Levels || merged.Candidates != total.Candidates ||
+		merged.Fallbacks != total.Fallbacks || merged.Difficulty.Buckets != total.Difficulty.Buckets ||
+		!reflect.DeepEqual(merged.Rejections, total.Rejections) {
+		t.Errorf("merged manifests %+v, the generator's total %+v", merged, total)
+	}
+	if _, ok := merged.StageMs[StageTerrain]; !ok {
+		t.Errorf("no terrain stage timing in %v", merged.StageMs)
+	}
+
+	var out bytes.Buffer
+	merged.Report(&out)
+	for _, want := range []string{"Levels: 5  candidates: 15", "Stage timings:", StageTerrain} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	if _, err := MergeManifests([]string{filepath.Join(root, "missing")}); err == nil {
+		t.Error("a directory without a manifest was merged")
+	}
+}
@@ -0,0 +1,179 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// TuningOptions control when SuggestTuning proposes a change
+type TuningOptions struct {
+	MinSessions int     // solo sessions a group of levels needs to be judged
+	Tolerance   float64 // clear rate gap from the target that is left alone
+}
+
+// DefaultTuningOptions tolerates clear rates within 5 points of the target
+func DefaultTuningOptions() TuningOptions {
+	return TuningOptions{MinSessions: 20, Tolerance: 0.05}
+}
+
+// TuningSuggestion is a proposed value for one generator config field
+type TuningSuggestion struct {
+	Field     string  `json:"field"` // the field's JSON name in the config
+	Current   float64 `json:"current"`
+	Suggested float64 `json:"suggested"`
+	Reason    string  `json:"reason"`
+}
+
+// String reads like "reduce specialBlockChance to 0.07; <reason>"
+func (s TuningSuggestion) String() string {
+	verb := "raise"
+	if s.Suggested < s.Current {
+		verb = "reduce"
+	}
+	return fmt.Sprintf("%s %s to %g; %s", verb, s.Field, s.Suggested, s.Reason)
+}
+
+// TuningReport compares how players fared on generated levels with the
+// generator's target and proposes config changes to close the gap
+type TuningReport struct {
+	Levels          int                `json:"levels"`
+	Sessions        int                `json:"sessions"`
+	TargetClearRate float64            `json:"targetClearRate"` // 1 - the target difficulty
+	ClearRate       float64            `json:"clearRate"`
+	Suggestions     []TuningSuggestion `json:"suggestions"`
+}
+
+// Patch returns the suggestions as a partial config, which
+// utils.ApplyConfigPatch applies over the current one
+func (r TuningReport) Patch() ([]byte, error) {
+	patch := make(map[string]float64, len(r.Suggestions))
+	for _, s := range r.Suggestions {
+		patch[s.Field] = s.Suggested
+	}
+	return json.MarshalIndent(patch, "", "  ")
+}
+
+// tuningGroup is the solo sessions played on a set of levels
+type tuningGroup struct {
+	sessions, cleared int
+}
+
+func (g tuningGroup) rate() float64 {
+	if g.sessions == 0 {
+		return 0
+	}
+	return float64(g.cleared) / float64(g.sessions)
+}
+
+// SuggestTuning reads the solo sessions played on the dataset's generated
+// levels and suggests generator settings that would bring their clear rate
+// to the one the target difficulty calls for. The overall gap moves
+// targetDifficulty; levels heavy in special blocks or blocks clearing well
+// below the rest move specialBlockChance and maxBlocks. Each suggestion is
+// sized to close its gap on its own, so applying several overshoots.
+func SuggestTuning(config utils.Config, data *analyzer.Dataset, opts TuningOptions) TuningReport {
+	played := make(map[string]tuningGroup)
+	for _, r := range data.Replays {
+		if len(r.Players) != 1 || r.Result.Outcome == "" {
+			continue
+		}
+		g := played[r.Level]
+		g.sessions++
+		if r.Result.Outcome == replay.OutcomeCleared {
+			g.cleared++
+		}
+		played[r.Level] = g
+	}
+	type levelResult struct {
+		stats LevelStats
+		tuningGroup
+	}
+	var levels []levelResult
+	var all tuningGroup
+	for _, lvl := range data.LevelList() {
+		g, ok := played[lvl.Name]
+		if !ok || lvl.Mode == level.ModeTutorial {
+			continue
+		}
+		levels = append(levels, levelResult{measure(lvl), g})
+		all.sessions += g.sessions
+		all.cleared += g.cleared
+	}
+
+	target := targetFor(config)
+	report := TuningReport{Levels: len(levels), Sessions: all.sessions, TargetClearRate: 1 - target, ClearRate: all.rate()}
+	if all.sessions < opts.MinSessions || report.TargetClearRate <= 0 {
+		return report
+	}
+	belowTarget := func(rate float64) string {
+		gap := (rate - report.TargetClearRate) / report.TargetClearRate
+		if gap < 0 {
+			return fmt.Sprintf("%.0f%% below target", -100*gap)
+		}
+		return fmt.Sprintf("%.0f%% above target", 100*gap)
+	}
+
+	if gap := report.ClearRate - report.TargetClearRate; math.Abs(gap) > opts.Tolerance {
+		report.Suggestions = append(report.Suggestions, TuningSuggestion{
+			Field: "targetDifficulty", Current: target, Suggested: round2(math.Max(0.05, math.Min(0.95, target+gap))),
+			Reason: fmt.Sprintf("the clear rate of %.0f%% is %s", 100*report.ClearRate, belowTarget(report.ClearRate)),
+		})
+	}
+
+	// split returns the sessions on levels where count is above its mean,
+	// and on the rest
+	split := func(count func(LevelStats) int) (heavy, rest tuningGroup) {
+		total := 0
+		for _, l := range levels {
+			total += count(l.stats)
+		}
+		for _, l := range levels {
+			g := &rest
+			if count(l.stats)*len(levels) > total {
+				g = &heavy
+			}
+			g.sessions += l.sessions
+			g.cleared += l.cleared
+		}
+		return heavy, rest
+	}
+	// harder reports whether heavy levels clear well below both the target
+	// and the rest
+	harder := func(heavy, rest tuningGroup) bool {
+		return heavy.sessions >= opts.MinSessions && rest.sessions >= opts.MinSessions && rest.cleared > 0 &&
+			heavy.rate() < report.TargetClearRate-opts.Tolerance && heavy.rate() < rest.rate()-opts.Tolerance
+	}
+
+	if config.SpecialBlockChance > 0 {
+		heavy, rest := split(func(s LevelStats) int { return s.SpecialBlocks })
+		if harder(heavy, rest) {
+			report.Suggestions = append(report.Suggestions, TuningSuggestion{
+				Field: "specialBlockChance", Current: config.SpecialBlockChance,
+				Suggested: round2(config.SpecialBlockChance * heavy.rate() / rest.rate()),
+				Reason:    fmt.Sprintf("clear rate on special-heavy levels is %s", belowTarget(heavy.rate())),
+			})
+		}
+	}
+	if config.MaxBlocks > config.MinBlocks {
+		heavy, rest := split(func(s LevelStats) int { return s.Blocks })
+		if harder(heavy, rest) {
+			spread := float64(config.MaxBlocks-config.MinBlocks) * heavy.rate() / rest.rate()
+			report.Suggestions = append(report.Suggestions, TuningSuggestion{
+				Field: "maxBlocks", Current: float64(config.MaxBlocks),
+				Suggested: float64(config.MinBlocks + int(math.Round(spread))),
+				Reason:    fmt.Sprintf("clear rate on block-heavy levels is %s", belowTarget(heavy.rate())),
+			})
+		}
+	}
+	return report
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
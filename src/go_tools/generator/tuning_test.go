@@ -0,0 +1,64 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+func TestSuggestTuningReducesSpecialBlocks(t *testing.T) {
+	data := analyzer.NewDataset()
+	for i := 0; i < 10; i++ {
+		lvl := level.New(fmt.Sprint("gen_", i), 10, 20)
+		for x := 0; x < 4; x++ {
+			lvl.Blocks = append(lvl.Blocks, level.Block{Type: "O", X: x, Y: 19})
+		}
+		cleared := 6
+		if i%2 == 0 {
+			lvl.Blocks[0].Special = level.SpecialBomb
+			cleared = 2
+		}
+		data.Levels[lvl.Name] = lvl
+		for s := 0; s < 10; s++ {
+			r := &replay.Replay{SessionID: fmt.Sprint(lvl.Name, s), Level: lvl.Name, Players: []replay.Player{{ID: "p"}}}
+			r.Result.Outcome = replay.OutcomeTopOut
+			if s < cleared {
+				r.Result.Outcome = replay.OutcomeCleared
+			}
+			data.Replays = append(data.Replays, r)
+		}
+	}
+	cfg := utils.DefaultConfig()
+	cfg.TargetDifficulty, cfg.SpecialBlockChance = 0.4, 0.1
+
+	report := SuggestTuning(cfg, data, DefaultTuningOptions())
+	if report.Sessions != 100 || report.ClearRate != 0.4 {
+		t.Fatalf("report = %+v", report)
+	}
+	byField := make(map[string]TuningSuggestion)
+	for _, s := range report.Suggestions {
+		byField[s.Field] = s
+	}
+	if s := byField["specialBlockChance"]; s.Suggested != 0.03 || !strings.Contains(s.String(), "reduce specialBlockChance to 0.03; clear rate on special-heavy levels is 67% below target") {
+		t.Errorf("special blocks: %v", s)
+	}
+	if s := byField["targetDifficulty"]; s.Suggested != 0.2 {
+		t.Errorf("target: %v", s)
+	}
+	if _, ok := byField["maxBlocks"]; ok {
+		t.Error("suggested maxBlocks though every level has as many blocks")
+	}
+
+	patch, err := report.Patch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(patch), `"specialBlockChance": 0.03`) {
+		t.Errorf("patch %s", patch)
+	}
+}
@@ -0,0 +1,114 @@
+package generator
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Tutorial mechanics, in the order the tutorial teaches them
+const (
+	MechanicSingleClear  = "single_clear"
+	MechanicFirstSpell   = "first_spell"
+	MechanicSpecialBlock = "special_block"
+)
+
+// TutorialSteps lists the mechanics of the scripted tutorial sequence
+var TutorialSteps = []string{MechanicSingleClear, MechanicFirstSpell, MechanicSpecialBlock}
+
+// GenerateTutorial returns one level per tutorial step. Each level isolates
+// its mechanic with a fixed layout and piece queue, so the sequence is the
+// same on every run; only the board size comes from the config.
+func (g *Generator) GenerateTutorial(prefix string) ([]*level.Level, error) {
+	width, height := g.config.LevelWidth, g.config.LevelHeight
+	if width < 4 || height < 8 {
+		return nil, fmt.Errorf("tutorial levels need at least a 4x8 board, got %dx%d", width, height)
+	}
+
+	levels := make([]*level.Level, 0, len(TutorialSteps))
+	for i, mechanic := range TutorialSteps {
+		name := fmt.Sprintf("%s_tutorial_%d", prefix, i+1)
+		lvl := level.New(name, width, height)
+		lvl.Mode = level.ModeTutorial
+		lvl.Difficulty = DifficultyNames[1]
+		lvl.SpawnPoints = []level.Point{{X: width / 2, Y: 0}}
+		lvl.Metadata = map[string]string{
+			"tutorial_step": strconv.Itoa(i + 1),
+			"mechanic":      mechanic,
+		}
+
+		switch mechanic {
+		case MechanicSingleClear:
+			tutorialSingleClear(lvl)
+		case MechanicFirstSpell:
+			tutorialFirstSpell(lvl)
+		case MechanicSpecialBlock:
+			tutorialSpecialBlock(lvl)
+		}
+
+		if err := lvl.Validate(); err != nil {
+			return nil, err
+		}
+		levels = append(levels, lvl)
+	}
+	return levels, nil
+}
+
+// fillRow fills a row from the floor (0 is the bottom row) except the gap column
+func fillRow(lvl *level.Level, row, gap int) {
+	y := lvl.GridSize.Height - 1 - row
+	for x := 0; x < lvl.GridSize.Width; x++ {
+		if x != gap {
+			lvl.Blocks = append(lvl.Blocks, level.Block{Type: "O", X: x, Y: y})
+		}
+	}
+}
+
+// tutorialSingleClear: one almost-full row and an I piece to drop into the gap
+func tutorialSingleClear(lvl *level.Level) {
+	gap := lvl.GridSize.Width - 1
+	fillRow(lvl, 0, gap)
+	lvl.Pieces = &level.PieceSequence{Randomizer: "bag7", Fixed: []string{"I"}}
+	lvl.Objectives = []level.Objective{{Kind: "clear_lines", Target: 1}}
+	lvl.Hints = []level.Hint{
+		{Trigger: "start", Text: "Fill a whole row to clear it."},
+		{Trigger: "first_piece", Text: "Drop the piece into the gap.", Cell: &level.Point{X: gap, Y: lvl.GridSize.Height - 1}},
+		{Trigger: "clear", Text: "Well done! Cleared rows score points."},
+	}
+}
+
+// tutorialFirstSpell: a messy stack and a clear-line pickup just above it
+func tutorialFirstSpell(lvl *level.Level) {
+	fillRow(lvl, 0, 1)
+	fillRow(lvl, 1, 4)
+	fillRow(lvl, 2, 2)
+	pickup := level.Point{X: lvl.GridSize.Width / 2, Y: lvl.GridSize.Height - 5}
+	lvl.Pickups = []level.Pickup{{Spell: level.SpellClearLine, X: pickup.X, Y: pickup.Y}}
+	lvl.Pieces = &level.PieceSequence{Randomizer: "bag7", Fixed: []string{"O", "T"}}
+	lvl.Objectives = []level.Objective{{Kind: "cast_spell", Target: 1}}
+	lvl.Hints = []level.Hint{
+		{Trigger: "start", Text: "Touch the glowing pickup with a piece to collect a spell."},
+		{Trigger: "first_piece", Text: "Steer towards the pickup.", Cell: &pickup},
+		{Trigger: "pickup", Text: "Cast the spell to clear the messy bottom row."},
+	}
+}
+
+// tutorialSpecialBlock: a row completed by detonating a bomb block
+func tutorialSpecialBlock(lvl *level.Level) {
+	gap := 0
+	fillRow(lvl, 0, gap)
+	bomb := level.Point{X: lvl.GridSize.Width / 2, Y: lvl.GridSize.Height - 1}
+	for i := range lvl.Blocks {
+		if lvl.Blocks[i].X == bomb.X && lvl.Blocks[i].Y == bomb.Y {
+			lvl.Blocks[i].Special = level.SpecialBomb
+		}
+	}
+	lvl.Pieces = &level.PieceSequence{Randomizer: "bag7", Fixed: []string{"I"}}
+	lvl.Objectives = []level.Objective{{Kind: "trigger_special", Target: 1}}
+	lvl.Hints = []level.Hint{
+		{Trigger: "start", Text: "Some blocks are special. This one is a bomb.", Cell: &bomb},
+		{Trigger: "first_piece", Text: "Clear its row to set it off.", Cell: &level.Point{X: gap, Y: lvl.GridSize.Height - 1}},
+		{Trigger: "special", Text: "Bombs clear the blocks around them."},
+	}
+}
@@ -0,0 +1,156 @@
+package generator
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+func tutorial(t *testing.T, cfg utils.Config) []*level.Level {
+	t.Helper()
+	gen, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels, err := gen.GenerateTutorial("intro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return levels
+}
+
+func TestTutorialTeachesEachStepInOrder(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	levels := tutorial(t, cfg)
+	if len(levels) != len(TutorialSteps) {
+		t.Fatalf("%d levels for %d steps", len(levels), len(TutorialSteps))
+	}
+	for i, lvl := range levels {
+		if want := "intro_tutorial_" + strconv.Itoa(i+1); lvl.Name != want {
+			t.Errorf("level %d is named %q, want %q", i, lvl.Name, want)
+		}
+		if lvl.Mode != level.ModeTutorial || lvl.Metadata["mechanic"] != TutorialSteps[i] || lvl.Metadata["tutorial_step"] != strconv.Itoa(i+1) {
+			t.Errorf("level %d: mode %q, metadata %v", i, lvl.Mode, lvl.Metadata)
+		}
+		if len(lvl.Objectives) != 1 || lvl.Pieces == nil || len(lvl.Pieces.Fixed) == 0 {
+			t.Errorf("level %d: objectives %v, pieces %+v", i, lvl.Objectives, lvl.Pieces)
+		}
+		if len(lvl.Hints) == 0 || lvl.Hints[0].Trigger != "start" {
+			t.Errorf("level %d doesn't open with a hint: %+v", i, lvl.Hints)
+		}
+		for _, h := range lvl.Hints {
+			if h.Cell != nil && !lvl.InBounds(h.Cell.X, h.Cell.Y) {
+				t.Errorf("level %d: hint %q points off the board at %v", i, h.Trigger, *h.Cell)
+			}
+		}
+		if err := lvl.Validate(); err != nil {
+			t.Errorf("level %d: %v", i, err)
+		}
+	}
+}
+
+func TestTutorialHintsPointAtTheMechanic(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	levels := tutorial(t, cfg)
+	byMechanic := map[string]*level.Level{}
+	for _, lvl := range levels {
+		byMechanic[lvl.Metadata["mechanic"]] = lvl
+	}
+	hint := func(lvl *level.Level, trigger string) level.Point {
+		for _, h := range lvl.Hints {
+			if h.Trigger == trigger && h.Cell != nil {
+				return *h.Cell
+			}
+		}
+		t.Fatalf("%s has no %q hint with a cell", lvl.Name, trigger)
+		return level.Point{}
+	}
+
+	// The single clear's hint marks the one gap in the bottom row
+	clear := byMechanic[MechanicSingleClear]
+	bottom := clear.Occupancy()[cfg.LevelHeight-1]
+	gap := hint(clear, "first_piece")
+	for x, filled := range bottom {
+		if filled == (x == gap.X) {
+			t.Errorf("bottom row cell %d filled %v, with the hinted gap at %d", x, filled, gap.X)
+		}
+	}
+	if gap.Y != cfg.LevelHeight-1 {
+		t.Errorf("the gap hint is on row %d, not the bottom", gap.Y)
+	}
+
+	// The first spell's hint marks its pickup, on an empty cell
+	spell := byMechanic[MechanicFirstSpell]
+	p := hint(spell, "first_piece")
+	if len(spell.Pickups) != 1 || spell.Pickups[0].X != p.X || spell.Pickups[0].Y != p.Y {
+		t.Errorf("pickups %+v, hinted %v", spell.Pickups, p)
+	}
+	if spell.Occupancy()[p.Y][p.X] {
+		t.Errorf("the pickup at %v sits on a block", p)
+	}
+
+	// The special block's opening hint marks its bomb
+	special := byMechanic[MechanicSpecialBlock]
+	bomb := hint(special, "start")
+	found := false
+	for _, b := range special.Blocks {
+		if b.Special != "" {
+			if b.Special != level.SpecialBomb || b.X != bomb.X || b.Y != bomb.Y {
+				t.Errorf("special block %+v, hinted %v", b, bomb)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Error("the special block level has no special block")
+	}
+}
+
+func TestTutorialIsTheSameOnEveryRun(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.GeneratorSeed = 1
+	first := tutorial(t, cfg)
+	cfg.GeneratorSeed = 2
+	cfg.SpecialBlockChance = 0.9
+	if second := tutorial(t, cfg); !reflect.DeepEqual(first, second) {
+		t.Error("the tutorial changed with the seed")
+	}
+
+	cfg.LevelWidth = 3
+	gen, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gen.GenerateTutorial("intro"); err == nil {
+		t.Error("a 3-wide board was accepted")
+	}
+}
+
+func TestTutorialBatchIgnoresCount(t *testing.T) {
+	cfg := utils.DefaultConfig()
+	cfg.GeneratorMode = level.ModeTutorial
+	gen, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	entries, err := gen.RunBatch(BatchOptions{Prefix: "intro", Count: 10, OutputDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(TutorialSteps) {
+		t.Fatalf("%d levels written, want %d", len(entries), len(TutorialSteps))
+	}
+	m, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range m.Levels {
+		if e.Mode != level.ModeTutorial || e.File != LevelFileName("intro_tutorial_"+strconv.Itoa(i+1)) {
+			t.Errorf("manifest entry %d: %+v", i, e)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// generateVersus builds a two-player board by generating one half and
+// copying it to the other side, either mirrored or repeated as-is
+func (g *Generator) generateVersus(name, mode string) (*level.Level, error) {
+	half, err := g.generateStandard(name)
+	if err != nil {
+		return nil, err
+	}
+
+	width := half.GridSize.Width
+	lvl := level.New(name, 2*width, half.GridSize.Height)
+	lvl.Mode = mode
+	lvl.Difficulty = half.Difficulty
+	lvl.SpecialRules = half.SpecialRules
+
+	for _, b := range half.Blocks {
+		lvl.Blocks = append(lvl.Blocks, b)
+		b.X = counterpartX(mode, b.X, width)
+		lvl.Blocks = append(lvl.Blocks, b)
+	}
+	for _, p := range half.Pickups {
+		lvl.Pickups = append(lvl.Pickups, p)
+		p.X = counterpartX(mode, p.X, width)
+		lvl.Pickups = append(lvl.Pickups, p)
+	}
+	for _, sp := range half.SpawnPoints {
+		lvl.SpawnPoints = append(lvl.SpawnPoints, sp)
+		sp.X = counterpartX(mode, sp.X, width)
+		lvl.SpawnPoints = append(lvl.SpawnPoints, sp)
+	}
+
+	if err := CheckVersusHalves(lvl); err != nil {
+		return nil, err
+	}
+	return lvl, nil
+}
+
+// counterpartX maps a column onto the matching column of the other half
+func counterpartX(mode string, x, halfWidth int) int {
+	switch {
+	case mode == level.ModeMirror:
+		return 2*halfWidth - 1 - x
+	case x < halfWidth:
+		return x + halfWidth
+	default:
+		return x - halfWidth
+	}
+}
+
+// CheckVersusHalves verifies block for block that each half of a mirror or
+// identical versus level matches the other, including block type, special
+// kind and pickups
+func CheckVersusHalves(lvl *level.Level) error {
+	if lvl.Mode != level.ModeMirror && lvl.Mode != level.ModeIdentical {
+		return i18n.Errorf("generator.not_versus", lvl.Name, lvl.Mode)
+	}
+	if lvl.GridSize.Width%2 != 0 {
+		return i18n.Errorf("generator.versus_odd_width", lvl.Name, lvl.GridSize.Width)
+	}
+	half := lvl.GridSize.Width / 2
+
+	blocks := make(map[level.Point]level.Block, len(lvl.Blocks))
+	for _, b := range lvl.Blocks {
+		blocks[level.Point{X: b.X, Y: b.Y}] = b
+	}
+	for p, b := range blocks {
+		q := level.Point{X: counterpartX(lvl.Mode, p.X, half), Y: p.Y}
+		other, ok := blocks[q]
+		if !ok {
+			return i18n.Errorf("generator.no_counterpart", lvl.Name, p.X, p.Y, q.X, q.Y)
+		}
+		if other.Type != b.Type || other.Special != b.Special {
+			return i18n.Errorf("generator.counterpart_differs",
+				lvl.Name, p.X, p.Y, b.Type, b.Special, other.Type, other.Special)
+		}
+	}
+
+	pickups := make(map[level.Point]string, len(lvl.Pickups))
+	for _, pk := range lvl.Pickups {
+		pickups[level.Point{X: pk.X, Y: pk.Y}] = pk.Spell
+	}
+	for p, spell := range pickups {
+		q := level.Point{X: counterpartX(lvl.Mode, p.X, half), Y: p.Y}
+		if pickups[q] != spell {
+			return i18n.Errorf("generator.no_matching_pickup", lvl.Name, spell, p.X, p.Y, q.X, q.Y)
+		}
+	}
+	return nil
+}
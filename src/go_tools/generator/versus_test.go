@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+func versusConfig(mode string, seed int64) utils.Config {
+	cfg := utils.DefaultConfig()
+	cfg.GeneratorMode = mode
+	cfg.GeneratorSeed = seed
+	cfg.SpecialBlockChance = 0.3
+	return cfg
+}
+
+func generate(t *testing.T, cfg utils.Config) (*level.Level, error) {
+	t.Helper()
+	gen, err := NewGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gen.Generate("versus")
+}
+
+func TestVersusHalvesMatchBlockForBlock(t *testing.T) {
+	for _, mode := range []string{level.ModeMirror, level.ModeIdentical} {
+		for seed := int64(1); seed <= 20; seed++ {
+			lvl, err := generate(t, versusConfig(mode, seed))
+			if err != nil {
+				t.Fatalf("%s seed %d: %v", mode, seed, err)
+			}
+			half := lvl.GridSize.Width / 2
+			if half != utils.DefaultConfig().LevelWidth {
+				t.Fatalf("%s seed %d: half width %d", mode, seed, half)
+			}
+
+			cells := make(map[level.Point]level.Block)
+			for _, b := range lvl.Blocks {
+				cells[level.Point{X: b.X, Y: b.Y}] = b
+			}
+			for _, b := range lvl.Blocks {
+				if b.X >= half {
+					continue
+				}
+				want := b.X + half
+				if mode == level.ModeMirror {
+					want = 2*half - 1 - b.X
+				}
+				other, ok := cells[level.Point{X: want, Y: b.Y}]
+				if !ok || other.Type != b.Type || other.Special != b.Special {
+					t.Fatalf("%s seed %d: block %+v has counterpart %+v (found %v)", mode, seed, b, other, ok)
+				}
+			}
+			if len(lvl.Blocks)%2 != 0 {
+				t.Fatalf("%s seed %d: odd block count %d", mode, seed, len(lvl.Blocks))
+			}
+			if err := CheckVersusHalves(lvl); err != nil {
+				t.Fatalf("%s seed %d: %v", mode, seed, err)
+			}
+		}
+	}
+}
+
+func TestCheckVersusHalvesRejectsTampering(t *testing.T) {
+	lvl, err := generate(t, versusConfig(level.ModeMirror, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lvl.Blocks) == 0 {
+		t.Fatal("expected terrain blocks")
+	}
+
+	changed := *lvl
+	changed.Blocks = append([]level.Block(nil), lvl.Blocks...)
+	if changed.Blocks[0].Type == "I" {
+		changed.Blocks[0].Type = "O"
+	} else {
+		changed.Blocks[0].Type = "I"
+	}
+	if err := CheckVersusHalves(&changed); err == nil {
+		t.Error("expected changed block type to be rejected")
+	}
+
+	removed := *lvl
+	removed.Blocks = append([]level.Block(nil), lvl.Blocks[1:]...)
+	if err := CheckVersusHalves(&removed); err == nil {
+		t.Error("expected missing counterpart to be rejected")
+	}
+}
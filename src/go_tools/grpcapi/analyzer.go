@@ -0,0 +1,86 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/toolspb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+type analyzerService struct {
+	toolspb.UnimplementedAnalyzerServer
+	config utils.Config
+}
+
+// Analyze computes the tables the api server serves, on a dataset of just
+// the request's levels and replays
+func (s *analyzerService) Analyze(ctx context.Context, req *toolspb.AnalyzeRequest) (*toolspb.AnalyzeResponse, error) {
+	d := analyzer.NewDataset()
+	for i, data := range req.Levels {
+		lvl, err := parseLevel(data)
+		if err != nil {
+			return nil, fmt.Errorf("level %d: %w", i, err)
+		}
+		if _, dup := d.Levels[lvl.Name]; dup {
+			return nil, invalid("level %d: duplicate level name %q", i, lvl.Name)
+		}
+		d.Levels[lvl.Name] = lvl
+	}
+	for i, data := range req.Replays {
+		if _, err := d.AddReplay(data); err != nil {
+			return nil, invalid("replay %d: %v", i, err)
+		}
+	}
+	tables, err := analyzer.DatasetTables(ctx, d, d.AnalyzeLevels(), gridSize(req.Fallback, s.config))
+	if err != nil {
+		return nil, internal(err)
+	}
+	byName := make(map[string]*analyzer.Table, len(tables))
+	for _, t := range tables {
+		byName[t.Name] = t
+	}
+	if len(req.Tables) > 0 {
+		tables = tables[:0]
+		for _, name := range req.Tables {
+			t, ok := byName[name]
+			if !ok {
+				return nil, invalid("no table %q", name)
+			}
+			tables = append(tables, t)
+		}
+	}
+	resp := &toolspb.AnalyzeResponse{}
+	for _, t := range tables {
+		resp.Tables = append(resp.Tables, table(t))
+	}
+	return resp, nil
+}
+
+// table converts an analysis table, each value by its column's kind
+func table(t *analyzer.Table) *toolspb.Table {
+	out := &toolspb.Table{Name: t.Name}
+	for _, c := range t.Columns {
+		out.Columns = append(out.Columns, &toolspb.Column{Name: c.Name, Kind: c.Kind})
+	}
+	for _, row := range t.Rows {
+		r := &toolspb.Row{Values: make([]*toolspb.Value, len(row))}
+		for i, v := range row {
+			switch v := v.(type) {
+			case string:
+				r.Values[i] = &toolspb.Value{Kind: &toolspb.Value_StringValue{StringValue: v}}
+			case int:
+				r.Values[i] = &toolspb.Value{Kind: &toolspb.Value_IntValue{IntValue: int64(v)}}
+			case float64:
+				r.Values[i] = &toolspb.Value{Kind: &toolspb.Value_FloatValue{FloatValue: v}}
+			case bool:
+				r.Values[i] = &toolspb.Value{Kind: &toolspb.Value_BoolValue{BoolValue: v}}
+			default:
+				r.Values[i] = &toolspb.Value{}
+			}
+		}
+		out.Rows = append(out.Rows, r)
+	}
+	return out
+}
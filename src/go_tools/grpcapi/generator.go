@@ -0,0 +1,89 @@
+package grpcapi
+
+import (
+	"encoding/json"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/toolspb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// maxBatch bounds the levels one Generate call builds
+const maxBatch = 10000
+
+type generatorService struct {
+	toolspb.UnimplementedGeneratorServer
+	config utils.Config
+}
+
+// Generate runs a batch as generate -dry-run would, sending each level as
+// it's built rather than writing it
+func (s *generatorService) Generate(req *toolspb.GenerateRequest, stream toolspb.Generator_GenerateServer) error {
+	config := s.config
+	if len(req.ConfigPatch) > 0 {
+		var err error
+		if config, err = utils.PatchConfig(config, req.ConfigPatch); err != nil {
+			return invalid("%v", err)
+		}
+	}
+	if req.Seed != 0 {
+		config.GeneratorSeed = req.Seed
+	}
+	count, prefix := int(req.Count), req.Prefix
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 || count > maxBatch {
+		return invalid("count %d isn't between 1 and %d", count, maxBatch)
+	}
+	if prefix == "" {
+		prefix = "level"
+	}
+	gen, err := generator.NewGenerator(config)
+	if err != nil {
+		return invalid("%v", err)
+	}
+	ctx := stream.Context()
+	_, err = gen.RunBatch(generator.BatchOptions{
+		Context:  ctx,
+		Prefix:   prefix,
+		Count:    count,
+		DryRun:   true,
+		Metadata: req.Metadata,
+		Emit: func(lvl *level.Level, entry generator.BatchEntry) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			data, err := json.Marshal(lvl)
+			if err != nil {
+				return err
+			}
+			return stream.Send(&toolspb.GeneratedLevel{
+				Level:          data,
+				Stats:          levelStats(entry.LevelStats),
+				DurationMs:     entry.DurationMs,
+				Fallback:       entry.Fallback,
+				FallbackReason: entry.FallbackReason,
+			})
+		},
+	})
+	if err != nil {
+		return internal(err)
+	}
+	return nil
+}
+
+func levelStats(s generator.LevelStats) *toolspb.LevelStats {
+	return &toolspb.LevelStats{
+		Name:          s.Name,
+		Mode:          s.Mode,
+		Blocks:        int32(s.Blocks),
+		SpecialBlocks: int32(s.SpecialBlocks),
+		Pickups:       int32(s.Pickups),
+		Density:       s.Density,
+		MaxHeight:     int32(s.MaxHeight),
+		Holes:         int32(s.Holes),
+		Difficulty:    s.Difficulty,
+	}
+}
@@ -0,0 +1,238 @@
+// Package grpcapi serves the generator, analyzer and headless simulator as
+// the gRPC services of toolspb, so the engine and build pipelines call the
+// tools instead of running them and parsing what they print
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/ratelimit"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/toolspb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// MaxMessageBytes bounds a request or reply, enough for a batch of levels
+// and replays
+const MaxMessageBytes = 64 << 20
+
+// NewServer returns a gRPC server of the tools working on config's
+// settings. Each call is traced, continuing the caller's trace when its
+// metadata carries a traceparent, is refused ResourceExhausted past the
+// config's rate limits, and with a keyring needs a bearer token covering
+// the tools surface; the server also answers health checks, without a
+// token or a limit, and reflection, for grpcurl and load balancers. opts
+// add to the server's options, such as its TLS credentials. A call that
+// panics leaves a crash bundle, as a panic in the tool's main would.
+func NewServer(config utils.Config, keys *auth.Keyring, opts ...grpc.ServerOption) *grpc.Server {
+	limits := ratelimit.FromConfig(config, keys)
+	s := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.MaxRecvMsgSize(MaxMessageBytes),
+		grpc.MaxSendMsgSize(MaxMessageBytes),
+		grpc.ChainUnaryInterceptor(crashUnary, traceUnary, limitUnary(limits), authUnary(keys)),
+		grpc.ChainStreamInterceptor(crashStream, traceStream, limitStream(limits), authStream(keys)),
+	}, opts...)...)
+	Register(s, config)
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	reflection.Register(s)
+	return s
+}
+
+// Register adds the Generator, Analyzer and Simulator services to s
+func Register(s grpc.ServiceRegistrar, config utils.Config) {
+	toolspb.RegisterGeneratorServer(s, &generatorService{config: config})
+	toolspb.RegisterAnalyzerServer(s, &analyzerService{config: config})
+	toolspb.RegisterSimulatorServer(s, &simulatorService{config: config})
+}
+
+// startSpan begins a call's server span
+func startSpan(ctx context.Context, method string) (context.Context, *tracing.Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = tracing.Extract(ctx, http.Header{http.CanonicalHeaderKey(tracing.TraceparentHeader): md.Get(tracing.TraceparentHeader)})
+	}
+	return tracing.StartKind(ctx, method, tracing.KindServer, tracing.String("rpc.system", "grpc"), tracing.String("rpc.method", method))
+}
+
+func endSpan(span *tracing.Span, err error) {
+	span.SetAttrs(tracing.String("rpc.grpc.status_code", status.Code(err).String()))
+	span.SetError(err)
+	span.End()
+}
+
+// crashUnary and crashStream report a call's panic, which runs on a
+// goroutine the server starts, where main's crash.Recover doesn't see it
+func crashUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	defer crash.Recover()
+	return handler(ctx, req)
+}
+
+func crashStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	defer crash.Recover()
+	return handler(srv, ss)
+}
+
+func traceUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, span := startSpan(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	endSpan(span, err)
+	return resp, err
+}
+
+func traceStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := startSpan(ss.Context(), info.FullMethod)
+	err := handler(srv, tracedStream{ss, ctx})
+	endSpan(span, err)
+	return err
+}
+
+// tracedStream is a stream whose context carries its call's span
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s tracedStream) Context() context.Context { return s.ctx }
+
+// isHealth reports whether method is a health check's
+func isHealth(method string) bool {
+	return strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
+
+// bearer is the bearer token in a call's metadata
+func bearer(ctx context.Context) string {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			token, _ = strings.CutPrefix(v[0], "Bearer ")
+		}
+	}
+	return token
+}
+
+// limit takes a call from its caller's rate limit buckets
+func limit(ctx context.Context, limits *ratelimit.Limiter, method string) error {
+	if limits == nil || isHealth(method) {
+		return nil
+	}
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = ratelimit.HostOf(p.Addr.String())
+	}
+	if d := limits.Allow(addr, bearer(ctx)); !d.Allowed {
+		return status.Error(codes.ResourceExhausted, d.Message())
+	}
+	return nil
+}
+
+func limitUnary(limits *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := limit(ctx, limits, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func limitStream(limits *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := limit(ss.Context(), limits, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// authorize checks the bearer token in a call's metadata
+func authorize(ctx context.Context, keys *auth.Keyring, method string) error {
+	if keys == nil || isHealth(method) {
+		return nil
+	}
+	// the services change nothing, so reading the surface is enough
+	if _, err := keys.Authorize(bearer(ctx), auth.SurfaceTools, false); err != nil {
+		if errors.Is(err, auth.ErrForbidden) {
+			return status.Error(codes.PermissionDenied, err.Error())
+		}
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return nil
+}
+
+func authUnary(keys *auth.Keyring) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authorize(ctx, keys, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func authStream(keys *auth.Keyring) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(ss.Context(), keys, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// invalid is an InvalidArgument error
+func invalid(format string, args ...any) error {
+	return status.Errorf(codes.InvalidArgument, format, args...)
+}
+
+// internal is err as a status, keeping a cancelled call's code
+func internal(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// parseLevel reads and validates a level file
+func parseLevel(data []byte) (*level.Level, error) {
+	lvl, err := level.Parse(data)
+	if err != nil {
+		return nil, invalid("parse level: %v", err)
+	}
+	if err := lvl.Validate(); err != nil {
+		return nil, invalid("level %s: %v", lvl.Name, err)
+	}
+	return lvl, nil
+}
+
+// gridSize is g, or the config's level size when unset
+func gridSize(g *toolspb.GridSize, config utils.Config) level.GridSize {
+	if g.GetWidth() > 0 && g.GetHeight() > 0 {
+		return level.GridSize{Width: int(g.GetWidth()), Height: int(g.GetHeight())}
+	}
+	return level.GridSize{Width: config.LevelWidth, Height: config.LevelHeight}
+}
+
+// parseReplay reads and validates a replay file
+func parseReplay(data []byte) (*replay.Replay, error) {
+	rp, err := replay.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+	return rp, nil
+}
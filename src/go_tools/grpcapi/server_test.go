@@ -0,0 +1,204 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/desync"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/toolspb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+const pitReplay = `{"sessionId":"s1","level":"pit","players":[{"id":"p"}],
+	"events":[{"frame":1,"player":"p","type":"lock","piece":"O","x":0,"y":18},
+		{"frame":5,"player":"p","type":"lock","piece":"O","x":2,"y":18}],
+	"result":{"durationMs":30000,"outcome":"cleared"}}`
+
+// dial serves the tools in memory, checking tokens with keys, and
+// connects to them
+func dial(t *testing.T, keys *auth.Keyring) *grpc.ClientConn {
+	t.Helper()
+	config := utils.DefaultConfig()
+	config.GeneratorSeed = 7
+	ln := bufconn.Listen(1 << 20)
+	srv := NewServer(config, keys)
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///tools",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGenerateThenSimulateAndAnalyze(t *testing.T) {
+	conn := dial(t, nil)
+	ctx := context.Background()
+
+	stream, err := toolspb.NewGeneratorClient(conn).Generate(ctx, &toolspb.GenerateRequest{
+		Prefix: "rpc", Count: 2, Metadata: map[string]string{"build": "42"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var levels [][]byte
+	for {
+		g, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lvl level.Level
+		if err := json.Unmarshal(g.Level, &lvl); err != nil || lvl.Name != g.Stats.Name || lvl.Metadata["build"] != "42" {
+			t.Fatalf("generated %s: %+v %v", g.Stats.GetName(), lvl.Metadata, err)
+		}
+		levels = append(levels, g.Level)
+	}
+	if len(levels) != 2 {
+		t.Fatalf("generated %d levels, want 2", len(levels))
+	}
+
+	sim := toolspb.NewSimulatorClient(conn)
+	solved, err := sim.Solve(ctx, &toolspb.SolveRequest{Level: levels[0], MaxNodes: 2000})
+	if err != nil || solved.Level != "rpc_level_1" || solved.Status == "" {
+		t.Errorf("solve = %v, %v", solved, err)
+	}
+	if clears, err := sim.SimulateClears(ctx, &toolspb.SimulateClearsRequest{Level: levels[0]}); err != nil || clears.Pieces == 0 {
+		t.Errorf("clears = %v, %v", clears, err)
+	}
+	if _, err := sim.Solve(ctx, &toolspb.SolveRequest{Level: []byte(`{"name":`)}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("broken level: %v", err)
+	}
+
+	boards, err := sim.SimulateReplay(ctx, &toolspb.SimulateReplayRequest{Replay: []byte(pitReplay),
+		Fallback: &toolspb.GridSize{Width: 10, Height: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []int32
+	for {
+		b, err := boards.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, b.Event)
+		if b.Board.MaxHeight != 0.1 {
+			t.Errorf("event %d board = %v", b.Event, b.Board)
+		}
+	}
+	if len(events) != 2 || events[1] != 1 {
+		t.Errorf("locked events = %v", events)
+	}
+
+	analysis, err := toolspb.NewAnalyzerClient(conn).Analyze(ctx, &toolspb.AnalyzeRequest{
+		Levels: levels, Replays: [][]byte{[]byte(pitReplay)}, Tables: []string{"difficulty", "sessions_by_level"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis.Tables) != 2 || len(analysis.Tables[0].Rows) != 2 {
+		t.Fatalf("tables = %v", analysis.Tables)
+	}
+	if name := analysis.Tables[0].Rows[0].Values[0].GetStringValue(); name != "rpc_level_1" {
+		t.Errorf("first difficulty row is %q", name)
+	}
+	if _, err := toolspb.NewAnalyzerClient(conn).Analyze(ctx, &toolspb.AnalyzeRequest{Tables: []string{"nope"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unknown table: %v", err)
+	}
+}
+
+func TestCallsNeedAToolsToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	tools, toolsToken, _ := auth.NewToken("pipeline", []string{"tools"}, 0)
+	packs, packsToken, _ := auth.NewToken("packs", []string{"packs"}, 0)
+	(auth.File{Tokens: []auth.Token{tools, packs}}).Save(path)
+	keys, err := auth.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := toolspb.NewSimulatorClient(dial(t, keys))
+	req := &toolspb.SimulateClearsRequest{Level: []byte(`{"name":"x"`)}
+	with := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+	if _, err := sim.SimulateClears(context.Background(), req); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("no token: %v", err)
+	}
+	if _, err := sim.SimulateClears(with(packsToken), req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("another surface's token: %v", err)
+	}
+	// past the check, to the broken level
+	if _, err := sim.SimulateClears(with(toolsToken), req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("tools token: %v", err)
+	}
+	health := healthpb.NewHealthClient(dial(t, keys))
+	if _, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("health check without a token: %v", err)
+	}
+}
+
+func TestStepReplayPlaysAsThisBuild(t *testing.T) {
+	lvl := level.New("open", 8, 12)
+	lvl.SpawnPoints = []level.Point{{X: 4, Y: 0}}
+	g, err := sim.New(lvl, sim.Options{Seed: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for col := 0; !g.Over() && g.Frame() < 200; col++ {
+		g.Tick()
+		if st, _ := g.State("p1"); st.Piece != nil && g.Frame()%10 == 0 {
+			g.Place("p1", col%6, col%4)
+		}
+	}
+	r := g.Replay("s")
+	rawLevel, _ := json.Marshal(lvl)
+	rawReplay, _ := json.Marshal(r)
+
+	remote, err := desync.Remote(context.Background(), dial(t, nil), rawLevel, rawReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := desync.Local(lvl, r, sim.Options{Randomizer: utils.DefaultConfig().PieceRandomizer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep, err := desync.Compare(local, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Diverged || rep.Ended != "" || rep.Frames != g.Frame() {
+		t.Errorf("played %+v, want %d frames alike", rep, g.Frame())
+	}
+
+	other := level.New("other", 8, 12)
+	rawOther, _ := json.Marshal(other)
+	stream, err := toolspb.NewSimulatorClient(dial(t, nil)).StepReplay(context.Background(),
+		&toolspb.StepReplayRequest{Replay: rawReplay, Level: rawOther})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("another level: %v", err)
+	}
+}
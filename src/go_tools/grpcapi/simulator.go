@@ -0,0 +1,153 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/toolspb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+type simulatorService struct {
+	toolspb.UnimplementedSimulatorServer
+	config utils.Config
+}
+
+// Solve runs the solver analyze -solve runs
+func (s *simulatorService) Solve(ctx context.Context, req *toolspb.SolveRequest) (*toolspb.Solvability, error) {
+	lvl, err := parseLevel(req.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := analyzer.DefaultSolveOptions()
+	if req.MaxPieces > 0 {
+		opts.MaxPieces = int(req.MaxPieces)
+	}
+	if req.MaxNodes > 0 {
+		opts.MaxNodes = int(req.MaxNodes)
+	}
+	res := analyzer.Solve(lvl, opts)
+	out := &toolspb.Solvability{Level: res.Level, Status: res.Status, Reason: res.Reason, Nodes: int32(res.Nodes)}
+	for _, p := range res.Witness {
+		out.Witness = append(out.Witness, &toolspb.Placement{
+			Piece: p.Piece, X: int32(p.X), Y: int32(p.Y), Rotation: int32(p.Rotation), Lines: int32(p.Lines)})
+	}
+	return out, nil
+}
+
+// SimulateClears runs the greedy bot of the difficulty model
+func (s *simulatorService) SimulateClears(ctx context.Context, req *toolspb.SimulateClearsRequest) (*toolspb.ClearSimulation, error) {
+	lvl, err := parseLevel(req.Level)
+	if err != nil {
+		return nil, err
+	}
+	sim := analyzer.SimulateClears(lvl)
+	return &toolspb.ClearSimulation{
+		Pieces:    int32(sim.Pieces),
+		Lines:     int32(sim.Lines),
+		ToppedOut: sim.ToppedOut,
+		Rate:      sim.Rate(lvl.GridSize.Width),
+	}, nil
+}
+
+// SimulateReplay steps the replay, sending the board of each lock that
+// fits it; locks that don't fit the reconstructed board are skipped
+func (s *simulatorService) SimulateReplay(req *toolspb.SimulateReplayRequest, stream toolspb.Simulator_SimulateReplayServer) error {
+	rp, err := parseReplay(req.Replay)
+	if err != nil {
+		return err
+	}
+	d := analyzer.NewDataset()
+	if len(req.Level) > 0 {
+		lvl, err := parseLevel(req.Level)
+		if err != nil {
+			return err
+		}
+		if lvl.Name != rp.Level {
+			return invalid("level %q isn't the replay's level %q", lvl.Name, rp.Level)
+		}
+		d.Levels[lvl.Name] = lvl
+	}
+	sim := analyzer.NewReplaySimulator(d, gridSize(req.Fallback, s.config))
+	if err := sim.Load(rp); err != nil {
+		return invalid("%v", err)
+	}
+	for i, ev := range rp.Events {
+		if ev.Type != replay.EventLock {
+			continue
+		}
+		locks := sim.Locks
+		if err := sim.Step(ev); err != nil {
+			return internal(err)
+		}
+		if sim.Locks == locks {
+			continue
+		}
+		b := sim.Board()
+		err := stream.Send(&toolspb.LockedBoard{
+			Event:  int32(i),
+			Frame:  int64(ev.Frame),
+			Player: ev.Player,
+			Board: &toolspb.BoardComplexity{
+				MaxHeight:         b.MaxHeight,
+				Roughness:         b.Roughness,
+				Holes:             int32(b.Holes),
+				DependencyDepth:   int32(b.DependencyDepth),
+				RowTransitions:    int32(b.RowTransitions),
+				ColumnTransitions: int32(b.ColumnTransitions),
+				Entropy:           b.Entropy,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StepReplay plays the replay again on its level by the config's rules,
+// sending each frame's checksum, and its state when asked
+func (s *simulatorService) StepReplay(req *toolspb.StepReplayRequest, stream toolspb.Simulator_StepReplayServer) error {
+	rp, err := parseReplay(req.Replay)
+	if err != nil {
+		return err
+	}
+	lvl, err := parseLevel(req.Level)
+	if err != nil {
+		return err
+	}
+	if lvl.Name != rp.Level {
+		return invalid("level %q isn't the replay's level %q", lvl.Name, rp.Level)
+	}
+	opts, err := sim.OptionsFromConfig(s.config)
+	if err != nil {
+		return internal(err)
+	}
+	r, err := sim.NewReplayer(lvl, rp, opts)
+	if err != nil {
+		return invalid("%v", err)
+	}
+	ctx := stream.Context()
+	for !r.Done() {
+		if err := ctx.Err(); err != nil {
+			return internal(err)
+		}
+		if _, err := r.Step(); err != nil {
+			return invalid("%v", err)
+		}
+		g := r.Game()
+		frame := &toolspb.FrameState{Frame: int64(g.Frame()), Checksum: g.Checksum()}
+		if req.WithState {
+			if frame.State, err = json.Marshal(g.FrameSnapshot()); err != nil {
+				return internal(err)
+			}
+		}
+		if err := stream.Send(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Package i18n translates the tools' user-facing messages: what the
+// validators and the generator's checks report, what stt edit prints, and
+// the balance report. A message is a key in a catalog per locale, its
+// text a fmt format, with %[n]v indexes where a translation orders its
+// arguments differently. Keys a locale's catalog lacks read in English.
+// The locale is the config's, set once as a tool starts.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultLocale is the locale messages read in when nothing sets one, and
+// the one every key is in
+const DefaultLocale = "en"
+
+//go:embed catalogs/*.json
+var catalogFiles embed.FS
+
+// catalogs are the messages of each locale, by key
+var catalogs = loadCatalogs()
+
+var locale atomic.Value // string
+
+func init() {
+	locale.Store(DefaultLocale)
+}
+
+func loadCatalogs() map[string]map[string]string {
+	entries, err := catalogFiles.ReadDir("catalogs")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]map[string]string)
+	for _, e := range entries {
+		data, err := catalogFiles.ReadFile(path.Join("catalogs", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: catalog %s: %v", e.Name(), err))
+		}
+		out[strings.TrimSuffix(e.Name(), ".json")] = messages
+	}
+	if out[DefaultLocale] == nil {
+		panic("i18n: no " + DefaultLocale + " catalog")
+	}
+	return out
+}
+
+// Locales are the locales there are catalogs of, in order
+func Locales() []string {
+	out := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		out = append(out, l)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Locale is the locale messages read in
+func Locale() string {
+	return locale.Load().(string)
+}
+
+// SetLocale has messages read in name's language: a locale such as ru,
+// or as $LANG spells it, ru_RU.UTF-8; empty is DefaultLocale
+func SetLocale(name string) error {
+	l, err := Parse(name)
+	if err != nil {
+		return err
+	}
+	locale.Store(l)
+	return nil
+}
+
+// Parse is the locale of catalogs name is in
+func Parse(name string) (string, error) {
+	if name == "" {
+		return DefaultLocale, nil
+	}
+	lang := strings.ToLower(name)
+	if i := strings.IndexAny(lang, "_-.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := catalogs[lang]; !ok {
+		return "", fmt.Errorf("unknown locale %q, want one of %s", name, strings.Join(Locales(), ", "))
+	}
+	return lang, nil
+}
+
+// T is the message of key in the locale, formatted with args; a key in
+// no catalog reads as itself
+func T(key string, args ...any) string {
+	return In(Locale(), key, args...)
+}
+
+// In is the message of key in locale l, formatted with args
+func In(l, key string, args ...any) string {
+	format, ok := catalogs[l][key]
+	if !ok {
+		if format, ok = catalogs[DefaultLocale][key]; !ok {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	// errors wrapped in a message are unwrapped by Error, formatted here
+	return fmt.Sprintf(strings.ReplaceAll(format, "%w", "%v"), args...)
+}
+
+// Message is a message to translate when it is read rather than when it
+// is made, as a word inside another message
+type Message struct {
+	Key  string
+	Args []any
+}
+
+// M is the message of key with args
+func M(key string, args ...any) Message {
+	return Message{Key: key, Args: args}
+}
+
+func (m Message) String() string {
+	return T(m.Key, m.Args...)
+}
+
+// Error is an error whose text is a message
+type Error struct {
+	Message
+}
+
+// Errorf is the error of key's message with args; an error among them
+// with %w is what it wraps
+func Errorf(key string, args ...any) error {
+	return &Error{Message{Key: key, Args: args}}
+}
+
+func (e *Error) Error() string {
+	return e.String()
+}
+
+// Unwrap is the error wrapped with %w, if the message wraps one
+func (e *Error) Unwrap() error {
+	format := catalogs[DefaultLocale][e.Key]
+	if !strings.Contains(format, "%w") {
+		return nil
+	}
+	for _, a := range e.Args {
+		if err, ok := a.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package i18n
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+var verb = regexp.MustCompile(`%(\[\d+\])?[-+# 0-9.]*[a-zA-Z%]`)
+
+// verbs are the verbs of a format, ignoring argument indexes, in order
+func verbs(format string) []string {
+	var out []string
+	for _, v := range verb.FindAllString(format, -1) {
+		out = append(out, regexp.MustCompile(`\[\d+\]`).ReplaceAllString(v, ""))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestCatalogsMatchEnglish(t *testing.T) {
+	en := catalogs[DefaultLocale]
+	for _, l := range Locales() {
+		for key, format := range catalogs[l] {
+			want, ok := en[key]
+			if !ok {
+				t.Errorf("%s: key %q is not in %s", l, key, DefaultLocale)
+				continue
+			}
+			if got, want := verbs(format), verbs(want); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %q has verbs %v, %s has %v", l, key, got, DefaultLocale, want)
+			}
+		}
+		for key := range en {
+			if _, ok := catalogs[l][key]; !ok {
+				t.Errorf("%s: no message for %q", l, key)
+			}
+		}
+	}
+}
+
+func TestLocale(t *testing.T) {
+	defer SetLocale(DefaultLocale)
+	for name, want := range map[string]string{"": "en", "ru": "ru", "ru_RU.UTF-8": "ru", "EN-us": "en"} {
+		if got, err := Parse(name); err != nil || got != want {
+			t.Errorf("Parse(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if err := SetLocale("fr_FR"); err == nil {
+		t.Error("no error for a locale without a catalog")
+	}
+	if Locale() != DefaultLocale {
+		t.Errorf("locale %q after a failed SetLocale", Locale())
+	}
+	if err := SetLocale("ru"); err != nil || Locale() != "ru" {
+		t.Fatalf("locale %q after SetLocale(ru): %v", Locale(), err)
+	}
+	if got := T("no.such.key"); got != "no.such.key" {
+		t.Errorf("a missing key reads %q", got)
+	}
+}
+
+func TestErrorf(t *testing.T) {
+	defer SetLocale(DefaultLocale)
+	err := Errorf("rules.line", 3, Errorf("rules.missing_subject"))
+	if got := err.Error(); got != "line 3: missing subject" {
+		t.Errorf("en: %q", got)
+	}
+	SetLocale("ru")
+	if got := err.Error(); got != "строка 3: не указан объект" {
+		t.Errorf("ru: %q", got)
+	}
+	wrapped := Errorf("level.parse", "a.json", fs.ErrNotExist)
+	if !errors.Is(wrapped, fs.ErrNotExist) {
+		t.Error("Errorf with %w doesn't wrap its error")
+	}
+	if errors.Unwrap(Errorf("edit.session_error", "s1", errors.New("x"))) != nil {
+		t.Error("Errorf without %w wraps an error")
+	}
+	// a message inside another reads in the locale when formatted
+	if got := In(DefaultLocale, "level.block_overlaps", "a", 1, 2, M("level.a_pickup")); got != `level "a": block at (1,2) overlaps бонус` {
+		t.Errorf("a message inside a message: %q", got)
+	}
+}
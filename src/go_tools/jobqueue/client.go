@@ -0,0 +1,165 @@
+package jobqueue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+)
+
+// Client talks to a queue's server
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// NewClient talks to the server at rawURL, such as http://host:8103. The
+// token of auth.TokenEnv, if set, is presented to the server.
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("job queue URL %s isn't http or https", rawURL)
+	}
+	u.RawQuery, u.Fragment = "", ""
+	// no timeout of its own: a lease waits as long as it asks to
+	return &Client{base: strings.TrimSuffix(u.String(), "/"), token: os.Getenv(auth.TokenEnv), http: certs.HTTPClient(0)}, nil
+}
+
+// Submit queues a job of the kind with payload, marshalled as JSON, given
+// maxAttempts, or the queue's when 0
+func (c *Client) Submit(ctx context.Context, kind string, payload any, maxAttempts int) (Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Job{}, err
+	}
+	var j Job
+	err = c.do(ctx, http.MethodPost, "/jobs", Submission{Kind: kind, Payload: data, MaxAttempts: maxAttempts}, &j)
+	return j, err
+}
+
+// Job is the job with the id
+func (c *Client) Job(ctx context.Context, id int64) (Job, error) {
+	var j Job
+	err := c.do(ctx, http.MethodGet, "/jobs/"+strconv.FormatInt(id, 10), nil, &j)
+	return j, err
+}
+
+// Jobs lists the jobs the filter picks, newest first
+func (c *Client) Jobs(ctx context.Context, f Filter) ([]Job, error) {
+	q := url.Values{}
+	if f.Status != "" {
+		q.Set("status", f.Status)
+	}
+	if f.Kind != "" {
+		q.Set("kind", f.Kind)
+	}
+	if f.Limit > 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+	var jobs []Job
+	err := c.do(ctx, http.MethodGet, "/jobs?"+q.Encode(), nil, &jobs)
+	return jobs, err
+}
+
+// Workers lists the registered workers
+func (c *Client) Workers(ctx context.Context) ([]Worker, error) {
+	var workers []Worker
+	err := c.do(ctx, http.MethodGet, "/workers", nil, &workers)
+	return workers, err
+}
+
+// Status is the queue's jobs by status and its workers
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var st Status
+	err := c.do(ctx, http.MethodGet, "/status", nil, &st)
+	return st, err
+}
+
+// Wait polls the job every interval until it is done or failed
+func (c *Client) Wait(ctx context.Context, id int64, interval time.Duration) (Job, error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		j, err := c.Job(ctx, id)
+		if err != nil || j.Status == StatusDone || j.Status == StatusFailed {
+			return j, err
+		}
+		select {
+		case <-ctx.Done():
+			return j, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// do sends body, if not nil, as JSON and decodes the reply into out; a
+// reply of 204 leaves out as it was
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	auth.SetHeader(req.Header, c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return nil
+	case resp.StatusCode >= 300:
+		return replyError(resp)
+	case out == nil:
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// StatusError is an error reply of the server
+type StatusError struct {
+	Code    int
+	Status  string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return "job queue: " + e.Status
+	}
+	return "job queue: " + e.Status + ": " + e.Message
+}
+
+// replyError is the server's error reply as an error
+func replyError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return &StatusError{Code: resp.StatusCode, Status: resp.Status, Message: body.Error}
+}
@@ -0,0 +1,41 @@
+package jobqueue
+
+import (
+	"net/http"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+)
+
+// DescribeAPI adds the queue's endpoints to a server's OpenAPI document
+func (s *Server) DescribeAPI(spec *openapi.Spec) {
+	job := map[string]string{"id": "the job's number"}
+	worker := map[string]string{"id": "the ID the worker was registered under"}
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/status", Summary: "jobs by status, workers and the lease",
+		Reply: Status{}})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/jobs", Summary: "submit a job",
+		Body: Submission{}, Status: http.StatusCreated, Reply: Job{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/jobs", Summary: "jobs, newest first",
+		Query: []openapi.Param{
+			{Name: "status", Doc: "queued, running, done or failed"},
+			{Name: "kind"},
+			{Name: "limit", Type: "integer"},
+		},
+		Reply: []Job{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/jobs/{id}", Summary: "a job, its status and result or error",
+		Params: job, Reply: Job{}})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/jobs/{id}/done", Summary: "a worker's result of a job; 409 if its lease ran out",
+		Params: job, Body: Outcome{}, Reply: Job{}})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/jobs/{id}/fail",
+		Summary: "a worker's failed attempt at a job, queued again while it has attempts left; 409 if its lease ran out",
+		Params:  job, Body: Outcome{}, Reply: Job{}})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/workers", Summary: "register a worker",
+		Body: Registration{}, Status: http.StatusCreated, Reply: Worker{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/workers", Summary: "the registered workers and what each runs",
+		Reply: []Worker{}})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/workers/{id}/heartbeat", Summary: "renew the worker's leases",
+		Params: worker, Status: http.StatusNoContent})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/workers/{id}/lease",
+		Summary: "lease the worker the next job of a kind it takes; 204 if none came within wait",
+		Params:  worker, Query: []openapi.Param{{Name: "wait", Doc: "how long to wait for a job, like 30s, at most 1m"}},
+		Reply: Job{}})
+}
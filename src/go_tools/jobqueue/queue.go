@@ -0,0 +1,529 @@
+// Package jobqueue spreads batch work, level generation, analysis and
+// simulation, across machines: jobs wait in a SQLite database on one,
+// which serves them over HTTP to the workers that register from any
+// number of others. A worker leases a job of a kind it takes and renews
+// the lease while it runs; a job whose worker fails, or stops renewing
+// because it died, goes back in the queue until its attempts run out.
+package jobqueue
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go driver, registers "sqlite"
+)
+
+// SchemaVersion is stored in PRAGMA user_version; add a step to
+// migrations whenever the schema changes
+const SchemaVersion = 1
+
+// migrations[i] brings a database from schema version i to i+1. Times are
+// Unix milliseconds, so leases compare in SQL.
+var migrations = [][]string{{
+	`CREATE TABLE jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL,
+		worker TEXT NOT NULL DEFAULT '',
+		result TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		created INTEGER NOT NULL,
+		started INTEGER NOT NULL DEFAULT 0,
+		finished INTEGER NOT NULL DEFAULT 0,
+		lease_until INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX jobs_queued ON jobs (status, kind, id)`,
+	`CREATE TABLE workers (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		host TEXT NOT NULL,
+		kinds TEXT NOT NULL,
+		registered INTEGER NOT NULL,
+		seen INTEGER NOT NULL
+	)`,
+}}
+
+// Statuses of a job
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed" // out of attempts
+)
+
+// Defaults for Options left zero
+const (
+	DefaultLease       = time.Minute
+	DefaultMaxAttempts = 3
+)
+
+// Errors of the queue
+var (
+	ErrNotFound = errors.New("not found")
+	ErrLost     = errors.New("job isn't leased to the worker") // its lease ran out and it went back in the queue
+)
+
+// Options tune a queue
+type Options struct {
+	Lease       time.Duration // a job is leased to its worker for between renewals
+	MaxAttempts int           // a job gets unless submitted with its own
+}
+
+// Job is a piece of work and what became of it
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	Worker      string          `json:"worker,omitempty"` // running it, or that last did
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"` // of the last attempt that failed
+	Created     time.Time       `json:"created"`
+	Started     *time.Time      `json:"started,omitempty"` // the last attempt
+	Finished    *time.Time      `json:"finished,omitempty"`
+	LeaseUntil  *time.Time      `json:"leaseUntil,omitempty"` // while running
+}
+
+// Worker is a registered worker
+type Worker struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Host       string    `json:"host"`
+	Kinds      []string  `json:"kinds"`
+	Registered time.Time `json:"registered"`
+	Seen       time.Time `json:"seen"`
+	Running    []int64   `json:"running"` // jobs leased to it
+}
+
+// Filter picks jobs to list
+type Filter struct {
+	Status string
+	Kind   string
+	Limit  int // 0 for DefaultLimit
+}
+
+// DefaultLimit is how many jobs a listing has unless asked for more
+const DefaultLimit = 100
+
+// Queue holds jobs in a database
+type Queue struct {
+	db   *sql.DB
+	opts Options
+
+	mu   sync.Mutex    // leases one job at a time
+	wake chan struct{} // closed when a job is queued, then replaced
+}
+
+// Open opens the queue in the database at path, creating it if need be
+func Open(path string, opts Options) (*Queue, error) {
+	if opts.Lease <= 0 {
+		opts.Lease = DefaultLease
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// one connection, so an in-memory database is one database and
+	// writers never meet SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	q := &Queue{db: db, opts: opts, wake: make(chan struct{})}
+	if err := q.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return q, nil
+}
+
+// migrate brings the database up to SchemaVersion
+func (q *Queue) migrate() error {
+	var version int
+	if err := q.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	switch {
+	case version == SchemaVersion:
+		return nil
+	case version > SchemaVersion:
+		return fmt.Errorf("schema version %d is newer than supported %d", version, SchemaVersion)
+	}
+	tx, err := q.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, step := range migrations[version:] {
+		for _, stmt := range step {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes the database
+func (q *Queue) Close() error {
+	return q.db.Close()
+}
+
+// Lease is how long a job is leased to its worker between renewals
+func (q *Queue) Lease() time.Duration {
+	return q.opts.Lease
+}
+
+// Submit queues a job of the kind with its payload, as JSON, given
+// maxAttempts, or the queue's when 0
+func (q *Queue) Submit(kind string, payload json.RawMessage, maxAttempts int) (Job, error) {
+	if kind == "" {
+		return Job{}, errors.New("a job needs a kind")
+	}
+	if len(payload) == 0 {
+		payload = json.RawMessage("null")
+	}
+	if !json.Valid(payload) {
+		return Job{}, errors.New("a job's payload must be JSON")
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = q.opts.MaxAttempts
+	}
+	res, err := q.db.Exec("INSERT INTO jobs (kind, payload, status, max_attempts, created) VALUES (?, ?, ?, ?, ?)",
+		kind, string(payload), StatusQueued, maxAttempts, millis(time.Now()))
+	if err != nil {
+		return Job{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Job{}, err
+	}
+	q.queued()
+	return q.Job(id)
+}
+
+// queued wakes the workers waiting for a job
+func (q *Queue) queued() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// Wake is closed when a job is next queued
+func (q *Queue) Wake() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.wake
+}
+
+const jobColumns = "id, kind, payload, status, attempts, max_attempts, worker, result, error, created, started, finished, lease_until"
+
+type scanner interface{ Scan(dest ...any) error }
+
+func scanJob(row scanner) (Job, error) {
+	var j Job
+	var payload, result string
+	var created, started, finished, lease int64
+	err := row.Scan(&j.ID, &j.Kind, &payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.Worker, &result, &j.Error,
+		&created, &started, &finished, &lease)
+	if err != nil {
+		return j, err
+	}
+	j.Payload = json.RawMessage(payload)
+	if result != "" {
+		j.Result = json.RawMessage(result)
+	}
+	j.Created = fromMillis(created)
+	j.Started, j.Finished = optTime(started), optTime(finished)
+	if j.Status == StatusRunning {
+		j.LeaseUntil = optTime(lease)
+	}
+	return j, nil
+}
+
+// Job is the job with the id
+func (q *Queue) Job(id int64) (Job, error) {
+	j, err := scanJob(q.db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return j, fmt.Errorf("job %d: %w", id, ErrNotFound)
+	}
+	return j, err
+}
+
+// Jobs lists the jobs the filter picks, newest first
+func (q *Queue) Jobs(f Filter) ([]Job, error) {
+	var where []string
+	var args []any
+	if f.Status != "" {
+		where, args = append(where, "status = ?"), append(args, f.Status)
+	}
+	if f.Kind != "" {
+		where, args = append(where, "kind = ?"), append(args, f.Kind)
+	}
+	query := "SELECT " + jobColumns + " FROM jobs"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if f.Limit <= 0 {
+		f.Limit = DefaultLimit
+	}
+	rows, err := q.db.Query(query+" ORDER BY id DESC LIMIT ?", append(args, f.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Counts is how many jobs have each status
+func (q *Queue) Counts() (map[string]int, error) {
+	rows, err := q.db.Query("SELECT status, COUNT(*) FROM jobs GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]int{StatusQueued: 0, StatusRunning: 0, StatusDone: 0, StatusFailed: 0}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// Register adds a worker on host taking jobs of the kinds, under an ID of
+// its name
+func (q *Queue) Register(name, host string, kinds []string) (Worker, error) {
+	if name == "" || len(kinds) == 0 {
+		return Worker{}, errors.New("a worker needs a name and the kinds of job it takes")
+	}
+	var suffix [4]byte
+	rand.Read(suffix[:])
+	now := fromMillis(millis(time.Now()))
+	w := Worker{ID: name + "-" + hex.EncodeToString(suffix[:]), Name: name, Host: host, Kinds: kinds,
+		Registered: now, Seen: now, Running: []int64{}}
+	_, err := q.db.Exec("INSERT INTO workers (id, name, host, kinds, registered, seen) VALUES (?, ?, ?, ?, ?, ?)",
+		w.ID, name, host, strings.Join(kinds, ","), millis(now), millis(now))
+	return w, err
+}
+
+// Workers lists the registered workers, and what each is running
+func (q *Queue) Workers() ([]Worker, error) {
+	rows, err := q.db.Query("SELECT id, name, host, kinds, registered, seen FROM workers ORDER BY registered")
+	if err != nil {
+		return nil, err
+	}
+	workers := []Worker{}
+	for rows.Next() {
+		var w Worker
+		var kinds string
+		var registered, seen int64
+		if err := rows.Scan(&w.ID, &w.Name, &w.Host, &kinds, &registered, &seen); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		w.Kinds, w.Registered, w.Seen, w.Running = strings.Split(kinds, ","), fromMillis(registered), fromMillis(seen), []int64{}
+		workers = append(workers, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range workers {
+		running, err := q.db.Query("SELECT id FROM jobs WHERE status = ? AND worker = ? ORDER BY id", StatusRunning, workers[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		for running.Next() {
+			var id int64
+			running.Scan(&id)
+			workers[i].Running = append(workers[i].Running, id)
+		}
+		running.Close()
+	}
+	return workers, nil
+}
+
+// worker is a registered worker's kinds
+func (q *Queue) worker(id string) ([]string, error) {
+	var kinds string
+	err := q.db.QueryRow("SELECT kinds FROM workers WHERE id = ?", id).Scan(&kinds)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("worker %s: %w; register again", id, ErrNotFound)
+	}
+	return strings.Split(kinds, ","), err
+}
+
+// Heartbeat renews the leases of the worker's jobs
+func (q *Queue) Heartbeat(worker string) error {
+	if _, err := q.worker(worker); err != nil {
+		return err
+	}
+	now := time.Now()
+	if _, err := q.db.Exec("UPDATE workers SET seen = ? WHERE id = ?", millis(now), worker); err != nil {
+		return err
+	}
+	_, err := q.db.Exec("UPDATE jobs SET lease_until = ? WHERE status = ? AND worker = ?",
+		millis(now.Add(q.opts.Lease)), StatusRunning, worker)
+	return err
+}
+
+// Next leases the worker the oldest queued job of a kind it takes; ok is
+// false when there is none
+func (q *Queue) Next(worker string) (j Job, ok bool, err error) {
+	kinds, err := q.worker(worker)
+	if err != nil {
+		return j, false, err
+	}
+	now := time.Now()
+	q.db.Exec("UPDATE workers SET seen = ? WHERE id = ?", millis(now), worker)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	args := []any{StatusQueued}
+	for _, k := range kinds {
+		args = append(args, k)
+	}
+	var id int64
+	err = q.db.QueryRow("SELECT id FROM jobs WHERE status = ? AND kind IN (?"+strings.Repeat(", ?", len(kinds)-1)+") ORDER BY id LIMIT 1",
+		args...).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return j, false, nil
+	}
+	if err != nil {
+		return j, false, err
+	}
+	_, err = q.db.Exec("UPDATE jobs SET status = ?, worker = ?, attempts = attempts + 1, started = ?, lease_until = ? WHERE id = ?",
+		StatusRunning, worker, millis(now), millis(now.Add(q.opts.Lease)), id)
+	if err != nil {
+		return j, false, err
+	}
+	j, err = q.Job(id)
+	return j, err == nil, err
+}
+
+// Complete records the worker's result of the job
+func (q *Queue) Complete(id int64, worker string, result json.RawMessage) error {
+	if len(result) == 0 {
+		result = json.RawMessage("null")
+	}
+	if !json.Valid(result) {
+		return errors.New("a job's result must be JSON")
+	}
+	return q.finish(id, worker, "status = ?, result = ?, error = '', finished = ?", StatusDone, string(result), millis(time.Now()))
+}
+
+// Fail records that the worker's attempt at the job failed: it is queued
+// again while it has attempts left
+func (q *Queue) Fail(id int64, worker, msg string) error {
+	if msg == "" {
+		msg = "failed"
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	res, err := q.db.Exec(`UPDATE jobs SET
+			status = CASE WHEN attempts < max_attempts THEN ? ELSE ? END,
+			finished = CASE WHEN attempts < max_attempts THEN 0 ELSE ? END,
+			error = ?, lease_until = 0
+		WHERE id = ? AND status = ? AND worker = ?`,
+		StatusQueued, StatusFailed, millis(time.Now()), msg, id, StatusRunning, worker)
+	if err := q.leased(id, res, err); err != nil {
+		return err
+	}
+	q.wakeIfQueued(id)
+	return nil
+}
+
+func (q *Queue) finish(id int64, worker, set string, args ...any) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	res, err := q.db.Exec("UPDATE jobs SET "+set+", lease_until = 0 WHERE id = ? AND status = ? AND worker = ?",
+		append(args, id, StatusRunning, worker)...)
+	return q.leased(id, res, err)
+}
+
+// leased turns an update of a job leased to a worker that changed nothing
+// into why
+func (q *Queue) leased(id int64, res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := q.Job(id); err != nil {
+			return err
+		}
+		return fmt.Errorf("job %d: %w", id, ErrLost)
+	}
+	return nil
+}
+
+// wakeIfQueued wakes waiting workers if the job went back in the queue.
+// q.mu is held.
+func (q *Queue) wakeIfQueued(id int64) {
+	var status string
+	if q.db.QueryRow("SELECT status FROM jobs WHERE id = ?", id).Scan(&status) == nil && status == StatusQueued {
+		close(q.wake)
+		q.wake = make(chan struct{})
+	}
+}
+
+// Expire takes back the jobs whose leases ran out by now, their workers
+// having died or lost touch: each is queued again while it has attempts
+// left, and failed when not. It answers how many were taken back.
+func (q *Queue) Expire(now time.Time) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	res, err := q.db.Exec(`UPDATE jobs SET
+			status = CASE WHEN attempts < max_attempts THEN ? ELSE ? END,
+			finished = CASE WHEN attempts < max_attempts THEN 0 ELSE ? END,
+			error = 'worker ' || worker || ' stopped renewing its lease', lease_until = 0
+		WHERE status = ? AND lease_until < ?`,
+		StatusQueued, StatusFailed, millis(now), StatusRunning, millis(now))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		close(q.wake)
+		q.wake = make(chan struct{})
+	}
+	return int(n), nil
+}
+
+func millis(t time.Time) int64 { return t.UnixMilli() }
+
+func fromMillis(ms int64) time.Time { return time.UnixMilli(ms).UTC() }
+
+func optTime(ms int64) *time.Time {
+	if ms == 0 {
+		return nil
+	}
+	t := fromMillis(ms)
+	return &t
+}
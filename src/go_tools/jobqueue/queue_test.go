@@ -0,0 +1,167 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueueRetriesFailedAndAbandonedJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	q, err := Open(path, Options{Lease: time.Minute, MaxAttempts: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Submit("", nil, 0); err == nil {
+		t.Error("a job without a kind was queued")
+	}
+	gen, _ := q.Submit("generate", json.RawMessage(`{"count":5}`), 0)
+	sim, _ := q.Submit("simulate", json.RawMessage(`{}`), 1)
+
+	w, err := q.Register("box", "box.lan", []string{"generate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, ok, err := q.Next(w.ID)
+	if err != nil || !ok || j.ID != gen.ID || j.Status != StatusRunning || j.Attempts != 1 || j.LeaseUntil == nil {
+		t.Fatalf("leased %+v, %v, %v", j, ok, err)
+	}
+	if _, ok, _ := q.Next(w.ID); ok {
+		t.Error("the simulate job was leased to a worker that only generates")
+	}
+	if err := q.Fail(j.ID, w.ID, "out of memory"); err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := q.Job(gen.ID); j.Status != StatusQueued || j.Error != "out of memory" {
+		t.Errorf("after a failed attempt the job is %+v", j)
+	}
+
+	// the second attempt's worker dies: its lease runs out and it's out of
+	// attempts
+	j, ok, _ = q.Next(w.ID)
+	if !ok || j.Attempts != 2 {
+		t.Fatalf("second lease %+v", j)
+	}
+	if n, err := q.Expire(time.Now()); err != nil || n != 0 {
+		t.Errorf("expired %d leases still running, %v", n, err)
+	}
+	if n, err := q.Expire(time.Now().Add(2 * time.Minute)); err != nil || n != 1 {
+		t.Errorf("expired %d leases run out, %v", n, err)
+	}
+	if j, _ := q.Job(gen.ID); j.Status != StatusFailed || j.Finished == nil || j.Error != "worker "+w.ID+" stopped renewing its lease" {
+		t.Errorf("after its last lease ran out the job is %+v", j)
+	}
+	if err := q.Complete(gen.ID, w.ID, json.RawMessage(`"late"`)); !errors.Is(err, ErrLost) {
+		t.Errorf("a result after the lease ran out: %v", err)
+	}
+	if err := q.Heartbeat("gone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("heartbeat of an unknown worker: %v", err)
+	}
+	q.Close()
+
+	// the queue survives a restart
+	q, err = Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	counts, _ := q.Counts()
+	if counts[StatusQueued] != 1 || counts[StatusFailed] != 1 {
+		t.Errorf("counts after reopening %v", counts)
+	}
+	if jobs, _ := q.Jobs(Filter{Kind: "simulate"}); len(jobs) != 1 || jobs[0].ID != sim.ID || jobs[0].MaxAttempts != 1 {
+		t.Errorf("simulate jobs %+v", jobs)
+	}
+}
+
+func TestWorkersRunJobsOverHTTP(t *testing.T) {
+	q, err := Open(":memory:", Options{Lease: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	srv := NewServer(q)
+	defer srv.Close()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	double, _ := c.Submit(ctx, "double", 21, 0)
+	flaky, _ := c.Submit(ctx, "flaky", nil, 0)
+	slow, _ := c.Submit(ctx, "slow", nil, 0)
+
+	var tries int
+	workCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Work(workCtx, WorkerOptions{Name: "test", Poll: 100 * time.Millisecond, Handlers: map[string]Handler{
+			"double": func(_ context.Context, payload json.RawMessage) (any, error) {
+				var n int
+				err := json.Unmarshal(payload, &n)
+				return n * 2, err
+			},
+			"flaky": func(context.Context, json.RawMessage) (any, error) {
+				if tries++; tries == 1 {
+					return nil, errors.New("flaked")
+				}
+				panic("flaked again")
+			},
+			// outlives several leases, which the worker renews
+			"slow": func(ctx context.Context, _ json.RawMessage) (any, error) {
+				select {
+				case <-time.After(time.Second):
+					return "slept", nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		}})
+	}()
+
+	j, err := c.Wait(ctx, double.ID, 20*time.Millisecond)
+	if err != nil || j.Status != StatusDone || string(j.Result) != "42" {
+		t.Errorf("double job %+v, %v", j, err)
+	}
+	j, err = c.Wait(ctx, slow.ID, 20*time.Millisecond)
+	if err != nil || j.Status != StatusDone || j.Attempts != 1 || string(j.Result) != `"slept"` {
+		t.Errorf("slow job %+v, %v", j, err)
+	}
+	j, err = c.Wait(ctx, flaky.ID, 20*time.Millisecond)
+	if err != nil || j.Status != StatusFailed || j.Attempts != 3 || j.Error != "panic: flaked again" {
+		t.Errorf("flaky job %+v, %v", j, err)
+	}
+	ws, err := c.Workers(ctx)
+	if err != nil || len(ws) != 1 || ws[0].Name != "test" || len(ws[0].Kinds) != 3 {
+		t.Errorf("workers %+v, %v", ws, err)
+	}
+
+	// a worker that dies with a job leased loses it to the next worker
+	stop()
+	<-done
+	dead, _ := q.Register("dead", "", []string{"triple"})
+	abandoned, _ := c.Submit(ctx, "triple", 5, 0)
+	if j, ok, _ := q.Next(dead.ID); !ok || j.ID != abandoned.ID {
+		t.Fatalf("dead worker leased %+v", j)
+	}
+	go c.Work(ctx, WorkerOptions{Name: "next", Poll: 100 * time.Millisecond, Handlers: map[string]Handler{
+		"triple": func(_ context.Context, payload json.RawMessage) (any, error) {
+			var n int
+			err := json.Unmarshal(payload, &n)
+			return n * 3, err
+		},
+	}})
+	j, err = c.Wait(ctx, abandoned.ID, 50*time.Millisecond)
+	if err != nil || j.Status != StatusDone || j.Attempts != 2 || string(j.Result) != "15" || j.Worker == dead.ID {
+		t.Errorf("abandoned job %+v, %v", j, err)
+	}
+}
@@ -0,0 +1,333 @@
+package jobqueue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+)
+
+// maxBodyBytes bounds a job's payload or result
+const maxBodyBytes = 32 << 20
+
+// maxWait bounds how long a lease request waits for a job
+const maxWait = time.Minute
+
+// expireInterval is how often the server takes back jobs whose leases ran
+// out
+const expireInterval = time.Second
+
+// Submission is the body of POST /jobs
+type Submission struct {
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	MaxAttempts int             `json:"maxAttempts,omitempty"` // 0 for the queue's
+}
+
+// Registration is the body of POST /workers
+type Registration struct {
+	Name  string   `json:"name"`
+	Host  string   `json:"host,omitempty"` // the worker's machine; empty for where it connected from
+	Kinds []string `json:"kinds"`
+}
+
+// Outcome is the body of POST /jobs/{id}/done and /jobs/{id}/fail
+type Outcome struct {
+	Worker string          `json:"worker"`
+	Result json.RawMessage `json:"result,omitempty"` // of a job done
+	Error  string          `json:"error,omitempty"`  // of an attempt that failed
+}
+
+// Status is what GET /status answers
+type Status struct {
+	Jobs    map[string]int `json:"jobs"` // by status
+	Workers int            `json:"workers"`
+	LeaseMs int64          `json:"leaseMs"` // how often a worker must renew its leases
+}
+
+// Server serves a queue to submitters and workers:
+//
+//	GET  /status                      jobs by status, workers and the lease
+//	POST /jobs                        submit a job: {"kind":, "payload":, "maxAttempts":}
+//	GET  /jobs?status=&kind=&limit=   jobs, newest first
+//	GET  /jobs/{id}                   one job: its status, attempts and result or error
+//	POST /jobs/{id}/done              a worker's result: {"worker":, "result":}
+//	POST /jobs/{id}/fail              a worker's failed attempt: {"worker":, "error":}
+//	POST /workers                     register a worker: {"name":, "kinds": []}
+//	GET  /workers                     workers, when each was last seen and what it runs
+//	POST /workers/{id}/heartbeat      renew the worker's leases
+//	POST /workers/{id}/lease?wait=30s lease the next job of a kind it takes
+//
+// A lease answers the job, or 204 when none came within wait. A worker
+// renews its leases each Status.LeaseMs; when one runs out the job is
+// taken back, and like a failed attempt is queued again while it has
+// attempts left.
+type Server struct {
+	queue *Queue
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// NewServer serves queue, taking back expired leases until Close
+func NewServer(queue *Queue) *Server {
+	s := &Server{queue: queue, stop: make(chan struct{})}
+	crash.Go(s.expire)
+	return s
+}
+
+// Close stops taking back expired leases
+func (s *Server) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *Server) expire() {
+	t := time.NewTicker(expireInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-t.C:
+			n, err := s.queue.Expire(now)
+			if err != nil {
+				slog.Error("jobqueue: taking back expired leases", "error", err)
+			} else if n > 0 {
+				slog.Warn("jobqueue: took back jobs whose workers stopped renewing their leases", "jobs", n)
+			}
+		}
+	}
+}
+
+// ServeHTTP routes the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "status":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.status(w)
+	case len(parts) == 1 && parts[0] == "jobs":
+		switch r.Method {
+		case http.MethodGet:
+			s.list(w, r)
+		case http.MethodPost:
+			s.submit(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	case len(parts) == 2 && parts[0] == "jobs":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		if id, ok := jobID(w, parts[1]); ok {
+			j, err := s.queue.Job(id)
+			reply(w, http.StatusOK, j, err)
+		}
+	case len(parts) == 3 && parts[0] == "jobs" && (parts[2] == "done" || parts[2] == "fail"):
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		if id, ok := jobID(w, parts[1]); ok {
+			s.outcome(w, r, id, parts[2] == "done")
+		}
+	case len(parts) == 1 && parts[0] == "workers":
+		switch r.Method {
+		case http.MethodGet:
+			workers, err := s.queue.Workers()
+			reply(w, http.StatusOK, workers, err)
+		case http.MethodPost:
+			s.register(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	case len(parts) == 3 && parts[0] == "workers" && (parts[2] == "heartbeat" || parts[2] == "lease"):
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		if parts[2] == "heartbeat" {
+			if err := s.queue.Heartbeat(parts[1]); err != nil {
+				reply(w, 0, nil, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		s.lease(w, r, parts[1])
+	default:
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+	}
+}
+
+func (s *Server) status(w http.ResponseWriter) {
+	counts, err := s.queue.Counts()
+	if err != nil {
+		reply(w, 0, nil, err)
+		return
+	}
+	workers, err := s.queue.Workers()
+	reply(w, http.StatusOK, Status{Jobs: counts, Workers: len(workers), LeaseMs: s.queue.Lease().Milliseconds()}, err)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := Filter{Status: q.Get("status"), Kind: q.Get("kind")}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			httpError(w, http.StatusBadRequest, "limit %q isn't a count", v)
+			return
+		}
+		f.Limit = n
+	}
+	jobs, err := s.queue.Jobs(f)
+	reply(w, http.StatusOK, jobs, err)
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	var sub Submission
+	if !readJSON(w, r, &sub) {
+		return
+	}
+	j, err := s.queue.Submit(sub.Kind, sub.Payload, sub.MaxAttempts)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	slog.Info("jobqueue: job submitted", "job", j.ID, "kind", j.Kind, "by", r.RemoteAddr)
+	writeJSON(w, http.StatusCreated, j)
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	var reg Registration
+	if !readJSON(w, r, &reg) {
+		return
+	}
+	if reg.Host == "" {
+		reg.Host = r.RemoteAddr
+	}
+	wk, err := s.queue.Register(reg.Name, reg.Host, reg.Kinds)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	slog.Info("jobqueue: worker registered", "worker", wk.ID, "host", wk.Host, "kinds", strings.Join(wk.Kinds, ","))
+	writeJSON(w, http.StatusCreated, wk)
+}
+
+// lease answers the worker's next job, waiting for one to be queued
+func (s *Server) lease(w http.ResponseWriter, r *http.Request, worker string) {
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			httpError(w, http.StatusBadRequest, "wait %q isn't a duration", v)
+			return
+		}
+		wait = min(d, maxWait)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for r.Context().Err() == nil {
+		wake := s.queue.Wake()
+		j, ok, err := s.queue.Next(worker)
+		if err != nil || ok {
+			if ok {
+				slog.Debug("jobqueue: job leased", "job", j.ID, "kind", j.Kind, "worker", worker, "attempt", j.Attempts)
+			}
+			reply(w, http.StatusOK, j, err)
+			return
+		}
+		select {
+		case <-wake:
+		case <-timer.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+		}
+	}
+}
+
+func (s *Server) outcome(w http.ResponseWriter, r *http.Request, id int64, done bool) {
+	var out Outcome
+	if !readJSON(w, r, &out) {
+		return
+	}
+	var err error
+	if done {
+		err = s.queue.Complete(id, out.Worker, out.Result)
+	} else {
+		err = s.queue.Fail(id, out.Worker, out.Error)
+	}
+	if err != nil {
+		reply(w, 0, nil, err)
+		return
+	}
+	j, err := s.queue.Job(id)
+	if err == nil {
+		if done {
+			slog.Info("jobqueue: job done", "job", id, "kind", j.Kind, "worker", out.Worker)
+		} else {
+			slog.Warn("jobqueue: job attempt failed", "job", id, "kind", j.Kind, "worker", out.Worker,
+				"attempt", j.Attempts, "status", j.Status, "error", out.Error)
+		}
+	}
+	reply(w, http.StatusOK, j, err)
+}
+
+func jobID(w http.ResponseWriter, s string) (int64, bool) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		httpError(w, http.StatusBadRequest, "job ID %q isn't a number", s)
+		return 0, false
+	}
+	return id, true
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(v); err != nil {
+		httpError(w, http.StatusBadRequest, "read body: %v", err)
+		return false
+	}
+	return true
+}
+
+// reply answers v, or the error as its status
+func reply(w http.ResponseWriter, status int, v any, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		httpError(w, http.StatusNotFound, "%v", err)
+	case errors.Is(err, ErrLost):
+		httpError(w, http.StatusConflict, "%v", err)
+	case err != nil:
+		httpError(w, http.StatusInternalServerError, "%v", err)
+	default:
+		writeJSON(w, status, v)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
@@ -0,0 +1,194 @@
+package jobqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+)
+
+// Handler runs a job of a kind: it answers the result, marshalled as JSON,
+// or why the attempt failed. ctx is done when the worker stops.
+type Handler func(ctx context.Context, payload json.RawMessage) (any, error)
+
+// Defaults for WorkerOptions left zero
+const (
+	DefaultPoll  = 30 * time.Second
+	DefaultRetry = 5 * time.Second
+)
+
+// WorkerOptions set up a worker
+type WorkerOptions struct {
+	Name     string             // default the host's name
+	Host     string             // default the host's name
+	Handlers map[string]Handler // by the kind of job each runs
+	Parallel int                // jobs at once; 0 for 1
+	Poll     time.Duration      // a lease waits for a job
+	Retry    time.Duration      // to wait after the server couldn't be reached
+}
+
+// Work registers a worker for the handlers' kinds of job and runs the jobs
+// it leases until ctx is done, renewing their leases while they run. A
+// worker the server lost track of registers again.
+func (c *Client) Work(ctx context.Context, opts WorkerOptions) error {
+	if len(opts.Handlers) == 0 {
+		return errors.New("a worker needs a handler for at least one kind of job")
+	}
+	host, _ := os.Hostname()
+	if opts.Host == "" {
+		opts.Host = host
+	}
+	if opts.Name == "" {
+		opts.Name = host
+	}
+	if opts.Parallel <= 0 {
+		opts.Parallel = 1
+	}
+	if opts.Poll <= 0 {
+		opts.Poll = DefaultPoll
+	}
+	if opts.Retry <= 0 {
+		opts.Retry = DefaultRetry
+	}
+	kinds := make([]string, 0, len(opts.Handlers))
+	for k := range opts.Handlers {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Parallel; i++ {
+		name := opts.Name
+		if opts.Parallel > 1 {
+			name = fmt.Sprintf("%s.%d", opts.Name, i+1)
+		}
+		wg.Add(1)
+		crash.Go(func() {
+			defer wg.Done()
+			c.work(ctx, name, opts.Host, kinds, opts)
+		})
+	}
+	wg.Wait()
+	return nil
+}
+
+// work is one worker's loop of leasing a job and running it
+func (c *Client) work(ctx context.Context, name, host string, kinds []string, opts WorkerOptions) {
+	var w Worker
+	var lease time.Duration
+	for ctx.Err() == nil {
+		if w.ID == "" {
+			var st Status
+			err := c.do(ctx, http.MethodGet, "/status", nil, &st)
+			if err == nil {
+				err = c.do(ctx, http.MethodPost, "/workers", Registration{Name: name, Host: host, Kinds: kinds}, &w)
+			}
+			if err != nil {
+				c.retry(ctx, "registering", err, opts.Retry)
+				continue
+			}
+			lease = time.Duration(st.LeaseMs) * time.Millisecond
+			slog.Info("jobqueue: worker registered", "worker", w.ID, "kinds", kinds, "lease", lease)
+		}
+		var j Job
+		err := c.do(ctx, http.MethodPost, "/workers/"+w.ID+"/lease?wait="+opts.Poll.String(), nil, &j)
+		switch {
+		case isNotFound(err):
+			slog.Warn("jobqueue: the server lost track of the worker; registering again", "worker", w.ID)
+			w = Worker{}
+		case err != nil:
+			c.retry(ctx, "leasing a job", err, opts.Retry)
+		case j.ID != 0:
+			c.run(ctx, w.ID, j, opts.Handlers[j.Kind], lease)
+		}
+	}
+}
+
+// run runs a leased job, renewing the lease a few times a lease, and
+// reports the outcome
+func (c *Client) run(ctx context.Context, worker string, j Job, h Handler, lease time.Duration) {
+	log := slog.With("job", j.ID, "kind", j.Kind, "attempt", j.Attempts, "worker", worker)
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	crash.Go(func() {
+		t := time.NewTicker(max(lease/3, 100*time.Millisecond))
+		defer t.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-t.C:
+				if err := c.do(jobCtx, http.MethodPost, "/workers/"+worker+"/heartbeat", nil, nil); err != nil && jobCtx.Err() == nil {
+					log.Warn("jobqueue: renewing the lease", "error", err)
+				}
+			}
+		}
+	})
+
+	log.Info("jobqueue: running job")
+	var out Outcome
+	path := "/jobs/" + strconv.FormatInt(j.ID, 10)
+	result, err := runHandler(jobCtx, h, j)
+	if err == nil {
+		out = Outcome{Worker: worker}
+		out.Result, err = json.Marshal(result)
+	}
+	if err == nil {
+		path += "/done"
+	} else {
+		out = Outcome{Worker: worker, Error: err.Error()}
+		path += "/fail"
+	}
+	cancel()
+	if ctx.Err() != nil {
+		// an interrupted attempt isn't the job's failure; its lease runs out
+		// and another worker takes it
+		log.Info("jobqueue: stopped with a job running")
+		return
+	}
+	if rerr := c.do(ctx, http.MethodPost, path, out, nil); rerr != nil {
+		log.Error("jobqueue: reporting the outcome", "error", rerr)
+	} else if err != nil {
+		log.Warn("jobqueue: job attempt failed", "error", err)
+	} else {
+		log.Info("jobqueue: job done")
+	}
+}
+
+// runHandler runs h, turning a panic into the attempt's failure
+func runHandler(ctx context.Context, h Handler, j Job) (result any, err error) {
+	if h == nil {
+		return nil, fmt.Errorf("no handler for jobs of kind %s", j.Kind)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return h(ctx, j.Payload)
+}
+
+func (c *Client) retry(ctx context.Context, what string, err error, wait time.Duration) {
+	if ctx.Err() != nil {
+		return
+	}
+	slog.Warn("jobqueue: "+what, "error", err, "retry", wait)
+	select {
+	case <-ctx.Done():
+	case <-time.After(wait):
+	}
+}
+
+func isNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusNotFound
+}
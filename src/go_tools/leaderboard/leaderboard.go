@@ -0,0 +1,225 @@
+// Package leaderboard ranks players' best scores per board and season, on
+// storage kept in memory, in SQLite or in Redis, for integration tests of
+// the game's online features
+package leaderboard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Season periods: a board starts over every week or month, or never
+const (
+	PeriodAll     = "all"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+)
+
+// Paging limits
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// ErrNotRanked is a player without a score on a board's season
+var ErrNotRanked = errors.New("not ranked")
+
+// Key names one season of one board
+type Key struct {
+	Board  string
+	Season string
+}
+
+// Entry is a player's best score on a board's season
+type Entry struct {
+	Player string    `json:"player"`
+	Score  int64     `json:"score"`
+	At     time.Time `json:"at"` // when the score was set
+}
+
+// Storage keeps the entries. Every backend ranks the same way: higher
+// scores first, equal ones by player ID, so a page reads the same from
+// each.
+type Storage interface {
+	// Submit keeps e if it beats the player's score, reporting whether
+	// it did
+	Submit(k Key, e Entry) (bool, error)
+	// Range returns up to limit entries from the 0-based rank offset
+	Range(k Key, offset, limit int) ([]Entry, error)
+	// Rank returns the player's 0-based rank and entry; ok is false for
+	// a player without one
+	Rank(k Key, player string) (rank int, e Entry, ok bool, err error)
+	// Count is how many players have a score
+	Count(k Key) (int, error)
+	// Seasons lists the seasons a board has scores in, oldest first
+	Seasons(board string) ([]string, error)
+	Close() error
+}
+
+// Open opens the storage spec names: memory, sqlite:PATH or
+// redis://[:PASSWORD@]HOST:PORT[/DB]
+func Open(spec string) (Storage, error) {
+	switch {
+	case spec == "" || spec == "memory":
+		return NewMemory(), nil
+	case strings.HasPrefix(spec, "sqlite:"):
+		return OpenSQLite(strings.TrimPrefix(spec, "sqlite:"))
+	case strings.HasPrefix(spec, "redis://"):
+		return OpenRedis(spec)
+	}
+	return nil, fmt.Errorf("unknown leaderboard storage %q, want memory, sqlite:PATH or redis://HOST:PORT", spec)
+}
+
+// Standing is an entry with its 1-based rank
+type Standing struct {
+	Rank int `json:"rank"`
+	Entry
+}
+
+// Page is a run of standings on a board's season
+type Page struct {
+	Board     string     `json:"board"`
+	Season    string     `json:"season"`
+	Players   int        `json:"players"` // ranked on the season
+	Standings []Standing `json:"standings"`
+}
+
+// Leaderboard submits and ranks scores on its storage, in seasons of its
+// period
+type Leaderboard struct {
+	storage Storage
+	period  string
+	now     func() time.Time
+}
+
+// New ranks scores on storage; period is PeriodAll, PeriodWeekly or
+// PeriodMonthly
+func New(storage Storage, period string) (*Leaderboard, error) {
+	switch period {
+	case "":
+		period = PeriodAll
+	case PeriodAll, PeriodWeekly, PeriodMonthly:
+	default:
+		return nil, fmt.Errorf("unknown season period %q, want %s, %s or %s", period, PeriodAll, PeriodWeekly, PeriodMonthly)
+	}
+	return &Leaderboard{storage: storage, period: period, now: time.Now}, nil
+}
+
+// Season names the season t falls in: all, an ISO week like 2024-W23 or
+// a month like 2024-06
+func (l *Leaderboard) Season(t time.Time) string {
+	t = t.UTC()
+	switch l.period {
+	case PeriodWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case PeriodMonthly:
+		return t.Format("2006-01")
+	}
+	return PeriodAll
+}
+
+// season is the named season, or the current one for ""
+func (l *Leaderboard) season(s string) string {
+	if s == "" {
+		return l.Season(l.now())
+	}
+	return s
+}
+
+// Submit records a player's score on the board's current season and
+// returns their standing after it; improved is false when the score
+// didn't beat their best
+func (l *Leaderboard) Submit(board, player string, score int64) (st Standing, improved bool, err error) {
+	if board == "" || player == "" {
+		return st, false, errors.New("a score needs a board and a player")
+	}
+	k := Key{Board: board, Season: l.season("")}
+	if improved, err = l.storage.Submit(k, Entry{Player: player, Score: score, At: l.now().UTC()}); err != nil {
+		return st, false, err
+	}
+	st, err = l.Player(board, k.Season, player)
+	return st, improved, err
+}
+
+// Player returns a player's standing on a board's season
+func (l *Leaderboard) Player(board, season, player string) (Standing, error) {
+	rank, e, ok, err := l.storage.Rank(Key{Board: board, Season: l.season(season)}, player)
+	if err != nil {
+		return Standing{}, err
+	}
+	if !ok {
+		return Standing{}, fmt.Errorf("%s on %s: %w", player, board, ErrNotRanked)
+	}
+	return Standing{Rank: rank + 1, Entry: e}, nil
+}
+
+// Top returns limit standings from the 0-based offset on a board's season
+func (l *Leaderboard) Top(board, season string, offset, limit int) (Page, error) {
+	return l.page(Key{Board: board, Season: l.season(season)}, offset, limit)
+}
+
+// Around returns the player's standing with up to n on either side of it
+func (l *Leaderboard) Around(board, season, player string, n int) (Page, error) {
+	k := Key{Board: board, Season: l.season(season)}
+	rank, _, ok, err := l.storage.Rank(k, player)
+	if err != nil {
+		return Page{}, err
+	}
+	if !ok {
+		return Page{}, fmt.Errorf("%s on %s: %w", player, board, ErrNotRanked)
+	}
+	if n < 0 {
+		n = 0
+	}
+	offset := rank - n
+	if offset < 0 {
+		offset = 0
+	}
+	return l.page(k, offset, rank+n+1-offset)
+}
+
+func (l *Leaderboard) page(k Key, offset, limit int) (Page, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	p := Page{Board: k.Board, Season: k.Season, Standings: []Standing{}}
+	var err error
+	if p.Players, err = l.storage.Count(k); err != nil {
+		return p, err
+	}
+	entries, err := l.storage.Range(k, offset, limit)
+	if err != nil {
+		return p, err
+	}
+	for i, e := range entries {
+		p.Standings = append(p.Standings, Standing{Rank: offset + i + 1, Entry: e})
+	}
+	return p, nil
+}
+
+// Seasons lists the seasons a board has scores in, oldest first
+func (l *Leaderboard) Seasons(board string) ([]string, error) {
+	return l.storage.Seasons(board)
+}
+
+// Close closes the storage
+func (l *Leaderboard) Close() error {
+	return l.storage.Close()
+}
+
+// ranksBefore is the order every backend ranks in
+func ranksBefore(a, b Entry) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Player < b.Player
+}
@@ -0,0 +1,118 @@
+package leaderboard
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// storages opens each backend empty
+func storages(t *testing.T) map[string]Storage {
+	out := map[string]Storage{}
+	for name, spec := range map[string]string{
+		"memory": "memory",
+		"sqlite": "sqlite:" + filepath.Join(t.TempDir(), "leaderboard.db"),
+		"redis":  startFakeRedis(t),
+	} {
+		s, err := Open(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		t.Cleanup(func() { s.Close() })
+		out[name] = s
+	}
+	return out
+}
+
+func players(p Page) []string {
+	var out []string
+	for _, s := range p.Standings {
+		out = append(out, fmt.Sprintf("%d:%s:%d", s.Rank, s.Player, s.Score))
+	}
+	return out
+}
+
+func TestLeaderboardOnEveryStorage(t *testing.T) {
+	for name, storage := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+			lb, err := New(storage, PeriodMonthly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+			lb.now = func() time.Time { return now }
+
+			for i, score := range []int64{300, 500, 100, 500, 200} {
+				if _, improved, err := lb.Submit("marathon", fmt.Sprint("p", i), score); err != nil || !improved {
+					t.Fatalf("submit p%d: %v %v", i, improved, err)
+				}
+			}
+			// a worse score keeps the best; a better one moves up
+			if st, improved, err := lb.Submit("marathon", "p1", 50); err != nil || improved || st.Rank != 1 || st.Score != 500 {
+				t.Errorf("worse score: %+v %v %v", st, improved, err)
+			}
+			now = now.Add(time.Minute)
+			st, improved, err := lb.Submit("marathon", "p2", 400)
+			if err != nil || !improved || st.Rank != 3 || !st.At.Equal(now) {
+				t.Errorf("better score: %+v %v %v", st, improved, err)
+			}
+
+			top, err := lb.Top("marathon", "", 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// equal scores rank by player
+			want := []string{"1:p1:500", "2:p3:500", "3:p2:400", "4:p0:300", "5:p4:200"}
+			if top.Season != "2024-06" || top.Players != 5 || !slices.Equal(players(top), want) {
+				t.Errorf("top = %+v", top)
+			}
+			if page, _ := lb.Top("marathon", "", 3, 10); !slices.Equal(players(page), want[3:]) {
+				t.Errorf("second page = %v", players(page))
+			}
+			around, err := lb.Around("marathon", "", "p0", 1)
+			if err != nil || !slices.Equal(players(around), want[2:5]) {
+				t.Errorf("around p0 = %v %v", players(around), err)
+			}
+			if around, _ := lb.Around("marathon", "", "p1", 2); !slices.Equal(players(around), want[:3]) {
+				t.Errorf("around the top = %v", players(around))
+			}
+			if _, err := lb.Player("marathon", "", "nobody"); !errors.Is(err, ErrNotRanked) {
+				t.Errorf("unranked player: %v", err)
+			}
+
+			// a new month is a new season; the old one stays readable
+			now = time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+			if st, _, _ := lb.Submit("marathon", "p4", 10); st.Rank != 1 {
+				t.Errorf("first of the season = %+v", st)
+			}
+			if seasons, err := lb.Seasons("marathon"); err != nil || !slices.Equal(seasons, []string{"2024-06", "2024-07"}) {
+				t.Errorf("seasons = %v %v", seasons, err)
+			}
+			if old, _ := lb.Top("marathon", "2024-06", 0, 1); old.Players != 5 || old.Standings[0].Player != "p1" {
+				t.Errorf("last season = %+v", old)
+			}
+			if other, _ := lb.Top("sprint", "", 0, 10); other.Players != 0 || len(other.Standings) != 0 {
+				t.Errorf("another board = %+v", other)
+			}
+		})
+	}
+}
+
+func TestSeasonNames(t *testing.T) {
+	at := time.Date(2024, 12, 30, 10, 0, 0, 0, time.UTC)
+	for period, want := range map[string]string{PeriodAll: "all", PeriodWeekly: "2025-W01", PeriodMonthly: "2024-12"} {
+		lb, err := New(NewMemory(), period)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lb.Season(at); got != want {
+			t.Errorf("%s season = %q, want %q", period, got, want)
+		}
+	}
+	if _, err := New(NewMemory(), "yearly"); err == nil {
+		t.Error("unknown period accepted")
+	}
+}
@@ -0,0 +1,111 @@
+package leaderboard
+
+import (
+	"sort"
+	"sync"
+)
+
+// Memory keeps entries in memory, lost when the process exits
+type Memory struct {
+	mu     sync.Mutex
+	boards map[Key]*memoryBoard
+}
+
+// memoryBoard is one season of a board, ranked
+type memoryBoard struct {
+	ranked []Entry
+	best   map[string]Entry
+}
+
+// NewMemory returns empty in-memory storage
+func NewMemory() *Memory {
+	return &Memory{boards: make(map[Key]*memoryBoard)}
+}
+
+// Submit implements Storage
+func (m *Memory) Submit(k Key, e Entry) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.boards[k]
+	if b == nil {
+		b = &memoryBoard{best: make(map[string]Entry)}
+		m.boards[k] = b
+	}
+	if old, ok := b.best[e.Player]; ok {
+		if e.Score <= old.Score {
+			return false, nil
+		}
+		i := b.position(old)
+		b.ranked = append(b.ranked[:i], b.ranked[i+1:]...)
+	}
+	i := b.position(e)
+	b.ranked = append(b.ranked, Entry{})
+	copy(b.ranked[i+1:], b.ranked[i:])
+	b.ranked[i] = e
+	b.best[e.Player] = e
+	return true, nil
+}
+
+// position is where e ranks among the entries
+func (b *memoryBoard) position(e Entry) int {
+	return sort.Search(len(b.ranked), func(i int) bool { return !ranksBefore(b.ranked[i], e) })
+}
+
+// Range implements Storage
+func (m *Memory) Range(k Key, offset, limit int) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.boards[k]
+	if b == nil || offset >= len(b.ranked) {
+		return nil, nil
+	}
+	end := offset + limit
+	if end > len(b.ranked) {
+		end = len(b.ranked)
+	}
+	return append([]Entry(nil), b.ranked[offset:end]...), nil
+}
+
+// Rank implements Storage
+func (m *Memory) Rank(k Key, player string) (int, Entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.boards[k]
+	if b == nil {
+		return 0, Entry{}, false, nil
+	}
+	e, ok := b.best[player]
+	if !ok {
+		return 0, Entry{}, false, nil
+	}
+	return b.position(e), e, true, nil
+}
+
+// Count implements Storage
+func (m *Memory) Count(k Key) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b := m.boards[k]; b != nil {
+		return len(b.ranked), nil
+	}
+	return 0, nil
+}
+
+// Seasons implements Storage
+func (m *Memory) Seasons(board string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seasons := []string{}
+	for k := range m.boards {
+		if k.Board == board {
+			seasons = append(seasons, k.Season)
+		}
+	}
+	sort.Strings(seasons)
+	return seasons, nil
+}
+
+// Close implements Storage
+func (m *Memory) Close() error {
+	return nil
+}
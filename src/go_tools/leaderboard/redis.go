@@ -0,0 +1,272 @@
+package leaderboard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisPrefix starts every key the leaderboard uses, so it can share a
+// database
+const redisPrefix = "supertetris:leaderboard:"
+
+// redisTimeout bounds a command's round trip
+const redisTimeout = 5 * time.Second
+
+// Redis keeps entries in Redis, a sorted set per board season. Scores are
+// stored negated, so ZRANGE's ascending order of scores and then members
+// ranks as the other backends do; they are doubles there, exact to 2^53.
+// It needs Redis 6.2 or later, for ZADD LT.
+type Redis struct {
+	addr string
+
+	mu   sync.Mutex // one command at a time on the connection
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// redisError is an error reply
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// OpenRedis connects to redis://[:PASSWORD@]HOST:PORT[/DB]
+func OpenRedis(rawURL string) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	conn, err := net.DialTimeout("tcp", addr, redisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	r := &Redis{addr: addr, conn: conn, br: bufio.NewReader(conn)}
+	if password, ok := u.User.Password(); ok {
+		if _, err := r.do("AUTH", password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis database %q isn't a number", db)
+		}
+		if _, err := r.do("SELECT", db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func redisKey(k Key) string {
+	return redisPrefix + k.Board + ":" + k.Season
+}
+
+// Submit implements Storage
+func (r *Redis) Submit(k Key, e Entry) (bool, error) {
+	changed, err := r.int("ZADD", redisKey(k), "LT", "CH", strconv.FormatInt(-e.Score, 10), e.Player)
+	if err != nil || changed == 0 {
+		return false, err
+	}
+	if _, err := r.do("HSET", redisKey(k)+":at", e.Player, strconv.FormatInt(e.At.UnixMilli(), 10)); err != nil {
+		return true, err
+	}
+	_, err = r.do("SADD", redisPrefix+k.Board+":seasons", k.Season)
+	return true, err
+}
+
+// Range implements Storage
+func (r *Redis) Range(k Key, offset, limit int) ([]Entry, error) {
+	reply, err := r.do("ZRANGE", redisKey(k), strconv.Itoa(offset), strconv.Itoa(offset+limit-1), "WITHSCORES")
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]any)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	out := make([]Entry, 0, len(items)/2)
+	args := []string{"HMGET", redisKey(k) + ":at"}
+	for i := 0; i+1 < len(items); i += 2 {
+		player, _ := items[i].(string)
+		score, err := redisScore(items[i+1])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Entry{Player: player, Score: score})
+		args = append(args, player)
+	}
+	reply, err = r.do(args...)
+	if err != nil {
+		return nil, err
+	}
+	ats, _ := reply.([]any)
+	for i := range out {
+		if i < len(ats) {
+			out[i].At = redisTime(ats[i])
+		}
+	}
+	return out, nil
+}
+
+// Rank implements Storage
+func (r *Redis) Rank(k Key, player string) (int, Entry, bool, error) {
+	reply, err := r.do("ZRANK", redisKey(k), player)
+	if err != nil || reply == nil {
+		return 0, Entry{}, false, err
+	}
+	rank, _ := reply.(int64)
+	reply, err = r.do("ZSCORE", redisKey(k), player)
+	if err != nil {
+		return 0, Entry{}, false, err
+	}
+	score, err := redisScore(reply)
+	if err != nil {
+		return 0, Entry{}, false, err
+	}
+	at, err := r.do("HGET", redisKey(k)+":at", player)
+	if err != nil {
+		return 0, Entry{}, false, err
+	}
+	return int(rank), Entry{Player: player, Score: score, At: redisTime(at)}, true, nil
+}
+
+// Count implements Storage
+func (r *Redis) Count(k Key) (int, error) {
+	n, err := r.int("ZCARD", redisKey(k))
+	return int(n), err
+}
+
+// Seasons implements Storage
+func (r *Redis) Seasons(board string) ([]string, error) {
+	reply, err := r.do("SMEMBERS", redisPrefix+board+":seasons")
+	if err != nil {
+		return nil, err
+	}
+	items, _ := reply.([]any)
+	seasons := []string{}
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			seasons = append(seasons, s)
+		}
+	}
+	sort.Strings(seasons)
+	return seasons, nil
+}
+
+// Close implements Storage
+func (r *Redis) Close() error {
+	return r.conn.Close()
+}
+
+// redisScore reads a stored score back, undoing its negation
+func redisScore(v any) (int64, error) {
+	s, _ := v.(string)
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("redis: score %q: %w", s, err)
+	}
+	return -int64(f), nil
+}
+
+func redisTime(v any) time.Time {
+	s, _ := v.(string)
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
+
+func (r *Redis) int(args ...string) (int64, error) {
+	reply, err := r.do(args...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: %s replied %v, want an integer", args[0], reply)
+	}
+	return n, nil
+}
+
+// do sends one command and reads its reply: a string, an int64, a []any
+// of replies, nil, or a redisError as the error
+func (r *Redis) do(args ...string) (any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conn.SetDeadline(time.Now().Add(redisTimeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(r.conn, b.String()); err != nil {
+		return nil, fmt.Errorf("redis %s: %w", r.addr, err)
+	}
+	return readReply(r.br)
+}
+
+// readReply reads one RESP2 reply
+func readReply(br *bufio.Reader) (any, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			// an error inside an array is an item, not the reply's error
+			item, err := readReply(br)
+			var rerr redisError
+			if errors.As(err, &rerr) {
+				item, err = rerr, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
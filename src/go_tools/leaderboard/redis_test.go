@@ -0,0 +1,182 @@
+package leaderboard
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis answers the commands the Redis storage sends, the way Redis
+// 6.2 does, enough to run the storage tests without a server
+type fakeRedis struct {
+	mu     sync.Mutex
+	zsets  map[string]map[string]float64
+	hashes map[string]map[string]string
+	sets   map[string]map[string]bool
+}
+
+func startFakeRedis(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeRedis{zsets: map[string]map[string]float64{}, hashes: map[string]map[string]string{}, sets: map[string]map[string]bool{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return "redis://" + ln.Addr().String() + "/2"
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(br)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		f.mu.Lock()
+		out := f.command(args)
+		f.mu.Unlock()
+		if _, err := io.WriteString(conn, out); err != nil {
+			return
+		}
+	}
+}
+
+func bulk(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+
+func array(items []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(items))
+	for _, it := range items {
+		b.WriteString(it)
+	}
+	return b.String()
+}
+
+// ranked is a sorted set's members in ZRANGE's order
+func ranked(z map[string]float64) []string {
+	members := make([]string, 0, len(z))
+	for m := range z {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if z[members[i]] != z[members[j]] {
+			return z[members[i]] < z[members[j]]
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+func (f *fakeRedis) command(args []string) string {
+	const nilBulk = "$-1\r\n"
+	switch strings.ToUpper(args[0]) {
+	case "SELECT", "AUTH":
+		return "+OK\r\n"
+	case "ZADD": // key LT CH score member
+		z := f.zsets[args[1]]
+		if z == nil {
+			z = map[string]float64{}
+			f.zsets[args[1]] = z
+		}
+		score, _ := strconv.ParseFloat(args[4], 64)
+		if old, ok := z[args[5]]; ok && score >= old {
+			return ":0\r\n"
+		}
+		z[args[5]] = score
+		return ":1\r\n"
+	case "ZRANGE": // key start stop WITHSCORES
+		members := ranked(f.zsets[args[1]])
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		var out []string
+		for i := start; i <= stop && i < len(members); i++ {
+			out = append(out, bulk(members[i]), bulk(strconv.FormatFloat(f.zsets[args[1]][members[i]], 'g', -1, 64)))
+		}
+		return array(out)
+	case "ZRANK":
+		for i, m := range ranked(f.zsets[args[1]]) {
+			if m == args[2] {
+				return fmt.Sprintf(":%d\r\n", i)
+			}
+		}
+		return nilBulk
+	case "ZSCORE":
+		if s, ok := f.zsets[args[1]][args[2]]; ok {
+			return bulk(strconv.FormatFloat(s, 'g', -1, 64))
+		}
+		return nilBulk
+	case "ZCARD":
+		return fmt.Sprintf(":%d\r\n", len(f.zsets[args[1]]))
+	case "HSET":
+		if f.hashes[args[1]] == nil {
+			f.hashes[args[1]] = map[string]string{}
+		}
+		f.hashes[args[1]][args[2]] = args[3]
+		return ":1\r\n"
+	case "HGET":
+		if v, ok := f.hashes[args[1]][args[2]]; ok {
+			return bulk(v)
+		}
+		return nilBulk
+	case "HMGET":
+		var out []string
+		for _, field := range args[2:] {
+			if v, ok := f.hashes[args[1]][field]; ok {
+				out = append(out, bulk(v))
+			} else {
+				out = append(out, nilBulk)
+			}
+		}
+		return array(out)
+	case "SADD":
+		if f.sets[args[1]] == nil {
+			f.sets[args[1]] = map[string]bool{}
+		}
+		f.sets[args[1]][args[2]] = true
+		return ":1\r\n"
+	case "SMEMBERS":
+		var out []string
+		for m := range f.sets[args[1]] {
+			out = append(out, bulk(m))
+		}
+		return array(out)
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func TestReadReply(t *testing.T) {
+	br := bufio.NewReader(strings.NewReader("*3\r\n$3\r\nfoo\r\n:-4\r\n-WRONGTYPE bad key\r\n$-1\r\n-ERR nope\r\n"))
+	reply, err := readReply(br)
+	items, _ := reply.([]any)
+	if err != nil || len(items) != 3 || items[0] != "foo" || items[1] != int64(-4) || items[2] != redisError("WRONGTYPE bad key") {
+		t.Fatalf("array = %#v, %v", reply, err)
+	}
+	if reply, err := readReply(br); reply != nil || err != nil {
+		t.Errorf("nil bulk = %#v, %v", reply, err)
+	}
+	if _, err := readReply(br); err == nil || err.Error() != "redis: ERR nope" {
+		t.Errorf("error reply: %v", err)
+	}
+}
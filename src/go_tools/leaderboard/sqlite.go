@@ -0,0 +1,126 @@
+package leaderboard
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go driver, registers "sqlite"
+)
+
+// sqliteSchema is created on open. Players are compared as bytes, the
+// BINARY collation, to rank ties as the other backends do.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS leaderboard (
+		board TEXT NOT NULL,
+		season TEXT NOT NULL,
+		player TEXT NOT NULL,
+		score INTEGER NOT NULL,
+		at INTEGER NOT NULL,
+		PRIMARY KEY (board, season, player)
+	)`,
+	`CREATE INDEX IF NOT EXISTS leaderboard_rank ON leaderboard (board, season, score DESC, player)`,
+}
+
+// SQLite keeps entries in a SQLite database
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the database at path
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range sqliteSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("open %s: %w", path, err)
+		}
+	}
+	return &SQLite{db: db}, nil
+}
+
+// Submit implements Storage
+func (s *SQLite) Submit(k Key, e Entry) (bool, error) {
+	res, err := s.db.Exec(`INSERT INTO leaderboard (board, season, player, score, at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (board, season, player) DO UPDATE SET score = excluded.score, at = excluded.at
+		WHERE excluded.score > leaderboard.score`,
+		k.Board, k.Season, e.Player, e.Score, e.At.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Range implements Storage
+func (s *SQLite) Range(k Key, offset, limit int) ([]Entry, error) {
+	rows, err := s.db.Query(`SELECT player, score, at FROM leaderboard WHERE board = ? AND season = ?
+		ORDER BY score DESC, player LIMIT ? OFFSET ?`, k.Board, k.Season, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Entry
+	for rows.Next() {
+		var e Entry
+		var at int64
+		if err := rows.Scan(&e.Player, &e.Score, &at); err != nil {
+			return nil, err
+		}
+		e.At = time.UnixMilli(at).UTC()
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// Rank implements Storage
+func (s *SQLite) Rank(k Key, player string) (int, Entry, bool, error) {
+	e := Entry{Player: player}
+	var at int64
+	err := s.db.QueryRow(`SELECT score, at FROM leaderboard WHERE board = ? AND season = ? AND player = ?`,
+		k.Board, k.Season, player).Scan(&e.Score, &at)
+	if err == sql.ErrNoRows {
+		return 0, Entry{}, false, nil
+	}
+	if err != nil {
+		return 0, Entry{}, false, err
+	}
+	e.At = time.UnixMilli(at).UTC()
+	var rank int
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM leaderboard WHERE board = ? AND season = ?
+		AND (score > ? OR score = ? AND player < ?)`, k.Board, k.Season, e.Score, e.Score, player).Scan(&rank)
+	return rank, e, err == nil, err
+}
+
+// Count implements Storage
+func (s *SQLite) Count(k Key) (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM leaderboard WHERE board = ? AND season = ?`, k.Board, k.Season).Scan(&n)
+	return n, err
+}
+
+// Seasons implements Storage
+func (s *SQLite) Seasons(board string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT season FROM leaderboard WHERE board = ? ORDER BY season`, board)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	seasons := []string{}
+	for rows.Next() {
+		var season string
+		if err := rows.Scan(&season); err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, season)
+	}
+	return seasons, rows.Err()
+}
+
+// Close implements Storage
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
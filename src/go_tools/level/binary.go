@@ -0,0 +1,482 @@
+package level
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// The binary level format, for packs too large to ship as JSON. A file
+// starts with BinaryMagic and the uvarint format version, then holds a
+// DEFLATE stream of sections, each a uvarint tag, a uvarint length and
+// that many bytes, in tag order, ending with a 0 tag:
+//
+//	1 header      name, difficulty, mode, width, height
+//	2 blocks      x, y, type and special of each
+//	3 spawns      spawn points, spawn zones, the goal area
+//	4 objectives  kind, target, whether shared
+//	5 pickups     x, y, spell
+//	6 pieces      randomizer, seed, fixed pieces
+//	7 hints       trigger, text, cell
+//	8 metadata    keys in order and their values
+//	9 rules       special rules' keys in order and their values
+//	10 signature  key ID, signature
+//
+// Strings are a uvarint length and their bytes, integers varints, counts
+// uvarints and floats their IEEE 754 bits little endian. A block's type
+// and special are a uvarint, n for the nth of BlockTypes or SpecialKinds
+// and 0 followed by the name otherwise, where a block without a special
+// is 0 and the empty name. Lists and maps JSON writes as null when absent
+// store their length plus one, so a decoded level marshals as the encoded
+// one did; a goal area or hint cell is a 1 before it when there is one.
+//
+// A decoded level is of CurrentFormat, which the binary format follows:
+// a change to the level format changing what a section holds bumps
+// BinaryVersion, which older decoders refuse. Decoders skip the sections
+// they don't know, so later versions may add sections.
+const (
+	BinaryMagic   = "STLV"
+	BinaryVersion = 1
+	BinaryExt     = ".stlv" // Save writes the binary format to paths ending in it
+)
+
+// Section tags of the binary format
+const (
+	sectionHeader = iota + 1
+	sectionBlocks
+	sectionSpawns
+	sectionObjectives
+	sectionPickups
+	sectionPieces
+	sectionHints
+	sectionMetadata
+	sectionRules
+	sectionSignature
+)
+
+// ErrBinaryVersion is a binary level written by a newer format version
+var ErrBinaryVersion = errors.New("binary level format version not supported")
+
+// Encode writes the level in the binary format
+func Encode(w io.Writer, l *Level) error {
+	var body bytes.Buffer
+	section := func(tag int, fill func(e *encoder)) {
+		e := &encoder{}
+		fill(e)
+		body.Write(binary.AppendUvarint(nil, uint64(tag)))
+		body.Write(binary.AppendUvarint(nil, uint64(len(e.buf))))
+		body.Write(e.buf)
+	}
+
+	section(sectionHeader, func(e *encoder) {
+		e.strings(l.Name, l.Difficulty, l.Mode)
+		e.int(l.GridSize.Width, l.GridSize.Height)
+	})
+	section(sectionBlocks, func(e *encoder) {
+		e.count(len(l.Blocks), l.Blocks == nil)
+		for _, b := range l.Blocks {
+			e.int(b.X, b.Y)
+			e.symbol(BlockTypes, b.Type)
+			e.symbol(SpecialKinds, b.Special)
+		}
+	})
+	section(sectionSpawns, func(e *encoder) {
+		e.count(len(l.SpawnPoints), l.SpawnPoints == nil)
+		for _, p := range l.SpawnPoints {
+			e.int(p.X, p.Y)
+		}
+		e.uint(uint64(len(l.SpawnZones)))
+		for _, z := range l.SpawnZones {
+			e.zone(z)
+		}
+		e.flag(l.GoalArea != nil)
+		if l.GoalArea != nil {
+			e.zone(*l.GoalArea)
+		}
+	})
+	if len(l.Objectives) > 0 {
+		section(sectionObjectives, func(e *encoder) {
+			e.uint(uint64(len(l.Objectives)))
+			for _, o := range l.Objectives {
+				e.string(o.Kind)
+				e.int(o.Target)
+				e.flag(o.Shared)
+			}
+		})
+	}
+	if len(l.Pickups) > 0 {
+		section(sectionPickups, func(e *encoder) {
+			e.uint(uint64(len(l.Pickups)))
+			for _, p := range l.Pickups {
+				e.int(p.X, p.Y)
+				e.string(p.Spell)
+			}
+		})
+	}
+	if l.Pieces != nil {
+		section(sectionPieces, func(e *encoder) {
+			e.string(l.Pieces.Randomizer)
+			e.buf = binary.AppendVarint(e.buf, l.Pieces.Seed)
+			e.uint(uint64(len(l.Pieces.Fixed)))
+			e.strings(l.Pieces.Fixed...)
+		})
+	}
+	if len(l.Hints) > 0 {
+		section(sectionHints, func(e *encoder) {
+			e.uint(uint64(len(l.Hints)))
+			for _, h := range l.Hints {
+				e.strings(h.Trigger, h.Text)
+				e.flag(h.Cell != nil)
+				if h.Cell != nil {
+					e.int(h.Cell.X, h.Cell.Y)
+				}
+			}
+		})
+	}
+	if len(l.Metadata) > 0 {
+		section(sectionMetadata, func(e *encoder) {
+			keys := sortedKeys(l.Metadata)
+			e.uint(uint64(len(keys)))
+			for _, k := range keys {
+				e.strings(k, l.Metadata[k])
+			}
+		})
+	}
+	section(sectionRules, func(e *encoder) {
+		keys := sortedKeys(l.SpecialRules)
+		e.count(len(keys), l.SpecialRules == nil)
+		for _, k := range keys {
+			e.string(k)
+			e.float(l.SpecialRules[k])
+		}
+	})
+	if l.Signature != nil {
+		section(sectionSignature, func(e *encoder) {
+			e.strings(l.Signature.KeyID, string(l.Signature.Sig))
+		})
+	}
+	body.WriteByte(0)
+
+	var out bytes.Buffer
+	out.WriteString(BinaryMagic)
+	out.Write(binary.AppendUvarint(nil, BinaryVersion))
+	zw, err := flate.NewWriter(&out, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(body.Bytes()); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// Decode reads a level in the binary format without validating it
+func Decode(rd io.Reader) (*Level, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	if !IsBinary(data) {
+		return nil, fmt.Errorf("decode level: not a binary level")
+	}
+	v, n := binary.Uvarint(data[len(BinaryMagic):])
+	if n <= 0 {
+		return nil, fmt.Errorf("decode level: %w", errTruncated)
+	}
+	if v > BinaryVersion {
+		return nil, fmt.Errorf("decode level: format version %d: %w", v, ErrBinaryVersion)
+	}
+	body, err := io.ReadAll(flate.NewReader(bytes.NewReader(data[len(BinaryMagic)+n:])))
+	if err != nil {
+		return nil, fmt.Errorf("decode level: %w", err)
+	}
+	d := &decoder{buf: body}
+	l := &Level{Format: CurrentFormat}
+	for d.err == nil {
+		tag := d.uint()
+		if tag == 0 {
+			break
+		}
+		n := d.uint()
+		if d.err != nil || n > uint64(len(d.buf)) {
+			d.fail()
+			break
+		}
+		s := &decoder{buf: d.buf[:n]}
+		d.buf = d.buf[n:]
+		s.section(int(tag), l)
+		if s.err != nil {
+			return nil, fmt.Errorf("decode level: section %d: %w", tag, s.err)
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("decode level: %w", d.err)
+	}
+	return l, nil
+}
+
+// IsBinary reports whether data, or its first bytes, are a binary level
+func IsBinary(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(BinaryMagic))
+}
+
+// section decodes one section into the level; unknown ones are skipped
+func (d *decoder) section(tag int, l *Level) {
+	switch tag {
+	case sectionHeader:
+		l.Name, l.Difficulty, l.Mode = d.string(), d.string(), d.string()
+		l.GridSize = GridSize{Width: d.int(), Height: d.int()}
+	case sectionBlocks:
+		for n, i := d.count(&l.Blocks), 0; i < n && d.err == nil; i++ {
+			b := Block{X: d.int(), Y: d.int()}
+			b.Type, b.Special = d.symbol(BlockTypes), d.symbol(SpecialKinds)
+			l.Blocks = append(l.Blocks, b)
+		}
+	case sectionSpawns:
+		for n, i := d.count(&l.SpawnPoints), 0; i < n && d.err == nil; i++ {
+			l.SpawnPoints = append(l.SpawnPoints, Point{X: d.int(), Y: d.int()})
+		}
+		for n, i := d.length(), 0; i < n && d.err == nil; i++ {
+			l.SpawnZones = append(l.SpawnZones, d.zone())
+		}
+		if d.flag() {
+			z := d.zone()
+			l.GoalArea = &z
+		}
+	case sectionObjectives:
+		for n, i := d.length(), 0; i < n && d.err == nil; i++ {
+			l.Objectives = append(l.Objectives, Objective{Kind: d.string(), Target: d.int(), Shared: d.flag()})
+		}
+	case sectionPickups:
+		for n, i := d.length(), 0; i < n && d.err == nil; i++ {
+			l.Pickups = append(l.Pickups, Pickup{X: d.int(), Y: d.int(), Spell: d.string()})
+		}
+	case sectionPieces:
+		l.Pieces = &PieceSequence{Randomizer: d.string(), Seed: d.int64()}
+		for n, i := d.length(), 0; i < n && d.err == nil; i++ {
+			l.Pieces.Fixed = append(l.Pieces.Fixed, d.string())
+		}
+	case sectionHints:
+		for n, i := d.length(), 0; i < n && d.err == nil; i++ {
+			h := Hint{Trigger: d.string(), Text: d.string()}
+			if d.flag() {
+				h.Cell = &Point{X: d.int(), Y: d.int()}
+			}
+			l.Hints = append(l.Hints, h)
+		}
+	case sectionMetadata:
+		if n := d.length(); n > 0 {
+			l.Metadata = make(map[string]string, n)
+			for i := 0; i < n && d.err == nil; i++ {
+				k := d.string()
+				l.Metadata[k] = d.string()
+			}
+		}
+	case sectionRules:
+		for n, i := d.count(&l.SpecialRules), 0; i < n && d.err == nil; i++ {
+			k := d.string()
+			l.SpecialRules[k] = d.float()
+		}
+	case sectionSignature:
+		l.Signature = &Signature{KeyID: d.string(), Sig: []byte(d.string())}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encoder builds a section
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(v uint64) { e.buf = binary.AppendUvarint(e.buf, v) }
+
+func (e *encoder) int(vs ...int) {
+	for _, v := range vs {
+		e.buf = binary.AppendVarint(e.buf, int64(v))
+	}
+}
+
+func (e *encoder) float(f float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+func (e *encoder) flag(b bool) {
+	if b {
+		e.uint(1)
+	} else {
+		e.uint(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) strings(ss ...string) {
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+// count writes a list's length plus one, or 0 for an absent list
+func (e *encoder) count(n int, absent bool) {
+	if absent {
+		e.uint(0)
+		return
+	}
+	e.uint(uint64(n) + 1)
+}
+
+func (e *encoder) zone(z Zone) {
+	e.int(z.X, z.Y, z.Width, z.Height)
+}
+
+func (e *encoder) symbol(table []string, s string) {
+	for i, t := range table {
+		if t == s {
+			e.uint(uint64(i + 1))
+			return
+		}
+	}
+	e.uint(0)
+	e.string(s)
+}
+
+// decoder reads a section, keeping the first error; reads after it
+// answer zero values
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errTruncated = errors.New("truncated or malformed")
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errTruncated
+	}
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) int64() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) int() int {
+	return int(d.int64())
+}
+
+func (d *decoder) float() float64 {
+	if d.err != nil || len(d.buf) < 8 {
+		d.fail()
+		return 0
+	}
+	f := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return f
+}
+
+func (d *decoder) flag() bool {
+	return d.uint() != 0
+}
+
+func (d *decoder) string() string {
+	n := d.uint()
+	if d.err != nil || n > uint64(len(d.buf)) {
+		d.fail()
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+// length reads a list's length, no longer than the bytes left could hold
+func (d *decoder) length() int {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+// count reads a list's length written by encoder.count, making the list
+// or map empty rather than absent when it has none
+func (d *decoder) count(list any) int {
+	u := d.uint()
+	if u == 0 || d.err != nil {
+		return 0
+	}
+	if u-1 > uint64(len(d.buf)) {
+		d.fail()
+		return 0
+	}
+	n := int(u - 1)
+	switch l := list.(type) {
+	case *[]Block:
+		*l = make([]Block, 0, n)
+	case *[]Point:
+		*l = make([]Point, 0, n)
+	case *map[string]float64:
+		*l = make(map[string]float64, n)
+	}
+	return n
+}
+
+func (d *decoder) zone() Zone {
+	return Zone{X: d.int(), Y: d.int(), Width: d.int(), Height: d.int()}
+}
+
+func (d *decoder) symbol(table []string) string {
+	i := d.uint()
+	switch {
+	case d.err != nil:
+		return ""
+	case i == 0:
+		return d.string()
+	case i > uint64(len(table)):
+		d.fail()
+		return ""
+	}
+	return table[i-1]
+}
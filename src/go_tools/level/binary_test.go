@@ -0,0 +1,101 @@
+package level
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// full is a level with every field the format holds set
+func full() *Level {
+	l := New("full", 10, 20)
+	l.Difficulty, l.Mode = "hard", ModeCoop
+	l.Blocks = []Block{{Type: "I", X: 0, Y: 19}, {Type: "T", X: 3, Y: 18, Special: SpecialBomb}, {Type: "X", X: 4, Y: 18, Special: "glass"}}
+	l.SpawnPoints = []Point{{X: 4, Y: 0}, {X: -1, Y: 0}}
+	l.SpawnZones = []Zone{{X: 0, Y: 0, Width: 5, Height: 2}}
+	l.GoalArea = &Zone{X: 2, Y: 15, Width: 3, Height: 1}
+	l.Objectives = []Objective{{Kind: "lines", Target: 40, Shared: true}}
+	l.Pickups = []Pickup{{Spell: "freeze", X: 6, Y: 10}}
+	l.Pieces = &PieceSequence{Randomizer: "bag7", Seed: -42, Fixed: []string{"I", "O"}}
+	l.Hints = []Hint{{Trigger: "start", Text: "Привет"}, {Trigger: "pickup", Text: "grab it", Cell: &Point{X: 6, Y: 10}}}
+	l.Metadata = map[string]string{"experiment": "e1", "arm": "b"}
+	l.SpecialRules = map[string]float64{"gravity": 1.5, "hold": 0}
+	return l
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	bare := New("bare", 4, 4)
+	bare.Blocks, bare.SpecialRules = nil, nil
+	for _, l := range []*Level{full(), bare} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, l); err != nil {
+			t.Fatal(err)
+		}
+		if !IsBinary(buf.Bytes()) {
+			t.Fatal("encoded level doesn't start with the magic")
+		}
+		got, err := Parse(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, l) {
+			t.Errorf("decoded\n%+v, want\n%+v", got, l)
+		}
+		a, _ := l.Marshal()
+		b, _ := got.Marshal()
+		if !bytes.Equal(a, b) {
+			t.Errorf("decoded level marshals as\n%s, want\n%s", b, a)
+		}
+	}
+}
+
+func TestBinarySmaller(t *testing.T) {
+	l := New("big", 40, 200)
+	for y := 100; y < 200; y++ {
+		for x := 0; x < 40; x++ {
+			if (x+y)%7 != 0 {
+				l.Blocks = append(l.Blocks, Block{Type: BlockTypes[(x*y)%len(BlockTypes)], X: x, Y: y})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, l); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := l.Marshal()
+	if buf.Len()*10 > len(data) {
+		t.Errorf("binary level of %d bytes, its JSON %d", buf.Len(), len(data))
+	}
+}
+
+func TestBinarySave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "full"+BinaryExt)
+	if err := full().Save(path); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l, full()) {
+		t.Errorf("loaded %+v", l)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	Encode(&buf, full())
+	data := buf.Bytes()
+	for n := len(BinaryMagic); n < len(data); n += 7 {
+		if _, err := Decode(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("no error decoding %d of %d bytes", n, len(data))
+		}
+	}
+	newer := append([]byte(BinaryMagic), binary.AppendUvarint(nil, BinaryVersion+1)...)
+	if _, err := Decode(bytes.NewReader(newer)); !errors.Is(err, ErrBinaryVersion) {
+		t.Errorf("newer version: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package level
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+)
+
+// CurrentFormat is the level format this build reads and writes. Levels
+// of an older one are migrated up to it as they're parsed; Save writes it.
+const CurrentFormat = 1
+
+// Migration upgrades the JSON of a level of format From to From+1
+type Migration struct {
+	From    int
+	Summary string
+	Apply   func(raw map[string]any) error
+}
+
+// Migrations are the format's upgrades in order, the one from format n at
+// index n. A change to the format that old levels won't load as adds one
+// here and bumps CurrentFormat.
+var Migrations = []Migration{
+	{From: 0, Summary: "stamp the format; lists and rules left out or null become empty", Apply: migrateUnversioned},
+}
+
+// migrateUnversioned upgrades the Python editor's and generator's levels,
+// which have no format and which hand edits and older tools left blocks,
+// spawn points or special rules out of, or null, where the Python
+// validator wants them there
+func migrateUnversioned(raw map[string]any) error {
+	for _, key := range []string{"blocks", "spawn_points"} {
+		if raw[key] == nil {
+			raw[key] = []any{}
+		}
+	}
+	if raw["special_rules"] == nil {
+		raw["special_rules"] = map[string]any{}
+	}
+	return nil
+}
+
+// FormatOf is the format of a level's JSON, 0 for a level from before
+// there was one
+func FormatOf(data []byte) (int, error) {
+	var v struct {
+		Format int `json:"format"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return 0, err
+	}
+	return v.Format, nil
+}
+
+// Parse reads a level from JSON, migrating it up to CurrentFormat first,
+// or from the binary format
+func Parse(data []byte) (*Level, error) {
+	if IsBinary(data) {
+		return Decode(bytes.NewReader(data))
+	}
+	format, err := FormatOf(data)
+	if err != nil {
+		return nil, err
+	}
+	if format != CurrentFormat {
+		if data, _, err = Migrate(data); err != nil {
+			return nil, err
+		}
+	}
+	var l Level
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Migrate upgrades a level's JSON to CurrentFormat, returning it and the
+// format it was. A level of a newer format than this build's is an error.
+func Migrate(data []byte) ([]byte, int, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, 0, err
+	}
+	from, err := FormatOf(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	name, _ := raw["name"].(string)
+	if from < 0 || from > CurrentFormat {
+		return nil, from, i18n.Errorf("level.format_unknown", name, from, CurrentFormat)
+	}
+	for _, m := range Migrations[from:] {
+		if err := m.Apply(raw); err != nil {
+			return nil, from, i18n.Errorf("level.migration", name, m.From, m.From+1, err)
+		}
+		raw["format"] = m.From + 1
+	}
+	out, err := json.Marshal(raw)
+	return out, from, err
+}
+
+// Change is a value a migration added, removed or changed, by its path in
+// the level's JSON
+type Change struct {
+	Path   string
+	Before string // JSON; empty when added
+	After  string // JSON; empty when removed
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Before == "":
+		return fmt.Sprintf("+ %s: %s", c.Path, c.After)
+	case c.After == "":
+		return fmt.Sprintf("- %s: %s", c.Path, c.Before)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.Before, c.After)
+	}
+}
+
+// Diff is what differs between two JSON documents, value by value, in
+// path order
+func Diff(before, after []byte) ([]Change, error) {
+	var a, b any
+	if err := json.Unmarshal(before, &a); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &b); err != nil {
+		return nil, err
+	}
+	var changes []Change
+	diffValues(&changes, "", a, b)
+	return changes, nil
+}
+
+func diffValues(changes *[]Change, path string, a, b any) {
+	ma, okA := a.(map[string]any)
+	mb, okB := b.(map[string]any)
+	if okA && okB {
+		keys := make([]string, 0, len(ma)+len(mb))
+		for k := range ma {
+			keys = append(keys, k)
+		}
+		for k := range mb {
+			if _, ok := ma[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			va, inA := ma[k]
+			vb, inB := mb[k]
+			switch {
+			case !inA:
+				*changes = append(*changes, Change{Path: p, After: jsonOf(vb)})
+			case !inB:
+				*changes = append(*changes, Change{Path: p, Before: jsonOf(va)})
+			default:
+				diffValues(changes, p, va, vb)
+			}
+		}
+		return
+	}
+	sa, okA := a.([]any)
+	sb, okB := b.([]any)
+	if okA && okB && len(sa) > 0 && len(sb) > 0 {
+		for i := 0; i < max(len(sa), len(sb)); i++ {
+			p := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(sa):
+				*changes = append(*changes, Change{Path: p, After: jsonOf(sb[i])})
+			case i >= len(sb):
+				*changes = append(*changes, Change{Path: p, Before: jsonOf(sa[i])})
+			default:
+				diffValues(changes, p, sa[i], sb[i])
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, Change{Path: path, Before: jsonOf(a), After: jsonOf(b)})
+	}
+}
+
+func jsonOf(v any) string {
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
@@ -0,0 +1,97 @@
+package level
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+)
+
+// unversioned is a level as the Python generator wrote them before the
+// format, with a field this build doesn't know
+const unversioned = `{
+  "name": "old",
+  "difficulty": "easy",
+  "grid_size": {"width": 4, "height": 6},
+  "blocks": [{"type": "I", "x": 1, "y": 5}],
+  "spawn_points": null,
+  "author": "someone"
+}`
+
+func TestMigrate(t *testing.T) {
+	if len(Migrations) != CurrentFormat {
+		t.Fatalf("%d migrations up to format %d", len(Migrations), CurrentFormat)
+	}
+	for i, m := range Migrations {
+		if m.From != i {
+			t.Errorf("migration %d is from format %d", i, m.From)
+		}
+	}
+
+	out, from, err := Migrate([]byte(unversioned))
+	if err != nil || from != 0 {
+		t.Fatalf("from %d: %v", from, err)
+	}
+	l, err := Parse(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Format != CurrentFormat || l.SpawnPoints == nil || l.SpecialRules == nil || len(l.Blocks) != 1 {
+		t.Errorf("migrated %+v", l)
+	}
+	saved, err := l.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := Diff([]byte(unversioned), saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Path: "author", Before: `"someone"`},
+		{Path: "format", After: "1"},
+		{Path: "spawn_points", Before: "null", After: "[]"},
+		{Path: "special_rules", After: "{}"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes\n%v, want\n%v", changes, want)
+	}
+	if s := want[2].String(); s != "~ spawn_points: null -> []" {
+		t.Errorf("change reads %q", s)
+	}
+
+	if _, _, err := Migrate([]byte(`{"format": 99, "name": "new"}`)); err == nil {
+		t.Error("no error migrating a format newer than this build's")
+	}
+}
+
+func TestLoadMigrates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.json")
+	if err := os.WriteFile(path, []byte(unversioned), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := l.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if f, err := FormatOf(data); err != nil || f != CurrentFormat {
+		t.Errorf("saved as format %d: %v", f, err)
+	}
+
+	os.WriteFile(path, []byte(`{"format": 99, "name": "new"}`), 0o644)
+	_, err = Load(path)
+	var e *i18n.Error
+	if !errors.As(err, &e) || e.Key != "level.parse" {
+		t.Errorf("loading a newer format: %v", err)
+	}
+}
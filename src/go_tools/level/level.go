@@ -0,0 +1,293 @@
+package level
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/i18n"
+)
+
+// Block types
+var BlockTypes = []string{"I", "J", "L", "O", "S", "T", "Z"}
+
+// Special block kinds
+const (
+	SpecialBomb  = "bomb"
+	SpecialIce   = "ice"
+	SpecialHeavy = "heavy"
+)
+
+// SpecialKinds lists every special block kind the game understands
+var SpecialKinds = []string{SpecialBomb, SpecialIce, SpecialHeavy}
+
+// GridSize represents the playfield dimensions in cells
+type GridSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Point represents a cell position; y grows downwards from the spawn row
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Block represents a single pre-placed cell of terrain
+type Block struct {
+	Type    string `json:"type"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Special string `json:"special,omitempty"`
+}
+
+// Pickup represents a spell pickup placed in an empty cell
+type Pickup struct {
+	Spell string `json:"spell"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+}
+
+// Zone represents a rectangular area of the board
+type Zone struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Contains reports whether the cell lies inside the zone
+func (z Zone) Contains(x, y int) bool {
+	return x >= z.X && x < z.X+z.Width && y >= z.Y && y < z.Y+z.Height
+}
+
+// Objective represents a goal players must complete to finish the level
+type Objective struct {
+	Kind   string `json:"kind"`
+	Target int    `json:"target"`
+	Shared bool   `json:"shared,omitempty"` // progress is pooled across players
+}
+
+// PieceSequence describes how a level deals its pieces, overriding the
+// tools' default randomizer
+type PieceSequence struct {
+	Randomizer string   `json:"randomizer,omitempty"` // bag7, bag14, classic or history
+	Seed       int64    `json:"seed,omitempty"`
+	Fixed      []string `json:"fixed,omitempty"` // dealt first, used by puzzle levels
+}
+
+// Hint is a tutorial message the client shows when its trigger fires,
+// optionally pointing at a cell
+type Hint struct {
+	Trigger string `json:"trigger"` // start, first_piece, pickup, clear, special
+	Text    string `json:"text"`
+	Cell    *Point `json:"cell,omitempty"`
+}
+
+// Level modes
+const (
+	ModeStandard  = "standard"
+	ModeCoop      = "coop"
+	ModeMirror    = "mirror"    // versus board whose right half mirrors the left
+	ModeIdentical = "identical" // versus board whose right half repeats the left
+	ModeTutorial  = "tutorial"
+	ModePhysics   = "physics" // blocks fall, stack and topple as boxes rather than on the grid
+)
+
+// Level represents a level in the same JSON layout the Python editor uses
+type Level struct {
+	Format       int                `json:"format"` // CurrentFormat once parsed
+	Name         string             `json:"name"`
+	Difficulty   string             `json:"difficulty"`
+	Mode         string             `json:"mode,omitempty"`
+	GridSize     GridSize           `json:"grid_size"`
+	Blocks       []Block            `json:"blocks"`
+	SpawnPoints  []Point            `json:"spawn_points"`
+	SpawnZones   []Zone             `json:"spawn_zones,omitempty"`
+	GoalArea     *Zone              `json:"goal_area,omitempty"`
+	Objectives   []Objective        `json:"objectives,omitempty"`
+	Pickups      []Pickup           `json:"pickups,omitempty"`
+	Pieces       *PieceSequence     `json:"piece_sequence,omitempty"`
+	Hints        []Hint             `json:"hints,omitempty"`
+	Metadata     map[string]string  `json:"metadata,omitempty"`
+	SpecialRules map[string]float64 `json:"special_rules"`
+	Signature    *Signature         `json:"signature,omitempty"` // see Sign
+}
+
+// New returns an empty level with the given dimensions
+func New(name string, width, height int) *Level {
+	return &Level{
+		Format:       CurrentFormat,
+		Name:         name,
+		GridSize:     GridSize{Width: width, Height: height},
+		Blocks:       []Block{},
+		SpawnPoints:  []Point{},
+		SpecialRules: map[string]float64{},
+	}
+}
+
+// InBounds reports whether the cell lies inside the playfield
+func (l *Level) InBounds(x, y int) bool {
+	return x >= 0 && x < l.GridSize.Width && y >= 0 && y < l.GridSize.Height
+}
+
+// Occupancy returns a height-major grid marking cells covered by blocks
+func (l *Level) Occupancy() [][]bool {
+	grid := make([][]bool, l.GridSize.Height)
+	for y := range grid {
+		grid[y] = make([]bool, l.GridSize.Width)
+	}
+	for _, b := range l.Blocks {
+		if l.InBounds(b.X, b.Y) {
+			grid[b.Y][b.X] = true
+		}
+	}
+	return grid
+}
+
+// Validate checks that every block and pickup is in bounds and that no two
+// objects share a cell
+func (l *Level) Validate() error {
+	if l.GridSize.Width <= 0 || l.GridSize.Height <= 0 {
+		return i18n.Errorf("level.grid_size", l.Name, l.GridSize.Width, l.GridSize.Height)
+	}
+	used := make(map[Point]i18n.Message)
+	for _, b := range l.Blocks {
+		p := Point{b.X, b.Y}
+		if !l.InBounds(b.X, b.Y) {
+			return i18n.Errorf("level.block_out_of_bounds", l.Name, b.X, b.Y)
+		}
+		if what, ok := used[p]; ok {
+			return i18n.Errorf("level.block_overlaps", l.Name, b.X, b.Y, what)
+		}
+		used[p] = i18n.M("level.a_block")
+	}
+	for _, pk := range l.Pickups {
+		p := Point{pk.X, pk.Y}
+		if !l.InBounds(pk.X, pk.Y) {
+			return i18n.Errorf("level.pickup_out_of_bounds", l.Name, pk.X, pk.Y)
+		}
+		if what, ok := used[p]; ok {
+			return i18n.Errorf("level.pickup_overlaps", l.Name, pk.X, pk.Y, what)
+		}
+		if _, ok := SpellCategories[pk.Spell]; !ok {
+			return i18n.Errorf("level.unknown_spell", l.Name, pk.Spell)
+		}
+		used[p] = i18n.M("level.a_pickup")
+	}
+	if l.Pieces != nil {
+		for i, p := range l.Pieces.Fixed {
+			if !IsBlockType(p) {
+				return i18n.Errorf("level.unknown_fixed_piece", l.Name, i, p)
+			}
+		}
+	}
+	for i, h := range l.Hints {
+		if h.Cell != nil && !l.InBounds(h.Cell.X, h.Cell.Y) {
+			return i18n.Errorf("level.hint_outside", l.Name, i)
+		}
+	}
+	for _, sp := range l.SpawnPoints {
+		if !l.InBounds(sp.X, sp.Y) {
+			return i18n.Errorf("level.spawn_out_of_bounds", l.Name, sp.X, sp.Y)
+		}
+	}
+	return nil
+}
+
+// IsBlockType reports whether t is one of the seven piece types
+func IsBlockType(t string) bool {
+	for _, b := range BlockTypes {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFile reports whether name is a level file's, JSON or binary
+func IsFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".json" || ext == BinaryExt
+}
+
+// ErrNoFiles is the error of Files for a directory without level files
+var ErrNoFiles = errors.New("no level files")
+
+// Files are the level files at path: the file itself, or the level files
+// under a directory but hidden ones and those named skip, such as batch
+// manifests
+func Files(path string, skip ...string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if p != path && strings.HasPrefix(name, ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && IsFile(name) && !slices.Contains(skip, name) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err == nil && len(files) == 0 {
+		err = fmt.Errorf("%s: %w", path, ErrNoFiles)
+	}
+	return files, err
+}
+
+// Load reads a level from a JSON or binary file, migrating it up to
+// CurrentFormat as Parse does
+func Load(path string) (*Level, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l, err := Parse(data)
+	if err != nil {
+		return nil, i18n.Errorf("level.parse", path, err)
+	}
+	return l, nil
+}
+
+// Marshal is the level's JSON as Save writes it, in CurrentFormat
+func (l *Level) Marshal() ([]byte, error) {
+	c := *l
+	c.Format = CurrentFormat
+	return json.MarshalIndent(&c, "", "  ")
+}
+
+// Save writes the level to a JSON file, or in the binary format to a path
+// ending in BinaryExt
+func (l *Level) Save(path string) error {
+	if filepath.Ext(path) == BinaryExt {
+		var buf bytes.Buffer
+		if err := Encode(&buf, l); err != nil {
+			return err
+		}
+		return os.WriteFile(path, buf.Bytes(), 0644)
+	}
+	data, err := l.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,41 @@
+package level
+
+// Reachable reports whether any empty cell of the goal zone can be reached
+// from an empty cell of the start zone through empty cells, stepping down,
+// left or right as a falling piece moves; a cell under an overhang that
+// can only be got at from below isn't reachable
+func (l *Level) Reachable(start, goal Zone) bool {
+	grid := l.Occupancy()
+	width, height := l.GridSize.Width, l.GridSize.Height
+	visited := make([][]bool, height)
+	for y := range visited {
+		visited[y] = make([]bool, width)
+	}
+
+	var queue []Point
+	for y := start.Y; y < start.Y+start.Height; y++ {
+		for x := start.X; x < start.X+start.Width; x++ {
+			if l.InBounds(x, y) && !grid[y][x] {
+				visited[y][x] = true
+				queue = append(queue, Point{x, y})
+			}
+		}
+	}
+
+	steps := []Point{{1, 0}, {-1, 0}, {0, 1}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if goal.Contains(p.X, p.Y) {
+			return true
+		}
+		for _, s := range steps {
+			nx, ny := p.X+s.X, p.Y+s.Y
+			if l.InBounds(nx, ny) && !grid[ny][nx] && !visited[ny][nx] {
+				visited[ny][nx] = true
+				queue = append(queue, Point{nx, ny})
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package level
+
+import "testing"
+
+func TestReachableNeverStepsUp(t *testing.T) {
+	// A ledge over the left two columns, walled on the right of its first
+	// cell: the cell under it opens only onto the floor below
+	//   . . .
+	//   # # .
+	//   g # .
+	//   . . .
+	l := New("overhang", 3, 4)
+	l.Blocks = []Block{{Type: "I", X: 0, Y: 1}, {Type: "I", X: 1, Y: 1}, {Type: "I", X: 1, Y: 2}}
+	top := Zone{X: 0, Y: 0, Width: 3, Height: 1}
+	cell := func(x, y int) Zone { return Zone{X: x, Y: y, Width: 1, Height: 1} }
+
+	if l.Reachable(top, cell(0, 2)) {
+		t.Error("the sealed cell under the overhang was reached")
+	}
+	for _, p := range []Point{{2, 2}, {0, 3}, {1, 3}} {
+		if !l.Reachable(top, cell(p.X, p.Y)) {
+			t.Errorf("cell %v, open from above, wasn't reached", p)
+		}
+	}
+	if l.Reachable(cell(0, 3), top) {
+		t.Error("the top was reached from the floor")
+	}
+}
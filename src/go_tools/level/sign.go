@@ -0,0 +1,79 @@
+package level
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Errors Verify returns
+var (
+	ErrUnsigned   = errors.New("level is unsigned")
+	ErrUnknownKey = errors.New("level is signed by an unknown key")
+	ErrTampered   = errors.New("level was modified after it was signed")
+)
+
+// Signature is an Ed25519 signature of a level's content, what Hash sums,
+// so changing anything but the signature breaks it, whichever format the
+// level is in
+type Signature struct {
+	KeyID string `json:"keyId"`
+	Sig   []byte `json:"sig"`
+}
+
+// Verifier finds the public keys signatures name, as replay.Keys does
+type Verifier interface {
+	PublicKey(id string) (ed25519.PublicKey, bool)
+}
+
+// content is what a level's hash and signature cover: its JSON in
+// CurrentFormat without the signature
+func (l *Level) content() ([]byte, error) {
+	c := *l
+	c.Format, c.Signature = CurrentFormat, nil
+	return json.Marshal(&c)
+}
+
+// Hash is the hex SHA-256 of the level's content, the same for the level
+// as JSON or binary and for a signed level and its unsigned original
+func (l *Level) Hash() (string, error) {
+	data, err := l.content()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sign signs the level with the private key of ID id, replacing any
+// signature it had
+func (l *Level) Sign(id string, key ed25519.PrivateKey) error {
+	data, err := l.content()
+	if err != nil {
+		return err
+	}
+	l.Signature = &Signature{KeyID: id, Sig: ed25519.Sign(key, data)}
+	return nil
+}
+
+// Verify checks that one of the keys signed the level as it is
+func (l *Level) Verify(keys Verifier) error {
+	if l.Signature == nil {
+		return fmt.Errorf("level %q: %w", l.Name, ErrUnsigned)
+	}
+	pub, ok := keys.PublicKey(l.Signature.KeyID)
+	if !ok {
+		return fmt.Errorf("level %q: %w %s", l.Name, ErrUnknownKey, l.Signature.KeyID)
+	}
+	data, err := l.content()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, data, l.Signature.Sig) {
+		return fmt.Errorf("level %q: %w", l.Name, ErrTampered)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package level
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+// keyring is a Verifier of the keys by ID
+type keyring map[string]ed25519.PublicKey
+
+func (k keyring) PublicKey(id string) (ed25519.PublicKey, bool) {
+	pub, ok := k[id]
+	return pub, ok
+}
+
+func TestSignAndVerify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	keys := keyring{"k1": pub}
+	l := full()
+	unsigned, _ := l.Hash()
+	if err := l.Verify(keys); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned: %v", err)
+	}
+	if err := l.Sign("k1", priv); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Verify(keys); err != nil {
+		t.Errorf("signed: %v", err)
+	}
+	if h, _ := l.Hash(); h != unsigned {
+		t.Errorf("hash changed by signing: %s, was %s", h, unsigned)
+	}
+	if err := l.Verify(keyring{}); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown key: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, l); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Verify(keys); err != nil {
+		t.Errorf("signature lost to the binary format: %v", err)
+	}
+	if h, _ := decoded.Hash(); h != unsigned {
+		t.Errorf("binary level hashes as %s, JSON %s", h, unsigned)
+	}
+
+	l.Blocks[0].X++
+	if err := l.Verify(keys); !errors.Is(err, ErrTampered) {
+		t.Errorf("tampered: %v", err)
+	}
+}
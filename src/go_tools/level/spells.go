@@ -0,0 +1,44 @@
+package level
+
+// Spell types, matching SpellType in the TypeScript client
+const (
+	SpellClearLine    = "CLEAR_LINE"
+	SpellSwapPieces   = "SWAP_PIECES"
+	SpellSlowDown     = "SLOW_DOWN"
+	SpellSpeedUp      = "SPEED_UP"
+	SpellAddBlocks    = "ADD_BLOCKS"
+	SpellRemoveBlocks = "REMOVE_BLOCKS"
+	SpellGravityFlip  = "GRAVITY_FLIP"
+	SpellFreeze       = "FREEZE"
+)
+
+// Spell categories used for balance rules
+const (
+	CategoryOffense = "offense"
+	CategoryDefense = "defense"
+	CategoryUtility = "utility"
+)
+
+// Spells lists every spell in a stable order
+var Spells = []string{
+	SpellClearLine,
+	SpellSwapPieces,
+	SpellSlowDown,
+	SpellSpeedUp,
+	SpellAddBlocks,
+	SpellRemoveBlocks,
+	SpellGravityFlip,
+	SpellFreeze,
+}
+
+// SpellCategories maps each spell to its balance category
+var SpellCategories = map[string]string{
+	SpellClearLine:    CategoryDefense,
+	SpellSwapPieces:   CategoryUtility,
+	SpellSlowDown:     CategoryDefense,
+	SpellSpeedUp:      CategoryOffense,
+	SpellAddBlocks:    CategoryOffense,
+	SpellRemoveBlocks: CategoryDefense,
+	SpellGravityFlip:  CategoryOffense,
+	SpellFreeze:       CategoryOffense,
+}
@@ -0,0 +1,124 @@
+package livesync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+// Client is a peer of a session, an editor or a game
+type Client struct {
+	Name    string
+	Role    string
+	Session string
+
+	conn *websocket.Conn
+	wmu  sync.Mutex
+}
+
+// Dial joins the session at the hub at baseURL, such as
+// http://host:8102, as name in role. The token of auth.TokenEnv, if set,
+// is presented to the hub.
+func Dial(ctx context.Context, baseURL, session, role, name string) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/sessions/" + url.PathEscape(session))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = url.Values{"role": {role}, "name": {name}}.Encode()
+	header := http.Header{}
+	auth.SetHeader(header, os.Getenv(auth.TokenEnv))
+	conn, err := certs.Dial(ctx, u.String(), header)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Name: name, Role: role, Session: session, conn: conn}, nil
+}
+
+// Close leaves the session
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Send sends a message to the hub
+func (c *Client) Send(m Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Load pushes the whole level to the session's games, as an editor
+func (c *Client) Load(lvl *level.Level) error {
+	return c.Send(Message{Type: TypeLoad, Level: lvl})
+}
+
+// Patch pushes changes to the level at revision base, as an editor
+func (c *Client) Patch(base int, ops ...Op) error {
+	return c.Send(Message{Type: TypePatch, Base: base, Ops: ops})
+}
+
+// Capture asks the game named, or every game, for a snapshot, as an
+// editor
+func (c *Client) Capture(game string) error {
+	return c.Send(Message{Type: TypeCapture, To: game})
+}
+
+// SendSnapshot sends the editors the board, as a game
+func (c *Client) SendSnapshot(s *Snapshot) error {
+	return c.Send(Message{Type: TypeSnapshot, Snapshot: s})
+}
+
+// Resync asks the hub for the level again, as a game that lost track
+func (c *Client) Resync() error {
+	return c.Send(Message{Type: TypeResync})
+}
+
+// Recv waits for the next message, until ctx's deadline if it has one
+func (c *Client) Recv(ctx context.Context) (Message, error) {
+	deadline, _ := ctx.Deadline()
+	c.conn.SetReadDeadline(deadline)
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		if ctx.Err() != nil {
+			return Message{}, ctx.Err()
+		}
+		return Message{}, err
+	}
+	var m Message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Message{}, fmt.Errorf("livesync: %w", err)
+	}
+	return m, nil
+}
+
+// Await receives until a message of one of the types, skipping others.
+// An error message ends the wait as an error.
+func (c *Client) Await(ctx context.Context, types ...string) (Message, error) {
+	for {
+		m, err := c.Recv(ctx)
+		if err != nil {
+			return Message{}, err
+		}
+		for _, t := range types {
+			if m.Type == t {
+				return m, nil
+			}
+		}
+		if m.Type == TypeError {
+			return m, fmt.Errorf("livesync: %s", m.Error)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package livesync
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+// Defaults for Options left zero
+const (
+	DefaultQueueSize = 64
+	DefaultReadLimit = 4 << 20 // a large level with its metadata
+)
+
+// Options tune a hub
+type Options struct {
+	QueueSize int   // messages waiting for a peer before it's dropped as too slow
+	ReadLimit int64 // of a message
+}
+
+// Hub joins editors and games in sessions:
+//
+//	GET /sessions                  sessions, their revisions and peers
+//	GET /sessions/{name}           one session, with its level
+//	GET /sessions/{name}?role=R    as a WebSocket handshake, joins as editor or game
+//
+// A peer names itself with &name=NAME, unique in the session. The hub
+// keeps the session's level: an editor's load replaces it and a patch
+// changes it, each making the next revision, which the editor is acked
+// and every game is sent. A patch must apply to the current revision, and
+// the level it makes must validate, or the editor is sent a reject and
+// should load again. A game joining, or sending resync, is sent the level
+// as a load. Captures go to the games, or to the one named by to, and
+// their snapshots to every editor. A session ends when its last peer
+// leaves.
+type Hub struct {
+	opts Options
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session is a level's editors and games
+type session struct {
+	name    string
+	created time.Time
+	level   *level.Level
+	rev     int
+	peers   []*peer
+}
+
+type peer struct {
+	name   string
+	role   string
+	joined time.Time
+	send   chan Message
+}
+
+// Session describes a session
+type Session struct {
+	Name    string       `json:"name"`
+	Created time.Time    `json:"created"`
+	Rev     int          `json:"rev"`
+	Level   *level.Level `json:"level,omitempty"`
+	Editors []string     `json:"editors"`
+	Games   []string     `json:"games"`
+}
+
+// NewHub returns a hub with no sessions
+func NewHub(opts Options) *Hub {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.ReadLimit <= 0 {
+		opts.ReadLimit = DefaultReadLimit
+	}
+	return &Hub{opts: opts, sessions: make(map[string]*session)}
+}
+
+// Sessions describes the sessions, without their levels
+func (h *Hub) Sessions() []Session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := []Session{}
+	for _, s := range h.sessions {
+		d := s.describe()
+		d.Level = nil
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (s *session) describe() Session {
+	editors, games := s.names()
+	return Session{Name: s.name, Created: s.created, Rev: s.rev, Level: s.level, Editors: editors, Games: games}
+}
+
+// names are the session's editors and games, in the order they joined
+func (s *session) names() (editors, games []string) {
+	editors, games = []string{}, []string{}
+	for _, p := range s.peers {
+		if p.role == RoleEditor {
+			editors = append(editors, p.name)
+		} else {
+			games = append(games, p.name)
+		}
+	}
+	return editors, games
+}
+
+// ServeHTTP routes the request
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "sessions" || len(parts) > 2 {
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if len(parts) == 1 {
+		writeJSON(w, http.StatusOK, h.Sessions())
+		return
+	}
+	name := parts[1]
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		h.join(w, r, name)
+		return
+	}
+	h.mu.Lock()
+	s, ok := h.sessions[name]
+	var desc Session
+	if ok {
+		desc = s.describe()
+	}
+	h.mu.Unlock()
+	if !ok {
+		httpError(w, http.StatusNotFound, "no session %s", name)
+		return
+	}
+	writeJSON(w, http.StatusOK, desc)
+}
+
+// join upgrades the request and serves the peer until it goes
+func (h *Hub) join(w http.ResponseWriter, r *http.Request, name string) {
+	q := r.URL.Query()
+	p := &peer{name: q.Get("name"), role: q.Get("role"), joined: time.Now(), send: make(chan Message, h.opts.QueueSize)}
+	if p.role != RoleEditor && p.role != RoleGame {
+		httpError(w, http.StatusBadRequest, "role %q is not %s or %s", p.role, RoleEditor, RoleGame)
+		return
+	}
+	if p.name == "" {
+		p.name = r.RemoteAddr
+	}
+	if err := h.admit(name, p.name); err != nil {
+		httpError(w, http.StatusConflict, "%v", err)
+		return
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	conn.ReadLimit = h.opts.ReadLimit
+	if err := h.add(name, p); err != nil {
+		// another peer took the name since admit
+		conn.Close()
+		return
+	}
+
+	written := make(chan struct{})
+	crash.Go(func() {
+		defer close(written)
+		for m := range p.send {
+			data, err := json.Marshal(m)
+			if err != nil || conn.WriteMessage(websocket.TextMessage, data) != nil {
+				break
+			}
+		}
+		conn.Close()
+	})
+	for {
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var m Message
+		if op != websocket.TextMessage || json.Unmarshal(data, &m) != nil {
+			h.reply(name, p, Message{Type: TypeError, Error: "not a JSON text message"})
+			continue
+		}
+		h.handle(name, p, m)
+	}
+	h.leave(name, p)
+	<-written
+}
+
+func (h *Hub) admit(name, peerName string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.sessions[name]; ok && s.peer(peerName) != nil {
+		return fmt.Errorf("session %s already has a peer %s", name, peerName)
+	}
+	return nil
+}
+
+func (s *session) peer(name string) *peer {
+	for _, p := range s.peers {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (h *Hub) add(name string, p *peer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.sessions[name]
+	if !ok {
+		s = &session{name: name, created: time.Now()}
+		h.sessions[name] = s
+	}
+	if s.peer(p.name) != nil {
+		return fmt.Errorf("session %s already has a peer %s", name, p.name)
+	}
+	s.peers = append(s.peers, p)
+	editors, games := s.names()
+	h.queue(s, p, Message{Type: TypeWelcome, Session: name, Rev: s.rev, Editors: editors, Games: games})
+	if p.role == RoleGame && s.level != nil {
+		h.queue(s, p, Message{Type: TypeLoad, Session: name, Rev: s.rev, Level: s.level})
+	}
+	h.broadcastPeers(s)
+	return nil
+}
+
+func (h *Hub) leave(name string, p *peer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.sessions[name]; ok {
+		h.remove(s, p)
+	}
+}
+
+// remove takes p out of s, ending s when it was the last. h.mu is held.
+func (h *Hub) remove(s *session, p *peer) {
+	i := -1
+	for j, q := range s.peers {
+		if q == p {
+			i = j
+		}
+	}
+	if i < 0 {
+		return
+	}
+	s.peers = append(s.peers[:i], s.peers[i+1:]...)
+	close(p.send)
+	if len(s.peers) == 0 {
+		delete(h.sessions, s.name)
+		return
+	}
+	h.broadcastPeers(s)
+}
+
+// broadcastPeers tells everyone in s who is. h.mu is held.
+func (h *Hub) broadcastPeers(s *session) {
+	editors, games := s.names()
+	h.broadcast(s, "", Message{Type: TypePeers, Session: s.name, Rev: s.rev, Editors: editors, Games: games})
+}
+
+// handle acts on a message from p
+func (h *Hub) handle(name string, from *peer, m Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.sessions[name]
+	if !ok {
+		return
+	}
+	m.Session, m.From = name, from.name
+	fail := func(format string, args ...any) {
+		h.queue(s, from, Message{Type: TypeError, Session: name, Rev: s.rev, Error: fmt.Sprintf(format, args...)})
+	}
+	editorOnly := map[string]bool{TypeLoad: true, TypePatch: true, TypeCapture: true}
+	gameOnly := map[string]bool{TypeSnapshot: true, TypeResync: true}
+	switch {
+	case editorOnly[m.Type] && from.role != RoleEditor, gameOnly[m.Type] && from.role != RoleGame:
+		fail("a %s can't send %s", from.role, m.Type)
+		return
+	}
+
+	switch m.Type {
+	case TypeLoad:
+		if m.Level == nil {
+			fail("load without a level")
+			return
+		}
+		if err := m.Level.Validate(); err != nil {
+			fail("%v", err)
+			return
+		}
+		s.rev++
+		s.level = m.Level
+		h.queue(s, from, Message{Type: TypeAck, Session: name, Rev: s.rev})
+		h.toGames(s, "", Message{Type: TypeLoad, Session: name, From: from.name, Rev: s.rev, Level: s.level})
+	case TypePatch:
+		reject := func(format string, args ...any) {
+			h.queue(s, from, Message{Type: TypeReject, Session: name, Base: m.Base, Rev: s.rev, Error: fmt.Sprintf(format, args...)})
+		}
+		switch {
+		case s.level == nil:
+			reject("the session has no level to patch; load one")
+			return
+		case m.Base != s.rev:
+			reject("patch of revision %d, the session is at %d", m.Base, s.rev)
+			return
+		}
+		patched, err := Apply(s.level, m.Ops)
+		if err != nil {
+			reject("%v", err)
+			return
+		}
+		s.rev++
+		s.level = patched
+		h.queue(s, from, Message{Type: TypeAck, Session: name, Rev: s.rev})
+		h.toGames(s, "", Message{Type: TypePatch, Session: name, From: from.name, Base: m.Base, Rev: s.rev, Ops: m.Ops})
+	case TypeCapture:
+		if m.To != "" {
+			if p := s.peer(m.To); p == nil || p.role != RoleGame {
+				fail("no game %s in the session", m.To)
+				return
+			}
+		}
+		h.toGames(s, m.To, Message{Type: TypeCapture, Session: name, From: from.name, To: m.To})
+	case TypeSnapshot:
+		if m.Snapshot == nil {
+			fail("snapshot without a board")
+			return
+		}
+		h.broadcast(s, RoleEditor, Message{Type: TypeSnapshot, Session: name, From: from.name, Rev: m.Snapshot.Rev, Snapshot: m.Snapshot})
+	case TypeResync:
+		if s.level == nil {
+			fail("the session has no level yet")
+			return
+		}
+		h.queue(s, from, Message{Type: TypeLoad, Session: name, Rev: s.rev, Level: s.level})
+	default:
+		fail("unknown message type %q", m.Type)
+	}
+}
+
+// reply queues m for p if it's still in the session
+func (h *Hub) reply(name string, p *peer, m Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.sessions[name]; ok {
+		m.Session = name
+		h.queue(s, p, m)
+	}
+}
+
+// toGames queues m for the session's games, or the one named. h.mu is
+// held.
+func (h *Hub) toGames(s *session, only string, m Message) {
+	for _, p := range append([]*peer(nil), s.peers...) {
+		if p.role == RoleGame && (only == "" || p.name == only) {
+			h.queue(s, p, m)
+		}
+	}
+}
+
+// broadcast queues m for the session's peers of role, or all of them.
+// h.mu is held.
+func (h *Hub) broadcast(s *session, role string, m Message) {
+	for _, p := range append([]*peer(nil), s.peers...) {
+		if role == "" || p.role == role {
+			h.queue(s, p, m)
+		}
+	}
+}
+
+// queue sends m to p, dropping p when it's too far behind to take it.
+// h.mu is held.
+func (h *Hub) queue(s *session, p *peer, m Message) {
+	if s.peer(p.name) != p {
+		return
+	}
+	select {
+	case p.send <- m:
+	default:
+		h.remove(s, p)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,125 @@
+package livesync
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+func dial(t *testing.T, ctx context.Context, url, role, name string) *Client {
+	t.Helper()
+	c, err := Dial(ctx, url, "tower", role, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if _, err := c.Await(ctx, TypeWelcome); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEditorAndGameSync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv := httptest.NewServer(NewHub(Options{}))
+	defer srv.Close()
+
+	editor := dial(t, ctx, srv.URL, RoleEditor, "ed")
+	lvl := level.New("tower", 4, 6)
+	lvl.SpawnPoints = []level.Point{{X: 2, Y: 0}}
+	if err := editor.Load(lvl); err != nil {
+		t.Fatal(err)
+	}
+	if ack, err := editor.Await(ctx, TypeAck); err != nil || ack.Rev != 1 {
+		t.Fatalf("load ack %+v %v", ack, err)
+	}
+
+	// a game joining late is loaded from the hub
+	game := dial(t, ctx, srv.URL, RoleGame, "pc")
+	var replica Replica
+	m, err := game.Await(ctx, TypeLoad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replica.Update(m); err != nil || replica.Rev != 1 || replica.Level.Name != "tower" {
+		t.Fatalf("replica after load: %+v %v", replica, err)
+	}
+
+	editor.Patch(1, Op{Op: OpBlock, Block: &level.Block{Type: "T", X: 0, Y: 5}}, Op{Op: OpRule, Key: "gravity", Value: 2})
+	if ack, err := editor.Await(ctx, TypeAck); err != nil || ack.Rev != 2 {
+		t.Fatalf("patch ack %+v %v", ack, err)
+	}
+	if m, err = game.Await(ctx, TypePatch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replica.Update(m); err != nil || replica.Rev != 2 || len(replica.Level.Blocks) != 1 || replica.Level.SpecialRules["gravity"] != 2 {
+		t.Fatalf("replica after patch: %+v %v", replica.Level, err)
+	}
+	if _, err := replica.Update(m); !errors.Is(err, ErrOutOfSync) {
+		t.Errorf("a patch applied twice: %v", err)
+	}
+
+	// stale and invalid patches are refused, and the games never see them
+	editor.Patch(1, Op{Op: OpClear, X: 0, Y: 5})
+	if rej, err := editor.Await(ctx, TypeReject); err != nil || rej.Rev != 2 {
+		t.Fatalf("stale patch: %+v %v", rej, err)
+	}
+	editor.Patch(2, Op{Op: OpBlock, Block: &level.Block{Type: "I", X: 9, Y: 9}})
+	if _, err := editor.Await(ctx, TypeReject); err != nil {
+		t.Fatal(err)
+	}
+	if err := game.Send(Message{Type: TypeLoad, Level: lvl}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := game.Await(ctx, TypeLoad); err == nil {
+		t.Fatal("a game loaded the level")
+	}
+
+	// the editor captures the game's board as a puzzle start
+	editor.Capture("pc")
+	if _, err := game.Await(ctx, TypeCapture); err != nil {
+		t.Fatal(err)
+	}
+	game.SendSnapshot(&Snapshot{Level: "tower", Rev: replica.Rev, Player: "pc", Frame: 600,
+		Blocks: []level.Block{{Type: "T", X: 0, Y: 5}, {Type: "O", X: 1, Y: 5}}, Current: "S", Next: []string{"Z", "I"}})
+	m, err = editor.Await(ctx, TypeSnapshot)
+	if err != nil || m.From != "pc" {
+		t.Fatalf("snapshot %+v %v", m, err)
+	}
+	puzzle, err := m.Snapshot.Puzzle(replica.Level, "tower puzzle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(puzzle.Blocks) != 2 || puzzle.Pieces == nil || len(puzzle.Pieces.Fixed) != 3 || puzzle.Pieces.Fixed[0] != "S" ||
+		puzzle.Metadata["captured_frame"] != "600" || puzzle.SpecialRules["gravity"] != 2 {
+		t.Errorf("puzzle %+v", puzzle)
+	}
+	if len(replica.Level.Blocks) != 1 {
+		t.Error("making the puzzle changed the level")
+	}
+}
+
+func TestApplyLeavesTheLevel(t *testing.T) {
+	lvl := level.New("l", 5, 5)
+	lvl.Blocks = []level.Block{{Type: "I", X: 1, Y: 4}}
+	lvl.Pickups = []level.Pickup{{Spell: "SLOW_DOWN", X: 2, Y: 4}}
+	out, err := Apply(lvl, []Op{{Op: OpBlock, Block: &level.Block{Type: "J", X: 2, Y: 4}}, {Op: OpClear, X: 1, Y: 4},
+		{Op: OpMetadata, Key: "author", Text: "kim"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Blocks) != 1 || out.Blocks[0].Type != "J" || len(out.Pickups) != 0 || out.Metadata["author"] != "kim" {
+		t.Errorf("patched %+v", out)
+	}
+	if len(lvl.Blocks) != 1 || lvl.Blocks[0].Type != "I" || len(lvl.Pickups) != 1 || lvl.Metadata != nil {
+		t.Errorf("the original changed: %+v", lvl)
+	}
+	if _, err := Apply(lvl, []Op{{Op: "paint"}}); err == nil {
+		t.Error("an unknown op applied")
+	}
+}
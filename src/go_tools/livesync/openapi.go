@@ -0,0 +1,19 @@
+package livesync
+
+import (
+	"net/http"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+)
+
+// DescribeAPI adds the hub's endpoints to a server's OpenAPI document
+func (h *Hub) DescribeAPI(spec *openapi.Spec) {
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/sessions", Summary: "sessions, their revisions and peers", Reply: []Session{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/sessions/{name}",
+		Summary: "one session, with its level; as a WebSocket handshake, joins it", Params: map[string]string{"name": "the session's"},
+		Query: []openapi.Param{
+			{Name: "role", Doc: RoleEditor + " or " + RoleGame + "; for a WebSocket"},
+			{Name: "name", Doc: "the peer's, unique in the session; for a WebSocket"},
+		},
+		Reply: Session{}})
+}
@@ -0,0 +1,273 @@
+// Package livesync keeps a level editor and running games in step, both
+// ways: the editor pushes the level it edits, then patches as it changes,
+// and a game sends back its board as it stands, so an interesting
+// situation mid-game becomes a puzzle start in the editor. Messages are
+// JSON text WebSocket messages through a hub that holds each session's
+// level and numbers its revisions, so a game that joins late, or loses
+// track, catches up from the hub rather than the editor.
+package livesync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Roles a peer connects as
+const (
+	RoleEditor = "editor"
+	RoleGame   = "game"
+)
+
+// Message types. The editor sends load, patch and capture; games send
+// snapshot and resync; the hub sends welcome, peers, ack and reject, and
+// relays the rest.
+const (
+	TypeWelcome  = "welcome"  // hub → peer on connecting: the session's revision and peers
+	TypePeers    = "peers"    // hub → all: who is connected now
+	TypeLoad     = "load"     // editor → games: the whole level, replacing what a game plays
+	TypePatch    = "patch"    // editor → games: changes to the level at Base, making Rev
+	TypeAck      = "ack"      // hub → editor: its load or patch is revision Rev
+	TypeReject   = "reject"   // hub → editor: its patch wasn't applied, and why; the editor resends a load
+	TypeCapture  = "capture"  // editor → games: send a snapshot; To picks one game
+	TypeSnapshot = "snapshot" // game → editors: its board as it stands
+	TypeResync   = "resync"   // game → hub: it lost track; the hub sends it a load
+	TypeError    = "error"    // hub → peer: a message it couldn't act on
+)
+
+// Message is every message of the protocol; the fields a type doesn't use
+// are left out
+type Message struct {
+	Type     string       `json:"type"`
+	Session  string       `json:"session,omitempty"`
+	From     string       `json:"from,omitempty"` // the peer that sent it, set by the hub
+	To       string       `json:"to,omitempty"`   // a capture's game; empty for every game
+	Base     int          `json:"base,omitempty"` // revision a patch applies to
+	Rev      int          `json:"rev,omitempty"`  // revision a load or patch makes, or an ack confirms
+	Level    *level.Level `json:"level,omitempty"`
+	Ops      []Op         `json:"ops,omitempty"`
+	Snapshot *Snapshot    `json:"snapshot,omitempty"`
+	Editors  []string     `json:"editors,omitempty"`
+	Games    []string     `json:"games,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// Patch operations
+const (
+	OpBlock    = "block"    // put Block in its cell, replacing anything there
+	OpPickup   = "pickup"   // put Pickup in its cell, replacing anything there
+	OpClear    = "clear"    // empty the cell at X, Y
+	OpSpawns   = "spawns"   // replace the spawn points with Spawns
+	OpRule     = "rule"     // set special rule Key to Value
+	OpMetadata = "metadata" // set metadata Key to Text; an empty Text removes it
+	OpPieces   = "pieces"   // replace the piece sequence with Pieces; nil for the default
+)
+
+// Op is one change of a patch
+type Op struct {
+	Op     string               `json:"op"`
+	X      int                  `json:"x,omitempty"`
+	Y      int                  `json:"y,omitempty"`
+	Block  *level.Block         `json:"block,omitempty"`
+	Pickup *level.Pickup        `json:"pickup,omitempty"`
+	Spawns []level.Point        `json:"spawns,omitempty"`
+	Key    string               `json:"key,omitempty"`
+	Value  float64              `json:"value,omitempty"`
+	Text   string               `json:"text,omitempty"`
+	Pieces *level.PieceSequence `json:"pieces,omitempty"`
+}
+
+// Apply returns the level with the ops applied, in order, leaving lvl as
+// it was. The result has to validate, so a game is never patched into a
+// level it can't play.
+func Apply(lvl *level.Level, ops []Op) (*level.Level, error) {
+	out := clone(lvl)
+	for i, op := range ops {
+		if err := apply(out, op); err != nil {
+			return nil, fmt.Errorf("op %d (%s): %w", i, op.Op, err)
+		}
+	}
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func apply(lvl *level.Level, op Op) error {
+	switch op.Op {
+	case OpBlock:
+		if op.Block == nil {
+			return fmt.Errorf("no block")
+		}
+		if !level.IsBlockType(op.Block.Type) {
+			return fmt.Errorf("unknown block type %q", op.Block.Type)
+		}
+		clearCell(lvl, op.Block.X, op.Block.Y)
+		lvl.Blocks = append(lvl.Blocks, *op.Block)
+	case OpPickup:
+		if op.Pickup == nil {
+			return fmt.Errorf("no pickup")
+		}
+		clearCell(lvl, op.Pickup.X, op.Pickup.Y)
+		lvl.Pickups = append(lvl.Pickups, *op.Pickup)
+	case OpClear:
+		clearCell(lvl, op.X, op.Y)
+	case OpSpawns:
+		lvl.SpawnPoints = append([]level.Point{}, op.Spawns...)
+	case OpRule:
+		if op.Key == "" {
+			return fmt.Errorf("no rule")
+		}
+		if lvl.SpecialRules == nil {
+			lvl.SpecialRules = map[string]float64{}
+		}
+		lvl.SpecialRules[op.Key] = op.Value
+	case OpMetadata:
+		if op.Key == "" {
+			return fmt.Errorf("no key")
+		}
+		if op.Text == "" {
+			delete(lvl.Metadata, op.Key)
+			break
+		}
+		if lvl.Metadata == nil {
+			lvl.Metadata = map[string]string{}
+		}
+		lvl.Metadata[op.Key] = op.Text
+	case OpPieces:
+		lvl.Pieces = nil
+		if op.Pieces != nil {
+			p := *op.Pieces
+			p.Fixed = slices.Clone(p.Fixed)
+			lvl.Pieces = &p
+		}
+	default:
+		return fmt.Errorf("unknown op")
+	}
+	return nil
+}
+
+// clearCell removes the block or pickup at x, y
+func clearCell(lvl *level.Level, x, y int) {
+	lvl.Blocks = slices.DeleteFunc(lvl.Blocks, func(b level.Block) bool { return b.X == x && b.Y == y })
+	lvl.Pickups = slices.DeleteFunc(lvl.Pickups, func(p level.Pickup) bool { return p.X == x && p.Y == y })
+}
+
+// clone deep-copies a level through its JSON, the layout the editor
+// and the game share
+func clone(lvl *level.Level) *level.Level {
+	data, _ := json.Marshal(lvl)
+	var out level.Level
+	json.Unmarshal(data, &out)
+	if out.Blocks == nil {
+		out.Blocks = []level.Block{}
+	}
+	if out.SpawnPoints == nil {
+		out.SpawnPoints = []level.Point{}
+	}
+	if out.SpecialRules == nil {
+		out.SpecialRules = map[string]float64{}
+	}
+	return &out
+}
+
+// ErrOutOfSync is a patch that isn't of the revision a replica has; the
+// game sends resync to be loaded again
+var ErrOutOfSync = errors.New("livesync: patch of another revision")
+
+// Replica is a game's copy of the session's level, kept up by the loads
+// and patches it is sent
+type Replica struct {
+	Level *level.Level
+	Rev   int
+}
+
+// Update applies a load or patch, reporting whether the level changed;
+// other messages leave it alone
+func (r *Replica) Update(m Message) (bool, error) {
+	switch m.Type {
+	case TypeLoad:
+		if m.Level == nil {
+			return false, fmt.Errorf("livesync: load without a level")
+		}
+		r.Level, r.Rev = m.Level, m.Rev
+		return true, nil
+	case TypePatch:
+		if r.Level == nil || m.Base != r.Rev {
+			return false, ErrOutOfSync
+		}
+		patched, err := Apply(r.Level, m.Ops)
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", ErrOutOfSync, err)
+		}
+		r.Level, r.Rev = patched, m.Rev
+		return true, nil
+	}
+	return false, nil
+}
+
+// Snapshot is a game's board as it stands: the level it plays at the
+// revision it last applied, the blocks locked and pickups left, and the
+// pieces to come
+type Snapshot struct {
+	Level    string         `json:"level"`
+	Rev      int            `json:"rev"`
+	Player   string         `json:"player"`
+	Frame    int            `json:"frame"`
+	TimeMs   int64          `json:"timeMs"`
+	Taken    time.Time      `json:"taken"`
+	Blocks   []level.Block  `json:"blocks"`
+	Pickups  []level.Pickup `json:"pickups,omitempty"`
+	Current  string         `json:"current,omitempty"` // the piece falling, which the puzzle deals first
+	Hold     string         `json:"hold,omitempty"`
+	Next     []string       `json:"next,omitempty"` // the pieces previewed, in order
+	Score    int            `json:"score"`
+	Lines    int            `json:"lines"`
+	Progress map[string]int `json:"progress,omitempty"` // towards each objective kind
+}
+
+// Puzzle makes a puzzle level that starts where the snapshot is: the
+// level's settings, the snapshot's blocks and pickups, and its pieces
+// dealt first. The level is the one the game played, for its size, spawns
+// and objectives.
+func (s *Snapshot) Puzzle(from *level.Level, name string) (*level.Level, error) {
+	out := clone(from)
+	out.Name = name
+	out.Blocks = slices.Clone(s.Blocks)
+	if out.Blocks == nil {
+		out.Blocks = []level.Block{}
+	}
+	out.Pickups = slices.Clone(s.Pickups)
+	var fixed []string
+	for _, p := range append([]string{s.Current}, s.Next...) {
+		if p != "" {
+			fixed = append(fixed, p)
+		}
+	}
+	if len(fixed) > 0 || out.Pieces != nil {
+		seq := level.PieceSequence{}
+		if out.Pieces != nil {
+			seq = *out.Pieces
+		}
+		seq.Fixed = fixed
+		out.Pieces = &seq
+	}
+	out.Metadata = maps.Clone(out.Metadata)
+	if out.Metadata == nil {
+		out.Metadata = map[string]string{}
+	}
+	out.Metadata["captured_from"] = s.Level
+	out.Metadata["captured_frame"] = fmt.Sprint(s.Frame)
+	if s.Player != "" {
+		out.Metadata["captured_player"] = s.Player
+	}
+	if err := out.Validate(); err != nil {
+		return nil, fmt.Errorf("snapshot doesn't make a level: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,563 @@
+// Package loadtest plays headless bots against a relay to see how many
+// players it carries: bots join rooms as clients do, get ready, and once
+// the host starts the match each plays the analyzer's greedy bot, sending
+// its moves as game messages at a player's pace. It reports the bots that
+// failed to connect or were cut off, how long the relay took to deliver
+// their messages to one another, and the relay's tick health while it
+// carried them.
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/lobby"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/relay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+// Defaults for Options left zero
+const (
+	DefaultBots           = 10
+	DefaultRoomSize       = 2
+	DefaultDuration       = 30 * time.Second
+	DefaultPieceInterval  = 500 * time.Millisecond
+	DefaultHealthInterval = time.Second
+)
+
+// Latency kinds a report summarises, besides the relay's ticks as
+// profiler.LatencyTick
+const (
+	LatencyConnect  = "connect"  // a bot's WebSocket handshake
+	LatencyStart    = "start"    // from the host starting a match to a bot hearing it
+	LatencyDelivery = "delivery" // from a bot sending a game message to a peer receiving it
+)
+
+// Kinds of error a report counts
+const (
+	ErrorOpen       = "open"       // opening a room
+	ErrorConnect    = "connect"    // joining it
+	ErrorStart      = "start"      // getting ready and started
+	ErrorSend       = "send"       // sending a game message
+	ErrorDisconnect = "disconnect" // the relay cut a bot off mid-match
+	ErrorHealth     = "health"     // reading the relay's health
+)
+
+// How long a room has to start its match, and how long the messages
+// still in flight when it ends have to arrive
+const (
+	startTimeout = 10 * time.Second
+	drainTime    = time.Second
+)
+
+// The board bots play when there's no level, and the game's frame rate,
+// which numbers their moves' frames
+const (
+	boardWidth  = 10
+	boardHeight = 20
+	framesPerMs = 60.0 / 1000
+)
+
+// Options tune a load test
+type Options struct {
+	Bots           int           // clients in all
+	RoomSize       int           // bots a room; rooms take the bots left over one each
+	Duration       time.Duration // of the matches
+	Ramp           time.Duration // over which rooms join, evenly spaced; 0 joins them at once
+	PieceInterval  time.Duration // between a bot's pieces
+	HealthInterval time.Duration // between reads of the relay's health
+	Level          *level.Level  // played, its board and pieces; nil for an empty board
+	Seed           uint64        // of the bots' pieces, each bot its own sequence
+}
+
+func (o *Options) defaults() {
+	if o.Bots <= 0 {
+		o.Bots = DefaultBots
+	}
+	if o.RoomSize <= 0 {
+		o.RoomSize = DefaultRoomSize
+	}
+	if o.Duration <= 0 {
+		o.Duration = DefaultDuration
+	}
+	if o.PieceInterval <= 0 {
+		o.PieceInterval = DefaultPieceInterval
+	}
+	if o.HealthInterval <= 0 {
+		o.HealthInterval = DefaultHealthInterval
+	}
+}
+
+// ErrorCount is how often one kind of error happened, and the first
+type ErrorCount struct {
+	Kind    string `json:"kind"`
+	Count   int    `json:"count"`
+	Example string `json:"example"`
+}
+
+// ServerHealth is what the relay's GET /health said over the test
+type ServerHealth struct {
+	Samples      int     `json:"samples"`
+	PeersPeak    int     `json:"peersPeak"`
+	RoomsPeak    int     `json:"roomsPeak"`
+	Dropped      int64   `json:"dropped"` // peers the relay dropped as too slow during the test
+	TickLagP99Ms float64 `json:"tickLagP99Ms"`
+	TickLagMaxMs float64 `json:"tickLagMaxMs"` // the worst the relay reported
+}
+
+// Report is a load test's outcome
+type Report struct {
+	URL        string                    `json:"url"`
+	Started    time.Time                 `json:"started"`
+	DurationMs float64                   `json:"durationMs"`
+	Bots       int                       `json:"bots"`
+	Rooms      int                       `json:"rooms"`
+	Playing    int                       `json:"playing"` // bots that joined and saw their match start
+	Pieces     int64                     `json:"pieces"`
+	TopOuts    int64                     `json:"topOuts"`
+	Sent       int64                     `json:"sent"`      // game messages
+	Delivered  int64                     `json:"delivered"` // copies of them peers received
+	Lost       int64                     `json:"lost"`      // copies owed to peers that never arrived
+	Errors     []ErrorCount              `json:"errors"`
+	Latencies  []profiler.LatencySummary `json:"latencies"`
+	Histograms profiler.Latencies        `json:"histograms"`
+	Server     ServerHealth              `json:"server"`
+}
+
+// Failed reports whether any bot failed to play its match through
+func (r Report) Failed() bool {
+	for _, e := range r.Errors {
+		if e.Kind != ErrorHealth {
+			return true
+		}
+	}
+	return r.Playing < r.Bots
+}
+
+// test is a running load test's tallies, which its bots share
+type test struct {
+	opts    Options
+	baseURL string
+	latency *profiler.LatencyRecorder
+
+	mu       sync.Mutex
+	rep      Report
+	errors   map[string]*ErrorCount
+	inFlight map[flightKey]*flight
+}
+
+type flightKey struct {
+	from string
+	seq  uint64
+}
+
+// flight is a game message on its way to a room's other bots
+type flight struct {
+	sent time.Time
+	left int // peers yet to receive it
+}
+
+// Run plays opts.Bots bots against the relay at baseURL, such as
+// http://host:8097, until their matches end or ctx is done. The token of
+// auth.TokenEnv, if set, is presented to the relay.
+func Run(ctx context.Context, baseURL string, opts Options) (Report, error) {
+	opts.defaults()
+	if opts.Bots < lobby.DefaultMinMembers || opts.RoomSize < lobby.DefaultMinMembers {
+		return Report{}, fmt.Errorf("a match needs %d bots, and so does a room", lobby.DefaultMinMembers)
+	}
+	t := &test{opts: opts, baseURL: baseURL, latency: profiler.NewLatencyRecorder(),
+		errors: make(map[string]*ErrorCount), inFlight: make(map[flightKey]*flight)}
+	t.rep = Report{URL: baseURL, Started: time.Now().UTC(), Bots: opts.Bots}
+
+	rooms := splitRooms(opts.Bots, opts.RoomSize)
+	t.rep.Rooms = len(rooms)
+	healthCtx, stopHealth := context.WithCancel(ctx)
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		t.pollHealth(healthCtx)
+	}()
+	var wg sync.WaitGroup
+	for i, names := range rooms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if opts.Ramp > 0 && i > 0 {
+				select {
+				case <-time.After(opts.Ramp * time.Duration(i) / time.Duration(len(rooms))):
+				case <-ctx.Done():
+					t.fail(ErrorConnect, len(names), ctx.Err())
+					return
+				}
+			}
+			t.playRoom(ctx, names, uint64(i))
+		}()
+	}
+	wg.Wait()
+	stopHealth()
+	<-polled
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rep := t.rep
+	rep.DurationMs = float64(time.Since(rep.Started)) / float64(time.Millisecond)
+	for _, f := range t.inFlight {
+		rep.Lost += int64(f.left)
+	}
+	rep.Errors = []ErrorCount{}
+	for _, e := range t.errors {
+		rep.Errors = append(rep.Errors, *e)
+	}
+	sort.Slice(rep.Errors, func(i, j int) bool { return rep.Errors[i].Kind < rep.Errors[j].Kind })
+	rep.Histograms = t.latency.Latencies()
+	rep.Latencies = rep.Histograms.Summaries()
+	return rep, nil
+}
+
+// splitRooms names the bots and shares them into rooms of size, the ones
+// left over going one to a room
+func splitRooms(bots, size int) [][]string {
+	rooms := make([][]string, bots/size)
+	for i := 0; i < bots; i++ {
+		r := i / size
+		if r >= len(rooms) {
+			r = i % len(rooms)
+		}
+		rooms[r] = append(rooms[r], fmt.Sprintf("bot-%03d", i+1))
+	}
+	return rooms
+}
+
+// fail counts n errors of kind
+func (t *test) fail(kind string, n int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e := t.errors[kind]
+	if e == nil {
+		e = &ErrorCount{Kind: kind, Example: err.Error()}
+		t.errors[kind] = e
+	}
+	e.Count += n
+}
+
+// playRoom opens a room, joins the bots to it and plays a match
+func (t *test) playRoom(ctx context.Context, names []string, room uint64) {
+	r, err := relay.OpenRoom(ctx, t.baseURL)
+	if err != nil {
+		t.fail(ErrorOpen, 1, err)
+		t.fail(ErrorConnect, len(names), fmt.Errorf("no room to join: %w", err))
+		return
+	}
+	clients := make([]*relay.Client, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			c, err := relay.Dial(ctx, t.baseURL, r.Code, name)
+			if err != nil {
+				t.fail(ErrorConnect, 1, err)
+				return
+			}
+			t.latency.Observe(LatencyConnect, time.Since(start))
+			clients[i] = c
+		}()
+	}
+	wg.Wait()
+	var joined []*relay.Client
+	for _, c := range clients {
+		if c != nil {
+			joined = append(joined, c)
+		}
+	}
+	defer func() {
+		for _, c := range joined {
+			c.Close()
+		}
+	}()
+	if len(joined) < lobby.DefaultMinMembers {
+		if len(joined) > 0 {
+			t.fail(ErrorStart, len(joined), fmt.Errorf("room %s: too few bots joined to start", r.Code))
+		}
+		return
+	}
+
+	host, started, err := t.start(ctx, joined)
+	if err != nil {
+		t.fail(ErrorStart, len(joined), fmt.Errorf("room %s: %w", r.Code, err))
+		return
+	}
+	t.mu.Lock()
+	t.rep.Playing += len(joined)
+	t.mu.Unlock()
+
+	end := started.Add(t.opts.Duration)
+	for i, c := range joined {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.play(ctx, c, len(joined)-1, end, t.opts.Seed+room*1000+uint64(i))
+		}()
+	}
+	wg.Wait()
+	host.End()
+}
+
+// start gets the bots ready and has the host, whichever joined first,
+// start the match once they all are, returning the host and when it did
+func (t *test) start(ctx context.Context, bots []*relay.Client) (*relay.Client, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+	for _, c := range bots {
+		if err := c.Ready(true); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+	e, err := bots[0].Await(ctx, func(e relay.Event) bool {
+		return len(e.Ready) == len(bots) && len(e.Peers) == len(bots)
+	})
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("waiting for the bots to be ready: %w", err)
+	}
+	var host *relay.Client
+	for _, c := range bots {
+		if c.Name == e.Host {
+			host = c
+		}
+	}
+	if host == nil {
+		return nil, time.Time{}, fmt.Errorf("%s hosts, not a bot", e.Host)
+	}
+	started := time.Now()
+	if err := host.Start(); err != nil {
+		return nil, time.Time{}, err
+	}
+	errs := make([]error, len(bots))
+	var wg sync.WaitGroup
+	for i, c := range bots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, errs[i] = c.Await(ctx, func(e relay.Event) bool { return e.Event == lobby.EventStart }); errs[i] == nil {
+				t.latency.Observe(LatencyStart, time.Since(started))
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, time.Time{}, fmt.Errorf("waiting for the match to start: %w", err)
+	}
+	return host, started, nil
+}
+
+// play has the bot place a piece each piece interval until end, sending
+// its moves to its peers, and counts the messages it receives from them
+func (t *test) play(ctx context.Context, c *relay.Client, peers int, end time.Time, seed uint64) {
+	bot, queue, err := t.newBot(seed)
+	if err != nil {
+		t.fail(ErrorStart, 1, err)
+		return
+	}
+	readCtx, stopReading := context.WithDeadline(ctx, end.Add(drainTime))
+	defer stopReading()
+	read := make(chan error, 1)
+	go func() { read <- t.receive(readCtx, c) }()
+
+	began := time.Now()
+	var seq uint64
+	send := func(gm *gamepb.Message) error {
+		seq++
+		gm.Session, gm.Seq = c.Code, seq
+		t.mu.Lock()
+		t.inFlight[flightKey{from: c.Name, seq: seq}] = &flight{sent: time.Now(), left: peers}
+		t.rep.Sent++
+		t.mu.Unlock()
+		return c.SendGame(gm)
+	}
+	ticker := time.NewTicker(t.opts.PieceInterval)
+	defer ticker.Stop()
+	for playing := true; playing; {
+		select {
+		case <-ctx.Done():
+			// the reader waits out its deadline otherwise
+			c.Close()
+			<-read
+			return
+		case err := <-read:
+			t.fail(ErrorDisconnect, 1, err)
+			return
+		case now := <-ticker.C:
+			if !now.Before(end) {
+				playing = false
+				break
+			}
+			ms := now.Sub(began).Milliseconds()
+			if err := t.place(bot, queue.Next(), c.Name, ms, send); err != nil {
+				t.fail(ErrorSend, 1, err)
+				return
+			}
+		}
+	}
+	if err := <-read; err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.fail(ErrorDisconnect, 1, err)
+	}
+}
+
+// newBot is a bot on the test's board and a sequence of its pieces
+func (t *test) newBot(seed uint64) (*analyzer.Bot, pieces.Randomizer, error) {
+	if lvl := t.opts.Level; lvl != nil {
+		queue, err := pieces.ForLevel(lvl.Pieces, pieces.Bag7, rng.NewXoshiro(seed))
+		return analyzer.NewLevelBot(lvl), queue, err
+	}
+	queue, err := pieces.New(pieces.Bag7, rng.NewXoshiro(seed))
+	return analyzer.NewBot(boardWidth, boardHeight), queue, err
+}
+
+// place drops a piece as the bot would and sends the moves that put it
+// there: the rotations, the shifts from the middle of the board and the
+// hard drop, then its lock and any clear. A bot that tops out says so and
+// starts over on a fresh board.
+func (t *test) place(bot *analyzer.Bot, piece, player string, ms int64, send func(*gamepb.Message) error) error {
+	frame := int32(float64(ms) * framesPerMs)
+	event := func(typ gamepb.EventType) *gamepb.Event {
+		return &gamepb.Event{Frame: frame, TimeMs: ms, Player: player, Type: typ, Piece: piece}
+	}
+	p, ok := bot.Drop(piece)
+	t.mu.Lock()
+	t.rep.Pieces++
+	if !ok {
+		t.rep.TopOuts++
+	}
+	t.mu.Unlock()
+	if !ok {
+		bot.Reset()
+		return send(&gamepb.Message{Body: &gamepb.Message_Event{Event: event(gamepb.EventType_EVENT_TYPE_TOP_OUT)}})
+	}
+
+	var moves []gamepb.Action
+	for i := 0; i < p.Rotation; i++ {
+		moves = append(moves, gamepb.Action_ACTION_ROTATE_CW)
+	}
+	for x := t.spawnX(); x != p.X; {
+		if x < p.X {
+			moves, x = append(moves, gamepb.Action_ACTION_RIGHT), x+1
+		} else {
+			moves, x = append(moves, gamepb.Action_ACTION_LEFT), x-1
+		}
+	}
+	moves = append(moves, gamepb.Action_ACTION_HARD_DROP)
+	for _, a := range moves {
+		in := &gamepb.Input{Frame: frame, TimeMs: ms, Player: player, Action: a}
+		if err := send(&gamepb.Message{Body: &gamepb.Message_Input{Input: in}}); err != nil {
+			return err
+		}
+	}
+	lock := event(gamepb.EventType_EVENT_TYPE_LOCK)
+	lock.X, lock.Y, lock.Rotation = int32(p.X), int32(p.Y), int32(p.Rotation)
+	if err := send(&gamepb.Message{Body: &gamepb.Message_Event{Event: lock}}); err != nil {
+		return err
+	}
+	if p.Lines == 0 {
+		return nil
+	}
+	clear := event(gamepb.EventType_EVENT_TYPE_CLEAR)
+	clear.Lines, clear.Score = int32(p.Lines), int32(100*p.Lines*p.Lines)
+	return send(&gamepb.Message{Body: &gamepb.Message_Event{Event: clear}})
+}
+
+// spawnX is the column pieces enter at, which the bot's shifts count from
+func (t *test) spawnX() int {
+	if lvl := t.opts.Level; lvl != nil {
+		if len(lvl.SpawnPoints) > 0 {
+			return lvl.SpawnPoints[0].X
+		}
+		return lvl.GridSize.Width / 2
+	}
+	return boardWidth / 2
+}
+
+// receive reads the bot's messages until ctx is done or the connection
+// fails, timing the game messages its peers sent
+func (t *test) receive(ctx context.Context, c *relay.Client) error {
+	for {
+		m, err := c.Recv(ctx)
+		if err != nil {
+			return err
+		}
+		if m.Event != nil {
+			continue
+		}
+		gm, err := m.Game()
+		if err != nil {
+			continue
+		}
+		key := flightKey{from: sender(gm), seq: gm.GetSeq()}
+		t.mu.Lock()
+		if f, ok := t.inFlight[key]; ok {
+			t.latency.Observe(LatencyDelivery, time.Since(f.sent))
+			t.rep.Delivered++
+			if f.left--; f.left <= 0 {
+				delete(t.inFlight, key)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// sender is the player a bot's game message is from
+func sender(gm *gamepb.Message) string {
+	switch {
+	case gm.GetInput() != nil:
+		return gm.GetInput().GetPlayer()
+	case gm.GetEvent() != nil:
+		return gm.GetEvent().GetPlayer()
+	}
+	return ""
+}
+
+// pollHealth reads the relay's health each interval until ctx is done
+func (t *test) pollHealth(ctx context.Context) {
+	ticker := time.NewTicker(t.opts.HealthInterval)
+	defer ticker.Stop()
+	first := true
+	var dropped int64
+	for {
+		h, err := relay.FetchHealth(ctx, t.baseURL)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			t.fail(ErrorHealth, 1, err)
+		default:
+			if first {
+				dropped, first = h.Dropped, false
+			}
+			t.latency.Observe(profiler.LatencyTick, time.Duration(h.TickLagMs*float64(time.Millisecond)))
+			t.mu.Lock()
+			s := &t.rep.Server
+			s.Samples++
+			s.PeersPeak = max(s.PeersPeak, h.Peers)
+			s.RoomsPeak = max(s.RoomsPeak, h.Rooms)
+			s.Dropped = h.Dropped - dropped
+			s.TickLagP99Ms = max(s.TickLagP99Ms, h.TickLagP99Ms)
+			s.TickLagMaxMs = max(s.TickLagMaxMs, h.TickLagMaxMs)
+			t.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package loadtest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/relay"
+)
+
+func TestBotsPlayThroughARelay(t *testing.T) {
+	s := relay.NewServer(relay.Options{})
+	defer s.Close()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	rep, err := Run(context.Background(), srv.URL, Options{Bots: 5, RoomSize: 2, Duration: 600 * time.Millisecond,
+		Ramp: 100 * time.Millisecond, PieceInterval: 50 * time.Millisecond, HealthInterval: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Failed() || len(rep.Errors) != 0 {
+		t.Fatalf("bots failed: %+v", rep.Errors)
+	}
+	// five bots make a room of three and one of two
+	if rep.Rooms != 2 || rep.Playing != 5 || rep.Pieces == 0 {
+		t.Errorf("rooms %d, playing %d, pieces %d", rep.Rooms, rep.Playing, rep.Pieces)
+	}
+	if rep.Sent == 0 || rep.Delivered < rep.Sent || rep.Lost != 0 {
+		t.Errorf("sent %d, delivered %d, lost %d", rep.Sent, rep.Delivered, rep.Lost)
+	}
+	kinds := map[string]int64{}
+	for _, l := range rep.Latencies {
+		kinds[l.Kind] = l.Count
+	}
+	if kinds[LatencyConnect] != 5 || kinds[LatencyStart] != 5 || kinds[LatencyDelivery] != rep.Delivered {
+		t.Errorf("latencies %v", kinds)
+	}
+	if rep.Server.Samples == 0 || rep.Server.PeersPeak != 5 || rep.Server.Dropped != 0 {
+		t.Errorf("server health %+v", rep.Server)
+	}
+}
+
+func TestUnreachableRelayCountsConnectErrors(t *testing.T) {
+	rep, err := Run(context.Background(), "http://127.0.0.1:1", Options{Bots: 4, Duration: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Failed() || rep.Playing != 0 {
+		t.Fatalf("report %+v", rep)
+	}
+	counts := map[string]int{}
+	for _, e := range rep.Errors {
+		counts[e.Kind] = e.Count
+	}
+	if counts[ErrorOpen] != 2 || counts[ErrorConnect] != 4 {
+		t.Errorf("errors %+v", rep.Errors)
+	}
+}
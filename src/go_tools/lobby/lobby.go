@@ -0,0 +1,555 @@
+// Package lobby tracks rooms through their lifecycle: a room opens under a
+// code, members join by the code and get ready, the host starts the match
+// and ends it, and when the host leaves the longest present member takes
+// over. Idle and unready members, and rooms nobody joins, time out. A
+// lobby holds no connections, only state, so the relay and headless bot
+// clients drive the same rules and tests step it on a fake clock.
+package lobby
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for Options left zero
+const (
+	DefaultMaxMembers   = 8
+	DefaultMinMembers   = 2
+	DefaultEmptyTimeout = 10 * time.Minute
+)
+
+// CodeAlphabet leaves out letters and digits that read alike, so a code
+// read off one screen types correctly on another
+const CodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// CodeLength is the length of the codes a new room is given
+const CodeLength = 5
+
+// Room states
+const (
+	StateWaiting = "waiting" // members join and get ready
+	StatePlaying = "playing" // the host started the match
+)
+
+// Event types
+const (
+	EventJoin    = "join"
+	EventLeave   = "leave" // with a Reason
+	EventReady   = "ready"
+	EventUnready = "unready"
+	EventHost    = "host" // Member is the new host
+	EventStart   = "start"
+	EventEnd     = "end"
+	EventClose   = "close"
+)
+
+// Reasons a member leaves
+const (
+	ReasonLeft    = "left"
+	ReasonKicked  = "kicked"
+	ReasonIdle    = "idle"    // not heard from in IdleTimeout
+	ReasonUnready = "unready" // not ready within ReadyTimeout
+	ReasonRemoved = "removed" // by an operator, not the host
+)
+
+// Errors the lobby returns
+var (
+	ErrNoRoom    = errors.New("no such room")
+	ErrExists    = errors.New("room already open")
+	ErrBadCode   = errors.New("bad room code")
+	ErrFull      = errors.New("room full")
+	ErrNameTaken = errors.New("name already in the room")
+	ErrNotMember = errors.New("not in the room")
+	ErrNotHost   = errors.New("only the host may do that")
+	ErrNotReady  = errors.New("not everyone is ready")
+	ErrTooFew    = errors.New("too few members to start")
+	ErrPlaying   = errors.New("match in progress")
+	ErrWaiting   = errors.New("no match in progress")
+)
+
+// Options tune a lobby
+type Options struct {
+	MaxMembers int // in a room
+	MinMembers int // for the host to start
+
+	// IdleTimeout drops a member not heard from, by Touch or any other
+	// call naming it, in this long; 0 never does
+	IdleTimeout time.Duration
+	// ReadyTimeout drops a member still not ready this long after joining
+	// or the last match ending, so one absent player can't hold a room;
+	// 0 never does
+	ReadyTimeout time.Duration
+	// EmptyTimeout closes a room opened but never joined; a room closes
+	// as soon as its last member leaves regardless
+	EmptyTimeout time.Duration
+
+	Now func() time.Time // nil for time.Now
+}
+
+// Room describes a room
+type Room struct {
+	Code    string    `json:"code"`
+	State   string    `json:"state"`
+	Host    string    `json:"host,omitempty"`
+	Members []Member  `json:"members"` // in the order they joined
+	Created time.Time `json:"created"`
+	Started time.Time `json:"started,omitempty"` // of the match in progress
+	Matches int       `json:"matches"`           // started in the room
+}
+
+// Names lists the members' names in the order they joined
+func (r Room) Names() []string {
+	names := make([]string, len(r.Members))
+	for i, m := range r.Members {
+		names[i] = m.Name
+	}
+	return names
+}
+
+// ReadyNames lists the names of the members who are ready
+func (r Room) ReadyNames() []string {
+	names := []string{}
+	for _, m := range r.Members {
+		if m.Ready {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// Member describes a member of a room
+type Member struct {
+	Name     string    `json:"name"`
+	Ready    bool      `json:"ready"`
+	Joined   time.Time `json:"joined"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Event is a change to a room, with the room as it is after the call that
+// made it
+type Event struct {
+	Type   string `json:"type"`
+	Member string `json:"member,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Room   Room   `json:"room"`
+}
+
+// Lobby is a set of rooms; it is safe for concurrent use
+type Lobby struct {
+	opts Options
+
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+type room struct {
+	Room
+	waiting map[string]time.Time // since when each member has been due to get ready
+}
+
+// New returns an empty lobby
+func New(opts Options) *Lobby {
+	if opts.MaxMembers <= 0 {
+		opts.MaxMembers = DefaultMaxMembers
+	}
+	if opts.MinMembers <= 0 {
+		opts.MinMembers = DefaultMinMembers
+	}
+	if opts.EmptyTimeout <= 0 {
+		opts.EmptyTimeout = DefaultEmptyTimeout
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Lobby{opts: opts, rooms: make(map[string]*room)}
+}
+
+// NormalizeCode lets a code be typed in lower case and with spaces around
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidCode reports whether a normalized code may name a room
+func ValidCode(code string) bool {
+	if code == "" || len(code) > 32 {
+		return false
+	}
+	for _, c := range code {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func newCode() string {
+	b := make([]byte, CodeLength)
+	rand.Read(b)
+	for i := range b {
+		b[i] = CodeAlphabet[int(b[i])%len(CodeAlphabet)]
+	}
+	return string(b)
+}
+
+// Rooms describes the open rooms by code
+func (l *Lobby) Rooms() []Room {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := []Room{}
+	for _, r := range l.rooms {
+		out = append(out, r.describe())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+// Room describes one room
+func (l *Lobby) Room(code string) (Room, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.rooms[NormalizeCode(code)]
+	if !ok {
+		return Room{}, false
+	}
+	return r.describe(), true
+}
+
+// Open opens an empty room under code, or a fresh code when it's empty
+func (l *Lobby) Open(code string) (Room, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if code == "" {
+		for {
+			if code = newCode(); l.rooms[code] == nil {
+				break
+			}
+		}
+	}
+	code = NormalizeCode(code)
+	if !ValidCode(code) {
+		return Room{}, fmt.Errorf("%w %q", ErrBadCode, code)
+	}
+	if l.rooms[code] != nil {
+		return Room{}, fmt.Errorf("%s: %w", code, ErrExists)
+	}
+	r := &room{Room: Room{Code: code, State: StateWaiting, Created: l.opts.Now()}, waiting: map[string]time.Time{}}
+	l.rooms[code] = r
+	return r.describe(), nil
+}
+
+// CanJoin checks that name could join the room now, such as before
+// accepting a connection, without joining it
+func (l *Lobby) CanJoin(code, name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, err := l.room(code)
+	if err != nil {
+		return err
+	}
+	return l.canJoin(r, name)
+}
+
+func (l *Lobby) canJoin(r *room, name string) error {
+	switch {
+	case r.index(name) >= 0:
+		return fmt.Errorf("room %s: %w: %q", r.Code, ErrNameTaken, name)
+	case len(r.Members) >= l.opts.MaxMembers:
+		return fmt.Errorf("room %s: %w, at %d members", r.Code, ErrFull, l.opts.MaxMembers)
+	case r.State == StatePlaying:
+		return fmt.Errorf("room %s: %w", r.Code, ErrPlaying)
+	}
+	return nil
+}
+
+// Join adds name to the room; the first member of a room hosts it
+func (l *Lobby) Join(code, name string) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, err := l.room(code)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.canJoin(r, name); err != nil {
+		return nil, err
+	}
+	now := l.opts.Now()
+	r.Members = append(r.Members, Member{Name: name, Joined: now, LastSeen: now})
+	r.waiting[name] = now
+	if r.Host != "" {
+		return []Event{r.event(EventJoin, name, "")}, nil
+	}
+	r.Host = name
+	return []Event{r.event(EventJoin, name, ""), r.event(EventHost, name, "")}, nil
+}
+
+// Leave takes name out of the room, passing the host on and closing the
+// room once it's empty
+func (l *Lobby) Leave(code, name string) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, err := l.room(code)
+	if err != nil {
+		return nil
+	}
+	return l.remove(r, name, ReasonLeft)
+}
+
+// remove takes a member out; l.mu is held
+func (l *Lobby) remove(r *room, name, reason string) []Event {
+	i := r.index(name)
+	if i < 0 {
+		return nil
+	}
+	r.Members = append(r.Members[:i], r.Members[i+1:]...)
+	delete(r.waiting, name)
+	if len(r.Members) == 0 {
+		r.Host = ""
+		delete(l.rooms, r.Code)
+		return []Event{r.event(EventLeave, name, reason), r.event(EventClose, "", "")}
+	}
+	if r.Host != name {
+		return []Event{r.event(EventLeave, name, reason)}
+	}
+	r.Host = r.Members[0].Name
+	return []Event{r.event(EventLeave, name, reason), r.event(EventHost, r.Host, "")}
+}
+
+// SetReady marks name ready, or not, for the next match
+func (l *Lobby) SetReady(code, name string, ready bool) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, m, err := l.member(code, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.State == StatePlaying {
+		return nil, fmt.Errorf("room %s: %w", r.Code, ErrPlaying)
+	}
+	if m.Ready == ready {
+		return nil, nil
+	}
+	m.Ready = ready
+	if ready {
+		return []Event{r.event(EventReady, name, "")}, nil
+	}
+	return []Event{r.event(EventUnready, name, "")}, nil
+}
+
+// Start starts the match; only the host may, once at least MinMembers are
+// in the room and every one is ready
+func (l *Lobby) Start(code, name string) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, err := l.host(code, name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case r.State == StatePlaying:
+		return nil, fmt.Errorf("room %s: %w", r.Code, ErrPlaying)
+	case len(r.Members) < l.opts.MinMembers:
+		return nil, fmt.Errorf("room %s: %w, %d of %d", r.Code, ErrTooFew, len(r.Members), l.opts.MinMembers)
+	}
+	for _, m := range r.Members {
+		if !m.Ready {
+			return nil, fmt.Errorf("room %s: %w: %s isn't", r.Code, ErrNotReady, m.Name)
+		}
+	}
+	r.State, r.Started = StatePlaying, l.opts.Now()
+	r.Matches++
+	return []Event{r.event(EventStart, name, "")}, nil
+}
+
+// End ends the match in progress; only the host may. Everyone is unready
+// again, due to ready up within ReadyTimeout for the next.
+func (l *Lobby) End(code, name string) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, err := l.host(code, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.State != StatePlaying {
+		return nil, fmt.Errorf("room %s: %w", r.Code, ErrWaiting)
+	}
+	now := l.opts.Now()
+	r.State, r.Started = StateWaiting, time.Time{}
+	for i := range r.Members {
+		r.Members[i].Ready = false
+		r.waiting[r.Members[i].Name] = now
+	}
+	return []Event{r.event(EventEnd, name, "")}, nil
+}
+
+// Transfer makes another member host; only the host may
+func (l *Lobby) Transfer(code, name, to string) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, err := l.host(code, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.index(to) < 0 {
+		return nil, fmt.Errorf("%s: %w %s", to, ErrNotMember, r.Code)
+	}
+	if to == name {
+		return nil, nil
+	}
+	r.Host = to
+	return []Event{r.event(EventHost, to, "")}, nil
+}
+
+// Kick removes another member; only the host may
+func (l *Lobby) Kick(code, name, member string) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, err := l.host(code, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.index(member) < 0 {
+		return nil, fmt.Errorf("%s: %w %s", member, ErrNotMember, r.Code)
+	}
+	return l.remove(r, member, ReasonKicked), nil
+}
+
+// Remove takes a member out on an operator's say, the host as well as any
+// other; Kick is the host's own
+func (l *Lobby) Remove(code, member string) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, err := l.room(code)
+	if err != nil {
+		return nil, err
+	}
+	if r.index(member) < 0 {
+		return nil, fmt.Errorf("%s: %w %s", member, ErrNotMember, r.Code)
+	}
+	return l.remove(r, member, ReasonRemoved), nil
+}
+
+// Close removes every member of a room, closing it, or closes it as it
+// is when nobody has joined
+func (l *Lobby) Close(code string) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, err := l.room(code)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Members) == 0 {
+		delete(l.rooms, r.Code)
+		return []Event{r.event(EventClose, "", "")}, nil
+	}
+	var events []Event
+	for len(r.Members) > 0 {
+		events = append(events, l.remove(r, r.Members[len(r.Members)-1].Name, ReasonRemoved)...)
+	}
+	return events, nil
+}
+
+// Touch records that name was heard from, holding off its IdleTimeout
+func (l *Lobby) Touch(code, name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.member(code, name)
+}
+
+// Sweep applies the timeouts, dropping idle and unready members and
+// closing rooms nobody joined. Something calls it every so often, such as
+// a relay's ticker or a test after advancing its clock.
+func (l *Lobby) Sweep() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.opts.Now()
+	codes := make([]string, 0, len(l.rooms))
+	for code := range l.rooms {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	var events []Event
+	for _, code := range codes {
+		r := l.rooms[code]
+		if len(r.Members) == 0 {
+			if now.Sub(r.Created) >= l.opts.EmptyTimeout {
+				delete(l.rooms, code)
+				events = append(events, r.event(EventClose, "", ""))
+			}
+			continue
+		}
+		var drop []string
+		var reasons []string
+		for _, m := range r.Members {
+			switch {
+			case l.opts.IdleTimeout > 0 && now.Sub(m.LastSeen) >= l.opts.IdleTimeout:
+				drop, reasons = append(drop, m.Name), append(reasons, ReasonIdle)
+			case l.opts.ReadyTimeout > 0 && r.State == StateWaiting && !m.Ready && now.Sub(r.waiting[m.Name]) >= l.opts.ReadyTimeout:
+				drop, reasons = append(drop, m.Name), append(reasons, ReasonUnready)
+			}
+		}
+		for i, name := range drop {
+			events = append(events, l.remove(r, name, reasons[i])...)
+		}
+	}
+	return events
+}
+
+// room finds a room; l.mu is held
+func (l *Lobby) room(code string) (*room, error) {
+	code = NormalizeCode(code)
+	r, ok := l.rooms[code]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNoRoom, code)
+	}
+	return r, nil
+}
+
+// member finds a member, recording it was heard from; l.mu is held
+func (l *Lobby) member(code, name string) (*room, *Member, error) {
+	r, err := l.room(code)
+	if err != nil {
+		return nil, nil, err
+	}
+	i := r.index(name)
+	if i < 0 {
+		return nil, nil, fmt.Errorf("%s: %w %s", name, ErrNotMember, r.Code)
+	}
+	r.Members[i].LastSeen = l.opts.Now()
+	return r, &r.Members[i], nil
+}
+
+// host finds a room name hosts; l.mu is held
+func (l *Lobby) host(code, name string) (*room, error) {
+	r, _, err := l.member(code, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.Host != name {
+		return nil, fmt.Errorf("room %s: %w; %s hosts", r.Code, ErrNotHost, r.Host)
+	}
+	return r, nil
+}
+
+func (r *room) index(name string) int {
+	for i, m := range r.Members {
+		if m.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *room) describe() Room {
+	out := r.Room
+	out.Members = append([]Member{}, r.Members...)
+	return out
+}
+
+func (r *room) event(typ, member, reason string) Event {
+	return Event{Type: typ, Member: member, Reason: reason, Room: r.describe()}
+}
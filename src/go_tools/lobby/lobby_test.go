@@ -0,0 +1,202 @@
+package lobby
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clocked returns a lobby on a clock the test moves with advance
+func clocked(opts Options) (*Lobby, func(time.Duration)) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	opts.Now = func() time.Time { return now }
+	return New(opts), func(d time.Duration) { now = now.Add(d) }
+}
+
+func types(events []Event) string {
+	var out []string
+	for _, e := range events {
+		s := e.Type
+		if e.Member != "" {
+			s += ":" + e.Member
+		}
+		if e.Reason != "" {
+			s += ":" + e.Reason
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, " ")
+}
+
+// must fails the test on a call's error, else passes on its events
+func must(t *testing.T) func([]Event, error) []Event {
+	return func(events []Event, err error) []Event {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+}
+
+func TestRoomLifecycle(t *testing.T) {
+	l, _ := clocked(Options{MaxMembers: 3})
+	ok := must(t)
+	r, err := l.Open("")
+	if err != nil || len(r.Code) != CodeLength || r.State != StateWaiting {
+		t.Fatalf("open = %+v %v", r, err)
+	}
+	code := strings.ToLower(r.Code)
+	if _, err := l.Open(r.Code); !errors.Is(err, ErrExists) {
+		t.Errorf("reopen: %v", err)
+	}
+	if _, err := l.Open("no spaces"); !errors.Is(err, ErrBadCode) {
+		t.Errorf("bad code: %v", err)
+	}
+
+	if got := types(ok(l.Join(code, "alice"))); got != "join:alice host:alice" {
+		t.Errorf("first join = %s", got)
+	}
+	ok(l.Join(code, "bob"))
+	if _, err := l.Join(code, "bob"); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("same name: %v", err)
+	}
+	ok(l.Join(code, "carol"))
+	if err := l.CanJoin(code, "dave"); !errors.Is(err, ErrFull) {
+		t.Errorf("full room: %v", err)
+	}
+
+	if _, err := l.Start(code, "bob"); !errors.Is(err, ErrNotHost) {
+		t.Errorf("start by a guest: %v", err)
+	}
+	ok(l.SetReady(code, "alice", true))
+	ok(l.SetReady(code, "bob", true))
+	if _, err := l.Start(code, "alice"); !errors.Is(err, ErrNotReady) {
+		t.Errorf("start with carol unready: %v", err)
+	}
+	if got := types(ok(l.SetReady(code, "carol", true))); got != "ready:carol" {
+		t.Errorf("ready = %s", got)
+	}
+	events := ok(l.Start(code, "alice"))
+	if types(events) != "start:alice" || events[0].Room.State != StatePlaying || events[0].Room.Matches != 1 {
+		t.Errorf("start = %+v", events)
+	}
+	if _, err := l.SetReady(code, "bob", false); !errors.Is(err, ErrPlaying) {
+		t.Errorf("unready mid-match: %v", err)
+	}
+	if err := l.CanJoin(code, "dave"); err == nil {
+		t.Error("joined mid-match")
+	}
+
+	events = ok(l.End(code, "alice"))
+	if types(events) != "end:alice" || len(events[0].Room.ReadyNames()) != 0 || events[0].Room.State != StateWaiting {
+		t.Errorf("end = %+v", events)
+	}
+	if _, err := l.End(code, "alice"); !errors.Is(err, ErrWaiting) {
+		t.Errorf("end twice: %v", err)
+	}
+}
+
+func TestHostMigration(t *testing.T) {
+	l, _ := clocked(Options{})
+	ok := must(t)
+	r, _ := l.Open("GAME")
+	for _, name := range []string{"alice", "bob", "carol"} {
+		ok(l.Join(r.Code, name))
+	}
+	if got := types(l.Leave(r.Code, "alice")); got != "leave:alice:left host:bob" {
+		t.Errorf("host leaves = %s", got)
+	}
+	if got := types(ok(l.Transfer(r.Code, "bob", "carol"))); got != "host:carol" {
+		t.Errorf("transfer = %s", got)
+	}
+	if _, err := l.Kick(r.Code, "bob", "carol"); !errors.Is(err, ErrNotHost) {
+		t.Errorf("kick by a guest: %v", err)
+	}
+	if got := types(ok(l.Kick(r.Code, "carol", "bob"))); got != "leave:bob:kicked" {
+		t.Errorf("kick = %s", got)
+	}
+	if got := types(l.Leave(r.Code, "carol")); got != "leave:carol:left close" {
+		t.Errorf("last leaves = %s", got)
+	}
+	if _, ok := l.Room(r.Code); ok {
+		t.Error("empty room still open")
+	}
+}
+
+func TestOperatorRemoval(t *testing.T) {
+	l, _ := clocked(Options{})
+	ok := must(t)
+	r, _ := l.Open("GAME")
+	for _, name := range []string{"alice", "bob", "carol"} {
+		ok(l.Join(r.Code, name))
+	}
+	if got := types(ok(l.Remove(r.Code, "alice"))); got != "leave:alice:removed host:bob" {
+		t.Errorf("remove the host = %s", got)
+	}
+	if _, err := l.Remove(r.Code, "alice"); !errors.Is(err, ErrNotMember) {
+		t.Errorf("remove a member gone: %v", err)
+	}
+	if got := types(ok(l.Close(r.Code))); got != "leave:carol:removed leave:bob:removed close" {
+		t.Errorf("close = %s", got)
+	}
+	empty, _ := l.Open("")
+	if got := types(ok(l.Close(empty.Code))); got != "close" {
+		t.Errorf("close an empty room = %s", got)
+	}
+	if len(l.Rooms()) != 0 {
+		t.Error("closed rooms still open")
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	l, advance := clocked(Options{IdleTimeout: time.Minute, ReadyTimeout: 2 * time.Minute, EmptyTimeout: 5 * time.Minute})
+	ok := must(t)
+	empty, _ := l.Open("")
+	r, _ := l.Open("GAME")
+	for _, name := range []string{"alice", "bob", "carol"} {
+		ok(l.Join(r.Code, name))
+	}
+	ok(l.SetReady(r.Code, "alice", true))
+	ok(l.SetReady(r.Code, "carol", true))
+
+	advance(50 * time.Second)
+	l.Touch(r.Code, "alice")
+	l.Touch(r.Code, "bob")
+	if events := l.Sweep(); len(events) != 0 {
+		t.Errorf("early sweep = %s", types(events))
+	}
+	// carol went quiet
+	advance(20 * time.Second)
+	if got := types(l.Sweep()); got != "leave:carol:idle" {
+		t.Errorf("idle sweep = %s", got)
+	}
+
+	// bob keeps talking but never gets ready
+	for range 6 {
+		advance(10 * time.Second)
+		l.Touch(r.Code, "alice")
+		l.Touch(r.Code, "bob")
+	}
+	if got := types(l.Sweep()); got != "leave:bob:unready" {
+		t.Errorf("unready sweep = %s", got)
+	}
+	if room, _ := l.Room(r.Code); !slices.Equal(room.Names(), []string{"alice"}) || room.Host != "alice" {
+		t.Errorf("room = %+v", room)
+	}
+
+	advance(4 * time.Minute)
+	events := l.Sweep()
+	want := "close leave:alice:idle close"
+	if empty.Code > r.Code {
+		want = "leave:alice:idle close close"
+	}
+	if got := types(events); got != want {
+		t.Errorf("final sweep = %s", got)
+	}
+	if len(l.Rooms()) != 0 {
+		t.Errorf("rooms left = %+v", l.Rooms())
+	}
+}
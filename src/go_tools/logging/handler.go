@@ -0,0 +1,242 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handler filters records by the level of the module they are from and
+// hands them to the format's handler with their module as an attribute
+type Handler struct {
+	inner   slog.Handler
+	level   slog.Leveler          // of modules without their own
+	modules map[string]slog.Level // of those with
+	lowest  slog.Level            // the lowest of modules
+	module  string                // set by a module attribute
+	grouped bool                  // attributes go in a group from here, so aren't the module
+}
+
+// NewHandler is a handler writing to w as o says, at o's level; its
+// file settings are ignored
+func NewHandler(w io.Writer, o Options) (*Handler, error) {
+	l, err := ParseLevel(o.Level)
+	if err != nil {
+		return nil, err
+	}
+	return newHandler(w, o, l)
+}
+
+func newHandler(w io.Writer, o Options, level slog.Leveler) (*Handler, error) {
+	h := &Handler{level: level, modules: make(map[string]slog.Level)}
+	switch o.Format {
+	case "", FormatConsole:
+		h.inner = &consoleHandler{mu: new(sync.Mutex), w: w}
+	case FormatJSON:
+		// below debug: the Handler does the filtering
+		h.inner = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug - 4})
+	default:
+		return nil, fmt.Errorf("unknown log format %q, want %s or %s", o.Format, FormatConsole, FormatJSON)
+	}
+	for module, name := range o.Modules {
+		l, err := ParseLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", module, err)
+		}
+		if len(h.modules) == 0 || l < h.lowest {
+			h.lowest = l
+		}
+		h.modules[module] = l
+	}
+	return h, nil
+}
+
+// levelOf is the level module logs at
+func (h *Handler) levelOf(module string) slog.Level {
+	if l, ok := h.modules[module]; ok {
+		return l
+	}
+	return h.level.Level()
+}
+
+// Enabled says whether a record at l could be logged; until its message
+// names the module, that is whether any module logs at l
+func (h *Handler) Enabled(_ context.Context, l slog.Level) bool {
+	if h.module != "" {
+		return l >= h.levelOf(h.module)
+	}
+	min := h.level.Level()
+	if len(h.modules) > 0 && h.lowest < min {
+		min = h.lowest
+	}
+	return l >= min
+}
+
+// Handle logs r if its module logs at its level, taking the module from
+// the message's prefix when no attribute named it
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if h.module != "" {
+		if r.Level < h.levelOf(h.module) {
+			return nil
+		}
+		return h.inner.Handle(ctx, r)
+	}
+	module, msg := splitModule(r.Message)
+	if r.Level < h.levelOf(module) {
+		return nil
+	}
+	if module == "" {
+		return h.inner.Handle(ctx, r)
+	}
+	out := slog.NewRecord(r.Time, r.Level, msg, r.PC)
+	out.AddAttrs(slog.String(ModuleKey, module))
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(a)
+		return true
+	})
+	return h.inner.Handle(ctx, out)
+}
+
+// WithAttrs is h with attrs, a module attribute among them naming the
+// module its records are from
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.inner = h.inner.WithAttrs(attrs)
+	if !h.grouped {
+		for _, a := range attrs {
+			if a.Key == ModuleKey {
+				c.module = a.Value.String()
+			}
+		}
+	}
+	return &c
+}
+
+// WithGroup is h with its attributes from here in group name
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.inner = h.inner.WithGroup(name)
+	c.grouped = true
+	return &c
+}
+
+// splitModule takes the module off a message written as "module: what
+// happened"; a message without one is from no module
+func splitModule(msg string) (module, rest string) {
+	i := strings.Index(msg, ": ")
+	if i <= 0 {
+		return "", msg
+	}
+	for _, c := range msg[:i] {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return "", msg
+		}
+	}
+	return msg[:i], msg[i+2:]
+}
+
+// consoleHandler writes a line a record for people reading a terminal:
+//
+//	15:04:05.000 WARN  relay: dropped a peer too slow to keep up room=ABCD peer=ann
+type consoleHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	module string
+	attrs  string // rendered by WithAttrs
+	group  string // prefix of attribute keys, ending in a dot
+}
+
+func (h *consoleHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if !r.Time.IsZero() {
+		b.WriteString(r.Time.Format("15:04:05.000 "))
+	}
+	fmt.Fprintf(&b, "%-5s ", r.Level)
+	module := h.module
+	var attrs strings.Builder
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == ModuleKey && h.group == "" {
+			module = a.Value.String()
+			return true
+		}
+		writeAttr(&attrs, h.group, a)
+		return true
+	})
+	if module != "" {
+		b.WriteString(module + ": ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	b.WriteString(attrs.String())
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	var b strings.Builder
+	for _, a := range attrs {
+		if a.Key == ModuleKey && h.group == "" {
+			c.module = a.Value.String()
+			continue
+		}
+		writeAttr(&b, h.group, a)
+	}
+	c.attrs += b.String()
+	return &c
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.group += name + "."
+	return &c
+}
+
+// writeAttr writes a as key=value, a group's attributes each under
+// group.key
+func writeAttr(b *strings.Builder, group string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			group += a.Key + "."
+		}
+		for _, g := range v.Group() {
+			writeAttr(b, group, g)
+		}
+		return
+	}
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	var s string
+	switch v.Kind() {
+	case slog.KindTime:
+		s = v.Time().Format(time.RFC3339Nano)
+	case slog.KindDuration:
+		s = v.Duration().String()
+	default:
+		s = v.String()
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		s = strconv.Quote(s)
+	}
+	fmt.Fprintf(b, " %s%s=%s", group, a.Key, s)
+}
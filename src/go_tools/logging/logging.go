@@ -0,0 +1,135 @@
+// Package logging is the tools' structured log: slog at the config's
+// logLevel, written as console lines or JSON to stderr and, when a file is
+// set, to it too, rotated by size. A module, named by the prefix a package
+// puts on its messages ("relay: peer joined") or by a module attribute,
+// can log at a level of its own. Its last lines are kept for crash
+// reports.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Log formats
+const (
+	FormatConsole = "console" // a line a message: time, level, module, message and key=value attributes
+	FormatJSON    = "json"    // an object a message, as slog's JSON handler writes them
+)
+
+// ModuleKey is the attribute naming the module a message is from
+const ModuleKey = "module"
+
+// Defaults of the log file's rotation
+const (
+	DefaultMaxSizeMiB = 10
+	DefaultMaxFiles   = 5
+)
+
+// Options configure the log, from the config's log settings
+type Options struct {
+	Level      string            // debug, info, warn or error; empty is info
+	Format     string            // FormatConsole or FormatJSON; empty is console
+	Modules    map[string]string // levels of modules logging at other than Level
+	File       string            // file written as well as stderr; empty for none
+	MaxSizeMiB int               // size the file is rotated at; 0 for DefaultMaxSizeMiB
+	MaxFiles   int               // rotated files kept besides the one written; 0 for DefaultMaxFiles
+}
+
+// level is the log level, which PUT /admin/log-level changes while the
+// servers run
+var level = new(slog.LevelVar)
+
+var logger = slog.New(mustHandler(tee{os.Stderr, tail}, Options{}))
+
+// file is the log file Start opened, closed when it starts again
+var file *File
+
+func mustHandler(w io.Writer, o Options) *Handler {
+	h, err := newHandler(w, o, level)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// Logger is the tools' log
+func Logger() *slog.Logger {
+	return logger
+}
+
+// Start sets the log up as o says and makes it slog's default, so what
+// packages log with slog goes to it
+func Start(o Options) error {
+	l, err := ParseLevel(o.Level)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = tee{os.Stderr, tail}
+	var f *File
+	if o.File != "" {
+		if f, err = OpenFile(o.File, o.MaxSizeMiB, o.MaxFiles); err != nil {
+			return err
+		}
+		w = tee{os.Stderr, f, tail}
+	}
+	h, err := newHandler(w, o, level)
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return err
+	}
+	level.Set(l)
+	if file != nil {
+		file.Close()
+	}
+	file = f
+	logger = slog.New(h)
+	slog.SetDefault(logger)
+	return nil
+}
+
+// Level is the log level's name
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// SetLevel sets the log level of the modules without one of their own
+func SetLevel(name string) error {
+	l, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// ParseLevel reads a level's name: debug, info, warn or error, in any
+// case; empty is info
+func ParseLevel(name string) (slog.Level, error) {
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, want debug, info, warn or error", name)
+	}
+	return l, nil
+}
+
+// tee writes to stderr, the log file and the tail, whichever fails
+type tee []io.Writer
+
+func (t tee) Write(p []byte) (int, error) {
+	var first error
+	for _, w := range t {
+		if _, err := w.Write(p); err != nil && first == nil {
+			first = err
+		}
+	}
+	return len(p), first
+}
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestModuleLevels(t *testing.T) {
+	var out bytes.Buffer
+	h, err := NewHandler(&out, Options{Level: "warn", Format: FormatJSON, Modules: map[string]string{"relay": "debug", "jobqueue": "error"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(h)
+	log.Debug("relay: peer joined", "room", "ABCD")
+	log.Info("api: replay submitted")
+	log.Warn("jobqueue: job attempt failed")
+	log.Warn("config reloaded")
+	log.With(ModuleKey, "jobqueue").Error("leases lost", "jobs", 2)
+
+	var got []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		got = append(got, m)
+	}
+	if len(got) != 3 {
+		t.Fatalf("logged:\n%s", out.String())
+	}
+	if got[0]["module"] != "relay" || got[0]["msg"] != "peer joined" || got[0]["room"] != "ABCD" {
+		t.Errorf("relay's debug message = %v", got[0])
+	}
+	if got[1]["module"] != nil || got[1]["msg"] != "config reloaded" {
+		t.Errorf("message from no module = %v", got[1])
+	}
+	if got[2]["module"] != "jobqueue" || got[2]["jobs"] != 2.0 {
+		t.Errorf("jobqueue's error = %v", got[2])
+	}
+	if !h.Enabled(context.Background(), slog.LevelDebug) || h.WithAttrs([]slog.Attr{slog.String(ModuleKey, "api")}).Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("Enabled doesn't follow the module levels")
+	}
+}
+
+func TestConsole(t *testing.T) {
+	var out bytes.Buffer
+	h, err := NewHandler(&out, Options{Level: "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(h)
+	log.Warn("relay: dropped a peer too slow to keep up", "peer", "ann lee", "err", nil)
+	log.WithGroup("job").Info("done", "id", 7, slog.Group("took", "ms", 12))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged:\n%s", out.String())
+	}
+	if _, after, _ := strings.Cut(lines[0], " "); after != `WARN  relay: dropped a peer too slow to keep up peer="ann lee" err=<nil>` {
+		t.Errorf("line = %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "INFO  done job.id=7 job.took.ms=12") {
+		t.Errorf("line = %q", lines[1])
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for _, o := range []Options{{Level: "loud"}, {Format: "xml"}, {Modules: map[string]string{"relay": "everything"}}} {
+		if _, err := NewHandler(&bytes.Buffer{}, o); err == nil {
+			t.Errorf("%+v accepted", o)
+		}
+	}
+	defer SetLevel(Level())
+	if err := SetLevel("ERROR"); err != nil || Level() != "error" {
+		t.Errorf("level %s, %v", Level(), err)
+	}
+}
+
+func TestFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "stt.log")
+	f, err := OpenFile(path, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	line := bytes.Repeat([]byte("x"), 400<<10)
+	for i := 0; i < 8; i++ {
+		if _, err := f.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"stt.log", "stt.log.1", "stt.log.2"} {
+		info, err := os.Stat(filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 1<<20 {
+			t.Errorf("%s is %d bytes, past the size", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("a third rotated file kept: %v", err)
+	}
+}
+
+func TestTail(t *testing.T) {
+	var b tailBuffer
+	for i := 0; i < 3*TailLines; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	b.Write([]byte("half"))
+	got := b.lines()
+	if len(got) != TailLines || got[0] != fmt.Sprintf("line %d", 2*TailLines+1) || got[TailLines-1] != "half" {
+		t.Errorf("tail of %d lines, from %q to %q", len(got), got[0], got[len(got)-1])
+	}
+	b.Write([]byte(" done\n"))
+	if got := b.lines(); got[len(got)-1] != "half done" {
+		t.Errorf("last line %q", got[len(got)-1])
+	}
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"strings"
+	"sync"
+)
+
+// TailLines is how many of the log's last lines Tail keeps
+const TailLines = 200
+
+// tail is the log's last lines, kept whatever the log writes them to for
+// crash reports to carry
+var tail = new(tailBuffer)
+
+// Tail is the last TailLines lines the log wrote, oldest first
+func Tail() []string {
+	return tail.lines()
+}
+
+// tailBuffer keeps the last TailLines lines written to it
+type tailBuffer struct {
+	mu      sync.Mutex
+	kept    []string
+	partial string // a line written without its newline yet
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := strings.Split(t.partial+string(p), "\n")
+	t.partial = lines[len(lines)-1]
+	t.kept = append(t.kept, lines[:len(lines)-1]...)
+	if len(t.kept) > 2*TailLines {
+		t.kept = append(t.kept[:0], t.kept[len(t.kept)-TailLines:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	kept := append([]string(nil), t.kept...)
+	if t.partial != "" {
+		kept = append(kept, t.partial)
+	}
+	return kept[max(0, len(kept)-TailLines):]
+}
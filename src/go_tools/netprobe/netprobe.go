@@ -0,0 +1,250 @@
+// Package netprobe measures the round trip from this machine to game
+// server regions over the WebSocket transport the game plays over, not
+// ICMP, which routes and queues differently: a connection's handshake,
+// then WebSocket pings it carries like game messages. Its report feeds
+// the latency between regions to the matchmaking simulator.
+package netprobe
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Defaults for Options left zero
+const (
+	DefaultCount    = 20
+	DefaultInterval = 200 * time.Millisecond
+	DefaultTimeout  = 2 * time.Second
+)
+
+// Target is a region's WebSocket endpoint, such as a relay's
+// ws://HOST:8097/ping
+type Target struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Options tune a probe
+type Options struct {
+	Count    int           // pings a region
+	Interval time.Duration // between pings
+	Timeout  time.Duration // for the handshake, and for a ping's pong before it counts as lost
+	Token    string        // presented to the regions, as auth.TokenEnv's would be
+}
+
+func (o *Options) defaults() {
+	if o.Count <= 0 {
+		o.Count = DefaultCount
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultTimeout
+	}
+}
+
+// Result is one region's measurements, in milliseconds
+type Result struct {
+	Region    string  `json:"region"`
+	URL       string  `json:"url"`
+	ConnectMs float64 `json:"connectMs"` // TCP, TLS and the WebSocket handshake
+	Sent      int     `json:"sent"`
+	Received  int     `json:"received"`
+	Loss      float64 `json:"loss"` // of pings sent, the share never answered in time
+	MinMs     float64 `json:"minMs"`
+	MeanMs    float64 `json:"meanMs"`
+	P50Ms     float64 `json:"p50Ms"`
+	P90Ms     float64 `json:"p90Ms"`
+	P99Ms     float64 `json:"p99Ms"`
+	MaxMs     float64 `json:"maxMs"`
+	JitterMs  float64 `json:"jitterMs"` // mean change between consecutive round trips, as RFC 3550 has it
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is a probe of every region from one place
+type Report struct {
+	From     string    `json:"from"` // the region probed from, as the matchmaking simulator names it
+	Measured time.Time `json:"measured"`
+	Regions  []Result  `json:"regions"`
+}
+
+// Run probes the targets at once, so each sees the same network, and
+// reports them in order
+func Run(ctx context.Context, from string, targets []Target, opts Options) Report {
+	opts.defaults()
+	rep := Report{From: from, Measured: time.Now().UTC(), Regions: make([]Result, len(targets))}
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rep.Regions[i] = Probe(ctx, t, opts)
+		}()
+	}
+	wg.Wait()
+	return rep
+}
+
+// Probe connects to a target and pings it opts.Count times
+func Probe(ctx context.Context, t Target, opts Options) Result {
+	opts.defaults()
+	res := Result{Region: t.Name, URL: t.URL}
+	header := http.Header{}
+	auth.SetHeader(header, opts.Token)
+	dialCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	start := time.Now()
+	conn, err := certs.Dial(dialCtx, t.URL, header)
+	cancel()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer conn.Close()
+	res.ConnectMs = ms(time.Since(start))
+
+	// pongs come back through the read loop; a ping's payload is its
+	// number, so late and reordered pongs are matched up
+	var mu sync.Mutex
+	sent := make([]time.Time, opts.Count)
+	rtts := make([]time.Duration, opts.Count)
+	conn.PongHandler = func(payload []byte) {
+		if len(payload) != 8 {
+			return
+		}
+		at := time.Now()
+		n := binary.BigEndian.Uint64(payload)
+		mu.Lock()
+		defer mu.Unlock()
+		if n < uint64(len(sent)) && rtts[n] == 0 && at.Sub(sent[n]) <= opts.Timeout {
+			rtts[n] = at.Sub(sent[n])
+		}
+	}
+	read := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				read <- err
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	var failed error
+pinging:
+	for i := 0; i < opts.Count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				failed = ctx.Err()
+				break pinging
+			case err := <-read:
+				failed = err
+				break pinging
+			case <-ticker.C:
+			}
+		}
+		mu.Lock()
+		sent[i] = time.Now()
+		mu.Unlock()
+		if err := conn.WritePing(binary.BigEndian.AppendUint64(nil, uint64(i))); err != nil {
+			failed = err
+			break
+		}
+		res.Sent++
+	}
+	if failed == nil {
+		// the last pings get their timeout to come back
+		select {
+		case <-time.After(opts.Timeout):
+		case err := <-read:
+			failed = err
+		case <-ctx.Done():
+		}
+	}
+	if failed != nil && !errors.Is(failed, context.Canceled) {
+		res.Error = failed.Error()
+	}
+	mu.Lock()
+	summarize(&res, rtts[:res.Sent])
+	mu.Unlock()
+	return res
+}
+
+// summarize fills in the statistics of the round trips, zero for pings
+// lost
+func summarize(res *Result, rtts []time.Duration) {
+	var got, ordered []float64
+	for _, d := range rtts {
+		if d > 0 {
+			got = append(got, ms(d))
+		}
+	}
+	res.Received = len(got)
+	if res.Sent > 0 {
+		res.Loss = 1 - float64(res.Received)/float64(res.Sent)
+	}
+	if len(got) == 0 {
+		return
+	}
+	sum, jitter := 0.0, 0.0
+	for i, v := range got {
+		sum += v
+		if i > 0 {
+			jitter += math.Abs(v - got[i-1])
+		}
+	}
+	res.MeanMs = sum / float64(len(got))
+	if len(got) > 1 {
+		res.JitterMs = jitter / float64(len(got)-1)
+	}
+	ordered = append(ordered, got...)
+	sort.Float64s(ordered)
+	res.MinMs, res.MaxMs = ordered[0], ordered[len(ordered)-1]
+	res.P50Ms, res.P90Ms, res.P99Ms = stats.Quantile(ordered, 0.5), stats.Quantile(ordered, 0.9), stats.Quantile(ordered, 0.99)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// ReadReport reads a report Save wrote
+func ReadReport(path string) (Report, error) {
+	var rep Report
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rep, err
+	}
+	if err := json.Unmarshal(data, &rep); err != nil {
+		return rep, fmt.Errorf("parse latency report %s: %w", path, err)
+	}
+	return rep, nil
+}
+
+// Save writes the report as JSON, replacing the file whole
+func (r Report) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
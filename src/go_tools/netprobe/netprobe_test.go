@@ -0,0 +1,38 @@
+package netprobe
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/relay"
+)
+
+func TestProbeRelay(t *testing.T) {
+	srv := httptest.NewServer(relay.NewServer(relay.Options{}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ping"
+	rep := Run(context.Background(), "eu", []Target{{Name: "local", URL: url}, {Name: "gone", URL: "ws://127.0.0.1:1/ping"}},
+		Options{Count: 5, Interval: 10 * time.Millisecond, Timeout: 500 * time.Millisecond})
+	local, gone := rep.Regions[0], rep.Regions[1]
+	if local.Error != "" || local.Sent != 5 || local.Received != 5 || local.Loss != 0 {
+		t.Fatalf("probing the relay: %+v", local)
+	}
+	if local.MinMs <= 0 || local.MinMs > local.P50Ms || local.P50Ms > local.MaxMs {
+		t.Errorf("round trips out of order: %+v", local)
+	}
+	if gone.Error == "" || gone.Sent != 0 {
+		t.Errorf("probing nothing: %+v", gone)
+	}
+
+	path := t.TempDir() + "/latency.json"
+	if err := rep.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadReport(path)
+	if err != nil || back.From != "eu" || len(back.Regions) != 2 || back.Regions[0].P50Ms != local.P50Ms {
+		t.Errorf("report read back: %+v %v", back, err)
+	}
+}
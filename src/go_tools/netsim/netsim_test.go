@@ -0,0 +1,175 @@
+package netsim
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+func TestParseScript(t *testing.T) {
+	s, err := ParseScript("150ms for 30s, then 2s outage, then latency 80ms jitter 40ms loss 2%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Phase{
+		{Conditions: Conditions{Latency: 150 * time.Millisecond}, For: 30 * time.Second},
+		{Conditions: Conditions{Outage: true}, For: 2 * time.Second},
+		{Conditions: Conditions{Latency: 80 * time.Millisecond, Jitter: 40 * time.Millisecond, Loss: 0.02}},
+	}
+	if fmt.Sprint(s.Phases) != fmt.Sprint(want) || s.Repeat {
+		t.Fatalf("script = %+v", s)
+	}
+	for at, want := range map[time.Duration]string{0: "latency 150ms", 31 * time.Second: "outage", time.Hour: "latency 80ms jitter 40ms loss 2%"} {
+		if got := s.At(at).String(); got != want {
+			t.Errorf("at %s = %s, want %s", at, got, want)
+		}
+	}
+
+	loop, err := ParseScript("latency=200ms reorder=5% for 10s; clear for 5s; repeat")
+	if err != nil || !loop.Repeat || loop.At(12*time.Second).String() != "clear" || loop.At(21*time.Second).Reorder != 0.05 {
+		t.Errorf("repeating script = %+v %v", loop, err)
+	}
+	if again, err := ParseScript(loop.String()); err != nil || again.String() != loop.String() {
+		t.Errorf("%q reads back as %q, %v", loop.String(), again.String(), err)
+	}
+
+	for _, bad := range []string{"", "150ms, then outage for 2s", "loss 150%", "fast", "clear for 1s, repeat, 2s outage", "clear, repeat"} {
+		if _, err := ParseScript(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+// echo is an upstream that sends every message back
+func echo(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteText("hello " + r.URL.Path)
+		for {
+			op, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(op, data)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dialProxy(t *testing.T, p *Proxy) *websocket.Conn {
+	t.Helper()
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/rooms/A", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readAll(t *testing.T, conn *websocket.Conn, wait time.Duration) []string {
+	t.Helper()
+	var got []string
+	conn.SetReadDeadline(time.Now().Add(wait))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return got
+		}
+		got = append(got, string(data))
+	}
+}
+
+func TestScriptedLossAndJitter(t *testing.T) {
+	c := Conditions{Latency: 100 * time.Millisecond, Jitter: 40 * time.Millisecond}
+	jitter := rng.NewScripted(nil, []float64{0, 0.5, 0.75})
+	for _, want := range []time.Duration{60 * time.Millisecond, 100 * time.Millisecond, 120 * time.Millisecond} {
+		if got := sample(c, jitter); got != want {
+			t.Errorf("delay %s, want %s", got, want)
+		}
+	}
+	if got := sample(Conditions{Latency: 10 * time.Millisecond, Jitter: time.Second}, rng.NewScripted(nil, []float64{0})); got != 0 {
+		t.Errorf("jitter past the latency delayed %s, want none", got)
+	}
+
+	// loss 50%: draws under a half drop the message, the rest are delayed
+	script, _ := ParseScript("latency 20ms loss 50%")
+	p, err := NewProxy("ws://127.0.0.1:1", script, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &link{proxy: p, random: rng.NewScripted(nil, []float64{0.1, 0.9, 0.4, 0.6}), opened: time.Now(), queue: make(chan delivery, 4)}
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		l.send(websocket.TextMessage, []byte(msg))
+	}
+	l.close()
+	var got []string
+	for d := range l.queue {
+		got = append(got, string(d.data))
+	}
+	if strings.Join(got, " ") != "b d" || p.Status().Dropped != 2 {
+		t.Errorf("delivered %q, status %+v", got, p.Status())
+	}
+}
+
+func TestProxyDelaysAndReorders(t *testing.T) {
+	script, _ := ParseScript("latency 40ms reorder 100%")
+	p, err := NewProxy(echo(t).URL, script, Options{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := dialProxy(t, p)
+	start := time.Now()
+	for i := 1; i <= 4; i++ {
+		conn.WriteText(fmt.Sprint(i))
+	}
+	got := readAll(t, conn, time.Second)
+	// each way, every other message is held for the next to overtake: the
+	// upstream hears 2 1 4 3, and its greeting is held for the first echo
+	if strings.Join(got, " ") != "2 hello /rooms/A 4 1 3" {
+		t.Errorf("got %q", got)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("round trips took %s, under twice the latency", elapsed)
+	}
+	if st := p.Status(); st.Connections != 1 || st.Reordered == 0 || st.Forwarded != 9 {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestProxyOutage(t *testing.T) {
+	script, _ := ParseScript("clear")
+	p, err := NewProxy(echo(t).URL, script, Options{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := dialProxy(t, p)
+	if got := readAll(t, conn, 200*time.Millisecond); len(got) != 1 {
+		t.Fatalf("greeting = %q", got)
+	}
+	p.SetScript(Script{Phases: []Phase{{Conditions: Conditions{Outage: true}, For: 300 * time.Millisecond}, {}}})
+	conn.WriteText("lost")
+	time.Sleep(400 * time.Millisecond)
+	conn.WriteText("through")
+	if got := readAll(t, conn, 300*time.Millisecond); strings.Join(got, " ") != "through" {
+		t.Errorf("after the outage got %q", got)
+	}
+	if st := p.Status(); st.Dropped != 1 || st.Conditions.Outage {
+		t.Errorf("status = %+v", st)
+	}
+}
@@ -0,0 +1,331 @@
+package netsim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+// StatusPath is where a proxy answers for itself instead of forwarding
+const StatusPath = "/netsim"
+
+// holdFor is how long past its time a reordered message waits for one to
+// overtake it before going anyway
+const holdFor = 100 * time.Millisecond
+
+// queueSize is how many delayed messages a direction of a connection holds
+const queueSize = 1024
+
+// Options tune a proxy
+type Options struct {
+	Seed          int64 // of the random choices, so a run repeats with the same traffic; 0 picks one
+	PerConnection bool  // run the script from each connection's opening rather than the proxy's start
+}
+
+// Stats counts what a proxy did to messages
+type Stats struct {
+	Connections int64 `json:"connections"`
+	Forwarded   int64 `json:"forwarded"`
+	Dropped     int64 `json:"dropped"` // lost, or sent in an outage
+	Reordered   int64 `json:"reordered"`
+}
+
+// Status describes a proxy
+type Status struct {
+	Upstream   string     `json:"upstream"`
+	Script     string     `json:"script"`
+	ElapsedMs  int64      `json:"elapsedMs"` // into the script, by the proxy's clock
+	Conditions Conditions `json:"conditions"`
+	Stats
+}
+
+// Proxy forwards WebSocket connections to an upstream server, message by
+// message, under a script's conditions in both directions; ordinary HTTP
+// requests are forwarded under its latency, or refused in an outage:
+//
+//	GET /netsim    the proxy's Status
+//	PUT /netsim    a new script as text, run from the start
+//
+// Any other path is the upstream's. A message lost or sent in an outage
+// never arrives; jitter doesn't reorder, only Reorder does.
+type Proxy struct {
+	upstream *url.URL
+	opts     Options
+	forward  *httputil.ReverseProxy
+
+	mu     sync.Mutex
+	script Script
+	start  time.Time
+	seeds  *rng.Xoshiro256 // seeds each connection direction's stream
+	stats  Stats
+}
+
+// NewProxy forwards to upstream, an http or ws URL, under script
+func NewProxy(upstream string, script Script, opts Options) (*Proxy, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws", "http":
+		u.Scheme = "http"
+	case "wss", "https":
+		u.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("upstream %s isn't an http or ws URL", upstream)
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	return &Proxy{upstream: u, opts: opts, forward: httputil.NewSingleHostReverseProxy(u), script: script,
+		start: time.Now(), seeds: rng.NewXoshiro(uint64(opts.Seed))}, nil
+}
+
+// SetScript replaces the script and runs it from the start
+func (p *Proxy) SetScript(script Script) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.script, p.start = script, time.Now()
+}
+
+// Status describes the proxy now
+func (p *Proxy) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elapsed := time.Since(p.start)
+	return Status{Upstream: p.upstream.String(), Script: p.script.String(), ElapsedMs: elapsed.Milliseconds(),
+		Conditions: p.script.At(elapsed), Stats: p.stats}
+}
+
+// conditions are the script's now, for a connection opened at opened
+func (p *Proxy) conditions(opened time.Time) Conditions {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	start := p.start
+	if p.opts.PerConnection {
+		start = opened
+	}
+	return p.script.At(time.Since(start))
+}
+
+func (p *Proxy) count(n *int64) {
+	p.mu.Lock()
+	*n++
+	p.mu.Unlock()
+}
+
+// ServeHTTP answers for the proxy or forwards the request
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == StatusPath {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			writeJSON(w, http.StatusOK, p.Status())
+		case http.MethodPut:
+			body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+			if err != nil {
+				httpError(w, http.StatusBadRequest, "read script: %v", err)
+				return
+			}
+			script, err := ParseScript(string(body))
+			if err != nil {
+				httpError(w, http.StatusBadRequest, "%v", err)
+				return
+			}
+			p.SetScript(script)
+			writeJSON(w, http.StatusOK, p.Status())
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		p.tunnel(w, r)
+		return
+	}
+	c := p.conditions(time.Now())
+	if c.Outage {
+		httpError(w, http.StatusServiceUnavailable, "network outage")
+		return
+	}
+	p.mu.Lock()
+	delay := sample(c, p.seeds)
+	p.mu.Unlock()
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+	p.forward.ServeHTTP(w, r)
+}
+
+// tunnel connects the client to the upstream at the same path and pipes
+// their messages both ways
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	u := *p.upstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	u.RawQuery = r.URL.RawQuery
+	header := http.Header{}
+	for _, name := range []string{"Authorization", "Cookie"} {
+		if v := r.Header.Values(name); len(v) > 0 {
+			header[name] = v
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	server, err := certs.Dial(ctx, u.String(), header)
+	if err != nil {
+		httpError(w, http.StatusBadGateway, "upstream: %v", err)
+		return
+	}
+	client, err := websocket.Upgrade(w, r)
+	if err != nil {
+		server.Close()
+		return
+	}
+	opened := time.Now()
+	p.mu.Lock()
+	p.stats.Connections++
+	up, down := rng.NewXoshiro(p.seeds.Uint64()), rng.NewXoshiro(p.seeds.Uint64())
+	p.mu.Unlock()
+
+	done := make(chan struct{}, 2)
+	go p.pipe(client, server, up, opened, done)
+	go p.pipe(server, client, down, opened, done)
+	<-done
+	client.Close()
+	server.Close()
+	<-done
+}
+
+// delivery is a message due to be written
+type delivery struct {
+	op   int
+	data []byte
+	due  time.Time
+}
+
+// link carries one direction of a connection
+type link struct {
+	proxy  *Proxy
+	random rng.RandomSource // loss, jitter and reordering draws
+	opened time.Time
+	queue  chan delivery
+
+	mu     sync.Mutex
+	last   time.Time // due time of the latest message queued
+	held   *delivery // waiting for the next message to overtake it
+	closed bool
+}
+
+// pipe forwards src's messages to dst until src ends, then delivers what
+// is still delayed
+func (p *Proxy) pipe(src, dst *websocket.Conn, random rng.RandomSource, opened time.Time, done chan<- struct{}) {
+	l := &link{proxy: p, random: random, opened: opened, queue: make(chan delivery, queueSize)}
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for d := range l.queue {
+			time.Sleep(time.Until(d.due))
+			if dst.WriteMessage(d.op, d.data) == nil {
+				p.count(&p.stats.Forwarded)
+			}
+		}
+	}()
+	for {
+		op, data, err := src.ReadMessage()
+		if err != nil {
+			break
+		}
+		l.send(op, data)
+	}
+	l.close()
+	<-written
+	done <- struct{}{}
+}
+
+// send decides a message's fate under the conditions now
+func (l *link) send(op int, data []byte) {
+	c := l.proxy.conditions(l.opened)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c.Outage || l.random.Float64() < c.Loss {
+		l.proxy.count(&l.proxy.stats.Dropped)
+		return
+	}
+	d := delivery{op: op, data: data, due: time.Now().Add(sample(c, l.random))}
+	if d.due.Before(l.last) {
+		d.due = l.last
+	}
+	if held := l.held; held != nil {
+		l.held = nil
+		l.emit(d)
+		held.due = d.due
+		l.emit(*held)
+		return
+	}
+	if c.Reorder > 0 && l.random.Float64() < c.Reorder {
+		l.held = &d
+		l.proxy.count(&l.proxy.stats.Reordered)
+		time.AfterFunc(time.Until(d.due)+holdFor, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.held == &d && !l.closed {
+				l.held = nil
+				l.emit(d)
+			}
+		})
+		return
+	}
+	l.emit(d)
+}
+
+// emit queues a delivery; l.mu is held
+func (l *link) emit(d delivery) {
+	if d.due.After(l.last) {
+		l.last = d.due
+	}
+	l.queue <- d
+}
+
+// close sends on any held message and ends the queue
+func (l *link) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held != nil {
+		l.emit(*l.held)
+		l.held = nil
+	}
+	l.closed = true
+	close(l.queue)
+}
+
+// sample is a message's delay under c
+func sample(c Conditions, random rng.RandomSource) time.Duration {
+	d := c.Latency
+	if c.Jitter > 0 {
+		d += time.Duration((random.Float64()*2 - 1) * float64(c.Jitter))
+	}
+	return max(d, 0)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
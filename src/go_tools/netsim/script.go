@@ -0,0 +1,248 @@
+// Package netsim puts bad networks between game clients and a server: a
+// proxy that delays, jitters, loses and reorders the messages it forwards
+// by a script of conditions over time, such as "150ms for 30s, then 2s
+// outage", so desync bugs seen on real networks reproduce on a desk
+package netsim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conditions are what a link does to the messages crossing it
+type Conditions struct {
+	Latency time.Duration `json:"latency"` // added to every message
+	Jitter  time.Duration `json:"jitter"`  // up to this, more or less, on top of Latency
+	Loss    float64       `json:"loss"`    // share of messages dropped, 0 to 1
+	Reorder float64       `json:"reorder"` // share held back so the next message overtakes them
+	Outage  bool          `json:"outage"`  // nothing gets through
+}
+
+// Phase is a span of a script under the same conditions
+type Phase struct {
+	Conditions
+	For time.Duration `json:"for"` // 0 for the rest of the script's time, in a last phase
+}
+
+// Script is conditions over time, from when a proxy starts or, per
+// connection, when a connection opens
+type Script struct {
+	Phases []Phase `json:"phases"`
+	Repeat bool    `json:"repeat"` // start over after the last phase
+}
+
+// At returns the conditions elapsed into the script
+func (s Script) At(elapsed time.Duration) Conditions {
+	if len(s.Phases) == 0 {
+		return Conditions{}
+	}
+	if total := s.length(); s.Repeat && total > 0 {
+		elapsed %= total
+	}
+	for _, p := range s.Phases {
+		if p.For == 0 || elapsed < p.For {
+			return p.Conditions
+		}
+		elapsed -= p.For
+	}
+	return s.Phases[len(s.Phases)-1].Conditions
+}
+
+func (s Script) length() time.Duration {
+	var total time.Duration
+	for _, p := range s.Phases {
+		total += p.For
+	}
+	return total
+}
+
+// ParseScript reads a script of phases separated by commas, semicolons or
+// "then", each a list of conditions with "for DURATION":
+//
+//	150ms for 30s, then 2s outage, then latency 80ms jitter 40ms loss 2%
+//	latency=200ms reorder=5% for 10s; clear for 5s; repeat
+//
+// A bare duration is latency, except in an outage, where it's how long
+// the outage lasts. "clear" is a phase of no conditions. The last phase
+// needs no duration and lasts from then on; a script ending in "repeat"
+// starts over instead, so every phase of it needs one.
+func ParseScript(text string) (Script, error) {
+	var s Script
+	for i, part := range splitPhases(text) {
+		words := strings.Fields(part)
+		if len(words) == 1 && strings.EqualFold(words[0], "repeat") {
+			s.Repeat = true
+			continue
+		}
+		if s.Repeat {
+			return s, fmt.Errorf("phase %d: repeat has to end the script", i+1)
+		}
+		p, err := parsePhase(words)
+		if err != nil {
+			return s, fmt.Errorf("phase %d %q: %w", i+1, part, err)
+		}
+		s.Phases = append(s.Phases, p)
+	}
+	if len(s.Phases) == 0 {
+		return s, fmt.Errorf("empty network script")
+	}
+	for i, p := range s.Phases {
+		if p.For == 0 && (s.Repeat || i < len(s.Phases)-1) {
+			return s, fmt.Errorf("phase %d needs a duration, with \"for\", to be followed", i+1)
+		}
+	}
+	return s, nil
+}
+
+func splitPhases(text string) []string {
+	text = strings.NewReplacer(",", "\n", ";", "\n", "=", " ").Replace(text)
+	var parts []string
+	var cur []string
+	flush := func() {
+		if len(cur) > 0 {
+			parts = append(parts, strings.Join(cur, " "))
+			cur = nil
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		for _, w := range strings.Fields(line) {
+			if strings.EqualFold(w, "then") {
+				flush()
+				continue
+			}
+			cur = append(cur, w)
+		}
+		flush()
+	}
+	return parts
+}
+
+func parsePhase(words []string) (Phase, error) {
+	var p Phase
+	var bare []time.Duration
+	for i := 0; i < len(words); i++ {
+		w := strings.ToLower(words[i])
+		next := func() (string, error) {
+			if i+1 >= len(words) {
+				return "", fmt.Errorf("%s needs a value", w)
+			}
+			i++
+			return words[i], nil
+		}
+		var err error
+		switch w {
+		case "outage", "down":
+			p.Outage = true
+		case "clear":
+		case "latency", "delay", "jitter", "for":
+			var v string
+			if v, err = next(); err == nil {
+				var d time.Duration
+				if d, err = parseDuration(v); err == nil {
+					switch w {
+					case "jitter":
+						p.Jitter = d
+					case "for":
+						p.For = d
+					default:
+						p.Latency = d
+					}
+				}
+			}
+		case "loss", "reorder":
+			var v string
+			if v, err = next(); err == nil {
+				var share float64
+				if share, err = parseShare(v); err == nil {
+					if w == "loss" {
+						p.Loss = share
+					} else {
+						p.Reorder = share
+					}
+				}
+			}
+		default:
+			var d time.Duration
+			if d, err = parseDuration(w); err != nil {
+				return p, fmt.Errorf("unknown condition %q", words[i])
+			}
+			bare = append(bare, d)
+		}
+		if err != nil {
+			return p, err
+		}
+	}
+	switch {
+	case len(bare) > 1:
+		return p, fmt.Errorf("more than one bare duration")
+	case len(bare) == 1 && p.Outage && p.For == 0:
+		p.For = bare[0]
+	case len(bare) == 1 && p.Latency == 0:
+		p.Latency = bare[0]
+	case len(bare) == 1:
+		return p, fmt.Errorf("bare duration %s and a latency", bare[0])
+	}
+	return p, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%q isn't a duration", s)
+	}
+	return d, nil
+}
+
+// parseShare reads 5% or 0.05
+func parseShare(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if strings.HasSuffix(s, "%") {
+		v /= 100
+	}
+	if err != nil || v < 0 || v > 1 {
+		return 0, fmt.Errorf("%q isn't a share, from 0%% to 100%%", s)
+	}
+	return v, nil
+}
+
+// String writes the conditions the way a script does
+func (c Conditions) String() string {
+	if c.Outage {
+		return "outage"
+	}
+	var parts []string
+	if c.Latency > 0 {
+		parts = append(parts, "latency "+c.Latency.String())
+	}
+	if c.Jitter > 0 {
+		parts = append(parts, "jitter "+c.Jitter.String())
+	}
+	if c.Loss > 0 {
+		parts = append(parts, "loss "+strconv.FormatFloat(c.Loss*100, 'g', -1, 64)+"%")
+	}
+	if c.Reorder > 0 {
+		parts = append(parts, "reorder "+strconv.FormatFloat(c.Reorder*100, 'g', -1, 64)+"%")
+	}
+	if len(parts) == 0 {
+		return "clear"
+	}
+	return strings.Join(parts, " ")
+}
+
+// String writes the script so ParseScript reads it back
+func (s Script) String() string {
+	parts := make([]string, 0, len(s.Phases)+1)
+	for _, p := range s.Phases {
+		part := p.Conditions.String()
+		if p.For > 0 {
+			part += " for " + p.For.String()
+		}
+		parts = append(parts, part)
+	}
+	if s.Repeat {
+		parts = append(parts, "repeat")
+	}
+	return strings.Join(parts, ", then ")
+}
@@ -0,0 +1,336 @@
+// Package notify tells webhooks, such as a Slack or Discord channel's,
+// when the tools' long jobs end: generation batches, analysis runs and
+// profiling runs, with a summary of what they did and links to what they
+// wrote
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Jobs a notifier reports
+const (
+	JobGenerate = "generate"
+	JobAnalyze  = "analyze"
+	JobProfile  = "profile"
+)
+
+// How a job ended
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Payload formats of a webhook
+const (
+	FormatSlack   = "slack"
+	FormatDiscord = "discord"
+	FormatJSON    = "json"
+)
+
+// Delivery: tries a webhook gets, and how long each may take
+const (
+	attempts       = 3
+	attemptTimeout = 10 * time.Second
+)
+
+// Artifact is a file or directory a job wrote
+type Artifact struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	URL  string `json:"url,omitempty"` // under the notifier's artifact URL
+}
+
+// Field is one figure of a job's summary, such as the levels made
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Event is what a webhook is told about a job, and the payload of the
+// json format
+type Event struct {
+	Job       string        `json:"job"`
+	Status    string        `json:"status"`
+	Summary   string        `json:"summary"`
+	Error     string        `json:"error,omitempty"`
+	Host      string        `json:"host"`
+	Command   string        `json:"command"`
+	Started   time.Time     `json:"started"`
+	Finished  time.Time     `json:"finished"`
+	Duration  time.Duration `json:"duration"`
+	Fields    []Field       `json:"fields,omitempty"`
+	Artifacts []Artifact    `json:"artifacts,omitempty"`
+}
+
+// Notifier sends events to the webhooks that asked for them. A nil
+// Notifier, as New makes without webhooks, sends nothing.
+type Notifier struct {
+	hooks       []utils.Webhook
+	artifactURL string
+	client      *http.Client
+}
+
+// New checks the webhooks and returns a notifier of them, or nil for none.
+// artifactURL, when set, is the base URL the working directory is served
+// under, so artifacts get links.
+func New(hooks []utils.Webhook, artifactURL string) (*Notifier, error) {
+	for i, h := range hooks {
+		if u, err := url.Parse(h.URL); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("webhook %d: %q isn't an http or https URL", i+1, h.URL)
+		}
+		switch h.Format {
+		case FormatSlack, FormatDiscord, FormatJSON, "":
+		default:
+			return nil, fmt.Errorf("webhook %d: unknown format %q, want slack, discord or json", i+1, h.Format)
+		}
+		for _, j := range h.Jobs {
+			if j != JobGenerate && j != JobAnalyze && j != JobProfile {
+				return nil, fmt.Errorf("webhook %d: unknown job %q, want generate, analyze or profile", i+1, j)
+			}
+		}
+		for _, s := range h.On {
+			if s != StatusSucceeded && s != StatusFailed {
+				return nil, fmt.Errorf("webhook %d: unknown status %q, want succeeded or failed", i+1, s)
+			}
+		}
+	}
+	if len(hooks) == 0 {
+		return nil, nil
+	}
+	return &Notifier{hooks: hooks, artifactURL: strings.TrimSuffix(artifactURL, "/"), client: &http.Client{Timeout: attemptTimeout}}, nil
+}
+
+// Job is a job being timed for its event
+type Job struct {
+	n     *Notifier
+	event Event
+}
+
+// Start starts timing a job of the kind; on a nil notifier too, so
+// callers needn't check
+func (n *Notifier) Start(job string) *Job {
+	host, _ := os.Hostname()
+	return &Job{n: n, event: Event{Job: job, Host: host, Command: strings.Join(os.Args, " "), Started: time.Now()}}
+}
+
+// Field adds a figure to the summary
+func (j *Job) Field(name string, format string, args ...any) {
+	j.event.Fields = append(j.event.Fields, Field{Name: name, Value: fmt.Sprintf(format, args...)})
+}
+
+// Artifact adds a file or directory the job wrote
+func (j *Job) Artifact(name, path string) {
+	j.event.Artifacts = append(j.event.Artifacts, Artifact{Name: name, Path: path, URL: j.n.link(path)})
+}
+
+// Succeed tells the webhooks the job succeeded
+func (j *Job) Succeed(summary string) error {
+	return j.finish(StatusSucceeded, summary, nil)
+}
+
+// Fail tells the webhooks the job failed with err
+func (j *Job) Fail(summary string, err error) error {
+	return j.finish(StatusFailed, summary, err)
+}
+
+func (j *Job) finish(status, summary string, err error) error {
+	ev := j.event
+	ev.Status, ev.Summary = status, summary
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	ev.Finished = time.Now()
+	ev.Duration = ev.Finished.Sub(ev.Started)
+	ctx, cancel := context.WithTimeout(context.Background(), attempts*attemptTimeout)
+	defer cancel()
+	return j.n.Send(ctx, ev)
+}
+
+// link is path's URL under the artifact URL, for paths inside the working
+// directory
+func (n *Notifier) link(path string) string {
+	if n == nil || n.artifactURL == "" {
+		return ""
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return n.artifactURL + "/" + strings.Join(parts, "/")
+}
+
+// Send posts the event to every webhook that asked for its job and status,
+// retrying failed deliveries, and returns the deliveries that failed
+func (n *Notifier) Send(ctx context.Context, ev Event) error {
+	if n == nil {
+		return nil
+	}
+	var errs []error
+	for _, h := range n.hooks {
+		if len(h.Jobs) > 0 && !slices.Contains(h.Jobs, ev.Job) || len(h.On) > 0 && !slices.Contains(h.On, ev.Status) {
+			continue
+		}
+		body, err := json.Marshal(payload(h.Format, ev))
+		if err != nil {
+			return err
+		}
+		if err := n.deliver(ctx, h.URL, body); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", redact(h.URL), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver posts body, trying again after server errors and rate limits
+func (n *Notifier) deliver(ctx context.Context, target string, body []byte) error {
+	var err error
+	for try := 0; try < attempts; try++ {
+		if try > 0 {
+			select {
+			case <-time.After(time.Duration(try) * time.Second):
+			case <-ctx.Done():
+				return err
+			}
+		}
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body)); err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		var resp *http.Response
+		if resp, err = n.client.Do(req); err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("%s", resp.Status)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+	}
+	return err
+}
+
+// redact drops the path of a webhook URL, which for Slack and Discord is
+// its secret, from error messages
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "?"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// payload is the event in a webhook's format
+func payload(format string, ev Event) any {
+	switch format {
+	case FormatSlack:
+		return slackPayload(ev)
+	case FormatDiscord:
+		return discordPayload(ev)
+	}
+	return ev
+}
+
+// headline is the event in a line
+func headline(ev Event) string {
+	return fmt.Sprintf("%s %s on %s after %s", ev.Job, ev.Status, ev.Host, ev.Duration.Round(time.Second))
+}
+
+func slackPayload(ev Event) any {
+	type field struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Short bool   `json:"short"`
+	}
+	type attachment struct {
+		Color  string  `json:"color"`
+		Text   string  `json:"text"`
+		Fields []field `json:"fields,omitempty"`
+	}
+	text := []string{ev.Summary}
+	if ev.Error != "" {
+		text = append(text, "```"+ev.Error+"```")
+	}
+	var links []string
+	for _, a := range ev.Artifacts {
+		if a.URL != "" {
+			links = append(links, fmt.Sprintf("<%s|%s>", a.URL, a.Name))
+		} else {
+			links = append(links, fmt.Sprintf("%s: `%s`", a.Name, a.Path))
+		}
+	}
+	if len(links) > 0 {
+		text = append(text, strings.Join(links, " · "))
+	}
+	att := attachment{Color: "good", Text: strings.Join(text, "\n")}
+	if ev.Status == StatusFailed {
+		att.Color = "danger"
+	}
+	for _, f := range ev.Fields {
+		att.Fields = append(att.Fields, field{Title: f.Name, Value: f.Value, Short: true})
+	}
+	return map[string]any{"text": headline(ev), "attachments": []attachment{att}}
+}
+
+func discordPayload(ev Event) any {
+	type field struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Inline bool   `json:"inline"`
+	}
+	type embed struct {
+		Title       string  `json:"title"`
+		Description string  `json:"description"`
+		Color       int     `json:"color"`
+		Fields      []field `json:"fields,omitempty"`
+		Timestamp   string  `json:"timestamp"`
+	}
+	desc := []string{ev.Summary}
+	if ev.Error != "" {
+		desc = append(desc, "```"+ev.Error+"```")
+	}
+	for _, a := range ev.Artifacts {
+		if a.URL != "" {
+			desc = append(desc, fmt.Sprintf("[%s](%s)", a.Name, a.URL))
+		} else {
+			desc = append(desc, fmt.Sprintf("%s: `%s`", a.Name, a.Path))
+		}
+	}
+	e := embed{Title: headline(ev), Description: strings.Join(desc, "\n"), Color: 0x2eb67d, Timestamp: ev.Finished.UTC().Format(time.RFC3339)}
+	if ev.Status == StatusFailed {
+		e.Color = 0xe01e5a
+	}
+	for _, f := range ev.Fields {
+		e.Fields = append(e.Fields, field{Name: f.Name, Value: f.Value, Inline: true})
+	}
+	return map[string]any{"content": headline(ev), "embeds": []embed{e}}
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// receiver records the bodies webhooks are posted, answering with the
+// statuses given, then 204
+type receiver struct {
+	mu       sync.Mutex
+	bodies   map[string][]map[string]any
+	statuses []int
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	rc := &receiver{bodies: make(map[string][]map[string]any), statuses: statuses}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		if len(rc.statuses) > 0 {
+			status := rc.statuses[0]
+			rc.statuses = rc.statuses[1:]
+			w.WriteHeader(status)
+			return
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		rc.bodies[r.URL.Path] = append(rc.bodies[r.URL.Path], body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return rc, srv
+}
+
+func TestNewRejectsBadWebhooks(t *testing.T) {
+	for _, h := range []utils.Webhook{
+		{URL: "ftp://hooks.example/x"},
+		{URL: "https://hooks.example/x", Format: "teams"},
+		{URL: "https://hooks.example/x", Jobs: []string{"deploy"}},
+		{URL: "https://hooks.example/x", On: []string{"started"}},
+	} {
+		if _, err := New([]utils.Webhook{h}, ""); err == nil {
+			t.Errorf("New(%+v) accepted", h)
+		}
+	}
+	n, err := New(nil, "")
+	if err != nil || n != nil {
+		t.Fatalf("New(nil) = %v, %v, want a nil notifier", n, err)
+	}
+	if err := n.Start(JobGenerate).Succeed("done"); err != nil {
+		t.Errorf("nil notifier: %v", err)
+	}
+}
+
+func TestSendFiltersAndFormats(t *testing.T) {
+	rc, srv := newReceiver(t)
+	n, err := New([]utils.Webhook{
+		{URL: srv.URL + "/slack", Format: FormatSlack},
+		{URL: srv.URL + "/discord", Format: FormatDiscord, On: []string{StatusFailed}},
+		{URL: srv.URL + "/json", Format: FormatJSON, Jobs: []string{JobGenerate}},
+	}, "https://artifacts.example/ci/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := n.Start(JobAnalyze)
+	job.Field("sessions", "%d", 12)
+	job.Artifact("reports", "reports/run 1")
+	if err := job.Succeed("analyzed 12 sessions"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rc.bodies["/discord"]) != 0 || len(rc.bodies["/json"]) != 0 {
+		t.Errorf("filtered webhooks were posted: %v", rc.bodies)
+	}
+	slack := rc.bodies["/slack"]
+	if len(slack) != 1 {
+		t.Fatalf("slack got %d posts, want 1", len(slack))
+	}
+	if text, _ := slack[0]["text"].(string); !strings.HasPrefix(text, "analyze succeeded on ") {
+		t.Errorf("slack text = %q", text)
+	}
+	att := slack[0]["attachments"].([]any)[0].(map[string]any)
+	if att["color"] != "good" {
+		t.Errorf("slack color = %v, want good", att["color"])
+	}
+	if text := att["text"].(string); !strings.Contains(text, "<https://artifacts.example/ci/reports/run%201|reports>") {
+		t.Errorf("slack attachment lacks the artifact link: %q", text)
+	}
+
+	job = n.Start(JobGenerate)
+	if err := job.Fail("batch failed after 3 levels", errors.New("disk full")); err != nil {
+		t.Fatal(err)
+	}
+	discord := rc.bodies["/discord"]
+	if len(discord) != 1 {
+		t.Fatalf("discord got %d posts, want 1", len(discord))
+	}
+	embed := discord[0]["embeds"].([]any)[0].(map[string]any)
+	if embed["color"] != float64(0xe01e5a) || !strings.Contains(embed["description"].(string), "disk full") {
+		t.Errorf("discord embed = %v", embed)
+	}
+	plain := rc.bodies["/json"]
+	if len(plain) != 1 || plain[0]["job"] != JobGenerate || plain[0]["status"] != StatusFailed || plain[0]["error"] != "disk full" {
+		t.Errorf("json posts = %v", plain)
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	rc, srv := newReceiver(t, http.StatusBadGateway, http.StatusTooManyRequests)
+	n, err := New([]utils.Webhook{{URL: srv.URL + "/hook", Format: FormatJSON}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(context.Background(), Event{Job: JobProfile, Status: StatusSucceeded}); err != nil {
+		t.Fatalf("Send after two failures: %v", err)
+	}
+	if len(rc.bodies["/hook"]) != 1 {
+		t.Errorf("got %d posts, want 1", len(rc.bodies["/hook"]))
+	}
+
+	rc.statuses = []int{http.StatusNotFound}
+	err = n.Send(context.Background(), Event{Job: JobProfile, Status: StatusSucceeded})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("Send to a missing hook = %v, want its 404", err)
+	}
+	if strings.Contains(err.Error(), "/hook") {
+		t.Errorf("error %q shows the webhook's path", err)
+	}
+	if len(rc.statuses) != 0 || len(rc.bodies["/hook"]) != 1 {
+		t.Errorf("a 404 was retried")
+	}
+}
@@ -0,0 +1,415 @@
+// Package openapi describes the tool servers' REST endpoints as OpenAPI
+// 3.0 documents, generated from the Go types they read and answer, and
+// versions their paths: each server's API is under /v1/, where its
+// document is too, and its unversioned paths keep working, answered with
+// Deprecation and Link headers naming the /v1/ path that replaces them.
+// Dashboards written against a document then keep working as the
+// handlers behind it change.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Version is the API's version, in the document and its paths
+const Version = "1"
+
+// Prefix is where the versioned API is served
+const Prefix = "/v" + Version
+
+// DocPath is where a server's document is served, under Prefix and not
+const DocPath = "/openapi.json"
+
+// Describer is a server with endpoints to describe
+type Describer interface {
+	DescribeAPI(spec *Spec)
+}
+
+// Op describes one endpoint
+type Op struct {
+	Method  string
+	Path    string // unversioned, with {name} for a path parameter, such as /packs/{pack}
+	Summary string
+	Params  map[string]string // what the path parameters are, by name; undocumented ones are strings
+	Query   []Param
+	Body    any // a value of the request body's type, sent as JSON, or a Raw
+	Status  int // of success; 0 for 200
+	Reply   any // a value of the answer's type, as JSON, or a Raw; nil for none
+}
+
+// Param is a query parameter
+type Param struct {
+	Name     string
+	Doc      string
+	Type     string // integer, number or boolean; empty for string
+	Required bool
+}
+
+// Raw is a body that isn't JSON, by its content type, such as image/png
+type Raw string
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components *Components         `json:"components,omitempty"`
+}
+
+// Components are the schemas operations refer to
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Info says what a document describes
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is where a document's paths are served, relative to it
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem is a path's operations, by lower case method
+type PathItem map[string]*Operation
+
+// Operation is one method on a path
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is what an operation reads
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is what an operation answers with a status
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is a body's schema under its content type
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Schema is a JSON schema, as far as Go types need one
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+// Error is how the servers answer a request they refuse
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Spec builds a server's document
+type Spec struct {
+	doc   Document
+	names map[reflect.Type]string // of the types given schemas
+	ops   [][]string              // path segments of the operations, for Has
+}
+
+// New is an empty document, for the server title names
+func New(title, description string) *Spec {
+	return &Spec{
+		doc: Document{OpenAPI: "3.0.3", Info: Info{Title: title, Description: description, Version: Version},
+			Servers: []Server{{URL: Prefix}}, Paths: map[string]PathItem{}},
+		names: map[reflect.Type]string{},
+	}
+}
+
+// Add describes an endpoint
+func (s *Spec) Add(op Op) {
+	o := &Operation{OperationID: operationID(op.Method, op.Path), Summary: op.Summary, Responses: map[string]Response{}}
+	for _, seg := range strings.Split(strings.Trim(op.Path, "/"), "/") {
+		if name, ok := param(seg); ok {
+			o.Parameters = append(o.Parameters, Parameter{Name: name, In: "path", Description: op.Params[name],
+				Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	for _, q := range op.Query {
+		typ := q.Type
+		if typ == "" {
+			typ = "string"
+		}
+		o.Parameters = append(o.Parameters, Parameter{Name: q.Name, In: "query", Description: q.Doc,
+			Required: q.Required, Schema: &Schema{Type: typ}})
+	}
+	if op.Body != nil {
+		o.RequestBody = &RequestBody{Required: true, Content: s.content(op.Body)}
+	}
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := Response{Description: http.StatusText(status)}
+	if op.Reply != nil {
+		ok.Content = s.content(op.Reply)
+	}
+	o.Responses[strconv.Itoa(status)] = ok
+	o.Responses["default"] = Response{Description: "an error", Content: s.content(Error{})}
+
+	item := s.doc.Paths[op.Path]
+	if item == nil {
+		item = PathItem{}
+		s.doc.Paths[op.Path] = item
+	}
+	item[strings.ToLower(op.Method)] = o
+	s.ops = append(s.ops, strings.Split(strings.Trim(op.Path, "/"), "/"))
+}
+
+// Document is the document so far
+func (s *Spec) Document() Document {
+	return s.doc
+}
+
+// Has reports whether an endpoint describes the unversioned path
+func (s *Spec) Has(path string) bool {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for _, op := range s.ops {
+		if len(op) != len(segs) {
+			continue
+		}
+		match := true
+		for i, seg := range op {
+			if _, ok := param(seg); !ok && seg != segs[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// param is the name of a path segment that is a parameter
+func param(seg string) (string, bool) {
+	if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+		return seg[1 : len(seg)-1], true
+	}
+	return "", false
+}
+
+// operationID names an operation for code generators: GET
+// /packs/{pack}/{version} is getPacksByPackByVersion
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name, ok := param(seg); ok {
+			b.WriteString("By")
+			seg = name
+		}
+		up := true
+		for _, r := range seg {
+			switch {
+			case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+				up = true
+			case up:
+				b.WriteRune(unicode.ToUpper(r))
+				up = false
+			default:
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// content is a body of v's type, or of a Raw's content type
+func (s *Spec) content(v any) map[string]MediaType {
+	if raw, ok := v.(Raw); ok {
+		return map[string]MediaType{string(raw): {Schema: &Schema{Type: "string", Format: "binary"}}}
+	}
+	return map[string]MediaType{"application/json": {Schema: s.schema(reflect.TypeOf(v))}}
+}
+
+var (
+	marshalerType = reflect.TypeFor[json.Marshaler]()
+	rawType       = reflect.TypeFor[json.RawMessage]()
+)
+
+// schema is t's JSON schema, a reference to it for a named struct, which
+// the document's components get
+func (s *Spec) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.PkgPath() == "time" && t.Name() == "Time":
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawType:
+		return &Schema{Description: "any JSON"}
+	case t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType):
+		return &Schema{Description: "JSON of its own encoding"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = s.componentName(t)
+			s.names[t] = name
+			if s.doc.Components == nil {
+				s.doc.Components = &Components{Schemas: map[string]*Schema{}}
+			}
+			// named before its fields, which may refer back to it
+			sch := &Schema{}
+			s.doc.Components.Schemas[name] = sch
+			*sch = *s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{Description: "any JSON"}
+}
+
+// componentName is a named type's schema's, its package and name, such
+// as relay.Room; unexported types are named as exported
+func (s *Spec) componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, t.Name())
+	name = pkg + "." + strings.ToUpper(name[:1]) + name[1:]
+	taken := map[string]bool{}
+	for _, n := range s.names {
+		taken[n] = true
+	}
+	for n, base := 2, name; taken[name]; n++ {
+		name = base + strconv.Itoa(n)
+	}
+	return name
+}
+
+// object is a struct's schema, its fields as encoding/json writes them
+func (s *Spec) object(t reflect.Type) *Schema {
+	o := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.fields(t, o)
+	sort.Strings(o.Required)
+	return o
+}
+
+func (s *Spec) fields(t reflect.Type, o *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				s.fields(ft, o)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		o.Properties[name] = s.schema(ft)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			o.Required = append(o.Required, name)
+		}
+	}
+}
+
+// Mount serves next's API under Prefix as well as where it was, and the
+// spec's document at DocPath under both. A request to an unversioned
+// path the spec describes is answered with a Deprecation header and a
+// Link to its successor under Prefix. Mount goes outside a server's other
+// middleware, so tokens are checked against the unversioned path.
+func Mount(spec *Spec, next http.Handler) http.Handler {
+	versioned := http.StripPrefix(Prefix, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == DocPath || r.URL.Path == Prefix+DocPath:
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				w.Header().Set("Allow", "GET, HEAD")
+				writeJSON(w, http.StatusMethodNotAllowed, Error{Error: "method " + r.Method + " not allowed"})
+				return
+			}
+			writeJSON(w, http.StatusOK, spec.Document())
+		case strings.HasPrefix(r.URL.Path, Prefix+"/"):
+			versioned.ServeHTTP(w, r)
+		default:
+			if spec.Has(r.URL.Path) {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Add("Link", "<"+Prefix+r.URL.RequestURI()+`>; rel="successor-version"`)
+			}
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,99 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type room struct {
+	Code    string    `json:"code"`
+	Created time.Time `json:"created"`
+	Host    string    `json:"host,omitempty"`
+	Peers   []peer    `json:"peers"`
+	Parent  *room     `json:"parent,omitempty"`
+	secret  string
+	Skipped string `json:"-"`
+}
+
+type peer struct {
+	Name  string `json:"name"`
+	Score int64  `json:"score"`
+	stats
+}
+
+type stats struct {
+	Sent  int64           `json:"sent"`
+	Extra map[string]bool `json:"extra,omitempty"`
+	Raw   json.RawMessage `json:"raw,omitempty"`
+	Bytes []byte          `json:"bytes,omitempty"`
+	Any   any             `json:"any,omitempty"`
+	Lag   float64         `json:"lag"`
+}
+
+func TestSpecSchemas(t *testing.T) {
+	s := New("relay", "rooms")
+	s.Add(Op{Method: http.MethodGet, Path: "/rooms/{code}", Summary: "one room", Params: map[string]string{"code": "the room's"},
+		Query: []Param{{Name: "limit", Type: "integer"}}, Reply: room{}})
+	s.Add(Op{Method: http.MethodPut, Path: "/packs/{pack}/{version}", Body: Raw("application/zip"), Status: http.StatusCreated, Reply: []peer{}})
+	doc := s.Document()
+
+	get := doc.Paths["/rooms/{code}"]["get"]
+	if get.OperationID != "getRoomsByCode" || len(get.Parameters) != 2 || get.Parameters[0].In != "path" || get.Parameters[1].Schema.Type != "integer" {
+		t.Errorf("get = %+v", get)
+	}
+	if ref := get.Responses["200"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/openapi.Room" {
+		t.Errorf("room reply refers to %q", ref)
+	}
+	put := doc.Paths["/packs/{pack}/{version}"]["put"]
+	if put.OperationID != "putPacksByPackByVersion" || put.RequestBody.Content["application/zip"].Schema.Format != "binary" {
+		t.Errorf("put = %+v", put)
+	}
+	if reply := put.Responses["201"].Content["application/json"].Schema; reply.Type != "array" || reply.Items.Ref != "#/components/schemas/openapi.Peer" {
+		t.Errorf("put reply = %+v", reply)
+	}
+
+	r := doc.Components.Schemas["openapi.Room"]
+	if strings.Join(r.Required, ",") != "code,created,peers" || r.Properties["created"].Format != "date-time" ||
+		r.Properties["parent"].Ref != "#/components/schemas/openapi.Room" || len(r.Properties) != 5 {
+		t.Errorf("room schema = %+v", r)
+	}
+	p := doc.Components.Schemas["openapi.Peer"]
+	if p.Properties["sent"].Type != "integer" || p.Properties["extra"].AdditionalProperties.Type != "boolean" ||
+		p.Properties["bytes"].Format != "byte" || p.Properties["lag"].Type != "number" || p.Properties["raw"].Type != "" {
+		t.Errorf("peer schema, with its embedded stats = %+v", p)
+	}
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMountVersions(t *testing.T) {
+	s := New("relay", "")
+	s.Add(Op{Method: http.MethodGet, Path: "/rooms/{code}"})
+	h := Mount(s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	for _, c := range []struct{ path, body, link string }{
+		{"/v1/rooms/GAME", "/rooms/GAME", ""},
+		{"/rooms/GAME?name=a", "/rooms/GAME", `</v1/rooms/GAME?name=a>; rel="successor-version"`},
+		{"/admin/", "/admin/", ""},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if w.Body.String() != c.body || w.Header().Get("Link") != c.link || (w.Header().Get("Deprecation") != "") != (c.link != "") {
+			t.Errorf("%s: %q with %v", c.path, w.Body, w.Header())
+		}
+	}
+	for _, path := range []string{DocPath, Prefix + DocPath} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var doc Document
+		if err := json.NewDecoder(w.Body).Decode(&doc); err != nil || doc.Info.Title != "relay" || doc.Servers[0].URL != Prefix {
+			t.Errorf("%s: %+v, %v", path, doc, err)
+		}
+	}
+}
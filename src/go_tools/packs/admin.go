@@ -0,0 +1,31 @@
+package packs
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/admin"
+)
+
+// RegisterAdmin adds the library's operations to a server's admin API:
+//
+//	POST /admin/packs/reload          reread every pack's versions from disk
+//	POST /admin/packs/{pack}/reload   reread one pack's
+func (s *Server) RegisterAdmin(a *admin.API) {
+	a.Handle("POST /admin/packs/reload", "reread every pack's versions from disk", func(w http.ResponseWriter, r *http.Request) {
+		s.reload(w, r, "")
+	})
+	a.Handle("POST /admin/packs/{pack}/reload", "reread one pack's versions from disk", func(w http.ResponseWriter, r *http.Request) {
+		s.reload(w, r, r.PathValue("pack"))
+	})
+}
+
+func (s *Server) reload(w http.ResponseWriter, r *http.Request, pack string) {
+	versions, err := s.lib.Reload(pack)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	slog.Info("packs: reloaded", "pack", pack, "versions", len(versions), "by", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, versions)
+}
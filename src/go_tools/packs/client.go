@@ -0,0 +1,141 @@
+package packs
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Client publishes to a packs server and fetches from it
+type Client struct {
+	base  string // scheme, host and any prefix, up to /packs
+	token string
+	http  *http.Client
+}
+
+// NewClient talks to the server at rawURL, such as http://host:8096. The
+// token of auth.TokenEnv, if set, is presented to the server.
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("packs server URL %s isn't http or https", rawURL)
+	}
+	u.RawQuery, u.Fragment = "", ""
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/packs")
+	return &Client{base: u.String(), token: os.Getenv(auth.TokenEnv), http: certs.HTTPClient(5 * time.Minute)}, nil
+}
+
+// Pack reads a pack's versions; a pack the server hasn't is ErrNotFound
+func (c *Client) Pack(name string) (*Pack, error) {
+	var p Pack
+	err := c.do(http.MethodGet, "/packs/"+url.PathEscape(name), nil, http.StatusOK, &p)
+	return &p, err
+}
+
+// Publish uploads a version's archive
+func (c *Client) Publish(pack, version string, archive []byte) (*Version, error) {
+	var v Version
+	err := c.do(http.MethodPut, "/packs/"+url.PathEscape(pack)+"/"+url.PathEscape(version), archive, http.StatusCreated, &v)
+	return &v, err
+}
+
+// Fetch downloads a version of a pack, or its Latest, into dir, which
+// mustn't exist yet. The archive must sum to the checksum the server
+// lists for it, and the batch in it verify as VerifyBatch verifies it
+// with keys; otherwise dir isn't written.
+func (c *Client) Fetch(pack, version, dir string, keys level.Verifier) (*Version, error) {
+	var v Version
+	if err := c.do(http.MethodGet, "/packs/"+url.PathEscape(pack)+"/"+url.PathEscape(version), nil, http.StatusOK, &v); err != nil {
+		return nil, err
+	}
+	// the version latest resolved to, so one published meanwhile isn't
+	// what's downloaded
+	var archive []byte
+	if err := c.do(http.MethodGet, "/packs/"+url.PathEscape(pack)+"/"+url.PathEscape(v.Version)+"/download", nil, http.StatusOK, &archive); err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(archive); hex.EncodeToString(sum[:]) != v.SHA256 {
+		return nil, fmt.Errorf("pack %s version %s: %s: %w", pack, v.Version, v.ArchiveName(), ErrCorrupt)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("pack %s version %s: %w", pack, v.Version, err)
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("%s exists already", dir)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".fetch-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractAll(zr, tmp); err != nil {
+		return nil, err
+	}
+	if err := VerifyBatch(tmp, keys); err != nil {
+		return nil, fmt.Errorf("pack %s version %s: %w", pack, v.Version, err)
+	}
+	if err := ValidateBatch(tmp); err != nil {
+		return nil, fmt.Errorf("pack %s version %s: %w", pack, v.Version, err)
+	}
+	return &v, os.Rename(tmp, dir)
+}
+
+// Withdraw takes a version off the server
+func (c *Client) Withdraw(pack, version string) error {
+	return c.do(http.MethodDelete, "/packs/"+url.PathEscape(pack)+"/"+url.PathEscape(version), nil, http.StatusNoContent, nil)
+}
+
+func (c *Client) do(method, path string, body []byte, want int, v any) error {
+	req, err := http.NewRequest(method, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/zip")
+	}
+	auth.SetHeader(req.Header, c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		var reply struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&reply)
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("packs server: %s: %w", reply.Error, ErrNotFound)
+		}
+		if reply.Error != "" {
+			return fmt.Errorf("packs server: %s: %s", resp.Status, reply.Error)
+		}
+		return fmt.Errorf("packs server: %s", resp.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	if raw, ok := v.(*[]byte); ok {
+		*raw, err = io.ReadAll(resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
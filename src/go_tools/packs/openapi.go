@@ -0,0 +1,27 @@
+package packs
+
+import (
+	"net/http"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+)
+
+// DescribeAPI adds the library's endpoints to a server's OpenAPI document
+func (s *Server) DescribeAPI(spec *openapi.Spec) {
+	version := map[string]string{"pack": "the pack's name", "version": "a version, or " + Latest + " for the newest"}
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/packs", Summary: "packs and their versions", Reply: []Pack{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/packs/{pack}", Summary: "one pack's versions",
+		Params: version, Reply: Pack{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/packs/{pack}/{version}", Summary: "a version's files, sizes and checksums",
+		Params: version, Reply: Version{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/packs/{pack}/{version}/download",
+		Summary: "the version as a zip; honours Range and If-None-Match", Params: version, Reply: openapi.Raw("application/zip")})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/packs/{pack}/{version}/checksums",
+		Summary: "sha256sum lines of its files and zip", Params: version, Reply: openapi.Raw("text/plain")})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/packs/{pack}/{version}/files/{file}",
+		Summary: "one file; honours Range and If-None-Match", Params: version, Reply: openapi.Raw("application/octet-stream")})
+	spec.Add(openapi.Op{Method: http.MethodPut, Path: "/packs/{pack}/{version}", Summary: "publish a version, its zip as the body",
+		Params: version, Body: openapi.Raw("application/zip"), Status: http.StatusCreated, Reply: Version{}})
+	spec.Add(openapi.Op{Method: http.MethodDelete, Path: "/packs/{pack}/{version}", Summary: "withdraw a version, as a rollback does",
+		Params: version, Status: http.StatusNoContent})
+}
@@ -0,0 +1,344 @@
+// Package packs serves generated level packs over HTTP, so test clients
+// and the launcher can pull content from a dev machine
+package packs
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Latest names a pack's newest version in place of a version
+const Latest = "latest"
+
+// Library is a directory of level packs, laid out as pack/version/ with a
+// generator batch, its levels and manifest, in each version. It is read
+// as requests come, so packs generated into it while it serves show up.
+type Library struct {
+	dir string
+
+	// Keys, when set, are the keys versions published must be signed by,
+	// as SignBatch signs them
+	Keys level.Verifier
+
+	mu    sync.Mutex
+	cache map[string]*Version // by pack/version, dropped when the files change
+}
+
+// NewLibrary serves the packs under dir
+func NewLibrary(dir string) *Library {
+	return &Library{dir: dir, cache: make(map[string]*Version)}
+}
+
+// Pack is one pack and the versions it has, oldest first
+type Pack struct {
+	Name     string   `json:"name"`
+	Versions []string `json:"versions"`
+	Latest   string   `json:"latest"`
+}
+
+// File is one file of a pack version
+type File struct {
+	Name       string  `json:"name"`
+	Bytes      int64   `json:"bytes"`
+	SHA256     string  `json:"sha256"`
+	Level      string  `json:"level,omitempty"` // from the manifest, for level files
+	Mode       string  `json:"mode,omitempty"`
+	Difficulty float64 `json:"difficulty,omitempty"`
+}
+
+// Version is one version of a pack: its files, and the archive of them
+// all a download serves
+type Version struct {
+	Pack      string    `json:"pack"`
+	Version   string    `json:"version"`
+	Generated time.Time `json:"generated,omitempty"` // from the manifest
+	Modified  time.Time `json:"modified"`            // the newest file's
+	Files     []File    `json:"files"`
+	Bytes     int64     `json:"bytes"`  // of the archive
+	SHA256    string    `json:"sha256"` // of the archive
+
+	dir       string
+	signature string
+	archive   []byte
+}
+
+// Archive is the version's files as a zip, the same bytes for the same
+// files, so its checksum and ranges of it hold across requests
+func (v *Version) Archive() []byte {
+	return v.archive
+}
+
+// ArchiveName is what a download of the version is saved as
+func (v *Version) ArchiveName() string {
+	return v.Pack + "-" + v.Version + ".zip"
+}
+
+// Path is where the version's file name is on disk
+func (v *Version) Path(name string) (string, bool) {
+	for _, f := range v.Files {
+		if f.Name == name {
+			return filepath.Join(v.dir, name), true
+		}
+	}
+	return "", false
+}
+
+// ErrNotFound is a pack, version or file the library doesn't have
+var ErrNotFound = errors.New("not found")
+
+// validName keeps a request's path segments inside the library
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".")
+}
+
+// Packs lists the library's packs by name
+func (l *Library) Packs() ([]Pack, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	out := []Pack{}
+	for _, e := range entries {
+		if !e.IsDir() || !validName(e.Name()) {
+			continue
+		}
+		p, err := l.Pack(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if len(p.Versions) > 0 {
+			out = append(out, *p)
+		}
+	}
+	return out, nil
+}
+
+// Pack reads one pack's versions
+func (l *Library) Pack(name string) (*Pack, error) {
+	if !validName(name) {
+		return nil, fmt.Errorf("pack %q: %w", name, ErrNotFound)
+	}
+	entries, err := os.ReadDir(filepath.Join(l.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("pack %q: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := &Pack{Name: name, Versions: []string{}}
+	for _, e := range entries {
+		if e.IsDir() && validName(e.Name()) && e.Name() != Latest {
+			p.Versions = append(p.Versions, e.Name())
+		}
+	}
+	sort.Slice(p.Versions, func(i, j int) bool { return VersionLess(p.Versions[i], p.Versions[j]) })
+	if len(p.Versions) > 0 {
+		p.Latest = p.Versions[len(p.Versions)-1]
+	}
+	return p, nil
+}
+
+// VersionLess orders versions like 1.2 < 1.10 < 2: dotted parts compare
+// as numbers where both are, as text otherwise
+func VersionLess(a, b string) bool {
+	as, bs := strings.Split(strings.TrimPrefix(a, "v"), "."), strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		x, errA := strconv.Atoi(as[i])
+		y, errB := strconv.Atoi(bs[i])
+		if errA == nil && errB == nil {
+			return x < y
+		}
+		return as[i] < bs[i]
+	}
+	return len(as) < len(bs)
+}
+
+// Version reads a pack version, or the newest for Latest. It is cached
+// until a file of it changes.
+func (l *Library) Version(pack, version string) (*Version, error) {
+	p, err := l.Pack(pack)
+	if err != nil {
+		return nil, err
+	}
+	if version == Latest {
+		version = p.Latest
+	}
+	found := false
+	for _, v := range p.Versions {
+		found = found || v == version
+	}
+	if !found {
+		return nil, fmt.Errorf("pack %q version %q: %w", pack, version, ErrNotFound)
+	}
+	dir := filepath.Join(l.dir, pack, version)
+	infos, sig, err := listFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	key := pack + "/" + version
+	l.mu.Lock()
+	cached := l.cache[key]
+	l.mu.Unlock()
+	if cached != nil && cached.signature == sig {
+		return cached, nil
+	}
+	v, err := readVersion(pack, version, dir, infos)
+	if err != nil {
+		return nil, fmt.Errorf("pack %q version %q: %w", pack, version, err)
+	}
+	v.signature = sig
+	l.mu.Lock()
+	l.cache[key] = v
+	l.mu.Unlock()
+	return v, nil
+}
+
+// Reload drops what the library cached of a pack, or of every pack for
+// "", and reads its versions again, so files replaced in place with the
+// same sizes and times are checksummed anew. It returns the versions read.
+func (l *Library) Reload(pack string) ([]*Version, error) {
+	var packs []Pack
+	if pack == "" {
+		all, err := l.Packs()
+		if err != nil {
+			return nil, err
+		}
+		packs = all
+	} else {
+		p, err := l.Pack(pack)
+		if err != nil {
+			return nil, err
+		}
+		packs = []Pack{*p}
+	}
+	l.mu.Lock()
+	for _, p := range packs {
+		for _, v := range p.Versions {
+			delete(l.cache, p.Name+"/"+v)
+		}
+	}
+	l.mu.Unlock()
+	out := []*Version{}
+	for _, p := range packs {
+		for _, version := range p.Versions {
+			v, err := l.Version(p.Name, version)
+			if err != nil {
+				return out, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// listFiles lists the files of a version directory, with a signature of
+// their names, sizes and times that changes when any of them does
+func listFiles(dir string) ([]os.FileInfo, string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	var infos []os.FileInfo
+	var sig strings.Builder
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !validName(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, "", err
+		}
+		infos = append(infos, info)
+		fmt.Fprintf(&sig, "%s %d %d\n", info.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return infos, sig.String(), nil
+}
+
+// ReadBatch reads a generator batch directory as the pack version it
+// would be, with the archive a library serving it would send
+func ReadBatch(pack, version, dir string) (*Version, error) {
+	infos, _, err := listFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return readVersion(pack, version, dir, infos)
+}
+
+// readVersion checksums a version's files and builds its archive
+func readVersion(pack, version, dir string, infos []os.FileInfo) (*Version, error) {
+	v := &Version{Pack: pack, Version: version, Files: []File{}, dir: dir}
+	levels := make(map[string]generator.BatchEntry)
+	if data, err := os.ReadFile(filepath.Join(dir, generator.ManifestFile)); err == nil {
+		var m generator.Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("%s: %w", generator.ManifestFile, err)
+		}
+		v.Generated = m.Generated
+		for _, e := range m.Levels {
+			levels[e.File] = e
+		}
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, info := range infos {
+		data, err := os.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		f := File{Name: info.Name(), Bytes: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+		if e, ok := levels[f.Name]; ok {
+			f.Level, f.Mode, f.Difficulty = e.Name, e.Mode, e.Difficulty
+		}
+		v.Files = append(v.Files, f)
+		if info.ModTime().After(v.Modified) {
+			v.Modified = info.ModTime()
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: info.ModTime().UTC()})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	v.archive = buf.Bytes()
+	sum := sha256.Sum256(v.archive)
+	v.Bytes, v.SHA256 = int64(len(v.archive)), hex.EncodeToString(sum[:])
+	return v, nil
+}
+
+// WriteChecksums writes the version's checksums as sha256sum prints them,
+// the archive's last
+func (v *Version) WriteChecksums(w io.Writer) error {
+	for _, f := range v.Files {
+		if _, err := fmt.Fprintf(w, "%s  %s\n", f.SHA256, f.Name); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s  %s\n", v.SHA256, v.ArchiveName())
+	return err
+}
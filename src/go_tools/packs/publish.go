@@ -0,0 +1,259 @@
+package packs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Errors publishing returns
+var (
+	ErrExists  = errors.New("already published")
+	ErrInvalid = errors.New("invalid pack")
+)
+
+// Version parts BumpVersion bumps
+const (
+	BumpMajor = "major"
+	BumpMinor = "minor"
+	BumpPatch = "patch"
+)
+
+// withdrawnPrefix starts the names versions are kept aside under once
+// withdrawn; validName hides them from the library
+const withdrawnPrefix = ".withdrawn-"
+
+// Bounds on what a batch's archive unpacks to, per file and for the
+// whole batch, so a small zip can't fill the disk
+const (
+	maxEntryBytes = 64 << 20
+	maxBatchBytes = 1 << 30
+)
+
+// ValidateBatch checks that dir is a batch fit to publish: a manifest
+// whose every level file is there, valid, named as it says and summing
+// to its checksum, no level twice and no level file it doesn't list
+func ValidateBatch(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, generator.ManifestFile))
+	if err != nil {
+		return fmt.Errorf("%w: no batch manifest: %v", ErrInvalid, err)
+	}
+	var m generator.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalid, generator.ManifestFile, err)
+	}
+	if len(m.Levels) == 0 {
+		return fmt.Errorf("%w: %s lists no levels", ErrInvalid, generator.ManifestFile)
+	}
+	var problems []error
+	listed := make(map[string]bool, len(m.Levels))
+	names := make(map[string]string, len(m.Levels))
+	for _, e := range m.Levels {
+		if !validName(e.File) || listed[e.File] {
+			problems = append(problems, fmt.Errorf("level %q has no file of its own", e.Name))
+			continue
+		}
+		listed[e.File] = true
+		lvl, err := level.Load(filepath.Join(dir, e.File))
+		if err == nil {
+			err = lvl.Validate()
+		}
+		switch {
+		case err != nil:
+			problems = append(problems, err)
+		case lvl.Name != e.Name:
+			problems = append(problems, fmt.Errorf("%s holds level %q, the manifest says %q", e.File, lvl.Name, e.Name))
+		case names[lvl.Name] != "":
+			problems = append(problems, fmt.Errorf("%s holds level %q, as %s does", e.File, lvl.Name, names[lvl.Name]))
+		default:
+			names[lvl.Name] = e.File
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if name := e.Name(); e.Type().IsRegular() && level.IsFile(name) && name != generator.ManifestFile && !listed[name] {
+			problems = append(problems, fmt.Errorf("%s isn't in the manifest", name))
+		}
+	}
+	if err := VerifyBatch(dir, nil); err != nil {
+		problems = append(problems, err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalid, errors.Join(problems...))
+	}
+	return nil
+}
+
+// BumpVersion returns the version after latest, a dotted version like
+// 1.4.2 or v2, bumping part of it and zeroing the parts after; the first
+// version, after "", is 1.0.0
+func BumpVersion(latest, part string) (string, error) {
+	if latest == "" {
+		return "1.0.0", nil
+	}
+	prefix := ""
+	if strings.HasPrefix(latest, "v") {
+		prefix, latest = "v", latest[1:]
+	}
+	var nums [3]int
+	fields := strings.Split(latest, ".")
+	if len(fields) > len(nums) {
+		return "", fmt.Errorf("version %s has more than three parts", latest)
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("version %s isn't numbers and dots, set the next one by hand", latest)
+		}
+		nums[i] = n
+	}
+	switch part {
+	case BumpMajor:
+		nums = [3]int{nums[0] + 1, 0, 0}
+	case BumpMinor:
+		nums = [3]int{nums[0], nums[1] + 1, 0}
+	case BumpPatch:
+		nums[2]++
+	default:
+		return "", fmt.Errorf("unknown version part %q, want major, minor or patch", part)
+	}
+	return fmt.Sprintf("%s%d.%d.%d", prefix, nums[0], nums[1], nums[2]), nil
+}
+
+// Add publishes a version of a pack from its archive, a zip of a batch's
+// files like a download's. The batch is validated, and appears whole or
+// not at all; a version published already is ErrExists.
+func (l *Library) Add(pack, version string, archive []byte) (*Version, error) {
+	if !validName(pack) || !validName(version) || version == Latest {
+		return nil, fmt.Errorf("%w: pack %q version %q isn't a name", ErrInvalid, pack, version)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	packDir := filepath.Join(l.dir, pack)
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(packDir, ".upload-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractAll(zr, tmp); err != nil {
+		return nil, err
+	}
+	if err := ValidateBatch(tmp); err != nil {
+		return nil, err
+	}
+	if l.Keys != nil {
+		if err := VerifyBatch(tmp, l.Keys); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+	}
+
+	l.mu.Lock()
+	dest := filepath.Join(packDir, version)
+	if _, err := os.Stat(dest); err == nil {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("pack %q version %q: %w", pack, version, ErrExists)
+	}
+	err = os.Rename(tmp, dest)
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return l.Version(pack, version)
+}
+
+// extractAll writes a batch's archive to dir, every entry a file of it
+// and none past maxEntryBytes, nor all of them past maxBatchBytes
+func extractAll(zr *zip.Reader, dir string) error {
+	left := int64(maxBatchBytes)
+	for _, f := range zr.File {
+		if !validName(f.Name) || f.FileInfo().IsDir() {
+			return fmt.Errorf("%w: archive entry %q isn't a file of the batch", ErrInvalid, f.Name)
+		}
+		limit := int64(maxEntryBytes)
+		if left < limit {
+			limit = left
+		}
+		n, err := extract(f, filepath.Join(dir, f.Name), limit)
+		if err != nil {
+			return err
+		}
+		left -= n
+	}
+	return nil
+}
+
+// extract writes a zip entry to path, with the entry's time so the
+// library's archive of it is the one uploaded, and returns its size. An
+// entry unpacking to more than limit bytes is refused, whatever its
+// header claims.
+func extract(f *zip.File, path string, limit int64) (int64, error) {
+	tooBig := fmt.Errorf("%w: %s unpacks to more than %d bytes", ErrInvalid, f.Name, limit)
+	if f.UncompressedSize64 > uint64(limit) {
+		return 0, tooBig
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s: %v", ErrInvalid, f.Name, err)
+	}
+	defer rc.Close()
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.CopyN(out, rc, limit+1)
+	if err == nil {
+		err = tooBig
+	} else if err == io.EOF {
+		err = nil
+	} else {
+		err = fmt.Errorf("%w: %s: %v", ErrInvalid, f.Name, err)
+	}
+	if err != nil {
+		out.Close()
+		return 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Chtimes(path, f.Modified, f.Modified)
+}
+
+// Withdraw takes a version out of the library, so latest is the version
+// before it again. It is kept aside under a name the library doesn't
+// list rather than deleted.
+func (l *Library) Withdraw(pack, version string) error {
+	if !validName(pack) || !validName(version) || version == Latest {
+		return fmt.Errorf("pack %q version %q: %w", pack, version, ErrNotFound)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	dir := filepath.Join(l.dir, pack, version)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("pack %q version %q: %w", pack, version, ErrNotFound)
+	}
+	aside := filepath.Join(l.dir, pack, fmt.Sprintf("%s%s-%d", withdrawnPrefix, version, time.Now().Unix()))
+	if err := os.Rename(dir, aside); err != nil {
+		return err
+	}
+	delete(l.cache, pack+"/"+version)
+	return nil
+}
@@ -0,0 +1,212 @@
+package packs
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeBatch writes a publishable batch of the levels to dir
+func writeBatch(t *testing.T, dir string, levels ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	for _, l := range levels {
+		entries = append(entries, `{"name":"`+l+`","mode":"standard","file":"`+l+`.json"}`)
+		data := `{"name":"` + l + `","grid_size":{"width":10,"height":20}}`
+		if err := os.WriteFile(filepath.Join(dir, l+".json"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest := `{"generated":"2024-06-01T12:00:00Z","levels":[` + strings.Join(entries, ",") + `]}`
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBumpVersion(t *testing.T) {
+	for _, c := range []struct{ latest, part, want string }{
+		{"", BumpMinor, "1.0.0"},
+		{"1.4.2", BumpPatch, "1.4.3"},
+		{"1.4.2", BumpMinor, "1.5.0"},
+		{"1.4.2", BumpMajor, "2.0.0"},
+		{"v2", BumpMinor, "v2.1.0"},
+		{"1.10", BumpPatch, "1.10.1"},
+	} {
+		if got, err := BumpVersion(c.latest, c.part); err != nil || got != c.want {
+			t.Errorf("BumpVersion(%q, %s) = %q %v, want %q", c.latest, c.part, got, err, c.want)
+		}
+	}
+	for _, bad := range [][2]string{{"beta", BumpMinor}, {"1.2.3.4", BumpPatch}, {"1.2", "huge"}} {
+		if _, err := BumpVersion(bad[0], bad[1]); err == nil {
+			t.Errorf("BumpVersion(%q, %s) took it", bad[0], bad[1])
+		}
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	dir := t.TempDir()
+	writeBatch(t, dir, "a1", "a2")
+	if err := ValidateBatch(dir); err != nil {
+		t.Fatalf("valid batch: %v", err)
+	}
+	for name, breakIt := range map[string]func(dir string){
+		"no manifest":    func(dir string) { os.Remove(filepath.Join(dir, "manifest.json")) },
+		"missing level":  func(dir string) { os.Remove(filepath.Join(dir, "a2.json")) },
+		"unlisted level": func(dir string) { os.WriteFile(filepath.Join(dir, "extra.json"), []byte(`{}`), 0644) },
+		"renamed level": func(dir string) {
+			os.WriteFile(filepath.Join(dir, "a2.json"), []byte(`{"name":"a1","grid_size":{"width":1,"height":1}}`), 0644)
+		},
+		"invalid level": func(dir string) { os.WriteFile(filepath.Join(dir, "a2.json"), []byte(`{"name":"a2"}`), 0644) },
+	} {
+		dir := t.TempDir()
+		writeBatch(t, dir, "a1", "a2")
+		breakIt(dir)
+		if err := ValidateBatch(dir); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestPublishAndWithdraw(t *testing.T) {
+	root := t.TempDir()
+	lib := NewLibrary(root)
+	srv := httptest.NewServer(NewServer(lib))
+	defer srv.Close()
+	c, err := NewClient(srv.URL + "/packs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Pack("arcade"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unpublished pack: %v", err)
+	}
+
+	batch := t.TempDir()
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		writeBatch(t, batch, "a1", "a2")
+		local, err := ReadBatch("arcade", version, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := c.Publish("arcade", version, local.Archive())
+		if err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+		if v.SHA256 != local.SHA256 || len(v.Files) != 3 {
+			t.Errorf("published %s: %+v, uploaded %s", version, v, local.SHA256)
+		}
+	}
+	if p, err := c.Pack("arcade"); err != nil || p.Latest != "1.1.0" {
+		t.Errorf("pack = %+v %v", p, err)
+	}
+	local, _ := ReadBatch("arcade", "1.1.0", batch)
+	if _, err := c.Publish("arcade", "1.1.0", local.Archive()); err == nil || !strings.Contains(err.Error(), "409") {
+		t.Errorf("republished: %v", err)
+	}
+	os.Remove(filepath.Join(batch, "a2.json"))
+	broken, _ := ReadBatch("arcade", "1.2.0", batch)
+	if _, err := c.Publish("arcade", "1.2.0", broken.Archive()); err == nil || !strings.Contains(err.Error(), "422") {
+		t.Errorf("broken batch: %v", err)
+	}
+	if _, err := c.Publish("arcade", "1.3.0", []byte("not a zip")); err == nil {
+		t.Error("published garbage")
+	}
+
+	if err := c.Withdraw("arcade", "1.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := c.Pack("arcade"); err != nil || p.Latest != "1.0.0" || len(p.Versions) != 1 {
+		t.Errorf("after withdrawing: %+v %v", p, err)
+	}
+	if err := c.Withdraw("arcade", "1.1.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("withdrawn twice: %v", err)
+	}
+	// kept aside, not deleted
+	if aside, _ := filepath.Glob(filepath.Join(root, "arcade", withdrawnPrefix+"1.1.0-*")); len(aside) != 1 {
+		t.Errorf("withdrawn version kept as %v", aside)
+	}
+}
+
+func TestAddRefusesArchivesThatUnpackTooBig(t *testing.T) {
+	zeros := make([]byte, maxEntryBytes+1)
+	bomb := func(lie bool) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		if lie {
+			// A header claiming a few bytes over a deflated stream of many
+			var deflated bytes.Buffer
+			fw, _ := flate.NewWriter(&deflated, flate.BestCompression)
+			fw.Write(zeros)
+			fw.Close()
+			w, err := zw.CreateRaw(&zip.FileHeader{Name: "a1.json", Method: zip.Deflate,
+				CompressedSize64: uint64(deflated.Len()), UncompressedSize64: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(deflated.Bytes())
+		} else {
+			w, err := zw.Create("a1.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(zeros)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	root := t.TempDir()
+	lib := NewLibrary(root)
+	for _, lie := range []bool{false, true} {
+		archive := bomb(lie)
+		if len(archive) > 1<<20 {
+			t.Fatalf("the bomb zipped to %d bytes", len(archive))
+		}
+		if _, err := lib.Add("arcade", "1.0.0", archive); !errors.Is(err, ErrInvalid) {
+			t.Errorf("a %d byte entry (header lying %v): %v", len(zeros), lie, err)
+		}
+	}
+	if left, _ := filepath.Glob(filepath.Join(root, "arcade", "*")); len(left) != 0 {
+		t.Errorf("the refused uploads left %v", left)
+	}
+}
+
+func TestRegistryRollBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "releases", "registry.json")
+	reg, err := ReadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	reg.Releases = []Release{{Pack: "arcade", Version: "1.2.0"}, {Pack: "puzzle", Version: "3.0.0"}, {Pack: "arcade", Version: "1.10.0"}}
+	if rel, err := reg.RollBack("arcade", now); err != nil || rel.Version != "1.10.0" {
+		t.Fatalf("roll back: %+v %v", rel, err)
+	}
+	if err := reg.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if reg, err = ReadRegistry(path); err != nil {
+		t.Fatal(err)
+	}
+	if cur, ok := reg.Current("arcade"); !ok || cur.Version != "1.2.0" {
+		t.Errorf("current = %+v %v", cur, ok)
+	}
+	// the next release still follows the rolled back one
+	if h := reg.Highest("arcade"); h != "1.10.0" {
+		t.Errorf("highest = %s", h)
+	}
+	reg.RollBack("arcade", now)
+	if _, err := reg.RollBack("arcade", now); err == nil {
+		t.Error("rolled back past the first release")
+	}
+}
@@ -0,0 +1,93 @@
+package packs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Release is one version publish put out
+type Release struct {
+	Pack       string    `json:"pack"`
+	Version    string    `json:"version"`
+	SHA256     string    `json:"sha256"` // of the archive
+	Levels     int       `json:"levels"`
+	Source     string    `json:"source"`   // batch directory published
+	Endpoint   string    `json:"endpoint"` // packs server it went to
+	Published  time.Time `json:"published"`
+	RolledBack time.Time `json:"rolledBack,omitempty"` // zero while it stands
+}
+
+// Registry is the local record of releases, oldest first, kept so a
+// release can be rolled back and the next version follows the last
+type Registry struct {
+	Releases []Release `json:"releases"`
+}
+
+// ReadRegistry reads a registry file; a missing one is empty
+func ReadRegistry(path string) (*Registry, error) {
+	reg := &Registry{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, reg); err != nil {
+		return nil, fmt.Errorf("parse pack registry %s: %w", path, err)
+	}
+	return reg, nil
+}
+
+// Save writes the registry, replacing the file whole
+func (r *Registry) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Current is a pack's newest release not rolled back
+func (r *Registry) Current(pack string) (Release, bool) {
+	for i := len(r.Releases) - 1; i >= 0; i-- {
+		if rel := r.Releases[i]; rel.Pack == pack && rel.RolledBack.IsZero() {
+			return rel, true
+		}
+	}
+	return Release{}, false
+}
+
+// Highest is the highest version of a pack ever released, rolled back or
+// not, since clients may have cached a version under its name
+func (r *Registry) Highest(pack string) string {
+	highest := ""
+	for _, rel := range r.Releases {
+		if rel.Pack == pack && (highest == "" || VersionLess(highest, rel.Version)) {
+			highest = rel.Version
+		}
+	}
+	return highest
+}
+
+// RollBack marks a pack's current release rolled back, returning it
+func (r *Registry) RollBack(pack string, at time.Time) (Release, error) {
+	for i := len(r.Releases) - 1; i >= 0; i-- {
+		if rel := &r.Releases[i]; rel.Pack == pack && rel.RolledBack.IsZero() {
+			rel.RolledBack = at.UTC()
+			return *rel, nil
+		}
+	}
+	return Release{}, fmt.Errorf("pack %q has no release to roll back", pack)
+}
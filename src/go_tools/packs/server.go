@@ -0,0 +1,221 @@
+package packs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Cache lifetimes: a named version may be regenerated on a dev machine, so
+// it is kept for a while and revalidated by its ETag after; what latest or
+// the listings point at is revalidated every time
+const (
+	versionCache = "public, max-age=300"
+	listingCache = "no-cache"
+)
+
+// maxArchiveBytes bounds a published version's zip
+const maxArchiveBytes = 256 << 20
+
+// Server exposes a library over HTTP:
+//
+//	GET /packs                                 packs and their versions
+//	GET /packs/{pack}                          one pack's versions
+//	GET /packs/{pack}/{version}                a version's files, sizes and checksums; latest for the newest
+//	GET /packs/{pack}/{version}/download       the version as a zip
+//	GET /packs/{pack}/{version}/checksums      sha256sum lines of its files and zip
+//	GET /packs/{pack}/{version}/files/{file}   one file
+//	PUT /packs/{pack}/{version}                publish a version, its zip as the body
+//	DELETE /packs/{pack}/{version}             withdraw a version, as a rollback does
+//
+// Downloads and files honour Range and If-None-Match, so an interrupted
+// pull resumes and an unchanged pack isn't sent again. A version is
+// published once; a fix is a new version. RegisterAdmin adds reloading
+// packs to a server's admin API.
+type Server struct {
+	lib *Library
+}
+
+// NewServer serves lib
+func NewServer(lib *Library) *Server {
+	return &Server{lib: lib}
+}
+
+// ServeHTTP routes the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 3 && parts[0] == "packs" && (r.Method == http.MethodPut || r.Method == http.MethodDelete) {
+		s.publish(w, r, parts[1], parts[2])
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		allow := "GET, HEAD"
+		if len(parts) == 3 {
+			allow += ", PUT, DELETE"
+		}
+		w.Header().Set("Allow", allow)
+		httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if parts[0] != "packs" {
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+		return
+	}
+	switch len(parts) {
+	case 1:
+		packs, err := s.lib.Packs()
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		writeCached(w, r, packs, listingCache)
+	case 2:
+		p, err := s.lib.Pack(parts[1])
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		if len(p.Versions) == 0 {
+			s.fail(w, fmt.Errorf("pack %q has no versions: %w", p.Name, ErrNotFound))
+			return
+		}
+		writeCached(w, r, p, listingCache)
+	default:
+		v, err := s.lib.Version(parts[1], parts[2])
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		cache := versionCache
+		if parts[2] == Latest {
+			cache = listingCache
+		}
+		s.version(w, r, v, parts[3:], cache)
+	}
+}
+
+// version serves a version's metadata, download, checksums or a file
+func (s *Server) version(w http.ResponseWriter, r *http.Request, v *Version, rest []string, cache string) {
+	switch {
+	case len(rest) == 0:
+		writeCached(w, r, v, cache)
+	case len(rest) == 1 && rest[0] == "download":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", v.ArchiveName()))
+		w.Header().Set("Cache-Control", cache)
+		w.Header().Set("ETag", `"`+v.SHA256+`"`)
+		http.ServeContent(w, r, v.ArchiveName(), v.Modified, bytes.NewReader(v.Archive()))
+	case len(rest) == 1 && rest[0] == "checksums":
+		var buf bytes.Buffer
+		v.WriteChecksums(&buf)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", cache)
+		w.Header().Set("ETag", `"`+v.SHA256+`"`)
+		http.ServeContent(w, r, "", v.Modified, bytes.NewReader(buf.Bytes()))
+	case len(rest) == 2 && rest[0] == "files":
+		path, ok := v.Path(rest[1])
+		if !ok {
+			httpError(w, http.StatusNotFound, "pack %q version %q has no file %q", v.Pack, v.Version, rest[1])
+			return
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		for _, file := range v.Files {
+			if file.Name == rest[1] {
+				w.Header().Set("ETag", `"`+file.SHA256+`"`)
+			}
+		}
+		w.Header().Set("Cache-Control", cache)
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	default:
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+	}
+}
+
+// publish adds or withdraws a version
+func (s *Server) publish(w http.ResponseWriter, r *http.Request, pack, version string) {
+	if r.Method == http.MethodDelete {
+		if err := s.lib.Withdraw(pack, version); err != nil {
+			s.fail(w, err)
+			return
+		}
+		slog.Info("packs: version withdrawn", "pack", pack, "version", version, "by", r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	archive, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxArchiveBytes))
+	if err != nil {
+		httpError(w, http.StatusRequestEntityTooLarge, "read archive: larger than %d bytes or %v", maxArchiveBytes, err)
+		return
+	}
+	v, err := s.lib.Add(pack, version, archive)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	slog.Info("packs: version published", "pack", pack, "version", version, "sha256", v.SHA256, "by", r.RemoteAddr)
+	writeJSON(w, http.StatusCreated, v)
+}
+
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		httpError(w, http.StatusNotFound, "%v", err)
+	case errors.Is(err, ErrExists):
+		httpError(w, http.StatusConflict, "%v", err)
+	case errors.Is(err, ErrInvalid):
+		httpError(w, http.StatusUnprocessableEntity, "%v", err)
+	default:
+		httpError(w, http.StatusInternalServerError, "%v", err)
+	}
+}
+
+// writeCached writes v as JSON with an ETag of it, and nothing but 304
+// to a client that has it already
+func writeCached(w http.ResponseWriter, r *http.Request, v any, cache string) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cache)
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == etag || match == "*") {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(append(data, '\n'))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
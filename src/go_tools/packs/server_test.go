@@ -0,0 +1,179 @@
+package packs
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePack writes a version of a pack with one level and its manifest
+func writePack(t *testing.T, root, pack, version, level string) {
+	t.Helper()
+	dir := filepath.Join(root, pack, version)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"generated":"2024-06-01T12:00:00Z","levels":[{"name":"` + level + `","mode":"standard","difficulty":0.4,"file":"` + level + `.json"}]}`
+	for name, data := range map[string]string{level + ".json": `{"name":"` + level + `"}`, "manifest.json": manifest} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func get(t *testing.T, url string, header map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestServerListsAndDownloads(t *testing.T) {
+	root := t.TempDir()
+	writePack(t, root, "arcade", "1.2", "a1")
+	writePack(t, root, "arcade", "1.10", "a2")
+	writePack(t, root, "puzzle", "1", "p1")
+	srv := httptest.NewServer(NewServer(NewLibrary(root)))
+	defer srv.Close()
+
+	resp, body := get(t, srv.URL+"/packs", nil)
+	var list []Pack
+	if err := json.Unmarshal(body, &list); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("list: %s %s", resp.Status, body)
+	}
+	if len(list) != 2 || list[0].Name != "arcade" || list[0].Latest != "1.10" || strings.Join(list[0].Versions, ",") != "1.2,1.10" {
+		t.Errorf("packs = %+v", list)
+	}
+	if resp.Header.Get("Cache-Control") != listingCache {
+		t.Errorf("listing cached as %q", resp.Header.Get("Cache-Control"))
+	}
+	resp, _ = get(t, srv.URL+"/packs", map[string]string{"If-None-Match": resp.Header.Get("ETag")})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("revalidated listing: %s", resp.Status)
+	}
+
+	_, body = get(t, srv.URL+"/packs/arcade/latest", nil)
+	var v Version
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != "1.10" || len(v.Files) != 2 || !v.Generated.Equal(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("latest = %+v", v)
+	}
+	level := v.Files[0]
+	sum := sha256.Sum256([]byte(`{"name":"a2"}`))
+	if level.Name != "a2.json" || level.Level != "a2" || level.Difficulty != 0.4 || level.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("level file = %+v", level)
+	}
+
+	resp, archive := get(t, srv.URL+"/packs/arcade/1.10/download", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Cache-Control") != versionCache || resp.Header.Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("download: %s %v", resp.Status, resp.Header)
+	}
+	sum = sha256.Sum256(archive)
+	if int64(len(archive)) != v.Bytes || hex.EncodeToString(sum[:]) != v.SHA256 {
+		t.Errorf("archive of %d bytes doesn't match its metadata %+v", len(archive), v)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil || len(zr.File) != 2 {
+		t.Fatalf("archive: %v", err)
+	}
+	resp, part := get(t, srv.URL+"/packs/arcade/1.10/download", map[string]string{"Range": "bytes=10-19"})
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(part, archive[10:20]) {
+		t.Errorf("range: %s, %d bytes", resp.Status, len(part))
+	}
+	resp, _ = get(t, srv.URL+"/packs/arcade/1.10/download", map[string]string{"If-None-Match": `"` + v.SHA256 + `"`})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("revalidated download: %s", resp.Status)
+	}
+
+	_, sums := get(t, srv.URL+"/packs/arcade/1.10/checksums", nil)
+	if !strings.Contains(string(sums), level.SHA256+"  a2.json\n") || !strings.HasSuffix(string(sums), v.SHA256+"  arcade-1.10.zip\n") {
+		t.Errorf("checksums =\n%s", sums)
+	}
+	resp, file := get(t, srv.URL+"/packs/arcade/1.10/files/a2.json", nil)
+	if resp.StatusCode != http.StatusOK || string(file) != `{"name":"a2"}` {
+		t.Errorf("file: %s %s", resp.Status, file)
+	}
+
+	for _, path := range []string{"/packs/arcade/2.0", "/packs/none", "/packs/arcade/1.10/files/..%2F..%2Fpuzzle", "/packs/../arcade", "/other"} {
+		if resp, _ := get(t, srv.URL+path, nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: %s, want 404", path, resp.Status)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/packs", nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("post: %v %v", resp, err)
+	}
+}
+
+func TestLibraryRereadsChangedVersions(t *testing.T) {
+	root := t.TempDir()
+	writePack(t, root, "arcade", "1", "a1")
+	lib := NewLibrary(root)
+	before, err := lib.Version("arcade", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := lib.Version("arcade", "1"); again != before {
+		t.Error("unchanged version read again")
+	}
+	path := filepath.Join(root, "arcade", "1", "a1.json")
+	if err := os.WriteFile(path, []byte(`{"name":"a1","blocks":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	after, err := lib.Version("arcade", "1")
+	if err != nil || after.SHA256 == before.SHA256 {
+		t.Errorf("regenerated version kept its checksum: %v", err)
+	}
+
+	// a file replaced in place, as a copy keeping times does, goes unnoticed
+	// until the pack is reloaded
+	info, _ := os.Stat(path)
+	if err := os.WriteFile(path, []byte(`{"name":"a1","blocks":{}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+	if stale, _ := lib.Version("arcade", "1"); stale != after {
+		t.Fatal("version reread though its files look the same")
+	}
+	reloaded, err := lib.Reload("arcade")
+	if err != nil || len(reloaded) != 1 || reloaded[0].SHA256 == after.SHA256 {
+		t.Errorf("reload = %v, %v", reloaded, err)
+	}
+	if _, err := lib.Reload("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("reload a missing pack: %v", err)
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	ordered := []string{"1", "1.2", "1.10", "2", "v3", "beta"}
+	for i := 1; i < len(ordered); i++ {
+		if !VersionLess(ordered[i-1], ordered[i]) || VersionLess(ordered[i], ordered[i-1]) {
+			t.Errorf("%s vs %s", ordered[i-1], ordered[i])
+		}
+	}
+}
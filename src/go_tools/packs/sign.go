@@ -0,0 +1,131 @@
+package packs
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Errors of a pack's integrity
+var (
+	// ErrCorrupt is a pack file whose checksum isn't the one its manifest
+	// or the server lists: a download cut short or damaged, or a file
+	// changed since
+	ErrCorrupt    = errors.New("checksum mismatch")
+	ErrUnsigned   = errors.New("pack is unsigned")
+	ErrUnknownKey = errors.New("pack is signed by an unknown key")
+	ErrTampered   = errors.New("pack was modified after it was signed")
+)
+
+// manifestContent is what a manifest's signature covers: its JSON
+// without the signature
+func manifestContent(m generator.Manifest) ([]byte, error) {
+	m.Signature = nil
+	return json.Marshal(m)
+}
+
+// SignBatch signs the batch in dir as a pack with key: each level file
+// it lists, rewritten in its format, and then the manifest, with every
+// file's checksum, so the signature covers them all
+func SignBatch(dir string, key replay.Key) error {
+	if key.Private == nil {
+		return fmt.Errorf("key %s has no private half to sign with", key.ID)
+	}
+	m, err := generator.ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+	for i, e := range m.Levels {
+		path := filepath.Join(dir, e.File)
+		lvl, err := level.Load(path)
+		if err != nil {
+			return err
+		}
+		if err := lvl.Sign(key.ID, key.Private); err != nil {
+			return err
+		}
+		if err := lvl.Save(path); err != nil {
+			return err
+		}
+		if m.Levels[i].SHA256, err = generator.FileHash(path); err != nil {
+			return err
+		}
+	}
+	data, err := manifestContent(*m)
+	if err != nil {
+		return err
+	}
+	m.Signature = &level.Signature{KeyID: key.ID, Sig: ed25519.Sign(key.Private, data)}
+	return generator.WriteManifest(dir, *m)
+}
+
+// VerifyBatch checks the batch in dir is whole: each level file its
+// manifest has a checksum of still sums to it. With keys it must be
+// signed, the manifest and each level by one of them, and every file
+// checksummed.
+func VerifyBatch(dir string, keys level.Verifier) error {
+	m, err := generator.ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+	if keys != nil {
+		if err := verifyManifest(*m, keys); err != nil {
+			return err
+		}
+	}
+	var problems []error
+	for _, e := range m.Levels {
+		path := filepath.Join(dir, e.File)
+		if e.SHA256 == "" {
+			if keys != nil {
+				problems = append(problems, fmt.Errorf("%s has no checksum in the manifest", e.File))
+			}
+			continue
+		}
+		sum, err := generator.FileHash(path)
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		if sum != e.SHA256 {
+			problems = append(problems, fmt.Errorf("%s: %w", e.File, ErrCorrupt))
+			continue
+		}
+		if keys == nil {
+			continue
+		}
+		lvl, err := level.Load(path)
+		if err == nil {
+			err = lvl.Verify(keys)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", e.File, err))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// verifyManifest checks one of the keys signed the manifest as it is
+func verifyManifest(m generator.Manifest, keys level.Verifier) error {
+	if m.Signature == nil {
+		return fmt.Errorf("%s: %w", generator.ManifestFile, ErrUnsigned)
+	}
+	pub, ok := keys.PublicKey(m.Signature.KeyID)
+	if !ok {
+		return fmt.Errorf("%s: %w %s", generator.ManifestFile, ErrUnknownKey, m.Signature.KeyID)
+	}
+	data, err := manifestContent(m)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, data, m.Signature.Sig) {
+		return fmt.Errorf("%s: %w", generator.ManifestFile, ErrTampered)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package packs
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// signedBatch writes a batch of the levels to dir signed with a new key,
+// returning the keys that verify it
+func signedBatch(t *testing.T, dir string, levels ...string) *replay.Keys {
+	t.Helper()
+	writeBatch(t, dir, levels...)
+	key, err := replay.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignBatch(dir, key); err != nil {
+		t.Fatal(err)
+	}
+	return (&replay.Keys{Keys: []replay.Key{key}}).Public()
+}
+
+func TestSignAndVerifyBatch(t *testing.T) {
+	dir := t.TempDir()
+	writeBatch(t, dir, "a1", "a2")
+	if err := VerifyBatch(dir, nil); err != nil {
+		t.Errorf("unchecksummed batch without keys: %v", err)
+	}
+	if err := VerifyBatch(dir, (&replay.Keys{}).Public()); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned batch with keys: %v", err)
+	}
+
+	keys := signedBatch(t, dir, "a1", "a2")
+	if err := VerifyBatch(dir, keys); err != nil {
+		t.Fatalf("signed batch: %v", err)
+	}
+	if err := ValidateBatch(dir); err != nil {
+		t.Errorf("signed batch invalid: %v", err)
+	}
+	m, _ := generator.ReadManifest(dir)
+	for _, e := range m.Levels {
+		if e.SHA256 == "" {
+			t.Errorf("%s has no checksum", e.File)
+		}
+	}
+	if err := VerifyBatch(dir, (&replay.Keys{}).Public()); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("other keys: %v", err)
+	}
+
+	for name, breakIt := range map[string]func(dir string){
+		"corrupt level": func(dir string) {
+			f, _ := os.OpenFile(filepath.Join(dir, "a2.json"), os.O_APPEND|os.O_WRONLY, 0)
+			f.WriteString(" ")
+			f.Close()
+		},
+		"tampered manifest": func(dir string) {
+			m, _ := generator.ReadManifest(dir)
+			m.Levels = m.Levels[:1]
+			generator.WriteManifest(dir, *m)
+		},
+	} {
+		dir := t.TempDir()
+		keys := signedBatch(t, dir, "a1", "a2")
+		breakIt(dir)
+		err := VerifyBatch(dir, keys)
+		if name == "corrupt level" && !errors.Is(err, ErrCorrupt) || name == "tampered manifest" && !errors.Is(err, ErrTampered) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// a level re-signed by a key the verifier doesn't know, checksum fixed
+	dir = t.TempDir()
+	keys = signedBatch(t, dir, "a1")
+	other, _ := replay.NewKey()
+	path := filepath.Join(dir, "a1.json")
+	lvl, _ := level.Load(path)
+	lvl.Sign(other.ID, other.Private)
+	lvl.Save(path)
+	m, _ = generator.ReadManifest(dir)
+	m.Levels[0].SHA256, _ = generator.FileHash(path)
+	generator.WriteManifest(dir, *m)
+	if err := VerifyBatch(dir, keys); !errors.Is(err, ErrTampered) {
+		t.Errorf("level re-signed under a signed manifest: %v", err)
+	}
+}
+
+func TestSignedLibraryAndFetch(t *testing.T) {
+	root := t.TempDir()
+	lib := NewLibrary(root)
+	batch := t.TempDir()
+	lib.Keys = signedBatch(t, batch, "a1", "a2")
+	srv := httptest.NewServer(NewServer(lib))
+	defer srv.Close()
+	c, err := NewClient(srv.URL + "/packs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := ReadBatch("arcade", "1.0.0", batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Publish("arcade", "1.0.0", signed.Archive()); err != nil {
+		t.Fatalf("signed pack: %v", err)
+	}
+	unsigned := t.TempDir()
+	writeBatch(t, unsigned, "a1", "a2")
+	v, _ := ReadBatch("arcade", "1.1.0", unsigned)
+	if _, err := c.Publish("arcade", "1.1.0", v.Archive()); err == nil {
+		t.Error("server took an unsigned pack")
+	}
+
+	out := filepath.Join(t.TempDir(), "arcade")
+	got, err := c.Fetch("arcade", Latest, out, lib.Keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "1.0.0" {
+		t.Errorf("fetched version %s", got.Version)
+	}
+	if err := VerifyBatch(out, lib.Keys); err != nil {
+		t.Errorf("fetched batch: %v", err)
+	}
+	if _, err := c.Fetch("arcade", Latest, out, lib.Keys); err == nil {
+		t.Error("fetched over an existing directory")
+	}
+
+	// a file on the server damaged after it was published
+	os.WriteFile(filepath.Join(root, "arcade", "1.0.0", "a1.json"), []byte(`{"name":"a1","grid_size":{"width":3,"height":3}}`), 0644)
+	if _, err := c.Fetch("arcade", Latest, filepath.Join(t.TempDir(), "arcade"), nil); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("damaged pack: %v", err)
+	}
+}
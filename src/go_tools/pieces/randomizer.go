@@ -0,0 +1,129 @@
+package pieces
+
+import (
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+// Randomizer algorithms
+const (
+	Bag7    = "bag7"
+	Bag14   = "bag14"
+	Classic = "classic"
+	History = "history"
+)
+
+// Randomizers lists every randomizer in a stable order
+var Randomizers = []string{Bag7, Bag14, Classic, History}
+
+// Randomizer produces the queue of pieces a player receives
+type Randomizer interface {
+	Next() string
+}
+
+// New returns the named randomizer drawing from src
+func New(name string, src rng.RandomSource) (Randomizer, error) {
+	switch name {
+	case "", Bag7:
+		return &bag{src: src, copies: 1}, nil
+	case Bag14:
+		return &bag{src: src, copies: 2}, nil
+	case Classic:
+		return &classic{src: src}, nil
+	case History:
+		return newHistory(src, 4, 4), nil
+	default:
+		return nil, fmt.Errorf("unknown piece randomizer %q", name)
+	}
+}
+
+// Seeded returns the named randomizer seeded with seed, dealing what a
+// game of a level without a piece sequence deals from that seed
+func Seeded(name string, seed int64) (Randomizer, error) {
+	return New(name, rng.NewXoshiro(uint64(seed)))
+}
+
+// Take draws n pieces from the randomizer
+func Take(r Randomizer, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = r.Next()
+	}
+	return out
+}
+
+// bag deals every piece type copies times in shuffled order before refilling
+type bag struct {
+	src    rng.RandomSource
+	copies int
+	queue  []string
+}
+
+func (b *bag) Next() string {
+	if len(b.queue) == 0 {
+		for i := 0; i < b.copies; i++ {
+			b.queue = append(b.queue, level.BlockTypes...)
+		}
+		for i := len(b.queue) - 1; i > 0; i-- {
+			j := b.src.Intn(i + 1)
+			b.queue[i], b.queue[j] = b.queue[j], b.queue[i]
+		}
+	}
+	p := b.queue[0]
+	b.queue = b.queue[1:]
+	return p
+}
+
+// classic picks every piece independently and uniformly
+type classic struct {
+	src rng.RandomSource
+}
+
+func (c *classic) Next() string {
+	return level.BlockTypes[c.src.Intn(len(level.BlockTypes))]
+}
+
+// history rerolls a piece up to rolls times while it matches one of the
+// last size pieces dealt, as in the arcade randomizers
+type history struct {
+	src    rng.RandomSource
+	recent []string
+	rolls  int
+}
+
+func newHistory(src rng.RandomSource, size, rolls int) *history {
+	// Seeded with S and Z so the first piece is never an overhang-maker.
+	recent := make([]string, size)
+	for i := range recent {
+		if i%2 == 0 {
+			recent[i] = "S"
+		} else {
+			recent[i] = "Z"
+		}
+	}
+	return &history{src: src, recent: recent, rolls: rolls}
+}
+
+func (h *history) Next() string {
+	var p string
+	for i := 0; i < h.rolls; i++ {
+		p = level.BlockTypes[h.src.Intn(len(level.BlockTypes))]
+		if !h.seen(p) {
+			break
+		}
+	}
+	copy(h.recent, h.recent[1:])
+	h.recent[len(h.recent)-1] = p
+	return p
+}
+
+func (h *history) seen(p string) bool {
+	for _, r := range h.recent {
+		if r == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package pieces
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+// counts tallies the pieces by type
+func counts(pieces []string) map[string]int {
+	out := map[string]int{}
+	for _, p := range pieces {
+		out[p]++
+	}
+	return out
+}
+
+func TestBagsDealEachTypeOncePerCopy(t *testing.T) {
+	for name, copies := range map[string]int{Bag7: 1, Bag14: 2} {
+		size := copies * len(level.BlockTypes)
+		for seed := int64(1); seed <= 5; seed++ {
+			r, err := Seeded(name, seed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dealt := Take(r, 40*size)
+			var orders [][]string
+			for i := 0; i < len(dealt); i += size {
+				bag := dealt[i : i+size]
+				for _, typ := range level.BlockTypes {
+					if n := counts(bag)[typ]; n != copies {
+						t.Fatalf("%s seed %d bag %d: %d of %s, want %d: %v", name, seed, i/size, n, typ, copies, bag)
+					}
+				}
+				orders = append(orders, bag)
+			}
+			if reflect.DeepEqual(orders[0], orders[1]) && reflect.DeepEqual(orders[1], orders[2]) {
+				t.Errorf("%s seed %d: the bags aren't shuffled: %v", name, seed, orders[0])
+			}
+		}
+	}
+}
+
+func TestClassicDealsIndependently(t *testing.T) {
+	r, _ := New(Classic, rng.NewScripted([]int{0, 3, 6, 3}, nil))
+	if got := Take(r, 4); !reflect.DeepEqual(got, []string{"I", "O", "Z", "O"}) {
+		t.Errorf("scripted classic dealt %v", got)
+	}
+
+	// uniform, and unlike a bag free to repeat within seven
+	r, _ = Seeded(Classic, 7)
+	const draws = 7000
+	dealt := Take(r, draws)
+	for _, typ := range level.BlockTypes {
+		if n := counts(dealt)[typ]; n < 900 || n > 1100 {
+			t.Errorf("%s dealt %d times in %d", typ, n, draws)
+		}
+	}
+	repeats := 0
+	for i := 1; i < len(dealt); i++ {
+		if dealt[i] == dealt[i-1] {
+			repeats++
+		}
+	}
+	if repeats == 0 {
+		t.Error("classic never dealt the same piece twice in a row")
+	}
+}
+
+func TestHistoryRerollsRecentPieces(t *testing.T) {
+	index := func(typ string) int {
+		return sort.SearchStrings(level.BlockTypes, typ)
+	}
+	I, S, Z := index("I"), index("S"), index("Z")
+	script := []int{
+		S, Z, S, I, // the history starts as S Z S Z: rerolled three times, then I
+		I, I, I, I, // I is recent now, but four rolls are all it gets
+		index("J"), // not recent: dealt on the first roll
+	}
+	r, _ := New(History, rng.NewScripted(script, nil))
+	if got := Take(r, 3); !reflect.DeepEqual(got, []string{"I", "I", "J"}) {
+		t.Errorf("scripted history dealt %v", got)
+	}
+
+	// seeded, it repeats a piece within its history far less than chance
+	r, _ = Seeded(History, 3)
+	dealt := Take(r, 5000)
+	recent := 0
+	for i := 4; i < len(dealt); i++ {
+		for _, p := range dealt[i-4 : i] {
+			if p == dealt[i] {
+				recent++
+				break
+			}
+		}
+	}
+	// all four rolls land on the at most four recent types (4/7)^4, about
+	// 11%, of the time, where one uniform draw does about half the time
+	if rate := float64(recent) / float64(len(dealt)-4); rate > 0.15 {
+		t.Errorf("history repeated a recent piece %.0f%% of the time", rate*100)
+	}
+}
+
+func TestNewNamesTheRandomizers(t *testing.T) {
+	for _, name := range append([]string{""}, Randomizers...) {
+		a, err := Seeded(name, 11)
+		if err != nil {
+			t.Fatalf("%q: %v", name, err)
+		}
+		b, _ := Seeded(name, 11)
+		if !reflect.DeepEqual(Take(a, 50), Take(b, 50)) {
+			t.Errorf("%q: the same seed dealt differently", name)
+		}
+	}
+	def, _ := Seeded("", 11)
+	bag, _ := Seeded(Bag7, 11)
+	if !reflect.DeepEqual(Take(def, 14), Take(bag, 14)) {
+		t.Error("the default randomizer isn't bag7")
+	}
+	if _, err := New("shuffle", rng.NewXoshiro(1)); err == nil {
+		t.Error("an unknown randomizer was made")
+	}
+}
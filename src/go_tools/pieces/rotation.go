@@ -0,0 +1,83 @@
+package pieces
+
+import (
+	"fmt"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Rotation systems
+const (
+	RotationSRS     = "srs"     // the guideline's wall and floor kicks
+	RotationClassic = "classic" // a rotation that doesn't fit fails
+)
+
+// RotationSystems lists every rotation system in a stable order
+var RotationSystems = []string{RotationSRS, RotationClassic}
+
+// RotationSystem decides where a rotated piece may end up when its
+// rotation in place doesn't fit
+type RotationSystem interface {
+	// Kicks are the offsets, in board coordinates with y growing
+	// downwards, to try in order for the piece rotating between the
+	// rotations; the first is no offset
+	Kicks(piece string, from, to int) []level.Point
+}
+
+// NewRotation returns the named rotation system
+func NewRotation(name string) (RotationSystem, error) {
+	switch name {
+	case "", RotationSRS:
+		return srs{}, nil
+	case RotationClassic:
+		return classicRotation{}, nil
+	default:
+		return nil, fmt.Errorf("unknown rotation system %q", name)
+	}
+}
+
+type classicRotation struct{}
+
+func (classicRotation) Kicks(string, int, int) []level.Point {
+	return []level.Point{{}}
+}
+
+// srsKicks are the SRS kick tables for each clockwise rotation from
+// rotation i, y pointing down; a counter-clockwise rotation's are the
+// negation of the clockwise one it undoes
+var srsKicks = map[string][4][5][2]int{
+	"JLSTZ": {
+		{{0, 0}, {-1, 0}, {-1, -1}, {0, 2}, {-1, 2}},
+		{{0, 0}, {1, 0}, {1, 1}, {0, -2}, {1, -2}},
+		{{0, 0}, {1, 0}, {1, -1}, {0, 2}, {1, 2}},
+		{{0, 0}, {-1, 0}, {-1, 1}, {0, -2}, {-1, -2}},
+	},
+	"I": {
+		{{0, 0}, {-2, 0}, {1, 0}, {-2, 1}, {1, -2}},
+		{{0, 0}, {-1, 0}, {2, 0}, {-1, -2}, {2, 1}},
+		{{0, 0}, {2, 0}, {-1, 0}, {2, -1}, {-1, 2}},
+		{{0, 0}, {1, 0}, {-2, 0}, {1, 2}, {-2, -1}},
+	},
+}
+
+type srs struct{}
+
+func (srs) Kicks(piece string, from, to int) []level.Point {
+	from, to = ((from%4)+4)%4, ((to%4)+4)%4
+	table, ok := srsKicks[piece]
+	if piece == "O" || from == to || (to-from+4)%4 == 2 {
+		return []level.Point{{}}
+	}
+	if !ok {
+		table = srsKicks["JLSTZ"]
+	}
+	sign, row := 1, table[from]
+	if (to-from+4)%4 == 3 {
+		sign, row = -1, table[to]
+	}
+	kicks := make([]level.Point, len(row))
+	for i, k := range row {
+		kicks[i] = level.Point{X: sign * k[0], Y: sign * k[1]}
+	}
+	return kicks
+}
@@ -0,0 +1,64 @@
+package pieces
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+// fixed deals a predetermined queue and then continues with a fallback randomizer
+type fixed struct {
+	queue    []string
+	fallback Randomizer
+}
+
+func (f *fixed) Next() string {
+	if len(f.queue) > 0 {
+		p := f.queue[0]
+		f.queue = f.queue[1:]
+		return p
+	}
+	return f.fallback.Next()
+}
+
+// ForLevel builds the randomizer described by a level's piece sequence:
+// its fixed queue first, then its own randomizer seeded with its seed.
+// Levels without a sequence use defaultName seeded from src.
+func ForLevel(seq *level.PieceSequence, defaultName string, src rng.RandomSource) (Randomizer, error) {
+	if seq == nil {
+		return New(defaultName, src)
+	}
+	if err := ValidateSequence(seq); err != nil {
+		return nil, err
+	}
+	if seq.Seed != 0 {
+		src = rng.NewXoshiro(uint64(seq.Seed))
+	}
+	name := seq.Randomizer
+	if name == "" {
+		name = defaultName
+	}
+	r, err := New(name, src)
+	if err != nil {
+		return nil, err
+	}
+	if len(seq.Fixed) == 0 {
+		return r, nil
+	}
+	return &fixed{queue: append([]string(nil), seq.Fixed...), fallback: r}, nil
+}
+
+// ValidateSequence checks a level's piece sequence for unknown pieces or randomizers
+func ValidateSequence(seq *level.PieceSequence) error {
+	if seq.Randomizer != "" && !slices.Contains(Randomizers, seq.Randomizer) {
+		return fmt.Errorf("unknown piece randomizer %q", seq.Randomizer)
+	}
+	for i, p := range seq.Fixed {
+		if !level.IsBlockType(p) {
+			return fmt.Errorf("fixed piece %d: unknown piece %q", i, p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package pieces
+
+import "github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+
+// shape is a piece's spawn orientation inside its size x size bounding box
+type shape struct {
+	size  int
+	cells []level.Point
+}
+
+// shapes follow the SRS spawn orientations used by the client
+var shapes = map[string]shape{
+	"I": {4, []level.Point{{X: 0, Y: 1}, {X: 1, Y: 1}, {X: 2, Y: 1}, {X: 3, Y: 1}}},
+	"J": {3, []level.Point{{X: 0, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}, {X: 2, Y: 1}}},
+	"L": {3, []level.Point{{X: 2, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}, {X: 2, Y: 1}}},
+	"O": {2, []level.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}}},
+	"S": {3, []level.Point{{X: 1, Y: 0}, {X: 2, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}}},
+	"T": {3, []level.Point{{X: 1, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}, {X: 2, Y: 1}}},
+	"Z": {3, []level.Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 2, Y: 1}}},
+}
+
+// Cells returns the cells a piece covers in the given rotation (0-3,
+// clockwise), relative to the top-left of its bounding box
+func Cells(piece string, rotation int) ([]level.Point, bool) {
+	s, ok := shapes[piece]
+	if !ok {
+		return nil, false
+	}
+	rotation = ((rotation % 4) + 4) % 4
+	cells := make([]level.Point, len(s.cells))
+	for i, c := range s.cells {
+		for r := 0; r < rotation; r++ {
+			c = level.Point{X: s.size - 1 - c.Y, Y: c.X}
+		}
+		cells[i] = c
+	}
+	return cells, true
+}
@@ -0,0 +1,323 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/generator"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Timeouts of a plugin's process
+const (
+	startTimeout = 10 * time.Second // to describe itself
+	stopTimeout  = 5 * time.Second  // to exit once its stdin closes, before it is killed
+)
+
+// Client is a running plugin
+type Client struct {
+	Path     string
+	Manifest Manifest
+	cmd      *exec.Cmd
+	rpc      *rpc.Client
+	stdin    *os.File
+	exited   chan struct{}
+}
+
+// Start runs the plugin at path and asks it what it provides
+func Start(path string) (*Client, error) {
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), Env+"="+strconv.Itoa(Protocol))
+	cmd.Stderr = os.Stderr
+	// pipes of our own rather than the command's, which Wait would close
+	// under a reply still being read
+	inR, stdin, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		stdin.Close()
+		return nil, err
+	}
+	cmd.Stdin, cmd.Stdout = inR, outW
+	err = cmd.Start()
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		return nil, err
+	}
+	c := &Client{Path: path, cmd: cmd, rpc: jsonrpc.NewClient(pipe{stdout, stdin}), stdin: stdin, exited: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(c.exited)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	if err := c.call(ctx, "Plugin.Describe", DescribeArgs{Protocol: Protocol}, &c.Manifest); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if c.Manifest.Protocol != Protocol {
+		c.Close()
+		return nil, fmt.Errorf("%s speaks protocol %d, not %d", filepath.Base(path), c.Manifest.Protocol, Protocol)
+	}
+	if c.Manifest.Name == "" {
+		c.Manifest.Name = filepath.Base(path)
+	}
+	return c, nil
+}
+
+// call calls method, giving up when ctx is done or the plugin exits
+func (c *Client) call(ctx context.Context, method string, args, reply any) error {
+	call := c.rpc.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if errors.Is(call.Error, rpc.ErrShutdown) || errors.Is(call.Error, io.ErrUnexpectedEOF) {
+			return errors.New("the plugin exited")
+		}
+		return call.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.exited:
+		return errors.New("the plugin exited")
+	}
+}
+
+// Tool is the plugin's tool of kind named name
+func (c *Client) Tool(kind, name string) (Tool, bool) {
+	for _, t := range c.Manifest.Tools {
+		if t.Kind == kind && t.Name == name {
+			return t, true
+		}
+	}
+	return Tool{}, false
+}
+
+// Generate asks the plugin's generator tool for a level
+func (c *Client) Generate(ctx context.Context, args GenerateArgs) (*level.Level, error) {
+	var lvl level.Level
+	if err := c.call(ctx, "Plugin.Generate", args, &lvl); err != nil {
+		return nil, err
+	}
+	return &lvl, nil
+}
+
+// Analyze runs the plugin's pass tool on the inputs it requires
+func (c *Client) Analyze(ctx context.Context, tool Tool, in analyzer.PassInputs) ([]*analyzer.Table, error) {
+	args, err := in.Payload(tool.Requires)
+	if err != nil {
+		return nil, err
+	}
+	args["tool"] = tool.Name
+	var reply json.RawMessage
+	if err := c.call(ctx, "Plugin.Analyze", args, &reply); err != nil {
+		return nil, err
+	}
+	return analyzer.DecodeTables(reply)
+}
+
+// Edit runs the plugin's editor tool on a level
+func (c *Client) Edit(ctx context.Context, args EditArgs) (*level.Level, error) {
+	var lvl level.Level
+	if err := c.call(ctx, "Plugin.Edit", args, &lvl); err != nil {
+		return nil, err
+	}
+	return &lvl, nil
+}
+
+// Close closes the plugin's stdin and waits for it to exit, killing it
+// if it doesn't; its stdout is read until then, so it can finish writing
+func (c *Client) Close() error {
+	c.stdin.Close()
+	select {
+	case <-c.exited:
+	case <-time.After(stopTimeout):
+		c.cmd.Process.Kill()
+		<-c.exited
+	}
+	c.rpc.Close()
+	return nil
+}
+
+// Failure is a plugin that wouldn't start
+type Failure struct {
+	Path string
+	Err  error
+}
+
+// Host is the plugins of a directory
+type Host struct {
+	Plugins  []*Client // by file name
+	Failures []Failure
+}
+
+// Open starts every executable in dir; a missing dir has none. Plugins
+// that don't start, or offer a tool an earlier one does, are Failures.
+func Open(dir string) (*Host, error) {
+	h := &Host{}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		c, err := Start(path)
+		if err == nil {
+			err = h.conflict(c)
+		}
+		if err != nil {
+			h.Failures = append(h.Failures, Failure{Path: path, Err: err})
+			continue
+		}
+		h.Plugins = append(h.Plugins, c)
+	}
+	return h, nil
+}
+
+// conflict is the error of a plugin offering a tool another does, which
+// it stops
+func (h *Host) conflict(c *Client) error {
+	for _, t := range c.Manifest.Tools {
+		if other, _, ok := h.Find(t.Kind, t.Name); ok {
+			c.Close()
+			return fmt.Errorf("%s %s is %s's already", t.Kind, t.Name, other.Manifest.Name)
+		}
+	}
+	return nil
+}
+
+// Close stops the plugins
+func (h *Host) Close() {
+	for _, c := range h.Plugins {
+		c.Close()
+	}
+}
+
+// Find is the plugin with the tool of kind named name
+func (h *Host) Find(kind, name string) (*Client, Tool, bool) {
+	for _, c := range h.Plugins {
+		if t, ok := c.Tool(kind, name); ok {
+			return c, t, true
+		}
+	}
+	return nil, Tool{}, false
+}
+
+// Tools are the plugins' tools of kind, or all of them for an empty kind
+func (h *Host) Tools(kind string) []Tool {
+	var out []Tool
+	for _, c := range h.Plugins {
+		for _, t := range c.Manifest.Tools {
+			if kind == "" || t.Kind == kind {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+// Passes are the plugins' analysis passes, to register with the analyzer
+func (h *Host) Passes() []analyzer.AnalysisPass {
+	var out []analyzer.AnalysisPass
+	for _, c := range h.Plugins {
+		for _, t := range c.Manifest.Tools {
+			if t.Kind == KindPass {
+				out = append(out, &pass{c, t})
+			}
+		}
+	}
+	return out
+}
+
+// pass is a plugin's analysis pass
+type pass struct {
+	c    *Client
+	tool Tool
+}
+
+func (p *pass) Name() string       { return p.tool.Name }
+func (p *pass) Requires() []string { return p.tool.Requires }
+
+func (p *pass) Run(in analyzer.PassInputs) ([]*analyzer.Table, error) {
+	ctx := in.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return p.c.Analyze(ctx, p.tool, in)
+}
+
+// Algorithm is the plugins' generator named name, building levels as
+// config says
+func (h *Host) Algorithm(name string, config utils.Config) (generator.Algorithm, error) {
+	c, _, ok := h.Find(KindGenerator, name)
+	if !ok {
+		return nil, fmt.Errorf("no plugin generator %q", name)
+	}
+	return func(lvl string, seed int64) (*level.Level, error) {
+		return c.Generate(context.Background(), GenerateArgs{Tool: name, Level: lvl, Seed: seed, Config: config})
+	}, nil
+}
+
+// NewGenerator is generator.NewGenerator, its levels built by the plugin
+// generator the config's generatorPlugin names when it names one; stop
+// stops the plugins
+func NewGenerator(config utils.Config) (gen *generator.Generator, stop func(), err error) {
+	if gen, err = generator.NewGenerator(config); err != nil {
+		return nil, nil, err
+	}
+	if config.GeneratorPlugin == "" {
+		return gen, func() {}, nil
+	}
+	h, err := Open(config.PluginsDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := h.Algorithm(config.GeneratorPlugin, config)
+	if err != nil {
+		for _, f := range h.Failures {
+			err = fmt.Errorf("%w; %s: %v", err, f.Path, f.Err)
+		}
+		h.Close()
+		return nil, nil, err
+	}
+	gen.SetAlgorithm(a)
+	return gen, h.Close, nil
+}
+
+// pipe is a plugin's stdout and stdin, or a plugin's own stdin and
+// stdout, as one connection
+type pipe struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (p pipe) Close() error {
+	werr := p.WriteCloser.Close()
+	rerr := p.ReadCloser.Close()
+	return errors.Join(werr, rerr)
+}
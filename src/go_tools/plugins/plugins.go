@@ -0,0 +1,158 @@
+// Package plugins hosts third-party generators, analysis passes and
+// editor tools shipped as separate executables in the plugins directory.
+// The host starts each with $STT_PLUGIN set to the protocol version and
+// speaks JSON-RPC 1.0 over its stdin and stdout, as net/rpc/jsonrpc
+// does; what it writes to stderr is passed through. A plugin answers
+//
+//	Plugin.Describe  {"protocol": 1}                      its Manifest
+//	Plugin.Generate  GenerateArgs                         a level
+//	Plugin.Analyze   {"tool": ..., "levels": [...], ...}  a JSON array of tables, as CommandPass reads them
+//	Plugin.Edit      EditArgs                             the level edited
+//
+// and exits when its stdin closes. Go plugins call Serve with their
+// tools; others need only a JSON-RPC loop.
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Protocol is the version of the calls plugins answer
+const Protocol = 1
+
+// Env is set to the protocol version in a plugin's environment, so it
+// knows it was started by the host and not from a shell
+const Env = "STT_PLUGIN"
+
+// Kinds of tool a plugin provides
+const (
+	KindGenerator = "generator" // builds levels in place of the built-in modes, see the config's generatorPlugin
+	KindPass      = "pass"      // an analysis pass, selected like the built-in ones
+	KindEditor    = "editor"    // edits a level file, run by stt plugins run
+)
+
+// Tool is one generator, pass or editor tool of a plugin
+type Tool struct {
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name"`
+	Summary  string   `json:"summary,omitempty"`
+	Requires []string `json:"requires,omitempty"` // a pass's inputs: levels, replays or client_events
+}
+
+// Manifest is what a plugin says it is
+type Manifest struct {
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	Protocol int    `json:"protocol"`
+	Tools    []Tool `json:"tools"`
+}
+
+// DescribeArgs is the host's protocol version, sent to Plugin.Describe
+type DescribeArgs struct {
+	Protocol int `json:"protocol"`
+}
+
+// GenerateArgs asks a generator for a level
+type GenerateArgs struct {
+	Tool   string       `json:"tool"`
+	Level  string       `json:"level"` // the level's name
+	Seed   int64        `json:"seed"`  // drawn from the generator's source, for reproducible batches
+	Config utils.Config `json:"config"`
+}
+
+// AnalyzeArgs are a pass's inputs, those it requires set
+type AnalyzeArgs struct {
+	Tool         string                 `json:"tool"`
+	Levels       []*level.Level         `json:"levels,omitempty"`
+	Replays      []*replay.Replay       `json:"replays,omitempty"`
+	ClientEvents []analyzer.ClientEvent `json:"client_events,omitempty"`
+}
+
+// EditArgs asks an editor tool to edit a level
+type EditArgs struct {
+	Tool  string       `json:"tool"`
+	Level *level.Level `json:"level"`
+	Args  []string     `json:"args,omitempty"` // after the level file on stt plugins run's command line
+}
+
+// Plugin is a Go plugin's tools, each of its functions called with the
+// tool of the manifest it is asked for; those its manifest lists no
+// tools of may be nil
+type Plugin struct {
+	Manifest Manifest
+	Generate func(GenerateArgs) (*level.Level, error)
+	Analyze  func(AnalyzeArgs) ([]*analyzer.Table, error)
+	Edit     func(EditArgs) (*level.Level, error)
+}
+
+// ErrNotHosted is Serve's error when the plugin wasn't started by a host
+var ErrNotHosted = errors.New("this is a SuperTetris tools plugin; put it in the plugins directory instead of running it")
+
+// Serve answers the host's calls on stdin and stdout until stdin closes
+func Serve(p Plugin) error {
+	if os.Getenv(Env) == "" {
+		return ErrNotHosted
+	}
+	p.Manifest.Protocol = Protocol
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Plugin", &service{p}); err != nil {
+		return err
+	}
+	srv.ServeCodec(jsonrpc.NewServerCodec(pipe{os.Stdin, os.Stdout}))
+	return nil
+}
+
+// service is the RPC receiver Serve registers
+type service struct {
+	p Plugin
+}
+
+func (s *service) Describe(args DescribeArgs, reply *Manifest) error {
+	if args.Protocol != Protocol {
+		return fmt.Errorf("host speaks protocol %d, the plugin %d", args.Protocol, Protocol)
+	}
+	*reply = s.p.Manifest
+	return nil
+}
+
+func (s *service) Generate(args GenerateArgs, reply *level.Level) error {
+	if s.p.Generate == nil {
+		return fmt.Errorf("no generators")
+	}
+	lvl, err := s.p.Generate(args)
+	if err != nil {
+		return err
+	}
+	*reply = *lvl
+	return nil
+}
+
+func (s *service) Analyze(args AnalyzeArgs, reply *[]*analyzer.Table) error {
+	if s.p.Analyze == nil {
+		return fmt.Errorf("no passes")
+	}
+	tables, err := s.p.Analyze(args)
+	*reply = tables
+	return err
+}
+
+func (s *service) Edit(args EditArgs, reply *level.Level) error {
+	if s.p.Edit == nil {
+		return fmt.Errorf("no editor tools")
+	}
+	lvl, err := s.p.Edit(args)
+	if err != nil {
+		return err
+	}
+	*reply = *lvl
+	return nil
+}
@@ -0,0 +1,178 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// TestMain serves as the test plugins when the host starts this binary,
+// as the scripts testPlugins writes do
+func TestMain(m *testing.M) {
+	if os.Getenv(Env) != "" {
+		if err := Serve(testPlugin(os.Args[len(os.Args)-1])); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func testPlugin(name string) Plugin {
+	p := Plugin{Manifest: Manifest{Name: name, Version: "1.0"}}
+	if name == "beta" {
+		// offers alpha's pass as well, so fails to load after it
+		p.Manifest.Tools = []Tool{{Kind: KindPass, Name: "blocks", Requires: []string{analyzer.InputLevels}}}
+		return p
+	}
+	p.Manifest.Tools = []Tool{
+		{Kind: KindGenerator, Name: "floor", Summary: "a floor of blocks, as wide as the seed says"},
+		{Kind: KindPass, Name: "blocks", Requires: []string{analyzer.InputLevels}},
+		{Kind: KindEditor, Name: "clear", Summary: "removes the blocks of a row"},
+	}
+	p.Generate = func(args GenerateArgs) (*level.Level, error) {
+		lvl := level.New(args.Level, args.Config.LevelWidth, args.Config.LevelHeight)
+		lvl.Mode = level.ModeStandard
+		lvl.Difficulty = "medium"
+		for x := 0; x < 1+int(args.Seed%int64(args.Config.LevelWidth-1)); x++ {
+			lvl.Blocks = append(lvl.Blocks, level.Block{Type: level.BlockTypes[0], X: x, Y: args.Config.LevelHeight - 1})
+		}
+		lvl.SpawnPoints = []level.Point{{X: args.Config.LevelWidth / 2, Y: 0}}
+		lvl.Metadata = map[string]string{"seed": strconv.FormatInt(args.Seed, 10)}
+		return lvl, nil
+	}
+	p.Analyze = func(args AnalyzeArgs) ([]*analyzer.Table, error) {
+		t := analyzer.NewTable("by_level", "level", "blocks:int")
+		for _, lvl := range args.Levels {
+			t.Add(lvl.Name, len(lvl.Blocks))
+		}
+		return []*analyzer.Table{t}, nil
+	}
+	p.Edit = func(args EditArgs) (*level.Level, error) {
+		if len(args.Args) != 1 {
+			return nil, fmt.Errorf("clear ROW")
+		}
+		row, err := strconv.Atoi(args.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		lvl := args.Level
+		kept := lvl.Blocks[:0]
+		for _, b := range lvl.Blocks {
+			if b.Y != row {
+				kept = append(kept, b)
+			}
+		}
+		lvl.Blocks = kept
+		return lvl, nil
+	}
+	return p
+}
+
+// testPlugins is a plugins directory of alpha, beta, and a file that
+// isn't executable
+func testPlugins(t *testing.T) string {
+	t.Helper()
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"alpha", "beta"} {
+		script := fmt.Sprintf("#!/bin/sh\nexec %q %s\n", self, name)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestHost(t *testing.T) {
+	h, err := Open(testPlugins(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if len(h.Plugins) != 1 || h.Plugins[0].Manifest.Name != "alpha" || len(h.Tools("")) != 3 {
+		t.Fatalf("plugins %+v", h.Plugins)
+	}
+	if len(h.Failures) != 1 || filepath.Base(h.Failures[0].Path) != "beta" || !strings.Contains(h.Failures[0].Err.Error(), "alpha's already") {
+		t.Errorf("failures %+v", h.Failures)
+	}
+
+	passes := h.Passes()
+	if len(passes) != 1 || passes[0].Name() != "blocks" {
+		t.Fatalf("passes %v", passes)
+	}
+	data := analyzer.NewDataset()
+	data.Levels["caves"] = &level.Level{Name: "caves", Blocks: make([]level.Block, 3)}
+	tables, err := passes[0].Run(analyzer.PassInputs{Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || len(tables[0].Rows) != 1 || tables[0].Rows[0][1] != 3 {
+		t.Errorf("tables %+v", tables)
+	}
+
+	c, _, ok := h.Find(KindEditor, "clear")
+	if !ok {
+		t.Fatal("no clear tool")
+	}
+	lvl := &level.Level{Name: "caves", Blocks: []level.Block{{X: 0, Y: 1}, {X: 0, Y: 2}, {X: 1, Y: 2}}}
+	edited, err := c.Edit(context.Background(), EditArgs{Tool: "clear", Level: lvl, Args: []string{"2"}})
+	if err != nil || len(edited.Blocks) != 1 {
+		t.Errorf("edited %+v, %v", edited, err)
+	}
+	if _, err := c.Edit(context.Background(), EditArgs{Tool: "clear", Level: lvl}); err == nil || err.Error() != "clear ROW" {
+		t.Errorf("the plugin's error came back as %v", err)
+	}
+}
+
+func TestGeneratorPlugin(t *testing.T) {
+	config := utils.DefaultConfig()
+	config.PluginsDir = testPlugins(t)
+	config.GeneratorPlugin = "floor"
+	config.GeneratorSeed = 7
+	seeds := make([]string, 2)
+	for i := range seeds {
+		gen, stop, err := NewGenerator(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lvl, err := gen.Generate("floor")
+		stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lvl.Metadata["seed"] == "" || len(lvl.Blocks) == 0 {
+			t.Fatalf("level %+v isn't the plugin's", lvl)
+		}
+		seeds[i] = lvl.Metadata["seed"]
+	}
+	if seeds[0] != seeds[1] {
+		t.Errorf("seeds %v differ for one generator seed", seeds)
+	}
+
+	config.GeneratorPlugin = "caves"
+	if _, _, err := NewGenerator(config); err == nil || !strings.Contains(err.Error(), `no plugin generator "caves"`) {
+		t.Errorf("unknown generator: %v", err)
+	}
+}
+
+func TestServeNeedsAHost(t *testing.T) {
+	if err := Serve(Plugin{}); err != ErrNotHosted {
+		t.Errorf("Serve outside a host: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package profiler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+// AgentPath is where servers mount the profiling agent
+const AgentPath = "/debug/profile/agent"
+
+// AgentTokenEnv holds the agent's token when the config doesn't, so it
+// can stay out of config files
+const AgentTokenEnv = "SUPERTETRIS_PROFILE_TOKEN"
+
+// minAgentToken is the shortest token an agent accepts
+const minAgentToken = 16
+
+// Limits of a remote capture, and its defaults
+const (
+	agentDuration    = 30 * time.Second
+	agentMaxDuration = 10 * time.Minute
+	agentInterval    = 10 * time.Millisecond
+	agentMinInterval = time.Millisecond
+	agentFlush       = time.Second
+)
+
+// AgentChunk is one message of an agent's stream: the stacks sampled
+// since the last chunk and the runtime's gauges, until one is Done
+type AgentChunk struct {
+	At      time.Time    `json:"at"`
+	Samples *Samples     `json:"samples,omitempty"`
+	Stats   RuntimeStats `json:"stats"`
+	Done    bool         `json:"done,omitempty"`
+}
+
+// Agent lets profile attach sample a running server's stacks over a
+// WebSocket, so a production-like server is profiled without copying
+// files off it. Clients authenticate with a bearer token, and one capture
+// runs at a time.
+type Agent struct {
+	token  string
+	budget float64
+
+	mu   sync.Mutex
+	busy bool
+}
+
+// NewAgent serves captures to clients presenting token; budget is the
+// share of a CPU sampling may use, 0 for a fixed rate
+func NewAgent(token string, budget float64) (*Agent, error) {
+	if len(token) < minAgentToken {
+		return nil, fmt.Errorf("profiling agent token must be at least %d characters", minAgentToken)
+	}
+	return &Agent{token: token, budget: budget}, nil
+}
+
+// ServeHTTP runs a capture for ?duration= (30s by default) sampling every
+// ?interval= (10ms), streaming a chunk each second
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(a.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="profiler"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	duration, err := durationParam(r, "duration", agentDuration)
+	if err == nil && (duration <= 0 || duration > agentMaxDuration) {
+		err = fmt.Errorf("duration must be over 0 and at most %s", agentMaxDuration)
+	}
+	interval, ierr := durationParam(r, "interval", agentInterval)
+	if ierr == nil && interval < agentMinInterval {
+		ierr = fmt.Errorf("interval must be at least %s", agentMinInterval)
+	}
+	if err = errors.Join(err, ierr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.mu.Lock()
+	if a.busy {
+		a.mu.Unlock()
+		http.Error(w, "a capture is already running", http.StatusConflict)
+		return
+	}
+	a.busy = true
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.busy = false
+		a.mu.Unlock()
+	}()
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	closed := make(chan struct{})
+	go func() {
+		// the client sends nothing; reading notices it going away
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sampler := StartAdaptiveSampler(interval, a.budget)
+	send := func(samples *Samples, done bool) bool {
+		data, err := json.Marshal(AgentChunk{At: time.Now(), Samples: samples, Stats: readRuntimeStats(), Done: done})
+		return err == nil && conn.WriteMessage(websocket.TextMessage, data) == nil
+	}
+	end := time.NewTimer(duration)
+	defer end.Stop()
+	flush := time.NewTicker(agentFlush)
+	defer flush.Stop()
+	for {
+		select {
+		case <-flush.C:
+			if !send(sampler.Drain(), false) {
+				sampler.Stop()
+				return
+			}
+		case <-end.C:
+			send(sampler.Stop(), true)
+			return
+		case <-closed:
+			sampler.Stop()
+			return
+		}
+	}
+}
+
+func durationParam(r *http.Request, name string, fallback time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return d, nil
+}
+
+// AttachOptions configure a remote capture
+type AttachOptions struct {
+	Token    string
+	Duration time.Duration // 0 leaves the agent's default
+	Interval time.Duration
+	OnChunk  func(AgentChunk) // sees each chunk as it arrives, if set
+}
+
+// Attach captures from the agent at url, such as
+// ws://host:8090/debug/profile/agent, and returns the stacks merged. A
+// capture cut short, by ctx or the connection, returns what arrived with
+// the error.
+func Attach(ctx context.Context, url string, opts AttachOptions) (*Samples, error) {
+	q := []string{}
+	if opts.Duration > 0 {
+		q = append(q, "duration="+opts.Duration.String())
+	}
+	if opts.Interval > 0 {
+		q = append(q, "interval="+opts.Interval.String())
+	}
+	if len(q) > 0 {
+		sep := "?"
+		if strings.Contains(url, "?") {
+			sep = "&"
+		}
+		url += sep + strings.Join(q, "&")
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := certs.Dial(dialCtx, url, http.Header{"Authorization": {"Bearer " + opts.Token}})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var merged *Samples
+	var rates []RateChange
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return merged, fmt.Errorf("capture cut short: %w", err)
+		}
+		var chunk AgentChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return merged, fmt.Errorf("agent sent %w", err)
+		}
+		if chunk.Samples != nil {
+			rates = append(rates, chunk.Samples.Rates...)
+			merged = mergeSamples(merged, chunk.Samples)
+			merged.Rates = rates
+		}
+		if opts.OnChunk != nil {
+			opts.OnChunk(chunk)
+		}
+		if chunk.Done {
+			if merged == nil {
+				merged = &Samples{Unit: "samples"}
+			}
+			return merged, nil
+		}
+	}
+}
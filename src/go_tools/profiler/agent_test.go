@@ -0,0 +1,86 @@
+package profiler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "0123456789abcdef"
+
+func TestAgentAuthAndParams(t *testing.T) {
+	if _, err := NewAgent("short", 0); err == nil {
+		t.Error("short token accepted")
+	}
+	agent, err := NewAgent(testToken, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+	for _, c := range []struct {
+		token, query string
+		want         int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"wrong-token-wrong-token", "", http.StatusUnauthorized},
+		{testToken, "?duration=1h", http.StatusBadRequest},
+		{testToken, "?interval=1us", http.StatusBadRequest},
+		{testToken, "?duration=soon", http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+c.query, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.want {
+			t.Errorf("token %q%s: %s, want %d", c.token, c.query, resp.Status, c.want)
+		}
+	}
+}
+
+func TestAttach(t *testing.T) {
+	agent, _ := NewAgent(testToken, 0)
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	stopBusy := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stopBusy:
+				return
+			default:
+			}
+		}
+	}()
+	defer close(stopBusy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	chunks := 0
+	samples, err := Attach(ctx, url, AttachOptions{Token: testToken, Duration: 1500 * time.Millisecond, Interval: time.Millisecond,
+		OnChunk: func(c AgentChunk) {
+			chunks++
+			if c.Stats.Goroutines == 0 {
+				t.Errorf("chunk without stats: %+v", c)
+			}
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunks < 2 || len(samples.Samples) == 0 || samples.Interval != time.Millisecond {
+		t.Errorf("%d chunks, samples %+v", chunks, samples)
+	}
+	if _, err := Attach(ctx, url, AttachOptions{Token: "not-the-token-at-all"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("attach with a wrong token: %v", err)
+	}
+}
@@ -0,0 +1,370 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// allocSiteDepth is how many frames an allocation watch keeps of each
+// stack: enough to find the simulation loop above the site
+const allocSiteDepth = 12
+
+// AllocSample is everything each allocation stack had allocated by one
+// point in a run, freed or not, and the ticks run by then
+type AllocSample struct {
+	AtMs  float64              `json:"atMs"` // since the watch began
+	Ticks int64                `json:"ticks"`
+	Sites map[string]SiteUsage `json:"sites"` // by allocation stack, innermost frame first
+}
+
+// ReadAllocSamples reads JSON-lines allocation samples; blank lines are
+// skipped
+func ReadAllocSamples(r io.Reader) ([]AllocSample, error) {
+	var out []AllocSample
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var s AllocSample
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		out = append(out, s)
+	}
+	return out, sc.Err()
+}
+
+// WriteAllocSamples writes the samples one JSON object per line
+func WriteAllocSamples(w io.Writer, samples []AllocSample) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, s := range samples {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// LoadAllocSamples reads an allocation sample log, or the one of the
+// session bundle or -profile directory at path
+func LoadAllocSamples(path string) ([]AllocSample, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		paths, err := sessionPaths(path)
+		if err != nil {
+			return nil, err
+		}
+		log, ok := paths["allocticks"]
+		if !ok {
+			return nil, fmt.Errorf("%s has no allocation samples; profile with profileAllocInterval set", path)
+		}
+		path = log
+	}
+	var samples []AllocSample
+	err := readLog(path, func(f io.Reader) (err error) {
+		samples, err = ReadAllocSamples(f)
+		return err
+	})
+	return samples, err
+}
+
+// AllocWatch samples what each allocation site has allocated at an
+// interval, with a tick count to divide it by. It doesn't collect to
+// sample, so the figures trail by up to two collections; a loop
+// allocating enough to matter collects often.
+type AllocWatch struct {
+	start time.Time
+	ticks func() int64
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu      sync.Mutex
+	samples []AllocSample
+}
+
+// StartAllocWatch samples now and every interval until Stop. ticks counts
+// the simulation's ticks so far, such as a FrameCollector's Count; nil
+// leaves the samples per second only.
+func StartAllocWatch(interval time.Duration, ticks func() int64) *AllocWatch {
+	w := &AllocWatch{start: time.Now(), ticks: ticks, stop: make(chan struct{}), done: make(chan struct{})}
+	w.sample()
+	go w.run(interval)
+	return w
+}
+
+func (w *AllocWatch) run(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.sample()
+		}
+	}
+}
+
+// Stop takes a last sample and returns them all
+func (w *AllocWatch) Stop() []AllocSample {
+	close(w.stop)
+	<-w.done
+	w.sample()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.samples
+}
+
+func (w *AllocWatch) sample() {
+	s := AllocSample{
+		AtMs:  float64(time.Since(w.start)) / float64(time.Millisecond),
+		Sites: memorySites(true, allocSiteDepth),
+	}
+	if w.ticks != nil {
+		s.Ticks = w.ticks()
+	}
+	w.mu.Lock()
+	w.samples = append(w.samples, s)
+	w.mu.Unlock()
+}
+
+// AllocTickOptions shape an allocation hot-path report
+type AllocTickOptions struct {
+	Loop        []string // function name parts of the simulation loop, such as Simulator.Step
+	SteadyShare float64  // of the intervals after warm-up a site must allocate in to be steady
+	Top         int      // sites kept, 0 for all
+}
+
+// DefaultAllocTickOptions call a site steady when it allocates in nearly
+// every interval
+func DefaultAllocTickOptions() AllocTickOptions {
+	return AllocTickOptions{SteadyShare: 0.8, Top: 20}
+}
+
+// AllocTickSite is what one call site allocated per tick once the run
+// had warmed up
+type AllocTickSite struct {
+	Site           string  `json:"site"` // the innermost frame outside the runtime
+	BytesPerTick   float64 `json:"bytesPerTick"`
+	ObjectsPerTick float64 `json:"objectsPerTick"`
+	BytesPerSec    float64 `json:"bytesPerSec"`
+	Share          float64 `json:"share"`  // of the bytes allocated
+	Active         float64 `json:"active"` // of intervals it allocated in
+	Steady         bool    `json:"steady"` // allocated in at least SteadyShare of them
+	InLoop         bool    `json:"inLoop"` // allocated under the simulation loop
+	Stack          string  `json:"stack"`  // its heaviest allocation stack
+}
+
+// AllocTickReport is a run's allocation by call site, per tick of the
+// simulation, measured after the first interval so start-up allocation
+// doesn't swamp the steady state that drives collection
+type AllocTickReport struct {
+	Samples        int             `json:"samples"`
+	DurationMs     float64         `json:"durationMs"` // of the measured window
+	Ticks          int64           `json:"ticks"`
+	BytesPerTick   float64         `json:"bytesPerTick"`
+	ObjectsPerTick float64         `json:"objectsPerTick"`
+	BytesPerSec    float64         `json:"bytesPerSec"`
+	SteadyBytes    float64         `json:"steadyBytes"` // per tick, by steady sites in the loop, or all steady sites without Loop
+	Sites          []AllocTickSite `json:"sites"`       // most bytes first
+	Note           string          `json:"note,omitempty"`
+}
+
+// Hot is the report's steady sites in the simulation loop, or every
+// steady site when it wasn't told the loop
+func (r AllocTickReport) Hot() []AllocTickSite {
+	var out []AllocTickSite
+	loop := false
+	for _, s := range r.Sites {
+		loop = loop || s.InLoop
+	}
+	for _, s := range r.Sites {
+		if s.Steady && (s.InLoop || !loop) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// AnalyzeAllocTicks diffs the first sample after warm-up against the last
+// per call site, and checks each interval between to tell the sites that
+// allocate every tick from those that allocated in bursts
+func AnalyzeAllocTicks(samples []AllocSample, opts AllocTickOptions) AllocTickReport {
+	r := AllocTickReport{Samples: len(samples), Sites: []AllocTickSite{}}
+	if len(samples) < 2 {
+		r.Note = fmt.Sprintf("%d allocation samples; at least two are needed", len(samples))
+		return r
+	}
+	window := samples[1:]
+	if len(samples) == 2 {
+		window = samples
+		r.Note = "two allocation samples, so start-up allocation is counted; run longer or sample more often"
+	}
+	first, last := window[0], window[len(window)-1]
+	r.DurationMs = last.AtMs - first.AtMs
+	r.Ticks = last.Ticks - first.Ticks
+	if r.Ticks <= 0 && r.Note == "" {
+		r.Note = "no ticks counted; the figures are per second only"
+	}
+
+	type acc struct {
+		AllocTickSite
+		bytes, objects int64
+		heaviest       int64
+		intervals      []int64
+	}
+	bySite := make(map[string]*acc)
+	var bytes, objects int64
+	for stack, end := range last.Sites {
+		start := first.Sites[stack]
+		b, o := end.Bytes-start.Bytes, end.Objects-start.Objects
+		if b <= 0 {
+			continue
+		}
+		site, _, _ := strings.Cut(stack, " < ")
+		a := bySite[site]
+		if a == nil {
+			a = &acc{AllocTickSite: AllocTickSite{Site: site}, intervals: make([]int64, len(window)-1)}
+			bySite[site] = a
+		}
+		a.bytes += b
+		a.objects += o
+		if b > a.heaviest {
+			a.heaviest, a.Stack = b, stack
+		}
+		a.InLoop = a.InLoop || (len(opts.Loop) > 0 && focused(strings.Split(stack, " < "), opts.Loop))
+		for i := 1; i < len(window); i++ {
+			a.intervals[i-1] += window[i].Sites[stack].Bytes - window[i-1].Sites[stack].Bytes
+		}
+		bytes += b
+		objects += o
+	}
+	secs := r.DurationMs / 1000
+	perTick := func(v int64) float64 {
+		if r.Ticks <= 0 {
+			return 0
+		}
+		return float64(v) / float64(r.Ticks)
+	}
+	r.BytesPerTick, r.ObjectsPerTick = perTick(bytes), perTick(objects)
+	if secs > 0 {
+		r.BytesPerSec = float64(bytes) / secs
+	}
+	for _, a := range bySite {
+		a.BytesPerTick, a.ObjectsPerTick = perTick(a.bytes), perTick(a.objects)
+		if secs > 0 {
+			a.BytesPerSec = float64(a.bytes) / secs
+		}
+		a.Share = float64(a.bytes) / float64(bytes)
+		active := 0
+		for _, b := range a.intervals {
+			if b > 0 {
+				active++
+			}
+		}
+		if len(a.intervals) > 0 {
+			a.Active = float64(active) / float64(len(a.intervals))
+		}
+		a.Steady = len(a.intervals) >= 2 && a.Active >= opts.SteadyShare
+		r.Sites = append(r.Sites, a.AllocTickSite)
+	}
+	sort.Slice(r.Sites, func(i, j int) bool {
+		if r.Sites[i].BytesPerSec != r.Sites[j].BytesPerSec {
+			return r.Sites[i].BytesPerSec > r.Sites[j].BytesPerSec
+		}
+		return r.Sites[i].Site < r.Sites[j].Site
+	})
+	for _, s := range r.Hot() {
+		r.SteadyBytes += s.BytesPerTick
+	}
+	if opts.Top > 0 && len(r.Sites) > opts.Top {
+		r.Sites = r.Sites[:opts.Top]
+	}
+	return r
+}
+
+// AllocTickDelta is how one call site's allocation per tick changed from
+// a baseline session
+type AllocTickDelta struct {
+	Site   string  `json:"site"`
+	Before float64 `json:"before"` // bytes per tick
+	After  float64 `json:"after"`
+	Steady bool    `json:"steady"` // in the current session
+	InLoop bool    `json:"inLoop"`
+}
+
+// Change is the relative change, +Inf for a new site
+func (d AllocTickDelta) Change() float64 {
+	return Change{Before: d.Before, After: d.After}.Delta()
+}
+
+// AllocTickDiff compares a session's allocation per tick to a baseline's
+type AllocTickDiff struct {
+	Before float64          `json:"before"` // bytes per tick
+	After  float64          `json:"after"`
+	Sites  []AllocTickDelta `json:"sites"` // largest change in bytes first
+}
+
+// Change is the relative change of the allocation per tick
+func (d AllocTickDiff) Change() float64 {
+	return Change{Before: d.Before, After: d.After}.Delta()
+}
+
+// DiffAllocTicks compares two reports site by site. Both should keep
+// every site, Top 0, so a site isn't taken for new or gone because it
+// fell out of one list.
+func DiffAllocTicks(baseline, current AllocTickReport) AllocTickDiff {
+	d := AllocTickDiff{Before: baseline.BytesPerTick, After: current.BytesPerTick, Sites: []AllocTickDelta{}}
+	sites := make(map[string]*AllocTickDelta)
+	for _, s := range baseline.Sites {
+		sites[s.Site] = &AllocTickDelta{Site: s.Site, Before: s.BytesPerTick}
+	}
+	for _, s := range current.Sites {
+		delta := sites[s.Site]
+		if delta == nil {
+			delta = &AllocTickDelta{Site: s.Site}
+			sites[s.Site] = delta
+		}
+		delta.After, delta.Steady, delta.InLoop = s.BytesPerTick, s.Steady, s.InLoop
+	}
+	for _, delta := range sites {
+		d.Sites = append(d.Sites, *delta)
+	}
+	sort.Slice(d.Sites, func(i, j int) bool {
+		if a, b := math.Abs(d.Sites[i].After-d.Sites[i].Before), math.Abs(d.Sites[j].After-d.Sites[j].Before); a != b {
+			return a > b
+		}
+		return d.Sites[i].Site < d.Sites[j].Site
+	})
+	return d
+}
+
+func writeAllocSamples(dir string, samples []AllocSample) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "allocticks-"+time.Now().Format("20060102-150405.000")+".jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := WriteAllocSamples(f, samples); err != nil {
+		f.Close()
+		return "", fmt.Errorf("write allocation samples: %w", err)
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,114 @@
+package profiler
+
+import (
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// allocSeries builds samples a second and 100 ticks apart from each
+// stack's bytes allocated by then
+func allocSeries(stacks map[string][]int64) []AllocSample {
+	var n int
+	for _, s := range stacks {
+		n = len(s)
+	}
+	out := make([]AllocSample, n)
+	for i := range out {
+		out[i] = AllocSample{AtMs: float64(i) * 1000, Ticks: int64(i) * 100, Sites: make(map[string]SiteUsage)}
+		for stack, bytes := range stacks {
+			out[i].Sites[stack] = SiteUsage{Bytes: bytes[i], Objects: bytes[i] / 32}
+		}
+	}
+	return out
+}
+
+func TestAnalyzeAllocTicks(t *testing.T) {
+	samples := allocSeries(map[string][]int64{
+		"sim.newContact (sim/contact.go:10) < sim.(*World).Step (sim/world.go:40)":   {0, 6400, 12800, 19200, 25600, 32000},
+		"sim.newContact (sim/contact.go:10) < sim.(*World).Settle (sim/world.go:80)": {0, 3200, 6400, 9600, 12800, 16000},
+		"level.Load (level/level.go:5) < main.main (main.go:3)":                      {1 << 20, 1 << 20, 1 << 20, 1 << 20, 1 << 20, 1 << 20},
+		"net.(*Conn).buf (net/conn.go:7) < main.serve (main.go:9)":                   {0, 0, 0, 64000, 64000, 64000},
+	})
+	r := AnalyzeAllocTicks(samples, AllocTickOptions{Loop: []string{"(*World).Step"}, SteadyShare: 0.8})
+	if r.Ticks != 400 || r.DurationMs != 4000 || r.Note != "" {
+		t.Fatalf("report = %+v", r)
+	}
+	// start-up level loading is before the window, so isn't counted
+	if len(r.Sites) != 2 {
+		t.Fatalf("sites = %+v", r.Sites)
+	}
+	conn, contact := r.Sites[0], r.Sites[1]
+	if conn.Site != "net.(*Conn).buf (net/conn.go:7)" || !near(conn.BytesPerTick, 64000.0/400) || conn.Steady || conn.InLoop {
+		t.Errorf("burst = %+v", conn)
+	}
+	if contact.Site != "sim.newContact (sim/contact.go:10)" || !near(contact.BytesPerTick, 96) || !near(contact.ObjectsPerTick, 3) ||
+		!contact.Steady || !contact.InLoop || contact.Active != 1 || !strings.Contains(contact.Stack, "Step") {
+		t.Errorf("steady site = %+v", contact)
+	}
+	if !near(r.BytesPerTick, 96+160) || !near(r.SteadyBytes, 96) {
+		t.Errorf("per tick %v, steady %v", r.BytesPerTick, r.SteadyBytes)
+	}
+	if hot := r.Hot(); len(hot) != 1 || hot[0].Site != contact.Site {
+		t.Errorf("hot = %+v", hot)
+	}
+
+	if r := AnalyzeAllocTicks(samples[:1], DefaultAllocTickOptions()); r.Note == "" || len(r.Sites) != 0 {
+		t.Errorf("one sample: %+v", r)
+	}
+}
+
+func TestDiffAllocTicks(t *testing.T) {
+	before := AllocTickReport{BytesPerTick: 300, Sites: []AllocTickSite{{Site: "a", BytesPerTick: 200}, {Site: "b", BytesPerTick: 100}}}
+	after := AllocTickReport{BytesPerTick: 450, Sites: []AllocTickSite{{Site: "a", BytesPerTick: 250, Steady: true}, {Site: "c", BytesPerTick: 200}}}
+	d := DiffAllocTicks(before, after)
+	if !near(d.Change(), 0.5) || len(d.Sites) != 3 {
+		t.Fatalf("diff = %+v", d)
+	}
+	if d.Sites[0].Site != "c" || !math.IsInf(d.Sites[0].Change(), 1) || d.Sites[1].Site != "b" || d.Sites[1].Change() != -1 {
+		t.Errorf("sites = %+v", d.Sites)
+	}
+	if a := d.Sites[2]; a.Site != "a" || !near(a.Change(), 0.25) || !a.Steady {
+		t.Errorf("a = %+v", a)
+	}
+}
+
+var tickGarbage []byte
+
+func allocTick() {
+	tickGarbage = make([]byte, 4096)
+}
+
+func TestAllocWatchCountsTicks(t *testing.T) {
+	defer func(rate int) { runtime.MemProfileRate = rate }(runtime.MemProfileRate)
+	runtime.MemProfileRate = 1
+	frames := NewFrameCollector()
+	w := StartAllocWatch(time.Hour, frames.Count)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 50; j++ {
+			end := frames.Begin()
+			allocTick()
+			end()
+		}
+		// the profile publishes allocations as of a finished cycle
+		runtime.GC()
+		runtime.GC()
+		w.sample()
+	}
+	samples := w.Stop()
+	if len(samples) != 6 || samples[4].Ticks != 200 {
+		t.Fatalf("%d samples, ticks %+v", len(samples), samples[len(samples)-1].Ticks)
+	}
+	r := AnalyzeAllocTicks(samples[:5], AllocTickOptions{Loop: []string{"TestAllocWatchCountsTicks"}, SteadyShare: 0.8})
+	var site *AllocTickSite
+	for i, s := range r.Sites {
+		if strings.Contains(s.Site, "allocTick") {
+			site = &r.Sites[i]
+		}
+	}
+	if site == nil || !site.Steady || !site.InLoop || site.BytesPerTick < 4096 || site.BytesPerTick > 4096*1.1 {
+		t.Errorf("tick site = %+v of %+v", site, r.Sites)
+	}
+}
@@ -0,0 +1,359 @@
+package profiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FormatBinary is a compact sample dump that can be appended to as a
+// session runs: every function name is written once and stacks refer to
+// it by number, so hours of samples stay a fraction of their JSON size
+const FormatBinary = "binary"
+
+// binaryMagic opens a binary sample dump; the last byte is its version
+const binaryMagic = "STSAMPLES\x01"
+
+// Binary dump records, each a tag byte and its fields. Numbers are
+// varints; strings are a length and their bytes.
+const (
+	recHeader = 'H' // unit, interval in nanoseconds
+	recFrame  = 'F' // a function name, numbered in order from 0
+	recSample = 'S' // depth, that many frame numbers outermost first, weight
+	recRate   = 'R' // at and interval in nanoseconds, overhead as float64 bits
+)
+
+// maxBinaryDepth bounds the stacks a reader accepts, so a corrupt depth
+// doesn't allocate without limit
+const maxBinaryDepth = 1 << 16
+
+// SampleWriter writes samples as a binary dump, one Write after another
+// onto the same stream, such as a sampler's drains through a long run
+type SampleWriter struct {
+	w      *bufio.Writer
+	frames map[string]uint64
+	header bool
+	buf    []byte
+}
+
+// NewSampleWriter starts a binary dump on w
+func NewSampleWriter(w io.Writer) *SampleWriter {
+	return &SampleWriter{w: bufio.NewWriter(w), frames: make(map[string]uint64)}
+}
+
+// Write appends the samples and flushes them. The first Write's unit and
+// interval are the dump's.
+func (sw *SampleWriter) Write(s *Samples) error {
+	if !sw.header {
+		sw.header = true
+		sw.buf = append(sw.buf[:0], binaryMagic...)
+		sw.buf = append(sw.buf, recHeader)
+		sw.buf = appendString(sw.buf, s.Unit)
+		sw.buf = binary.AppendVarint(sw.buf, int64(s.Interval))
+		if _, err := sw.w.Write(sw.buf); err != nil {
+			return err
+		}
+	}
+	for _, sample := range s.Samples {
+		for _, name := range sample.Stack {
+			if _, ok := sw.frames[name]; !ok {
+				sw.frames[name] = uint64(len(sw.frames))
+				sw.buf = appendString(append(sw.buf[:0], recFrame), name)
+				if _, err := sw.w.Write(sw.buf); err != nil {
+					return err
+				}
+			}
+		}
+		sw.buf = binary.AppendUvarint(append(sw.buf[:0], recSample), uint64(len(sample.Stack)))
+		for _, name := range sample.Stack {
+			sw.buf = binary.AppendUvarint(sw.buf, sw.frames[name])
+		}
+		sw.buf = binary.AppendVarint(sw.buf, sample.Weight)
+		if _, err := sw.w.Write(sw.buf); err != nil {
+			return err
+		}
+	}
+	for _, r := range s.Rates {
+		sw.buf = binary.AppendVarint(append(sw.buf[:0], recRate), int64(r.At))
+		sw.buf = binary.AppendVarint(sw.buf, int64(r.Interval))
+		sw.buf = binary.LittleEndian.AppendUint64(sw.buf, math.Float64bits(r.Overhead))
+		if _, err := sw.w.Write(sw.buf); err != nil {
+			return err
+		}
+	}
+	return sw.w.Flush()
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(binary.AppendUvarint(b, uint64(len(s))), s...)
+}
+
+// WriteBinarySamples writes the samples as a binary dump
+func WriteBinarySamples(w io.Writer, s *Samples) error {
+	return NewSampleWriter(w).Write(s)
+}
+
+// SampleReader reads a binary dump a sample at a time, so one too large
+// to hold whole can still be folded or filtered
+type SampleReader struct {
+	r      *countingReader
+	frames []string
+	unit   string
+	every  time.Duration
+	rates  []RateChange
+}
+
+// countingReader counts the bytes read, to place errors in the dump
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// NewSampleReader reads a binary dump's header
+func NewSampleReader(r io.Reader) (*SampleReader, error) {
+	sr := &SampleReader{r: &countingReader{r: bufio.NewReaderSize(r, 64*1024)}}
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(sr.r, magic); err != nil || string(magic) != binaryMagic {
+		return nil, fmt.Errorf("not a binary sample dump")
+	}
+	tag, err := sr.r.ReadByte()
+	if err != nil || tag != recHeader {
+		return nil, fmt.Errorf("binary sample dump has no header")
+	}
+	if sr.unit, err = sr.readString(); err != nil {
+		return nil, sr.corrupt(err)
+	}
+	interval, err := sr.readVarint()
+	if err != nil {
+		return nil, sr.corrupt(err)
+	}
+	sr.every = time.Duration(interval)
+	return sr, nil
+}
+
+// Unit is the samples' weight unit
+func (sr *SampleReader) Unit() string { return sr.unit }
+
+// Interval is the base sampling interval
+func (sr *SampleReader) Interval() time.Duration { return sr.every }
+
+// Rates are the rate changes read so far
+func (sr *SampleReader) Rates() []RateChange { return sr.rates }
+
+// Next returns the next sample, or io.EOF after the last
+func (sr *SampleReader) Next() (Sample, error) {
+	for {
+		tag, err := sr.r.ReadByte()
+		if err == io.EOF {
+			return Sample{}, io.EOF
+		}
+		if err != nil {
+			return Sample{}, err
+		}
+		switch tag {
+		case recFrame:
+			name, err := sr.readString()
+			if err != nil {
+				return Sample{}, sr.corrupt(err)
+			}
+			sr.frames = append(sr.frames, name)
+		case recSample:
+			depth, err := sr.readUvarint()
+			if err != nil {
+				return Sample{}, sr.corrupt(err)
+			}
+			if depth > maxBinaryDepth {
+				return Sample{}, sr.corrupt(fmt.Errorf("stack of %d frames", depth))
+			}
+			sample := Sample{Stack: make([]string, depth)}
+			for i := range sample.Stack {
+				id, err := sr.readUvarint()
+				if err != nil {
+					return Sample{}, sr.corrupt(err)
+				}
+				if id >= uint64(len(sr.frames)) {
+					return Sample{}, sr.corrupt(fmt.Errorf("frame %d not defined", id))
+				}
+				sample.Stack[i] = sr.frames[id]
+			}
+			if sample.Weight, err = sr.readVarint(); err != nil {
+				return Sample{}, sr.corrupt(err)
+			}
+			return sample, nil
+		case recRate:
+			at, err := sr.readVarint()
+			if err != nil {
+				return Sample{}, sr.corrupt(err)
+			}
+			interval, err := sr.readVarint()
+			if err != nil {
+				return Sample{}, sr.corrupt(err)
+			}
+			var bits [8]byte
+			if _, err := io.ReadFull(sr.r, bits[:]); err != nil {
+				return Sample{}, sr.corrupt(err)
+			}
+			sr.rates = append(sr.rates, RateChange{At: time.Duration(at), Interval: time.Duration(interval),
+				Overhead: math.Float64frombits(binary.LittleEndian.Uint64(bits[:]))})
+		default:
+			return Sample{}, sr.corrupt(fmt.Errorf("unknown record %q", tag))
+		}
+	}
+}
+
+func (sr *SampleReader) corrupt(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("binary sample dump at byte %d: %w", sr.r.n, err)
+}
+
+func (sr *SampleReader) readUvarint() (uint64, error) {
+	return binary.ReadUvarint(sr.r)
+}
+
+func (sr *SampleReader) readVarint() (int64, error) {
+	return binary.ReadVarint(sr.r)
+}
+
+func (sr *SampleReader) readString() (string, error) {
+	n, err := sr.readUvarint()
+	if err != nil {
+		return "", err
+	}
+	if n > 1<<20 {
+		return "", fmt.Errorf("string of %d bytes", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ReadBinarySamples reads a binary dump, merging the stacks its writes
+// repeated, so a session's drains add up to one sample per stack
+func ReadBinarySamples(r io.Reader) (*Samples, error) {
+	sr, err := NewSampleReader(r)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+	var samples []Sample
+	for {
+		sample, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := strings.Join(sample.Stack, ";")
+		if i, ok := index[key]; ok {
+			samples[i].Weight += sample.Weight
+			continue
+		}
+		index[key] = len(samples)
+		samples = append(samples, sample)
+	}
+	s := &Samples{Unit: sr.Unit(), Interval: sr.Interval(), Samples: samples, Rates: sr.Rates()}
+	if s.Unit == "" {
+		s.Unit = "samples"
+	}
+	return s, nil
+}
+
+// isBinarySamples reports whether data opens a binary dump
+func isBinarySamples(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(binaryMagic))
+}
+
+// sampleFlushEvery is how often a session writing a binary dump drains
+// its sampler to the file, bounding what a crash loses and what the
+// sampler holds
+const sampleFlushEvery = time.Minute
+
+// sampleStream drains a sampler into a binary dump until stopped
+type sampleStream struct {
+	f       *os.File
+	w       *SampleWriter
+	sampler *Sampler
+	stop    chan struct{}
+	done    chan struct{}
+
+	mu  sync.Mutex
+	err error // the first failed write
+}
+
+// streamSamples opens dir's samples-<time> dump and drains the sampler
+// into it every interval
+func streamSamples(dir string, sampler *Sampler, interval time.Duration) (*sampleStream, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(dir, "samples-"+time.Now().Format("20060102-150405.000")+Extension(FormatBinary)))
+	if err != nil {
+		return nil, err
+	}
+	st := &sampleStream{f: f, w: NewSampleWriter(f), sampler: sampler, stop: make(chan struct{}), done: make(chan struct{})}
+	go st.run(interval)
+	return st, nil
+}
+
+func (st *sampleStream) run(interval time.Duration) {
+	defer close(st.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-st.stop:
+			return
+		case <-ticker.C:
+			st.write(st.sampler.Drain())
+		}
+	}
+}
+
+func (st *sampleStream) write(s *Samples) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.err == nil {
+		st.err = st.w.Write(s)
+	}
+}
+
+// close stops the sampler, writes what it still holds and closes the
+// dump, returning its path
+func (st *sampleStream) close() (string, error) {
+	close(st.stop)
+	<-st.done
+	st.write(st.sampler.Stop())
+	err := errors.Join(st.err, st.f.Close())
+	if err != nil {
+		return st.f.Name(), fmt.Errorf("write samples: %w", err)
+	}
+	return st.f.Name(), nil
+}
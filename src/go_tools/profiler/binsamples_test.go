@@ -0,0 +1,119 @@
+package profiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBinarySamplesRoundTrip(t *testing.T) {
+	first := &Samples{Unit: "microseconds", Interval: 10 * time.Millisecond, Samples: []Sample{
+		{Stack: []string{"main.main", "game.tick", "physics.step"}, Weight: 300},
+		{Stack: []string{"main.main", "game.tick"}, Weight: 20},
+	}, Rates: []RateChange{{At: time.Second, Interval: 20 * time.Millisecond, Overhead: 0.015}}}
+	second := &Samples{Unit: "microseconds", Interval: 10 * time.Millisecond, Samples: []Sample{
+		{Stack: []string{"main.main", "game.tick", "physics.step"}, Weight: 200},
+		{Stack: []string{"main.main", "net.write"}, Weight: 5},
+	}}
+	var buf bytes.Buffer
+	w := NewSampleWriter(&buf)
+	if err := w.Write(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(second); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadBinarySamples(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Samples{Unit: "microseconds", Interval: 10 * time.Millisecond, Samples: []Sample{
+		{Stack: []string{"main.main", "game.tick", "physics.step"}, Weight: 500},
+		{Stack: []string{"main.main", "game.tick"}, Weight: 20},
+		{Stack: []string{"main.main", "net.write"}, Weight: 5},
+	}, Rates: first.Rates}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read %+v, want %+v", got, want)
+	}
+
+	// the second write only names the one new function
+	if n := bytes.Count(buf.Bytes(), []byte("game.tick")); n != 1 {
+		t.Errorf("game.tick written %d times", n)
+	}
+	js, _ := json.Marshal(want)
+	if buf.Len()*2 > len(js) {
+		t.Errorf("binary is %d bytes, json %d", buf.Len(), len(js))
+	}
+}
+
+func TestBinarySamplesCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	WriteBinarySamples(&buf, &Samples{Unit: "samples", Samples: []Sample{{Stack: []string{"a", "b"}, Weight: 3}}})
+	data := buf.Bytes()
+	if _, err := ReadBinarySamples(bytes.NewReader(data[:len(data)-1])); err == nil || !strings.Contains(err.Error(), "unexpected EOF") {
+		t.Errorf("truncated: %v", err)
+	}
+	if _, err := ReadBinarySamples(strings.NewReader(`{"unit":"samples"}`)); err == nil {
+		t.Error("json read as binary")
+	}
+	bad := append([]byte(nil), data...)
+	bad[len(bad)-3] = 9 // a frame number past those defined
+	if _, err := ReadBinarySamples(bytes.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "not defined") {
+		t.Errorf("bad frame: %v", err)
+	}
+}
+
+func TestLoadSamplesReadsBothFormats(t *testing.T) {
+	dir := t.TempDir()
+	s := &Samples{Unit: "samples", Interval: time.Millisecond, Samples: []Sample{{Stack: []string{"a", "b"}, Weight: 3}}}
+	for _, format := range []string{FormatJSON, FormatBinary} {
+		path := filepath.Join(dir, "samples"+Extension(format))
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteSamples(f, s, format, ""); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		got, err := LoadSamples(path)
+		if err != nil || !reflect.DeepEqual(got, s) {
+			t.Errorf("%s: %+v, %v", format, got, err)
+		}
+		if !isSampleDump(path) {
+			t.Errorf("%s not taken for a sample dump", path)
+		}
+	}
+}
+
+func TestSessionStreamsBinarySamples(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Start(Options{Dir: dir, SampleInterval: time.Millisecond, SampleFormat: FormatBinary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.stream.write(s.sampler.Drain()) // as the minute's flush would
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for x := 0; time.Now().Before(deadline); x++ {
+		_ = x * x
+	}
+	paths, err := s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || !strings.HasSuffix(paths[0], ".bin") {
+		t.Fatalf("paths = %v", paths)
+	}
+	got, err := LoadSamples(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Unit != "samples" || got.Interval != time.Millisecond || len(got.Samples) == 0 {
+		t.Errorf("samples = %+v", got)
+	}
+}
@@ -0,0 +1,192 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Budgets are the performance limits a run must stay under; a zero limit
+// is left unchecked
+type Budgets struct {
+	TickMs         float64 `json:"tickMs"`         // the longest a frame or tick may take
+	HeapMiB        float64 `json:"heapMiB"`        // heap in use
+	BandwidthKiBps float64 `json:"bandwidthKiBps"` // network traffic a second per connected player, both ways
+}
+
+// Any reports whether a budget is set
+func (b Budgets) Any() bool {
+	return b.TickMs > 0 || b.HeapMiB > 0 || b.BandwidthKiBps > 0
+}
+
+// Budget names, as alerts carry them
+const (
+	BudgetTick      = "tick"
+	BudgetHeap      = "heap"
+	BudgetBandwidth = "bandwidth"
+)
+
+// Alert states: a budget starts being exceeded, or is met again
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alert is a budget changing state, one JSON object per line in logs
+type Alert struct {
+	At     time.Time `json:"at"`
+	Budget string    `json:"budget"`
+	State  string    `json:"state"`
+	Value  float64   `json:"value"` // at the check that changed the state
+	Limit  float64   `json:"limit"`
+	Unit   string    `json:"unit"`
+}
+
+func (a Alert) String() string {
+	if a.State == AlertResolved {
+		return fmt.Sprintf("%s budget met again: %.4g %s, under %.4g", a.Budget, a.Value, a.Unit, a.Limit)
+	}
+	return fmt.Sprintf("%s budget exceeded: %.4g %s over %.4g", a.Budget, a.Value, a.Unit, a.Limit)
+}
+
+// AlertLog writes each alert to w as a JSON line
+func AlertLog(w io.Writer) func(Alert) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(a Alert) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(a)
+	}
+}
+
+// budgetWindow is what LiveMetrics saw since the last budget check
+type budgetWindow struct {
+	peakTick time.Duration
+	bytes    uint64
+	conns    map[string]bool
+}
+
+// takeWindow returns the window and starts the next one
+func (m *LiveMetrics) takeWindow() budgetWindow {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w := m.window
+	m.window = budgetWindow{}
+	return w
+}
+
+// BudgetWatch checks budgets against live metrics every interval until
+// Stop, alerting as each is exceeded and met again
+type BudgetWatch struct {
+	metrics  *LiveMetrics
+	budgets  Budgets
+	alert    func(Alert)
+	interval time.Duration
+
+	mu       sync.Mutex
+	last     time.Time
+	firing   map[string]bool
+	exceeded map[string]bool // budgets exceeded at any check
+	alerts   []Alert
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartBudgetWatch watches m, which the run's frame collectors and
+// network recorders publish to; alert, if set, sees each alert as raised
+func StartBudgetWatch(m *LiveMetrics, budgets Budgets, interval time.Duration, alert func(Alert)) *BudgetWatch {
+	w := &BudgetWatch{metrics: m, budgets: budgets, alert: alert, interval: interval, last: time.Now(),
+		firing: make(map[string]bool), exceeded: make(map[string]bool),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	m.takeWindow()
+	go w.run()
+	return w
+}
+
+func (w *BudgetWatch) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			w.Check(now)
+		}
+	}
+}
+
+// Check evaluates the budgets over the time since the last check
+func (w *BudgetWatch) Check(now time.Time) {
+	window := w.metrics.takeWindow()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	w.mu.Lock()
+	secs := now.Sub(w.last).Seconds()
+	w.last = now
+	var raised []Alert
+	check := func(budget string, value, limit float64, unit string) {
+		if limit <= 0 {
+			return
+		}
+		over := value > limit
+		if over == w.firing[budget] {
+			return
+		}
+		w.firing[budget] = over
+		state := AlertResolved
+		if over {
+			state = AlertFiring
+			w.exceeded[budget] = true
+		}
+		raised = append(raised, Alert{At: now, Budget: budget, State: state, Value: value, Limit: limit, Unit: unit})
+	}
+	check(BudgetTick, float64(window.peakTick)/float64(time.Millisecond), w.budgets.TickMs, "ms")
+	check(BudgetHeap, float64(ms.HeapInuse)/(1<<20), w.budgets.HeapMiB, "MiB")
+	if secs > 0 {
+		players := max(1, len(window.conns))
+		check(BudgetBandwidth, float64(window.bytes)/1024/secs/float64(players), w.budgets.BandwidthKiBps, "KiB/s per player")
+	}
+	w.alerts = append(w.alerts, raised...)
+	w.mu.Unlock()
+
+	if w.alert != nil {
+		for _, a := range raised {
+			w.alert(a)
+		}
+	}
+}
+
+// Stop checks once more, for the end of a batch, and stops watching
+func (w *BudgetWatch) Stop() {
+	close(w.stop)
+	<-w.done
+	w.Check(time.Now())
+}
+
+// Exceeded lists the budgets exceeded at any check, in budget order
+func (w *BudgetWatch) Exceeded() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var out []string
+	for _, budget := range []string{BudgetTick, BudgetHeap, BudgetBandwidth} {
+		if w.exceeded[budget] {
+			out = append(out, budget)
+		}
+	}
+	return out
+}
+
+// Alerts returns the alerts raised so far
+func (w *BudgetWatch) Alerts() []Alert {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Alert(nil), w.alerts...)
+}
@@ -0,0 +1,52 @@
+package profiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBudgetWatch(t *testing.T) {
+	m := NewLiveMetrics()
+	net := NewNetworkRecorder()
+	net.Publish(m)
+	var raised []Alert
+	w := StartBudgetWatch(m, Budgets{TickMs: 20, HeapMiB: 1 << 20, BandwidthKiBps: 1}, time.Hour, func(a Alert) { raised = append(raised, a) })
+	start := w.last
+
+	m.ObserveTick(5 * time.Millisecond)
+	m.ObserveTick(30 * time.Millisecond)
+	// two players sending 3KiB in a second is 1.5KiB/s each
+	net.Conn("p1").Marshal("state", strings.Repeat("x", 1534))
+	net.Conn("p2").Marshal("state", strings.Repeat("x", 1534))
+	w.Check(start.Add(time.Second))
+	if len(raised) != 2 || raised[0].Budget != BudgetTick || raised[0].State != AlertFiring || raised[0].Value != 30 ||
+		raised[1].Budget != BudgetBandwidth || !near(raised[1].Value, 1.5) {
+		t.Fatalf("alerts = %+v", raised)
+	}
+
+	// a quiet second resolves both; still under budget raises nothing more
+	m.ObserveTick(5 * time.Millisecond)
+	w.Check(start.Add(2 * time.Second))
+	w.Check(start.Add(3 * time.Second))
+	if len(raised) != 4 || raised[2].State != AlertResolved || raised[3].State != AlertResolved {
+		t.Errorf("alerts = %+v", raised)
+	}
+	w.Stop()
+	if got := w.Exceeded(); !reflect.DeepEqual(got, []string{BudgetTick, BudgetBandwidth}) {
+		t.Errorf("exceeded = %v", got)
+	}
+	if len(w.Alerts()) != 4 {
+		t.Errorf("kept %d alerts", len(w.Alerts()))
+	}
+
+	var buf bytes.Buffer
+	AlertLog(&buf)(raised[0])
+	var a Alert
+	if err := json.Unmarshal(buf.Bytes(), &a); err != nil || a.Budget != BudgetTick || a.Unit != "ms" {
+		t.Errorf("logged %q: %v", buf.String(), err)
+	}
+}
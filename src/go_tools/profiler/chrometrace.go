@@ -0,0 +1,243 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+)
+
+// Timeline tracks, one row each in a trace viewer
+const (
+	TrackPhysics   = "physics"
+	TrackNetwork   = "network"
+	TrackGenerator = "generator"
+	TrackSamples   = "cpu samples" // merged stacks, a flame chart rather than a timeline
+)
+
+// trackOrder is how the viewer stacks the known tracks; others follow by
+// name, and the samples come last
+var trackOrder = []string{TrackMarkers, TrackPhysics, TrackNetwork, TrackGenerator, TrackDisk, TrackEditor}
+
+// TraceEvent is one timed span on a track, or an instant across them all
+type TraceEvent struct {
+	Track   string
+	Name    string
+	Start   time.Duration // since the timeline began
+	Dur     time.Duration
+	Args    map[string]any
+	Instant bool
+}
+
+// timelineLimit caps what a long run keeps; later spans are dropped
+const timelineLimit = 1 << 20
+
+// Timeline collects timed spans of the subsystems for a trace viewer. A
+// nil timeline records nothing. It is also a tracing exporter, so traced
+// work such as generator stages shows up without timing it twice.
+type Timeline struct {
+	start   time.Time
+	mu      sync.Mutex
+	events  []TraceEvent
+	dropped int
+}
+
+// NewTimeline starts a timeline's clock
+func NewTimeline() *Timeline {
+	return &Timeline{start: time.Now()}
+}
+
+// Span starts a span on track; calling the result ends it
+func (t *Timeline) Span(track, name string) func() {
+	if t == nil {
+		return func() {}
+	}
+	begin := time.Now()
+	return func() { t.Add(track, name, begin, time.Since(begin), nil) }
+}
+
+// Began is when the timeline's clock started, the zero of its events
+func (t *Timeline) Began() time.Time {
+	return t.start
+}
+
+// Add records a span that began at begin and took d
+func (t *Timeline) Add(track, name string, begin time.Time, d time.Duration, args map[string]any) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.events) >= timelineLimit {
+		t.dropped++
+		return
+	}
+	t.events = append(t.events, TraceEvent{Track: track, Name: name, Start: begin.Sub(t.start), Dur: d, Args: args})
+}
+
+// Events returns the spans recorded so far, with the process's markers
+// since the timeline began
+func (t *Timeline) Events() []TraceEvent {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	out := slices.Clone(t.events)
+	t.mu.Unlock()
+	for _, m := range Markers(t.start, time.Now()) {
+		out = append(out, TraceEvent{Track: TrackMarkers, Name: m.Name, Start: m.At.Sub(t.start), Dur: m.Dur, Instant: m.Dur == 0})
+	}
+	return out
+}
+
+// Dropped is how many spans the timeline had no room for
+func (t *Timeline) Dropped() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped
+}
+
+// ExportSpans records finished tracing spans, each on the track its name
+// starts with: generator.terrain is terrain on the generator track
+func (t *Timeline) ExportSpans(ctx context.Context, spans []tracing.SpanData) error {
+	for _, s := range spans {
+		track, name, ok := strings.Cut(s.Name, ".")
+		if !ok {
+			name = s.Name
+		}
+		var args map[string]any
+		if len(s.Attrs) > 0 || s.Err != "" {
+			args = make(map[string]any, len(s.Attrs)+1)
+			for _, a := range s.Attrs {
+				args[a.Key] = a.Value
+			}
+			if s.Err != "" {
+				args["error"] = s.Err
+			}
+		}
+		t.Add(track, name, s.Start, s.End.Sub(s.Start), args)
+	}
+	return nil
+}
+
+// chromeEvent is an event of the trace event format chrome://tracing and
+// Perfetto read
+type chromeEvent struct {
+	Name  string         `json:"name"`
+	Cat   string         `json:"cat,omitempty"`
+	Phase string         `json:"ph"`
+	TS    float64        `json:"ts"` // microseconds
+	Dur   float64        `json:"dur,omitempty"`
+	Scope string         `json:"s,omitempty"` // g draws an instant across every track
+	PID   int            `json:"pid"`
+	TID   int            `json:"tid"`
+	Args  map[string]any `json:"args,omitempty"`
+}
+
+// WriteChromeTrace writes the timeline's events and the samples, either of
+// which may be missing, as trace event JSON with a track per subsystem.
+// The samples are merged into a flame chart on a track of their own,
+// each stack as long as the time its samples stand for.
+func WriteChromeTrace(w io.Writer, s *Samples, events []TraceEvent, title string) error {
+	return writeChromeTrace(w, s, events, title, time.Time{})
+}
+
+// writeChromeTrace also records when the events' clock started, if known,
+// so traces of several processes can be lined up
+func writeChromeTrace(w io.Writer, s *Samples, events []TraceEvent, title string, began time.Time) error {
+	tracks := make(map[string]bool)
+	for _, e := range events {
+		tracks[e.Track] = true
+	}
+	var order []string
+	for _, track := range trackOrder {
+		if tracks[track] {
+			order = append(order, track)
+			delete(tracks, track)
+		}
+	}
+	var rest []string
+	for track := range tracks {
+		rest = append(rest, track)
+	}
+	sort.Strings(rest)
+	order = append(order, rest...)
+	if s != nil && len(s.Samples) > 0 {
+		order = append(order, TrackSamples)
+	}
+
+	out := []chromeEvent{{Name: "process_name", Phase: "M", PID: 1, Args: map[string]any{"name": title}}}
+	tids := make(map[string]int, len(order))
+	for i, track := range order {
+		tids[track] = i + 1
+		out = append(out,
+			chromeEvent{Name: "thread_name", Phase: "M", PID: 1, TID: i + 1, Args: map[string]any{"name": track}},
+			chromeEvent{Name: "thread_sort_index", Phase: "M", PID: 1, TID: i + 1, Args: map[string]any{"sort_index": i}})
+	}
+	sorted := slices.Clone(events)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	for _, e := range sorted {
+		ce := chromeEvent{Name: e.Name, Cat: e.Track, Phase: "X", TS: micros(e.Start), Dur: micros(e.Dur),
+			PID: 1, TID: tids[e.Track], Args: e.Args}
+		if e.Instant {
+			ce.Phase, ce.Scope = "i", "g"
+		}
+		out = append(out, ce)
+	}
+	if tid, ok := tids[TrackSamples]; ok {
+		root, _ := flameTree(s)
+		scale := sampleMicros(s)
+		var walk func(n *flameNode, at float64)
+		walk = func(n *flameNode, at float64) {
+			for _, c := range n.sortedChildren() {
+				dur := float64(c.total) * scale
+				out = append(out, chromeEvent{Name: c.name, Cat: TrackSamples, Phase: "X", TS: at, Dur: dur,
+					PID: 1, TID: tid, Args: map[string]any{"weight": c.total, "unit": s.Unit}})
+				walk(c, at)
+				at += dur
+			}
+		}
+		walk(root, 0)
+	}
+
+	other := map[string]any{"exporter": "supertetris profiler", "title": title}
+	if !began.IsZero() {
+		other[traceStartKey] = began.UnixMicro()
+	}
+	enc := json.NewEncoder(w)
+	return enc.Encode(map[string]any{
+		"traceEvents":     out,
+		"displayTimeUnit": "ms",
+		"otherData":       other,
+	})
+}
+
+func micros(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+// sampleMicros is how long a unit of sample weight stands for
+func sampleMicros(s *Samples) float64 {
+	switch s.Unit {
+	case "nanoseconds":
+		return 0.001
+	case "milliseconds":
+		return 1000
+	case "seconds":
+		return 1e6
+	case "samples":
+		if s.Interval > 0 {
+			return micros(s.Interval)
+		}
+	}
+	return 1
+}
@@ -0,0 +1,73 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"
+)
+
+func TestWriteChromeTrace(t *testing.T) {
+	tl := NewTimeline()
+	rec := NewPhysicsRecorder("level1")
+	rec.Trace(tl)
+	step := rec.Step(4)
+	step.Phase(PhaseCollision)()
+	step.End()
+	NewNetworkRecorder().Conn("c").Marshal("state", 1)
+	net := NewNetworkRecorder()
+	net.Trace(tl)
+	net.Conn("c").Marshal("state", map[string]int{"x": 1})
+	tl.ExportSpans(context.Background(), []tracing.SpanData{{
+		Name: "generator.terrain", Start: tl.start, End: tl.start.Add(3 * time.Millisecond),
+		Attrs: []tracing.Attr{tracing.String("level", "a")},
+	}})
+	var off *Timeline
+	off.Span(TrackPhysics, "nothing")()
+
+	samples := &Samples{Unit: "samples", Interval: time.Millisecond, Samples: []Sample{
+		{Stack: []string{"main", "a"}, Weight: 3}, {Stack: []string{"main", "b"}, Weight: 1},
+	}}
+	var buf bytes.Buffer
+	if err := WriteChromeTrace(&buf, samples, tl.Events(), "run"); err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatal(err)
+	}
+	tracks := map[int]string{}
+	spans := map[string]chromeEvent{}
+	for _, e := range trace.TraceEvents {
+		if e.Name == "thread_name" {
+			tracks[e.TID] = e.Args["name"].(string)
+		}
+		if e.Phase == "X" {
+			spans[e.Cat+"/"+e.Name] = e
+		}
+	}
+	want := map[int]string{1: TrackPhysics, 2: TrackNetwork, 3: TrackGenerator, 4: TrackSamples}
+	for tid, name := range want {
+		if tracks[tid] != name {
+			t.Errorf("tracks = %v, want %v", tracks, want)
+			break
+		}
+	}
+	for _, key := range []string{"physics/step", "physics/collision", "network/marshal state", "generator/terrain", "cpu samples/main"} {
+		if _, ok := spans[key]; !ok {
+			t.Errorf("no %s span in %v", key, spans)
+		}
+	}
+	if g := spans["generator/terrain"]; g.Dur != 3000 || g.Args["level"] != "a" {
+		t.Errorf("terrain = %+v", g)
+	}
+	// stacks are as long as their samples, callees side by side
+	if m, a, b := spans["cpu samples/main"], spans["cpu samples/a"], spans["cpu samples/b"]; m.Dur != 4000 || a.Dur != 3000 || b.TS != 3000 {
+		t.Errorf("samples: main %+v, a %+v, b %+v", m, a, b)
+	}
+}
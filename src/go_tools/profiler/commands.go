@@ -0,0 +1,251 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TrackEditor is the timeline track of editor commands
+const TrackEditor = "editor"
+
+// DefaultCommandStall is how long a command runs before it is a stall a
+// designer notices
+const DefaultCommandStall = time.Second
+
+// CommandEvent is one editor command run through the command engine, as
+// its profiling middleware logs them one JSON object per line
+type CommandEvent struct {
+	At         float64 `json:"at"`      // start, in milliseconds since the capture began
+	Command    string  `json:"command"` // such as fill, paste or move selection
+	Level      string  `json:"level,omitempty"`
+	Blocks     int     `json:"blocks"` // in the level as the command ran
+	Ms         float64 `json:"ms"`
+	AllocBytes int64   `json:"allocBytes"` // allocated while it ran
+	Allocs     int64   `json:"allocs"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// ReadCommandEvents reads JSON-lines editor commands; blank lines are
+// skipped
+func ReadCommandEvents(r io.Reader) ([]CommandEvent, error) {
+	var out []CommandEvent
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var ev CommandEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ev.Command == "" {
+			return nil, fmt.Errorf("line %d: no command", line)
+		}
+		if ev.Ms < 0 || ev.Blocks < 0 || ev.AllocBytes < 0 || ev.Allocs < 0 {
+			return nil, fmt.Errorf("line %d: negative time, size or allocation", line)
+		}
+		out = append(out, ev)
+	}
+	return out, sc.Err()
+}
+
+// WriteCommandEvents writes editor commands as JSON lines
+func WriteCommandEvents(w io.Writer, events []CommandEvent) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// CommandRecorder is the command engine's profiling middleware: every
+// command it runs is timed, with what the process allocated meanwhile. A
+// nil recorder records nothing and still runs the commands.
+type CommandRecorder struct {
+	start    time.Time
+	mu       sync.Mutex
+	events   []CommandEvent
+	timeline *Timeline
+}
+
+// NewCommandRecorder starts a capture's clock
+func NewCommandRecorder() *CommandRecorder {
+	return &CommandRecorder{start: time.Now()}
+}
+
+// allocMetrics are the runtime's running allocation totals, cheap enough
+// to read around every command
+var allocMetrics = []string{"/gc/heap/allocs:bytes", "/gc/heap/allocs:objects"}
+
+func readAllocs() (bytes, objects int64) {
+	samples := make([]metrics.Sample, len(allocMetrics))
+	for i, name := range allocMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		bytes = int64(samples[0].Value.Uint64())
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		objects = int64(samples[1].Value.Uint64())
+	}
+	return bytes, objects
+}
+
+// Run runs command on level, of blocks blocks, and records it. The
+// allocation is the whole process's while it ran, so commands run one at
+// a time, as the engine does, to be told apart; small allocations count
+// as the runtime refills its caches, so it is good to a few KiB.
+func (r *CommandRecorder) Run(command, level string, blocks int, fn func() error) error {
+	if r == nil {
+		return fn()
+	}
+	bytes, objects := readAllocs()
+	begin := time.Now()
+	err := fn()
+	d := time.Since(begin)
+	afterBytes, afterObjects := readAllocs()
+	ev := CommandEvent{Command: command, Level: level, Blocks: blocks, Ms: ms(d),
+		AllocBytes: afterBytes - bytes, Allocs: afterObjects - objects}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ev.At = ms(begin.Sub(r.start))
+	r.events = append(r.events, ev)
+	r.timeline.Add(TrackEditor, command, begin, d, map[string]any{"level": level, "blocks": blocks, "allocBytes": ev.AllocBytes})
+	return err
+}
+
+// Events returns the commands recorded so far
+func (r *CommandRecorder) Events() []CommandEvent {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+// Trace puts the recorder's later commands on t's editor track
+func (r *CommandRecorder) Trace(t *Timeline) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeline = t
+}
+
+// CommandStats is one command's latency and allocation, and how its time
+// grows with the level
+type CommandStats struct {
+	Command      string       `json:"command"`
+	Count        int          `json:"count"`
+	Errors       int          `json:"errors"`
+	LatencyMs    Distribution `json:"latencyMs"`
+	AllocBytes   float64      `json:"allocBytes"` // mean per run
+	Allocs       float64      `json:"allocs"`
+	Stalls       int          `json:"stalls"`       // runs longer than the stall threshold
+	MsPerKBlocks float64      `json:"msPerKBlocks"` // least-squares growth with level size; 0 with one size
+	MaxBlocks    int          `json:"maxBlocks"`
+}
+
+// slowestCommands is how many of the slowest commands a report keeps
+const slowestCommands = 10
+
+// CommandReport summarizes a capture's editor commands, commands by the
+// time spent in them
+type CommandReport struct {
+	Events   int            `json:"events"`
+	StallMs  float64        `json:"stallMs"`
+	Commands []CommandStats `json:"commands"`
+	Slowest  []CommandEvent `json:"slowest"` // over the stall threshold, slowest first
+}
+
+// AnalyzeCommands summarizes editor commands per command, counting runs
+// longer than stall as stalls, and fits each command's time against the
+// level's block count: a command whose time climbs with it is what huge
+// levels stall on
+func AnalyzeCommands(events []CommandEvent, stall time.Duration) CommandReport {
+	r := CommandReport{Events: len(events), StallMs: ms(stall), Commands: []CommandStats{}, Slowest: []CommandEvent{}}
+	type acc struct {
+		stats     CommandStats
+		latencies []float64
+		blocks    []float64
+		bytes     int64
+		objects   int64
+	}
+	byCommand := make(map[string]*acc)
+	for _, ev := range events {
+		a := byCommand[ev.Command]
+		if a == nil {
+			a = &acc{stats: CommandStats{Command: ev.Command}}
+			byCommand[ev.Command] = a
+		}
+		a.stats.Count++
+		if ev.Error != "" {
+			a.stats.Errors++
+		}
+		a.latencies = append(a.latencies, ev.Ms)
+		a.blocks = append(a.blocks, float64(ev.Blocks))
+		a.bytes += ev.AllocBytes
+		a.objects += ev.Allocs
+		a.stats.MaxBlocks = max(a.stats.MaxBlocks, ev.Blocks)
+		if ev.Ms > r.StallMs {
+			a.stats.Stalls++
+			r.Slowest = append(r.Slowest, ev)
+		}
+	}
+	for _, a := range byCommand {
+		a.stats.AllocBytes = float64(a.bytes) / float64(a.stats.Count)
+		a.stats.Allocs = float64(a.objects) / float64(a.stats.Count)
+		a.stats.MsPerKBlocks = fitSlope(a.blocks, a.latencies) * 1000
+		a.stats.LatencyMs = distribution(a.latencies)
+		r.Commands = append(r.Commands, a.stats)
+	}
+	sort.Slice(r.Commands, func(i, j int) bool {
+		ti, tj := r.Commands[i].LatencyMs.Mean*float64(r.Commands[i].Count), r.Commands[j].LatencyMs.Mean*float64(r.Commands[j].Count)
+		if ti != tj {
+			return ti > tj
+		}
+		return r.Commands[i].Command < r.Commands[j].Command
+	})
+	sort.SliceStable(r.Slowest, func(i, j int) bool { return r.Slowest[i].Ms > r.Slowest[j].Ms })
+	if len(r.Slowest) > slowestCommands {
+		r.Slowest = r.Slowest[:slowestCommands]
+	}
+	return r
+}
+
+func writeCommandEvents(dir string, events []CommandEvent) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "commands-"+time.Now().Format("20060102-150405.000")+".jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := WriteCommandEvents(f, events); err != nil {
+		f.Close()
+		return "", fmt.Errorf("write commands: %w", err)
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,79 @@
+package profiler
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeCommands(t *testing.T) {
+	var events []CommandEvent
+	for i, blocks := range []int{1000, 2000, 4000, 8000} {
+		// fill grows with the level; paste doesn't
+		events = append(events,
+			CommandEvent{At: float64(i) * 1000, Command: "fill", Blocks: blocks, Ms: float64(blocks) / 4, AllocBytes: int64(blocks) * 64, Allocs: int64(blocks)},
+			CommandEvent{At: float64(i)*1000 + 500, Command: "paste", Blocks: blocks, Ms: 5, AllocBytes: 1024, Allocs: 4})
+	}
+	events = append(events, CommandEvent{Command: "paste", Blocks: 8000, Ms: 5, Error: "nothing copied"})
+	r := AnalyzeCommands(events, time.Second)
+	if r.Events != 9 || len(r.Commands) != 2 {
+		t.Fatalf("report = %+v", r)
+	}
+	fill, paste := r.Commands[0], r.Commands[1]
+	if fill.Command != "fill" || fill.Count != 4 || fill.Stalls != 1 || fill.MaxBlocks != 8000 ||
+		!near(fill.MsPerKBlocks, 250) || !near(fill.AllocBytes, 3750*64) || !near(fill.Allocs, 3750) {
+		t.Errorf("fill = %+v", fill)
+	}
+	if paste.Command != "paste" || paste.Count != 5 || paste.Errors != 1 || paste.Stalls != 0 || !near(paste.MsPerKBlocks, 0) {
+		t.Errorf("paste = %+v", paste)
+	}
+	if len(r.Slowest) != 1 || r.Slowest[0].Blocks != 8000 {
+		t.Errorf("slowest = %+v", r.Slowest)
+	}
+}
+
+func TestCommandRecorderRoundTrip(t *testing.T) {
+	rec := NewCommandRecorder()
+	timeline := NewTimeline()
+	rec.Trace(timeline)
+	var grid [][]byte
+	if err := rec.Run("fill", "huge", 4096, func() error {
+		for i := 0; i < 64; i++ {
+			grid = append(grid, make([]byte, 64<<10))
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Run("undo", "huge", 4096, func() error { return errors.New("nothing to undo") }); err == nil {
+		t.Error("command error lost")
+	}
+	events := rec.Events()
+	if len(events) != 2 || events[0].AllocBytes < 64*64<<10 || events[0].Allocs < 64 || events[1].Error != "nothing to undo" {
+		t.Fatalf("events = %+v", events)
+	}
+	if spans := timeline.Events(); len(spans) != 2 || spans[0].Track != TrackEditor {
+		t.Errorf("timeline = %+v", spans)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCommandEvents(&buf, events); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadCommandEvents(&buf)
+	if err != nil || len(back) != 2 || back[0] != events[0] {
+		t.Errorf("read back %+v, %v", back, err)
+	}
+	if _, err := ReadCommandEvents(strings.NewReader(`{"ms":3}`)); err == nil {
+		t.Error("command without a name accepted")
+	}
+
+	var nilRec *CommandRecorder
+	ran := false
+	nilRec.Run("fill", "", 0, func() error { ran = true; return nil })
+	if !ran || nilRec.Events() != nil {
+		t.Error("nil recorder didn't just run the command")
+	}
+}
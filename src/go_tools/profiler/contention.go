@@ -0,0 +1,151 @@
+package profiler
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How finely a session with Contention records lock and blocking events:
+// one mutex contention in contentionFraction, and blocking events of
+// about contentionBlockRate or longer
+const (
+	contentionFraction  = 5
+	contentionBlockRate = 10 * time.Microsecond
+)
+
+// startContention turns on the mutex and block profiles and returns the
+// function turning them back off
+func startContention() func() {
+	prev := runtime.SetMutexProfileFraction(contentionFraction)
+	runtime.SetBlockProfileRate(int(contentionBlockRate))
+	return func() {
+		runtime.SetMutexProfileFraction(prev)
+		runtime.SetBlockProfileRate(0)
+	}
+}
+
+// LockContention is the waiting at one site, the innermost function
+// outside the runtime and sync packages: in a mutex profile the holder
+// whose unlock others had waited for, in a block profile the waiter
+type LockContention struct {
+	Site        string   `json:"site"`
+	Kind        string   `json:"kind"` // the primitive waited on, like sync.(*Mutex).Lock or chan receive
+	Contentions int64    `json:"contentions"`
+	DelayMs     float64  `json:"delayMs"`
+	Share       float64  `json:"share"` // of the profile's delay
+	Stack       []string `json:"stack"` // the site's heaviest stack, outermost first
+}
+
+// ContentionReport ranks the sites of a mutex or block profile by the
+// time spent waiting at them, most first
+type ContentionReport struct {
+	Profile     string           `json:"profile"` // mutex or block
+	Contentions int64            `json:"contentions"`
+	DelayMs     float64          `json:"delayMs"`
+	Sites       []LockContention `json:"sites"`
+}
+
+// waitKinds names the primitives a blocked stack ends in
+var waitKinds = map[string]string{
+	"runtime.chanrecv1":       "chan receive",
+	"runtime.chanrecv2":       "chan receive",
+	"runtime.chansend1":       "chan send",
+	"runtime.selectgo":        "select",
+	"runtime.selectnbrecv":    "select",
+	"sync.runtime_Semacquire": "semaphore",
+}
+
+// AnalyzeContention groups a mutex or block profile's stacks by site.
+// With focus, only stacks through a function containing one of its
+// strings count, such as the simulation's or server's packages; top
+// limits the sites kept, 0 keeping them all.
+func AnalyzeContention(p *Profile, name string, focus []string, top int) ContentionReport {
+	r := ContentionReport{Profile: name, Sites: []LockContention{}}
+	counts, delays := p.ValueIndex("contentions"), p.ValueIndex("delay")
+	if counts < 0 || delays < 0 {
+		return r
+	}
+	type acc struct {
+		LockContention
+		heaviest int64
+	}
+	bySite := make(map[string]*acc)
+	var delayNs int64
+	for _, s := range p.Samples {
+		if len(s.Values) <= max(counts, delays) || len(s.Stack) == 0 || !focused(s.Stack, focus) {
+			continue
+		}
+		site, kind := contentionSite(s.Stack)
+		a := bySite[site]
+		if a == nil {
+			a = &acc{LockContention: LockContention{Site: site, Kind: kind}}
+			bySite[site] = a
+		}
+		n, d := s.Values[counts], s.Values[delays]
+		a.Contentions += n
+		a.DelayMs += float64(d) / float64(time.Millisecond)
+		if d > a.heaviest {
+			a.heaviest, a.Stack, a.Kind = d, s.Stack, kind
+		}
+		r.Contentions += n
+		delayNs += d
+	}
+	r.DelayMs = float64(delayNs) / float64(time.Millisecond)
+	for _, a := range bySite {
+		if r.DelayMs > 0 {
+			a.Share = a.DelayMs / r.DelayMs
+		}
+		r.Sites = append(r.Sites, a.LockContention)
+	}
+	sort.Slice(r.Sites, func(i, j int) bool {
+		if r.Sites[i].DelayMs != r.Sites[j].DelayMs {
+			return r.Sites[i].DelayMs > r.Sites[j].DelayMs
+		}
+		return r.Sites[i].Site < r.Sites[j].Site
+	})
+	if top > 0 && len(r.Sites) > top {
+		r.Sites = r.Sites[:top]
+	}
+	return r
+}
+
+// contentionSite finds where a stack, outermost first, waited: the
+// innermost frame of the program's own code, and the primitive under it
+func contentionSite(stack []string) (site, kind string) {
+	for i := len(stack) - 1; i >= 0; i-- {
+		fn := stack[i]
+		if !waitInternal(fn) {
+			if i+1 < len(stack) {
+				kind = stack[i+1]
+				if k, ok := waitKinds[kind]; ok {
+					kind = k
+				}
+			}
+			return fn, kind
+		}
+	}
+	return stack[0], stack[len(stack)-1]
+}
+
+// waitInternal reports whether fn is the runtime's or a sync primitive's
+func waitInternal(fn string) bool {
+	return strings.HasPrefix(fn, "runtime.") || strings.HasPrefix(fn, "sync.") || strings.HasPrefix(fn, "internal/")
+}
+
+// focused reports whether the stack passes through a function containing
+// any of focus, or focus is empty
+func focused(stack []string, focus []string) bool {
+	if len(focus) == 0 {
+		return true
+	}
+	for _, fn := range stack {
+		for _, f := range focus {
+			if strings.Contains(fn, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package profiler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeContention(t *testing.T) {
+	p := &Profile{
+		SampleTypes: []ValueType{{"contentions", "count"}, {"delay", "nanoseconds"}},
+		Samples: []ProfileSample{
+			{Stack: []string{"main.main", "websocket.(*Hub).Broadcast", "sync.(*Mutex).Unlock"}, Values: []int64{30, 60e6}},
+			{Stack: []string{"main.main", "websocket.(*Hub).Register", "sync.(*Mutex).Unlock"}, Values: []int64{10, 20e6}},
+			{Stack: []string{"main.tick", "websocket.(*Hub).Broadcast", "sync.(*Mutex).Unlock"}, Values: []int64{5, 80e6}},
+			{Stack: []string{"main.main", "store.(*DB).Save", "runtime.chanrecv1"}, Values: []int64{5, 40e6}},
+		},
+	}
+	r := AnalyzeContention(p, "mutex", nil, 0)
+	if r.Contentions != 50 || !near(r.DelayMs, 200) || len(r.Sites) != 3 {
+		t.Fatalf("report = %+v", r)
+	}
+	top := r.Sites[0]
+	if top.Site != "websocket.(*Hub).Broadcast" || top.Kind != "sync.(*Mutex).Unlock" || top.Contentions != 35 ||
+		!near(top.DelayMs, 140) || !near(top.Share, 0.7) || top.Stack[0] != "main.tick" {
+		t.Errorf("top site = %+v", top)
+	}
+	if s := r.Sites[1]; s.Site != "store.(*DB).Save" || s.Kind != "chan receive" {
+		t.Errorf("second site = %+v", s)
+	}
+
+	focused := AnalyzeContention(p, "mutex", []string{"store."}, 0)
+	if len(focused.Sites) != 1 || focused.Contentions != 5 || !near(focused.Sites[0].Share, 1) {
+		t.Errorf("focused = %+v", focused)
+	}
+	if r := AnalyzeContention(p, "mutex", nil, 1); len(r.Sites) != 1 || r.Contentions != 50 {
+		t.Errorf("top 1 = %+v", r)
+	}
+	cpu := &Profile{SampleTypes: []ValueType{{"cpu", "nanoseconds"}}, Samples: p.Samples}
+	if r := AnalyzeContention(cpu, "cpu", nil, 0); len(r.Sites) != 0 {
+		t.Errorf("cpu profile read as contention: %+v", r)
+	}
+}
+
+func TestSessionRecordsContention(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Start(Options{Contention: true, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(ch)
+	}()
+	<-ch
+	paths, err := s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || !strings.Contains(paths[0], "mutex-") || !strings.Contains(paths[1], "block-") {
+		t.Fatalf("profiles = %v, want mutex and block", paths)
+	}
+	p, err := LoadProfile(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := AnalyzeContention(p, "block", []string{"TestSessionRecordsContention"}, 0)
+	if len(r.Sites) == 0 || r.Sites[0].Kind != "chan receive" || r.DelayMs < 10 {
+		t.Errorf("block report = %+v", r)
+	}
+}
@@ -0,0 +1,328 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ContinuousOptions configure always-on profiling: a short window of stack
+// samples every so often, cheap enough to leave running through soak tests
+// and playtests
+type ContinuousOptions struct {
+	Dir            string        // captures and rollups are kept here
+	Every          time.Duration // from one capture's start to the next
+	Window         time.Duration // how long each capture samples
+	SampleInterval time.Duration // between stack samples within a window
+	RollupAfter    time.Duration // older captures are merged into hourly rollups
+	Retention      time.Duration // older rollups are deleted
+}
+
+// DefaultContinuousOptions capture 10s of every minute, roll captures up
+// by the hour after a day and keep two weeks
+func DefaultContinuousOptions(dir string) ContinuousOptions {
+	return ContinuousOptions{
+		Dir:            dir,
+		Every:          time.Minute,
+		Window:         10 * time.Second,
+		SampleInterval: 50 * time.Millisecond,
+		RollupAfter:    24 * time.Hour,
+		Retention:      14 * 24 * time.Hour,
+	}
+}
+
+// RuntimeStats are the runtime's gauges at a capture; in a rollup, the
+// peaks of its captures
+type RuntimeStats struct {
+	HeapInuse   uint64 `json:"heapInuse"`
+	HeapObjects uint64 `json:"heapObjects"`
+	GCCycles    uint32 `json:"gcCycles"`
+	Goroutines  int    `json:"goroutines"`
+}
+
+// Capture is one window of continuous profiling, or the hourly rollup of
+// several
+type Capture struct {
+	At       time.Time     `json:"at"`       // window start, or the rollup's hour
+	Window   time.Duration `json:"window"`   // time sampled, summed over a rollup
+	Captures int           `json:"captures"` // windows merged, 1 for a capture
+	Samples  *Samples      `json:"samples"`
+	Stats    RuntimeStats  `json:"stats"`
+}
+
+// Continuous profiles in the background from StartContinuous to Stop
+type Continuous struct {
+	opts ContinuousOptions
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Where captures and rollups are kept under the directory, named by UTC
+// time so they sort and compare by name
+const (
+	capturesDir   = "captures"
+	rollupsDir    = "rollups"
+	captureLayout = "20060102-150405.000"
+	rollupLayout  = "20060102-15"
+)
+
+// StartContinuous begins capturing, compacting the directory after each
+// capture
+func StartContinuous(opts ContinuousOptions) (*Continuous, error) {
+	if opts.Every <= 0 || opts.Window <= 0 || opts.Window > opts.Every || opts.SampleInterval <= 0 {
+		return nil, fmt.Errorf("continuous profiling needs 0 < window <= every and a sample interval, have %v, %v and %v",
+			opts.Window, opts.Every, opts.SampleInterval)
+	}
+	for _, sub := range []string{capturesDir, rollupsDir} {
+		if err := os.MkdirAll(filepath.Join(opts.Dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	c := &Continuous{opts: opts, stop: make(chan struct{}), done: make(chan struct{})}
+	go c.run()
+	return c, nil
+}
+
+func (c *Continuous) run() {
+	defer close(c.done)
+	for {
+		start := time.Now()
+		stopped := c.capture(start)
+		if err := Compact(c.opts.Dir, time.Now(), c.opts.RollupAfter, c.opts.Retention); err != nil {
+			slog.Warn("profiler: continuous profiling", "error", err)
+		}
+		if stopped {
+			return
+		}
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(time.Until(start.Add(c.opts.Every))):
+		}
+	}
+}
+
+// capture samples one window and saves it, reporting whether Stop cut the
+// window short
+func (c *Continuous) capture(start time.Time) (stopped bool) {
+	sampler := StartSampler(c.opts.SampleInterval)
+	select {
+	case <-c.stop:
+		stopped = true
+	case <-time.After(c.opts.Window):
+	}
+	samples := sampler.Stop()
+	capture := Capture{At: start, Window: time.Since(start), Captures: 1, Samples: samples, Stats: readRuntimeStats()}
+	path := filepath.Join(c.opts.Dir, capturesDir, start.UTC().Format(captureLayout)+".json")
+	if err := writeCapture(path, capture); err != nil {
+		slog.Warn("profiler: continuous profiling", "error", err)
+	}
+	return stopped
+}
+
+// Stop saves the window in progress and ends continuous profiling
+func (c *Continuous) Stop() {
+	close(c.stop)
+	<-c.done
+}
+
+func readRuntimeStats() RuntimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return RuntimeStats{HeapInuse: ms.HeapInuse, HeapObjects: ms.HeapObjects, GCCycles: ms.NumGC, Goroutines: runtime.NumGoroutine()}
+}
+
+// Compact applies the retention policy to dir as of now: captures older
+// than rollupAfter are merged into the rollup of their hour, and rollups
+// older than retention are deleted
+func Compact(dir string, now time.Time, rollupAfter, retention time.Duration) error {
+	captures, err := listTimed(filepath.Join(dir, capturesDir), captureLayout)
+	if err != nil {
+		return err
+	}
+	byHour := make(map[time.Time][]string)
+	for at, path := range captures {
+		if now.Sub(at) > rollupAfter {
+			hour := at.Truncate(time.Hour)
+			byHour[hour] = append(byHour[hour], path)
+		}
+	}
+	for hour, paths := range byHour {
+		sort.Strings(paths)
+		if err := rollUp(dir, hour, paths); err != nil {
+			return err
+		}
+	}
+
+	rollups, err := listTimed(filepath.Join(dir, rollupsDir), rollupLayout)
+	if err != nil {
+		return err
+	}
+	for hour, path := range rollups {
+		// a rollup expires once the whole hour is past retention
+		if now.Sub(hour.Add(time.Hour)) > retention {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rollUp merges the captures at paths into hour's rollup and deletes them
+func rollUp(dir string, hour time.Time, paths []string) error {
+	path := filepath.Join(dir, rollupsDir, hour.UTC().Format(rollupLayout)+".json")
+	rollup := Capture{At: hour, Samples: &Samples{Unit: "samples"}}
+	if existing, err := readCapture(path); err == nil {
+		rollup = existing
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	for _, p := range paths {
+		c, err := readCapture(p)
+		if err != nil {
+			return err
+		}
+		rollup.merge(c)
+	}
+	if err := writeCapture(path, rollup); err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge adds c's windows, samples and peaks to r
+func (r *Capture) merge(c Capture) {
+	r.Window += c.Window
+	r.Captures += c.Captures
+	r.Samples = mergeSamples(r.Samples, c.Samples)
+	r.Stats.HeapInuse = max(r.Stats.HeapInuse, c.Stats.HeapInuse)
+	r.Stats.HeapObjects = max(r.Stats.HeapObjects, c.Stats.HeapObjects)
+	r.Stats.GCCycles = max(r.Stats.GCCycles, c.Stats.GCCycles)
+	r.Stats.Goroutines = max(r.Stats.Goroutines, c.Stats.Goroutines)
+}
+
+// mergeSamples sums the weights of the stacks a and b share
+func mergeSamples(a, b *Samples) *Samples {
+	out := &Samples{Unit: "samples"}
+	weights := make(map[string]int64)
+	for _, s := range []*Samples{a, b} {
+		if s == nil {
+			continue
+		}
+		if out.Interval == 0 {
+			out.Interval, out.Unit = s.Interval, s.Unit
+		}
+		for _, sample := range s.Samples {
+			weights[strings.Join(sample.Stack, ";")] += sample.Weight
+		}
+	}
+	stacks := make([]string, 0, len(weights))
+	for stack := range weights {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		out.Samples = append(out.Samples, Sample{Stack: strings.Split(stack, ";"), Weight: weights[stack]})
+	}
+	return out
+}
+
+// History is what continuous profiling saw over a period
+type History struct {
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Captures int           `json:"captures"`
+	Window   time.Duration `json:"window"`
+	Samples  *Samples      `json:"samples"` // merged over the period
+	Points   []Capture     `json:"points"`  // each capture or rollup, oldest first, without samples
+}
+
+// LoadHistory merges the captures and rollups in dir that start within
+// [from, to); rollups count when their hour does
+func LoadHistory(dir string, from, to time.Time) (*History, error) {
+	h := &History{From: from, To: to, Samples: &Samples{Unit: "samples"}}
+	for _, sub := range []struct{ dir, layout string }{{rollupsDir, rollupLayout}, {capturesDir, captureLayout}} {
+		files, err := listTimed(filepath.Join(dir, sub.dir), sub.layout)
+		if err != nil {
+			return nil, err
+		}
+		for at, path := range files {
+			if at.Before(from) || !at.Before(to) {
+				continue
+			}
+			c, err := readCapture(path)
+			if err != nil {
+				return nil, err
+			}
+			h.Captures += c.Captures
+			h.Window += c.Window
+			h.Samples = mergeSamples(h.Samples, c.Samples)
+			c.Samples = nil
+			h.Points = append(h.Points, c)
+		}
+	}
+	sort.Slice(h.Points, func(i, j int) bool { return h.Points[i].At.Before(h.Points[j].At) })
+	return h, nil
+}
+
+// listTimed maps the times in the names of dir's JSON files to their paths;
+// a missing directory has none
+func listTimed(dir, layout string) (map[time.Time]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[time.Time]string)
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		at, err := time.Parse(layout, name)
+		if err != nil {
+			continue
+		}
+		out[at] = filepath.Join(dir, e.Name())
+	}
+	return out, nil
+}
+
+func readCapture(path string) (Capture, error) {
+	var c Capture
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// writeCapture replaces path whole, so a reader never sees half a file
+func writeCapture(path string, c Capture) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
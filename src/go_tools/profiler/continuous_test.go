@@ -0,0 +1,92 @@
+package profiler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCapture(t *testing.T, dir string, at time.Time, stack []string, heap uint64) {
+	t.Helper()
+	c := Capture{At: at, Window: 10 * time.Second, Captures: 1, Stats: RuntimeStats{HeapInuse: heap},
+		Samples: &Samples{Unit: "samples", Samples: []Sample{{Stack: stack, Weight: 3}}}}
+	path := filepath.Join(dir, capturesDir, at.UTC().Format(captureLayout)+".json")
+	if err := writeCapture(path, c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompactRollsUpAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, capturesDir), 0755)
+	os.MkdirAll(filepath.Join(dir, rollupsDir), 0755)
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	tuesday := time.Date(2026, 10, 6, 9, 0, 0, 0, time.UTC)
+	writeTestCapture(t, dir, tuesday.Add(time.Minute), []string{"main", "solve"}, 100)
+	writeTestCapture(t, dir, tuesday.Add(2*time.Minute), []string{"main", "solve"}, 300)
+	writeTestCapture(t, dir, tuesday.Add(3*time.Minute), []string{"main", "render"}, 200)
+	writeTestCapture(t, dir, now.Add(-40*24*time.Hour), []string{"main"}, 1)
+	writeTestCapture(t, dir, now.Add(-time.Minute), []string{"main", "recent"}, 50)
+
+	if err := Compact(dir, now, 24*time.Hour, 14*24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	captures, _ := listTimed(filepath.Join(dir, capturesDir), captureLayout)
+	rollups, _ := listTimed(filepath.Join(dir, rollupsDir), rollupLayout)
+	if len(captures) != 1 || len(rollups) != 1 {
+		t.Fatalf("captures %v, rollups %v; want the recent capture and Tuesday's rollup", captures, rollups)
+	}
+	rollup, err := readCapture(rollups[tuesday])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rollup.Captures != 3 || rollup.Window != 30*time.Second || rollup.Stats.HeapInuse != 300 {
+		t.Errorf("rollup = %+v", rollup)
+	}
+
+	h, err := LoadHistory(dir, tuesday, tuesday.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Captures != 3 || len(h.Points) != 1 || h.Samples.Weight() != 9 {
+		t.Errorf("history = %+v", h)
+	}
+	fns := h.Samples.Functions()
+	if fns[0].Function != "solve" || fns[0].Self != 6 || fns[0].Total != 6 {
+		t.Errorf("hottest = %+v, want solve with 6", fns[0])
+	}
+
+	h, err = LoadHistory(dir, now.Add(-time.Hour), now)
+	if err != nil || h.Captures != 1 {
+		t.Errorf("recent history = %+v, %v", h, err)
+	}
+}
+
+func TestContinuousCaptures(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := StartContinuous(ContinuousOptions{Dir: dir, Every: time.Millisecond, Window: time.Second}); err == nil {
+		t.Error("window longer than the period accepted")
+	}
+	opts := DefaultContinuousOptions(dir)
+	opts.Every, opts.Window, opts.SampleInterval = 30*time.Millisecond, 10*time.Millisecond, time.Millisecond
+	c, err := StartContinuous(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.Stop()
+	captures, err := listTimed(filepath.Join(dir, capturesDir), captureLayout)
+	if err != nil || len(captures) == 0 {
+		t.Fatalf("captures = %v, %v", captures, err)
+	}
+	for _, path := range captures {
+		capture, err := readCapture(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if capture.Captures != 1 || capture.Stats.Goroutines == 0 || capture.Samples == nil {
+			t.Errorf("capture = %+v", capture)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package profiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entity kinds costs are attributed to
+const (
+	EntityBlock = "block" // a special block kind, such as ice
+	EntitySpell = "spell"
+)
+
+// BlockEntity tags costs caused by a kind of block
+func BlockEntity(kind string) string { return EntityBlock + ":" + kind }
+
+// SpellEntity tags costs caused by a spell
+func SpellEntity(spell string) string { return EntitySpell + ":" + spell }
+
+// Tag starts timing the part of phase that entity causes, within the
+// phase's own timing; calling the result stops it. Tagged time adds up
+// per entity and counts towards the phase only through Phase.
+func (t *StepTimer) Tag(phase, entity string) func() {
+	if t == nil {
+		return func() {}
+	}
+	begin := time.Now()
+	return func() {
+		d := time.Since(begin)
+		t.Attribute(phase, entity, d)
+		t.timeline().Add(TrackPhysics, entity, begin, d, nil)
+	}
+}
+
+// Attribute adds d of phase to entity, for costs measured some other way
+func (t *StepTimer) Attribute(phase, entity string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	if t.step.Costs == nil {
+		t.step.Costs = make(map[string]map[string]float64)
+	}
+	if t.step.Costs[phase] == nil {
+		t.step.Costs[phase] = make(map[string]float64)
+	}
+	t.step.Costs[phase][entity] += float64(d) / float64(time.Millisecond)
+}
+
+// EntityCost is what one block kind or spell cost across a run
+type EntityCost struct {
+	Entity  string             `json:"entity"` // such as block:ice
+	Kind    string             `json:"kind"`   // block or spell
+	Name    string             `json:"name"`
+	Steps   int                `json:"steps"` // steps it cost anything in
+	TotalMs float64            `json:"totalMs"`
+	Phases  map[string]float64 `json:"phases"` // milliseconds by phase
+	Shares  map[string]float64 `json:"shares"` // of each phase's total time
+	Share   float64            `json:"share"`  // of all physics time
+}
+
+// CostReport attributes physics time to block kinds and spells, costliest
+// first; untagged time is each phase's time no entity was tagged with
+type CostReport struct {
+	Steps      int                `json:"steps"`
+	TotalMs    float64            `json:"totalMs"`
+	PhaseMs    map[string]float64 `json:"phaseMs"`
+	UntaggedMs map[string]float64 `json:"untaggedMs"`
+	Entities   []EntityCost       `json:"entities"`
+}
+
+// AnalyzeCosts aggregates the tagged costs of physics steps
+func AnalyzeCosts(steps []PhysicsStep) CostReport {
+	r := CostReport{Steps: len(steps), PhaseMs: make(map[string]float64), UntaggedMs: make(map[string]float64)}
+	byEntity := make(map[string]*EntityCost)
+	for _, s := range steps {
+		for phase, ms := range s.Phases {
+			r.PhaseMs[phase] += ms
+			r.TotalMs += ms
+		}
+		for phase, costs := range s.Costs {
+			for entity, ms := range costs {
+				e, ok := byEntity[entity]
+				if !ok {
+					kind, name, _ := strings.Cut(entity, ":")
+					e = &EntityCost{Entity: entity, Kind: kind, Name: name, Phases: make(map[string]float64)}
+					byEntity[entity] = e
+				}
+				e.Phases[phase] += ms
+				e.TotalMs += ms
+			}
+		}
+		for entity := range stepEntities(s) {
+			byEntity[entity].Steps++
+		}
+	}
+	for phase, ms := range r.PhaseMs {
+		r.UntaggedMs[phase] = ms
+	}
+	for _, e := range byEntity {
+		e.Shares = make(map[string]float64)
+		for phase, ms := range e.Phases {
+			r.UntaggedMs[phase] -= ms
+			if r.PhaseMs[phase] > 0 {
+				e.Shares[phase] = ms / r.PhaseMs[phase]
+			}
+		}
+		if r.TotalMs > 0 {
+			e.Share = e.TotalMs / r.TotalMs
+		}
+		r.Entities = append(r.Entities, *e)
+	}
+	for phase, ms := range r.UntaggedMs {
+		// tags timed around more than their phase leave nothing untagged
+		r.UntaggedMs[phase] = max(0, ms)
+	}
+	sort.Slice(r.Entities, func(i, j int) bool {
+		if r.Entities[i].TotalMs != r.Entities[j].TotalMs {
+			return r.Entities[i].TotalMs > r.Entities[j].TotalMs
+		}
+		return r.Entities[i].Entity < r.Entities[j].Entity
+	})
+	return r
+}
+
+func stepEntities(s PhysicsStep) map[string]bool {
+	out := make(map[string]bool)
+	for _, costs := range s.Costs {
+		for entity := range costs {
+			out[entity] = true
+		}
+	}
+	return out
+}
+
+// Headlines sum the report up for the content team, one line per phase
+// naming its costliest entity, such as "ice blocks account for 38% of
+// collision time"; phases under minShare of physics time are left out
+func (r CostReport) Headlines(minShare float64) []string {
+	var out []string
+	for _, phase := range r.PhaseOrder() {
+		if r.TotalMs == 0 || r.PhaseMs[phase]/r.TotalMs < minShare {
+			continue
+		}
+		var top *EntityCost
+		for i := range r.Entities {
+			e := &r.Entities[i]
+			if e.Phases[phase] > 0 && (top == nil || e.Shares[phase] > top.Shares[phase]) {
+				top = e
+			}
+		}
+		if top != nil {
+			out = append(out, fmt.Sprintf("%s account for %.0f%% of %s time", entityNoun(*top), 100*top.Shares[phase], phase))
+		}
+	}
+	return out
+}
+
+// PhaseOrder lists the report's phases, PhysicsPhases first
+func (r CostReport) PhaseOrder() []string {
+	phases := make([]string, 0, len(r.PhaseMs))
+	for phase := range r.PhaseMs {
+		phases = append(phases, phase)
+	}
+	return orderPhases(phases)
+}
+
+func entityNoun(e EntityCost) string {
+	switch e.Kind {
+	case EntityBlock:
+		return e.Name + " blocks"
+	case EntitySpell:
+		return e.Name + " spells"
+	}
+	return e.Entity
+}
@@ -0,0 +1,69 @@
+package profiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeCosts(t *testing.T) {
+	in := `{"level":"a","step":0,"blocks":10,"phases":{"collision":4,"spells":2},"costs":{"collision":{"block:ice":2,"block:heavy":1},"spells":{"spell:CLEAR_LINE":2}}}
+{"level":"a","step":1,"blocks":10,"phases":{"collision":6,"integration":2},"costs":{"collision":{"block:ice":3}}}
+{"level":"a","step":2,"blocks":10,"phases":{"collision":3}}
+`
+	steps, err := ReadPhysicsSteps(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := AnalyzeCosts(steps)
+	if r.Steps != 3 || !near(r.TotalMs, 17) || !near(r.PhaseMs[PhaseCollision], 13) {
+		t.Errorf("totals = %+v", r)
+	}
+	if !near(r.UntaggedMs[PhaseCollision], 7) || r.UntaggedMs[PhaseSpells] != 0 || !near(r.UntaggedMs[PhaseIntegration], 2) {
+		t.Errorf("untagged = %v", r.UntaggedMs)
+	}
+	var order []string
+	for _, e := range r.Entities {
+		order = append(order, e.Entity)
+	}
+	if want := []string{"block:ice", "spell:CLEAR_LINE", "block:heavy"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("entities = %v, want %v", order, want)
+	}
+	ice := r.Entities[0]
+	if ice.Kind != EntityBlock || ice.Name != "ice" || ice.Steps != 2 || !near(ice.TotalMs, 5) ||
+		!near(ice.Shares[PhaseCollision], 5.0/13) || !near(ice.Share, 5.0/17) {
+		t.Errorf("ice = %+v", ice)
+	}
+	want := []string{"ice blocks account for 38% of collision time", "CLEAR_LINE spells account for 100% of spells time"}
+	if got := r.Headlines(0); !reflect.DeepEqual(got, want) {
+		t.Errorf("headlines = %q, want %q", got, want)
+	}
+	if got := r.Headlines(0.2); len(got) != 1 {
+		t.Errorf("headlines over 20%% = %q", got)
+	}
+	if _, err := ReadPhysicsSteps(strings.NewReader(`{"phases":{"collision":1},"costs":{"collision":{"block:ice":-1}}}`)); err == nil {
+		t.Error("negative cost accepted")
+	}
+}
+
+func TestStepTimerTag(t *testing.T) {
+	var off *StepTimer
+	off.Tag(PhaseCollision, BlockEntity("ice"))()
+
+	rec := NewPhysicsRecorder("level1")
+	s := rec.Step(5)
+	stop := s.Phase(PhaseSpells)
+	s.Tag(PhaseSpells, SpellEntity("SLOW_DOWN"))()
+	stop()
+	s.Attribute(PhaseCollision, BlockEntity("bomb"), 2*time.Millisecond)
+	s.Attribute(PhaseCollision, BlockEntity("bomb"), time.Millisecond)
+	s.End()
+	step := rec.Steps()[0]
+	if _, ok := step.Costs[PhaseSpells]["spell:SLOW_DOWN"]; !ok || !near(step.Costs[PhaseCollision]["block:bomb"], 3) {
+		t.Errorf("costs = %v", step.Costs)
+	}
+	if _, ok := step.Phases[PhaseCollision]; ok {
+		t.Error("attributed cost counted as phase time")
+	}
+}
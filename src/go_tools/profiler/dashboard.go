@@ -0,0 +1,355 @@
+package profiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+// MetricsSnapshot is the profiler's metrics at one moment, as LiveMetrics
+// exports them; counters are totals since the metrics started
+type MetricsSnapshot struct {
+	At          time.Time
+	TickBuckets []uint64 // cumulative tick counts at each of TickBuckets' bounds
+	TickCount   uint64
+	TickSum     float64 // seconds
+	HeapInuse   uint64
+	HeapAlloc   uint64
+	GCCycles    uint64
+	GCPause     float64 // seconds, total
+	Goroutines  int64
+	Messages    map[string]uint64 // by "type dir"
+	Markers     map[string]uint64 // by name
+}
+
+// Snapshot reads the metrics as a scrape of them would
+func (m *LiveMetrics) Snapshot() (MetricsSnapshot, error) {
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	return ParseMetrics(&buf)
+}
+
+// ParseMetrics reads the profiler's metrics from Prometheus text, such as
+// another process's /metrics; other metrics are ignored
+func ParseMetrics(r io.Reader) (MetricsSnapshot, error) {
+	s := MetricsSnapshot{At: time.Now(), TickBuckets: make([]uint64, len(TickBuckets)), Messages: make(map[string]uint64),
+		Markers: make(map[string]uint64)}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		name, ok := strings.CutPrefix(text, metricsPrefix)
+		if !ok {
+			continue
+		}
+		i := strings.LastIndexByte(name, ' ')
+		if i < 0 {
+			return s, fmt.Errorf("line %d: no value", line)
+		}
+		value, err := strconv.ParseFloat(name[i+1:], 64)
+		if err != nil {
+			return s, fmt.Errorf("line %d: %w", line, err)
+		}
+		name = name[:i]
+		labels := map[string]string{}
+		if j := strings.IndexByte(name, '{'); j >= 0 {
+			if labels, err = parseLabels(strings.TrimSuffix(name[j+1:], "}")); err != nil {
+				return s, fmt.Errorf("line %d: %w", line, err)
+			}
+			name = name[:j]
+		}
+		switch name {
+		case "tick_seconds_bucket":
+			if le, err := strconv.ParseFloat(labels["le"], 64); err == nil {
+				for k, bound := range TickBuckets {
+					if bound == le {
+						s.TickBuckets[k] = uint64(value)
+					}
+				}
+			}
+		case "tick_seconds_count":
+			s.TickCount = uint64(value)
+		case "tick_seconds_sum":
+			s.TickSum = value
+		case "heap_inuse_bytes":
+			s.HeapInuse = uint64(value)
+		case "heap_alloc_bytes":
+			s.HeapAlloc = uint64(value)
+		case "gc_cycles_total":
+			s.GCCycles = uint64(value)
+		case "gc_pause_seconds_total":
+			s.GCPause = value
+		case "goroutines":
+			s.Goroutines = int64(value)
+		case "messages_total":
+			s.Messages[labels["type"]+" "+labels["dir"]] = uint64(value)
+		case "markers_total":
+			s.Markers[labels["name"]] = uint64(value)
+		}
+	}
+	return s, sc.Err()
+}
+
+// parseLabels reads a label set such as type="state",dir="out"
+func parseLabels(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed labels %q", s)
+		}
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, fmt.Errorf("malformed labels %q", s)
+		}
+		out[strings.TrimSpace(key)], _ = strconv.Unquote(quoted)
+		s = strings.TrimPrefix(rest[len(quoted):], ",")
+	}
+	return out, nil
+}
+
+// ScrapeSource reads the profiler's metrics from a /metrics URL, for a
+// dashboard watching another process, presenting the token of
+// auth.TokenEnv if set
+func ScrapeSource(url string) func() (MetricsSnapshot, error) {
+	client := certs.HTTPClient(5 * time.Second)
+	token := os.Getenv(auth.TokenEnv)
+	return func() (MetricsSnapshot, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return MetricsSnapshot{}, err
+		}
+		auth.SetHeader(req.Header, token)
+		resp, err := client.Do(req)
+		if err != nil {
+			return MetricsSnapshot{}, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return MetricsSnapshot{}, fmt.Errorf("scrape %s: %s", url, resp.Status)
+		}
+		return ParseMetrics(resp.Body)
+	}
+}
+
+// DashboardPoint is what the dashboard charts for one interval
+type DashboardPoint struct {
+	At           int64              `json:"t"`        // end of the interval, in Unix milliseconds
+	TickRate     float64            `json:"tickRate"` // ticks a second
+	TickMeanMs   float64            `json:"tickMeanMs"`
+	TickP95Ms    float64            `json:"tickP95Ms"` // the bucket bound 95% of the interval's ticks fit under
+	HeapInuseMiB float64            `json:"heapInuseMiB"`
+	HeapAllocMiB float64            `json:"heapAllocMiB"`
+	GCRate       float64            `json:"gcRate"`    // collections a second
+	GCPauseMs    float64            `json:"gcPauseMs"` // time paused for collection in the interval
+	Goroutines   int64              `json:"goroutines"`
+	MessageRates map[string]float64 `json:"messageRates"`      // a second, by "type dir"
+	Markers      []string           `json:"markers,omitempty"` // marks and regions recorded in the interval
+}
+
+// pointBetween turns two snapshots into the interval between them
+func pointBetween(prev, cur MetricsSnapshot) DashboardPoint {
+	secs := cur.At.Sub(prev.At).Seconds()
+	p := DashboardPoint{
+		At:           cur.At.UnixMilli(),
+		HeapInuseMiB: float64(cur.HeapInuse) / (1 << 20),
+		HeapAllocMiB: float64(cur.HeapAlloc) / (1 << 20),
+		GCPauseMs:    max(0, cur.GCPause-prev.GCPause) * 1000,
+		Goroutines:   cur.Goroutines,
+		MessageRates: make(map[string]float64),
+	}
+	if secs <= 0 {
+		return p
+	}
+	// a restarted source's counters go back to zero; count from there
+	delta := func(a, b uint64) float64 {
+		if b < a {
+			return float64(b)
+		}
+		return float64(b - a)
+	}
+	ticks := delta(prev.TickCount, cur.TickCount)
+	p.TickRate = ticks / secs
+	p.GCRate = delta(prev.GCCycles, cur.GCCycles) / secs
+	if ticks > 0 {
+		p.TickMeanMs = max(0, cur.TickSum-prev.TickSum) / ticks * 1000
+		p.TickP95Ms = TickBuckets[len(TickBuckets)-1] * 1000
+		for i, bound := range TickBuckets {
+			if delta(prev.TickBuckets[i], cur.TickBuckets[i]) >= 0.95*ticks {
+				p.TickP95Ms = bound * 1000
+				break
+			}
+		}
+	}
+	for k, n := range cur.Messages {
+		p.MessageRates[k] = delta(prev.Messages[k], n) / secs
+	}
+	for name, n := range cur.Markers {
+		if delta(prev.Markers[name], n) > 0 {
+			p.Markers = append(p.Markers, name)
+		}
+	}
+	sort.Strings(p.Markers)
+	return p
+}
+
+// dashboardHistory is how many points a newly opened dashboard is sent
+const dashboardHistory = 600
+
+// Dashboard serves a live web view of the profiler's metrics: tick times,
+// memory, GC and message rates, pushed to the page over a WebSocket once
+// an interval. Mount it on a path ending in a slash; the stream is the
+// ws below it.
+type Dashboard struct {
+	source   func() (MetricsSnapshot, error)
+	interval time.Duration
+
+	mu      sync.Mutex
+	history []DashboardPoint
+	err     string // the source's last failure, cleared by a success
+	subs    map[chan dashboardUpdate]struct{}
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type dashboardUpdate struct {
+	History []DashboardPoint `json:"history,omitempty"`
+	Point   *DashboardPoint  `json:"point,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// NewDashboard polls source every interval until Close
+func NewDashboard(source func() (MetricsSnapshot, error), interval time.Duration) *Dashboard {
+	d := &Dashboard{source: source, interval: interval, subs: make(map[chan dashboardUpdate]struct{}),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	go d.run()
+	return d
+}
+
+func (d *Dashboard) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	prev, err := d.source()
+	havePrev := err == nil
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+		cur, err := d.source()
+		if err != nil {
+			d.publish(dashboardUpdate{Error: err.Error()})
+			continue
+		}
+		if havePrev {
+			p := pointBetween(prev, cur)
+			d.publish(dashboardUpdate{Point: &p})
+		}
+		prev, havePrev = cur, true
+	}
+}
+
+func (d *Dashboard) publish(u dashboardUpdate) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if u.Point != nil {
+		d.history = append(d.history, *u.Point)
+		if len(d.history) > dashboardHistory {
+			d.history = d.history[len(d.history)-dashboardHistory:]
+		}
+		d.err = ""
+	} else {
+		d.err = u.Error
+	}
+	for ch := range d.subs {
+		select {
+		case ch <- u:
+		default: // a page that can't keep up misses points
+		}
+	}
+}
+
+// Close stops polling; open pages keep what they have
+func (d *Dashboard) Close() {
+	close(d.stop)
+	<-d.done
+}
+
+// ServeHTTP serves the page, and the stream under ws
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/ws") {
+		d.stream(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, dashboardPage)
+}
+
+func (d *Dashboard) stream(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	ch := make(chan dashboardUpdate, 16)
+	d.mu.Lock()
+	first := dashboardUpdate{History: append([]DashboardPoint(nil), d.history...), Error: d.err}
+	d.subs[ch] = struct{}{}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.subs, ch)
+		d.mu.Unlock()
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		// the page sends nothing; reading notices it going away
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	send := func(u dashboardUpdate) bool {
+		data, err := json.Marshal(u)
+		return err == nil && conn.WriteMessage(websocket.TextMessage, data) == nil
+	}
+	if !send(first) {
+		return
+	}
+	for {
+		select {
+		case u := <-ch:
+			if !send(u) {
+				return
+			}
+		case <-closed:
+			return
+		case <-d.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package profiler
+
+// dashboardPage charts the stream with plain canvas drawing, so the page
+// works on a test server without internet access
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>SuperTetris live profile</title>
+<style>
+body { font-family: sans-serif; margin: 1em; background: #fafafa; color: #222; }
+h1 { font-size: 1.2em; }
+#status { font-size: 0.9em; color: #666; }
+#status.error { color: #b00; }
+.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(460px, 1fr)); gap: 1em; }
+.chart { background: #fff; border: 1px solid #ddd; padding: 0.5em; }
+.chart h2 { font-size: 1em; margin: 0 0 0.3em; }
+.legend span { font-size: 0.8em; margin-right: 1em; }
+canvas { width: 100%; height: 180px; }
+</style>
+</head>
+<body>
+<h1>SuperTetris live profile</h1>
+<div id="status">connecting…</div>
+<div class="grid" id="charts"></div>
+<script>
+const colors = ["#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#17becf"];
+const charts = [
+  {title: "Tick time (ms)", series: p => ({"mean": p.tickMeanMs, "p95": p.tickP95Ms})},
+  {title: "Ticks per second", series: p => ({"ticks/s": p.tickRate})},
+  {title: "Memory (MiB)", series: p => ({"heap in use": p.heapInuseMiB, "heap allocated": p.heapAllocMiB})},
+  {title: "GC", series: p => ({"collections/s": p.gcRate, "pause ms": p.gcPauseMs})},
+  {title: "Goroutines", series: p => ({"goroutines": p.goroutines})},
+  {title: "Messages per second", series: p => p.messageRates || {}},
+];
+const points = [];
+const limit = 600;
+
+for (const c of charts) {
+  const div = document.createElement("div");
+  div.className = "chart";
+  div.innerHTML = "<h2></h2><div class=legend></div><canvas></canvas>";
+  div.querySelector("h2").textContent = c.title;
+  document.getElementById("charts").appendChild(div);
+  c.canvas = div.querySelector("canvas");
+  c.legend = div.querySelector(".legend");
+}
+
+function draw() {
+  for (const c of charts) {
+    const canvas = c.canvas, ctx = canvas.getContext("2d");
+    canvas.width = canvas.clientWidth * devicePixelRatio;
+    canvas.height = canvas.clientHeight * devicePixelRatio;
+    ctx.scale(devicePixelRatio, devicePixelRatio);
+    const w = canvas.clientWidth, h = canvas.clientHeight, pad = 40;
+    const names = [...new Set(points.flatMap(p => Object.keys(c.series(p))))].sort();
+    let top = 0;
+    for (const p of points) for (const v of Object.values(c.series(p))) top = Math.max(top, v);
+    top = top > 0 ? top * 1.1 : 1;
+    ctx.clearRect(0, 0, w, h);
+    ctx.fillStyle = "#888"; ctx.font = "11px sans-serif";
+    ctx.fillText(top.toPrecision(3), 2, 12);
+    ctx.fillText("0", 2, h - 4);
+    ctx.strokeStyle = "#eee"; ctx.beginPath(); ctx.moveTo(pad, h - 8); ctx.lineTo(w, h - 8); ctx.stroke();
+    c.legend.innerHTML = "";
+    names.forEach((name, i) => {
+      const color = colors[i % colors.length];
+      const last = points.length ? c.series(points[points.length - 1])[name] : undefined;
+      const span = document.createElement("span");
+      span.style.color = color;
+      span.textContent = name + (last === undefined ? "" : " " + last.toFixed(2));
+      c.legend.appendChild(span);
+      ctx.strokeStyle = color; ctx.lineWidth = 1.5; ctx.beginPath();
+      points.forEach((p, j) => {
+        const v = c.series(p)[name] || 0;
+        const x = pad + (w - pad) * (points.length > 1 ? j / (points.length - 1) : 1);
+        const y = h - 8 - (h - 16) * v / top;
+        j ? ctx.lineTo(x, y) : ctx.moveTo(x, y);
+      });
+      ctx.stroke();
+    });
+    // markers are dashed lines across every chart, named on top
+    ctx.setLineDash([3, 3]); ctx.strokeStyle = "#999"; ctx.fillStyle = "#555"; ctx.lineWidth = 1;
+    points.forEach((p, j) => {
+      if (!p.markers) return;
+      const x = pad + (w - pad) * (points.length > 1 ? j / (points.length - 1) : 1);
+      ctx.beginPath(); ctx.moveTo(x, 0); ctx.lineTo(x, h - 8); ctx.stroke();
+      ctx.fillText(p.markers.join(", "), x + 3, 24);
+    });
+    ctx.setLineDash([]);
+  }
+}
+
+function connect() {
+  const status = document.getElementById("status");
+  const path = location.pathname.replace(/\/?$/, "/") + "ws";
+  const ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + path);
+  ws.onopen = () => { status.className = ""; status.textContent = "live"; };
+  ws.onmessage = e => {
+    const u = JSON.parse(e.data);
+    if (u.history) points.splice(0, points.length, ...u.history);
+    if (u.point) { points.push(u.point); if (points.length > limit) points.shift(); }
+    if (u.error) { status.className = "error"; status.textContent = "source failing: " + u.error; }
+    else if (u.point) { status.className = ""; status.textContent = "live, updated " + new Date(u.point.t).toLocaleTimeString(); }
+    draw();
+  };
+  ws.onclose = () => { status.className = "error"; status.textContent = "disconnected, retrying…"; setTimeout(connect, 2000); };
+}
+window.onresize = draw;
+connect();
+</script>
+</body>
+</html>
+`
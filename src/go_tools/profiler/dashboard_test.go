@@ -0,0 +1,164 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+func TestSnapshotParsesExport(t *testing.T) {
+	m := NewLiveMetrics()
+	m.ObserveTick(3 * time.Millisecond)
+	m.ObserveTick(40 * time.Millisecond)
+	m.ObserveMessage("state", DirOut, 100)
+	s, err := m.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TickCount != 2 || !near(s.TickSum, 0.043) || s.Messages["state out"] != 1 {
+		t.Errorf("snapshot = %+v", s)
+	}
+	// cumulative: 3ms under 0.004, both under 0.05
+	if s.TickBuckets[1] != 0 || s.TickBuckets[2] != 1 || s.TickBuckets[6] != 2 {
+		t.Errorf("buckets = %v", s.TickBuckets)
+	}
+	if s.HeapInuse == 0 || s.Goroutines == 0 {
+		t.Errorf("runtime gauges missing: %+v", s)
+	}
+	if _, err := ParseMetrics(strings.NewReader("supertetris_profiler_goroutines x\n")); err == nil {
+		t.Error("bad value accepted")
+	}
+}
+
+func TestPointBetween(t *testing.T) {
+	at := time.Unix(100, 0)
+	prev := MetricsSnapshot{At: at, TickBuckets: make([]uint64, len(TickBuckets)), TickCount: 10, TickSum: 0.1,
+		GCCycles: 4, GCPause: 0.001, Messages: map[string]uint64{"state out": 5}}
+	cur := prev
+	cur.At = at.Add(2 * time.Second)
+	cur.TickBuckets = make([]uint64, len(TickBuckets))
+	// of the 100 new ticks, 90 fit under 8ms and all under 16.7ms
+	for i := 4; i < len(cur.TickBuckets); i++ {
+		cur.TickBuckets[i] = 100
+	}
+	cur.TickBuckets[3] = 90
+	cur.TickCount, cur.TickSum, cur.GCCycles, cur.GCPause = 110, 1.1, 8, 0.003
+	cur.HeapInuse = 2 << 20
+	cur.Messages = map[string]uint64{"state out": 25, "input in": 4}
+
+	p := pointBetween(prev, cur)
+	if p.At != cur.At.UnixMilli() || p.TickRate != 50 || !near(p.TickMeanMs, 10) || p.TickP95Ms != 16.7 {
+		t.Errorf("ticks: %+v", p)
+	}
+	if p.GCRate != 2 || !near(p.GCPauseMs, 2) || p.HeapInuseMiB != 2 {
+		t.Errorf("runtime: %+v", p)
+	}
+	if p.MessageRates["state out"] != 10 || p.MessageRates["input in"] != 2 {
+		t.Errorf("message rates = %v", p.MessageRates)
+	}
+}
+
+func TestDashboardStreams(t *testing.T) {
+	var mu sync.Mutex
+	ticks := uint64(0)
+	source := func() (MetricsSnapshot, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		ticks += 5
+		return MetricsSnapshot{At: time.Now(), TickBuckets: make([]uint64, len(TickBuckets)), TickCount: ticks}, nil
+	}
+	dash := NewDashboard(source, 10*time.Millisecond)
+	defer dash.Close()
+	mux := http.NewServeMux()
+	mux.Handle("/debug/dashboard/", dash)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/debug/dashboard/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "new WebSocket") {
+		t.Error("dashboard page missing its stream")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/debug/dashboard/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for got := 0; got < 2; {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var u dashboardUpdate
+		if err := json.Unmarshal(data, &u); err != nil {
+			t.Fatal(err)
+		}
+		if u.Point != nil {
+			if u.Point.TickRate <= 0 {
+				t.Errorf("point = %+v, want ticks", u.Point)
+			}
+			got++
+		}
+	}
+}
+
+func TestMarkersReachTimelineAndDashboard(t *testing.T) {
+	tl := NewTimeline()
+	m := NewLiveMetrics()
+	before, err := m.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Mark("wave spawn")
+	end := Region("level load")
+	time.Sleep(time.Millisecond)
+	end()
+	after, err := m.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	after.At = before.At.Add(time.Second)
+	if p := pointBetween(before, after); len(p.Markers) != 2 || p.Markers[0] != "level load" || p.Markers[1] != "wave spawn" {
+		t.Errorf("point markers = %v", p.Markers)
+	}
+
+	var wave, load *TraceEvent
+	events := tl.Events()
+	for i, e := range events {
+		switch e.Name {
+		case "wave spawn":
+			wave = &events[i]
+		case "level load":
+			load = &events[i]
+		}
+	}
+	if wave == nil || !wave.Instant || wave.Track != TrackMarkers || load == nil || load.Instant || load.Dur < time.Millisecond {
+		t.Fatalf("marker events: wave %+v, load %+v", wave, load)
+	}
+	var buf strings.Builder
+	if err := WriteChromeTrace(&buf, nil, events, "run"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"name":"wave spawn","cat":"markers","ph":"i"`) || !strings.Contains(buf.String(), `"s":"g"`) {
+		t.Errorf("trace = %s", buf.String())
+	}
+	if got := Markers(time.Now().Add(-time.Minute), time.Now()); len(got) < 2 {
+		t.Errorf("markers = %+v", got)
+	}
+}
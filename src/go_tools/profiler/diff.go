@@ -0,0 +1,308 @@
+package profiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SessionProfiles are what a profile diff compares of one session; a
+// field is nil when the session didn't capture it
+type SessionProfiles struct {
+	Dir     string
+	CPU     *Samples // CPU time by stack, or stack sample counts
+	Allocs  *Samples // bytes allocated by stack
+	Frames  *FrameReport
+	Latency Latencies
+}
+
+// LoadSessionProfiles reads the session bundle in dir: the profiles its
+// session.json lists or, without a manifest, the newest of each kind in
+// dir, so a plain -profile output directory diffs too. Frame times are
+// judged against budget.
+func LoadSessionProfiles(dir string, budget time.Duration) (*SessionProfiles, error) {
+	paths, err := sessionPaths(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &SessionProfiles{Dir: dir}
+	if path, ok := paths["cpu"]; ok {
+		p, err := LoadProfile(path)
+		if err != nil {
+			return nil, err
+		}
+		s.CPU = p.Stacks(p.ValueIndex("cpu"))
+	}
+	if path, ok := paths["samples"]; ok && s.CPU == nil && isSampleDump(path) {
+		if s.CPU, err = LoadSamples(path); err != nil {
+			return nil, err
+		}
+	}
+	if path, ok := paths["heap"]; ok {
+		p, err := LoadProfile(path)
+		if err != nil {
+			return nil, err
+		}
+		s.Allocs = p.Stacks(p.ValueIndex("alloc_space"))
+	}
+	if path, ok := paths["frames"]; ok {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		frames, err := ReadFrameTimes(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		report := AnalyzeFrames(frames, budget)
+		s.Frames = &report
+	}
+	if path, ok := paths["latency"]; ok {
+		if s.Latency, err = LoadLatencies(path); err != nil {
+			return nil, err
+		}
+	}
+	if s.CPU == nil && s.Allocs == nil && s.Frames == nil && s.Latency == nil {
+		return nil, fmt.Errorf("%s: no cpu, heap, samples, frames or latency profiles", dir)
+	}
+	return s, nil
+}
+
+// isSampleDump tells the JSON and binary sample dumps from the other
+// formats, some of which also end in .json
+func isSampleDump(path string) bool {
+	return filepath.Ext(path) == Extension(FormatBinary) || filepath.Ext(path) == ".json" &&
+		!strings.HasSuffix(path, Extension(FormatSpeedscope)) && !strings.HasSuffix(path, Extension(FormatChromeTrace))
+}
+
+// sessionPaths finds a bundle's profiles by kind
+func sessionPaths(dir string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "session.json"))
+	if err == nil {
+		var a Artifact
+		if err := json.Unmarshal(data, &a); err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		// the manifest's paths are as written; the bundle may have moved
+		for kind, p := range a.Profiles {
+			if _, err := os.Stat(p); err != nil {
+				a.Profiles[kind] = filepath.Join(dir, filepath.Base(p))
+			}
+		}
+		return a.Profiles, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string]string)
+	for _, e := range entries {
+		kind, _, ok := strings.Cut(e.Name(), "-")
+		if !ok || e.IsDir() {
+			continue
+		}
+		// names carry their time, so the last listed is the newest
+		paths[kind] = filepath.Join(dir, e.Name())
+	}
+	return paths, nil
+}
+
+// DiffOptions set what a profile diff flags
+type DiffOptions struct {
+	Threshold float64 `json:"threshold"` // relative growth that is a regression, 0.1 for 10%
+	MinShare  float64 `json:"minShare"`  // functions and allocation sites under this share of both sessions are left out
+}
+
+// DefaultDiffOptions flag 10% growth of anything over 2% of a session
+func DefaultDiffOptions() DiffOptions {
+	return DiffOptions{Threshold: 0.10, MinShare: 0.02}
+}
+
+// Metrics a profile diff compares
+const (
+	MetricCPU     = "cpu"     // a function's share of CPU time, innermost
+	MetricAllocs  = "allocs"  // bytes allocated at a site
+	MetricFrames  = "frames"  // a frame time percentile
+	MetricLatency = "latency" // a latency histogram's percentile, such as tick p99
+)
+
+// Change is one compared measurement
+type Change struct {
+	Metric     string  `json:"metric"`
+	Name       string  `json:"name"` // function, allocation site or percentile
+	Before     float64 `json:"before"`
+	After      float64 `json:"after"`
+	Unit       string  `json:"unit"` // %, bytes or ms
+	Regression bool    `json:"regression"`
+}
+
+// Delta is the relative change, +Inf for something new
+func (c Change) Delta() float64 {
+	if c.Before == 0 {
+		if c.After == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (c.After - c.Before) / c.Before
+}
+
+// ProfileDiff compares two sessions, regressions first and then by how
+// much each measurement changed
+type ProfileDiff struct {
+	Before   string      `json:"before"`
+	After    string      `json:"after"`
+	Options  DiffOptions `json:"options"`
+	Compared []string    `json:"compared"`
+	Skipped  []string    `json:"skipped,omitempty"` // metrics only one session captured
+	Changes  []Change    `json:"changes"`
+}
+
+// Regressions are the changes past the threshold for the worse
+func (d ProfileDiff) Regressions() []Change {
+	var out []Change
+	for _, c := range d.Changes {
+		if c.Regression {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// DiffProfiles compares before with after. CPU is compared by share, so
+// sessions of different lengths compare; allocations by bytes, so the
+// sessions should run the same workload.
+func DiffProfiles(before, after *SessionProfiles, opts DiffOptions) ProfileDiff {
+	d := ProfileDiff{Before: before.Dir, After: after.Dir, Options: opts}
+	compare := func(metric, unit string, a, b map[string]float64, totalA, totalB float64) {
+		for _, name := range unionKeys(a, b) {
+			if a[name] < opts.MinShare*totalA && b[name] < opts.MinShare*totalB {
+				continue
+			}
+			d.add(Change{Metric: metric, Name: name, Before: a[name], After: b[name], Unit: unit})
+		}
+		d.Compared = append(d.Compared, metric)
+	}
+
+	switch {
+	case before.CPU != nil && after.CPU != nil:
+		compare(MetricCPU, "%", cpuShares(before.CPU), cpuShares(after.CPU), 100, 100)
+	case before.CPU != nil || after.CPU != nil:
+		d.Skipped = append(d.Skipped, MetricCPU)
+	}
+	switch {
+	case before.Allocs != nil && after.Allocs != nil:
+		a, b := allocSites(before.Allocs), allocSites(after.Allocs)
+		compare(MetricAllocs, "bytes", a, b, float64(before.Allocs.Weight()), float64(after.Allocs.Weight()))
+	case before.Allocs != nil || after.Allocs != nil:
+		d.Skipped = append(d.Skipped, MetricAllocs)
+	}
+	switch {
+	case before.Frames != nil && after.Frames != nil:
+		a, b := before.Frames, after.Frames
+		for _, p := range []struct {
+			name          string
+			before, after float64
+		}{{"p50", a.P50Ms, b.P50Ms}, {"p95", a.P95Ms, b.P95Ms}, {"p99", a.P99Ms, b.P99Ms}} {
+			d.add(Change{Metric: MetricFrames, Name: p.name, Before: p.before, After: p.after, Unit: "ms"})
+		}
+		d.Compared = append(d.Compared, MetricFrames)
+	case before.Frames != nil || after.Frames != nil:
+		d.Skipped = append(d.Skipped, MetricFrames)
+	}
+
+	switch {
+	case before.Latency != nil && after.Latency != nil:
+		// percentiles of the kinds both sessions recorded
+		b := make(map[string]LatencySummary)
+		for _, s := range after.Latency.Summaries() {
+			b[s.Kind] = s
+		}
+		for _, a := range before.Latency.Summaries() {
+			s, ok := b[a.Kind]
+			if !ok {
+				continue
+			}
+			for _, p := range []struct {
+				name          string
+				before, after float64
+			}{{"p50", a.P50Ms, s.P50Ms}, {"p99", a.P99Ms, s.P99Ms}, {"p99.9", a.P999Ms, s.P999Ms}} {
+				d.add(Change{Metric: MetricLatency, Name: a.Kind + " " + p.name, Before: p.before, After: p.after, Unit: "ms"})
+			}
+		}
+		d.Compared = append(d.Compared, MetricLatency)
+	case before.Latency != nil || after.Latency != nil:
+		d.Skipped = append(d.Skipped, MetricLatency)
+	}
+
+	sort.SliceStable(d.Changes, func(i, j int) bool {
+		a, b := d.Changes[i], d.Changes[j]
+		if a.Regression != b.Regression {
+			return a.Regression
+		}
+		return math.Abs(a.Delta()) > math.Abs(b.Delta())
+	})
+	return d
+}
+
+func (d *ProfileDiff) add(c Change) {
+	c.Regression = c.After > c.Before*(1+d.Options.Threshold)
+	d.Changes = append(d.Changes, c)
+}
+
+// cpuShares is each function's innermost share of the samples, in percent
+func cpuShares(s *Samples) map[string]float64 {
+	out := make(map[string]float64)
+	total := float64(s.Weight())
+	if total == 0 {
+		return out
+	}
+	for _, f := range s.Functions() {
+		if f.Self > 0 {
+			out[f.Function] = 100 * float64(f.Self) / total
+		}
+	}
+	return out
+}
+
+// allocSites sums bytes by the innermost function outside the runtime,
+// the code that asked for the memory
+func allocSites(s *Samples) map[string]float64 {
+	out := make(map[string]float64)
+	for _, sample := range s.Samples {
+		site := ""
+		for i := len(sample.Stack) - 1; i >= 0; i-- {
+			if site = sample.Stack[i]; !strings.HasPrefix(site, "runtime.") {
+				break
+			}
+		}
+		if site != "" {
+			out[site] += float64(sample.Weight)
+		}
+	}
+	return out
+}
+
+func unionKeys(a, b map[string]float64) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
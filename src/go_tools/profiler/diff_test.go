@@ -0,0 +1,112 @@
+package profiler
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var diffSink [][]byte
+
+//go:noinline
+func allocateForDiff() {
+	for i := 0; i < 64; i++ {
+		diffSink = append(diffSink, make([]byte, 4096))
+	}
+}
+
+func TestLoadSessionProfilesDecodesBundle(t *testing.T) {
+	defer func(rate int) { runtime.MemProfileRate = rate }(runtime.MemProfileRate)
+	runtime.MemProfileRate = 1
+	frames := NewFrameCollector()
+	frames.Record(10 * time.Millisecond)
+	frames.Record(30 * time.Millisecond)
+
+	dir := t.TempDir()
+	s, err := Start(Options{CPU: true, Memory: true, Dir: dir, Frames: frames})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocateForDiff()
+	if _, err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	diffSink = nil
+
+	p, err := LoadSessionProfiles(dir, DefaultFrameBudget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.CPU == nil || p.Allocs == nil || p.Frames == nil {
+		t.Fatalf("profiles = %+v, want cpu, allocs and frames", p)
+	}
+	if p.Frames.Frames != 2 || p.Frames.WorstMs != 30 {
+		t.Errorf("frames = %+v", p.Frames)
+	}
+	if p.Allocs.Unit != "bytes" {
+		t.Errorf("allocs unit = %q", p.Allocs.Unit)
+	}
+	sites := allocSites(p.Allocs)
+	found := false
+	for site, bytes := range sites {
+		if strings.HasSuffix(site, "profiler.allocateForDiff") && bytes >= 64*4096 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("allocateForDiff missing from allocation sites %v", sites)
+	}
+
+	if _, err := LoadSessionProfiles(t.TempDir(), DefaultFrameBudget); err == nil {
+		t.Error("empty directory loaded")
+	}
+	os.WriteFile(filepath.Join(dir, "session.json"), []byte("{"), 0644)
+	if _, err := LoadSessionProfiles(dir, DefaultFrameBudget); err == nil {
+		t.Error("broken manifest accepted")
+	}
+}
+
+func TestDiffProfilesFlagsRegressions(t *testing.T) {
+	cpu := func(solve, render int64) *Samples {
+		return &Samples{Unit: "samples", Samples: []Sample{
+			{Stack: []string{"main", "solve"}, Weight: solve},
+			{Stack: []string{"main", "render"}, Weight: render},
+			{Stack: []string{"main", "idle"}, Weight: 1},
+		}}
+	}
+	allocs := func(bytes int64) *Samples {
+		return &Samples{Unit: "bytes", Samples: []Sample{{Stack: []string{"main", "load", "runtime.makeslice"}, Weight: bytes}}}
+	}
+	before := &SessionProfiles{Dir: "a", CPU: cpu(50, 49), Allocs: allocs(1000), Frames: &FrameReport{P50Ms: 10, P95Ms: 14, P99Ms: 20}}
+	after := &SessionProfiles{Dir: "b", CPU: cpu(70, 29), Allocs: allocs(1050), Frames: &FrameReport{P50Ms: 10, P95Ms: 15, P99Ms: 30}}
+
+	d := DiffProfiles(before, after, DefaultDiffOptions())
+	var got []string
+	for _, c := range d.Regressions() {
+		got = append(got, c.Metric+":"+c.Name)
+	}
+	slices.Sort(got)
+	if want := []string{"cpu:solve", "frames:p99"}; !slices.Equal(got, want) {
+		t.Errorf("regressions = %v, want %v", got, want)
+	}
+	for _, c := range d.Changes {
+		if c.Name == "idle" {
+			t.Error("function under the minimum share compared")
+		}
+		if c.Metric == MetricAllocs && c.Name != "load" {
+			t.Errorf("allocation site %q, want load past the runtime frames", c.Name)
+		}
+	}
+	if !d.Changes[0].Regression {
+		t.Error("regressions not listed first")
+	}
+
+	d = DiffProfiles(before, &SessionProfiles{Dir: "c", CPU: cpu(50, 49)}, DefaultDiffOptions())
+	if !slices.Equal(d.Skipped, []string{MetricAllocs, MetricFrames}) || len(d.Regressions()) != 0 {
+		t.Errorf("skipped = %v, regressions %v", d.Skipped, d.Regressions())
+	}
+}
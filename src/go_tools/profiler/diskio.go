@@ -0,0 +1,294 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Disk operations the tools and the editor time
+const (
+	IOLevelLoad   = "level load"
+	IOLevelSave   = "level save"
+	IOAutosave    = "autosave"
+	IOReplayLoad  = "replay load"
+	IOReplayWrite = "replay write"
+)
+
+// TrackDisk is the timeline track of timed disk operations
+const TrackDisk = "disk io"
+
+// IOEvent is one timed file read or write, as the editor logs its
+// autosaves and the tools their loads and saves, one JSON object per line
+type IOEvent struct {
+	At    float64 `json:"at"` // start, in milliseconds since the capture began
+	Op    string  `json:"op"`
+	Path  string  `json:"path,omitempty"`
+	Bytes int64   `json:"bytes"`
+	Ms    float64 `json:"ms"`
+	Error string  `json:"error,omitempty"`
+}
+
+// ReadIOEvents reads JSON-lines disk events; blank lines are skipped
+func ReadIOEvents(r io.Reader) ([]IOEvent, error) {
+	var out []IOEvent
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var ev IOEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ev.Op == "" {
+			return nil, fmt.Errorf("line %d: no op", line)
+		}
+		if ev.Bytes < 0 || ev.Ms < 0 {
+			return nil, fmt.Errorf("line %d: negative size or time", line)
+		}
+		out = append(out, ev)
+	}
+	return out, sc.Err()
+}
+
+// WriteIOEvents writes disk events as JSON lines
+func WriteIOEvents(w io.Writer, events []IOEvent) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// IORecorder times file reads and writes. A nil recorder records nothing,
+// so a tool holds one only when config.ProfileIO is set; its files are
+// still read and written.
+type IORecorder struct {
+	start    time.Time
+	mu       sync.Mutex
+	events   []IOEvent
+	timeline *Timeline
+}
+
+// NewIORecorder starts a capture's clock
+func NewIORecorder() *IORecorder {
+	return &IORecorder{start: time.Now()}
+}
+
+// Time runs an op on path, such as a level's Save, and records how long
+// it took and the size of the file afterwards
+func (r *IORecorder) Time(op, path string, fn func() error) error {
+	if r == nil {
+		return fn()
+	}
+	begin := time.Now()
+	err := fn()
+	d := time.Since(begin)
+	var size int64
+	if fi, statErr := os.Stat(path); statErr == nil {
+		size = fi.Size()
+	}
+	r.add(IOEvent{Op: op, Path: path, Bytes: size, Ms: ms(d)}, begin, err)
+	return err
+}
+
+// ReadFile reads path as os.ReadFile does, recording it as op
+func (r *IORecorder) ReadFile(op, path string) ([]byte, error) {
+	begin := time.Now()
+	data, err := os.ReadFile(path)
+	r.add(IOEvent{Op: op, Path: path, Bytes: int64(len(data)), Ms: ms(time.Since(begin))}, begin, err)
+	return data, err
+}
+
+// WriteFile writes path as os.WriteFile does, recording it as op
+func (r *IORecorder) WriteFile(op, path string, data []byte, perm os.FileMode) error {
+	begin := time.Now()
+	err := os.WriteFile(path, data, perm)
+	r.add(IOEvent{Op: op, Path: path, Bytes: int64(len(data)), Ms: ms(time.Since(begin))}, begin, err)
+	return err
+}
+
+// Events returns the events captured so far
+func (r *IORecorder) Events() []IOEvent {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+// Trace puts the recorder's later operations on t's disk track
+func (r *IORecorder) Trace(t *Timeline) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeline = t
+}
+
+func (r *IORecorder) add(ev IOEvent, at time.Time, err error) {
+	if r == nil {
+		return
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ev.At = ms(at.Sub(r.start))
+	r.events = append(r.events, ev)
+	r.timeline.Add(TrackDisk, ev.Op, at, time.Duration(ev.Ms*float64(time.Millisecond)),
+		map[string]any{"path": ev.Path, "bytes": ev.Bytes})
+}
+
+// IOOpStats is one operation's latency and throughput
+type IOOpStats struct {
+	Op         string       `json:"op"`
+	Count      int          `json:"count"`
+	Errors     int          `json:"errors"`
+	Bytes      int64        `json:"bytes"`
+	LatencyMs  Distribution `json:"latencyMs"`
+	MiBps      float64      `json:"mibps"`      // bytes over the time spent in the op
+	Hitches    int          `json:"hitches"`    // operations longer than the hitch threshold
+	IntervalMs float64      `json:"intervalMs"` // median time between starts, the period of one that recurs
+}
+
+// IOStutter is a stutter frame that a disk operation overlapped for much
+// of its overrun
+type IOStutter struct {
+	Frame     int64   `json:"frame"`
+	Ms        float64 `json:"ms"`
+	Op        string  `json:"op"`
+	Path      string  `json:"path,omitempty"`
+	OverlapMs float64 `json:"overlapMs"`
+}
+
+// slowestIOEvents is how many of the slowest operations a report keeps
+const slowestIOEvents = 10
+
+// IOReport summarizes a capture's disk operations, operations by the time
+// spent in them
+type IOReport struct {
+	DurationMs float64     `json:"durationMs"`
+	Events     int         `json:"events"`
+	Bytes      int64       `json:"bytes"`
+	HitchMs    float64     `json:"hitchMs"`
+	Ops        []IOOpStats `json:"ops"`
+	Slowest    []IOEvent   `json:"slowest"`            // over the hitch threshold, slowest first
+	Stutters   []IOStutter `json:"stutters,omitempty"` // with frames, the stutters disk operations explain
+}
+
+// AnalyzeIO summarizes disk events per operation, counting those longer
+// than hitch as hitches. With frames from the same clock, a stutter frame
+// is put down to the operation overlapping it most, if that overlap is
+// at least half the frame's excess over the median, as GC spikes are.
+func AnalyzeIO(events []IOEvent, hitch time.Duration, frames []FrameTime, budget time.Duration) IOReport {
+	r := IOReport{Events: len(events), HitchMs: ms(hitch), Ops: []IOOpStats{}, Slowest: []IOEvent{}}
+	type acc struct {
+		stats     IOOpStats
+		latencies []float64
+		starts    []float64
+		busyMs    float64
+	}
+	byOp := make(map[string]*acc)
+	first, last := 0.0, 0.0
+	for i, ev := range events {
+		if i == 0 || ev.At < first {
+			first = ev.At
+		}
+		last = max(last, ev.At+ev.Ms)
+		a := byOp[ev.Op]
+		if a == nil {
+			a = &acc{stats: IOOpStats{Op: ev.Op}}
+			byOp[ev.Op] = a
+		}
+		a.stats.Count++
+		if ev.Error != "" {
+			a.stats.Errors++
+		}
+		a.stats.Bytes += ev.Bytes
+		r.Bytes += ev.Bytes
+		a.latencies = append(a.latencies, ev.Ms)
+		a.starts = append(a.starts, ev.At)
+		a.busyMs += ev.Ms
+		if ev.Ms > r.HitchMs {
+			a.stats.Hitches++
+			r.Slowest = append(r.Slowest, ev)
+		}
+	}
+	r.DurationMs = last - first
+	for _, a := range byOp {
+		a.stats.LatencyMs = distribution(a.latencies)
+		if a.busyMs > 0 {
+			a.stats.MiBps = float64(a.stats.Bytes) / (1 << 20) / (a.busyMs / 1000)
+		}
+		if len(a.starts) > 1 {
+			slices.Sort(a.starts)
+			gaps := make([]float64, len(a.starts)-1)
+			for i := range gaps {
+				gaps[i] = a.starts[i+1] - a.starts[i]
+			}
+			slices.Sort(gaps)
+			a.stats.IntervalMs = stats.Quantile(gaps, 0.5)
+		}
+		r.Ops = append(r.Ops, a.stats)
+	}
+	sort.Slice(r.Ops, func(i, j int) bool {
+		ti, tj := r.Ops[i].LatencyMs.Mean*float64(r.Ops[i].Count), r.Ops[j].LatencyMs.Mean*float64(r.Ops[j].Count)
+		if ti != tj {
+			return ti > tj
+		}
+		return r.Ops[i].Op < r.Ops[j].Op
+	})
+	sort.SliceStable(r.Slowest, func(i, j int) bool { return r.Slowest[i].Ms > r.Slowest[j].Ms })
+	if len(r.Slowest) > slowestIOEvents {
+		r.Slowest = r.Slowest[:slowestIOEvents]
+	}
+	if len(frames) > 0 {
+		r.Stutters = ioStutters(frames, events, budget)
+	}
+	return r
+}
+
+// ioStutters finds the stutter frames disk operations overlapped. Unlike
+// collection pauses, operations may overlap each other, so each frame is
+// checked against every operation that started before it ended.
+func ioStutters(frames []FrameTime, events []IOEvent, budget time.Duration) []IOStutter {
+	frameReport := AnalyzeFrames(frames, budget)
+	sorted := slices.Clone(events)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].At < sorted[j].At })
+	var out []IOStutter
+	for _, f := range frames {
+		if f.Ms <= frameReport.BudgetMs || !stutters(f.Ms, frameReport.P50Ms) {
+			continue
+		}
+		end := sort.Search(len(sorted), func(i int) bool { return sorted[i].At >= f.At+f.Ms })
+		var best IOStutter
+		for _, ev := range sorted[:end] {
+			if overlap := min(ev.At+ev.Ms, f.At+f.Ms) - max(ev.At, f.At); overlap > best.OverlapMs {
+				best = IOStutter{Frame: f.Frame, Ms: f.Ms, Op: ev.Op, Path: ev.Path, OverlapMs: overlap}
+			}
+		}
+		if best.OverlapMs > 0 && best.OverlapMs >= (f.Ms-frameReport.P50Ms)/2 {
+			out = append(out, best)
+		}
+	}
+	return out
+}
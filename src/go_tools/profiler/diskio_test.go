@@ -0,0 +1,102 @@
+package profiler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIORecorder(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "level.json")
+	rec := NewIORecorder()
+	tl := NewTimeline()
+	rec.Trace(tl)
+	if err := rec.WriteFile(IOAutosave, path, []byte(`{"name":"a"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := rec.ReadFile(IOLevelLoad, path); err != nil || string(data) != `{"name":"a"}` {
+		t.Fatalf("read %q, %v", data, err)
+	}
+	failed := errors.New("disk full")
+	if err := rec.Time(IOLevelSave, path, func() error { return failed }); err != failed {
+		t.Errorf("time passed back %v", err)
+	}
+	events := rec.Events()
+	if len(events) != 3 || events[0].Op != IOAutosave || events[0].Bytes != 12 || events[1].Bytes != 12 {
+		t.Fatalf("events = %+v", events)
+	}
+	if events[2].Bytes != 12 || events[2].Error != "disk full" {
+		t.Errorf("timed save = %+v", events[2])
+	}
+	if got := tl.Events(); len(got) < 3 || got[0].Track != TrackDisk {
+		t.Errorf("timeline = %+v", got)
+	}
+
+	var none *IORecorder
+	if _, err := none.ReadFile(IOReplayLoad, filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("nil recorder read: %v", err)
+	}
+	if none.Events() != nil {
+		t.Error("nil recorder recorded")
+	}
+}
+
+func TestAnalyzeIO(t *testing.T) {
+	events := []IOEvent{
+		{At: 0, Op: IOAutosave, Bytes: 4 << 20, Ms: 200},
+		{At: 1000, Op: IOLevelLoad, Bytes: 1 << 20, Ms: 5},
+		{At: 1100, Op: IOLevelLoad, Bytes: 1 << 20, Ms: 5, Error: "parse"},
+		{At: 5000, Op: IOAutosave, Bytes: 4 << 20, Ms: 300},
+		{At: 10000, Op: IOAutosave, Bytes: 4 << 20, Ms: 100},
+	}
+	// steady 10ms frames, but the ones the autosaves run through stall
+	var frames []FrameTime
+	for i := 0; i < 1100; i++ {
+		ms := 10.0
+		if i == 1 || i == 500 {
+			ms = 150
+		}
+		at := 0.0
+		if i > 0 {
+			at = frames[i-1].At + frames[i-1].Ms
+		}
+		frames = append(frames, FrameTime{Frame: int64(i), At: at, Ms: ms})
+	}
+	r := AnalyzeIO(events, 16700*time.Microsecond, frames, DefaultFrameBudget)
+	if r.Events != 5 || r.Bytes != 14<<20 || !near(r.DurationMs, 10100) || len(r.Ops) != 2 {
+		t.Fatalf("report = %+v", r)
+	}
+	save := r.Ops[0]
+	if save.Op != IOAutosave || save.Count != 3 || save.Hitches != 3 || !near(save.LatencyMs.Max, 300) ||
+		!near(save.MiBps, 20) || !near(save.IntervalMs, 5000) {
+		t.Errorf("autosave = %+v", save)
+	}
+	if load := r.Ops[1]; load.Errors != 1 || load.Hitches != 0 || !near(load.IntervalMs, 100) {
+		t.Errorf("level load = %+v", load)
+	}
+	if len(r.Slowest) != 3 || r.Slowest[0].Ms != 300 || r.Slowest[2].Ms != 100 {
+		t.Errorf("slowest = %+v", r.Slowest)
+	}
+	// frame 1 runs 10-160ms, inside the first autosave, and frame 500
+	// 5140-5290ms, inside the second
+	if len(r.Stutters) != 2 || r.Stutters[0].Frame != 1 || r.Stutters[0].Op != IOAutosave || !near(r.Stutters[0].OverlapMs, 150) ||
+		r.Stutters[1].Frame != 500 || !near(r.Stutters[1].OverlapMs, 150) {
+		t.Errorf("stutters = %+v", r.Stutters)
+	}
+}
+
+func TestReadIOEvents(t *testing.T) {
+	events, err := ReadIOEvents(strings.NewReader(`{"at":1,"op":"autosave","bytes":10,"ms":2}` + "\n\n" + `{"at":5,"op":"replay write","bytes":3,"ms":1}` + "\n"))
+	if err != nil || len(events) != 2 || events[1].Op != IOReplayWrite {
+		t.Fatalf("events = %+v, %v", events, err)
+	}
+	for _, bad := range []string{`{"at":1,"bytes":1}`, `{"op":"x","ms":-1}`, `nope`} {
+		if _, err := ReadIOEvents(strings.NewReader(bad)); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Sample output formats
+const (
+	FormatJSON        = "json"
+	FormatFolded      = "folded"       // one "outer;inner count" line per stack, for flamegraph.pl and friends
+	FormatSpeedscope  = "speedscope"   // https://www.speedscope.app
+	FormatSVG         = "svg"          // a self-contained flamegraph
+	FormatChromeTrace = "chrome-trace" // trace event JSON for chrome://tracing and Perfetto
+)
+
+// ValidFormat reports whether format is one of the sample output formats
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatJSON, FormatFolded, FormatSpeedscope, FormatSVG, FormatChromeTrace, FormatBinary:
+		return true
+	}
+	return false
+}
+
+// Extension returns the file extension of an output format
+func Extension(format string) string {
+	switch format {
+	case FormatFolded:
+		return ".folded"
+	case FormatSpeedscope:
+		return ".speedscope.json"
+	case FormatSVG:
+		return ".svg"
+	case FormatChromeTrace:
+		return ".trace.json"
+	case FormatBinary:
+		return ".bin"
+	}
+	return ".json"
+}
+
+// WriteSamples writes the samples in the given format; title names the
+// speedscope profile and the trace, and heads the flamegraph
+func WriteSamples(w io.Writer, s *Samples, format, title string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case FormatFolded:
+		return WriteFolded(w, s)
+	case FormatSpeedscope:
+		return WriteSpeedscope(w, s, title)
+	case FormatSVG:
+		return WriteFlamegraph(w, s, title)
+	case FormatChromeTrace:
+		return WriteChromeTrace(w, s, nil, title)
+	case FormatBinary:
+		return WriteBinarySamples(w, s)
+	}
+	return fmt.Errorf("unknown sample format %q", format)
+}
+
+// Folded merges identical stacks into folded-stack lines, sorted
+func Folded(s *Samples) []string {
+	counts := make(map[string]int64)
+	for _, sample := range s.Samples {
+		if len(sample.Stack) > 0 && sample.Weight > 0 {
+			counts[strings.Join(sample.Stack, ";")] += sample.Weight
+		}
+	}
+	lines := make([]string, 0, len(counts))
+	for stack, n := range counts {
+		lines = append(lines, fmt.Sprintf("%s %d", stack, n))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// WriteFolded writes the folded-stack lines
+func WriteFolded(w io.Writer, s *Samples) error {
+	for _, l := range Folded(s) {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// speedscopeUnits maps sample units to speedscope's; others become none
+var speedscopeUnits = map[string]string{
+	"bytes": "bytes", "nanoseconds": "nanoseconds", "microseconds": "microseconds",
+	"milliseconds": "milliseconds", "seconds": "seconds",
+}
+
+// WriteSpeedscope writes the samples as a speedscope sampled profile
+func WriteSpeedscope(w io.Writer, s *Samples, name string) error {
+	type frame struct {
+		Name string `json:"name"`
+	}
+	type profile struct {
+		Type       string  `json:"type"`
+		Name       string  `json:"name"`
+		Unit       string  `json:"unit"`
+		StartValue int64   `json:"startValue"`
+		EndValue   int64   `json:"endValue"`
+		Samples    [][]int `json:"samples"`
+		Weights    []int64 `json:"weights"`
+	}
+	unit := speedscopeUnits[s.Unit]
+	if unit == "" {
+		unit = "none"
+	}
+	p := profile{Type: "sampled", Name: name, Unit: unit, Samples: [][]int{}, Weights: []int64{}}
+	frames := []frame{}
+	index := make(map[string]int)
+	for _, sample := range s.Samples {
+		if len(sample.Stack) == 0 || sample.Weight <= 0 {
+			continue
+		}
+		stack := make([]int, len(sample.Stack))
+		for i, f := range sample.Stack {
+			j, ok := index[f]
+			if !ok {
+				j = len(frames)
+				index[f] = j
+				frames = append(frames, frame{f})
+			}
+			stack[i] = j
+		}
+		p.Samples = append(p.Samples, stack)
+		p.Weights = append(p.Weights, sample.Weight)
+		p.EndValue += sample.Weight
+	}
+	enc := json.NewEncoder(w)
+	return enc.Encode(map[string]any{
+		"$schema":  "https://www.speedscope.app/file-format-schema.json",
+		"name":     name,
+		"exporter": "supertetris profiler",
+		"shared":   map[string]any{"frames": frames},
+		"profiles": []profile{p},
+	})
+}
+
+// flameNode is a frame of the merged call tree
+type flameNode struct {
+	name     string
+	total    int64
+	children map[string]*flameNode
+}
+
+func (n *flameNode) child(name string) *flameNode {
+	c, ok := n.children[name]
+	if !ok {
+		c = &flameNode{name: name, children: make(map[string]*flameNode)}
+		n.children[name] = c
+	}
+	return c
+}
+
+// sortedChildren lists the node's callees in name order
+func (n *flameNode) sortedChildren() []*flameNode {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]*flameNode, len(names))
+	for i, name := range names {
+		out[i] = n.children[name]
+	}
+	return out
+}
+
+// flameTree merges the samples into a call tree under a root named all,
+// and returns its depth
+func flameTree(s *Samples) (root *flameNode, depth int) {
+	root = &flameNode{name: "all", children: make(map[string]*flameNode)}
+	for _, sample := range s.Samples {
+		if sample.Weight <= 0 {
+			continue
+		}
+		root.total += sample.Weight
+		n := root
+		for _, f := range sample.Stack {
+			n = n.child(f)
+			n.total += sample.Weight
+		}
+		depth = max(depth, len(sample.Stack))
+	}
+	return root, depth
+}
+
+// Flamegraph layout
+const (
+	flameWidth       = 1200
+	flameFrameHeight = 16
+	flameHeader      = 32
+	flameMinWidth    = 0.5 // narrower frames are left out
+)
+
+// WriteFlamegraph renders the samples as an SVG flamegraph, callers below
+// callees and siblings in name order, with each frame's share on hover
+func WriteFlamegraph(w io.Writer, s *Samples, title string) error {
+	root, depth := flameTree(s)
+	height := flameHeader + (depth+1)*flameFrameHeight + 4
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="11">`, flameWidth, height)
+	fmt.Fprintf(&sb, `<text x="%d" y="20" font-size="15" text-anchor="middle">%s</text>`, flameWidth/2, html.EscapeString(title))
+	var draw func(n *flameNode, x float64, level int)
+	draw = func(n *flameNode, x float64, level int) {
+		width := float64(flameWidth) * float64(n.total) / float64(max(root.total, 1))
+		if width < flameMinWidth {
+			return
+		}
+		y := height - 4 - (level+1)*flameFrameHeight
+		label := fmt.Sprintf("%s (%d, %.2f%%)", n.name, n.total, 100*float64(n.total)/float64(max(root.total, 1)))
+		fmt.Fprintf(&sb, `<g><title>%s</title><rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s" stroke="#fff" stroke-width="0.5"/>`,
+			html.EscapeString(label), x, y, width, flameFrameHeight-1, flameColor(n.name))
+		// about 7px per character at this font size
+		if chars := int(width/7) - 1; chars >= 3 {
+			text := n.name
+			if len(text) > chars {
+				text = text[:chars-2] + ".."
+			}
+			fmt.Fprintf(&sb, `<text x="%.1f" y="%d">%s</text>`, x+3, y+flameFrameHeight-4, html.EscapeString(text))
+		}
+		sb.WriteString("</g>")
+		for _, c := range n.sortedChildren() {
+			draw(c, x, level+1)
+			x += float64(flameWidth) * float64(c.total) / float64(max(root.total, 1))
+		}
+	}
+	if root.total > 0 {
+		draw(root, 0, 0)
+	}
+	sb.WriteString("</svg>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// flameColor picks a stable warm color for a frame name
+func flameColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+v%50, 80+(v>>8)%130, (v>>16)%60)
+}
@@ -0,0 +1,199 @@
+package profiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const stackDump = `goroutine 7 [running]:
+main.simulate(0xc000012345)
+	/src/main.go:40 +0x25
+main.main()
+	/src/main.go:12 +0x1d
+
+goroutine 1 [chan receive]:
+main.wait()
+	/src/main.go:50 +0x10
+
+goroutine 9 [running]:
+github.com/x/profiler.(*Sampler).run(0xc0000a0000)
+	/src/samples.go:70 +0x40
+created by github.com/x/profiler.StartSampler in goroutine 1
+	/src/samples.go:56 +0x99
+
+goroutine 12 [runnable]:
+level.(*Board).Drop(...)
+	/src/board.go:8
+main.simulate(0x1)
+	/src/main.go:41 +0x25
+created by main.main in goroutine 1
+	/src/main.go:11 +0x1d
+`
+
+func testSamples() *Samples {
+	return &Samples{Unit: "samples", Samples: []Sample{
+		{Stack: []string{"main.main", "main.simulate"}, Weight: 3},
+		{Stack: []string{"main.main", "main.simulate", "level.(*Board).Drop"}, Weight: 1},
+		{Stack: []string{"main.main", "main.simulate"}, Weight: 2},
+		{Stack: []string{"main.idle"}, Weight: 0},
+	}}
+}
+
+func TestParseStacks(t *testing.T) {
+	got := parseStacks(stackDump)
+	want := [][]string{
+		{"main.main", "main.simulate"},
+		{"main.simulate", "level.(*Board).Drop"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("stacks = %q, want %q", got, want)
+	}
+}
+
+func TestFolded(t *testing.T) {
+	got := Folded(testSamples())
+	want := []string{"main.main;main.simulate 5", "main.main;main.simulate;level.(*Board).Drop 1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("folded = %q, want %q", got, want)
+	}
+}
+
+func TestWriteSpeedscope(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSpeedscope(&buf, testSamples(), "test"); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Schema string `json:"$schema"`
+		Shared struct {
+			Frames []struct{ Name string } `json:"frames"`
+		} `json:"shared"`
+		Profiles []struct {
+			Type     string
+			Unit     string
+			EndValue int64
+			Samples  [][]int
+			Weights  []int64
+		} `json:"profiles"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(doc.Schema, "speedscope") || len(doc.Profiles) != 1 {
+		t.Fatalf("not a speedscope file: %s", buf.String())
+	}
+	p := doc.Profiles[0]
+	if p.Type != "sampled" || p.Unit != "none" || p.EndValue != 6 || len(p.Samples) != 3 || len(p.Weights) != 3 {
+		t.Fatalf("profile = %+v", p)
+	}
+	if len(doc.Shared.Frames) != 3 || doc.Shared.Frames[p.Samples[1][2]].Name != "level.(*Board).Drop" {
+		t.Errorf("frames = %+v, samples = %v", doc.Shared.Frames, p.Samples)
+	}
+}
+
+func TestWriteFlamegraph(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFlamegraph(&buf, testSamples(), "a <test>"); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	if !strings.HasPrefix(svg, "<svg") || !strings.HasSuffix(svg, "</svg>\n") {
+		t.Fatalf("not an svg: %.80s", svg)
+	}
+	for _, want := range []string{"a &lt;test&gt;", "main.simulate (6, 100.00%)", "level.(*Board).Drop (1, 16.67%)"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("svg lacks %q", want)
+		}
+	}
+	if strings.Contains(svg, "main.idle") {
+		t.Error("unweighted stack drawn")
+	}
+}
+
+func TestSessionSamples(t *testing.T) {
+	if _, err := Start(Options{SampleInterval: time.Millisecond, SampleFormat: "png"}); err == nil {
+		t.Error("unknown sample format accepted")
+	}
+	dir := t.TempDir()
+	s, err := Start(Options{Dir: dir, SampleInterval: time.Millisecond, SampleFormat: FormatFolded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stay on the CPU until sampled; on one core the sampler only runs
+	// when this goroutine is preempted
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		s.sampler.mu.Lock()
+		n := len(s.sampler.counts)
+		s.sampler.mu.Unlock()
+		if n > 0 {
+			break
+		}
+	}
+	paths, err := s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || filepath.Ext(paths[0]) != ".folded" {
+		t.Fatalf("paths = %v, want one folded sample file", paths)
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "TestSessionSamples") {
+		t.Errorf("busy test goroutine never sampled:\n%s", data)
+	}
+}
+
+func TestAdaptiveSamplerRate(t *testing.T) {
+	s := &Sampler{interval: 100 * time.Millisecond, budget: 0.01, current: 100 * time.Millisecond}
+	s.adapt(0.05, time.Second) // over budget: back off
+	s.adapt(0.05, 2*time.Second)
+	if s.Interval() != 400*time.Millisecond {
+		t.Errorf("after overruns: %v, want 400ms", s.Interval())
+	}
+	for i := 0; i < 10; i++ {
+		s.adapt(0.05, 3*time.Second)
+	}
+	if s.Interval() != adaptSlowest*100*time.Millisecond {
+		t.Errorf("backed off to %v, past the slowest rate", s.Interval())
+	}
+	s.adapt(0.005, 4*time.Second) // within budget but not cheap: hold
+	if s.Interval() != adaptSlowest*100*time.Millisecond {
+		t.Errorf("moved within budget to %v", s.Interval())
+	}
+	for i := 0; i < 10; i++ {
+		s.adapt(0.0001, 5*time.Second)
+	}
+	if s.Interval() != 25*time.Millisecond {
+		t.Errorf("idle: %v, want the fastest 25ms", s.Interval())
+	}
+	if len(s.rates) != 2+3+7 || s.rates[0] != (RateChange{At: time.Second, Interval: 200 * time.Millisecond, Overhead: 0.05}) {
+		t.Errorf("rates = %+v", s.rates)
+	}
+
+	a := StartAdaptiveSampler(time.Millisecond, 0.5)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		a.mu.Lock()
+		n := len(a.counts)
+		a.mu.Unlock()
+		if n > 0 {
+			break
+		}
+	}
+	out := a.Stop()
+	if out.Unit != "microseconds" || out.Interval != time.Millisecond {
+		t.Errorf("adaptive samples: unit %q, interval %v", out.Unit, out.Interval)
+	}
+	for _, sample := range out.Samples {
+		if sample.Weight < 250 {
+			t.Errorf("sample weighted %d, want the microseconds of its interval", sample.Weight)
+		}
+	}
+}
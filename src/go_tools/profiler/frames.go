@@ -0,0 +1,233 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// DefaultFrameBudget is a frame at the game's 60 FPS
+const DefaultFrameBudget = time.Second / 60
+
+// StutterFactor is how many median frames long a frame must take to count
+// as a stutter: a hitch against the run's own pacing, which a slow but
+// steady run doesn't have
+const StutterFactor = 2.0
+
+// FrameTime is one timed frame or simulation tick, as the game and the
+// headless simulator log them, one JSON object per line
+type FrameTime struct {
+	Frame int64   `json:"frame"`
+	At    float64 `json:"at,omitempty"` // frame start, in milliseconds since the run began
+	Ms    float64 `json:"ms"`           // frame duration, in milliseconds
+}
+
+// ReadFrameTimes reads JSON-lines frame timings; blank lines are skipped
+// and frames without a start time are placed end to end
+func ReadFrameTimes(r io.Reader) ([]FrameTime, error) {
+	var out []FrameTime
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	line, at := 0, 0.0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var f FrameTime
+		if err := json.Unmarshal(sc.Bytes(), &f); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if f.Ms < 0 || math.IsNaN(f.Ms) {
+			return nil, fmt.Errorf("line %d: frame %d has duration %v", line, f.Frame, f.Ms)
+		}
+		if f.At == 0 {
+			f.At = at
+		}
+		at = f.At + f.Ms
+		out = append(out, f)
+	}
+	return out, sc.Err()
+}
+
+// WriteFrameTimes writes frames one JSON object per line, as
+// ReadFrameTimes reads them
+func WriteFrameTimes(w io.Writer, frames []FrameTime) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, f := range frames {
+		if err := enc.Encode(f); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// FrameCollector times frames or ticks in-process, for the headless
+// simulator and tools; it is safe for concurrent use
+type FrameCollector struct {
+	mu      sync.Mutex
+	start   time.Time
+	frames  []FrameTime
+	live    *LiveMetrics
+	latency *LatencyRecorder
+	gc      *gcTracker
+}
+
+// NewFrameCollector starts a run's clock
+func NewFrameCollector() *FrameCollector {
+	start := time.Now()
+	return &FrameCollector{start: start, gc: newGCTracker(start)}
+}
+
+// Begin marks a frame's start; calling the result ends and records it
+func (c *FrameCollector) Begin() func() {
+	begin := time.Now()
+	return func() { c.add(begin, time.Since(begin)) }
+}
+
+// Record adds a frame of duration d ending now
+func (c *FrameCollector) Record(d time.Duration) {
+	c.add(time.Now().Add(-d), d)
+}
+
+func (c *FrameCollector) add(begin time.Time, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frames = append(c.frames, FrameTime{
+		Frame: int64(len(c.frames)),
+		At:    float64(begin.Sub(c.start)) / float64(time.Millisecond),
+		Ms:    float64(d) / float64(time.Millisecond),
+	})
+	c.live.ObserveTick(d)
+	c.latency.Observe(LatencyTick, d)
+	if now := begin.Add(d); now.Sub(c.gc.polled) >= gcPollEvery {
+		c.gc.poll(now)
+	}
+}
+
+// Frames returns the frames recorded so far
+func (c *FrameCollector) Frames() []FrameTime {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.frames)
+}
+
+// Count is how many frames have been recorded
+func (c *FrameCollector) Count() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int64(len(c.frames))
+}
+
+// FrameReport summarizes a run's frame times, all in milliseconds
+type FrameReport struct {
+	Frames     int     `json:"frames"`
+	BudgetMs   float64 `json:"budgetMs"`
+	MeanMs     float64 `json:"meanMs"`
+	P50Ms      float64 `json:"p50Ms"`
+	P95Ms      float64 `json:"p95Ms"`
+	P99Ms      float64 `json:"p99Ms"`
+	WorstMs    float64 `json:"worstMs"`
+	WorstFrame int64   `json:"worstFrame"`
+	OverBudget int     `json:"overBudget"` // frames longer than the budget
+	Stutters   int     `json:"stutters"`   // frames StutterFactor times the median or longer, and over budget
+}
+
+// StutterRate is the fraction of frames that stuttered
+func (r FrameReport) StutterRate() float64 {
+	if r.Frames == 0 {
+		return 0
+	}
+	return float64(r.Stutters) / float64(r.Frames)
+}
+
+// AnalyzeFrames reports the frame time distribution against budget; a
+// frame only stutters when it also misses the budget, so a fast run's
+// small wobbles don't count
+func AnalyzeFrames(frames []FrameTime, budget time.Duration) FrameReport {
+	r := FrameReport{Frames: len(frames), BudgetMs: float64(budget) / float64(time.Millisecond)}
+	if len(frames) == 0 {
+		return r
+	}
+	ms := make([]float64, len(frames))
+	sum := 0.0
+	for i, f := range frames {
+		ms[i] = f.Ms
+		sum += f.Ms
+		if i == 0 || f.Ms > r.WorstMs {
+			r.WorstMs, r.WorstFrame = f.Ms, f.Frame
+		}
+	}
+	slices.Sort(ms)
+	r.MeanMs = sum / float64(len(ms))
+	r.P50Ms = stats.Quantile(ms, 0.50)
+	r.P95Ms = stats.Quantile(ms, 0.95)
+	r.P99Ms = stats.Quantile(ms, 0.99)
+	for _, f := range frames {
+		over := f.Ms > r.BudgetMs
+		if over {
+			r.OverBudget++
+		}
+		if over && stutters(f.Ms, r.P50Ms) {
+			r.Stutters++
+		}
+	}
+	return r
+}
+
+func stutters(ms, median float64) bool {
+	return ms >= StutterFactor*median
+}
+
+// WriteTimeline writes one CSV row per frame, with whether it missed the
+// budget and stuttered, for plotting the run
+func WriteTimeline(w io.Writer, frames []FrameTime, report FrameReport) error {
+	return writeTimeline(w, frames, report, nil, false)
+}
+
+// WriteGCTimeline writes the timeline with how long each frame was paused
+// for collection, and whether the pause explains its stutter
+func WriteGCTimeline(w io.Writer, frames []FrameTime, report FrameReport, pauses []GCPause) error {
+	return writeTimeline(w, frames, report, pauses, true)
+}
+
+func writeTimeline(w io.Writer, frames []FrameTime, report FrameReport, pauses []GCPause, withGC bool) error {
+	cw := csv.NewWriter(w)
+	header := []string{"frame", "at_ms", "ms", "over_budget", "stutter"}
+	var overlaps []float64
+	gcSpikes := make(map[int64]bool)
+	if withGC {
+		header = append(header, "gc_ms", "gc_spike")
+		overlaps = gcOverlaps(frames, pauses)
+		for _, s := range AnalyzeGC(frames, pauses, time.Duration(report.BudgetMs*float64(time.Millisecond))).Spikes {
+			gcSpikes[s.Frame] = true
+		}
+	}
+	cw.Write(header)
+	for i, f := range frames {
+		over := f.Ms > report.BudgetMs
+		row := []string{
+			strconv.FormatInt(f.Frame, 10),
+			strconv.FormatFloat(f.At, 'f', 3, 64),
+			strconv.FormatFloat(f.Ms, 'f', 3, 64),
+			strconv.FormatBool(over),
+			strconv.FormatBool(over && stutters(f.Ms, report.P50Ms)),
+		}
+		if withGC {
+			row = append(row, strconv.FormatFloat(overlaps[i], 'f', 3, 64), strconv.FormatBool(gcSpikes[f.Frame]))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,96 @@
+package profiler
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestReadFrameTimes(t *testing.T) {
+	in := "{\"frame\":0,\"ms\":16}\n\n{\"frame\":1,\"ms\":17}\n{\"frame\":2,\"at\":100,\"ms\":15}\n{\"frame\":3,\"ms\":1}\n"
+	frames, err := ReadFrameTimes(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{0, 16, 100, 115}
+	if len(frames) != len(want) {
+		t.Fatalf("frames = %+v", frames)
+	}
+	for i, f := range frames {
+		if !near(f.At, want[i]) {
+			t.Errorf("frame %d at %v, want %v", i, f.At, want[i])
+		}
+	}
+	if _, err := ReadFrameTimes(strings.NewReader("{\"frame\":0,\"ms\":-1}\n")); err == nil {
+		t.Error("negative frame time accepted")
+	}
+	if _, err := ReadFrameTimes(strings.NewReader("{\"frame\":0,\"ms\":1}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("err = %v, want a line 2 error", err)
+	}
+}
+
+func TestAnalyzeFrames(t *testing.T) {
+	var frames []FrameTime
+	for i := 0; i < 100; i++ {
+		ms := 10.0
+		switch i {
+		case 40:
+			ms = 50 // a stutter
+		case 60:
+			ms = 18 // over budget, but under twice the median
+		}
+		frames = append(frames, FrameTime{Frame: int64(i), Ms: ms})
+	}
+	r := AnalyzeFrames(frames, DefaultFrameBudget)
+	if r.Frames != 100 || !near(r.P50Ms, 10) || !near(r.WorstMs, 50) || r.WorstFrame != 40 {
+		t.Fatalf("report = %+v", r)
+	}
+	if !near(r.MeanMs, 10.48) || !near(r.P99Ms, 18+0.01*32) {
+		t.Errorf("mean %v p99 %v", r.MeanMs, r.P99Ms)
+	}
+	if r.OverBudget != 2 || r.Stutters != 1 || !near(r.StutterRate(), 0.01) {
+		t.Errorf("over budget %d stutters %d", r.OverBudget, r.Stutters)
+	}
+
+	// a steadily slow run misses the budget without stuttering
+	for i := range frames {
+		frames[i].Ms = 30
+	}
+	if r := AnalyzeFrames(frames, DefaultFrameBudget); r.OverBudget != 100 || r.Stutters != 0 {
+		t.Errorf("steady slow run: %+v", r)
+	}
+	if r := AnalyzeFrames(nil, DefaultFrameBudget); r.Frames != 0 || r.StutterRate() != 0 {
+		t.Errorf("empty run: %+v", r)
+	}
+}
+
+func TestWriteTimeline(t *testing.T) {
+	frames := []FrameTime{{Frame: 0, Ms: 10}, {Frame: 1, At: 10, Ms: 10}, {Frame: 2, At: 20, Ms: 40}}
+	var buf bytes.Buffer
+	if err := WriteTimeline(&buf, frames, AnalyzeFrames(frames, DefaultFrameBudget)); err != nil {
+		t.Fatal(err)
+	}
+	want := "frame,at_ms,ms,over_budget,stutter\n0,0.000,10.000,false,false\n1,10.000,10.000,false,false\n2,20.000,40.000,true,true\n"
+	if buf.String() != want {
+		t.Errorf("timeline =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestFrameCollector(t *testing.T) {
+	c := NewFrameCollector()
+	end := c.Begin()
+	time.Sleep(2 * time.Millisecond)
+	end()
+	c.Record(5 * time.Millisecond)
+	frames := c.Frames()
+	if len(frames) != 2 || frames[0].Frame != 0 || frames[1].Frame != 1 {
+		t.Fatalf("frames = %+v", frames)
+	}
+	if frames[0].Ms < 2 || !near(frames[1].Ms, 5) {
+		t.Errorf("frames = %+v", frames)
+	}
+}
@@ -0,0 +1,208 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"runtime/debug"
+	"slices"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// GCPause is one stop-the-world collection pause, on a run's frame clock
+type GCPause struct {
+	At float64 `json:"at"` // pause start, in milliseconds since the run began
+	Ms float64 `json:"ms"`
+}
+
+// ReadGCPauses reads JSON-lines GC pauses; blank lines are skipped
+func ReadGCPauses(r io.Reader) ([]GCPause, error) {
+	var out []GCPause
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var p GCPause
+		if err := json.Unmarshal(sc.Bytes(), &p); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if p.Ms < 0 || math.IsNaN(p.Ms) {
+			return nil, fmt.Errorf("line %d: pause at %vms has duration %v", line, p.At, p.Ms)
+		}
+		out = append(out, p)
+	}
+	return out, sc.Err()
+}
+
+// WriteGCPauses writes pauses one JSON object per line, as ReadGCPauses
+// reads them
+func WriteGCPauses(w io.Writer, pauses []GCPause) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, p := range pauses {
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// gcPollEvery is how often a frame collector catches up on GC pauses; the
+// runtime only remembers the last 256
+const gcPollEvery = time.Second
+
+// gcTracker keeps the runtime's GC pauses since start, which it would
+// otherwise forget
+type gcTracker struct {
+	start  time.Time
+	numGC  int64
+	polled time.Time
+	pauses []GCPause
+	stats  debug.GCStats
+}
+
+func newGCTracker(start time.Time) *gcTracker {
+	t := &gcTracker{start: start}
+	debug.ReadGCStats(&t.stats)
+	t.numGC = t.stats.NumGC
+	return t
+}
+
+// poll adds the pauses since the last poll, oldest first
+func (t *gcTracker) poll(now time.Time) {
+	t.polled = now
+	debug.ReadGCStats(&t.stats)
+	n := int(t.stats.NumGC - t.numGC)
+	t.numGC = t.stats.NumGC
+	n = min(n, len(t.stats.Pause), len(t.stats.PauseEnd))
+	for i := n - 1; i >= 0; i-- {
+		begin := t.stats.PauseEnd[i].Add(-t.stats.Pause[i])
+		t.pauses = append(t.pauses, GCPause{
+			At: float64(begin.Sub(t.start)) / float64(time.Millisecond),
+			Ms: float64(t.stats.Pause[i]) / float64(time.Millisecond),
+		})
+	}
+}
+
+// GCPauses returns the collection pauses since the collector started
+func (c *FrameCollector) GCPauses() []GCPause {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gc.poll(time.Now())
+	return slices.Clone(c.gc.pauses)
+}
+
+// GCSpike is a stutter frame a collection pause accounts for
+type GCSpike struct {
+	Frame int64   `json:"frame"`
+	Ms    float64 `json:"ms"`
+	GCMs  float64 `json:"gcMs"` // paused within the frame
+}
+
+// GCReport is how often and how long a run paused for collection, and
+// which of its stutters the pauses explain, all in milliseconds
+type GCReport struct {
+	Pauses     int       `json:"pauses"`
+	PerSecond  float64   `json:"perSecond"`
+	TotalMs    float64   `json:"totalMs"`
+	MeanMs     float64   `json:"meanMs"`
+	P95Ms      float64   `json:"p95Ms"`
+	MaxMs      float64   `json:"maxMs"`
+	BudgetMs   float64   `json:"budgetMs"`
+	OverBudget int       `json:"overBudget"` // pauses longer than a whole frame
+	Stutters   int       `json:"stutters"`
+	Spikes     []GCSpike `json:"gcSpikes"` // the stutters GC explains
+}
+
+// Flagged reports a build whose collections alone miss the frame budget
+func (r GCReport) Flagged() bool {
+	return r.OverBudget > 0
+}
+
+// SpikeShare is the fraction of stutters GC explains
+func (r GCReport) SpikeShare() float64 {
+	if r.Stutters == 0 {
+		return 0
+	}
+	return float64(len(r.Spikes)) / float64(r.Stutters)
+}
+
+// AnalyzeGC reports a run's pauses against the frame budget and matches
+// them with its frames: a stutter is GC's when the pause time within it
+// is at least half of what it took over the median frame, the rest being
+// left to physics and the other usual suspects
+func AnalyzeGC(frames []FrameTime, pauses []GCPause, budget time.Duration) GCReport {
+	frameReport := AnalyzeFrames(frames, budget)
+	r := GCReport{Pauses: len(pauses), BudgetMs: frameReport.BudgetMs, Stutters: frameReport.Stutters}
+	if len(pauses) > 0 {
+		ms := make([]float64, len(pauses))
+		for i, p := range pauses {
+			ms[i] = p.Ms
+			r.TotalMs += p.Ms
+			if p.Ms > r.BudgetMs {
+				r.OverBudget++
+			}
+		}
+		slices.Sort(ms)
+		r.MeanMs = r.TotalMs / float64(len(ms))
+		r.P95Ms = stats.Quantile(ms, 0.95)
+		r.MaxMs = ms[len(ms)-1]
+	}
+	if len(frames) > 0 {
+		last := frames[len(frames)-1]
+		if span := last.At + last.Ms - frames[0].At; span > 0 {
+			r.PerSecond = float64(len(pauses)) / span * 1000
+		}
+	}
+	overlaps := gcOverlaps(frames, pauses)
+	for i, f := range frames {
+		if f.Ms <= r.BudgetMs || !stutters(f.Ms, frameReport.P50Ms) {
+			continue
+		}
+		if gc := overlaps[i]; gc > 0 && gc >= (f.Ms-frameReport.P50Ms)/2 {
+			r.Spikes = append(r.Spikes, GCSpike{Frame: f.Frame, Ms: f.Ms, GCMs: gc})
+		}
+	}
+	return r
+}
+
+// gcOverlaps is how long each frame was paused for collection
+func gcOverlaps(frames []FrameTime, pauses []GCPause) []float64 {
+	out := make([]float64, len(frames))
+	if len(pauses) == 0 {
+		return out
+	}
+	sorted := slices.Clone(pauses)
+	slices.SortFunc(sorted, func(a, b GCPause) int {
+		switch {
+		case a.At < b.At:
+			return -1
+		case a.At > b.At:
+			return 1
+		}
+		return 0
+	})
+	for i, f := range frames {
+		// the first pause that may still overlap this frame; pauses don't
+		// overlap each other, so by start they're ordered by end too
+		j, _ := slices.BinarySearchFunc(sorted, f.At, func(p GCPause, at float64) int {
+			if p.At+p.Ms <= at {
+				return -1
+			}
+			return 1
+		})
+		for ; j < len(sorted) && sorted[j].At < f.At+f.Ms; j++ {
+			p := sorted[j]
+			out[i] += max(0, min(p.At+p.Ms, f.At+f.Ms)-max(p.At, f.At))
+		}
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package profiler
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeGC(t *testing.T) {
+	frames := make([]FrameTime, 100)
+	for i := range frames {
+		frames[i] = FrameTime{Frame: int64(i), At: float64(i) * 10, Ms: 10}
+	}
+	// frame 20 stutters on a collection, frame 60 on something else
+	frames[20].Ms, frames[60].Ms = 40, 40
+	for i := 21; i < len(frames); i++ {
+		frames[i].At += 30
+	}
+	for i := 61; i < len(frames); i++ {
+		frames[i].At += 30
+	}
+	pauses := []GCPause{{At: 615, Ms: 2}, {At: 205, Ms: 20}, {At: 500, Ms: 1}}
+	r := AnalyzeGC(frames, pauses, DefaultFrameBudget)
+	if r.Pauses != 3 || !near(r.TotalMs, 23) || !near(r.MaxMs, 20) || r.OverBudget != 1 || !r.Flagged() {
+		t.Errorf("pauses: %+v", r)
+	}
+	if !near(r.PerSecond, 3/1.06) {
+		t.Errorf("per second = %v", r.PerSecond)
+	}
+	if r.Stutters != 2 || len(r.Spikes) != 1 || r.Spikes[0].Frame != 20 || !near(r.Spikes[0].GCMs, 20) || r.SpikeShare() != 0.5 {
+		t.Errorf("spikes: %+v", r)
+	}
+	if r := AnalyzeGC(frames, pauses[2:], DefaultFrameBudget); r.Flagged() || len(r.Spikes) != 0 {
+		t.Errorf("small pauses flagged: %+v", r)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteGCTimeline(&buf, frames[19:22], AnalyzeFrames(frames[19:22], DefaultFrameBudget), pauses); err != nil {
+		t.Fatal(err)
+	}
+	want := "frame,at_ms,ms,over_budget,stutter,gc_ms,gc_spike\n19,190.000,10.000,false,false,0.000,false\n20,200.000,40.000,true,true,20.000,true\n21,240.000,10.000,false,false,0.000,false\n"
+	if buf.String() != want {
+		t.Errorf("timeline =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestGCPausesRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	in := []GCPause{{At: 1.5, Ms: 0.25}, {At: 30, Ms: 2}}
+	if err := WriteGCPauses(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ReadGCPauses(strings.NewReader(buf.String() + "\n"))
+	if err != nil || len(out) != 2 || out[1] != in[1] {
+		t.Errorf("round trip = %+v, %v", out, err)
+	}
+	if _, err := ReadGCPauses(strings.NewReader(`{"at":1,"ms":-1}`)); err == nil {
+		t.Error("negative pause accepted")
+	}
+}
+
+func TestFrameCollectorGCPauses(t *testing.T) {
+	c := NewFrameCollector()
+	runtime.GC()
+	c.Record(time.Millisecond)
+	pauses := c.GCPauses()
+	if len(pauses) == 0 {
+		t.Fatal("no pause recorded for a forced collection")
+	}
+	if p := pauses[len(pauses)-1]; p.At < 0 || p.Ms < 0 {
+		t.Errorf("pause = %+v", p)
+	}
+}
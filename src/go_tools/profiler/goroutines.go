@@ -0,0 +1,257 @@
+package profiler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GoroutineSample is the goroutine population at one moment of a run
+type GoroutineSample struct {
+	AtMs       float64        `json:"atMs"` // since the watch began
+	Total      int            `json:"total"`
+	Signatures map[string]int `json:"signatures"` // goroutines by stack signature
+}
+
+// GoroutineWatch counts goroutines by stack signature at an interval,
+// keeping a representative stack of each signature
+type GoroutineWatch struct {
+	start time.Time
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu      sync.Mutex
+	samples []GoroutineSample
+	stacks  map[string]string // the latest full stack seen per signature
+}
+
+// StartGoroutineWatch samples now and every interval until Stop
+func StartGoroutineWatch(interval time.Duration) *GoroutineWatch {
+	w := &GoroutineWatch{start: time.Now(), stop: make(chan struct{}), done: make(chan struct{}), stacks: make(map[string]string)}
+	w.sample()
+	go w.run(interval)
+	return w
+}
+
+func (w *GoroutineWatch) run(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.sample()
+		}
+	}
+}
+
+// Stop takes a last sample and returns them all, with a representative
+// stack per signature
+func (w *GoroutineWatch) Stop() ([]GoroutineSample, map[string]string) {
+	close(w.stop)
+	<-w.done
+	w.sample()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.samples, w.stacks
+}
+
+func (w *GoroutineWatch) sample() {
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	groups := parseGoroutineGroups(buf.String())
+	s := GoroutineSample{AtMs: float64(time.Since(w.start)) / float64(time.Millisecond), Signatures: make(map[string]int)}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, g := range groups {
+		s.Total += g.count
+		s.Signatures[g.signature] += g.count
+		w.stacks[g.signature] = g.stack
+	}
+	w.samples = append(w.samples, s)
+}
+
+// goroutineGroup is goroutines the runtime found on the same stack
+type goroutineGroup struct {
+	count     int
+	signature string
+	stack     string
+}
+
+// signatureDepth is how many frames name a stack signature
+const signatureDepth = 8
+
+// parseGoroutineGroups reads the goroutine profile's debug=1 text: a
+// "N @ pcs" line per group, then "#\tpc\tfunc+off\tfile:line" frames,
+// innermost first. A signature is the group's functions without lines
+// or offsets, so goroutines parked at different lines of one loop count
+// together.
+func parseGoroutineGroups(text string) []goroutineGroup {
+	var out []goroutineGroup
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	var cur *goroutineGroup
+	var names, frames []string
+	flush := func() {
+		if cur != nil && len(names) > 0 {
+			cur.signature = strings.Join(names, " < ")
+			cur.stack = strings.Join(frames, "\n")
+			out = append(out, *cur)
+		}
+		cur, names, frames = nil, nil, nil
+	}
+	for sc.Scan() {
+		line := sc.Text()
+		if n, _, ok := strings.Cut(line, " @ "); ok && !strings.HasPrefix(line, "#") {
+			flush()
+			count, err := strconv.Atoi(strings.TrimSpace(n))
+			if err != nil {
+				continue
+			}
+			cur = &goroutineGroup{count: count}
+			continue
+		}
+		if cur == nil || !strings.HasPrefix(line, "#\t") {
+			continue
+		}
+		fields := strings.Split(strings.TrimPrefix(line, "#\t"), "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		fn, _, _ := strings.Cut(strings.TrimSpace(fields[1]), "+")
+		where := ""
+		if len(fields) > 2 {
+			where = strings.TrimSpace(fields[2])
+		}
+		frames = append(frames, fmt.Sprintf("%s (%s)", fn, shortFile(where)))
+		if len(names) < signatureDepth {
+			names = append(names, fn)
+		}
+	}
+	flush()
+	return out
+}
+
+// GoroutineLeakOptions decide which signatures are suspects
+type GoroutineLeakOptions struct {
+	MinGrowth   int     // goroutines a signature must gain over the run
+	GrowthShare float64 // of consecutive samples in which it must grow
+	MinSamples  int
+}
+
+// DefaultGoroutineLeakOptions flag a signature that gained ten goroutines,
+// in nearly every interval, over at least five samples
+func DefaultGoroutineLeakOptions() GoroutineLeakOptions {
+	return GoroutineLeakOptions{MinGrowth: 10, GrowthShare: 0.8, MinSamples: 5}
+}
+
+// GoroutineSuspect is a stack signature whose population kept growing
+type GoroutineSuspect struct {
+	Signature   string  `json:"signature"`
+	First       int     `json:"first"`
+	Last        int     `json:"last"`
+	Growth      int     `json:"growth"`
+	PerMin      float64 `json:"perMin"`      // least-squares slope
+	GrowthShare float64 `json:"growthShare"` // intervals in which it grew
+	Stack       string  `json:"stack"`       // a representative full stack
+}
+
+// GoroutineLeakReport is the goroutine population's course over a run and
+// the signatures suspected of leaking, largest growth first
+type GoroutineLeakReport struct {
+	Samples    int                `json:"samples"`
+	DurationMs float64            `json:"durationMs"`
+	First      int                `json:"first"`
+	Last       int                `json:"last"`
+	Peak       int                `json:"peak"`
+	Suspects   []GoroutineSuspect `json:"suspects"`
+	Note       string             `json:"note,omitempty"`
+}
+
+// Warnings describes the suspects, one line each
+func (r GoroutineLeakReport) Warnings() []string {
+	var out []string
+	for _, s := range r.Suspects {
+		out = append(out, fmt.Sprintf("possible goroutine leak: %s grew from %d to %d (%.1f/min) over %s",
+			s.Signature, s.First, s.Last, s.PerMin, time.Duration(r.DurationMs*float64(time.Millisecond)).Round(time.Second)))
+	}
+	return out
+}
+
+// DetectGoroutineLeaks follows each signature's population across the
+// samples. One that grows steadily and ends at its peak is a suspect; a
+// pool that fills up once, or workers that come and go, are not.
+func DetectGoroutineLeaks(samples []GoroutineSample, stacks map[string]string, opts GoroutineLeakOptions) GoroutineLeakReport {
+	r := GoroutineLeakReport{Samples: len(samples), Suspects: []GoroutineSuspect{}}
+	if len(samples) == 0 {
+		r.Note = "no goroutine samples"
+		return r
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	r.DurationMs = last.AtMs - first.AtMs
+	r.First, r.Last = first.Total, last.Total
+	for _, s := range samples {
+		r.Peak = max(r.Peak, s.Total)
+	}
+	if len(samples) < max(opts.MinSamples, 2) {
+		r.Note = fmt.Sprintf("%d goroutine samples are too few to tell growth from churn; run longer or sample more often", len(samples))
+		return r
+	}
+
+	signatures := make(map[string]bool)
+	for _, s := range samples {
+		for sig := range s.Signatures {
+			signatures[sig] = true
+		}
+	}
+	times := make([]float64, len(samples))
+	for i, s := range samples {
+		times[i] = s.AtMs
+	}
+	for sig := range signatures {
+		series := make([]int64, len(samples))
+		peak := int64(0)
+		for i, s := range samples {
+			series[i] = int64(s.Signatures[sig])
+			peak = max(peak, series[i])
+		}
+		growth := series[len(series)-1] - series[0]
+		if growth < int64(opts.MinGrowth) || series[len(series)-1] < peak {
+			continue
+		}
+		up := 0
+		for i := 1; i < len(series); i++ {
+			if series[i] > series[i-1] {
+				up++
+			}
+		}
+		share := float64(up) / float64(len(series)-1)
+		if share < opts.GrowthShare {
+			continue
+		}
+		r.Suspects = append(r.Suspects, GoroutineSuspect{
+			Signature:   sig,
+			First:       int(series[0]),
+			Last:        int(series[len(series)-1]),
+			Growth:      int(growth),
+			PerMin:      fitSlope(times, series) * 60000,
+			GrowthShare: share,
+			Stack:       stacks[sig],
+		})
+	}
+	sort.Slice(r.Suspects, func(i, j int) bool {
+		if r.Suspects[i].Growth != r.Suspects[j].Growth {
+			return r.Suspects[i].Growth > r.Suspects[j].Growth
+		}
+		return r.Suspects[i].Signature < r.Suspects[j].Signature
+	})
+	return r
+}
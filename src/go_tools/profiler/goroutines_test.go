@@ -0,0 +1,100 @@
+package profiler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func goroutineSeries(signatures map[string][]int) []GoroutineSample {
+	var n int
+	for _, s := range signatures {
+		n = len(s)
+	}
+	out := make([]GoroutineSample, n)
+	for i := range out {
+		out[i] = GoroutineSample{AtMs: float64(i) * 60000, Signatures: make(map[string]int)}
+		for sig, counts := range signatures {
+			out[i].Signatures[sig] = counts[i]
+			out[i].Total += counts[i]
+		}
+	}
+	return out
+}
+
+func TestDetectGoroutineLeaks(t *testing.T) {
+	samples := goroutineSeries(map[string][]int{
+		"leaky":   {1, 11, 21, 31, 41, 51},
+		"pool":    {0, 32, 32, 32, 32, 32}, // fills once, then holds
+		"workers": {0, 40, 0, 40, 0, 40},   // come and go
+		"drained": {0, 10, 20, 30, 40, 5},  // gave most back by the end
+		"small":   {0, 1, 2, 3, 4, 5},
+	})
+	r := DetectGoroutineLeaks(samples, map[string]string{"leaky": "main.leak (x/y.go:3)"}, DefaultGoroutineLeakOptions())
+	if len(r.Suspects) != 1 || r.Suspects[0].Signature != "leaky" {
+		t.Fatalf("suspects = %+v", r.Suspects)
+	}
+	s := r.Suspects[0]
+	if s.Growth != 50 || s.First != 1 || s.Last != 51 || s.GrowthShare != 1 || !near(s.PerMin, 10) || s.Stack != "main.leak (x/y.go:3)" {
+		t.Errorf("suspect = %+v", s)
+	}
+	if r.Samples != 6 || r.First != 1 || r.Last != 133 || r.Peak != 136 || r.Note != "" {
+		t.Errorf("report = %+v", r)
+	}
+	if w := r.Warnings(); len(w) != 1 || !strings.Contains(w[0], "leaky grew from 1 to 51") || !strings.Contains(w[0], "5m0s") {
+		t.Errorf("warnings = %q", w)
+	}
+
+	if r := DetectGoroutineLeaks(samples[:3], nil, DefaultGoroutineLeakOptions()); len(r.Suspects) != 0 || r.Note == "" {
+		t.Errorf("three samples: %+v", r)
+	}
+	if r := DetectGoroutineLeaks(nil, nil, DefaultGoroutineLeakOptions()); r.Note == "" {
+		t.Error("no note without samples")
+	}
+}
+
+func parkForever(stop chan struct{}) {
+	<-stop
+}
+
+func TestGoroutineWatchFindsGrowingSignature(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	w := StartGoroutineWatch(time.Hour)
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 4; j++ {
+			go parkForever(stop)
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.sample()
+	}
+	samples, stacks := w.Stop()
+	if len(samples) != 7 {
+		t.Fatalf("%d samples, want 7", len(samples))
+	}
+	r := DetectGoroutineLeaks(samples, stacks, GoroutineLeakOptions{MinGrowth: 20, GrowthShare: 0.5, MinSamples: 5})
+	if len(r.Suspects) != 1 || !strings.HasPrefix(r.Suspects[0].Signature, "github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler.parkForever") {
+		t.Fatalf("suspects = %+v", r.Suspects)
+	}
+	if s := r.Suspects[0]; s.Growth != 20 || !strings.Contains(s.Stack, "goroutines_test.go:") {
+		t.Errorf("suspect = %+v", s)
+	}
+}
+
+func TestParseGoroutineGroups(t *testing.T) {
+	text := `goroutine profile: total 3
+2 @ 0x1 0x2
+#	0x43e1	main.wait+0x31	/src/app/wait.go:12
+#	0x43e2	main.serve+0x10	/src/app/serve.go:40
+
+1 @ 0x3
+#	0x43e3	runtime.main+0x1	/go/src/runtime/proc.go:250
+`
+	groups := parseGoroutineGroups(text)
+	if len(groups) != 2 || groups[0].count != 2 || groups[0].signature != "main.wait < main.serve" || groups[1].signature != "runtime.main" {
+		t.Fatalf("groups = %+v", groups)
+	}
+	if groups[0].stack != "main.wait (app/wait.go:12)\nmain.serve (app/serve.go:40)" {
+		t.Errorf("stack = %q", groups[0].stack)
+	}
+}
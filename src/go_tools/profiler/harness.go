@@ -0,0 +1,118 @@
+package profiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Simulator runs a replay headlessly, one event a tick, such as
+// analyzer.ReplaySimulator
+type Simulator interface {
+	Load(r *replay.Replay) error
+	Step(ev replay.Event) error
+}
+
+// HarnessOptions shape a replay-driven profiling run
+type HarnessOptions struct {
+	Name   string            // the session's name; replay by default
+	Build  string            // the build profiled, recorded as the build label
+	Labels map[string]string // more session labels
+	Passes int               // profiled passes over the replay, 5 by default
+	Warmup int               // passes before profiling starts, so caches and the heap settle
+}
+
+// HarnessResult is a replay-driven session and the workload it ran
+type HarnessResult struct {
+	Artifact *Artifact       `json:"artifact"`
+	Workload string          `json:"workload"` // the replay's content hash; sessions with the same one ran the same work
+	Events   int             `json:"events"`   // per pass
+	Ticks    int64           `json:"ticks"`    // across the profiled passes
+	Passes   []time.Duration `json:"passes"`
+}
+
+// Workload is the content hash naming a replay as a profiling workload
+func Workload(r *replay.Replay) (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// RunReplay steps the replay through sim under a named session, each
+// event a timed tick, so two builds profiled on the same replay did the
+// same work and their sessions diff like for like. The session captures
+// what ConfigureSessions set, with the ticks as its frames; the workload
+// hash, build and passes are its labels.
+func RunReplay(r *replay.Replay, sim Simulator, opts HarnessOptions) (*HarnessResult, error) {
+	if len(r.Events) == 0 {
+		return nil, fmt.Errorf("replay has no events to run")
+	}
+	if opts.Name == "" {
+		opts.Name = "replay"
+	}
+	if opts.Passes <= 0 {
+		opts.Passes = 5
+	}
+	workload, err := Workload(r)
+	if err != nil {
+		return nil, err
+	}
+	pass := func(frames *FrameCollector) error {
+		if err := sim.Load(r); err != nil {
+			return err
+		}
+		for i, ev := range r.Events {
+			end := frames.Begin()
+			err := sim.Step(ev)
+			end()
+			if err != nil {
+				return fmt.Errorf("event %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+	for i := 0; i < opts.Warmup; i++ {
+		if err := pass(NewFrameCollector()); err != nil {
+			return nil, fmt.Errorf("warm-up: %w", err)
+		}
+	}
+
+	labels := map[string]string{"workload": workload, "passes": strconv.Itoa(opts.Passes)}
+	if opts.Build != "" {
+		labels["build"] = opts.Build
+	}
+	for k, v := range opts.Labels {
+		labels[k] = v
+	}
+	frames := NewFrameCollector()
+	sessionMu.Lock()
+	prev := sessionOpts
+	sessionOpts.Frames = frames
+	sessionMu.Unlock()
+	defer ConfigureSessions(prev)
+	if err := StartSession(opts.Name, labels); err != nil {
+		return nil, err
+	}
+	res := &HarnessResult{Workload: workload, Events: len(r.Events)}
+	var runErr error
+	for i := 0; i < opts.Passes && runErr == nil; i++ {
+		begin := time.Now()
+		if runErr = pass(frames); runErr == nil {
+			res.Passes = append(res.Passes, time.Since(begin))
+		}
+	}
+	a, err := StopSession()
+	res.Artifact, res.Ticks = a, frames.Count()
+	if runErr != nil {
+		return res, fmt.Errorf("pass %d: %w", len(res.Passes)+1, runErr)
+	}
+	return res, err
+}
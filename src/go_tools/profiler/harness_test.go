@@ -0,0 +1,56 @@
+package profiler
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestRunReplayIsRepeatable(t *testing.T) {
+	dir := t.TempDir()
+	ConfigureSessions(Options{Memory: true, Dir: dir})
+	defer ConfigureSessions(Options{CPU: true, Memory: true, Dir: "data/profiles"})
+	r := &replay.Replay{Players: []replay.Player{{ID: "p"}}}
+	for i := 0; i < 40; i++ {
+		r.Events = append(r.Events, replay.Event{Type: replay.EventLock, Player: "p", Piece: "I", X: 0, Y: 18})
+	}
+
+	var workloads []string
+	for _, build := range []string{"a", "b"} {
+		sim := analyzer.NewReplaySimulator(nil, level.GridSize{Width: 4, Height: 20})
+		res, err := RunReplay(r, sim, HarnessOptions{Build: build, Passes: 3, Warmup: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Events != 40 || res.Ticks != 120 || len(res.Passes) != 3 || sim.Locks != 40 {
+			t.Errorf("build %s: %+v, %d locks", build, res, sim.Locks)
+		}
+		a := res.Artifact
+		if a.Labels["build"] != build || a.Labels["workload"] != res.Workload || a.Labels["passes"] != "3" {
+			t.Errorf("labels = %v", a.Labels)
+		}
+		if _, err := os.Stat(a.Profiles["frames"]); err != nil {
+			t.Errorf("no frames in %v", a.Profiles)
+		}
+		workloads = append(workloads, res.Workload)
+		time.Sleep(time.Millisecond) // bundles are named to the millisecond
+	}
+	if workloads[0] != workloads[1] || workloads[0] == "" {
+		t.Errorf("workloads %v differ", workloads)
+	}
+	if running != nil {
+		t.Error("session left running")
+	}
+
+	r.Events[0].X = 1
+	if w, _ := Workload(r); w == workloads[0] {
+		t.Error("a changed replay is the same workload")
+	}
+	if _, err := RunReplay(&replay.Replay{}, analyzer.NewReplaySimulator(nil, level.GridSize{}), HarnessOptions{}); err == nil {
+		t.Error("ran a replay without events")
+	}
+}
@@ -0,0 +1,204 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Histogram is an HDR histogram of durations, to the microsecond: its
+// buckets keep every value to a fixed number of significant digits however
+// large, in constant memory, so a tail percentile is as exact as the
+// median, and histograms of many sessions merge without their samples.
+// Values over its highest are counted as the highest.
+type Histogram struct {
+	digits   int
+	highest  int64 // microseconds
+	halfMag  uint  // log2 of half the sub-buckets of a bucket
+	half     int64
+	mask     int64
+	counts   []int64
+	total    int64
+	min, max int64
+	sum      float64
+}
+
+// NewHistogram makes a histogram of durations up to highest, kept to
+// digits significant decimal digits, 1 to 5
+func NewHistogram(highest time.Duration, digits int) *Histogram {
+	digits = min(max(digits, 1), 5)
+	h := &Histogram{digits: digits, highest: max(int64(highest/time.Microsecond), 2), min: math.MaxInt64}
+	// enough sub-buckets that neighbours differ by under one in the last digit
+	largest := 2 * int64(math.Pow10(digits))
+	subBuckets := int64(1) << bits.Len64(uint64(largest-1))
+	h.halfMag = uint(bits.TrailingZeros64(uint64(subBuckets))) - 1
+	h.half, h.mask = subBuckets/2, subBuckets-1
+	buckets := 1
+	for smallest := subBuckets; smallest <= h.highest; smallest <<= 1 {
+		buckets++
+	}
+	h.counts = make([]int64, (buckets+1)*int(h.half))
+	return h
+}
+
+func (h *Histogram) bucket(v int64) int {
+	return bits.Len64(uint64(v|h.mask)) - int(h.halfMag+1)
+}
+
+func (h *Histogram) index(v int64) int {
+	b := h.bucket(v)
+	return (b+1)<<h.halfMag + int(v>>b-h.half)
+}
+
+// lowest is the smallest value counted at index i
+func (h *Histogram) lowest(i int) int64 {
+	b := i>>h.halfMag - 1
+	sub := int64(i)&(h.half-1) + h.half
+	if b < 0 {
+		sub -= h.half
+		b = 0
+	}
+	return sub << b
+}
+
+// highestAt is the largest value counted at index i
+func (h *Histogram) highestAt(i int) int64 {
+	v := h.lowest(i)
+	return v + 1<<h.bucket(v) - 1
+}
+
+// Record counts a duration
+func (h *Histogram) Record(d time.Duration) {
+	h.recordN(int64(d/time.Microsecond), 1)
+}
+
+func (h *Histogram) recordN(v, n int64) {
+	v = min(max(v, 0), h.highest)
+	h.counts[h.index(v)] += n
+	h.total += n
+	h.min, h.max = min(h.min, v), max(h.max, v)
+	h.sum += float64(v) * float64(n)
+}
+
+// Count is how many durations were recorded
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// Max is the longest duration recorded
+func (h *Histogram) Max() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Mean is the recorded durations' mean
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.total) * float64(time.Microsecond))
+}
+
+// Quantile is the duration q of the recorded ones are at most, as the
+// top of its bucket, such as 0.99 for the 99th percentile
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	target := max(int64(math.Ceil(min(max(q, 0), 1)*float64(h.total))), 1)
+	var seen int64
+	for i, n := range h.counts {
+		if seen += n; seen >= target {
+			v := min(max(h.highestAt(i), h.min), h.max)
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
+
+// Merge adds o's durations to h. A histogram of another range or
+// precision is added bucket by bucket, each at its middle value.
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.total == 0 {
+		return
+	}
+	if o.digits == h.digits && o.highest == h.highest {
+		for i, n := range o.counts {
+			h.counts[i] += n
+		}
+		h.total += o.total
+		h.min, h.max = min(h.min, o.min), max(h.max, o.max)
+		h.sum += o.sum
+		return
+	}
+	for i, n := range o.counts {
+		if n > 0 {
+			v := o.lowest(i)
+			h.recordN(v+(o.highestAt(i)-v)/2, n)
+		}
+	}
+}
+
+// Clone copies h
+func (h *Histogram) Clone() *Histogram {
+	c := *h
+	c.counts = append([]int64(nil), h.counts...)
+	return &c
+}
+
+// histogramJSON is a histogram as written, only its non-empty buckets
+type histogramJSON struct {
+	Digits  int        `json:"digits"`
+	Highest int64      `json:"highestUs"`
+	Count   int64      `json:"count"`
+	Min     int64      `json:"minUs"`
+	Max     int64      `json:"maxUs"`
+	Sum     float64    `json:"sumUs"`
+	Counts  [][2]int64 `json:"counts"` // [bucket index, count]
+}
+
+// MarshalJSON writes the histogram's shape and non-empty buckets
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	out := histogramJSON{Digits: h.digits, Highest: h.highest, Count: h.total, Sum: h.sum, Counts: [][2]int64{}}
+	if h.total > 0 {
+		out.Min, out.Max = h.min, h.max
+	}
+	for i, n := range h.counts {
+		if n > 0 {
+			out.Counts = append(out.Counts, [2]int64{int64(i), n})
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON reads a histogram MarshalJSON wrote
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var in histogramJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	if in.Digits < 1 || in.Digits > 5 || in.Highest < 2 {
+		return fmt.Errorf("histogram of %d digits up to %dus", in.Digits, in.Highest)
+	}
+	*h = *NewHistogram(time.Duration(in.Highest)*time.Microsecond, in.Digits)
+	var total int64
+	for _, c := range in.Counts {
+		if c[0] < 0 || c[0] >= int64(len(h.counts)) || c[1] <= 0 {
+			return fmt.Errorf("histogram bucket %d of count %d", c[0], c[1])
+		}
+		h.counts[c[0]] += c[1]
+		total += c[1]
+	}
+	if total != in.Count {
+		return fmt.Errorf("histogram buckets count %d, not its count %d", total, in.Count)
+	}
+	h.total, h.sum = in.Count, in.Sum
+	if h.total > 0 {
+		h.min, h.max = in.Min, in.Max
+	}
+	return nil
+}
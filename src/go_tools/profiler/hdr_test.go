@@ -0,0 +1,91 @@
+package profiler
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// within is whether got is want to three significant digits
+func within(got, want time.Duration) bool {
+	return math.Abs(float64(got-want)) <= float64(want)/1000
+}
+
+func TestHistogramQuantiles(t *testing.T) {
+	h := NewHistogram(time.Minute, 3)
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond / 10)
+	}
+	h.Record(30 * time.Second)
+	if h.Count() != 10001 || h.Max() != 30*time.Second {
+		t.Fatalf("count %d, max %s", h.Count(), h.Max())
+	}
+	for q, want := range map[float64]time.Duration{0.5: 500 * time.Millisecond, 0.9: 900 * time.Millisecond, 0.99: 990 * time.Millisecond, 1: 30 * time.Second} {
+		if got := h.Quantile(q); !within(got, want) {
+			t.Errorf("q%v = %s, want %s", q, got, want)
+		}
+	}
+	if got := h.Quantile(0); got != 100*time.Microsecond {
+		t.Errorf("q0 = %s", got)
+	}
+	// a value over the range counts as the top of it
+	h.Record(time.Hour)
+	if h.Max() != time.Minute {
+		t.Errorf("clamped max = %s", h.Max())
+	}
+	if e := NewHistogram(time.Second, 3); e.Quantile(0.99) != 0 || e.Mean() != 0 {
+		t.Errorf("empty histogram reports %s", e.Quantile(0.99))
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b := NewHistogram(time.Minute, 3), NewHistogram(time.Minute, 3)
+	for i := 0; i < 990; i++ {
+		a.Record(10 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		b.Record(200 * time.Millisecond)
+	}
+	// each alone hides the other's tail; merged, p99 sits at the boundary
+	a.Merge(b)
+	if a.Count() != 1000 || !within(a.Quantile(0.99), 10*time.Millisecond) || !within(a.Quantile(0.995), 200*time.Millisecond) {
+		t.Errorf("merged: count %d, p99 %s, p99.5 %s", a.Count(), a.Quantile(0.99), a.Quantile(0.995))
+	}
+	if !within(a.Mean(), 11900*time.Microsecond) {
+		t.Errorf("mean = %s", a.Mean())
+	}
+
+	coarse := NewHistogram(time.Hour, 2)
+	coarse.Merge(a)
+	if coarse.Count() != 1000 || math.Abs(float64(coarse.Quantile(0.5)-10*time.Millisecond)) > float64(time.Millisecond)/5 {
+		t.Errorf("merged into another shape: count %d, p50 %s", coarse.Count(), coarse.Quantile(0.5))
+	}
+}
+
+func TestHistogramJSON(t *testing.T) {
+	h := NewHistogram(time.Minute, 3)
+	for _, d := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 2 * time.Millisecond, time.Second} {
+		h.Record(d)
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Histogram
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Count() != 4 || back.Quantile(0.5) != h.Quantile(0.5) || back.Max() != time.Second || back.Mean() != h.Mean() {
+		t.Errorf("round trip = %s", data)
+	}
+	for _, bad := range []string{
+		`{"digits":9,"highestUs":1000,"count":0,"counts":[]}`,
+		`{"digits":3,"highestUs":1000,"count":2,"counts":[[5,1]]}`,
+		`{"digits":3,"highestUs":1000,"count":1,"counts":[[99999999,1]]}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &back); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
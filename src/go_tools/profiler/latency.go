@@ -0,0 +1,180 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latency kinds a LatencyRecorder keeps
+const (
+	LatencyTick  = "tick"  // a frame or simulation tick
+	LatencyRTT   = "rtt"   // a network round trip
+	LatencyInput = "input" // from a player's input arriving to the state that applied it going out
+)
+
+// latencyKinds is the order latencies are listed in; other kinds follow
+// by name
+var latencyKinds = []string{LatencyTick, LatencyRTT, LatencyInput}
+
+// The shape of a recorder's histograms: a minute, to three significant
+// digits
+const (
+	latencyHighest = time.Minute
+	latencyDigits  = 3
+)
+
+// Latencies are HDR histograms by latency kind, as a session's
+// latency-<time>.json holds them
+type Latencies map[string]*Histogram
+
+// Merge adds o's histograms into l, pooling sessions' latencies
+func (l Latencies) Merge(o Latencies) {
+	for kind, h := range o {
+		if l[kind] == nil {
+			l[kind] = NewHistogram(latencyHighest, latencyDigits)
+		}
+		l[kind].Merge(h)
+	}
+}
+
+// Kinds lists l's kinds: tick, rtt and input, then any others by name
+func (l Latencies) Kinds() []string {
+	var out, others []string
+	for _, kind := range latencyKinds {
+		if l[kind] != nil {
+			out = append(out, kind)
+		}
+	}
+	for kind := range l {
+		if l[kind] != nil && !slices.Contains(latencyKinds, kind) {
+			others = append(others, kind)
+		}
+	}
+	sort.Strings(others)
+	return append(out, others...)
+}
+
+// LatencySummary is one latency kind's percentiles, in milliseconds
+type LatencySummary struct {
+	Kind   string  `json:"kind"`
+	Count  int64   `json:"count"`
+	MeanMs float64 `json:"meanMs"`
+	P50Ms  float64 `json:"p50Ms"`
+	P90Ms  float64 `json:"p90Ms"`
+	P99Ms  float64 `json:"p99Ms"`
+	P999Ms float64 `json:"p999Ms"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+// Summaries are l's percentiles, kind by kind
+func (l Latencies) Summaries() []LatencySummary {
+	out := []LatencySummary{}
+	for _, kind := range l.Kinds() {
+		h := l[kind]
+		out = append(out, LatencySummary{Kind: kind, Count: h.Count(), MeanMs: ms(h.Mean()), P50Ms: ms(h.Quantile(0.50)),
+			P90Ms: ms(h.Quantile(0.90)), P99Ms: ms(h.Quantile(0.99)), P999Ms: ms(h.Quantile(0.999)), MaxMs: ms(h.Max())})
+	}
+	return out
+}
+
+// ReadLatencies reads latency histograms as a session writes them
+func ReadLatencies(r io.Reader) (Latencies, error) {
+	var l Latencies
+	if err := json.NewDecoder(r).Decode(&l); err != nil {
+		return nil, err
+	}
+	for kind, h := range l {
+		if h == nil {
+			delete(l, kind)
+		}
+	}
+	return l, nil
+}
+
+// LoadLatencies reads a latency-<time>.json, or the one of a session
+// bundle
+func LoadLatencies(path string) (Latencies, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		paths, err := sessionPaths(path)
+		if err != nil {
+			return nil, err
+		}
+		file, ok := paths["latency"]
+		if !ok {
+			return nil, fmt.Errorf("%s has no latency histograms; profile with a latency recorder", path)
+		}
+		path = file
+	}
+	var l Latencies
+	err := readLog(path, func(f io.Reader) (err error) {
+		l, err = ReadLatencies(f)
+		return err
+	})
+	return l, err
+}
+
+// LatencyRecorder keeps HDR histograms of the latencies players feel:
+// tick times, round trips and input latency. It is safe for concurrent
+// use, and a nil recorder records nothing.
+type LatencyRecorder struct {
+	mu    sync.Mutex
+	hists Latencies
+}
+
+// NewLatencyRecorder makes an empty recorder
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{hists: make(Latencies)}
+}
+
+// Observe records a latency of kind
+func (r *LatencyRecorder) Observe(kind string, d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := r.hists[kind]
+	if h == nil {
+		h = NewHistogram(latencyHighest, latencyDigits)
+		r.hists[kind] = h
+	}
+	h.Record(d)
+}
+
+// Latencies copies the histograms recorded so far
+func (r *LatencyRecorder) Latencies() Latencies {
+	out := make(Latencies)
+	if r == nil {
+		return out
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for kind, h := range r.hists {
+		out[kind] = h.Clone()
+	}
+	return out
+}
+
+// Latency records the collector's later frames as tick latencies in r
+func (c *FrameCollector) Latency(r *LatencyRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latency = r
+}
+
+// Latency records the recorder's later round trips and input latencies
+// in l
+func (r *NetworkRecorder) Latency(l *LatencyRecorder) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latency = l
+}
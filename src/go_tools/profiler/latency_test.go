@@ -0,0 +1,93 @@
+package profiler
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// nearMs is whether a histogram's percentile is want to its precision
+func nearMs(got, want float64) bool {
+	return math.Abs(got-want) <= want/1000
+}
+
+func TestLatencyRecorderSession(t *testing.T) {
+	dir := t.TempDir()
+	frames, latency := NewFrameCollector(), NewLatencyRecorder()
+	s, err := Start(Options{Dir: dir, Frames: frames, Latency: latency})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		frames.Record(time.Duration(i+1) * time.Millisecond)
+	}
+	net := NewNetworkRecorder()
+	net.Latency(latency)
+	c := net.Conn("player1")
+	c.ObserveRTT("ping", 40*time.Millisecond)
+	c.ObserveInput(25 * time.Millisecond)
+	paths, err := s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := LoadLatencies(dir)
+	if err != nil {
+		t.Fatalf("%v of %v", err, paths)
+	}
+	if kinds := l.Kinds(); !slices.Equal(kinds, []string{LatencyTick, LatencyRTT, LatencyInput}) {
+		t.Fatalf("kinds = %v", kinds)
+	}
+	sums := l.Summaries()
+	if tick := sums[0]; tick.Count != 100 || !nearMs(tick.P50Ms, 50) || !nearMs(tick.P99Ms, 99) || !near(tick.MaxMs, 100) {
+		t.Errorf("tick = %+v", tick)
+	}
+	if sums[1].Count != 1 || !near(sums[1].P99Ms, 40) || !near(sums[2].P50Ms, 25) {
+		t.Errorf("rtt %+v, input %+v", sums[1], sums[2])
+	}
+
+	// two sessions' latencies pool into one set of percentiles
+	again, err := LoadLatencies(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Merge(again)
+	if sums := l.Summaries(); sums[0].Count != 200 || !nearMs(sums[0].P99Ms, 99) {
+		t.Errorf("merged tick = %+v", sums[0])
+	}
+}
+
+func TestDiffLatency(t *testing.T) {
+	session := func(tick time.Duration) string {
+		dir := t.TempDir()
+		r := NewLatencyRecorder()
+		for i := 0; i < 1000; i++ {
+			r.Observe(LatencyTick, 8*time.Millisecond)
+		}
+		for i := 0; i < 20; i++ {
+			r.Observe(LatencyTick, tick)
+		}
+		if _, err := writeReport(dir, "latency", r.Latencies()); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	before, err := LoadSessionProfiles(session(10*time.Millisecond), DefaultFrameBudget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := LoadSessionProfiles(session(50*time.Millisecond), DefaultFrameBudget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DiffProfiles(before, after, DefaultDiffOptions())
+	if !slices.Equal(d.Compared, []string{MetricLatency}) {
+		t.Fatalf("compared %v", d.Compared)
+	}
+	// the mean barely moves; the tail is what regressed
+	regs := d.Regressions()
+	if len(regs) != 2 || regs[0].Name != "tick p99" && regs[0].Name != "tick p99.9" || !near(regs[0].After, 50) {
+		t.Errorf("regressions = %+v", regs)
+	}
+}
@@ -0,0 +1,310 @@
+package profiler
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SiteUsage is the live heap of one allocation site
+type SiteUsage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+// HeapSample is the heap as of one collection during a run
+type HeapSample struct {
+	AtMs    float64              `json:"atMs"` // since the watch began
+	Inuse   uint64               `json:"inuse"`
+	Objects uint64               `json:"objects"`
+	Sys     uint64               `json:"sys"`
+	NumGC   uint32               `json:"numGC"`
+	Sites   map[string]SiteUsage `json:"sites"` // by allocation stack, innermost frame first
+}
+
+// HeapWatch samples the heap and its allocation sites at an interval,
+// collecting first so each sample holds only live memory
+type HeapWatch struct {
+	start time.Time
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu      sync.Mutex
+	samples []HeapSample
+}
+
+// StartHeapWatch samples now and every interval until Stop
+func StartHeapWatch(interval time.Duration) *HeapWatch {
+	w := &HeapWatch{start: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+	w.sample()
+	go w.run(interval)
+	return w
+}
+
+func (w *HeapWatch) run(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.sample()
+		}
+	}
+}
+
+// Stop takes a last sample and returns them all
+func (w *HeapWatch) Stop() []HeapSample {
+	close(w.stop)
+	<-w.done
+	w.sample()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.samples
+}
+
+func (w *HeapWatch) sample() {
+	// the memory profile trails by up to two cycles
+	runtime.GC()
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	s := HeapSample{
+		AtMs:    float64(time.Since(w.start)) / float64(time.Millisecond),
+		Inuse:   ms.HeapInuse,
+		Objects: ms.HeapObjects,
+		Sys:     ms.Sys,
+		NumGC:   ms.NumGC,
+		Sites:   heapSites(),
+	}
+	w.mu.Lock()
+	w.samples = append(w.samples, s)
+	w.mu.Unlock()
+}
+
+// heapSites reads the live heap per allocation stack from the memory
+// profile, which the runtime samples about once per MemProfileRate bytes
+// and scales here back to estimates
+func heapSites() map[string]SiteUsage {
+	return memorySites(false, siteDepth)
+}
+
+// memorySites reads the memory profile per allocation stack of up to
+// depth frames: the live heap, or with allocated everything allocated
+// since the program began, freed or not
+func memorySites(allocated bool, depth int) map[string]SiteUsage {
+	n, _ := runtime.MemProfile(nil, allocated)
+	records := make([]runtime.MemProfileRecord, n+50)
+	n, ok := runtime.MemProfile(records, allocated)
+	if !ok {
+		return nil
+	}
+	rate := int64(runtime.MemProfileRate)
+	sites := make(map[string]SiteUsage)
+	for _, r := range records[:n] {
+		objects, bytes := r.InUseObjects(), r.InUseBytes()
+		if allocated {
+			objects, bytes = r.AllocObjects, r.AllocBytes
+		}
+		if objects <= 0 {
+			continue
+		}
+		if rate > 1 {
+			// the runtime.MemProfile estimate pprof also applies
+			size := float64(bytes) / float64(objects)
+			scale := 1 / (1 - math.Exp(-size/float64(rate)))
+			objects, bytes = int64(float64(objects)*scale), int64(float64(bytes)*scale)
+		}
+		key := siteKey(r.Stack(), depth)
+		u := sites[key]
+		u.Bytes += bytes
+		u.Objects += objects
+		sites[key] = u
+	}
+	return sites
+}
+
+// siteKey names an allocation stack by its frames outside the runtime,
+// innermost first, joined with " < "
+func siteKey(pcs []uintptr, depth int) string {
+	frames := runtime.CallersFrames(pcs)
+	var names []string
+	for {
+		f, more := frames.Next()
+		if f.Function != "" && !strings.HasPrefix(f.Function, "runtime.") {
+			names = append(names, fmt.Sprintf("%s (%s:%d)", f.Function, shortFile(f.File), f.Line))
+		}
+		if !more || len(names) == depth {
+			break
+		}
+	}
+	if len(names) == 0 {
+		return "runtime"
+	}
+	return strings.Join(names, " < ")
+}
+
+// siteDepth is how many frames name a leaking allocation site
+const siteDepth = 4
+
+func shortFile(path string) string {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		if j := strings.LastIndex(path[:i], "/"); j >= 0 {
+			return path[j+1:]
+		}
+	}
+	return path
+}
+
+// LeakOptions decide which sites are suspects
+type LeakOptions struct {
+	MinGrowth   int64   // bytes a site must grow by over the run
+	GrowthShare float64 // of consecutive samples in which it must grow
+	MinSamples  int
+}
+
+// DefaultLeakOptions flag a site that grew by a MiB, in nearly every
+// interval, over at least five samples
+func DefaultLeakOptions() LeakOptions {
+	return LeakOptions{MinGrowth: 1 << 20, GrowthShare: 0.8, MinSamples: 5}
+}
+
+// LeakSuspect is an allocation site whose live heap kept growing
+type LeakSuspect struct {
+	Site         string  `json:"site"`
+	FirstBytes   int64   `json:"firstBytes"`
+	LastBytes    int64   `json:"lastBytes"`
+	Growth       int64   `json:"growth"`
+	BytesPerMin  float64 `json:"bytesPerMin"` // least-squares slope
+	GrowthShare  float64 `json:"growthShare"` // intervals in which it grew
+	LastObjects  int64   `json:"lastObjects"`
+	ObjectGrowth int64   `json:"objectGrowth"`
+}
+
+// LeakReport is the heap's course over a run and the sites suspected of
+// leaking, largest growth first
+type LeakReport struct {
+	Samples     int           `json:"samples"`
+	DurationMs  float64       `json:"durationMs"`
+	FirstInuse  uint64        `json:"firstInuse"`
+	LastInuse   uint64        `json:"lastInuse"`
+	PeakInuse   uint64        `json:"peakInuse"`
+	InuseGrowth float64       `json:"inuseGrowth"` // of in-use heap intervals that grew
+	Suspects    []LeakSuspect `json:"suspects"`
+	Note        string        `json:"note,omitempty"`
+}
+
+// Warnings describes the suspects, one line each
+func (r LeakReport) Warnings() []string {
+	var out []string
+	for _, s := range r.Suspects {
+		out = append(out, fmt.Sprintf("possible leak: %s grew %d bytes (%.0f/min) over %s",
+			s.Site, s.Growth, s.BytesPerMin, time.Duration(r.DurationMs*float64(time.Millisecond)).Round(time.Second)))
+	}
+	return out
+}
+
+// DetectLeaks diffs consecutive heap samples per allocation site. Sites
+// that grow steadily while the run goes on are suspects; a one-off jump, or
+// growth a later sample gives back, is not.
+func DetectLeaks(samples []HeapSample, opts LeakOptions) LeakReport {
+	r := LeakReport{Samples: len(samples), Suspects: []LeakSuspect{}}
+	if len(samples) == 0 {
+		r.Note = "no heap samples"
+		return r
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	r.DurationMs = last.AtMs - first.AtMs
+	r.FirstInuse, r.LastInuse = first.Inuse, last.Inuse
+	grew := 0
+	for i, s := range samples {
+		r.PeakInuse = max(r.PeakInuse, s.Inuse)
+		if i > 0 && s.Inuse > samples[i-1].Inuse {
+			grew++
+		}
+	}
+	if len(samples) > 1 {
+		r.InuseGrowth = float64(grew) / float64(len(samples)-1)
+	}
+	if len(samples) < max(opts.MinSamples, 2) {
+		r.Note = fmt.Sprintf("%d heap samples are too few to tell growth from noise; run longer or sample more often", len(samples))
+		return r
+	}
+
+	sites := make(map[string]bool)
+	for _, s := range samples {
+		for site := range s.Sites {
+			sites[site] = true
+		}
+	}
+	for site := range sites {
+		series := make([]int64, len(samples))
+		for i, s := range samples {
+			series[i] = s.Sites[site].Bytes
+		}
+		growth := series[len(series)-1] - series[0]
+		if growth < opts.MinGrowth {
+			continue
+		}
+		up := 0
+		for i := 1; i < len(series); i++ {
+			if series[i] > series[i-1] {
+				up++
+			}
+		}
+		share := float64(up) / float64(len(series)-1)
+		if share < opts.GrowthShare {
+			continue
+		}
+		r.Suspects = append(r.Suspects, LeakSuspect{
+			Site:         site,
+			FirstBytes:   series[0],
+			LastBytes:    series[len(series)-1],
+			Growth:       growth,
+			BytesPerMin:  slope(samples, series) * 60000,
+			GrowthShare:  share,
+			LastObjects:  last.Sites[site].Objects,
+			ObjectGrowth: last.Sites[site].Objects - first.Sites[site].Objects,
+		})
+	}
+	sort.Slice(r.Suspects, func(i, j int) bool {
+		if r.Suspects[i].Growth != r.Suspects[j].Growth {
+			return r.Suspects[i].Growth > r.Suspects[j].Growth
+		}
+		return r.Suspects[i].Site < r.Suspects[j].Site
+	})
+	return r
+}
+
+// slope fits bytes per millisecond over the samples' times
+func slope(samples []HeapSample, bytes []int64) float64 {
+	times := make([]float64, len(samples))
+	for i, s := range samples {
+		times[i] = s.AtMs
+	}
+	return fitSlope(times, bytes)
+}
+
+// fitSlope is the least-squares slope of values over times
+func fitSlope[T int64 | float64](times []float64, values []T) float64 {
+	n := float64(len(times))
+	var sx, sy, sxx, sxy float64
+	for i, x := range times {
+		y := float64(values[i])
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / d
+}
@@ -0,0 +1,80 @@
+package profiler
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func heapSeries(sites map[string][]int64) []HeapSample {
+	var n int
+	for _, s := range sites {
+		n = len(s)
+	}
+	out := make([]HeapSample, n)
+	for i := range out {
+		out[i] = HeapSample{AtMs: float64(i) * 60000, Sites: make(map[string]SiteUsage)}
+		for site, bytes := range sites {
+			out[i].Sites[site] = SiteUsage{Bytes: bytes[i], Objects: bytes[i] / 64}
+			out[i].Inuse += uint64(bytes[i])
+		}
+	}
+	return out
+}
+
+func TestDetectLeaks(t *testing.T) {
+	const mb = 1 << 20
+	samples := heapSeries(map[string][]int64{
+		"leaky":    {0, mb, 2 * mb, 3 * mb, 4 * mb, 5 * mb},
+		"steady":   {4 * mb, 4 * mb, 4 * mb, 4 * mb, 4 * mb, 4 * mb},
+		"jump":     {0, 0, 0, 8 * mb, 8 * mb, 8 * mb}, // grows once, then holds
+		"sawtooth": {0, 2 * mb, 0, 2 * mb, 0, 2 * mb}, // gives it back
+		"small":    {0, 1, 2, 3, 4, 5},
+	})
+	r := DetectLeaks(samples, DefaultLeakOptions())
+	if len(r.Suspects) != 1 || r.Suspects[0].Site != "leaky" {
+		t.Fatalf("suspects = %+v", r.Suspects)
+	}
+	s := r.Suspects[0]
+	if s.Growth != 5*mb || s.GrowthShare != 1 || !near(s.BytesPerMin, mb) || s.ObjectGrowth != 5*mb/64 {
+		t.Errorf("suspect = %+v", s)
+	}
+	if r.Samples != 6 || !near(r.DurationMs, 300000) || r.PeakInuse != r.LastInuse || r.Note != "" {
+		t.Errorf("report = %+v", r)
+	}
+	if w := r.Warnings(); len(w) != 1 || !strings.Contains(w[0], "leaky grew 5242880 bytes") || !strings.Contains(w[0], "5m0s") {
+		t.Errorf("warnings = %q", w)
+	}
+
+	if r := DetectLeaks(samples[:3], DefaultLeakOptions()); len(r.Suspects) != 0 || r.Note == "" {
+		t.Errorf("three samples: %+v", r)
+	}
+	if r := DetectLeaks(nil, DefaultLeakOptions()); r.Note == "" {
+		t.Error("no note without samples")
+	}
+}
+
+var retained [][]byte
+
+func TestHeapWatchFindsGrowingSite(t *testing.T) {
+	// record every allocation rather than a sample, so growth is exact
+	defer func(rate int) { runtime.MemProfileRate = rate }(runtime.MemProfileRate)
+	runtime.MemProfileRate = 1
+	w := StartHeapWatch(time.Hour)
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 64; j++ {
+			retained = append(retained, make([]byte, 16<<10))
+		}
+		w.sample()
+	}
+	samples := w.Stop()
+	defer func() { retained = nil }()
+	if len(samples) != 7 {
+		t.Fatalf("%d samples, want 7", len(samples))
+	}
+	r := DetectLeaks(samples, LeakOptions{MinGrowth: 4 << 20, GrowthShare: 0.8, MinSamples: 5})
+	if len(r.Suspects) == 0 || !strings.Contains(r.Suspects[0].Site, "TestHeapWatchFindsGrowingSite") {
+		t.Fatalf("suspects = %+v", r.Suspects)
+	}
+}
@@ -0,0 +1,79 @@
+package profiler
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Marker annotates a run: a moment from Mark, or a span from Region
+type Marker struct {
+	Name string        `json:"name"`
+	At   time.Time     `json:"at"`
+	Dur  time.Duration `json:"dur,omitempty"` // a region's length; a mark has none
+}
+
+// markerLimit is how many recent markers are kept for timelines and
+// sessions to pick up; older ones are only counted
+const markerLimit = 10000
+
+// TrackMarkers is the timeline track regions are drawn on; marks cross
+// every track
+const TrackMarkers = "markers"
+
+var markers struct {
+	mu     sync.Mutex
+	recent []Marker
+	counts map[string]uint64
+}
+
+// Mark notes that something happened now, such as "wave spawn", on the
+// timelines, dashboards and session reports of the process
+func Mark(name string) {
+	addMarker(Marker{Name: name, At: time.Now()})
+}
+
+// Region notes a span of work, such as "level load", from now until the
+// result is called
+func Region(name string) func() {
+	begin := time.Now()
+	return func() { addMarker(Marker{Name: name, At: begin, Dur: time.Since(begin)}) }
+}
+
+func addMarker(m Marker) {
+	markers.mu.Lock()
+	defer markers.mu.Unlock()
+	if len(markers.recent) == markerLimit {
+		markers.recent = append(markers.recent[:0], markers.recent[markerLimit/2:]...)
+	}
+	markers.recent = append(markers.recent, m)
+	if markers.counts == nil {
+		markers.counts = make(map[string]uint64)
+	}
+	markers.counts[m.Name]++
+}
+
+// Markers returns the markers recorded from from up to to, by time
+func Markers(from, to time.Time) []Marker {
+	markers.mu.Lock()
+	var out []Marker
+	for _, m := range markers.recent {
+		if !m.At.Before(from) && !m.At.After(to) {
+			out = append(out, m)
+		}
+	}
+	markers.mu.Unlock()
+	sort.SliceStable(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+// markerCounts is how many of each marker the process recorded
+func markerCounts() map[string]uint64 {
+	markers.mu.Lock()
+	defer markers.mu.Unlock()
+	out := make(map[string]uint64, len(markers.counts))
+	for name, n := range markers.counts {
+		out[name] = n
+	}
+	return out
+}
@@ -0,0 +1,206 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// traceStartKey is the otherData field holding when a trace's clock
+// started, in Unix microseconds on the recording process's clock
+const traceStartKey = "startUnixMicros"
+
+// ChromeTrace is a trace event file read back for merging
+type ChromeTrace struct {
+	Title       string
+	StartMicros int64 // Unix microseconds its ts count from; 0 if it didn't record them
+	Events      []chromeEvent
+}
+
+// ReadChromeTrace reads a trace event file in the object form the
+// profiler writes, or a bare event array
+func ReadChromeTrace(r io.Reader) (*ChromeTrace, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		TraceEvents []chromeEvent  `json:"traceEvents"`
+		OtherData   map[string]any `json:"otherData"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		if err := json.Unmarshal(data, &file.TraceEvents); err != nil {
+			return nil, fmt.Errorf("not a trace event file: %w", err)
+		}
+	}
+	t := &ChromeTrace{Events: file.TraceEvents}
+	if title, ok := file.OtherData["title"].(string); ok {
+		t.Title = title
+	}
+	if start, ok := file.OtherData[traceStartKey].(float64); ok {
+		t.StartMicros = int64(start)
+	}
+	return t, nil
+}
+
+// Handshake is one clock exchange between a client and a server, each
+// time in Unix milliseconds as that side's own clock read it, as the
+// client logs its connection handshakes one JSON object per line
+type Handshake struct {
+	ClientSend    float64 `json:"clientSend"`
+	ServerReceive float64 `json:"serverReceive"`
+	ServerSend    float64 `json:"serverSend"`
+	ClientReceive float64 `json:"clientReceive"`
+}
+
+// rtt is the exchange's round trip, less the server's turnaround
+func (h Handshake) rtt() float64 {
+	return (h.ClientReceive - h.ClientSend) - (h.ServerSend - h.ServerReceive)
+}
+
+// offset is how far the server's clock is ahead of the client's, if the
+// two legs took as long
+func (h Handshake) offset() float64 {
+	return ((h.ServerReceive - h.ClientSend) + (h.ServerSend - h.ClientReceive)) / 2
+}
+
+// ReadHandshakes reads JSON-lines handshakes; blank lines are skipped
+func ReadHandshakes(r io.Reader) ([]Handshake, error) {
+	var out []Handshake
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var h Handshake
+		if err := json.Unmarshal(sc.Bytes(), &h); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if h.ClientReceive < h.ClientSend || h.ServerSend < h.ServerReceive {
+			return nil, fmt.Errorf("line %d: a reply before its request", line)
+		}
+		if h.rtt() < 0 {
+			return nil, fmt.Errorf("line %d: the server took longer than the round trip", line)
+		}
+		out = append(out, h)
+	}
+	return out, sc.Err()
+}
+
+// ClockOffset is how far one process's clock runs ahead of another's
+type ClockOffset struct {
+	OffsetMs      float64 `json:"offsetMs"`      // add to the reference's times to get the other's
+	UncertaintyMs float64 `json:"uncertaintyMs"` // half the fastest round trip; the offset is within it
+	RTTMs         float64 `json:"rttMs"`         // the fastest round trip
+	Handshakes    int     `json:"handshakes"`
+	Used          int     `json:"used"` // the fastest of them, which the offset is the median of
+}
+
+// EstimateClockOffset estimates the server's clock offset from the
+// client's. A handshake's legs are assumed to take equally long, so the
+// error of each estimate is at most half its round trip; the quarter of
+// handshakes with the fastest round trips, where queueing skewed the legs
+// least, give the estimate as their median.
+func EstimateClockOffset(handshakes []Handshake) (ClockOffset, error) {
+	if len(handshakes) == 0 {
+		return ClockOffset{}, fmt.Errorf("no handshakes to estimate a clock offset from")
+	}
+	sorted := slices.Clone(handshakes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].rtt() < sorted[j].rtt() })
+	used := sorted[:max(1, len(sorted)/4)]
+	offsets := make([]float64, len(used))
+	for i, h := range used {
+		offsets[i] = h.offset()
+	}
+	slices.Sort(offsets)
+	return ClockOffset{
+		OffsetMs:      stats.Quantile(offsets, 0.5),
+		UncertaintyMs: sorted[0].rtt() / 2,
+		RTTMs:         sorted[0].rtt(),
+		Handshakes:    len(handshakes),
+		Used:          len(used),
+	}, nil
+}
+
+// MergeInput is one process's trace for a merge, with its clock's offset
+// from the reference trace's
+type MergeInput struct {
+	Name   string // the process's name in the merged trace; the trace's title if empty
+	Trace  *ChromeTrace
+	Offset ClockOffset // zero for the reference
+}
+
+// MergeTraces writes the traces as one, each process's tracks under a
+// process of its own and every timestamp moved onto the first input's
+// clock. Each trace must have recorded when its clock started.
+func MergeTraces(w io.Writer, inputs []MergeInput) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("no traces to merge")
+	}
+	for i, in := range inputs {
+		if in.Trace.StartMicros == 0 {
+			return fmt.Errorf("trace %d (%s) has no clock start to line it up by", i+1, mergeName(in))
+		}
+	}
+	base := inputs[0].Trace.StartMicros
+	var out []chromeEvent
+	var offsets []map[string]any
+	for i, in := range inputs {
+		pid := i + 1
+		// the trace's zero on its own clock, then on the reference's
+		shift := float64(in.Trace.StartMicros-base) - in.Offset.OffsetMs*1000
+		out = append(out, chromeEvent{Name: "process_name", Phase: "M", PID: pid, Args: map[string]any{"name": mergeName(in)}},
+			chromeEvent{Name: "process_sort_index", Phase: "M", PID: pid, Args: map[string]any{"sort_index": i}})
+		for _, e := range in.Trace.Events {
+			if e.Phase == "M" && e.Name == "process_name" {
+				continue
+			}
+			e.PID = pid
+			if e.Phase != "M" {
+				e.TS += shift
+			}
+			out = append(out, e)
+		}
+		offsets = append(offsets, map[string]any{"process": mergeName(in), "offsetMs": in.Offset.OffsetMs,
+			"uncertaintyMs": in.Offset.UncertaintyMs})
+	}
+	// a viewer shows everything after the earliest event; keep the times
+	// positive for those that don't
+	earliest := 0.0
+	for _, e := range out {
+		if e.Phase != "M" {
+			earliest = math.Min(earliest, e.TS)
+		}
+	}
+	for i := range out {
+		if out[i].Phase != "M" {
+			out[i].TS -= earliest
+		}
+	}
+	enc := json.NewEncoder(w)
+	return enc.Encode(map[string]any{
+		"traceEvents":     out,
+		"displayTimeUnit": "ms",
+		"otherData": map[string]any{"exporter": "supertetris profiler", "title": "merged " + mergeName(inputs[0]),
+			traceStartKey: base + int64(earliest), "clockOffsets": offsets},
+	})
+}
+
+func mergeName(in MergeInput) string {
+	if in.Name != "" {
+		return in.Name
+	}
+	if in.Trace.Title != "" {
+		return in.Trace.Title
+	}
+	return "process"
+}
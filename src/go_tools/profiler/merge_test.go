@@ -0,0 +1,97 @@
+package profiler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateClockOffset(t *testing.T) {
+	// the server's clock runs 250ms ahead; the legs are 5ms each way,
+	// except where queueing held up one of them
+	var hs []Handshake
+	for i, extra := range []float64{0, 40, 0, 0, 90, 0, 15, 0} {
+		send := 1000.0 * float64(i)
+		out, back := 5.0, 5.0
+		if i%2 == 0 {
+			out += extra
+		} else {
+			back += extra
+		}
+		hs = append(hs, Handshake{ClientSend: send, ServerReceive: send + out + 250, ServerSend: send + out + 251, ClientReceive: send + out + back + 1})
+	}
+	got, err := EstimateClockOffset(hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(got.OffsetMs, 250) || !near(got.RTTMs, 10) || !near(got.UncertaintyMs, 5) || got.Handshakes != 8 || got.Used != 2 {
+		t.Errorf("offset = %+v", got)
+	}
+	if _, err := EstimateClockOffset(nil); err == nil {
+		t.Error("offset without handshakes")
+	}
+
+	if _, err := ReadHandshakes(strings.NewReader(`{"clientSend":10,"serverReceive":5,"serverSend":20,"clientReceive":12}`)); err == nil {
+		t.Error("server turnaround longer than the round trip accepted")
+	}
+	read, err := ReadHandshakes(strings.NewReader(`{"clientSend":1,"serverReceive":2,"serverSend":3,"clientReceive":4}` + "\n\n"))
+	if err != nil || len(read) != 1 || read[0].ClientReceive != 4 {
+		t.Errorf("read %+v, %v", read, err)
+	}
+}
+
+func TestMergeTracesLinesUpClocks(t *testing.T) {
+	began := time.UnixMilli(1_700_000_000_000)
+	var client, server bytes.Buffer
+	// the client sends at 100ms into its trace; the server, whose clock is
+	// 250ms ahead and whose trace began 50ms before the client's, receives
+	// 5ms later
+	if err := writeChromeTrace(&client, nil, []TraceEvent{{Track: TrackNetwork, Name: "send input", Start: 100 * time.Millisecond, Dur: time.Millisecond}}, "client", began); err != nil {
+		t.Fatal(err)
+	}
+	serverBegan := began.Add(250*time.Millisecond - 50*time.Millisecond)
+	if err := writeChromeTrace(&server, nil, []TraceEvent{{Track: TrackNetwork, Name: "recv input", Start: 155 * time.Millisecond, Dur: time.Millisecond}}, "server", serverBegan); err != nil {
+		t.Fatal(err)
+	}
+	ct, err := ReadChromeTrace(&client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := ReadChromeTrace(&server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.StartMicros != began.UnixMicro() || ct.Title != "client" {
+		t.Fatalf("client trace = %+v", ct)
+	}
+
+	var merged bytes.Buffer
+	if err := MergeTraces(&merged, []MergeInput{{Trace: ct}, {Trace: st, Offset: ClockOffset{OffsetMs: 250}}}); err != nil {
+		t.Fatal(err)
+	}
+	mt, err := ReadChromeTrace(&merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := map[string]float64{}
+	pids := map[string]int{}
+	for _, e := range mt.Events {
+		if e.Phase == "X" {
+			at[e.Name], pids[e.Name] = e.TS, e.PID
+		}
+	}
+	if !near(at["recv input"]-at["send input"], 5000) || pids["send input"] == pids["recv input"] {
+		t.Errorf("merged events: at %v, pids %v", at, pids)
+	}
+	if mt.StartMicros != began.UnixMicro()+int64(at["send input"])-100000 {
+		t.Errorf("merged start = %d", mt.StartMicros)
+	}
+
+	var bare bytes.Buffer
+	WriteChromeTrace(&bare, nil, nil, "old")
+	old, _ := ReadChromeTrace(&bare)
+	if err := MergeTraces(&merged, []MergeInput{{Trace: ct}, {Trace: old}}); err == nil || !strings.Contains(err.Error(), "no clock start") {
+		t.Errorf("merge without a clock start: %v", err)
+	}
+}
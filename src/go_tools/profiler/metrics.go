@@ -0,0 +1,205 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metricsPrefix namespaces every exported profiler metric
+const metricsPrefix = "supertetris_profiler_"
+
+// TickBuckets are the upper bounds of the tick time histogram, in seconds,
+// around the 60 FPS frame budget
+var TickBuckets = []float64{0.001, 0.002, 0.004, 0.008, 0.0167, 0.033, 0.05, 0.1, 0.25, 1}
+
+// LiveMetrics aggregates what the profiler's collectors see, for a
+// Prometheus /metrics endpoint; runtime gauges are read at each scrape.
+// Frame collectors and network recorders feed it once published to it.
+type LiveMetrics struct {
+	mu        sync.Mutex
+	ticks     []uint64 // by bucket, not cumulative; the last is +Inf
+	tickCount uint64
+	tickSum   float64 // seconds
+	messages  map[messageKey]uint64
+	bytes     map[messageKey]uint64
+	started   time.Time
+
+	// what budgets are checked against, since the last check
+	window budgetWindow
+}
+
+type messageKey struct{ typ, dir string }
+
+// NewLiveMetrics starts an empty set of metrics
+func NewLiveMetrics() *LiveMetrics {
+	return &LiveMetrics{
+		ticks:    make([]uint64, len(TickBuckets)+1),
+		messages: make(map[messageKey]uint64),
+		bytes:    make(map[messageKey]uint64),
+		started:  time.Now(),
+	}
+}
+
+// ObserveTick adds a frame or simulation tick of duration d
+func (m *LiveMetrics) ObserveTick(d time.Duration) {
+	if m == nil {
+		return
+	}
+	s := d.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ticks[sort.SearchFloat64s(TickBuckets, s)]++
+	m.tickCount++
+	m.tickSum += s
+	m.window.peakTick = max(m.window.peakTick, d)
+}
+
+// ObserveMessage counts a message of msgType in direction dir
+func (m *LiveMetrics) ObserveMessage(msgType, dir string, bytes int) {
+	if m == nil {
+		return
+	}
+	k := messageKey{msgType, dir}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages[k]++
+	m.bytes[k] += uint64(bytes)
+	m.window.bytes += uint64(bytes)
+}
+
+// observeConn counts conn as a player for the bandwidth budget
+func (m *LiveMetrics) observeConn(conn string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.window.conns == nil {
+		m.window.conns = make(map[string]bool)
+	}
+	m.window.conns[conn] = true
+}
+
+// Publish feeds the collector's later frames to m
+func (c *FrameCollector) Publish(m *LiveMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.live = m
+}
+
+// Publish feeds the recorder's later messages to m
+func (r *NetworkRecorder) Publish(m *LiveMetrics) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.live = m
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *LiveMetrics) WriteTo(w io.Writer) (int64, error) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	goroutines := runtime.NumGoroutine()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cw := &countingWriter{w: w}
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(cw, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, kind)
+	}
+
+	metric("tick_seconds", "histogram", "Frame and simulation tick durations.")
+	cumulative := uint64(0)
+	for i, le := range TickBuckets {
+		cumulative += m.ticks[i]
+		fmt.Fprintf(cw, "%stick_seconds_bucket{le=%q} %d\n", metricsPrefix, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(cw, "%stick_seconds_bucket{le=\"+Inf\"} %d\n", metricsPrefix, m.tickCount)
+	fmt.Fprintf(cw, "%stick_seconds_sum %g\n", metricsPrefix, m.tickSum)
+	fmt.Fprintf(cw, "%stick_seconds_count %d\n", metricsPrefix, m.tickCount)
+
+	metric("heap_inuse_bytes", "gauge", "Bytes in in-use heap spans.")
+	fmt.Fprintf(cw, "%sheap_inuse_bytes %d\n", metricsPrefix, ms.HeapInuse)
+	metric("heap_alloc_bytes", "gauge", "Bytes of allocated heap objects, live and not yet collected.")
+	fmt.Fprintf(cw, "%sheap_alloc_bytes %d\n", metricsPrefix, ms.HeapAlloc)
+	metric("heap_objects", "gauge", "Allocated heap objects.")
+	fmt.Fprintf(cw, "%sheap_objects %d\n", metricsPrefix, ms.HeapObjects)
+	metric("sys_bytes", "gauge", "Bytes obtained from the OS.")
+	fmt.Fprintf(cw, "%ssys_bytes %d\n", metricsPrefix, ms.Sys)
+	metric("gc_cycles_total", "counter", "Completed garbage collections.")
+	fmt.Fprintf(cw, "%sgc_cycles_total %d\n", metricsPrefix, ms.NumGC)
+	metric("gc_pause_seconds_total", "counter", "Time the world was stopped for garbage collection.")
+	fmt.Fprintf(cw, "%sgc_pause_seconds_total %g\n", metricsPrefix, float64(ms.PauseTotalNs)/1e9)
+	metric("goroutines", "gauge", "Goroutines that exist.")
+	fmt.Fprintf(cw, "%sgoroutines %d\n", metricsPrefix, goroutines)
+
+	keys := make([]messageKey, 0, len(m.messages))
+	for k := range m.messages {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].typ != keys[j].typ {
+			return keys[i].typ < keys[j].typ
+		}
+		return keys[i].dir < keys[j].dir
+	})
+	metric("messages_total", "counter", "Network messages, by type and direction; rate() gives message rates.")
+	for _, k := range keys {
+		fmt.Fprintf(cw, "%smessages_total{type=%q,dir=%q} %d\n", metricsPrefix, k.typ, k.dir, m.messages[k])
+	}
+	metric("message_bytes_total", "counter", "Network message bytes, by type and direction.")
+	for _, k := range keys {
+		fmt.Fprintf(cw, "%smessage_bytes_total{type=%q,dir=%q} %d\n", metricsPrefix, k.typ, k.dir, m.bytes[k])
+	}
+
+	counts := markerCounts()
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metric("markers_total", "counter", "Marks and regions the process recorded, by name.")
+	for _, name := range names {
+		fmt.Fprintf(cw, "%smarkers_total{name=%q} %d\n", metricsPrefix, name, counts[name])
+	}
+
+	metric("uptime_seconds", "gauge", "Time since the metrics started.")
+	fmt.Fprintf(cw, "%suptime_seconds %g\n", metricsPrefix, time.Since(m.started).Seconds())
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics, for mounting on /metrics
+func (m *LiveMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// countingWriter tracks what WriteTo wrote and its first error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,65 @@
+package profiler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLiveMetrics(t *testing.T) {
+	m := NewLiveMetrics()
+	frames := NewFrameCollector()
+	frames.Publish(m)
+	frames.Record(3 * time.Millisecond)
+	frames.Record(20 * time.Millisecond)
+	frames.Record(2 * time.Second)
+	net := NewNetworkRecorder()
+	net.Publish(m)
+	c := net.Conn("c")
+	c.Marshal("state", []int{1, 2, 3})
+	c.Marshal("state", []int{4})
+	c.ObserveRTT("ping", time.Millisecond)
+
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	out := string(body)
+	for _, want := range []string{
+		"# TYPE supertetris_profiler_tick_seconds histogram",
+		`supertetris_profiler_tick_seconds_bucket{le="0.002"} 0`,
+		`supertetris_profiler_tick_seconds_bucket{le="0.004"} 1`,
+		`supertetris_profiler_tick_seconds_bucket{le="0.033"} 2`,
+		`supertetris_profiler_tick_seconds_bucket{le="1"} 2`,
+		`supertetris_profiler_tick_seconds_bucket{le="+Inf"} 3`,
+		"supertetris_profiler_tick_seconds_sum 2.023",
+		"supertetris_profiler_tick_seconds_count 3",
+		`supertetris_profiler_messages_total{type="state",dir="out"} 2`,
+		`supertetris_profiler_message_bytes_total{type="state",dir="out"} 10`,
+		"supertetris_profiler_heap_inuse_bytes ",
+		"supertetris_profiler_goroutines ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+	if strings.Contains(out, `type="ping"`) {
+		t.Error("a round trip counted as a message")
+	}
+
+	resp, err = http.Post(srv.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,388 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Message directions, as seen from the capturing side
+const (
+	DirIn  = "in"
+	DirOut = "out"
+)
+
+// NetworkEvent is one message on an instrumented connection, as the game
+// servers and clients log them, one JSON object per line
+type NetworkEvent struct {
+	At          float64 `json:"at"` // milliseconds since the capture began
+	Conn        string  `json:"conn,omitempty"`
+	Type        string  `json:"type"` // message type
+	Dir         string  `json:"dir"`  // in or out
+	Bytes       int     `json:"bytes"`
+	SerializeMs float64 `json:"serializeMs,omitempty"` // encoding an out message, decoding an in one
+	RTTMs       float64 `json:"rttMs,omitempty"`       // round trip, on the reply that completed it
+}
+
+// ReadNetworkEvents reads JSON-lines network events; blank lines are
+// skipped
+func ReadNetworkEvents(r io.Reader) ([]NetworkEvent, error) {
+	var out []NetworkEvent
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var ev NetworkEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ev.Dir != DirIn && ev.Dir != DirOut {
+			return nil, fmt.Errorf("line %d: direction %q is neither in nor out", line, ev.Dir)
+		}
+		if ev.Bytes < 0 || ev.SerializeMs < 0 || ev.RTTMs < 0 {
+			return nil, fmt.Errorf("line %d: negative size or time", line)
+		}
+		out = append(out, ev)
+	}
+	return out, sc.Err()
+}
+
+// NetworkRecorder captures the messages of instrumented connections. A nil
+// recorder records nothing, so a server holds one only when
+// config.ProfileNetwork is set; its connections still encode and decode.
+type NetworkRecorder struct {
+	start    time.Time
+	mu       sync.Mutex
+	events   []NetworkEvent
+	live     *LiveMetrics
+	latency  *LatencyRecorder
+	timeline *Timeline
+}
+
+// NewNetworkRecorder starts a capture's clock
+func NewNetworkRecorder() *NetworkRecorder {
+	return &NetworkRecorder{start: time.Now()}
+}
+
+// Conn returns the instrumentation of the named connection
+func (r *NetworkRecorder) Conn(name string) *NetConn {
+	return &NetConn{rec: r, name: name}
+}
+
+// Events returns the events captured so far
+func (r *NetworkRecorder) Events() []NetworkEvent {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+func (r *NetworkRecorder) add(ev NetworkEvent, at time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ev.At = ms(at.Sub(r.start))
+	r.events = append(r.events, ev)
+	if ev.RTTMs > 0 {
+		r.latency.Observe(LatencyRTT, time.Duration(ev.RTTMs*float64(time.Millisecond)))
+	}
+	if ev.Bytes > 0 || ev.RTTMs == 0 {
+		r.live.ObserveMessage(ev.Type, ev.Dir, ev.Bytes)
+		if ev.Conn != "" {
+			r.live.observeConn(ev.Conn)
+		}
+	}
+	if ev.RTTMs == 0 {
+		name := "marshal " + ev.Type
+		if ev.Dir == DirIn {
+			name = "unmarshal " + ev.Type
+		}
+		r.timeline.Add(TrackNetwork, name, at, time.Duration(ev.SerializeMs*float64(time.Millisecond)),
+			map[string]any{"conn": ev.Conn, "bytes": ev.Bytes})
+	}
+}
+
+// Trace puts the recorder's later encoding and decoding on t's network
+// track
+func (r *NetworkRecorder) Trace(t *Timeline) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeline = t
+}
+
+// NetConn records one connection's messages as it encodes and decodes
+// them: protobuf messages, such as gamepb's, in their wire format and
+// anything else as JSON
+type NetConn struct {
+	rec  *NetworkRecorder
+	name string
+}
+
+// Marshal encodes an out message of msgType
+func (c *NetConn) Marshal(msgType string, v any) ([]byte, error) {
+	begin := time.Now()
+	var data []byte
+	var err error
+	if m, ok := v.(proto.Message); ok {
+		data, err = proto.Marshal(m)
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.rec.add(NetworkEvent{Conn: c.name, Type: msgType, Dir: DirOut, Bytes: len(data), SerializeMs: ms(time.Since(begin))}, begin)
+	return data, nil
+}
+
+// Unmarshal decodes an in message of msgType
+func (c *NetConn) Unmarshal(msgType string, data []byte, v any) error {
+	begin := time.Now()
+	var err error
+	if m, ok := v.(proto.Message); ok {
+		err = proto.Unmarshal(data, m)
+	} else {
+		err = json.Unmarshal(data, v)
+	}
+	c.rec.add(NetworkEvent{Conn: c.name, Type: msgType, Dir: DirIn, Bytes: len(data), SerializeMs: ms(time.Since(begin))}, begin)
+	return err
+}
+
+// ObserveRTT records the round trip a msgType reply completed
+func (c *NetConn) ObserveRTT(msgType string, rtt time.Duration) {
+	c.rec.add(NetworkEvent{Conn: c.name, Type: msgType, Dir: DirIn, RTTMs: ms(rtt)}, time.Now())
+}
+
+// ObserveInput records the time from a player's input arriving to the
+// state that applied it going out
+func (c *NetConn) ObserveInput(d time.Duration) {
+	if c.rec == nil {
+		return
+	}
+	c.rec.mu.Lock()
+	defer c.rec.mu.Unlock()
+	c.rec.latency.Observe(LatencyInput, d)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Distribution summarizes a set of measurements
+type Distribution struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+func distribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	return Distribution{
+		Count: len(sorted),
+		Mean:  sum / float64(len(sorted)),
+		P50:   stats.Quantile(sorted, 0.50),
+		P95:   stats.Quantile(sorted, 0.95),
+		P99:   stats.Quantile(sorted, 0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// MessageStats is the traffic of one message type
+type MessageStats struct {
+	Type        string       `json:"type"`
+	In          int          `json:"in"` // messages received
+	Out         int          `json:"out"`
+	BytesIn     int64        `json:"bytesIn"`
+	BytesOut    int64        `json:"bytesOut"`
+	Size        Distribution `json:"size"`        // bytes per message
+	SerializeMs Distribution `json:"serializeMs"` // of messages that timed it
+	RTTMs       Distribution `json:"rttMs"`
+}
+
+// NetworkReport summarizes a capture, message types by bytes moved
+type NetworkReport struct {
+	DurationMs float64        `json:"durationMs"`
+	Messages   int            `json:"messages"`
+	BytesIn    int64          `json:"bytesIn"`
+	BytesOut   int64          `json:"bytesOut"`
+	RTTMs      Distribution   `json:"rttMs"`
+	Types      []MessageStats `json:"types"`
+}
+
+// AnalyzeNetwork summarizes network events per message type. RTT-only
+// events, which carry no bytes, count toward latency but not traffic.
+func AnalyzeNetwork(events []NetworkEvent) NetworkReport {
+	type acc struct {
+		stats                  MessageStats
+		sizes, serialize, rtts []float64
+	}
+	byType := make(map[string]*acc)
+	var r NetworkReport
+	var rtts []float64
+	first, last := 0.0, 0.0
+	for i, ev := range events {
+		if i == 0 || ev.At < first {
+			first = ev.At
+		}
+		last = max(last, ev.At)
+		a := byType[ev.Type]
+		if a == nil {
+			a = &acc{stats: MessageStats{Type: ev.Type}}
+			byType[ev.Type] = a
+		}
+		if ev.RTTMs > 0 {
+			a.rtts = append(a.rtts, ev.RTTMs)
+			rtts = append(rtts, ev.RTTMs)
+		}
+		if ev.Bytes == 0 && ev.RTTMs > 0 {
+			continue
+		}
+		r.Messages++
+		if ev.Dir == DirIn {
+			a.stats.In++
+			a.stats.BytesIn += int64(ev.Bytes)
+			r.BytesIn += int64(ev.Bytes)
+		} else {
+			a.stats.Out++
+			a.stats.BytesOut += int64(ev.Bytes)
+			r.BytesOut += int64(ev.Bytes)
+		}
+		a.sizes = append(a.sizes, float64(ev.Bytes))
+		if ev.SerializeMs > 0 {
+			a.serialize = append(a.serialize, ev.SerializeMs)
+		}
+	}
+	r.DurationMs = last - first
+	r.RTTMs = distribution(rtts)
+	for _, a := range byType {
+		a.stats.Size = distribution(a.sizes)
+		a.stats.SerializeMs = distribution(a.serialize)
+		a.stats.RTTMs = distribution(a.rtts)
+		r.Types = append(r.Types, a.stats)
+	}
+	sort.Slice(r.Types, func(i, j int) bool {
+		bi, bj := r.Types[i].BytesIn+r.Types[i].BytesOut, r.Types[j].BytesIn+r.Types[j].BytesOut
+		if bi != bj {
+			return bi > bj
+		}
+		return r.Types[i].Type < r.Types[j].Type
+	})
+	return r
+}
+
+// NetworkBucket is one message type's traffic in a time bucket
+type NetworkBucket struct {
+	StartMs  float64 `json:"startMs"`
+	Type     string  `json:"type"`
+	Messages int     `json:"messages"`
+	BytesIn  int64   `json:"bytesIn"`
+	BytesOut int64   `json:"bytesOut"`
+	RTTP50Ms float64 `json:"rttP50Ms"` // 0 without round trips
+	RTTP99Ms float64 `json:"rttP99Ms"`
+}
+
+// NetworkSeries buckets the events by time from the first, one row per
+// bucket and message type seen in it, in time then type order
+func NetworkSeries(events []NetworkEvent, bucket time.Duration) []NetworkBucket {
+	if len(events) == 0 || bucket <= 0 {
+		return nil
+	}
+	width := ms(bucket)
+	first := events[0].At
+	for _, ev := range events {
+		first = min(first, ev.At)
+	}
+	type key struct {
+		bucket int
+		typ    string
+	}
+	rows := make(map[key]*NetworkBucket)
+	rtts := make(map[key][]float64)
+	for _, ev := range events {
+		k := key{int((ev.At - first) / width), ev.Type}
+		b := rows[k]
+		if b == nil {
+			b = &NetworkBucket{StartMs: first + float64(k.bucket)*width, Type: ev.Type}
+			rows[k] = b
+		}
+		if ev.RTTMs > 0 {
+			rtts[k] = append(rtts[k], ev.RTTMs)
+		}
+		if ev.Bytes == 0 && ev.RTTMs > 0 {
+			continue
+		}
+		b.Messages++
+		if ev.Dir == DirIn {
+			b.BytesIn += int64(ev.Bytes)
+		} else {
+			b.BytesOut += int64(ev.Bytes)
+		}
+	}
+	out := make([]NetworkBucket, 0, len(rows))
+	for k, b := range rows {
+		if rtt := rtts[k]; len(rtt) > 0 {
+			d := distribution(rtt)
+			b.RTTP50Ms, b.RTTP99Ms = d.P50, d.P99
+		}
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].StartMs != out[j].StartMs {
+			return out[i].StartMs < out[j].StartMs
+		}
+		return out[i].Type < out[j].Type
+	})
+	return out
+}
+
+// WriteNetworkSeries writes the series as CSV
+func WriteNetworkSeries(w io.Writer, series []NetworkBucket) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"start_ms", "type", "messages", "bytes_in", "bytes_out", "rtt_p50_ms", "rtt_p99_ms"})
+	for _, b := range series {
+		cw.Write([]string{
+			strconv.FormatFloat(b.StartMs, 'f', 3, 64),
+			b.Type,
+			strconv.Itoa(b.Messages),
+			strconv.FormatInt(b.BytesIn, 10),
+			strconv.FormatInt(b.BytesOut, 10),
+			strconv.FormatFloat(b.RTTP50Ms, 'f', 3, 64),
+			strconv.FormatFloat(b.RTTP99Ms, 'f', 3, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
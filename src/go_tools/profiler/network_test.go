@@ -0,0 +1,105 @@
+package profiler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+)
+
+const networkLog = `{"at":0,"conn":"c1","type":"state","dir":"out","bytes":400,"serializeMs":0.2}
+{"at":10,"conn":"c1","type":"input","dir":"in","bytes":40,"serializeMs":0.01}
+
+{"at":500,"conn":"c1","type":"ping","dir":"out","bytes":16}
+{"at":520,"conn":"c1","type":"ping","dir":"in","rttMs":20}
+{"at":1200,"conn":"c1","type":"state","dir":"out","bytes":600,"serializeMs":0.4}
+`
+
+func TestAnalyzeNetwork(t *testing.T) {
+	events, err := ReadNetworkEvents(strings.NewReader(networkLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := AnalyzeNetwork(events)
+	if r.Messages != 4 || r.BytesOut != 1016 || r.BytesIn != 40 || !near(r.DurationMs, 1200) {
+		t.Fatalf("report = %+v", r)
+	}
+	if len(r.Types) != 3 || r.Types[0].Type != "state" || r.Types[1].Type != "input" || r.Types[2].Type != "ping" {
+		t.Fatalf("types = %+v", r.Types)
+	}
+	state := r.Types[0]
+	if state.Out != 2 || !near(state.Size.Mean, 500) || !near(state.Size.Max, 600) || !near(state.SerializeMs.Max, 0.4) || state.RTTMs.Count != 0 {
+		t.Errorf("state = %+v", state)
+	}
+	if ping := r.Types[2]; ping.Out != 1 || ping.In != 0 || ping.RTTMs.Count != 1 || !near(ping.RTTMs.P99, 20) {
+		t.Errorf("ping = %+v", ping)
+	}
+
+	for _, bad := range []string{`{"type":"x","dir":"sideways"}`, `{"type":"x","dir":"in","bytes":-1}`, `nope`} {
+		if _, err := ReadNetworkEvents(strings.NewReader(bad)); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
+
+func TestNetworkSeries(t *testing.T) {
+	events, err := ReadNetworkEvents(strings.NewReader(networkLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteNetworkSeries(&buf, NetworkSeries(events, time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	want := `start_ms,type,messages,bytes_in,bytes_out,rtt_p50_ms,rtt_p99_ms
+0.000,input,1,40,0,0.000,0.000
+0.000,ping,1,0,16,20.000,20.000
+0.000,state,1,0,400,0.000,0.000
+1000.000,state,1,0,600,0.000,0.000
+`
+	if buf.String() != want {
+		t.Errorf("series =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestNetConn(t *testing.T) {
+	rec := NewNetworkRecorder()
+	c := rec.Conn("player1")
+	data, err := c.Marshal("state", map[string]int{"score": 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]int
+	if err := c.Unmarshal("state", data, &v); err != nil || v["score"] != 12 {
+		t.Fatalf("round trip = %v, %v", v, err)
+	}
+	c.ObserveRTT("ping", 15*time.Millisecond)
+	events := rec.Events()
+	if len(events) != 3 || events[0].Dir != DirOut || events[1].Dir != DirIn || events[0].Bytes != len(data) || events[0].Conn != "player1" {
+		t.Fatalf("events = %+v", events)
+	}
+	if !near(events[2].RTTMs, 15) {
+		t.Errorf("rtt = %v", events[2].RTTMs)
+	}
+
+	// game messages go in their wire format
+	in := &gamepb.Message{Session: "s", Body: &gamepb.Message_Input{Input: &gamepb.Input{Frame: 3, Action: gamepb.Action_ACTION_LEFT}}}
+	wire, _ := proto.Marshal(in)
+	if data, err := c.Marshal("input", in); err != nil || !bytes.Equal(data, wire) {
+		t.Errorf("game message = %x, %v", data, err)
+	}
+	out := &gamepb.Message{}
+	if err := c.Unmarshal("input", wire, out); err != nil || !proto.Equal(in, out) {
+		t.Errorf("game message back = %v, %v", out, err)
+	}
+
+	// without a recorder connections still encode
+	var off *NetworkRecorder
+	if data, err := off.Conn("x").Marshal("state", 1); err != nil || string(data) != "1" || off.Events() != nil {
+		t.Errorf("nil recorder: %s, %v", data, err)
+	}
+}
@@ -0,0 +1,292 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Phases of a physics step
+const (
+	PhaseCollision   = "collision"
+	PhaseIntegration = "integration"
+	PhaseSettling    = "settling" // resting blocks onto the stack
+	PhaseSpells      = "spells"   // applying spell effects
+)
+
+// PhysicsPhases lists the phases in step order
+var PhysicsPhases = []string{PhaseCollision, PhaseIntegration, PhaseSettling, PhaseSpells}
+
+// PhysicsStep is the timing of one physics step, as the game server and
+// the headless simulator log them, one JSON object per line
+type PhysicsStep struct {
+	Level  string             `json:"level"`
+	Step   int64              `json:"step"`
+	Blocks int                `json:"blocks"` // bodies in the world during the step
+	Phases map[string]float64 `json:"phases"` // milliseconds by phase
+
+	// Costs attributes parts of phases to the entities that caused them:
+	// milliseconds by phase, then by entity such as block:ice
+	Costs map[string]map[string]float64 `json:"costs,omitempty"`
+}
+
+// TotalMs is the step's time across its phases
+func (s PhysicsStep) TotalMs() float64 {
+	total := 0.0
+	for _, ms := range s.Phases {
+		total += ms
+	}
+	return total
+}
+
+// ReadPhysicsSteps reads JSON-lines physics step timings; blank lines are
+// skipped
+func ReadPhysicsSteps(r io.Reader) ([]PhysicsStep, error) {
+	var out []PhysicsStep
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var s PhysicsStep
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		for phase, ms := range s.Phases {
+			if ms < 0 {
+				return nil, fmt.Errorf("line %d: step %d %s took %vms", line, s.Step, phase, ms)
+			}
+		}
+		for phase, costs := range s.Costs {
+			for entity, ms := range costs {
+				if ms < 0 {
+					return nil, fmt.Errorf("line %d: step %d %s cost %vms of %s", line, s.Step, entity, ms, phase)
+				}
+			}
+		}
+		out = append(out, s)
+	}
+	return out, sc.Err()
+}
+
+// PhysicsRecorder times physics steps in-process. A nil recorder records
+// nothing, so a simulator holds one only when config.ProfilePhysics is set.
+type PhysicsRecorder struct {
+	level    string
+	mu       sync.Mutex
+	steps    []PhysicsStep
+	timeline *Timeline
+}
+
+// NewPhysicsRecorder records the steps of a run on level
+func NewPhysicsRecorder(level string) *PhysicsRecorder {
+	return &PhysicsRecorder{level: level}
+}
+
+// StepTimer times the phases of one step
+type StepTimer struct {
+	rec   *PhysicsRecorder
+	step  PhysicsStep
+	begin time.Time
+}
+
+// Step begins a step over blocks bodies; End records it
+func (r *PhysicsRecorder) Step(blocks int) *StepTimer {
+	if r == nil {
+		return nil
+	}
+	return &StepTimer{rec: r, step: PhysicsStep{Level: r.level, Blocks: blocks, Phases: make(map[string]float64)}, begin: time.Now()}
+}
+
+// Phase starts timing phase; calling the result stops it. A phase timed
+// more than once in a step adds up.
+func (t *StepTimer) Phase(phase string) func() {
+	if t == nil {
+		return func() {}
+	}
+	begin := time.Now()
+	return func() {
+		d := time.Since(begin)
+		t.step.Phases[phase] += float64(d) / float64(time.Millisecond)
+		t.timeline().Add(TrackPhysics, phase, begin, d, nil)
+	}
+}
+
+// End records the step
+func (t *StepTimer) End() {
+	if t == nil {
+		return
+	}
+	r := t.rec
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t.step.Step = int64(len(r.steps))
+	r.steps = append(r.steps, t.step)
+	r.timeline.Add(TrackPhysics, "step", t.begin, time.Since(t.begin), map[string]any{"level": r.level, "step": t.step.Step, "blocks": t.step.Blocks})
+}
+
+// Trace puts the recorder's later steps and phases on t's physics track
+func (r *PhysicsRecorder) Trace(t *Timeline) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeline = t
+}
+
+func (t *StepTimer) timeline() *Timeline {
+	t.rec.mu.Lock()
+	defer t.rec.mu.Unlock()
+	return t.rec.timeline
+}
+
+// Steps returns the steps recorded so far
+func (r *PhysicsRecorder) Steps() []PhysicsStep {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.steps)
+}
+
+// blockBuckets are the lower bounds of the block count buckets
+var blockBuckets = []int{0, 25, 50, 100, 200, 400}
+
+// BlockBucket names the block count bucket of n, such as "50-99"
+func BlockBucket(n int) string {
+	i := bucketIndex(n)
+	if i == len(blockBuckets)-1 {
+		return fmt.Sprintf("%d+", blockBuckets[i])
+	}
+	return fmt.Sprintf("%d-%d", blockBuckets[i], blockBuckets[i+1]-1)
+}
+
+func bucketIndex(n int) int {
+	return max(sort.SearchInts(blockBuckets, n+1)-1, 0)
+}
+
+// PhaseTiming is a phase's time per step, in milliseconds
+type PhaseTiming struct {
+	MeanMs float64 `json:"meanMs"`
+	P95Ms  float64 `json:"p95Ms"`
+	MaxMs  float64 `json:"maxMs"`
+	Share  float64 `json:"share"` // of the group's total physics time
+}
+
+// PhysicsBreakdown is where a group of steps spent their time
+type PhysicsBreakdown struct {
+	Group  string                 `json:"group"` // level name or block count bucket
+	Steps  int                    `json:"steps"`
+	Total  PhaseTiming            `json:"total"` // of whole steps; Share is 1
+	Phases map[string]PhaseTiming `json:"phases"`
+}
+
+// PhysicsReport breaks step times down per level and per block count
+// bucket, both in order: levels by name, buckets by size
+type PhysicsReport struct {
+	ByLevel  []PhysicsBreakdown `json:"byLevel"`
+	ByBlocks []PhysicsBreakdown `json:"byBlocks"`
+}
+
+// AnalyzePhysics aggregates physics step timings. Phases a step doesn't
+// report count as zero for it, so means stay per step.
+func AnalyzePhysics(steps []PhysicsStep) PhysicsReport {
+	byLevel := make(map[string][]PhysicsStep)
+	byBucket := make(map[int][]PhysicsStep)
+	for _, s := range steps {
+		byLevel[s.Level] = append(byLevel[s.Level], s)
+		i := bucketIndex(s.Blocks)
+		byBucket[i] = append(byBucket[i], s)
+	}
+	var r PhysicsReport
+	levels := make([]string, 0, len(byLevel))
+	for level := range byLevel {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	for _, level := range levels {
+		r.ByLevel = append(r.ByLevel, breakdown(level, byLevel[level]))
+	}
+	for i, lower := range blockBuckets {
+		if group := byBucket[i]; len(group) > 0 {
+			r.ByBlocks = append(r.ByBlocks, breakdown(BlockBucket(lower), group))
+		}
+	}
+	return r
+}
+
+func breakdown(name string, steps []PhysicsStep) PhysicsBreakdown {
+	b := PhysicsBreakdown{Group: name, Steps: len(steps), Phases: make(map[string]PhaseTiming)}
+	totals := make([]float64, len(steps))
+	for i, s := range steps {
+		totals[i] = s.TotalMs()
+	}
+	b.Total = timing(totals)
+	b.Total.Share = 1
+	phases := make(map[string]bool)
+	for _, s := range steps {
+		for phase := range s.Phases {
+			phases[phase] = true
+		}
+	}
+	for phase := range phases {
+		ms := make([]float64, len(steps))
+		for i, s := range steps {
+			ms[i] = s.Phases[phase]
+		}
+		t := timing(ms)
+		if b.Total.MeanMs > 0 {
+			t.Share = t.MeanMs / b.Total.MeanMs
+		}
+		b.Phases[phase] = t
+	}
+	return b
+}
+
+func timing(ms []float64) PhaseTiming {
+	sorted := slices.Clone(ms)
+	slices.Sort(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	return PhaseTiming{MeanMs: sum / float64(len(sorted)), P95Ms: stats.Quantile(sorted, 0.95), MaxMs: sorted[len(sorted)-1]}
+}
+
+// PhaseOrder lists the phases a breakdown reports, PhysicsPhases first
+// and any others after by name
+func (b PhysicsBreakdown) PhaseOrder() []string {
+	phases := make([]string, 0, len(b.Phases))
+	for phase := range b.Phases {
+		phases = append(phases, phase)
+	}
+	return orderPhases(phases)
+}
+
+func orderPhases(phases []string) []string {
+	var out, extra []string
+	for _, phase := range PhysicsPhases {
+		if slices.Contains(phases, phase) {
+			out = append(out, phase)
+		}
+	}
+	for _, phase := range phases {
+		if !slices.Contains(PhysicsPhases, phase) {
+			extra = append(extra, phase)
+		}
+	}
+	sort.Strings(extra)
+	return append(out, extra...)
+}
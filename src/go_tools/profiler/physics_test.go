@@ -0,0 +1,74 @@
+package profiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBlockBucket(t *testing.T) {
+	for n, want := range map[int]string{0: "0-24", 24: "0-24", 25: "25-49", 99: "50-99", 399: "200-399", 400: "400+", 5000: "400+", -1: "0-24"} {
+		if got := BlockBucket(n); got != want {
+			t.Errorf("BlockBucket(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestAnalyzePhysics(t *testing.T) {
+	in := `{"level":"b","step":0,"blocks":10,"phases":{"collision":3,"integration":1}}
+{"level":"a","step":0,"blocks":30,"phases":{"collision":1,"integration":1,"settling":2}}
+
+{"level":"a","step":1,"blocks":31,"phases":{"collision":3,"integration":1,"spells":4,"wind":2}}
+`
+	steps, err := ReadPhysicsSteps(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := AnalyzePhysics(steps)
+	if len(r.ByLevel) != 2 || r.ByLevel[0].Group != "a" || r.ByLevel[1].Group != "b" {
+		t.Fatalf("by level = %+v", r.ByLevel)
+	}
+	a := r.ByLevel[0]
+	if a.Steps != 2 || !near(a.Total.MeanMs, 7) || !near(a.Total.MaxMs, 10) {
+		t.Errorf("level a total = %+v", a.Total)
+	}
+	// steps without a phase count it as zero
+	if s := a.Phases[PhaseSettling]; !near(s.MeanMs, 1) || !near(s.MaxMs, 2) || !near(s.Share, 1.0/7) {
+		t.Errorf("level a settling = %+v", s)
+	}
+	if got, want := a.PhaseOrder(), []string{PhaseCollision, PhaseIntegration, PhaseSettling, PhaseSpells, "wind"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("phase order = %v, want %v", got, want)
+	}
+	if len(r.ByBlocks) != 2 || r.ByBlocks[0].Group != "0-24" || r.ByBlocks[1].Group != "25-49" || r.ByBlocks[1].Steps != 2 {
+		t.Errorf("by blocks = %+v", r.ByBlocks)
+	}
+	if _, err := ReadPhysicsSteps(strings.NewReader(`{"phases":{"collision":-1}}`)); err == nil {
+		t.Error("negative phase time accepted")
+	}
+}
+
+func TestPhysicsRecorder(t *testing.T) {
+	var off *PhysicsRecorder
+	s := off.Step(3)
+	s.Phase(PhaseCollision)()
+	s.End()
+	if off.Steps() != nil {
+		t.Error("nil recorder recorded")
+	}
+
+	rec := NewPhysicsRecorder("level1")
+	for i := 0; i < 2; i++ {
+		s := rec.Step(5 + i)
+		s.Phase(PhaseCollision)()
+		s.Phase(PhaseCollision)()
+		s.Phase(PhaseSpells)()
+		s.End()
+	}
+	steps := rec.Steps()
+	if len(steps) != 2 || steps[1].Step != 1 || steps[1].Blocks != 6 || steps[0].Level != "level1" {
+		t.Fatalf("steps = %+v", steps)
+	}
+	if len(steps[0].Phases) != 2 {
+		t.Errorf("phases = %v", steps[0].Phases)
+	}
+}
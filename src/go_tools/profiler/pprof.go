@@ -0,0 +1,465 @@
+// Package profiler captures how the tools and headless simulations spend
+// their time and memory, in formats standard tooling reads
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	httppprof "net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+// Options select which runtime profiles are captured
+type Options struct {
+	CPU    bool
+	Memory bool   // heap and allocation profiles
+	Dir    string // .pb.gz profiles are written here
+
+	// SampleInterval > 0 also samples whole goroutine stacks, written by
+	// Stop as samples-<time> in SampleFormat (json by default); a binary
+	// dump is appended to as the session runs instead. With SampleBudget,
+	// a share of one CPU, the interval adapts to keep sampling's overhead
+	// under it.
+	SampleInterval time.Duration
+	SampleFormat   string
+	SampleBudget   float64
+
+	// With Memory, HeapInterval > 0 also snapshots the heap per allocation
+	// site, and Stop writes a leaks-<time>.json report of the sites that
+	// kept growing
+	HeapInterval time.Duration
+
+	// GoroutineInterval > 0 counts goroutines by stack signature at that
+	// interval, and Stop writes a goroutines-<time>.json report of the
+	// signatures whose population kept growing, with a stack of each
+	GoroutineInterval time.Duration
+
+	// AllocInterval > 0 samples what each allocation site has allocated at
+	// that interval, counting Frames' frames as the simulation's ticks
+	// when set, and Stop writes the samples as allocticks-<time>.jsonl
+	AllocInterval time.Duration
+
+	// Contention records lock contention and blocking for the session,
+	// which Stop writes as the mutex and block profiles
+	Contention bool
+
+	// Frames, when set, has Stop write the frames it timed as
+	// frames-<time>.jsonl and the collection pauses over them as
+	// gc-<time>.jsonl, so a session carries its frame times
+	Frames *FrameCollector
+
+	// IO, when set, has Stop write the disk operations it timed as
+	// io-<time>.jsonl, and puts them on the timeline of a chrome trace
+	IO *IORecorder
+
+	// Commands, when set, has Stop write the editor commands it timed as
+	// commands-<time>.jsonl, and puts them on a chrome trace's timeline
+	Commands *CommandRecorder
+
+	// Latency, when set, has Stop write its HDR histograms as
+	// latency-<time>.json; Frames' frames are recorded to it as ticks
+	Latency *LatencyRecorder
+
+	// Timeline collects the subsystems' spans for a SampleFormat of
+	// chrome-trace, which Stop writes with the samples as one trace; Start
+	// makes one for that format when it isn't given
+	Timeline *Timeline
+}
+
+// Session is a profile capture running from Start to Stop
+type Session struct {
+	opts           Options
+	cpu            *os.File
+	sampler        *Sampler
+	stream         *sampleStream // the sampler's binary dump
+	heap           *HeapWatch
+	leaks          *LeakReport
+	gor            *GoroutineWatch
+	allocs         *AllocWatch
+	gorLeak        *GoroutineLeakReport
+	undoContention func()
+}
+
+// Start begins a capture: the CPU profile runs until Stop, which writes
+// the heap profile as it stands then
+func Start(opts Options) (*Session, error) {
+	s := &Session{opts: opts}
+	if opts.SampleFormat == FormatChromeTrace && opts.Timeline == nil {
+		s.opts.Timeline = NewTimeline()
+	}
+	if s.opts.Timeline != nil {
+		opts.IO.Trace(s.opts.Timeline)
+		opts.Commands.Trace(s.opts.Timeline)
+	}
+	if opts.Frames != nil && opts.Latency != nil {
+		opts.Frames.Latency(opts.Latency)
+	}
+	if opts.SampleInterval > 0 {
+		if opts.SampleFormat == "" {
+			s.opts.SampleFormat = FormatJSON
+		}
+		if !ValidFormat(s.opts.SampleFormat) {
+			return nil, fmt.Errorf("unknown sample format %q", opts.SampleFormat)
+		}
+		s.sampler = StartAdaptiveSampler(opts.SampleInterval, opts.SampleBudget)
+		if s.opts.SampleFormat == FormatBinary {
+			stream, err := streamSamples(opts.Dir, s.sampler, sampleFlushEvery)
+			if err != nil {
+				s.sampler.Stop()
+				return nil, err
+			}
+			s.stream = stream
+		}
+	}
+	if opts.Memory && opts.HeapInterval > 0 {
+		s.heap = StartHeapWatch(opts.HeapInterval)
+	}
+	if opts.GoroutineInterval > 0 {
+		s.gor = StartGoroutineWatch(opts.GoroutineInterval)
+	}
+	if opts.AllocInterval > 0 {
+		var ticks func() int64
+		if opts.Frames != nil {
+			ticks = opts.Frames.Count
+		}
+		s.allocs = StartAllocWatch(opts.AllocInterval, ticks)
+	}
+	if opts.Contention {
+		s.undoContention = startContention()
+	}
+	if !opts.CPU {
+		return s, nil
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(profilePath(opts.Dir, "cpu", time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		if s.stream != nil {
+			s.stream.close()
+		} else if s.sampler != nil {
+			s.sampler.Stop()
+		}
+		if s.heap != nil {
+			s.heap.Stop()
+		}
+		if s.gor != nil {
+			s.gor.Stop()
+		}
+		if s.allocs != nil {
+			s.allocs.Stop()
+		}
+		if s.undoContention != nil {
+			s.undoContention()
+		}
+		return nil, fmt.Errorf("start cpu profile: %w", err)
+	}
+	s.cpu = f
+	return s, nil
+}
+
+// Stop ends the capture and returns the profiles written
+func (s *Session) Stop() ([]string, error) {
+	var paths []string
+	if s.cpu != nil {
+		pprof.StopCPUProfile()
+		if err := s.cpu.Close(); err != nil {
+			return nil, err
+		}
+		paths = append(paths, s.cpu.Name())
+		s.cpu = nil
+	}
+	if s.stream != nil {
+		path, err := s.stream.close()
+		s.stream, s.sampler = nil, nil
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if s.sampler != nil || s.opts.SampleFormat == FormatChromeTrace {
+		samples := &Samples{Unit: "samples"}
+		if s.sampler != nil {
+			samples = s.sampler.Stop()
+		}
+		path, err := writeSamples(s.opts.Dir, samples, s.opts.SampleFormat, s.opts.Timeline)
+		s.sampler = nil
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if s.heap != nil {
+		report := DetectLeaks(s.heap.Stop(), DefaultLeakOptions())
+		s.heap, s.leaks = nil, &report
+		path, err := writeReport(s.opts.Dir, "leaks", report)
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if s.gor != nil {
+		samples, stacks := s.gor.Stop()
+		report := DetectGoroutineLeaks(samples, stacks, DefaultGoroutineLeakOptions())
+		s.gor, s.gorLeak = nil, &report
+		path, err := writeReport(s.opts.Dir, "goroutines", report)
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if s.allocs != nil {
+		path, err := writeAllocSamples(s.opts.Dir, s.allocs.Stop())
+		s.allocs = nil
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if s.opts.Frames != nil {
+		path, err := writeFrames(s.opts.Dir, s.opts.Frames.Frames())
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+		if path, err = writeGCPauses(s.opts.Dir, s.opts.Frames.GCPauses()); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if s.opts.IO != nil {
+		path, err := writeIOEvents(s.opts.Dir, s.opts.IO.Events())
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if s.opts.Commands != nil {
+		path, err := writeCommandEvents(s.opts.Dir, s.opts.Commands.Events())
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if s.opts.Latency != nil {
+		path, err := writeReport(s.opts.Dir, "latency", s.opts.Latency.Latencies())
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if s.opts.Memory {
+		path, err := WriteProfile(s.opts.Dir, "heap")
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	if s.undoContention != nil {
+		for _, name := range []string{"mutex", "block"} {
+			path, err := WriteProfile(s.opts.Dir, name)
+			if err != nil {
+				return paths, err
+			}
+			paths = append(paths, path)
+		}
+		s.undoContention()
+		s.undoContention = nil
+	}
+	return paths, nil
+}
+
+// Timeline returns the timeline of a session writing a chrome trace, for
+// the recorders and tracing to feed; nil for other formats
+func (s *Session) Timeline() *Timeline {
+	return s.opts.Timeline
+}
+
+// Leaks returns the leak report of a stopped session watching the heap
+func (s *Session) Leaks() *LeakReport {
+	return s.leaks
+}
+
+// GoroutineLeaks returns the goroutine report of a stopped session
+// counting goroutines
+func (s *Session) GoroutineLeaks() *GoroutineLeakReport {
+	return s.gorLeak
+}
+
+// WriteProfile snapshots the named runtime profile, such as heap, allocs
+// or goroutine, to dir as <name>-<time>.pb.gz and returns the path
+func WriteProfile(dir, name string) (string, error) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		return "", fmt.Errorf("unknown profile %q", name)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if name == "heap" || name == "allocs" {
+		// the heap profile is as of the last collection
+		runtime.GC()
+	}
+	path := profilePath(dir, name, time.Now())
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := p.WriteTo(f, 0); err != nil {
+		f.Close()
+		return "", fmt.Errorf("write %s profile: %w", name, err)
+	}
+	return path, f.Close()
+}
+
+// writeSamples writes sampled stacks to dir as samples-<time> in format,
+// a chrome trace with the timeline's spans
+func writeSamples(dir string, s *Samples, format string, timeline *Timeline) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	at := time.Now()
+	path := filepath.Join(dir, "samples-"+at.Format("20060102-150405.000")+Extension(format))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	title := "samples " + at.Format(time.DateTime)
+	if format == FormatChromeTrace {
+		err = writeChromeTrace(f, s, timeline.Events(), title, timeline.Began())
+	} else {
+		err = WriteSamples(f, s, format, title)
+	}
+	if err != nil {
+		f.Close()
+		return "", fmt.Errorf("write samples: %w", err)
+	}
+	return path, f.Close()
+}
+
+func writeFrames(dir string, frames []FrameTime) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "frames-"+time.Now().Format("20060102-150405.000")+".jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := WriteFrameTimes(f, frames); err != nil {
+		f.Close()
+		return "", fmt.Errorf("write frames: %w", err)
+	}
+	return path, f.Close()
+}
+
+func writeIOEvents(dir string, events []IOEvent) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "io-"+time.Now().Format("20060102-150405.000")+".jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := WriteIOEvents(f, events); err != nil {
+		f.Close()
+		return "", fmt.Errorf("write io events: %w", err)
+	}
+	return path, f.Close()
+}
+
+func writeGCPauses(dir string, pauses []GCPause) (string, error) {
+	path := filepath.Join(dir, "gc-"+time.Now().Format("20060102-150405.000")+".jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := WriteGCPauses(f, pauses); err != nil {
+		f.Close()
+		return "", fmt.Errorf("write gc pauses: %w", err)
+	}
+	return path, f.Close()
+}
+
+// writeReport writes a JSON report as <kind>-<time>.json
+func writeReport(dir, kind string, r any) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, kind+"-"+time.Now().Format("20060102-150405.000")+".json")
+	return path, os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func profilePath(dir, name string, at time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%s.pb.gz", name, at.Format("20060102-150405.000")))
+}
+
+// Handler serves net/http/pprof under /debug/pprof/ for go tool pprof,
+// limited to the profiles opts enables, and
+//
+//	POST /debug/pprof/save?profile=heap   writes a snapshot to opts.Dir
+//
+// answering with the path written
+func Handler(opts Options) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+	if opts.CPU {
+		mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+		mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+	}
+	memory := map[string]bool{"heap": true, "allocs": true}
+	contention := map[string]bool{"mutex": true, "block": true}
+	off := func(name string) string {
+		switch {
+		case memory[name] && !opts.Memory:
+			return "memory profiling is off"
+		case contention[name] && !opts.Contention:
+			return "contention profiling is off"
+		}
+		return ""
+	}
+	mux.HandleFunc("/debug/pprof/save", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		name := r.URL.Query().Get("profile")
+		if msg := off(name); msg != "" {
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+		path, err := WriteProfile(opts.Dir, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintln(w, path)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/")
+		if msg := off(name); msg != "" {
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package profiler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func isGzip(t *testing.T, path string) bool {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.HasPrefix(data, []byte{0x1f, 0x8b})
+}
+
+func TestSessionWritesProfiles(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Start(Options{CPU: true, Memory: true, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || !strings.Contains(paths[0], "cpu-") || !strings.Contains(paths[1], "heap-") {
+		t.Fatalf("profiles = %v, want cpu and heap", paths)
+	}
+	for _, p := range paths {
+		if !strings.HasSuffix(p, ".pb.gz") || !isGzip(t, p) {
+			t.Errorf("%s is not a gzipped profile", p)
+		}
+	}
+	if _, err := WriteProfile(dir, "nope"); err == nil {
+		t.Error("unknown profile written")
+	}
+}
+
+func TestHandlerHonoursOptions(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(Handler(Options{Memory: false, Dir: dir}))
+	defer srv.Close()
+
+	get := func(path string) int {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get("/debug/pprof/goroutine?debug=1"); code != http.StatusOK {
+		t.Errorf("goroutine profile: %d", code)
+	}
+	if code := get("/debug/pprof/heap"); code != http.StatusNotFound {
+		t.Errorf("heap with memory profiling off: %d, want 404", code)
+	}
+	if code := get("/debug/pprof/mutex"); code != http.StatusNotFound {
+		t.Errorf("mutex with contention profiling off: %d, want 404", code)
+	}
+
+	resp, err := http.Post(srv.URL+"/debug/pprof/save?profile=goroutine", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !isGzip(t, strings.TrimSpace(string(body))) {
+		t.Errorf("save: %s %s", resp.Status, body)
+	}
+}
@@ -0,0 +1,280 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Profile is the part of a pprof profile the diffing reads: its value
+// types and each sample's stack and values
+type Profile struct {
+	SampleTypes []ValueType
+	Samples     []ProfileSample
+	Period      int64
+}
+
+// ValueType names one of a profile's sample values, like cpu/nanoseconds
+// or alloc_space/bytes
+type ValueType struct {
+	Type, Unit string
+}
+
+// ProfileSample is one stack in a pprof profile, outermost frame first
+type ProfileSample struct {
+	Stack  []string
+	Values []int64 // one per sample type
+}
+
+// LoadProfile reads a .pb.gz profile such as Session writes
+func LoadProfile(path string) (*Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := ReadProfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// ReadProfile decodes a gzipped or plain pprof protobuf
+func ReadProfile(r io.Reader) (*Profile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(gz); err != nil {
+			return nil, err
+		}
+	}
+	return decodeProfile(data)
+}
+
+// ValueIndex is the position of the named sample type, or -1
+func (p *Profile) ValueIndex(typ string) int {
+	for i, t := range p.SampleTypes {
+		if t.Type == typ {
+			return i
+		}
+	}
+	return -1
+}
+
+// Stacks returns the samples weighted by the value at index, as the
+// profiler's sample sets, for flamegraphs and function rankings
+func (p *Profile) Stacks(index int) *Samples {
+	out := &Samples{Unit: "samples"}
+	if index < 0 || index >= len(p.SampleTypes) {
+		return out
+	}
+	out.Unit = p.SampleTypes[index].Unit
+	for _, s := range p.Samples {
+		if index < len(s.Values) && s.Values[index] != 0 {
+			out.Samples = append(out.Samples, Sample{Stack: s.Stack, Weight: s.Values[index]})
+		}
+	}
+	return out
+}
+
+// pprof's profile.proto field numbers
+const (
+	profileSampleType = 1
+	profileSample     = 2
+	profileLocation   = 4
+	profileFunction   = 5
+	profileStrings    = 6
+	profilePeriod     = 12
+
+	sampleLocation = 1
+	sampleValue    = 2
+
+	locationID   = 1
+	locationLine = 4
+	lineFunction = 1
+
+	functionID   = 1
+	functionName = 2
+)
+
+var errTruncated = errors.New("truncated profile")
+
+type rawSample struct {
+	locations []uint64
+	values    []int64
+}
+
+func decodeProfile(data []byte) (*Profile, error) {
+	var (
+		strs      []string
+		types     [][2]uint64
+		samples   []rawSample
+		locations = make(map[uint64][]uint64) // function IDs, innermost first
+		functions = make(map[uint64]uint64)   // name string index
+		period    int64
+	)
+	err := eachField(data, func(field int, v uint64, b []byte) error {
+		switch field {
+		case profileStrings:
+			strs = append(strs, string(b))
+		case profileSampleType:
+			var t [2]uint64
+			err := eachField(b, func(f int, v uint64, _ []byte) error {
+				if f == 1 || f == 2 {
+					t[f-1] = v
+				}
+				return nil
+			})
+			types = append(types, t)
+			return err
+		case profileSample:
+			var s rawSample
+			err := eachField(b, func(f int, v uint64, packed []byte) error {
+				switch f {
+				case sampleLocation:
+					return eachVarint(v, packed, func(x uint64) { s.locations = append(s.locations, x) })
+				case sampleValue:
+					return eachVarint(v, packed, func(x uint64) { s.values = append(s.values, int64(x)) })
+				}
+				return nil
+			})
+			samples = append(samples, s)
+			return err
+		case profileLocation:
+			var id uint64
+			var fns []uint64
+			err := eachField(b, func(f int, v uint64, line []byte) error {
+				switch f {
+				case locationID:
+					id = v
+				case locationLine:
+					return eachField(line, func(f int, v uint64, _ []byte) error {
+						if f == lineFunction {
+							fns = append(fns, v)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			locations[id] = fns
+			return err
+		case profileFunction:
+			var id, name uint64
+			err := eachField(b, func(f int, v uint64, _ []byte) error {
+				switch f {
+				case functionID:
+					id = v
+				case functionName:
+					name = v
+				}
+				return nil
+			})
+			functions[id] = name
+			return err
+		case profilePeriod:
+			period = int64(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	str := func(i uint64) string {
+		if i < uint64(len(strs)) {
+			return strs[i]
+		}
+		return ""
+	}
+	p := &Profile{Period: period}
+	for _, t := range types {
+		p.SampleTypes = append(p.SampleTypes, ValueType{Type: str(t[0]), Unit: str(t[1])})
+	}
+	for _, s := range samples {
+		// locations run leaf first, and a location's lines innermost first
+		var stack []string
+		for i := len(s.locations) - 1; i >= 0; i-- {
+			fns := locations[s.locations[i]]
+			for j := len(fns) - 1; j >= 0; j-- {
+				stack = append(stack, str(functions[fns[j]]))
+			}
+		}
+		p.Samples = append(p.Samples, ProfileSample{Stack: stack, Values: s.values})
+	}
+	return p, nil
+}
+
+// eachField walks a protobuf message, passing varint fields' values and
+// length-delimited fields' bytes; fixed-width fields are skipped
+func eachField(data []byte, fn func(field int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errTruncated
+		}
+		data = data[n:]
+		field := int(key >> 3)
+		var v uint64
+		var b []byte
+		switch key & 7 {
+		case 0:
+			if v, n = binary.Uvarint(data); n <= 0 {
+				return errTruncated
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return errTruncated
+			}
+			data = data[8:]
+			continue
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errTruncated
+			}
+			b, data = data[n:n+int(size)], data[n+int(size):]
+		case 5:
+			if len(data) < 4 {
+				return errTruncated
+			}
+			data = data[4:]
+			continue
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+		if err := fn(field, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachVarint handles a repeated integer field, packed or not
+func eachVarint(v uint64, packed []byte, fn func(uint64)) error {
+	if packed == nil {
+		fn(v)
+		return nil
+	}
+	for len(packed) > 0 {
+		x, n := binary.Uvarint(packed)
+		if n <= 0 {
+			return errTruncated
+		}
+		fn(x)
+		packed = packed[n:]
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package profiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReportOptions shape a session report
+type ReportOptions struct {
+	FrameBudget time.Duration // frames, GC pauses and disk operations over it are violations
+	Top         int           // hot spots and allocation sites listed
+}
+
+// DefaultReportOptions judge a 60 fps budget and list the top 20
+func DefaultReportOptions() ReportOptions {
+	return ReportOptions{FrameBudget: DefaultFrameBudget, Top: 20}
+}
+
+// Violation is one way a session missed its budgets
+type Violation struct {
+	Kind   string `json:"kind"` // frames, gc, io, commands, leak or goroutines
+	Detail string `json:"detail"`
+}
+
+// SessionReport is what a profiling session captured, summarized for a
+// person reading it rather than a diff: the manifest, the hot spots, the
+// frame times, and everything that missed a budget
+type SessionReport struct {
+	Name      string            `json:"name"`
+	Dir       string            `json:"dir"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Start     time.Time         `json:"start,omitempty"`
+	End       time.Time         `json:"end,omitempty"`
+	Generated time.Time         `json:"generated"`
+	Profiles  map[string]string `json:"profiles"`
+	Markers   []Marker          `json:"markers,omitempty"`
+
+	CPUUnit    string           `json:"cpuUnit,omitempty"`
+	CPUTotal   int64            `json:"cpuTotal,omitempty"`
+	Hotspots   []FunctionWeight `json:"hotspots,omitempty"`
+	AllocTotal int64            `json:"allocTotal,omitempty"`
+	AllocSites []FunctionWeight `json:"allocSites,omitempty"`
+
+	Frames     *FrameReport         `json:"frames,omitempty"`
+	FrameTimes []FrameTime          `json:"-"` // for the charts
+	GCPauses   []GCPause            `json:"-"`
+	GC         *GCReport            `json:"gc,omitempty"`
+	IO         *IOReport            `json:"io,omitempty"`
+	Leaks      *LeakReport          `json:"leaks,omitempty"`
+	Goroutines *GoroutineLeakReport `json:"goroutines,omitempty"`
+	Contention []ContentionReport   `json:"contention,omitempty"` // the mutex then block profile
+	AllocTicks *AllocTickReport     `json:"allocTicks,omitempty"`
+	Commands   *CommandReport       `json:"commands,omitempty"`
+	Latency    []LatencySummary     `json:"latency,omitempty"`
+
+	Violations []Violation `json:"violations"`
+}
+
+// Duration is how long the session ran, if its manifest says
+func (r *SessionReport) Duration() time.Duration {
+	if r.Start.IsZero() || r.End.IsZero() {
+		return 0
+	}
+	return r.End.Sub(r.Start)
+}
+
+// BuildSessionReport reads the session bundle or -profile directory in
+// dir, as LoadSessionProfiles does, and summarizes what it holds
+func BuildSessionReport(dir string, opts ReportOptions) (*SessionReport, error) {
+	paths, err := sessionPaths(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &SessionReport{Name: filepath.Base(dir), Dir: dir, Generated: time.Now(), Profiles: paths, Violations: []Violation{}}
+	if data, err := os.ReadFile(filepath.Join(dir, "session.json")); err == nil {
+		var a Artifact
+		if err := json.Unmarshal(data, &a); err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		r.Name, r.Labels, r.Start, r.End, r.Markers = a.Name, a.Labels, a.Start, a.End, a.Markers
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var cpu *Samples
+	if path, ok := paths["cpu"]; ok {
+		p, err := LoadProfile(path)
+		if err != nil {
+			return nil, err
+		}
+		cpu = p.Stacks(p.ValueIndex("cpu"))
+	}
+	if path, ok := paths["samples"]; ok && cpu == nil && isSampleDump(path) {
+		if cpu, err = LoadSamples(path); err != nil {
+			return nil, err
+		}
+	}
+	if cpu != nil {
+		r.CPUUnit, r.CPUTotal, r.Hotspots = cpu.Unit, cpu.Weight(), topFunctions(cpu, opts.Top)
+	}
+	if path, ok := paths["heap"]; ok {
+		p, err := LoadProfile(path)
+		if err != nil {
+			return nil, err
+		}
+		allocs := p.Stacks(p.ValueIndex("alloc_space"))
+		r.AllocTotal, r.AllocSites = allocs.Weight(), topFunctions(allocs, opts.Top)
+	}
+
+	if path, ok := paths["allocticks"]; ok {
+		samples, err := LoadAllocSamples(path)
+		if err != nil {
+			return nil, err
+		}
+		ticks := DefaultAllocTickOptions()
+		ticks.Top = opts.Top
+		report := AnalyzeAllocTicks(samples, ticks)
+		r.AllocTicks = &report
+	}
+	for _, name := range []string{"mutex", "block"} {
+		if path, ok := paths[name]; ok {
+			p, err := LoadProfile(path)
+			if err != nil {
+				return nil, err
+			}
+			r.Contention = append(r.Contention, AnalyzeContention(p, name, nil, opts.Top))
+		}
+	}
+
+	if path, ok := paths["frames"]; ok {
+		if err := readLog(path, func(f io.Reader) (err error) {
+			r.FrameTimes, err = ReadFrameTimes(f)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		report := AnalyzeFrames(r.FrameTimes, opts.FrameBudget)
+		r.Frames = &report
+		if report.OverBudget > 0 {
+			r.violate("frames", "%d of %d frames (%.1f%%) over the %s budget, %d stutters, worst %s at frame %d",
+				report.OverBudget, report.Frames, 100*float64(report.OverBudget)/float64(report.Frames), fmtMs(report.BudgetMs),
+				report.Stutters, fmtMs(report.WorstMs), report.WorstFrame)
+		}
+	}
+	if path, ok := paths["gc"]; ok {
+		if err := readLog(path, func(f io.Reader) (err error) {
+			r.GCPauses, err = ReadGCPauses(f)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		gc := AnalyzeGC(r.FrameTimes, r.GCPauses, opts.FrameBudget)
+		r.GC = &gc
+		if gc.Flagged() {
+			r.violate("gc", "%d of %d GC pauses over the %s budget, longest %s", gc.OverBudget, gc.Pauses, fmtMs(gc.BudgetMs), fmtMs(gc.MaxMs))
+		}
+		if len(gc.Spikes) > 0 {
+			r.violate("gc", "GC explains %d of %d stutters", len(gc.Spikes), gc.Stutters)
+		}
+	}
+	if path, ok := paths["io"]; ok {
+		var events []IOEvent
+		if err := readLog(path, func(f io.Reader) (err error) {
+			events, err = ReadIOEvents(f)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		report := AnalyzeIO(events, opts.FrameBudget, r.FrameTimes, opts.FrameBudget)
+		r.IO = &report
+		for _, op := range report.Ops {
+			if op.Hitches > 0 {
+				r.violate("io", "%d of %d %s operations over %s, longest %s", op.Hitches, op.Count, op.Op, fmtMs(report.HitchMs), fmtMs(op.LatencyMs.Max))
+			}
+		}
+		if len(report.Stutters) > 0 {
+			r.violate("io", "disk operations overlap %d stutters", len(report.Stutters))
+		}
+	}
+	if path, ok := paths["commands"]; ok {
+		var events []CommandEvent
+		if err := readLog(path, func(f io.Reader) (err error) {
+			events, err = ReadCommandEvents(f)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+		report := AnalyzeCommands(events, DefaultCommandStall)
+		r.Commands = &report
+		for _, c := range report.Commands {
+			if c.Stalls > 0 {
+				r.violate("commands", "%d of %d %s commands over %s, longest %s on %d blocks", c.Stalls, c.Count, c.Command,
+					fmtMs(report.StallMs), fmtMs(c.LatencyMs.Max), c.MaxBlocks)
+			}
+		}
+	}
+	if path, ok := paths["latency"]; ok {
+		l, err := LoadLatencies(path)
+		if err != nil {
+			return nil, err
+		}
+		r.Latency = l.Summaries()
+	}
+	if path, ok := paths["leaks"]; ok {
+		r.Leaks = &LeakReport{}
+		if err := readReport(path, r.Leaks); err != nil {
+			return nil, err
+		}
+		for _, w := range r.Leaks.Warnings() {
+			r.violate("leak", "%s", w)
+		}
+	}
+	if path, ok := paths["goroutines"]; ok {
+		r.Goroutines = &GoroutineLeakReport{}
+		if err := readReport(path, r.Goroutines); err != nil {
+			return nil, err
+		}
+		for _, w := range r.Goroutines.Warnings() {
+			r.violate("goroutines", "%s", w)
+		}
+	}
+	return r, nil
+}
+
+func (r *SessionReport) violate(kind, format string, args ...any) {
+	r.Violations = append(r.Violations, Violation{Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+// topFunctions is the n heaviest functions by self weight
+func topFunctions(s *Samples, n int) []FunctionWeight {
+	fns := s.Functions()
+	if n > 0 && len(fns) > n {
+		fns = fns[:n]
+	}
+	return fns
+}
+
+// readLog opens a log of the bundle for read
+func readLog(path string, read func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := read(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// readReport reads one of the bundle's JSON reports
+func readReport(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func fmtMs(v float64) string {
+	return time.Duration(v * float64(time.Millisecond)).Round(10 * time.Microsecond).String()
+}
@@ -0,0 +1,221 @@
+package profiler
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+)
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms":         fmtMs,
+	"share":      func(part, total int64) string { return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(max(total, 1))) },
+	"percent":    func(v float64) string { return fmt.Sprintf("%.1f%%", 100*v) },
+	"mib":        func(v int64) string { return fmt.Sprintf("%.1f MiB", float64(v)/(1<<20)) },
+	"mibps":      func(v float64) float64 { return v / (1 << 20) },
+	"kib":        func(v float64) float64 { return v / (1 << 10) },
+	"frameChart": frameChart,
+	"histogram":  frameHistogram,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} performance report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { padding: 4px 12px; border-bottom: 1px solid #ddd; text-align: left; }
+td.num { text-align: right; }
+td.fn { font-family: monospace; font-size: 0.9em; }
+section { margin-bottom: 2em; }
+.ok { color: #2a7a2a; }
+.violation { color: #b00; }
+</style>
+</head>
+<body>
+<h1>{{.Name}} performance report</h1>
+<section>
+<h2>Summary</h2>
+<table>
+{{if not .Start.IsZero}}<tr><th>Ran</th><td>{{.Start.Format "2006-01-02 15:04:05"}} for {{.Duration}}</td></tr>
+{{end}}{{range $k, $v := .Labels}}<tr><th>{{$k}}</th><td>{{$v}}</td></tr>
+{{end}}{{if .Frames}}<tr><th>Frames</th><td>{{.Frames.Frames}}, p50 {{ms .Frames.P50Ms}}, p95 {{ms .Frames.P95Ms}}, p99 {{ms .Frames.P99Ms}}, worst {{ms .Frames.WorstMs}}</td></tr>
+{{end}}{{if .GC}}<tr><th>GC</th><td>{{.GC.Pauses}} pauses, {{ms .GC.TotalMs}} in all, p95 {{ms .GC.P95Ms}}</td></tr>
+{{end}}{{if .CPUTotal}}<tr><th>CPU</th><td>{{.CPUTotal}} {{.CPUUnit}}</td></tr>
+{{end}}{{if .AllocTotal}}<tr><th>Allocated</th><td>{{mib .AllocTotal}}</td></tr>
+{{end}}<tr><th>Profiles</th><td>{{range $k, $v := .Profiles}}{{$k}} {{end}}</td></tr>
+<tr><th>Generated</th><td>{{.Generated.Format "2006-01-02 15:04"}}</td></tr>
+</table>
+</section>
+<section>
+<h2>Budget violations</h2>
+{{if .Violations}}<table>
+<tr><th>Kind</th><th>Detail</th></tr>
+{{range .Violations}}<tr class="violation"><td>{{.Kind}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+{{else}}<p class="ok">Every budget met.</p>
+{{end}}</section>
+{{if .Frames}}<section>
+<h2>Frame times</h2>
+{{frameChart .}}
+{{histogram .}}
+</section>
+{{end}}{{if .Latency}}<section>
+<h2>Latency</h2>
+<table>
+<tr><th>Latency</th><th>Count</th><th>p50</th><th>p90</th><th>p99</th><th>p99.9</th><th>Max</th></tr>
+{{range .Latency}}<tr><td>{{.Kind}}</td><td class="num">{{.Count}}</td><td class="num">{{ms .P50Ms}}</td><td class="num">{{ms .P90Ms}}</td><td class="num">{{ms .P99Ms}}</td><td class="num">{{ms .P999Ms}}</td><td class="num">{{ms .MaxMs}}</td></tr>
+{{end}}</table>
+</section>
+{{end}}{{if .Hotspots}}<section>
+<h2>Top hot spots</h2>
+<table>
+<tr><th>Function</th><th>Self</th><th>Total</th></tr>
+{{range .Hotspots}}<tr><td class="fn">{{.Function}}</td><td class="num">{{share .Self $.CPUTotal}}</td><td class="num">{{share .Total $.CPUTotal}}</td></tr>
+{{end}}</table>
+</section>
+{{end}}{{if .AllocSites}}<section>
+<h2>Top allocation sites</h2>
+<table>
+<tr><th>Function</th><th>Self</th><th>Total</th></tr>
+{{range .AllocSites}}<tr><td class="fn">{{.Function}}</td><td class="num">{{mib .Self}}</td><td class="num">{{mib .Total}}</td></tr>
+{{end}}</table>
+</section>
+{{end}}{{if .AllocTicks}}{{if .AllocTicks.Sites}}<section>
+<h2>Allocation per tick</h2>
+<p>{{if .AllocTicks.Ticks}}{{printf "%.0f" .AllocTicks.BytesPerTick}} bytes and {{printf "%.1f" .AllocTicks.ObjectsPerTick}} objects a tick over {{.AllocTicks.Ticks}} ticks, {{printf "%.0f" .AllocTicks.SteadyBytes}} bytes of it steady{{else}}{{.AllocTicks.Note}}{{end}}</p>
+<table>
+<tr><th>Site</th><th>Bytes/tick</th><th>Objects/tick</th><th>MiB/s</th><th>Share</th><th>Steady</th></tr>
+{{range .AllocTicks.Sites}}<tr{{if .Steady}} class="violation"{{end}}><td class="fn">{{.Site}}</td><td class="num">{{printf "%.0f" .BytesPerTick}}</td><td class="num">{{printf "%.1f" .ObjectsPerTick}}</td><td class="num">{{printf "%.2f" (mibps .BytesPerSec)}}</td><td class="num">{{percent .Share}}</td><td>{{if .Steady}}every tick{{end}}</td></tr>
+{{end}}</table>
+</section>
+{{end}}{{end}}{{if .IO}}{{if .IO.Ops}}<section>
+<h2>Disk I/O</h2>
+<table>
+<tr><th>Op</th><th>Count</th><th>Errors</th><th>p50</th><th>p95</th><th>Max</th><th>MiB/s</th><th>Hitches</th></tr>
+{{range .IO.Ops}}<tr><td>{{.Op}}</td><td class="num">{{.Count}}</td><td class="num">{{.Errors}}</td><td class="num">{{ms .LatencyMs.P50}}</td><td class="num">{{ms .LatencyMs.P95}}</td><td class="num">{{ms .LatencyMs.Max}}</td><td class="num">{{printf "%.1f" .MiBps}}</td><td class="num">{{.Hitches}}</td></tr>
+{{end}}</table>
+</section>
+{{end}}{{end}}{{if .Commands}}{{if .Commands.Commands}}<section>
+<h2>Editor commands</h2>
+<table>
+<tr><th>Command</th><th>Count</th><th>p50</th><th>p95</th><th>Max</th><th>Allocated</th><th>Per 1k blocks</th><th>Stalls</th></tr>
+{{range .Commands.Commands}}<tr{{if .Stalls}} class="violation"{{end}}><td>{{.Command}}</td><td class="num">{{.Count}}</td><td class="num">{{ms .LatencyMs.P50}}</td><td class="num">{{ms .LatencyMs.P95}}</td><td class="num">{{ms .LatencyMs.Max}}</td><td class="num">{{printf "%.1f KiB" (kib .AllocBytes)}}</td><td class="num">{{ms .MsPerKBlocks}}</td><td class="num">{{.Stalls}}</td></tr>
+{{end}}</table>
+</section>
+{{end}}{{end}}{{range .Contention}}{{if .Sites}}<section>
+<h2>Most contended locks: {{.Profile}}</h2>
+<p>{{.Contentions}} contentions, {{ms .DelayMs}} waited</p>
+<table>
+<tr><th>Site</th><th>On</th><th>Waited</th><th>Share</th><th>Count</th></tr>
+{{range .Sites}}<tr><td class="fn">{{.Site}}</td><td>{{.Kind}}</td><td class="num">{{ms .DelayMs}}</td><td class="num">{{percent .Share}}</td><td class="num">{{.Contentions}}</td></tr>
+{{end}}</table>
+</section>
+{{end}}{{end}}{{if .Markers}}<section>
+<h2>Markers</h2>
+<table>
+<tr><th>At</th><th>Name</th><th>Length</th></tr>
+{{range .Markers}}<tr><td>{{.At.Format "15:04:05.000"}}</td><td>{{.Name}}</td><td class="num">{{if .Dur}}{{.Dur}}{{end}}</td></tr>
+{{end}}</table>
+</section>
+{{end}}</body>
+</html>
+`))
+
+// reportChartPoints is how many columns the frame chart draws; longer runs
+// show each column's worst frame, so spikes aren't averaged away
+const reportChartPoints = 900
+
+// frameChart draws the frame times as an inline SVG line with the budget
+// dashed across it and GC pauses ticked under it
+func frameChart(r *SessionReport) template.HTML {
+	const width, height, pad = reportChartPoints, 220, 40
+	frames := r.FrameTimes
+	if len(frames) == 0 {
+		return ""
+	}
+	columns := min(len(frames), reportChartPoints)
+	worst := make([]float64, columns)
+	for i, f := range frames {
+		c := i * columns / len(frames)
+		worst[c] = max(worst[c], f.Ms)
+	}
+	top := max(r.Frames.WorstMs, r.Frames.BudgetMs) * 1.1
+	y := func(ms float64) float64 { return height - 10 - (height-20)*ms/top }
+	x := func(c int) float64 { return pad + float64(width-pad)*float64(c)/float64(max(columns-1, 1)) }
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-size="11">`, width+10, height)
+	fmt.Fprintf(&sb, `<text x="0" y="14">%s</text><text x="0" y="%d">0</text>`, fmtMs(top), height-8)
+	sb.WriteString(`<polyline fill="none" stroke="#4a7ebb" stroke-width="1" points="`)
+	for c, ms := range worst {
+		fmt.Fprintf(&sb, "%.1f,%.1f ", x(c), y(ms))
+	}
+	sb.WriteString(`"/>`)
+	fmt.Fprintf(&sb, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#c00" stroke-dasharray="4"/>`, pad, y(r.Frames.BudgetMs), width, y(r.Frames.BudgetMs))
+	fmt.Fprintf(&sb, `<text x="%d" y="%.1f" fill="#c00">budget %s</text>`, pad+4, y(r.Frames.BudgetMs)-3, fmtMs(r.Frames.BudgetMs))
+	if first, last := frames[0], frames[len(frames)-1]; len(r.GCPauses) > 0 && last.At > first.At {
+		span := last.At + last.Ms - first.At
+		for _, p := range r.GCPauses {
+			if p.At < first.At || p.At > first.At+span {
+				continue
+			}
+			px := pad + float64(width-pad)*(p.At-first.At)/span
+			fmt.Fprintf(&sb, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#2ca02c"/>`, px, height-8, px, height)
+		}
+	}
+	sb.WriteString(`</svg>`)
+	return template.HTML(sb.String())
+}
+
+// frameHistogram draws how many frames took each millisecond, the last
+// bar holding everything past twice the budget
+func frameHistogram(r *SessionReport) template.HTML {
+	const barWidth, height = 12, 80
+	buckets := make([]int, int(2*r.Frames.BudgetMs)+2)
+	for _, f := range r.FrameTimes {
+		buckets[min(int(f.Ms), len(buckets)-1)]++
+	}
+	most := 0
+	for _, b := range buckets {
+		most = max(most, b)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-size="10">`, len(buckets)*barWidth, height+14)
+	for i, b := range buckets {
+		if most == 0 {
+			break
+		}
+		h := float64(b*height) / float64(most)
+		color := "#4a7ebb"
+		if float64(i) >= r.Frames.BudgetMs {
+			color = "#c00"
+		}
+		fmt.Fprintf(&sb, `<rect x="%d" y="%.1f" width="%d" height="%.1f" fill="%s"><title>%d ms: %d frames</title></rect>`,
+			i*barWidth, height-h, barWidth-1, h, color, i, b)
+		if i%5 == 0 {
+			fmt.Fprintf(&sb, `<text x="%d" y="%d">%d</text>`, i*barWidth, height+12, i)
+		}
+	}
+	sb.WriteString(`</svg>`)
+	return template.HTML(sb.String())
+}
+
+// WriteHTML renders the report as a self-contained HTML page
+func (r *SessionReport) WriteHTML(w io.Writer) error {
+	return reportTemplate.Execute(w, r)
+}
+
+// SaveHTML writes the HTML report to path
+func (r *SessionReport) SaveHTML(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteHTML(f); err != nil {
+		f.Close()
+		return fmt.Errorf("render %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,74 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionReport(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var frames strings.Builder
+	for i := 0; i < 100; i++ {
+		ms := 10
+		if i == 50 {
+			ms = 90
+		}
+		fmt.Fprintf(&frames, "{\"frame\":%d,\"ms\":%d}\n", i, ms)
+	}
+	write("frames-1.jsonl", frames.String())
+	write("gc-1.jsonl", `{"at":500,"ms":40}`+"\n")
+	write("io-1.jsonl", `{"at":495,"op":"autosave","bytes":1048576,"ms":80}`+"\n"+`{"at":0,"op":"level load","bytes":10,"ms":1}`+"\n")
+	leaks, _ := json.Marshal(GoroutineLeakReport{Samples: 6, DurationMs: 60000, Suspects: []GoroutineSuspect{{Signature: "net.serve", First: 1, Last: 40}}})
+	write("goroutines-1.json", string(leaks))
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	manifest, _ := json.Marshal(Artifact{Name: "soak", Labels: map[string]string{"level": "ice"}, Start: start, End: start.Add(time.Minute),
+		Markers:  []Marker{{Name: "wave <spawn>", At: start.Add(time.Second)}},
+		Profiles: map[string]string{"frames": "frames-1.jsonl", "gc": "gc-1.jsonl", "io": "io-1.jsonl", "goroutines": "goroutines-1.json"}})
+	write("session.json", string(manifest))
+
+	r, err := BuildSessionReport(dir, DefaultReportOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "soak" || r.Duration() != time.Minute || r.Frames == nil || r.Frames.Frames != 100 || r.GC == nil || r.IO == nil {
+		t.Fatalf("report = %+v", r)
+	}
+	kinds := map[string]int{}
+	for _, v := range r.Violations {
+		kinds[v.Kind]++
+	}
+	// one slow frame; a GC pause over budget that explains it; an autosave
+	// over budget overlapping it; a goroutine suspect
+	if kinds["frames"] != 1 || kinds["gc"] != 2 || kinds["io"] != 2 || kinds["goroutines"] != 1 || len(r.Violations) != 6 {
+		t.Errorf("violations = %+v", r.Violations)
+	}
+
+	var page strings.Builder
+	if err := r.WriteHTML(&page); err != nil {
+		t.Fatal(err)
+	}
+	html := page.String()
+	for _, want := range []string{"soak performance report", "<polyline", "budget 16.67ms", "wave &lt;spawn&gt;", "autosave", "possible goroutine leak: net.serve"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+	if strings.Contains(html, "<script") || strings.Contains(html, "src=") || strings.Contains(html, "<link") {
+		t.Error("page is not self-contained")
+	}
+
+	if _, err := BuildSessionReport(t.TempDir(), DefaultReportOptions()); err != nil {
+		t.Errorf("empty directory: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sample is one observed call stack, outermost frame first
+type Sample struct {
+	Stack  []string `json:"stack"`
+	Weight int64    `json:"weight"` // times seen, or the unit's amount
+}
+
+// Samples is a captured set of stacks, the profiler's JSON sample dump
+type Samples struct {
+	Unit     string        `json:"unit"` // samples, or a unit like milliseconds
+	Interval time.Duration `json:"interval,omitempty"`
+	Samples  []Sample      `json:"samples"`
+
+	// Rates are the intervals an adaptive sampler moved through; its
+	// samples are weighted by the interval each was taken at, so weights
+	// stay comparable across changes
+	Rates []RateChange `json:"rates,omitempty"`
+}
+
+// RateChange is an adaptive sampler switching interval
+type RateChange struct {
+	At       time.Duration `json:"at"` // since sampling started
+	Interval time.Duration `json:"interval"`
+	Overhead float64       `json:"overhead"` // share of a CPU sampling took before the change
+}
+
+// LoadSamples reads a JSON or binary sample dump
+func LoadSamples(path string) (*Samples, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if head, _ := r.Peek(len(binaryMagic)); isBinarySamples(head) {
+		s, err := ReadBinarySamples(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return s, nil
+	}
+	var s Samples
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Unit == "" {
+		s.Unit = "samples"
+	}
+	return &s, nil
+}
+
+// Sampler records the stacks of the goroutines on a CPU at a fixed
+// interval, a cheap approximation of a CPU profile that keeps whole
+// stacks for flamegraphs
+type Sampler struct {
+	interval time.Duration // the base interval
+	budget   float64       // share of a CPU sampling may use; 0 fixes the interval
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu      sync.Mutex
+	counts  map[string]int64 // by stack joined with folded separators
+	current time.Duration
+	rates   []RateChange
+}
+
+// How far and how often an adaptive sampler moves its interval
+const (
+	adaptFastest  = 4  // base interval divided by this when sampling is cheap
+	adaptSlowest  = 32 // base interval times this at the most
+	adaptEvery    = 10 // samples between adjustments
+	adaptHeadroom = 4  // sample faster when overhead is under budget/adaptHeadroom
+)
+
+// StartSampler samples every interval until Stop
+func StartSampler(interval time.Duration) *Sampler {
+	return StartAdaptiveSampler(interval, 0)
+}
+
+// StartAdaptiveSampler samples from every interval, halving its rate when
+// sampling costs more than budget, a share of one CPU such as 0.01, and
+// doubling it, up to adaptFastest times the base rate, while sampling is
+// cheap, as it is when the process is idle. Stacks are weighted by the
+// microseconds of the interval that caught them.
+func StartAdaptiveSampler(interval time.Duration, budget float64) *Sampler {
+	s := &Sampler{interval: interval, budget: budget, current: interval,
+		stop: make(chan struct{}), done: make(chan struct{}), counts: make(map[string]int64)}
+	go s.run()
+	return s
+}
+
+func (s *Sampler) run() {
+	defer close(s.done)
+	start := time.Now()
+	timer := time.NewTimer(s.interval)
+	defer timer.Stop()
+	buf := make([]byte, 1<<20)
+	var cost time.Duration
+	taken, windowStart := 0, start
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-timer.C:
+		}
+		began := time.Now()
+		n := runtime.Stack(buf, true)
+		for n == len(buf) && len(buf) < 64<<20 {
+			buf = make([]byte, 2*len(buf))
+			n = runtime.Stack(buf, true)
+		}
+		stacks := parseStacks(string(buf[:n]))
+		s.mu.Lock()
+		weight := int64(1)
+		if s.budget > 0 {
+			weight = max(1, s.current.Microseconds())
+		}
+		for _, stack := range stacks {
+			s.counts[strings.Join(stack, ";")] += weight
+		}
+		s.mu.Unlock()
+		cost += time.Since(began)
+
+		if taken++; s.budget > 0 && taken == adaptEvery {
+			now := time.Now()
+			s.adapt(cost.Seconds()/now.Sub(windowStart).Seconds(), now.Sub(start))
+			cost, taken, windowStart = 0, 0, now
+		}
+		timer.Reset(s.Interval())
+	}
+}
+
+// adapt moves the interval after a window costing overhead of a CPU
+func (s *Sampler) adapt(overhead float64, at time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.current
+	switch {
+	case overhead > s.budget:
+		next = min(2*s.current, adaptSlowest*s.interval)
+	case overhead < s.budget/adaptHeadroom:
+		next = max(s.current/2, s.interval/adaptFastest)
+	}
+	if next != s.current {
+		s.current = next
+		s.rates = append(s.rates, RateChange{At: at, Interval: next, Overhead: overhead})
+	}
+}
+
+// Interval is the interval sampling runs at now
+func (s *Sampler) Interval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// Stop ends sampling and returns the stacks seen since the last Drain
+func (s *Sampler) Stop() *Samples {
+	close(s.stop)
+	<-s.done
+	return s.Drain()
+}
+
+// Drain returns the stacks and rate changes seen since the last Drain, or
+// since sampling started, and keeps sampling
+func (s *Sampler) Drain() *Samples {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := &Samples{Unit: "samples", Interval: s.interval, Rates: s.rates}
+	if s.budget > 0 {
+		out.Unit = "microseconds"
+	}
+	for stack, n := range s.counts {
+		out.Samples = append(out.Samples, Sample{Stack: strings.Split(stack, ";"), Weight: n})
+	}
+	s.counts, s.rates = make(map[string]int64), nil
+	return out
+}
+
+// parseStacks reads runtime.Stack output into the stacks of goroutines
+// running, runnable or in a system call, outermost frame first, leaving
+// out the sampler's own goroutine
+func parseStacks(dump string) [][]string {
+	var out [][]string
+	for _, block := range strings.Split(dump, "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		if len(lines) < 2 || !strings.HasPrefix(lines[0], "goroutine ") {
+			continue
+		}
+		header := lines[0]
+		if !strings.Contains(header, "[running") && !strings.Contains(header, "[runnable") && !strings.Contains(header, "[syscall") {
+			continue
+		}
+		var frames []string
+		sampler := false
+		for _, l := range lines[1:] {
+			if strings.HasPrefix(l, "\t") || strings.HasPrefix(l, "created by ") {
+				continue
+			}
+			if i := strings.LastIndex(l, "("); i > 0 {
+				l = l[:i]
+			}
+			sampler = sampler || strings.HasSuffix(l, "profiler.(*Sampler).run")
+			frames = append(frames, l)
+		}
+		if sampler || len(frames) == 0 {
+			continue
+		}
+		for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+			frames[i], frames[j] = frames[j], frames[i]
+		}
+		out = append(out, frames)
+	}
+	return out
+}
+
+// FunctionWeight is how much of a sample set one function accounts for
+type FunctionWeight struct {
+	Function string `json:"function"`
+	Self     int64  `json:"self"`  // weight of the stacks it is innermost in
+	Total    int64  `json:"total"` // weight of the stacks it is on at all
+}
+
+// Weight sums the samples' weights
+func (s *Samples) Weight() int64 {
+	var total int64
+	for _, sample := range s.Samples {
+		total += sample.Weight
+	}
+	return total
+}
+
+// Functions ranks the sampled functions by self weight, then total weight,
+// heaviest first
+func (s *Samples) Functions() []FunctionWeight {
+	byName := make(map[string]*FunctionWeight)
+	get := func(name string) *FunctionWeight {
+		f, ok := byName[name]
+		if !ok {
+			f = &FunctionWeight{Function: name}
+			byName[name] = f
+		}
+		return f
+	}
+	for _, sample := range s.Samples {
+		if len(sample.Stack) == 0 {
+			continue
+		}
+		seen := make(map[string]bool, len(sample.Stack))
+		for _, name := range sample.Stack {
+			if !seen[name] {
+				seen[name] = true
+				get(name).Total += sample.Weight
+			}
+		}
+		get(sample.Stack[len(sample.Stack)-1]).Self += sample.Weight
+	}
+	out := make([]FunctionWeight, 0, len(byName))
+	for _, f := range byName {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Self != out[j].Self {
+			return out[i].Self > out[j].Self
+		}
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		return out[i].Function < out[j].Function
+	})
+	return out
+}
@@ -0,0 +1,118 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Artifact is what a named session captured: every enabled profile kind,
+// bundled in one directory with a session.json manifest describing it
+type Artifact struct {
+	Name       string               `json:"name"`
+	Labels     map[string]string    `json:"labels,omitempty"`
+	Start      time.Time            `json:"start"`
+	End        time.Time            `json:"end"`
+	Dir        string               `json:"dir"`
+	Profiles   map[string]string    `json:"profiles"` // path by kind: cpu, heap, samples, leaks, goroutines, frames, gc or io
+	Markers    []Marker             `json:"markers,omitempty"`
+	Leaks      *LeakReport          `json:"-"`
+	Goroutines *GoroutineLeakReport `json:"-"`
+}
+
+// Duration is how long the session ran
+func (a *Artifact) Duration() time.Duration {
+	return a.End.Sub(a.Start)
+}
+
+var (
+	sessionMu   sync.Mutex
+	sessionOpts = Options{CPU: true, Memory: true, Dir: "data/profiles"}
+	running     *namedSession
+)
+
+type namedSession struct {
+	*Session
+	artifact Artifact
+}
+
+// ConfigureSessions sets the profiles later named sessions capture; their
+// bundles are written under opts.Dir
+func ConfigureSessions(opts Options) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	sessionOpts = opts
+}
+
+// StartSession begins profiling the region up to StopSession under name,
+// so a tool or test captures just the work it cares about. The labels are
+// attached to the calling goroutine, and goroutines it starts, as pprof
+// labels, so CPU samples of the region can be filtered by them. Only one
+// session runs at a time.
+func StartSession(name string, labels map[string]string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid session name %q", name)
+	}
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if running != nil {
+		return fmt.Errorf("profiling session %q already running", running.artifact.Name)
+	}
+	start := time.Now()
+	opts := sessionOpts
+	opts.Dir = filepath.Join(sessionOpts.Dir, name+"-"+start.Format("20060102-150405.000"))
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return err
+	}
+	s, err := Start(opts)
+	if err != nil {
+		os.Remove(opts.Dir)
+		return err
+	}
+	if len(labels) > 0 {
+		var kv []string
+		for k, v := range labels {
+			kv = append(kv, k, v)
+		}
+		pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels(kv...)))
+	}
+	running = &namedSession{Session: s, artifact: Artifact{Name: name, Labels: labels, Start: start, Dir: opts.Dir}}
+	return nil
+}
+
+// StopSession ends the running session, writes its manifest and returns
+// the bundle. The labels are cleared from the calling goroutine.
+func StopSession() (*Artifact, error) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if running == nil {
+		return nil, fmt.Errorf("no profiling session running")
+	}
+	s := running
+	running = nil
+	if len(s.artifact.Labels) > 0 {
+		pprof.SetGoroutineLabels(context.Background())
+	}
+	paths, err := s.Stop()
+	a := &s.artifact
+	a.End, a.Leaks, a.Profiles = time.Now(), s.Leaks(), make(map[string]string)
+	a.Goroutines, a.Markers = s.GoroutineLeaks(), Markers(a.Start, a.End)
+	for _, p := range paths {
+		kind, _, _ := strings.Cut(filepath.Base(p), "-")
+		a.Profiles[kind] = p
+	}
+	if err != nil {
+		return a, err
+	}
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return a, err
+	}
+	return a, os.WriteFile(filepath.Join(a.Dir, "session.json"), append(data, '\n'), 0644)
+}
@@ -0,0 +1,71 @@
+package profiler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNamedSessionBundlesProfiles(t *testing.T) {
+	dir := t.TempDir()
+	ConfigureSessions(Options{CPU: true, Memory: true, Dir: dir, SampleInterval: time.Millisecond})
+	defer ConfigureSessions(Options{CPU: true, Memory: true, Dir: "data/profiles"})
+
+	if err := StartSession("bad/name", nil); err == nil {
+		t.Error("session name with a separator accepted")
+	}
+	if err := StartSession("solve", map[string]string{"level": "caves"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartSession("again", nil); err == nil {
+		t.Error("second session started while one runs")
+	}
+	var goroutines strings.Builder
+	pprof.Lookup("goroutine").WriteTo(&goroutines, 1)
+	if !strings.Contains(goroutines.String(), `"level":"caves"`) {
+		t.Error("session labels not on the goroutine")
+	}
+	Mark("solver restart")
+
+	a, err := StopSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "solve" || filepath.Dir(a.Dir) != dir || !strings.HasPrefix(filepath.Base(a.Dir), "solve-") {
+		t.Errorf("artifact = %+v", a)
+	}
+	if a.Duration() <= 0 {
+		t.Errorf("duration = %v", a.Duration())
+	}
+	for _, kind := range []string{"cpu", "heap", "samples"} {
+		p, ok := a.Profiles[kind]
+		if !ok || filepath.Dir(p) != a.Dir {
+			t.Errorf("%s profile = %q, want one in %s", kind, p, a.Dir)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(a.Dir, "session.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Artifact
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Labels["level"] != "caves" || manifest.Profiles["cpu"] != a.Profiles["cpu"] ||
+		len(manifest.Markers) != 1 || manifest.Markers[0].Name != "solver restart" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+
+	goroutines.Reset()
+	pprof.Lookup("goroutine").WriteTo(&goroutines, 1)
+	if strings.Contains(goroutines.String(), `"level":"caves"`) {
+		t.Error("labels outlived the session")
+	}
+	if _, err := StopSession(); err == nil {
+		t.Error("stopped a session that wasn't running")
+	}
+}
@@ -0,0 +1,169 @@
+package profiler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// watchWindow is how many of the agent's chunks, a second apart, a live
+// view's hot spots are taken over
+const watchWindow = 10
+
+// Watcher follows a running process for profile watch: the stacks its
+// agent streams, kept whole for the session and windowed for the live
+// view, and the tick times scraped from its metrics
+type Watcher struct {
+	mu      sync.Mutex
+	start   time.Time
+	samples *Samples
+	recent  []*Samples
+	stats   RuntimeStats
+	chunks  int
+	prev    *MetricsSnapshot
+	points  []DashboardPoint
+}
+
+// NewWatcher starts a watch's clock
+func NewWatcher() *Watcher {
+	return &Watcher{start: time.Now()}
+}
+
+// Chunk takes one chunk of the agent's stream, as AttachOptions.OnChunk
+func (w *Watcher) Chunk(c AgentChunk) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats = c.Stats
+	w.chunks++
+	if c.Samples == nil {
+		return
+	}
+	w.samples = mergeSamples(w.samples, c.Samples)
+	w.recent = append(w.recent, c.Samples)
+	if len(w.recent) > watchWindow {
+		w.recent = w.recent[len(w.recent)-watchWindow:]
+	}
+}
+
+// Scrape takes one scrape of the process's metrics; the tick times are
+// the interval since the last
+func (w *Watcher) Scrape(s MetricsSnapshot) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.prev != nil {
+		w.points = append(w.points, pointBetween(*w.prev, s))
+	}
+	w.prev = &s
+}
+
+// Hotspot is one function's share of a live view's samples
+type Hotspot struct {
+	Function string  `json:"function"`
+	Self     float64 `json:"self"`
+	Total    float64 `json:"total"`
+}
+
+// WatchView is what profile watch shows at one moment
+type WatchView struct {
+	Elapsed  time.Duration   `json:"elapsed"`
+	Chunks   int             `json:"chunks"` // arrived from the agent
+	Stats    RuntimeStats    `json:"stats"`
+	Tick     *DashboardPoint `json:"tick,omitempty"` // the last scrape's interval, nil before two
+	Samples  int64           `json:"samples"`        // of the window the hot spots cover
+	Hotspots []Hotspot       `json:"hotspots"`
+}
+
+// View is the watch's latest state, with the top functions by self
+// weight over the last few seconds of samples
+func (w *Watcher) View(top int) WatchView {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	v := WatchView{Elapsed: time.Since(w.start), Chunks: w.chunks, Stats: w.stats, Hotspots: []Hotspot{}}
+	if len(w.points) > 0 {
+		p := w.points[len(w.points)-1]
+		v.Tick = &p
+	}
+	var window *Samples
+	for _, s := range w.recent {
+		window = mergeSamples(window, s)
+	}
+	if window == nil {
+		return v
+	}
+	v.Samples = window.Weight()
+	if v.Samples == 0 {
+		return v
+	}
+	for _, f := range window.Functions() {
+		if len(v.Hotspots) == top {
+			break
+		}
+		v.Hotspots = append(v.Hotspots, Hotspot{Function: f.Function,
+			Self: float64(f.Self) / float64(v.Samples), Total: float64(f.Total) / float64(v.Samples)})
+	}
+	return v
+}
+
+// Save writes what the watch saw as a session bundle under dir: the
+// stacks in format, the tick intervals as dashboard-<time>.jsonl, and the
+// session.json manifest, so report and diff read it like a local session
+func (w *Watcher) Save(dir, name, format string, labels map[string]string) (*Artifact, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid session name %q", name)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	a := &Artifact{Name: name, Labels: labels, Start: w.start, End: time.Now(), Profiles: make(map[string]string)}
+	a.Dir = filepath.Join(dir, name+"-"+w.start.Format("20060102-150405.000"))
+	if w.samples != nil {
+		path, err := writeSamples(a.Dir, w.samples, format, &Timeline{start: w.start})
+		if err != nil {
+			return nil, err
+		}
+		a.Profiles["samples"] = path
+	}
+	if len(w.points) > 0 {
+		path, err := writeDashboardPoints(a.Dir, w.points)
+		if err != nil {
+			return nil, err
+		}
+		a.Profiles["dashboard"] = path
+	}
+	if err := os.MkdirAll(a.Dir, 0755); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return a, os.WriteFile(filepath.Join(a.Dir, "session.json"), append(data, '\n'), 0644)
+}
+
+func writeDashboardPoints(dir string, points []DashboardPoint) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "dashboard-"+time.Now().Format("20060102-150405.000")+".jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	for _, p := range points {
+		if err := enc.Encode(p); err != nil {
+			f.Close()
+			return "", fmt.Errorf("write dashboard points: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return "", fmt.Errorf("write dashboard points: %w", err)
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,57 @@
+package profiler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherView(t *testing.T) {
+	w := NewWatcher()
+	// the first chunk's hot spot falls out of the window
+	w.Chunk(AgentChunk{Samples: &Samples{Unit: "samples", Samples: []Sample{{Stack: []string{"main", "load"}, Weight: 1000}}}})
+	for i := 0; i < watchWindow; i++ {
+		w.Chunk(AgentChunk{Stats: RuntimeStats{HeapInuse: 8 << 20, Goroutines: 12}, Samples: &Samples{Unit: "samples", Samples: []Sample{
+			{Stack: []string{"main", "tick", "step"}, Weight: 3},
+			{Stack: []string{"main", "tick"}, Weight: 1},
+		}}})
+	}
+	v := w.View(1)
+	if v.Chunks != watchWindow+1 || v.Samples != 4*watchWindow || v.Stats.Goroutines != 12 || v.Tick != nil {
+		t.Fatalf("view = %+v", v)
+	}
+	if len(v.Hotspots) != 1 || v.Hotspots[0].Function != "step" || !near(v.Hotspots[0].Self, 0.75) || !near(v.Hotspots[0].Total, 0.75) {
+		t.Errorf("hot spots = %+v", v.Hotspots)
+	}
+
+	at := time.Now()
+	buckets := make([]uint64, len(TickBuckets))
+	w.Scrape(MetricsSnapshot{At: at, TickBuckets: buckets})
+	after := make([]uint64, len(TickBuckets))
+	for i := range after {
+		after[i] = 60
+	}
+	w.Scrape(MetricsSnapshot{At: at.Add(time.Second), TickBuckets: after, TickCount: 60, TickSum: 0.6})
+	if tick := w.View(5).Tick; tick == nil || !near(tick.TickRate, 60) || !near(tick.TickMeanMs, 10) {
+		t.Errorf("tick = %+v", tick)
+	}
+
+	a, err := w.Save(t.TempDir(), "watch", FormatJSON, map[string]string{"target": "localhost:8090"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := LoadSamples(a.Profiles["samples"])
+	if err != nil || samples.Weight() != 1000+4*watchWindow {
+		t.Errorf("saved samples = %+v, %v", samples, err)
+	}
+	data, err := os.ReadFile(filepath.Join(a.Dir, "session.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Artifact
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.Labels["target"] != "localhost:8090" || manifest.Profiles["dashboard"] == "" {
+		t.Errorf("manifest = %s, %v", data, err)
+	}
+}
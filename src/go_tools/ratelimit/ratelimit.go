@@ -0,0 +1,246 @@
+// Package ratelimit throttles the tool servers' clients: each API token
+// and each client address gets a token bucket, refilled at a steady rate
+// up to a burst, and a request finding its bucket empty is refused 429
+// with how long to wait. A token that doesn't authenticate takes from its
+// address's token bucket instead, so made-up tokens share one. Requests
+// count alike whatever they ask for; a WebSocket counts once, as it
+// connects.
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Bucket sweeping: how often idle buckets are dropped, and how many a
+// limiter keeps before it sweeps early
+const (
+	sweepEvery = time.Minute
+	maxBuckets = 100000
+)
+
+// Rate is a bucket's refill: PerSecond requests a second, up to Burst at
+// once. A zero PerSecond is unlimited.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// burst is the bucket's size, one second's worth when Burst isn't set
+func (r Rate) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return math.Max(1, math.Ceil(r.PerSecond))
+}
+
+// Limits are a limiter's rates
+type Limits struct {
+	PerToken  Rate
+	PerIP     Rate
+	ProxyHops int           // proxies in front whose X-Forwarded-For hops are trusted; 0 trusts none
+	Keys      *auth.Keyring // tokens given buckets of their own; without one every token counts against its address
+}
+
+// Decision is a limiter's answer to a request
+type Decision struct {
+	Allowed    bool
+	Limit      int           // size of the bucket that decided
+	Remaining  int           // requests left in it
+	RetryAfter time.Duration // until the next request is allowed, when refused
+	By         string        // "token" or "address", the bucket that decided; empty when none applies
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps the buckets
+type Limiter struct {
+	limits Limits
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// New returns a limiter of the limits, or nil, which limits nothing, when
+// both rates are unlimited
+func New(limits Limits) *Limiter {
+	if limits.PerToken.PerSecond <= 0 && limits.PerIP.PerSecond <= 0 {
+		return nil
+	}
+	return &Limiter{limits: limits, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// FromConfig returns the limiter of a config's rate limit settings, keys
+// being the keyring the server checks tokens against
+func FromConfig(config utils.Config, keys *auth.Keyring) *Limiter {
+	var hops int
+	if config.RateLimitTrustProxy {
+		hops = max(1, config.RateLimitProxyHops)
+	}
+	return New(Limits{
+		PerToken:  Rate{PerSecond: config.RateLimitTokenRate, Burst: config.RateLimitTokenBurst},
+		PerIP:     Rate{PerSecond: config.RateLimitIPRate, Burst: config.RateLimitIPBurst},
+		ProxyHops: hops,
+		Keys:      keys,
+	})
+}
+
+// Allow takes a request from the address's bucket and, when the request
+// presents one, the token's, or the address's token bucket when the token
+// doesn't authenticate; a nil limiter allows everything
+func (l *Limiter) Allow(addr, token string) Decision {
+	if l == nil {
+		return Decision{Allowed: true}
+	}
+	var tokenBucket, tokenBy string
+	if token != "" && l.limits.PerToken.PerSecond > 0 {
+		tokenBucket, tokenBy = "token:ip:"+addr, "address"
+		if l.limits.Keys != nil {
+			if _, err := l.limits.Keys.Authenticate(token); err == nil {
+				tokenBucket, tokenBy = "token:"+tokenKey(token), "token"
+			}
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	d := Decision{Allowed: true}
+	if addr != "" && l.limits.PerIP.PerSecond > 0 {
+		if d = l.take("ip:"+addr, "address", l.limits.PerIP, now); !d.Allowed {
+			return d
+		}
+	}
+	if tokenBucket != "" {
+		td := l.take(tokenBucket, tokenBy, l.limits.PerToken, now)
+		if !td.Allowed || d.By == "" || td.Remaining < d.Remaining {
+			d = td
+		}
+	}
+	return d
+}
+
+// tokenKey names a token's bucket by its ID, or by a hash for strings
+// that aren't tokens, so the buckets never hold a secret
+func tokenKey(token string) string {
+	if id := auth.TokenID(token); id != "" {
+		return id
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// take refills the bucket for the time since it was last used and takes a
+// request from it
+func (l *Limiter) take(key, by string, rate Rate, now time.Time) Decision {
+	size := rate.burst()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: size, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(size, b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond)
+	b.last = now
+	d := Decision{Limit: int(size), By: by}
+	if b.tokens < 1 {
+		d.RetryAfter = time.Duration((1 - b.tokens) / rate.PerSecond * float64(time.Second))
+		return d
+	}
+	b.tokens--
+	d.Allowed, d.Remaining = true, int(b.tokens)
+	return d
+}
+
+// sweep drops the buckets idle long enough to have filled up again, which
+// are as good as new, every sweepEvery or when there are too many
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepEvery && len(l.buckets) < maxBuckets {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		rate := l.limits.PerIP
+		if strings.HasPrefix(key, "token:") {
+			rate = l.limits.PerToken
+		}
+		if b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond >= rate.burst() {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// ClientAddr is the address a request came from: its connection's, or
+// behind proxyHops trusted proxies the X-Forwarded-For hop the outermost
+// of them added. The hops left of it are the client's to write, so are
+// never taken.
+func ClientAddr(r *http.Request, proxyHops int) string {
+	if proxyHops > 0 {
+		var hops []string
+		for _, fwd := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(fwd, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+		if len(hops) > 0 {
+			return hops[max(0, len(hops)-proxyHops)]
+		}
+	}
+	return HostOf(r.RemoteAddr)
+}
+
+// HostOf is a host:port address's host
+func HostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// Middleware passes on the requests the limiter allows and answers the
+// others 429 with a Retry-After and a JSON error. Every answer carries the
+// X-RateLimit-Limit and X-RateLimit-Remaining of the bucket that decided.
+// A nil limiter checks nothing.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := l.Allow(ClientAddr(r, l.limits.ProxyHops), auth.Credential(r))
+		if d.By != "" {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		}
+		if !d.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.RetryAfter.Seconds()))))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": d.Message()})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Message describes a refusal
+func (d Decision) Message() string {
+	return fmt.Sprintf("rate limit of this %s exceeded; retry in %s", d.By, d.RetryAfter.Round(time.Millisecond))
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+)
+
+// clocked is a limiter on a clock the test moves
+func clocked(limits Limits) (*Limiter, *time.Time) {
+	l := New(limits)
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestBucketsRefillAtTheirRate(t *testing.T) {
+	l, now := clocked(Limits{PerIP: Rate{PerSecond: 2, Burst: 3}})
+	for i := 0; i < 3; i++ {
+		if d := l.Allow("10.0.0.1", ""); !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("request %d: %+v, want allowed with %d left", i+1, d, 2-i)
+		}
+	}
+	d := l.Allow("10.0.0.1", "")
+	if d.Allowed || d.By != "address" || d.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("past the burst: %+v, want refused for 500ms", d)
+	}
+	if !l.Allow("10.0.0.2", "").Allowed {
+		t.Error("another address shares the bucket")
+	}
+	*now = now.Add(500 * time.Millisecond)
+	if !l.Allow("10.0.0.1", "").Allowed {
+		t.Error("refused after the wait it was told")
+	}
+	if l.Allow("10.0.0.1", "").Allowed {
+		t.Error("half a second refilled more than one request")
+	}
+	*now = now.Add(time.Hour)
+	if d := l.Allow("10.0.0.1", ""); !d.Allowed || d.Remaining != 2 {
+		t.Errorf("after an hour: %+v, want a full bucket", d)
+	}
+}
+
+// keyring holds two tokens, which it returns
+func keyring(t *testing.T) (*auth.Keyring, string, string) {
+	one, oneToken, _ := auth.NewToken("one", []string{"*"}, 0)
+	other, otherToken, _ := auth.NewToken("other", []string{"*"}, 0)
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	if err := (auth.File{Tokens: []auth.Token{one, other}}).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys, oneToken, otherToken
+}
+
+func TestTokensHaveTheirOwnBuckets(t *testing.T) {
+	keys, token, other := keyring(t)
+	l, _ := clocked(Limits{PerToken: Rate{PerSecond: 1}, PerIP: Rate{PerSecond: 100}, Keys: keys})
+	if d := l.Allow("10.0.0.1", token); !d.Allowed || d.By != "token" {
+		t.Fatalf("first request: %+v", d)
+	}
+	// the same token from elsewhere is still the same token
+	if d := l.Allow("10.0.0.2", token); d.Allowed || d.By != "token" {
+		t.Fatalf("second request: %+v, want refused by the token", d)
+	}
+	if !l.Allow("10.0.0.2", other).Allowed {
+		t.Error("another token shares the bucket")
+	}
+	for key := range l.buckets {
+		if key == "token:"+token {
+			t.Error("a bucket is named by the token's secret")
+		}
+	}
+	// made-up tokens share their address's bucket
+	if d := l.Allow("10.0.0.3", "st_0123456789abcdef_madeup"); !d.Allowed || d.By != "address" {
+		t.Fatalf("a made-up token: %+v", d)
+	}
+	if d := l.Allow("10.0.0.3", "st_fedcba9876543210_madeup"); d.Allowed || d.By != "address" {
+		t.Errorf("another made-up token from the address: %+v, want refused by the address", d)
+	}
+	if !l.Allow("10.0.0.4", "st_fedcba9876543210_madeup").Allowed {
+		t.Error("a made-up token from another address was refused")
+	}
+	noKeys, _ := clocked(Limits{PerToken: Rate{PerSecond: 1}})
+	noKeys.Allow("10.0.0.1", token)
+	if noKeys.Allow("10.0.0.1", other).Allowed {
+		t.Error("without a keyring, tokens from one address had buckets of their own")
+	}
+	if New(Limits{}) != nil {
+		t.Error("a limiter without rates")
+	}
+	var none *Limiter
+	if !none.Allow("10.0.0.1", token).Allowed {
+		t.Error("a nil limiter refused")
+	}
+}
+
+func TestMiddlewareAnswers429(t *testing.T) {
+	l, _ := clocked(Limits{PerIP: Rate{PerSecond: 0.5, Burst: 1}, ProxyHops: 1})
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	get := func(forwarded string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/packs", nil)
+		r.RemoteAddr = "127.0.0.1:5000"
+		if forwarded != "" {
+			r.Header.Set("X-Forwarded-For", forwarded)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	if w := get("10.0.0.1, 203.0.113.9"); w.Code != http.StatusNoContent || w.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Fatalf("first request: %d %v", w.Code, w.Header())
+	}
+	// the proxy's hop is the client's, whatever it claims before it
+	w := get("10.0.0.2, 203.0.113.9")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("second request: %d %v", w.Code, w.Header())
+	}
+	if w := get("198.51.100.4"); w.Code != http.StatusNoContent {
+		t.Errorf("another client behind the proxy: %d", w.Code)
+	}
+}
+
+func TestClientAddrTakesTheTrustedHop(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	r.Header.Add("X-Forwarded-For", "198.51.100.7, 203.0.113.9")
+	r.Header.Add("X-Forwarded-For", "10.0.0.5")
+	for hops, want := range []string{"127.0.0.1", "10.0.0.5", "203.0.113.9", "198.51.100.7", "198.51.100.7"} {
+		if got := ClientAddr(r, hops); got != want {
+			t.Errorf("behind %d proxies: %s, want %s", hops, got, want)
+		}
+	}
+	r.Header.Del("X-Forwarded-For")
+	if got := ClientAddr(r, 1); got != "127.0.0.1" {
+		t.Errorf("without X-Forwarded-For: %s", got)
+	}
+}
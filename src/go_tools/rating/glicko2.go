@@ -0,0 +1,96 @@
+package rating
+
+import "math"
+
+// glicko2Scale converts between the Glicko and Glicko-2 scales
+const glicko2Scale = 173.7178
+
+// tau constrains how quickly volatility changes
+const tau = 0.5
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func glickoE(mu, muj, phij float64) float64 {
+	return 1 / (1 + math.Exp(-glickoG(phij)*(mu-muj)))
+}
+
+// glicko2Update runs one Glicko-2 rating period over the results,
+// following Glickman's "Example of the Glicko-2 system"
+func glicko2Update(r Rating, results []outcome) Rating {
+	mu := (r.Value - InitialRating) / glicko2Scale
+	phi := r.Deviation / glicko2Scale
+	sigma := r.Volatility
+
+	if len(results) == 0 {
+		phi = math.Sqrt(phi*phi + sigma*sigma)
+		r.Deviation = math.Min(phi*glicko2Scale, InitialDeviation)
+		return r
+	}
+
+	var vInv, sum float64
+	for _, o := range results {
+		muj := (o.opponent.Value - InitialRating) / glicko2Scale
+		phij := o.opponent.Deviation / glicko2Scale
+		g, e := glickoG(phij), glickoE(mu, muj, phij)
+		vInv += g * g * e * (1 - e)
+		sum += g * (o.score - e)
+	}
+	v := 1 / vInv
+	delta := v * sum
+
+	sigma = newVolatility(phi, sigma, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * sum
+
+	r.Value = mu*glicko2Scale + InitialRating
+	r.Deviation = phi * glicko2Scale
+	r.Volatility = sigma
+	return r
+}
+
+// newVolatility solves for the new volatility with the Illinois algorithm
+func newVolatility(phi, sigma, v, delta float64) float64 {
+	const epsilon = 0.000001
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+// glicko2Expected is the expected score of a against b, accounting for
+// both players' deviations
+func glicko2Expected(a, b Rating) float64 {
+	mu := (a.Value - InitialRating) / glicko2Scale
+	muj := (b.Value - InitialRating) / glicko2Scale
+	phi := math.Hypot(a.Deviation, b.Deviation) / glicko2Scale
+	return glickoE(mu, muj, phi)
+}
@@ -0,0 +1,159 @@
+package rating
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// HistoryEntry records how one match changed one player's rating
+type HistoryEntry struct {
+	Match  string `json:"match"`
+	Player string `json:"player"`
+	Before Rating `json:"before"`
+	After  Rating `json:"after"`
+}
+
+// Ledger holds every player's current rating and the history that led to
+// it; it is what the matchmaking simulator queries
+type Ledger struct {
+	System  string            `json:"system"`
+	EloK    float64           `json:"eloK,omitempty"`
+	Ratings map[string]Rating `json:"ratings"`
+	History []HistoryEntry    `json:"history"`
+}
+
+// NewLedger returns an empty ledger for the named rating system
+func NewLedger(system string, eloK float64) (*Ledger, error) {
+	switch system {
+	case SystemElo:
+		if eloK <= 0 {
+			eloK = DefaultEloK
+		}
+	case SystemGlicko2:
+		eloK = 0
+	default:
+		return nil, fmt.Errorf("unknown rating system %q", system)
+	}
+	return &Ledger{System: system, EloK: eloK, Ratings: make(map[string]Rating)}, nil
+}
+
+// Rating returns the player's current rating, or the initial one for
+// players the ledger hasn't seen
+func (l *Ledger) Rating(player string) Rating {
+	if r, ok := l.Ratings[player]; ok {
+		return r
+	}
+	return NewRating()
+}
+
+// Apply updates the ratings of everyone in the match; every player's
+// update uses the ratings from before the match
+func (l *Ledger) Apply(m Match) error {
+	if len(m.Players) < 2 {
+		return fmt.Errorf("match %s: needs at least two players", m.ID)
+	}
+	before := make(map[string]Rating, len(m.Players))
+	for _, p := range m.Players {
+		if _, dup := before[p]; dup {
+			return fmt.Errorf("match %s: player %s listed twice", m.ID, p)
+		}
+		before[p] = l.Rating(p)
+	}
+	if _, ok := before[m.Winner]; m.Winner != "" && !ok {
+		return fmt.Errorf("match %s: winner %s did not play", m.ID, m.Winner)
+	}
+
+	for _, p := range m.Players {
+		results := m.outcomes(p, before)
+		var after Rating
+		if l.System == SystemElo {
+			after = eloUpdate(before[p], results, l.EloK)
+		} else {
+			after = glicko2Update(before[p], results)
+		}
+		after.Games++
+		l.Ratings[p] = after
+		l.History = append(l.History, HistoryEntry{Match: m.ID, Player: p, Before: before[p], After: after})
+	}
+	return nil
+}
+
+// ApplyAll applies matches in chronological order
+func (l *Ledger) ApplyAll(matches []Match) error {
+	sorted := append([]Match(nil), matches...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+	for _, m := range sorted {
+		if err := l.Apply(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WinProbability returns the chance that a beats b under the ledger's system
+func (l *Ledger) WinProbability(a, b string) float64 {
+	ra, rb := l.Rating(a), l.Rating(b)
+	if l.System == SystemElo {
+		return eloExpected(ra.Value, rb.Value)
+	}
+	return glicko2Expected(ra, rb)
+}
+
+// PlayerHistory returns the rating changes of one player, oldest first
+func (l *Ledger) PlayerHistory(player string) []HistoryEntry {
+	var out []HistoryEntry
+	for _, h := range l.History {
+		if h.Player == player {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// Standing is a player's position in the leaderboard
+type Standing struct {
+	Player string `json:"player"`
+	Rating Rating `json:"rating"`
+}
+
+// Leaderboard returns every rated player, best first
+func (l *Ledger) Leaderboard() []Standing {
+	out := make([]Standing, 0, len(l.Ratings))
+	for p, r := range l.Ratings {
+		out = append(out, Standing{Player: p, Rating: r})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rating.Value != out[j].Rating.Value {
+			return out[i].Rating.Value > out[j].Rating.Value
+		}
+		return out[i].Player < out[j].Player
+	})
+	return out
+}
+
+// LoadLedger reads a ledger saved with Save
+func LoadLedger(path string) (*Ledger, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var l Ledger
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("parse ledger %s: %w", path, err)
+	}
+	if l.Ratings == nil {
+		l.Ratings = make(map[string]Rating)
+	}
+	return &l, nil
+}
+
+// Save writes the ledger, including its full history, to a JSON file
+func (l *Ledger) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,192 @@
+package rating
+
+import (
+	"math"
+	"sort"
+)
+
+// Matchmaking report settings
+const (
+	gapBucketWidth = 100 // rating points per gap bucket
+	blowoutRatio   = 2   // a win by at least this multiple of the runner-up's score
+)
+
+// GapBucket gathers the matches whose rating gap fell in [Low, High)
+type GapBucket struct {
+	Low         float64 `json:"low"`
+	High        float64 `json:"high"`
+	Matches     int     `json:"matches"`
+	MeanQueueMs float64 `json:"meanQueueMs"` // over matches with a queue time
+	Expected    float64 `json:"expected"`    // mean win probability of the higher-rated player
+	FavoriteWin float64 `json:"favoriteWin"` // share of decided matches the higher-rated player won
+	BlowoutRate float64 `json:"blowoutRate"` // over matches with scores
+}
+
+// MatchmakingReport measures how evenly matches were made, for tuning the
+// matchmaking simulator against real play
+type MatchmakingReport struct {
+	System      string      `json:"system"`
+	Matches     int         `json:"matches"`
+	GapP50      float64     `json:"gapP50"`
+	GapP90      float64     `json:"gapP90"`
+	GapMax      float64     `json:"gapMax"`
+	QueueGap    float64     `json:"queueGapCorrelation"` // Pearson correlation of queue time and gap
+	UpsetRate   float64     `json:"upsetRate"`           // share of decided matches the lower-rated player won
+	BlowoutRate float64     `json:"blowoutRate"`
+	Buckets     []GapBucket `json:"buckets"`
+}
+
+// AnalyzeMatchmaking replays the matches through a fresh ledger and
+// measures each match's rating gap, the spread between its highest and
+// lowest pre-match rating, against queue time, upsets and blowouts
+func AnalyzeMatchmaking(system string, eloK float64, matches []Match) (MatchmakingReport, error) {
+	ledger, err := NewLedger(system, eloK)
+	if err != nil {
+		return MatchmakingReport{System: system}, err
+	}
+	return analyzeMatchmaking(ledger, matches)
+}
+
+// analyzeMatchmaking measures the matches against ratings that start from
+// the ledger's, which it updates
+func analyzeMatchmaking(ledger *Ledger, matches []Match) (MatchmakingReport, error) {
+	report := MatchmakingReport{System: ledger.System}
+	sorted := append([]Match(nil), matches...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	type sums struct {
+		GapBucket
+		queued, decided, favoriteWins, scored, blowouts int
+		queueMs, expected                               float64
+	}
+	var buckets []*sums
+	var gaps, queueGaps, queues []float64
+	upsets, decided, blowouts, scored := 0, 0, 0, 0
+	for _, m := range sorted {
+		if len(m.Players) < 2 {
+			continue
+		}
+		favorite, underdog := m.Players[0], m.Players[0]
+		for _, p := range m.Players {
+			if ledger.Rating(p).Value > ledger.Rating(favorite).Value {
+				favorite = p
+			}
+			if ledger.Rating(p).Value < ledger.Rating(underdog).Value {
+				underdog = p
+			}
+		}
+		gap := ledger.Rating(favorite).Value - ledger.Rating(underdog).Value
+		expected := 0.5
+		if gap > 0 {
+			expected = ledger.WinProbability(favorite, underdog)
+		}
+		if err := ledger.Apply(m); err != nil {
+			return report, err
+		}
+
+		i := int(gap / gapBucketWidth)
+		for len(buckets) <= i {
+			low := float64(len(buckets) * gapBucketWidth)
+			buckets = append(buckets, &sums{GapBucket: GapBucket{Low: low, High: low + gapBucketWidth}})
+		}
+		b := buckets[i]
+		b.Matches++
+		b.expected += expected
+		gaps = append(gaps, gap)
+		if m.QueueMs > 0 {
+			b.queued++
+			b.queueMs += float64(m.QueueMs)
+			queueGaps, queues = append(queueGaps, gap), append(queues, float64(m.QueueMs))
+		}
+		if m.Winner != "" && gap > 0 {
+			b.decided++
+			decided++
+			if m.Winner == favorite {
+				b.favoriteWins++
+			} else {
+				upsets++
+			}
+		}
+		if blowout, ok := isBlowout(m); ok {
+			b.scored++
+			scored++
+			if blowout {
+				b.blowouts++
+				blowouts++
+			}
+		}
+	}
+
+	report.Matches = len(gaps)
+	if len(gaps) == 0 {
+		return report, nil
+	}
+	sort.Float64s(gaps)
+	report.GapP50 = gaps[(len(gaps)-1)/2]
+	report.GapP90 = gaps[int(float64(len(gaps)-1)*0.9)]
+	report.GapMax = gaps[len(gaps)-1]
+	report.QueueGap = correlation(queues, queueGaps)
+	report.UpsetRate = ratio(upsets, decided)
+	report.BlowoutRate = ratio(blowouts, scored)
+	for _, b := range buckets {
+		if b.Matches == 0 {
+			continue
+		}
+		g := b.GapBucket
+		g.Expected = b.expected / float64(b.Matches)
+		g.FavoriteWin = ratio(b.favoriteWins, b.decided)
+		g.BlowoutRate = ratio(b.blowouts, b.scored)
+		if b.queued > 0 {
+			g.MeanQueueMs = b.queueMs / float64(b.queued)
+		}
+		report.Buckets = append(report.Buckets, g)
+	}
+	return report, nil
+}
+
+// isBlowout reports whether the winner scored at least blowoutRatio times
+// the best of the others; ok is false without a winner and scores
+func isBlowout(m Match) (blowout, ok bool) {
+	won, has := m.Scores[m.Winner]
+	if m.Winner == "" || !has {
+		return false, false
+	}
+	best := 0
+	for _, p := range m.Players {
+		if p != m.Winner && m.Scores[p] > best {
+			best = m.Scores[p]
+		}
+	}
+	return won > 0 && won >= blowoutRatio*best, true
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// correlation is the Pearson correlation of xs and ys, 0 when either is
+// constant
+func correlation(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	if n < 2 {
+		return 0
+	}
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i] / n
+		my += ys[i] / n
+	}
+	var sxy, sxx, syy float64
+	for i := range xs {
+		sxy += (xs[i] - mx) * (ys[i] - my)
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+		syy += (ys[i] - my) * (ys[i] - my)
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
@@ -0,0 +1,136 @@
+package rating
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Rating systems
+const (
+	SystemElo     = "elo"
+	SystemGlicko2 = "glicko2"
+)
+
+// Defaults for unrated players
+const (
+	InitialRating     = 1500.0
+	InitialDeviation  = 350.0
+	InitialVolatility = 0.06
+	DefaultEloK       = 32.0
+)
+
+// Rating is a player's current skill estimate; Deviation and Volatility
+// only change under Glicko-2
+type Rating struct {
+	Value      float64 `json:"value"`
+	Deviation  float64 `json:"deviation"`
+	Volatility float64 `json:"volatility"`
+	Games      int     `json:"games"`
+}
+
+// NewRating returns the rating of a player who hasn't played yet
+func NewRating() Rating {
+	return Rating{Value: InitialRating, Deviation: InitialDeviation, Volatility: InitialVolatility}
+}
+
+// Match is a finished game between two or more players; an empty Winner
+// is a draw
+type Match struct {
+	ID      string         `json:"id"`
+	Time    time.Time      `json:"time"`
+	Players []string       `json:"players"`
+	Winner  string         `json:"winner,omitempty"`
+	QueueMs int64          `json:"queueMs,omitempty"` // longest any player waited in the matchmaking queue
+	Scores  map[string]int `json:"scores,omitempty"`
+}
+
+// outcome is a single head-to-head result from one player's point of view
+type outcome struct {
+	opponent Rating
+	score    float64 // 1 win, 0.5 draw, 0 loss
+}
+
+// outcomes splits a match into head-to-head results for player: the winner
+// beats everyone, the other players only lose to the winner, and a draw
+// is a draw against every other player
+func (m Match) outcomes(player string, ratings map[string]Rating) []outcome {
+	var out []outcome
+	for _, other := range m.Players {
+		if other == player {
+			continue
+		}
+		var score float64
+		switch {
+		case m.Winner == "":
+			score = 0.5
+		case m.Winner == player:
+			score = 1
+		case m.Winner == other:
+			score = 0
+		default:
+			continue
+		}
+		out = append(out, outcome{opponent: ratings[other], score: score})
+	}
+	return out
+}
+
+// FromReplay extracts the match result recorded in a replay; replays with
+// fewer than two players aren't matches
+func FromReplay(r *replay.Replay) (Match, bool) {
+	if len(r.Players) < 2 {
+		return Match{}, false
+	}
+	m := Match{ID: r.SessionID, Time: r.StartedAt, Winner: r.Result.Winner, Scores: r.Result.Scores}
+	for _, p := range r.Players {
+		m.Players = append(m.Players, p.ID)
+	}
+	return m, true
+}
+
+// LoadMatchLog reads a match log with one JSON match per line
+func LoadMatchLog(path string) ([]Match, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var matches []Match
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var m Match
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		matches = append(matches, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// eloExpected is the Elo expected score of a player rated ra against rb
+func eloExpected(ra, rb float64) float64 {
+	return 1 / (1 + math.Pow(10, (rb-ra)/400))
+}
+
+// eloUpdate applies one match's results to an Elo rating
+func eloUpdate(r Rating, results []outcome, k float64) Rating {
+	delta := 0.0
+	for _, o := range results {
+		delta += k * (o.score - eloExpected(r.Value, o.opponent.Value))
+	}
+	r.Value += delta
+	return r
+}
@@ -0,0 +1,79 @@
+package rating
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGlicko2MatchesGlickmanExample(t *testing.T) {
+	r := Rating{Value: 1500, Deviation: 200, Volatility: 0.06}
+	results := []outcome{
+		{opponent: Rating{Value: 1400, Deviation: 30}, score: 1},
+		{opponent: Rating{Value: 1550, Deviation: 100}, score: 0},
+		{opponent: Rating{Value: 1700, Deviation: 300}, score: 0},
+	}
+	got := glicko2Update(r, results)
+	if math.Abs(got.Value-1464.06) > 0.01 || math.Abs(got.Deviation-151.52) > 0.01 || math.Abs(got.Volatility-0.05999) > 0.00001 {
+		t.Fatalf("got %+v, want 1464.06 / 151.52 / 0.05999", got)
+	}
+}
+
+func TestLedgerWinnerGainsRating(t *testing.T) {
+	for _, system := range []string{SystemElo, SystemGlicko2} {
+		l, err := NewLedger(system, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Apply(Match{ID: "m1", Players: []string{"a", "b"}, Winner: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		if a, b := l.Rating("a"), l.Rating("b"); a.Value <= b.Value || a.Games != 1 {
+			t.Fatalf("%s: a=%+v b=%+v", system, a, b)
+		}
+		if p := l.WinProbability("a", "b"); p <= 0.5 {
+			t.Fatalf("%s: WinProbability(a, b) = %.3f", system, p)
+		}
+		if h := l.PlayerHistory("b"); len(h) != 1 || h[0].After.Value >= h[0].Before.Value {
+			t.Fatalf("%s: history %+v", system, h)
+		}
+	}
+}
+
+func TestAnalyzeMatchmaking(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var matches []Match
+	// a beats everyone early on, so later matches against a have a gap
+	for i, opp := range []string{"b", "c", "d", "b", "c", "d"} {
+		m := Match{ID: fmt.Sprint("m", i), Time: start.Add(time.Duration(i) * time.Hour), Players: []string{"a", opp},
+			Winner: "a", QueueMs: int64(1000 * (i + 1)), Scores: map[string]int{"a": 1000, opp: 300}}
+		if i == 5 {
+			m.Winner, m.Scores = opp, map[string]int{"a": 500, opp: 600}
+		}
+		matches = append(matches, m)
+	}
+	r, err := AnalyzeMatchmaking(SystemElo, DefaultEloK, matches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Matches != 6 || r.GapP50 <= 0 || r.GapMax < r.GapP90 {
+		t.Fatalf("report = %+v", r)
+	}
+	if r.UpsetRate != 0.2 {
+		t.Errorf("upset rate %g, want 1 of the 5 matches with a favourite", r.UpsetRate)
+	}
+	if math.Abs(r.BlowoutRate-5.0/6) > 1e-9 {
+		t.Errorf("blowout rate %g, want 5/6", r.BlowoutRate)
+	}
+	if r.QueueGap <= 0 {
+		t.Errorf("queue/gap correlation %g, want positive as both grow", r.QueueGap)
+	}
+	total := 0
+	for _, b := range r.Buckets {
+		total += b.Matches
+	}
+	if total != 6 || r.Buckets[0].Low != 0 {
+		t.Errorf("buckets = %+v", r.Buckets)
+	}
+}
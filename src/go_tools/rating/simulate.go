@@ -0,0 +1,519 @@
+package rating
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/stats"
+)
+
+// Simulation defaults for settings left zero
+const (
+	defaultSimPlayers     = 2000
+	defaultSimDurationSec = 4 * 3600
+	defaultSimMatchSec    = 180
+	defaultSimArrivals    = 60 // per minute
+	defaultSimSkillStdDev = 300
+	defaultPolicySize     = 2
+	performanceStdDev     = 200 // of a player's play in one match around their skill, as in Elo's normal model
+	fairOdds              = 0.65
+)
+
+// simulationEpoch is when simulated time starts
+var simulationEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SimulationConfig sets up a matchmaking simulation: one synthetic
+// population, and the policies to run it under
+type SimulationConfig struct {
+	Seed          int64      `json:"seed"` // 0 for a fresh population every run
+	DurationSec   int        `json:"durationSec"`
+	MatchSec      int        `json:"matchSec"`      // how long a match keeps its players out of the queue
+	RequeueChance float64    `json:"requeueChance"` // that a player queues again straight after a match
+	System        string     `json:"system"`        // rating system the matchmaker rates with
+	EloK          float64    `json:"eloK"`
+	Population    Population `json:"population"`
+	Policies      []Policy   `json:"policies"`
+}
+
+// Population describes the synthetic players
+type Population struct {
+	Players        int      `json:"players"`
+	SkillMean      float64  `json:"skillMean"`
+	SkillStdDev    float64  `json:"skillStdDev"`
+	ArrivalsPerMin float64  `json:"arrivalsPerMinute"` // players coming to queue; those queued or playing already don't
+	PatienceSec    float64  `json:"patienceSec"`       // wait after which a player gives up; 0 for never
+	Established    bool     `json:"established"`       // players start rated at their skill instead of as newcomers
+	Regions        []Region `json:"regions"`
+}
+
+// Region is a share of the population that plays from one place
+type Region struct {
+	Name  string             `json:"name"`
+	Share float64            `json:"share"`
+	RTTMs map[string]float64 `json:"rttMs,omitempty"` // round trip from here to each region's servers, by name, as probe measures it
+}
+
+// SetRTT records the round trip from one region's players to another's
+// servers
+func (p *Population) SetRTT(from, to string, ms float64) error {
+	for i := range p.Regions {
+		if r := &p.Regions[i]; r.Name == from {
+			if r.RTTMs == nil {
+				r.RTTMs = make(map[string]float64)
+			}
+			r.RTTMs[to] = ms
+			return nil
+		}
+	}
+	return fmt.Errorf("no region %q in the population", from)
+}
+
+// Policy is how a matchmaker picks who plays whom. The oldest player in
+// the queue is matched first, with the closest rated players in reach.
+type Policy struct {
+	Name           string  `json:"name"`
+	Size           int     `json:"size"`                // players per match
+	Window         float64 `json:"window"`              // rating gap allowed at once; 0 without widening matches anyone
+	WidenPerSec    float64 `json:"widenPerSec"`         // window growth per second waited
+	MaxWindow      float64 `json:"maxWindow,omitempty"` // 0 for no cap
+	CrossRegionSec float64 `json:"crossRegionSec"`      // wait after which a player is matched outside their region; negative for never
+	MaxRTTMs       float64 `json:"maxRttMs,omitempty"`  // round trip to another region's server a player is matched at, where measured; 0 for any
+}
+
+// DefaultSimulationConfig is a mid-sized population across three regions
+// and three policies with the trade-off between them to tune
+func DefaultSimulationConfig() SimulationConfig {
+	return SimulationConfig{
+		DurationSec:   defaultSimDurationSec,
+		MatchSec:      defaultSimMatchSec,
+		RequeueChance: 0.7,
+		System:        SystemGlicko2,
+		Population: Population{
+			Players:        defaultSimPlayers,
+			SkillMean:      InitialRating,
+			SkillStdDev:    defaultSimSkillStdDev,
+			ArrivalsPerMin: defaultSimArrivals,
+			PatienceSec:    300,
+			Regions:        []Region{{Name: "eu", Share: 0.45}, {Name: "na", Share: 0.35}, {Name: "asia", Share: 0.2}},
+		},
+		Policies: []Policy{
+			{Name: "fifo", CrossRegionSec: -1},
+			{Name: "strict", Window: 100, CrossRegionSec: -1},
+			{Name: "widening", Window: 50, WidenPerSec: 5, MaxWindow: 600, CrossRegionSec: 60},
+		},
+	}
+}
+
+// LoadSimulationConfig reads a simulation config from JSON over the
+// defaults; policies given replace the default ones
+func LoadSimulationConfig(path string) (SimulationConfig, error) {
+	c := DefaultSimulationConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	c.Policies = nil
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("parse simulation config %s: %w", path, err)
+	}
+	if len(c.Policies) == 0 {
+		c.Policies = DefaultSimulationConfig().Policies
+	}
+	return c, nil
+}
+
+// RegionQueue is the queueing of one region's players
+type RegionQueue struct {
+	Region     string  `json:"region"`
+	Matched    int     `json:"matched"` // queue entries that ended in a match
+	Abandoned  int     `json:"abandoned"`
+	QueueP50Ms int64   `json:"queueP50Ms"`
+	QueueP90Ms int64   `json:"queueP90Ms"`
+	CrossShare float64 `json:"crossRegionShare"` // of its matched players, the share that played outside it
+}
+
+// SimulationReport is one policy's run: how long players queued, and how
+// fair the matches were by their hidden skill and by the ratings the
+// matchmaker saw
+type SimulationReport struct {
+	Policy       Policy            `json:"policy"`
+	Players      int               `json:"players"`
+	Matches      int               `json:"matches"`
+	Abandoned    int               `json:"abandoned"`   // queue entries given up on
+	StillQueued  int               `json:"stillQueued"` // at the end
+	QueueP50Ms   int64             `json:"queueP50Ms"`
+	QueueP90Ms   int64             `json:"queueP90Ms"`
+	QueueP99Ms   int64             `json:"queueP99Ms"`
+	QueueMaxMs   int64             `json:"queueMaxMs"`
+	CrossRegion  float64           `json:"crossRegionShare"` // of matches, those with players from two regions or more
+	SkillGapP50  float64           `json:"skillGapP50"`      // spread of hidden skill in a match
+	SkillGapP90  float64           `json:"skillGapP90"`
+	FavoriteOdds float64           `json:"favoriteOdds"` // mean chance the most skilled player beat the least
+	FairShare    float64           `json:"fairShare"`    // of matches, those whose favourite's odds were at most fairOdds
+	RTTP50Ms     float64           `json:"rttP50Ms"`     // players' round trip to the server of their match, in its first player's region, where measured
+	RTTP90Ms     float64           `json:"rttP90Ms"`
+	Regions      []RegionQueue     `json:"regions"`
+	Matchmaking  MatchmakingReport `json:"matchmaking"` // by the ratings the matchmaker saw
+}
+
+// simPlayer is one synthetic player
+type simPlayer struct {
+	id       string
+	skill    float64
+	region   int
+	queuedAt int // second joined the queue, -1 when not queued
+	busyTill int // second their match ends
+}
+
+// simRegion gathers a region's queueing
+type simRegion struct {
+	waits            []int64
+	abandoned, cross int
+}
+
+// Simulate runs the config's population under each of its policies. Every
+// policy sees the same players and the same arrivals until their matches
+// make the runs diverge.
+func Simulate(c SimulationConfig) ([]SimulationReport, error) {
+	if c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+	}
+	var out []SimulationReport
+	for _, p := range c.Policies {
+		r, err := simulatePolicy(c, p)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func simulatePolicy(c SimulationConfig, policy Policy) (SimulationReport, error) {
+	if policy.Size <= 0 {
+		policy.Size = defaultPolicySize
+	}
+	report := SimulationReport{Policy: policy}
+	pop := c.Population
+	if pop.Players < policy.Size {
+		return report, fmt.Errorf("%d players can't fill matches of %d", pop.Players, policy.Size)
+	}
+	if len(pop.Regions) == 0 {
+		pop.Regions = []Region{{Name: "all", Share: 1}}
+	}
+	if c.DurationSec <= 0 {
+		c.DurationSec = defaultSimDurationSec
+	}
+	if c.MatchSec <= 0 {
+		c.MatchSec = defaultSimMatchSec
+	}
+	src, err := rng.New(rng.AlgorithmXoshiro, c.Seed)
+	if err != nil {
+		return report, err
+	}
+	players := newPopulation(pop, src)
+	report.Players = len(players)
+	ledger, err := populationLedger(c, players)
+	if err != nil {
+		return report, err
+	}
+
+	regions := make([]simRegion, len(pop.Regions))
+	var queue []*simPlayer // oldest first
+	var matches []Match
+	var waits []int64
+	var gaps, favorites, rtts []float64
+	rtt := regionRTT(pop.Regions)
+	fair, cross := 0, 0
+	// arrivals, outcomes and requeues draw from their own sources so the
+	// population and its arrivals stay the same however matches go
+	arrivals := rng.NewXoshiro(uint64(c.Seed) + 1)
+	outcomes := rng.NewXoshiro(uint64(c.Seed) + 2)
+	for now := 0; now < c.DurationSec; now++ {
+		for _, p := range players {
+			if p.busyTill == now && p.queuedAt < 0 && now > 0 && outcomes.Float64() < c.RequeueChance {
+				p.queuedAt = now
+				queue = append(queue, p)
+			}
+		}
+		for n := poisson(arrivals, pop.ArrivalsPerMin/60); n > 0; n-- {
+			p := players[arrivals.Intn(len(players))]
+			if p.queuedAt < 0 && p.busyTill <= now {
+				p.queuedAt = now
+				queue = append(queue, p)
+			}
+		}
+		if pop.PatienceSec > 0 {
+			kept := queue[:0]
+			for _, p := range queue {
+				if float64(now-p.queuedAt) >= pop.PatienceSec {
+					p.queuedAt = -1
+					regions[p.region].abandoned++
+					report.Abandoned++
+					continue
+				}
+				kept = append(kept, p)
+			}
+			queue = kept
+		}
+
+		for _, group := range policy.match(queue, ledger, now, rtt) {
+			m := Match{ID: fmt.Sprintf("%s-%d", policy.Name, len(matches)+1), Time: simulationEpoch.Add(time.Duration(now) * time.Second)}
+			strongest, weakest := group[0], group[0]
+			best, bestPerf := group[0], math.Inf(-1)
+			mixed := false
+			for _, p := range group {
+				wait := int64(now-p.queuedAt) * 1000
+				m.Players = append(m.Players, p.id)
+				if wait > m.QueueMs {
+					m.QueueMs = wait
+				}
+				waits = append(waits, wait)
+				regions[p.region].waits = append(regions[p.region].waits, wait)
+				if p.region != group[0].region {
+					mixed = true
+				}
+				if ms, ok := rtt(p.region, group[0].region); ok {
+					rtts = append(rtts, ms)
+				}
+				if p.skill > strongest.skill {
+					strongest = p
+				}
+				if p.skill < weakest.skill {
+					weakest = p
+				}
+				if perf := p.skill + performanceStdDev*normal(outcomes); perf > bestPerf {
+					best, bestPerf = p, perf
+				}
+				p.queuedAt, p.busyTill = -1, now+c.MatchSec
+			}
+			m.Winner = best.id
+			if mixed {
+				cross++
+				for _, p := range group {
+					regions[p.region].cross++
+				}
+			}
+			// with both playing around their skill, the stronger outplays
+			// the weaker by a normal margin of sd performanceStdDev*sqrt2
+			odds := normalCDF((strongest.skill - weakest.skill) / (performanceStdDev * math.Sqrt2))
+			gaps = append(gaps, strongest.skill-weakest.skill)
+			favorites = append(favorites, odds)
+			if odds <= fairOdds {
+				fair++
+			}
+			if err := ledger.Apply(m); err != nil {
+				return report, err
+			}
+			matches = append(matches, m)
+		}
+		kept := queue[:0]
+		for _, p := range queue {
+			if p.queuedAt >= 0 {
+				kept = append(kept, p)
+			}
+		}
+		queue = kept
+	}
+
+	report.Matches = len(matches)
+	report.StillQueued = len(queue)
+	sortInt64s(waits)
+	report.QueueP50Ms, report.QueueP90Ms, report.QueueP99Ms = quantileMs(waits, 0.5), quantileMs(waits, 0.9), quantileMs(waits, 0.99)
+	if len(waits) > 0 {
+		report.QueueMaxMs = waits[len(waits)-1]
+	}
+	if len(matches) > 0 {
+		report.CrossRegion = ratio(cross, len(matches))
+		report.FairShare = ratio(fair, len(matches))
+		sum := 0.0
+		for _, f := range favorites {
+			sum += f
+		}
+		report.FavoriteOdds = sum / float64(len(favorites))
+		sort.Float64s(gaps)
+		report.SkillGapP50, report.SkillGapP90 = stats.Quantile(gaps, 0.5), stats.Quantile(gaps, 0.9)
+	}
+	if len(rtts) > 0 {
+		sort.Float64s(rtts)
+		report.RTTP50Ms, report.RTTP90Ms = stats.Quantile(rtts, 0.5), stats.Quantile(rtts, 0.9)
+	}
+	for i, r := range regions {
+		sortInt64s(r.waits)
+		report.Regions = append(report.Regions, RegionQueue{
+			Region:     pop.Regions[i].Name,
+			Matched:    len(r.waits),
+			Abandoned:  r.abandoned,
+			QueueP50Ms: quantileMs(r.waits, 0.5),
+			QueueP90Ms: quantileMs(r.waits, 0.9),
+			CrossShare: ratio(r.cross, len(r.waits)),
+		})
+	}
+
+	// the matchmaker's view: the same matches against the ratings it had
+	start, err := populationLedger(c, players)
+	if err != nil {
+		return report, err
+	}
+	if report.Matchmaking, err = analyzeMatchmaking(start, matches); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// newPopulation draws the players' skills and regions
+func newPopulation(pop Population, src rng.RandomSource) []*simPlayer {
+	if pop.SkillMean == 0 {
+		pop.SkillMean = InitialRating
+	}
+	if pop.SkillStdDev == 0 {
+		pop.SkillStdDev = defaultSimSkillStdDev
+	}
+	total := 0.0
+	for _, r := range pop.Regions {
+		total += r.Share
+	}
+	players := make([]*simPlayer, pop.Players)
+	for i := range players {
+		p := &simPlayer{id: fmt.Sprintf("p%d", i+1), skill: pop.SkillMean + pop.SkillStdDev*normal(src), queuedAt: -1}
+		pick := src.Float64() * total
+		for p.region = 0; p.region < len(pop.Regions)-1 && pick >= pop.Regions[p.region].Share; p.region++ {
+			pick -= pop.Regions[p.region].Share
+		}
+		players[i] = p
+	}
+	return players
+}
+
+// populationLedger is the matchmaker's ratings before the first match:
+// empty for newcomers, or each player's skill for an established
+// population
+func populationLedger(c SimulationConfig, players []*simPlayer) (*Ledger, error) {
+	system := c.System
+	if system == "" {
+		system = SystemGlicko2
+	}
+	ledger, err := NewLedger(system, c.EloK)
+	if err != nil {
+		return nil, err
+	}
+	if c.Population.Established {
+		for _, p := range players {
+			ledger.Ratings[p.id] = Rating{Value: p.skill, Deviation: 50, Volatility: InitialVolatility}
+		}
+	}
+	return ledger, nil
+}
+
+// window is the rating gap a player who has waited this long accepts;
+// negative for any
+func (p Policy) window(waited int) float64 {
+	if p.Window <= 0 && p.WidenPerSec <= 0 {
+		return -1
+	}
+	w := p.Window + p.WidenPerSec*float64(waited)
+	if p.MaxWindow > 0 && w > p.MaxWindow {
+		w = p.MaxWindow
+	}
+	return w
+}
+
+// regionRTT looks up the round trip from one region's players to
+// another's servers, when it was measured
+func regionRTT(regions []Region) func(from, to int) (float64, bool) {
+	return func(from, to int) (float64, bool) {
+		ms, ok := regions[from].RTTMs[regions[to].Name]
+		return ms, ok
+	}
+}
+
+// match makes the matches the policy finds in the queue this second,
+// marking their players out of it. Each unmatched player, oldest first,
+// takes the closest rated of the players in their window and region, or
+// once waited long enough in any region their round trip to the
+// player's is within the policy's.
+func (p Policy) match(queue []*simPlayer, ledger *Ledger, now int, rtt func(from, to int) (float64, bool)) [][]*simPlayer {
+	var out [][]*simPlayer
+	taken := make(map[*simPlayer]bool)
+	for i, anchor := range queue {
+		if taken[anchor] {
+			continue
+		}
+		waited := now - anchor.queuedAt
+		window := p.window(waited)
+		anyRegion := p.CrossRegionSec >= 0 && float64(waited) >= p.CrossRegionSec
+		rating := ledger.Rating(anchor.id).Value
+		type candidate struct {
+			p   *simPlayer
+			gap float64
+		}
+		var cands []candidate
+		for _, q := range queue[i+1:] {
+			if taken[q] || !anyRegion && q.region != anchor.region {
+				continue
+			}
+			if ms, ok := rtt(q.region, anchor.region); ok && q.region != anchor.region && p.MaxRTTMs > 0 && ms > p.MaxRTTMs {
+				continue
+			}
+			gap := math.Abs(ledger.Rating(q.id).Value - rating)
+			if window >= 0 && gap > window {
+				continue
+			}
+			cands = append(cands, candidate{q, gap})
+		}
+		if len(cands) < p.Size-1 {
+			continue
+		}
+		sort.SliceStable(cands, func(a, b int) bool { return cands[a].gap < cands[b].gap })
+		group := []*simPlayer{anchor}
+		for _, c := range cands[:p.Size-1] {
+			group = append(group, c.p)
+		}
+		for _, q := range group {
+			taken[q] = true
+		}
+		out = append(out, group)
+	}
+	return out
+}
+
+// normal draws from the standard normal distribution
+func normal(src rng.RandomSource) float64 {
+	u := 1 - src.Float64() // (0, 1], so the log is finite
+	return math.Sqrt(-2*math.Log(u)) * math.Cos(2*math.Pi*src.Float64())
+}
+
+func normalCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+// poisson draws a count of events with the given mean, by Knuth's method
+func poisson(src rng.RandomSource, mean float64) int {
+	if mean <= 0 {
+		return 0
+	}
+	limit, n, p := math.Exp(-mean), 0, src.Float64()
+	for p > limit {
+		n++
+		p *= src.Float64()
+	}
+	return n
+}
+
+func sortInt64s(xs []int64) {
+	sort.Slice(xs, func(i, j int) bool { return xs[i] < xs[j] })
+}
+
+// quantileMs is stats.Quantile of sorted waits, to the millisecond
+func quantileMs(sorted []int64, q float64) int64 {
+	ms := make([]float64, len(sorted))
+	for i, w := range sorted {
+		ms[i] = float64(w)
+	}
+	return int64(math.Round(stats.Quantile(ms, q)))
+}
@@ -0,0 +1,104 @@
+package rating
+
+import (
+	"reflect"
+	"testing"
+)
+
+func smallSimulation() SimulationConfig {
+	c := DefaultSimulationConfig()
+	c.Seed = 7
+	c.DurationSec = 3600
+	c.Population.Players = 400
+	c.Population.ArrivalsPerMin = 30
+	return c
+}
+
+func TestSimulateTradesQueueTimeForFairness(t *testing.T) {
+	reports, err := Simulate(smallSimulation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("%d reports", len(reports))
+	}
+	fifo, strict, widening := reports[0], reports[1], reports[2]
+	for _, r := range reports {
+		if r.Matches == 0 || r.Players != 400 || len(r.Regions) != 3 || r.Matchmaking.Matches != r.Matches {
+			t.Fatalf("%s: %+v", r.Policy.Name, r)
+		}
+	}
+	if fifo.QueueP90Ms >= strict.QueueP90Ms || fifo.Abandoned >= strict.Abandoned {
+		t.Errorf("fifo queued longer than strict: p90 %d vs %d ms, %d vs %d abandoned", fifo.QueueP90Ms, strict.QueueP90Ms, fifo.Abandoned, strict.Abandoned)
+	}
+	if fifo.CrossRegion != 0 || strict.CrossRegion != 0 || widening.CrossRegion == 0 {
+		t.Errorf("cross-region shares %g %g %g", fifo.CrossRegion, strict.CrossRegion, widening.CrossRegion)
+	}
+	if fifo.Matchmaking.GapP50 <= strict.Matchmaking.GapP50 {
+		t.Errorf("strict matched wider rating gaps than fifo: %g vs %g", strict.Matchmaking.GapP50, fifo.Matchmaking.GapP50)
+	}
+
+	again, err := Simulate(smallSimulation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, reports) {
+		t.Error("the same seed simulated differently")
+	}
+}
+
+func TestSimulateEstablishedPopulation(t *testing.T) {
+	c := smallSimulation()
+	c.Population.Established = true
+	c.Policies = []Policy{{Name: "fifo"}, {Name: "strict", Window: 50, CrossRegionSec: -1}}
+	reports, err := Simulate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rated at their skill from the start, a tight window is fair at once
+	fifo, strict := reports[0], reports[1]
+	if strict.SkillGapP90 >= fifo.SkillGapP50 || strict.FairShare <= fifo.FairShare || strict.FavoriteOdds >= fifo.FavoriteOdds {
+		t.Errorf("fifo %+v\nstrict %+v", fifo, strict)
+	}
+	if fifo.Regions[0].CrossShare == 0 {
+		t.Errorf("fifo with regions ignored kept %s to itself", fifo.Regions[0].Region)
+	}
+}
+
+func TestSimulateRoundTrips(t *testing.T) {
+	c := smallSimulation()
+	rtts := map[[2]string]float64{{"eu", "eu"}: 20, {"na", "na"}: 25, {"asia", "asia"}: 30,
+		{"eu", "na"}: 90, {"na", "eu"}: 90, {"eu", "asia"}: 250, {"asia", "eu"}: 250, {"na", "asia"}: 160, {"asia", "na"}: 160}
+	for k, ms := range rtts {
+		if err := c.Population.SetRTT(k[0], k[1], ms); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Population.SetRTT("mars", "eu", 1) == nil {
+		t.Error("set a round trip from a region the population lacks")
+	}
+	c.Policies = []Policy{{Name: "any"}, {Name: "near", MaxRTTMs: 100}}
+	reports, err := Simulate(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anyRegion, near := reports[0], reports[1]
+	if anyRegion.RTTP50Ms == 0 || near.RTTP90Ms > 100 || near.RTTP90Ms >= anyRegion.RTTP90Ms {
+		t.Errorf("round trips p50/p90: any %g/%g, near %g/%g", anyRegion.RTTP50Ms, anyRegion.RTTP90Ms, near.RTTP50Ms, near.RTTP90Ms)
+	}
+	if asia := near.Regions[2]; asia.CrossShare != 0 {
+		t.Errorf("asia, 160ms or more from the others, played %.0f%% outside under a 100ms cap", 100*asia.CrossShare)
+	}
+}
+
+func TestPolicyWindow(t *testing.T) {
+	p := Policy{Window: 50, WidenPerSec: 10, MaxWindow: 200}
+	for waited, want := range map[int]float64{0: 50, 10: 150, 60: 200} {
+		if got := p.window(waited); got != want {
+			t.Errorf("window after %ds = %g, want %g", waited, got, want)
+		}
+	}
+	if (Policy{}).window(100) >= 0 {
+		t.Error("a policy without a window limited the gap")
+	}
+}
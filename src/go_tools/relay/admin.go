@@ -0,0 +1,99 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/admin"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/lobby"
+)
+
+// RegisterAdmin adds the relay's operations to a server's admin API:
+//
+//	GET    /admin/rooms                       rooms, with their peers' addresses
+//	DELETE /admin/rooms/{code}                close a room, disconnecting its peers and spectators
+//	DELETE /admin/rooms/{code}/peers/{peer}   kick a peer, whether or not it hosts
+func (s *Server) RegisterAdmin(a *admin.API) {
+	a.Handle("GET /admin/rooms", "rooms, with their peers' addresses", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, s.AdminRooms())
+	})
+	a.Handle("DELETE /admin/rooms/{code}", "close a room, disconnecting its peers and spectators", func(w http.ResponseWriter, r *http.Request) {
+		code := lobby.NormalizeCode(r.PathValue("code"))
+		if err := s.CloseRoom(code); err != nil {
+			adminError(w, err)
+			return
+		}
+		slog.Info("relay: room closed by an operator", "room", code, "by", r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	a.Handle("DELETE /admin/rooms/{code}/peers/{peer}", "kick a peer, whether or not it hosts", func(w http.ResponseWriter, r *http.Request) {
+		code, name := lobby.NormalizeCode(r.PathValue("code")), r.PathValue("peer")
+		if err := s.Kick(code, name); err != nil {
+			adminError(w, err)
+			return
+		}
+		slog.Info("relay: peer kicked by an operator", "room", code, "peer", name, "by", r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func adminError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, lobby.ErrNoRoom) || errors.Is(err, lobby.ErrNotMember) {
+		status = http.StatusNotFound
+	}
+	admin.Error(w, status, "%v", err)
+}
+
+// AdminRooms describes the open rooms like Rooms, with where each peer
+// connected from
+func (s *Server) AdminRooms() []Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Room{}
+	for _, lr := range s.lobby.Rooms() {
+		r, ok := s.rooms[lr.Code]
+		if !ok {
+			continue
+		}
+		desc := r.describe(lr)
+		for i, p := range r.peers {
+			desc.Peers[i].Addr = p.addr
+		}
+		out = append(out, desc)
+	}
+	return out
+}
+
+// Kick disconnects a peer from its room, the host as well as any other;
+// the room's other peers see it leave, removed
+func (s *Server) Kick(code, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[code]; !ok {
+		return fmt.Errorf("%w %s", lobby.ErrNoRoom, code)
+	}
+	events, err := s.lobby.Remove(code, name)
+	if err != nil {
+		return err
+	}
+	s.dispatch(events)
+	return nil
+}
+
+// CloseRoom disconnects a room's peers and spectators and closes it
+func (s *Server) CloseRoom(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[code]; !ok {
+		return fmt.Errorf("%w %s", lobby.ErrNoRoom, code)
+	}
+	events, err := s.lobby.Close(code)
+	if err != nil {
+		return err
+	}
+	s.dispatch(events)
+	return nil
+}
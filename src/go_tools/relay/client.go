@@ -0,0 +1,256 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+// Client is a headless peer in a relay room, for bots and tests: it sends
+// the lobby's controls and tells the room's events from relayed messages
+type Client struct {
+	Name string
+	Code string
+
+	conn      *websocket.Conn
+	wmu       sync.Mutex
+	spectator bool
+
+	mu   sync.Mutex
+	last Event
+}
+
+// Message is what a Client receives: a room event, or a message relayed
+// from another peer
+type Message struct {
+	Event *Event
+	Op    int // of a relayed message
+	Data  []byte
+}
+
+// Dial joins the room with the code at the relay at baseURL, such as
+// http://host:8097, as name, asking for events as game messages. The token
+// of auth.TokenEnv, if set, is presented to the relay.
+func Dial(ctx context.Context, baseURL, code, name string) (*Client, error) {
+	return dial(ctx, baseURL, code, name, url.Values{"name": {name}, "events": {"1"}})
+}
+
+// Spectate watches the room with the code at the relay at baseURL as
+// name: the client receives the room's events and batches of its game
+// messages, see Message.Stream, the relay's spectator delay late, and
+// what it sends is ignored
+func Spectate(ctx context.Context, baseURL, code, name string) (*Client, error) {
+	c, err := dial(ctx, baseURL, code, name, url.Values{"name": {name}, "spectate": {"1"}})
+	if err == nil {
+		c.spectator = true
+	}
+	return c, err
+}
+
+func dial(ctx context.Context, baseURL, code, name string, query url.Values) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/rooms/" + url.PathEscape(code))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query.Encode()
+	header := http.Header{}
+	auth.SetHeader(header, os.Getenv(auth.TokenEnv))
+	conn, err := certs.Dial(ctx, u.String(), header)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Name: name, Code: strings.ToUpper(code), conn: conn}, nil
+}
+
+// OpenRoom opens an empty room at the relay at baseURL, as POST /rooms
+// does, to join under its code
+func OpenRoom(ctx context.Context, baseURL string) (Room, error) {
+	var r Room
+	err := call(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/rooms", http.StatusCreated, &r)
+	return r, err
+}
+
+// FetchHealth reads the relay at baseURL's GET /health
+func FetchHealth(ctx context.Context, baseURL string) (Health, error) {
+	var h Health
+	err := call(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/health", http.StatusOK, &h)
+	return h, err
+}
+
+// httpClient is made once, for its connections to be reused
+var httpClient = sync.OnceValue(func() *http.Client { return certs.HTTPClient(0) })
+
+func call(ctx context.Context, method, u string, want int, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return err
+	}
+	auth.SetHeader(req.Header, os.Getenv(auth.TokenEnv))
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		var reply struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&reply)
+		if reply.Error != "" {
+			return fmt.Errorf("relay: %s: %s", resp.Status, reply.Error)
+		}
+		return fmt.Errorf("relay: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Close leaves the room
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Room is the room as the last event received described it
+func (c *Client) Room() Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Send relays a message to the room's other peers
+func (c *Client) Send(op int, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.conn.WriteMessage(op, data)
+}
+
+func (c *Client) control(op, peer string) error {
+	return c.SendGame(&gamepb.Message{Body: &gamepb.Message_Control{Control: &gamepb.Control{Lobby: op, Peer: peer}}})
+}
+
+// Ready tells the room whether this peer is ready for a match
+func (c *Client) Ready(ready bool) error {
+	if ready {
+		return c.control("ready", "")
+	}
+	return c.control("unready", "")
+}
+
+// Start starts a match, as the host
+func (c *Client) Start() error { return c.control("start", "") }
+
+// End ends the match, as the host
+func (c *Client) End() error { return c.control("end", "") }
+
+// Transfer hands hosting to another peer, as the host
+func (c *Client) Transfer(peer string) error { return c.control("host", peer) }
+
+// Kick removes a peer, as the host
+func (c *Client) Kick(peer string) error { return c.control("kick", peer) }
+
+// Ping holds off the relay's idle timeout
+func (c *Client) Ping() error { return c.control("ping", "") }
+
+// SendGame relays a game message to the room's other peers, as a binary
+// message in its wire format
+func (c *Client) SendGame(m *gamepb.Message) error {
+	data, err := gamepb.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return c.Send(websocket.BinaryMessage, data)
+}
+
+// Game decodes a relayed binary message as a game message
+func (m Message) Game() (*gamepb.Message, error) {
+	if m.Event != nil || m.Op != websocket.BinaryMessage {
+		return nil, fmt.Errorf("relay: not a binary game message")
+	}
+	return gamepb.Unmarshal(m.Data)
+}
+
+// Stream decodes a binary message a spectator receives, the game messages
+// the room relayed over one spectator interval
+func (m Message) Stream() ([]*gamepb.Message, error) {
+	if m.Event != nil || m.Op != websocket.BinaryMessage {
+		return nil, fmt.Errorf("relay: not a binary game message")
+	}
+	var out []*gamepb.Message
+	err := gamepb.Decode(bytes.NewReader(m.Data), func(gm *gamepb.Message) error {
+		out = append(out, gm)
+		return nil
+	})
+	return out, err
+}
+
+// Recv waits for the next message, until ctx's deadline if it has one. A
+// game message with a room event body for this room is taken for an
+// event, which only the relay sends.
+func (c *Client) Recv(ctx context.Context) (Message, error) {
+	deadline, _ := ctx.Deadline()
+	c.conn.SetReadDeadline(deadline)
+	op, data, err := c.conn.ReadMessage()
+	if err != nil {
+		if ctx.Err() != nil {
+			return Message{}, ctx.Err()
+		}
+		return Message{}, err
+	}
+	if re := c.roomEvent(op, data); re != nil && re.GetRoom() == c.Code {
+		e := eventFromProto(re)
+		if e.Event != "error" {
+			c.mu.Lock()
+			c.last = e
+			c.mu.Unlock()
+		}
+		return Message{Event: &e}, nil
+	}
+	return Message{Op: op, Data: data}, nil
+}
+
+// roomEvent is the room event a message received carries, if it's one: a
+// game message of its own to a peer, and length-prefixed to a spectator
+func (c *Client) roomEvent(op int, data []byte) *gamepb.RoomEvent {
+	if op != websocket.BinaryMessage {
+		return nil
+	}
+	if !c.spectator {
+		gm, _ := gamepb.Unmarshal(data)
+		return gm.GetRoom()
+	}
+	m := Message{Op: op, Data: data}
+	msgs, err := m.Stream()
+	if err != nil || len(msgs) != 1 {
+		return nil
+	}
+	return msgs[0].GetRoom()
+}
+
+// Await receives until an event match accepts, skipping relayed messages
+// and other events. An error event, answering a control of this client's
+// that failed, ends the wait as an error.
+func (c *Client) Await(ctx context.Context, match func(Event) bool) (Event, error) {
+	for {
+		m, err := c.Recv(ctx)
+		if err != nil {
+			return Event{}, err
+		}
+		switch {
+		case m.Event == nil:
+		case m.Event.Event == "error":
+			return *m.Event, fmt.Errorf("relay: %s", m.Event.Error)
+		case match(*m.Event):
+			return *m.Event, nil
+		}
+	}
+}
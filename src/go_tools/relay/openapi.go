@@ -0,0 +1,26 @@
+package relay
+
+import (
+	"net/http"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+)
+
+// DescribeAPI adds the relay's endpoints to a server's OpenAPI document
+func (s *Server) DescribeAPI(spec *openapi.Spec) {
+	code := map[string]string{"code": "the room's, in any case"}
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/rooms", Summary: "rooms, their peers and traffic", Reply: []Room{}})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/rooms", Summary: "a new room under a fresh code",
+		Status: http.StatusCreated, Reply: Room{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/rooms/{code}",
+		Summary: "one room; as a WebSocket handshake, joins it, or with spectate=1 watches it", Params: code,
+		Query: []openapi.Param{
+			{Name: "name", Doc: "the peer's, unique in the room; for a WebSocket"},
+			{Name: "events", Doc: "1 to be sent the room's events as game messages, json as legacy JSON text; for a WebSocket"},
+			{Name: "spectate", Doc: "1 to watch rather than join; for a WebSocket", Type: "integer"},
+		},
+		Reply: Room{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/ping",
+		Summary: "a WebSocket that answers pings and echoes messages, for latency probes", Status: http.StatusSwitchingProtocols})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/health", Summary: "the relay's load and how late its ticks run", Reply: Health{}})
+}
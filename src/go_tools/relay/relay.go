@@ -0,0 +1,751 @@
+// Package relay forwards game messages between locally running clients in
+// rooms keyed by a code, so networked features can be tested without
+// standing up the production backend
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/lobby"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/wirecap"
+)
+
+// Defaults for Options left zero
+const (
+	DefaultMaxPeers          = lobby.DefaultMaxMembers
+	DefaultQueueSize         = 256
+	DefaultMaxSpectators     = 64
+	DefaultSpectatorDelay    = 5 * time.Second
+	DefaultSpectatorInterval = 250 * time.Millisecond
+)
+
+// sweepInterval is how often the relay applies the lobby's timeouts
+const sweepInterval = time.Second
+
+// tickWindow is how many of the latest sweeps Health's tick lag covers
+const tickWindow = 60
+
+// controlPrefix starts the text messages the relay takes as lobby
+// controls rather than relaying, the legacy JSON form of gamepb.Control
+var controlPrefix = []byte(`{"lobby":`)
+
+// Options tune a relay
+type Options struct {
+	MaxPeers  int   // in a room
+	MinPeers  int   // for the host to start a match; 0 for lobby.DefaultMinMembers
+	QueueSize int   // messages waiting for a peer before it's dropped as too slow
+	ReadLimit int64 // of a message; 0 for websocket.DefaultReadLimit
+
+	IdleTimeout  time.Duration // drops a peer that sends nothing this long; 0 never does
+	ReadyTimeout time.Duration // drops a peer not ready this long before a match; 0 never does
+	EmptyTimeout time.Duration // closes a room POST /rooms opened that nobody joins; 0 for lobby.DefaultEmptyTimeout
+
+	MaxSpectators     int           // watching a room
+	SpectatorDelay    time.Duration // how far behind the room spectators see it
+	SpectatorInterval time.Duration // how often spectators are sent what came due
+
+	Capture *wirecap.Recorder // records each room's traffic; nil records none
+}
+
+// Server relays messages between the peers of each room:
+//
+//	GET  /rooms          rooms, their peers and traffic
+//	POST /rooms          a new room under a fresh code
+//	GET  /rooms/{code}   one room; as a WebSocket handshake, joins it
+//	GET  /ping           a WebSocket that answers pings and echoes messages,
+//	                     for latency probes
+//	GET  /health         the relay's load and how late its ticks run
+//
+// With a Capture, every room's joins, leaves, messages, controls included,
+// and events are recorded as they happen, for wirecap to play back.
+//
+// RegisterAdmin adds the rooms, with their peers' addresses, and kicking
+// peers and closing rooms to a server's admin API.
+//
+// A peer joins with ?name=NAME, unique in the room, and every message it
+// sends goes verbatim, text or binary, to the room's other peers. With
+// ?events=1 it is also sent the room's events, each a binary game message
+// with a gamepb.RoomEvent body; ?events=json sends them as JSON text
+// instead, the legacy format. Joining a code no room has opens it, and a
+// room closes when its last peer leaves.
+//
+// Rooms follow the lobby's lifecycle: the first peer hosts, peers get
+// ready and the host starts and ends matches, with game messages with a
+// gamepb.Control body, which the relay acts on instead of relaying:
+//
+//	ready, unready        this peer's readiness
+//	start, end            the host's match
+//	host, with a peer     the host hands over
+//	kick, with a peer     the host removes a peer
+//	ping                  holds off the idle timeout
+//
+// The relay still decodes the legacy JSON controls, text messages such as
+// {"lobby":"ready"} or {"lobby":"kick","peer":NAME}. A control that fails
+// is answered with an error event, to its sender alone. Room events come
+// from the relay alone: a peer's message with a RoomEvent body is dropped.
+//
+// A WebSocket to /rooms/{code}?spectate=1 watches an open room instead of
+// joining it, read-only and outside the lobby, for casting: a spectator is
+// sent the room's events and its game messages SpectatorDelay late,
+// batched each SpectatorInterval as binary messages of length-prefixed
+// game messages, see Message.Stream, with each event a message of its own.
+// Inputs, which the events make redundant, and players' addresses are left
+// out, and so are messages that aren't game messages. With ?events=json a
+// spectator is sent the events as JSON text instead. What spectators send
+// is ignored.
+type Server struct {
+	opts  Options
+	lobby *lobby.Lobby
+	stop  chan struct{}
+	once  sync.Once
+
+	mu      sync.Mutex
+	rooms   map[string]*room
+	started time.Time
+	dropped int64           // peers dropped as too slow
+	ticks   int64           // sweeps run
+	lags    []time.Duration // of the latest sweeps, a ring of tickWindow
+}
+
+// NewServer returns an empty relay
+func NewServer(opts Options) *Server {
+	if opts.MaxPeers <= 0 {
+		opts.MaxPeers = DefaultMaxPeers
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.ReadLimit <= 0 {
+		opts.ReadLimit = websocket.DefaultReadLimit
+	}
+	if opts.MaxSpectators <= 0 {
+		opts.MaxSpectators = DefaultMaxSpectators
+	}
+	if opts.SpectatorDelay <= 0 {
+		opts.SpectatorDelay = DefaultSpectatorDelay
+	}
+	if opts.SpectatorInterval <= 0 {
+		opts.SpectatorInterval = DefaultSpectatorInterval
+	}
+	s := &Server{opts: opts, stop: make(chan struct{}), rooms: make(map[string]*room), started: time.Now()}
+	s.lobby = lobby.New(lobby.Options{
+		MaxMembers:   opts.MaxPeers,
+		MinMembers:   opts.MinPeers,
+		IdleTimeout:  opts.IdleTimeout,
+		ReadyTimeout: opts.ReadyTimeout,
+		EmptyTimeout: opts.EmptyTimeout,
+	})
+	crash.Go(s.sweep)
+	return s
+}
+
+// Close stops the relay applying timeouts; connected peers stay
+func (s *Server) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *Server) sweep() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case fired := <-ticker.C:
+			s.mu.Lock()
+			s.dispatch(s.lobby.Sweep())
+			s.tick(time.Since(fired))
+			s.mu.Unlock()
+		}
+	}
+}
+
+// tick records a sweep's lag, from its ticker firing until it was done,
+// which waiting on a busy relay's lock stretches. s.mu is held.
+func (s *Server) tick(lag time.Duration) {
+	if len(s.lags) < tickWindow {
+		s.lags = append(s.lags, lag)
+	} else {
+		s.lags[s.ticks%tickWindow] = lag
+	}
+	s.ticks++
+}
+
+// Health is the relay's load, and how far behind its once-a-second tick
+// runs: a relay keeping up sweeps within a millisecond or so of the
+// ticker, one that isn't waits on its lock behind the messages it relays
+type Health struct {
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+	Rooms         int     `json:"rooms"`
+	Peers         int     `json:"peers"`
+	Spectators    int     `json:"spectators"`
+	Dropped       int64   `json:"dropped"` // peers dropped as too slow, since the relay started
+	Ticks         int64   `json:"ticks"`
+	TickLagMs     float64 `json:"tickLagMs"` // of the latest tick
+	TickLagP99Ms  float64 `json:"tickLagP99Ms"`
+	TickLagMaxMs  float64 `json:"tickLagMaxMs"` // over the latest minute of ticks
+}
+
+// Health reports the relay's load and tick lag
+func (s *Server) Health() Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := Health{UptimeSeconds: time.Since(s.started).Seconds(), Rooms: len(s.rooms), Dropped: s.dropped, Ticks: s.ticks}
+	for _, r := range s.rooms {
+		h.Peers += len(r.peers)
+		h.Spectators += len(r.spectators)
+	}
+	if len(s.lags) == 0 {
+		return h
+	}
+	lags := append([]time.Duration(nil), s.lags...)
+	sort.Slice(lags, func(i, j int) bool { return lags[i] < lags[j] })
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	h.TickLagMs = ms(s.lags[(s.ticks-1)%tickWindow])
+	h.TickLagP99Ms = ms(lags[(len(lags)-1)*99/100])
+	h.TickLagMaxMs = ms(lags[len(lags)-1])
+	return h
+}
+
+// room is a lobby room's connections
+type room struct {
+	code       string
+	peers      []*peer
+	spectators []*spectator
+	messages   int64
+	bytes      int64
+}
+
+type peer struct {
+	name     string
+	addr     string
+	query    string // it joined with
+	joined   time.Time
+	events   eventFormat
+	send     chan message
+	sent     int64 // messages from the peer
+	received int64 // messages to it
+}
+
+type message struct {
+	op    int
+	data  []byte
+	event bool // a spectator's event, sent as a message of its own
+}
+
+// eventFormat is how a peer or spectator takes the room's events, by its
+// events query parameter
+type eventFormat int
+
+const (
+	noEvents    eventFormat = iota
+	protoEvents             // ?events=1: game messages with a RoomEvent body
+	jsonEvents              // ?events=json: text, the legacy format
+)
+
+func parseEventFormat(v string) eventFormat {
+	switch v {
+	case "":
+		return noEvents
+	case "json":
+		return jsonEvents
+	}
+	return protoEvents
+}
+
+// Room describes a room
+type Room struct {
+	Code       string      `json:"code"`
+	Created    time.Time   `json:"created"`
+	State      string      `json:"state"` // as lobby's
+	Host       string      `json:"host,omitempty"`
+	Matches    int         `json:"matches"`
+	Peers      []Peer      `json:"peers"`
+	Spectators []Spectator `json:"spectators"`
+	Messages   int64       `json:"messages"` // relayed, counted once however many peers got them
+	Bytes      int64       `json:"bytes"`
+}
+
+// Peer describes a peer in a room
+type Peer struct {
+	Name     string    `json:"name"`
+	Joined   time.Time `json:"joined"`
+	Ready    bool      `json:"ready"`
+	Sent     int64     `json:"sent"`
+	Received int64     `json:"received"`
+	Addr     string    `json:"addr,omitempty"` // where it connected from, for the admin API only
+}
+
+// Spectator describes a spectator of a room
+type Spectator struct {
+	Name   string    `json:"name"`
+	Joined time.Time `json:"joined"`
+}
+
+// Event tells peers that asked for events what changed in the room: a
+// lobby event type, or error, answering a control that failed
+type Event struct {
+	Event  string   `json:"event"`
+	Room   string   `json:"room"`
+	Peer   string   `json:"peer"`
+	Peers  []string `json:"peers"` // in the room after it, in the order they joined
+	Host   string   `json:"host,omitempty"`
+	Ready  []string `json:"ready,omitempty"` // peers ready
+	State  string   `json:"state,omitempty"`
+	Reason string   `json:"reason,omitempty"` // why a peer left
+	Error  string   `json:"error,omitempty"`
+}
+
+// proto is the event as a game message's body
+func (e Event) proto() *gamepb.RoomEvent {
+	return &gamepb.RoomEvent{Event: e.Event, Room: e.Room, Peer: e.Peer, Peers: e.Peers, Host: e.Host,
+		Ready: e.Ready, State: e.State, Reason: e.Reason, Error: e.Error}
+}
+
+// eventFromProto converts a game message's room event body
+func eventFromProto(re *gamepb.RoomEvent) Event {
+	return Event{Event: re.GetEvent(), Room: re.GetRoom(), Peer: re.GetPeer(), Peers: re.GetPeers(), Host: re.GetHost(),
+		Ready: re.GetReady(), State: re.GetState(), Reason: re.GetReason(), Error: re.GetError()}
+}
+
+// legacyControl decodes a control in its legacy JSON form
+func legacyControl(data []byte) (*gamepb.Control, error) {
+	var c struct {
+		Lobby string `json:"lobby"`
+		Peer  string `json:"peer,omitempty"`
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &gamepb.Control{Lobby: c.Lobby, Peer: c.Peer}, nil
+}
+
+// Rooms describes the open rooms by code
+func (s *Server) Rooms() []Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Room{}
+	for _, lr := range s.lobby.Rooms() {
+		if r, ok := s.rooms[lr.Code]; ok {
+			out = append(out, r.describe(lr))
+		}
+	}
+	return out
+}
+
+// Open opens an empty room under a fresh code
+func (s *Server) Open() Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lr, _ := s.lobby.Open("")
+	r := &room{code: lr.Code}
+	s.rooms[r.code] = r
+	return r.describe(lr)
+}
+
+// describe merges the lobby's view of the room with the relay's
+func (r *room) describe(lr lobby.Room) Room {
+	out := Room{Code: r.code, Created: lr.Created, State: lr.State, Host: lr.Host, Matches: lr.Matches,
+		Peers: []Peer{}, Spectators: []Spectator{}, Messages: r.messages, Bytes: r.bytes}
+	ready := map[string]bool{}
+	for _, m := range lr.Members {
+		ready[m.Name] = m.Ready
+	}
+	for _, p := range r.peers {
+		out.Peers = append(out.Peers, Peer{Name: p.name, Joined: p.joined, Ready: ready[p.name], Sent: p.sent, Received: p.received})
+	}
+	for _, sp := range r.spectators {
+		out.Spectators = append(out.Spectators, Spectator{Name: sp.name, Joined: sp.joined})
+	}
+	return out
+}
+
+func (r *room) peer(name string) *peer {
+	for _, p := range r.peers {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// ServeHTTP routes the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "rooms":
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, s.Rooms())
+		case http.MethodPost:
+			writeJSON(w, http.StatusCreated, s.Open())
+		default:
+			methodNotAllowed(w, "GET, POST")
+		}
+	case len(parts) == 2 && parts[0] == "rooms":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		code := lobby.NormalizeCode(parts[1])
+		if !lobby.ValidCode(code) {
+			httpError(w, http.StatusBadRequest, "bad room code %q", parts[1])
+			return
+		}
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			if r.URL.Query().Get("spectate") == "1" {
+				s.spectate(w, r, code)
+			} else {
+				s.join(w, r, code)
+			}
+			return
+		}
+		s.mu.Lock()
+		room, ok := s.rooms[code]
+		var desc Room
+		if ok {
+			lr, _ := s.lobby.Room(code)
+			desc = room.describe(lr)
+		}
+		s.mu.Unlock()
+		if !ok {
+			httpError(w, http.StatusNotFound, "no room %s", code)
+			return
+		}
+		writeJSON(w, http.StatusOK, desc)
+	case len(parts) == 1 && parts[0] == "ping":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		echo(w, r, s.opts.ReadLimit)
+	case len(parts) == 1 && parts[0] == "health":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.Health())
+	default:
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+	}
+}
+
+// echo upgrades the request and sends every message back; pings are
+// answered as on any connection
+func echo(w http.ResponseWriter, r *http.Request, limit int64) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.ReadLimit = limit
+	for {
+		op, data, err := conn.ReadMessage()
+		if err != nil || conn.WriteMessage(op, data) != nil {
+			return
+		}
+	}
+}
+
+// join upgrades the request and relays the peer's messages until it goes
+func (s *Server) join(w http.ResponseWriter, r *http.Request, code string) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = r.RemoteAddr
+	}
+	if err := s.admit(code, name); err != nil {
+		httpError(w, http.StatusConflict, "%v", err)
+		return
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	conn.ReadLimit = s.opts.ReadLimit
+	p := &peer{name: name, addr: r.RemoteAddr, query: r.URL.RawQuery, joined: time.Now(), events: parseEventFormat(r.URL.Query().Get("events")), send: make(chan message, s.opts.QueueSize)}
+	if err := s.add(code, p); err != nil {
+		// another peer took the name or the last place, or a match
+		// started, since admit
+		conn.Close()
+		return
+	}
+
+	// the writer owns sending; closing send, when the peer leaves or is
+	// dropped, ends it and the connection
+	written := make(chan struct{})
+	crash.Go(func() {
+		defer close(written)
+		for m := range p.send {
+			if conn.WriteMessage(m.op, m.data) != nil {
+				break
+			}
+		}
+		conn.Close()
+	})
+	for {
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		s.relay(code, p, message{op: op, data: data})
+	}
+	s.leave(code, p)
+	<-written
+}
+
+// admit checks a peer may join before the handshake, so a refusal is an
+// HTTP error the client can read
+func (s *Server) admit(code, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[code]; !ok {
+		return nil
+	}
+	return s.lobby.CanJoin(code, name)
+}
+
+func (s *Server) add(code string, p *peer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rooms[code]
+	if !ok {
+		if _, err := s.lobby.Open(code); err != nil {
+			return err
+		}
+		r = &room{code: code}
+		s.rooms[code] = r
+	}
+	events, err := s.lobby.Join(code, p.name)
+	if err != nil {
+		return err
+	}
+	r.peers = append(r.peers, p)
+	s.opts.Capture.Record(code, wirecap.Record{Kind: wirecap.KindJoin, Peer: p.name, Addr: p.addr, Query: p.query})
+	s.dispatch(events)
+	slog.Debug("relay: peer joined", "room", code, "peer", p.name, "addr", p.addr)
+	return nil
+}
+
+// relay queues m for the room's other peers, dropping any too far behind
+func (s *Server) relay(code string, from *peer, m message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rooms[code]
+	if !ok {
+		return
+	}
+	s.opts.Capture.Record(code, wirecap.Message(from.name, m.op, m.data))
+	if m.op == websocket.TextMessage && bytes.HasPrefix(m.data, controlPrefix) {
+		c, err := legacyControl(m.data)
+		if err != nil {
+			s.refuse(r, from, err)
+			return
+		}
+		s.control(r, from, c)
+		return
+	}
+	var gm *gamepb.Message
+	if m.op == websocket.BinaryMessage {
+		// a binary message that isn't a game message is relayed all the same
+		gm, _ = gamepb.Unmarshal(m.data)
+	}
+	if c := gm.GetControl(); c != nil {
+		s.control(r, from, c)
+		return
+	}
+	if gm.GetRoom() != nil {
+		return
+	}
+	s.lobby.Touch(code, from.name)
+	from.sent++
+	r.messages++
+	r.bytes += int64(len(m.data))
+	var slow []*peer
+	for _, p := range r.peers {
+		if p == from {
+			continue
+		}
+		select {
+		case p.send <- m:
+			p.received++
+		default:
+			slow = append(slow, p)
+		}
+	}
+	for _, p := range slow {
+		slog.Warn("relay: dropped a peer too slow to keep up", "room", code, "peer", p.name, "addr", p.addr)
+		s.remove(r, p)
+	}
+	s.dropped += int64(len(slow))
+	if gm != nil && len(r.spectators) > 0 {
+		if frame, ok := spectatorFrame(gm); ok {
+			s.watch(r, func(*spectator) message { return message{op: websocket.BinaryMessage, data: frame} })
+		}
+	}
+}
+
+func (s *Server) leave(code string, p *peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.rooms[code]; ok {
+		s.remove(r, p)
+	}
+	slog.Debug("relay: peer left", "room", code, "peer", p.name)
+}
+
+// control acts on a lobby control from a peer. s.mu is held.
+func (s *Server) control(r *room, from *peer, c *gamepb.Control) {
+	var events []lobby.Event
+	var err error
+	switch c.GetLobby() {
+	case "ready", "unready":
+		events, err = s.lobby.SetReady(r.code, from.name, c.GetLobby() == "ready")
+	case "start":
+		events, err = s.lobby.Start(r.code, from.name)
+	case "end":
+		events, err = s.lobby.End(r.code, from.name)
+	case "host":
+		events, err = s.lobby.Transfer(r.code, from.name, c.GetPeer())
+	case "kick":
+		events, err = s.lobby.Kick(r.code, from.name, c.GetPeer())
+	case "ping":
+		s.lobby.Touch(r.code, from.name)
+	default:
+		err = fmt.Errorf("unknown lobby control %q", c.GetLobby())
+	}
+	if err != nil {
+		s.refuse(r, from, err)
+		return
+	}
+	s.dispatch(events)
+}
+
+// refuse answers a control that failed with an error event, to its
+// sender alone. s.mu is held.
+func (s *Server) refuse(r *room, from *peer, err error) {
+	lr, _ := s.lobby.Room(r.code)
+	ev := Event{Event: "error", Room: r.code, Peer: from.name, Peers: lr.Names(), Host: lr.Host,
+		Ready: lr.ReadyNames(), State: lr.State, Error: err.Error()}
+	s.opts.Capture.Event(r.code, from.name, ev)
+	send(from, ev)
+}
+
+// remove takes p out of r, if it's still there, and out of the lobby.
+// s.mu is held.
+func (s *Server) remove(r *room, p *peer) {
+	if s.drop(r, p) {
+		s.dispatch(s.lobby.Leave(r.code, p.name))
+	}
+}
+
+// drop takes p off r's connections, if it's still there. s.mu is held.
+func (s *Server) drop(r *room, p *peer) bool {
+	if !r.drop(p) {
+		return false
+	}
+	s.opts.Capture.Record(r.code, wirecap.Record{Kind: wirecap.KindLeave, Peer: p.name})
+	return true
+}
+
+// drop takes p off r's connections, if it's still there
+func (r *room) drop(p *peer) bool {
+	for i, q := range r.peers {
+		if q == p {
+			r.peers = append(r.peers[:i], r.peers[i+1:]...)
+			close(p.send)
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch carries out lobby events, sending them to the peers that asked
+// for them: peers the lobby dropped are disconnected, closed rooms
+// forgotten. A first peer's becoming host goes without saying, as its
+// join event names the host. s.mu is held.
+func (s *Server) dispatch(events []lobby.Event) {
+	for i, e := range events {
+		r, ok := s.rooms[e.Room.Code]
+		if !ok {
+			continue
+		}
+		switch e.Type {
+		case lobby.EventClose:
+			for _, sp := range r.spectators {
+				sp.finish()
+			}
+			delete(s.rooms, r.code)
+			s.opts.Capture.Finish(r.code)
+			continue
+		case lobby.EventLeave:
+			// cut off the peer before telling the others, so it isn't told
+			if p := r.peer(e.Member); p != nil {
+				s.drop(r, p)
+			}
+		case lobby.EventHost:
+			if i > 0 && events[i-1].Type == lobby.EventJoin && events[i-1].Member == e.Member {
+				continue
+			}
+		}
+		ev := Event{Event: e.Type, Room: r.code, Peer: e.Member, Peers: e.Room.Names(), Host: e.Room.Host,
+			Ready: e.Room.ReadyNames(), State: e.Room.State, Reason: e.Reason}
+		s.opts.Capture.Event(r.code, "", ev)
+		for _, p := range r.peers {
+			if p.events != noEvents {
+				send(p, ev)
+			}
+		}
+		if len(r.spectators) > 0 {
+			s.watchEvent(r, ev)
+		}
+	}
+}
+
+// send queues an event for p; a peer too far behind to take it is
+// dropped by the next relay
+func send(p *peer, e Event) {
+	m, ok := p.events.encode(e)
+	if !ok {
+		return
+	}
+	select {
+	case p.send <- m:
+	default:
+	}
+}
+
+// encode is the message an event goes as in the format
+func (f eventFormat) encode(e Event) (message, bool) {
+	if f == jsonEvents {
+		data, err := json.Marshal(e)
+		return message{op: websocket.TextMessage, data: data}, err == nil
+	}
+	data, err := gamepb.Marshal(&gamepb.Message{Body: &gamepb.Message_Room{Room: e.proto()}})
+	return message{op: websocket.BinaryMessage, data: data}, err == nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
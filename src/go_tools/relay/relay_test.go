@@ -0,0 +1,536 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/admin"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/lobby"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/wirecap"
+)
+
+func joinRoom(t *testing.T, srv *httptest.Server, code, query string) *websocket.Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/rooms/"+code+"?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func read(t *testing.T, c *websocket.Conn) (int, string) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	op, data, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return op, string(data)
+}
+
+// readEvent reads an event as a peer that joined with events=1 gets it, a
+// game message, or with events=json, text
+func readEvent(t *testing.T, c *websocket.Conn) Event {
+	t.Helper()
+	op, data := read(t, c)
+	if op == websocket.TextMessage {
+		var e Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatalf("%q: %v", data, err)
+		}
+		return e
+	}
+	m, err := gamepb.Unmarshal([]byte(data))
+	if err != nil || m.GetRoom() == nil {
+		t.Fatalf("%q is no room event: %v", data, err)
+	}
+	return eventFromProto(m.GetRoom())
+}
+
+func TestRelayForwardsWithinRooms(t *testing.T) {
+	s := NewServer(Options{MaxPeers: 2})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/rooms", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opened Room
+	json.NewDecoder(resp.Body).Decode(&opened)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || len(opened.Code) != lobby.CodeLength {
+		t.Fatalf("open: %s %+v", resp.Status, opened)
+	}
+
+	alice := joinRoom(t, srv, opened.Code, "name=alice&events=1")
+	if e := readEvent(t, alice); e.Event != "join" || e.Peer != "alice" {
+		t.Errorf("own join = %+v", e)
+	}
+	bob := joinRoom(t, srv, strings.ToLower(opened.Code), "name=bob")
+	if e := readEvent(t, alice); e.Peer != "bob" || strings.Join(e.Peers, ",") != "alice,bob" {
+		t.Errorf("bob's join = %+v", e)
+	}
+	other := joinRoom(t, srv, "OTHER", "name=carol")
+
+	// room events come from the relay alone
+	spoof, _ := gamepb.Marshal(&gamepb.Message{Body: &gamepb.Message_Room{Room: &gamepb.RoomEvent{Event: "kick", Room: opened.Code, Peer: "alice"}}})
+	bob.WriteMessage(websocket.BinaryMessage, spoof)
+	bob.WriteMessage(websocket.BinaryMessage, []byte{1, 2, 3})
+	if op, got := read(t, alice); op != websocket.BinaryMessage || got != "\x01\x02\x03" {
+		t.Errorf("alice got %d %q", op, got)
+	}
+	alice.WriteText("move left")
+	if _, got := read(t, bob); got != "move left" {
+		t.Errorf("bob got %q", got)
+	}
+	// the other room hears nothing of it
+	other.WriteText("alone")
+	other.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := other.ReadMessage(); err == nil {
+		t.Errorf("carol got %q", data)
+	}
+
+	// the room is full, and names are unique in it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/rooms/"+opened.Code+"?name=dave", nil); err == nil {
+		t.Error("joined a full room")
+	}
+
+	rooms := s.Rooms()
+	if len(rooms) != 2 || rooms[0].Code != "OTHER" && rooms[1].Code != "OTHER" {
+		t.Fatalf("rooms = %+v", rooms)
+	}
+	for _, r := range rooms {
+		if r.Code == opened.Code && (r.Messages != 2 || r.Bytes != 12 || r.Peers[1].Sent != 1 || r.Peers[1].Received != 1) {
+			t.Errorf("room = %+v", r)
+		}
+	}
+
+	bob.Close()
+	if e := readEvent(t, alice); e.Event != "leave" || e.Peer != "bob" || strings.Join(e.Peers, ",") != "alice" {
+		t.Errorf("bob's leave = %+v", e)
+	}
+	alice.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Rooms()) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rooms := s.Rooms(); len(rooms) != 1 || rooms[0].Code != "OTHER" {
+		t.Errorf("after everyone left, rooms = %+v", rooms)
+	}
+	if resp, _ := http.Get(srv.URL + "/rooms/" + opened.Code); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("closed room: %s", resp.Status)
+	}
+}
+
+func TestRelayDropsSlowPeers(t *testing.T) {
+	s := NewServer(Options{QueueSize: 4})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	fast := joinRoom(t, srv, "SLOW", "name=fast")
+	joinRoom(t, srv, "SLOW", "name=stalled") // never reads
+	// enough to fill the socket buffers and then the queue
+	payload := strings.Repeat("x", 64<<10)
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if rooms := s.Rooms(); len(rooms) == 1 && len(rooms[0].Peers) == 1 {
+			return
+		}
+		if err := fast.WriteText(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Errorf("stalled peer still in %+v", s.Rooms()[0].Peers)
+}
+
+func TestRelayLobbyFlow(t *testing.T) {
+	s := NewServer(Options{MaxPeers: 3})
+	defer s.Close()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dial := func(name string) *Client {
+		c, err := Dial(ctx, srv.URL, "game", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	await := func(c *Client, event, peer string) Event {
+		t.Helper()
+		e, err := c.Await(ctx, func(e Event) bool { return e.Event == event && e.Peer == peer })
+		if err != nil {
+			t.Fatalf("%s awaiting %s %s: %v", c.Name, event, peer, err)
+		}
+		return e
+	}
+
+	alice := dial("alice")
+	if e := await(alice, "join", "alice"); e.Host != "alice" || e.State != lobby.StateWaiting {
+		t.Errorf("own join = %+v", e)
+	}
+	bob := dial("bob")
+	await(alice, "join", "bob")
+	await(bob, "join", "bob")
+
+	// only the host starts, and only once everyone is ready
+	bob.Start()
+	if _, err := bob.Await(ctx, func(Event) bool { return false }); err == nil || !strings.Contains(err.Error(), "host") {
+		t.Errorf("guest start: %v", err)
+	}
+	alice.Ready(true)
+	await(bob, "ready", "alice")
+	bob.Ready(true)
+	if e := await(alice, "ready", "bob"); strings.Join(e.Ready, ",") != "alice,bob" {
+		t.Errorf("ready = %+v", e)
+	}
+	alice.Start()
+	await(alice, "start", "alice")
+	await(bob, "start", "alice")
+	if r := s.Rooms()[0]; r.State != lobby.StatePlaying || r.Matches != 1 || !r.Peers[1].Ready {
+		t.Errorf("room mid-match = %+v", r)
+	}
+
+	// controls aren't relayed; game messages still are
+	bob.Send(websocket.TextMessage, []byte("drop"))
+	if m, err := alice.Recv(ctx); err != nil || m.Event != nil || string(m.Data) != "drop" {
+		t.Errorf("alice got %+v %v", m, err)
+	}
+	input := &gamepb.Message{Session: "GAME", Seq: 1, Body: &gamepb.Message_Input{Input: &gamepb.Input{Player: "bob", Action: gamepb.Action_ACTION_HOLD}}}
+	bob.SendGame(input)
+	if m, err := alice.Recv(ctx); err != nil {
+		t.Error(err)
+	} else if got, err := m.Game(); err != nil || got.GetInput().GetAction() != gamepb.Action_ACTION_HOLD {
+		t.Errorf("alice got game message %v %v", got, err)
+	}
+	alice.End()
+	await(bob, "end", "alice")
+
+	// the host hands over and kicks, then leaves, and the host passes on
+	carol := dial("carol")
+	await(alice, "join", "carol")
+	alice.Transfer("carol")
+	await(alice, "host", "carol")
+	carol.Kick("bob")
+	if e := await(alice, "leave", "bob"); e.Reason != lobby.ReasonKicked || strings.Join(e.Peers, ",") != "alice,carol" {
+		t.Errorf("kick = %+v", e)
+	}
+	for {
+		if _, err := bob.Recv(ctx); err != nil {
+			if ctx.Err() != nil {
+				t.Error("kicked peer still connected")
+			}
+			break
+		}
+	}
+	carol.Close()
+	if e := await(alice, "host", "alice"); e.Host != "alice" || alice.Room().Host != "alice" {
+		t.Errorf("host after carol left = %+v", e)
+	}
+}
+
+func TestRelayDropsIdlePeers(t *testing.T) {
+	s := NewServer(Options{IdleTimeout: time.Second})
+	defer s.Close()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	quiet, err := Dial(ctx, srv.URL, "IDLE", "quiet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer quiet.Close()
+	chatty, err := Dial(ctx, srv.URL, "IDLE", "chatty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chatty.Close()
+	go func() {
+		for ctx.Err() == nil {
+			chatty.Ping()
+			time.Sleep(200 * time.Millisecond)
+		}
+	}()
+	e, err := chatty.Await(ctx, func(e Event) bool { return e.Event == "leave" })
+	if err != nil || e.Peer != "quiet" || e.Reason != lobby.ReasonIdle || e.Host != "chatty" {
+		t.Errorf("leave = %+v %v", e, err)
+	}
+}
+
+func TestRelaySpectatorsWatchDelayed(t *testing.T) {
+	const delay = 300 * time.Millisecond
+	s := NewServer(Options{SpectatorDelay: delay, SpectatorInterval: 20 * time.Millisecond})
+	defer s.Close()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := Spectate(ctx, srv.URL, "NONE", "caster"); err == nil {
+		t.Error("spectated a room nobody opened")
+	}
+	alice, err := Dial(ctx, srv.URL, "CAST", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+	caster, err := Spectate(ctx, srv.URL, "CAST", "caster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caster.Close()
+	bob, err := Dial(ctx, srv.URL, "CAST", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Await(ctx, func(e Event) bool { return e.Event == "join" && e.Peer == "bob" }); err != nil {
+		t.Fatal(err)
+	}
+	if r := s.Rooms()[0]; len(r.Peers) != 2 || len(r.Spectators) != 1 || r.Spectators[0].Name != "caster" {
+		t.Errorf("room = %+v", r)
+	}
+
+	sent := time.Now()
+	caster.Send(websocket.TextMessage, []byte(`{"lobby":"start"}`)) // ignored
+	bob.SendGame(&gamepb.Message{Session: "GAME", Seq: 1, Body: &gamepb.Message_Start{Start: &gamepb.SessionStart{
+		Level: "pit", Players: []*gamepb.Player{{Id: "bob", Address: "10.0.0.7"}}}}})
+	bob.SendGame(&gamepb.Message{Session: "GAME", Seq: 2, Body: &gamepb.Message_Input{Input: &gamepb.Input{Player: "bob", Action: gamepb.Action_ACTION_HOLD}}})
+	bob.Send(websocket.TextMessage, []byte("chatter"))
+	bob.SendGame(&gamepb.Message{Session: "GAME", Seq: 3, Body: &gamepb.Message_Event{Event: &gamepb.Event{Player: "bob", Type: gamepb.EventType_EVENT_TYPE_LOCK}}})
+
+	if e, err := caster.Await(ctx, func(e Event) bool { return e.Event == "join" }); err != nil || e.Peer != "bob" {
+		t.Fatalf("caster's first event = %+v %v", e, err)
+	}
+	var stream []*gamepb.Message
+	for len(stream) < 2 {
+		m, err := caster.Recv(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Event != nil {
+			t.Fatalf("caster got event %+v, want the game", m.Event)
+		}
+		if time.Since(sent) < delay {
+			t.Errorf("caster got the game %s after it was sent, before the delay", time.Since(sent))
+		}
+		got, err := m.Stream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, got...)
+	}
+	if len(stream) != 2 || stream[0].GetSeq() != 1 || stream[1].GetSeq() != 3 {
+		t.Fatalf("caster's stream = %v, want the start and the lock", stream)
+	}
+	if addr := stream[0].GetStart().GetPlayers()[0].GetAddress(); addr != "" {
+		t.Errorf("caster saw the address %q", addr)
+	}
+	if s.Rooms()[0].State != lobby.StateWaiting {
+		t.Error("a spectator's control was acted on")
+	}
+
+	// the room closing ends the stream once its last events are sent
+	bob.Close()
+	alice.Close()
+	for seen := 0; ; seen++ {
+		m, err := caster.Recv(ctx)
+		if err != nil {
+			if ctx.Err() != nil || seen < 2 {
+				t.Errorf("stream ended after %d events: %v", seen, err)
+			}
+			break
+		}
+		if m.Event == nil {
+			t.Errorf("caster got game message %v after the match", m.Data)
+		}
+	}
+}
+
+func TestRelayAdminKicksAndCloses(t *testing.T) {
+	s := NewServer(Options{})
+	defer s.Close()
+	api := admin.New("relay", nil)
+	s.RegisterAdmin(api)
+	srv := httptest.NewServer(admin.Mount(api, s))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dial := func(name string) *Client {
+		c, err := Dial(ctx, srv.URL, "game", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	alice, bob := dial("alice"), dial("bob")
+	if _, err := alice.Await(ctx, func(e Event) bool { return e.Event == "join" && e.Peer == "bob" }); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := admin.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rooms []Room
+	if err := c.Do(ctx, http.MethodGet, "rooms", nil, &rooms); err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 1 || len(rooms[0].Peers) != 2 || rooms[0].Peers[0].Addr == "" {
+		t.Fatalf("admin rooms = %+v", rooms)
+	}
+	if public := s.Rooms(); public[0].Peers[0].Addr != "" {
+		t.Error("the public room listing gives peers' addresses")
+	}
+
+	// the host goes like any other peer
+	if err := c.Do(ctx, http.MethodDelete, "rooms/game/peers/alice", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	e, err := bob.Await(ctx, func(e Event) bool { return e.Event == "leave" })
+	if err != nil || e.Peer != "alice" || e.Reason != lobby.ReasonRemoved || e.Host != "bob" {
+		t.Errorf("bob saw %+v, %v", e, err)
+	}
+	if _, err := alice.Recv(ctx); err == nil {
+		t.Error("kicked peer still connected")
+	}
+	if err := c.Do(ctx, http.MethodDelete, "rooms/GAME/peers/alice", nil, nil); err == nil || !strings.Contains(err.Error(), "not in the room") {
+		t.Errorf("kick a peer gone: %v", err)
+	}
+
+	if err := c.Do(ctx, http.MethodDelete, "rooms/GAME", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if _, err := bob.Recv(ctx); err != nil {
+			break
+		}
+	}
+	if rooms := s.Rooms(); len(rooms) != 0 {
+		t.Errorf("rooms after close = %+v", rooms)
+	}
+}
+
+// captureRoom runs a room on a relay recording into a fresh directory
+// until it closes, and reads back its capture
+func captureRoom(t *testing.T, run func(srv *httptest.Server)) *wirecap.Capture {
+	t.Helper()
+	rec, err := wirecap.NewRecorder(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(Options{Capture: rec})
+	defer s.Close()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	run(srv)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.Rooms()) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := rec.Files()
+	if len(files) != 1 {
+		t.Fatalf("capture files = %v", files)
+	}
+	c, err := wirecap.Load(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// messages lists a capture's messages as peer: what
+func messages(c *wirecap.Capture) []string {
+	var out []string
+	for _, r := range c.Records {
+		if r.Kind == wirecap.KindMessage {
+			op, data := r.Data()
+			out = append(out, fmt.Sprintf("%s: %d %q", r.Peer, op, data))
+		}
+	}
+	return out
+}
+
+func TestRelayCapturePlaysBack(t *testing.T) {
+	const pause = 20 * time.Millisecond
+	captured := captureRoom(t, func(srv *httptest.Server) {
+		// the legacy JSON controls and events
+		alice := joinRoom(t, srv, "GAME", "name=alice&events=json")
+		readEvent(t, alice)
+		bob := joinRoom(t, srv, "GAME", "name=bob")
+		readEvent(t, alice)
+		time.Sleep(pause)
+		bob.WriteMessage(websocket.BinaryMessage, []byte{1, 2, 3})
+		read(t, alice)
+		time.Sleep(pause)
+		alice.WriteText("move left")
+		read(t, bob)
+		time.Sleep(pause)
+		alice.WriteText(`{"lobby":"kick","peer":"nobody"}`)
+		if op, data := read(t, alice); op != websocket.TextMessage || !strings.Contains(data, `"event":"error"`) {
+			t.Fatalf("kick nobody = %d %q", op, data)
+		}
+		time.Sleep(pause)
+		alice.Close()
+		time.Sleep(pause)
+		bob.Close()
+	})
+	if captured.Room != "GAME" || strings.Join(captured.Peers(), ",") != "alice,bob" {
+		t.Fatalf("capture of %s with %v", captured.Room, captured.Peers())
+	}
+	want := messages(captured)
+	if len(want) != 3 {
+		t.Fatalf("captured messages %q", want)
+	}
+	var kinds []string
+	for _, r := range captured.Records {
+		kind := r.Kind
+		if r.To != "" {
+			kind += " to " + r.To
+		}
+		kinds = append(kinds, kind)
+	}
+	// joins and leaves come before their events, a control before its
+	// answer, and bob hosts once alice leaves
+	if got := strings.Join(kinds, ","); got != "join,event,join,event,message,message,message,event to alice,leave,event,event,leave,event" {
+		t.Errorf("captured %s", got)
+	}
+
+	var stats wirecap.PlayStats
+	played := captureRoom(t, func(srv *httptest.Server) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var err error
+		if stats, err = wirecap.Play(ctx, captured, srv.URL, wirecap.PlayOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if stats.Joined != 2 || stats.Sent != 3 || stats.Failed != 0 {
+		t.Errorf("play stats = %+v", stats)
+	}
+	if got := messages(played); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("played back\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if strings.Join(played.Peers(), ",") != "alice,bob" {
+		t.Errorf("played back peers %v", played.Peers())
+	}
+}
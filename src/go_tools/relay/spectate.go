@@ -0,0 +1,223 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+// maxSpectatorBacklog bounds the bytes a spectator holds for its delay; a
+// spectator past it is dropped as too slow
+const maxSpectatorBacklog = 16 << 20
+
+// spectator is a read-only watcher of a room, sent what the room sees a
+// delay late
+type spectator struct {
+	name   string
+	joined time.Time
+	events eventFormat
+
+	mu       sync.Mutex
+	pending  []stamped
+	backlog  int  // bytes pending
+	finished bool // nothing more is coming
+}
+
+// stamped is a message and when the room saw it
+type stamped struct {
+	message
+	at time.Time
+}
+
+// push holds m for the spectator's delay, reporting false when the
+// spectator is too far behind to take it
+func (sp *spectator) push(m message, at time.Time) bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.backlog+len(m.data) > maxSpectatorBacklog {
+		return false
+	}
+	sp.pending = append(sp.pending, stamped{message: m, at: at})
+	sp.backlog += len(m.data)
+	return true
+}
+
+// finish tells the spectator nothing more is coming; what's pending is
+// still sent when it comes due
+func (sp *spectator) finish() {
+	sp.mu.Lock()
+	sp.finished = true
+	sp.mu.Unlock()
+}
+
+// due takes the messages the room saw by cutoff, reporting whether that
+// was the last of them
+func (sp *spectator) due(cutoff time.Time) ([]message, bool) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	n := 0
+	for n < len(sp.pending) && !sp.pending[n].at.After(cutoff) {
+		sp.backlog -= len(sp.pending[n].data)
+		n++
+	}
+	out := make([]message, n)
+	for i := range out {
+		out[i] = sp.pending[i].message
+	}
+	sp.pending = sp.pending[n:]
+	return out, sp.finished && len(sp.pending) == 0
+}
+
+// spectatorFrame is a relayed game message as spectators get it: not an
+// input, without players' addresses, length-prefixed to be batched
+func spectatorFrame(gm *gamepb.Message) ([]byte, bool) {
+	switch body := gm.GetBody().(type) {
+	case *gamepb.Message_Input:
+		return nil, false
+	case *gamepb.Message_Start:
+		for _, p := range body.Start.GetPlayers() {
+			p.Address = ""
+		}
+	}
+	var buf bytes.Buffer
+	if err := gamepb.Write(&buf, gm); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// watch holds the message each of the room's spectators gets for their
+// delay, dropping any too far behind. s.mu is held.
+func (s *Server) watch(r *room, m func(*spectator) message) {
+	now := time.Now()
+	kept := r.spectators[:0]
+	for _, sp := range r.spectators {
+		if sp.push(m(sp), now) {
+			kept = append(kept, sp)
+		} else {
+			sp.finish()
+		}
+	}
+	r.spectators = kept
+}
+
+// watchEvent holds an event for the room's spectators, a length-prefixed
+// game message or, for those that asked, JSON text. s.mu is held.
+func (s *Server) watchEvent(r *room, e Event) {
+	var frame bytes.Buffer
+	gamepb.Write(&frame, &gamepb.Message{Body: &gamepb.Message_Room{Room: e.proto()}})
+	text, _ := json.Marshal(e)
+	s.watch(r, func(sp *spectator) message {
+		if sp.events == jsonEvents {
+			return message{op: websocket.TextMessage, data: text, event: true}
+		}
+		return message{op: websocket.BinaryMessage, data: frame.Bytes(), event: true}
+	})
+}
+
+// spectate upgrades the request and sends the spectator the room, delayed,
+// until it closes or the spectator goes
+func (s *Server) spectate(w http.ResponseWriter, r *http.Request, code string) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = r.RemoteAddr
+	}
+	s.mu.Lock()
+	rm, ok := s.rooms[code]
+	full := ok && len(rm.spectators) >= s.opts.MaxSpectators
+	s.mu.Unlock()
+	switch {
+	case !ok:
+		httpError(w, http.StatusNotFound, "no room %s", code)
+		return
+	case full:
+		httpError(w, http.StatusConflict, "room %s has %d spectators, the most it takes", code, s.opts.MaxSpectators)
+		return
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	sp := &spectator{name: name, joined: time.Now(), events: parseEventFormat(r.URL.Query().Get("events"))}
+	s.mu.Lock()
+	rm, ok = s.rooms[code]
+	if ok {
+		rm.spectators = append(rm.spectators, sp)
+	}
+	s.mu.Unlock()
+	if !ok {
+		// the room closed since the check
+		conn.Close()
+		return
+	}
+
+	// spectators only read; reading notices them going
+	gone := make(chan struct{})
+	crash.Go(func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	ticker := time.NewTicker(s.opts.SpectatorInterval)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-gone:
+			done = true
+		case now := <-ticker.C:
+			var msgs []message
+			msgs, done = sp.due(now.Add(-s.opts.SpectatorDelay))
+			if writeBatched(conn, msgs) != nil {
+				done = true
+			}
+		}
+	}
+	s.mu.Lock()
+	if rm, ok := s.rooms[code]; ok {
+		for i, other := range rm.spectators {
+			if other == sp {
+				rm.spectators = append(rm.spectators[:i], rm.spectators[i+1:]...)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	conn.Close()
+	<-gone
+}
+
+// writeBatched sends msgs in order, each run of game frames as one binary
+// message and each event as a message of its own
+func writeBatched(conn *websocket.Conn, msgs []message) error {
+	var batch []byte
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := conn.WriteMessage(websocket.BinaryMessage, batch)
+		batch = nil
+		return err
+	}
+	for _, m := range msgs {
+		if !m.event {
+			batch = append(batch, m.data...)
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if err := conn.WriteMessage(m.op, m.data); err != nil {
+			return err
+		}
+	}
+	return flush()
+}
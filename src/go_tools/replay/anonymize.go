@@ -0,0 +1,130 @@
+package replay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Replay fields an Anonymizer handles
+const (
+	FieldPlayerID   = "player_id" // Player.ID and every reference to the player
+	FieldPlayerName = "player_name"
+	FieldAddress    = "address"
+	FieldChat       = "chat" // chat message text
+)
+
+// What an Anonymizer does with a field
+const (
+	AnonymizeKeep  = "keep"
+	AnonymizeHash  = "hash"  // replaced by a salted hash, the same in every replay
+	AnonymizeStrip = "strip" // removed; player IDs, which replays need, become p1, p2, ...
+)
+
+// hashPrefix marks hashed values, so anonymizing a replay twice leaves it
+// unchanged
+const hashPrefix = "anon-"
+
+var anonymizedFields = []string{FieldPlayerID, FieldPlayerName, FieldAddress, FieldChat}
+
+// Anonymizer strips or hashes identifying fields of replays, so datasets
+// can be shared outside the studio
+type Anonymizer struct {
+	Fields map[string]string `json:"fields"` // action per field; missing fields are kept
+	Salt   string            `json:"salt"`   // without one, hashed IDs can be recovered by guessing
+}
+
+// NewAnonymizer checks the field actions and returns an anonymizer
+func NewAnonymizer(fields map[string]string, salt string) (*Anonymizer, error) {
+	known := make(map[string]bool, len(anonymizedFields))
+	for _, f := range anonymizedFields {
+		known[f] = true
+	}
+	for field, action := range fields {
+		if !known[field] {
+			return nil, fmt.Errorf("unknown replay field %q, want one of %s", field, strings.Join(anonymizedFields, ", "))
+		}
+		switch action {
+		case AnonymizeKeep, AnonymizeHash, AnonymizeStrip:
+		default:
+			return nil, fmt.Errorf("field %s: unknown action %q, want keep, hash or strip", field, action)
+		}
+	}
+	return &Anonymizer{Fields: fields, Salt: salt}, nil
+}
+
+// Apply anonymizes the replay in place. Its signature, of the replay as
+// recorded, is dropped: an anonymized replay is unsigned.
+func (a *Anonymizer) Apply(r *Replay) {
+	r.Signature = nil
+	ids := make(map[string]string, len(r.Players))
+	for i := range r.Players {
+		p := &r.Players[i]
+		switch a.Fields[FieldPlayerID] {
+		case AnonymizeHash:
+			ids[p.ID] = a.hash(p.ID)
+		case AnonymizeStrip:
+			ids[p.ID] = fmt.Sprintf("p%d", i+1)
+		}
+		p.Name = a.value(FieldPlayerName, p.Name)
+		p.Address = a.value(FieldAddress, p.Address)
+	}
+	for i := range r.Chat {
+		r.Chat[i].Text = a.value(FieldChat, r.Chat[i].Text)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	id := func(s string) string {
+		if v, ok := ids[s]; ok {
+			return v
+		}
+		return s
+	}
+	for i := range r.Players {
+		r.Players[i].ID = id(r.Players[i].ID)
+	}
+	for i := range r.Inputs {
+		r.Inputs[i].Player = id(r.Inputs[i].Player)
+	}
+	for i := range r.Events {
+		r.Events[i].Player = id(r.Events[i].Player)
+	}
+	for i := range r.Spells {
+		r.Spells[i].Player = id(r.Spells[i].Player)
+		r.Spells[i].Target = id(r.Spells[i].Target)
+	}
+	for i := range r.Chat {
+		r.Chat[i].Player = id(r.Chat[i].Player)
+	}
+	r.Result.Winner = id(r.Result.Winner)
+	if r.Result.Scores != nil {
+		scores := make(map[string]int, len(r.Result.Scores))
+		for p, s := range r.Result.Scores {
+			scores[id(p)] = s
+		}
+		r.Result.Scores = scores
+	}
+}
+
+// value applies the field's action to one value
+func (a *Anonymizer) value(field, v string) string {
+	switch a.Fields[field] {
+	case AnonymizeHash:
+		return a.hash(v)
+	case AnonymizeStrip:
+		return ""
+	}
+	return v
+}
+
+func (a *Anonymizer) hash(v string) string {
+	if v == "" || strings.HasPrefix(v, hashPrefix) {
+		return v
+	}
+	mac := hmac.New(sha256.New, []byte(a.Salt))
+	mac.Write([]byte(v))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+}
@@ -0,0 +1,49 @@
+package replay
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnonymizerHashesIDsEverywhere(t *testing.T) {
+	r, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Players[0].Name, r.Players[0].Address = "Valeria", "203.0.113.7"
+	r.Chat = []ChatMessage{{Frame: 4, Player: "p2", Text: "gg"}}
+	r.Result.Scores = map[string]int{"p1": 100}
+
+	a, err := NewAnonymizer(map[string]string{FieldPlayerID: AnonymizeHash, FieldPlayerName: AnonymizeStrip,
+		FieldAddress: AnonymizeHash, FieldChat: AnonymizeStrip}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Apply(r)
+	id := r.Players[0].ID
+	if !strings.HasPrefix(id, hashPrefix) || r.Players[1].ID == id {
+		t.Fatalf("player ids %q, %q not hashed apart", id, r.Players[1].ID)
+	}
+	if r.Inputs[0].Player != id || r.Events[0].Player != id || r.Spells[0].Player != id ||
+		r.Spells[0].Target != r.Players[1].ID || r.Chat[0].Player != r.Players[1].ID || r.Result.Winner != id || r.Result.Scores[id] != 100 {
+		t.Errorf("references not renamed: %+v", r)
+	}
+	if r.Players[0].Name != "" || r.Chat[0].Text != "" || !strings.HasPrefix(r.Players[0].Address, hashPrefix) {
+		t.Errorf("player %+v, chat %+v", r.Players[0], r.Chat[0])
+	}
+	if err := r.Validate(); err != nil {
+		t.Errorf("anonymized replay invalid: %v", err)
+	}
+
+	before := r.Players[0]
+	a.Apply(r)
+	if r.Players[0] != before {
+		t.Errorf("anonymizing twice changed %+v to %+v", before, r.Players[0])
+	}
+	if _, err := NewAnonymizer(map[string]string{"email": AnonymizeStrip}, ""); err == nil {
+		t.Error("unknown field accepted")
+	}
+	if _, err := NewAnonymizer(map[string]string{FieldChat: "redact"}, ""); err == nil {
+		t.Error("unknown action accepted")
+	}
+}
@@ -0,0 +1,518 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// The binary replay format. A file starts with FormatMagic and the
+// uvarint format version, then holds sections, each a uvarint tag, a
+// uvarint length and that many bytes, in tag order, and ends with a 0 tag
+// so a file cut short at a section's end doesn't read as a whole one:
+//
+//	1 header    replay version, session, level, game version, mode,
+//	            seed, experiment, arm, start time
+//	2 rules     rotation system, randomizer, gravity, lock delay
+//	3 players   id, name, rating, address of each
+//	4 pieces
+//	5 inputs    frame and time as deltas from the input before, player,
+//	            action
+//	6 events    frame and time as deltas, player, type, piece, x, y,
+//	            rotation, lines, score, detail
+//	7 spells    frame and time as deltas, player, spell, target
+//	8 chat      frame and time as deltas, player, text
+//	9 result    winner, duration, scores, outcome
+//	10 signature
+//	11 checksums frames between them, then each one's frame as a delta
+//	            from the one before and its sum
+//
+// Strings are a uvarint length and their bytes; integers, and frame and
+// time deltas, are varints, counts uvarints, and floats their IEEE 754
+// bits little endian. A player is a uvarint, 0 followed by the id as a
+// string or n for the nth player of the players section, and actions and
+// event types likewise: 0
+// and the name, or n for the nth of Actions or Events. Lists without
+// omitempty in JSON store their length plus one, so an absent list, 0,
+// stays apart from an empty one and a decoded replay marshals, and so
+// verifies, as the encoded one did.
+//
+// A decoder skips the sections it doesn't know, so later format versions
+// may add sections; one changing what an existing section holds bumps
+// FormatVersion, which older decoders refuse.
+const (
+	FormatMagic   = "STRP"
+	FormatVersion = 1
+	FormatExt     = ".strp" // Save writes the binary format to paths ending in it
+)
+
+// Section tags of the binary format
+const (
+	sectionHeader = iota + 1
+	sectionRules
+	sectionPlayers
+	sectionPieces
+	sectionInputs
+	sectionEvents
+	sectionSpells
+	sectionChat
+	sectionResult
+	sectionSignature
+	sectionChecksums
+	sectionPhysics // the rules' physics math, when set
+)
+
+// Actions and Events list the known actions and event types in the order
+// the binary format numbers them from 1; new ones go at the end
+var (
+	Actions = []string{ActionLeft, ActionRight, ActionRotateCW, ActionRotateCCW, ActionSoftDrop, ActionHardDrop, ActionHold, ActionCast}
+	Events  = []string{EventSpawn, EventLock, EventClear, EventPickup, EventSpecial, EventGarbage, EventTopOut, EventAttack, EventCounter}
+)
+
+// ErrFormatVersion is a binary replay written by a newer format version
+var ErrFormatVersion = errors.New("replay format version not supported")
+
+// Encode writes the replay in the binary format
+func Encode(w io.Writer, r *Replay) error {
+	players := make(map[string]int, len(r.Players))
+	for i, p := range r.Players {
+		if _, dup := players[p.ID]; !dup {
+			players[p.ID] = i + 1
+		}
+	}
+	var out bytes.Buffer
+	out.WriteString(FormatMagic)
+	out.Write(binary.AppendUvarint(nil, FormatVersion))
+	section := func(tag int, fill func(e *encoder)) {
+		e := &encoder{players: players}
+		fill(e)
+		out.Write(binary.AppendUvarint(nil, uint64(tag)))
+		out.Write(binary.AppendUvarint(nil, uint64(len(e.buf))))
+		out.Write(e.buf)
+	}
+
+	section(sectionHeader, func(e *encoder) {
+		e.int(int64(r.Version))
+		e.strings(r.SessionID, r.Level, r.GameVersion, r.Mode)
+		e.int(r.Seed)
+		e.strings(r.Experiment, r.Arm)
+		started, _ := r.StartedAt.MarshalText()
+		e.string(string(started))
+	})
+	if r.Rules != nil {
+		section(sectionRules, func(e *encoder) {
+			e.strings(r.Rules.Rotation, r.Rules.Randomizer)
+			e.float(r.Rules.Gravity)
+			e.int(int64(r.Rules.LockDelay))
+		})
+	}
+	section(sectionPlayers, func(e *encoder) {
+		e.count(len(r.Players), r.Players == nil)
+		for _, p := range r.Players {
+			e.strings(p.ID, p.Name)
+			e.float(p.Rating)
+			e.string(p.Address)
+		}
+	})
+	section(sectionPieces, func(e *encoder) {
+		e.count(len(r.Pieces), r.Pieces == nil)
+		e.strings(r.Pieces...)
+	})
+	section(sectionInputs, func(e *encoder) {
+		e.count(len(r.Inputs), r.Inputs == nil)
+		for _, in := range r.Inputs {
+			e.when(in.Frame, in.TimeMs)
+			e.player(in.Player)
+			e.symbol(Actions, in.Action)
+		}
+	})
+	section(sectionEvents, func(e *encoder) {
+		e.count(len(r.Events), r.Events == nil)
+		for _, ev := range r.Events {
+			e.when(ev.Frame, ev.TimeMs)
+			e.player(ev.Player)
+			e.symbol(Events, ev.Type)
+			e.string(ev.Piece)
+			for _, n := range []int{ev.X, ev.Y, ev.Rotation, ev.Lines, ev.Score} {
+				e.int(int64(n))
+			}
+			e.string(ev.Detail)
+		}
+	})
+	section(sectionSpells, func(e *encoder) {
+		e.count(len(r.Spells), r.Spells == nil)
+		for _, sc := range r.Spells {
+			e.when(sc.Frame, sc.TimeMs)
+			e.player(sc.Player)
+			e.string(sc.Spell)
+			e.player(sc.Target)
+		}
+	})
+	if len(r.Chat) > 0 {
+		section(sectionChat, func(e *encoder) {
+			e.uint(uint64(len(r.Chat)))
+			for _, m := range r.Chat {
+				e.when(m.Frame, m.TimeMs)
+				e.player(m.Player)
+				e.string(m.Text)
+			}
+		})
+	}
+	section(sectionResult, func(e *encoder) {
+		e.string(r.Result.Winner)
+		e.int(r.Result.DurationMs)
+		ids := make([]string, 0, len(r.Result.Scores))
+		for id := range r.Result.Scores {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		e.uint(uint64(len(ids)))
+		for _, id := range ids {
+			e.player(id)
+			e.int(int64(r.Result.Scores[id]))
+		}
+		e.string(r.Result.Outcome)
+	})
+	if r.Signature != nil {
+		section(sectionSignature, func(e *encoder) {
+			e.strings(r.Signature.KeyID, string(r.Signature.Sig))
+		})
+	}
+	if r.ChecksumEvery > 0 || len(r.Checksums) > 0 {
+		section(sectionChecksums, func(e *encoder) {
+			e.uint(uint64(r.ChecksumEvery))
+			e.uint(uint64(len(r.Checksums)))
+			last := 0
+			for _, c := range r.Checksums {
+				e.int(int64(c.Frame - last))
+				e.uint(uint64(c.Sum))
+				last = c.Frame
+			}
+		})
+	}
+	if r.Rules != nil && r.Rules.Physics != "" {
+		section(sectionPhysics, func(e *encoder) { e.string(r.Rules.Physics) })
+	}
+	out.WriteByte(0)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// Decode reads a replay in the binary format without validating it
+func Decode(rd io.Reader) (*Replay, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	if !IsBinary(data) {
+		return nil, fmt.Errorf("decode replay: not a binary replay")
+	}
+	d := &decoder{buf: data[len(FormatMagic):]}
+	if v := d.uint(); d.err == nil && v > FormatVersion {
+		return nil, fmt.Errorf("decode replay: format version %d: %w", v, ErrFormatVersion)
+	}
+	r := &Replay{}
+	for d.err == nil {
+		tag := d.uint()
+		if tag == 0 {
+			break
+		}
+		n := d.uint()
+		if d.err != nil || n > uint64(len(d.buf)) {
+			d.fail()
+			break
+		}
+		s := &decoder{buf: d.buf[:n], players: r.Players}
+		d.buf = d.buf[n:]
+		s.section(int(tag), r)
+		if s.err != nil {
+			return nil, fmt.Errorf("decode replay: section %d: %w", tag, s.err)
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("decode replay: %w", d.err)
+	}
+	return r, nil
+}
+
+// IsBinary reports whether data, or its first bytes, are a binary replay
+func IsBinary(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(FormatMagic))
+}
+
+// section decodes one section into the replay; unknown ones are skipped
+func (d *decoder) section(tag int, r *Replay) {
+	switch tag {
+	case sectionHeader:
+		r.Version = int(d.int())
+		r.SessionID, r.Level, r.GameVersion, r.Mode = d.string(), d.string(), d.string(), d.string()
+		r.Seed = d.int()
+		r.Experiment, r.Arm = d.string(), d.string()
+		if started := d.string(); d.err == nil {
+			d.check(r.StartedAt.UnmarshalText([]byte(started)))
+		}
+	case sectionRules:
+		r.Rules = &Rules{Rotation: d.string(), Randomizer: d.string(), Gravity: d.float(), LockDelay: int(d.int())}
+	case sectionPlayers:
+		for n, i := d.count(&r.Players), 0; i < n && d.err == nil; i++ {
+			r.Players = append(r.Players, Player{ID: d.string(), Name: d.string(), Rating: d.float(), Address: d.string()})
+		}
+	case sectionPieces:
+		for n, i := d.count(&r.Pieces), 0; i < n && d.err == nil; i++ {
+			r.Pieces = append(r.Pieces, d.string())
+		}
+	case sectionInputs:
+		for n, i := d.count(&r.Inputs), 0; i < n && d.err == nil; i++ {
+			frame, ms := d.when()
+			r.Inputs = append(r.Inputs, Input{Frame: frame, TimeMs: ms, Player: d.player(), Action: d.symbol(Actions)})
+		}
+	case sectionEvents:
+		for n, i := d.count(&r.Events), 0; i < n && d.err == nil; i++ {
+			ev := Event{}
+			ev.Frame, ev.TimeMs = d.when()
+			ev.Player, ev.Type, ev.Piece = d.player(), d.symbol(Events), d.string()
+			ev.X, ev.Y, ev.Rotation, ev.Lines, ev.Score = int(d.int()), int(d.int()), int(d.int()), int(d.int()), int(d.int())
+			ev.Detail = d.string()
+			r.Events = append(r.Events, ev)
+		}
+	case sectionSpells:
+		for n, i := d.count(&r.Spells), 0; i < n && d.err == nil; i++ {
+			frame, ms := d.when()
+			r.Spells = append(r.Spells, SpellCast{Frame: frame, TimeMs: ms, Player: d.player(), Spell: d.string(), Target: d.player()})
+		}
+	case sectionChat:
+		for n, i := d.length(), 0; i < n && d.err == nil; i++ {
+			frame, ms := d.when()
+			r.Chat = append(r.Chat, ChatMessage{Frame: frame, TimeMs: ms, Player: d.player(), Text: d.string()})
+		}
+	case sectionResult:
+		r.Result.Winner, r.Result.DurationMs = d.string(), d.int()
+		if n := d.length(); n > 0 {
+			r.Result.Scores = make(map[string]int, n)
+			for i := 0; i < n && d.err == nil; i++ {
+				id := d.player()
+				r.Result.Scores[id] = int(d.int())
+			}
+		}
+		r.Result.Outcome = d.string()
+	case sectionSignature:
+		r.Signature = &Signature{KeyID: d.string(), Sig: []byte(d.string())}
+	case sectionChecksums:
+		r.ChecksumEvery = int(d.uint())
+		for n, i, frame := d.length(), 0, 0; i < n && d.err == nil; i++ {
+			frame += int(d.int())
+			r.Checksums = append(r.Checksums, Checksum{Frame: frame, Sum: uint32(d.uint())})
+		}
+	case sectionPhysics:
+		if r.Rules == nil {
+			r.Rules = &Rules{}
+		}
+		r.Rules.Physics = d.string()
+	}
+}
+
+// encoder builds a section
+type encoder struct {
+	buf                   []byte
+	players               map[string]int
+	lastFrame, lastTimeMs int64 // of the entry before in a list
+}
+
+func (e *encoder) uint(v uint64) { e.buf = binary.AppendUvarint(e.buf, v) }
+func (e *encoder) int(v int64)   { e.buf = binary.AppendVarint(e.buf, v) }
+
+func (e *encoder) float(f float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) strings(ss ...string) {
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+// count writes a list's length plus one, or 0 for an absent list
+func (e *encoder) count(n int, absent bool) {
+	if absent {
+		e.uint(0)
+		return
+	}
+	e.uint(uint64(n) + 1)
+}
+
+// when writes a frame and time as deltas from the entry before's
+func (e *encoder) when(frame int, timeMs int64) {
+	e.int(int64(frame) - e.lastFrame)
+	e.int(timeMs - e.lastTimeMs)
+	e.lastFrame, e.lastTimeMs = int64(frame), timeMs
+}
+
+func (e *encoder) player(id string) {
+	if i, ok := e.players[id]; ok {
+		e.uint(uint64(i))
+		return
+	}
+	e.uint(0)
+	e.string(id)
+}
+
+func (e *encoder) symbol(table []string, s string) {
+	for i, t := range table {
+		if t == s {
+			e.uint(uint64(i + 1))
+			return
+		}
+	}
+	e.uint(0)
+	e.string(s)
+}
+
+// decoder reads a section, keeping the first error; reads after it
+// answer zero values
+type decoder struct {
+	buf                   []byte
+	players               []Player
+	err                   error
+	lastFrame, lastTimeMs int64
+}
+
+var errTruncated = errors.New("truncated or malformed")
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = errTruncated
+	}
+}
+
+func (d *decoder) check(err error) {
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) float() float64 {
+	if d.err != nil || len(d.buf) < 8 {
+		d.fail()
+		return 0
+	}
+	f := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return f
+}
+
+func (d *decoder) string() string {
+	n := d.uint()
+	if d.err != nil || n > uint64(len(d.buf)) {
+		d.fail()
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+// length reads a list's length, no longer than the bytes left could hold
+func (d *decoder) length() int {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+// count reads a list's length written by encoder.count, making the list
+// empty rather than absent when it has none
+func (d *decoder) count(list any) int {
+	u := d.uint()
+	if u == 0 || d.err != nil {
+		return 0
+	}
+	if u-1 > uint64(len(d.buf)) {
+		d.fail()
+		return 0
+	}
+	n := int(u - 1)
+	switch l := list.(type) {
+	case *[]Player:
+		*l = make([]Player, 0, n)
+	case *[]string:
+		*l = make([]string, 0, n)
+	case *[]Input:
+		*l = make([]Input, 0, n)
+	case *[]Event:
+		*l = make([]Event, 0, n)
+	case *[]SpellCast:
+		*l = make([]SpellCast, 0, n)
+	}
+	return n
+}
+
+func (d *decoder) when() (int, int64) {
+	d.lastFrame += d.int()
+	d.lastTimeMs += d.int()
+	return int(d.lastFrame), d.lastTimeMs
+}
+
+func (d *decoder) player() string {
+	i := d.uint()
+	switch {
+	case d.err != nil:
+		return ""
+	case i == 0:
+		return d.string()
+	case i > uint64(len(d.players)):
+		d.fail()
+		return ""
+	}
+	return d.players[i-1].ID
+}
+
+func (d *decoder) symbol(table []string) string {
+	i := d.uint()
+	switch {
+	case d.err != nil:
+		return ""
+	case i == 0:
+		return d.string()
+	case i > uint64(len(table)):
+		d.fail()
+		return ""
+	}
+	return table[i-1]
+}
@@ -0,0 +1,121 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// golden is the sample, given rules, chat and scores, in format version 1;
+// a decoder must keep reading it as long as it claims to read version 1
+const golden = "5354525001012604027331076c6576656c5f31000000000014323032362d3033" +
+	"2d30315431323a30303a30305a0212037372730462616737000000000000f83f" +
+	"3c031e0302703103616e6e00000000009a974000027032000000000000000000" +
+	"0004050301540149050903060001010c00010606190312000102015400000000" +
+	"0000000001030000000002c80100070e021800010853504545445f5550020808" +
+	"010884010202676c090c027031904e0201c80102000000"
+
+func full(t *testing.T) *Replay {
+	r, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Version = CurrentVersion
+	r.StartedAt = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	r.Rules = &Rules{Rotation: "srs", Randomizer: "bag7", Gravity: 1.5, LockDelay: 30}
+	r.Players[0].Name, r.Players[0].Rating = "ann", 1510.5
+	r.Chat = []ChatMessage{{Frame: 4, TimeMs: 66, Player: "p2", Text: "gl"}}
+	r.Result.Scores = map[string]int{"p1": 100, "p2": 0}
+	return r
+}
+
+func marshal(t *testing.T, r *Replay) string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBinaryFormatRoundTrips(t *testing.T) {
+	key, _ := NewKey()
+	keys := &Keys{Keys: []Key{key}}
+	for name, r := range map[string]*Replay{"sample": full(t), "empty lists": {SessionID: "e", Players: []Player{{ID: "p"}}, Inputs: []Input{}},
+		"physics math": {SessionID: "f", Players: []Player{{ID: "p"}}, Rules: &Rules{Rotation: "srs", Physics: "fixed"}}} {
+		if name == "sample" {
+			r.Sign(key)
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, r); err != nil {
+			t.Fatal(err)
+		}
+		if json := marshal(t, r); buf.Len() >= len(json) {
+			t.Errorf("%s: %d bytes binary, %d as JSON", name, buf.Len(), len(json))
+		}
+		back, err := Parse(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, want := marshal(t, back), marshal(t, r); got != want {
+			t.Errorf("%s decoded as\n%s\nwant\n%s", name, got, want)
+		}
+		if r.Signature != nil {
+			if err := keys.Verify(back); err != nil {
+				t.Errorf("%s: a decoded replay no longer verifies: %v", name, err)
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "s1"+FormatExt)
+	if err := full(t).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := Load(path); err != nil || r.Rules == nil || r.Rules.Gravity != 1.5 {
+		t.Errorf("loaded %+v, %v", r, err)
+	}
+}
+
+func TestBinaryFormatCompatibility(t *testing.T) {
+	data, _ := hex.DecodeString(golden)
+	r, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := marshal(t, r), marshal(t, full(t)); got != want {
+		t.Errorf("golden decoded as\n%s\nwant\n%s", got, want)
+	}
+	var buf bytes.Buffer
+	Encode(&buf, full(t))
+	if got := hex.EncodeToString(buf.Bytes()); got != golden {
+		t.Errorf("the encoding changed without a format version:\n%s", got)
+	}
+
+	// a section a later version adds is skipped
+	extra := append(append([]byte(nil), data[:len(data)-1]...), 42, 3, 'n', 'e', 'w', 0)
+	if _, err := Parse(bytes.NewReader(extra)); err != nil {
+		t.Errorf("an unknown section: %v", err)
+	}
+	newer := append([]byte(FormatMagic), FormatVersion+1)
+	if _, err := Parse(bytes.NewReader(append(newer, data[len(FormatMagic)+1:]...))); !errors.Is(err, ErrFormatVersion) {
+		t.Errorf("a newer format version: %v", err)
+	}
+	for n := len(FormatMagic); n < len(data); n += 7 {
+		if _, err := Parse(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("truncated to %d bytes, it still parsed", n)
+		}
+	}
+
+	// JSON replays of the first version, without rules, still read; a
+	// version past this package's is refused
+	if r, err := Parse(strings.NewReader(sample)); err != nil || r.Version != 1 || r.Rules != nil {
+		t.Errorf("version 1 JSON: %+v, %v", r, err)
+	}
+	if _, err := Parse(strings.NewReader(strings.Replace(sample, `"version": 1`, `"version": 99`, 1))); err == nil {
+		t.Error("a replay from a newer version parsed")
+	}
+}
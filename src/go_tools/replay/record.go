@@ -0,0 +1,66 @@
+package replay
+
+import (
+	"fmt"
+	"time"
+)
+
+// Recorder assembles live session log records into replays, signing each
+// as its session ends when it has a key
+type Recorder struct {
+	key      *Key
+	sessions map[string]*Replay
+}
+
+// NewRecorder records replays signed with key, or unsigned when it's nil
+func NewRecorder(key *Key) (*Recorder, error) {
+	if key != nil && key.Private == nil {
+		return nil, fmt.Errorf("replay key %s has no private half to sign with", key.ID)
+	}
+	return &Recorder{key: key, sessions: make(map[string]*Replay)}, nil
+}
+
+// Add records a record received at now, returning the session's replay
+// once its end record completes it. Records of a session that never
+// started here, such as one already under way when the log was opened,
+// are skipped.
+func (rc *Recorder) Add(rec Record, now time.Time) (*Replay, error) {
+	if rec.Kind == RecordStart {
+		rc.sessions[rec.Session] = &Replay{Version: CurrentVersion, SessionID: rec.Session, Level: rec.Level,
+			StartedAt: now.UTC(), Players: rec.Players}
+		return nil, nil
+	}
+	r := rc.sessions[rec.Session]
+	if r == nil {
+		return nil, nil
+	}
+	switch rec.Kind {
+	case RecordInput:
+		r.Inputs = append(r.Inputs, *rec.Input)
+	case RecordEvent:
+		r.Events = append(r.Events, *rec.Event)
+		if rec.Event.Type == EventSpawn && rec.Event.Piece != "" {
+			r.Pieces = append(r.Pieces, rec.Event.Piece)
+		}
+	case RecordSpell:
+		r.Spells = append(r.Spells, *rec.Spell)
+	case RecordEnd:
+		delete(rc.sessions, rec.Session)
+		r.Result = *rec.Result
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		if rc.key != nil {
+			if err := r.Sign(*rc.key); err != nil {
+				return nil, err
+			}
+		}
+		return r, nil
+	}
+	return nil, nil
+}
+
+// Open is how many sessions are being recorded
+func (rc *Recorder) Open() int {
+	return len(rc.sessions)
+}
@@ -0,0 +1,304 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Player input actions
+const (
+	ActionLeft      = "left"
+	ActionRight     = "right"
+	ActionRotateCW  = "rotate_cw"
+	ActionRotateCCW = "rotate_ccw"
+	ActionSoftDrop  = "soft_drop"
+	ActionHardDrop  = "hard_drop"
+	ActionHold      = "hold"
+	ActionCast      = "cast"
+)
+
+// Game event types
+const (
+	EventSpawn   = "spawn"
+	EventLock    = "lock"
+	EventClear   = "clear"
+	EventPickup  = "pickup"
+	EventSpecial = "special"
+	EventGarbage = "garbage"
+	EventTopOut  = "top_out"
+	EventAttack  = "attack"  // garbage rows a clear sends; Detail names the player they go to
+	EventCounter = "counter" // garbage rows queued against the player a clear cancels
+)
+
+var knownActions = map[string]bool{
+	ActionLeft: true, ActionRight: true, ActionRotateCW: true, ActionRotateCCW: true,
+	ActionSoftDrop: true, ActionHardDrop: true, ActionHold: true, ActionCast: true,
+}
+
+var knownEvents = map[string]bool{
+	EventSpawn: true, EventLock: true, EventClear: true, EventPickup: true,
+	EventSpecial: true, EventGarbage: true, EventTopOut: true, EventAttack: true, EventCounter: true,
+}
+
+// CurrentVersion is the version of the replays this package writes; 2
+// added the rules
+const CurrentVersion = 2
+
+// Session outcomes
+const (
+	OutcomeCleared = "cleared" // solo player completed the level
+	OutcomeTopOut  = "top_out"
+	OutcomeQuit    = "quit"
+	OutcomeWin     = "win" // versus match with a winner
+)
+
+// Player identifies a participant of the recorded session
+type Player struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name,omitempty"`
+	Rating  float64 `json:"rating,omitempty"`
+	Address string  `json:"address,omitempty"` // client IP the server saw
+}
+
+// Input is a single player input
+type Input struct {
+	Frame  int    `json:"frame"`
+	TimeMs int64  `json:"timeMs"`
+	Player string `json:"player"`
+	Action string `json:"action"`
+}
+
+// Event is something the game reported during the session
+type Event struct {
+	Frame    int    `json:"frame"`
+	TimeMs   int64  `json:"timeMs"`
+	Player   string `json:"player"`
+	Type     string `json:"type"`
+	Piece    string `json:"piece,omitempty"`
+	X        int    `json:"x,omitempty"`
+	Y        int    `json:"y,omitempty"`
+	Rotation int    `json:"rotation,omitempty"`
+	Lines    int    `json:"lines,omitempty"`
+	Score    int    `json:"score,omitempty"` // points awarded by this event
+	Detail   string `json:"detail,omitempty"`
+}
+
+// SpellCast records a spell being used
+type SpellCast struct {
+	Frame  int    `json:"frame"`
+	TimeMs int64  `json:"timeMs"`
+	Player string `json:"player"`
+	Spell  string `json:"spell"`
+	Target string `json:"target,omitempty"` // player the spell was aimed at
+}
+
+// ChatMessage is a line of in-game chat
+type ChatMessage struct {
+	Frame  int    `json:"frame"`
+	TimeMs int64  `json:"timeMs"`
+	Player string `json:"player"`
+	Text   string `json:"text"`
+}
+
+// Checksum is a checksum of the game's state once a frame has played,
+// which playing the replay again must reproduce
+type Checksum struct {
+	Frame int    `json:"frame"`
+	Sum   uint32 `json:"sum"`
+}
+
+// Result is the outcome of the session
+type Result struct {
+	Winner     string         `json:"winner,omitempty"`
+	DurationMs int64          `json:"durationMs"`
+	Scores     map[string]int `json:"scores,omitempty"`
+	Outcome    string         `json:"outcome,omitempty"`
+}
+
+// Won reports whether the player won the session: by being the winner of
+// a match, or by clearing the level when playing alone
+func (r *Replay) Won(player string) bool {
+	if len(r.Players) == 1 {
+		return r.Result.Outcome == OutcomeCleared
+	}
+	return r.Result.Winner == player
+}
+
+// Rules are the game rules a session was played by, as the simulator
+// names them
+type Rules struct {
+	Rotation   string  `json:"rotation,omitempty"`   // a pieces rotation system
+	Randomizer string  `json:"randomizer,omitempty"` // a pieces randomizer
+	Gravity    float64 `json:"gravity,omitempty"`    // rows a second
+	LockDelay  int     `json:"lockDelay,omitempty"`  // frames
+	Physics    string  `json:"physics,omitempty"`    // the math a physics mode level stepped by
+}
+
+// Replay is a recorded game session
+type Replay struct {
+	Version       int           `json:"version"`
+	SessionID     string        `json:"sessionId"`
+	Level         string        `json:"level"`
+	GameVersion   string        `json:"gameVersion,omitempty"`
+	Mode          string        `json:"mode,omitempty"`
+	Seed          int64         `json:"seed,omitempty"`
+	Rules         *Rules        `json:"rules,omitempty"`      // from version 2
+	Experiment    string        `json:"experiment,omitempty"` // A/B experiment the session was assigned to
+	Arm           string        `json:"arm,omitempty"`        // the experiment arm, e.g. control or b
+	StartedAt     time.Time     `json:"startedAt"`
+	Players       []Player      `json:"players"`
+	Pieces        []string      `json:"pieces"`
+	Inputs        []Input       `json:"inputs"`
+	Events        []Event       `json:"events"`
+	Spells        []SpellCast   `json:"spells"`
+	Chat          []ChatMessage `json:"chat,omitempty"`
+	ChecksumEvery int           `json:"checksumEvery,omitempty"` // frames between the checksums
+	Checksums     []Checksum    `json:"checksums,omitempty"`
+	Result        Result        `json:"result"`
+	Signature     *Signature    `json:"signature,omitempty"` // the recorder's, see Sign
+}
+
+// Parse reads a JSON or binary replay and validates it
+func Parse(r io.Reader) (*Replay, error) {
+	br := bufio.NewReader(r)
+	rp := &Replay{}
+	if head, _ := br.Peek(len(FormatMagic)); IsBinary(head) {
+		var err error
+		if rp, err = Decode(br); err != nil {
+			return nil, err
+		}
+	} else if err := json.NewDecoder(br).Decode(rp); err != nil {
+		return nil, fmt.Errorf("decode replay: %w", err)
+	}
+	if err := rp.Validate(); err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
+
+// Load reads a replay file
+func Load(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rp, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rp, nil
+}
+
+// Save writes the replay as JSON, or in the binary format to a path
+// ending in FormatExt
+func (r *Replay) Save(path string) error {
+	if filepath.Ext(path) == FormatExt {
+		var buf bytes.Buffer
+		if err := Encode(&buf, r); err != nil {
+			return err
+		}
+		return os.WriteFile(path, buf.Bytes(), 0644)
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Validate checks that the replay is internally consistent: known players,
+// actions and event types, and frames that never go backwards
+func (r *Replay) Validate() error {
+	if r.SessionID == "" {
+		return fmt.Errorf("replay has no session id")
+	}
+	if r.Version > CurrentVersion {
+		return fmt.Errorf("replay %s: version %d is newer than %d", r.SessionID, r.Version, CurrentVersion)
+	}
+	if len(r.Players) == 0 {
+		return fmt.Errorf("replay %s: no players", r.SessionID)
+	}
+	players := make(map[string]bool, len(r.Players))
+	for _, p := range r.Players {
+		players[p.ID] = true
+	}
+
+	last := 0
+	for i, in := range r.Inputs {
+		if !knownActions[in.Action] {
+			return fmt.Errorf("replay %s: input %d: unknown action %q", r.SessionID, i, in.Action)
+		}
+		if !players[in.Player] {
+			return fmt.Errorf("replay %s: input %d: unknown player %q", r.SessionID, i, in.Player)
+		}
+		if in.Frame < last {
+			return fmt.Errorf("replay %s: input %d: frame %d before %d", r.SessionID, i, in.Frame, last)
+		}
+		last = in.Frame
+	}
+
+	last = 0
+	for i, ev := range r.Events {
+		if !knownEvents[ev.Type] {
+			return fmt.Errorf("replay %s: event %d: unknown type %q", r.SessionID, i, ev.Type)
+		}
+		if ev.Player != "" && !players[ev.Player] {
+			return fmt.Errorf("replay %s: event %d: unknown player %q", r.SessionID, i, ev.Player)
+		}
+		if ev.Frame < last {
+			return fmt.Errorf("replay %s: event %d: frame %d before %d", r.SessionID, i, ev.Frame, last)
+		}
+		last = ev.Frame
+	}
+
+	for i, sc := range r.Spells {
+		if !players[sc.Player] {
+			return fmt.Errorf("replay %s: spell %d: unknown player %q", r.SessionID, i, sc.Player)
+		}
+		if sc.Target != "" && !players[sc.Target] {
+			return fmt.Errorf("replay %s: spell %d: unknown target %q", r.SessionID, i, sc.Target)
+		}
+	}
+	for i, m := range r.Chat {
+		if !players[m.Player] {
+			return fmt.Errorf("replay %s: chat %d: unknown player %q", r.SessionID, i, m.Player)
+		}
+	}
+
+	last = 0
+	for i, c := range r.Checksums {
+		if c.Frame <= last {
+			return fmt.Errorf("replay %s: checksum %d: frame %d not after %d", r.SessionID, i, c.Frame, last)
+		}
+		last = c.Frame
+	}
+	return nil
+}
+
+// EventsOf returns the events of the given type, in order
+func (r *Replay) EventsOf(eventType string) []Event {
+	var out []Event
+	for _, ev := range r.Events {
+		if ev.Type == eventType {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// Player returns the player with the given id
+func (r *Replay) Player(id string) (Player, bool) {
+	for _, p := range r.Players {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Player{}, false
+}
@@ -0,0 +1,103 @@
+package replay
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = `{
+  "version": 1,
+  "sessionId": "s1",
+  "level": "level_1",
+  "players": [{"id": "p1"}, {"id": "p2"}],
+  "pieces": ["T", "I"],
+  "inputs": [
+    {"frame": 3, "player": "p1", "action": "left"},
+    {"frame": 9, "player": "p1", "action": "hard_drop"}
+  ],
+  "events": [
+    {"frame": 9, "player": "p1", "type": "lock", "piece": "T"},
+    {"frame": 9, "player": "p1", "type": "clear", "lines": 1, "score": 100}
+  ],
+  "spells": [{"frame": 12, "player": "p1", "spell": "SPEED_UP", "target": "p2"}],
+  "result": {"winner": "p1", "durationMs": 5000}
+}`
+
+func TestParse(t *testing.T) {
+	r, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Inputs) != 2 || len(r.Spells) != 1 || r.Result.Winner != "p1" {
+		t.Fatalf("unexpected replay %+v", r)
+	}
+	if clears := r.EventsOf(EventClear); len(clears) != 1 || clears[0].Lines != 1 {
+		t.Fatalf("EventsOf(clear) = %+v", clears)
+	}
+}
+
+func TestParseRejectsInconsistentReplays(t *testing.T) {
+	cases := map[string]string{
+		"unknown action": strings.Replace(sample, `"left"`, `"jump"`, 1),
+		"unknown player": strings.Replace(sample, `"target": "p2"`, `"target": "p3"`, 1),
+		"frame order":    strings.Replace(sample, `"frame": 3`, `"frame": 30`, 1),
+		"unknown event":  strings.Replace(sample, `"type": "lock"`, `"type": "explode"`, 1),
+	}
+	for name, src := range cases {
+		if _, err := Parse(strings.NewReader(src)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRecordsRecordTheReplay(t *testing.T) {
+	r, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	if err := EncodeRecords(&log, r.Records()); err != nil {
+		t.Fatal(err)
+	}
+	rc, _ := NewRecorder(nil)
+	var got *Replay
+	err = DecodeRecords(&log, func(rec Record) error {
+		if done, err := rc.Add(rec, time.Time{}); done != nil || err != nil {
+			got = done
+			return err
+		}
+		return nil
+	})
+	if err != nil || got == nil {
+		t.Fatalf("the records recorded no replay: %v", err)
+	}
+	if !reflect.DeepEqual(got.Inputs, r.Inputs) || !reflect.DeepEqual(got.Events, r.Events) || !reflect.DeepEqual(got.Spells, r.Spells) || got.Result.Winner != "p1" {
+		t.Errorf("recorded %+v, want the replay's session", got)
+	}
+}
+
+func TestSkipRecordsReadsOnPastBadLines(t *testing.T) {
+	log := `{"session":"s1","kind":"start","players":[{"id":"p1"}]}
+not json
+{"session":"s1","kind":"input","input":{"frame":1,"player":"p1","action":"jump"}}
+
+{"session":"s1","kind":"input","input":{"frame":2,"player":"p1","action":"left"}}
+`
+	if err := DecodeRecords(strings.NewReader(log), func(Record) error { return nil }); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("strict decoding: %v", err)
+	}
+	var kinds []string
+	var skipped []int
+	err := SkipRecords(strings.NewReader(log), func(rec Record) error {
+		kinds = append(kinds, rec.Kind)
+		return nil
+	}, func(line int, err error) {
+		skipped = append(skipped, line)
+	})
+	if err != nil || strings.Join(kinds, ",") != "start,input" || !reflect.DeepEqual(skipped, []int{2, 3}) {
+		t.Errorf("read %v, skipped lines %v: %v", kinds, skipped, err)
+	}
+}
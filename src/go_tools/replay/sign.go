@@ -0,0 +1,159 @@
+package replay
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Errors Verify returns
+var (
+	ErrUnsigned   = errors.New("replay is unsigned")
+	ErrUnknownKey = errors.New("replay is signed by an unknown key")
+	ErrTampered   = errors.New("replay was modified after it was signed")
+)
+
+// Signature is a recorder's Ed25519 signature of a replay: of its JSON
+// with no signature, so changing anything else breaks it
+type Signature struct {
+	KeyID string `json:"keyId"`
+	Sig   []byte `json:"sig"`
+}
+
+// Key is a signing key. Recorders need the private half; a copy of the
+// keys without it, as Public makes, is enough to verify and can't sign.
+type Key struct {
+	ID      string             `json:"id"`
+	Public  ed25519.PublicKey  `json:"public"`
+	Private ed25519.PrivateKey `json:"private,omitempty"`
+	Created time.Time          `json:"created"`
+	Retired bool               `json:"retired,omitempty"` // no longer signs, still verifies what it signed
+}
+
+// NewKey makes a key pair with a fresh ID
+func NewKey() (Key, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, err
+	}
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, err
+	}
+	return Key{ID: hex.EncodeToString(id), Public: pub, Private: priv, Created: time.Now().UTC()}, nil
+}
+
+// Keys is a replay keys file
+type Keys struct {
+	Keys []Key `json:"keys"`
+}
+
+// ReadKeys reads a keys file
+func ReadKeys(path string) (*Keys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var k Keys
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("parse replay keys %s: %w", path, err)
+	}
+	for _, key := range k.Keys {
+		if len(key.Public) != ed25519.PublicKeySize || key.Private != nil && len(key.Private) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("replay keys %s: key %s is malformed", path, key.ID)
+		}
+	}
+	return &k, nil
+}
+
+// Save writes the keys readable only by their owner, replacing the file
+// whole
+func (k *Keys) Save(path string) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Public returns the keys without their private halves, for the servers
+// that only verify
+func (k *Keys) Public() *Keys {
+	pub := &Keys{Keys: make([]Key, len(k.Keys))}
+	for i, key := range k.Keys {
+		key.Private = nil
+		pub.Keys[i] = key
+	}
+	return pub
+}
+
+// PublicKey returns the public half of the key with the ID, for verifying
+// what else the keys sign, such as levels
+func (k *Keys) PublicKey(id string) (ed25519.PublicKey, bool) {
+	for _, key := range k.Keys {
+		if key.ID == id {
+			return key.Public, true
+		}
+	}
+	return nil, false
+}
+
+// Signer returns the newest key that can sign
+func (k *Keys) Signer() (Key, bool) {
+	for i := len(k.Keys) - 1; i >= 0; i-- {
+		if key := k.Keys[i]; key.Private != nil && !key.Retired {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// signedBytes is what a signature covers
+func signedBytes(r *Replay) ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+// Sign signs the replay with the key, replacing any signature it had
+func (r *Replay) Sign(key Key) error {
+	if key.Private == nil {
+		return fmt.Errorf("replay key %s has no private half to sign with", key.ID)
+	}
+	data, err := signedBytes(r)
+	if err != nil {
+		return err
+	}
+	r.Signature = &Signature{KeyID: key.ID, Sig: ed25519.Sign(key.Private, data)}
+	return nil
+}
+
+// Verify checks that one of the keys signed the replay as it is
+func (k *Keys) Verify(r *Replay) error {
+	if r.Signature == nil {
+		return fmt.Errorf("%s: %w", r.SessionID, ErrUnsigned)
+	}
+	for _, key := range k.Keys {
+		if key.ID != r.Signature.KeyID {
+			continue
+		}
+		data, err := signedBytes(r)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(key.Public, data, r.Signature.Sig) {
+			return fmt.Errorf("%s: %w", r.SessionID, ErrTampered)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: %w %s", r.SessionID, ErrUnknownKey, r.Signature.KeyID)
+}
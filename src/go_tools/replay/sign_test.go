@@ -0,0 +1,98 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	old, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := NewKey()
+	old.Retired = true
+	keys := &Keys{Keys: []Key{old, key}}
+	if signer, ok := keys.Signer(); !ok || signer.ID != key.ID {
+		t.Fatalf("signer = %s, want the newest key %s", signer.ID, key.ID)
+	}
+	r, _ := Parse(strings.NewReader(sample))
+	if err := keys.Verify(r); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned: %v", err)
+	}
+	if err := r.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	// through a file, as a recorder saves it and a server reads it
+	path := filepath.Join(t.TempDir(), "s1.json")
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := keys.Public()
+	if err := pub.Verify(loaded); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	if _, ok := pub.Signer(); ok {
+		t.Error("public keys can sign")
+	}
+
+	loaded.Result.Winner = "p2"
+	if err := pub.Verify(loaded); !errors.Is(err, ErrTampered) {
+		t.Errorf("changed winner: %v", err)
+	}
+	data, _ := json.Marshal(r)
+	edited, _ := Parse(bytes.NewReader(bytes.Replace(data, []byte(`"score":100`), []byte(`"score":900`), 1)))
+	if err := pub.Verify(edited); !errors.Is(err, ErrTampered) {
+		t.Errorf("changed score: %v", err)
+	}
+	if err := (&Keys{Keys: []Key{old}}).Verify(r); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("other key: %v", err)
+	}
+	// a retired key still verifies what it signed
+	if err := r.Sign(old); err != nil || keys.Verify(r) != nil {
+		t.Errorf("retired key: %v %v", err, keys.Verify(r))
+	}
+}
+
+func TestRecorderSignsEndedSessions(t *testing.T) {
+	key, _ := NewKey()
+	rc, err := NewRecorder(&key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	players := []Player{{ID: "p1"}}
+	for _, rec := range []Record{
+		{Session: "before", Kind: RecordInput, Input: &Input{Player: "p1", Action: ActionLeft}},
+		{Session: "s", Kind: RecordStart, Level: "l", Players: players},
+		{Session: "s", Kind: RecordEvent, Event: &Event{Frame: 1, Player: "p1", Type: EventSpawn, Piece: "T"}},
+		{Session: "s", Kind: RecordInput, Input: &Input{Frame: 2, Player: "p1", Action: ActionHardDrop}},
+	} {
+		if r, err := rc.Add(rec, now); r != nil || err != nil {
+			t.Fatalf("%s: %v %v", rec.Kind, r, err)
+		}
+	}
+	r, err := rc.Add(Record{Session: "s", Kind: RecordEnd, Result: &Result{DurationMs: 100, Scores: map[string]int{"p1": 40}}}, now)
+	if err != nil || r == nil {
+		t.Fatalf("end: %v %v", r, err)
+	}
+	if len(r.Pieces) != 1 || len(r.Inputs) != 1 || r.Result.Scores["p1"] != 40 || rc.Open() != 0 {
+		t.Errorf("replay = %+v", r)
+	}
+	if err := (&Keys{Keys: []Key{key}}).Verify(r); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	key.Private = nil
+	if _, err := NewRecorder(&key); err == nil {
+		t.Error("recorder with a public key")
+	}
+}
@@ -0,0 +1,137 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Stream record kinds
+const (
+	RecordStart = "start"
+	RecordInput = "input"
+	RecordEvent = "event"
+	RecordSpell = "spell"
+	RecordEnd   = "end"
+)
+
+// Record is one line of a live session log: a session starting or ending,
+// or a single input, event or spell cast as it happens
+type Record struct {
+	Session string     `json:"session"`
+	Kind    string     `json:"kind"`
+	Level   string     `json:"level,omitempty"`   // start
+	Players []Player   `json:"players,omitempty"` // start
+	Input   *Input     `json:"input,omitempty"`
+	Event   *Event     `json:"event,omitempty"`
+	Spell   *SpellCast `json:"spell,omitempty"`
+	Result  *Result    `json:"result,omitempty"` // end
+}
+
+// Validate checks that the record carries the payload its kind needs
+func (r Record) Validate() error {
+	var ok bool
+	switch r.Kind {
+	case RecordStart:
+		ok = len(r.Players) > 0
+	case RecordInput:
+		ok = r.Input != nil && knownActions[r.Input.Action]
+	case RecordEvent:
+		ok = r.Event != nil && knownEvents[r.Event.Type]
+	case RecordSpell:
+		ok = r.Spell != nil
+	case RecordEnd:
+		ok = r.Result != nil
+	default:
+		return fmt.Errorf("unknown record kind %q", r.Kind)
+	}
+	if !ok || r.Session == "" {
+		return fmt.Errorf("malformed %s record", r.Kind)
+	}
+	return nil
+}
+
+// DecodeRecords reads one JSON record per line, calling fn for each until
+// the reader ends or fn returns an error. The first line that doesn't
+// decode, or isn't a valid record, ends it with an error.
+func DecodeRecords(r io.Reader, fn func(Record) error) error {
+	return decodeRecords(r, fn, nil)
+}
+
+// SkipRecords reads records as DecodeRecords does, but hands a line that
+// doesn't decode or validate to skip, with its number, and reads on: for
+// following a live log, which one bad line shouldn't end
+func SkipRecords(r io.Reader, fn func(Record) error, skip func(line int, err error)) error {
+	return decodeRecords(r, fn, skip)
+}
+
+func decodeRecords(r io.Reader, fn func(Record) error, skip func(line int, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err == nil {
+			err = rec.Validate()
+		}
+		if err != nil {
+			if skip == nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			skip(line, err)
+			continue
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Records are the replay's session as a live session log records it: its
+// start, then its inputs, spells and events in the order they happened,
+// inputs first and events last within a frame, then its end
+func (r *Replay) Records() []Record {
+	type timed struct {
+		frame, order int
+		rec          Record
+	}
+	var recs []timed
+	for i := range r.Inputs {
+		recs = append(recs, timed{r.Inputs[i].Frame, 0, Record{Session: r.SessionID, Kind: RecordInput, Input: &r.Inputs[i]}})
+	}
+	for i := range r.Spells {
+		recs = append(recs, timed{r.Spells[i].Frame, 1, Record{Session: r.SessionID, Kind: RecordSpell, Spell: &r.Spells[i]}})
+	}
+	for i := range r.Events {
+		recs = append(recs, timed{r.Events[i].Frame, 2, Record{Session: r.SessionID, Kind: RecordEvent, Event: &r.Events[i]}})
+	}
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].frame != recs[j].frame {
+			return recs[i].frame < recs[j].frame
+		}
+		return recs[i].order < recs[j].order
+	})
+	out := []Record{{Session: r.SessionID, Kind: RecordStart, Level: r.Level, Players: r.Players}}
+	for _, t := range recs {
+		out = append(out, t.rec)
+	}
+	return append(out, Record{Session: r.SessionID, Kind: RecordEnd, Result: &r.Result})
+}
+
+// EncodeRecords writes the records one JSON record a line, as
+// DecodeRecords reads them
+func EncodeRecords(w io.Writer, recs []Record) error {
+	enc := json.NewEncoder(w)
+	for _, rec := range recs {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
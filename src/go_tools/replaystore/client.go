@@ -0,0 +1,141 @@
+package replaystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+)
+
+// Client talks to a replay store's server
+type Client struct {
+	base  string     // scheme, host and any prefix, up to /replays
+	query url.Values // the search a client made from a search URL narrows its Replays to
+	token string
+	http  *http.Client
+}
+
+// NewClient talks to the server at rawURL, such as http://host:8098. A URL
+// of a search, like http://host:8098/replays?level=pack3/*, makes its
+// Replays that search's replays. The token of auth.TokenEnv, if set, is
+// presented to the server.
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("replay store URL %s isn't http or https", rawURL)
+	}
+	q := u.Query()
+	u.RawQuery, u.Fragment = "", ""
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/replays")
+	return &Client{base: u.String(), query: q, token: os.Getenv(auth.TokenEnv), http: certs.HTTPClient(time.Minute)}, nil
+}
+
+// IsURL reports whether a replay source names a server rather than a
+// directory
+func IsURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// Search returns a page of the server's replays q matches
+func (c *Client) Search(q url.Values) (Results, error) {
+	var res Results
+	err := c.get("/replays?"+q.Encode(), func(r io.Reader) error { return json.NewDecoder(r).Decode(&res) })
+	return res, err
+}
+
+// Upload sends a replay file to the store; created is false when it had
+// the file already
+func (c *Client) Upload(data []byte) (m Meta, created bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, c.base+"/replays", bytes.NewReader(data))
+	if err != nil {
+		return m, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	auth.SetHeader(req.Header, c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return m, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return m, false, replyError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&m)
+	return m, resp.StatusCode == http.StatusCreated, err
+}
+
+// Replays lists the hashes of every replay the client's search matches,
+// page by page, so a server is an analyzer.ReplaySource
+func (c *Client) Replays() ([]string, error) {
+	q := url.Values{}
+	for k, v := range c.query {
+		q[k] = v
+	}
+	q.Del("offset")
+	q.Set("limit", strconv.Itoa(MaxLimit))
+	var hashes []string
+	for {
+		q.Set("offset", strconv.Itoa(len(hashes)))
+		res, err := c.Search(q)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range res.Replays {
+			hashes = append(hashes, m.Hash)
+		}
+		if len(res.Replays) == 0 || len(hashes) >= res.Total {
+			return hashes, nil
+		}
+	}
+}
+
+// ReadReplay downloads a replay by its hash or session ID
+func (c *Client) ReadReplay(id string) ([]byte, error) {
+	var data []byte
+	err := c.get("/replays/"+url.PathEscape(id)+"/download", func(r io.Reader) error {
+		var err error
+		data, err = io.ReadAll(r)
+		return err
+	})
+	return data, err
+}
+
+func (c *Client) get(path string, read func(io.Reader) error) error {
+	req, err := http.NewRequest(http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	auth.SetHeader(req.Header, c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return replyError(resp)
+	}
+	return read(resp.Body)
+}
+
+// replyError is the server's error reply as an error
+func replyError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != "" {
+		return fmt.Errorf("replay store: %s: %s", resp.Status, body.Error)
+	}
+	return fmt.Errorf("replay store: %s", resp.Status)
+}
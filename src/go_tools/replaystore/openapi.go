@@ -0,0 +1,31 @@
+package replaystore
+
+import (
+	"net/http"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// DescribeAPI adds the store's endpoints to a server's OpenAPI document
+func (s *Server) DescribeAPI(spec *openapi.Spec) {
+	id := map[string]string{"id": "the replay's hash or session ID"}
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/replays",
+		Summary: "upload a replay, gzipped with Content-Encoding or not; 200 with the first upload's metadata if the store had it",
+		Body:    replay.Replay{}, Status: http.StatusCreated, Reply: Meta{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/replays", Summary: "search the replays, in upload order",
+		Query: []openapi.Param{
+			{Name: "player", Doc: "who played"},
+			{Name: "level", Doc: "a name or a glob of them"},
+			{Name: "version", Doc: "of the game"},
+			{Name: "outcome"},
+			{Name: "since", Doc: "started at or after, a date like 2024-06-01 or an RFC 3339 time"},
+			{Name: "until", Doc: "started before, likewise"},
+			{Name: "offset", Type: "integer"},
+			{Name: "limit", Type: "integer"},
+		},
+		Reply: Results{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/replays/{id}", Summary: "a replay's metadata", Params: id, Reply: Meta{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/replays/{id}/download", Summary: "the replay as uploaded",
+		Params: id, Reply: replay.Replay{}})
+}
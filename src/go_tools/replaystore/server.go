@@ -0,0 +1,175 @@
+package replaystore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// maxUploadBytes bounds an uploaded replay, decompressed
+const maxUploadBytes = 32 << 20
+
+// Server exposes a store over HTTP:
+//
+//	POST /replays                  upload a replay, gzipped or not
+//	GET  /replays?player=&level=&version=&outcome=&since=&until=&offset=&limit=  search
+//	GET  /replays/{id}             a replay's metadata, by hash or session ID
+//	GET  /replays/{id}/download    the replay as uploaded
+//
+// An upload answers 201 with the replay's metadata, or 200 with the first
+// upload's when the store had it already.
+type Server struct {
+	store *Store
+}
+
+// NewServer serves store
+func NewServer(store *Store) *Server {
+	return &Server{store: store}
+}
+
+// ServeHTTP routes the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "replays" || len(parts) > 3 || len(parts) == 3 && parts[2] != "download" {
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+		return
+	}
+	if len(parts) == 1 && r.Method == http.MethodPost {
+		s.upload(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if len(parts) == 1 {
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		} else {
+			methodNotAllowed(w, http.MethodGet)
+		}
+		return
+	}
+	switch len(parts) {
+	case 1:
+		q, err := ParseQuery(r.URL.Query())
+		if err != nil {
+			httpError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.store.Search(q))
+	case 2:
+		m, err := s.store.Meta(parts[1])
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, m)
+	case 3:
+		data, m, err := s.store.Read(parts[1])
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		// content-addressed, so a replay never changes under its hash
+		kind, ext := "application/json", ".json"
+		if replay.IsBinary(data) {
+			kind, ext = "application/octet-stream", replay.FormatExt
+		}
+		w.Header().Set("Content-Type", kind)
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("ETag", `"`+m.Hash+`"`)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", m.SessionID+ext))
+		http.ServeContent(w, r, "", m.Uploaded, bytes.NewReader(data))
+	}
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, "read replay: %v", err)
+			return
+		}
+		defer zr.Close()
+		body = io.LimitReader(zr, maxUploadBytes+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil || len(data) > maxUploadBytes {
+		httpError(w, http.StatusRequestEntityTooLarge, "read replay: larger than %d bytes or %v", maxUploadBytes, err)
+		return
+	}
+	m, created, err := s.store.Put(data)
+	switch {
+	case errors.Is(err, ErrInvalid):
+		httpError(w, http.StatusBadRequest, "%v", err)
+	case err != nil:
+		httpError(w, http.StatusInternalServerError, "%v", err)
+	case created:
+		writeJSON(w, http.StatusCreated, m)
+	default:
+		writeJSON(w, http.StatusOK, m)
+	}
+}
+
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		httpError(w, http.StatusNotFound, "%v", err)
+		return
+	}
+	httpError(w, http.StatusInternalServerError, "%v", err)
+}
+
+// ParseQuery reads a search from URL parameters: player, level, version,
+// outcome, since and until as dates like 2024-06-01 or RFC 3339 times,
+// offset and limit
+func ParseQuery(v url.Values) (Query, error) {
+	q := Query{Player: v.Get("player"), Level: v.Get("level"), Version: v.Get("version"), Outcome: v.Get("outcome")}
+	var err error
+	if q.Since, err = parseTime(v.Get("since")); err != nil {
+		return q, fmt.Errorf("since: %w", err)
+	}
+	if q.Until, err = parseTime(v.Get("until")); err != nil {
+		return q, fmt.Errorf("until: %w", err)
+	}
+	for name, dst := range map[string]*int{"offset": &q.Offset, "limit": &q.Limit} {
+		if s := v.Get(name); s != "" {
+			if *dst, err = strconv.Atoi(s); err != nil || *dst < 0 {
+				return q, fmt.Errorf("%s %q isn't a count", name, s)
+			}
+		}
+	}
+	return q, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
@@ -0,0 +1,286 @@
+// Package replaystore keeps uploaded replays by their content hash, with
+// their metadata searchable, and serves them over HTTP; the analyzer reads
+// a store, or a server of one, as it reads a directory of replays
+package replaystore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// IndexFile lists a store's replays, one JSON Meta per line in upload
+// order; objects/ holds the replays themselves
+const IndexFile = "index.jsonl"
+
+// Search limits
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Errors a store returns
+var (
+	ErrNotFound = errors.New("replay not found")
+	ErrInvalid  = errors.New("invalid replay") // one that doesn't parse, validate or verify
+)
+
+// Meta is what a store knows of a replay without reading it
+type Meta struct {
+	Hash        string    `json:"hash"` // SHA-256 of the file as uploaded
+	SessionID   string    `json:"sessionId"`
+	Level       string    `json:"level"`
+	GameVersion string    `json:"gameVersion,omitempty"`
+	Mode        string    `json:"mode,omitempty"`
+	Players     []string  `json:"players"` // IDs
+	Names       []string  `json:"names,omitempty"`
+	Outcome     string    `json:"outcome,omitempty"`
+	Winner      string    `json:"winner,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	DurationMs  int64     `json:"durationMs"`
+	Bytes       int       `json:"bytes"`
+	Uploaded    time.Time `json:"uploaded"`
+}
+
+// Query narrows a search; zero fields match everything
+type Query struct {
+	Player  string    // ID or name
+	Level   string    // name pattern, as in path.Match
+	Version string    // game version
+	Outcome string    // as in replay.Result
+	Since   time.Time // started at or after
+	Until   time.Time // started before
+	Offset  int
+	Limit   int // 0 for DefaultLimit
+}
+
+// Results is a page of a search
+type Results struct {
+	Total   int    `json:"total"` // matches, across every page
+	Replays []Meta `json:"replays"`
+}
+
+// Store is a directory of replays
+type Store struct {
+	// Keys, when set, refuse uploads their recorders didn't sign or that
+	// were modified since; nil takes any replay
+	Keys *replay.Keys
+
+	dir string
+
+	mu     sync.RWMutex
+	metas  []Meta
+	byHash map[string]int
+	index  *os.File
+}
+
+// Open opens or creates the store in dir
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, byHash: make(map[string]int)}
+	if f, err := os.Open(filepath.Join(dir, IndexFile)); err == nil {
+		scanner := bufio.NewScanner(f)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var m Meta
+			if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: %w", IndexFile, line, err)
+			}
+			s.byHash[m.Hash] = len(s.metas)
+			s.metas = append(s.metas, m)
+		}
+		err := scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	index, err := os.OpenFile(filepath.Join(dir, IndexFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.index = index
+	return s, nil
+}
+
+// IsStore reports whether dir holds a store, rather than loose replays
+func IsStore(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, IndexFile))
+	return err == nil
+}
+
+// Close closes the index
+func (s *Store) Close() error {
+	return s.index.Close()
+}
+
+// objectPath is where a replay with the hash is kept
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash[:2], hash+".json")
+}
+
+// Put validates a replay file, checks its signature when the store has
+// Keys, and keeps it. A file the store has already,
+// byte for byte, isn't kept twice: created is false and its Meta is the
+// first upload's.
+func (s *Store) Put(data []byte) (m Meta, created bool, err error) {
+	rp, err := replay.Parse(bytes.NewReader(data))
+	if err != nil {
+		return m, false, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if s.Keys != nil {
+		if err := s.Keys.Verify(rp); err != nil {
+			return m, false, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i, ok := s.byHash[hash]; ok {
+		return s.metas[i], false, nil
+	}
+	m = describe(rp, hash, len(data))
+	p := s.objectPath(hash)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return m, false, err
+	}
+	// written aside and renamed so a crash never leaves half a replay
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return m, false, err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return m, false, err
+	}
+	line, err := json.Marshal(m)
+	if err != nil {
+		return m, false, err
+	}
+	if _, err := s.index.Write(append(line, '\n')); err != nil {
+		return m, false, err
+	}
+	s.byHash[hash] = len(s.metas)
+	s.metas = append(s.metas, m)
+	return m, true, nil
+}
+
+func describe(rp *replay.Replay, hash string, size int) Meta {
+	m := Meta{Hash: hash, SessionID: rp.SessionID, Level: rp.Level, GameVersion: rp.GameVersion, Mode: rp.Mode,
+		Players: []string{}, Outcome: rp.Result.Outcome, Winner: rp.Result.Winner, StartedAt: rp.StartedAt,
+		DurationMs: rp.Result.DurationMs, Bytes: size, Uploaded: time.Now().UTC()}
+	for _, p := range rp.Players {
+		m.Players = append(m.Players, p.ID)
+		if p.Name != "" {
+			m.Names = append(m.Names, p.Name)
+		}
+	}
+	return m
+}
+
+// Meta returns a replay's metadata, by its hash or session ID
+func (s *Store) Meta(id string) (Meta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i, ok := s.byHash[id]; ok {
+		return s.metas[i], nil
+	}
+	for _, m := range s.metas {
+		if m.SessionID == id {
+			return m, nil
+		}
+	}
+	return Meta{}, fmt.Errorf("%s: %w", id, ErrNotFound)
+}
+
+// Read returns a replay file, by its hash or session ID
+func (s *Store) Read(id string) ([]byte, Meta, error) {
+	m, err := s.Meta(id)
+	if err != nil {
+		return nil, m, err
+	}
+	data, err := os.ReadFile(s.objectPath(m.Hash))
+	return data, m, err
+}
+
+// Search returns a page of the replays the query matches, in upload order
+func (s *Store) Search(q Query) Results {
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	q.Limit = min(q.Limit, MaxLimit)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := Results{Replays: []Meta{}}
+	for _, m := range s.metas {
+		if !q.Match(m) {
+			continue
+		}
+		if res.Total >= q.Offset && len(res.Replays) < q.Limit {
+			res.Replays = append(res.Replays, m)
+		}
+		res.Total++
+	}
+	return res
+}
+
+// Match reports whether a replay passes the query's filters
+func (q Query) Match(m Meta) bool {
+	if q.Level != "" {
+		if ok, _ := path.Match(q.Level, m.Level); !ok {
+			return false
+		}
+	}
+	if q.Version != "" && q.Version != m.GameVersion || q.Outcome != "" && q.Outcome != m.Outcome {
+		return false
+	}
+	if !q.Since.IsZero() && m.StartedAt.Before(q.Since) || !q.Until.IsZero() && !m.StartedAt.Before(q.Until) {
+		return false
+	}
+	if q.Player != "" {
+		found := false
+		for _, p := range append(append([]string(nil), m.Players...), m.Names...) {
+			found = found || strings.EqualFold(p, q.Player)
+		}
+		return found
+	}
+	return true
+}
+
+// Replays lists every replay's hash in upload order, so a store is an
+// analyzer.ReplaySource
+func (s *Store) Replays() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hashes := make([]string, len(s.metas))
+	for i, m := range s.metas {
+		hashes[i] = m.Hash
+	}
+	return hashes, nil
+}
+
+// ReadReplay reads a replay by its hash
+func (s *Store) ReadReplay(hash string) ([]byte, error) {
+	data, _, err := s.Read(hash)
+	return data, err
+}
@@ -0,0 +1,183 @@
+package replaystore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func replayFile(session, level, version, player, outcome string, day int) []byte {
+	return []byte(fmt.Sprintf(`{"sessionId":%q,"level":%q,"gameVersion":%q,"startedAt":"2024-06-%02dT10:00:00Z",
+	"players":[{"id":%q,"name":"Name of %s"}],
+	"events":[{"frame":1,"player":%q,"type":"lock","piece":"O","x":0,"y":18}],
+	"result":{"durationMs":30000,"outcome":%q}}`, session, level, version, day, player, player, player, outcome))
+}
+
+func TestStoreDedupesAndSearches(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := [][]byte{
+		replayFile("s1", "pack1/a", "1.0", "ann", "cleared", 1),
+		replayFile("s2", "pack1/b", "1.1", "bob", "top_out", 2),
+		replayFile("s3", "pack2/a", "1.1", "ann", "cleared", 3),
+	}
+	for _, f := range files {
+		if _, created, err := s.Put(f); err != nil || !created {
+			t.Fatalf("put: %v %v", created, err)
+		}
+	}
+	first, created, err := s.Put(files[0])
+	if err != nil || created || first.SessionID != "s1" {
+		t.Errorf("duplicate: %+v %v %v", first, created, err)
+	}
+	if _, _, err := s.Put([]byte(`{"sessionId":"bad"}`)); !errors.Is(err, ErrInvalid) {
+		t.Errorf("invalid replay: %v", err)
+	}
+
+	for _, c := range []struct {
+		q    Query
+		want []string
+	}{
+		{Query{}, []string{"s1", "s2", "s3"}},
+		{Query{Player: "ann"}, []string{"s1", "s3"}},
+		{Query{Player: "name of bob"}, []string{"s2"}},
+		{Query{Level: "pack1/*", Version: "1.1"}, []string{"s2"}},
+		{Query{Outcome: "cleared", Since: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)}, []string{"s3"}},
+		{Query{Until: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)}, []string{"s1"}},
+		{Query{Offset: 1, Limit: 1}, []string{"s2"}},
+	} {
+		res := s.Search(c.q)
+		var got []string
+		for _, m := range res.Replays {
+			got = append(got, m.SessionID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("search %+v = %v, want %v", c.q, got, c.want)
+		}
+	}
+	s.Close()
+
+	// the index survives a reopen, and the objects read back as uploaded
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if res := s.Search(Query{}); res.Total != 3 {
+		t.Fatalf("reopened store has %d replays", res.Total)
+	}
+	data, m, err := s.Read("s2")
+	if err != nil || !bytes.Equal(data, files[1]) || m.Players[0] != "bob" || m.Bytes != len(files[1]) {
+		t.Errorf("read s2: %+v %v", m, err)
+	}
+	if _, _, err := s.Read("../index"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("read outside the store: %v", err)
+	}
+	if !IsStore(dir) || IsStore(t.TempDir()) {
+		t.Error("IsStore")
+	}
+}
+
+func TestStoreRefusesUnsignedReplays(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	key, _ := replay.NewKey()
+	s.Keys = &replay.Keys{Keys: []replay.Key{key}}
+
+	rp, _ := replay.Parse(bytes.NewReader(replayFile("s1", "pack1/a", "1.0", "ann", "cleared", 1)))
+	unsigned, _ := json.Marshal(rp)
+	rp.Sign(key)
+	signed, _ := json.Marshal(rp)
+	forged := bytes.Replace(signed, []byte(`"outcome":"cleared"`), []byte(`"outcome":"win"`), 1)
+	for name, data := range map[string][]byte{"unsigned": unsigned, "forged": forged} {
+		if _, _, err := s.Put(data); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, created, err := s.Put(signed); err != nil || !created {
+		t.Errorf("signed: %v %v", created, err)
+	}
+}
+
+func TestServerFeedsTheAnalyzer(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	srv := httptest.NewServer(NewServer(s))
+	defer srv.Close()
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		level := "pack1/a"
+		if i%2 == 1 {
+			level = "pack2/a"
+		}
+		if _, created, err := c.Upload(replayFile(fmt.Sprint("s", i), level, "1.0", "ann", "cleared", i+1)); err != nil || !created {
+			t.Fatalf("upload %d: %v %v", i, created, err)
+		}
+	}
+	if m, created, err := c.Upload(replayFile("s0", "pack1/a", "1.0", "ann", "cleared", 1)); err != nil || created || m.SessionID != "s0" {
+		t.Errorf("re-upload: %+v %v %v", m, created, err)
+	}
+	if _, _, err := c.Upload([]byte(`{`)); err == nil {
+		t.Error("uploaded a broken replay")
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(replayFile("s9", "pack1/z", "1.0", "cat", "cleared", 9))
+	zw.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/replays", &gz)
+	req.Header.Set("Content-Encoding", "gzip")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Errorf("gzipped upload: %v %v", resp.Status, err)
+	}
+
+	res, err := c.Search(url.Values{"level": {"pack2/*"}})
+	if err != nil || res.Total != 2 {
+		t.Fatalf("search: %+v %v", res, err)
+	}
+	resp, err := http.Get(srv.URL + "/replays/" + res.Replays[0].Hash + "/download")
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != `"`+res.Replays[0].Hash+`"` {
+		t.Errorf("download: %v %v", resp.Header, err)
+	}
+	resp.Body.Close()
+	if resp, _ := http.Get(srv.URL + "/replays/nope"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown replay: %s", resp.Status)
+	}
+
+	// the analyzer loads a search's replays straight from the server
+	filtered, err := NewClient(srv.URL + "/replays?level=pack1/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := analyzer.NewDataset()
+	failed, err := d.LoadReplaysFrom(filtered, analyzer.Pool{})
+	if err != nil || len(failed) != 0 || len(d.Replays) != 4 {
+		t.Fatalf("loaded %d replays, %v %v", len(d.Replays), failed, err)
+	}
+	d = analyzer.NewDataset()
+	if _, err := d.LoadReplaysFrom(s, analyzer.Pool{}); err != nil || len(d.Replays) != 6 {
+		t.Errorf("loaded %d replays from the store, %v", len(d.Replays), err)
+	}
+}
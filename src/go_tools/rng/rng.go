@@ -0,0 +1,101 @@
+package rng
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// RandomSource supplies the randomness used by the tools' algorithms
+type RandomSource interface {
+	// Intn returns a value in [0, n); n must be positive
+	Intn(n int) int
+	// Float64 returns a value in [0, 1)
+	Float64() float64
+}
+
+// Source algorithms selectable from config
+const (
+	AlgorithmMath    = "math"
+	AlgorithmXoshiro = "xoshiro"
+)
+
+// New returns a source for the named algorithm; a zero seed seeds from the current time
+func New(algorithm string, seed int64) (RandomSource, error) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	switch algorithm {
+	case "", AlgorithmXoshiro:
+		return NewXoshiro(uint64(seed)), nil
+	case AlgorithmMath:
+		return NewMathSource(seed), nil
+	default:
+		return nil, fmt.Errorf("unknown random algorithm %q", algorithm)
+	}
+}
+
+// Perm returns a random permutation of [0, n) drawn from src
+func Perm(src RandomSource, n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j := src.Intn(i + 1)
+		p[i], p[j] = p[j], p[i]
+	}
+	return p
+}
+
+// MathSource adapts math/rand to RandomSource
+type MathSource struct {
+	r *rand.Rand
+}
+
+// NewMathSource creates a math/rand backed source
+func NewMathSource(seed int64) *MathSource {
+	return &MathSource{r: rand.New(rand.NewSource(seed))}
+}
+
+// Intn implements RandomSource
+func (m *MathSource) Intn(n int) int { return m.r.Intn(n) }
+
+// Float64 implements RandomSource
+func (m *MathSource) Float64() float64 { return m.r.Float64() }
+
+// Scripted replays fixed sequences, cycling when exhausted, so tests can
+// drive an algorithm down a known path
+type Scripted struct {
+	Ints   []int
+	Floats []float64
+	ni, nf int
+}
+
+// NewScripted creates a scripted source
+func NewScripted(ints []int, floats []float64) *Scripted {
+	return &Scripted{Ints: ints, Floats: floats}
+}
+
+// Intn implements RandomSource; scripted values are reduced modulo n
+func (s *Scripted) Intn(n int) int {
+	if len(s.Ints) == 0 {
+		return 0
+	}
+	v := s.Ints[s.ni%len(s.Ints)]
+	s.ni++
+	if v < 0 {
+		v = -v
+	}
+	return v % n
+}
+
+// Float64 implements RandomSource
+func (s *Scripted) Float64() float64 {
+	if len(s.Floats) == 0 {
+		return 0
+	}
+	v := s.Floats[s.nf%len(s.Floats)]
+	s.nf++
+	return v
+}
@@ -0,0 +1,40 @@
+package rng
+
+import "testing"
+
+func TestXoshiroIsDeterministicAndInRange(t *testing.T) {
+	a, b := NewXoshiro(99), NewXoshiro(99)
+	for i := 0; i < 1000; i++ {
+		x, y := a.Intn(7), b.Intn(7)
+		if x != y {
+			t.Fatalf("draw %d: %d != %d for the same seed", i, x, y)
+		}
+		if x < 0 || x >= 7 {
+			t.Fatalf("draw %d: %d out of range", i, x)
+		}
+		if f := a.Float64(); f < 0 || f >= 1 {
+			t.Fatalf("draw %d: float %f out of range", i, f)
+		}
+		b.Float64()
+	}
+}
+
+func TestScriptedCyclesValues(t *testing.T) {
+	s := NewScripted([]int{3, 8}, []float64{0.25})
+	got := []int{s.Intn(5), s.Intn(5), s.Intn(5)}
+	want := []int{3, 3, 3}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if f := s.Float64(); f != 0.25 {
+		t.Fatalf("got %f, want 0.25", f)
+	}
+}
+
+func TestNewRejectsUnknownAlgorithm(t *testing.T) {
+	if _, err := New("mersenne", 1); err == nil {
+		t.Fatal("expected an error for an unknown algorithm")
+	}
+}
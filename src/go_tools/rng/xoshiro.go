@@ -0,0 +1,63 @@
+package rng
+
+import "math/bits"
+
+// Xoshiro256 implements the xoshiro256** generator, which has better
+// statistical quality than math/rand and a small, copyable state
+type Xoshiro256 struct {
+	s [4]uint64
+}
+
+// NewXoshiro seeds a generator by expanding the seed with splitmix64
+func NewXoshiro(seed uint64) *Xoshiro256 {
+	x := &Xoshiro256{}
+	for i := range x.s {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		x.s[i] = z ^ (z >> 31)
+	}
+	return x
+}
+
+// State is the generator's state, to resume it from with SetState
+func (x *Xoshiro256) State() [4]uint64 { return x.s }
+
+// SetState resumes the generator from a state State returned
+func (x *Xoshiro256) SetState(s [4]uint64) { x.s = s }
+
+// Uint64 returns the next 64 random bits
+func (x *Xoshiro256) Uint64() uint64 {
+	s := &x.s
+	result := bits.RotateLeft64(s[1]*5, 7) * 9
+	t := s[1] << 17
+	s[2] ^= s[0]
+	s[3] ^= s[1]
+	s[1] ^= s[2]
+	s[0] ^= s[3]
+	s[2] ^= t
+	s[3] = bits.RotateLeft64(s[3], 45)
+	return result
+}
+
+// Intn implements RandomSource using unbiased multiply-shift rejection
+func (x *Xoshiro256) Intn(n int) int {
+	if n <= 0 {
+		panic("rng: Intn called with non-positive n")
+	}
+	bound := uint64(n)
+	hi, lo := bits.Mul64(x.Uint64(), bound)
+	if lo < bound {
+		threshold := -bound % bound
+		for lo < threshold {
+			hi, lo = bits.Mul64(x.Uint64(), bound)
+		}
+	}
+	return int(hi)
+}
+
+// Float64 implements RandomSource
+func (x *Xoshiro256) Float64() float64 {
+	return float64(x.Uint64()>>11) / (1 << 53)
+}
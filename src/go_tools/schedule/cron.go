@@ -0,0 +1,192 @@
+// Package schedule runs the tools' periodic tasks at the times cron-like
+// specs say, in place of OS cron entries
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec is when a job runs: the minutes a cron expression matches, or
+// every so long
+type Spec struct {
+	expr                         string
+	every                        time.Duration
+	minute, hour, dom, month     uint64 // bit n set for value n
+	dow                          uint64 // Sunday 0
+	domRestricted, dowRestricted bool
+}
+
+// field is one of a cron expression's five fields
+type field struct {
+	name     string
+	min, max int
+	names    []string // of the values from min, for months and weekdays
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// shorthands are the @ expressions cron takes for common specs
+var shorthands = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// Parse reads a spec: five fields, minute, hour, day of month, month and
+// day of week, each *, a value, a range a-b or a list of them, with an
+// optional /step, as cron takes them, months and weekdays by their names
+// too; or @hourly, @daily, @weekly, @monthly or @yearly; or @every and a
+// duration, such as @every 90m. A job matching both a restricted day of
+// month and day of week runs on either, as in cron.
+func Parse(expr string) (Spec, error) {
+	expr = strings.TrimSpace(expr)
+	s := Spec{expr: expr}
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d <= 0 {
+			return Spec{}, fmt.Errorf("schedule %q: want a positive duration after @every", expr)
+		}
+		s.every = d
+		return s, nil
+	}
+	if full, ok := shorthands[strings.ToLower(expr)]; ok {
+		expr = full
+	} else if strings.HasPrefix(expr, "@") {
+		return Spec{}, fmt.Errorf("schedule %q: unknown shorthand", expr)
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Spec{}, fmt.Errorf("schedule %q: want 5 fields, minute hour day-of-month month day-of-week, got %d", s.expr, len(parts))
+	}
+	sets := make([]uint64, len(fields))
+	for i, f := range fields {
+		set, err := f.parse(parts[i])
+		if err != nil {
+			return Spec{}, fmt.Errorf("schedule %q: %s: %w", s.expr, f.name, err)
+		}
+		sets[i] = set
+	}
+	s.minute, s.hour, s.dom, s.month, s.dow = sets[0], sets[1], sets[2], sets[3], sets[4]
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	s.domRestricted, s.dowRestricted = parts[2] != "*", parts[4] != "*"
+	return s, nil
+}
+
+// MustParse is Parse for specs known to be right, panicking on an error
+func MustParse(expr string) Spec {
+	s, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// parse reads a field into the set of values it matches
+func (f field) parse(text string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(text, ",") {
+		span, stepText, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q", stepText)
+			}
+			step = n
+		}
+		lo, hi := f.min, f.max
+		if span != "*" {
+			a, b, ranged := strings.Cut(span, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if ranged {
+				if hi, err = f.value(b); err != nil {
+					return 0, err
+				}
+			} else if stepped {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("range %s runs backwards", span)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value reads one value of the field, a number or a name
+func (f field) value(text string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%q isn't a value from %d to %d", text, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (s Spec) String() string {
+	return s.expr
+}
+
+// Next is the first time after t the spec matches, in t's location; the
+// zero time if it never does, as for February 30th
+func (s Spec) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// a match is at most some years off, past leap days, so a spec still
+	// unmatched after that never matches
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches is whether t's day is one of the spec's, by day of month or
+// of week as cron has it
+func (s Spec) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
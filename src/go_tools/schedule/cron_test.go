@@ -0,0 +1,95 @@
+package schedule
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseAndNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, c := range []struct{ expr, from, want string }{
+		{"* * * * *", "2024-06-01 12:00", "2024-06-01 12:01"},
+		{"30 3 * * *", "2024-06-01 12:00", "2024-06-02 03:30"},
+		{"@daily", "2024-06-01 00:00", "2024-06-02 00:00"},
+		{"@hourly", "2024-06-01 12:59", "2024-06-01 13:00"},
+		{"*/15 9-17 * * mon-fri", "2024-06-01 12:00", "2024-06-03 09:00"}, // a Saturday
+		{"0 2 * * 7", "2024-06-01 12:00", "2024-06-02 02:00"},             // Sunday as 7
+		{"0 0 1,15 * *", "2024-06-02 00:00", "2024-06-15 00:00"},
+		{"0 0 13 * fri", "2024-06-01 00:00", "2024-06-07 00:00"}, // on either day
+		{"0 0 29 feb *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"5-10/5 * * dec *", "2024-06-01 00:00", "2024-12-01 00:05"},
+		{"@every 90m", "2024-06-01 12:00", "2024-06-01 13:30"},
+	} {
+		s, err := Parse(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if got := s.Next(at(c.from)); !got.Equal(at(c.want)) {
+			t.Errorf("%s after %s = %s, want %s", c.expr, c.from, got, c.want)
+		}
+	}
+	if next := MustParse("0 0 30 feb *").Next(at("2024-01-01 00:00")); !next.IsZero() {
+		t.Errorf("February 30th at %s", next)
+	}
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "@sometimes", "@every -1m", "* * * smarch *"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) took it", bad)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var quick, slow atomic.Int32
+	Run(ctx, []Job{
+		{Name: "quick", Spec: MustParse("@every 20ms"), Run: func(context.Context, time.Time) error {
+			quick.Add(1)
+			return nil
+		}},
+		{Name: "slow", Spec: MustParse("@every 10ms"), Run: func(ctx context.Context, _ time.Time) error {
+			slow.Add(1)
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	})
+	if n := quick.Load(); n < 4 || n > 10 {
+		t.Errorf("quick job ran %d times in 200ms every 20ms", n)
+	}
+	if n := slow.Load(); n != 1 {
+		t.Errorf("slow job ran %d times, overlapping itself", n)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"old.autosave": 48 * time.Hour, "new.autosave": time.Hour, "old.json": 48 * time.Hour} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, nil, 0644)
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+	}
+	os.Mkdir(filepath.Join(dir, "sub.autosave"), 0755)
+	n, err := Sweep([]string{filepath.Join(dir, "*.autosave")}, 24*time.Hour, now)
+	if err != nil || n != 1 {
+		t.Fatalf("swept %d: %v", n, err)
+	}
+	left, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(left) != 3 {
+		t.Errorf("left %v", left)
+	}
+	if _, err := Sweep(nil, 0, now); err == nil {
+		t.Error("swept without an age")
+	}
+}
@@ -0,0 +1,77 @@
+package schedule
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/crash"
+)
+
+// Job is a task run at the times its Spec says
+type Job struct {
+	Name string
+	Spec Spec
+	Run  func(ctx context.Context, at time.Time) error
+}
+
+// Run runs the jobs at their times until ctx is done, then waits for the
+// runs going to end; ctx is theirs too. Jobs run at once if due at once,
+// but a job still running when it's due again skips that run rather
+// than piling up behind itself.
+func Run(ctx context.Context, jobs []Job) {
+	next := make([]time.Time, len(jobs))
+	running := make([]atomic.Bool, len(jobs))
+	now := time.Now()
+	for i, j := range jobs {
+		next[i] = j.Spec.Next(now)
+		slog.Info("schedule: job scheduled", "job", j.Name, "spec", j.Spec.String(), "next", next[i])
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		var soonest time.Time
+		for _, at := range next {
+			if !at.IsZero() && (soonest.IsZero() || at.Before(soonest)) {
+				soonest = at
+			}
+		}
+		if soonest.IsZero() {
+			<-ctx.Done()
+			return
+		}
+		timer := time.NewTimer(time.Until(soonest))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		now = time.Now()
+		for i, j := range jobs {
+			if next[i].IsZero() || next[i].After(now) {
+				continue
+			}
+			at := next[i]
+			next[i] = j.Spec.Next(now)
+			if !running[i].CompareAndSwap(false, true) {
+				slog.Warn("schedule: job still running from its last run; skipping this one", "job", j.Name, "next", next[i])
+				continue
+			}
+			wg.Add(1)
+			i, j := i, j
+			crash.Go(func() {
+				defer wg.Done()
+				defer running[i].Store(false)
+				start := time.Now()
+				if err := j.Run(ctx, at); err != nil {
+					slog.Error("schedule: job failed", "job", j.Name, "error", err, "took", time.Since(start).Round(time.Millisecond))
+					return
+				}
+				slog.Info("schedule: job ran", "job", j.Name, "took", time.Since(start).Round(time.Millisecond))
+			})
+		}
+	}
+}
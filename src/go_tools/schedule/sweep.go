@@ -0,0 +1,38 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sweep removes the files the globs match last modified more than maxAge
+// before now, such as stale autosaves or old profiles, returning how many
+// went. Directories are left alone.
+func Sweep(globs []string, maxAge time.Duration, now time.Time) (int, error) {
+	if maxAge <= 0 {
+		return 0, fmt.Errorf("sweep: want a positive age, got %s", maxAge)
+	}
+	removed := 0
+	var problems []error
+	for _, glob := range globs {
+		paths, err := filepath.Glob(glob)
+		if err != nil {
+			return removed, fmt.Errorf("sweep %s: %w", glob, err)
+		}
+		for _, path := range paths {
+			info, err := os.Lstat(path)
+			if err != nil || !info.Mode().IsRegular() || now.Sub(info.ModTime()) <= maxAge {
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				problems = append(problems, err)
+				continue
+			}
+			removed++
+		}
+	}
+	return removed, errors.Join(problems...)
+}
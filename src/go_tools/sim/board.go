@@ -0,0 +1,277 @@
+package sim
+
+import (
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+)
+
+// Garbage is the type of the cells ADD_BLOCKS pushes onto a board
+const Garbage = "G"
+
+// Cell is one cell of a board; an empty cell has no type
+type Cell struct {
+	Type    string `json:"type,omitempty"`    // piece type, a level block's, or Garbage
+	Special string `json:"special,omitempty"` // a level.Special kind
+}
+
+// Empty reports whether nothing is in the cell
+func (c Cell) Empty() bool { return c.Type == "" }
+
+// Board is a player's playfield indexed [y][x], y growing downwards
+type Board [][]Cell
+
+// NewBoard is an empty board of the size
+func NewBoard(width, height int) Board {
+	b := make(Board, height)
+	for y := range b {
+		b[y] = make([]Cell, width)
+	}
+	return b
+}
+
+// LevelBoard is the level's starting board, its blocks placed
+func LevelBoard(lvl *level.Level) Board {
+	b := NewBoard(lvl.GridSize.Width, lvl.GridSize.Height)
+	for _, bl := range lvl.Blocks {
+		if lvl.InBounds(bl.X, bl.Y) {
+			b[bl.Y][bl.X] = Cell{Type: bl.Type, Special: bl.Special}
+		}
+	}
+	return b
+}
+
+// Width is the board's width in cells
+func (b Board) Width() int {
+	if len(b) == 0 {
+		return 0
+	}
+	return len(b[0])
+}
+
+// Clone is a copy of the board
+func (b Board) Clone() Board {
+	c := make(Board, len(b))
+	for y := range b {
+		c[y] = append([]Cell(nil), b[y]...)
+	}
+	return c
+}
+
+// Rows draws the board a string a row: . for an empty cell, the type of a
+// block, and a special block's kind's initial in lower case
+func (b Board) Rows() []string {
+	rows := make([]string, len(b))
+	for y, row := range b {
+		line := make([]byte, len(row))
+		for x, c := range row {
+			switch {
+			case c.Empty():
+				line[x] = '.'
+			case c.Special != "":
+				line[x] = c.Special[0]
+			default:
+				line[x] = c.Type[0]
+			}
+		}
+		rows[y] = string(line)
+	}
+	return rows
+}
+
+// Occupancy marks the cells holding blocks, as level.Occupancy does
+func (b Board) Occupancy() [][]bool {
+	grid := make([][]bool, len(b))
+	for y, row := range b {
+		grid[y] = make([]bool, len(row))
+		for x, c := range row {
+			grid[y][x] = !c.Empty()
+		}
+	}
+	return grid
+}
+
+// fits reports whether the cells, moved by dx and dy, are inside the board
+// and empty
+func (b Board) fits(cells []level.Point, dx, dy int) bool {
+	for _, c := range cells {
+		x, y := c.X+dx, c.Y+dy
+		if x < 0 || y < 0 || y >= len(b) || x >= b.Width() || !b[y][x].Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// Drop is the piece moved straight down as far as it fits
+func (b Board) Drop(pc Piece) Piece {
+	cells, _ := pieces.Cells(pc.Type, pc.Rotation)
+	for b.fits(cells, pc.X, pc.Y+1) {
+		pc.Y++
+	}
+	return pc
+}
+
+// Fits reports whether the piece is inside the board on empty cells
+func (b Board) Fits(pc Piece) bool {
+	cells, ok := pieces.Cells(pc.Type, pc.Rotation)
+	return ok && b.fits(cells, pc.X, pc.Y)
+}
+
+// Lock locks the piece into the board where it is and clears rows as the
+// game does, answering the lines cleared
+func (b Board) Lock(pc Piece) int {
+	lines, _ := b.lock(pc)
+	return lines
+}
+
+func (b Board) lock(pc Piece) (int, []triggered) {
+	for _, c := range pc.Cells() {
+		b[c.Y][c.X] = Cell{Type: pc.Type}
+	}
+	return b.clear()
+}
+
+func (b Board) full(y int) bool {
+	for _, c := range b[y] {
+		if c.Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// triggered is a special block set off by a clear
+type triggered struct {
+	kind string
+	x, y int
+}
+
+// clear removes the board's full rows, rows above falling into their
+// place, and plays out the special blocks in them: a bomb also destroys
+// the blocks around it, setting off any bomb there in turn; ice keeps its
+// row from clearing, thawing into a plain block while the row's other
+// blocks go; and a heavy block, after a clear, sinks down its column as
+// far as it can. Clears a heavy block's sinking completes are cleared too.
+// It answers the lines cleared and the special blocks set off.
+func (b Board) clear() (lines int, specials []triggered) {
+	for {
+		n, set := b.clearOnce()
+		lines += n
+		specials = append(specials, set...)
+		if len(set) == 0 && n == 0 || !b.sink() {
+			return lines, specials
+		}
+	}
+}
+
+// clearOnce clears the full rows; sinking heavy blocks is left to the
+// caller
+func (b Board) clearOnce() (int, []triggered) {
+	height, width := len(b), b.Width()
+	remove := make([]bool, height)
+	destroy := make([][]bool, height)
+	for y := range destroy {
+		destroy[y] = make([]bool, width)
+	}
+	var set []triggered
+	var bombs []level.Point
+	for y := 0; y < height; y++ {
+		if !b.full(y) {
+			continue
+		}
+		ice := false
+		for x, c := range b[y] {
+			if c.Special == level.SpecialIce {
+				ice = true
+			}
+			if c.Special != "" {
+				set = append(set, triggered{kind: c.Special, x: x, y: y})
+				if c.Special == level.SpecialBomb {
+					bombs = append(bombs, level.Point{X: x, Y: y})
+				}
+			}
+		}
+		if !ice {
+			remove[y] = true
+			continue
+		}
+		// the ice thaws and stays; the rest of the row goes
+		for x := range b[y] {
+			if b[y][x].Special == level.SpecialIce {
+				b[y][x].Special = ""
+			} else {
+				destroy[y][x] = true
+			}
+		}
+	}
+	for i := 0; i < len(bombs); i++ {
+		p := bombs[i]
+		for y := p.Y - 1; y <= p.Y+1; y++ {
+			for x := p.X - 1; x <= p.X+1; x++ {
+				if y < 0 || y >= height || x < 0 || x >= width || destroy[y][x] || b[y][x].Empty() {
+					continue
+				}
+				destroy[y][x] = true
+				if c := b[y][x]; c.Special == level.SpecialBomb && !remove[y] {
+					set = append(set, triggered{kind: c.Special, x: x, y: y})
+					bombs = append(bombs, level.Point{X: x, Y: y})
+				}
+			}
+		}
+	}
+	if len(set) == 0 && !anyTrue(remove) {
+		return 0, nil
+	}
+
+	kept := make([][]Cell, 0, height)
+	lines := 0
+	for y := 0; y < height; y++ {
+		if remove[y] {
+			lines++
+			continue
+		}
+		row := b[y]
+		for x := range row {
+			if destroy[y][x] {
+				row[x] = Cell{}
+			}
+		}
+		kept = append(kept, row)
+	}
+	for y := 0; y < lines; y++ {
+		b[y] = make([]Cell, width)
+	}
+	copy(b[lines:], kept)
+	return lines, set
+}
+
+// sink drops every heavy block down its column onto whatever is below it,
+// lowest first, reporting whether any moved
+func (b Board) sink() bool {
+	moved := false
+	for y := len(b) - 2; y >= 0; y-- {
+		for x := range b[y] {
+			if b[y][x].Special != level.SpecialHeavy {
+				continue
+			}
+			to := y
+			for to+1 < len(b) && b[to+1][x].Empty() {
+				to++
+			}
+			if to != y {
+				b[to][x], b[y][x] = b[y][x], Cell{}
+				moved = true
+			}
+		}
+	}
+	return moved
+}
+
+func anyTrue(v []bool) bool {
+	for _, t := range v {
+		if t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package sim
+
+import "github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+
+// OptionsFromConfig are the simulation rules the config's tables set: its
+// randomizer, scoring, spellbook, rules of play and versus attack table
+func OptionsFromConfig(config utils.Config) (Options, error) {
+	opts := Options{Randomizer: config.PieceRandomizer}
+	if config.ScoringFile != "" {
+		scoring, err := LoadScoring(config.ScoringFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.Scoring = &scoring
+	}
+	if config.SpellsFile != "" {
+		var err error
+		if opts.Spells, err = LoadSpellbook(config.SpellsFile); err != nil {
+			return opts, err
+		}
+	}
+	if config.PlayRulesFile != "" {
+		rules, err := LoadRules(config.PlayRulesFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.Rules = &rules
+	}
+	if config.AttackFile != "" {
+		attack, err := LoadAttack(config.AttackFile)
+		if err != nil {
+			return opts, err
+		}
+		opts.Versus = &attack
+	}
+	return opts, nil
+}
@@ -0,0 +1,274 @@
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"slices"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Check is the first way the game's state doesn't hold together, nil when
+// it does: every board keeps the level's size and holds only pieces'
+// blocks, garbage and known specials, a piece in play lies on empty cells
+// of its board, no score, tally or queued garbage is negative, and a
+// player still playing sees their whole preview
+func (g *Game) Check() error {
+	for _, p := range g.players {
+		if len(p.board) != g.lvl.GridSize.Height || p.board.Width() != g.lvl.GridSize.Width {
+			return fmt.Errorf("player %s: board %dx%d on a %dx%d level", p.id, p.board.Width(), len(p.board), g.lvl.GridSize.Width, g.lvl.GridSize.Height)
+		}
+		for y, row := range p.board {
+			if len(row) != g.lvl.GridSize.Width {
+				return fmt.Errorf("player %s: row %d is %d wide", p.id, y, len(row))
+			}
+			for x, c := range row {
+				if !c.Empty() && !level.IsBlockType(c.Type) && c.Type != Garbage {
+					return fmt.Errorf("player %s: cell (%d,%d) is unknown type %q", p.id, x, y, c.Type)
+				}
+				if c.Special != "" && (c.Empty() || !slices.Contains(level.SpecialKinds, c.Special)) {
+					return fmt.Errorf("player %s: cell (%d,%d) is special %q", p.id, x, y, c.Special)
+				}
+			}
+		}
+		if p.piece != nil && !p.board.Fits(*p.piece) {
+			return fmt.Errorf("player %s: piece %s at (%d,%d) rotation %d overlaps the board", p.id, p.piece.Type, p.piece.X, p.piece.Y, p.piece.Rotation)
+		}
+		if p.piece != nil && p.toppedOut {
+			return fmt.Errorf("player %s: topped out with a piece in play", p.id)
+		}
+		if p.score < 0 || p.lines < 0 || p.combo < 0 || p.locks < 0 || p.collected < 0 || p.triggered < 0 {
+			return fmt.Errorf("player %s: negative score or tally", p.id)
+		}
+		for _, in := range p.incoming {
+			if in.rows <= 0 || in.gap < 0 || in.gap >= p.board.Width() {
+				return fmt.Errorf("player %s: garbage of %d rows with a gap at %d queued", p.id, in.rows, in.gap)
+			}
+		}
+		if len(p.spells) > MaxSpells {
+			return fmt.Errorf("player %s: holds %d spells", p.id, len(p.spells))
+		}
+		if p.drawn > 0 && !p.toppedOut && len(p.queue) != max(g.opts.Preview, 0) {
+			return fmt.Errorf("player %s: sees %d pieces coming, want %d", p.id, len(p.queue), max(g.opts.Preview, 0))
+		}
+	}
+	return nil
+}
+
+// FuzzFrames is the frames a Fuzz game plays at most
+const FuzzFrames = 20 * FrameRate
+
+// Fuzz plays a game drawn from data and reports the first way it breaks:
+// a panic, a state Check rejects, a game restored from a snapshot playing
+// on differently from the game it was taken of, or the game's replay
+// failing to verify. The bytes pick the level's size, blocks, pickups and
+// mode, the rules, handling and players, the frame the snapshot is taken on, then
+// frame by frame each player's inputs and casts, all of them ones the game
+// accepts; data running out reads as zeros, so any data plays a game.
+func Fuzz(data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	src := &fuzzSource{data: data}
+	lvl := src.level()
+	opts := src.options()
+	g, err := New(lvl, opts)
+	if err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	at := src.intn(FuzzFrames)
+	var restored *Game
+	for g.frame < FuzzFrames && !g.Over() {
+		if g.frame == at {
+			if restored, err = restore(g, lvl, opts); err != nil {
+				return fmt.Errorf("frame %d: %w", g.frame, err)
+			}
+		}
+		games := []*Game{g}
+		if restored != nil {
+			games = append(games, restored)
+		}
+		for _, id := range g.Players() {
+			if err := src.play(games, id); err != nil {
+				return fmt.Errorf("frame %d: %w", g.frame, err)
+			}
+		}
+		for _, game := range games {
+			game.Tick()
+		}
+		if err := g.Check(); err != nil {
+			return fmt.Errorf("frame %d: %w", g.frame, err)
+		}
+		if restored != nil && restored.Checksum() != g.Checksum() {
+			return fmt.Errorf("frame %d: the game restored on frame %d diverged", g.frame, at)
+		}
+	}
+
+	raw, err := json.Marshal(g.Replay("fuzz"))
+	if err != nil {
+		return err
+	}
+	var r replay.Replay
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return fmt.Errorf("read the replay back: %w", err)
+	}
+	v, err := Verify(lvl, &r, opts)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if v.Diverged {
+		return fmt.Errorf("the replay diverged on frame %d", v.Frame)
+	}
+	return nil
+}
+
+// restore is the game restored from its snapshot read back from JSON
+func restore(g *Game, lvl *level.Level, opts Options) (*Game, error) {
+	raw, err := json.Marshal(g.Snapshot())
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("read the snapshot back: %w", err)
+	}
+	return Restore(lvl, &s, opts)
+}
+
+// fuzzActions are the inputs a fuzzed player plays
+var fuzzActions = []string{
+	replay.ActionLeft, replay.ActionRight, replay.ActionRotateCW, replay.ActionRotateCCW,
+	replay.ActionSoftDrop, replay.ActionHardDrop, replay.ActionHold,
+}
+
+// fuzzSource draws a fuzzed game's choices from its data
+type fuzzSource struct {
+	data []byte
+}
+
+// intn is a choice of n, 0 once the data runs out
+func (s *fuzzSource) intn(n int) int {
+	if len(s.data) == 0 || n <= 0 {
+		return 0
+	}
+	v := int(s.data[0])
+	s.data = s.data[1:]
+	if n > 256 {
+		v = v<<8 | s.intn(256)
+	}
+	return v % n
+}
+
+// level is a level of a size from 4x4 up to 12x24, blocks up to half its
+// height, some of them special, a few pickups and maybe the physics mode
+func (s *fuzzSource) level() *level.Level {
+	lvl := level.New("fuzz", 4+s.intn(9), 4+s.intn(21))
+	w, h := lvl.GridSize.Width, lvl.GridSize.Height
+	if s.intn(4) == 0 {
+		lvl.Mode = level.ModePhysics
+	}
+	for y := h - s.intn(h/2+1); y < h; y++ {
+		for x := 0; x < w; x++ {
+			if s.intn(3) == 0 {
+				continue
+			}
+			b := level.Block{Type: level.BlockTypes[s.intn(len(level.BlockTypes))], X: x, Y: y}
+			if s.intn(8) == 0 {
+				b.Special = level.SpecialKinds[s.intn(len(level.SpecialKinds))]
+			}
+			lvl.Blocks = append(lvl.Blocks, b)
+		}
+	}
+	used := make(map[level.Point]bool)
+	for _, b := range lvl.Blocks {
+		used[level.Point{X: b.X, Y: b.Y}] = true
+	}
+	for n := s.intn(4); n > 0; n-- {
+		at := level.Point{X: s.intn(w), Y: s.intn(h)}
+		if used[at] {
+			continue
+		}
+		used[at] = true
+		lvl.Pickups = append(lvl.Pickups, level.Pickup{Spell: level.Spells[s.intn(len(level.Spells))], X: at.X, Y: at.Y})
+	}
+	if s.intn(4) == 0 {
+		lvl.SpawnPoints = append(lvl.SpawnPoints, level.Point{X: s.intn(w), Y: 0})
+	}
+	return lvl
+}
+
+// options are the rules, the handling delayed or not, one or two players,
+// their clears attacking each other or not, and the physics math
+func (s *fuzzSource) options() Options {
+	opts := Options{
+		Seed:          int64(s.intn(1 << 16)),
+		Randomizer:    pieces.Randomizers[s.intn(len(pieces.Randomizers))],
+		Rotation:      pieces.RotationSystems[s.intn(len(pieces.RotationSystems))],
+		Gravity:       []float64{DefaultGravity, 5, 20, FrameRate}[s.intn(4)],
+		LockDelay:     s.intn(FrameRate),
+		Preview:       s.intn(DefaultPreview+2) - 1,
+		ChecksumEvery: 1 + s.intn(FrameRate),
+	}
+	if s.intn(2) == 1 {
+		rules := DefaultRules()
+		rules.Handling = Handling{Model: HandlingDAS, DAS: s.intn(DefaultDAS * 2), ARR: s.intn(DefaultARR * 2)}
+		rules.Hold = s.intn(2) == 1
+		for lines := 0; s.intn(2) == 1; {
+			lines += 1 + s.intn(4)
+			rules.Gravity = append(rules.Gravity, GravityStep{Lines: lines, Gravity: float64(1 + s.intn(2*FrameRate))})
+		}
+		opts.Rules = &rules
+	}
+	if s.intn(2) == 1 {
+		opts.Players = []string{"p1", "p2"}
+		if s.intn(2) == 1 {
+			attack := DefaultAttack()
+			attack.Delay = s.intn(2 * FrameRate)
+			opts.Versus = &attack
+		}
+	}
+	opts.Physics = PhysicsModes[s.intn(len(PhysicsModes))]
+	return opts
+}
+
+// play queues up to three inputs of the player still playing, and maybe a
+// cast of a spell they hold, on each game alike; the games must take or
+// refuse them alike
+func (s *fuzzSource) play(games []*Game, id string) error {
+	st, _ := games[0].State(id)
+	if st.ToppedOut {
+		return nil
+	}
+	for n := s.intn(4); n > 0; n-- {
+		act := fuzzActions[s.intn(len(fuzzActions))]
+		for _, g := range games {
+			if err := g.Input(id, act); err != nil {
+				return fmt.Errorf("player %s: %s refused: %w", id, act, err)
+			}
+		}
+	}
+	if len(st.Spells) == 0 || s.intn(8) != 0 {
+		return nil
+	}
+	spell := st.Spells[s.intn(len(st.Spells))]
+	var first error
+	for i, g := range games {
+		err := g.Cast(id, spell, "")
+		switch {
+		case i == 0:
+			first = err
+		case (err == nil) != (first == nil):
+			return fmt.Errorf("player %s: the games disagree on casting %s", id, spell)
+		}
+	}
+	if first != nil && !errors.Is(first, ErrNoTarget) {
+		return fmt.Errorf("player %s: casting %s they hold refused: %w", id, spell, first)
+	}
+	return nil
+}
@@ -0,0 +1,486 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Physics of the game's physics mode, as its engine steps it: a block is
+// a box of its own, y points up from the floor at 0 and a step lasts a
+// frame
+const (
+	PhysicsGravity     = -9.8 // units a second, squared
+	PhysicsDamping     = 0.98 // of its velocity a body keeps each step
+	PhysicsRestitution = 0.1  // a block's
+	PhysicsFriction    = 0.8  // a block's
+	PhysicsCorrection  = 0.2  // of a penetration past the slop pushed apart each step
+	PhysicsSlop        = 0.01
+	PhysicsRest        = 0.1  // speed under which a supported body is at rest
+	PhysicsTolerance   = 0.05 // a body may sit from the game's before the two diverge
+	PhysicsSettleSteps = 10 * FrameRate
+)
+
+// Physics math modes
+const (
+	PhysicsFloat = "float" // the engine's float arithmetic, as the platform rounds it
+	PhysicsFixed = "fixed" // fixed point, bit-identical on every architecture
+)
+
+// PhysicsModes lists every physics math mode in a stable order
+var PhysicsModes = []string{PhysicsFloat, PhysicsFixed}
+
+// PhysicsFixedScale is the steps a unit holds in fixed point: positions,
+// velocities and every product of them are rounded to its multiples
+const PhysicsFixedScale = 1 << 16
+
+// Vec is a point or a velocity in the physics world
+type Vec struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Body is a box in the physics world, in the game engine's JSON layout
+type Body struct {
+	ID          string  `json:"id"`
+	Position    Vec     `json:"position"` // of its center
+	Velocity    Vec     `json:"velocity"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Mass        float64 `json:"mass"`
+	Restitution float64 `json:"restitution"`
+	Friction    float64 `json:"friction"`
+	Static      bool    `json:"isStatic"`
+	Cell        Cell    `json:"-"` // the board cell it came from
+}
+
+// World is a physics world of boxes standing on the floor between two
+// walls. It is the game engine simplified: boxes keep upright, so one
+// whose center hangs past the boxes holding it up topples by sliding off
+// their edge rather than turning, and a stack passes each box's weight
+// straight down to the boxes under it, lowest first.
+//
+// A Fixed world steps in fixed point: its quantities are multiples of
+// 1/PhysicsFixedScale, small enough that float64 holds their sums and the
+// products of two exactly, and every other result is rounded back onto
+// them before it is used, so no platform's rounding or fused
+// multiply-adds can tell two runs apart.
+type World struct {
+	Width  float64 // the walls stand at 0 and Width; none when zero
+	Bodies []Body
+	Steps  int
+	Fixed  bool
+
+	resting bool // every body was at rest on the last step
+}
+
+// NewWorld is a world of the board's blocks, a unit box each at rest
+func NewWorld(b Board) *World {
+	w := &World{Width: float64(b.Width())}
+	for y, row := range b {
+		for x, c := range row {
+			if c.Empty() {
+				continue
+			}
+			w.Bodies = append(w.Bodies, Body{
+				ID:          fmt.Sprintf("block_%d_%d", x, y),
+				Position:    Vec{X: float64(x) + 0.5, Y: float64(len(b)-y) - 0.5},
+				Width:       1,
+				Height:      1,
+				Mass:        1,
+				Restitution: PhysicsRestitution,
+				Friction:    PhysicsFriction,
+				Cell:        c,
+			})
+		}
+	}
+	return w
+}
+
+// ParseWorld reads a physics state the game engine exported, its bodies
+// between walls width apart
+func ParseWorld(data []byte, width float64) (*World, error) {
+	var state struct {
+		Bodies []Body `json:"bodies"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse physics state: %w", err)
+	}
+	for _, b := range state.Bodies {
+		if b.Width <= 0 || b.Height <= 0 || !b.Static && b.Mass <= 0 {
+			return nil, fmt.Errorf("physics body %q has no size or mass", b.ID)
+		}
+	}
+	return &World{Width: width, Bodies: state.Bodies}, nil
+}
+
+// contact is two bodies, or a body and the floor or a wall, touching
+type contact struct {
+	a, b     int  // bodies; b is floorOrWall for the floor or a wall
+	vertical bool // a stands on b; otherwise b is to a's right
+	pen      float64
+}
+
+const floorOrWall = -1
+
+// Step plays a step as the game engine does: contacts are found and
+// resolved, then gravity and damping act and the bodies move
+func (w *World) Step() {
+	contacts := w.contacts()
+	tipping := w.tipping(contacts)
+	for _, c := range contacts {
+		w.resolve(c, tipping)
+	}
+
+	supported := make(map[int]bool, len(w.Bodies))
+	for _, c := range contacts {
+		if c.vertical {
+			supported[c.a] = true
+		}
+	}
+	w.resting = true
+	for i := range w.Bodies {
+		b := &w.Bodies[i]
+		if b.Static {
+			continue
+		}
+		if !supported[i] || tipping[i] != 0 || w.moving(b.Velocity) {
+			w.resting = false
+		}
+	}
+
+	const dt = 1.0 / FrameRate
+	for i := range w.Bodies {
+		b := &w.Bodies[i]
+		if b.Static {
+			continue
+		}
+		b.Velocity.X += w.fix(tipping[i] * dt)
+		b.Velocity.Y += w.fix(PhysicsGravity * dt)
+		b.Velocity.X = w.fix(b.Velocity.X * PhysicsDamping)
+		b.Velocity.Y = w.fix(b.Velocity.Y * PhysicsDamping)
+		b.Position.X += w.fix(b.Velocity.X * dt)
+		b.Position.Y += w.fix(b.Velocity.Y * dt)
+	}
+	w.Steps++
+}
+
+// fix rounds a result onto the fixed-point steps in a Fixed world and
+// leaves it be otherwise; the conversion keeps the product it is handed
+// from fusing with what it is added to
+func (w *World) fix(v float64) float64 {
+	if !w.Fixed {
+		return v
+	}
+	return math.Round(float64(v)*PhysicsFixedScale) / PhysicsFixedScale
+}
+
+// moving reports whether a velocity is PhysicsRest or faster, comparing
+// squares in a Fixed world rather than taking a root
+func (w *World) moving(v Vec) bool {
+	if !w.Fixed {
+		return math.Hypot(v.X, v.Y) >= PhysicsRest
+	}
+	return w.fix(v.X*v.X)+w.fix(v.Y*v.Y) >= w.fix(PhysicsRest*PhysicsRest)
+}
+
+// Resting reports whether every body stood at rest on the last step,
+// supported, slower than PhysicsRest and not toppling
+func (w *World) Resting() bool { return w.resting }
+
+// Settle steps the world until every body is at rest, for at most steps,
+// reporting whether it came to rest
+func (w *World) Settle(steps int) bool {
+	for i := 0; i < steps; i++ {
+		if w.Step(); w.resting {
+			return true
+		}
+	}
+	return false
+}
+
+// contacts finds the bodies touching, lowest first, so that resolving
+// them in order passes weight down a stack before what stands on it.
+// Bodies no bigger than a block are looked for only among those around
+// them, by the unit cell their center is in.
+func (w *World) contacts() []contact {
+	var out []contact
+	var big []int
+	cells := make(map[[2]int][]int, len(w.Bodies))
+	key := func(b Body) [2]int {
+		return [2]int{int(math.Floor(b.Position.X)), int(math.Floor(b.Position.Y))}
+	}
+	for i, b := range w.Bodies {
+		if b.Width > 1 || b.Height > 1 {
+			big = append(big, i)
+		} else {
+			cells[key(b)] = append(cells[key(b)], i)
+		}
+	}
+	near := func(i int) []int {
+		a := w.Bodies[i]
+		if a.Width > 1 || a.Height > 1 {
+			all := make([]int, len(w.Bodies))
+			for j := range all {
+				all[j] = j
+			}
+			return all
+		}
+		at := key(a)
+		js := append([]int(nil), big...)
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				js = append(js, cells[[2]int{at[0] + dx, at[1] + dy}]...)
+			}
+		}
+		return js
+	}
+	for i, a := range w.Bodies {
+		if a.Static {
+			continue
+		}
+		if pen := a.Height/2 - a.Position.Y; pen >= 0 {
+			out = append(out, contact{a: i, b: floorOrWall, vertical: true, pen: pen})
+		}
+		if w.Width > 0 {
+			if pen := a.Width/2 - a.Position.X; pen >= 0 {
+				out = append(out, contact{a: i, b: floorOrWall, pen: -pen})
+			}
+			if pen := a.Position.X + a.Width/2 - w.Width; pen >= 0 {
+				out = append(out, contact{a: i, b: floorOrWall, pen: pen})
+			}
+		}
+		for _, j := range near(i) {
+			// each pair of moving bodies once
+			if j == i || j < i && !w.Bodies[j].Static {
+				continue
+			}
+			if c, ok := w.touch(i, j); ok {
+				out = append(out, c)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].vertical && (!out[j].vertical || w.below(out[i]) < w.below(out[j]))
+	})
+	return out
+}
+
+// touch is the contact of two bodies whose boxes meet along an edge,
+// across the axis they overlap least on
+func (w *World) touch(i, j int) (contact, bool) {
+	a, b := w.Bodies[i], w.Bodies[j]
+	ox := (a.Width+b.Width)/2 - math.Abs(a.Position.X-b.Position.X)
+	oy := (a.Height+b.Height)/2 - math.Abs(a.Position.Y-b.Position.Y)
+	const edge = 1e-9
+	switch {
+	case ox < 0 || oy < 0 || ox < edge && oy < edge:
+		return contact{}, false
+	case oy <= ox:
+		if a.Position.Y < b.Position.Y {
+			i, j = j, i
+		}
+		return contact{a: i, b: j, vertical: true, pen: oy}, true
+	}
+	if a.Position.X > b.Position.X {
+		i, j = j, i
+	}
+	return contact{a: i, b: j, pen: ox}, true
+}
+
+// below is the height of what a vertical contact's upper body stands on
+func (w *World) below(c contact) float64 {
+	if c.b == floorOrWall {
+		return math.Inf(-1)
+	}
+	return w.Bodies[c.b].Position.Y
+}
+
+// tipping is the push sideways on each body whose center hangs past the
+// edges of the boxes under it, the further past the harder
+func (w *World) tipping(contacts []contact) map[int]float64 {
+	type span struct{ lo, hi float64 }
+	spans := make(map[int]span)
+	for _, c := range contacts {
+		if !c.vertical {
+			continue
+		}
+		a := w.Bodies[c.a]
+		lo, hi := a.Position.X-a.Width/2, a.Position.X+a.Width/2
+		if c.b != floorOrWall {
+			b := w.Bodies[c.b]
+			lo, hi = max(lo, b.Position.X-b.Width/2), min(hi, b.Position.X+b.Width/2)
+		}
+		if s, ok := spans[c.a]; ok {
+			lo, hi = min(lo, s.lo), max(hi, s.hi)
+		}
+		spans[c.a] = span{lo, hi}
+	}
+	push := make(map[int]float64)
+	for i, s := range spans {
+		a := w.Bodies[i]
+		half := a.Width / 2
+		switch x := a.Position.X; {
+		case x < s.lo-PhysicsSlop:
+			push[i] = w.fix(PhysicsGravity * min(w.fix((s.lo-x)/half), 1))
+		case x > s.hi+PhysicsSlop:
+			push[i] = w.fix(-PhysicsGravity * min(w.fix((x-s.hi)/half), 1))
+		}
+	}
+	return push
+}
+
+// resolve answers a contact as the game engine does, by a restitution
+// impulse and friction along the contact and a push out of the
+// penetration; the body underneath holds firm against what stands on it,
+// and friction doesn't hold a body that is toppling
+func (w *World) resolve(c contact, tipping map[int]float64) {
+	a := &w.Bodies[c.a]
+	var b *Body
+	if c.b != floorOrWall {
+		b = &w.Bodies[c.b]
+	}
+	if !c.vertical {
+		w.resolveSide(c, a, b)
+		return
+	}
+	// a stands on b: b holds firm unless it alone can move
+	upper, lower, sign := a, b, 1.0
+	if b != nil && a.Static {
+		upper, lower, sign = b, a, -1
+	}
+	var under Vec
+	restitution, friction := upper.Restitution, upper.Friction
+	if lower != nil {
+		under = lower.Velocity
+		restitution = min(restitution, lower.Restitution)
+		friction = (friction + lower.Friction) / 2
+	}
+	vn := sign * (upper.Velocity.Y - under.Y)
+	if vn < 0 {
+		j := w.fix(-(1 + restitution) * vn)
+		upper.Velocity.Y += sign * j
+		if _, ok := tipping[c.a]; !ok || sign < 0 {
+			slide := upper.Velocity.X - under.X
+			limit := w.fix(friction * j)
+			upper.Velocity.X -= math.Max(-limit, math.Min(slide, limit))
+		}
+	}
+	if c.pen > PhysicsSlop {
+		upper.Position.Y += sign * w.fix((c.pen-PhysicsSlop)*PhysicsCorrection)
+	}
+}
+
+// resolveSide answers a contact between a body and the one to its right,
+// or a wall, by the bodies' masses
+func (w *World) resolveSide(c contact, a, b *Body) {
+	inv := func(b *Body) float64 {
+		if b == nil || b.Static {
+			return 0
+		}
+		return w.fix(1 / b.Mass)
+	}
+	if b == nil {
+		// a wall, to a's left when the penetration is negative
+		dir := math.Copysign(1, c.pen)
+		if dir*a.Velocity.X > 0 {
+			a.Velocity.X = w.fix(a.Velocity.X * -PhysicsRestitution)
+		}
+		if pen := math.Abs(c.pen); pen > PhysicsSlop {
+			a.Position.X -= dir * w.fix((pen-PhysicsSlop)*PhysicsCorrection)
+		}
+		return
+	}
+	total := inv(a) + inv(b)
+	if total == 0 {
+		return
+	}
+	if vn := b.Velocity.X - a.Velocity.X; vn < 0 {
+		j := w.fix(w.fix(-(1+min(a.Restitution, b.Restitution))*vn) / total)
+		a.Velocity.X -= w.fix(j * inv(a))
+		b.Velocity.X += w.fix(j * inv(b))
+	}
+	if c.pen > PhysicsSlop {
+		push := w.fix(w.fix((c.pen-PhysicsSlop)*PhysicsCorrection) / total)
+		a.Position.X -= w.fix(push * inv(a))
+		b.Position.X += w.fix(push * inv(b))
+	}
+}
+
+// Board snaps the world's bodies back onto a board of the height, each to
+// the cell its center is in, lowest first; a body landing on a cell
+// already taken takes the first free one above it, and one the board has
+// no room for is lost
+func (w *World) Board(height int) Board {
+	b := NewBoard(int(w.Width), height)
+	order := make([]int, len(w.Bodies))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return w.Bodies[order[i]].Position.Y < w.Bodies[order[j]].Position.Y
+	})
+	for _, i := range order {
+		body := w.Bodies[i]
+		x := min(max(int(math.Floor(body.Position.X)), 0), b.Width()-1)
+		y := min(max(height-1-int(math.Floor(body.Position.Y)), 0), height-1)
+		for y >= 0 && !b[y][x].Empty() {
+			y--
+		}
+		if y >= 0 {
+			b[y][x] = body.Cell
+		}
+	}
+	return b
+}
+
+// Diverge compares the world with a state of the game engine's, answering
+// the body furthest from where the game has it and how far; a body
+// missing from the world is infinitely far. The two match while the
+// distance is within PhysicsTolerance.
+func (w *World) Diverge(game *World) (id string, dist float64) {
+	at := make(map[string]Vec, len(w.Bodies))
+	for _, b := range w.Bodies {
+		at[b.ID] = b.Position
+	}
+	for _, want := range game.Bodies {
+		got, ok := at[want.ID]
+		d := math.Inf(1)
+		if ok {
+			d = math.Hypot(got.X-want.Position.X, got.Y-want.Position.Y)
+		}
+		if d > dist {
+			id, dist = want.ID, d
+		}
+	}
+	return id, dist
+}
+
+// settle lets the board's blocks fall, stack and topple in a physics
+// world, fixed point if fixed, until they come to rest, then snaps them
+// back onto the board
+func (b Board) settle(fixed bool) {
+	w := NewWorld(b)
+	w.Fixed = fixed
+	w.Settle(PhysicsSettleSteps)
+	copy(b, w.Board(len(b)))
+}
+
+// lockPhysics locks the piece into the board as lock does in physics
+// mode: its blocks settle, rows clear, and what is left settles again
+// until nothing more clears
+func (b Board) lockPhysics(pc Piece, fixed bool) (lines int, specials []triggered) {
+	for _, c := range pc.Cells() {
+		b[c.Y][c.X] = Cell{Type: pc.Type}
+	}
+	for {
+		b.settle(fixed)
+		n, set := b.clear()
+		lines += n
+		specials = append(specials, set...)
+		if n == 0 && len(set) == 0 {
+			return lines, specials
+		}
+	}
+}
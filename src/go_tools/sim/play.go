@@ -0,0 +1,456 @@
+package sim
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Objective kinds the game keeps progress of, the solver's
+const (
+	ObjectiveClearLines     = "clear_lines"
+	ObjectiveFillGoal       = "fill_goal"
+	ObjectiveCastSpell      = "cast_spell" // pickups collected
+	ObjectiveTriggerSpecial = "trigger_special"
+)
+
+// State is a player's side of the game at a frame
+type State struct {
+	Player    string   `json:"player"`
+	Piece     *Piece   `json:"piece,omitempty"`
+	Hold      string   `json:"hold,omitempty"`
+	Next      []string `json:"next"`
+	Score     int      `json:"score"`
+	Lines     int      `json:"lines"`
+	Combo     int      `json:"combo"` // clears in a row
+	Pieces    int      `json:"pieces"`
+	Pickups   int      `json:"pickups"`
+	Specials  int      `json:"specials"` // special blocks set off
+	Spells    []string `json:"spells,omitempty"`
+	Incoming  int      `json:"incoming,omitempty"` // garbage rows queued against the player
+	ToppedOut bool     `json:"toppedOut,omitempty"`
+}
+
+// State is the player's state, false for a player not in the game
+func (g *Game) State(id string) (State, bool) {
+	p, ok := g.byID[id]
+	if !ok {
+		return State{}, false
+	}
+	st := State{
+		Player: p.id, Hold: p.hold, Next: append([]string(nil), p.queue...),
+		Score: p.score, Lines: p.lines, Combo: p.combo, Pieces: p.locks,
+		Pickups: p.collected, Specials: p.triggered,
+		Spells: append([]string(nil), p.spells...), ToppedOut: p.toppedOut,
+	}
+	for _, in := range p.incoming {
+		st.Incoming += in.rows
+	}
+	if p.piece != nil {
+		pc := *p.piece
+		st.Piece = &pc
+	}
+	return st, true
+}
+
+// Board is a copy of the player's board, nil for a player not in the game
+func (g *Game) Board(id string) Board {
+	if p, ok := g.byID[id]; ok {
+		return p.board.Clone()
+	}
+	return nil
+}
+
+// progress is the player's progress towards an objective kind, pooled
+// across the players when shared
+func (g *Game) progress(p *player, o level.Objective) int {
+	if o.Shared {
+		sum := 0
+		for _, q := range g.players {
+			sum += g.progressOf(q, o.Kind)
+		}
+		return sum
+	}
+	return g.progressOf(p, o.Kind)
+}
+
+func (g *Game) progressOf(p *player, kind string) int {
+	switch kind {
+	case ObjectiveClearLines:
+		return p.lines
+	case ObjectiveCastSpell:
+		return p.collected
+	case ObjectiveTriggerSpecial:
+		return p.triggered
+	case ObjectiveFillGoal:
+		z := g.lvl.GoalArea
+		if z == nil {
+			return 0
+		}
+		filled := 0
+		for y := z.Y; y < z.Y+z.Height && y < len(p.board); y++ {
+			for x := z.X; x < z.X+z.Width && x < p.board.Width(); x++ {
+				if !p.board[y][x].Empty() {
+					filled++
+				}
+			}
+		}
+		return filled
+	}
+	return 0
+}
+
+// Complete reports whether the player has met every objective of the
+// level; a level without objectives is never complete
+func (g *Game) Complete(id string) bool {
+	p, ok := g.byID[id]
+	if !ok || len(g.lvl.Objectives) == 0 {
+		return false
+	}
+	for _, o := range g.lvl.Objectives {
+		if g.progress(p, o) < o.Target {
+			return false
+		}
+	}
+	return true
+}
+
+// Over reports whether the game has ended: a player completed the level,
+// every player topped out, or in a match one player is left
+func (g *Game) Over() bool {
+	playing := 0
+	for _, p := range g.players {
+		if g.Complete(p.id) {
+			return true
+		}
+		if !p.toppedOut {
+			playing++
+		}
+	}
+	return playing == 0 || len(g.players) > 1 && playing == 1
+}
+
+// Result is the game's outcome so far
+func (g *Game) Result() replay.Result {
+	res := replay.Result{DurationMs: timeMs(g.frame), Scores: make(map[string]int, len(g.players))}
+	var standing []string
+	for _, p := range g.players {
+		res.Scores[p.id] = p.score
+		if !p.toppedOut {
+			standing = append(standing, p.id)
+		}
+		if res.Winner == "" && g.Complete(p.id) {
+			res.Winner = p.id
+		}
+	}
+	if len(g.players) > 1 && res.Winner == "" && len(standing) == 1 {
+		res.Winner = standing[0]
+	}
+	switch {
+	case len(g.players) == 1 && res.Winner != "":
+		res.Outcome, res.Winner = replay.OutcomeCleared, ""
+	case res.Winner != "":
+		res.Outcome = replay.OutcomeWin
+	case len(standing) == 0:
+		res.Outcome = replay.OutcomeTopOut
+	}
+	return res
+}
+
+// Replay records the game played so far as a session's replay
+func (g *Game) Replay(session string) *replay.Replay {
+	r := &replay.Replay{
+		Version: replay.CurrentVersion, SessionID: session, Level: g.lvl.Name, Mode: g.lvl.Mode, Seed: g.opts.Seed,
+		Rules:  &replay.Rules{Rotation: g.opts.Rotation, Randomizer: g.opts.Randomizer, Gravity: g.opts.Gravity, LockDelay: g.opts.LockDelay, Physics: g.opts.Physics},
+		Pieces: append([]string(nil), g.dealt...),
+		Inputs: append([]replay.Input(nil), g.inputs...),
+		Events: append([]replay.Event(nil), g.events...),
+		Spells: append([]replay.SpellCast(nil), g.casts...),
+		Result: g.Result(),
+
+		ChecksumEvery: g.opts.ChecksumEvery,
+		Checksums:     append([]replay.Checksum(nil), g.checksums...),
+	}
+	for _, id := range g.Players() {
+		r.Players = append(r.Players, replay.Player{ID: id})
+	}
+	return r
+}
+
+// PlayReplay plays a replay's inputs and spells again on the level,
+// seeded with its seed and by its rules, through the frame its result ends
+// on or its last input or spell; opts name the players only when the
+// replay doesn't, and set the rules it has none of. The game checksums
+// its state as often as the replay did. The
+// replay's own events are left alone, for the caller to hold the game's
+// against. A cast input casts the player's next spell of r.Spells in its
+// place among the frame's inputs; a spell without one, as the client
+// records them, is cast after them.
+func PlayReplay(lvl *level.Level, r *replay.Replay, opts Options) (*Game, error) {
+	return ReplayTo(lvl, r, opts, -1)
+}
+
+// ReplayTo plays the replay as PlayReplay does but stops once frame frames
+// have played, for a game to snapshot or go on with from there; a frame
+// below zero plays it through
+func ReplayTo(lvl *level.Level, r *replay.Replay, opts Options, frame int) (*Game, error) {
+	rp, err := NewReplayer(lvl, r, opts)
+	if err != nil {
+		return nil, err
+	}
+	if frame >= 0 {
+		rp.end = min(rp.end, frame)
+	}
+	for !rp.Done() {
+		if _, err := rp.Step(); err != nil {
+			return rp.g, err
+		}
+	}
+	return rp.g, nil
+}
+
+// Replayer plays a replay again a frame at a time, as PlayReplay does
+type Replayer struct {
+	g      *Game
+	inputs []replay.Input
+	spells []replay.SpellCast
+	cast   []bool // spells cast by their cast inputs
+	in, sp int    // the next input and spell to play
+	end    int    // the frame it plays through
+}
+
+// NewReplayer sets the replay's game up on the level, by its rules as
+// PlayReplay has them, before its first frame
+func NewReplayer(lvl *level.Level, r *replay.Replay, opts Options) (*Replayer, error) {
+	if len(r.Players) > 0 {
+		opts.Players = nil
+		for _, p := range r.Players {
+			opts.Players = append(opts.Players, p.ID)
+		}
+	}
+	opts.Seed, opts.ChecksumEvery = r.Seed, r.ChecksumEvery
+	if rules := r.Rules; rules != nil {
+		if rules.Rotation != "" {
+			opts.Rotation = rules.Rotation
+		}
+		if rules.Randomizer != "" {
+			opts.Randomizer = rules.Randomizer
+		}
+		if rules.Gravity > 0 {
+			opts.Gravity = rules.Gravity
+		}
+		if rules.LockDelay > 0 {
+			opts.LockDelay = rules.LockDelay
+		}
+		if rules.Physics != "" {
+			opts.Physics = rules.Physics
+		}
+	}
+	g, err := New(lvl, opts)
+	if err != nil {
+		return nil, err
+	}
+	rp := &Replayer{g: g, inputs: append([]replay.Input(nil), r.Inputs...), spells: append([]replay.SpellCast(nil), r.Spells...)}
+	sort.SliceStable(rp.inputs, func(i, j int) bool { return rp.inputs[i].Frame < rp.inputs[j].Frame })
+	sort.SliceStable(rp.spells, func(i, j int) bool { return rp.spells[i].Frame < rp.spells[j].Frame })
+	rp.cast = make([]bool, len(rp.spells))
+	rp.end = int((r.Result.DurationMs*FrameRate + 999) / 1000)
+	if n := len(rp.inputs); n > 0 {
+		rp.end = max(rp.end, rp.inputs[n-1].Frame+1)
+	}
+	if n := len(rp.spells); n > 0 {
+		rp.end = max(rp.end, rp.spells[n-1].Frame+1)
+	}
+	return rp, nil
+}
+
+// Game is the game the replay is played on
+func (rp *Replayer) Game() *Game { return rp.g }
+
+// Done reports whether the replay has played through, or its game is
+// over
+func (rp *Replayer) Done() bool { return rp.g.frame >= rp.end || rp.g.Over() }
+
+// Step plays the replay's next frame: its inputs and spells are queued,
+// then the frame is played, answering its events
+func (rp *Replayer) Step() ([]replay.Event, error) {
+	g := rp.g
+	inputs, spells := rp.inputs, rp.spells
+	for ; rp.in < len(inputs) && inputs[rp.in].Frame <= g.frame; rp.in++ {
+		if inputs[rp.in].Action == replay.ActionCast {
+			for i := rp.sp; i < len(spells) && spells[i].Frame <= g.frame; i++ {
+				if !rp.cast[i] && spells[i].Player == inputs[rp.in].Player {
+					rp.cast[i] = true
+					if err := g.Cast(spells[i].Player, spells[i].Spell, spells[i].Target); err != nil {
+						return nil, fmt.Errorf("frame %d: spell %d: %w", g.frame, i, err)
+					}
+					break
+				}
+			}
+			continue
+		}
+		if err := g.Input(inputs[rp.in].Player, inputs[rp.in].Action); err != nil {
+			return nil, fmt.Errorf("frame %d: input %d: %w", g.frame, rp.in, err)
+		}
+	}
+	for ; rp.sp < len(spells) && spells[rp.sp].Frame <= g.frame; rp.sp++ {
+		if rp.cast[rp.sp] {
+			continue
+		}
+		if err := g.Cast(spells[rp.sp].Player, spells[rp.sp].Spell, spells[rp.sp].Target); err != nil {
+			return nil, fmt.Errorf("frame %d: spell %d: %w", g.frame, rp.sp, err)
+		}
+	}
+	return g.Tick(), nil
+}
+
+// Placement is somewhere the player's piece can lock and the inputs that
+// take it there and hard drop it, all queued on one frame; under
+// HandlingDAS a run of shifts plays out over the frames after
+type Placement struct {
+	Piece   Piece    `json:"piece"` // as it locks
+	Inputs  []string `json:"inputs"`
+	Pickups []string `json:"pickups,omitempty"` // the spells the piece picks up on its way, in order
+}
+
+// Placements are the places the player's piece can be hard dropped to
+// from where it is, each with the shortest inputs that get it there, in
+// the order a breadth-first search over the inputs reaches them; none
+// when the player has no piece
+func (g *Game) Placements(id string) []Placement {
+	p, ok := g.byID[id]
+	if !ok || p.piece == nil {
+		return nil
+	}
+	return g.placements(p, *p.piece)
+}
+
+// HoldPlacements are the placements of the piece holding would bring into
+// play, the held one or the first coming, from where it would spawn, each
+// led by the hold; none when holding isn't allowed, the player held this
+// piece already or can't see the piece holding would bring
+func (g *Game) HoldPlacements(id string) []Placement {
+	p, ok := g.byID[id]
+	if !ok || p.piece == nil || p.held || !g.rules.Hold {
+		return nil
+	}
+	typ := p.hold
+	if typ == "" {
+		if len(p.queue) == 0 {
+			return nil
+		}
+		typ = p.queue[0]
+	}
+	start, ok := g.spawnAt(p, typ)
+	if !ok {
+		return nil
+	}
+	out := g.placements(p, start)
+	for i := range out {
+		out[i].Inputs = append([]string{replay.ActionHold}, out[i].Inputs...)
+	}
+	return out
+}
+
+// placements are the places a piece at start can be hard dropped to on
+// the player's board, as Placements finds them, with the pickups the
+// piece passes over on the way
+func (g *Game) placements(p *player, start Piece) []Placement {
+	moves := []struct {
+		input       string
+		dx, dy, rot int
+	}{
+		{replay.ActionLeft, -1, 0, 0},
+		{replay.ActionRight, 1, 0, 0},
+		{replay.ActionRotateCW, 0, 0, 1},
+		{replay.ActionRotateCCW, 0, 0, 3},
+		{replay.ActionSoftDrop, 0, 1, 0},
+	}
+	how := map[Piece][]string{start: nil}
+	got := map[Piece][]level.Point{start: p.pickedUp(start, nil)}
+	landed := make(map[Piece]bool)
+	var out []Placement
+	queue := []Piece{start}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if at := p.board.Drop(cur); !landed[at] {
+			landed[at] = true
+			pl := Placement{Piece: at, Inputs: append(append([]string(nil), how[cur]...), replay.ActionHardDrop)}
+			cells := got[cur]
+			for y := cur.Y + 1; y <= at.Y; y++ {
+				cells = p.pickedUp(Piece{Type: at.Type, X: at.X, Y: y, Rotation: at.Rotation}, cells)
+			}
+			for _, c := range cells {
+				pl.Pickups = append(pl.Pickups, p.pickups[c])
+			}
+			out = append(out, pl)
+		}
+		for _, m := range moves {
+			next := Piece{Type: cur.Type, X: cur.X + m.dx, Y: cur.Y + m.dy, Rotation: cur.Rotation}
+			if m.rot != 0 {
+				var ok bool
+				if next, ok = g.turn(p.board, cur, m.rot); !ok {
+					continue
+				}
+			} else if !p.board.Fits(next) {
+				continue
+			}
+			if _, seen := how[next]; seen {
+				continue
+			}
+			how[next] = append(append([]string(nil), how[cur]...), m.input)
+			got[next] = p.pickedUp(next, got[cur])
+			queue = append(queue, next)
+		}
+	}
+	return out
+}
+
+// pickedUp are the pickup cells had with those under the piece added, a
+// new slice when any are
+func (p *player) pickedUp(pc Piece, had []level.Point) []level.Point {
+	if len(p.pickups) == 0 {
+		return had
+	}
+	out := had
+	for _, c := range pc.Cells() {
+		if _, ok := p.pickups[c]; ok && !slices.Contains(out, c) {
+			if len(out) == len(had) {
+				out = slices.Clone(had)
+			}
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Path is the shortest run of inputs that takes the player's piece to
+// column x in rotation rot and hard drops it there, all queued on one
+// frame; false when the piece can't get there
+func (g *Game) Path(id string, x, rot int) ([]string, bool) {
+	for _, pl := range g.Placements(id) {
+		if pl.Piece.X == x && pl.Piece.Rotation == rot%4 {
+			return pl.Inputs, true
+		}
+	}
+	return nil, false
+}
+
+// Place queues the inputs that hard drop the player's piece at column x in
+// rotation rot, as Path finds them
+func (g *Game) Place(id string, x, rot int) error {
+	path, ok := g.Path(id, x, rot)
+	if !ok {
+		return fmt.Errorf("player %s can't place the piece at column %d rotation %d", id, x, rot)
+	}
+	for _, input := range path {
+		if err := g.Input(id, input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
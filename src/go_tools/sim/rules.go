@@ -0,0 +1,122 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Handling models, how a player's shifts in a row apply
+const (
+	HandlingInstant = "instant" // every shift queued applies on the frame it is queued for
+	HandlingDAS     = "das"     // held shifts charge a delayed auto shift, then repeat
+)
+
+// Defaults of DefaultRules' handling
+const (
+	DefaultDAS = 10 // frames
+	DefaultARR = 2  // frames
+)
+
+// Rules are a game mode's rules of play: its gravity curve, lock delay,
+// handling, hold and preview
+type Rules struct {
+	Gravity   []GravityStep `json:"gravity,omitempty"` // none plays the options' gravity throughout
+	LockDelay int           `json:"lockDelay"`
+	MaxResets int           `json:"maxResets"`
+	Handling  Handling      `json:"handling"`
+	Hold      bool          `json:"hold"` // whether players can hold
+	Preview   int           `json:"preview"`
+}
+
+// GravityStep is a step of a gravity curve: the gravity a player's piece
+// falls at from their Lines'th line on, until the curve's next step.
+// Before the first step, the options' gravity.
+type GravityStep struct {
+	Lines   int     `json:"lines"`
+	Gravity float64 `json:"gravity"` // rows a second
+}
+
+// Handling is how a player's shifts in a row apply. Under HandlingDAS
+// a shift in the direction of the shift before it, queued with it or on
+// the next frame, holds the key down: it waits until DAS frames after the
+// first have passed, and each after it ARR frames more, none with ARR
+// zero. The shifts and inputs after one waiting wait with it.
+type Handling struct {
+	Model string `json:"model"`
+	DAS   int    `json:"das"` // delayed auto shift, in frames
+	ARR   int    `json:"arr"` // auto repeat rate, in frames
+}
+
+// DefaultRules are the game's own rules, by the Defaults for Options left
+// zero, with instant handling and hold
+func DefaultRules() Rules {
+	return Rules{
+		LockDelay: DefaultLockDelay,
+		MaxResets: DefaultMaxResets,
+		Handling:  Handling{Model: HandlingInstant, DAS: DefaultDAS, ARR: DefaultARR},
+		Hold:      true,
+		Preview:   DefaultPreview,
+	}
+}
+
+// LoadRules reads JSON rules; entries missing from the file keep
+// DefaultRules'
+func LoadRules(path string) (Rules, error) {
+	r := DefaultRules()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("parse rules %s: %w", path, err)
+	}
+	if err := r.Validate(); err != nil {
+		return r, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Validate checks that the gravity curve climbs by lines at positive
+// gravities, the handling model is known and nothing is negative
+func (r Rules) Validate() error {
+	for i, s := range r.Gravity {
+		if s.Lines < 0 || s.Gravity <= 0 {
+			return fmt.Errorf("rules gravity step %d needs lines from zero and a positive gravity", i)
+		}
+		if i > 0 && s.Lines <= r.Gravity[i-1].Lines {
+			return fmt.Errorf("rules gravity step %d is at %d lines, not past step %d's", i, s.Lines, i-1)
+		}
+	}
+	switch r.Handling.Model {
+	case "", HandlingInstant, HandlingDAS:
+	default:
+		return fmt.Errorf("unknown handling model %q", r.Handling.Model)
+	}
+	if r.LockDelay < 0 || r.MaxResets < 0 || r.Preview < 0 || r.Handling.DAS < 0 || r.Handling.ARR < 0 {
+		return fmt.Errorf("rules lockDelay, maxResets, preview, das and arr can't be negative")
+	}
+	return nil
+}
+
+// handles reports whether the player's input applies this frame by the
+// handling model, holding back a shift that continues a run of shifts in
+// its direction; any other input lets the key go
+func (g *Game) handles(p *player, act string) bool {
+	if g.rules.Handling.Model != HandlingDAS {
+		return true
+	}
+	switch {
+	case act != replay.ActionLeft && act != replay.ActionRight:
+		p.run = ""
+	case act != p.run:
+		p.run, p.repeat = act, g.frame+g.rules.Handling.DAS
+	case g.frame < p.repeat:
+		return false
+	default:
+		p.repeat = g.frame + g.rules.Handling.ARR
+	}
+	return true
+}
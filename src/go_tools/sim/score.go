@@ -0,0 +1,168 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+// Clear kinds a clear event's Detail names, ClearBackToBack joined after
+// a T-spin's by a space; a T-spin clearing no lines details its lock
+// event instead, with the points it scores
+const (
+	ClearTSpin      = "t_spin"
+	ClearTSpinMini  = "t_spin_mini"
+	ClearBackToBack = "back_to_back"
+)
+
+// Scoring is the table of points the game scores by
+type Scoring struct {
+	Lines      []int          `json:"lines"`      // a clear's by its lines from none; each line past the table scores Lines[1]
+	TSpin      []int          `json:"tSpin"`      // a T-spin's by its lines from none; past the table its last
+	TSpinMini  []int          `json:"tSpinMini"`  // a mini T-spin's
+	Combo      int            `json:"combo"`      // a clear, for each clear before it in the combo
+	BackToBack float64        `json:"backToBack"` // scales a difficult clear's points following a difficult clear
+	SoftDrop   int            `json:"softDrop"`   // a row
+	HardDrop   int            `json:"hardDrop"`   // a row
+	Pickup     int            `json:"pickup"`
+	Special    int            `json:"special"` // a special block set off
+	Spells     map[string]int `json:"spells"`  // a spell cast that lands, by spell
+}
+
+// DefaultScoring is the game's own table
+func DefaultScoring() Scoring {
+	s := Scoring{
+		Lines:      append([]int(nil), LinePoints[:]...),
+		TSpin:      append([]int(nil), TSpinPoints[:]...),
+		TSpinMini:  append([]int(nil), TSpinMiniPoints[:]...),
+		Combo:      ComboPoints,
+		BackToBack: BackToBackScale,
+		SoftDrop:   SoftDropPoints,
+		HardDrop:   HardDropPoints,
+		Pickup:     PickupPoints,
+		Special:    SpecialPoints,
+		Spells:     make(map[string]int, len(level.Spells)),
+	}
+	for _, spell := range level.Spells {
+		s.Spells[spell] = CastPoints
+	}
+	return s
+}
+
+// LoadScoring reads a JSON scoring table; entries missing from the file
+// keep DefaultScoring's
+func LoadScoring(path string) (Scoring, error) {
+	s := DefaultScoring()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("parse scoring %s: %w", path, err)
+	}
+	if err := s.Validate(); err != nil {
+		return s, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Validate checks that the table scores every clear and takes no points
+// away
+func (s Scoring) Validate() error {
+	if len(s.Lines) < 2 || len(s.TSpin) == 0 || len(s.TSpinMini) == 0 {
+		return fmt.Errorf("scoring needs line points through a single and T-spin points from no lines")
+	}
+	for name, table := range map[string][]int{"lines": s.Lines, "tSpin": s.TSpin, "tSpinMini": s.TSpinMini} {
+		for i, points := range table {
+			if points < 0 {
+				return fmt.Errorf("scoring %s[%d] is negative", name, i)
+			}
+		}
+	}
+	if s.Combo < 0 || s.SoftDrop < 0 || s.HardDrop < 0 || s.Pickup < 0 || s.Special < 0 {
+		return fmt.Errorf("scoring takes points away")
+	}
+	if s.BackToBack != 0 && s.BackToBack < 1 {
+		return fmt.Errorf("scoring backToBack %g scales points down", s.BackToBack)
+	}
+	for spell, points := range s.Spells {
+		if points < 0 {
+			return fmt.Errorf("scoring spell %s is negative", spell)
+		}
+	}
+	return nil
+}
+
+// Clear is the points of a clear of kind, "" or a T-spin, before its combo
+// bonus; backToBack scales a difficult one following another
+func (s Scoring) Clear(lines int, kind string, backToBack bool) int {
+	var points int
+	switch kind {
+	case ClearTSpin, ClearTSpinMini:
+		table := s.TSpin
+		if kind == ClearTSpinMini {
+			table = s.TSpinMini
+		}
+		points = table[min(lines, len(table)-1)]
+	default:
+		extra := max(lines-(len(s.Lines)-1), 0)
+		points = s.Lines[lines-extra] + s.Lines[1]*extra
+	}
+	if backToBack && s.BackToBack > 1 && Difficult(lines, kind) {
+		points = int(float64(points) * s.BackToBack)
+	}
+	return points
+}
+
+// Difficult reports whether a clear keeps a back-to-back going: four lines
+// or more, or a T-spin clearing any
+func Difficult(lines int, kind string) bool {
+	return lines >= 4 || lines > 0 && kind != ""
+}
+
+// ClearKind is the kind of a clear event's Detail, and whether it was back
+// to back
+func ClearKind(detail string) (kind string, backToBack bool) {
+	for _, word := range strings.Fields(detail) {
+		switch word {
+		case ClearTSpin, ClearTSpinMini:
+			kind = word
+		case ClearBackToBack:
+			backToBack = true
+		}
+	}
+	return kind, backToBack
+}
+
+// tSpin checks the piece, a T whose last move was a rotation, for a
+// T-spin: three of the corners around its center filled, cells off the
+// board counting, and of those both in front of the T unless a mini
+func (b Board) tSpin(pc Piece) string {
+	filled := func(x, y int) bool {
+		return x < 0 || y < 0 || y >= len(b) || x >= b.Width() || !b[y][x].Empty()
+	}
+	// corners clockwise from top-left; the T points up in rotation 0, so
+	// its front corners are the first two, shifting by one a turn
+	corners := [4][2]int{{pc.X, pc.Y}, {pc.X + 2, pc.Y}, {pc.X + 2, pc.Y + 2}, {pc.X, pc.Y + 2}}
+	rot := pc.Rotation % 4
+	count, front := 0, 0
+	for i, c := range corners {
+		if !filled(c[0], c[1]) {
+			continue
+		}
+		count++
+		if i == rot || i == (rot+1)%4 {
+			front++
+		}
+	}
+	switch {
+	case count < 3:
+		return ""
+	case front < 2:
+		return ClearTSpinMini
+	}
+	return ClearTSpin
+}
@@ -0,0 +1,753 @@
+// Package sim plays the game's rules headlessly: pieces falling under
+// gravity, moved, rotated, held and locked by a player's inputs, full rows
+// clearing, special blocks going off, pickups collected and spells cast,
+// a frame at a time. It keeps no clock and draws on no randomness but the
+// game's seed, so the same level, seed and inputs always play the same
+// game; the generator's checks, the analyzer's reconstructions and bots
+// play levels with it where the client would otherwise be needed.
+//
+// Positions are those of replay lock events, the top-left of the piece's
+// bounding box in pieces.Cells, and a piece spawns with its box one column
+// left of a spawn point. A rotation that doesn't fit in place kicks as
+// the game's rotation system has it: by the SRS tables, as the client
+// does, or not at all with pieces.RotationClassic, as the solver and the
+// move validation assume.
+//
+// A level.ModePhysics level plays its blocks as the game's physics mode
+// does, each a box of its own in a World: the level's blocks settle before
+// the first piece, and a piece's blocks, once it locks, fall, stack and
+// topple until they come to rest and snap back onto the grid, where rows
+// clear as they do in the other modes. With PhysicsFixed the World steps
+// in fixed point, so a server verifying a physics mode replay settles
+// every lock bit for bit as the machine that recorded it did.
+//
+// With an Attack table, players' clears send each other garbage as in the
+// game's versus matches, a clear countering its player's own queued
+// garbage before it attacks.
+//
+// Rules model the game's modes: a gravity curve climbing with the lines a
+// player clears, lock delay, whether players can hold, how many pieces
+// they see coming, and the handling of their shifts, applied as queued or
+// held back by a delayed auto shift and auto repeat rate.
+//
+// Points follow a Scoring table, DefaultScoring being the game's: line
+// clears, combos, T-spins by the three-corner rule, back-to-back difficult
+// clears, drops, pickups, special blocks and spells cast.
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+// FrameRate is the frames the game plays a second
+const FrameRate = 60
+
+// Defaults for Options left zero
+const (
+	DefaultGravity     = 1.0 // rows a second a piece falls
+	DefaultLockDelay   = FrameRate / 2
+	DefaultMaxResets   = 15
+	DefaultSpellFrames = 10 * FrameRate
+	DefaultPreview     = 5
+)
+
+// MaxSpells is the spells a player holds; pickups past them are lost
+const MaxSpells = 3
+
+// Points of DefaultScoring
+const (
+	SoftDropPoints  = 1  // a row
+	HardDropPoints  = 2  // a row
+	ComboPoints     = 50 // a clear, for each clear before it in the combo
+	PickupPoints    = 50
+	SpecialPoints   = 100 // a special block set off
+	CastPoints      = 25  // a spell cast that lands
+	BackToBackScale = 1.5 // a difficult clear following a difficult clear
+)
+
+// LinePoints are a clear's points by the lines it clears, up to four; each
+// line past four scores a single's
+var LinePoints = [5]int{0, 100, 300, 500, 800}
+
+// TSpinPoints and TSpinMiniPoints are a T-spin's points by the lines it
+// clears, none included; past the last, it scores the last
+var (
+	TSpinPoints     = [4]int{400, 800, 1200, 1600}
+	TSpinMiniPoints = [3]int{100, 200, 400}
+)
+
+// level.SpecialRules keys the game plays by, overriding the options and
+// rules: puzzle levels restrict holding and the preview with them
+const (
+	GravityRule = "gravity" // scales the game's gravity
+	HoldRule    = "hold"    // zero forbids holding, any other value allows it
+	PreviewRule = "preview" // pieces players see coming, none at zero
+)
+
+// Errors of inputs and casts
+var (
+	ErrNoPlayer  = errors.New("no such player")
+	ErrOver      = errors.New("the player topped out")
+	ErrNoSpell   = errors.New("the player holds no such spell")
+	ErrNoTarget  = errors.New("no player to aim the spell at")
+	ErrBadAction = errors.New("unknown action")
+)
+
+// Options set up a game
+type Options struct {
+	Players     []string  // default one, "p1"
+	Seed        int64     // deals the pieces of a level without a seeded sequence
+	Randomizer  string    // of a level without a sequence; default pieces.Bag7
+	Rotation    string    // a pieces rotation system; default pieces.RotationSRS
+	Gravity     float64   // rows a second, before the level's gravity rule scales it
+	LockDelay   int       // frames a piece rests on the stack before it locks
+	MaxResets   int       // moves and rotations on the stack that restart the lock delay
+	SpellFrames int       // a timed spell lasts
+	Preview     int       // pieces a player sees coming; below zero, none
+	Physics     string    // the math physics mode levels step by, a PhysicsModes entry; default PhysicsFloat
+	Scoring     *Scoring  // default DefaultScoring; replays don't record it
+	Spells      Spellbook // what casts do; default DefaultSpellbook
+	Versus      *Attack   // garbage the players' clears send each other; nil for none
+	// Attacks are players' own tables, by player, for the garbage their
+	// clears send and how long it waits, in place of Versus, which a
+	// match with them needs for the rest
+	Attacks map[string]*Attack
+	// Rules are a game mode's gravity curve, handling and hold, and stand
+	// in for the lock delay, resets and preview left zero; default
+	// DefaultRules, and replays don't record them
+	Rules *Rules
+	// ChecksumEvery is the frames between the state checksums the game's
+	// replay records, none when zero
+	ChecksumEvery int
+}
+
+// Piece is a falling piece
+type Piece struct {
+	Type     string `json:"type"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	Rotation int    `json:"rotation"`
+}
+
+// Cells are the board cells the piece covers
+func (p Piece) Cells() []level.Point {
+	cells, _ := pieces.Cells(p.Type, p.Rotation)
+	for i := range cells {
+		cells[i].X += p.X
+		cells[i].Y += p.Y
+	}
+	return cells
+}
+
+// Game is a game of a level between its players, each on their own board
+type Game struct {
+	lvl     *level.Level
+	opts    Options
+	gravity float64       // rows a frame
+	curve   []GravityStep // the rules' gravity curve, in rows a frame
+	rules   Rules
+	scoring Scoring
+	spells  Spellbook
+	versus  *Attack
+	turns   pieces.RotationSystem
+	frame   int
+	players []*player
+	byID    map[string]*player
+	garbage *rng.Xoshiro256 // picks the gaps of garbage rows
+	dealt   []string        // every piece dealt, the same to each player
+
+	events    []replay.Event
+	casts     []replay.SpellCast
+	inputs    []replay.Input
+	checksums []replay.Checksum
+}
+
+// player is one player's side of a game
+type player struct {
+	id      string
+	spawn   int // the spawn point tried first
+	board   Board
+	pickups map[level.Point]string
+	deal    pieces.Randomizer
+	queue   []string // coming, the next first
+	drawn   int
+	piece   *Piece
+	hold    string
+	held    bool // hold was used on this piece
+	rotated bool // the piece's last move was a rotation
+
+	fall     float64 // rows fallen towards the next, under gravity
+	resting  int     // frames on the stack
+	resets   int
+	run      string     // the shift whose key is held, under HandlingDAS
+	repeat   int        // the frame the held shift repeats on next
+	effects  []timed    // of the spells cast on them still lasting
+	incoming []incoming // garbage queued against them, oldest first
+	pending  []action
+
+	score, lines, combo, locks int
+	backToBack                 bool // the last clear was difficult
+	collected, triggered       int
+	spells                     []string
+	toppedOut                  bool
+}
+
+// action is an input or a cast waiting for the frame it applies on
+type action struct {
+	input         string
+	spell, target string
+}
+
+// New starts a game of the level. Every player is dealt the same pieces:
+// the level's sequence, or without one, the randomizer seeded with seed.
+func New(lvl *level.Level, opts Options) (*Game, error) {
+	if err := lvl.Validate(); err != nil {
+		return nil, err
+	}
+	if len(opts.Players) == 0 {
+		opts.Players = []string{"p1"}
+	}
+	rules := DefaultRules()
+	if opts.Rules != nil {
+		if err := opts.Rules.Validate(); err != nil {
+			return nil, err
+		}
+		rules = *opts.Rules
+		if opts.LockDelay <= 0 {
+			opts.LockDelay = rules.LockDelay
+		}
+		if opts.MaxResets <= 0 {
+			opts.MaxResets = rules.MaxResets
+		}
+		if opts.Preview == 0 {
+			opts.Preview = rules.Preview
+		}
+	}
+	if v, ok := lvl.SpecialRules[HoldRule]; ok {
+		rules.Hold = v != 0
+	}
+	if v, ok := lvl.SpecialRules[PreviewRule]; ok {
+		if opts.Preview = int(v); opts.Preview <= 0 {
+			opts.Preview = -1
+		}
+	}
+	if opts.Gravity <= 0 {
+		opts.Gravity = DefaultGravity
+	}
+	if opts.LockDelay <= 0 {
+		opts.LockDelay = DefaultLockDelay
+	}
+	if opts.MaxResets <= 0 {
+		opts.MaxResets = DefaultMaxResets
+	}
+	if opts.SpellFrames <= 0 {
+		opts.SpellFrames = DefaultSpellFrames
+	}
+	if opts.Preview == 0 {
+		opts.Preview = DefaultPreview
+	}
+	if opts.Rotation == "" {
+		opts.Rotation = pieces.RotationSRS
+	}
+	if opts.Randomizer == "" {
+		opts.Randomizer = pieces.Bag7
+	}
+	switch opts.Physics {
+	case "":
+		opts.Physics = PhysicsFloat
+	case PhysicsFloat, PhysicsFixed:
+	default:
+		return nil, fmt.Errorf("unknown physics mode %q", opts.Physics)
+	}
+	turns, err := pieces.NewRotation(opts.Rotation)
+	if err != nil {
+		return nil, err
+	}
+	scoring := DefaultScoring()
+	if opts.Scoring != nil {
+		if err := opts.Scoring.Validate(); err != nil {
+			return nil, err
+		}
+		scoring = *opts.Scoring
+	}
+	spells := opts.Spells
+	if spells == nil {
+		spells = DefaultSpellbook()
+	} else if err := spells.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Versus != nil {
+		if err := opts.Versus.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	for id, a := range opts.Attacks {
+		if opts.Versus == nil {
+			return nil, fmt.Errorf("player %s's attack table needs a versus match", id)
+		}
+		if err := a.Validate(); err != nil {
+			return nil, fmt.Errorf("player %s: %w", id, err)
+		}
+	}
+	for _, pk := range lvl.Pickups {
+		if _, ok := spells[pk.Spell]; !ok {
+			return nil, fmt.Errorf("level %q: pickup spell %s has no definition", lvl.Name, pk.Spell)
+		}
+	}
+	scale := 1.0 / FrameRate
+	if s, ok := lvl.SpecialRules[GravityRule]; ok && s > 0 {
+		scale *= s
+	}
+	var curve []GravityStep
+	for _, s := range rules.Gravity {
+		curve = append(curve, GravityStep{Lines: s.Lines, Gravity: s.Gravity * scale})
+	}
+	g := &Game{
+		lvl:     lvl,
+		opts:    opts,
+		gravity: opts.Gravity * scale,
+		curve:   curve,
+		rules:   rules,
+		turns:   turns,
+		scoring: scoring,
+		spells:  spells,
+		versus:  opts.Versus,
+		byID:    make(map[string]*player, len(opts.Players)),
+		garbage: rng.NewXoshiro(uint64(opts.Seed) ^ 0x9e3779b97f4a7c15),
+	}
+	start := LevelBoard(lvl)
+	if lvl.Mode == level.ModePhysics {
+		start.settle(opts.Physics == PhysicsFixed)
+	}
+	for i, id := range opts.Players {
+		if _, dup := g.byID[id]; dup {
+			return nil, fmt.Errorf("player %q twice", id)
+		}
+		deal, err := dealer(lvl, opts)
+		if err != nil {
+			return nil, err
+		}
+		p := &player{id: id, spawn: i, board: start.Clone(), deal: deal, pickups: make(map[level.Point]string)}
+		for _, pk := range lvl.Pickups {
+			p.pickups[level.Point{X: pk.X, Y: pk.Y}] = pk.Spell
+		}
+		g.players = append(g.players, p)
+		g.byID[id] = p
+	}
+	return g, nil
+}
+
+// dealer deals a player of the level their pieces
+func dealer(lvl *level.Level, opts Options) (pieces.Randomizer, error) {
+	name := opts.Randomizer
+	if name == "" {
+		name = pieces.Bag7
+	}
+	return pieces.ForLevel(lvl.Pieces, name, rng.NewXoshiro(uint64(opts.Seed)))
+}
+
+// Deal is the first n pieces every player of a game of the level with the
+// options is dealt, the ground truth a recorded game's pieces can be held
+// against
+func Deal(lvl *level.Level, opts Options, n int) ([]string, error) {
+	r, err := dealer(lvl, opts)
+	if err != nil {
+		return nil, err
+	}
+	return pieces.Take(r, n), nil
+}
+
+// Level is the level the game plays
+func (g *Game) Level() *level.Level { return g.lvl }
+
+// Frame is the frames played
+func (g *Game) Frame() int { return g.frame }
+
+// Spellbook is the spells the game resolves casts by
+func (g *Game) Spellbook() Spellbook { return g.spells }
+
+// Players are the game's players, in order
+func (g *Game) Players() []string {
+	ids := make([]string, len(g.players))
+	for i, p := range g.players {
+		ids[i] = p.id
+	}
+	return ids
+}
+
+// Input queues one of the replay package's actions for the player, applied
+// when the next frame is played; cast is Cast's
+func (g *Game) Input(id, act string) error {
+	p, err := g.active(id)
+	if err != nil {
+		return err
+	}
+	switch act {
+	case replay.ActionLeft, replay.ActionRight, replay.ActionRotateCW, replay.ActionRotateCCW,
+		replay.ActionSoftDrop, replay.ActionHardDrop, replay.ActionHold:
+	default:
+		return fmt.Errorf("%w %q", ErrBadAction, act)
+	}
+	p.pending = append(p.pending, action{input: act})
+	g.inputs = append(g.inputs, replay.Input{Frame: g.frame, TimeMs: timeMs(g.frame), Player: id, Action: act})
+	return nil
+}
+
+// Cast queues a spell the player holds, aimed at target: the player
+// themselves when empty, or for a spell targeting an opponent, the next
+// player still playing. It is cast when the next frame is played.
+func (g *Game) Cast(id, spell, target string) error {
+	p, err := g.active(id)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(p.spells, spell) {
+		return fmt.Errorf("%w %s", ErrNoSpell, spell)
+	}
+	if _, ok := g.byID[target]; !ok && target != "" {
+		return fmt.Errorf("target %s: %w", target, ErrNoPlayer)
+	}
+	if g.targetOf(p, spell, target) == nil {
+		return fmt.Errorf("%s: %w", spell, ErrNoTarget)
+	}
+	p.pending = append(p.pending, action{spell: spell, target: target})
+	g.inputs = append(g.inputs, replay.Input{Frame: g.frame, TimeMs: timeMs(g.frame), Player: id, Action: replay.ActionCast})
+	return nil
+}
+
+func (g *Game) active(id string) (*player, error) {
+	p, ok := g.byID[id]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("player %s: %w", id, ErrNoPlayer)
+	case p.toppedOut:
+		return nil, fmt.Errorf("player %s: %w", id, ErrOver)
+	}
+	return p, nil
+}
+
+// Tick plays a frame: timed spells that ran out wear off, and each player
+// still playing, in order, gets a piece if they have none, their queued
+// inputs and casts apply as far as the handling model lets them, and
+// gravity and the lock delay act on their piece. It answers the events of
+// the frame.
+func (g *Game) Tick() []replay.Event {
+	from := len(g.events)
+	for _, p := range g.players {
+		p.effects = slices.DeleteFunc(p.effects, func(e timed) bool { return g.frame >= e.until })
+		if p.toppedOut {
+			continue
+		}
+		if p.piece == nil && !g.spawn(p, "") {
+			continue
+		}
+		pending := p.pending
+		p.pending = nil
+		if len(pending) == 0 || pending[0].input != p.run {
+			p.run = ""
+		}
+		for i, a := range pending {
+			if p.toppedOut {
+				break
+			}
+			if !g.handles(p, a.input) {
+				p.pending = pending[i:]
+				break
+			}
+			if a.spell != "" {
+				g.cast(p, a.spell, a.target)
+			} else {
+				g.apply(p, a.input)
+			}
+			if p.piece == nil && !p.toppedOut && !g.spawn(p, "") {
+				break
+			}
+		}
+		if !p.toppedOut && p.piece != nil {
+			g.fall(p)
+		}
+	}
+	g.frame++
+	if n := g.opts.ChecksumEvery; n > 0 && g.frame%n == 0 {
+		g.checksums = append(g.checksums, replay.Checksum{Frame: g.frame, Sum: g.Checksum()})
+	}
+	return g.events[from:]
+}
+
+// Run plays frames until the game is over or frames have been played
+func (g *Game) Run(frames int) {
+	for i := 0; i < frames && !g.Over(); i++ {
+		g.Tick()
+	}
+}
+
+// rowsPerFrame is the player's piece's gravity at this frame, on the
+// rules' curve by their lines and scaled by the timed spells cast on them
+// that still last; below zero it pulls the piece up
+func (g *Game) rowsPerFrame(p *player) float64 {
+	v := g.gravity
+	for _, s := range g.curve {
+		if p.lines < s.Lines {
+			break
+		}
+		v = s.Gravity
+	}
+	for _, e := range p.effects {
+		v *= e.scale
+	}
+	return v
+}
+
+// fall moves the piece with gravity and locks it once it rested on the
+// stack, or under a flipped gravity against the ceiling, through the lock
+// delay
+func (g *Game) fall(p *player) {
+	v, dy := g.rowsPerFrame(p), 1
+	if v < 0 {
+		v, dy = -v, -1
+	}
+	p.fall += v
+	for p.fall >= 1 {
+		p.fall--
+		if !g.move(p, 0, dy, 0) {
+			p.fall = 0
+			break
+		}
+	}
+	if g.canMove(p, 0, dy, 0) {
+		p.resting = 0
+		return
+	}
+	if p.resting++; p.resting >= g.opts.LockDelay {
+		g.lock(p)
+	}
+}
+
+// apply applies one input to the player's piece
+func (g *Game) apply(p *player, act string) {
+	switch act {
+	case replay.ActionLeft:
+		g.shift(p, -1, 0)
+	case replay.ActionRight:
+		g.shift(p, 1, 0)
+	case replay.ActionRotateCW:
+		g.shift(p, 0, 1)
+	case replay.ActionRotateCCW:
+		g.shift(p, 0, 3)
+	case replay.ActionSoftDrop:
+		if g.move(p, 0, 1, 0) {
+			p.score += g.scoring.SoftDrop
+			p.rotated = false
+		}
+	case replay.ActionHardDrop:
+		rows := 0
+		for g.move(p, 0, 1, 0) {
+			rows++
+		}
+		p.score += rows * g.scoring.HardDrop
+		g.lock(p)
+	case replay.ActionHold:
+		if p.held || !g.rules.Hold {
+			return
+		}
+		swap := p.hold
+		p.hold, p.piece = p.piece.Type, nil
+		g.spawn(p, swap)
+		p.held = true
+	}
+}
+
+// shift moves or rotates the piece, restarting the lock delay when it
+// rests on the stack, up to the resets allowed
+func (g *Game) shift(p *player, dx, rot int) {
+	dy := 0
+	if rot != 0 {
+		to, ok := g.turn(p.board, *p.piece, rot)
+		if !ok {
+			return
+		}
+		dx, dy = to.X-p.piece.X, to.Y-p.piece.Y
+	}
+	if !g.move(p, dx, dy, rot) {
+		return
+	}
+	p.rotated = rot != 0
+	if p.resting > 0 && p.resets < g.opts.MaxResets {
+		p.resting = 0
+		p.resets++
+	}
+}
+
+// turn is where the piece ends up rotated by rot quarter turns clockwise,
+// the first of its rotation system's kicks that fits; false when none does
+func (g *Game) turn(b Board, pc Piece, rot int) (Piece, bool) {
+	to := (pc.Rotation + rot) % 4
+	cells, _ := pieces.Cells(pc.Type, to)
+	for _, k := range g.turns.Kicks(pc.Type, pc.Rotation, to) {
+		if b.fits(cells, pc.X+k.X, pc.Y+k.Y) {
+			return Piece{Type: pc.Type, X: pc.X + k.X, Y: pc.Y + k.Y, Rotation: to}, true
+		}
+	}
+	return pc, false
+}
+
+func (g *Game) canMove(p *player, dx, dy, rot int) bool {
+	cells, _ := pieces.Cells(p.piece.Type, p.piece.Rotation+rot)
+	return p.board.fits(cells, p.piece.X+dx, p.piece.Y+dy)
+}
+
+// move moves the piece if it fits there, collecting the pickups it moves
+// over
+func (g *Game) move(p *player, dx, dy, rot int) bool {
+	if !g.canMove(p, dx, dy, rot) {
+		return false
+	}
+	p.piece.X += dx
+	p.piece.Y += dy
+	p.piece.Rotation = (p.piece.Rotation + rot) % 4
+	g.collect(p)
+	return true
+}
+
+// spawn gives the player their next piece, or typ from hold, at the first
+// spawn point it fits, theirs tried first; it tops them out when there is
+// none
+func (g *Game) spawn(p *player, typ string) bool {
+	if typ == "" {
+		typ = g.next(p)
+		p.held = false
+	}
+	pc, ok := g.spawnAt(p, typ)
+	if !ok {
+		g.topOut(p, "no room to spawn "+typ)
+		return false
+	}
+	p.piece = &pc
+	p.fall, p.resting, p.resets, p.rotated = 0, 0, 0, false
+	g.emit(replay.Event{Player: p.id, Type: replay.EventSpawn, Piece: typ, X: p.piece.X, Y: p.piece.Y})
+	g.collect(p)
+	return true
+}
+
+// spawnAt is where a piece of the type would spawn on the player's board,
+// the first of the spawn points from theirs on it fits at; false when it
+// fits at none
+func (g *Game) spawnAt(p *player, typ string) (Piece, bool) {
+	cells, _ := pieces.Cells(typ, 0)
+	spawns := g.lvl.SpawnPoints
+	if len(spawns) == 0 {
+		spawns = []level.Point{{X: p.board.Width() / 2, Y: 0}}
+	}
+	for i := range spawns {
+		sp := spawns[(p.spawn+i)%len(spawns)]
+		if p.board.fits(cells, sp.X-1, sp.Y) {
+			return Piece{Type: typ, X: sp.X - 1, Y: sp.Y}, true
+		}
+	}
+	return Piece{}, false
+}
+
+// next draws the player's next piece, keeping their preview filled
+func (g *Game) next(p *player) string {
+	for len(p.queue) <= max(g.opts.Preview, 0) {
+		typ := p.deal.Next()
+		p.queue = append(p.queue, typ)
+		if p.drawn++; p.drawn > len(g.dealt) {
+			g.dealt = append(g.dealt, typ)
+		}
+	}
+	typ := p.queue[0]
+	p.queue = p.queue[1:]
+	return typ
+}
+
+// lock locks the piece where it is, clears rows and plays out the special
+// blocks set off, scoring the clear. A T whose last move was a rotation is
+// checked for a T-spin, gravity and hard drops not counting as moves.
+func (g *Game) lock(p *player) {
+	pc := *p.piece
+	p.piece = nil
+	p.locks++
+	kind := ""
+	if pc.Type == "T" && p.rotated {
+		kind = p.board.tSpin(pc)
+	}
+	var lines int
+	var set []triggered
+	if g.lvl.Mode == level.ModePhysics {
+		lines, set = p.board.lockPhysics(pc, g.opts.Physics == PhysicsFixed)
+	} else {
+		lines, set = p.board.lock(pc)
+	}
+	locked := replay.Event{Player: p.id, Type: replay.EventLock, Piece: pc.Type, X: pc.X, Y: pc.Y, Rotation: pc.Rotation, Lines: lines}
+	if lines == 0 && kind != "" {
+		locked.Score, locked.Detail = g.scoring.Clear(0, kind, false), kind
+		p.score += locked.Score
+	}
+	g.emit(locked)
+	for _, t := range set {
+		p.triggered++
+		p.score += g.scoring.Special
+		g.emit(replay.Event{Player: p.id, Type: replay.EventSpecial, X: t.x, Y: t.y, Score: g.scoring.Special, Detail: t.kind})
+	}
+	if lines == 0 {
+		p.combo = 0
+		if g.versus != nil {
+			g.land(p)
+		}
+		return
+	}
+	b2b := p.backToBack && Difficult(lines, kind)
+	points := g.scoring.Clear(lines, kind, b2b) + g.scoring.Combo*p.combo
+	p.backToBack = Difficult(lines, kind)
+	p.combo++
+	p.lines += lines
+	p.score += points
+	detail := kind
+	if b2b {
+		detail = strings.TrimSpace(kind + " " + ClearBackToBack)
+	}
+	g.emit(replay.Event{Player: p.id, Type: replay.EventClear, Lines: lines, Score: points, Detail: detail})
+	if g.versus != nil {
+		g.attack(p, lines, kind, b2b, p.combo-1)
+	}
+}
+
+// collect picks up the pickups under the player's piece
+func (g *Game) collect(p *player) {
+	for _, c := range p.piece.Cells() {
+		spell, ok := p.pickups[c]
+		if !ok {
+			continue
+		}
+		delete(p.pickups, c)
+		p.collected++
+		p.score += g.scoring.Pickup
+		if len(p.spells) < MaxSpells {
+			p.spells = append(p.spells, spell)
+		}
+		g.emit(replay.Event{Player: p.id, Type: replay.EventPickup, X: c.X, Y: c.Y, Score: g.scoring.Pickup, Detail: spell})
+	}
+}
+
+func (g *Game) topOut(p *player, why string) {
+	p.toppedOut, p.piece = true, nil
+	g.emit(replay.Event{Player: p.id, Type: replay.EventTopOut, Detail: why})
+}
+
+func (g *Game) emit(ev replay.Event) {
+	ev.Frame, ev.TimeMs = g.frame, timeMs(g.frame)
+	g.events = append(g.events, ev)
+}
+
+func timeMs(frame int) int64 {
+	return int64(frame) * 1000 / FrameRate
+}
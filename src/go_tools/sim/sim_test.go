@@ -0,0 +1,970 @@
+package sim
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/pieces"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// gapLevel has its bottom row filled except for the last column
+func gapLevel(objectives ...level.Objective) *level.Level {
+	lvl := level.New("gap", 6, 8)
+	for x := 0; x < 5; x++ {
+		lvl.Blocks = append(lvl.Blocks, level.Block{Type: "O", X: x, Y: 7})
+	}
+	lvl.SpawnPoints = []level.Point{{X: 3, Y: 0}}
+	lvl.Objectives = objectives
+	return lvl
+}
+
+// boardOf draws rows as Board.Rows does, o being an O block
+func boardOf(rows ...string) Board {
+	b := NewBoard(len(rows[0]), len(rows))
+	specials := map[byte]string{'b': level.SpecialBomb, 'i': level.SpecialIce, 'h': level.SpecialHeavy}
+	for y, row := range rows {
+		for x := range row {
+			switch c := row[x]; {
+			case c == '.':
+			case specials[c] != "":
+				b[y][x] = Cell{Type: "O", Special: specials[c]}
+			default:
+				b[y][x] = Cell{Type: string(c)}
+			}
+		}
+	}
+	return b
+}
+
+func TestClearPlaysOutSpecials(t *testing.T) {
+	cases := []struct {
+		name     string
+		board    Board
+		lines    int
+		specials []string
+		want     []string
+	}{
+		{"bomb", boardOf("....", "O..O", "ObOO"), 1, []string{level.SpecialBomb}, []string{"....", "....", "...O"}},
+		{"bombs chain", boardOf("O...", ".Ob.", "OOOb"), 1, []string{level.SpecialBomb, level.SpecialBomb}, []string{"....", "O...", "...."}},
+		{"ice", boardOf("O...", "iOOO"), 0, []string{level.SpecialIce}, []string{"O...", "O..."}},
+		{"heavy sinks into a clear", boardOf("h..", ".OO", "OOO"), 2, []string{level.SpecialHeavy}, []string{"...", "...", "..."}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lines, set := tc.board.clear()
+			var kinds []string
+			for _, s := range set {
+				kinds = append(kinds, s.kind)
+			}
+			if lines != tc.lines || !reflect.DeepEqual(kinds, tc.specials) {
+				t.Errorf("cleared %d lines setting off %v, want %d and %v", lines, kinds, tc.lines, tc.specials)
+			}
+			if got := tc.board.Rows(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("board\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestGravityAndLockDelay(t *testing.T) {
+	lvl := level.New("empty", 6, 8)
+	lvl.SpawnPoints = []level.Point{{X: 3, Y: 0}}
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"O", "O"}}
+	g, err := New(lvl, Options{Gravity: 30, LockDelay: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock replay.Event
+	for lock.Type == "" && g.Frame() < 100 {
+		for _, ev := range g.Tick() {
+			if ev.Type == replay.EventLock {
+				lock = ev
+			}
+		}
+	}
+	// half a row a frame: six rows down by frame 11, resting from frame 11
+	// through the tenth frame of the lock delay
+	if lock.Frame != 20 || lock.Y != 6 || lock.X != 2 {
+		t.Errorf("locked %+v, want at 2,6 on frame 20", lock)
+	}
+
+	lvl.SpecialRules[GravityRule] = 2
+	g, _ = New(lvl, Options{Gravity: 30, LockDelay: 10})
+	for i := 0; i < 3; i++ {
+		g.Tick()
+	}
+	if st, _ := g.State("p1"); st.Piece.Y != 3 {
+		t.Errorf("doubled gravity fell %d rows in 3 frames", st.Piece.Y)
+	}
+}
+
+func TestGameClearsLineAndReplays(t *testing.T) {
+	lvl := gapLevel(level.Objective{Kind: ObjectiveClearLines, Target: 1})
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"I"}}
+	g, err := New(lvl, Options{Seed: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Tick()
+	if err := g.Place("p1", 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, ev := range g.Tick() {
+		types = append(types, ev.Type)
+	}
+	if want := []string{replay.EventLock, replay.EventClear, replay.EventSpawn}; !reflect.DeepEqual(types, want) {
+		t.Errorf("events %v, want %v", types, want)
+	}
+	st, _ := g.State("p1")
+	if st.Lines != 1 || st.Score != LinePoints[1]+4*HardDropPoints || !g.Complete("p1") || !g.Over() {
+		t.Errorf("state %+v, complete %v", st, g.Complete("p1"))
+	}
+	if rows := g.Board("p1").Rows(); rows[7] != ".....I" {
+		t.Errorf("bottom row %q", rows[7])
+	}
+
+	rec := g.Replay("s1")
+	if err := rec.Validate(); err != nil || rec.Result.Outcome != replay.OutcomeCleared {
+		t.Fatalf("replay %v, result %+v", err, rec.Result)
+	}
+	again, err := PlayReplay(lvl, rec, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := again.Replay("s1"); !reflect.DeepEqual(got.Events, rec.Events) || !reflect.DeepEqual(got.Result, rec.Result) {
+		t.Errorf("replayed %+v\nwant %+v", got.Events, rec.Events)
+	}
+}
+
+func TestGamesAreDeterministic(t *testing.T) {
+	play := func(seed int64) *replay.Replay {
+		lvl := level.New("open", 8, 12)
+		lvl.SpawnPoints = []level.Point{{X: 4, Y: 0}}
+		g, err := New(lvl, Options{Seed: seed, Players: []string{"a", "b"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for col := 0; !g.Over() && g.Frame() < 5000; col++ {
+			g.Tick()
+			for i, id := range g.Players() {
+				if st, _ := g.State(id); st.Piece != nil {
+					g.Place(id, (col+i)%6, col%4)
+				}
+			}
+		}
+		return g.Replay("det")
+	}
+	a, b := play(3), play(3)
+	if len(a.Events) == 0 || !reflect.DeepEqual(a, b) {
+		t.Error("the same seed and inputs played different games")
+	}
+	if !reflect.DeepEqual(a.Pieces[:7], play(3).Pieces[:7]) || reflect.DeepEqual(a.Pieces, play(4).Pieces) {
+		t.Error("the pieces dealt don't follow the seed")
+	}
+	if a.Result.Winner == "" && a.Result.Outcome != replay.OutcomeTopOut {
+		t.Errorf("the match ended with %+v", a.Result)
+	}
+}
+
+func TestSpells(t *testing.T) {
+	lvl := level.New("duel", 6, 8)
+	lvl.SpawnPoints = []level.Point{{X: 3, Y: 0}}
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"O"}}
+	// under the O piece as it spawns
+	lvl.Pickups = []level.Pickup{{Spell: level.SpellAddBlocks, X: 2, Y: 1}, {Spell: level.SpellClearLine, X: 3, Y: 1}}
+	g, err := New(lvl, Options{Players: []string{"p1", "p2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Tick()
+	st, _ := g.State("p2")
+	if st.Pickups != 2 || !reflect.DeepEqual(st.Spells, []string{level.SpellAddBlocks, level.SpellClearLine}) {
+		t.Fatalf("p2 after spawning over the pickups %+v", st)
+	}
+
+	if err := g.Cast("p1", level.SpellAddBlocks, ""); err != nil {
+		t.Fatal(err)
+	}
+	events := g.Tick()
+	if len(events) != 1 || events[0].Type != replay.EventGarbage || events[0].Player != "p2" {
+		t.Errorf("casting ADD_BLOCKS %+v", events)
+	}
+	if bottom := g.Board("p2").Rows()[7]; strings.Count(bottom, Garbage) != 5 {
+		t.Errorf("p2's bottom row %q", bottom)
+	}
+	if err := g.Cast("p1", level.SpellAddBlocks, ""); !errors.Is(err, ErrNoSpell) {
+		t.Errorf("casting a spent spell: %v", err)
+	}
+
+	g.Cast("p2", level.SpellClearLine, "")
+	g.Tick()
+	if bottom := g.Board("p2").Rows()[7]; bottom != "......" {
+		t.Errorf("p2's bottom row after CLEAR_LINE %q", bottom)
+	}
+	rec := g.Replay("duel")
+	if len(rec.Spells) != 2 || rec.Spells[0].Target != "p2" || rec.Spells[1].Target != "" {
+		t.Errorf("spells recorded %+v", rec.Spells)
+	}
+}
+
+func TestPlacementsListPickups(t *testing.T) {
+	lvl := level.New("open", 10, 20)
+	lvl.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"O"}}
+	lvl.Pickups = []level.Pickup{{Spell: level.SpellFreeze, X: 0, Y: 10}, {Spell: level.SpellClearLine, X: 1, Y: 19}}
+	g, _ := New(lvl, Options{})
+	g.Tick()
+	byColumn := map[int][]string{}
+	for _, pl := range g.Placements("p1") {
+		byColumn[pl.Piece.X] = pl.Pickups
+	}
+	if got := byColumn[0]; !reflect.DeepEqual(got, []string{level.SpellFreeze, level.SpellClearLine}) {
+		t.Errorf("the piece dropped down the first columns picks up %v", got)
+	}
+	if got := byColumn[1]; !reflect.DeepEqual(got, []string{level.SpellClearLine}) || len(byColumn[4]) != 0 {
+		t.Errorf("the piece dropped down the second and third columns picks up %v, in the middle %v", got, byColumn[4])
+	}
+	g.Place("p1", 0, 0)
+	g.Tick()
+	if st, _ := g.State("p1"); !reflect.DeepEqual(st.Spells, []string{level.SpellFreeze, level.SpellClearLine}) {
+		t.Errorf("placed down the first columns, the player holds %v", st.Spells)
+	}
+}
+
+func TestRotationKicks(t *testing.T) {
+	lvl := level.New("wall", 6, 8)
+	lvl.SpawnPoints = []level.Point{{X: 3, Y: 0}}
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"I"}}
+	// a vertical I against the left wall turns flat only by kicking right
+	turned := func(rotation string) Piece {
+		g, err := New(lvl, Options{Rotation: rotation})
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.Tick()
+		for _, act := range []string{replay.ActionRotateCW, replay.ActionLeft, replay.ActionLeft, replay.ActionLeft, replay.ActionLeft, replay.ActionRotateCW} {
+			g.Input("p1", act)
+		}
+		g.Tick()
+		st, _ := g.State("p1")
+		return *st.Piece
+	}
+	if pc := turned(pieces.RotationSRS); pc.Rotation != 2 || pc.X != 0 {
+		t.Errorf("SRS turned the I to %+v, want rotation 2 kicked to x 0", pc)
+	}
+	if pc := turned(pieces.RotationClassic); pc.Rotation != 1 || pc.X != -2 {
+		t.Errorf("classic rotation turned the I to %+v, want it left standing", pc)
+	}
+	if _, err := New(lvl, Options{Rotation: "arika"}); err == nil {
+		t.Error("an unknown rotation system was accepted")
+	}
+
+	// kicks counter-clockwise undo the clockwise ones
+	srs, _ := pieces.NewRotation(pieces.RotationSRS)
+	for _, typ := range []string{"I", "T"} {
+		for r := 0; r < 4; r++ {
+			cw, ccw := srs.Kicks(typ, r, r+1), srs.Kicks(typ, r+1, r)
+			for i := range cw {
+				if cw[i].X != -ccw[i].X || cw[i].Y != -ccw[i].Y {
+					t.Errorf("%s kicks %d to %d %v and back %v", typ, r, r+1, cw, ccw)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestRandomizersDealTheSeed(t *testing.T) {
+	lvl := level.New("open", 8, 12)
+	lvl.SpawnPoints = []level.Point{{X: 4, Y: 0}}
+	for _, name := range pieces.Randomizers {
+		g, err := New(lvl, Options{Seed: 11, Randomizer: name, Players: []string{"a", "b"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			g.Tick()
+			for _, id := range g.Players() {
+				g.Input(id, replay.ActionHardDrop)
+			}
+		}
+		r, _ := pieces.Seeded(name, 11)
+		want := pieces.Take(r, 20)
+		if got, _ := Deal(lvl, Options{Seed: 11, Randomizer: name}, 20); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Deal %v, want %v", name, got, want)
+		}
+		var spawned []string
+		for _, ev := range g.Replay(name).EventsOf(replay.EventSpawn) {
+			if ev.Player == "b" {
+				spawned = append(spawned, ev.Piece)
+			}
+		}
+		if n := min(len(spawned), len(want)); n < 5 || !reflect.DeepEqual(spawned[:n], want[:n]) {
+			t.Errorf("%s: b was dealt %v, want %v", name, spawned, want)
+		}
+	}
+	if _, err := New(lvl, Options{Randomizer: "tgm"}); err == nil {
+		t.Error("an unknown randomizer was accepted")
+	}
+}
+
+func TestVerifyReplays(t *testing.T) {
+	lvl := level.New("open", 8, 12)
+	lvl.SpawnPoints = []level.Point{{X: 4, Y: 0}}
+	g, err := New(lvl, Options{Seed: 7, Players: []string{"a", "b"}, ChecksumEvery: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for col := 0; !g.Over() && g.Frame() < 3000; col++ {
+		g.Tick()
+		for i, id := range g.Players() {
+			if st, _ := g.State(id); st.Piece != nil {
+				g.Place(id, (col+2*i)%6, col%4)
+			}
+		}
+	}
+	for i := 0; i < 45; i++ {
+		g.Tick() // checksums recorded once the game is over still verify
+	}
+	r := g.Replay("v")
+	if len(r.Checksums) != g.Frame()/5 || r.ChecksumEvery != 5 || len(r.Checksums) < 10 {
+		t.Fatalf("%d checksums every %d frames over %d frames", len(r.Checksums), r.ChecksumEvery, g.Frame())
+	}
+	var buf bytes.Buffer
+	if err := replay.Encode(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	back, err := replay.Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := Verify(lvl, back, Options{}); err != nil || v.Diverged || v.Checked != len(r.Checksums) {
+		t.Errorf("the recorded game: %+v, %v", v, err)
+	}
+
+	// a checksum off, the game dealt other pieces, or played by another
+	// gravity diverge where they first show
+	bad := *r
+	bad.Checksums = append([]replay.Checksum(nil), r.Checksums...)
+	bad.Checksums[3].Sum++
+	if v, _ := Verify(lvl, &bad, Options{}); !v.Diverged || v.Frame != 20 || v.Checked != 3 || v.Got != r.Checksums[3].Sum {
+		t.Errorf("a checksum off: %+v", v)
+	}
+	bad = *r
+	bad.Seed++
+	if v, _ := Verify(lvl, &bad, Options{}); !v.Diverged || v.Checked != 0 {
+		t.Errorf("another seed: %+v", v)
+	}
+	bad = *r
+	bad.Rules = &replay.Rules{Gravity: 2}
+	if v, _ := Verify(lvl, &bad, Options{}); !v.Diverged {
+		t.Errorf("another gravity: %+v", v)
+	}
+
+	r.Checksums, r.ChecksumEvery = nil, 0
+	if v, err := Verify(lvl, r, Options{}); err != nil || v.Checked != 0 || v.Diverged {
+		t.Errorf("a replay without checksums: %+v, %v", v, err)
+	}
+}
+
+func TestScoring(t *testing.T) {
+	lvl := level.New("slot", 5, 6)
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"T"}}
+	g, err := New(lvl, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := g.players[0]
+	lock := func(pc Piece, rotated, backToBack bool, rows ...string) replay.Event {
+		p.board, p.piece, p.rotated, p.backToBack, p.combo, p.score = boardOf(rows...), &pc, rotated, backToBack, 0, 0
+		g.lock(p)
+		return g.events[len(g.events)-1]
+	}
+	// a T pointing down into the slot under the overhang, and one pointing
+	// up against it
+	slot := []string{".....", ".....", ".....", "...o.", "o...o", "oo.oo"}
+	down, up := Piece{Type: "T", X: 1, Y: 3, Rotation: 2}, Piece{Type: "T", X: 1, Y: 3}
+	for _, c := range []struct {
+		name         string
+		pc           Piece
+		rotated, b2b bool
+		rows         []string
+		score        int
+		ev           replay.Event
+	}{
+		{"dropped in", down, false, true, slot, LinePoints[2], replay.Event{Type: replay.EventClear, Lines: 2}},
+		{"T-spin double", down, true, false, slot, TSpinPoints[2], replay.Event{Type: replay.EventClear, Lines: 2, Detail: ClearTSpin}},
+		{"back to back", down, true, true, slot, TSpinPoints[2] * 3 / 2,
+			replay.Event{Type: replay.EventClear, Lines: 2, Detail: ClearTSpin + " " + ClearBackToBack}},
+		{"mini clearing nothing", up, true, true, []string{".....", ".....", ".....", "...o.", ".....", "oo.oo"}, TSpinMiniPoints[0],
+			replay.Event{Type: replay.EventLock, Piece: "T", X: 1, Y: 3, Detail: ClearTSpinMini}},
+	} {
+		ev := lock(c.pc, c.rotated, c.b2b, c.rows...)
+		ev.Player, ev.Frame, ev.TimeMs, ev.Rotation, ev.Score = "", 0, 0, 0, 0
+		if p.score != c.score || ev != c.ev || p.backToBack != (c.ev.Detail != "") {
+			t.Errorf("%s: scored %d, %+v, back to back %v", c.name, p.score, ev, p.backToBack)
+		}
+	}
+
+	// the last move counts: a rotation, then a shift
+	p.board, p.piece = NewBoard(5, 6), nil
+	g.Tick()
+	g.Input("p1", replay.ActionRotateCW)
+	g.Tick()
+	rotated := p.rotated
+	g.Input("p1", replay.ActionLeft)
+	g.Tick()
+	if !rotated || p.rotated {
+		t.Errorf("the T rotated %v, then shifted and still rotated %v", rotated, p.rotated)
+	}
+
+	// a table of its own, read over the defaults
+	path := filepath.Join(t.TempDir(), "scoring.json")
+	os.WriteFile(path, []byte(`{"lines": [0, 10, 20], "backToBack": 2, "spells": {"CLEAR_LINE": 5}}`), 0644)
+	s, err := LoadScoring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Clear(4, "", true); got != 2*(20+2*10) {
+		t.Errorf("a back-to-back tetris by four-line-less lines scored %d", got)
+	}
+	if s.Spells[level.SpellClearLine] != 5 || s.Spells[level.SpellAddBlocks] != CastPoints || s.TSpin[1] != TSpinPoints[1] {
+		t.Errorf("loaded %+v", s)
+	}
+	s.Lines = []int{0, -100}
+	if _, err := New(lvl, Options{Scoring: &s}); err == nil {
+		t.Error("a table taking points away was accepted")
+	}
+}
+
+func TestSpellbook(t *testing.T) {
+	book := DefaultSpellbook()
+	for _, spell := range level.Spells {
+		if _, ok := book[spell]; !ok {
+			t.Errorf("the game's spellbook has no %s", spell)
+		}
+	}
+
+	lvl := level.New("duel", 6, 8)
+	lvl.SpawnPoints = []level.Point{{X: 3, Y: 0}}
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"O"}}
+	lvl.Blocks = []level.Block{{Type: "O", X: 0, Y: 6}, {Type: "O", X: 0, Y: 7}, {Type: "O", X: 1, Y: 7, Special: level.SpecialBomb}}
+	path := filepath.Join(t.TempDir(), "spells.json")
+	os.WriteFile(path, []byte(`{"spells": [{"name": "ADD_BLOCKS", "target": "opponent", "effect": "garbage", "rows": 2}]}`), 0644)
+	book, err := LoadSpellbook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := New(lvl, Options{Players: []string{"p1", "p2"}, Spells: book})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p1, p2 := g.players[0], g.players[1]
+	g.Tick()
+	p1.spells = []string{level.SpellAddBlocks, level.SpellFreeze, level.SpellGravityFlip}
+	for _, spell := range p1.spells {
+		if err := g.Cast("p1", spell, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.Tick()
+	rows := g.Board("p2").Rows()
+	if strings.Count(rows[6], Garbage) != 5 || strings.Count(rows[7], Garbage) != 5 {
+		t.Errorf("two garbage rows sent: %q", rows)
+	}
+	frozen := g.Board("p2")
+	if frozen[4][0].Special != level.SpecialIce || frozen[5][0].Special != level.SpecialIce || frozen[5][1].Special != level.SpecialBomb || frozen[6][0].Special != "" {
+		t.Errorf("the two highest rows holding blocks not frozen: %+v", frozen[4:])
+	}
+	y := p2.piece.Y
+	for i := 0; i < 2*FrameRate; i++ {
+		g.Tick()
+	}
+	if st, _ := g.State("p2"); st.Pieces == 0 || p2.piece != nil && p2.piece.Y > y {
+		t.Errorf("the flipped piece fell from row %d to %+v", y, st.Piece)
+	}
+	if len(p2.effects) != 0 || len(p1.effects) != 0 {
+		t.Errorf("the flip outlasted its %d frames: %+v", book[level.SpellGravityFlip].Frames, p2.effects)
+	}
+
+	if _, err := New(lvl, Options{Spells: Spellbook{}}); err != nil {
+		t.Errorf("a level without pickups needs no spells: %v", err)
+	}
+	lvl.Pickups = []level.Pickup{{Spell: level.SpellFreeze, X: 5, Y: 0}}
+	if _, err := New(lvl, Options{Spells: Spellbook{level.SpellClearLine: book[level.SpellClearLine]}}); err == nil {
+		t.Error("a pickup without a definition was accepted")
+	}
+	if _, err := ParseSpellbook([]byte(`{"spells": [{"name": "X", "target": "self", "effect": "teleport"}]}`)); err == nil {
+		t.Error("an unknown effect was accepted")
+	}
+}
+
+func TestPhysics(t *testing.T) {
+	// a block dropped from a height lands on the floor and rests there
+	b := NewBoard(3, 10)
+	b[0][1] = Cell{Type: "O"}
+	w := NewWorld(b)
+	if !w.Settle(PhysicsSettleSteps) || math.Abs(w.Bodies[0].Position.Y-0.5) > PhysicsTolerance {
+		t.Fatalf("dropped block %+v after %d steps", w.Bodies[0], w.Steps)
+	}
+
+	// one hanging mostly past the block under it topples off onto the floor;
+	// one over it stays
+	game := []byte(`{"gravity": {"x": 0, "y": -9.8}, "bodies": [
+		{"id": "base", "position": {"x": 0.5, "y": 0.5}, "width": 1, "height": 1, "mass": 1, "restitution": 0.1, "friction": 0.8},
+		{"id": "over", "position": {"x": 1.3, "y": 1.5}, "width": 1, "height": 1, "mass": 1, "restitution": 0.1, "friction": 0.8},
+		{"id": "ground", "position": {"x": 2, "y": -0.5}, "width": 4, "height": 1, "isStatic": true}]}`)
+	w, err := ParseWorld(game, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Settle(PhysicsSettleSteps)
+	if over := w.Bodies[1].Position; over.Y > 0.6 || over.X < 1.5 {
+		t.Errorf("overhanging block came to rest at %+v", over)
+	}
+	if id, d := w.Diverge(&World{Bodies: []Body{{ID: "base", Position: Vec{X: 0.5, Y: 0.5}}}}); d > PhysicsTolerance {
+		t.Errorf("%s moved %v", id, d)
+	}
+	w, _ = ParseWorld(bytes.Replace(game, []byte(`"x": 1.3`), []byte(`"x": 0.8`), 1), 4)
+	w.Settle(PhysicsSettleSteps)
+	if over := w.Bodies[1].Position; math.Abs(over.X-0.8) > PhysicsTolerance || over.Y < 1.4 {
+		t.Errorf("supported block came to rest at %+v", over)
+	}
+
+	// an I laid over a pillar: its blocks past the pillar fall and fill the
+	// bottom row, which clears, and the one over the pillar stays on it
+	lvl := level.New("physics", 4, 6)
+	lvl.Mode = level.ModePhysics
+	lvl.SpawnPoints = []level.Point{{X: 1, Y: 0}}
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"I"}}
+	lvl.Blocks = []level.Block{{Type: "O", X: 0, Y: 5}, {Type: "O", X: 0, Y: 4}, {Type: "O", X: 3, Y: 1}}
+	g, err := New(lvl, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := g.Board("p1").Rows(); rows[1] != "...." || rows[5] != "O..O" {
+		t.Errorf("level blocks settled to %q", rows)
+	}
+	g.Tick()
+	if err := g.Place("p1", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	g.Tick()
+	if st, _ := g.State("p1"); st.Lines != 1 {
+		t.Errorf("lines %d, board %q", st.Lines, g.Board("p1").Rows())
+	}
+	if rows := g.Board("p1").Rows(); rows[5] != "O..I" || rows[4] != "I..." {
+		t.Errorf("board %q", rows)
+	}
+}
+
+func TestFixedPointPhysics(t *testing.T) {
+	// a pile toppling in fixed point stays on its steps and comes to rest
+	// where the float world has it
+	b := NewBoard(4, 8)
+	b[4][1], b[5][2], b[6][0], b[7][3] = Cell{Type: "O"}, Cell{Type: "T"}, Cell{Type: "I"}, Cell{Type: "I"}
+	float, fixed := NewWorld(b), NewWorld(b)
+	fixed.Fixed = true
+	if !float.Settle(PhysicsSettleSteps) || !fixed.Settle(PhysicsSettleSteps) {
+		t.Fatalf("no rest after %d and %d steps", float.Steps, fixed.Steps)
+	}
+	for i, body := range fixed.Bodies {
+		for _, v := range []float64{body.Position.X, body.Position.Y, body.Velocity.X, body.Velocity.Y} {
+			if v*PhysicsFixedScale != math.Trunc(v*PhysicsFixedScale) {
+				t.Errorf("%s: %v is off the fixed-point steps", body.ID, v)
+			}
+		}
+		if d := math.Hypot(body.Position.X-float.Bodies[i].Position.X, body.Position.Y-float.Bodies[i].Position.Y); d > PhysicsTolerance {
+			t.Errorf("%s rests %v from the float world's", body.ID, d)
+		}
+	}
+	if got, want := fixed.Board(8).Rows(), float.Board(8).Rows(); !slices.Equal(got, want) {
+		t.Errorf("fixed point settled to %q, float to %q", got, want)
+	}
+
+	// a game in fixed point records it, and its replay plays back by it
+	lvl := level.New("physics", 4, 8)
+	lvl.Mode = level.ModePhysics
+	lvl.Blocks = []level.Block{{Type: "O", X: 0, Y: 7}, {Type: "O", X: 0, Y: 6}}
+	g, err := New(lvl, Options{Physics: PhysicsFixed, Seed: 2, ChecksumEvery: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for g.Frame() < 200 && !g.Over() {
+		g.Tick()
+		if g.Frame()%20 == 0 {
+			g.Input("p1", replay.ActionHardDrop)
+		}
+	}
+	r := g.Replay("s")
+	if r.Rules.Physics != PhysicsFixed {
+		t.Fatalf("replay rules %+v", r.Rules)
+	}
+	back, err := PlayReplay(lvl, r, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.opts.Physics != PhysicsFixed || !slices.Equal(back.Board("p1").Rows(), g.Board("p1").Rows()) {
+		t.Errorf("replayed by %s to %q, want %q", back.opts.Physics, back.Board("p1").Rows(), g.Board("p1").Rows())
+	}
+	if _, err := New(lvl, Options{Physics: "exact"}); err == nil {
+		t.Error("an unknown physics mode was accepted")
+	}
+}
+
+func TestVersusGarbage(t *testing.T) {
+	a := DefaultAttack()
+	if rows := a.Rows(4, "", true, 2); rows != 6 {
+		t.Errorf("back-to-back tetris two clears into a combo sent %d rows, want 6", rows)
+	}
+	if rows := a.Rows(2, ClearTSpin, false, 0); rows != 4 {
+		t.Errorf("T-spin double sent %d rows", rows)
+	}
+	if err := (Attack{Lines: []int{0, -1}, TSpin: []int{0}, TSpinMini: []int{0}, Combo: []int{0}}).Validate(); err == nil {
+		t.Error("a negative attack was accepted")
+	}
+
+	lvl := gapLevel()
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"I"}}
+	attack := Attack{Lines: []int{0, 2}, TSpin: []int{0}, TSpinMini: []int{0}, Combo: []int{0}, Delay: 2}
+	start := func() *Game {
+		g, err := New(lvl, Options{Players: []string{"p1", "p2"}, Versus: &attack})
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.Tick()
+		g.Place("p1", 3, 1)
+		g.Tick()
+		if st, _ := g.State("p2"); st.Incoming != 2 {
+			t.Fatalf("p1's single queued %d rows against p2", st.Incoming)
+		}
+		return g
+	}
+
+	// p2 clears in time to counter the garbage before it lands
+	g := start()
+	g.Place("p2", 3, 1)
+	g.Tick()
+	evs := g.Replay("versus").Events
+	if last := evs[len(evs)-2]; last.Type != replay.EventCounter || last.Player != "p2" || last.Lines != 2 {
+		t.Errorf("events end %+v", evs[len(evs)-3:])
+	}
+	if st, _ := g.State("p1"); st.Incoming != 0 {
+		t.Errorf("a countered attack went on with %d rows", st.Incoming)
+	}
+
+	// p2 waits out the delay and locks without clearing: the garbage lands,
+	// its rows sharing a gap
+	g = start()
+	g.Tick()
+	g.Tick()
+	g.Place("p2", 0, 0)
+	g.Tick()
+	rows := g.Board("p2").Rows()
+	if st, _ := g.State("p2"); st.Incoming != 0 || rows[7] != rows[6] || strings.Count(rows[7], "G") != 5 {
+		t.Errorf("p2 %+v landed %q", st, rows)
+	}
+
+	// p1 sends by a table of its own, its garbage waiting as that says
+	own := Attack{Lines: []int{0, 3}, TSpin: []int{0}, TSpinMini: []int{0}, Combo: []int{0}, Delay: 5}
+	g, err := New(lvl, Options{Players: []string{"p1", "p2"}, Versus: &attack, Attacks: map[string]*Attack{"p1": &own}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Tick()
+	g.Place("p1", 3, 1)
+	g.Tick()
+	if st, _ := g.State("p2"); st.Incoming != 3 || g.byID["p2"].incoming[0].ready != g.frame+own.Delay-1 {
+		t.Errorf("p1's own single queued %d rows against p2, %+v", st.Incoming, g.byID["p2"].incoming)
+	}
+	if _, err := New(lvl, Options{Players: []string{"p1", "p2"}, Attacks: map[string]*Attack{"p1": &own}}); err == nil {
+		t.Error("a player's table was taken outside a versus match")
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	lvl := level.New("snap", 10, 20)
+	lvl.SpawnPoints = []level.Point{{X: 5, Y: 0}}
+	for x := 0; x < 10; x += 3 {
+		lvl.Pickups = append(lvl.Pickups, level.Pickup{Spell: level.Spells[x%len(level.Spells)], X: x, Y: 19})
+	}
+	attack := DefaultAttack()
+	attack.Lines[1] = 1
+	opts := Options{Players: []string{"p1", "p2"}, Seed: 3, Versus: &attack, ChecksumEvery: 10}
+	// drive plays both players by a fixed rule of the frame, so that two
+	// games in the same state play on the same
+	drive := func(g *Game, frames int) {
+		for i := 0; i < frames && !g.Over(); i++ {
+			for k, id := range g.Players() {
+				st, _ := g.State(id)
+				if st.Piece == nil || (g.Frame()+k)%7 != 0 {
+					continue
+				}
+				for _, spell := range st.Spells {
+					g.Cast(id, spell, "")
+				}
+				// the lowest placement, the first of those tying for p1 and the
+				// last for p2
+				pls, low := g.Placements(id), 0
+				for i, pl := range pls {
+					if pl.Piece.Y > pls[low].Piece.Y || k == 1 && pl.Piece.Y == pls[low].Piece.Y {
+						low = i
+					}
+				}
+				if len(pls) > 0 {
+					for _, input := range pls[low].Inputs {
+						g.Input(id, input)
+					}
+				}
+			}
+			g.Tick()
+		}
+	}
+	g, err := New(lvl, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drive(g, 150)
+	if g.Over() {
+		t.Fatalf("the game ended on frame %d", g.Frame())
+	}
+	mid := g.Checksum()
+	path := filepath.Join(t.TempDir(), "snap.json")
+	if err := g.Snapshot().Save(path); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := Restore(lvl, snap, Options{Versus: &attack})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Checksum() != g.Checksum() {
+		t.Fatal("the restored game's state differs")
+	}
+	clone := g.Clone()
+	drive(clone, 50)
+	if clone.Frame() == g.Frame() {
+		t.Error("the clone played on the original's frames")
+	}
+
+	drive(g, 600)
+	drive(restored, 600)
+	if a, b := g.Replay("s"), restored.Replay("s"); g.Frame() != restored.Frame() || !reflect.DeepEqual(a, b) {
+		t.Errorf("played on to frame %d and %d, events %d and %d", g.Frame(), restored.Frame(), len(a.Events), len(b.Events))
+	}
+	if evs := g.Replay("s").EventsOf(replay.EventGarbage); len(evs) == 0 {
+		t.Error("no garbage was exchanged")
+	}
+
+	at, err := ReplayTo(lvl, g.Replay("s"), Options{Versus: &attack}, snap.Frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at.Frame() != snap.Frame || at.Checksum() != mid {
+		t.Errorf("replayed to frame %d, not to the snapshot's state", at.Frame())
+	}
+	if _, err := Restore(level.New("other", 10, 20), snap, Options{}); err == nil {
+		t.Error("a snapshot was restored on another level")
+	}
+}
+
+func TestRules(t *testing.T) {
+	lvl := level.New("wide", 12, 10)
+	lvl.SpawnPoints = []level.Point{{X: 11, Y: 0}}
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"O", "T"}}
+	rules := DefaultRules()
+	rules.Handling = Handling{Model: HandlingDAS, DAS: 5, ARR: 2}
+	rules.Gravity = []GravityStep{{Lines: 1, Gravity: 30}}
+	rules.Preview = 2
+	g, err := New(lvl, Options{Gravity: 0.01, Rules: &rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := g.players[0]
+	g.Tick()
+	x := p.piece.X
+	for i := 0; i < 4; i++ {
+		g.Input("p1", replay.ActionLeft)
+	}
+	var moved []int // by the frames played
+	for g.Frame() < 12 {
+		g.Tick()
+		moved = append(moved, x-p.piece.X)
+	}
+	if want := []int{1, 1, 1, 1, 1, 2, 2, 3, 3, 4, 4}; !reflect.DeepEqual(moved, want) {
+		t.Errorf("a held left moved %v columns by frame, want %v", moved, want)
+	}
+	x = p.piece.X
+	g.Input("p1", replay.ActionRight)
+	g.Tick()
+	g.Tick()
+	g.Input("p1", replay.ActionRight)
+	g.Tick()
+	g.Input("p1", replay.ActionRight)
+	g.Tick()
+	if p.piece.X != x+2 {
+		t.Errorf("a right tapped, then held two frames, moved %d columns, want 2", p.piece.X-x)
+	}
+
+	if st, _ := g.State("p1"); len(st.Next) != 2 {
+		t.Errorf("the rules' preview of 2 shows %v", st.Next)
+	}
+	if v := g.rowsPerFrame(p); v != 0.01/FrameRate {
+		t.Errorf("gravity before the curve's first step is %v rows a frame", v)
+	}
+	p.lines = 1
+	if v := g.rowsPerFrame(p); v != 0.5 {
+		t.Errorf("gravity from the curve's first step is %v rows a frame, want 0.5", v)
+	}
+
+	rules = DefaultRules()
+	rules.Hold = false
+	g, err = New(lvl, Options{Rules: &rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Tick()
+	g.Input("p1", replay.ActionHold)
+	g.Tick()
+	if st, _ := g.State("p1"); st.Hold != "" || st.Piece.Type != "O" {
+		t.Errorf("held %q with hold off, playing %s", st.Hold, st.Piece.Type)
+	}
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`{"lockDelay": 20, "handling": {"model": "das"}}`), 0644)
+	loaded, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.LockDelay != 20 || loaded.Handling.DAS != DefaultDAS || !loaded.Hold || loaded.Preview != DefaultPreview {
+		t.Errorf("loaded %+v, not the defaults under the file's entries", loaded)
+	}
+	for _, bad := range []Rules{
+		{Handling: Handling{Model: "charge"}},
+		{Gravity: []GravityStep{{Lines: 10, Gravity: 2}, {Lines: 5, Gravity: 3}}},
+		{Gravity: []GravityStep{{Lines: 0, Gravity: 0}}},
+		{Preview: -1},
+	} {
+		if _, err := New(lvl, Options{Rules: &bad}); err == nil {
+			t.Errorf("rules %+v accepted", bad)
+		}
+	}
+}
+
+func TestLevelRestrictsHoldAndPreview(t *testing.T) {
+	lvl := level.New("open", 10, 20)
+	lvl.Pieces = &level.PieceSequence{Fixed: []string{"O", "T", "I", "L"}}
+	g, _ := New(lvl, Options{})
+	g.Tick()
+	held := g.HoldPlacements("p1")
+	if len(held) == 0 {
+		t.Fatal("no placements holding")
+	}
+	for _, pl := range held {
+		if pl.Inputs[0] != replay.ActionHold || pl.Piece.Type != "T" {
+			t.Fatalf("holding places %+v", pl)
+		}
+	}
+	for _, input := range held[0].Inputs {
+		g.Input("p1", input)
+	}
+	g.Tick()
+	if st, _ := g.State("p1"); st.Hold != "O" || st.Pieces != 1 || st.Piece.Type != "I" || g.HoldPlacements("p1") == nil {
+		t.Errorf("after holding into place: %+v", st)
+	}
+
+	lvl.SpecialRules = map[string]float64{HoldRule: 0, PreviewRule: 0}
+	rules := DefaultRules()
+	rules.Preview = 3
+	g, err := New(lvl, Options{Rules: &rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Tick()
+	if st, _ := g.State("p1"); len(st.Next) != 0 || g.HoldPlacements("p1") != nil {
+		t.Errorf("a level without hold or preview shows %v, holds to %d placements", st.Next, len(g.HoldPlacements("p1")))
+	}
+	g.Input("p1", replay.ActionHold)
+	g.Tick()
+	if st, _ := g.State("p1"); st.Hold != "" || st.Piece.Type != "O" {
+		t.Errorf("held %q on a level without hold, playing %s", st.Hold, st.Piece.Type)
+	}
+	// no preview and nothing held hides the piece holding would bring
+	delete(lvl.SpecialRules, HoldRule)
+	g, _ = New(lvl, Options{})
+	g.Tick()
+	if g.HoldPlacements("p1") != nil {
+		t.Error("held to a piece out of sight")
+	}
+	if c := g.Clone(); len(c.players[0].queue) != 0 || c.opts.Preview != g.opts.Preview {
+		t.Errorf("the clone sees %v coming", c.players[0].queue)
+	}
+
+	lvl.SpecialRules = map[string]float64{PreviewRule: 2}
+	g, _ = New(lvl, Options{Preview: 5})
+	g.Tick()
+	if st, _ := g.State("p1"); len(st.Next) != 2 {
+		t.Errorf("the level's preview of 2 shows %v", st.Next)
+	}
+	lvl.SpecialRules = nil
+	g, _ = New(lvl, Options{Preview: -1})
+	g.Tick()
+	if st, _ := g.State("p1"); len(st.Next) != 0 || st.Piece.Type != "O" {
+		t.Errorf("options without a preview show %v", st.Next)
+	}
+}
+
+func FuzzGame(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("\x06\x10\x01\x05\x02\x01\x01\x03\x00\x01\x02\x03\x04\x05\x06"))
+	f.Add(bytes.Repeat([]byte{3, 1, 4, 1, 5, 9, 2, 6, 5, 3, 5, 8, 9, 7, 9}, 64))
+	f.Add(bytes.Repeat([]byte{0, 255, 7, 128, 1, 64, 2, 32}, 200))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := Fuzz(data); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestOptionsFromConfig(t *testing.T) {
+	config := utils.DefaultConfig()
+	opts, err := OptionsFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Scoring != nil || opts.Rules != nil || opts.Versus != nil {
+		t.Errorf("a config without tables set %+v", opts)
+	}
+
+	config.AttackFile = filepath.Join(t.TempDir(), "attack.json")
+	if err := os.WriteFile(config.AttackFile, []byte(`{"lines": [0, 1, 2, 4, 8]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if opts, err = OptionsFromConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Versus == nil || opts.Versus.Lines[4] != 8 {
+		t.Errorf("the attack table was not loaded: %+v", opts.Versus)
+	}
+
+	if err := os.WriteFile(config.AttackFile, []byte(`{"lines": [0, -1]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OptionsFromConfig(config); err == nil {
+		t.Error("an invalid attack table was accepted")
+	}
+}
@@ -0,0 +1,257 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// SnapshotVersion is the version of the snapshots this package writes
+const SnapshotVersion = 1
+
+// Snapshot is the whole state of a game at a frame, its rules and what it
+// has recorded so far, for Restore to go on from. The rules a Snapshot
+// doesn't hold, the scoring, spellbook, attack tables and the Rules, are
+// the options' on restoring, as with replays.
+type Snapshot struct {
+	Version int    `json:"version"`
+	Level   string `json:"level"`
+	Frame   int    `json:"frame"`
+
+	Seed          int64   `json:"seed,omitempty"`
+	Randomizer    string  `json:"randomizer"`
+	Rotation      string  `json:"rotation"`
+	Gravity       float64 `json:"gravity"`
+	LockDelay     int     `json:"lockDelay"`
+	MaxResets     int     `json:"maxResets"`
+	SpellFrames   int     `json:"spellFrames"`
+	Preview       int     `json:"preview"`
+	Physics       string  `json:"physics,omitempty"`
+	ChecksumEvery int     `json:"checksumEvery,omitempty"`
+
+	Garbage [4]uint64        `json:"garbage"` // state of the generator picking garbage gaps
+	Dealt   []string         `json:"dealt"`
+	Players []PlayerSnapshot `json:"players"`
+
+	Events    []replay.Event     `json:"events,omitempty"`
+	Casts     []replay.SpellCast `json:"casts,omitempty"`
+	Inputs    []replay.Input     `json:"inputs,omitempty"`
+	Checksums []replay.Checksum  `json:"checksums,omitempty"`
+}
+
+// PlayerSnapshot is a player's side of a Snapshot. A player's randomizer
+// is dealt again up to Drawn on restoring, a randomizer's state being its
+// seed and the pieces it has dealt.
+type PlayerSnapshot struct {
+	ID      string         `json:"id"`
+	Spawn   int            `json:"spawn"`
+	Board   Board          `json:"board"`
+	Pickups []level.Pickup `json:"pickups,omitempty"` // still on the board
+	Queue   []string       `json:"queue"`
+	Drawn   int            `json:"drawn"`
+	Piece   *Piece         `json:"piece,omitempty"`
+	Hold    string         `json:"hold,omitempty"`
+	Held    bool           `json:"held,omitempty"`
+	Rotated bool           `json:"rotated,omitempty"`
+
+	Fall     float64          `json:"fall,omitempty"`
+	Resting  int              `json:"resting,omitempty"`
+	Resets   int              `json:"resets,omitempty"`
+	Run      string           `json:"run,omitempty"` // the shift whose key is held
+	Repeat   int              `json:"repeat,omitempty"`
+	Effects  []EffectSnapshot `json:"effects,omitempty"`
+	Incoming []GarbageBatch   `json:"incoming,omitempty"`
+	Pending  []PendingAction  `json:"pending,omitempty"`
+
+	Score      int      `json:"score"`
+	Lines      int      `json:"lines"`
+	Combo      int      `json:"combo"`
+	Locks      int      `json:"locks"`
+	BackToBack bool     `json:"backToBack,omitempty"`
+	Collected  int      `json:"collected"`
+	Triggered  int      `json:"triggered"`
+	Spells     []string `json:"spells,omitempty"`
+	ToppedOut  bool     `json:"toppedOut,omitempty"`
+}
+
+// EffectSnapshot is a timed spell lasting on a player
+type EffectSnapshot struct {
+	Scale float64 `json:"scale"` // of gravity
+	Until int     `json:"until"` // the frame it wears off on
+}
+
+// GarbageBatch is an attack's garbage queued against a player
+type GarbageBatch struct {
+	From  string `json:"from"`
+	Rows  int    `json:"rows"`
+	Gap   int    `json:"gap"`
+	Ready int    `json:"ready"` // the frame it can land on
+}
+
+// PendingAction is an input or a cast queued for the next frame
+type PendingAction struct {
+	Input  string `json:"input,omitempty"`
+	Spell  string `json:"spell,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// Snapshot is the game's state as of now; it shares nothing with the game
+func (g *Game) Snapshot() *Snapshot {
+	s := &Snapshot{
+		Version: SnapshotVersion, Level: g.lvl.Name, Frame: g.frame,
+		Seed: g.opts.Seed, Randomizer: g.opts.Randomizer, Rotation: g.opts.Rotation, Gravity: g.opts.Gravity,
+		LockDelay: g.opts.LockDelay, MaxResets: g.opts.MaxResets, SpellFrames: g.opts.SpellFrames,
+		Preview: g.opts.Preview, Physics: g.opts.Physics, ChecksumEvery: g.opts.ChecksumEvery,
+		Garbage:   g.garbage.State(),
+		Dealt:     append([]string(nil), g.dealt...),
+		Events:    append([]replay.Event(nil), g.events...),
+		Casts:     append([]replay.SpellCast(nil), g.casts...),
+		Inputs:    append([]replay.Input(nil), g.inputs...),
+		Checksums: append([]replay.Checksum(nil), g.checksums...),
+	}
+	for _, p := range g.players {
+		ps := PlayerSnapshot{
+			ID: p.id, Spawn: p.spawn, Board: p.board.Clone(), Queue: append([]string(nil), p.queue...), Drawn: p.drawn,
+			Hold: p.hold, Held: p.held, Rotated: p.rotated, Fall: p.fall, Resting: p.resting, Resets: p.resets,
+			Run: p.run, Repeat: p.repeat,
+			Score: p.score, Lines: p.lines, Combo: p.combo, Locks: p.locks, BackToBack: p.backToBack,
+			Collected: p.collected, Triggered: p.triggered, Spells: append([]string(nil), p.spells...), ToppedOut: p.toppedOut,
+		}
+		if p.piece != nil {
+			pc := *p.piece
+			ps.Piece = &pc
+		}
+		for at, spell := range p.pickups {
+			ps.Pickups = append(ps.Pickups, level.Pickup{Spell: spell, X: at.X, Y: at.Y})
+		}
+		sort.Slice(ps.Pickups, func(i, j int) bool {
+			a, b := ps.Pickups[i], ps.Pickups[j]
+			if a.Y != b.Y {
+				return a.Y < b.Y
+			}
+			return a.X < b.X
+		})
+		for _, e := range p.effects {
+			ps.Effects = append(ps.Effects, EffectSnapshot{Scale: e.scale, Until: e.until})
+		}
+		for _, in := range p.incoming {
+			ps.Incoming = append(ps.Incoming, GarbageBatch{From: in.from, Rows: in.rows, Gap: in.gap, Ready: in.ready})
+		}
+		for _, a := range p.pending {
+			ps.Pending = append(ps.Pending, PendingAction{Input: a.input, Spell: a.spell, Target: a.target})
+		}
+		s.Players = append(s.Players, ps)
+	}
+	return s
+}
+
+// FrameSnapshot is the game's Snapshot without what it has recorded, its
+// events, casts, inputs and checksums: the state as of now that two games
+// of the same frames must agree on
+func (g *Game) FrameSnapshot() *Snapshot {
+	s := g.Snapshot()
+	s.Events, s.Casts, s.Inputs, s.Checksums = nil, nil, nil, nil
+	return s
+}
+
+// Restore goes on with the game of the level a snapshot was taken of, by
+// its rules and the options' scoring, spellbook, attack tables and Rules; it
+// plays on exactly as the game it was taken of would have
+func Restore(lvl *level.Level, s *Snapshot, opts Options) (*Game, error) {
+	if s.Version > SnapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d not supported", s.Version)
+	}
+	if s.Level != lvl.Name {
+		return nil, fmt.Errorf("snapshot of level %q restored on %q", s.Level, lvl.Name)
+	}
+	opts.Players = nil
+	for _, ps := range s.Players {
+		opts.Players = append(opts.Players, ps.ID)
+	}
+	opts.Seed, opts.Randomizer, opts.Rotation, opts.Gravity = s.Seed, s.Randomizer, s.Rotation, s.Gravity
+	opts.LockDelay, opts.MaxResets, opts.SpellFrames = s.LockDelay, s.MaxResets, s.SpellFrames
+	opts.Preview, opts.ChecksumEvery, opts.Physics = s.Preview, s.ChecksumEvery, s.Physics
+	g, err := New(lvl, opts)
+	if err != nil {
+		return nil, err
+	}
+	g.frame = s.Frame
+	g.garbage.SetState(s.Garbage)
+	g.dealt = append([]string(nil), s.Dealt...)
+	g.events = append([]replay.Event(nil), s.Events...)
+	g.casts = append([]replay.SpellCast(nil), s.Casts...)
+	g.inputs = append([]replay.Input(nil), s.Inputs...)
+	g.checksums = append([]replay.Checksum(nil), s.Checksums...)
+	for i, ps := range s.Players {
+		p := g.players[i]
+		if len(ps.Board) != len(p.board) || ps.Board.Width() != p.board.Width() {
+			return nil, fmt.Errorf("snapshot player %s: board %dx%d on a %dx%d level", ps.ID, ps.Board.Width(), len(ps.Board), p.board.Width(), len(p.board))
+		}
+		for n := 0; n < ps.Drawn; n++ {
+			p.deal.Next()
+		}
+		p.spawn, p.board, p.queue, p.drawn = ps.Spawn, ps.Board.Clone(), append([]string(nil), ps.Queue...), ps.Drawn
+		p.piece = nil
+		if ps.Piece != nil {
+			pc := *ps.Piece
+			p.piece = &pc
+		}
+		p.hold, p.held, p.rotated = ps.Hold, ps.Held, ps.Rotated
+		p.fall, p.resting, p.resets = ps.Fall, ps.Resting, ps.Resets
+		p.run, p.repeat = ps.Run, ps.Repeat
+		p.score, p.lines, p.combo, p.locks, p.backToBack = ps.Score, ps.Lines, ps.Combo, ps.Locks, ps.BackToBack
+		p.collected, p.triggered, p.toppedOut = ps.Collected, ps.Triggered, ps.ToppedOut
+		p.spells = append([]string(nil), ps.Spells...)
+		p.pickups = make(map[level.Point]string, len(ps.Pickups))
+		for _, pk := range ps.Pickups {
+			p.pickups[level.Point{X: pk.X, Y: pk.Y}] = pk.Spell
+		}
+		for _, e := range ps.Effects {
+			p.effects = append(p.effects, timed{scale: e.Scale, until: e.Until})
+		}
+		for _, in := range ps.Incoming {
+			p.incoming = append(p.incoming, incoming{from: in.From, rows: in.Rows, gap: in.Gap, ready: in.Ready})
+		}
+		for _, a := range ps.Pending {
+			p.pending = append(p.pending, action{input: a.Input, spell: a.Spell, target: a.Target})
+		}
+	}
+	return g, nil
+}
+
+// Clone is a copy of the game to play on separately from it, as restoring
+// its snapshot would be, for branching rollouts
+func (g *Game) Clone() *Game {
+	c, err := Restore(g.lvl, g.Snapshot(), g.opts)
+	if err != nil {
+		// the game's own snapshot on its own level and options restores
+		panic(err)
+	}
+	return c
+}
+
+// Save writes the snapshot to path as JSON
+func (s *Snapshot) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// LoadSnapshot reads a snapshot Save wrote
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse snapshot %s: %w", path, err)
+	}
+	return &s, nil
+}
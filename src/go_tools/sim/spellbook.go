@@ -0,0 +1,118 @@
+package sim
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Spell effects a spell definition resolves to
+const (
+	EffectClearLines = "clear_lines" // the Rows lowest rows holding blocks go
+	EffectSwapPiece  = "swap_piece"  // the piece in play trades places with the next
+	EffectGravity    = "gravity"     // gravity scales by Scale for Frames, below zero pulling pieces up
+	EffectFreeze     = "freeze"      // the blocks of the Rows highest rows holding any turn to ice
+	EffectGarbage    = "garbage"     // Rows garbage rows, each with a gap, push up from the bottom
+	EffectRemoveTops = "remove_tops" // the highest block of each column goes
+)
+
+// Effects lists every spell effect in a stable order
+var Effects = []string{EffectClearLines, EffectSwapPiece, EffectGravity, EffectFreeze, EffectGarbage, EffectRemoveTops}
+
+// Who a spell lands on
+const (
+	TargetSelf     = "self"
+	TargetOpponent = "opponent"
+)
+
+// Spell defines what casting a spell does
+type Spell struct {
+	Name   string  `json:"name"` // as level pickups name it
+	Target string  `json:"target"`
+	Effect string  `json:"effect"`
+	Rows   int     `json:"rows,omitempty"`
+	Scale  float64 `json:"scale,omitempty"`
+	Frames int     `json:"frames,omitempty"` // a timed effect lasts; default Options.SpellFrames
+}
+
+// Spellbook is the spells a game resolves casts by, keyed by name
+type Spellbook map[string]Spell
+
+// spellsJSON is the game's own spell definitions
+//
+//go:embed spells.json
+var spellsJSON []byte
+
+// DefaultSpellbook is the game's own spells
+func DefaultSpellbook() Spellbook {
+	b, err := ParseSpellbook(spellsJSON)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// LoadSpellbook reads spell definitions from a JSON file shaped like the
+// game's spells.json, keeping every spell it doesn't define as the game
+// has it
+func LoadSpellbook(path string) (Spellbook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ParseSpellbook(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	book := DefaultSpellbook()
+	for name, s := range b {
+		book[name] = s
+	}
+	return book, nil
+}
+
+// ParseSpellbook reads spell definitions shaped like spells.json
+func ParseSpellbook(data []byte) (Spellbook, error) {
+	var file struct {
+		Spells []Spell `json:"spells"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse spells: %w", err)
+	}
+	b := make(Spellbook, len(file.Spells))
+	for _, s := range file.Spells {
+		if _, dup := b[s.Name]; dup {
+			return nil, fmt.Errorf("spell %q defined twice", s.Name)
+		}
+		b[s.Name] = s
+	}
+	return b, b.Validate()
+}
+
+// Validate checks that every spell has a name, a target and an effect it
+// can resolve
+func (b Spellbook) Validate() error {
+	for name, s := range b {
+		switch {
+		case name == "" || s.Name != name:
+			return fmt.Errorf("spell %q is filed as %q", s.Name, name)
+		case s.Target != TargetSelf && s.Target != TargetOpponent:
+			return fmt.Errorf("spell %s: unknown target %q", name, s.Target)
+		case !slices.Contains(Effects, s.Effect):
+			return fmt.Errorf("spell %s: unknown effect %q", name, s.Effect)
+		case s.Rows < 0 || s.Frames < 0:
+			return fmt.Errorf("spell %s: negative rows or frames", name)
+		case s.Effect == EffectGravity && s.Scale == 0:
+			return fmt.Errorf("spell %s: gravity needs a scale", name)
+		}
+	}
+	return nil
+}
+
+// timed is a timed spell's effect on a player
+type timed struct {
+	scale float64 // of gravity
+	until int     // the frame it wears off on
+}
@@ -0,0 +1,178 @@
+package sim
+
+import (
+	"slices"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// targetOf is who a spell cast at target lands on: the caster for a spell
+// aimed at no one, or for one targeting an opponent, the first player
+// after the caster still playing; nil when there is no such player
+func (g *Game) targetOf(p *player, spell, target string) *player {
+	if t, ok := g.byID[target]; ok && target != "" {
+		if t.toppedOut {
+			return nil
+		}
+		return t
+	}
+	if g.spells[spell].Target != TargetOpponent {
+		return p
+	}
+	return g.opponent(p)
+}
+
+// opponent is the first player after p still playing, nil when there is
+// none
+func (g *Game) opponent(p *player) *player {
+	at := slices.Index(g.players, p)
+	for i := 1; i < len(g.players); i++ {
+		if t := g.players[(at+i)%len(g.players)]; !t.toppedOut {
+			return t
+		}
+	}
+	return nil
+}
+
+// cast spends one of the player's spells, resolving its effect by the
+// game's spellbook; an effect on rows takes one when the spell names none.
+// A spell whose target topped out in the meantime is spent to no effect.
+func (g *Game) cast(p *player, spell, target string) {
+	i := slices.Index(p.spells, spell)
+	if i < 0 {
+		return
+	}
+	p.spells = slices.Delete(p.spells, i, i+1)
+	t := g.targetOf(p, spell, target)
+	cast := replay.SpellCast{Frame: g.frame, TimeMs: timeMs(g.frame), Player: p.id, Spell: spell}
+	if t != nil && t != p {
+		cast.Target = t.id
+	}
+	g.casts = append(g.casts, cast)
+	if t == nil {
+		return
+	}
+	p.score += g.scoring.Spells[spell]
+	def := g.spells[spell]
+	rows := max(def.Rows, 1)
+	switch def.Effect {
+	case EffectClearLines:
+		for i := 0; i < rows; i++ {
+			if y := t.board.lowest(); y >= 0 {
+				t.board.remove(y)
+			}
+		}
+	case EffectSwapPiece:
+		if t.piece != nil && len(t.queue) > 0 {
+			swap := t.queue[0]
+			t.queue[0], t.piece = t.piece.Type, nil
+			g.spawn(t, swap)
+		}
+	case EffectGravity:
+		frames := def.Frames
+		if frames == 0 {
+			frames = g.opts.SpellFrames
+		}
+		t.effects = append(t.effects, timed{scale: def.Scale, until: g.frame + frames})
+	case EffectFreeze:
+		t.board.freeze(rows)
+	case EffectGarbage:
+		for i := 0; i < rows && !t.toppedOut; i++ {
+			g.addGarbage(t, g.garbage.Intn(t.board.Width()))
+		}
+	case EffectRemoveTops:
+		t.board.removeTops()
+	}
+}
+
+// addGarbage pushes a garbage row with a gap at x onto the bottom of the
+// player's board, lifting their piece with it; a block pushed off the top
+// tops them out
+func (g *Game) addGarbage(p *player, gap int) {
+	if !p.board.push(gap) {
+		g.topOut(p, "garbage pushed the stack out")
+		return
+	}
+	g.emit(replay.Event{Player: p.id, Type: replay.EventGarbage, X: gap, Lines: 1})
+	if p.piece == nil || g.canMove(p, 0, 0, 0) {
+		return
+	}
+	if !g.canMove(p, 0, -1, 0) {
+		g.topOut(p, "garbage pushed the piece out")
+		return
+	}
+	p.piece.Y--
+}
+
+// lowest is the lowest row holding a block, or -1 for an empty board
+func (b Board) lowest() int {
+	for y := len(b) - 1; y >= 0; y-- {
+		for _, c := range b[y] {
+			if !c.Empty() {
+				return y
+			}
+		}
+	}
+	return -1
+}
+
+// remove takes row y out of the board, the rows above falling a row
+func (b Board) remove(y int) {
+	copy(b[1:y+1], b[:y])
+	b[0] = make([]Cell, b.Width())
+}
+
+// push moves every row up, a garbage row with a gap at x coming in at the
+// bottom; it fails, the board left alone, when the top row holds a block
+func (b Board) push(gap int) bool {
+	for _, c := range b[0] {
+		if !c.Empty() {
+			return false
+		}
+	}
+	row := make([]Cell, b.Width())
+	for x := range row {
+		if x != gap {
+			row[x] = Cell{Type: Garbage}
+		}
+	}
+	copy(b, b[1:])
+	b[len(b)-1] = row
+	return true
+}
+
+// freeze turns the blocks of the rows highest rows holding any to ice,
+// special blocks staying as they are
+func (b Board) freeze(rows int) {
+	for y := range b {
+		if rows == 0 {
+			return
+		}
+		held := false
+		for x, c := range b[y] {
+			if c.Empty() {
+				continue
+			}
+			held = true
+			if c.Special == "" {
+				b[y][x].Special = level.SpecialIce
+			}
+		}
+		if held {
+			rows--
+		}
+	}
+}
+
+// removeTops removes the highest block of each column
+func (b Board) removeTops() {
+	for x := 0; x < b.Width(); x++ {
+		for y := range b {
+			if !b[y][x].Empty() {
+				b[y][x] = Cell{}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package sim
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Checksum is a 32-bit FNV-1a hash of the game's state: the frame, then
+// each player in order with their board a cell at a time, piece and
+// whether it last rotated, hold, preview, gravity and lock delay
+// counters, the held shift and when it repeats, timed spells, queued
+// garbage, score, tallies and back-to-back, spells and pickups left. Integers are hashed as varints,
+// strings by their length and bytes, and the fall towards the next row
+// and gravity scales by their IEEE 754 bits, so a port of the rules whose
+// floats round differently diverges here before it does on the board.
+func (g *Game) Checksum() uint32 {
+	var buf []byte
+	num := func(ns ...int) {
+		for _, n := range ns {
+			buf = binary.AppendVarint(buf, int64(n))
+		}
+	}
+	str := func(ss ...string) {
+		for _, s := range ss {
+			num(len(s))
+			buf = append(buf, s...)
+		}
+	}
+	flag := func(b bool) {
+		if b {
+			num(1)
+		} else {
+			num(0)
+		}
+	}
+
+	num(g.frame, len(g.players))
+	for _, p := range g.players {
+		str(p.id)
+		num(len(p.board), p.board.Width())
+		for _, row := range p.board {
+			for _, c := range row {
+				str(c.Type, c.Special)
+			}
+		}
+		flag(p.piece != nil)
+		if p.piece != nil {
+			str(p.piece.Type)
+			num(p.piece.X, p.piece.Y, p.piece.Rotation)
+		}
+		flag(p.rotated)
+		str(p.hold)
+		flag(p.held)
+		num(len(p.queue))
+		str(p.queue...)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(p.fall))
+		num(p.resting, p.resets)
+		str(p.run)
+		num(p.repeat, len(p.effects))
+		for _, e := range p.effects {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(e.scale))
+			num(e.until)
+		}
+		num(len(p.incoming))
+		for _, in := range p.incoming {
+			str(in.from)
+			num(in.rows, in.gap, in.ready)
+		}
+		num(p.score, p.lines, p.combo, p.locks, p.collected, p.triggered)
+		flag(p.backToBack)
+		num(len(p.spells))
+		str(p.spells...)
+		flag(p.toppedOut)
+
+		left := make([]level.Point, 0, len(p.pickups))
+		for at := range p.pickups {
+			left = append(left, at)
+		}
+		sort.Slice(left, func(i, j int) bool {
+			if left[i].Y != left[j].Y {
+				return left[i].Y < left[j].Y
+			}
+			return left[i].X < left[j].X
+		})
+		num(len(left))
+		for _, at := range left {
+			num(at.X, at.Y)
+			str(p.pickups[at])
+		}
+	}
+	h := fnv.New32a()
+	h.Write(buf)
+	return h.Sum32()
+}
+
+// Verification is how a replay played again held up against the state
+// checksums it recorded
+type Verification struct {
+	Checked  int    `json:"checked"` // checksums compared
+	Diverged bool   `json:"diverged"`
+	Frame    int    `json:"frame,omitempty"` // of the first checksum that differs
+	Want     uint32 `json:"want,omitempty"`  // the replay's checksum there
+	Got      uint32 `json:"got,omitempty"`   // the simulation's
+}
+
+// Verify plays the replay again on the level as PlayReplay does, on
+// through its last checksum, and compares the state checksums of the two
+// games frame by frame, stopping at the first that differs. A replay
+// recorded without checksums checks none.
+func Verify(lvl *level.Level, r *replay.Replay, opts Options) (Verification, error) {
+	var v Verification
+	if len(r.Checksums) == 0 {
+		return v, nil
+	}
+	g, err := PlayReplay(lvl, r, opts)
+	if err != nil {
+		return v, err
+	}
+	last := r.Checksums[len(r.Checksums)-1].Frame
+	for g.frame < last && g.opts.ChecksumEvery > 0 {
+		g.Tick()
+	}
+	got := make(map[int]uint32, len(g.checksums))
+	for _, c := range g.checksums {
+		got[c.Frame] = c.Sum
+	}
+	for _, want := range r.Checksums {
+		sum, ok := got[want.Frame]
+		if !ok || sum != want.Sum {
+			v.Diverged, v.Frame, v.Want, v.Got = true, want.Frame, want.Sum, sum
+			return v, nil
+		}
+		v.Checked++
+	}
+	return v, nil
+}
@@ -0,0 +1,167 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// Attack of DefaultAttack, in garbage rows, by the game's versus rules
+var (
+	AttackLines     = [5]int{0, 0, 1, 2, 4}
+	AttackTSpin     = [4]int{0, 2, 4, 6}
+	AttackTSpinMini = [3]int{0, 0, 1}
+	AttackCombo     = [11]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4, 5} // by the clears before in the combo
+)
+
+// Defaults of DefaultAttack
+const (
+	AttackBackToBack = 1         // rows a difficult clear following a difficult clear adds
+	GarbageDelay     = FrameRate // frames sent garbage waits before it can land
+	GarbageCap       = 8         // rows landing on a lock at most
+)
+
+// Attack is the table of garbage a versus clear sends, and how the
+// garbage queued against a player lands. A clear first counters the
+// garbage queued against its player, oldest first, and sends what is
+// left of its attack to the next player still playing. Garbage lands
+// once it has waited Delay frames, when its player locks a piece that
+// clears nothing, at most Cap rows a lock; the rows of one attack share
+// a gap.
+type Attack struct {
+	Lines      []int `json:"lines"`     // by the lines cleared from none; each line past the table sends one more
+	TSpin      []int `json:"tSpin"`     // by the lines cleared from none; past the table its last
+	TSpinMini  []int `json:"tSpinMini"` // a mini T-spin's
+	Combo      []int `json:"combo"`     // added by the clears before in the combo; past the table its last
+	BackToBack int   `json:"backToBack"`
+	Delay      int   `json:"delay"`
+	Cap        int   `json:"cap"` // zero for no cap
+}
+
+// DefaultAttack is the game's own table
+func DefaultAttack() Attack {
+	return Attack{
+		Lines:      append([]int(nil), AttackLines[:]...),
+		TSpin:      append([]int(nil), AttackTSpin[:]...),
+		TSpinMini:  append([]int(nil), AttackTSpinMini[:]...),
+		Combo:      append([]int(nil), AttackCombo[:]...),
+		BackToBack: AttackBackToBack,
+		Delay:      GarbageDelay,
+		Cap:        GarbageCap,
+	}
+}
+
+// LoadAttack reads a JSON attack table; entries missing from the file
+// keep DefaultAttack's
+func LoadAttack(path string) (Attack, error) {
+	a := DefaultAttack()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return a, err
+	}
+	if err := json.Unmarshal(data, &a); err != nil {
+		return a, fmt.Errorf("parse attack %s: %w", path, err)
+	}
+	if err := a.Validate(); err != nil {
+		return a, fmt.Errorf("%s: %w", path, err)
+	}
+	return a, nil
+}
+
+// Validate checks that the table sends garbage for every clear and none
+// of it negative
+func (a Attack) Validate() error {
+	if len(a.Lines) < 2 || len(a.TSpin) == 0 || len(a.TSpinMini) == 0 || len(a.Combo) == 0 {
+		return fmt.Errorf("attack needs rows through a single, T-spin rows from no lines and a combo")
+	}
+	for name, table := range map[string][]int{"lines": a.Lines, "tSpin": a.TSpin, "tSpinMini": a.TSpinMini, "combo": a.Combo} {
+		for i, rows := range table {
+			if rows < 0 {
+				return fmt.Errorf("attack %s[%d] is negative", name, i)
+			}
+		}
+	}
+	if a.BackToBack < 0 || a.Delay < 0 || a.Cap < 0 {
+		return fmt.Errorf("attack backToBack, delay and cap can't be negative")
+	}
+	return nil
+}
+
+// Rows is the garbage a clear of kind, "" or a T-spin, sends, combo
+// being the clears before it in the combo and backToBack whether it
+// follows a difficult clear
+func (a Attack) Rows(lines int, kind string, backToBack bool, combo int) int {
+	var rows int
+	switch kind {
+	case ClearTSpin, ClearTSpinMini:
+		table := a.TSpin
+		if kind == ClearTSpinMini {
+			table = a.TSpinMini
+		}
+		rows = table[min(lines, len(table)-1)]
+	default:
+		extra := max(lines-(len(a.Lines)-1), 0)
+		rows = a.Lines[lines-extra] + extra
+	}
+	if lines > 0 {
+		rows += a.Combo[min(combo, len(a.Combo)-1)]
+	}
+	if backToBack && Difficult(lines, kind) {
+		rows += a.BackToBack
+	}
+	return rows
+}
+
+// incoming is garbage queued against a player
+type incoming struct {
+	from  string
+	rows  int
+	gap   int
+	ready int // the frame it can land on
+}
+
+// attack sends the garbage of the player's clear by their table,
+// countering their own queued garbage first
+func (g *Game) attack(p *player, lines int, kind string, backToBack bool, combo int) {
+	table := g.versus
+	if own := g.opts.Attacks[p.id]; own != nil {
+		table = own
+	}
+	rows := table.Rows(lines, kind, backToBack, combo)
+	countered := 0
+	for rows > 0 && len(p.incoming) > 0 {
+		n := min(rows, p.incoming[0].rows)
+		rows, countered = rows-n, countered+n
+		if p.incoming[0].rows -= n; p.incoming[0].rows == 0 {
+			p.incoming = p.incoming[1:]
+		}
+	}
+	if countered > 0 {
+		g.emit(replay.Event{Player: p.id, Type: replay.EventCounter, Lines: countered})
+	}
+	t := g.opponent(p)
+	if rows == 0 || t == nil {
+		return
+	}
+	t.incoming = append(t.incoming, incoming{from: p.id, rows: rows, gap: g.garbage.Intn(t.board.Width()), ready: g.frame + table.Delay})
+	g.emit(replay.Event{Player: p.id, Type: replay.EventAttack, Lines: rows, Detail: t.id})
+}
+
+// land lands the player's garbage that has waited long enough, oldest
+// first, up to the cap
+func (g *Game) land(p *player) {
+	landed := 0
+	for len(p.incoming) > 0 && !p.toppedOut {
+		in := &p.incoming[0]
+		if in.ready > g.frame || g.versus.Cap > 0 && landed == g.versus.Cap {
+			return
+		}
+		g.addGarbage(p, in.gap)
+		landed++
+		if in.rows--; in.rows == 0 {
+			p.incoming = p.incoming[1:]
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package stats
+
+import "sort"
+
+// Holm adjusts p-values for testing them together with the Holm-Bonferroni
+// step-down method, which bounds the chance of any false positive; compare
+// the adjusted values to the usual alpha
+func Holm(ps []float64) []float64 {
+	order := ascending(ps)
+	adjusted := make([]float64, len(ps))
+	running := 0.0
+	for rank, i := range order {
+		running = max(running, min(1, float64(len(ps)-rank)*ps[i]))
+		adjusted[i] = running
+	}
+	return adjusted
+}
+
+// BenjaminiHochberg adjusts p-values to q-values that bound the expected
+// share of false positives among those below alpha, for screening many
+// metrics at once where Holm would miss too much
+func BenjaminiHochberg(ps []float64) []float64 {
+	order := ascending(ps)
+	adjusted := make([]float64, len(ps))
+	running := 1.0
+	for rank := len(order) - 1; rank >= 0; rank-- {
+		i := order[rank]
+		running = min(running, float64(len(ps))*ps[i]/float64(rank+1))
+		adjusted[i] = running
+	}
+	return adjusted
+}
+
+// ascending returns the indices of ps from the smallest value up
+func ascending(ps []float64) []int {
+	order := make([]int, len(ps))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return ps[order[a]] < ps[order[b]] })
+	return order
+}
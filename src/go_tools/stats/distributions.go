@@ -0,0 +1,151 @@
+package stats
+
+import "math"
+
+// ChiSquareP returns the probability of a chi-square statistic at
+// least x with df degrees of freedom
+func ChiSquareP(x float64, df int) float64 {
+	if x <= 0 || df <= 0 {
+		return 1
+	}
+	return upperGamma(float64(df)/2, x/2)
+}
+
+// upperGamma is the regularized upper incomplete gamma function Q(a, x),
+// using the series for small x and Lentz's continued fraction otherwise
+func upperGamma(a, x float64) float64 {
+	const (
+		iterations = 200
+		epsilon    = 1e-12
+		tiny       = 1e-300
+	)
+	lg, _ := math.Lgamma(a)
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1; n < iterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*epsilon {
+				break
+			}
+		}
+		return 1 - sum*math.Exp(-x+a*math.Log(x)-lg)
+	}
+
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < iterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return math.Exp(-x+a*math.Log(x)-lg) * h
+}
+
+// StudentTwoSided is P(|T| >= |t|) for Student's t with df degrees of freedom
+func StudentTwoSided(t, df float64) float64 {
+	x := df / (df + t*t)
+	return incompleteBeta(df/2, 0.5, x)
+}
+
+// incompleteBeta is the regularized incomplete beta function I_x(a, b),
+// evaluated with a continued fraction
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaFraction(b, a, 1-x)/b
+	}
+	return front * betaFraction(a, b, x) / a
+}
+
+func betaFraction(a, b, x float64) float64 {
+	const (
+		iterations = 300
+		epsilon    = 1e-12
+		tiny       = 1e-300
+	)
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m < iterations; m++ {
+		fm := float64(m)
+		for _, num := range []float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+		if math.Abs(d*c-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
+
+// NormalTwoSided is P(|Z| >= |z|) for a standard normal Z
+func NormalTwoSided(z float64) float64 {
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// NormalQuantile returns z with P(|Z| >= z) = alpha
+func NormalQuantile(alpha float64) float64 {
+	return bisectQuantile(alpha, NormalTwoSided)
+}
+
+// StudentQuantile returns t with P(|T| >= t) = alpha for df degrees of freedom
+func StudentQuantile(alpha, df float64) float64 {
+	return bisectQuantile(alpha, func(t float64) float64 { return StudentTwoSided(t, df) })
+}
+
+// bisectQuantile inverts a decreasing two-sided tail probability
+func bisectQuantile(alpha float64, tail func(float64) float64) float64 {
+	lo, hi := 0.0, 1.0
+	for tail(hi) > alpha && hi < 1e6 {
+		hi *= 2
+	}
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if tail(mid) > alpha {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
@@ -0,0 +1,35 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestChiSquarePValue(t *testing.T) {
+	// 12.592 is the 95th percentile of chi-square with 6 degrees of freedom
+	if p := ChiSquareP(12.592, 6); math.Abs(p-0.05) > 0.001 {
+		t.Fatalf("p = %.4f, want 0.05", p)
+	}
+	if p := ChiSquareP(1.0, 1); math.Abs(p-0.3173) > 0.001 {
+		t.Fatalf("p = %.4f, want 0.3173", p)
+	}
+}
+
+func TestStudentTwoSided(t *testing.T) {
+	// 2.228 is the two-sided 5% critical value of t with 10 degrees of freedom
+	if p := StudentTwoSided(2.228, 10); math.Abs(p-0.05) > 0.001 {
+		t.Fatalf("p = %.4f, want 0.05", p)
+	}
+	if p := StudentTwoSided(0, 5); math.Abs(p-1) > 1e-9 {
+		t.Fatalf("p = %.4f, want 1", p)
+	}
+}
+
+func TestQuantiles(t *testing.T) {
+	if z := NormalQuantile(0.05); math.Abs(z-1.959964) > 1e-4 {
+		t.Errorf("normal 95%% quantile = %f", z)
+	}
+	if q := StudentQuantile(0.05, 10); math.Abs(q-2.228139) > 1e-4 {
+		t.Errorf("t(10) 95%% quantile = %f", q)
+	}
+}
@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"math"
+	"sort"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+// WilsonInterval is the Wilson score interval of a proportion p over n
+// trials, z the normal quantile of the confidence
+func WilsonInterval(p, n, z float64) (low, high float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	z2 := z * z
+	center := (p + z2/(2*n)) / (1 + z2/n)
+	half := z * math.Sqrt(p*(1-p)/n+z2/(4*n*n)) / (1 + z2/n)
+	return center - half, center + half
+}
+
+// Mean is the arithmetic mean, 0 for no values
+func Mean(xs []float64) float64 {
+	m, _ := MeanVariance(xs)
+	return m
+}
+
+// Quantile interpolates the q quantile of sorted values, between the two
+// nearest ranks; 0 for no values
+func Quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := max(0, q) * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// BootstrapCI is the percentile bootstrap interval of statistic over xs
+// at the given confidence, from resamples drawn with src; pass a seeded
+// source so reports are reproducible
+func BootstrapCI(xs []float64, statistic func([]float64) float64, confidence float64, resamples int, src rng.RandomSource) (low, high float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	if len(xs) == 1 || resamples <= 0 {
+		v := statistic(xs)
+		return v, v
+	}
+	estimates := make([]float64, resamples)
+	sample := make([]float64, len(xs))
+	for r := range estimates {
+		for i := range sample {
+			sample[i] = xs[src.Intn(len(xs))]
+		}
+		estimates[r] = statistic(sample)
+	}
+	sort.Float64s(estimates)
+	tail := (1 - confidence) / 2
+	at := func(q float64) float64 {
+		i := int(math.Round(q * float64(resamples-1)))
+		return estimates[max(0, min(i, resamples-1))]
+	}
+	return at(tail), at(1 - tail)
+}
@@ -0,0 +1,100 @@
+package stats
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/rng"
+)
+
+func TestChiSquare(t *testing.T) {
+	// a fair die rolled 60 times: statistic 1.0 on 5 degrees of freedom,
+	// the empty seventh cell left out
+	x, p := ChiSquare([]float64{8, 9, 12, 11, 10, 10, 0}, []float64{10, 10, 10, 10, 10, 10, 0})
+	if math.Abs(x-1.0) > 1e-9 || math.Abs(p-0.9626) > 0.001 {
+		t.Errorf("chi-square %g, p %.4f; want 1.0 and 0.9626", x, p)
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	sorted := []float64{1, 2, 4, 8, 16}
+	for _, c := range []struct{ q, want float64 }{
+		{0, 1}, {0.25, 2}, {0.5, 4}, {0.625, 6}, {0.9, 12.8}, {1, 16}, {-1, 1}, {2, 16},
+	} {
+		if got := Quantile(sorted, c.q); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("Quantile(%v) = %g, want %g", c.q, got, c.want)
+		}
+	}
+	if got := Quantile([]float64{3}, 0.99); got != 3 {
+		t.Errorf("one value's quantile %g", got)
+	}
+	if got := Quantile(nil, 0.5); got != 0 {
+		t.Errorf("no values' quantile %g", got)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	a := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	b := []float64{11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	u, p := MannWhitneyU(a, b)
+	if u != 0 || p > 0.001 {
+		t.Errorf("separated samples: U %g, p %.5f", u, p)
+	}
+	if u, _ := MannWhitneyU(b, a); u != 100 {
+		t.Errorf("U of the larger sample %g, want 100", u)
+	}
+	// ties share ranks: identical samples can't differ
+	same := []float64{1, 1, 2, 2, 3, 3, 3, 4}
+	if u, p := MannWhitneyU(same, same); u != 32 || p != 1 {
+		t.Errorf("identical samples: U %g, p %g", u, p)
+	}
+}
+
+func TestBootstrapCI(t *testing.T) {
+	xs := make([]float64, 200)
+	for i := range xs {
+		xs[i] = float64(i % 10)
+	}
+	low, high := BootstrapCI(xs, Mean, 0.95, 2000, rng.NewXoshiro(1))
+	// the mean is 4.5 with a standard error of about 0.2
+	if low > 4.5 || high < 4.5 || high-low < 0.6 || high-low > 1.0 {
+		t.Errorf("95%% interval [%.3f, %.3f] around 4.5", low, high)
+	}
+	again, _ := BootstrapCI(xs, Mean, 0.95, 2000, rng.NewXoshiro(1))
+	if again != low {
+		t.Error("same seed, different interval")
+	}
+}
+
+func TestCorrections(t *testing.T) {
+	ps := []float64{0.01, 0.04, 0.03, 0.005}
+	holm := Holm(ps)
+	for i, want := range []float64{0.03, 0.06, 0.06, 0.02} {
+		if math.Abs(holm[i]-want) > 1e-12 {
+			t.Errorf("Holm %v, want [0.03 0.06 0.06 0.02]", holm)
+			break
+		}
+	}
+	bh := BenjaminiHochberg(ps)
+	for i, want := range []float64{0.02, 0.04, 0.04, 0.02} {
+		if math.Abs(bh[i]-want) > 1e-12 {
+			t.Errorf("Benjamini-Hochberg %v, want [0.02 0.04 0.04 0.02]", bh)
+			break
+		}
+	}
+	if len(Holm(nil)) != 0 {
+		t.Error("no p-values to adjust")
+	}
+}
+
+func TestMeansAndProportions(t *testing.T) {
+	if m, v := MeanVariance([]float64{2, 4, 6}); m != 4 || v != 4 {
+		t.Errorf("mean %g variance %g, want 4 and 4", m, v)
+	}
+	if p := TwoProportionP(0.5, 100, 0.5, 100); p != 1 {
+		t.Errorf("equal proportions p = %g", p)
+	}
+	if low, high := WilsonInterval(0.5, 100, NormalQuantile(0.05)); math.Abs(low-0.4038) > 0.001 || math.Abs(high-0.5962) > 0.001 {
+		t.Errorf("Wilson interval [%.4f, %.4f]", low, high)
+	}
+}
@@ -0,0 +1,130 @@
+// Package stats holds the significance tests, intervals, corrections and
+// quantiles the analysis passes share, so every report judges evidence
+// and summarizes timings the same way
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// MeanVariance returns the mean and unbiased sample variance
+func MeanVariance(xs []float64) (mean, variance float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+	for _, x := range xs {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, variance / float64(len(xs)-1)
+}
+
+// WelchP returns the two-sided p-value of Welch's t-test for the
+// difference between two sample means
+func WelchP(meanA, varA float64, nA int, meanB, varB float64, nB int) float64 {
+	if nA < 2 || nB < 2 {
+		return 1
+	}
+	sa, sb := varA/float64(nA), varB/float64(nB)
+	if sa+sb == 0 {
+		if meanA == meanB {
+			return 1
+		}
+		return 0
+	}
+	t := (meanA - meanB) / math.Sqrt(sa+sb)
+	df := (sa + sb) * (sa + sb) / (sa*sa/float64(nA-1) + sb*sb/float64(nB-1))
+	return StudentTwoSided(t, df)
+}
+
+// TwoProportionP is the two-sided p-value of the pooled z-test for the
+// difference between proportions pA over nA trials and pB over nB
+func TwoProportionP(pA, nA, pB, nB float64) float64 {
+	if nA == 0 || nB == 0 {
+		return 1
+	}
+	pooled := (pA*nA + pB*nB) / (nA + nB)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/nA + 1/nB))
+	if se == 0 {
+		if pA == pB {
+			return 1
+		}
+		return 0
+	}
+	return NormalTwoSided((pA - pB) / se)
+}
+
+// ChiSquare is Pearson's goodness-of-fit test of observed counts against
+// expected ones; cells expecting nothing are left out, and the degrees of
+// freedom are one less than the cells kept
+func ChiSquare(observed, expected []float64) (statistic, p float64) {
+	cells := 0
+	for i, e := range expected {
+		if e <= 0 {
+			continue
+		}
+		d := observed[i] - e
+		statistic += d * d / e
+		cells++
+	}
+	return statistic, ChiSquareP(statistic, cells-1)
+}
+
+// MannWhitneyU is the rank-sum test of whether values in a tend to be
+// larger or smaller than those in b. It returns a's U statistic and the
+// two-sided p-value of the normal approximation, corrected for ties and
+// continuity, which holds from about eight values a side.
+func MannWhitneyU(a, b []float64) (u, p float64) {
+	na, nb := float64(len(a)), float64(len(b))
+	if na == 0 || nb == 0 {
+		return 0, 1
+	}
+	type value struct {
+		x     float64
+		fromA bool
+	}
+	all := make([]value, 0, len(a)+len(b))
+	for _, x := range a {
+		all = append(all, value{x, true})
+	}
+	for _, x := range b {
+		all = append(all, value{x, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].x < all[j].x })
+
+	rankSum, ties := 0.0, 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].x == all[i].x {
+			j++
+		}
+		// ranks i+1 … j share their average
+		rank, t := float64(i+j+1)/2, float64(j-i)
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankSum += rank
+			}
+		}
+		ties += t*t*t - t
+		i = j
+	}
+	u = rankSum - na*(na+1)/2
+
+	n := na + nb
+	sd := math.Sqrt(na * nb / 12 * (n + 1 - ties/(n*(n-1))))
+	if sd == 0 {
+		return u, 1
+	}
+	d := math.Abs(u-na*nb/2) - 0.5
+	if d < 0 {
+		d = 0
+	}
+	return u, NormalTwoSided(d / sd)
+}
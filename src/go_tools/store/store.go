@@ -0,0 +1,459 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go driver, registers "sqlite"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// SchemaVersion is stored in PRAGMA user_version; add a step to
+// migrations whenever the schema changes
+const SchemaVersion = 3
+
+// migrations[i] brings a database from schema version i to i+1. Every row
+// belongs to a run, so repeated analyses accumulate and can be compared
+// over time
+var migrations = [][]string{{
+	`CREATE TABLE runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		started_at TEXT NOT NULL,
+		label TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE sessions (
+		run_id INTEGER NOT NULL REFERENCES runs(id),
+		session_id TEXT NOT NULL,
+		level TEXT NOT NULL,
+		mode TEXT NOT NULL,
+		game_version TEXT NOT NULL,
+		players INTEGER NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		outcome TEXT NOT NULL,
+		winner TEXT NOT NULL,
+		PRIMARY KEY (run_id, session_id)
+	)`,
+	`CREATE TABLE levels (
+		run_id INTEGER NOT NULL REFERENCES runs(id),
+		name TEXT NOT NULL,
+		difficulty TEXT NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		blocks INTEGER NOT NULL,
+		pickups INTEGER NOT NULL,
+		PRIMARY KEY (run_id, name)
+	)`,
+	`CREATE TABLE metrics (
+		run_id INTEGER NOT NULL REFERENCES runs(id),
+		source TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		name TEXT NOT NULL,
+		value REAL NOT NULL
+	)`,
+	`CREATE INDEX metrics_lookup ON metrics (source, name, subject)`,
+}, {
+	`CREATE TABLE balance (
+		run_id INTEGER NOT NULL REFERENCES runs(id),
+		game_version TEXT NOT NULL,
+		metric TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		successes INTEGER NOT NULL,
+		trials INTEGER NOT NULL,
+		PRIMARY KEY (run_id, game_version, metric, subject)
+	)`,
+}, {
+	// client telemetry, by event rather than run: each is kept once, however
+	// often it is sent or imported
+	`CREATE TABLE client_events (
+		id TEXT PRIMARY KEY,
+		time TEXT NOT NULL,
+		player TEXT NOT NULL,
+		event TEXT NOT NULL,
+		version TEXT NOT NULL,
+		build TEXT NOT NULL,
+		platform TEXT NOT NULL,
+		experiment TEXT NOT NULL,
+		arm TEXT NOT NULL,
+		latency_ms REAL NOT NULL
+	)`,
+	`CREATE INDEX client_events_time ON client_events (time)`,
+}}
+
+// Store is an analysis results database
+type Store struct {
+	db *sql.DB
+}
+
+// Run is one recorded analysis
+type Run struct {
+	ID        int64
+	StartedAt time.Time
+	Label     string
+}
+
+// Metric is one numeric result of a run
+type Metric struct {
+	Source  string // the analysis table it came from
+	Subject string // what was measured, e.g. a level or player
+	Name    string
+	Value   float64
+}
+
+// MetricPoint is a metric's value in one run
+type MetricPoint struct {
+	Run   Run
+	Value float64
+}
+
+// Open opens or creates the database at path
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// migrate brings the database up to SchemaVersion
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	switch {
+	case version == SchemaVersion:
+		return nil
+	case version > SchemaVersion:
+		return fmt.Errorf("schema version %d is newer than supported %d", version, SchemaVersion)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, step := range migrations[version:] {
+		for _, stmt := range step {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", SchemaVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// BeginRun starts recording a new analysis run
+func (s *Store) BeginRun(label string, started time.Time) (Run, error) {
+	run := Run{StartedAt: started.UTC(), Label: label}
+	res, err := s.db.Exec("INSERT INTO runs (started_at, label) VALUES (?, ?)",
+		run.StartedAt.Format(time.RFC3339Nano), label)
+	if err != nil {
+		return Run{}, err
+	}
+	run.ID, err = res.LastInsertId()
+	return run, err
+}
+
+// RecordSessions stores one row per replay under the run
+func (s *Store) RecordSessions(run Run, replays []*replay.Replay) error {
+	return s.insert(`INSERT OR REPLACE INTO sessions
+		(run_id, session_id, level, mode, game_version, players, duration_ms, outcome, winner)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, len(replays), func(i int) []any {
+		r := replays[i]
+		return []any{run.ID, r.SessionID, r.Level, r.Mode, r.GameVersion, len(r.Players),
+			r.Result.DurationMs, r.Result.Outcome, r.Result.Winner}
+	})
+}
+
+// RecordLevels stores one row per level under the run
+func (s *Store) RecordLevels(run Run, levels []*level.Level) error {
+	return s.insert(`INSERT OR REPLACE INTO levels
+		(run_id, name, difficulty, width, height, blocks, pickups)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, len(levels), func(i int) []any {
+		l := levels[i]
+		return []any{run.ID, l.Name, l.Difficulty, l.GridSize.Width, l.GridSize.Height, len(l.Blocks), len(l.Pickups)}
+	})
+}
+
+// RecordMetrics stores metrics under the run
+func (s *Store) RecordMetrics(run Run, metrics []Metric) error {
+	return s.insert("INSERT INTO metrics (run_id, source, subject, name, value) VALUES (?, ?, ?, ?, ?)",
+		len(metrics), func(i int) []any {
+			m := metrics[i]
+			return []any{run.ID, m.Source, m.Subject, m.Name, m.Value}
+		})
+}
+
+// RecordBalance stores per-version balance metrics under the run
+func (s *Store) RecordBalance(run Run, metrics []analyzer.BalanceMetric) error {
+	return s.insert(`INSERT OR REPLACE INTO balance
+		(run_id, game_version, metric, subject, successes, trials)
+		VALUES (?, ?, ?, ?, ?, ?)`, len(metrics), func(i int) []any {
+		m := metrics[i]
+		return []any{run.ID, m.Version, m.Metric, m.Subject, m.Successes, m.Trials}
+	})
+}
+
+// RecordTable stores every numeric cell of an analysis table as a metric
+func (s *Store) RecordTable(run Run, t *analyzer.Table) error {
+	return s.RecordMetrics(run, TableMetrics(t))
+}
+
+// AddClientEvents stores client events by their IDs, which must be set,
+// passing over those with one already stored; it returns how many were
+// new
+func (s *Store) AddClientEvents(events []analyzer.ClientEvent) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	prepared, err := tx.Prepare(`INSERT OR IGNORE INTO client_events
+		(id, time, player, event, version, build, platform, experiment, arm, latency_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer prepared.Close()
+	added := 0
+	for _, e := range events {
+		if e.ID == "" {
+			return 0, fmt.Errorf("client event %s of %s at %s has no ID", e.Event, e.Player, e.Time.Format(time.RFC3339))
+		}
+		res, err := prepared.Exec(e.ID, e.Time.UTC().Format(time.RFC3339Nano), e.Player, e.Event, e.Version,
+			e.Build, e.Platform, e.Experiment, e.Arm, e.LatencyMs)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		added += int(n)
+	}
+	return added, tx.Commit()
+}
+
+// ClientEvents returns the client events stored, in time order
+func (s *Store) ClientEvents() ([]analyzer.ClientEvent, error) {
+	rows, err := s.db.Query(`SELECT id, time, player, event, version, build, platform, experiment, arm, latency_ms
+		FROM client_events ORDER BY time, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []analyzer.ClientEvent
+	for rows.Next() {
+		var e analyzer.ClientEvent
+		var at string
+		if err := rows.Scan(&e.ID, &at, &e.Player, &e.Event, &e.Version, &e.Build, &e.Platform, &e.Experiment, &e.Arm, &e.LatencyMs); err != nil {
+			return nil, err
+		}
+		if e.Time, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// insert runs stmt once per row in a single transaction
+func (s *Store) insert(stmt string, n int, row func(i int) []any) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	prepared, err := tx.Prepare(stmt)
+	if err != nil {
+		return err
+	}
+	defer prepared.Close()
+	for i := 0; i < n; i++ {
+		if _, err := prepared.Exec(row(i)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TableMetrics flattens a table into metrics: the row's string columns,
+// joined with "/", are the subject and every int or float column is a
+// metric named after it
+func TableMetrics(t *analyzer.Table) []Metric {
+	var metrics []Metric
+	for _, row := range t.Rows {
+		var subject []string
+		for j, c := range t.Columns {
+			if v, ok := row[j].(string); ok && c.Kind == analyzer.KindString {
+				subject = append(subject, v)
+			}
+		}
+		for j, c := range t.Columns {
+			m := Metric{Source: t.Name, Subject: strings.Join(subject, "/"), Name: c.Name}
+			switch v := row[j].(type) {
+			case int:
+				m.Value = float64(v)
+			case float64:
+				m.Value = v
+			default:
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// Runs lists every recorded run, oldest first
+func (s *Store) Runs() ([]Run, error) {
+	rows, err := s.db.Query("SELECT id, started_at, label FROM runs ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var runs []Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// RunMetrics returns every metric recorded by a run
+func (s *Store) RunMetrics(runID int64) ([]Metric, error) {
+	rows, err := s.db.Query(`SELECT source, subject, name, value FROM metrics
+		WHERE run_id = ? ORDER BY source, subject, name`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var metrics []Metric
+	for rows.Next() {
+		var m Metric
+		if err := rows.Scan(&m.Source, &m.Subject, &m.Name, &m.Value); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
+
+// MetricHistory returns a metric's value in every run that recorded it,
+// oldest first, so trends across analyses can be plotted
+func (s *Store) MetricHistory(source, subject, name string) ([]MetricPoint, error) {
+	rows, err := s.db.Query(`SELECT r.id, r.started_at, r.label, m.value
+		FROM metrics m JOIN runs r ON r.id = m.run_id
+		WHERE m.source = ? AND m.subject = ? AND m.name = ?
+		ORDER BY r.id`, source, subject, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var points []MetricPoint
+	for rows.Next() {
+		var p MetricPoint
+		var started string
+		if err := rows.Scan(&p.Run.ID, &started, &p.Run.Label, &p.Value); err != nil {
+			return nil, err
+		}
+		if p.Run.StartedAt, err = time.Parse(time.RFC3339Nano, started); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// BalanceVersions lists the game versions with recorded balance metrics,
+// oldest version first
+func (s *Store) BalanceVersions() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT game_version FROM balance")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return analyzer.CompareVersions(versions[i], versions[j]) < 0 })
+	return versions, rows.Err()
+}
+
+// VersionBalance returns a version's balance metrics as recorded by the
+// latest run that saw the version
+func (s *Store) VersionBalance(version string) ([]analyzer.BalanceMetric, error) {
+	rows, err := s.db.Query(`SELECT metric, subject, successes, trials FROM balance
+		WHERE game_version = ? AND run_id = (SELECT MAX(run_id) FROM balance WHERE game_version = ?)
+		ORDER BY metric, subject`, version, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var metrics []analyzer.BalanceMetric
+	for rows.Next() {
+		m := analyzer.BalanceMetric{Version: version}
+		if err := rows.Scan(&m.Metric, &m.Subject, &m.Successes, &m.Trials); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
+
+// SessionCounts returns how many distinct sessions were recorded per
+// level across all runs
+func (s *Store) SessionCounts() (map[string]int, error) {
+	rows, err := s.db.Query("SELECT level, COUNT(DISTINCT session_id) FROM sessions GROUP BY level")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var lvl string
+		var n int
+		if err := rows.Scan(&lvl, &n); err != nil {
+			return nil, err
+		}
+		counts[lvl] = n
+	}
+	return counts, rows.Err()
+}
+
+func scanRun(rows *sql.Rows) (Run, error) {
+	var run Run
+	var started string
+	if err := rows.Scan(&run.ID, &started, &run.Label); err != nil {
+		return Run{}, err
+	}
+	var err error
+	run.StartedAt, err = time.Parse(time.RFC3339Nano, started)
+	return run, err
+}
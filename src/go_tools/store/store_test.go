@@ -0,0 +1,131 @@
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+func TestRunsAccumulateAcrossOpens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, rate := range []float64{0.4, 0.55} {
+		s, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		run, err := s.BeginRun("nightly", start.Add(time.Duration(i)*24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		table := analyzer.NewTable("win_rates", "group", "key", "games:int", "rate:float")
+		table.Add("level", "caves", 20, rate)
+		if err := s.RecordTable(run, table); err != nil {
+			t.Fatal(err)
+		}
+		replays := []*replay.Replay{{SessionID: "s1", Level: "caves"}, {SessionID: "s2", Level: "caves"}}
+		if err := s.RecordSessions(run, replays); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	runs, err := s.Runs()
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("runs = %v, %v; want 2", runs, err)
+	}
+	history, err := s.MetricHistory("win_rates", "level/caves", "rate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Value != 0.4 || history[1].Value != 0.55 {
+		t.Errorf("history = %+v", history)
+	}
+	if !history[1].Run.StartedAt.Equal(start.Add(24 * time.Hour)) {
+		t.Errorf("second run started %v", history[1].Run.StartedAt)
+	}
+	counts, err := s.SessionCounts()
+	if err != nil || counts["caves"] != 2 {
+		t.Errorf("session counts = %v, %v; want 2 distinct for caves", counts, err)
+	}
+}
+
+func TestBalanceSurvivesMigrationFromVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range append(migrations[0], "PRAGMA user_version = 1") {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, wins := range []int{40, 45} {
+		run, err := s.BeginRun("nightly", start.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.RecordBalance(run, []analyzer.BalanceMetric{
+			{Version: "1.10", Metric: analyzer.MetricSpellWinRate, Subject: "FREEZE", Successes: wins, Trials: 100},
+			{Version: "1.9", Metric: analyzer.MetricSpellWinRate, Subject: "FREEZE", Successes: 50, Trials: 100},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := s.BalanceVersions()
+	if err != nil || len(versions) != 2 || versions[0] != "1.9" {
+		t.Fatalf("versions = %v, %v; want 1.9 before 1.10", versions, err)
+	}
+	metrics, err := s.VersionBalance("1.10")
+	if err != nil || len(metrics) != 1 || metrics[0].Successes != 45 {
+		t.Errorf("balance = %+v, %v; want the latest run's 45 wins", metrics, err)
+	}
+}
+
+func TestClientEventsKeptOnce(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "results.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events := []analyzer.ClientEvent{
+		{ID: "b", Time: at.Add(time.Minute), Player: "p1", Event: analyzer.ClientWin, Version: "1.2"},
+		{ID: "a", Time: at, Player: "p1", Event: analyzer.ClientInputLatency, Version: "1.2", Platform: "web", LatencyMs: 41.5},
+	}
+	for i, want := range []int{2, 0} {
+		added, err := s.AddClientEvents(events)
+		if err != nil || added != want {
+			t.Errorf("add %d: %d added, %v; want %d", i, added, err, want)
+		}
+	}
+	got, err := s.ClientEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != events[1] || !got[1].Time.Equal(events[0].Time) {
+		t.Errorf("events = %+v", got)
+	}
+	if _, err := s.AddClientEvents([]analyzer.ClientEvent{{Event: analyzer.ClientLaunch}}); err == nil {
+		t.Error("no error adding an event without an ID")
+	}
+}
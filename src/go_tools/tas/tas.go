@@ -0,0 +1,509 @@
+// Package tas runs hand-written, frame-indexed input scripts against the
+// simulator and checks what they expect of the game, so tricky rule
+// interactions such as spin kicks and last-frame holds are pinned down by
+// an executable regression suite.
+//
+// A script is a line a directive; # starts a comment. The setup:
+//
+//	level PATH           a level file, relative to the script
+//	board                the level's board instead, rows up to a line "end":
+//	...                  . empty, a piece type's letter a block of it, G
+//	end                  garbage, and b, i or h a bomb, ice or heavy block
+//	spawn X Y            a spawn point; default the top middle
+//	pickup SPELL X Y
+//	pieces T I O ...     the pieces dealt first
+//	players p1 p2        default p1
+//	seed N
+//	rotation NAME        a pieces rotation system
+//	randomizer NAME
+//	gravity ROWS         rows a second
+//	lock_delay FRAMES
+//	run FRAMES           play at least this long
+//
+// Inputs queue replay actions for the frame they name, absolutely as @F or
+// relative to the previous input line as +F, for a player or the first:
+//
+//	@0 p1 left left rotate_cw
+//	+30 hard_drop
+//	@40 cast:FREEZE cast:ADD_BLOCKS>p2
+//
+// Expectations check the game once F frames have played, or at the end
+// without one:
+//
+//	expect @F [PLAYER] lines|score|combo|pieces|pickups|specials|incoming N
+//	expect @F [PLAYER] hold TYPE|-
+//	expect @F [PLAYER] piece TYPE X Y ROTATION|-
+//	expect @F [PLAYER] spells SPELL ...|-
+//	expect @F [PLAYER] topped_out true|false
+//	expect @F over true|false
+//	expect @F [PLAYER] event TYPE [DETAIL]      by then, the player's
+//	expect @F [PLAYER] no event TYPE [DETAIL]
+//	expect @F [PLAYER] board                    rows as in board, up to end
+package tas
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Script is a parsed input script
+type Script struct {
+	Name    string
+	Level   *level.Level
+	Options sim.Options
+	Inputs  []Input
+	Expects []Expect
+	Frames  int // played at least
+}
+
+// Input is an action a script queues
+type Input struct {
+	Line   int
+	Frame  int
+	Player string
+	Action string // a replay action; for a cast, Spell and Target
+	Spell  string
+	Target string
+}
+
+// Expect is something a script expects of the game
+type Expect struct {
+	Line   int
+	Frame  int // -1 for the end
+	Player string
+	Field  string
+	Args   []string
+	Rows   []string // of a board
+}
+
+// Failure is an expectation the game didn't meet, or an input it refused
+type Failure struct {
+	Line int    `json:"line"`
+	Msg  string `json:"msg"`
+}
+
+func (f Failure) String() string { return fmt.Sprintf("line %d: %s", f.Line, f.Msg) }
+
+// Report is how a script's run went
+type Report struct {
+	Name     string    `json:"name"`
+	Frames   int       `json:"frames"`
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+// OK reports whether the game did all the script expected
+func (r Report) OK() bool { return len(r.Failures) == 0 }
+
+// counts are the fields an expectation checks a number of
+var counts = []string{"lines", "score", "combo", "pieces", "pickups", "specials", "incoming"}
+
+// ParseFile reads a script file
+func ParseFile(path string) (*Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := Parse(f, filepath.Base(path), filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse reads a script named name, its level paths relative to dir
+func Parse(r io.Reader, name, dir string) (*Script, error) {
+	s := &Script{Name: name}
+	var board []string
+	var spawns []level.Point
+	var pickups []level.Pickup
+	var fixed []string
+	frame := 0
+
+	sc := bufio.NewScanner(r)
+	line := 0
+	next := func() (string, bool) {
+		for sc.Scan() {
+			line++
+			if text := strings.TrimSpace(strings.SplitN(sc.Text(), "#", 2)[0]); text != "" {
+				return text, true
+			}
+		}
+		return "", false
+	}
+	rows := func() ([]string, error) {
+		start := line
+		var out []string
+		for {
+			text, ok := next()
+			if !ok {
+				return nil, fmt.Errorf("line %d: board without end", start)
+			}
+			if text == "end" {
+				return out, nil
+			}
+			if len(out) > 0 && len(text) != len(out[0]) {
+				return nil, fmt.Errorf("line %d: row %q is not %d wide", line, text, len(out[0]))
+			}
+			out = append(out, text)
+		}
+	}
+	for {
+		text, ok := next()
+		if !ok {
+			break
+		}
+		f := strings.Fields(text)
+		bad := func(format string, args ...any) error {
+			return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+		}
+		ints := func(args []string, n int) ([]int, error) {
+			if len(args) != n {
+				return nil, bad("%s takes %d numbers", f[0], n)
+			}
+			out := make([]int, n)
+			for i, a := range args {
+				v, err := strconv.Atoi(a)
+				if err != nil {
+					return nil, bad("%s: %q is not a number", f[0], a)
+				}
+				out[i] = v
+			}
+			return out, nil
+		}
+		switch {
+		case f[0] == "level" && len(f) == 2:
+			lvl, err := level.Load(filepath.Join(dir, f[1]))
+			if err != nil {
+				return nil, bad("%v", err)
+			}
+			s.Level = lvl
+		case f[0] == "board" && len(f) == 1:
+			var err error
+			if board, err = rows(); err != nil {
+				return nil, err
+			}
+		case f[0] == "spawn":
+			v, err := ints(f[1:], 2)
+			if err != nil {
+				return nil, err
+			}
+			spawns = append(spawns, level.Point{X: v[0], Y: v[1]})
+		case f[0] == "pickup" && len(f) == 4:
+			v, err := ints(f[2:], 2)
+			if err != nil {
+				return nil, err
+			}
+			pickups = append(pickups, level.Pickup{Spell: f[1], X: v[0], Y: v[1]})
+		case f[0] == "pieces":
+			fixed = append(fixed, f[1:]...)
+		case f[0] == "players":
+			s.Options.Players = f[1:]
+		case f[0] == "seed" && len(f) == 2:
+			seed, err := strconv.ParseInt(f[1], 10, 64)
+			if err != nil {
+				return nil, bad("seed %q is not a number", f[1])
+			}
+			s.Options.Seed = seed
+		case f[0] == "rotation" && len(f) == 2:
+			s.Options.Rotation = f[1]
+		case f[0] == "randomizer" && len(f) == 2:
+			s.Options.Randomizer = f[1]
+		case f[0] == "gravity" && len(f) == 2:
+			g, err := strconv.ParseFloat(f[1], 64)
+			if err != nil || g <= 0 {
+				return nil, bad("gravity %q is not a positive number", f[1])
+			}
+			s.Options.Gravity = g
+		case f[0] == "lock_delay", f[0] == "run":
+			v, err := ints(f[1:], 1)
+			if err != nil {
+				return nil, err
+			}
+			if f[0] == "run" {
+				s.Frames = v[0]
+			} else {
+				s.Options.LockDelay = v[0]
+			}
+		case f[0][0] == '@' || f[0][0] == '+':
+			n, err := strconv.Atoi(f[0][1:])
+			if err != nil || n < 0 {
+				return nil, bad("frame %q", f[0])
+			}
+			if f[0][0] == '+' {
+				n += frame
+			}
+			frame = n
+			player, actions := "", f[1:]
+			if len(actions) > 0 && !isAction(actions[0]) {
+				player, actions = actions[0], actions[1:]
+			}
+			if len(actions) == 0 {
+				return nil, bad("no actions")
+			}
+			for _, a := range actions {
+				in := Input{Line: line, Frame: n, Player: player, Action: a}
+				if spell, ok := strings.CutPrefix(a, "cast:"); ok {
+					in.Action = replay.ActionCast
+					in.Spell, in.Target, _ = strings.Cut(spell, ">")
+				} else if !isAction(a) {
+					return nil, bad("unknown action %q", a)
+				}
+				s.Inputs = append(s.Inputs, in)
+			}
+		case f[0] == "expect":
+			e, err := parseExpect(f[1:], line, s.Options.Players)
+			if err != nil {
+				return nil, err
+			}
+			if e.Field == "board" {
+				if e.Rows, err = rows(); err != nil {
+					return nil, err
+				}
+			}
+			s.Expects = append(s.Expects, e)
+		default:
+			return nil, bad("unknown directive %q", text)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(s.Inputs, func(i, j int) bool { return s.Inputs[i].Frame < s.Inputs[j].Frame })
+
+	switch {
+	case s.Level != nil && board != nil:
+		return nil, fmt.Errorf("a script has a level or a board, not both")
+	case board != nil:
+		lvl, err := boardLevel(name, board)
+		if err != nil {
+			return nil, err
+		}
+		s.Level = lvl
+	case s.Level == nil:
+		return nil, fmt.Errorf("a script needs a level or a board")
+	}
+	if spawns != nil {
+		s.Level.SpawnPoints = spawns
+	} else if len(s.Level.SpawnPoints) == 0 {
+		s.Level.SpawnPoints = []level.Point{{X: s.Level.GridSize.Width / 2, Y: 0}}
+	}
+	s.Level.Pickups = append(s.Level.Pickups, pickups...)
+	if fixed != nil {
+		if s.Level.Pieces == nil {
+			s.Level.Pieces = &level.PieceSequence{}
+		}
+		s.Level.Pieces.Fixed = fixed
+	}
+	return s, nil
+}
+
+func isAction(a string) bool {
+	return slices.Contains(replay.Actions, a) && a != replay.ActionCast || strings.HasPrefix(a, "cast:")
+}
+
+// parseExpect reads an expectation's words after expect; players are the
+// script's so far, a word naming none of them being the field
+func parseExpect(f []string, line int, players []string) (Expect, error) {
+	e := Expect{Line: line, Frame: -1}
+	bad := fmt.Errorf("line %d: expect [@F] [PLAYER] FIELD VALUE...", line)
+	if len(f) > 0 && f[0][0] == '@' {
+		n, err := strconv.Atoi(f[0][1:])
+		if err != nil || n < 0 {
+			return e, bad
+		}
+		e.Frame, f = n, f[1:]
+	}
+	if len(f) > 1 && (slices.Contains(players, f[0]) || len(players) == 0 && f[0] == "p1") {
+		e.Player, f = f[0], f[1:]
+	}
+	if len(f) == 0 {
+		return e, bad
+	}
+	e.Field, e.Args = f[0], f[1:]
+	if e.Field == "no" && len(e.Args) > 0 && e.Args[0] == "event" {
+		e.Field, e.Args = "no event", e.Args[1:]
+	}
+	want := map[string][2]int{ // least and most arguments
+		"hold": {1, 1}, "piece": {1, 4}, "spells": {1, 99}, "topped_out": {1, 1}, "over": {1, 1},
+		"event": {1, 2}, "no event": {1, 2}, "board": {0, 0},
+	}
+	for _, c := range counts {
+		want[c] = [2]int{1, 1}
+	}
+	n, ok := want[e.Field]
+	if !ok {
+		return e, fmt.Errorf("line %d: unknown expectation %q", line, e.Field)
+	}
+	if len(e.Args) < n[0] || len(e.Args) > n[1] || e.Field == "piece" && len(e.Args) != 1 && len(e.Args) != 4 {
+		return e, bad
+	}
+	return e, nil
+}
+
+// boardLevel is a level of the board's rows
+func boardLevel(name string, rows []string) (*level.Level, error) {
+	lvl := level.New(strings.TrimSuffix(name, filepath.Ext(name)), len(rows[0]), len(rows))
+	specials := map[byte]string{'b': level.SpecialBomb, 'i': level.SpecialIce, 'h': level.SpecialHeavy}
+	for y, row := range rows {
+		for x := 0; x < len(row); x++ {
+			switch c := row[x]; {
+			case c == '.':
+			case specials[c] != "":
+				lvl.Blocks = append(lvl.Blocks, level.Block{Type: "O", X: x, Y: y, Special: specials[c]})
+			case level.IsBlockType(string(c)) || string(c) == sim.Garbage:
+				lvl.Blocks = append(lvl.Blocks, level.Block{Type: string(c), X: x, Y: y})
+			default:
+				return nil, fmt.Errorf("board row %d: unknown cell %q", y, c)
+			}
+		}
+	}
+	return lvl, nil
+}
+
+// Run plays the script and checks its expectations; it errs only when
+// the game can't be set up
+func (s *Script) Run() (Report, error) {
+	g, err := sim.New(s.Level, s.Options)
+	if err != nil {
+		return Report{}, err
+	}
+	first := g.Players()[0]
+	end := s.Frames
+	for _, in := range s.Inputs {
+		end = max(end, in.Frame+1)
+	}
+	for _, e := range s.Expects {
+		end = max(end, e.Frame)
+	}
+	r := Report{Name: s.Name}
+	fail := func(line int, format string, args ...any) {
+		r.Failures = append(r.Failures, Failure{Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+	check := func(frame int) {
+		for _, e := range s.Expects {
+			if e.Frame != frame {
+				continue
+			}
+			player := e.Player
+			if player == "" {
+				player = first
+			}
+			if msg := e.check(g, player); msg != "" {
+				fail(e.Line, "frame %d, %s: %s", g.Frame(), player, msg)
+			}
+		}
+	}
+	in := 0
+	for g.Frame() < end {
+		check(g.Frame())
+		for ; in < len(s.Inputs) && s.Inputs[in].Frame <= g.Frame(); in++ {
+			input := s.Inputs[in]
+			player := input.Player
+			if player == "" {
+				player = first
+			}
+			var err error
+			if input.Action == replay.ActionCast {
+				err = g.Cast(player, input.Spell, input.Target)
+			} else {
+				err = g.Input(player, input.Action)
+			}
+			if err != nil {
+				fail(input.Line, "frame %d: %v", g.Frame(), err)
+			}
+		}
+		g.Tick()
+	}
+	check(g.Frame())
+	check(-1)
+	r.Frames = g.Frame()
+	return r, nil
+}
+
+// check is what the game falls short of the expectation by, "" when it
+// meets it
+func (e Expect) check(g *sim.Game, player string) string {
+	if e.Field == "over" {
+		if got := strconv.FormatBool(g.Over()); got != e.Args[0] {
+			return "over is " + got
+		}
+		return ""
+	}
+	st, ok := g.State(player)
+	if !ok {
+		return "no such player"
+	}
+	switch e.Field {
+	case "hold":
+		if got := orNone(st.Hold); got != e.Args[0] {
+			return "holds " + got
+		}
+	case "piece":
+		got := "-"
+		if pc := st.Piece; pc != nil {
+			got = fmt.Sprintf("%s %d %d %d", pc.Type, pc.X, pc.Y, pc.Rotation)
+		}
+		if want := strings.Join(e.Args, " "); got != want && (len(e.Args) != 1 || !strings.HasPrefix(got, want+" ")) {
+			return "piece is " + got
+		}
+	case "spells":
+		if got := orNone(strings.Join(st.Spells, " ")); got != strings.Join(e.Args, " ") {
+			return "holds spells " + got
+		}
+	case "topped_out":
+		if got := strconv.FormatBool(st.ToppedOut); got != e.Args[0] {
+			return "topped out is " + got
+		}
+	case "event", "no event":
+		seen := false
+		for _, ev := range g.Replay("").Events {
+			if ev.Player == player && ev.Type == e.Args[0] && (len(e.Args) == 1 || ev.Detail == e.Args[1]) {
+				seen = true
+				break
+			}
+		}
+		switch {
+		case !seen && e.Field == "event":
+			return "had no " + strings.Join(e.Args, " ")
+		case seen && e.Field == "no event":
+			return "had " + strings.Join(e.Args, " ")
+		}
+	case "board":
+		got := g.Board(player).Rows()
+		if !slices.Equal(got, e.Rows) {
+			return "board is\n\t" + strings.Join(got, "\n\t")
+		}
+	default:
+		want, err := strconv.Atoi(e.Args[0])
+		if err != nil {
+			return fmt.Sprintf("%s %q is not a number", e.Field, e.Args[0])
+		}
+		got := map[string]int{
+			"lines": st.Lines, "score": st.Score, "combo": st.Combo, "pieces": st.Pieces,
+			"pickups": st.Pickups, "specials": st.Specials, "incoming": st.Incoming,
+		}[e.Field]
+		if got != want {
+			return fmt.Sprintf("%s is %d", e.Field, got)
+		}
+	}
+	return ""
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
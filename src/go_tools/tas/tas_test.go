@@ -0,0 +1,58 @@
+package tas
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScripts(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.tas")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no scripts in testdata: %v", err)
+	}
+	for _, path := range files {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			s, err := ParseFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := s.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range r.Failures {
+				t.Error(f)
+			}
+		})
+	}
+}
+
+func TestFailures(t *testing.T) {
+	s, err := Parse(strings.NewReader("board\n..\n..\nend\npieces O\ngravity 0.01\nexpect @1 piece O 0 0 0\nexpect @1 lines 1\n"), "fail", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.OK() || len(r.Failures) != 1 || r.Failures[0].Line != 8 {
+		t.Errorf("failures %v, want the lines expectation on line 8", r.Failures)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, script := range []string{
+		"pieces O\n",
+		"board\n..\n",
+		"board\n..\n...\nend\n",
+		"board\n..\nend\n@0 jump\n",
+		"board\n..\nend\nexpect @1 colour red\n",
+		"board\n..\nend\nexpect @1 piece O 0\n",
+	} {
+		if _, err := Parse(strings.NewReader(script), "bad", ""); err == nil {
+			t.Errorf("script %q parsed", script)
+		}
+	}
+}
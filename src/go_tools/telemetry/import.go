@@ -0,0 +1,32 @@
+package telemetry
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+// Import reads the client event log at path, gzipped if it ends in .gz,
+// into the ingester and stores what it buffered
+func Import(in *Ingester, path string) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return Result{}, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	res, err := in.Read(r)
+	if err != nil {
+		return res, err
+	}
+	return res, in.Flush()
+}
@@ -0,0 +1,236 @@
+package telemetry
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/utils"
+)
+
+// Defaults of Options left zero
+const (
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 5 * time.Second
+)
+
+// maxLineBytes bounds a line of an event log
+const maxLineBytes = 64 << 10
+
+// ErrBufferFull is events refused because the buffer is full with events
+// the store wouldn't take; they can be sent again once it does
+var ErrBufferFull = errors.New("telemetry buffer full")
+
+// Sink stores events by their IDs, passing over those it has, as
+// store.Store does
+type Sink interface {
+	AddClientEvents(events []analyzer.ClientEvent) (int, error)
+}
+
+// Options size an Ingester's batches
+type Options struct {
+	BatchSize     int           // events buffered before they are stored
+	FlushInterval time.Duration // longest Run lets an event wait in the buffer
+	MaxBuffered   int           // events held while the sink fails, before more are refused; default 20 batches
+}
+
+// Result is what became of the events of a call to Add or Read
+type Result struct {
+	Accepted   int         `json:"accepted"`
+	Duplicates int         `json:"duplicates"` // of events accepted and not yet stored; those stored already are counted by Stats
+	Rejected   []Rejection `json:"rejected,omitempty"`
+}
+
+// Rejection is an event refused, by its line, or its index for Add from 1
+type Rejection struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Stats are an Ingester's totals
+type Stats struct {
+	Accepted   int       `json:"accepted"`
+	Duplicates int       `json:"duplicates"` // sent again, while buffered or once stored
+	Rejected   int       `json:"rejected"`
+	Stored     int       `json:"stored"`
+	Buffered   int       `json:"buffered"`
+	Flushes    int       `json:"flushes"`
+	LastFlush  time.Time `json:"lastFlush"`
+	LastError  string    `json:"lastError,omitempty"` // of the last flush, if it failed
+}
+
+// Ingester validates and dedupes events, buffering them into batches for
+// its sink. It's safe for concurrent use.
+type Ingester struct {
+	sink Sink
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	buffer   []analyzer.ClientEvent
+	buffered map[string]bool // keys of the events in buffer
+	stats    Stats
+}
+
+// FromConfig is the results database the config stores telemetry in, and
+// the options it sizes batches by
+func FromConfig(config utils.Config) (string, Options) {
+	path := config.TelemetryDB
+	if path == "" {
+		path = config.ResultsDB
+	}
+	return path, Options{BatchSize: config.TelemetryBatchSize, FlushInterval: time.Duration(config.TelemetryFlushSecs) * time.Second}
+}
+
+// New ingests into sink
+func New(sink Sink, opts Options) *Ingester {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.MaxBuffered < opts.BatchSize {
+		opts.MaxBuffered = 20 * opts.BatchSize
+	}
+	return &Ingester{sink: sink, opts: opts, now: time.Now, buffered: make(map[string]bool)}
+}
+
+// Add validates and buffers events, storing a batch once there's one
+func (in *Ingester) Add(events ...analyzer.ClientEvent) (Result, error) {
+	var res Result
+	for i, ev := range events {
+		if err := in.add(&res, i+1, ev); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// Read validates and buffers the events of a client event log, one JSON
+// event a line, storing each batch as it fills. Events that don't decode
+// or validate are rejected by line; an error is the log failing to read,
+// or the buffer filling, with the events before it accepted. Lines are
+// read and decoded without holding the ingester, so a slow client holds
+// up no one else's events.
+func (in *Ingester) Read(r io.Reader) (Result, error) {
+	var res Result
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineBytes)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		ev, err := Decode(scanner.Bytes())
+		if err != nil {
+			in.reject(&res, line, err)
+			continue
+		}
+		if err := in.add(&res, line, ev); err != nil {
+			return res, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return res, fmt.Errorf("read events: %w", err)
+	}
+	return res, nil
+}
+
+// add validates an event and buffers it
+func (in *Ingester) add(res *Result, line int, ev analyzer.ClientEvent) error {
+	if err := Validate(ev, in.now()); err != nil {
+		in.reject(res, line, err)
+		return nil
+	}
+	ev.ID = Key(ev)
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.buffered[ev.ID] {
+		res.Duplicates++
+		in.stats.Duplicates++
+		return nil
+	}
+	if len(in.buffer) >= in.opts.MaxBuffered {
+		if err := in.flush(); err != nil {
+			return fmt.Errorf("%w: %v", ErrBufferFull, err)
+		}
+	}
+	in.buffer = append(in.buffer, ev)
+	in.buffered[ev.ID] = true
+	res.Accepted++
+	in.stats.Accepted++
+	if len(in.buffer) >= in.opts.BatchSize {
+		if err := in.flush(); err != nil {
+			slog.Warn("telemetry: store failed, keeping the events buffered", "events", len(in.buffer), "err", err)
+		}
+	}
+	return nil
+}
+
+func (in *Ingester) reject(res *Result, line int, err error) {
+	res.Rejected = append(res.Rejected, Rejection{Line: line, Error: err.Error()})
+	in.mu.Lock()
+	in.stats.Rejected++
+	in.mu.Unlock()
+}
+
+// Flush stores the events buffered
+func (in *Ingester) Flush() error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.flush()
+}
+
+// flush stores the buffer, under in.mu; on failure the events stay
+// buffered for the next
+func (in *Ingester) flush() error {
+	if len(in.buffer) == 0 {
+		return nil
+	}
+	added, err := in.sink.AddClientEvents(in.buffer)
+	in.stats.Flushes++
+	in.stats.LastFlush = in.now()
+	if err != nil {
+		in.stats.LastError = err.Error()
+		return err
+	}
+	in.stats.LastError = ""
+	in.stats.Stored += added
+	in.stats.Duplicates += len(in.buffer) - added
+	slog.Debug("telemetry: stored", "events", added, "duplicates", len(in.buffer)-added)
+	in.buffer = in.buffer[:0]
+	clear(in.buffered)
+	return nil
+}
+
+// Run flushes the buffer every FlushInterval until ctx is done, and once
+// more then
+func (in *Ingester) Run(ctx context.Context) error {
+	tick := time.NewTicker(in.opts.FlushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return in.Flush()
+		case <-tick.C:
+			if err := in.Flush(); err != nil {
+				slog.Warn("telemetry: store failed, keeping the events buffered", "err", err)
+			}
+		}
+	}
+}
+
+// Stats are the ingester's totals so far
+func (in *Ingester) Stats() Stats {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	s := in.stats
+	s.Buffered = len(in.buffer)
+	return s
+}
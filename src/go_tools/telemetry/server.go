@@ -0,0 +1,112 @@
+package telemetry
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/admin"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+)
+
+// maxBodyBytes bounds a request's events, decompressed
+const maxBodyBytes = 8 << 20
+
+// Server takes clients' events over HTTP:
+//
+//	POST /telemetry   a client event log, one JSON event a line, gzipped or not
+//	GET  /telemetry   the ingester's totals
+//
+// A post answers 202 with what became of its events, even with some
+// rejected, 400 when every event was, and 503 when the buffer is full,
+// the events before the one refused accepted.
+type Server struct {
+	in *Ingester
+}
+
+// NewServer serves in
+func NewServer(in *Ingester) *Server {
+	return &Server{in: in}
+}
+
+// ServeHTTP routes the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.Trim(r.URL.Path, "/") != "telemetry" {
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		s.post(w, r)
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, s.in.Stats())
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) post(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, "read events: %v", err)
+			return
+		}
+		defer zr.Close()
+		body = http.MaxBytesReader(w, zr, maxBodyBytes)
+	}
+	res, err := s.in.Read(body)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, ErrBufferFull):
+		w.Header().Set("Retry-After", "30")
+		writeJSON(w, http.StatusServiceUnavailable, res)
+	case errors.As(err, &tooLarge):
+		httpError(w, http.StatusRequestEntityTooLarge, "events larger than %d bytes; send them in parts", maxBodyBytes)
+	case err != nil:
+		httpError(w, http.StatusBadRequest, "%v", err)
+	case res.Accepted == 0 && res.Duplicates == 0 && len(res.Rejected) > 0:
+		writeJSON(w, http.StatusBadRequest, res)
+	default:
+		writeJSON(w, http.StatusAccepted, res)
+	}
+}
+
+// RegisterAdmin adds the ingester's operations to a server's admin API:
+//
+//	POST /admin/telemetry/flush   store the events buffered now
+func (s *Server) RegisterAdmin(a *admin.API) {
+	a.Handle("POST /admin/telemetry/flush", "store the events buffered now", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.in.Flush(); err != nil {
+			admin.Error(w, http.StatusInternalServerError, "%v", err)
+			return
+		}
+		slog.Info("telemetry: flushed", "by", r.RemoteAddr)
+		admin.WriteJSON(w, http.StatusOK, s.in.Stats())
+	})
+}
+
+// DescribeAPI adds the server's endpoints to its OpenAPI document
+func (s *Server) DescribeAPI(spec *openapi.Spec) {
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/telemetry",
+		Summary: "send client events, one JSON event a line, gzipped with Content-Encoding or not; 400 if every one is rejected, 413 past 8 MiB decompressed, 503 with Retry-After if the buffer is full",
+		Body:    openapi.Raw("application/x-ndjson"), Status: http.StatusAccepted, Reply: Result{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/telemetry", Summary: "the events accepted, rejected and stored so far", Reply: Stats{}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,107 @@
+// Package telemetry ingests the client's telemetry events into the
+// analysis results store: each is checked against the event schema, keyed
+// so one sent or imported twice is kept once, and buffered into batches
+// before it is written
+package telemetry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+)
+
+// Limits of an event's fields
+const (
+	MaxIDLength    = 128
+	MaxFieldLength = 256
+	MaxClockSkew   = time.Hour // how far in the future an event's time may be
+)
+
+// eventName is the shape of an event's name
+var eventName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// ErrSchema is an event that isn't one the schema allows
+var ErrSchema = errors.New("invalid client event")
+
+// Decode reads one event of the client's event log. Fields the schema
+// doesn't have are an error, so a client sending them is caught rather
+// than its data dropped unnoticed.
+func Decode(data []byte) (analyzer.ClientEvent, error) {
+	var ev analyzer.ClientEvent
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ev); err != nil {
+		return ev, fmt.Errorf("%w: %v", ErrSchema, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return ev, fmt.Errorf("%w: more than one event", ErrSchema)
+	}
+	return ev, nil
+}
+
+// Validate checks an event against the schema as of now: when it
+// happened, no later than MaxClockSkew from now, who to and what, by a
+// lowercase name, and the client's version are required; an arm needs its
+// experiment, and latency samples a positive latency
+func Validate(ev analyzer.ClientEvent, now time.Time) error {
+	switch {
+	case ev.Time.IsZero():
+		return fmt.Errorf("%w: no time", ErrSchema)
+	case ev.Time.After(now.Add(MaxClockSkew)):
+		return fmt.Errorf("%w: time %s is in the future", ErrSchema, ev.Time.Format(time.RFC3339))
+	case ev.Player == "":
+		return fmt.Errorf("%w: no player", ErrSchema)
+	case !eventName.MatchString(ev.Event):
+		return fmt.Errorf("%w: event %q isn't a lowercase name of letters, digits and underscores", ErrSchema, ev.Event)
+	case ev.Version == "":
+		return fmt.Errorf("%w: no version", ErrSchema)
+	case len(ev.ID) > MaxIDLength:
+		return fmt.Errorf("%w: id longer than %d bytes", ErrSchema, MaxIDLength)
+	case ev.Arm != "" && ev.Experiment == "":
+		return fmt.Errorf("%w: arm %q of no experiment", ErrSchema, ev.Arm)
+	case math.IsNaN(ev.LatencyMs) || math.IsInf(ev.LatencyMs, 0) || ev.LatencyMs < 0:
+		return fmt.Errorf("%w: latencyMs %g", ErrSchema, ev.LatencyMs)
+	case ev.Event == analyzer.ClientInputLatency && ev.LatencyMs == 0:
+		return fmt.Errorf("%w: %s without latencyMs", ErrSchema, ev.Event)
+	}
+	for name, v := range map[string]string{"player": ev.Player, "version": ev.Version, "build": ev.Build,
+		"platform": ev.Platform, "experiment": ev.Experiment, "arm": ev.Arm} {
+		if len(v) > MaxFieldLength {
+			return fmt.Errorf("%w: %s longer than %d bytes", ErrSchema, name, MaxFieldLength)
+		}
+	}
+	return nil
+}
+
+// Key is what an event is kept once by: the client's ID for it or, for
+// events without one, such as those of older clients' logs, a hash of
+// everything else in it
+func Key(ev analyzer.ClientEvent) string {
+	if ev.ID != "" {
+		return ev.ID
+	}
+	ev.Time = ev.Time.UTC()
+	data, _ := json.Marshal(ev)
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Table is the events as an analysis table, for export as CSV or Parquet
+func Table(events []analyzer.ClientEvent) *analyzer.Table {
+	t := analyzer.NewTable("client_events", "id", "time", "player", "event", "version", "build", "platform",
+		"experiment", "arm", "latency_ms:float")
+	for _, e := range events {
+		t.Add(e.ID, e.Time.UTC().Format(time.RFC3339Nano), e.Player, e.Event, e.Version, e.Build, e.Platform,
+			e.Experiment, e.Arm, e.LatencyMs)
+	}
+	return t
+}
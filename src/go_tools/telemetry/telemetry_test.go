@@ -0,0 +1,224 @@
+package telemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+)
+
+// memory is a sink keeping events by ID, failing while fail is set
+type memory struct {
+	events map[string]analyzer.ClientEvent
+	fail   bool
+}
+
+func (m *memory) AddClientEvents(events []analyzer.ClientEvent) (int, error) {
+	if m.fail {
+		return 0, errors.New("store down")
+	}
+	added := 0
+	for _, e := range events {
+		if _, ok := m.events[e.ID]; !ok {
+			m.events[e.ID] = e
+			added++
+		}
+	}
+	return added, nil
+}
+
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newIngester(opts Options) (*Ingester, *memory) {
+	m := &memory{events: make(map[string]analyzer.ClientEvent)}
+	in := New(m, opts)
+	in.now = func() time.Time { return now }
+	return in, m
+}
+
+const log = `{"time":"2024-06-01T10:00:00Z","player":"p1","event":"launch","version":"1.2"}
+{"time":"2024-06-01T10:05:00Z","player":"p1","event":"input_latency","version":"1.2","platform":"web","latencyMs":38}
+
+{"time":"2024-06-01T10:00:00Z","player":"p1","event":"launch","version":"1.2"}
+{"id":"c-1","time":"2024-06-01T10:06:00Z","player":"p2","event":"win","version":"1.2"}
+{"time":"2024-06-01T10:07:00Z","player":"p2","event":"win","version":"1.2","score":9}
+{"time":"2024-06-01T10:07:00Z","player":"p2","event":"input_latency","version":"1.2"}
+`
+
+func TestRead(t *testing.T) {
+	in, m := newIngester(Options{BatchSize: 2})
+	res, err := in.Read(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first batch is stored by the time line 4 repeats line 1, so the
+	// store rather than the buffer passes over it
+	if res.Accepted != 4 || len(res.Rejected) != 2 || res.Rejected[0].Line != 6 || res.Rejected[1].Line != 7 {
+		t.Errorf("result %+v", res)
+	}
+	if err := in.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.events) != 3 || m.events["c-1"].Player != "p2" {
+		t.Errorf("stored %v", m.events)
+	}
+	// the same log again is all duplicates, found as it's stored
+	if _, err := in.Read(strings.NewReader(log)); err != nil {
+		t.Fatal(err)
+	}
+	in.Flush()
+	s := in.Stats()
+	if len(m.events) != 3 || s.Stored != 3 || s.Duplicates != 5 || s.Rejected != 4 || s.Buffered != 0 {
+		t.Errorf("stats %+v with %d stored", s, len(m.events))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ok := analyzer.ClientEvent{Time: now, Player: "p", Event: "launch", Version: "1"}
+	if err := Validate(ok, now); err != nil {
+		t.Fatal(err)
+	}
+	bad := map[string]func(e *analyzer.ClientEvent){
+		"future":     func(e *analyzer.ClientEvent) { e.Time = now.Add(2 * MaxClockSkew) },
+		"no player":  func(e *analyzer.ClientEvent) { e.Player = "" },
+		"event name": func(e *analyzer.ClientEvent) { e.Event = "Launch Game" },
+		"arm":        func(e *analyzer.ClientEvent) { e.Arm = "b" },
+		"latency":    func(e *analyzer.ClientEvent) { e.LatencyMs = -1 },
+		"long":       func(e *analyzer.ClientEvent) { e.Platform = strings.Repeat("x", MaxFieldLength+1) },
+	}
+	for name, change := range bad {
+		e := ok
+		change(&e)
+		if err := Validate(e, now); !errors.Is(err, ErrSchema) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if Key(ok) == Key(analyzer.ClientEvent{Time: now, Player: "q", Event: "launch", Version: "1"}) {
+		t.Error("events of different players share a key")
+	}
+}
+
+func TestBufferFull(t *testing.T) {
+	in, m := newIngester(Options{BatchSize: 2, MaxBuffered: 3})
+	m.fail = true
+	var events []analyzer.ClientEvent
+	for i := range 5 {
+		events = append(events, analyzer.ClientEvent{Time: now.Add(time.Duration(i) * time.Second), Player: "p", Event: "launch", Version: "1"})
+	}
+	res, err := in.Add(events...)
+	if !errors.Is(err, ErrBufferFull) || res.Accepted != 3 {
+		t.Fatalf("%+v, %v; want 3 accepted before the buffer filled", res, err)
+	}
+	m.fail = false
+	if res, err := in.Add(events[3:]...); err != nil || res.Accepted != 2 {
+		t.Errorf("%+v, %v once the store is back", res, err)
+	}
+	in.Flush()
+	if len(m.events) != 5 || in.Stats().LastError != "" {
+		t.Errorf("stored %d, stats %+v", len(m.events), in.Stats())
+	}
+}
+
+func TestServer(t *testing.T) {
+	in, m := newIngester(Options{})
+	srv := httptest.NewServer(NewServer(in))
+	defer srv.Close()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(log))
+	zw.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/telemetry", &gz)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("post: %s", resp.Status)
+	}
+	resp, err = http.Post(srv.URL+"/telemetry", "application/x-ndjson", strings.NewReader("{\"event\":\"launch\"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("post of invalid events: %s", resp.Status)
+	}
+	in.Flush()
+	if len(m.events) != 3 {
+		t.Errorf("stored %d events", len(m.events))
+	}
+}
+
+func TestServerRefusesLargeGzip(t *testing.T) {
+	in, _ := newIngester(Options{})
+	srv := httptest.NewServer(NewServer(in))
+	defer srv.Close()
+
+	// a small body that gunzips past the limit
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(log))
+	zw.Write(bytes.Repeat([]byte("\n"), maxBodyBytes))
+	zw.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/telemetry", &gz)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("post gunzipping past the limit: %s", resp.Status)
+	}
+}
+
+func TestReadHoldsNoLockWhileReading(t *testing.T) {
+	in, _ := newIngester(Options{})
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := in.Read(r)
+		done <- err
+	}()
+	w.Write([]byte(strings.SplitAfter(log, "\n")[0]))
+	accepted := make(chan bool, 1)
+	go func() {
+		for in.Stats().Accepted != 1 {
+			time.Sleep(time.Millisecond)
+		}
+		accepted <- true
+	}()
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the ingester was held while its reader waited for lines")
+	}
+	w.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := os.WriteFile(path, []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	in, m := newIngester(Options{})
+	res, err := Import(in, path)
+	if err != nil || res.Accepted != 3 || len(m.events) != 3 {
+		t.Errorf("%+v, %v with %d stored", res, err, len(m.events))
+	}
+}
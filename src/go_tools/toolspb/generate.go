@@ -0,0 +1,5 @@
+// Package toolspb holds the tools' gRPC services and messages, generated
+// from tools.proto; the engine generates its side from the same file
+package toolspb
+
+//go:generate protoc -I. --go_out=paths=source_relative:. --go-grpc_out=paths=source_relative:. tools.proto
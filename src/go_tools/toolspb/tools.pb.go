@@ -0,0 +1,1611 @@
+// The tools as gRPC services, for the engine and build pipelines to call
+// instead of running the CLIs and parsing their output. Levels and replays
+// travel as the JSON files the game reads and writes.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.28.3
+// source: tools.proto
+
+package toolspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GenerateRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// config_patch is a partial JSON config applied over the server's, as
+	// generate -patch applies one
+	ConfigPatch   []byte            `protobuf:"bytes,1,opt,name=config_patch,json=configPatch,proto3" json:"config_patch,omitempty"`
+	Prefix        string            `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix,omitempty"`                                                                               // level names are PREFIX_level_N; empty is "level"
+	Count         int32             `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`                                                                                // 0 is 1
+	Seed          int64             `protobuf:"varint,4,opt,name=seed,proto3" json:"seed,omitempty"`                                                                                  // 0 keeps the config's seed
+	Metadata      map[string]string `protobuf:"bytes,5,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // added to every level
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GenerateRequest) Reset() {
+	*x = GenerateRequest{}
+	mi := &file_tools_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GenerateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GenerateRequest) ProtoMessage() {}
+
+func (x *GenerateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GenerateRequest.ProtoReflect.Descriptor instead.
+func (*GenerateRequest) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GenerateRequest) GetConfigPatch() []byte {
+	if x != nil {
+		return x.ConfigPatch
+	}
+	return nil
+}
+
+func (x *GenerateRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *GenerateRequest) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *GenerateRequest) GetSeed() int64 {
+	if x != nil {
+		return x.Seed
+	}
+	return 0
+}
+
+func (x *GenerateRequest) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type GeneratedLevel struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Level          []byte                 `protobuf:"bytes,1,opt,name=level,proto3" json:"level,omitempty"` // the level file
+	Stats          *LevelStats            `protobuf:"bytes,2,opt,name=stats,proto3" json:"stats,omitempty"`
+	DurationMs     int64                  `protobuf:"varint,3,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	Fallback       bool                   `protobuf:"varint,4,opt,name=fallback,proto3" json:"fallback,omitempty"` // the time budget ran out before every candidate was complete
+	FallbackReason string                 `protobuf:"bytes,5,opt,name=fallback_reason,json=fallbackReason,proto3" json:"fallback_reason,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *GeneratedLevel) Reset() {
+	*x = GeneratedLevel{}
+	mi := &file_tools_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GeneratedLevel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GeneratedLevel) ProtoMessage() {}
+
+func (x *GeneratedLevel) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GeneratedLevel.ProtoReflect.Descriptor instead.
+func (*GeneratedLevel) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GeneratedLevel) GetLevel() []byte {
+	if x != nil {
+		return x.Level
+	}
+	return nil
+}
+
+func (x *GeneratedLevel) GetStats() *LevelStats {
+	if x != nil {
+		return x.Stats
+	}
+	return nil
+}
+
+func (x *GeneratedLevel) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *GeneratedLevel) GetFallback() bool {
+	if x != nil {
+		return x.Fallback
+	}
+	return false
+}
+
+func (x *GeneratedLevel) GetFallbackReason() string {
+	if x != nil {
+		return x.FallbackReason
+	}
+	return ""
+}
+
+type LevelStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Mode          string                 `protobuf:"bytes,2,opt,name=mode,proto3" json:"mode,omitempty"`
+	Blocks        int32                  `protobuf:"varint,3,opt,name=blocks,proto3" json:"blocks,omitempty"`
+	SpecialBlocks int32                  `protobuf:"varint,4,opt,name=special_blocks,json=specialBlocks,proto3" json:"special_blocks,omitempty"`
+	Pickups       int32                  `protobuf:"varint,5,opt,name=pickups,proto3" json:"pickups,omitempty"`
+	Density       float64                `protobuf:"fixed64,6,opt,name=density,proto3" json:"density,omitempty"`
+	MaxHeight     int32                  `protobuf:"varint,7,opt,name=max_height,json=maxHeight,proto3" json:"max_height,omitempty"`
+	Holes         int32                  `protobuf:"varint,8,opt,name=holes,proto3" json:"holes,omitempty"`
+	Difficulty    float64                `protobuf:"fixed64,9,opt,name=difficulty,proto3" json:"difficulty,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LevelStats) Reset() {
+	*x = LevelStats{}
+	mi := &file_tools_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LevelStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LevelStats) ProtoMessage() {}
+
+func (x *LevelStats) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LevelStats.ProtoReflect.Descriptor instead.
+func (*LevelStats) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *LevelStats) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *LevelStats) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *LevelStats) GetBlocks() int32 {
+	if x != nil {
+		return x.Blocks
+	}
+	return 0
+}
+
+func (x *LevelStats) GetSpecialBlocks() int32 {
+	if x != nil {
+		return x.SpecialBlocks
+	}
+	return 0
+}
+
+func (x *LevelStats) GetPickups() int32 {
+	if x != nil {
+		return x.Pickups
+	}
+	return 0
+}
+
+func (x *LevelStats) GetDensity() float64 {
+	if x != nil {
+		return x.Density
+	}
+	return 0
+}
+
+func (x *LevelStats) GetMaxHeight() int32 {
+	if x != nil {
+		return x.MaxHeight
+	}
+	return 0
+}
+
+func (x *LevelStats) GetHoles() int32 {
+	if x != nil {
+		return x.Holes
+	}
+	return 0
+}
+
+func (x *LevelStats) GetDifficulty() float64 {
+	if x != nil {
+		return x.Difficulty
+	}
+	return 0
+}
+
+type GridSize struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Width         int32                  `protobuf:"varint,1,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GridSize) Reset() {
+	*x = GridSize{}
+	mi := &file_tools_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GridSize) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GridSize) ProtoMessage() {}
+
+func (x *GridSize) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GridSize.ProtoReflect.Descriptor instead.
+func (*GridSize) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GridSize) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *GridSize) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+type AnalyzeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Levels        [][]byte               `protobuf:"bytes,1,rep,name=levels,proto3" json:"levels,omitempty"`
+	Replays       [][]byte               `protobuf:"bytes,2,rep,name=replays,proto3" json:"replays,omitempty"`
+	Tables        []string               `protobuf:"bytes,3,rep,name=tables,proto3" json:"tables,omitempty"`     // names of the tables wanted, empty for all
+	Fallback      *GridSize              `protobuf:"bytes,4,opt,name=fallback,proto3" json:"fallback,omitempty"` // board of replays of levels not sent; unset is the config's
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnalyzeRequest) Reset() {
+	*x = AnalyzeRequest{}
+	mi := &file_tools_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnalyzeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnalyzeRequest) ProtoMessage() {}
+
+func (x *AnalyzeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnalyzeRequest.ProtoReflect.Descriptor instead.
+func (*AnalyzeRequest) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AnalyzeRequest) GetLevels() [][]byte {
+	if x != nil {
+		return x.Levels
+	}
+	return nil
+}
+
+func (x *AnalyzeRequest) GetReplays() [][]byte {
+	if x != nil {
+		return x.Replays
+	}
+	return nil
+}
+
+func (x *AnalyzeRequest) GetTables() []string {
+	if x != nil {
+		return x.Tables
+	}
+	return nil
+}
+
+func (x *AnalyzeRequest) GetFallback() *GridSize {
+	if x != nil {
+		return x.Fallback
+	}
+	return nil
+}
+
+type AnalyzeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tables        []*Table               `protobuf:"bytes,1,rep,name=tables,proto3" json:"tables,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnalyzeResponse) Reset() {
+	*x = AnalyzeResponse{}
+	mi := &file_tools_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnalyzeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnalyzeResponse) ProtoMessage() {}
+
+func (x *AnalyzeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnalyzeResponse.ProtoReflect.Descriptor instead.
+func (*AnalyzeResponse) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *AnalyzeResponse) GetTables() []*Table {
+	if x != nil {
+		return x.Tables
+	}
+	return nil
+}
+
+type Table struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Columns       []*Column              `protobuf:"bytes,2,rep,name=columns,proto3" json:"columns,omitempty"`
+	Rows          []*Row                 `protobuf:"bytes,3,rep,name=rows,proto3" json:"rows,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Table) Reset() {
+	*x = Table{}
+	mi := &file_tools_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Table) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Table) ProtoMessage() {}
+
+func (x *Table) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Table.ProtoReflect.Descriptor instead.
+func (*Table) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Table) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Table) GetColumns() []*Column {
+	if x != nil {
+		return x.Columns
+	}
+	return nil
+}
+
+func (x *Table) GetRows() []*Row {
+	if x != nil {
+		return x.Rows
+	}
+	return nil
+}
+
+type Column struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Kind          string                 `protobuf:"bytes,2,opt,name=kind,proto3" json:"kind,omitempty"` // string, int, float or bool
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Column) Reset() {
+	*x = Column{}
+	mi := &file_tools_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Column) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Column) ProtoMessage() {}
+
+func (x *Column) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Column.ProtoReflect.Descriptor instead.
+func (*Column) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Column) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Column) GetKind() string {
+	if x != nil {
+		return x.Kind
+	}
+	return ""
+}
+
+type Row struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        []*Value               `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"` // one per column
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Row) Reset() {
+	*x = Row{}
+	mi := &file_tools_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Row) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Row) ProtoMessage() {}
+
+func (x *Row) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Row.ProtoReflect.Descriptor instead.
+func (*Row) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Row) GetValues() []*Value {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+type Value struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Kind:
+	//
+	//	*Value_StringValue
+	//	*Value_IntValue
+	//	*Value_FloatValue
+	//	*Value_BoolValue
+	Kind          isValue_Kind `protobuf_oneof:"kind"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Value) Reset() {
+	*x = Value{}
+	mi := &file_tools_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Value) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Value) ProtoMessage() {}
+
+func (x *Value) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Value.ProtoReflect.Descriptor instead.
+func (*Value) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Value) GetKind() isValue_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return nil
+}
+
+func (x *Value) GetStringValue() string {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_StringValue); ok {
+			return x.StringValue
+		}
+	}
+	return ""
+}
+
+func (x *Value) GetIntValue() int64 {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_IntValue); ok {
+			return x.IntValue
+		}
+	}
+	return 0
+}
+
+func (x *Value) GetFloatValue() float64 {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_FloatValue); ok {
+			return x.FloatValue
+		}
+	}
+	return 0
+}
+
+func (x *Value) GetBoolValue() bool {
+	if x != nil {
+		if x, ok := x.Kind.(*Value_BoolValue); ok {
+			return x.BoolValue
+		}
+	}
+	return false
+}
+
+type isValue_Kind interface {
+	isValue_Kind()
+}
+
+type Value_StringValue struct {
+	StringValue string `protobuf:"bytes,1,opt,name=string_value,json=stringValue,proto3,oneof"`
+}
+
+type Value_IntValue struct {
+	IntValue int64 `protobuf:"varint,2,opt,name=int_value,json=intValue,proto3,oneof"`
+}
+
+type Value_FloatValue struct {
+	FloatValue float64 `protobuf:"fixed64,3,opt,name=float_value,json=floatValue,proto3,oneof"`
+}
+
+type Value_BoolValue struct {
+	BoolValue bool `protobuf:"varint,4,opt,name=bool_value,json=boolValue,proto3,oneof"`
+}
+
+func (*Value_StringValue) isValue_Kind() {}
+
+func (*Value_IntValue) isValue_Kind() {}
+
+func (*Value_FloatValue) isValue_Kind() {}
+
+func (*Value_BoolValue) isValue_Kind() {}
+
+type SolveRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Level         []byte                 `protobuf:"bytes,1,opt,name=level,proto3" json:"level,omitempty"`
+	MaxPieces     int32                  `protobuf:"varint,2,opt,name=max_pieces,json=maxPieces,proto3" json:"max_pieces,omitempty"` // 0 is the solver's default
+	MaxNodes      int32                  `protobuf:"varint,3,opt,name=max_nodes,json=maxNodes,proto3" json:"max_nodes,omitempty"`    // 0 is the solver's default
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SolveRequest) Reset() {
+	*x = SolveRequest{}
+	mi := &file_tools_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SolveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SolveRequest) ProtoMessage() {}
+
+func (x *SolveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SolveRequest.ProtoReflect.Descriptor instead.
+func (*SolveRequest) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SolveRequest) GetLevel() []byte {
+	if x != nil {
+		return x.Level
+	}
+	return nil
+}
+
+func (x *SolveRequest) GetMaxPieces() int32 {
+	if x != nil {
+		return x.MaxPieces
+	}
+	return 0
+}
+
+func (x *SolveRequest) GetMaxNodes() int32 {
+	if x != nil {
+		return x.MaxNodes
+	}
+	return 0
+}
+
+type Solvability struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Level         string                 `protobuf:"bytes,1,opt,name=level,proto3" json:"level,omitempty"`
+	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"` // solvable, impossible or unknown
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	Witness       []*Placement           `protobuf:"bytes,4,rep,name=witness,proto3" json:"witness,omitempty"`
+	Nodes         int32                  `protobuf:"varint,5,opt,name=nodes,proto3" json:"nodes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Solvability) Reset() {
+	*x = Solvability{}
+	mi := &file_tools_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Solvability) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Solvability) ProtoMessage() {}
+
+func (x *Solvability) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Solvability.ProtoReflect.Descriptor instead.
+func (*Solvability) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Solvability) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
+func (x *Solvability) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Solvability) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Solvability) GetWitness() []*Placement {
+	if x != nil {
+		return x.Witness
+	}
+	return nil
+}
+
+func (x *Solvability) GetNodes() int32 {
+	if x != nil {
+		return x.Nodes
+	}
+	return 0
+}
+
+type Placement struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Piece         string                 `protobuf:"bytes,1,opt,name=piece,proto3" json:"piece,omitempty"`
+	X             int32                  `protobuf:"varint,2,opt,name=x,proto3" json:"x,omitempty"`
+	Y             int32                  `protobuf:"varint,3,opt,name=y,proto3" json:"y,omitempty"`
+	Rotation      int32                  `protobuf:"varint,4,opt,name=rotation,proto3" json:"rotation,omitempty"`
+	Lines         int32                  `protobuf:"varint,5,opt,name=lines,proto3" json:"lines,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Placement) Reset() {
+	*x = Placement{}
+	mi := &file_tools_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Placement) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Placement) ProtoMessage() {}
+
+func (x *Placement) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Placement.ProtoReflect.Descriptor instead.
+func (*Placement) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Placement) GetPiece() string {
+	if x != nil {
+		return x.Piece
+	}
+	return ""
+}
+
+func (x *Placement) GetX() int32 {
+	if x != nil {
+		return x.X
+	}
+	return 0
+}
+
+func (x *Placement) GetY() int32 {
+	if x != nil {
+		return x.Y
+	}
+	return 0
+}
+
+func (x *Placement) GetRotation() int32 {
+	if x != nil {
+		return x.Rotation
+	}
+	return 0
+}
+
+func (x *Placement) GetLines() int32 {
+	if x != nil {
+		return x.Lines
+	}
+	return 0
+}
+
+type SimulateClearsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Level         []byte                 `protobuf:"bytes,1,opt,name=level,proto3" json:"level,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SimulateClearsRequest) Reset() {
+	*x = SimulateClearsRequest{}
+	mi := &file_tools_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SimulateClearsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SimulateClearsRequest) ProtoMessage() {}
+
+func (x *SimulateClearsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SimulateClearsRequest.ProtoReflect.Descriptor instead.
+func (*SimulateClearsRequest) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *SimulateClearsRequest) GetLevel() []byte {
+	if x != nil {
+		return x.Level
+	}
+	return nil
+}
+
+type ClearSimulation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pieces        int32                  `protobuf:"varint,1,opt,name=pieces,proto3" json:"pieces,omitempty"`
+	Lines         int32                  `protobuf:"varint,2,opt,name=lines,proto3" json:"lines,omitempty"`
+	ToppedOut     bool                   `protobuf:"varint,3,opt,name=topped_out,json=toppedOut,proto3" json:"topped_out,omitempty"`
+	Rate          float64                `protobuf:"fixed64,4,opt,name=rate,proto3" json:"rate,omitempty"` // lines per piece relative to perfect play
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClearSimulation) Reset() {
+	*x = ClearSimulation{}
+	mi := &file_tools_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClearSimulation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClearSimulation) ProtoMessage() {}
+
+func (x *ClearSimulation) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClearSimulation.ProtoReflect.Descriptor instead.
+func (*ClearSimulation) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ClearSimulation) GetPieces() int32 {
+	if x != nil {
+		return x.Pieces
+	}
+	return 0
+}
+
+func (x *ClearSimulation) GetLines() int32 {
+	if x != nil {
+		return x.Lines
+	}
+	return 0
+}
+
+func (x *ClearSimulation) GetToppedOut() bool {
+	if x != nil {
+		return x.ToppedOut
+	}
+	return false
+}
+
+func (x *ClearSimulation) GetRate() float64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+type SimulateReplayRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Replay        []byte                 `protobuf:"bytes,1,opt,name=replay,proto3" json:"replay,omitempty"`
+	Level         []byte                 `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`       // the replay's level; unset starts from an empty board
+	Fallback      *GridSize              `protobuf:"bytes,3,opt,name=fallback,proto3" json:"fallback,omitempty"` // that empty board; unset is the config's
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SimulateReplayRequest) Reset() {
+	*x = SimulateReplayRequest{}
+	mi := &file_tools_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SimulateReplayRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SimulateReplayRequest) ProtoMessage() {}
+
+func (x *SimulateReplayRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SimulateReplayRequest.ProtoReflect.Descriptor instead.
+func (*SimulateReplayRequest) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *SimulateReplayRequest) GetReplay() []byte {
+	if x != nil {
+		return x.Replay
+	}
+	return nil
+}
+
+func (x *SimulateReplayRequest) GetLevel() []byte {
+	if x != nil {
+		return x.Level
+	}
+	return nil
+}
+
+func (x *SimulateReplayRequest) GetFallback() *GridSize {
+	if x != nil {
+		return x.Fallback
+	}
+	return nil
+}
+
+type LockedBoard struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Event         int32                  `protobuf:"varint,1,opt,name=event,proto3" json:"event,omitempty"` // index of the lock among the replay's events
+	Frame         int64                  `protobuf:"varint,2,opt,name=frame,proto3" json:"frame,omitempty"`
+	Player        string                 `protobuf:"bytes,3,opt,name=player,proto3" json:"player,omitempty"`
+	Board         *BoardComplexity       `protobuf:"bytes,4,opt,name=board,proto3" json:"board,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LockedBoard) Reset() {
+	*x = LockedBoard{}
+	mi := &file_tools_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LockedBoard) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LockedBoard) ProtoMessage() {}
+
+func (x *LockedBoard) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LockedBoard.ProtoReflect.Descriptor instead.
+func (*LockedBoard) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *LockedBoard) GetEvent() int32 {
+	if x != nil {
+		return x.Event
+	}
+	return 0
+}
+
+func (x *LockedBoard) GetFrame() int64 {
+	if x != nil {
+		return x.Frame
+	}
+	return 0
+}
+
+func (x *LockedBoard) GetPlayer() string {
+	if x != nil {
+		return x.Player
+	}
+	return ""
+}
+
+func (x *LockedBoard) GetBoard() *BoardComplexity {
+	if x != nil {
+		return x.Board
+	}
+	return nil
+}
+
+type BoardComplexity struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	MaxHeight         float64                `protobuf:"fixed64,1,opt,name=max_height,json=maxHeight,proto3" json:"max_height,omitempty"`
+	Roughness         float64                `protobuf:"fixed64,2,opt,name=roughness,proto3" json:"roughness,omitempty"`
+	Holes             int32                  `protobuf:"varint,3,opt,name=holes,proto3" json:"holes,omitempty"`
+	DependencyDepth   int32                  `protobuf:"varint,4,opt,name=dependency_depth,json=dependencyDepth,proto3" json:"dependency_depth,omitempty"`
+	RowTransitions    int32                  `protobuf:"varint,5,opt,name=row_transitions,json=rowTransitions,proto3" json:"row_transitions,omitempty"`
+	ColumnTransitions int32                  `protobuf:"varint,6,opt,name=column_transitions,json=columnTransitions,proto3" json:"column_transitions,omitempty"`
+	Entropy           float64                `protobuf:"fixed64,7,opt,name=entropy,proto3" json:"entropy,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *BoardComplexity) Reset() {
+	*x = BoardComplexity{}
+	mi := &file_tools_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BoardComplexity) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BoardComplexity) ProtoMessage() {}
+
+func (x *BoardComplexity) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BoardComplexity.ProtoReflect.Descriptor instead.
+func (*BoardComplexity) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *BoardComplexity) GetMaxHeight() float64 {
+	if x != nil {
+		return x.MaxHeight
+	}
+	return 0
+}
+
+func (x *BoardComplexity) GetRoughness() float64 {
+	if x != nil {
+		return x.Roughness
+	}
+	return 0
+}
+
+func (x *BoardComplexity) GetHoles() int32 {
+	if x != nil {
+		return x.Holes
+	}
+	return 0
+}
+
+func (x *BoardComplexity) GetDependencyDepth() int32 {
+	if x != nil {
+		return x.DependencyDepth
+	}
+	return 0
+}
+
+func (x *BoardComplexity) GetRowTransitions() int32 {
+	if x != nil {
+		return x.RowTransitions
+	}
+	return 0
+}
+
+func (x *BoardComplexity) GetColumnTransitions() int32 {
+	if x != nil {
+		return x.ColumnTransitions
+	}
+	return 0
+}
+
+func (x *BoardComplexity) GetEntropy() float64 {
+	if x != nil {
+		return x.Entropy
+	}
+	return 0
+}
+
+type StepReplayRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Replay        []byte                 `protobuf:"bytes,1,opt,name=replay,proto3" json:"replay,omitempty"`
+	Level         []byte                 `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`                           // the replay's level
+	WithState     bool                   `protobuf:"varint,3,opt,name=with_state,json=withState,proto3" json:"with_state,omitempty"` // send each frame's state, not only its checksum
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StepReplayRequest) Reset() {
+	*x = StepReplayRequest{}
+	mi := &file_tools_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StepReplayRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StepReplayRequest) ProtoMessage() {}
+
+func (x *StepReplayRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StepReplayRequest.ProtoReflect.Descriptor instead.
+func (*StepReplayRequest) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *StepReplayRequest) GetReplay() []byte {
+	if x != nil {
+		return x.Replay
+	}
+	return nil
+}
+
+func (x *StepReplayRequest) GetLevel() []byte {
+	if x != nil {
+		return x.Level
+	}
+	return nil
+}
+
+func (x *StepReplayRequest) GetWithState() bool {
+	if x != nil {
+		return x.WithState
+	}
+	return false
+}
+
+type FrameState struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Frame    int64                  `protobuf:"varint,1,opt,name=frame,proto3" json:"frame,omitempty"`       // frames played
+	Checksum uint32                 `protobuf:"varint,2,opt,name=checksum,proto3" json:"checksum,omitempty"` // of the state, as replays record them
+	// state is the game's state as JSON, shaped like a simulator snapshot
+	// without what the game recorded: the rules, then each player's board,
+	// piece, hold, preview, counters, garbage and tallies
+	State         []byte `protobuf:"bytes,3,opt,name=state,proto3" json:"state,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FrameState) Reset() {
+	*x = FrameState{}
+	mi := &file_tools_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FrameState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FrameState) ProtoMessage() {}
+
+func (x *FrameState) ProtoReflect() protoreflect.Message {
+	mi := &file_tools_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FrameState.ProtoReflect.Descriptor instead.
+func (*FrameState) Descriptor() ([]byte, []int) {
+	return file_tools_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *FrameState) GetFrame() int64 {
+	if x != nil {
+		return x.Frame
+	}
+	return 0
+}
+
+func (x *FrameState) GetChecksum() uint32 {
+	if x != nil {
+		return x.Checksum
+	}
+	return 0
+}
+
+func (x *FrameState) GetState() []byte {
+	if x != nil {
+		return x.State
+	}
+	return nil
+}
+
+var File_tools_proto protoreflect.FileDescriptor
+
+const file_tools_proto_rawDesc = "" +
+	"\n" +
+	"\vtools.proto\x12\x14supertetris.tools.v1\"\x84\x02\n" +
+	"\x0fGenerateRequest\x12!\n" +
+	"\fconfig_patch\x18\x01 \x01(\fR\vconfigPatch\x12\x16\n" +
+	"\x06prefix\x18\x02 \x01(\tR\x06prefix\x12\x14\n" +
+	"\x05count\x18\x03 \x01(\x05R\x05count\x12\x12\n" +
+	"\x04seed\x18\x04 \x01(\x03R\x04seed\x12O\n" +
+	"\bmetadata\x18\x05 \x03(\v23.supertetris.tools.v1.GenerateRequest.MetadataEntryR\bmetadata\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xc4\x01\n" +
+	"\x0eGeneratedLevel\x12\x14\n" +
+	"\x05level\x18\x01 \x01(\fR\x05level\x126\n" +
+	"\x05stats\x18\x02 \x01(\v2 .supertetris.tools.v1.LevelStatsR\x05stats\x12\x1f\n" +
+	"\vduration_ms\x18\x03 \x01(\x03R\n" +
+	"durationMs\x12\x1a\n" +
+	"\bfallback\x18\x04 \x01(\bR\bfallback\x12'\n" +
+	"\x0ffallback_reason\x18\x05 \x01(\tR\x0efallbackReason\"\xfc\x01\n" +
+	"\n" +
+	"LevelStats\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04mode\x18\x02 \x01(\tR\x04mode\x12\x16\n" +
+	"\x06blocks\x18\x03 \x01(\x05R\x06blocks\x12%\n" +
+	"\x0especial_blocks\x18\x04 \x01(\x05R\rspecialBlocks\x12\x18\n" +
+	"\apickups\x18\x05 \x01(\x05R\apickups\x12\x18\n" +
+	"\adensity\x18\x06 \x01(\x01R\adensity\x12\x1d\n" +
+	"\n" +
+	"max_height\x18\a \x01(\x05R\tmaxHeight\x12\x14\n" +
+	"\x05holes\x18\b \x01(\x05R\x05holes\x12\x1e\n" +
+	"\n" +
+	"difficulty\x18\t \x01(\x01R\n" +
+	"difficulty\"8\n" +
+	"\bGridSize\x12\x14\n" +
+	"\x05width\x18\x01 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x02 \x01(\x05R\x06height\"\x96\x01\n" +
+	"\x0eAnalyzeRequest\x12\x16\n" +
+	"\x06levels\x18\x01 \x03(\fR\x06levels\x12\x18\n" +
+	"\areplays\x18\x02 \x03(\fR\areplays\x12\x16\n" +
+	"\x06tables\x18\x03 \x03(\tR\x06tables\x12:\n" +
+	"\bfallback\x18\x04 \x01(\v2\x1e.supertetris.tools.v1.GridSizeR\bfallback\"F\n" +
+	"\x0fAnalyzeResponse\x123\n" +
+	"\x06tables\x18\x01 \x03(\v2\x1b.supertetris.tools.v1.TableR\x06tables\"\x82\x01\n" +
+	"\x05Table\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x126\n" +
+	"\acolumns\x18\x02 \x03(\v2\x1c.supertetris.tools.v1.ColumnR\acolumns\x12-\n" +
+	"\x04rows\x18\x03 \x03(\v2\x19.supertetris.tools.v1.RowR\x04rows\"0\n" +
+	"\x06Column\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04kind\x18\x02 \x01(\tR\x04kind\":\n" +
+	"\x03Row\x123\n" +
+	"\x06values\x18\x01 \x03(\v2\x1b.supertetris.tools.v1.ValueR\x06values\"\x97\x01\n" +
+	"\x05Value\x12#\n" +
+	"\fstring_value\x18\x01 \x01(\tH\x00R\vstringValue\x12\x1d\n" +
+	"\tint_value\x18\x02 \x01(\x03H\x00R\bintValue\x12!\n" +
+	"\vfloat_value\x18\x03 \x01(\x01H\x00R\n" +
+	"floatValue\x12\x1f\n" +
+	"\n" +
+	"bool_value\x18\x04 \x01(\bH\x00R\tboolValueB\x06\n" +
+	"\x04kind\"`\n" +
+	"\fSolveRequest\x12\x14\n" +
+	"\x05level\x18\x01 \x01(\fR\x05level\x12\x1d\n" +
+	"\n" +
+	"max_pieces\x18\x02 \x01(\x05R\tmaxPieces\x12\x1b\n" +
+	"\tmax_nodes\x18\x03 \x01(\x05R\bmaxNodes\"\xa4\x01\n" +
+	"\vSolvability\x12\x14\n" +
+	"\x05level\x18\x01 \x01(\tR\x05level\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x129\n" +
+	"\awitness\x18\x04 \x03(\v2\x1f.supertetris.tools.v1.PlacementR\awitness\x12\x14\n" +
+	"\x05nodes\x18\x05 \x01(\x05R\x05nodes\"o\n" +
+	"\tPlacement\x12\x14\n" +
+	"\x05piece\x18\x01 \x01(\tR\x05piece\x12\f\n" +
+	"\x01x\x18\x02 \x01(\x05R\x01x\x12\f\n" +
+	"\x01y\x18\x03 \x01(\x05R\x01y\x12\x1a\n" +
+	"\brotation\x18\x04 \x01(\x05R\brotation\x12\x14\n" +
+	"\x05lines\x18\x05 \x01(\x05R\x05lines\"-\n" +
+	"\x15SimulateClearsRequest\x12\x14\n" +
+	"\x05level\x18\x01 \x01(\fR\x05level\"r\n" +
+	"\x0fClearSimulation\x12\x16\n" +
+	"\x06pieces\x18\x01 \x01(\x05R\x06pieces\x12\x14\n" +
+	"\x05lines\x18\x02 \x01(\x05R\x05lines\x12\x1d\n" +
+	"\n" +
+	"topped_out\x18\x03 \x01(\bR\ttoppedOut\x12\x12\n" +
+	"\x04rate\x18\x04 \x01(\x01R\x04rate\"\x81\x01\n" +
+	"\x15SimulateReplayRequest\x12\x16\n" +
+	"\x06replay\x18\x01 \x01(\fR\x06replay\x12\x14\n" +
+	"\x05level\x18\x02 \x01(\fR\x05level\x12:\n" +
+	"\bfallback\x18\x03 \x01(\v2\x1e.supertetris.tools.v1.GridSizeR\bfallback\"\x8e\x01\n" +
+	"\vLockedBoard\x12\x14\n" +
+	"\x05event\x18\x01 \x01(\x05R\x05event\x12\x14\n" +
+	"\x05frame\x18\x02 \x01(\x03R\x05frame\x12\x16\n" +
+	"\x06player\x18\x03 \x01(\tR\x06player\x12;\n" +
+	"\x05board\x18\x04 \x01(\v2%.supertetris.tools.v1.BoardComplexityR\x05board\"\x81\x02\n" +
+	"\x0fBoardComplexity\x12\x1d\n" +
+	"\n" +
+	"max_height\x18\x01 \x01(\x01R\tmaxHeight\x12\x1c\n" +
+	"\troughness\x18\x02 \x01(\x01R\troughness\x12\x14\n" +
+	"\x05holes\x18\x03 \x01(\x05R\x05holes\x12)\n" +
+	"\x10dependency_depth\x18\x04 \x01(\x05R\x0fdependencyDepth\x12'\n" +
+	"\x0frow_transitions\x18\x05 \x01(\x05R\x0erowTransitions\x12-\n" +
+	"\x12column_transitions\x18\x06 \x01(\x05R\x11columnTransitions\x12\x18\n" +
+	"\aentropy\x18\a \x01(\x01R\aentropy\"`\n" +
+	"\x11StepReplayRequest\x12\x16\n" +
+	"\x06replay\x18\x01 \x01(\fR\x06replay\x12\x14\n" +
+	"\x05level\x18\x02 \x01(\fR\x05level\x12\x1d\n" +
+	"\n" +
+	"with_state\x18\x03 \x01(\bR\twithState\"T\n" +
+	"\n" +
+	"FrameState\x12\x14\n" +
+	"\x05frame\x18\x01 \x01(\x03R\x05frame\x12\x1a\n" +
+	"\bchecksum\x18\x02 \x01(\rR\bchecksum\x12\x14\n" +
+	"\x05state\x18\x03 \x01(\fR\x05state2f\n" +
+	"\tGenerator\x12Y\n" +
+	"\bGenerate\x12%.supertetris.tools.v1.GenerateRequest\x1a$.supertetris.tools.v1.GeneratedLevel0\x012b\n" +
+	"\bAnalyzer\x12V\n" +
+	"\aAnalyze\x12$.supertetris.tools.v1.AnalyzeRequest\x1a%.supertetris.tools.v1.AnalyzeResponse2\x80\x03\n" +
+	"\tSimulator\x12N\n" +
+	"\x05Solve\x12\".supertetris.tools.v1.SolveRequest\x1a!.supertetris.tools.v1.Solvability\x12d\n" +
+	"\x0eSimulateClears\x12+.supertetris.tools.v1.SimulateClearsRequest\x1a%.supertetris.tools.v1.ClearSimulation\x12b\n" +
+	"\x0eSimulateReplay\x12+.supertetris.tools.v1.SimulateReplayRequest\x1a!.supertetris.tools.v1.LockedBoard0\x01\x12Y\n" +
+	"\n" +
+	"StepReplay\x12'.supertetris.tools.v1.StepReplayRequest\x1a .supertetris.tools.v1.FrameState0\x01B=Z;github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/toolspbb\x06proto3"
+
+var (
+	file_tools_proto_rawDescOnce sync.Once
+	file_tools_proto_rawDescData []byte
+)
+
+func file_tools_proto_rawDescGZIP() []byte {
+	file_tools_proto_rawDescOnce.Do(func() {
+		file_tools_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_tools_proto_rawDesc), len(file_tools_proto_rawDesc)))
+	})
+	return file_tools_proto_rawDescData
+}
+
+var file_tools_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
+var file_tools_proto_goTypes = []any{
+	(*GenerateRequest)(nil),       // 0: supertetris.tools.v1.GenerateRequest
+	(*GeneratedLevel)(nil),        // 1: supertetris.tools.v1.GeneratedLevel
+	(*LevelStats)(nil),            // 2: supertetris.tools.v1.LevelStats
+	(*GridSize)(nil),              // 3: supertetris.tools.v1.GridSize
+	(*AnalyzeRequest)(nil),        // 4: supertetris.tools.v1.AnalyzeRequest
+	(*AnalyzeResponse)(nil),       // 5: supertetris.tools.v1.AnalyzeResponse
+	(*Table)(nil),                 // 6: supertetris.tools.v1.Table
+	(*Column)(nil),                // 7: supertetris.tools.v1.Column
+	(*Row)(nil),                   // 8: supertetris.tools.v1.Row
+	(*Value)(nil),                 // 9: supertetris.tools.v1.Value
+	(*SolveRequest)(nil),          // 10: supertetris.tools.v1.SolveRequest
+	(*Solvability)(nil),           // 11: supertetris.tools.v1.Solvability
+	(*Placement)(nil),             // 12: supertetris.tools.v1.Placement
+	(*SimulateClearsRequest)(nil), // 13: supertetris.tools.v1.SimulateClearsRequest
+	(*ClearSimulation)(nil),       // 14: supertetris.tools.v1.ClearSimulation
+	(*SimulateReplayRequest)(nil), // 15: supertetris.tools.v1.SimulateReplayRequest
+	(*LockedBoard)(nil),           // 16: supertetris.tools.v1.LockedBoard
+	(*BoardComplexity)(nil),       // 17: supertetris.tools.v1.BoardComplexity
+	(*StepReplayRequest)(nil),     // 18: supertetris.tools.v1.StepReplayRequest
+	(*FrameState)(nil),            // 19: supertetris.tools.v1.FrameState
+	nil,                           // 20: supertetris.tools.v1.GenerateRequest.MetadataEntry
+}
+var file_tools_proto_depIdxs = []int32{
+	20, // 0: supertetris.tools.v1.GenerateRequest.metadata:type_name -> supertetris.tools.v1.GenerateRequest.MetadataEntry
+	2,  // 1: supertetris.tools.v1.GeneratedLevel.stats:type_name -> supertetris.tools.v1.LevelStats
+	3,  // 2: supertetris.tools.v1.AnalyzeRequest.fallback:type_name -> supertetris.tools.v1.GridSize
+	6,  // 3: supertetris.tools.v1.AnalyzeResponse.tables:type_name -> supertetris.tools.v1.Table
+	7,  // 4: supertetris.tools.v1.Table.columns:type_name -> supertetris.tools.v1.Column
+	8,  // 5: supertetris.tools.v1.Table.rows:type_name -> supertetris.tools.v1.Row
+	9,  // 6: supertetris.tools.v1.Row.values:type_name -> supertetris.tools.v1.Value
+	12, // 7: supertetris.tools.v1.Solvability.witness:type_name -> supertetris.tools.v1.Placement
+	3,  // 8: supertetris.tools.v1.SimulateReplayRequest.fallback:type_name -> supertetris.tools.v1.GridSize
+	17, // 9: supertetris.tools.v1.LockedBoard.board:type_name -> supertetris.tools.v1.BoardComplexity
+	0,  // 10: supertetris.tools.v1.Generator.Generate:input_type -> supertetris.tools.v1.GenerateRequest
+	4,  // 11: supertetris.tools.v1.Analyzer.Analyze:input_type -> supertetris.tools.v1.AnalyzeRequest
+	10, // 12: supertetris.tools.v1.Simulator.Solve:input_type -> supertetris.tools.v1.SolveRequest
+	13, // 13: supertetris.tools.v1.Simulator.SimulateClears:input_type -> supertetris.tools.v1.SimulateClearsRequest
+	15, // 14: supertetris.tools.v1.Simulator.SimulateReplay:input_type -> supertetris.tools.v1.SimulateReplayRequest
+	18, // 15: supertetris.tools.v1.Simulator.StepReplay:input_type -> supertetris.tools.v1.StepReplayRequest
+	1,  // 16: supertetris.tools.v1.Generator.Generate:output_type -> supertetris.tools.v1.GeneratedLevel
+	5,  // 17: supertetris.tools.v1.Analyzer.Analyze:output_type -> supertetris.tools.v1.AnalyzeResponse
+	11, // 18: supertetris.tools.v1.Simulator.Solve:output_type -> supertetris.tools.v1.Solvability
+	14, // 19: supertetris.tools.v1.Simulator.SimulateClears:output_type -> supertetris.tools.v1.ClearSimulation
+	16, // 20: supertetris.tools.v1.Simulator.SimulateReplay:output_type -> supertetris.tools.v1.LockedBoard
+	19, // 21: supertetris.tools.v1.Simulator.StepReplay:output_type -> supertetris.tools.v1.FrameState
+	16, // [16:22] is the sub-list for method output_type
+	10, // [10:16] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_tools_proto_init() }
+func file_tools_proto_init() {
+	if File_tools_proto != nil {
+		return
+	}
+	file_tools_proto_msgTypes[9].OneofWrappers = []any{
+		(*Value_StringValue)(nil),
+		(*Value_IntValue)(nil),
+		(*Value_FloatValue)(nil),
+		(*Value_BoolValue)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tools_proto_rawDesc), len(file_tools_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   21,
+			NumExtensions: 0,
+			NumServices:   3,
+		},
+		GoTypes:           file_tools_proto_goTypes,
+		DependencyIndexes: file_tools_proto_depIdxs,
+		MessageInfos:      file_tools_proto_msgTypes,
+	}.Build()
+	File_tools_proto = out.File
+	file_tools_proto_goTypes = nil
+	file_tools_proto_depIdxs = nil
+}
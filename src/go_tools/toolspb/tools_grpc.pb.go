@@ -0,0 +1,481 @@
+// The tools as gRPC services, for the engine and build pipelines to call
+// instead of running the CLIs and parsing their output. Levels and replays
+// travel as the JSON files the game reads and writes.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: tools.proto
+
+package toolspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Generator_Generate_FullMethodName = "/supertetris.tools.v1.Generator/Generate"
+)
+
+// GeneratorClient is the client API for Generator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Generator builds levels, as generate does
+type GeneratorClient interface {
+	// Generate streams each level of a batch as it's built
+	Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GeneratedLevel], error)
+}
+
+type generatorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGeneratorClient(cc grpc.ClientConnInterface) GeneratorClient {
+	return &generatorClient{cc}
+}
+
+func (c *generatorClient) Generate(ctx context.Context, in *GenerateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GeneratedLevel], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Generator_ServiceDesc.Streams[0], Generator_Generate_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GenerateRequest, GeneratedLevel]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Generator_GenerateClient = grpc.ServerStreamingClient[GeneratedLevel]
+
+// GeneratorServer is the server API for Generator service.
+// All implementations must embed UnimplementedGeneratorServer
+// for forward compatibility.
+//
+// Generator builds levels, as generate does
+type GeneratorServer interface {
+	// Generate streams each level of a batch as it's built
+	Generate(*GenerateRequest, grpc.ServerStreamingServer[GeneratedLevel]) error
+	mustEmbedUnimplementedGeneratorServer()
+}
+
+// UnimplementedGeneratorServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGeneratorServer struct{}
+
+func (UnimplementedGeneratorServer) Generate(*GenerateRequest, grpc.ServerStreamingServer[GeneratedLevel]) error {
+	return status.Errorf(codes.Unimplemented, "method Generate not implemented")
+}
+func (UnimplementedGeneratorServer) mustEmbedUnimplementedGeneratorServer() {}
+func (UnimplementedGeneratorServer) testEmbeddedByValue()                   {}
+
+// UnsafeGeneratorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GeneratorServer will
+// result in compilation errors.
+type UnsafeGeneratorServer interface {
+	mustEmbedUnimplementedGeneratorServer()
+}
+
+func RegisterGeneratorServer(s grpc.ServiceRegistrar, srv GeneratorServer) {
+	// If the following call pancis, it indicates UnimplementedGeneratorServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Generator_ServiceDesc, srv)
+}
+
+func _Generator_Generate_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GenerateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GeneratorServer).Generate(m, &grpc.GenericServerStream[GenerateRequest, GeneratedLevel]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Generator_GenerateServer = grpc.ServerStreamingServer[GeneratedLevel]
+
+// Generator_ServiceDesc is the grpc.ServiceDesc for Generator service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Generator_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "supertetris.tools.v1.Generator",
+	HandlerType: (*GeneratorServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Generate",
+			Handler:       _Generator_Generate_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tools.proto",
+}
+
+const (
+	Analyzer_Analyze_FullMethodName = "/supertetris.tools.v1.Analyzer/Analyze"
+)
+
+// AnalyzerClient is the client API for Analyzer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Analyzer analyzes replays of levels, as analyze does
+type AnalyzerClient interface {
+	// Analyze returns the analysis tables of the levels and replays sent
+	Analyze(ctx context.Context, in *AnalyzeRequest, opts ...grpc.CallOption) (*AnalyzeResponse, error)
+}
+
+type analyzerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAnalyzerClient(cc grpc.ClientConnInterface) AnalyzerClient {
+	return &analyzerClient{cc}
+}
+
+func (c *analyzerClient) Analyze(ctx context.Context, in *AnalyzeRequest, opts ...grpc.CallOption) (*AnalyzeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AnalyzeResponse)
+	err := c.cc.Invoke(ctx, Analyzer_Analyze_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AnalyzerServer is the server API for Analyzer service.
+// All implementations must embed UnimplementedAnalyzerServer
+// for forward compatibility.
+//
+// Analyzer analyzes replays of levels, as analyze does
+type AnalyzerServer interface {
+	// Analyze returns the analysis tables of the levels and replays sent
+	Analyze(context.Context, *AnalyzeRequest) (*AnalyzeResponse, error)
+	mustEmbedUnimplementedAnalyzerServer()
+}
+
+// UnimplementedAnalyzerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAnalyzerServer struct{}
+
+func (UnimplementedAnalyzerServer) Analyze(context.Context, *AnalyzeRequest) (*AnalyzeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Analyze not implemented")
+}
+func (UnimplementedAnalyzerServer) mustEmbedUnimplementedAnalyzerServer() {}
+func (UnimplementedAnalyzerServer) testEmbeddedByValue()                  {}
+
+// UnsafeAnalyzerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AnalyzerServer will
+// result in compilation errors.
+type UnsafeAnalyzerServer interface {
+	mustEmbedUnimplementedAnalyzerServer()
+}
+
+func RegisterAnalyzerServer(s grpc.ServiceRegistrar, srv AnalyzerServer) {
+	// If the following call pancis, it indicates UnimplementedAnalyzerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Analyzer_ServiceDesc, srv)
+}
+
+func _Analyzer_Analyze_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnalyzeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AnalyzerServer).Analyze(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Analyzer_Analyze_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AnalyzerServer).Analyze(ctx, req.(*AnalyzeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Analyzer_ServiceDesc is the grpc.ServiceDesc for Analyzer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Analyzer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "supertetris.tools.v1.Analyzer",
+	HandlerType: (*AnalyzerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Analyze",
+			Handler:    _Analyzer_Analyze_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "tools.proto",
+}
+
+const (
+	Simulator_Solve_FullMethodName          = "/supertetris.tools.v1.Simulator/Solve"
+	Simulator_SimulateClears_FullMethodName = "/supertetris.tools.v1.Simulator/SimulateClears"
+	Simulator_SimulateReplay_FullMethodName = "/supertetris.tools.v1.Simulator/SimulateReplay"
+	Simulator_StepReplay_FullMethodName     = "/supertetris.tools.v1.Simulator/StepReplay"
+)
+
+// SimulatorClient is the client API for Simulator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Simulator plays levels and replays headlessly
+type SimulatorClient interface {
+	// Solve decides whether a single player can complete a level
+	Solve(ctx context.Context, in *SolveRequest, opts ...grpc.CallOption) (*Solvability, error)
+	// SimulateClears plays a level with the greedy bot difficulty scoring uses
+	SimulateClears(ctx context.Context, in *SimulateClearsRequest, opts ...grpc.CallOption) (*ClearSimulation, error)
+	// SimulateReplay steps a replay, streaming the board after each lock
+	SimulateReplay(ctx context.Context, in *SimulateReplayRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LockedBoard], error)
+	// StepReplay plays a replay again by the simulation's rules a frame at a
+	// time, streaming the game's state after each frame; two builds, or the
+	// tools and the engine, playing the same replay stream the same states
+	StepReplay(ctx context.Context, in *StepReplayRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FrameState], error)
+}
+
+type simulatorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSimulatorClient(cc grpc.ClientConnInterface) SimulatorClient {
+	return &simulatorClient{cc}
+}
+
+func (c *simulatorClient) Solve(ctx context.Context, in *SolveRequest, opts ...grpc.CallOption) (*Solvability, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Solvability)
+	err := c.cc.Invoke(ctx, Simulator_Solve_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simulatorClient) SimulateClears(ctx context.Context, in *SimulateClearsRequest, opts ...grpc.CallOption) (*ClearSimulation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ClearSimulation)
+	err := c.cc.Invoke(ctx, Simulator_SimulateClears_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *simulatorClient) SimulateReplay(ctx context.Context, in *SimulateReplayRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LockedBoard], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Simulator_ServiceDesc.Streams[0], Simulator_SimulateReplay_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SimulateReplayRequest, LockedBoard]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Simulator_SimulateReplayClient = grpc.ServerStreamingClient[LockedBoard]
+
+func (c *simulatorClient) StepReplay(ctx context.Context, in *StepReplayRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FrameState], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Simulator_ServiceDesc.Streams[1], Simulator_StepReplay_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StepReplayRequest, FrameState]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Simulator_StepReplayClient = grpc.ServerStreamingClient[FrameState]
+
+// SimulatorServer is the server API for Simulator service.
+// All implementations must embed UnimplementedSimulatorServer
+// for forward compatibility.
+//
+// Simulator plays levels and replays headlessly
+type SimulatorServer interface {
+	// Solve decides whether a single player can complete a level
+	Solve(context.Context, *SolveRequest) (*Solvability, error)
+	// SimulateClears plays a level with the greedy bot difficulty scoring uses
+	SimulateClears(context.Context, *SimulateClearsRequest) (*ClearSimulation, error)
+	// SimulateReplay steps a replay, streaming the board after each lock
+	SimulateReplay(*SimulateReplayRequest, grpc.ServerStreamingServer[LockedBoard]) error
+	// StepReplay plays a replay again by the simulation's rules a frame at a
+	// time, streaming the game's state after each frame; two builds, or the
+	// tools and the engine, playing the same replay stream the same states
+	StepReplay(*StepReplayRequest, grpc.ServerStreamingServer[FrameState]) error
+	mustEmbedUnimplementedSimulatorServer()
+}
+
+// UnimplementedSimulatorServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSimulatorServer struct{}
+
+func (UnimplementedSimulatorServer) Solve(context.Context, *SolveRequest) (*Solvability, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Solve not implemented")
+}
+func (UnimplementedSimulatorServer) SimulateClears(context.Context, *SimulateClearsRequest) (*ClearSimulation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SimulateClears not implemented")
+}
+func (UnimplementedSimulatorServer) SimulateReplay(*SimulateReplayRequest, grpc.ServerStreamingServer[LockedBoard]) error {
+	return status.Errorf(codes.Unimplemented, "method SimulateReplay not implemented")
+}
+func (UnimplementedSimulatorServer) StepReplay(*StepReplayRequest, grpc.ServerStreamingServer[FrameState]) error {
+	return status.Errorf(codes.Unimplemented, "method StepReplay not implemented")
+}
+func (UnimplementedSimulatorServer) mustEmbedUnimplementedSimulatorServer() {}
+func (UnimplementedSimulatorServer) testEmbeddedByValue()                   {}
+
+// UnsafeSimulatorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SimulatorServer will
+// result in compilation errors.
+type UnsafeSimulatorServer interface {
+	mustEmbedUnimplementedSimulatorServer()
+}
+
+func RegisterSimulatorServer(s grpc.ServiceRegistrar, srv SimulatorServer) {
+	// If the following call pancis, it indicates UnimplementedSimulatorServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Simulator_ServiceDesc, srv)
+}
+
+func _Simulator_Solve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SolveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimulatorServer).Solve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Simulator_Solve_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimulatorServer).Solve(ctx, req.(*SolveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Simulator_SimulateClears_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SimulateClearsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SimulatorServer).SimulateClears(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Simulator_SimulateClears_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SimulatorServer).SimulateClears(ctx, req.(*SimulateClearsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Simulator_SimulateReplay_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SimulateReplayRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SimulatorServer).SimulateReplay(m, &grpc.GenericServerStream[SimulateReplayRequest, LockedBoard]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Simulator_SimulateReplayServer = grpc.ServerStreamingServer[LockedBoard]
+
+func _Simulator_StepReplay_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StepReplayRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SimulatorServer).StepReplay(m, &grpc.GenericServerStream[StepReplayRequest, FrameState]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Simulator_StepReplayServer = grpc.ServerStreamingServer[FrameState]
+
+// Simulator_ServiceDesc is the grpc.ServiceDesc for Simulator service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Simulator_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "supertetris.tools.v1.Simulator",
+	HandlerType: (*SimulatorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Solve",
+			Handler:    _Simulator_Solve_Handler,
+		},
+		{
+			MethodName: "SimulateClears",
+			Handler:    _Simulator_SimulateClears_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SimulateReplay",
+			Handler:       _Simulator_SimulateReplay_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StepReplay",
+			Handler:       _Simulator_StepReplay_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tools.proto",
+}
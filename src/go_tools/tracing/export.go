@@ -0,0 +1,292 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans somewhere
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+}
+
+// Batching of finished spans
+const (
+	batchSize     = 256
+	maxQueue      = 4096 // spans beyond this are dropped until the next export
+	flushInterval = 5 * time.Second
+)
+
+// ErrorHandler reports export failures, which never stop the traced work
+var ErrorHandler = func(err error) {
+	slog.Warn("tracing: export failed", "error", err)
+}
+
+// processor batches finished spans for an exporter
+type processor struct {
+	exporter Exporter
+	mu       sync.Mutex
+	queue    []SpanData
+	dropped  int
+	kick     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var (
+	currentMu sync.RWMutex
+	active    *processor
+)
+
+func current() *processor {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+	return active
+}
+
+// SetExporter turns tracing on, exporting spans to e in batches, and
+// returns the function that flushes what is queued and turns it off again
+func SetExporter(e Exporter) (shutdown func(context.Context) error) {
+	p := &processor{exporter: e, kick: make(chan struct{}, 1), stop: make(chan struct{}), done: make(chan struct{})}
+	go p.run()
+	currentMu.Lock()
+	previous := active
+	active = p
+	currentMu.Unlock()
+	if previous != nil {
+		previous.shutdown(context.Background())
+	}
+	return func(ctx context.Context) error {
+		currentMu.Lock()
+		if active == p {
+			active = nil
+		}
+		currentMu.Unlock()
+		return p.shutdown(ctx)
+	}
+}
+
+func (p *processor) add(s SpanData) {
+	p.mu.Lock()
+	if len(p.queue) >= maxQueue {
+		p.dropped++
+	} else {
+		p.queue = append(p.queue, s)
+	}
+	full := len(p.queue) >= batchSize
+	p.mu.Unlock()
+	if full {
+		select {
+		case p.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (p *processor) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		case <-p.kick:
+		}
+		if err := p.flush(context.Background()); err != nil {
+			ErrorHandler(err)
+		}
+	}
+}
+
+// flush exports everything queued
+func (p *processor) flush(ctx context.Context) error {
+	p.mu.Lock()
+	spans, dropped := p.queue, p.dropped
+	p.queue, p.dropped = nil, 0
+	p.mu.Unlock()
+	if dropped > 0 {
+		ErrorHandler(fmt.Errorf("dropped %d spans with the export queue full", dropped))
+	}
+	for len(spans) > 0 {
+		n := min(len(spans), batchSize)
+		if err := p.exporter.ExportSpans(ctx, spans[:n]); err != nil {
+			return err
+		}
+		spans = spans[n:]
+	}
+	return nil
+}
+
+func (p *processor) shutdown(ctx context.Context) error {
+	select {
+	case <-p.stop:
+		return nil
+	default:
+	}
+	close(p.stop)
+	<-p.done
+	return p.flush(ctx)
+}
+
+// Setup exports spans to the OTLP/HTTP collector at endpoint, such as
+// http://localhost:4318, as service, and to any other exporters given. An
+// empty endpoint falls back to OTEL_EXPORTER_OTLP_ENDPOINT and, without
+// that or other exporters, leaves tracing off; the shutdown returned is
+// then a no-op.
+func Setup(endpoint, service string, also ...Exporter) (shutdown func(context.Context) error) {
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	exporters := also
+	if endpoint != "" {
+		exporters = append([]Exporter{NewOTLPExporter(endpoint, service)}, also...)
+	}
+	switch len(exporters) {
+	case 0:
+		return func(context.Context) error { return nil }
+	case 1:
+		return SetExporter(exporters[0])
+	}
+	return SetExporter(Tee(exporters...))
+}
+
+// Tee exports every batch to each of exporters, returning the first
+// failure once all have had it
+func Tee(exporters ...Exporter) Exporter {
+	return tee(exporters)
+}
+
+type tee []Exporter
+
+func (t tee) ExportSpans(ctx context.Context, spans []SpanData) error {
+	var first error
+	for _, e := range t {
+		if err := e.ExportSpans(ctx, spans); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// OTLPExporter posts spans to an OpenTelemetry collector using OTLP's
+// HTTP transport with JSON encoding
+type OTLPExporter struct {
+	URL     string // the collector's traces endpoint
+	Service string // service.name of the spans' resource
+	Client  *http.Client
+}
+
+// NewOTLPExporter exports to the collector at endpoint, appending
+// /v1/traces unless the endpoint already names it
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &OTLPExporter{URL: url, Service: service, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// ExportSpans posts one export request
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(otlpRequest(e.Service, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("export to %s: %w", e.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("export to %s: %s: %s", e.URL, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// otlp* mirror the protobuf JSON mapping of OTLP's trace service request;
+// IDs are hex and nanosecond timestamps strings, as the spec asks
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            map[string]any `json:"status,omitempty"`
+}
+
+func otlpRequest(service string, spans []SpanData) map[string]any {
+	out := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		o := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if s.Parent.IsValid() {
+			o.ParentSpanID = s.Parent.String()
+		}
+		for _, a := range s.Attrs {
+			o.Attributes = append(o.Attributes, otlpAttr(a))
+		}
+		if s.Err != "" {
+			o.Status = map[string]any{"code": 2, "message": s.Err} // STATUS_CODE_ERROR
+		}
+		out[i] = o
+	}
+	return map[string]any{"resourceSpans": []any{map[string]any{
+		"resource": map[string]any{"attributes": []otlpKeyValue{otlpAttr(String("service.name", service))}},
+		"scopeSpans": []any{map[string]any{
+			"scope": map[string]any{"name": "github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/tracing"},
+			"spans": out,
+		}},
+	}}}
+}
+
+func otlpAttr(a Attr) otlpKeyValue {
+	var v map[string]any
+	switch x := a.Value.(type) {
+	case string:
+		v = map[string]any{"stringValue": x}
+	case bool:
+		v = map[string]any{"boolValue": x}
+	case int:
+		v = map[string]any{"intValue": strconv.Itoa(x)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+	case float64:
+		v = map[string]any{"doubleValue": x}
+	default:
+		v = map[string]any{"stringValue": fmt.Sprint(x)}
+	}
+	return otlpKeyValue{Key: a.Key, Value: v}
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader carries a span's context between processes, per W3C
+// Trace Context
+const TraceparentHeader = "traceparent"
+
+// Traceparent formats the span ctx carries as a traceparent value, empty
+// without one
+func Traceparent(ctx context.Context) string {
+	sc, ok := SpanContextFrom(ctx)
+	if !ok {
+		return ""
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-01"
+}
+
+// ParseTraceparent reads a traceparent value
+func ParseTraceparent(v string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	return sc, sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Inject sets the traceparent header of an outgoing request
+func Inject(ctx context.Context, h http.Header) {
+	if v := Traceparent(ctx); v != "" {
+		h.Set(TraceparentHeader, v)
+	}
+}
+
+// Extract returns ctx carrying the parent an incoming request names
+func Extract(ctx context.Context, h http.Header) context.Context {
+	if sc, ok := ParseTraceparent(h.Get(TraceparentHeader)); ok {
+		return contextWithRemote(ctx, sc)
+	}
+	return ctx
+}
+
+// Middleware wraps each request to next in a server span, continuing the
+// caller's trace when the request carries one
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := StartKind(Extract(r.Context(), r.Header), r.Method+" "+r.URL.Path, KindServer,
+			String("http.request.method", r.Method),
+			String("url.path", r.URL.Path))
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		span.SetAttrs(Int("http.response.status_code", rec.status))
+		if rec.status >= 500 {
+			span.SetError(errStatus(rec.status))
+		}
+	})
+}
+
+type errStatus int
+
+func (e errStatus) Error() string { return http.StatusText(int(e)) }
+
+// statusRecorder remembers the status a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack hands over the connection, for WebSocket upgrades
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("tracing: response can't be hijacked")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hj.Hijack()
+}
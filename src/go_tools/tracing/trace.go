@@ -0,0 +1,192 @@
+// Package tracing records OpenTelemetry-style spans across the tools, so a
+// generate, validate and publish pipeline or an API request can be followed
+// end to end, and exports them to an OTLP collector. Tracing is off until
+// Setup or SetExporter installs an exporter; until then spans are nil and
+// every Span method is a no-op, so instrumented code needs no checks.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace, the spans of one end-to-end operation
+type TraceID [16]byte
+
+// SpanID identifies a span within its trace
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether the ID is set
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether the ID is set
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanKind is a span's role, with OTLP's numbering
+type SpanKind int
+
+// Span kinds
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2 // handling a request
+	KindClient   SpanKind = 3 // making one
+)
+
+// Attr is a span attribute; values are strings, ints, floats or bools
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// String, Int, Float and Bool make attributes
+func String(key, value string) Attr    { return Attr{key, value} }
+func Int(key string, value int) Attr   { return Attr{key, value} }
+func Float(key string, v float64) Attr { return Attr{key, v} }
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+// SpanData is a finished span as exporters see it
+type SpanData struct {
+	Name    string
+	Kind    SpanKind
+	TraceID TraceID
+	SpanID  SpanID
+	Parent  SpanID // zero for a trace's root
+	Start   time.Time
+	End     time.Time
+	Attrs   []Attr
+	Err     string // the error the span failed with, if any
+}
+
+// Span is an operation being timed. A nil span records nothing.
+type Span struct {
+	proc  *processor
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext is what a child span or a remote service needs of a parent
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+type contextKey struct{}
+
+// ContextWithSpan returns ctx carrying s as the parent of spans started
+// from it
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, s.Context())
+}
+
+// contextWithRemote returns ctx carrying a parent from another process
+func contextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// SpanContextFrom returns the parent ctx carries, if any
+func SpanContextFrom(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(contextKey{}).(SpanContext)
+	return sc, ok && sc.TraceID.IsValid()
+}
+
+// Start begins an internal span named name, a child of the span ctx
+// carries or else a new trace's root, and returns ctx carrying it
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal, attrs...)
+}
+
+// StartKind is Start for a server or client span
+func StartKind(ctx context.Context, name string, kind SpanKind, attrs ...Attr) (context.Context, *Span) {
+	p := current()
+	if p == nil {
+		return ctx, nil
+	}
+	parent, _ := SpanContextFrom(ctx)
+	s := newSpan(p, name, kind, parent, attrs)
+	return ContextWithSpan(ctx, s), s
+}
+
+// Child begins a span under s, for code that holds a span rather than a
+// context; the child of a nil span is nil
+func (s *Span) Child(name string, attrs ...Attr) *Span {
+	if s == nil {
+		return nil
+	}
+	return newSpan(s.proc, name, KindInternal, s.Context(), attrs)
+}
+
+func newSpan(p *processor, name string, kind SpanKind, parent SpanContext, attrs []Attr) *Span {
+	s := &Span{proc: p, data: SpanData{Name: name, Kind: kind, Start: time.Now(), Attrs: append([]Attr(nil), attrs...)}}
+	if parent.TraceID.IsValid() {
+		s.data.TraceID, s.data.Parent = parent.TraceID, parent.SpanID
+	} else {
+		rand.Read(s.data.TraceID[:])
+	}
+	rand.Read(s.data.SpanID[:])
+	return s
+}
+
+// Context returns the span's IDs, zero for a nil span
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID}
+}
+
+// SetAttrs adds attributes, replacing any of the same key
+func (s *Span) SetAttrs(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range attrs {
+		replaced := false
+		for i := range s.data.Attrs {
+			if s.data.Attrs[i].Key == a.Key {
+				s.data.Attrs[i], replaced = a, true
+			}
+		}
+		if !replaced {
+			s.data.Attrs = append(s.data.Attrs, a)
+		}
+	}
+}
+
+// SetError marks the span failed with err; a nil err changes nothing
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err.Error()
+}
+
+// End finishes the span and queues it for export; later calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.proc.add(data)
+}
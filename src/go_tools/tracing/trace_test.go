@@ -0,0 +1,216 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// memoryExporter keeps what it is given
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (m *memoryExporter) ExportSpans(_ context.Context, spans []SpanData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+// capture turns tracing on for the test and returns the spans it exported
+func capture(t *testing.T) func() []SpanData {
+	t.Helper()
+	e := &memoryExporter{}
+	shutdown := SetExporter(e)
+	t.Cleanup(func() { shutdown(context.Background()) })
+	return func() []SpanData {
+		if err := shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return e.spans
+	}
+}
+
+func TestSpansNilWithoutExporter(t *testing.T) {
+	ctx, s := Start(context.Background(), "off")
+	if s != nil {
+		t.Fatal("span started with tracing off")
+	}
+	s.SetAttrs(Int("n", 1))
+	s.SetError(errors.New("boom"))
+	s.Child("child").End()
+	s.End()
+	if _, ok := SpanContextFrom(ctx); ok {
+		t.Error("context carries a span with tracing off")
+	}
+}
+
+func TestSetupTees(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	a, b := &memoryExporter{}, &memoryExporter{}
+	shutdown := Setup("", "test", a, b)
+	_, s := Start(context.Background(), "both")
+	s.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.spans) != 1 || len(b.spans) != 1 {
+		t.Errorf("exported %d and %d spans, want one each", len(a.spans), len(b.spans))
+	}
+}
+
+func TestSpanParentage(t *testing.T) {
+	spans := capture(t)
+	ctx, root := Start(context.Background(), "root", String("a", "b"))
+	_, child := Start(ctx, "child")
+	grandchild := child.Child("grandchild")
+	grandchild.SetError(errors.New("boom"))
+	grandchild.End()
+	child.End()
+	root.SetAttrs(String("a", "c"), Bool("done", true))
+	root.End()
+	root.End()
+
+	got := spans()
+	if len(got) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(got))
+	}
+	byName := map[string]SpanData{}
+	for _, s := range got {
+		byName[s.Name] = s
+	}
+	r, c, g := byName["root"], byName["child"], byName["grandchild"]
+	if r.Parent.IsValid() || c.Parent != r.SpanID || g.Parent != c.SpanID {
+		t.Errorf("parents: root %v, child %v (want %v), grandchild %v (want %v)", r.Parent, c.Parent, r.SpanID, g.Parent, c.SpanID)
+	}
+	if c.TraceID != r.TraceID || g.TraceID != r.TraceID {
+		t.Error("children left the root's trace")
+	}
+	if g.Err != "boom" || r.Err != "" {
+		t.Errorf("errors: root %q, grandchild %q", r.Err, g.Err)
+	}
+	if len(r.Attrs) != 2 || r.Attrs[0] != String("a", "c") {
+		t.Errorf("root attrs = %v", r.Attrs)
+	}
+	if r.End.Before(r.Start) {
+		t.Error("root ended before it started")
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	spans := capture(t)
+	ctx, s := Start(context.Background(), "caller")
+	h := http.Header{}
+	Inject(ctx, h)
+	sc, ok := ParseTraceparent(h.Get(TraceparentHeader))
+	if !ok || sc != s.Context() {
+		t.Fatalf("traceparent %q parsed to %v, want %v", h.Get(TraceparentHeader), sc, s.Context())
+	}
+	s.End()
+	spans()
+
+	for _, bad := range []string{"", "00-abc-def-01", "ff-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-01",
+		"00-00000000000000000000000000000000-" + sc.SpanID.String() + "-01"} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("parsed %q", bad)
+		}
+	}
+}
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	spans := capture(t)
+	var inner SpanContext
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner, _ = SpanContextFrom(r.Context())
+		if r.URL.Path == "/fail" {
+			http.Error(w, "no", http.StatusInternalServerError)
+		}
+	}))
+	ctx, caller := Start(context.Background(), "caller")
+	req := httptest.NewRequest(http.MethodGet, "/fail", nil)
+	Inject(ctx, req.Header)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	caller.End()
+
+	var server SpanData
+	for _, s := range spans() {
+		if s.Kind == KindServer {
+			server = s
+		}
+	}
+	if server.Name != "GET /fail" || server.Parent != caller.Context().SpanID || server.TraceID != caller.Context().TraceID {
+		t.Fatalf("server span = %+v", server)
+	}
+	if inner.SpanID != server.SpanID {
+		t.Error("handler didn't see the server span")
+	}
+	if server.Err == "" {
+		t.Error("a 500 didn't fail the span")
+	}
+	found := false
+	for _, a := range server.Attrs {
+		if a.Key == "http.response.status_code" && a.Value == 500 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("status missing from %v", server.Attrs)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]any
+	var path string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer collector.Close()
+
+	shutdown := Setup(collector.URL, "test-service")
+	ctx, root := Start(context.Background(), "root")
+	_, child := Start(ctx, "child", Int("n", 3), Float("ratio", 0.5))
+	child.SetError(errors.New("boom"))
+	child.End()
+	root.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/traces" {
+		t.Errorf("posted to %q", path)
+	}
+	rs := body["resourceSpans"].([]any)[0].(map[string]any)
+	service := rs["resource"].(map[string]any)["attributes"].([]any)[0].(map[string]any)
+	if service["key"] != "service.name" || service["value"].(map[string]any)["stringValue"] != "test-service" {
+		t.Errorf("resource = %v", rs["resource"])
+	}
+	spans := rs["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans", len(spans))
+	}
+	c := spans[0].(map[string]any)
+	if c["name"] != "child" || c["traceId"] != root.Context().TraceID.String() || c["parentSpanId"] != root.Context().SpanID.String() {
+		t.Errorf("child = %v", c)
+	}
+	if c["status"].(map[string]any)["code"] != 2.0 {
+		t.Errorf("child status = %v", c["status"])
+	}
+	attrs := c["attributes"].([]any)
+	if n := attrs[0].(map[string]any)["value"].(map[string]any)["intValue"]; n != "3" {
+		t.Errorf("int attribute = %v", n)
+	}
+	if _, ok := spans[1].(map[string]any)["parentSpanId"]; ok {
+		t.Error("root has a parent")
+	}
+}
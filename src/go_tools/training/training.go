@@ -0,0 +1,379 @@
+// Package training turns replays into state-action-reward samples for
+// training learned difficulty models and bot policies: a sample a piece,
+// the player's state as the piece came into play, encoded as a vector of
+// features, the placement it locked at and the reward of locking it.
+// Simulated games are turned into samples by way of their replays.
+//
+// Samples are written as NumPy's NPZ archives or TensorFlow's TFRecord
+// files of tf.train.Example records, with a Meta describing where each
+// feature lies in the state vectors.
+package training
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// Board encodings
+const (
+	BoardOccupancy = "occupancy" // a cell a feature, 1 when filled
+	BoardTypes     = "types"     // a cell a one-hot of its block type or garbage, and its special kind
+	BoardHeights   = "heights"   // a column a feature, its height in rows
+)
+
+// Encoding is how samples encode states and reward locks: the board, the
+// piece in play, hold and preview one-hot over level.BlockTypes, and a
+// player's counters. Boards of levels smaller than Width by Height sit
+// in its bottom-left corner, the columns past their width filled.
+type Encoding struct {
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Board    string `json:"board"`
+	Preview  int    `json:"preview"`  // pieces of the preview encoded
+	Hold     bool   `json:"hold"`     // whether the held piece is encoded
+	Counters bool   `json:"counters"` // combo, incoming garbage rows and spells held
+	Reward   Reward `json:"reward"`
+}
+
+// Reward weighs what a lock did into its sample's reward
+type Reward struct {
+	Lines  float64 `json:"lines"`  // a line cleared
+	Score  float64 `json:"score"`  // a point scored
+	Piece  float64 `json:"piece"`  // the lock itself
+	TopOut float64 `json:"topOut"` // the last lock before the player topped out
+}
+
+// DefaultEncoding encodes a standard board's occupancy, the hold, a full
+// preview and the counters, rewarding lines and penalising topping out
+func DefaultEncoding() Encoding {
+	return Encoding{
+		Width: 10, Height: 20, Board: BoardOccupancy, Preview: sim.DefaultPreview, Hold: true, Counters: true,
+		Reward: Reward{Lines: 1, TopOut: -1},
+	}
+}
+
+// LoadEncoding reads a JSON encoding; entries missing from the file keep
+// DefaultEncoding's
+func LoadEncoding(path string) (Encoding, error) {
+	e := DefaultEncoding()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, fmt.Errorf("parse encoding %s: %w", path, err)
+	}
+	if err := e.Validate(); err != nil {
+		return e, fmt.Errorf("%s: %w", path, err)
+	}
+	return e, nil
+}
+
+// Validate checks the board size is positive, the board encoding known
+// and the preview not negative
+func (e Encoding) Validate() error {
+	if e.Width <= 0 || e.Height <= 0 {
+		return fmt.Errorf("encoding board %dx%d must be positive", e.Width, e.Height)
+	}
+	switch e.Board {
+	case BoardOccupancy, BoardTypes, BoardHeights:
+	default:
+		return fmt.Errorf("unknown board encoding %q", e.Board)
+	}
+	if e.Preview < 0 {
+		return fmt.Errorf("encoding preview can't be negative")
+	}
+	return nil
+}
+
+// Feature is a run of a state vector's features
+type Feature struct {
+	Name   string `json:"name"`
+	Offset int    `json:"offset"`
+	Shape  []int  `json:"shape"` // the run's, row-major
+}
+
+// Features lays out the state vectors, in order
+func (e Encoding) Features() []Feature {
+	var out []Feature
+	at := 0
+	add := func(name string, shape ...int) {
+		out = append(out, Feature{Name: name, Offset: at, Shape: shape})
+		n := 1
+		for _, s := range shape {
+			n *= s
+		}
+		at += n
+	}
+	switch e.Board {
+	case BoardOccupancy:
+		add("board", e.Height, e.Width)
+	case BoardTypes:
+		add("board", e.Height, e.Width, len(cellChannels))
+	case BoardHeights:
+		add("heights", e.Width)
+	}
+	add("piece", len(level.BlockTypes))
+	if e.Hold {
+		add("hold", len(level.BlockTypes))
+	}
+	if e.Preview > 0 {
+		add("preview", e.Preview, len(level.BlockTypes))
+	}
+	if e.Counters {
+		add("counters", 3)
+	}
+	return out
+}
+
+// Size is the length of the state vectors
+func (e Encoding) Size() int {
+	f := e.Features()
+	last := f[len(f)-1]
+	n := 1
+	for _, s := range last.Shape {
+		n *= s
+	}
+	return last.Offset + n
+}
+
+// cellChannels are the channels of BoardTypes: the block types, garbage,
+// then the special kinds
+var cellChannels = append(append(slices.Clone(level.BlockTypes), sim.Garbage), level.SpecialKinds...)
+
+// Actions name the columns of a sample's action
+var Actions = []string{"piece", "x", "y", "rotation", "held"}
+
+// Sample is a piece a player locked
+type Sample struct {
+	Episode int       // the player's game, numbered across the export
+	State   []float32 // as the piece came into play
+	Action  [5]int32  // as Actions: the piece's index in level.BlockTypes, its lock position and rotation, 1 if the player held
+	Reward  float32
+	Done    bool // the last lock of the episode
+}
+
+// Episode is a player's game the samples of an export came from
+type Episode struct {
+	Session string `json:"session"`
+	Level   string `json:"level"`
+	Player  string `json:"player"`
+	Samples int    `json:"samples"`
+}
+
+// Meta describes an export's samples
+type Meta struct {
+	Encoding Encoding  `json:"encoding"`
+	Features []Feature `json:"features"`
+	Size     int       `json:"size"` // of a state vector
+	Actions  []string  `json:"actions"`
+	Episodes []Episode `json:"episodes"`
+}
+
+// NewMeta is the meta of an export by the encoding, before its episodes
+func NewMeta(e Encoding) *Meta {
+	return &Meta{Encoding: e, Features: e.Features(), Size: e.Size(), Actions: Actions}
+}
+
+// Save writes the meta as JSON
+func (m *Meta) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// observed is a player's state as their piece came into play
+type observed struct {
+	state []float32
+	piece string
+	score int
+}
+
+// Extract plays the replay again on its level and hands fn each player's
+// samples in the order they locked, an episode a player numbered on from
+// meta's episodes, which it appends to
+func Extract(lvl *level.Level, r *replay.Replay, opts sim.Options, meta *Meta, fn func(Sample) error) error {
+	e := meta.Encoding
+	if lvl.GridSize.Width > e.Width || lvl.GridSize.Height > e.Height {
+		return fmt.Errorf("level %s is %dx%d, larger than the encoding's %dx%d", lvl.Name,
+			lvl.GridSize.Width, lvl.GridSize.Height, e.Width, e.Height)
+	}
+	rp, err := sim.NewReplayer(lvl, r, opts)
+	if err != nil {
+		return err
+	}
+	g := rp.Game()
+	players := g.Players()
+	episode := make(map[string]int, len(players))
+	for _, id := range players {
+		episode[id] = len(meta.Episodes)
+		meta.Episodes = append(meta.Episodes, Episode{Session: r.SessionID, Level: lvl.Name, Player: id})
+	}
+	obs := make(map[string]*observed, len(players))
+	last := make(map[string]*Sample, len(players)) // held back for the top-out's reward
+	emit := func(id string, s *Sample) error {
+		meta.Episodes[episode[id]].Samples++
+		return fn(*s)
+	}
+	for {
+		for _, id := range players {
+			if obs[id] == nil {
+				obs[id] = observe(g, id, e)
+			}
+		}
+		if rp.Done() {
+			break
+		}
+		events, err := rp.Step()
+		if err != nil {
+			return err
+		}
+		for _, id := range players {
+			var lock *replay.Event
+			lines := 0
+			for i, ev := range events {
+				switch {
+				case ev.Player != id:
+				case ev.Type == replay.EventLock:
+					lock = &events[i]
+				case ev.Type == replay.EventClear:
+					lines += ev.Lines
+				}
+			}
+			if lock == nil || obs[id] == nil {
+				continue
+			}
+			o := obs[id]
+			st, _ := g.State(id)
+			s := &Sample{
+				Episode: episode[id], State: o.state,
+				Action: [5]int32{int32(slices.Index(level.BlockTypes, lock.Piece)), int32(lock.X), int32(lock.Y), int32(lock.Rotation), 0},
+				Reward: float32(e.Reward.Lines*float64(lines) + e.Reward.Score*float64(st.Score-o.score) + e.Reward.Piece),
+			}
+			if lock.Piece != o.piece {
+				s.Action[4] = 1
+			}
+			if prev := last[id]; prev != nil {
+				if err := emit(id, prev); err != nil {
+					return err
+				}
+			}
+			last[id], obs[id] = s, nil
+		}
+	}
+	for _, id := range players {
+		s := last[id]
+		if s == nil {
+			continue
+		}
+		s.Done = true
+		if st, _ := g.State(id); st.ToppedOut {
+			s.Reward += float32(e.Reward.TopOut)
+		}
+		if err := emit(id, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observe encodes the player's state now, their piece in play or, before
+// it spawns, the one coming first; nil once they topped out
+func observe(g *sim.Game, id string, e Encoding) *observed {
+	st, _ := g.State(id)
+	if st.ToppedOut {
+		return nil
+	}
+	next := st.Next
+	piece := ""
+	switch {
+	case st.Piece != nil:
+		piece = st.Piece.Type
+	case len(next) > 0:
+		piece, next = next[0], next[1:]
+	}
+	v := make([]float32, 0, e.Size())
+	b := g.Board(id)
+	w, h := b.Width(), len(b)
+	switch e.Board {
+	case BoardOccupancy:
+		for y := 0; y < e.Height; y++ {
+			for x := 0; x < e.Width; x++ {
+				c, in := cellAt(b, x, y-(e.Height-h))
+				v = append(v, bit(!in && x >= w || in && !c.Empty()))
+			}
+		}
+	case BoardTypes:
+		for y := 0; y < e.Height; y++ {
+			for x := 0; x < e.Width; x++ {
+				c, in := cellAt(b, x, y-(e.Height-h))
+				if !in && x >= w {
+					c = sim.Cell{Type: sim.Garbage}
+				}
+				for _, ch := range cellChannels {
+					v = append(v, bit(c.Type == ch || c.Special == ch))
+				}
+			}
+		}
+	case BoardHeights:
+		for x := 0; x < e.Width; x++ {
+			height := e.Height
+			if x < w {
+				height = 0
+				for y := 0; y < h; y++ {
+					if !b[y][x].Empty() {
+						height = h - y
+						break
+					}
+				}
+			}
+			v = append(v, float32(height))
+		}
+	}
+	v = oneHot(v, piece)
+	if e.Hold {
+		v = oneHot(v, st.Hold)
+	}
+	for i := 0; i < e.Preview; i++ {
+		p := ""
+		if i < len(next) {
+			p = next[i]
+		}
+		v = oneHot(v, p)
+	}
+	if e.Counters {
+		v = append(v, float32(st.Combo), float32(st.Incoming), float32(len(st.Spells)))
+	}
+	return &observed{state: v, piece: piece, score: st.Score}
+}
+
+// cellAt is the board's cell at x, y, false off the board
+func cellAt(b sim.Board, x, y int) (sim.Cell, bool) {
+	if y < 0 || y >= len(b) || x < 0 || x >= b.Width() {
+		return sim.Cell{}, false
+	}
+	return b[y][x], true
+}
+
+// oneHot appends piece one-hot over level.BlockTypes, zeros for none
+func oneHot(v []float32, piece string) []float32 {
+	for _, t := range level.BlockTypes {
+		v = append(v, bit(t == piece))
+	}
+	return v
+}
+
+func bit(b bool) float32 {
+	if b {
+		return 1
+	}
+	return 0
+}
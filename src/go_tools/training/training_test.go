@@ -0,0 +1,206 @@
+package training
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/sim"
+)
+
+// played is a replay of a piece placed every few frames on a narrow
+// level until the player tops out
+func played(t *testing.T) (*level.Level, *replay.Replay) {
+	t.Helper()
+	lvl := level.New("narrow", 6, 10)
+	lvl.SpawnPoints = []level.Point{{X: 3, Y: 0}}
+	g, err := sim.New(lvl, sim.Options{Seed: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for col := 0; !g.Over() && g.Frame() < 2000; col++ {
+		g.Tick()
+		if st, _ := g.State("p1"); st.Piece != nil && g.Frame()%10 == 0 {
+			g.Place("p1", col%4, col%4)
+		}
+	}
+	return lvl, g.Replay("s")
+}
+
+func TestExtract(t *testing.T) {
+	lvl, r := played(t)
+	enc := DefaultEncoding()
+	enc.Reward.Piece = 0.5
+	meta := NewMeta(enc)
+	if meta.Size != 200+7+7+5*7+3 {
+		t.Fatalf("state vectors of %d features", meta.Size)
+	}
+	var samples []Sample
+	if err := Extract(lvl, r, sim.Options{}, meta, func(s Sample) error {
+		samples = append(samples, s)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	locks := r.EventsOf(replay.EventLock)
+	if len(samples) != len(locks) || len(meta.Episodes) != 1 || meta.Episodes[0].Samples != len(locks) {
+		t.Fatalf("%d samples of %d locks, episodes %+v", len(samples), len(locks), meta.Episodes)
+	}
+	if r.Result.Outcome != replay.OutcomeTopOut {
+		t.Fatalf("the game ended %q, want a top-out", r.Result.Outcome)
+	}
+	for i, s := range samples {
+		ev := locks[i]
+		if len(s.State) != meta.Size || s.Action[0] != int32(strings.Index("IJLOSTZ", ev.Piece)) || s.Action[1] != int32(ev.X) || s.Action[2] != int32(ev.Y) {
+			t.Fatalf("sample %d: action %v for lock %+v", i, s.Action, ev)
+		}
+		if s.Done != (i == len(samples)-1) {
+			t.Errorf("sample %d done %t", i, s.Done)
+		}
+		// the piece in play one-hot, then the board's columns past the level's filled
+		piece := s.State[200 : 200+7]
+		if piece[s.Action[0]] != 1 && s.Action[4] == 0 {
+			t.Errorf("sample %d: piece %v locked %s unheld", i, piece, ev.Piece)
+		}
+		if s.State[0*10+6] != 1 || s.State[0*10+5] != 0 {
+			t.Errorf("sample %d: top row %v", i, s.State[:10])
+		}
+	}
+	if first := samples[0].State[:200]; first[19*10] != 0 {
+		t.Errorf("the first piece came into play on a filled board: %v", first)
+	}
+	if last := samples[len(samples)-1]; last.Reward >= 0 {
+		t.Errorf("the lock before the top-out rewarded %v", last.Reward)
+	}
+
+	heights := DefaultEncoding()
+	heights.Board, heights.Preview, heights.Hold, heights.Counters = BoardHeights, 0, false, false
+	hm := NewMeta(heights)
+	var last Sample
+	Extract(lvl, r, sim.Options{}, hm, func(s Sample) error { last = s; return nil })
+	if hm.Size != 10+7 || len(last.State) != hm.Size || last.State[6] != 20 || last.State[9] != 20 || last.State[2] == 0 {
+		t.Errorf("heights %v", last.State)
+	}
+
+	small := DefaultEncoding()
+	small.Width = 4
+	if err := Extract(lvl, r, sim.Options{}, NewMeta(small), func(Sample) error { return nil }); err == nil {
+		t.Error("extracted a level wider than the encoding")
+	}
+	if err := (Encoding{Width: 10, Height: 20, Board: "pixels"}).Validate(); err == nil {
+		t.Error("an unknown board encoding validated")
+	}
+}
+
+func TestNPZ(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewNPZWriter(&buf, 3)
+	w.Write(Sample{State: []float32{1, 2, 3}, Action: [5]int32{1, 2, 3, 4, 0}, Reward: 1})
+	w.Write(Sample{Episode: 1, State: []float32{4, 5, 6}, Reward: -1, Done: true})
+	if err := w.Write(Sample{State: []float32{1}}); err == nil {
+		t.Error("wrote a state of the wrong size")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"states.npy":   "{'descr': '<f4', 'fortran_order': False, 'shape': (2, 3), }",
+		"actions.npy":  "{'descr': '<i4', 'fortran_order': False, 'shape': (2, 5), }",
+		"rewards.npy":  "{'descr': '<f4', 'fortran_order': False, 'shape': (2,), }",
+		"dones.npy":    "{'descr': '|b1', 'fortran_order': False, 'shape': (2,), }",
+		"episodes.npy": "{'descr': '<i4', 'fortran_order': False, 'shape': (2,), }",
+	}
+	for _, f := range z.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		n := int(binary.LittleEndian.Uint16(data[8:10]))
+		if string(data[:8]) != "\x93NUMPY\x01\x00" || (10+n)%64 != 0 || data[10+n-1] != '\n' {
+			t.Errorf("%s: header %q", f.Name, data[:min(len(data), 10+n)])
+			continue
+		}
+		if header := strings.TrimRight(string(data[10:10+n]), " \n"); header != want[f.Name] {
+			t.Errorf("%s: header %s", f.Name, header)
+		}
+		delete(want, f.Name)
+		if f.Name == "states.npy" && len(data)-10-n != 6*4 {
+			t.Errorf("states of %d bytes", len(data)-10-n)
+		}
+		if f.Name == "dones.npy" && !bytes.Equal(data[10+n:], []byte{0, 1}) {
+			t.Errorf("dones %v", data[10+n:])
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("missing arrays %v", want)
+	}
+}
+
+func TestTFRecord(t *testing.T) {
+	// crc32c's check value, masked as TFRecord masks it
+	check := uint32(0xe3069283)
+	if c := maskedCRC([]byte("123456789")); c != (check>>15|check<<17)+0xa282ead8 {
+		t.Errorf("masked crc %08x", c)
+	}
+	var buf bytes.Buffer
+	w := NewTFRecordWriter(&buf)
+	for i := 0; i < 2; i++ {
+		if err := w.Write(Sample{Episode: i, State: []float32{0.5, 1}, Action: [5]int32{6, -1, 3, 2, 1}, Reward: 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := buf.Bytes()
+	for i := 0; i < 2; i++ {
+		n := binary.LittleEndian.Uint64(data[:8])
+		if binary.LittleEndian.Uint32(data[8:12]) != maskedCRC(data[:8]) {
+			t.Fatalf("record %d: length checksum", i)
+		}
+		record := data[12 : 12+n]
+		if binary.LittleEndian.Uint32(data[12+n:16+n]) != maskedCRC(record) {
+			t.Fatalf("record %d: data checksum", i)
+		}
+		data = data[16+n:]
+
+		// Example.features, then each map entry of Features.feature
+		_, _, l := protowire.ConsumeTag(record)
+		features, _ := protowire.ConsumeBytes(record[l:])
+		names := map[string][]byte{}
+		for len(features) > 0 {
+			_, _, l := protowire.ConsumeTag(features)
+			entry, m := protowire.ConsumeBytes(features[l:])
+			features = features[l+m:]
+			_, _, l = protowire.ConsumeTag(entry)
+			name, m := protowire.ConsumeString(entry[l:])
+			entry = entry[l+m:]
+			_, _, l = protowire.ConsumeTag(entry)
+			names[name], _ = protowire.ConsumeBytes(entry[l:])
+		}
+		if len(names) != 5 {
+			t.Fatalf("record %d: features %v", i, names)
+		}
+		// Feature.int64_list, then Int64List.value, packed
+		num, _, l := protowire.ConsumeTag(names["episode"])
+		list, _ := protowire.ConsumeBytes(names["episode"][l:])
+		_, _, l = protowire.ConsumeTag(list)
+		packed, _ := protowire.ConsumeBytes(list[l:])
+		if v, _ := protowire.ConsumeVarint(packed); num != 3 || v != uint64(i) {
+			t.Errorf("record %d: episode field %d = %d", i, num, v)
+		}
+		if num, _, _ := protowire.ConsumeTag(names["state"]); num != 2 {
+			t.Errorf("record %d: state is field %d, not a float list", i, num)
+		}
+	}
+	if len(data) != 0 {
+		t.Errorf("%d bytes after the records", len(data))
+	}
+}
@@ -0,0 +1,217 @@
+package training
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Export formats
+const (
+	FormatNPZ      = "npz"
+	FormatTFRecord = "tfrecord"
+)
+
+// Formats are the export formats, the first the default
+var Formats = []string{FormatNPZ, FormatTFRecord}
+
+// Writer writes an export's samples; Close finishes the export without
+// closing what it writes to
+type Writer interface {
+	Write(Sample) error
+	Close() error
+}
+
+// NewWriter is the writer of a format, writing state vectors of size
+func NewWriter(format string, w io.Writer, size int) (Writer, error) {
+	switch format {
+	case FormatNPZ:
+		return NewNPZWriter(w, size), nil
+	case FormatTFRecord:
+		return NewTFRecordWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// npzWriter gathers the samples, written as arrays on Close
+type npzWriter struct {
+	w        io.Writer
+	size     int
+	states   []float32
+	actions  []int32
+	rewards  []float32
+	dones    []byte
+	episodes []int32
+}
+
+// NewNPZWriter writes the samples as a NumPy NPZ archive of arrays, as
+// numpy.load reads them: states, float32 N by size; actions, int32 N by
+// 5; rewards, float32; dones, bool; and episodes, int32. The samples are
+// kept until Close writes them.
+func NewNPZWriter(w io.Writer, size int) Writer {
+	return &npzWriter{w: w, size: size}
+}
+
+func (n *npzWriter) Write(s Sample) error {
+	if len(s.State) != n.size {
+		return fmt.Errorf("sample state of %d features, want %d", len(s.State), n.size)
+	}
+	n.states = append(n.states, s.State...)
+	n.actions = append(n.actions, s.Action[:]...)
+	n.rewards = append(n.rewards, s.Reward)
+	n.dones = append(n.dones, byte(bit(s.Done)))
+	n.episodes = append(n.episodes, int32(s.Episode))
+	return nil
+}
+
+func (n *npzWriter) Close() error {
+	rows := len(n.rewards)
+	z := zip.NewWriter(n.w)
+	arrays := []struct {
+		name  string
+		descr string
+		shape []int
+		data  any
+	}{
+		{"states", "<f4", []int{rows, n.size}, n.states},
+		{"actions", "<i4", []int{rows, len(Actions)}, n.actions},
+		{"rewards", "<f4", []int{rows}, n.rewards},
+		{"dones", "|b1", []int{rows}, n.dones},
+		{"episodes", "<i4", []int{rows}, n.episodes},
+	}
+	for _, a := range arrays {
+		f, err := z.Create(a.name + ".npy")
+		if err != nil {
+			return err
+		}
+		if err := writeNPY(f, a.descr, a.shape, a.data); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// writeNPY writes an array in the .npy format, version 1.0
+func writeNPY(w io.Writer, descr string, shape []int, data any) error {
+	dims := make([]string, len(shape))
+	for i, d := range shape {
+		dims[i] = fmt.Sprint(d)
+	}
+	tuple := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		tuple += ","
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, tuple)
+	// the magic, version and header length before it, the whole padded to 64 bytes
+	pad := 64 - (10+len(header)+1)%64
+	header += strings.Repeat(" ", pad%64) + "\n"
+	var head bytes.Buffer
+	head.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(&head, binary.LittleEndian, uint16(len(header)))
+	head.WriteString(header)
+	if _, err := w.Write(head.Bytes()); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, data)
+}
+
+// tfRecordWriter streams the samples as records
+type tfRecordWriter struct {
+	w io.Writer
+}
+
+// NewTFRecordWriter writes each sample as a TFRecord of a tf.train.Example
+// with the features state, a float list; action, an int64 list; reward, a
+// float; done and episode, int64s
+func NewTFRecordWriter(w io.Writer) Writer {
+	return &tfRecordWriter{w: w}
+}
+
+func (t *tfRecordWriter) Write(s Sample) error {
+	action := make([]int64, len(s.Action))
+	for i, a := range s.Action {
+		action[i] = int64(a)
+	}
+	var features []byte
+	features = exampleFeature(features, "state", floatList(s.State))
+	features = exampleFeature(features, "action", int64List(action))
+	features = exampleFeature(features, "reward", floatList([]float32{s.Reward}))
+	features = exampleFeature(features, "done", int64List([]int64{int64(bit(s.Done))}))
+	features = exampleFeature(features, "episode", int64List([]int64{int64(s.Episode)}))
+	// Example{features: Features{feature: map}}
+	example := protowire.AppendTag(nil, 1, protowire.BytesType)
+	example = protowire.AppendBytes(example, features)
+	return writeTFRecord(t.w, example)
+}
+
+func (t *tfRecordWriter) Close() error { return nil }
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// maskedCRC is a TFRecord's checksum of data
+func maskedCRC(data []byte) uint32 {
+	crc := crc32.Checksum(data, castagnoli)
+	return (crc>>15 | crc<<17) + 0xa282ead8
+}
+
+// writeTFRecord frames a record: its length and the length's checksum,
+// then the data and its checksum
+func writeTFRecord(w io.Writer, data []byte) error {
+	var head [12]byte
+	binary.LittleEndian.PutUint64(head[:8], uint64(len(data)))
+	binary.LittleEndian.PutUint32(head[8:], maskedCRC(head[:8]))
+	var tail [4]byte
+	binary.LittleEndian.PutUint32(tail[:], maskedCRC(data))
+	for _, b := range [][]byte{head[:], data, tail[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exampleFeature appends an entry of Features' feature map
+func exampleFeature(b []byte, name string, feature []byte) []byte {
+	var entry []byte
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, name)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, feature)
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, entry)
+}
+
+// floatList is a Feature of a FloatList, packed
+func floatList(v []float32) []byte {
+	var packed []byte
+	for _, f := range v {
+		packed = protowire.AppendFixed32(packed, math.Float32bits(f))
+	}
+	return list(2, packed)
+}
+
+// int64List is a Feature of an Int64List, packed
+func int64List(v []int64) []byte {
+	var packed []byte
+	for _, n := range v {
+		packed = protowire.AppendVarint(packed, uint64(n))
+	}
+	return list(3, packed)
+}
+
+// list is a Feature whose oneof field is a list message of packed values
+func list(field protowire.Number, packed []byte) []byte {
+	var l []byte
+	l = protowire.AppendTag(l, 1, protowire.BytesType)
+	l = protowire.AppendBytes(l, packed)
+	f := protowire.AppendTag(nil, field, protowire.BytesType)
+	return protowire.AppendBytes(f, l)
+}
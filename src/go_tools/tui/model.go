@@ -0,0 +1,376 @@
+package tui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/jobqueue"
+)
+
+// Keys the dashboard acts on besides characters, as ParseKeys names them
+const (
+	KeyUp       = "up"
+	KeyDown     = "down"
+	KeyLeft     = "left"
+	KeyRight    = "right"
+	KeyTab      = "tab"
+	KeyBackTab  = "backtab"
+	KeyEnter    = "enter"
+	KeyEsc      = "esc"
+	KeyHome     = "home"
+	KeyEnd      = "end"
+	KeyPageUp   = "pgup"
+	KeyPageDown = "pgdn"
+)
+
+// escapes are the sequences terminals send for the keys, in normal and
+// application cursor mode
+var escapes = map[string]string{
+	"[A": KeyUp, "[B": KeyDown, "[C": KeyRight, "[D": KeyLeft,
+	"OA": KeyUp, "OB": KeyDown, "OC": KeyRight, "OD": KeyLeft,
+	"[H": KeyHome, "[F": KeyEnd, "OH": KeyHome, "OF": KeyEnd, "[1~": KeyHome, "[4~": KeyEnd,
+	"[5~": KeyPageUp, "[6~": KeyPageDown, "[Z": KeyBackTab,
+}
+
+// ParseKeys splits what the terminal sent into keys: a known escape
+// sequence as its name, tab, enter and a lone escape as theirs, and any
+// other character as itself; unknown sequences are dropped
+func ParseKeys(data []byte) []string {
+	var keys []string
+	for len(data) > 0 {
+		switch data[0] {
+		case '\t':
+			keys = append(keys, KeyTab)
+			data = data[1:]
+			continue
+		case '\r', '\n':
+			keys = append(keys, KeyEnter)
+			data = data[1:]
+			continue
+		case 0x1b:
+			n := 1
+			if len(data) > 1 && (data[1] == '[' || data[1] == 'O') {
+				// CSI and SS3 sequences end at a letter or ~
+				for n = 2; n < len(data) && !(data[n] >= 'A' && data[n] <= 'Z' || data[n] >= 'a' && data[n] <= 'z' || data[n] == '~'); n++ {
+				}
+				n = min(n+1, len(data))
+				if k, ok := escapes[string(data[1:n])]; ok {
+					keys = append(keys, k)
+				}
+			} else {
+				keys = append(keys, KeyEsc)
+			}
+			data = data[n:]
+			continue
+		}
+		r, n := utf8.DecodeRune(data)
+		keys = append(keys, string(r))
+		data = data[n:]
+	}
+	return keys
+}
+
+// Actions a key asks of the dashboard's loop
+const (
+	ActionNone    = ""
+	ActionRefresh = "refresh" // poll again now
+	ActionQuit    = "quit"
+)
+
+// page is how far page up and down move the selection
+const page = 10
+
+// Model is what the dashboard shows: the last poll, the panel in view, the
+// row selected in each and whether the selected row is opened to its
+// details
+type Model struct {
+	Status  Status
+	Sources Sources
+	Panel   int
+	Rows    [len(Panels)]int // selected, by panel
+	Open    bool
+}
+
+// Key moves through the panels and their rows: left and right, tab or
+// 1 to 4 for the panel, up and down, page up and down, home and end for
+// the row, enter to open a row's details and escape to close them, r to
+// poll again and q to quit
+func (m *Model) Key(k string) string {
+	rows := len(m.table().rows)
+	switch k {
+	case KeyLeft, "h", KeyBackTab:
+		m.Panel = (m.Panel + len(Panels) - 1) % len(Panels)
+		m.Open = false
+	case KeyRight, "l", KeyTab:
+		m.Panel = (m.Panel + 1) % len(Panels)
+		m.Open = false
+	case "1", "2", "3", "4":
+		m.Panel = int(k[0] - '1')
+		m.Open = false
+	case KeyUp, "k":
+		m.Rows[m.Panel]--
+	case KeyDown, "j":
+		m.Rows[m.Panel]++
+	case KeyPageUp:
+		m.Rows[m.Panel] -= page
+	case KeyPageDown:
+		m.Rows[m.Panel] += page
+	case KeyHome, "g":
+		m.Rows[m.Panel] = 0
+	case KeyEnd, "G":
+		m.Rows[m.Panel] = rows - 1
+	case KeyEnter, " ":
+		m.Open = !m.Open && rows > 0
+	case KeyEsc:
+		m.Open = false
+	case "r":
+		return ActionRefresh
+	case "q", "\x03":
+		return ActionQuit
+	}
+	m.clamp()
+	return ActionNone
+}
+
+// SetStatus takes a new poll, keeping the selections on rows that still
+// exist
+func (m *Model) SetStatus(st Status) {
+	m.Status = st
+	m.clamp()
+}
+
+func (m *Model) clamp() {
+	rows := len(m.table().rows)
+	m.Rows[m.Panel] = max(0, min(m.Rows[m.Panel], rows-1))
+	if rows == 0 {
+		m.Open = false
+	}
+}
+
+// table is a panel laid out: a line summing it up, its column heads and
+// rows, tab separated, and each row's details
+type table struct {
+	summary string
+	head    string
+	rows    []string
+	details func(i int) []string
+}
+
+// table is the panel in view
+func (m *Model) table() table {
+	st := m.Status
+	switch Panels[m.Panel] {
+	case PanelJobs:
+		t := table{head: "ID\tKIND\tSTATUS\tATTEMPTS\tWORKER\tCREATED\tTOOK"}
+		if m.Sources.Jobs == "" {
+			t.summary = "no job queue; pass -jobs or set the config's jobQueueUrl"
+			return t
+		}
+		if q := st.Queue; q != nil {
+			t.summary = fmt.Sprintf("%d queued, %d running, %d done, %d failed; %d workers",
+				q.Jobs[jobqueue.StatusQueued], q.Jobs[jobqueue.StatusRunning], q.Jobs[jobqueue.StatusDone],
+				q.Jobs[jobqueue.StatusFailed], q.Workers)
+		}
+		for _, j := range st.Jobs {
+			took := "-"
+			if j.Started != nil {
+				end := st.At
+				if j.Finished != nil {
+					end = *j.Finished
+				}
+				took = end.Sub(*j.Started).Round(time.Second).String()
+			}
+			t.rows = append(t.rows, fmt.Sprintf("%d\t%s\t%s\t%d/%d\t%s\t%s ago\t%s", j.ID, j.Kind, j.Status,
+				j.Attempts, j.MaxAttempts, dash(j.Worker), st.At.Sub(j.Created).Round(time.Second), took))
+		}
+		t.details = func(i int) []string {
+			j := st.Jobs[i]
+			out := []string{"payload " + compact(j.Payload)}
+			if len(j.Result) > 0 {
+				out = append(out, "result  "+compact(j.Result))
+			}
+			if j.Error != "" {
+				out = append(out, "error   "+j.Error)
+			}
+			for _, w := range st.Workers {
+				if w.Name == j.Worker {
+					out = append(out, fmt.Sprintf("worker  %s on %s, seen %s ago, running %d jobs", w.Name, w.Host,
+						st.At.Sub(w.Seen).Round(time.Second), len(w.Running)))
+				}
+			}
+			return out
+		}
+		return t
+	case PanelAnalysis:
+		t := table{head: "ID\tKIND\tSUBJECT\tRUNNING"}
+		if m.Sources.Analysis == "" {
+			t.summary = "no analysis server; pass -analysis or run stt analyze -serve where discovery finds it"
+			return t
+		}
+		t.summary = fmt.Sprintf("%d analysis jobs running", len(st.Analysis))
+		for _, j := range st.Analysis {
+			t.rows = append(t.rows, fmt.Sprintf("%d\t%s\t%s\t%s", j.ID, j.Kind, dash(j.Subject),
+				(time.Duration(j.Seconds*float64(time.Second))).Round(time.Second)))
+		}
+		t.details = func(i int) []string {
+			j := st.Analysis[i]
+			return []string{fmt.Sprintf("started %s", j.Started.Format(time.DateTime))}
+		}
+		return t
+	case PanelBudgets:
+		t := table{head: "PROCESS\tTICKS/S\tMEAN\tP95\tHEAP MiB\tGC/S\tGOROUTINES\tOVER"}
+		if len(m.Sources.Metrics) == 0 {
+			t.summary = "no metrics; pass -metrics with the /metrics URLs of processes, such as stt generate -metrics"
+			return t
+		}
+		b := m.Sources.Budgets
+		t.summary = fmt.Sprintf("budgets: tick p95 %s, heap %s", limit(b.TickMs, "ms"), limit(b.HeapMiB, " MiB"))
+		for _, p := range st.Budgets {
+			if p.Tick == nil {
+				t.rows = append(t.rows, fmt.Sprintf("%s\t-\t-\t-\t-\t-\t-\t", p.URL))
+				continue
+			}
+			tk := p.Tick
+			t.rows = append(t.rows, fmt.Sprintf("%s\t%.0f\t%.2fms\t%.2fms\t%.1f\t%.1f\t%d\t%s", p.URL, tk.TickRate,
+				tk.TickMeanMs, tk.TickP95Ms, tk.HeapInuseMiB, tk.GCRate, tk.Goroutines, strings.Join(p.Over, ",")))
+		}
+		t.details = func(i int) []string {
+			tk := st.Budgets[i].Tick
+			if tk == nil {
+				return []string{"waiting for a second scrape"}
+			}
+			out := []string{fmt.Sprintf("heap allocated %.1f MiB, gc paused %.2fms", tk.HeapAllocMiB, tk.GCPauseMs)}
+			if len(tk.Markers) > 0 {
+				out = append(out, "markers "+strings.Join(tk.Markers, ", "))
+			}
+			return out
+		}
+		return t
+	default:
+		t := table{head: "ROOM\tSTATE\tHOST\tPEERS\tSPECTATORS\tMATCHES\tMESSAGES\tBYTES"}
+		if m.Sources.Relay == "" {
+			t.summary = "no relay; pass -relay or run stt serve relay where discovery finds it"
+			return t
+		}
+		peers := 0
+		for _, r := range st.Rooms {
+			peers += len(r.Peers)
+		}
+		t.summary = fmt.Sprintf("%d rooms, %d peers", len(st.Rooms), peers)
+		for _, r := range st.Rooms {
+			t.rows = append(t.rows, fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d", r.Code, r.State, dash(r.Host),
+				len(r.Peers), len(r.Spectators), r.Matches, r.Messages, r.Bytes))
+		}
+		t.details = func(i int) []string {
+			var out []string
+			for _, p := range st.Rooms[i].Peers {
+				out = append(out, fmt.Sprintf("%s from %s, joined %s ago, ready %t, sent %d, received %d", p.Name,
+					dash(p.Addr), st.At.Sub(p.Joined).Round(time.Second), p.Ready, p.Sent, p.Received))
+			}
+			if len(out) == 0 {
+				out = []string{"no peers"}
+			}
+			return out
+		}
+		return t
+	}
+}
+
+// Render draws the panel in view for a terminal of width by height
+// characters, its last line the keys' help; a height of 0 draws every
+// row and no help, for printing
+func (m *Model) Render(w io.Writer, width, height int) {
+	t := m.table()
+	var tabs []string
+	for i, p := range Panels {
+		if i == m.Panel {
+			p = "[" + p + "]"
+		}
+		tabs = append(tabs, fmt.Sprintf("%d %s", i+1, p))
+	}
+	lines := []string{fmt.Sprintf("%s   updated %s", strings.Join(tabs, "  "), m.Status.At.Format(time.TimeOnly)), t.summary}
+	if err := m.Status.Errors[Panels[m.Panel]]; err != nil {
+		lines = append(lines, "error: "+err.Error())
+	}
+	lines = append(lines, "")
+
+	var details []string
+	if m.Open && t.details != nil && len(t.rows) > 0 {
+		details = append([]string{""}, t.details(m.Rows[m.Panel])...)
+	}
+	const help = "←→ panel  ↑↓ row  enter details  r refresh  q quit"
+	// the rows that fit under the head, scrolled to the selection
+	fit := len(t.rows)
+	if height > 0 {
+		fit = max(1, height-len(lines)-len(details)-2)
+	}
+	sel := m.Rows[m.Panel]
+	first := max(0, min(sel-fit/2, len(t.rows)-fit))
+	last := min(len(t.rows), first+fit)
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  "+t.head)
+	for i := first; i < last; i++ {
+		mark := "  "
+		if i == sel {
+			mark = "> "
+		}
+		fmt.Fprintln(tw, mark+t.rows[i])
+	}
+	tw.Flush()
+	lines = append(lines, strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")...)
+	if len(t.rows) == 0 && t.summary != "" {
+		lines = append(lines, "  nothing to show")
+	}
+	for _, d := range details {
+		lines = append(lines, "    "+d)
+	}
+	if height > 0 {
+		for len(lines) < height-1 {
+			lines = append(lines, "")
+		}
+		lines = append(lines[:min(len(lines), height-1)], help)
+	}
+
+	for i, l := range lines {
+		if utf8.RuneCountInString(l) > width {
+			l = string([]rune(l)[:max(0, width)])
+		}
+		if i < len(lines)-1 || height <= 0 {
+			l += "\n"
+		}
+		fmt.Fprint(w, l)
+	}
+}
+
+// dash stands in for an empty cell
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// limit is a budget as shown, unset when 0
+func limit(v float64, unit string) string {
+	if v <= 0 {
+		return "unset"
+	}
+	return fmt.Sprintf("%.4g%s", v, unit)
+}
+
+// compact is a job's JSON on one line
+func compact(data json.RawMessage) string {
+	var buf bytes.Buffer
+	if json.Compact(&buf, data) != nil {
+		return string(data)
+	}
+	return buf.String()
+}
@@ -0,0 +1,202 @@
+// Package tui is a terminal dashboard of the work running on a test
+// server: the job queue's generation, analysis and simulation batches,
+// the analysis jobs analyze -serve is running, the profiler budgets of
+// processes serving metrics, and the relay's rooms. A Poller reads them
+// all at once into a Status, and a Model lays it out as panels to move
+// through with the keyboard.
+package tui
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/admin"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/api"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/jobqueue"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/relay"
+)
+
+// Panels, in the order the dashboard tabs through them
+const (
+	PanelJobs     = "jobs"
+	PanelAnalysis = "analysis"
+	PanelBudgets  = "budgets"
+	PanelRooms    = "rooms"
+)
+
+// Panels lists them
+var Panels = [...]string{PanelJobs, PanelAnalysis, PanelBudgets, PanelRooms}
+
+// DefaultJobs is how many of the newest jobs the jobs panel lists
+const DefaultJobs = 50
+
+// Sources are the servers a Poller reads; a panel whose source is left
+// empty says so instead of showing anything
+type Sources struct {
+	Jobs     string           // job queue, such as http://host:8103
+	Analysis string           // analyze -serve, for its admin API's analysis jobs
+	Relay    string           // relay, for its admin API's rooms
+	Metrics  []string         // /metrics URLs of processes held to the budgets, such as a generate -metrics batch
+	Budgets  profiler.Budgets // the config's; bandwidth isn't checked, a scrape doesn't say how many players share it
+	Limit    int              // jobs listed; 0 for DefaultJobs
+}
+
+// Status is one poll of every source
+type Status struct {
+	At       time.Time
+	Queue    *jobqueue.Status
+	Jobs     []jobqueue.Job // newest first
+	Workers  []jobqueue.Worker
+	Analysis []api.Job // oldest first
+	Budgets  []Budget  // in the order of Sources.Metrics
+	Rooms    []relay.Room
+	Errors   map[string]error // by panel, of the last poll
+}
+
+// Budget is a process's ticks and heap against the budgets, over the
+// interval between its last two scrapes
+type Budget struct {
+	URL  string
+	Tick *profiler.DashboardPoint // nil before two scrapes
+	Over []string                 // budgets exceeded: profiler.BudgetTick or BudgetHeap
+}
+
+// Poller reads the sources, keeping each process's last scrape to time
+// its ticks against
+type Poller struct {
+	src      Sources
+	jobs     *jobqueue.Client
+	analysis *admin.Client
+	relay    *admin.Client
+	scrapes  []func() (profiler.MetricsSnapshot, error)
+	watchers []*profiler.Watcher
+}
+
+// NewPoller reads src
+func NewPoller(src Sources) (*Poller, error) {
+	p := &Poller{src: src}
+	var err error
+	if src.Jobs != "" {
+		if p.jobs, err = jobqueue.NewClient(src.Jobs); err != nil {
+			return nil, err
+		}
+	}
+	if src.Analysis != "" {
+		if p.analysis, err = admin.NewClient(src.Analysis); err != nil {
+			return nil, err
+		}
+	}
+	if src.Relay != "" {
+		if p.relay, err = admin.NewClient(src.Relay); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range src.Metrics {
+		p.scrapes = append(p.scrapes, profiler.ScrapeSource(u))
+		p.watchers = append(p.watchers, profiler.NewWatcher())
+	}
+	return p, nil
+}
+
+// Sources are what the poller reads
+func (p *Poller) Sources() Sources {
+	return p.src
+}
+
+// Poll reads every source at once, waiting for each until ctx is done
+func (p *Poller) Poll(ctx context.Context) Status {
+	st := Status{At: time.Now(), Errors: make(map[string]error)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	run := func(panel string, read func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := read(); err != nil {
+				mu.Lock()
+				st.Errors[panel] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	if p.jobs != nil {
+		run(PanelJobs, func() error {
+			queue, err := p.jobs.Status(ctx)
+			if err != nil {
+				return err
+			}
+			limit := p.src.Limit
+			if limit <= 0 {
+				limit = DefaultJobs
+			}
+			jobs, err := p.jobs.Jobs(ctx, jobqueue.Filter{Limit: limit})
+			if err != nil {
+				return err
+			}
+			workers, err := p.jobs.Workers(ctx)
+			if err != nil {
+				return err
+			}
+			sort.Slice(workers, func(i, j int) bool { return workers[i].Name < workers[j].Name })
+			mu.Lock()
+			st.Queue, st.Jobs, st.Workers = &queue, jobs, workers
+			mu.Unlock()
+			return nil
+		})
+	}
+	if p.analysis != nil {
+		run(PanelAnalysis, func() error {
+			var jobs []api.Job
+			if err := p.analysis.Do(ctx, http.MethodGet, "jobs", nil, &jobs); err != nil {
+				return err
+			}
+			mu.Lock()
+			st.Analysis = jobs
+			mu.Unlock()
+			return nil
+		})
+	}
+	if p.relay != nil {
+		run(PanelRooms, func() error {
+			var rooms []relay.Room
+			if err := p.relay.Do(ctx, http.MethodGet, "rooms", nil, &rooms); err != nil {
+				return err
+			}
+			mu.Lock()
+			st.Rooms = rooms
+			mu.Unlock()
+			return nil
+		})
+	}
+	if len(p.scrapes) > 0 {
+		st.Budgets = make([]Budget, len(p.scrapes))
+		for i := range p.scrapes {
+			i := i
+			run(PanelBudgets, func() error {
+				s, err := p.scrapes[i]()
+				if err == nil {
+					p.watchers[i].Scrape(s)
+				}
+				b := Budget{URL: p.src.Metrics[i], Tick: p.watchers[i].View(0).Tick}
+				if t := b.Tick; t != nil {
+					if limit := p.src.Budgets.TickMs; limit > 0 && t.TickP95Ms > limit {
+						b.Over = append(b.Over, profiler.BudgetTick)
+					}
+					if limit := p.src.Budgets.HeapMiB; limit > 0 && t.HeapInuseMiB > limit {
+						b.Over = append(b.Over, profiler.BudgetHeap)
+					}
+				}
+				mu.Lock()
+				st.Budgets[i] = b
+				mu.Unlock()
+				return err
+			})
+		}
+	}
+	wg.Wait()
+	return st
+}
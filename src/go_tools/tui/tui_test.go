@@ -0,0 +1,126 @@
+package tui
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/admin"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/jobqueue"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/profiler"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/relay"
+)
+
+func TestParseKeys(t *testing.T) {
+	got := ParseKeys([]byte("j\x1b[A\x1b[6~\tq\x1b\r\x1b[99x"))
+	want := []string{"j", KeyUp, KeyPageDown, KeyTab, "q", KeyEsc, KeyEnter}
+	if !slices.Equal(got, want) {
+		t.Errorf("keys = %q, want %q", got, want)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	ctx := context.Background()
+	q, err := jobqueue.Open(":memory:", jobqueue.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	queue := httptest.NewServer(jobqueue.NewServer(q))
+	defer queue.Close()
+	c, err := jobqueue.NewClient(queue.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []string{"generate", "analyze"} {
+		if _, err := c.Submit(ctx, kind, map[string]int{"count": 3}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rs := relay.NewServer(relay.Options{})
+	api := admin.New("relay", nil)
+	rs.RegisterAdmin(api)
+	relaySrv := httptest.NewServer(admin.Mount(api, rs))
+	defer relaySrv.Close()
+	room, err := relay.OpenRoom(ctx, relaySrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live := profiler.NewLiveMetrics()
+	metrics := httptest.NewServer(live)
+	defer metrics.Close()
+
+	src := Sources{Jobs: queue.URL, Relay: relaySrv.URL, Metrics: []string{metrics.URL},
+		Budgets: profiler.Budgets{TickMs: 10}}
+	p, err := NewPoller(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Poll(ctx)
+	live.ObserveTick(50 * time.Millisecond)
+	st := p.Poll(ctx)
+	if len(st.Errors) > 0 {
+		t.Fatalf("poll errors: %v", st.Errors)
+	}
+	if len(st.Jobs) != 2 || st.Queue.Jobs[jobqueue.StatusQueued] != 2 {
+		t.Errorf("jobs %+v, queue %+v", st.Jobs, st.Queue)
+	}
+	if len(st.Rooms) != 1 || st.Rooms[0].Code != room.Code {
+		t.Errorf("rooms = %+v, want %s", st.Rooms, room.Code)
+	}
+	if len(st.Budgets) != 1 || !slices.Equal(st.Budgets[0].Over, []string{profiler.BudgetTick}) {
+		t.Errorf("budgets = %+v, want the tick budget over", st.Budgets)
+	}
+
+	m := &Model{Sources: src}
+	m.SetStatus(st)
+	var out strings.Builder
+	m.Render(&out, 120, 20)
+	// newest first: the analyze job selected, its payload opened
+	if lines := strings.Split(out.String(), "\n"); len(lines) != 20 || !strings.Contains(strings.Join(strings.Fields(out.String()), " "), "> 2 analyze queued 0/3") {
+		t.Errorf("%d lines:\n%s", len(lines), out.String())
+	}
+	for _, k := range []string{KeyDown, KeyDown, KeyEnter} {
+		if a := m.Key(k); a != ActionNone {
+			t.Errorf("key %s asked to %s", k, a)
+		}
+	}
+	if m.Rows[0] != 1 || !m.Open {
+		t.Errorf("row %d, open %t after down, down and enter on two jobs", m.Rows[0], m.Open)
+	}
+	out.Reset()
+	m.Render(&out, 120, 20)
+	if !strings.Contains(out.String(), `payload {"count":3}`) {
+		t.Errorf("no payload in the details:\n%s", out.String())
+	}
+
+	m.Key("4")
+	if m.Open {
+		t.Error("details stayed open on another panel")
+	}
+	out.Reset()
+	m.Render(&out, 120, 0)
+	if !strings.Contains(out.String(), "> "+room.Code) || strings.Contains(out.String(), "q quit") {
+		t.Errorf("rooms panel:\n%s", out.String())
+	}
+	m.Key(KeyLeft)
+	out.Reset()
+	m.Render(&out, 120, 0)
+	if !strings.Contains(out.String(), "tick") || !strings.Contains(out.String(), "budgets: tick p95 10ms, heap unset") {
+		t.Errorf("budgets panel:\n%s", out.String())
+	}
+	m.Key(KeyLeft)
+	out.Reset()
+	m.Render(&out, 120, 0)
+	if !strings.Contains(out.String(), "no analysis server") {
+		t.Errorf("analysis panel without a source:\n%s", out.String())
+	}
+	if m.Key("r") != ActionRefresh || m.Key("q") != ActionQuit {
+		t.Error("r and q don't refresh and quit")
+	}
+}
@@ -1,12 +1,33 @@
 package utils
 
-// Config represents the configuration for the development tools
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config represents the configuration for the development tools. Settings
+// holding a secret are tagged secret:"true", for crash bundles to leave out.
 type Config struct {
 	// General settings
-	WorkingDirectory string `json:"workingDirectory"`
-	LogLevel         string `json:"logLevel"`
-	AutoSave         bool   `json:"autoSave"`
-	AutoSaveInterval int    `json:"autoSaveInterval"` // in seconds
+	WorkingDirectory string            `json:"workingDirectory"`
+	LogLevel         string            `json:"logLevel"`
+	LogFormat        string            `json:"logFormat"`      // console or json
+	LogModules       map[string]string `json:"logModules"`     // levels of modules, such as relay or jobqueue, logging at other than logLevel
+	LogFile          string            `json:"logFile"`        // file in the working directory logged to as well as stderr, rotated by size; empty for none
+	LogMaxSizeMiB    int               `json:"logMaxSizeMiB"`  // size the log file is rotated at
+	LogMaxFiles      int               `json:"logMaxFiles"`    // rotated log files kept
+	Locale           string            `json:"locale"`         // language of messages and reports, en or ru
+	CrashDir         string            `json:"crashDir"`       // directory in the working directory a tool that panics writes its crash bundle to: the stack, the log's tail, this config without its secrets and the documents it had open
+	CrashReportURL   string            `json:"crashReportUrl"` // endpoint crash bundles are POSTed to as zips as well; empty keeps them local
+	AutoSave         bool              `json:"autoSave"`
+	AutoSaveInterval int               `json:"autoSaveInterval"` // in seconds
+	ScoringFile      string            `json:"scoringFile"`      // JSON scoring table the simulation, and so bots, replay checks and the analyzer's scoring economy, score by; empty for the game's own
+	SpellsFile       string            `json:"spellsFile"`       // JSON spell definitions, shaped like the game's spells.json, the simulation resolves casts by; empty for the game's own
+	PlayRulesFile    string            `json:"playRulesFile"`    // JSON rules of play, a gravity curve, lock delay, handling, hold and preview, the simulation plays a mode by; empty for the game's own
+	BotSpellsFile    string            `json:"botSpellsFile"`    // JSON spell policy, when bots grab pickups and cast their spells, the bot estimators and batches play by; empty for bot.DefaultSpellPolicy
+	AttackFile       string            `json:"attackFile"`       // JSON versus attack table the garbage of bot matches and tournaments is sent by; empty for the game's own
+	PluginsDir       string            `json:"pluginsDir"`       // directory of plugin executables providing generators, analysis passes and editor tools
 
 	// Editor settings
 	EditorTheme      string `json:"editorTheme"`
@@ -17,28 +38,143 @@ type Config struct {
 	DefaultBlockSize int    `json:"defaultBlockSize"`
 
 	// Generator settings
+	GeneratorMode        string  `json:"generatorMode"` // standard, coop, mirror, identical or tutorial
 	GeneratorSeed        int64   `json:"generatorSeed"`
+	GeneratorRNG         string  `json:"generatorRNG"`    // xoshiro or math
+	GeneratorPlugin      string  `json:"generatorPlugin"` // a plugin generator building levels in place of generatorMode's; empty for the built-in ones
 	DifficultyLevel      int     `json:"difficultyLevel"`
+	TargetDifficulty     float64 `json:"targetDifficulty"`    // 0..1, 0 derives it from DifficultyLevel
+	DifficultyEstimator  string  `json:"difficultyEstimator"` // model, the analyzer's, bot, beam bots' clear rates, or rollout, a bot's clear times
+	EstimatorRollouts    int     `json:"estimatorRollouts"`   // games the rollout estimator plays of a candidate, 0 for bot.DefaultRollouts
+	CandidatesPerLevel   int     `json:"candidatesPerLevel"`  // levels tried per output level
+	LevelTimeBudget      int     `json:"levelTimeBudget"`     // in milliseconds, 0 disables
 	MinBlocks            int     `json:"minBlocks"`
 	MaxBlocks            int     `json:"maxBlocks"`
-	SymmetryProbability  float64 `json:"symmetryProbability"`
+	SymmetryXProbability float64 `json:"symmetryXProbability"` // left-right mirrored terrain
+	SymmetryYProbability float64 `json:"symmetryYProbability"` // columns read the same top to bottom
+	SymmetryAccents      int     `json:"symmetryAccents"`      // deliberate breaks in symmetric terrain
 	SpecialBlockChance   float64 `json:"specialBlockChance"`
 	GenerateSpellPickups bool    `json:"generateSpellPickups"`
+	LevelWidth           int     `json:"levelWidth"` // per player in versus modes
+	LevelHeight          int     `json:"levelHeight"`
+	RulesFile            string  `json:"rulesFile"`       // designer rules, see generator.ParseRules
+	PieceRandomizer      string  `json:"pieceRandomizer"` // bag7, bag14, classic or history
+	FixedPieceCount      int     `json:"fixedPieceCount"` // >0 embeds a fixed queue for puzzle levels
+
+	// Pickup rules
+	PickupRules PickupRules `json:"pickupRules"`
 
 	// Analyzer settings
-	AnalysisDepth        int  `json:"analysisDepth"`
-	GenerateHeatmaps     bool `json:"generateHeatmaps"`
-	AnalyzeBlockPatterns bool `json:"analyzeBlockPatterns"`
-	AnalyzePlayerStats   bool `json:"analyzePlayerStats"`
-	AnalyzeGameBalance   bool `json:"analyzeGameBalance"`
+	AnalysisDepth           int               `json:"analysisDepth"`
+	GenerateHeatmaps        bool              `json:"generateHeatmaps"`
+	AnalyzeBlockPatterns    bool              `json:"analyzeBlockPatterns"`
+	AnalyzePlayerStats      bool              `json:"analyzePlayerStats"`
+	RatingSystem            string            `json:"ratingSystem"` // elo or glicko2
+	EloK                    float64           `json:"eloK"`
+	RatingsFile             string            `json:"ratingsFile"`    // rating ledger with history, rebuilt on every run
+	ClientEventLog          string            `json:"clientEventLog"` // client event log for funnel and retention analysis, JSON lines
+	CheatMaxInputsPerSecond float64           `json:"cheatMaxInputsPerSecond"`
+	CheatMinReactionMs      int64             `json:"cheatMinReactionMs"`
+	ExperimentMetric        string            `json:"experimentMetric"` // A/B winner metric: completion_rate, top_out_rate or score
+	ExperimentConfidence    float64           `json:"experimentConfidence"`
+	PlaystyleClusters       int               `json:"playstyleClusters"`  // k for player playstyle clustering
+	ExportFormats           []string          `json:"exportFormats"`      // analysis tables are written as csv and/or parquet
+	ResultsDB               string            `json:"resultsDb"`          // SQLite database each analysis run is appended to
+	RegressionMinDelta      float64           `json:"regressionMinDelta"` // smallest win rate change between versions flagged by -regressions
+	RegressionAlpha         float64           `json:"regressionAlpha"`
+	RegressionMinTrials     int               `json:"regressionMinTrials"`         // games a metric needs in both versions to be compared
+	Anonymize               map[string]string `json:"anonymize"`                   // replay field (player_id, player_name, address, chat) to keep, hash or strip on load
+	AnonymizeSalt           string            `json:"anonymizeSalt" secret:"true"` // secret mixed into hashed fields
+	AnalysisCache           string            `json:"analysisCache"`               // directory of cached per-file results, empty disables caching
+	AnalysisWorkers         int               `json:"analysisWorkers"`             // files processed in parallel, 0 for one per CPU
+	AnalysisPasses          []string          `json:"analysisPasses"`              // registered passes to run, empty runs all
+	PassCommands            []PassCommand     `json:"passCommands"`                // external programs run as analysis passes
+	AnalyzeGameBalance      bool              `json:"analyzeGameBalance"`
+	ReplayDir               string            `json:"replayDir"`
+	ReportDir               string            `json:"reportDir"`
+	ReportTemplates         []string          `json:"reportTemplates"`       // Go template files rendered into the report directory alongside balance.html
+	HeatmapFormat           string            `json:"heatmapFormat"`         // png or svg
+	HeatmapColorMap         string            `json:"heatmapColorMap"`       // heat, gray, viridis or blues
+	HeatmapDiffColorMap     string            `json:"heatmapDiffColorMap"`   // for cohort differences, diverging by default
+	HeatmapCellSize         int               `json:"heatmapCellSize"`       // in pixels
+	PatternSize             int               `json:"patternSize"`           // side of the mined window in cells
+	PatternMinOccurrences   int               `json:"patternMinOccurrences"` // report patterns seen at least this often
+	SolveMaxPieces          int               `json:"solveMaxPieces"`        // deepest witness -solve searches for
+	SolveMaxNodes           int               `json:"solveMaxNodes"`         // board states -solve explores per level before giving up
 
 	// Profiler settings
-	ProfilerSamplingRate int    `json:"profilerSamplingRate"` // in milliseconds
-	ProfilerOutputFormat string `json:"profilerOutputFormat"`
-	ProfileMemory        bool   `json:"profileMemory"`
-	ProfileCPU           bool   `json:"profileCPU"`
-	ProfileNetwork       bool   `json:"profileNetwork"`
-	ProfilePhysics       bool   `json:"profilePhysics"`
+	ProfilerSamplingRate     int     `json:"profilerSamplingRate"` // base stack sampling interval under -profile, in milliseconds; 0 turns it off
+	ProfilerCPUBudget        float64 `json:"profilerCPUBudget"`    // share of a CPU stack sampling may use, slowing down past it and speeding up while cheap; 0 keeps the rate fixed
+	ProfilerOutputFormat     string  `json:"profilerOutputFormat"` // sampled stacks as json, folded, speedscope or svg, binary for a compact dump appended to as the run goes, or chrome-trace for a trace of the physics, network and generator tracks with them
+	ProfileMemory            bool    `json:"profileMemory"`
+	ProfileCPU               bool    `json:"profileCPU"`
+	ProfileNetwork           bool    `json:"profileNetwork"`                  // record message sizes, serialization time and round trips of connections
+	ProfilePhysics           bool    `json:"profilePhysics"`                  // time collision, integration, settling and spell phases of physics steps
+	ProfileIO                bool    `json:"profileIO"`                       // time level loads and saves and replay reads and writes under -profile
+	ProfileDir               string  `json:"profileDir"`                      // .pb.gz profiles written by -profile
+	ProfileHeapInterval      int     `json:"profileHeapInterval"`             // seconds between heap snapshots for leak detection under -profile; 0 turns it off
+	ProfileGoroutineInterval int     `json:"profileGoroutineInterval"`        // seconds between goroutine counts by stack for leak detection under -profile; 0 turns it off
+	ProfileAllocInterval     int     `json:"profileAllocInterval"`            // seconds between reads of what each allocation site has allocated, for per-tick hot paths under -profile; 0 turns it off
+	ProfileContention        bool    `json:"profileContention"`               // record lock contention and blocking as mutex and block profiles under -profile, as for high player count load tests
+	ProfileContinuous        bool    `json:"profileContinuous"`               // always capture a few seconds of stacks a minute into profileDir/continuous, rolled up hourly after a day
+	ProfileRetentionDays     int     `json:"profileRetentionDays"`            // days continuous profiles are kept
+	BudgetTickMs             float64 `json:"budgetTickMs"`                    // longest a frame or simulation tick may take; alerts, and fails a batch, when exceeded; 0 leaves it unchecked
+	BudgetHeapMiB            float64 `json:"budgetHeapMiB"`                   // heap in use allowed; 0 leaves it unchecked
+	BudgetBandwidthKiBps     float64 `json:"budgetBandwidthKiBps"`            // network traffic a second per connected player, both ways; 0 leaves it unchecked
+	ProfileAgentToken        string  `json:"profileAgentToken" secret:"true"` // bearer token profile attach presents to analyze -serve's profiling agent; empty falls back to SUPERTETRIS_PROFILE_TOKEN, and without that the agent is off
+
+	// Tool server settings
+	PackDir            string `json:"packDir"`            // level packs serve packs exposes, as pack/version/ generator batches
+	PackPublishURL     string `json:"packPublishUrl"`     // packs server publish uploads releases to, such as http://HOST:8096
+	PackRegistry       string `json:"packRegistry"`       // local record of the releases publish made, for rollbacks and the next version
+	PackKeysFile       string `json:"packKeysFile"`       // pack signing keys, laid out as serve replaykey -file writes them: pack -sign signs with the newest, and serve packs and pack -fetch and -verify refuse packs not signed by one; empty takes unsigned packs
+	LeaderboardStorage string `json:"leaderboardStorage"` // memory, sqlite:PATH or redis://HOST:PORT/DB, served by analyze -serve; empty for none
+	LeaderboardSeason  string `json:"leaderboardSeason"`  // all, weekly or monthly: how often boards start over
+	ReplayStoreDir     string `json:"replayStoreDir"`     // replays serve replays keeps, deduplicated by content hash
+	TelemetryDB        string `json:"telemetryDb"`        // results database serve telemetry and stt telemetry store client events in, which analyze reads with -events sqlite:PATH; empty for resultsDb
+	TelemetryBatchSize int    `json:"telemetryBatchSize"` // client events buffered before they're stored; 0 for telemetry.DefaultBatchSize
+	TelemetryFlushSecs int    `json:"telemetryFlushSecs"` // longest serve telemetry buffers an event before storing it; 0 for telemetry.DefaultFlushInterval
+	JobQueueDB         string `json:"jobQueueDb"`         // SQLite database serve jobs keeps the batch job queue in
+	JobQueueURL        string `json:"jobQueueUrl"`        // job queue the jobs tool submits to and works for, such as http://HOST:8103; empty finds one by LAN discovery
+	AuthTokensFile     string `json:"authTokensFile"`     // API tokens every tool server requires, as serve token writes them; empty leaves the servers open to anyone who reaches them
+	ReplayKeysFile     string `json:"replayKeysFile"`     // replay signing keys, as serve replaykey writes them: replays recorded are signed and replays uploaded, analyzed or backing a score must verify; empty takes unsigned replays
+
+	// Rate limit settings, for the tool servers
+	RateLimitTokenRate  float64 `json:"rateLimitTokenRate"`  // requests a second each API token may make of a tool server, WebSocket connections and gRPC calls included; 0 leaves tokens unlimited
+	RateLimitTokenBurst int     `json:"rateLimitTokenBurst"` // requests a token may make at once before its rate applies; 0 for one second's worth
+	RateLimitIPRate     float64 `json:"rateLimitIpRate"`     // requests a second each client address may make of a tool server, with or without a token; 0 leaves addresses unlimited
+	RateLimitIPBurst    int     `json:"rateLimitIpBurst"`    // requests an address may make at once; 0 for one second's worth
+	RateLimitTrustProxy bool    `json:"rateLimitTrustProxy"` // take client addresses from X-Forwarded-For, for servers behind a reverse proxy; otherwise anyone could claim any address
+	RateLimitProxyHops  int     `json:"rateLimitProxyHops"`  // reverse proxies in front, each adding an X-Forwarded-For hop; the client's address is the hop the outermost added; 0 for one
+
+	// Latency probe settings
+	ProbeRegions []ProbeRegion `json:"probeRegions"` // game server regions probe measures the round trip to
+
+	// TLS settings, for the tool servers
+	TLSEnabled      bool   `json:"tlsEnabled"`      // serve over TLS, for playtests on networks that aren't trusted; clients then need https:// and wss:// URLs
+	TLSCertFile     string `json:"tlsCertFile"`     // PEM certificate served; with neither it nor tlsKeyFile, a dev certificate is issued under tlsDevDir
+	TLSKeyFile      string `json:"tlsKeyFile"`      // its PEM key
+	TLSDevDir       string `json:"tlsDevDir"`       // where the dev CA and the server certificate it issues are kept; clients trust its ca.pem through SUPERTETRIS_TLS_CA
+	TLSClientCAFile string `json:"tlsClientCaFile"` // PEM CAs client certificates must be signed by, for mutual TLS; the dev CA's ca.pem for those serve cert issues; empty asks for none
+
+	// Discovery settings
+	DiscoveryAddr      string `json:"discoveryAddr"`      // UDP multicast group and port of LAN discovery, which the tool servers answer on and tools browse to find them without a host and port
+	DiscoveryAdvertise bool   `json:"discoveryAdvertise"` // tool servers listening beyond loopback answer discovery queries
+
+	// Notification settings
+	Webhooks           []Webhook `json:"webhooks"`           // told when generation batches, analysis runs and profiling runs end
+	WebhookArtifactURL string    `json:"webhookArtifactUrl"` // base URL the working directory is served under, so webhooks link artifacts; empty sends their paths
+
+	// Scheduler settings
+	Schedules []Schedule `json:"schedules"` // periodic tasks stt schedule runs, in place of cron entries
+
+	// Benchmark settings
+	BenchBaseline       string  `json:"benchBaseline"`       // stt bench's baseline, recorded with -save, that its runs must keep within the thresholds of
+	BenchTimeThreshold  float64 `json:"benchTimeThreshold"`  // rise in a workload's time over the baseline stt bench fails on, as a fraction
+	BenchAllocThreshold float64 `json:"benchAllocThreshold"` // rise in its allocations or bytes allocated, likewise
+
+	// Tracing settings
+	TracingEndpoint string `json:"tracingEndpoint"` // OTLP/HTTP collector spans are exported to, such as http://localhost:4318; empty falls back to OTEL_EXPORTER_OTLP_ENDPOINT, and without that tracing is off
 }
 
 // DefaultConfig returns a default configuration
@@ -47,8 +183,20 @@ func DefaultConfig() Config {
 		// General settings
 		WorkingDirectory: ".",
 		LogLevel:         "info",
+		LogFormat:        "console",
+		LogModules:       nil,
+		LogFile:          "",
+		LogMaxSizeMiB:    10,
+		LogMaxFiles:      5,
+		CrashDir:         "crashes",
+		CrashReportURL:   "",
+		Locale:           "en",
 		AutoSave:         true,
 		AutoSaveInterval: 300, // 5 minutes
+		ScoringFile:      "",
+		SpellsFile:       "",
+		PlayRulesFile:    "",
+		PluginsDir:       "plugins",
 
 		// Editor settings
 		EditorTheme:      "dark",
@@ -59,27 +207,243 @@ func DefaultConfig() Config {
 		DefaultBlockSize: 32,
 
 		// Generator settings
+		GeneratorMode:        "standard",
 		GeneratorSeed:        0, // 0 means use current time
+		GeneratorRNG:         "xoshiro",
+		GeneratorPlugin:      "",
 		DifficultyLevel:      2, // Medium difficulty
+		TargetDifficulty:     0,
+		DifficultyEstimator:  "model",
+		EstimatorRollouts:    0,
+		CandidatesPerLevel:   4,
+		LevelTimeBudget:      2000,
 		MinBlocks:            10,
 		MaxBlocks:            50,
-		SymmetryProbability:  0.3,
+		SymmetryXProbability: 0.3,
+		SymmetryYProbability: 0.1,
+		SymmetryAccents:      2,
 		SpecialBlockChance:   0.1,
 		GenerateSpellPickups: true,
+		LevelWidth:           10,
+		LevelHeight:          20,
+		RulesFile:            "",
+		PieceRandomizer:      "bag7",
+		FixedPieceCount:      0,
+
+		// Pickup rules
+		PickupRules: DefaultPickupRules(),
 
 		// Analyzer settings
-		AnalysisDepth:        3,
-		GenerateHeatmaps:     true,
-		AnalyzeBlockPatterns: true,
-		AnalyzePlayerStats:   true,
-		AnalyzeGameBalance:   true,
+		AnalysisDepth:           3,
+		GenerateHeatmaps:        true,
+		AnalyzeBlockPatterns:    true,
+		PatternSize:             3,
+		PatternMinOccurrences:   4,
+		SolveMaxPieces:          40,
+		SolveMaxNodes:           200000,
+		AnalyzePlayerStats:      true,
+		RatingSystem:            "glicko2",
+		EloK:                    32,
+		RatingsFile:             "data/reports/ratings.json",
+		ClientEventLog:          "",
+		CheatMaxInputsPerSecond: 35,
+		CheatMinReactionMs:      100,
+		ExperimentMetric:        "completion_rate",
+		ExperimentConfidence:    0.95,
+		PlaystyleClusters:       4,
+		ExportFormats:           []string{"csv"},
+		ResultsDB:               "data/reports/results.db",
+		RegressionMinDelta:      0.05,
+		RegressionAlpha:         0.01,
+		RegressionMinTrials:     30,
+		AnalysisCache:           "data/reports/cache",
+		AnalysisWorkers:         0,
+		AnalysisPasses:          nil,
+		PassCommands:            nil,
+		AnalyzeGameBalance:      true,
+		ReplayDir:               "data/replays",
+		ReportDir:               "data/reports",
+		HeatmapFormat:           "png",
+		HeatmapColorMap:         "heat",
+		HeatmapDiffColorMap:     "diverging",
+		HeatmapCellSize:         16,
 
 		// Profiler settings
-		ProfilerSamplingRate: 100,
-		ProfilerOutputFormat: "json",
-		ProfileMemory:        true,
-		ProfileCPU:           true,
-		ProfileNetwork:       true,
-		ProfilePhysics:       true,
+		ProfilerSamplingRate:     100,
+		ProfilerCPUBudget:        0.01,
+		ProfilerOutputFormat:     "json",
+		ProfileMemory:            true,
+		ProfileCPU:               true,
+		ProfileNetwork:           true,
+		ProfilePhysics:           true,
+		ProfileIO:                true,
+		ProfileDir:               "data/profiles",
+		ProfileHeapInterval:      10,
+		ProfileGoroutineInterval: 10,
+		ProfileAllocInterval:     10,
+		ProfileContinuous:        false,
+		ProfileRetentionDays:     14,
+		BudgetTickMs:             0,
+		BudgetHeapMiB:            0,
+		BudgetBandwidthKiBps:     0,
+		ProfileAgentToken:        "",
+
+		// Tool server settings
+		PackDir:            "data/packs",
+		PackPublishURL:     "",
+		PackRegistry:       "data/pack-releases.json",
+		PackKeysFile:       "",
+		LeaderboardStorage: "memory",
+		LeaderboardSeason:  "all",
+		ReplayStoreDir:     "data/replaystore",
+		TelemetryDB:        "",
+		TelemetryBatchSize: 500,
+		TelemetryFlushSecs: 5,
+		JobQueueDB:         "data/jobs.db",
+		JobQueueURL:        "",
+		AuthTokensFile:     "",
+		ReplayKeysFile:     "",
+
+		// Rate limit settings
+		RateLimitTokenRate:  0,
+		RateLimitTokenBurst: 0,
+		RateLimitIPRate:     0,
+		RateLimitIPBurst:    0,
+		RateLimitTrustProxy: false,
+		RateLimitProxyHops:  1,
+
+		// TLS settings
+		TLSEnabled:      false,
+		TLSCertFile:     "",
+		TLSKeyFile:      "",
+		TLSDevDir:       "data/tls",
+		TLSClientCAFile: "",
+
+		// Discovery settings
+		DiscoveryAddr:      "239.255.83.84:8199",
+		DiscoveryAdvertise: true,
+
+		// Benchmark settings
+		BenchBaseline:       "data/bench/baseline.json",
+		BenchTimeThreshold:  0.15,
+		BenchAllocThreshold: 0.02,
+
+		// Tracing settings
+		TracingEndpoint: "",
+	}
+}
+
+// PickupRules limits how many spell pickups of each category a generated
+// level may contain, both overall and within any single region
+type PickupRules struct {
+	PickupsPerLevel int            `json:"pickupsPerLevel"`
+	MaxPerLevel     map[string]int `json:"maxPerLevel"`  // keyed by spell category
+	MaxPerRegion    map[string]int `json:"maxPerRegion"` // keyed by spell category
+	RegionSize      int            `json:"regionSize"`   // region edge length in cells
+}
+
+// ProbeRegion is a game server region's WebSocket endpoint, such as a
+// relay's ws://HOST:8097/ping, named as the matchmaking simulator names
+// the region
+type ProbeRegion struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Webhook is an endpoint told about the tools' long jobs as they end, see
+// notify.Notifier
+type Webhook struct {
+	URL    string   `json:"url"`
+	Format string   `json:"format"` // slack, discord or json, the payload as is
+	Jobs   []string `json:"jobs"`   // generate, analyze or profile; empty for all
+	On     []string `json:"on"`     // succeeded or failed; empty for both
+}
+
+// Schedule is a task stt schedule runs when its cron spec says
+type Schedule struct {
+	Name   string   `json:"name"`
+	Cron   string   `json:"cron"`   // minute hour day-of-month month day-of-week, as cron's, or @hourly, @daily, @weekly, @monthly or @every DURATION, in local time
+	Task   string   `json:"task"`   // generate or analyze, run with Args; prune-profiles, of profileDir past profileRetentionDays; or sweep, of Args' globs
+	Args   []string `json:"args"`   // generate's or analyze's flags, with {date} and {time} the run's, or sweep's globs
+	MaxAge string   `json:"maxAge"` // sweep: how old a file must be to go, such as 168h
+}
+
+// PassCommand is an external analysis pass: Command reads the Requires
+// inputs as JSON on stdin and writes result tables as JSON to stdout, see
+// analyzer.CommandPass
+type PassCommand struct {
+	Name     string   `json:"name"`
+	Command  []string `json:"command"`
+	Requires []string `json:"requires"` // levels, replays or client_events
+}
+
+// DefaultPickupRules returns pickup rules suitable for versus play
+func DefaultPickupRules() PickupRules {
+	return PickupRules{
+		PickupsPerLevel: 6,
+		MaxPerLevel: map[string]int{
+			"offense": 3,
+			"defense": 3,
+			"utility": 2,
+		},
+		MaxPerRegion: map[string]int{
+			"offense": 1,
+			"defense": 2,
+			"utility": 1,
+		},
+		RegionSize: 5,
+	}
+}
+
+// LoadConfig reads a JSON config file; fields missing from the file keep
+// their default values
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	// Configs written before the per-axis split only carry symmetryProbability
+	var legacy struct {
+		SymmetryProbability  *float64 `json:"symmetryProbability"`
+		SymmetryXProbability *float64 `json:"symmetryXProbability"`
+	}
+	if err := json.Unmarshal(data, &legacy); err == nil && legacy.SymmetryProbability != nil && legacy.SymmetryXProbability == nil {
+		config.SymmetryXProbability = *legacy.SymmetryProbability
+	}
+	return config, nil
+}
+
+// ApplyConfigPatch overlays a partial config file, such as the analyzer's
+// generator tuning suggestions, on config
+func ApplyConfigPatch(config Config, path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if config, err = PatchConfig(config, data); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// PatchConfig overlays a partial JSON config on config
+func PatchConfig(config Config, data []byte) (Config, error) {
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parse config patch: %w", err)
+	}
+	return config, nil
+}
+
+// SaveConfig writes the config as indented JSON
+func SaveConfig(path string, config Config) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(path, data, 0644)
 }
@@ -0,0 +1,24 @@
+package validation
+
+import (
+	"net/http"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/openapi"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// DescribeAPI adds the validator's endpoints to a server's OpenAPI
+// document
+func (s *Server) DescribeAPI(spec *openapi.Spec) {
+	id := map[string]string{"id": "the game's, as opening it answered"}
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/validate", Summary: "the verdict on a replay's every move",
+		Body: replay.Replay{}, Reply: analyzer.Verdict{}})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/games", Summary: "open a game",
+		Body: GameRequest{}, Status: http.StatusCreated, Reply: GameState{}})
+	spec.Add(openapi.Op{Method: http.MethodGet, Path: "/games/{id}", Summary: "the game's boards", Params: id, Reply: GameState{}})
+	spec.Add(openapi.Op{Method: http.MethodPost, Path: "/games/{id}/moves",
+		Summary: "apply events in order until one is rejected, 422 with the rejection if one is; a lone event needn't be in a list",
+		Params:  id, Body: []replay.Event{}, Reply: MovesResult{}})
+	spec.Add(openapi.Op{Method: http.MethodDelete, Path: "/games/{id}", Summary: "close the game", Params: id, Status: http.StatusNoContent})
+}
@@ -0,0 +1,297 @@
+// Package validation serves the analyzer's move validation over HTTP, so
+// a game server can keep an authoritative copy of each game outside its
+// own process, and a tool can check a submitted replay, without linking
+// the analyzer
+package validation
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/replay"
+)
+
+// maxBodyBytes bounds a request's replay or moves
+const maxBodyBytes = 32 << 20
+
+// Defaults for Options left zero
+const (
+	DefaultMaxGames    = 10000
+	DefaultIdleTimeout = time.Hour
+)
+
+// Options tune a Server
+type Options struct {
+	Fallback    level.GridSize // board size for levels not loaded
+	Validate    analyzer.ValidateOptions
+	MaxGames    int           // open at once
+	IdleTimeout time.Duration // a game sent nothing this long is closed to make room
+}
+
+// Server validates moves against the levels of a dataset:
+//
+//	POST   /validate           a replay; the Verdict on its every move
+//	POST   /games              open a game: {"level":, "players": [], "pieces": []}
+//	GET    /games/{id}         the game's boards
+//	POST   /games/{id}/moves   an event, or a list of them, applied in order
+//	DELETE /games/{id}         close the game
+//
+// Moves are applied until one is rejected; the answer counts the moves
+// accepted and is 422 with the Rejection when one was. A game without
+// pieces is dealt its level's, or any piece for levels not loaded.
+type Server struct {
+	data *analyzer.Dataset
+	opts Options
+
+	mu    sync.Mutex
+	games map[string]*game
+}
+
+type game struct {
+	mu      sync.Mutex
+	g       *analyzer.Game
+	level   string
+	players []string
+	used    time.Time
+}
+
+// NewServer validates against the dataset's levels
+func NewServer(data *analyzer.Dataset, opts Options) *Server {
+	if opts.MaxGames <= 0 {
+		opts.MaxGames = DefaultMaxGames
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+	return &Server{data: data, opts: opts, games: make(map[string]*game)}
+}
+
+// GameRequest opens a game
+type GameRequest struct {
+	Level   string   `json:"level"`
+	Players []string `json:"players"`
+	Pieces  []string `json:"pieces,omitempty"` // dealt each player, in order
+}
+
+// GameState describes an open game
+type GameState struct {
+	ID      string              `json:"id"`
+	Level   string              `json:"level"`
+	Players []string            `json:"players"`
+	Boards  map[string][]string `json:"boards"` // per player, a row a string, # for a block
+}
+
+// MovesResult answers submitted moves
+type MovesResult struct {
+	Accepted  int                 `json:"accepted"`
+	Rejection *analyzer.Rejection `json:"rejection,omitempty"`
+}
+
+// ServeHTTP routes the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "validate":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		s.validate(w, r)
+	case len(parts) == 1 && parts[0] == "games":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		s.open(w, r)
+	case len(parts) == 2 && parts[0] == "games":
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.describe(w, parts[1], http.StatusOK)
+		case http.MethodDelete:
+			s.mu.Lock()
+			_, ok := s.games[parts[1]]
+			delete(s.games, parts[1])
+			s.mu.Unlock()
+			if !ok {
+				httpError(w, http.StatusNotFound, "no game %s", parts[1])
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+	case len(parts) == 3 && parts[0] == "games" && parts[2] == "moves":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		s.moves(w, r, parts[1])
+	default:
+		httpError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+	}
+}
+
+func (s *Server) validate(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		httpError(w, http.StatusRequestEntityTooLarge, "read replay: %v", err)
+		return
+	}
+	rp, err := replay.Parse(bytes.NewReader(data))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	v, err := s.data.ValidateReplay(rp, s.opts.Fallback, s.opts.Validate)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (s *Server) open(w http.ResponseWriter, r *http.Request) {
+	var req GameRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&req); err != nil {
+		httpError(w, http.StatusBadRequest, "read game: %v", err)
+		return
+	}
+	var g *analyzer.Game
+	var err error
+	if lvl := s.data.Levels[req.Level]; lvl != nil && len(req.Pieces) == 0 {
+		g, err = analyzer.NewGame(lvl, req.Players, s.opts.Validate)
+	} else {
+		rp := &replay.Replay{Level: req.Level, Pieces: req.Pieces}
+		for _, p := range req.Players {
+			rp.Players = append(rp.Players, replay.Player{ID: p})
+		}
+		g, err = s.data.NewReplayGame(rp, s.opts.Fallback, s.opts.Validate)
+	}
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	id, err := s.add(&game{g: g, level: req.Level, players: req.Players, used: time.Now()})
+	if err != nil {
+		httpError(w, http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	w.Header().Set("Location", "/games/"+id)
+	s.describe(w, id, http.StatusCreated)
+}
+
+// add keeps a game under a fresh ID, closing idle games to make room
+func (s *Server) add(g *game) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.games) >= s.opts.MaxGames {
+		for id, other := range s.games {
+			if other.idle() > s.opts.IdleTimeout {
+				delete(s.games, id)
+			}
+		}
+		if len(s.games) >= s.opts.MaxGames {
+			return "", fmt.Errorf("%d games open, none idle", len(s.games))
+		}
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	s.games[id] = g
+	return id, nil
+}
+
+func (g *game) idle() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return time.Since(g.used)
+}
+
+func (s *Server) game(id string) (*game, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.games[id]
+	return g, ok
+}
+
+func (s *Server) describe(w http.ResponseWriter, id string, status int) {
+	g, ok := s.game(id)
+	if !ok {
+		httpError(w, http.StatusNotFound, "no game %s", id)
+		return
+	}
+	g.mu.Lock()
+	st := GameState{ID: id, Level: g.level, Players: g.players, Boards: make(map[string][]string, len(g.players))}
+	for _, p := range g.players {
+		st.Boards[p], _ = g.g.Rows(p)
+	}
+	g.mu.Unlock()
+	writeJSON(w, status, st)
+}
+
+func (s *Server) moves(w http.ResponseWriter, r *http.Request, id string) {
+	g, ok := s.game(id)
+	if !ok {
+		httpError(w, http.StatusNotFound, "no game %s", id)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		httpError(w, http.StatusRequestEntityTooLarge, "read moves: %v", err)
+		return
+	}
+	var events []replay.Event
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &events)
+	} else {
+		var ev replay.Event
+		err = json.Unmarshal(data, &ev)
+		events = []replay.Event{ev}
+	}
+	if err != nil {
+		httpError(w, http.StatusBadRequest, "read moves: %v", err)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.used = time.Now()
+	var res MovesResult
+	for _, ev := range events {
+		err := g.g.Submit(ev)
+		var rej *analyzer.Rejection
+		if errors.As(err, &rej) {
+			res.Rejection = rej
+			writeJSON(w, http.StatusUnprocessableEntity, res)
+			return
+		}
+		res.Accepted++
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
@@ -0,0 +1,78 @@
+package validation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/analyzer"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/level"
+)
+
+func post(t *testing.T, url, body string, v any) int {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		json.NewDecoder(resp.Body).Decode(v)
+	}
+	return resp.StatusCode
+}
+
+func TestServerValidatesMoves(t *testing.T) {
+	srv := httptest.NewServer(NewServer(analyzer.NewDataset(), Options{Fallback: level.GridSize{Width: 6, Height: 6}}))
+	defer srv.Close()
+
+	var game GameState
+	if code := post(t, srv.URL+"/games", `{"level":"any","players":["p"],"pieces":["I","O"]}`, &game); code != http.StatusCreated || game.ID == "" {
+		t.Fatalf("open: %d %+v", code, game)
+	}
+	var res MovesResult
+	code := post(t, srv.URL+"/games/"+game.ID+"/moves", `[
+		{"frame":1,"player":"p","type":"lock","piece":"I","x":0,"y":4},
+		{"frame":2,"player":"p","type":"lock","piece":"I","x":0,"y":3}
+	]`, &res)
+	if code != http.StatusUnprocessableEntity || res.Accepted != 1 || res.Rejection == nil || res.Rejection.Reason != analyzer.RejectWrongPiece {
+		t.Errorf("moves: %d %+v", code, res)
+	}
+	if code := post(t, srv.URL+"/games/"+game.ID+"/moves", `{"frame":2,"player":"p","type":"lock","piece":"O","x":4,"y":4}`, &res); code != http.StatusOK || res.Accepted != 1 {
+		t.Errorf("move: %d %+v", code, res)
+	}
+
+	resp, err := http.Get(srv.URL + "/games/" + game.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&game)
+	resp.Body.Close()
+	if rows := game.Boards["p"]; len(rows) != 6 || rows[4] != "......" || rows[5] != "....##" { // the bottom row cleared
+		t.Errorf("board = %q", rows)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/games/"+game.ID, nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Errorf("close: %v %v", resp, err)
+	}
+	if code := post(t, srv.URL+"/games/"+game.ID+"/moves", `{}`, nil); code != http.StatusNotFound {
+		t.Errorf("moves of a closed game: %d", code)
+	}
+}
+
+func TestServerValidatesReplays(t *testing.T) {
+	srv := httptest.NewServer(NewServer(analyzer.NewDataset(), Options{Fallback: level.GridSize{Width: 6, Height: 6}}))
+	defer srv.Close()
+	var v analyzer.Verdict
+	code := post(t, srv.URL+"/validate", `{"version":1,"sessionId":"s","level":"l","players":[{"id":"p"}],
+		"events":[{"frame":1,"player":"p","type":"lock","piece":"O","x":0,"y":0}],"result":{"durationMs":10}}`, &v)
+	if code != http.StatusOK || v.Valid || len(v.Rejections) != 1 || v.Rejections[0].Reason != analyzer.RejectFloating {
+		t.Errorf("verdict: %d %+v", code, v)
+	}
+	if code := post(t, srv.URL+"/validate", `not a replay`, nil); code != http.StatusBadRequest {
+		t.Errorf("garbage: %d", code)
+	}
+}
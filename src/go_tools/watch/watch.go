@@ -0,0 +1,234 @@
+// Package watch polls files and directories for changes, for the tools'
+// -watch modes. A burst of saves, or a batch of replays landing, is
+// debounced into one list of changes.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Defaults of Options
+const (
+	DefaultInterval = 500 * time.Millisecond
+	DefaultDebounce = time.Second
+)
+
+// Ops of a Change
+const (
+	Added    = "added"
+	Modified = "modified"
+	Removed  = "removed"
+)
+
+// Change is a file added, modified or removed since the last scan
+type Change struct {
+	Path string
+	Op   string
+}
+
+// Options time a Watcher's Run
+type Options struct {
+	Interval time.Duration // between scans; 0 for DefaultInterval
+	Debounce time.Duration // quiet after a change before it is reported; 0 for DefaultDebounce
+}
+
+// stamp is what a scan notices of a file
+type stamp struct {
+	mod  time.Time
+	size int64
+}
+
+// Watcher is the files under its paths as last scanned
+type Watcher struct {
+	paths   []string
+	exclude []string
+	files   map[string]stamp
+}
+
+// New watches paths, files or the directories they're under; a path that
+// doesn't exist yet is watched for. Files under exclude, such as a
+// pipeline's outputs, are left out, as are hidden files and editors'
+// backups.
+func New(paths, exclude []string) *Watcher {
+	w := &Watcher{}
+	for _, p := range paths {
+		if p != "" {
+			w.paths = append(w.paths, filepath.Clean(p))
+		}
+	}
+	for _, p := range exclude {
+		if p != "" {
+			w.exclude = append(w.exclude, filepath.Clean(p))
+		}
+	}
+	w.files = w.scan()
+	return w
+}
+
+// Paths are the paths watched
+func (w *Watcher) Paths() []string {
+	return w.paths
+}
+
+// Files is how many files the last scan found
+func (w *Watcher) Files() int {
+	return len(w.files)
+}
+
+func (w *Watcher) scan() map[string]stamp {
+	files := make(map[string]stamp)
+	for _, root := range w.paths {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || w.excluded(path) {
+				if d != nil && d.IsDir() && path != root {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if path != root && ignored(d.Name()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			files[path] = stamp{mod: info.ModTime(), size: info.Size()}
+			return nil
+		})
+	}
+	return files
+}
+
+func (w *Watcher) excluded(path string) bool {
+	for _, e := range w.exclude {
+		if path == e || strings.HasPrefix(path, e+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored are hidden files and editors' backups and swap files
+func ignored(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") || strings.HasSuffix(name, ".swp")
+}
+
+// Scan rescans the paths, returning what changed since the last scan by
+// path
+func (w *Watcher) Scan() []Change {
+	files := w.scan()
+	var changes []Change
+	for path, s := range files {
+		if was, ok := w.files[path]; !ok {
+			changes = append(changes, Change{Path: path, Op: Added})
+		} else if !was.mod.Equal(s.mod) || was.size != s.size {
+			changes = append(changes, Change{Path: path, Op: Modified})
+		}
+	}
+	for path := range w.files {
+		if _, ok := files[path]; !ok {
+			changes = append(changes, Change{Path: path, Op: Removed})
+		}
+	}
+	w.files = files
+	sortChanges(changes)
+	return changes
+}
+
+// Run scans every interval until ctx is done, calling fn with the changes
+// once a debounce passes without more; fn's changes are merged by path,
+// a file added and removed again not among them
+func (w *Watcher) Run(ctx context.Context, o Options, fn func([]Change)) {
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.Debounce <= 0 {
+		o.Debounce = DefaultDebounce
+	}
+	tick := time.NewTicker(o.Interval)
+	defer tick.Stop()
+	pending := make(map[string]string)
+	var last time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			if changes := w.Scan(); len(changes) > 0 {
+				for _, c := range changes {
+					merge(pending, c)
+				}
+				last = now
+			}
+			if len(pending) == 0 || now.Sub(last) < o.Debounce {
+				// nothing to report, or the burst isn't over
+				continue
+			}
+			changes := make([]Change, 0, len(pending))
+			for path, op := range pending {
+				changes = append(changes, Change{Path: path, Op: op})
+			}
+			sortChanges(changes)
+			clear(pending)
+			fn(changes)
+		}
+	}
+}
+
+// merge folds c into the ops pending by path
+func merge(pending map[string]string, c Change) {
+	was, ok := pending[c.Path]
+	switch {
+	case !ok:
+		pending[c.Path] = c.Op
+	case was == Added && c.Op == Removed:
+		delete(pending, c.Path)
+	case was == Added:
+		// still new to whoever runs on it
+	case was == Removed && c.Op == Added:
+		pending[c.Path] = Modified
+	default:
+		pending[c.Path] = c.Op
+	}
+}
+
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+}
+
+// Summary says what changed in a line: how many files by op, and the
+// first of them
+func Summary(changes []Change) string {
+	const shown = 5
+	counts := make(map[string]int)
+	var names []string
+	for i, c := range changes {
+		counts[c.Op]++
+		if i < shown {
+			names = append(names, c.Path)
+		}
+	}
+	var ops []string
+	for _, op := range []string{Added, Modified, Removed} {
+		if n := counts[op]; n > 0 {
+			ops = append(ops, fmt.Sprintf("%d %s", n, op))
+		}
+	}
+	s := fmt.Sprintf("%s: %s", strings.Join(ops, ", "), strings.Join(names, ", "))
+	if len(changes) > shown {
+		s += fmt.Sprintf(" and %d more", len(changes)-shown)
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	replays := filepath.Join(dir, "replays")
+	out := filepath.Join(replays, "reports")
+	write(t, config, "{}")
+	write(t, filepath.Join(replays, "a.json"), "a")
+	write(t, filepath.Join(replays, "b.json"), "b")
+
+	w := New([]string{config, replays, filepath.Join(dir, "rules.json")}, []string{out})
+	if w.Files() != 3 {
+		t.Fatalf("%d files at first", w.Files())
+	}
+	write(t, config, `{"logLevel": "debug"}`)
+	os.Remove(filepath.Join(replays, "a.json"))
+	write(t, filepath.Join(replays, "c.json"), "c")
+	write(t, filepath.Join(replays, ".c.json.swp"), "editing")
+	write(t, filepath.Join(replays, "c.json~"), "backup")
+	write(t, filepath.Join(out, "balance.html"), "output")
+	write(t, filepath.Join(dir, "rules.json"), "[]")
+	got := w.Scan()
+	want := []Change{{config, Modified}, {filepath.Join(replays, "a.json"), Removed}, {filepath.Join(replays, "c.json"), Added}, {filepath.Join(dir, "rules.json"), Added}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes\n%v, want\n%v", got, want)
+	}
+	if changes := w.Scan(); len(changes) != 0 {
+		t.Errorf("changes %v on a scan after", changes)
+	}
+	if s := Summary(want); s != "2 added, 1 modified, 1 removed: "+config+", "+want[1].Path+", "+want[2].Path+", "+want[3].Path {
+		t.Errorf("summary %q", s)
+	}
+}
+
+func TestRunDebounces(t *testing.T) {
+	dir := t.TempDir()
+	w := New([]string{dir}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	batches := make(chan []Change, 10)
+	go w.Run(ctx, Options{Interval: 10 * time.Millisecond, Debounce: 150 * time.Millisecond}, func(c []Change) { batches <- c })
+
+	// a burst of saves, one of them a temporary file gone again
+	for i, name := range []string{"a.json", "b.json", "tmp.json", "a.json"} {
+		write(t, filepath.Join(dir, name), string(rune('0'+i)))
+		time.Sleep(20 * time.Millisecond)
+	}
+	os.Remove(filepath.Join(dir, "tmp.json"))
+	select {
+	case got := <-batches:
+		want := []Change{{filepath.Join(dir, "a.json"), Added}, {filepath.Join(dir, "b.json"), Added}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("batch %v, want %v", got, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("no batch")
+	}
+	select {
+	case got := <-batches:
+		t.Errorf("a second batch %v for one burst", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
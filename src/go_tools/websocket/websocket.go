@@ -0,0 +1,388 @@
+// Package websocket implements the RFC 6455 WebSocket protocol the tools'
+// live views and relays speak: the opening handshake for servers and
+// clients and a message-oriented connection over it. Extensions and
+// subprotocols are not negotiated.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message opcodes
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	closeMessage  = 8
+	pingMessage   = 9
+	pongMessage   = 10
+)
+
+// DefaultReadLimit caps a message's size unless the connection sets its own
+const DefaultReadLimit = 1 << 20
+
+// acceptGUID is mixed into the handshake key, per the RFC
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrClosed is returned by reads once either side has closed the connection
+var ErrClosed = errors.New("websocket: connection closed")
+
+// Conn is an open WebSocket connection. One goroutine may read while
+// others write.
+type Conn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool // clients mask what they send
+
+	// ReadLimit caps incoming messages; larger ones fail the read
+	ReadLimit int64
+
+	// PongHandler, if set, is called from ReadMessage with each pong's
+	// payload, answering a WritePing
+	PongHandler func(payload []byte)
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+// Upgrade answers a WebSocket opening handshake and takes over the
+// request's connection; on failure it has already written an HTTP error
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "use GET", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("websocket: handshake with %s", r.Method)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !hasToken(r.Header, "Connection", "upgrade") || !hasToken(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "expected a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("websocket: not a handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("websocket: response can't be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	return &Conn{conn: conn, br: rw.Reader, ReadLimit: DefaultReadLimit}, nil
+}
+
+// Dial opens a client connection to a ws:// or http:// URL, or over TLS
+// to a wss:// or https:// one; header adds request headers, such as
+// authorization, and may be nil
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, error) {
+	return DialTLS(ctx, rawURL, header, nil)
+}
+
+// DialTLS is Dial with the TLS config of a wss:// or https:// URL, such
+// as one trusting a dev CA or presenting a client certificate; nil for
+// the defaults
+func DialTLS(ctx context.Context, rawURL string, header http.Header, cfg *tls.Config) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	port := "80"
+	switch u.Scheme {
+	case "ws", "http":
+		u.Scheme = "http"
+	case "wss", "https":
+		u.Scheme, port = "https", "443"
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			cfg.ServerName = u.Hostname()
+		}
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req := &http.Request{Method: http.MethodGet, URL: u, Host: u.Host, Header: http.Header{}}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("websocket: handshake with %s failed: %s", rawURL, resp.Status)
+	}
+	return &Conn{conn: conn, br: br, client: true, ReadLimit: DefaultReadLimit}, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// hasToken reports whether a comma-separated header lists token
+func hasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteMessage sends one text or binary message
+func (c *Conn) WriteMessage(op int, data []byte) error {
+	if op != TextMessage && op != BinaryMessage {
+		return fmt.Errorf("websocket: can't send opcode %d as a message", op)
+	}
+	return c.writeFrame(op, data)
+}
+
+// WriteText sends a text message
+func (c *Conn) WriteText(s string) error {
+	return c.writeFrame(TextMessage, []byte(s))
+}
+
+// WritePing sends a ping, which the other side answers with a pong of the
+// same payload, at most 125 bytes
+func (c *Conn) WritePing(payload []byte) error {
+	if len(payload) > 125 {
+		return fmt.Errorf("websocket: ping payload of %d bytes, over 125", len(payload))
+	}
+	return c.writeFrame(pingMessage, payload)
+}
+
+func (c *Conn) writeFrame(op int, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | byte(op) // a single, final frame
+	switch n := len(data); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if c.client {
+		header[1] |= 0x80
+		var mask [4]byte
+		rand.Read(mask[:])
+		header = append(header, mask[:]...)
+		masked := make([]byte, len(data))
+		for i, b := range data {
+			masked[i] = b ^ mask[i%4]
+		}
+		data = masked
+	}
+	if _, err := c.conn.Write(append(header, data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings
+// and the other side's close along the way
+func (c *Conn) ReadMessage() (op int, data []byte, err error) {
+	for {
+		fin, frameOp, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch frameOp {
+		case pingMessage:
+			if err := c.writeFrame(pongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case pongMessage:
+			if c.PongHandler != nil {
+				c.PongHandler(payload)
+			}
+			continue
+		case closeMessage:
+			c.closeWith(payload)
+			return 0, nil, ErrClosed
+		case TextMessage, BinaryMessage:
+			if op != 0 {
+				return 0, nil, c.fail("new message inside a fragmented one")
+			}
+			op = frameOp
+		case 0:
+			if op == 0 {
+				return 0, nil, c.fail("continuation without a message")
+			}
+		default:
+			return 0, nil, c.fail(fmt.Sprintf("unknown opcode %d", frameOp))
+		}
+		if int64(len(data)+len(payload)) > c.ReadLimit {
+			return 0, nil, c.fail("message too large")
+		}
+		data = append(data, payload...)
+		if fin {
+			return op, data, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (fin bool, op int, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, c.readErr(err)
+	}
+	fin, op = head[0]&0x80 != 0, int(head[0]&0x0f)
+	masked := head[1]&0x80 != 0
+	if masked == c.client {
+		return false, 0, nil, c.fail("frame masked the wrong way")
+	}
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, c.readErr(err)
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, c.readErr(err)
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= closeMessage && (n > 125 || !fin) {
+		return false, 0, nil, c.fail("malformed control frame")
+	}
+	if n > uint64(c.ReadLimit) {
+		return false, 0, nil, c.fail("message too large")
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, c.readErr(err)
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, c.readErr(err)
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+func (c *Conn) readErr(err error) error {
+	c.wmu.Lock()
+	closed := c.closed
+	c.wmu.Unlock()
+	if closed || errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+		return ErrClosed
+	}
+	return err
+}
+
+// fail closes the connection as a protocol error
+func (c *Conn) fail(reason string) error {
+	c.closeWith(closePayload(1002, reason))
+	return fmt.Errorf("websocket: %s", reason)
+}
+
+// Close sends a normal close and shuts the connection
+func (c *Conn) Close() error {
+	return c.closeWith(closePayload(1000, ""))
+}
+
+func (c *Conn) closeWith(payload []byte) error {
+	c.writeFrame(closeMessage, payload)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+func closePayload(code uint16, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, code), reason...)
+}
+
+// SetReadDeadline bounds the next reads, as net.Conn's does
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// RemoteAddr is the other side's address
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoServer sends every message back until the client closes
+func echoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			op, data, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.WriteMessage(op, data); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dial(t *testing.T, srv *httptest.Server) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEcho(t *testing.T) {
+	c := dial(t, echoServer(t))
+	defer c.Close()
+	for _, msg := range [][]byte{[]byte("hello"), bytes.Repeat([]byte("x"), 300), bytes.Repeat([]byte("y"), 70000)} {
+		if err := c.WriteMessage(BinaryMessage, msg); err != nil {
+			t.Fatal(err)
+		}
+		op, got, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op != BinaryMessage || !bytes.Equal(got, msg) {
+			t.Errorf("echo of %d bytes: op %d, %d bytes", len(msg), op, len(got))
+		}
+	}
+	var pongs []string
+	c.PongHandler = func(payload []byte) { pongs = append(pongs, string(payload)) }
+	if err := c.WritePing([]byte("p")); err != nil {
+		t.Fatal(err)
+	}
+	c.WriteText("after ping")
+	if _, got, err := c.ReadMessage(); err != nil || string(got) != "after ping" {
+		t.Errorf("after a ping: %q, %v", got, err)
+	}
+	if len(pongs) != 1 || pongs[0] != "p" {
+		t.Errorf("pongs = %q, want the ping's payload", pongs)
+	}
+	if c.WritePing(bytes.Repeat([]byte("p"), 126)) == nil {
+		t.Error("sent a ping over 125 bytes")
+	}
+}
+
+func TestCloseAndLimits(t *testing.T) {
+	srv := echoServer(t)
+	c := dial(t, srv)
+	c.Close()
+	if _, _, err := c.ReadMessage(); !errors.Is(err, ErrClosed) {
+		t.Errorf("read after close: %v", err)
+	}
+	if err := c.WriteText("late"); !errors.Is(err, ErrClosed) {
+		t.Errorf("write after close: %v", err)
+	}
+
+	c = dial(t, srv)
+	defer c.Close()
+	c.ReadLimit = 10
+	c.WriteText(strings.Repeat("z", 11))
+	if _, _, err := c.ReadMessage(); err == nil || errors.Is(err, ErrClosed) {
+		t.Errorf("oversized message: %v", err)
+	}
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain GET: %s", resp.Status)
+	}
+}
@@ -0,0 +1,260 @@
+package wirecap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/auth"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/certs"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+// PlayOptions tune a playback to a relay
+type PlayOptions struct {
+	Room  string  // to join; empty for the capture's
+	Speed float64 // of the playback, 2 for twice as fast; 0 for 1
+}
+
+// PlayStats counts what a playback did
+type PlayStats struct {
+	Joined   int   `json:"joined"`   // connections the peers made
+	Sent     int   `json:"sent"`     // messages
+	Failed   int   `json:"failed"`   // messages the relay had disconnected their peer for
+	Received int64 `json:"received"` // messages the relay sent the peers
+}
+
+// Play plays a capture to the relay at baseURL, such as
+// http://host:8097: each of the capture's peers joins the room as it
+// did, with the query it did, and sends its messages in the recorded
+// order and at the recorded pace, and leaves when it left. The relay's
+// part, its events and what it relayed, is left to the relay. The token
+// of auth.TokenEnv, if set, is presented on joining.
+func Play(ctx context.Context, c *Capture, baseURL string, opts PlayOptions) (PlayStats, error) {
+	room := opts.Room
+	if room == "" {
+		room = c.Room
+	}
+	var st PlayStats
+	var received atomic.Int64
+	var wg sync.WaitGroup
+	conns := map[string]*websocket.Conn{}
+	finish := func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		wg.Wait()
+		st.Received = received.Load()
+	}
+
+	start := time.Now()
+	for _, rec := range c.Records {
+		if err := waitUntil(ctx, start.Add(scale(rec.Time.Sub(c.Started), opts.Speed))); err != nil {
+			finish()
+			return st, err
+		}
+		switch rec.Kind {
+		case KindJoin:
+			if old := conns[rec.Peer]; old != nil {
+				old.Close()
+			}
+			conn, err := join(ctx, baseURL, room, rec)
+			if err != nil {
+				delete(conns, rec.Peer)
+				finish()
+				return st, fmt.Errorf("join room %s as %s: %w", room, rec.Peer, err)
+			}
+			conns[rec.Peer] = conn
+			st.Joined++
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+					received.Add(1)
+				}
+			}()
+		case KindLeave:
+			if conn := conns[rec.Peer]; conn != nil {
+				conn.Close()
+				delete(conns, rec.Peer)
+			}
+		case KindMessage:
+			conn := conns[rec.Peer]
+			op, data := rec.Data()
+			if conn == nil || conn.WriteMessage(op, data) != nil {
+				st.Failed++
+				continue
+			}
+			st.Sent++
+		}
+	}
+	finish()
+	return st, nil
+}
+
+// join connects as a join record's peer, with its query
+func join(ctx context.Context, baseURL, room string, rec Record) (*websocket.Conn, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/rooms/" + url.PathEscape(room))
+	if err != nil {
+		return nil, err
+	}
+	query, _ := url.ParseQuery(rec.Query)
+	query.Set("name", rec.Peer)
+	u.RawQuery = query.Encode()
+	header := http.Header{}
+	auth.SetHeader(header, os.Getenv(auth.TokenEnv))
+	return certs.Dial(ctx, u.String(), header)
+}
+
+// Player serves a capture to a client as the relay it was recorded from:
+// a client joining /rooms/{code} as a WebSocket is sent what one of the
+// capture's peers was, the other peers' messages and, with ?events=1, the
+// room's events as game messages, or with ?events=json as the JSON text
+// they're recorded as, from when that peer joined to when it left, at the
+// recorded pace. What the client sends is read and dropped. Which peer's
+// view is played is the client's ?name=, unless the Player was made for
+// one.
+type Player struct {
+	capture *Capture
+	as      string
+	speed   float64
+}
+
+// NewPlayer plays c to clients, as peer as whatever name they join with
+// if as isn't empty, at speed, 2 for twice as fast and 0 for 1
+func NewPlayer(c *Capture, as string, speed float64) *Player {
+	return &Player{capture: c, as: as, speed: speed}
+}
+
+// ServeHTTP plays the capture to a client joining a room
+func (p *Player) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/rooms/") || r.URL.Path == "/rooms/" {
+		httpError(w, http.StatusNotFound, "a capture plays to clients joining /rooms/CODE")
+		return
+	}
+	name := p.as
+	if name == "" {
+		name = r.URL.Query().Get("name")
+	}
+	joined, recs, ok := p.view(name, r.URL.Query().Get("events"))
+	if !ok {
+		httpError(w, http.StatusNotFound, "the capture of room %s has no peer %q; it has %s",
+			p.capture.Room, name, strings.Join(p.capture.Peers(), ", "))
+		return
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sent := 0
+	start := time.Now()
+	for _, rec := range recs {
+		if waitUntil(ctx, start.Add(scale(rec.Time.Sub(joined), p.speed))) != nil {
+			break
+		}
+		op, data := rec.Data()
+		if conn.WriteMessage(op, data) != nil {
+			break
+		}
+		sent++
+	}
+	slog.Info("wirecap: played a capture to a client", "room", p.capture.Room, "as", name,
+		"client", r.RemoteAddr, "sent", sent, "of", len(recs))
+}
+
+// view is what the relay sent the peer name from its first join, when
+// that was, to its leave: the others' messages and the events it would
+// have heard, in the events format it asked for. ok is false if it never
+// joined.
+func (p *Player) view(name, events string) (joined time.Time, recs []Record, ok bool) {
+	for _, rec := range p.capture.Records {
+		switch {
+		case !ok:
+			if rec.Kind == KindJoin && rec.Peer == name {
+				joined, ok = rec.Time, true
+			}
+		case rec.Kind == KindLeave && rec.Peer == name:
+			return joined, recs, true
+		case rec.Kind == KindMessage && rec.Peer != name:
+			recs = append(recs, rec)
+		case rec.Kind == KindEvent && (rec.To == name || rec.To == "" && events != ""):
+			recs = append(recs, eventRecord(rec, events))
+		}
+	}
+	return joined, recs, ok
+}
+
+// eventRecord is a recorded event as the relay sends it in the events
+// format: a game message with a room event body, or for json the text it
+// was recorded as
+func eventRecord(rec Record, events string) Record {
+	out := Record{Time: rec.Time, Kind: KindEvent, Op: OpText, Text: rec.Text}
+	if events == "json" {
+		return out
+	}
+	var re gamepb.RoomEvent
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal([]byte(rec.Text), &re); err != nil {
+		return out
+	}
+	data, err := gamepb.Marshal(&gamepb.Message{Body: &gamepb.Message_Room{Room: &re}})
+	if err != nil {
+		return out
+	}
+	return Record{Time: rec.Time, Kind: KindEvent, Op: OpBinary, Binary: data}
+}
+
+// scale is how far into a playback at speed d into the recording comes
+func scale(d time.Duration, speed float64) time.Duration {
+	if speed <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) / speed)
+}
+
+// waitUntil waits for t, or for ctx to be done
+func waitUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func httpError(w http.ResponseWriter, status int, format string, args ...any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf(format, args...)})
+}
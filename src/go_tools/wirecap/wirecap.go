@@ -0,0 +1,292 @@
+// Package wirecap records what passes through the relay, room by room, and
+// plays a recording back: to a relay, as the peers that sent it, or to a
+// client, as the relay it came from. A networking bug seen once can then
+// be run again with the same messages in the same order at the same
+// pace, against a fixed build or under a debugger.
+package wirecap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+// Format names a capture file's format, in its header
+const Format = "supertetris-wire/1"
+
+// Kinds of record
+const (
+	KindJoin    = "join"    // a peer connected
+	KindLeave   = "leave"   // a peer was disconnected, by itself or the relay
+	KindMessage = "message" // a peer sent a message
+	KindEvent   = "event"   // the relay sent the room's peers an event
+)
+
+// Ops of a message
+const (
+	OpText   = "text"
+	OpBinary = "binary"
+)
+
+// Header is a capture file's first line
+type Header struct {
+	Format  string    `json:"format"`
+	Room    string    `json:"room"`
+	Started time.Time `json:"started"`
+}
+
+// Record is one thing that happened in a room, a line of its capture file
+type Record struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Peer   string    `json:"peer,omitempty"`   // who joined, left or sent the message
+	Addr   string    `json:"addr,omitempty"`   // where a peer joined from
+	Query  string    `json:"query,omitempty"`  // a peer joined with, such as events=1
+	To     string    `json:"to,omitempty"`     // the one peer an event went to; empty for the room's
+	Op     string    `json:"op,omitempty"`     // of a message
+	Text   string    `json:"text,omitempty"`   // a text message, or the event
+	Binary []byte    `json:"binary,omitempty"` // a binary message
+}
+
+// Message is a record of a message, text or binary by op
+func Message(peer string, op int, data []byte) Record {
+	if op == websocket.BinaryMessage {
+		return Record{Kind: KindMessage, Peer: peer, Op: OpBinary, Binary: data}
+	}
+	return Record{Kind: KindMessage, Peer: peer, Op: OpText, Text: string(data)}
+}
+
+// Data is a message record's op and payload, as the WebSocket sent them
+func (r Record) Data() (op int, data []byte) {
+	if r.Op == OpBinary {
+		return websocket.BinaryMessage, r.Binary
+	}
+	return websocket.TextMessage, []byte(r.Text)
+}
+
+// Capture is a room's recording
+type Capture struct {
+	Header
+	Records []Record
+}
+
+// Peers names the peers that joined, in the order they first did
+func (c *Capture) Peers() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, r := range c.Records {
+		if r.Kind == KindJoin && !seen[r.Peer] {
+			seen[r.Peer] = true
+			names = append(names, r.Peer)
+		}
+	}
+	return names
+}
+
+// Duration is how long the recording runs
+func (c *Capture) Duration() time.Duration {
+	if len(c.Records) == 0 {
+		return 0
+	}
+	return c.Records[len(c.Records)-1].Time.Sub(c.Started)
+}
+
+// Read reads a capture file
+func Read(r io.Reader) (*Capture, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 2*websocket.DefaultReadLimit)
+	c := &Capture{}
+	for line := 1; sc.Scan(); line++ {
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		if c.Format == "" {
+			if err := json.Unmarshal(sc.Bytes(), &c.Header); err != nil || c.Format != Format {
+				return nil, fmt.Errorf("line %d: not a %s capture", line, Format)
+			}
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		c.Records = append(c.Records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if c.Format == "" {
+		return nil, errors.New("empty capture")
+	}
+	sort.SliceStable(c.Records, func(i, j int) bool { return c.Records[i].Time.Before(c.Records[j].Time) })
+	return c, nil
+}
+
+// Load reads the capture file at path
+func Load(path string) (*Capture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Recorder writes each room's records to a file of its own in a
+// directory, named for the room's code and when it opened, such as
+// GAME-20261014-101502.123.jsonl. A record is written through as it
+// comes, so a capture survives the relay crashing. A nil Recorder
+// records nothing.
+type Recorder struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*roomFile
+	paths []string
+	err   error // the first write that failed, logged once
+}
+
+type roomFile struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewRecorder records into dir, making it if need be
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Recorder{dir: dir, files: map[string]*roomFile{}}, nil
+}
+
+// Record adds rec to the room's capture, opening it for the room's first
+// record; rec's time is now if zero
+func (c *Recorder) Record(room string, rec Record) {
+	if c == nil {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rf, ok := c.files[room]
+	if !ok {
+		var err error
+		if rf, err = c.open(room, rec.Time); err != nil {
+			c.failed(err)
+			return
+		}
+		c.files[room] = rf
+	}
+	if err := rf.enc.Encode(rec); err != nil {
+		c.failed(err)
+	}
+}
+
+// Event records an event the relay sent, to the room's peers or to just
+// one when to isn't empty
+func (c *Recorder) Event(room, to string, event any) {
+	if c == nil {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	c.Record(room, Record{Kind: KindEvent, To: to, Text: string(data)})
+}
+
+func (c *Recorder) open(room string, started time.Time) (*roomFile, error) {
+	base := filepath.Join(c.dir, fileName(room)+"-"+started.Format("20060102-150405.000"))
+	path := base + ".jsonl"
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	for n := 2; errors.Is(err, os.ErrExist); n++ {
+		path = fmt.Sprintf("%s-%d.jsonl", base, n)
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rf := &roomFile{f: f, enc: json.NewEncoder(f)}
+	if err := rf.enc.Encode(Header{Format: Format, Room: room, Started: started}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	c.paths = append(c.paths, path)
+	slog.Debug("wirecap: capturing a room", "room", room, "file", path)
+	return rf, nil
+}
+
+// fileName keeps a room's code to what's safe in a file name
+func fileName(room string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, room)
+}
+
+func (c *Recorder) failed(err error) {
+	if c.err == nil {
+		c.err = err
+		slog.Error("wirecap: capture stopped recording", "err", err)
+	}
+}
+
+// Finish closes the room's capture, when the room closes; a room opened
+// again under the code is captured to a new file
+func (c *Recorder) Finish(room string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rf, ok := c.files[room]; ok {
+		rf.f.Close()
+		delete(c.files, room)
+	}
+}
+
+// Files are the capture files written, in the order they were opened
+func (c *Recorder) Files() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.paths...)
+}
+
+// Close closes every room's capture and reports the first write that
+// failed
+func (c *Recorder) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for room, rf := range c.files {
+		if err := rf.f.Close(); err != nil && c.err == nil {
+			c.err = err
+		}
+		delete(c.files, room)
+	}
+	return c.err
+}
@@ -0,0 +1,126 @@
+package wirecap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/gamepb"
+	"github.com/ValeriaBelyaeva/SuperTetris/src/go_tools/websocket"
+)
+
+func TestRecorderWritesARoomAFile(t *testing.T) {
+	var off *Recorder
+	off.Record("GAME", Record{Kind: KindJoin, Peer: "alice"})
+	off.Finish("GAME")
+
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Record("GAME", Record{Kind: KindJoin, Peer: "alice", Query: "name=alice&events=1"})
+	rec.Record("OTHER/1", Record{Kind: KindJoin, Peer: "carol"})
+	rec.Record("GAME", Message("alice", websocket.BinaryMessage, []byte{0, 1, 2}))
+	rec.Record("GAME", Message("alice", websocket.TextMessage, []byte("move left")))
+	rec.Event("GAME", "alice", map[string]string{"event": "error"})
+	rec.Finish("GAME")
+	rec.Record("GAME", Record{Kind: KindJoin, Peer: "bob"})
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := rec.Files()
+	if len(files) != 3 || filepath.Dir(files[1]) != dir || !strings.HasPrefix(filepath.Base(files[1]), "OTHER_1-") || files[0] == files[2] {
+		t.Fatalf("files = %v", files)
+	}
+	c, err := Load(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Room != "GAME" || len(c.Records) != 4 || strings.Join(c.Peers(), ",") != "alice" {
+		t.Fatalf("capture = %+v", c)
+	}
+	if op, data := c.Records[1].Data(); op != websocket.BinaryMessage || string(data) != "\x00\x01\x02" {
+		t.Errorf("binary message read back as %d %q", op, data)
+	}
+	if op, data := c.Records[2].Data(); op != websocket.TextMessage || string(data) != "move left" {
+		t.Errorf("text message read back as %d %q", op, data)
+	}
+	if e := c.Records[3]; e.Kind != KindEvent || e.To != "alice" || e.Text != `{"event":"error"}` {
+		t.Errorf("event read back as %+v", e)
+	}
+	if c, err := Load(files[2]); err != nil || c.Peers()[0] != "bob" {
+		t.Errorf("reopened room's capture = %+v, %v", c, err)
+	}
+	if _, err := Read(strings.NewReader(`{"time":"2026-10-14T10:00:00Z","kind":"join"}`)); err == nil {
+		t.Error("a capture without a header was read")
+	}
+}
+
+func TestPlayerPlaysAPeersView(t *testing.T) {
+	start := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	at := func(ms int, r Record) Record {
+		r.Time = start.Add(time.Duration(ms) * time.Millisecond)
+		return r
+	}
+	c := &Capture{Header: Header{Format: Format, Room: "GAME", Started: start}, Records: []Record{
+		at(0, Record{Kind: KindJoin, Peer: "alice"}),
+		at(1, Record{Kind: KindEvent, Text: `{"event":"join","peer":"alice"}`}),
+		at(10, Message("alice", websocket.TextMessage, []byte("before bob"))),
+		at(20, Record{Kind: KindJoin, Peer: "bob"}),
+		at(21, Record{Kind: KindEvent, Text: `{"event":"join","peer":"bob"}`}),
+		at(30, Message("alice", websocket.BinaryMessage, []byte{7})),
+		at(40, Message("bob", websocket.TextMessage, []byte("bob's own"))),
+		at(50, Record{Kind: KindEvent, To: "alice", Text: `{"event":"error"}`}),
+		at(60, Record{Kind: KindLeave, Peer: "bob"}),
+		at(70, Message("alice", websocket.TextMessage, []byte("after bob"))),
+	}}
+	srv := httptest.NewServer(NewPlayer(c, "", 0))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	play := func(query string) (ops []int, got []string) {
+		conn, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/rooms/GAME?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.WriteText("ignored")
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			op, data, err := conn.ReadMessage()
+			if err != nil {
+				return ops, got
+			}
+			ops, got = append(ops, op), append(got, string(data))
+		}
+	}
+	if _, got := play("name=bob&events=json"); strings.Join(got, "|") != `{"event":"join","peer":"bob"}|`+"\x07" {
+		t.Errorf("bob was played %q", got)
+	}
+	ops, got := play("name=bob&events=1")
+	if len(got) != 2 || ops[0] != websocket.BinaryMessage || got[1] != "\x07" {
+		t.Fatalf("bob was played %q", got)
+	}
+	if m, err := gamepb.Unmarshal([]byte(got[0])); err != nil || m.GetRoom().GetEvent() != "join" || m.GetRoom().GetPeer() != "bob" {
+		t.Errorf("bob's join played as %v %v", m, err)
+	}
+	if _, got := play("name=bob"); strings.Join(got, "|") != "\x07" {
+		t.Errorf("bob, without events, was played %q", got)
+	}
+
+	resp, err := http.Get(srv.URL + "/rooms/GAME?name=carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("a peer not in the capture: %s", resp.Status)
+	}
+}
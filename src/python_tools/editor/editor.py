@@ -9,6 +9,8 @@ from rich.console import Console
 from rich.prompt import Prompt, Confirm
 from rich.table import Table
 
+from ..utils.validation import LEVEL_FORMAT
+
 class LevelEditor:
     def __init__(self):
         self.console = Console()
@@ -45,6 +47,7 @@ class LevelEditor:
     def create_new_level(self):
         """Create a new level"""
         self.current_level = {
+            "format": LEVEL_FORMAT,
             "name": Prompt.ask("Level name"),
             "difficulty": Prompt.ask("Difficulty", choices=["easy", "medium", "hard"]),
             "grid_size": {
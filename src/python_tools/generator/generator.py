@@ -10,6 +10,8 @@ from rich.console import Console
 from rich.prompt import Prompt, Confirm
 from rich.progress import Progress
 
+from ..utils.validation import LEVEL_FORMAT
+
 class LevelGenerator:
     def __init__(self):
         self.console = Console()
@@ -99,6 +101,7 @@ class LevelGenerator:
                 special_rules["rotation_speed"] = random.uniform(0.5, 1.5)
         
         return {
+            "format": LEVEL_FORMAT,
             "name": name,
             "difficulty": difficulty,
             "grid_size": {
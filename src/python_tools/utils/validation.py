@@ -5,6 +5,9 @@ Data Validation Utilities
 from typing import Dict, Any, List, Tuple
 from pathlib import Path
 
+# Level format the Go tools read and write; stt migrate upgrades older levels
+LEVEL_FORMAT = 1
+
 def validate_level_data(data: Dict[str, Any]) -> Tuple[bool, List[str]]:
     """
     Validate level data structure
@@ -26,6 +29,10 @@ def validate_level_data(data: Dict[str, Any]) -> Tuple[bool, List[str]]:
     if errors:
         return False, errors
     
+    # Проверка версии формата
+    if data.get("format", 0) > LEVEL_FORMAT:
+        errors.append(f"Level format {data['format']} is newer than {LEVEL_FORMAT}")
+    
     # Проверка типа сложности
     valid_difficulties = ["easy", "medium", "hard"]
     if data["difficulty"] not in valid_difficulties:
@@ -61,7 +61,9 @@ export const SPELL_ICONS: Record<SpellType, string> = {
   [SpellType.SLOW_DOWN]: '⏱️',
   [SpellType.SPEED_UP]: '⚡',
   [SpellType.ADD_BLOCKS]: '➕',
-  [SpellType.REMOVE_BLOCKS]: '➖'
+  [SpellType.REMOVE_BLOCKS]: '➖',
+  [SpellType.GRAVITY_FLIP]: '🙃',
+  [SpellType.FREEZE]: '🧊'
 };
 
 export const DEFAULT_GAME_SETTINGS: GameSettings = {
@@ -26,7 +26,9 @@ export enum SpellType {
   SLOW_DOWN = 'SLOW_DOWN',
   SPEED_UP = 'SPEED_UP',
   ADD_BLOCKS = 'ADD_BLOCKS',
-  REMOVE_BLOCKS = 'REMOVE_BLOCKS'
+  REMOVE_BLOCKS = 'REMOVE_BLOCKS',
+  GRAVITY_FLIP = 'GRAVITY_FLIP',
+  FREEZE = 'FREEZE'
 }
 
 export enum GameMode {